@@ -26,6 +26,23 @@ type (
 		NodeName   string
 		NodeRole   string
 		EdgeKeySet bool
+		Version    string
+	}
+
+	// ClusterMemberHealth is the health of an agent of the cluster, as seen through the cluster membership
+	ClusterMemberHealth struct {
+		NodeName  string
+		IPAddress string
+		NodeRole  string
+		Version   string
+		// Status is the status of the member in the cluster: alive, leaving, left or failed
+		Status string
+		// Reachable is true when the member answers the probes of the cluster
+		Reachable bool
+		LastSeen  time.Time
+		// RTTMilliseconds is the round trip time to the member estimated from the network coordinates of the
+		// cluster, 0 when unknown
+		RTTMilliseconds float64 `json:",omitempty"`
 	}
 
 	// ContainerPlatform represent the platform on which the agent is running (Docker, Kubernetes)
@@ -44,10 +61,33 @@ type (
 		NodeRole     DockerNodeRole
 	}
 
+	// DNSOverrides represents the name resolution settings injected into the stacks deployed by the agent
+	DNSOverrides struct {
+		// ExtraHosts is a list of host:ip entries
+		ExtraHosts []string
+		// DNS is a list of DNS servers
+		DNS []string
+	}
+
+	// DeploymentQuotas represents the resources the stacks deployed by the agent can use on the host, a zero
+	// value means unlimited
+	DeploymentQuotas struct {
+		MaxContainers int
+		MaxVolumes    int
+		// MaxMemory is the total memory reservation of the containers, in bytes
+		MaxMemory int64
+		// MaxCPUs is the total CPU reservation of the containers
+		MaxCPUs float64
+	}
+
 	// EdgeJobStatus represents an Edge job status
 	EdgeJobStatus struct {
 		JobID          int    `json:"JobID"`
 		LogFileContent string `json:"LogFileContent"`
+		// ExitCode is the exit code of the last run of the job, nil when the job has not run yet
+		ExitCode *int `json:"ExitCode,omitempty"`
+		// FinishedAt is the Unix time at which the last run of the job finished
+		FinishedAt int64 `json:"FinishedAt,omitempty"`
 	}
 
 	// HostInfo is the representation of the collection of host information
@@ -90,21 +130,158 @@ type (
 		SharedSecret          string
 		EdgeMode              bool
 		EdgeAsyncMode         bool
+		EdgeSnapshotDelta     bool
+		// EdgePayloadFormat is the codec of the payloads of the Edge Async mode preferred by the agent
+		EdgePayloadFormat string
+		// EdgeOfflineQueue persists the commands of the Edge Async mode and the results waiting to be sent to the
+		// server, so that they survive the restarts of the agent while the server cannot be reached
+		EdgeOfflineQueue bool
+		// EdgeHTTP2 enables HTTP/2 for the requests sent to the Portainer instance when it supports it
+		EdgeHTTP2 bool
+		// EdgeMaxIdleConns is the number of idle connections to the Portainer instance kept for reuse, the default
+		// of the HTTP transport is used when 0
+		EdgeMaxIdleConns int
+		// EdgeIdleConnTimeout is the duration after which an idle connection to the Portainer instance is closed, the
+		// default of the HTTP transport is used when 0
+		EdgeIdleConnTimeout time.Duration
+		// EdgePollTransport is the transport of the requests sent to the Portainer instance, tcp or the experimental
+		// quic
+		EdgePollTransport string
+		// EdgeServerURLs are the URLs of the Portainer instance by priority, the requests fail over to the next URL
+		// when an URL is unavailable
+		EdgeServerURLs []string
+		// EdgeServerAddressRules map the hosts of the Portainer instance to other addresses depending on the network
+		// the host is connected to, formatted as host@network=address
+		EdgeServerAddressRules []string
+		// RetentionPolicies bound the data stored by the agent on the device, formatted as
+		// category:max_age:max_size
+		RetentionPolicies []string
+		// RetentionInterval is the interval between two applications of the retention policies
+		RetentionInterval time.Duration
+		// ProvisioningSources are the sources (userdata, dmi, dhcp, url) the enrollment configuration is discovered
+		// from when no Edge key is associated to the agent, in order
+		ProvisioningSources []string
+		// ProvisioningURL is the URL of the enrollment configuration read by the url provisioning source
+		ProvisioningURL string
+		// AnomalyDetection enables the alerts on the unusual accesses to the agent API
+		AnomalyDetection bool
+		// AnomalyAuthThreshold is the number of failed authentications from a source address within a minute
+		// raising an alert
+		AnomalyAuthThreshold int
+		// AnomalyLearningPeriod is the period during which the source addresses and the endpoints of the agent API
+		// are learned without raising alerts
+		AnomalyLearningPeriod time.Duration
+		// AlertWebhookURL is the URL the alerts are sent to, empty when disabled
+		AlertWebhookURL string
+		// AlertNotifiers are the URLs of the channels the alerts are sent to: SMTP, Slack or Teams webhooks and MQTT
+		AlertNotifiers []string
+		// AlertNotifyInterval is the interval between two checks of the diagnostics raising the alerts sent to the
+		// notification channels
+		AlertNotifyInterval time.Duration
+		// ShutdownSignals are the signals on which the containers of the Edge stacks are stopped in dependency order
+		// before the host powers off, empty when disabled
+		ShutdownSignals []string
+		// ShutdownStopTimeout is the maximum duration of the stop of a container on shutdown, after which it is killed
+		ShutdownStopTimeout time.Duration
+		// ShutdownTimeout is the maximum duration of the stop of the Edge stacks on shutdown
+		ShutdownTimeout time.Duration
+		// PowerUPS is the URL of the daemon of the UPS of the host, empty when disabled
+		PowerUPS string
+		// PowerCheckInterval is the interval between two checks of the status of the UPS
+		PowerCheckInterval time.Duration
+		// PowerShedding stops the low-priority stacks while the host runs on battery
+		PowerShedding bool
+		// PowerShedDelay is the duration on battery after which the low-priority stacks are stopped
+		PowerShedDelay time.Duration
+		// NetworkPolicy enables the enforcement of the network policies of the containers with iptables
+		NetworkPolicy bool
+		// NetworkPolicyInterval is the interval between two applications of the network policies
+		NetworkPolicyInterval time.Duration
+		// PortForwardNetworks are the CIDR ranges of the targets of the port-forwards
+		PortForwardNetworks []string
+		// PortForwardMaxSessions is the maximum number of concurrent port-forward sessions
+		PortForwardMaxSessions int
+		// PortForwardMaxDuration is the maximum duration of a port-forward session
+		PortForwardMaxDuration time.Duration
+		// TPM is the use of the TPM to store the key material of the agent: auto, required or off
+		TPM string
+		// TPMDevice is the path of the TPM device, empty to use the default TPM of the platform
+		TPMDevice string
+		// StateEncryption enables the encryption of the persistent state of the agent
+		StateEncryption bool
+		// DockerBroker is the socket of the Docker broker the agent talks to instead of the Docker socket, the socket
+		// the broker listens on in broker mode, empty when the agent uses the Docker socket
+		DockerBroker string
+		// BrokerMode runs the Docker broker instead of the agent
+		BrokerMode bool
+		// BrokerUID is the user owning the socket of the broker, the user of the agent, -1 to allow every user
+		BrokerUID int
+		// WASMPluginsPath is the folder containing the WebAssembly plugins, empty when disabled
+		WASMPluginsPath string
+		// WASMPluginTimeout is the maximum duration of a call to a WebAssembly plugin
+		WASMPluginTimeout time.Duration
+		// ImageCacheAddr is the address of the registry mirror serving the cached image layers to the other hosts of
+		// the site, empty when disabled
+		ImageCacheAddr     string
+		ImageCacheUpstream string
+		// ImageCacheMaxSize is the maximum total size of the cached image layers, in bytes
+		ImageCacheMaxSize int64
+		// RelayAddr is the address of the listener relaying the Edge requests of the peers of the site, empty when
+		// disabled
+		RelayAddr string
+		// RelaySecret signs the hops of the Edge requests sent through the relays of the site
+		RelaySecret string
+		// SnapshotHistoryInterval is the interval at which a snapshot of the environment is stored, 0 when disabled
+		SnapshotHistoryInterval time.Duration
+		// HooksPath is the folder containing the local scripting hooks, empty when there is none
+		HooksPath string
+		// HooksSnapshotInterval is the interval between two snapshots passed to the scripting hooks
+		HooksSnapshotInterval time.Duration
+		// PrivilegeCheck is the check of the capabilities of the agent at startup: warn, enforce or off
+		PrivilegeCheck string
+		// WriteSecurityProfiles is the folder the seccomp and the AppArmor profiles of the agent container are
+		// written to before exiting, empty to start the agent
+		WriteSecurityProfiles string
+		// StateSecret is the machine secret the key encrypting the state is derived from when the host has no TPM,
+		// empty to use the machine identifier of the host
+		StateSecret string
+		// EdgePayloadServerKey is the public key of the server used to encrypt the Edge Async payloads, empty when
+		// the payloads are not encrypted
+		EdgePayloadServerKey  string
 		EdgeKey               string
 		EdgeID                string
 		EdgeUIServerAddr      string
 		EdgeUIServerPort      string
+		EdgeEnrollment        bool
+		EdgeEnrollURL         string
+		EdgeEnrollCode        string
+		EdgeClaim             bool
 		EdgeInactivityTimeout string
+		EdgeTunnelGracePeriod string
 		EdgeInsecurePoll      bool
 		EdgeTunnel            bool
+		EdgeTunnelTransport   string
+		EdgeOIDCTokenURL      string
+		EdgeOIDCClientID      string
+		EdgeOIDCClientSecret  string
+		EdgeOIDCScopes        []string
+		EdgeOIDCAudience      string
 		EdgeMetaFields        EdgeMetaFields
 		LogLevel              string
 		LogMode               string
 		HealthCheck           bool
+		PrintConfig           bool
+		ExportProfile         string
+		ImportProfile         string
+		Profile               string
+		UseProfile            string
+		ListProfiles          bool
 		SSLCert               string
 		SSLKey                string
 		SSLCACert             string
 		CertRetryInterval     time.Duration
+		MTLSEnrollURL         string
+		MTLSEnrollToken       string
 		AWSClientCert         string
 		AWSClientKey          string
 		AWSClientBundle       string
@@ -112,6 +289,123 @@ type (
 		AWSTrustAnchorARN     string
 		AWSProfileARN         string
 		AWSRegion             string
+		CredentialHelpers     map[string]string
+		CredentialHelpersTTL  time.Duration
+		GitCredentialHelpers  map[string]string
+		WebhookSecret         string
+		RegistryWebhookToken  string
+		RegistryAutoUpdate    bool
+		DNSOverrides          DNSOverrides
+		DeploymentQuotas      DeploymentQuotas
+		AllowedOperations     []string
+		RedactionPatterns     []string
+		CaptureImage          string
+		ScanImage             string
+		HostActionImage       string
+		IdentityFile          string
+		DockerProxyTimeout    time.Duration
+		DockerProxyRetries    int
+		ACMEDomains           []string
+		ACMEEmail             string
+		ACMEDirectoryURL      string
+		ACMESolver            string
+		ACMEHTTPAddr          string
+		ACMEDNSHook           string
+		SPIFFEEndpointSocket  string
+		EgressAllowlist       []string
+		DeploymentLintPolicy  string
+		OrphanGCPolicy        string
+		OrphanGCInterval      time.Duration
+		StackHooks            bool
+		StackHookTimeout      time.Duration
+		HealthGateWindow      time.Duration
+		HealthGateMinUptime   time.Duration
+		// EdgeStackAutoRollback redeploys the last known-good version of an Edge stack when its deployment fails
+		EdgeStackAutoRollback bool
+		// EdgeStackHistorySize is the number of deployed versions kept for each Edge stack
+		EdgeStackHistorySize int
+		// EdgeStackPreflight refuses to deploy an Edge stack when one of its preflight checks fails
+		EdgeStackPreflight bool
+		// HASocket is the path of the heartbeat socket shared by the two instances of a warm standby pair, empty
+		// when the agent runs alone
+		HASocket string
+		// BandwidthMonthlyCap is the maximum number of bytes exchanged by the agent per month, 0 when there is no cap
+		BandwidthMonthlyCap       uint64
+		BandwidthWarningThreshold int
+		// MaintenanceWindows are the periods of the week during which the disruptive operations are executed
+		MaintenanceWindows []string
+		// OSUpdater is the name of the tool used to update the host operating system, empty when disabled
+		OSUpdater string
+		// SystemdUnits are the systemd units of the host reported in the snapshots, and the only ones that can be
+		// restarted
+		SystemdUnits []string
+		// CommandPluginsPath is the folder containing the Go plugins providing the executors of additional Edge commands
+		CommandPluginsPath string
+		// GRPCAPI enables the gRPC control-plane API served alongside the REST API
+		GRPCAPI bool
+		// SnapshotStats adds the resource usage of the containers to the Docker snapshots
+		SnapshotStats bool
+		// SnapshotVirtualMachines adds the virtual machines managed by libvirt on the host to the snapshots
+		SnapshotVirtualMachines bool
+		// SnapshotOverlayNetworks adds the status of the overlay networking clients of the host to the snapshots
+		SnapshotOverlayNetworks bool
+		// SnapshotSMART adds the SMART health of the disks of the host to the snapshots
+		SnapshotSMART bool
+		// SnapshotKernelAnomalies adds the anomalies found in the kernel messages of the host to the snapshots
+		SnapshotKernelAnomalies bool
+		// SnapshotLANDevices adds the devices of the local network discovered with mDNS and SSDP to the snapshots
+		SnapshotLANDevices bool
+		// TemperatureAlertThreshold is the CPU temperature in Celsius from which an alert is reported, 0 to disable it
+		TemperatureAlertThreshold float64
+		// BatteryAlertThreshold is the capacity in percent of a discharging battery or UPS from which an alert is reported
+		BatteryAlertThreshold int
+		// SnapshotConcurrency is the maximum number of containers inspected in parallel during a Docker snapshot
+		SnapshotConcurrency int
+		// SnapshotEnv enables the collection of the environment variables of the containers in the Docker snapshots
+		SnapshotEnv bool
+		// StackConcurrency is the maximum number of operations executed at the same time on different stacks
+		StackConcurrency int
+		// EventBusURL is the URL of the event bus on which the agent publishes its data, empty when disabled
+		EventBusURL              string
+		EventBusSubject          string
+		EventBusSnapshotInterval time.Duration
+		// LogShippingURL is the URL of the sink to which the logs of the selected containers are shipped, empty when
+		// disabled
+		LogShippingURL string
+		// LogShippingContainers are the patterns of the names of the containers whose logs are shipped
+		LogShippingContainers    []string
+		LogShippingBatchSize     int
+		LogShippingFlushInterval time.Duration
+		// MetricsAddr is the address of the listener exposing the metrics of the agent, empty when disabled
+		MetricsAddr string
+		// ReplicaToken authenticates the consumers of the read-only replica API, empty when disabled
+		ReplicaToken string
+		// CrashArtifacts enables the collection of the artifacts of the crashed containers
+		CrashArtifacts    bool
+		CrashLogLines     int
+		CrashCoreDumpPath string
+		// CrashArtifactsMaxSize is the maximum total size of the stored crash artifacts, in bytes
+		CrashArtifactsMaxSize int64
+		// AuditSessions is the recording of the exec and attach sessions: off, metadata or full
+		AuditSessions string
+		// AuditMaxSize is the size in bytes from which the audit trail is rotated
+		AuditMaxSize int64
+		// IdempotencyWindow is the duration during which the responses of the requests sent with an Idempotency-Key
+		// header are replayed, disabled when 0
+		IdempotencyWindow time.Duration
+		// BrowseArchiveMaxSize is the maximum size of the directories archived and of the archives extracted by the
+		// browse API, in bytes
+		BrowseArchiveMaxSize int64
+		// ClockSkewTolerance is the maximum difference tolerated between the timestamp of a signed command or webhook
+		// and the clock it is compared with
+		ClockSkewTolerance time.Duration
+		// KubernetesKubeconfig is the kubeconfig of the Kubernetes cluster running on the same host as the Docker
+		// daemon, managed as a second environment by the agent. Empty when disabled, "auto" selects the kubeconfig
+		// of the distribution installed on the host.
+		KubernetesKubeconfig string
+		// ProxyPolicyFile is the local policy restricting the Docker API requests proxied by the agent, empty when
+		// there is none
+		ProxyPolicyFile string
 	}
 
 	NomadConfig struct {
@@ -151,6 +445,10 @@ type (
 		Script         string
 		Version        int
 		CollectLogs    bool
+		// Interpreter runs the script (e.g. /bin/bash or python3), the script is executed directly when empty
+		Interpreter string
+		// Image runs the script in an ephemeral container of the image instead of on the host
+		Image string
 	}
 
 	// TunnelConfig contains all the required information for the agent to establish
@@ -171,6 +469,8 @@ type (
 		GetMemberByRole(role DockerNodeRole) *ClusterMember
 		GetMemberByNodeName(nodeName string) *ClusterMember
 		GetMemberWithEdgeKeySet() *ClusterMember
+		GetMismatchedVersionMembers() []ClusterMember
+		MembersHealth() []ClusterMemberHealth
 		GetRuntimeConfiguration() *RuntimeConfiguration
 		UpdateRuntimeConfiguration(runtimeConfiguration *RuntimeConfiguration) error
 	}
@@ -281,6 +581,24 @@ const (
 	DefaultEdgePollInterval = "5s"
 	// DefaultEdgeSleepInterval is the default interval after which the agent will close the tunnel if no activity.
 	DefaultEdgeSleepInterval = "5m"
+	// DefaultEdgeTunnelGracePeriod is the default duration a tunnel is kept open after its last activity when the
+	// Portainer instance reports that it is not required anymore
+	DefaultEdgeTunnelGracePeriod = "1m"
+	// DefaultEdgeMaxIdleConns is the default number of idle connections to the Portainer instance kept for reuse
+	DefaultEdgeMaxIdleConns = "10"
+	// DefaultEdgeIdleConnTimeout is the default duration after which an idle connection to the Portainer instance
+	// is closed
+	DefaultEdgeIdleConnTimeout = "90s"
+	// EdgeTunnelTransportChisel opens the reverse tunnel with the chisel client, connecting directly to the server
+	EdgeTunnelTransportChisel = "chisel"
+	// EdgeTunnelTransportWebSocket opens the reverse tunnel through the HTTP proxy of the environment, with keepalives
+	// and automatic reconnection
+	EdgeTunnelTransportWebSocket = "websocket"
+	// EdgePollTransportTCP sends the requests to the Portainer instance over TCP and TLS
+	EdgePollTransportTCP = "tcp"
+	// EdgePollTransportQUIC sends the requests to the Portainer instance over HTTP/3, falling back to TCP when the
+	// instance cannot be reached over QUIC
+	EdgePollTransportQUIC = "quic"
 	// DefaultConfigCheckInterval is the default interval used to check if node config changed
 	DefaultConfigCheckInterval = "5s"
 	// DefaultClusterProbeTimeout is the default member list ping probe timeout.
@@ -292,6 +610,20 @@ const (
 	// HTTPEdgeIdentifierHeaderName is the name of the header used to specify the Docker identifier associated to
 	// an Edge agent.
 	HTTPEdgeIdentifierHeaderName = "X-PortainerAgent-EdgeID"
+	// HTTPAgentIdentityHeaderName is the name of the header containing the durable identifier of the agent.
+	HTTPAgentIdentityHeaderName = "X-PortainerAgent-Identity"
+	// HTTPAgentIdentityPublicKeyHeaderName is the name of the header containing the public key associated to the
+	// durable identity of the agent.
+	HTTPAgentIdentityPublicKeyHeaderName = "X-PortainerAgent-Identity-PublicKey"
+	// HTTPAgentIdentityTimestampHeaderName is the name of the header containing the Unix time covered by the
+	// identity signature.
+	HTTPAgentIdentityTimestampHeaderName = "X-PortainerAgent-Identity-Timestamp"
+	// HTTPAgentIdentitySignatureHeaderName is the name of the header containing the signature of the identifier
+	// and timestamp, created with the private key of the agent identity.
+	HTTPAgentIdentitySignatureHeaderName = "X-PortainerAgent-Identity-Signature"
+	// HTTPResourceOwnerHeaderName is the name of the header containing the owner of the resources created through
+	// the agent, it is stamped on the resources as a label.
+	HTTPResourceOwnerHeaderName = "X-PortainerAgent-Owner"
 	// HTTPManagerOperationHeaderName is the name of the header used to specify that
 	// a request must target a manager node.
 	HTTPManagerOperationHeaderName = "X-PortainerAgent-ManagerOperation"
@@ -301,13 +633,46 @@ const (
 	// HTTPPublicKeyHeaderName is the name of the header containing the public key
 	// of a Portainer instance.
 	HTTPPublicKeyHeaderName = "X-PortainerAgent-PublicKey"
+	// HTTPWebhookSignatureHeaderName is the name of the header containing the HMAC signature
+	// of a webhook request payload.
+	HTTPWebhookSignatureHeaderName = "X-PortainerAgent-Webhook-Signature"
+	// HTTPWebhookTimestampHeaderName is the name of the header containing the Unix time at which a webhook
+	// request was signed.
+	HTTPWebhookTimestampHeaderName = "X-PortainerAgent-Webhook-Timestamp"
 	// HTTPResponseAgentTimeZone is the name of the header containing the timezone
 	HTTPResponseAgentTimeZone = "X-PortainerAgent-TimeZone"
+	// HTTPPayloadEncryptionHeaderName is the name of the header containing the encryption scheme of an encrypted
+	// request or response body
+	HTTPPayloadEncryptionHeaderName = "X-PortainerAgent-Payload-Encryption"
+	// HTTPPayloadPublicKeyHeaderName is the name of the header containing the public key of the agent used to
+	// encrypt the request body
+	HTTPPayloadPublicKeyHeaderName = "X-PortainerAgent-Payload-PublicKey"
+	// HTTPPayloadContentEncodingHeaderName is the name of the header containing the content encoding of an encrypted
+	// request body, applied before the encryption
+	HTTPPayloadContentEncodingHeaderName = "X-PortainerAgent-Payload-Content-Encoding"
+	// HTTPPayloadContentTypeHeaderName is the name of the header containing the media type of an encrypted request
+	// or response body, before the encryption
+	HTTPPayloadContentTypeHeaderName = "X-PortainerAgent-Payload-Content-Type"
+	// HTTPRelayTimestampHeaderName is the name of the header containing the Unix time at which the hop of a relayed
+	// request was signed
+	HTTPRelayTimestampHeaderName = "X-PortainerAgent-Relay-Timestamp"
+	// HTTPRelayNonceHeaderName is the name of the header containing the random value identifying the hop of a
+	// relayed request, the hops already received are rejected
+	HTTPRelayNonceHeaderName = "X-PortainerAgent-Relay-Nonce"
+	// HTTPRelaySignatureHeaderName is the name of the header containing the HMAC signature of the hop of a relayed
+	// request, created with the relay secret of the site
+	HTTPRelaySignatureHeaderName = "X-PortainerAgent-Relay-Signature"
+	// HTTPRelayViaHeaderName is the name of the header containing the comma separated identifiers of the relays
+	// traversed by a request
+	HTTPRelayViaHeaderName = "X-PortainerAgent-Relay-Via"
 	// HTTPResponseUpdateIDHeaderName is the name of the header that will have the update ID that started this container
 	HTTPResponseUpdateIDHeaderName = "X-PortainerAgent-Update-ID"
 	// HTTPResponseAgentHeaderName is the name of the header that is automatically added
 	// to each agent response.
 	HTTPResponseAgentHeaderName = "Portainer-Agent"
+	// HTTPTargetPlatformHeaderName is the name of the header used to target the Kubernetes environment of an agent
+	// managing both the Docker daemon and the Kubernetes cluster of its host
+	HTTPTargetPlatformHeaderName = "X-PortainerAgent-Platform"
 	// HTTPKubernetesSATokenHeaderName represent the name of the header containing a Kubernetes SA token
 	HTTPKubernetesSATokenHeaderName = "X-PortainerAgent-SA-Token"
 	// HTTPNomadTokenHeaderName represent the name of the header containing a Nomad token
@@ -339,6 +704,9 @@ const (
 	HTTPResponseAgentApiVersion = "Portainer-Agent-API-Version"
 	// HTTPResponseAgentPlatform is the name of the header that will have the Portainer agent platform
 	HTTPResponseAgentPlatform = "Portainer-Agent-Platform"
+	// HTTPResponseAgentRuntime is the name of the header that will have the container runtime (docker, podman)
+	// of the Docker platform
+	HTTPResponseAgentRuntime = "Portainer-Agent-Runtime"
 	// PortainerAgentSignatureMessage is the unhashed content that is signed by the Portainer instance.
 	// It is used by the agent during the signature verification process.
 	PortainerAgentSignatureMessage = "Portainer-App"
@@ -363,6 +731,19 @@ const (
 	ScheduleScriptDirectory = "/opt/portainer/scripts"
 	// EdgeKeyFile is the name of the file used to persist the Edge key associated to the agent.
 	EdgeKeyFile = "agent_edge_key"
+	// EdgeEnrollmentPath is the path of the Portainer API exchanging a one-time enrollment code for an Edge key.
+	EdgeEnrollmentPath = "/api/endpoints/edge/enroll"
+	// EdgeClaimPath is the path of the Portainer API registering the claims of the devices and returning their Edge key
+	// once approved.
+	EdgeClaimPath = "/api/endpoints/edge/claims"
+	// EdgeClaimUIPath is the page of the Portainer UI where a claim code is entered to approve the claim of a device.
+	EdgeClaimUIPath = "/#!/edge/claim"
+	// EdgeClaimFile is the name of the file used to persist the claim code of the device until it is claimed.
+	EdgeClaimFile = "agent_claim"
+	// ProvisioningDHCPOption is the site-specific DHCP option providing the provisioning URL of the agents.
+	ProvisioningDHCPOption = 224
+	// EdgeEnrollmentMaxAttempts is the number of failed enrollments after which the Edge UI server shuts down.
+	EdgeEnrollmentMaxAttempts = 5
 	// DefaultAssetsPath is the default path of the binaries
 	DefaultAssetsPath = "/app"
 	// EdgeStackFilesPath is the path where edge stack files are saved
@@ -379,8 +760,226 @@ const (
 	DefaultAWSClientCertPath = "/certs/aws-client.crt"
 	// DefaultAWSClientKeyPath is the default path to the AWS client key file
 	DefaultAWSClientKeyPath = "/certs/aws-client.key"
+	// DefaultCredentialHelpersTTL is the default duration during which the credentials returned by a Docker
+	// credential helper are cached
+	DefaultCredentialHelpersTTL = "10m"
 	// DefaultUnpackerImage is the default name of unpacker image
 	DefaultUnpackerImage = "portainer/compose-unpacker:latest"
+	// DefaultDockerProxyTimeout is the default maximum duration to wait for the Docker daemon to answer a proxied request
+	DefaultDockerProxyTimeout = "2m"
+	// DefaultDockerProxyRetries is the default number of times a proxied read request is retried
+	DefaultDockerProxyRetries = "2"
+	// DefaultACMEDirectoryURL is the default ACME directory used to obtain the certificate of the agent API
+	DefaultACMEDirectoryURL = "https://acme-v02.api.letsencrypt.org/directory"
+	// DefaultACMEHTTPAddr is the default address of the server answering the ACME HTTP-01 challenges
+	DefaultACMEHTTPAddr = ":80"
+	// ACMESolverHTTP01 validates the domains by serving the ACME challenges over HTTP
+	ACMESolverHTTP01 = "http-01"
+	// ACMESolverTLSALPN01 validates the domains by serving the ACME challenges on the TLS listener of the agent API
+	ACMESolverTLSALPN01 = "tls-alpn-01"
+	// ACMESolverDNS01 validates the domains by publishing DNS records through an external hook
+	ACMESolverDNS01 = "dns-01"
+	// ACMECacheDirName is the name of the folder inside the data folder storing the ACME account and certificates
+	ACMECacheDirName = "acme"
+	// SPIFFEWorkloadAPITimeout is the maximum duration the agent waits for its first SVID from the SPIFFE Workload API
+	SPIFFEWorkloadAPITimeout = 30 * time.Second
+	// DeploymentLintPolicyOff disables the security linting of the deployed stacks
+	DeploymentLintPolicyOff = "off"
+	// DeploymentLintPolicyWarn logs the security findings of the deployed stacks
+	DeploymentLintPolicyWarn = "warn"
+	// DeploymentLintPolicyBlock refuses to deploy the stacks with security findings
+	DeploymentLintPolicyBlock = "block"
+	// ResourceLabelEndpoint is the label identifying the environment of the resources created through the agent
+	ResourceLabelEndpoint = "io.portainer.agent.endpoint"
+	// ResourceLabelStack is the label identifying the stack of the resources created through the agent
+	ResourceLabelStack = "io.portainer.agent.stack"
+	// ResourceLabelOwner is the label identifying the owner of the resources created through the agent
+	ResourceLabelOwner = "io.portainer.agent.owner"
+	// ContainerLabelStats opts a container in (true) or out (false) of the resource usage sent in the snapshots,
+	// regardless of the stats collector
+	ContainerLabelStats = "io.portainer.agent.stats"
+	// ContainerLabelLogShip opts a container in or out of the log shipping, the value is true, false or the kind of
+	// the configured sink (loki, syslog or http)
+	ContainerLabelLogShip = "io.portainer.agent.logship"
+	// ContainerLabelCrash opts a container out of the collection of the crash artifacts when set to false
+	ContainerLabelCrash = "io.portainer.agent.crash"
+	// ContainerLabelPowerPriority marks the stack of a container as stopped while the host runs on battery when set
+	// to low
+	ContainerLabelPowerPriority = "io.portainer.agent.power-priority"
+	// ContainerLabelNetworkPolicyIngress and ContainerLabelNetworkPolicyEgress declare the rules applied to the new
+	// connections to and from a container, e.g. "allow 10.0.0.0/8 tcp/80, deny"
+	ContainerLabelNetworkPolicyIngress = "io.portainer.agent.netpolicy.ingress"
+	ContainerLabelNetworkPolicyEgress  = "io.portainer.agent.netpolicy.egress"
+	// ContainerLabelPriorityClass sets the priority class of a service of a stack (critical, normal or batch), which
+	// the agent maps to the CPU and IO weights of its containers on deployment
+	ContainerLabelPriorityClass = "io.portainer.agent.priority-class"
+	// OrphanGCPolicyOff disables the detection of the orphaned resources of the deployed stacks
+	OrphanGCPolicyOff = "off"
+	// OrphanGCPolicyReport logs the orphaned resources of the deployed stacks
+	OrphanGCPolicyReport = "report"
+	// OrphanGCPolicyRemove removes the orphaned resources of the deployed stacks
+	OrphanGCPolicyRemove = "remove"
+	// DefaultOrphanGCInterval is the default interval between two detections of the orphaned resources
+	DefaultOrphanGCInterval = "1h"
+	// DefaultStackHookTimeout is the default maximum duration of the execution of an Edge stack hook script
+	DefaultStackHookTimeout = "5m"
+	// DefaultHealthGateMinUptime is the default duration the containers without healthcheck must be running for to
+	// pass the health gate of a deployment
+	DefaultHealthGateMinUptime = "10s"
+	// BandwidthUsageFileName is the name of the file persisting the bandwidth usage of the current month inside the data folder
+	BandwidthUsageFileName = "agent_bandwidth_usage.json"
+	// DefaultBandwidthWarningThreshold is the default percentage of the monthly bandwidth cap from which a warning is reported
+	DefaultBandwidthWarningThreshold = "80"
+	// DefaultTemperatureAlertThreshold is the default CPU temperature in Celsius from which an alert is reported
+	DefaultTemperatureAlertThreshold = "80"
+	// DefaultBatteryAlertThreshold is the default capacity in percent of a discharging battery or UPS from which an alert is reported
+	DefaultBatteryAlertThreshold = "20"
+	// DefaultSnapshotConcurrency is the default maximum number of containers inspected in parallel during a snapshot
+	DefaultSnapshotConcurrency = "5"
+	// DefaultEventBusSubject is the default prefix of the subjects of the messages published on the event bus
+	DefaultEventBusSubject = "portainer.agent"
+	// DefaultEventBusSnapshotInterval is the default interval between two snapshots published on the event bus
+	DefaultEventBusSnapshotInterval = "5m"
+	// DefaultLogShippingBatchSize is the default number of lines from which the shipped logs are sent
+	DefaultLogShippingBatchSize = "500"
+	// DefaultLogShippingFlushInterval is the default interval at which the shipped logs are sent
+	DefaultLogShippingFlushInterval = "5s"
+	// DefaultStackConcurrency is the default maximum number of operations executed at the same time on different stacks
+	DefaultStackConcurrency = "1"
+	// DefaultCrashLogLines is the default number of log lines collected when a container crashes
+	DefaultCrashLogLines = "200"
+	// DefaultCrashArtifactsMaxSize is the default maximum total size of the stored crash artifacts
+	DefaultCrashArtifactsMaxSize = "256MB"
+	// CrashArtifactsDirName is the name of the folder storing the crash artifacts inside the data folder
+	CrashArtifactsDirName = "crashes"
+	// TPMAuto stores the key material in the TPM when the host has one, in files otherwise
+	TPMAuto = "auto"
+	// TPMRequired stores the key material in the TPM and prevents the agent from starting without a TPM
+	TPMRequired = "required"
+	// TPMOff stores the key material in files
+	TPMOff = "off"
+	// EdgeKeySealedFile is the name of the file used to persist the Edge key sealed by the TPM
+	EdgeKeySealedFile = "agent_edge_key.sealed"
+	// StateKeyFileName is the name of the file persisting the key encrypting the state of the agent inside the data
+	// folder, sealed by the TPM or wrapped with a key derived from the machine secret
+	StateKeyFileName = "agent_state_key.json"
+	// PrivilegeCheckWarn logs the capabilities of the agent container that the agent does not need
+	PrivilegeCheckWarn = "warn"
+	// PrivilegeCheckEnforce prevents the agent from starting with capabilities it does not need
+	PrivilegeCheckEnforce = "enforce"
+	// PrivilegeCheckOff disables the check of the capabilities and the hardening of the agent process
+	PrivilegeCheckOff = "off"
+	// AuditSessionsOff disables the recording of the exec and attach sessions
+	AuditSessionsOff = "off"
+	// AuditSessionsMetadata records the command, the user and the timestamps of the sessions
+	AuditSessionsMetadata = "metadata"
+	// AuditSessionsFull also records the input and the output of the sessions
+	AuditSessionsFull = "full"
+	// DefaultAuditMaxSize is the default size from which the audit trail is rotated
+	DefaultAuditMaxSize = "10MB"
+	// AuditDirName is the name of the folder storing the audit trail inside the data folder
+	AuditDirName = "audit"
+	// DefaultIdempotencyWindow is the default duration during which the responses of the requests sent with an
+	// Idempotency-Key header are replayed
+	DefaultIdempotencyWindow = "1h"
+	// DefaultBrowseArchiveMaxSize is the default maximum size of the archives of the browse API
+	DefaultBrowseArchiveMaxSize = "1GB"
+	// DefaultClockSkewTolerance is the default maximum difference tolerated between the timestamp of a signed command
+	// or webhook and the clock it is compared with
+	DefaultClockSkewTolerance = "5m"
+	// DefaultEdgeStackHistorySize is the default number of deployed versions kept for each Edge stack
+	DefaultEdgeStackHistorySize = "5"
+	// EdgeStackVersionsDirName is the name of the folder persisting the deployed versions of the Edge stacks inside
+	// the data folder
+	EdgeStackVersionsDirName = "edge_stack_versions"
+	// JournalDirName is the name of the folder persisting the operations in progress inside the data folder
+	JournalDirName = "journal"
+	// BackupsDirName is the name of the folder storing the volume backups inside the data folder
+	BackupsDirName = "backups"
+	// ImageCacheDirName is the name of the folder storing the image layers served to the other hosts of the site
+	// inside the data folder
+	ImageCacheDirName = "image_cache"
+	// SnapshotsDirName is the name of the folder storing the history of the snapshots of the environment inside the
+	// data folder
+	SnapshotsDirName = "snapshots"
+	// HooksDirName is the name of the folder persisting the scripting hooks pushed by the server inside the data folder
+	HooksDirName = "hooks"
+	// DefaultHooksSnapshotInterval is the default interval between two snapshots passed to the scripting hooks
+	DefaultHooksSnapshotInterval = "1m"
+	// DefaultRetentionInterval is the default interval between two applications of the retention policies
+	DefaultRetentionInterval = "1h"
+	// DefaultAnomalyFailedAuthThreshold is the default number of failed authentications from a source address within
+	// a minute raising an alert
+	DefaultAnomalyFailedAuthThreshold = "10"
+	// DefaultAnomalyLearningPeriod is the default period during which the accesses to the agent API are learned
+	DefaultAnomalyLearningPeriod = "24h"
+	// DefaultAlertNotifyInterval is the default interval between two checks of the alerts sent to the notification
+	// channels
+	DefaultAlertNotifyInterval = "1m"
+	// DefaultShutdownStopTimeout is the default maximum duration of the stop of a container on shutdown
+	DefaultShutdownStopTimeout = "30s"
+	// DefaultShutdownTimeout is the default maximum duration of the stop of the Edge stacks on shutdown
+	DefaultShutdownTimeout = "2m"
+	// DefaultPowerCheckInterval is the default interval between two checks of the status of the UPS
+	DefaultPowerCheckInterval = "10s"
+	// DefaultPowerShedDelay is the default duration on battery after which the low-priority stacks are stopped
+	DefaultPowerShedDelay = "1m"
+	// DefaultNetworkPolicyInterval is the default interval between two applications of the network policies
+	DefaultNetworkPolicyInterval = "30s"
+	// DefaultPortForwardNetworks are the default CIDR ranges of the targets of the port-forwards, the private and
+	// link-local networks
+	DefaultPortForwardNetworks = "10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,169.254.0.0/16,fc00::/7,fe80::/10"
+	// DefaultPortForwardMaxSessions is the default maximum number of concurrent port-forward sessions
+	DefaultPortForwardMaxSessions = "4"
+	// DefaultPortForwardMaxDuration is the default maximum duration of a port-forward session
+	DefaultPortForwardMaxDuration = "1h"
+	// DefaultWASMPluginTimeout is the default maximum duration of a call to a WebAssembly plugin
+	DefaultWASMPluginTimeout = "10s"
+	// DefaultImageCacheUpstream is the default registry mirrored by the image cache
+	DefaultImageCacheUpstream = "https://registry-1.docker.io"
+	// DefaultImageCacheMaxSize is the default maximum total size of the layers stored by the image cache
+	DefaultImageCacheMaxSize = "20GB"
+	// AccessBaselineFileName is the name of the file persisting the accesses to the agent API learned by the anomaly
+	// detection inside the data folder
+	AccessBaselineFileName = "agent_access_baseline.json"
+	// EdgeQueueFileName is the name of the BoltDB database persisting the queue of the Edge commands inside the data
+	// folder
+	EdgeQueueFileName = "agent_edge_queue.db"
+	// HostActionFileName is the name of the file persisting the last host action inside the data folder
+	HostActionFileName = "agent_host_action.json"
+	// PowerSheddingFileName is the name of the file persisting the containers stopped while the host runs on battery
+	// inside the data folder
+	PowerSheddingFileName = "agent_power_shedding.json"
+	// NetworkPolicyFileName is the name of the file persisting the network policies pushed by the server inside the
+	// data folder
+	NetworkPolicyFileName = "agent_network_policy.json"
+	// ProxyPolicyFileName is the name of the file persisting the proxy policy pushed by the server inside the data folder
+	ProxyPolicyFileName = "agent_proxy_policy.json"
+	// DefaultHostActionImage is the default name of the image used to execute the host actions
+	DefaultHostActionImage = "alpine:latest"
+	// IdentityFileName is the name of the file persisting the identity of the agent inside the data folder
+	IdentityFileName = "agent_identity.json"
+	// PayloadKeyFileName is the name of the file persisting the key pair encrypting the Edge payloads inside the data folder
+	PayloadKeyFileName = "agent_payload_key.json"
+	// DeclarativeStateFileName is the name of the file persisting the resources created by the declarative apply
+	// inside the data folder
+	DeclarativeStateFileName = "agent_declarative_state.json"
+	// ScheduleFileName is the name of the file persisting the schedules of the Edge jobs inside the data folder
+	ScheduleFileName = "agent_schedules.json"
+	// MTLSCertFileName and MTLSKeyFileName are the names of the files storing the enrolled mTLS certificate and its
+	// key inside the data folder, when their paths are not set
+	MTLSCertFileName = "agent_mtls_cert.pem"
+	MTLSKeyFileName  = "agent_mtls_key.pem"
+	// StacksDirName is the name of the folder, inside the data folder, where the files of the stacks deployed through
+	// the agent API are stored
+	StacksDirName = "stacks"
+	// StackFileName is the name of the files of the stacks deployed through the agent API
+	StackFileName = "docker-compose.yml"
+	// DefaultCaptureImage is the default name of the image used to capture the network traffic of a container and to
+	// debug its network
+	DefaultCaptureImage = "nicolaka/netshoot:latest"
+	// DefaultScanImage is the default name of the image used to scan the local images for vulnerabilities
+	DefaultScanImage = "aquasec/trivy:latest"
 	// ComposeUnpackerImageEnvVar is the default environment variable name of the unpacker image
 	ComposeUnpackerImageEnvVar = "COMPOSE_UNPACKER_IMAGE"
 	// ComposePathPrefix is the folder name of compose path in unpacker
@@ -425,3 +1024,54 @@ const (
 	// TunnelStatusActive represents an active state for a tunnel connected to an Edge environment(endpoint)
 	TunnelStatusActive string = "ACTIVE"
 )
+
+// Operations gated by the policy of the agent. They are disabled unless explicitly allowed.
+const (
+	// OperationTrafficCapture allows the capture of the network traffic of a container
+	OperationTrafficCapture = "traffic_capture"
+	// OperationStackSync allows the synchronization of a local directory with the bind mount of a stack
+	OperationStackSync = "stack_sync"
+	// OperationSFTP allows the access to the host filesystem and the volumes through the SFTP sessions tunneled by
+	// the Portainer instance
+	OperationSFTP = "sftp"
+	// OperationHostReboot allows the reboot of the host
+	OperationHostReboot = "host_reboot"
+	// OperationDockerRestart allows the restart of the Docker daemon
+	OperationDockerRestart = "docker_restart"
+	// OperationKubernetesRestart allows the restart of the Kubernetes distribution installed on the host
+	OperationKubernetesRestart = "kubernetes_restart"
+	// OperationOSUpdate allows the update of the host operating system with the configured OS updater
+	OperationOSUpdate = "os_update"
+	// OperationLogRemediation allows the truncation of the container logs and the recreation of the containers with
+	// unbounded logs
+	OperationLogRemediation = "log_remediation"
+	// OperationImageScan allows the scan of the local images for vulnerabilities
+	OperationImageScan = "image_scan"
+	// OperationSystemdRestart allows the restart of the monitored systemd units of the host
+	OperationSystemdRestart = "systemd_restart"
+	// OperationOverlayControl allows the connection and disconnection of the overlay networks of the host, which can
+	// cut the agent from the Portainer server
+	OperationOverlayControl = "overlay_control"
+	// OperationSBOM allows the generation of the SBOMs of the local images and their upload
+	OperationSBOM = "sbom"
+	// OperationJournalQuery allows the queries of the journal of the host, which can contain sensitive information
+	OperationJournalQuery = "journal_query"
+	// OperationNetworkDebug allows the DNS lookups and the HTTP probes from the network namespace of a container, which
+	// can reach the services only exposed to the container
+	OperationNetworkDebug = "network_debug"
+	// OperationScriptHooks allows the Portainer server to push scripting hooks, which can restart, start and stop the
+	// containers
+	OperationScriptHooks = "script_hooks"
+	// OperationNetworkPolicy allows the Portainer server to push the network policies of the containers, which can
+	// cut their traffic
+	OperationNetworkPolicy = "network_policy"
+	// OperationPortForward allows the port-forwards to the TCP services of the devices of the local network of the
+	// host through the tunnel of the agent
+	OperationPortForward = "port_forward"
+	// OperationZRAM allows the configuration of the zram swap recommended for the host, which changes the swap and the
+	// swappiness of the host until its next reboot
+	OperationZRAM = "zram"
+	// OperationStackMigration allows the export of the compose stacks with their secrets, their import and the stop
+	// and removal of their containers during their migration to another agent
+	OperationStackMigration = "stack_migration"
+)
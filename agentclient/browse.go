@@ -0,0 +1,82 @@
+package agentclient
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+
+	"github.com/portainer/agent/filesystem"
+)
+
+// browseQuery returns the query of the browse requests, the paths are relative to the volume volumeID when set
+func browseQuery(volumeID, path string) url.Values {
+	query := url.Values{"path": {path}}
+	if volumeID != "" {
+		query.Set("volumeID", volumeID)
+	}
+
+	return query
+}
+
+// ListFiles returns the files of the directory path
+func (client *Client) ListFiles(ctx context.Context, volumeID, path string) ([]filesystem.FileInfo, error) {
+	var files []filesystem.FileInfo
+
+	err := client.doJSON(ctx, request{method: http.MethodGet, path: "/browse/ls", query: browseQuery(volumeID, path)}, nil, &files)
+
+	return files, err
+}
+
+// GetFile returns the content of the file path, the caller must close it
+func (client *Client) GetFile(ctx context.Context, volumeID, path string) (io.ReadCloser, error) {
+	resp, err := client.do(ctx, request{method: http.MethodGet, path: "/browse/get", query: browseQuery(volumeID, path)})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// PutFile uploads content as the file filename inside the directory dir
+func (client *Client) PutFile(ctx context.Context, volumeID, dir, filename string, content []byte) error {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	if err := writer.WriteField("Path", dir); err != nil {
+		return err
+	}
+
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		return err
+	}
+
+	if _, err := part.Write(content); err != nil {
+		return err
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	if volumeID != "" {
+		query.Set("volumeID", volumeID)
+	}
+
+	return client.doJSON(ctx, request{
+		method:      http.MethodPost,
+		path:        "/browse/put",
+		query:       query,
+		body:        body.Bytes(),
+		contentType: writer.FormDataContentType(),
+	}, nil, nil)
+}
+
+// DeleteFile deletes the file path
+func (client *Client) DeleteFile(ctx context.Context, volumeID, path string) error {
+	return client.doJSON(ctx, request{method: http.MethodDelete, path: "/browse/delete", query: browseQuery(volumeID, path)}, nil, nil)
+}
@@ -0,0 +1,347 @@
+// Package agentclient is a Go client of the agent API. The requests are signed like the requests sent by the
+// Portainer server and retried when the agent is unreachable or temporarily unavailable.
+package agentclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/http/idempotency"
+)
+
+const (
+	defaultMaxRetries = 3
+	defaultRetryDelay = 500 * time.Millisecond
+	// maxErrorSize is the maximum size of an error response read by the client
+	maxErrorSize = 64 * 1024
+)
+
+// Config represents the configuration of a Client
+type Config struct {
+	// URL is the address of the agent API, e.g. https://10.0.0.10:9001
+	URL string
+	// PrivateKey signs the requests. The agent accepts the first public key it receives, unless it is started with
+	// AGENT_SECRET, so the key of the Portainer server associated with the agent must be used.
+	PrivateKey *ecdsa.PrivateKey
+	// SignatureMessage is the signed message, it must be the value of AGENT_SECRET when the agent is started with it.
+	// Defaults to agent.PortainerAgentSignatureMessage.
+	SignatureMessage string
+	// ReplicaToken is the bearer token of the replica API, only required by GetSnapshot
+	ReplicaToken string
+	// HTTPClient is used to send the requests. The agent uses a self-signed certificate by default, the TLS
+	// configuration of the client must trust it. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// MaxRetries is the number of times a failed request is sent again, 3 when 0, no retry when negative
+	MaxRetries int
+	// RetryDelay is the delay before the first retry, doubled before each following retry. Defaults to 500ms.
+	RetryDelay time.Duration
+}
+
+// Client sends requests to the agent API
+type Client struct {
+	baseURL      *url.URL
+	httpClient   *http.Client
+	publicKey    string
+	signature    string
+	replicaToken string
+	target       string
+	maxRetries   int
+	retryDelay   time.Duration
+}
+
+// APIError is returned when the agent answers with an error status code
+type APIError struct {
+	StatusCode int
+	Message    string
+	Details    string
+}
+
+func (err *APIError) Error() string {
+	if err.Message == "" {
+		return fmt.Sprintf("the agent answered with the status code %d", err.StatusCode)
+	}
+
+	if err.Details == "" {
+		return fmt.Sprintf("%s (status code %d)", err.Message, err.StatusCode)
+	}
+
+	return fmt.Sprintf("%s: %s (status code %d)", err.Message, err.Details, err.StatusCode)
+}
+
+// NewClient returns a pointer to a Client configured with config
+func NewClient(config Config) (*Client, error) {
+	baseURL, err := url.Parse(strings.TrimSuffix(config.URL, "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	if baseURL.Scheme != "http" && baseURL.Scheme != "https" {
+		return nil, errors.New("the URL of the agent must use the http or https scheme")
+	}
+
+	if config.PrivateKey == nil {
+		return nil, errors.New("a private key is required to sign the requests")
+	}
+
+	message := config.SignatureMessage
+	if message == "" {
+		message = agent.PortainerAgentSignatureMessage
+	}
+
+	publicKey, signature, err := sign(config.PrivateKey, message)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &Client{
+		baseURL:      baseURL,
+		httpClient:   config.HTTPClient,
+		publicKey:    publicKey,
+		signature:    signature,
+		replicaToken: config.ReplicaToken,
+		maxRetries:   config.MaxRetries,
+		retryDelay:   config.RetryDelay,
+	}
+
+	if client.httpClient == nil {
+		client.httpClient = http.DefaultClient
+	}
+
+	if client.maxRetries == 0 {
+		client.maxRetries = defaultMaxRetries
+	} else if client.maxRetries < 0 {
+		client.maxRetries = 0
+	}
+
+	if client.retryDelay <= 0 {
+		client.retryDelay = defaultRetryDelay
+	}
+
+	return client, nil
+}
+
+// ForNode returns a copy of the client sending the requests to the agent running on the node nodeName of the cluster
+func (client *Client) ForNode(nodeName string) *Client {
+	copied := *client
+	copied.target = nodeName
+
+	return &copied
+}
+
+// sign returns the hexadecimal encoded public key of privateKey and the signature of the MD5 digest of message, as
+// verified by the agent
+func sign(privateKey *ecdsa.PrivateKey, message string) (string, string, error) {
+	der, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	hash := md5.Sum([]byte(message))
+
+	r, s, err := ecdsa.Sign(rand.Reader, privateKey, hash[:])
+	if err != nil {
+		return "", "", err
+	}
+
+	keySize := privateKey.Params().BitSize / 8
+	signature := make([]byte, 2*keySize)
+	r.FillBytes(signature[:keySize])
+	s.FillBytes(signature[keySize:])
+
+	return hex.EncodeToString(der), base64.RawStdEncoding.EncodeToString(signature), nil
+}
+
+// request represents a request sent to the agent, the body is kept in memory so that the request can be sent again
+type request struct {
+	method      string
+	path        string
+	query       url.Values
+	body        []byte
+	contentType string
+	// replica authenticates the request with the replica token instead of the signature
+	replica bool
+}
+
+// do sends r and returns the response when its status code is 2xx. The requests failing with a network error or a
+// HTTP 429, 502, 503 or 504 are sent again. The mutating requests are sent with an Idempotency-Key header so that
+// the agent does not execute them twice, unless the idempotency window of the agent is disabled.
+func (client *Client) do(ctx context.Context, r request) (*http.Response, error) {
+	var idempotencyKey string
+	if r.method != http.MethodGet && r.method != http.MethodHead {
+		key := make([]byte, 16)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+
+		idempotencyKey = hex.EncodeToString(key)
+	}
+
+	delay := client.retryDelay
+	for attempt := 0; ; attempt++ {
+		req, err := client.newRequest(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+
+		if idempotencyKey != "" {
+			req.Header.Set(idempotency.HeaderName, idempotencyKey)
+		}
+
+		resp, err := client.httpClient.Do(req)
+		if err == nil && !isRetryableStatus(resp.StatusCode) {
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				return resp, nil
+			}
+
+			return nil, readAPIError(resp)
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		if attempt >= client.maxRetries {
+			if err != nil {
+				return nil, err
+			}
+
+			return nil, readAPIError(resp)
+		}
+
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+	}
+}
+
+func (client *Client) newRequest(ctx context.Context, r request) (*http.Request, error) {
+	target := *client.baseURL
+	target.Path += r.path
+	target.RawQuery = r.query.Encode()
+
+	var body io.Reader
+	if r.body != nil {
+		body = bytes.NewReader(r.body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, r.method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.contentType != "" {
+		req.Header.Set("Content-Type", r.contentType)
+	}
+
+	client.setAuthHeaders(req.Header, r.replica)
+
+	return req, nil
+}
+
+// setAuthHeaders sets the signature headers, or the replica token when replica is true, and the target node header
+func (client *Client) setAuthHeaders(header http.Header, replica bool) {
+	if replica {
+		header.Set("Authorization", "Bearer "+client.replicaToken)
+	} else {
+		header.Set(agent.HTTPPublicKeyHeaderName, client.publicKey)
+		header.Set(agent.HTTPSignatureHeaderName, client.signature)
+	}
+
+	if client.target != "" {
+		header.Set(agent.HTTPTargetHeaderName, client.target)
+	}
+}
+
+func isRetryableStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// readAPIError returns an APIError from the error response sent by the agent and closes its body
+func readAPIError(resp *http.Response) error {
+	defer resp.Body.Close()
+
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+
+	var errorResponse struct {
+		Message string `json:"message"`
+		Details string `json:"details"`
+	}
+	if json.NewDecoder(io.LimitReader(resp.Body, maxErrorSize)).Decode(&errorResponse) == nil {
+		apiErr.Message = errorResponse.Message
+		apiErr.Details = errorResponse.Details
+	}
+
+	return apiErr
+}
+
+// doJSON sends r with payload encoded in JSON when not nil, and decodes the response in result when not nil
+func (client *Client) doJSON(ctx context.Context, r request, payload, result interface{}) error {
+	if payload != nil {
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+
+		r.body = body
+		r.contentType = "application/json"
+	}
+
+	resp, err := client.do(ctx, r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if result == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// GetMembers returns the agents of the cluster
+func (client *Client) GetMembers(ctx context.Context) ([]agent.ClusterMember, error) {
+	var members []agent.ClusterMember
+
+	err := client.doJSON(ctx, request{method: http.MethodGet, path: "/agents"}, nil, &members)
+
+	return members, err
+}
+
+// GetHostInfo returns the information about the host of the agent
+func (client *Client) GetHostInfo(ctx context.Context) (*agent.HostInfo, error) {
+	var info agent.HostInfo
+	if err := client.doJSON(ctx, request{method: http.MethodGet, path: "/host/info"}, nil, &info); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
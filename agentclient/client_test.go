@@ -0,0 +1,102 @@
+package agentclient
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/crypto"
+	"github.com/portainer/agent/http/idempotency"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClient(Config{URL: server.URL, PrivateKey: privateKey, RetryDelay: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+func TestClient_SignsRequests(t *testing.T) {
+	signatureService := crypto.NewECDSAService("")
+
+	client := newTestClient(t, func(rw http.ResponseWriter, r *http.Request) {
+		valid, err := signatureService.VerifySignature(r.Header.Get(agent.HTTPSignatureHeaderName), r.Header.Get(agent.HTTPPublicKeyHeaderName))
+		if err != nil || !valid {
+			rw.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		rw.Write([]byte(`{}`))
+	})
+
+	if _, err := client.GetHostInfo(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClient_RetriesWithTheSameIdempotencyKey(t *testing.T) {
+	var keys []string
+
+	client := newTestClient(t, func(rw http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get(idempotency.HeaderName))
+		if len(keys) < 3 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		rw.Write([]byte(`{"Id": "1", "Status": "running"}`))
+	})
+
+	op, err := client.PullImage(context.Background(), "alpine:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if op.ID != "1" || len(keys) != 3 {
+		t.Fatalf("expected the operation to be started after 3 attempts, got %+v after %d attempts", op, len(keys))
+	}
+
+	if keys[0] == "" || keys[0] != keys[1] || keys[1] != keys[2] {
+		t.Fatalf("expected the same idempotency key on every attempt, got %v", keys)
+	}
+}
+
+func TestClient_ReturnsAPIError(t *testing.T) {
+	attempts := 0
+
+	client := newTestClient(t, func(rw http.ResponseWriter, r *http.Request) {
+		attempts++
+		rw.WriteHeader(http.StatusNotFound)
+		rw.Write([]byte(`{"message": "Unable to find the operation", "details": "operation not found"}`))
+	})
+
+	_, err := client.GetOperation(context.Background(), "1")
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Details != "operation not found" {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if attempts != 1 {
+		t.Fatalf("expected the request not to be retried, got %d attempts", attempts)
+	}
+}
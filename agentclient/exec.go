@@ -0,0 +1,78 @@
+package agentclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/websocket"
+)
+
+// ExecConfig represents the process executed in a container
+type ExecConfig struct {
+	Cmd        []string
+	User       string
+	WorkingDir string
+	Env        []string
+}
+
+// Exec creates a process executing config.Cmd with a TTY in the container containerID and returns the websocket
+// connected to it, the input and the output of the process are exchanged as websocket messages. The caller must close
+// the connection.
+func (client *Client) Exec(ctx context.Context, containerID string, config ExecConfig) (*websocket.Conn, error) {
+	payload := struct {
+		AttachStdin  bool
+		AttachStdout bool
+		AttachStderr bool
+		Tty          bool
+		Cmd          []string
+		User         string   `json:",omitempty"`
+		WorkingDir   string   `json:",omitempty"`
+		Env          []string `json:",omitempty"`
+	}{
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		Tty:          true,
+		Cmd:          config.Cmd,
+		User:         config.User,
+		WorkingDir:   config.WorkingDir,
+		Env:          config.Env,
+	}
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	err := client.doJSON(ctx, request{method: http.MethodPost, path: "/containers/" + containerID + "/exec"}, payload, &created)
+	if err != nil {
+		return nil, err
+	}
+
+	target := *client.baseURL
+	target.Scheme = "ws"
+	if client.baseURL.Scheme == "https" {
+		target.Scheme = "wss"
+	}
+	target.Path += "/websocket/exec"
+	target.RawQuery = url.Values{"id": {created.ID}}.Encode()
+
+	dialer := &websocket.Dialer{Proxy: http.ProxyFromEnvironment}
+	if transport, ok := client.httpClient.Transport.(*http.Transport); ok {
+		dialer.TLSClientConfig = transport.TLSClientConfig
+		dialer.Proxy = transport.Proxy
+	}
+
+	header := http.Header{}
+	client.setAuthHeaders(header, false)
+
+	conn, resp, err := dialer.DialContext(ctx, target.String(), header)
+	if err != nil {
+		if resp != nil {
+			return nil, readAPIError(resp)
+		}
+
+		return nil, err
+	}
+
+	return conn, nil
+}
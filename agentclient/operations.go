@@ -0,0 +1,69 @@
+package agentclient
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/portainer/agent/operations"
+)
+
+// ListOperations returns the long-running operations of the agent
+func (client *Client) ListOperations(ctx context.Context) ([]operations.Operation, error) {
+	var ops []operations.Operation
+
+	err := client.doJSON(ctx, request{method: http.MethodGet, path: "/operations"}, nil, &ops)
+
+	return ops, err
+}
+
+// GetOperation returns the state of the operation id
+func (client *Client) GetOperation(ctx context.Context, id string) (*operations.Operation, error) {
+	var op operations.Operation
+	if err := client.doJSON(ctx, request{method: http.MethodGet, path: "/operations/" + id}, nil, &op); err != nil {
+		return nil, err
+	}
+
+	return &op, nil
+}
+
+// CancelOperation cancels the operation id
+func (client *Client) CancelOperation(ctx context.Context, id string) error {
+	return client.doJSON(ctx, request{method: http.MethodDelete, path: "/operations/" + id}, nil, nil)
+}
+
+// PullImage starts the pull of image and returns the operation tracking it
+func (client *Client) PullImage(ctx context.Context, image string) (*operations.Operation, error) {
+	var op operations.Operation
+
+	payload := struct{ Image string }{Image: image}
+	if err := client.doJSON(ctx, request{method: http.MethodPost, path: "/operations/image_pull"}, payload, &op); err != nil {
+		return nil, err
+	}
+
+	return &op, nil
+}
+
+// WaitOperation polls the operation id every interval until it is finished and returns its final state. The
+// deferred operations are waited for as well.
+func (client *Client) WaitOperation(ctx context.Context, id string, interval time.Duration) (*operations.Operation, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		op, err := client.GetOperation(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		if op.Status != operations.StatusRunning && op.Status != operations.StatusDeferred {
+			return op, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
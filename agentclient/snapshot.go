@@ -0,0 +1,38 @@
+package agentclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/kubernetes"
+	portainer "github.com/portainer/portainer/api"
+)
+
+// Snapshot represents the snapshot of the environment served by the replica API
+type Snapshot struct {
+	CreatedAt         time.Time                     `json:"createdAt"`
+	Docker            *portainer.DockerSnapshot     `json:"docker,omitempty"`
+	Kubernetes        *portainer.KubernetesSnapshot `json:"kubernetes,omitempty"`
+	KubernetesSummary *kubernetes.ClusterSummary    `json:"kubernetesSummary,omitempty"`
+	ContainerStats    *docker.ContainerStats        `json:"containerStats,omitempty"`
+	GPUs              *docker.GPUInventory          `json:"gpus,omitempty"`
+	ImageScans        *docker.ImageScanReport       `json:"imageScans,omitempty"`
+}
+
+// GetSnapshot returns the last snapshot of the environment, created at most 30 seconds ago. The replica API must be
+// enabled on the agent and the replica token set in the configuration of the client.
+func (client *Client) GetSnapshot(ctx context.Context) (*Snapshot, error) {
+	if client.replicaToken == "" {
+		return nil, errors.New("a replica token is required to retrieve the snapshot")
+	}
+
+	var snapshot Snapshot
+	if err := client.doJSON(ctx, request{method: http.MethodGet, path: "/replica/snapshot", replica: true}, nil, &snapshot); err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
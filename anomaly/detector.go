@@ -0,0 +1,433 @@
+// Package anomaly provides a basic intrusion detection for the agent API: it learns the source addresses and the
+// endpoints used during a learning period and raises an alert for the bursts of failed authentications, the replayed
+// requests, and the requests from new source addresses or to unusual endpoints once the learning period is over.
+package anomaly
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent/eventbus"
+	"github.com/portainer/agent/notify"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Kinds of the alerts
+const (
+	KindFailedAuth      = "failed_auth"
+	KindReplay          = "replay"
+	KindNewSource       = "new_source"
+	KindUnusualEndpoint = "unusual_endpoint"
+)
+
+const (
+	// maxAlerts is the number of alerts kept in memory
+	maxAlerts = 100
+	// diagnosticsWindow is the period during which an alert is reported in the diagnostics of the snapshots
+	diagnosticsWindow = 24 * time.Hour
+	// maxTrackedSources is the number of source addresses with recent failed authentications from which the
+	// addresses without failure within the window are forgotten
+	maxTrackedSources = 1024
+)
+
+// DefaultFailedAuthWindow is the window within which the failed authentications from a source address are counted
+const DefaultFailedAuthWindow = time.Minute
+
+var (
+	defaultDetector   *Detector
+	defaultDetectorMu sync.Mutex
+)
+
+// idSegmentRegexp matches the path segments identifying a resource (numbers, UUIDs, Docker IDs), so that the requests
+// to the same endpoint are not reported as unusual for each resource
+var idSegmentRegexp = regexp.MustCompile(`^([0-9]+|[0-9a-fA-F]{12,64}|[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})$`)
+
+// Config represents the configuration of the detector
+type Config struct {
+	// FailedAuthThreshold is the number of failed authentications from a source address within FailedAuthWindow
+	// raising an alert
+	FailedAuthThreshold int
+	FailedAuthWindow    time.Duration
+	// LearningPeriod is the period, from the first start of the detector, during which the source addresses and the
+	// endpoints are learned without raising alerts
+	LearningPeriod time.Duration
+	// BaselinePath is the file persisting the learned source addresses and endpoints
+	BaselinePath string
+	// Emitter sends the alerts to a webhook, nil when disabled
+	Emitter *WebhookEmitter
+}
+
+// Alert represents an unusual access to the agent API
+type Alert struct {
+	Time     time.Time `json:"Time"`
+	Kind     string    `json:"Kind"`
+	SourceIP string    `json:"SourceIP"`
+	Method   string    `json:"Method,omitempty"`
+	Path     string    `json:"Path,omitempty"`
+	Message  string    `json:"Message"`
+}
+
+// baseline represents the accesses learned during the learning period
+type baseline struct {
+	Since     time.Time       `json:"Since"`
+	Sources   map[string]bool `json:"Sources"`
+	Endpoints map[string]bool `json:"Endpoints"`
+}
+
+// Detector observes the requests of the agent API and raises the alerts
+type Detector struct {
+	config Config
+
+	mu       sync.Mutex
+	baseline baseline
+	failures map[string][]time.Time
+	alerts   []Alert
+}
+
+// NewDetector returns a pointer to a Detector, the baseline is read from the baseline file when it exists
+func NewDetector(config Config) (*Detector, error) {
+	detector := &Detector{
+		config:   config,
+		failures: map[string][]time.Time{},
+		baseline: baseline{
+			Since:     time.Now().UTC(),
+			Sources:   map[string]bool{},
+			Endpoints: map[string]bool{},
+		},
+	}
+
+	if config.BaselinePath == "" {
+		return detector, nil
+	}
+
+	content, err := os.ReadFile(config.BaselinePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return detector, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var persisted baseline
+	if err := json.Unmarshal(content, &persisted); err != nil {
+		log.Warn().Err(err).Msg("unable to read the access baseline, learning it again")
+
+		return detector, nil
+	}
+
+	if persisted.Sources != nil {
+		detector.baseline.Sources = persisted.Sources
+	}
+
+	if persisted.Endpoints != nil {
+		detector.baseline.Endpoints = persisted.Endpoints
+	}
+
+	detector.baseline.Since = persisted.Since
+
+	return detector, nil
+}
+
+// Enable makes detector the detector of the agent API
+func Enable(detector *Detector) {
+	defaultDetectorMu.Lock()
+	defer defaultDetectorMu.Unlock()
+
+	defaultDetector = detector
+}
+
+// DefaultDetector returns the enabled detector, nil when the detection is disabled
+func DefaultDetector() *Detector {
+	defaultDetectorMu.Lock()
+	defer defaultDetectorMu.Unlock()
+
+	return defaultDetector
+}
+
+// Middleware reports the requests handled by next to the enabled detector
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		detector := DefaultDetector()
+		if detector == nil {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		detector.Observe(r, recorder.status)
+	})
+}
+
+// RecordReplay reports a replayed request to the enabled detector, if any
+func RecordReplay(r *http.Request) {
+	if detector := DefaultDetector(); detector != nil {
+		detector.raise(Alert{
+			Kind:     KindReplay,
+			SourceIP: sourceIP(r),
+			Method:   r.Method,
+			Path:     r.URL.Path,
+			Message:  fmt.Sprintf("replayed request %s %s from %s", r.Method, r.URL.Path, sourceIP(r)),
+		})
+	}
+}
+
+// Diagnostics returns a diagnostic message for each kind of alert raised by the enabled detector during the last day
+func Diagnostics() []string {
+	detector := DefaultDetector()
+	if detector == nil {
+		return nil
+	}
+
+	return detector.Diagnostics()
+}
+
+// Observe records a request of the agent API answered with status
+func (detector *Detector) Observe(r *http.Request, status int) {
+	now := time.Now()
+	ip := sourceIP(r)
+
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		detector.observeFailure(ip, now)
+	case status < http.StatusBadRequest:
+		detector.observeSuccess(r, ip, now)
+	}
+}
+
+func (detector *Detector) observeFailure(ip string, now time.Time) {
+	detector.mu.Lock()
+
+	failures := detector.failures[ip][:0]
+	for _, t := range detector.failures[ip] {
+		if now.Sub(t) < detector.config.FailedAuthWindow {
+			failures = append(failures, t)
+		}
+	}
+	failures = append(failures, now)
+
+	if len(detector.failures) > maxTrackedSources {
+		for source, times := range detector.failures {
+			if now.Sub(times[len(times)-1]) >= detector.config.FailedAuthWindow {
+				delete(detector.failures, source)
+			}
+		}
+	}
+
+	burst := detector.config.FailedAuthThreshold > 0 && len(failures) >= detector.config.FailedAuthThreshold
+	if burst {
+		delete(detector.failures, ip)
+	} else {
+		detector.failures[ip] = failures
+	}
+
+	detector.mu.Unlock()
+
+	if burst {
+		detector.raise(Alert{
+			Kind:     KindFailedAuth,
+			SourceIP: ip,
+			Message:  fmt.Sprintf("%d failed authentications from %s within %s", len(failures), ip, detector.config.FailedAuthWindow),
+		})
+	}
+}
+
+func (detector *Detector) observeSuccess(r *http.Request, ip string, now time.Time) {
+	endpoint := r.Method + " " + normalizePath(r.URL.Path)
+
+	detector.mu.Lock()
+
+	learning := now.Before(detector.baseline.Since.Add(detector.config.LearningPeriod))
+	newSource := !detector.baseline.Sources[ip]
+	newEndpoint := !detector.baseline.Endpoints[endpoint]
+
+	if newSource {
+		detector.baseline.Sources[ip] = true
+	}
+
+	if newEndpoint {
+		detector.baseline.Endpoints[endpoint] = true
+	}
+
+	detector.mu.Unlock()
+
+	if !newSource && !newEndpoint {
+		return
+	}
+
+	detector.saveBaseline()
+
+	if learning {
+		return
+	}
+
+	if newSource {
+		detector.raise(Alert{
+			Kind:     KindNewSource,
+			SourceIP: ip,
+			Method:   r.Method,
+			Path:     r.URL.Path,
+			Message:  fmt.Sprintf("request from the new source address %s", ip),
+		})
+	}
+
+	if newEndpoint {
+		detector.raise(Alert{
+			Kind:     KindUnusualEndpoint,
+			SourceIP: ip,
+			Method:   r.Method,
+			Path:     r.URL.Path,
+			Message:  fmt.Sprintf("request to the unusual endpoint %s from %s", endpoint, ip),
+		})
+	}
+}
+
+// raise records the alert, publishes it on the event bus and sends it to the webhook
+func (detector *Detector) raise(alert Alert) {
+	alert.Time = time.Now().UTC()
+
+	detector.mu.Lock()
+	detector.alerts = append(detector.alerts, alert)
+	if len(detector.alerts) > maxAlerts {
+		detector.alerts = detector.alerts[len(detector.alerts)-maxAlerts:]
+	}
+	detector.mu.Unlock()
+
+	log.Warn().
+		Str("kind", alert.Kind).
+		Str("source_ip", alert.SourceIP).
+		Str("path", alert.Path).
+		Msg(alert.Message)
+
+	eventbus.Publish(eventbus.TypeAlert, alert)
+	notify.Notify(notify.SourceAnomaly, alert.Message)
+
+	if detector.config.Emitter != nil {
+		go detector.config.Emitter.Emit(alert)
+	}
+}
+
+// Alerts returns the alerts raised since start, the most recent last
+func (detector *Detector) Alerts() []Alert {
+	detector.mu.Lock()
+	defer detector.mu.Unlock()
+
+	return append([]Alert(nil), detector.alerts...)
+}
+
+// Diagnostics returns a diagnostic message for each kind of alert raised during the last day
+func (detector *Detector) Diagnostics() []string {
+	counts := map[string]int{}
+	last := map[string]Alert{}
+
+	for _, alert := range detector.Alerts() {
+		if time.Since(alert.Time) > diagnosticsWindow {
+			continue
+		}
+
+		counts[alert.Kind]++
+		last[alert.Kind] = alert
+	}
+
+	var diagnostics []string
+	for kind, count := range counts {
+		diagnostics = append(diagnostics, fmt.Sprintf("%d %s alert(s) on the agent API during the last day, last: %s", count, kind, last[kind].Message))
+	}
+	sort.Strings(diagnostics)
+
+	return diagnostics
+}
+
+func (detector *Detector) saveBaseline() {
+	if detector.config.BaselinePath == "" {
+		return
+	}
+
+	detector.mu.Lock()
+	content, err := json.Marshal(detector.baseline)
+	detector.mu.Unlock()
+
+	if err == nil {
+		err = os.WriteFile(detector.config.BaselinePath, content, 0600)
+	}
+
+	if err != nil {
+		log.Warn().Err(err).Msg("unable to persist the access baseline")
+	}
+}
+
+// normalizePath replaces the segments identifying a resource with {id}
+func normalizePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if idSegmentRegexp.MatchString(segment) {
+			segments[i] = "{id}"
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// statusRecorder records the status of the response, it implements the optional interfaces used by the proxies and
+// the websockets of the agent API
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	if !recorder.wroteHeader {
+		recorder.status = status
+		recorder.wroteHeader = true
+	}
+
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+func (recorder *statusRecorder) Write(p []byte) (int, error) {
+	recorder.wroteHeader = true
+
+	return recorder.ResponseWriter.Write(p)
+}
+
+func (recorder *statusRecorder) Flush() {
+	if flusher, ok := recorder.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (recorder *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := recorder.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the response writer does not support hijacking")
+	}
+
+	return hijacker.Hijack()
+}
+
+// Unwrap allows http.ResponseController to reach the underlying response writer
+func (recorder *statusRecorder) Unwrap() http.ResponseWriter {
+	return recorder.ResponseWriter
+}
@@ -0,0 +1,162 @@
+package anomaly
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/portainer/agent"
+)
+
+func request(method, path, remoteAddr string) *http.Request {
+	r := httptest.NewRequest(method, path, nil)
+	r.RemoteAddr = remoteAddr
+
+	return r
+}
+
+func kinds(alerts []Alert) []string {
+	var kinds []string
+	for _, alert := range alerts {
+		kinds = append(kinds, alert.Kind)
+	}
+
+	return kinds
+}
+
+func TestFailedAuthBurst(t *testing.T) {
+	detector, err := NewDetector(Config{FailedAuthThreshold: 3, FailedAuthWindow: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		detector.Observe(request(http.MethodGet, "/docker/info", "10.0.0.9:1234"), http.StatusForbidden)
+		detector.Observe(request(http.MethodGet, "/docker/info", "10.0.0.8:1234"), http.StatusForbidden)
+	}
+
+	if alerts := detector.Alerts(); len(alerts) != 0 {
+		t.Fatalf("expected no alert below the threshold, got %v", kinds(alerts))
+	}
+
+	detector.Observe(request(http.MethodGet, "/docker/info", "10.0.0.9:1234"), http.StatusUnauthorized)
+
+	alerts := detector.Alerts()
+	if len(alerts) != 1 || alerts[0].Kind != KindFailedAuth || alerts[0].SourceIP != "10.0.0.9" {
+		t.Fatalf("expected a failed authentication alert for 10.0.0.9, got %+v", alerts)
+	}
+
+	if diagnostics := detector.Diagnostics(); len(diagnostics) != 1 {
+		t.Errorf("expected a diagnostic for the alert, got %v", diagnostics)
+	}
+}
+
+func TestLearningPeriod(t *testing.T) {
+	baselinePath := filepath.Join(t.TempDir(), "baseline.json")
+
+	detector, err := NewDetector(Config{LearningPeriod: time.Hour, BaselinePath: baselinePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	detector.Observe(request(http.MethodGet, "/docker/containers/0123456789abcdef/json", "10.0.0.1:1234"), http.StatusOK)
+
+	if alerts := detector.Alerts(); len(alerts) != 0 {
+		t.Fatalf("expected no alert during the learning period, got %v", kinds(alerts))
+	}
+
+	// The detector is restarted once the learning period is over, the baseline is read from the file
+	detector, err = NewDetector(Config{LearningPeriod: time.Hour, BaselinePath: baselinePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	detector.baseline.Since = time.Now().Add(-2 * time.Hour)
+
+	detector.Observe(request(http.MethodGet, "/docker/containers/fedcba9876543210/json", "10.0.0.1:4321"), http.StatusOK)
+	detector.Observe(request(http.MethodGet, "/docker/containers/fedcba9876543210/json", "10.0.0.2:1234"), http.StatusNotFound)
+
+	if alerts := detector.Alerts(); len(alerts) != 0 {
+		t.Fatalf("expected no alert for the learned accesses, got %v", kinds(alerts))
+	}
+
+	detector.Observe(request(http.MethodPost, "/host/reboot", "10.0.0.2:1234"), http.StatusOK)
+	detector.Observe(request(http.MethodPost, "/host/reboot", "10.0.0.2:1234"), http.StatusOK)
+
+	alerts := detector.Alerts()
+	if len(alerts) != 2 || alerts[0].Kind != KindNewSource || alerts[1].Kind != KindUnusualEndpoint {
+		t.Fatalf("expected a single new source and unusual endpoint alert, got %v", kinds(alerts))
+	}
+}
+
+func TestMiddlewareAndReplay(t *testing.T) {
+	detector, err := NewDetector(Config{FailedAuthThreshold: 1, FailedAuthWindow: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Enable(detector)
+	defer Enable(nil)
+
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), request(http.MethodGet, "/ping", "10.0.0.3:1234"))
+	RecordReplay(request(http.MethodPost, "/webhooks/redeploy", "10.0.0.3:1234"))
+
+	alerts := detector.Alerts()
+	if len(alerts) != 2 || alerts[0].Kind != KindFailedAuth || alerts[1].Kind != KindReplay {
+		t.Fatalf("expected a failed authentication and a replay alert, got %v", kinds(alerts))
+	}
+}
+
+func TestWebhookEmitter(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	var payload []byte
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, _ = io.ReadAll(r.Body)
+		received <- r
+	}))
+	defer srv.Close()
+
+	NewWebhookEmitter(srv.URL, "secret").Emit(Alert{Kind: KindReplay, Message: "replayed request"})
+
+	r := <-received
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(r.Header.Get(agent.HTTPWebhookTimestampHeaderName) + "."))
+	mac.Write(payload)
+
+	if r.Header.Get(agent.HTTPWebhookSignatureHeaderName) != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+		t.Error("expected the alert to be signed with the webhook secret")
+	}
+
+	var alert Alert
+	if err := json.Unmarshal(payload, &alert); err != nil || alert.Kind != KindReplay {
+		t.Errorf("expected the alert to be sent, got %s", payload)
+	}
+}
+
+func TestNormalizePath(t *testing.T) {
+	tests := map[string]string{
+		"/docker/containers/0123456789abcdef/json":              "/docker/containers/{id}/json",
+		"/operations/6f1c1d0e-0b6a-4b53-9b0b-3f8c0f6f6a4e":      "/operations/{id}",
+		"/kubernetes/api/v1/namespaces/default/pods":            "/kubernetes/api/v1/namespaces/default/pods",
+		"/docker/v1.41/images/sha256:0123456789abcdef0123/json": "/docker/v1.41/images/sha256:0123456789abcdef0123/json",
+		"/edge/stacks/12": "/edge/stacks/{id}",
+	}
+
+	for path, expected := range tests {
+		if normalized := normalizePath(path); normalized != expected {
+			t.Errorf("%s: expected %s, got %s", path, expected, normalized)
+		}
+	}
+}
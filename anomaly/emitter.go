@@ -0,0 +1,79 @@
+package anomaly
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/portainer/agent"
+
+	"github.com/rs/zerolog/log"
+)
+
+// emitTimeout is the maximum duration of the delivery of an alert to the webhook
+const emitTimeout = 10 * time.Second
+
+// WebhookEmitter sends the alerts to a webhook. When a secret is set, the payload is signed like the webhooks received
+// by the agent: the signature header contains the HMAC-SHA256 of "<timestamp>.<payload>" in the sha256=<hex> form.
+type WebhookEmitter struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+// NewWebhookEmitter returns a pointer to a WebhookEmitter sending the alerts to url
+func NewWebhookEmitter(url, secret string) *WebhookEmitter {
+	return &WebhookEmitter{
+		url:    url,
+		secret: []byte(secret),
+		client: &http.Client{Timeout: emitTimeout},
+	}
+}
+
+// Emit sends the alert to the webhook, the failures are logged
+func (emitter *WebhookEmitter) Emit(alert Alert) {
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), emitTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, emitter.url, bytes.NewReader(payload))
+	if err != nil {
+		log.Warn().Err(err).Msg("unable to send the alert to the webhook")
+
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if len(emitter.secret) > 0 {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+		mac := hmac.New(sha256.New, emitter.secret)
+		mac.Write([]byte(timestamp + "."))
+		mac.Write(payload)
+
+		req.Header.Set(agent.HTTPWebhookTimestampHeaderName, timestamp)
+		req.Header.Set(agent.HTTPWebhookSignatureHeaderName, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := emitter.client.Do(req)
+	if err != nil {
+		log.Warn().Err(err).Msg("unable to send the alert to the webhook")
+
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		log.Warn().Int("status", resp.StatusCode).Msg("the webhook refused the alert")
+	}
+}
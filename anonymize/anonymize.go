@@ -0,0 +1,182 @@
+// Package anonymize produces anonymized copies of the snapshots of the environment, that can safely be attached to
+// support tickets or public issues. The names and the identifiers are replaced with hashes that are consistent within
+// a copy, so that the references between the resources are preserved, the environment variables, labels, commands
+// and addresses are stripped, and the structure and the counts of the snapshot are kept.
+package anonymize
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+)
+
+// StrippedValue is the placeholder used in place of a stripped value
+const StrippedValue = "<stripped>"
+
+// hashPrefix is the prefix of the hashed values, hashLength the number of hexadecimal characters of the hash
+const (
+	hashPrefix = "anon-"
+	hashLength = 12
+)
+
+// hashedFields are the fields whose values are names or identifiers, replaced with their hash
+var hashedFields = map[string]bool{
+	"Name": true, "Names": true, "Hostname": true, "Domainname": true, "Image": true, "ImageID": true,
+	"RepoTags": true, "RepoDigests": true, "Id": true, "ID": true, "ParentId": true, "Parent": true,
+	"ContainerID": true, "NetworkID": true, "EndpointID": true, "NodeID": true, "NodeAddr": true, "ServiceID": true,
+	"TaskID": true, "Source": true, "Destination": true, "Mountpoint": true, "DockerRootDir": true,
+	"Namespace": true, "NodeName": true,
+}
+
+// strippedFields are the fields whose values may contain secrets or personal data, replaced with StrippedValue
+var strippedFields = map[string]bool{
+	"Env": true, "Labels": true, "Annotations": true, "Command": true, "Cmd": true, "Entrypoint": true, "Args": true,
+	"IPAddress": true, "GlobalIPv6Address": true, "Gateway": true, "IPv6Gateway": true, "MacAddress": true,
+	"Aliases": true, "DNSNames": true, "RemoteManagers": true, "HttpProxy": true, "HttpsProxy": true,
+	"NoProxy": true, "RegistryConfig": true, "Options": true, "DiagnosticsData": true,
+}
+
+// keyedFields are the objects whose keys are names, e.g. the networks of a container keyed by network name
+var keyedFields = map[string]bool{
+	"Networks": true,
+}
+
+// Anonymizer anonymizes the snapshots with a random key, the hashes of two anonymizers cannot be correlated
+type Anonymizer struct {
+	key []byte
+}
+
+// New returns a pointer to an Anonymizer using a new random key
+func New() (*Anonymizer, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	return &Anonymizer{key: key}, nil
+}
+
+// NewWithKey returns a pointer to an Anonymizer using key, the hashes of the anonymizers sharing a key can be
+// correlated, e.g. to compare the anonymized snapshots of two environments
+func NewWithKey(key []byte) *Anonymizer {
+	return &Anonymizer{key: key}
+}
+
+// Anonymize returns the anonymized JSON representation of v
+func (anonymizer *Anonymizer) Anonymize(v interface{}) (json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	// the numbers are kept as such instead of being converted to floats
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(anonymizer.walk("", value))
+}
+
+// Hash returns the hash of a name or an identifier, the leading slash of the container names is preserved
+func (anonymizer *Anonymizer) Hash(s string) string {
+	if s == "" {
+		return ""
+	}
+
+	prefix := ""
+	if strings.HasPrefix(s, "/") {
+		prefix, s = "/", s[1:]
+	}
+
+	mac := hmac.New(sha256.New, anonymizer.key)
+	mac.Write([]byte(s))
+
+	return prefix + hashPrefix + hex.EncodeToString(mac.Sum(nil))[:hashLength]
+}
+
+// walk returns the anonymized copy of the value of field
+func (anonymizer *Anonymizer) walk(field string, value interface{}) interface{} {
+	switch {
+	case hashedFields[field]:
+		return anonymizer.hash(value)
+	case strippedFields[field]:
+		return anonymizer.strip(value)
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		anonymized := make(map[string]interface{}, len(value))
+		for key, v := range value {
+			if keyedFields[field] {
+				anonymized[anonymizer.Hash(key)] = anonymizer.walk("", v)
+			} else {
+				anonymized[key] = anonymizer.walk(key, v)
+			}
+		}
+
+		return anonymized
+	case []interface{}:
+		anonymized := make([]interface{}, len(value))
+		for i, v := range value {
+			anonymized[i] = anonymizer.walk(field, v)
+		}
+
+		return anonymized
+	}
+
+	return value
+}
+
+// hash replaces the strings of value with their hash, the objects are walked
+func (anonymizer *Anonymizer) hash(value interface{}) interface{} {
+	switch value := value.(type) {
+	case string:
+		return anonymizer.Hash(value)
+	case []interface{}:
+		anonymized := make([]interface{}, len(value))
+		for i, v := range value {
+			anonymized[i] = anonymizer.hash(v)
+		}
+
+		return anonymized
+	}
+
+	return anonymizer.walk("", value)
+}
+
+// strip replaces the strings of value with StrippedValue, the keys of the objects are hashed so that their number
+// is preserved
+func (anonymizer *Anonymizer) strip(value interface{}) interface{} {
+	switch value := value.(type) {
+	case string:
+		if value == "" {
+			return value
+		}
+
+		return StrippedValue
+	case []interface{}:
+		stripped := make([]interface{}, len(value))
+		for i, v := range value {
+			stripped[i] = anonymizer.strip(v)
+		}
+
+		return stripped
+	case map[string]interface{}:
+		stripped := make(map[string]interface{}, len(value))
+		for key, v := range value {
+			stripped[anonymizer.Hash(key)] = anonymizer.strip(v)
+		}
+
+		return stripped
+	}
+
+	return value
+}
@@ -0,0 +1,125 @@
+package anonymize
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type testContainer struct {
+	Id              string
+	Names           []string
+	Image           string
+	Command         string
+	State           string
+	Labels          map[string]string
+	SizeRw          int64
+	NetworkSettings struct {
+		Networks map[string]struct {
+			NetworkID string
+			IPAddress string
+		}
+	}
+}
+
+type testSnapshot struct {
+	Info struct {
+		Name          string
+		NCPU          int
+		ServerVersion string
+	}
+	Containers []testContainer
+	Env        []string
+}
+
+func newTestSnapshot() testSnapshot {
+	var snapshot testSnapshot
+	snapshot.Info.Name = "factory-gateway-12"
+	snapshot.Info.NCPU = 4
+	snapshot.Info.ServerVersion = "24.0.7"
+	snapshot.Env = []string{"DB_PASSWORD=hunter2", "TZ=UTC"}
+
+	container := testContainer{
+		Id:      "3f4e9b2c",
+		Names:   []string{"/billing-db"},
+		Image:   "registry.acme.local/billing/postgres:15",
+		Command: "postgres -c password=hunter2",
+		State:   "running",
+		Labels:  map[string]string{"com.acme.customer": "ACME Corp", "com.acme.owner": "jdoe"},
+		SizeRw:  1024,
+	}
+	container.NetworkSettings.Networks = map[string]struct {
+		NetworkID string
+		IPAddress string
+	}{"billing_backend": {NetworkID: "9a8b7c", IPAddress: "10.0.3.2"}}
+
+	snapshot.Containers = []testContainer{container, {Id: "3f4e9b2c", State: "exited"}}
+
+	return snapshot
+}
+
+func TestAnonymize(t *testing.T) {
+	anonymizer, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := anonymizer.Anonymize(newTestSnapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, leaked := range []string{"factory-gateway", "billing", "hunter2", "acme", "ACME", "jdoe", "10.0.3.2", "9a8b7c", "3f4e9b2c", "postgres"} {
+		if strings.Contains(string(data), leaked) {
+			t.Errorf("the anonymized snapshot leaks %q: %s", leaked, data)
+		}
+	}
+
+	var anonymized testSnapshot
+	if err := json.Unmarshal(data, &anonymized); err != nil {
+		t.Fatal(err)
+	}
+
+	if anonymized.Info.NCPU != 4 || anonymized.Info.ServerVersion != "24.0.7" || len(anonymized.Containers) != 2 {
+		t.Fatalf("expected the structure and the counts to be preserved, got %s", data)
+	}
+
+	container := anonymized.Containers[0]
+	if container.State != "running" || container.SizeRw != 1024 || len(container.Labels) != 2 || len(container.NetworkSettings.Networks) != 1 {
+		t.Fatalf("expected the container state, size and counts to be preserved, got %+v", container)
+	}
+
+	if container.Id != anonymized.Containers[1].Id || container.Id != anonymizer.Hash("3f4e9b2c") {
+		t.Fatalf("expected the identifiers to be hashed consistently, got %s and %s", container.Id, anonymized.Containers[1].Id)
+	}
+
+	if !strings.HasPrefix(container.Names[0], "/"+hashPrefix) {
+		t.Fatalf("expected the leading slash of the container name to be preserved, got %s", container.Names[0])
+	}
+
+	if anonymized.Env[0] != StrippedValue || container.Command != StrippedValue {
+		t.Fatalf("expected the environment and the command to be stripped, got %v and %s", anonymized.Env, container.Command)
+	}
+}
+
+func TestHash(t *testing.T) {
+	first, _ := New()
+	second, _ := New()
+
+	if first.Hash("billing-db") == second.Hash("billing-db") {
+		t.Fatal("expected the hashes of two anonymizers to differ")
+	}
+
+	if first.Hash("") != "" {
+		t.Fatal("expected the empty values to be preserved")
+	}
+}
+
+func TestNewWithKey(t *testing.T) {
+	first := NewWithKey([]byte("shared-key"))
+	second := NewWithKey([]byte("shared-key"))
+
+	if first.Hash("billing-db") != second.Hash("billing-db") {
+		t.Fatal("expected the hashes of two anonymizers sharing a key to match")
+	}
+}
@@ -0,0 +1,301 @@
+// Package audit records the interactive sessions opened in the containers through the agent (exec, attach and pod
+// exec), the port-forwards it brokers and the credentials it issues, so that the commands run inside the containers
+// can be traced back to the users who ran them.
+package audit
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/eventbus"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Kinds of the sessions
+const (
+	SessionExec   = "exec"
+	SessionAttach = "attach"
+	SessionPod    = "pod"
+	// SessionPortForward is a port-forward to a device of the local network, its data is never recorded
+	SessionPortForward = "port_forward"
+	// SessionKubeconfig is the issuance of a kubeconfig, recorded as a single EventIssue event
+	SessionKubeconfig = "kubeconfig"
+)
+
+// Types of the events of a session
+const (
+	EventStart  = "start"
+	EventInput  = "input"
+	EventOutput = "output"
+	EventEnd    = "end"
+	EventIssue  = "issue"
+)
+
+const (
+	// FileName is the name of the file of the audit trail inside the audit folder, the rotated files are suffixed
+	// with .1 (the most recent) up to .<maxBackups>
+	FileName   = "sessions.log"
+	maxBackups = 5
+)
+
+var (
+	defaultRecorder   *Recorder
+	defaultRecorderMu sync.Mutex
+)
+
+// Event represents an entry of the audit trail
+type Event struct {
+	Time      time.Time `json:"time"`
+	SessionID string    `json:"sessionId"`
+	Type      string    `json:"type"`
+	Kind      string    `json:"kind,omitempty"`
+	// Target is the container of the session, or the namespace/pod/container of a pod exec
+	Target     string `json:"target,omitempty"`
+	Command    string `json:"command,omitempty"`
+	User       string `json:"user,omitempty"`
+	RemoteAddr string `json:"remoteAddr,omitempty"`
+	// Data is the input or the output of the session, recorded in full mode only
+	Data  string `json:"data,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Recorder writes the events of the sessions to a rotating file of the data folder and forwards the start and end
+// of the sessions to the event bus, when enabled
+type Recorder struct {
+	dir     string
+	level   string
+	maxSize int64
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewRecorder returns a pointer to a Recorder writing in dir. level is agent.AuditSessionsMetadata or
+// agent.AuditSessionsFull, the file is rotated once it exceeds maxSize bytes.
+func NewRecorder(dir, level string, maxSize int64) (*Recorder, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	recorder := &Recorder{
+		dir:     dir,
+		level:   level,
+		maxSize: maxSize,
+	}
+
+	err = recorder.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return recorder, nil
+}
+
+// Enable makes recorder the recorder of the sessions opened through the agent API
+func Enable(recorder *Recorder) {
+	defaultRecorderMu.Lock()
+	defer defaultRecorderMu.Unlock()
+
+	defaultRecorder = recorder
+}
+
+// Enabled returns true when the sessions are recorded
+func Enabled() bool {
+	return enabledRecorder() != nil
+}
+
+func enabledRecorder() *Recorder {
+	defaultRecorderMu.Lock()
+	defer defaultRecorderMu.Unlock()
+
+	return defaultRecorder
+}
+
+func (recorder *Recorder) open() error {
+	path := filepath.Join(recorder.dir, FileName)
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+
+		return err
+	}
+
+	recorder.file = file
+	recorder.size = info.Size()
+
+	return nil
+}
+
+// rotate shifts the rotated files, the oldest one is removed, and opens a new file
+func (recorder *Recorder) rotate() error {
+	recorder.file.Close()
+
+	path := filepath.Join(recorder.dir, FileName)
+
+	os.Remove(fmt.Sprintf("%s.%d", path, maxBackups))
+	for i := maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1))
+	}
+
+	err := os.Rename(path, path+".1")
+	if err != nil {
+		return err
+	}
+
+	return recorder.open()
+}
+
+func (recorder *Recorder) record(event Event) {
+	if event.Type == EventStart || event.Type == EventEnd || event.Type == EventIssue {
+		eventbus.Publish(eventbus.TypeAudit, event)
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Warn().Err(err).Str("session_id", event.SessionID).Msg("unable to encode the audit event")
+
+		return
+	}
+	data = append(data, '\n')
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	if recorder.size > 0 && recorder.size+int64(len(data)) > recorder.maxSize {
+		if err := recorder.rotate(); err != nil {
+			log.Error().Err(err).Msg("unable to rotate the audit trail")
+
+			return
+		}
+	}
+
+	n, err := recorder.file.Write(data)
+	recorder.size += int64(n)
+	if err != nil {
+		log.Error().Err(err).Str("session_id", event.SessionID).Msg("unable to write the audit event")
+	}
+}
+
+// Session records the events of an interactive session, a nil Session records nothing
+type Session struct {
+	recorder *Recorder
+	id       string
+	started  time.Time
+}
+
+// StartSession records the start of a session with the enabled recorder, it returns nil when the sessions are not
+// recorded
+func StartSession(kind, target, command, user, remoteAddr string) *Session {
+	recorder := enabledRecorder()
+	if recorder == nil {
+		return nil
+	}
+
+	session := &Session{
+		recorder: recorder,
+		id:       newSessionID(),
+		started:  time.Now().UTC(),
+	}
+
+	recorder.record(Event{
+		Time:       session.started,
+		SessionID:  session.id,
+		Type:       EventStart,
+		Kind:       kind,
+		Target:     target,
+		Command:    command,
+		User:       user,
+		RemoteAddr: remoteAddr,
+	})
+
+	return session
+}
+
+// RecordIssue records the issuance of a credential with the enabled recorder, command describes its scope
+func RecordIssue(kind, target, command, user, remoteAddr string) {
+	recorder := enabledRecorder()
+	if recorder == nil {
+		return
+	}
+
+	recorder.record(Event{
+		Time:       time.Now().UTC(),
+		SessionID:  newSessionID(),
+		Type:       EventIssue,
+		Kind:       kind,
+		Target:     target,
+		Command:    command,
+		User:       user,
+		RemoteAddr: remoteAddr,
+	})
+}
+
+// RecordsData returns true when the input and output of the session are recorded
+func (session *Session) RecordsData() bool {
+	return session != nil && session.recorder.level == agent.AuditSessionsFull
+}
+
+// Input records data sent by the user to the session
+func (session *Session) Input(data []byte) {
+	session.recordData(EventInput, data)
+}
+
+// Output records data written by the session
+func (session *Session) Output(data []byte) {
+	session.recordData(EventOutput, data)
+}
+
+func (session *Session) recordData(eventType string, data []byte) {
+	if !session.RecordsData() || len(data) == 0 {
+		return
+	}
+
+	session.recorder.record(Event{
+		Time:      time.Now().UTC(),
+		SessionID: session.id,
+		Type:      eventType,
+		Data:      string(data),
+	})
+}
+
+// End records the end of the session, err is the reason the session ended abnormally
+func (session *Session) End(err error) {
+	if session == nil {
+		return
+	}
+
+	event := Event{
+		Time:      time.Now().UTC(),
+		SessionID: session.id,
+		Type:      EventEnd,
+	}
+
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	session.recorder.record(event)
+}
+
+func newSessionID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
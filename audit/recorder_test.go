@@ -0,0 +1,130 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/portainer/agent"
+)
+
+func readEvents(t *testing.T, path string) []Event {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var events []Event
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatal(err)
+		}
+
+		events = append(events, event)
+	}
+
+	return events
+}
+
+func TestSession_Metadata(t *testing.T) {
+	dir := t.TempDir()
+
+	recorder, err := NewRecorder(dir, agent.AuditSessionsMetadata, 1024*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Enable(recorder)
+	defer Enable(nil)
+
+	session := StartSession(SessionExec, "abc", "sh -c id", "admin", "10.0.0.1:4000")
+	session.Input([]byte("ls\n"))
+	session.Output([]byte("bin etc\n"))
+	session.End(errors.New("connection reset"))
+
+	events := readEvents(t, filepath.Join(dir, FileName))
+	if len(events) != 2 {
+		t.Fatalf("expected the start and the end of the session only, got %+v", events)
+	}
+
+	start, end := events[0], events[1]
+	if start.Type != EventStart || start.Command != "sh -c id" || start.User != "admin" || start.Target != "abc" {
+		t.Fatalf("unexpected start event %+v", start)
+	}
+
+	if end.Type != EventEnd || end.SessionID != start.SessionID || end.Error != "connection reset" {
+		t.Fatalf("unexpected end event %+v", end)
+	}
+}
+
+func TestSession_FullRotation(t *testing.T) {
+	dir := t.TempDir()
+
+	recorder, err := NewRecorder(dir, agent.AuditSessionsFull, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Enable(recorder)
+	defer Enable(nil)
+
+	session := StartSession(SessionAttach, "abc", "", "", "")
+	for i := 0; i < 10; i++ {
+		session.Input([]byte("ls\n"))
+	}
+	session.End(nil)
+
+	if _, err := os.Stat(filepath.Join(dir, FileName+".1")); err != nil {
+		t.Fatalf("expected the audit trail to be rotated: %s", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, FileName+".6")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal("expected at most 5 rotated files")
+	}
+
+	events := readEvents(t, filepath.Join(dir, FileName))
+	if last := events[len(events)-1]; last.Type != EventEnd {
+		t.Fatalf("expected the session to end in the current file, got %+v", last)
+	}
+}
+
+func TestStartSession_Disabled(t *testing.T) {
+	session := StartSession(SessionExec, "abc", "sh", "", "")
+	if session != nil {
+		t.Fatal("expected no session without recorder")
+	}
+
+	// A nil session records nothing
+	session.Input([]byte("ls\n"))
+	session.End(nil)
+}
+
+func TestRecordIssue(t *testing.T) {
+	dir := t.TempDir()
+
+	recorder, err := NewRecorder(dir, agent.AuditSessionsMetadata, 1024*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Enable(recorder)
+	defer Enable(nil)
+
+	RecordIssue(SessionKubeconfig, "default/portainer-kubeconfig-1", "role=readonly", "admin", "10.0.0.1:4000")
+
+	events := readEvents(t, filepath.Join(dir, FileName))
+	if len(events) != 1 {
+		t.Fatalf("expected a single event, got %+v", events)
+	}
+
+	if event := events[0]; event.Type != EventIssue || event.Kind != SessionKubeconfig || event.User != "admin" || event.SessionID == "" {
+		t.Fatalf("unexpected event %+v", event)
+	}
+}
@@ -0,0 +1,276 @@
+// Package broker implements the least-privilege mode of the agent: the access to the Docker socket lives in a minimal
+// broker process and the agent runs unprivileged, talking to the broker over a unix socket. The broker only forwards
+// the endpoints of the Docker API used by the agent and rejects the containers and the services mounting the Docker
+// socket, so that a compromised agent cannot take over the Docker daemon.
+package broker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultDockerSocketPath is the path of the Docker socket used when the agent does not go through a broker
+const DefaultDockerSocketPath = "/var/run/docker.sock"
+
+// maxInspectedBodySize is the size of the largest container or service specification inspected by the broker
+const maxInspectedBodySize = 10 << 20
+
+var (
+	socketPath   = DefaultDockerSocketPath
+	socketPathMu sync.Mutex
+)
+
+// versionPrefixRegexp matches the API version prefix of the Docker API paths
+var versionPrefixRegexp = regexp.MustCompile(`^/v[0-9]+\.[0-9]+/`)
+
+// rule allows the requests whose method is one of methods, all the methods when empty, and whose path without the
+// API version prefix matches path
+type rule struct {
+	methods []string
+	path    *regexp.Regexp
+}
+
+// allowedEndpoints are the endpoints of the Docker API used by the agent and by the Portainer UI through the agent
+var allowedEndpoints = []rule{
+	{methods: []string{http.MethodGet, http.MethodHead}, path: regexp.MustCompile(`^/_ping$`)},
+	{methods: []string{http.MethodGet}, path: regexp.MustCompile(`^/(version|info|events|system/df)$`)},
+	{path: regexp.MustCompile(`^/(containers|images|volumes|networks|services|tasks|nodes|secrets|configs|exec|distribution)(/.*)?$`)},
+	{methods: []string{http.MethodPost}, path: regexp.MustCompile(`^/(build|build/prune|auth|commit)$`)},
+	{methods: []string{http.MethodGet}, path: regexp.MustCompile(`^/swarm$`)},
+}
+
+// createEndpointRegexp matches the endpoints creating or updating a container or a service
+var createEndpointRegexp = regexp.MustCompile(`^/(containers/create|services/create|services/[^/]+/update)$`)
+
+// Enable makes the agent talk to the Docker daemon through the broker listening on path
+func Enable(path string) {
+	socketPathMu.Lock()
+	defer socketPathMu.Unlock()
+
+	socketPath = path
+}
+
+// DockerSocketPath returns the path of the socket of the Docker API used by the agent, the socket of the broker when
+// it is enabled
+func DockerSocketPath() string {
+	socketPathMu.Lock()
+	defer socketPathMu.Unlock()
+
+	return socketPath
+}
+
+// Broker forwards the allowed requests of the agent to the Docker socket
+type Broker struct {
+	dockerSocketPath string
+	proxy            *httputil.ReverseProxy
+}
+
+// NewBroker returns a pointer to a Broker forwarding the requests to the Docker socket at dockerSocketPath
+func NewBroker(dockerSocketPath string) *Broker {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+
+			return dialer.DialContext(ctx, "unix", dockerSocketPath)
+		},
+	}
+
+	return &Broker{
+		dockerSocketPath: dockerSocketPath,
+		proxy: &httputil.ReverseProxy{
+			Director: func(r *http.Request) {
+				r.URL.Scheme = "http"
+				r.URL.Host = "docker"
+			},
+			Transport: transport,
+			// the logs, the events and the stats are streamed
+			FlushInterval: -1,
+		},
+	}
+}
+
+// ListenAndServe serves the broker on the unix socket at path, owned by uid when it is not negative so that only the
+// agent can use it
+func (broker *Broker) ListenAndServe(ctx context.Context, path string, uid int) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+
+	mode := os.FileMode(0666)
+	if uid >= 0 {
+		mode = 0600
+		if err := os.Chown(path, uid, -1); err != nil {
+			listener.Close()
+
+			return err
+		}
+	}
+
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+
+		return err
+	}
+
+	server := &http.Server{Handler: broker}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	log.Info().Str("socket", path).Str("docker_socket", broker.dockerSocketPath).Msg("starting the Docker broker")
+
+	err = server.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// ServeHTTP forwards the request to the Docker socket when it is allowed
+func (broker *Broker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := broker.authorize(r); err != nil {
+		log.Warn().Str("method", r.Method).Str("path", r.URL.Path).Err(err).Msg("request denied by the Docker broker")
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"message": err.Error()})
+
+		return
+	}
+
+	broker.proxy.ServeHTTP(w, r)
+}
+
+// authorize returns an error when the request is not allowed by the broker
+func (broker *Broker) authorize(r *http.Request) error {
+	path := versionPrefixRegexp.ReplaceAllString(r.URL.Path, "/")
+
+	if !isAllowed(r.Method, path) {
+		return fmt.Errorf("%s %s is not allowed by the Docker broker", r.Method, path)
+	}
+
+	if r.Method != http.MethodPost || !createEndpointRegexp.MatchString(path) {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxInspectedBodySize+1))
+	r.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	if len(body) > maxInspectedBodySize {
+		return errors.New("the specification is too large to be inspected by the Docker broker")
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	return broker.checkMounts(body)
+}
+
+func isAllowed(method, path string) bool {
+	for _, rule := range allowedEndpoints {
+		if !rule.path.MatchString(path) {
+			continue
+		}
+
+		if len(rule.methods) == 0 {
+			return true
+		}
+
+		for _, allowed := range rule.methods {
+			if method == allowed {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// mountSpec is the part of a container or a service specification defining its mounts
+type mountSpec struct {
+	HostConfig struct {
+		Binds  []string
+		Mounts []mount
+	}
+	TaskTemplate struct {
+		ContainerSpec struct {
+			Mounts []mount
+		}
+	}
+}
+
+type mount struct {
+	Type   string
+	Source string
+}
+
+// checkMounts returns an error when the specification mounts the Docker socket
+func (broker *Broker) checkMounts(body []byte) error {
+	if len(body) == 0 {
+		return nil
+	}
+
+	var spec mountSpec
+	if err := json.Unmarshal(body, &spec); err != nil {
+		return fmt.Errorf("invalid specification: %w", err)
+	}
+
+	var sources []string
+	for _, bind := range spec.HostConfig.Binds {
+		sources = append(sources, strings.SplitN(bind, ":", 2)[0])
+	}
+
+	for _, m := range append(spec.HostConfig.Mounts, spec.TaskTemplate.ContainerSpec.Mounts...) {
+		if m.Type == "" || m.Type == "bind" {
+			sources = append(sources, m.Source)
+		}
+	}
+
+	for _, source := range sources {
+		if broker.isDockerSocket(source) {
+			return fmt.Errorf("mounting the Docker socket %s is not allowed by the Docker broker", source)
+		}
+	}
+
+	return nil
+}
+
+func (broker *Broker) isDockerSocket(source string) bool {
+	source = filepath.Clean(source)
+
+	for _, path := range []string{broker.dockerSocketPath, DefaultDockerSocketPath, "/run/docker.sock"} {
+		if source == path || strings.HasPrefix(path, source+"/") || source == "/" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,112 @@
+package broker
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthorize(t *testing.T) {
+	broker := NewBroker("/var/run/docker.sock")
+
+	tests := []struct {
+		method  string
+		path    string
+		body    string
+		allowed bool
+	}{
+		{http.MethodHead, "/_ping", "", true},
+		{http.MethodGet, "/v1.41/containers/json", "", true},
+		{http.MethodPost, "/v1.41/containers/0123/exec", "", true},
+		{http.MethodGet, "/swarm", "", true},
+		{http.MethodPost, "/v1.41/swarm/leave", "", false},
+		{http.MethodPost, "/v1.41/plugins/pull", "", false},
+		{http.MethodPost, "/session", "", false},
+		{http.MethodPost, "/v1.41/containers/create", `{"Image":"nginx","HostConfig":{"Binds":["/data:/data"]}}`, true},
+		{http.MethodPost, "/v1.41/containers/create", `{"Image":"docker","HostConfig":{"Binds":["/var/run/docker.sock:/var/run/docker.sock"]}}`, false},
+		{http.MethodPost, "/v1.41/containers/create", `{"Image":"docker","HostConfig":{"Mounts":[{"Type":"bind","Source":"/var/run"}]}}`, false},
+		{http.MethodPost, "/v1.41/containers/create", `{"Image":"alpine","HostConfig":{"Binds":["/:/host"]}}`, false},
+		{http.MethodPost, "/services/create", `{"TaskTemplate":{"ContainerSpec":{"Mounts":[{"Type":"bind","Source":"/run/docker.sock"}]}}}`, false},
+		{http.MethodPost, "/services/create", `{"TaskTemplate":{"ContainerSpec":{"Mounts":[{"Type":"volume","Source":"docker.sock"}]}}}`, true},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+
+		err := broker.authorize(r)
+		if (err == nil) != test.allowed {
+			t.Errorf("%s %s %s: expected allowed=%t, got %v", test.method, test.path, test.body, test.allowed, err)
+		}
+
+		if err == nil && test.body != "" {
+			body, _ := io.ReadAll(r.Body)
+			if string(body) != test.body {
+				t.Errorf("%s %s: expected the body to be forwarded, got %q", test.method, test.path, body)
+			}
+		}
+	}
+}
+
+func TestBrokerForwardsToDocker(t *testing.T) {
+	dir := t.TempDir()
+	dockerSocketPath := filepath.Join(dir, "docker.sock")
+	brokerSocketPath := filepath.Join(dir, "broker", "broker.sock")
+
+	listener, err := net.Listen("unix", dockerSocketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docker := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("docker " + r.URL.Path))
+	})}
+	go docker.Serve(listener)
+	defer docker.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go NewBroker(dockerSocketPath).ListenAndServe(ctx, brokerSocketPath, -1)
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return net.Dial("unix", brokerSocketPath)
+		},
+	}}
+
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		resp, err = client.Get("http://docker/v1.41/info")
+		if err == nil {
+			break
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || string(body) != "docker /v1.41/info" {
+		t.Fatalf("expected the request to be forwarded to Docker, got %d %q", resp.StatusCode, body)
+	}
+
+	resp, err = client.Post("http://docker/v1.41/plugins/pull", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected the plugin installation to be denied, got %d", resp.StatusCode)
+	}
+}
@@ -3,9 +3,12 @@ package chisel
 import (
 	"context"
 	"fmt"
+	"net"
 	"sync"
 
 	"github.com/portainer/agent"
+	"github.com/portainer/agent/metrics"
+	agentnet "github.com/portainer/agent/net"
 
 	chclient "github.com/jpillora/chisel/client"
 	"github.com/rs/zerolog/log"
@@ -16,6 +19,8 @@ type Client struct {
 	chiselClient *chclient.Client
 	tunnelOpen   bool
 	mu           sync.Mutex
+	// configure adapts the configuration of the chisel client to the transport
+	configure func(config *chclient.Config) error
 }
 
 // NewClient creates a new reverse tunnel client
@@ -41,6 +46,14 @@ func (client *Client) CreateTunnel(tunnelConfig agent.TunnelConfig) error {
 		Remotes:     []string{remote},
 		Fingerprint: tunnelConfig.ServerFingerprint,
 		Auth:        tunnelConfig.Credentials,
+		DialContext: agentnet.MeterDialContext(agentnet.BandwidthTunnel, countConnections((&net.Dialer{}).DialContext)),
+	}
+
+	if client.configure != nil {
+		err := client.configure(config)
+		if err != nil {
+			return err
+		}
 	}
 
 	chiselClient, err := chclient.NewClient(config)
@@ -78,3 +91,21 @@ func (client *Client) IsTunnelOpen() bool {
 
 	return client.tunnelOpen
 }
+
+// countConnections counts the connections of the tunnel in the metrics, the chisel client dials the server again
+// after losing the connection
+func countConnections(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	connected := false
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		metrics.TunnelConnected(connected)
+		connected = true
+
+		return conn, nil
+	}
+}
@@ -0,0 +1,70 @@
+package chisel
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	chclient "github.com/jpillora/chisel/client"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// webSocketKeepAlive is short enough for the tunnel to never look idle to the proxies closing the idle connections
+	webSocketKeepAlive = 15 * time.Second
+	// webSocketMaxRetryInterval caps the delay between two reconnections of the tunnel
+	webSocketMaxRetryInterval = 30 * time.Second
+)
+
+// NewWebSocketClient creates a reverse tunnel client for the networks where the long-lived websockets are cut by
+// HTTP proxies. The tunnel goes through the proxy configured with the HTTPS_PROXY, HTTP_PROXY and NO_PROXY
+// environment variables, keeps the connection busy and reconnects without limit, binding the remote port again once
+// reconnected.
+func NewWebSocketClient() *Client {
+	return &Client{
+		configure: configureWebSocket,
+	}
+}
+
+func configureWebSocket(config *chclient.Config) error {
+	config.KeepAlive = webSocketKeepAlive
+	config.MaxRetryCount = -1
+	config.MaxRetryInterval = webSocketMaxRetryInterval
+
+	proxyURL, err := environmentProxy(config.Server)
+	if err != nil {
+		return err
+	}
+
+	if proxyURL != nil {
+		log.Debug().Str("proxy", proxyURL.Redacted()).Msg("opening the reverse tunnel through the proxy")
+
+		config.Proxy = proxyURL.String()
+	}
+
+	return nil
+}
+
+// environmentProxy returns the proxy configured in the environment for the tunnel server, nil when the server is
+// reached directly
+func environmentProxy(server string) (*url.URL, error) {
+	if !strings.Contains(server, "://") {
+		server = "http://" + server
+	}
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	// the tunnel is a websocket, the proxy of its HTTP counterpart applies
+	switch serverURL.Scheme {
+	case "ws":
+		serverURL.Scheme = "http"
+	case "wss":
+		serverURL.Scheme = "https"
+	}
+
+	return http.ProxyFromEnvironment(&http.Request{URL: serverURL})
+}
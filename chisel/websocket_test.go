@@ -0,0 +1,34 @@
+package chisel
+
+import (
+	"testing"
+)
+
+func TestEnvironmentProxy(t *testing.T) {
+	t.Setenv("HTTP_PROXY", "http://proxy.corp:3128")
+	t.Setenv("HTTPS_PROXY", "http://secure-proxy.corp:3128")
+	t.Setenv("NO_PROXY", "portainer.internal")
+
+	tests := map[string]string{
+		"portainer.example.com:8000":         "http://proxy.corp:3128",
+		"https://portainer.example.com:8000": "http://secure-proxy.corp:3128",
+		"wss://portainer.example.com:8000":   "http://secure-proxy.corp:3128",
+		"portainer.internal:8000":            "",
+	}
+
+	for server, expected := range tests {
+		proxyURL, err := environmentProxy(server)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %s", server, err)
+		}
+
+		got := ""
+		if proxyURL != nil {
+			got = proxyURL.String()
+		}
+
+		if got != expected {
+			t.Errorf("expected the proxy of %s to be %q, got %q", server, expected, got)
+		}
+	}
+}
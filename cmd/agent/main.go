@@ -4,32 +4,74 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	gohttp "net/http"
 	goos "os"
 	"os/signal"
 	"path"
+	"slices"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/portainer/agent"
+	"github.com/portainer/agent/anomaly"
+	"github.com/portainer/agent/audit"
+	"github.com/portainer/agent/broker"
+	"github.com/portainer/agent/crash"
 	"github.com/portainer/agent/crypto"
+	"github.com/portainer/agent/discovery"
 	"github.com/portainer/agent/docker"
 	"github.com/portainer/agent/edge"
 	"github.com/portainer/agent/edge/aws"
 	httpEdge "github.com/portainer/agent/edge/http"
 	"github.com/portainer/agent/edge/registry"
+	"github.com/portainer/agent/eventbus"
 	"github.com/portainer/agent/exec"
 	"github.com/portainer/agent/filesystem"
 	"github.com/portainer/agent/ghw"
 	"github.com/portainer/agent/healthcheck"
+	"github.com/portainer/agent/hooks"
+	"github.com/portainer/agent/hostaction"
 	"github.com/portainer/agent/http"
+	"github.com/portainer/agent/http/security"
+	"github.com/portainer/agent/identity"
+	"github.com/portainer/agent/imagecache"
 	"github.com/portainer/agent/internals/updates"
+	"github.com/portainer/agent/journal"
+	"github.com/portainer/agent/kernellog"
 	"github.com/portainer/agent/kubernetes"
+	"github.com/portainer/agent/logship"
+	"github.com/portainer/agent/maintenance"
+	"github.com/portainer/agent/memory"
+	"github.com/portainer/agent/metrics"
+	"github.com/portainer/agent/migration"
 	"github.com/portainer/agent/net"
+	"github.com/portainer/agent/netpolicy"
+	"github.com/portainer/agent/notify"
+	"github.com/portainer/agent/operations"
 	"github.com/portainer/agent/os"
+	"github.com/portainer/agent/osupdate"
+	"github.com/portainer/agent/overlay"
+	"github.com/portainer/agent/portforward"
+	"github.com/portainer/agent/posture"
+	"github.com/portainer/agent/power"
+	"github.com/portainer/agent/provisioning"
+	"github.com/portainer/agent/registryauth"
+	"github.com/portainer/agent/relay"
+	"github.com/portainer/agent/retention"
 	cluster "github.com/portainer/agent/serf"
+	"github.com/portainer/agent/shutdown"
+	"github.com/portainer/agent/smart"
+	"github.com/portainer/agent/snapshots"
+	"github.com/portainer/agent/spiffe"
+	"github.com/portainer/agent/stacklock"
+	"github.com/portainer/agent/standby"
+	"github.com/portainer/agent/systemd"
+	"github.com/portainer/agent/thermal"
+	"github.com/portainer/agent/tpm"
+	"github.com/portainer/agent/wasm"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -49,22 +91,254 @@ func main() {
 
 	rand.Seed(time.Now().UnixNano())
 
-	options, err := parseOptions()
+	optionParser := os.NewEnvOptionParser()
+
+	options, err := optionParser.Options()
 	if err != nil {
 		log.Fatal().Err(err).Msg("invalid agent configuration")
 	}
 
+	// the agent is hardened before it executes any process
+	posture.Harden(options.PrivilegeCheck)
+
+	if options.PrintConfig {
+		optionParser.PrintConfig(goos.Stdout)
+		goos.Exit(0)
+	}
+
+	if options.ExportProfile != "" {
+		exportProfile(optionParser, options.ExportProfile)
+		goos.Exit(0)
+	}
+
+	if options.ImportProfile != "" {
+		importProfile(options.DataPath, options.Profile, options.ImportProfile)
+		goos.Exit(0)
+	}
+
+	if options.UseProfile != "" {
+		err := os.UseProfile(options.DataPath, options.UseProfile)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to select the configuration profile")
+		}
+
+		log.Info().Str("profile", options.UseProfile).Msg("configuration profile selected, it will be applied on the next start")
+		goos.Exit(0)
+	}
+
+	if options.ListProfiles {
+		listProfiles(options.DataPath)
+		goos.Exit(0)
+	}
+
+	if options.WriteSecurityProfiles != "" {
+		err := posture.WriteProfiles(options.WriteSecurityProfiles)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to write the security profiles")
+		}
+
+		log.Info().Str("folder", options.WriteSecurityProfiles).Msg("security profiles written")
+		goos.Exit(0)
+	}
+
 	setLoggingLevel(options.LogLevel)
 	setLoggingMode(options.LogMode)
 
+	// the agent cannot remove a secret from the environment of its container, it is only kept out of the inspection
+	// of the container when it is mounted as a file
+	for _, key := range optionParser.ExposedSecrets() {
+		log.Warn().
+			Str("option", key).
+			Msg("the secret is provided through an environment variable or a flag and can be read by inspecting the agent container, mount it as a secret file and enable " + os.EnvKeySecretsFilesOnly + " to reject the other sources")
+	}
+
+	if options.BrokerMode {
+		err := broker.NewBroker(broker.DefaultDockerSocketPath).ListenAndServe(context.Background(), options.DockerBroker, options.BrokerUID)
+		if err != nil {
+			log.Fatal().Err(err).Str("socket", options.DockerBroker).Msg("unable to start the Docker broker")
+		}
+
+		goos.Exit(0)
+	}
+
+	if options.DockerBroker != "" {
+		// The Docker client, the Docker proxy and the deployments through the Docker CLI use the broker
+		broker.Enable(options.DockerBroker)
+		goos.Setenv("DOCKER_HOST", "unix://"+options.DockerBroker)
+	}
+
+	_, err = posture.Check(options.PrivilegeCheck)
+	if err != nil {
+		log.Fatal().Err(err).Msg("the agent is running with more privileges than it needs")
+	}
+
 	if options.EdgeAsyncMode && !options.EdgeMode {
 		log.Fatal().Msg("edge Async mode cannot be enabled if Edge Mode is disabled")
 	}
 
-	if options.SSLCert != "" && options.SSLKey != "" && options.CertRetryInterval > 0 {
+	// The standby instance of a warm standby pair waits here, before it touches the containers, the data folder or
+	// the network, until the primary instance stops answering
+	if options.HASocket != "" && !options.HealthCheck {
+		primary, err := standby.Acquire(context.Background(), options.HASocket)
+		if err != nil {
+			log.Fatal().Err(err).Str("socket", options.HASocket).Msg("unable to acquire the primary role of the agent pair")
+		}
+
+		go func() {
+			<-primary.Fenced()
+
+			log.Fatal().Str("socket", options.HASocket).Msg("another agent instance took over, stopping")
+		}()
+	}
+
+	if options.MTLSEnrollURL != "" {
+		enrollMTLSCertificate(options)
+	} else if options.SSLCert != "" && options.SSLKey != "" && options.CertRetryInterval > 0 {
 		edge.BlockUntilCertificateIsReady(options.SSLCert, options.SSLKey, options.CertRetryInterval)
 	}
 
+	if len(options.EgressAllowlist) > 0 {
+		egressPolicy, err := net.NewEgressPolicy(options.EgressAllowlist)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to parse the egress allowlist")
+		}
+
+		net.EnforceEgressPolicy(egressPolicy)
+
+		log.Info().Strs("allowlist", options.EgressAllowlist).Msg("enforcing the egress allowlist")
+	}
+
+	if len(options.EdgeServerAddressRules) > 0 {
+		splitHorizon, err := net.NewSplitHorizon(options.EdgeServerAddressRules)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to parse the server address rules")
+		}
+
+		net.EnableSplitHorizon(splitHorizon)
+	}
+
+	bandwidthMeter, err := net.NewBandwidthMeter(path.Join(options.DataPath, agent.BandwidthUsageFileName), options.BandwidthMonthlyCap, options.BandwidthWarningThreshold)
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to load the bandwidth usage")
+	}
+
+	net.EnableBandwidthAccounting(bandwidthMeter)
+
+	if len(options.MaintenanceWindows) > 0 {
+		schedule, err := maintenance.NewSchedule(options.MaintenanceWindows)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to parse the maintenance windows")
+		}
+
+		maintenance.EnforceSchedule(schedule)
+
+		log.Info().Strs("windows", options.MaintenanceWindows).Msg("deferring the disruptive operations outside the maintenance windows")
+	}
+
+	if options.OSUpdater != "" {
+		osUpdateService, err := osupdate.NewService(options.OSUpdater, options.HostActionImage)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to create the OS update service")
+		}
+
+		osupdate.Enable(osUpdateService)
+	}
+
+	if len(options.SystemdUnits) > 0 {
+		systemdService, err := systemd.NewService(options.SystemdUnits, options.HostActionImage)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to create the systemd service")
+		}
+
+		systemd.Enable(systemdService)
+	}
+
+	if options.SnapshotStats {
+		docker.EnableSnapshotStats()
+	}
+
+	if options.SnapshotVirtualMachines {
+		docker.EnableSnapshotVirtualMachines()
+	}
+
+	if options.SnapshotOverlayNetworks {
+		docker.EnableSnapshotOverlayNetworks()
+	}
+
+	if options.SnapshotSMART {
+		docker.EnableSnapshotSMART()
+	}
+
+	if options.SnapshotKernelAnomalies {
+		docker.EnableSnapshotKernelAnomalies()
+	}
+
+	if options.SnapshotLANDevices {
+		docker.EnableSnapshotLANDevices()
+	}
+
+	overlay.Enable(overlay.NewService(options.HostActionImage))
+	smart.Enable(smart.NewService(options.HostActionImage))
+	kernellog.Enable(kernellog.NewService(options.HostActionImage))
+	discovery.Enable(discovery.NewService())
+	systemd.EnableJournal(systemd.NewJournal(options.HostActionImage))
+	thermal.Enable(thermal.NewService(options.HostActionImage, options.TemperatureAlertThreshold, options.BatteryAlertThreshold))
+	memory.Enable(memory.NewService(options.HostActionImage))
+
+	if options.WASMPluginsPath != "" {
+		wasmRuntime, err := wasm.NewRuntime(context.Background(), options.WASMPluginsPath, options.WASMPluginTimeout)
+		if err != nil {
+			log.Fatal().Err(err).Str("folder", options.WASMPluginsPath).Msg("unable to load the WebAssembly plugins")
+		}
+
+		wasm.Enable(wasmRuntime)
+	}
+
+	docker.SetSnapshotConcurrency(options.SnapshotConcurrency)
+	docker.SetSnapshotEnvRedaction(options.RedactionPatterns)
+	stacklock.SetConcurrency(options.StackConcurrency)
+
+	if !options.SnapshotEnv {
+		docker.DisableSnapshotEnv()
+	}
+
+	_, err = hostaction.Reconcile(path.Join(options.DataPath, agent.HostActionFileName))
+	if err != nil {
+		log.Warn().Err(err).Msg("unable to determine the outcome of the last host action")
+	}
+
+	tpmDevice := openTPM(options)
+	tpm.Enable(tpmDevice)
+
+	if options.StateEncryption {
+		enableStateEncryption(options, tpmDevice)
+	}
+
+	agentIdentity, err := identity.LoadOrCreate(options.IdentityFile, tpmDevice)
+	if err != nil {
+		log.Fatal().Err(err).Str("path", options.IdentityFile).Msg("unable to load the agent identity")
+	}
+
+	var svidSource *spiffe.X509Source
+	if options.SPIFFEEndpointSocket != "" {
+		svidSource, err = spiffe.NewX509Source(context.Background(), options.SPIFFEEndpointSocket, agent.SPIFFEWorkloadAPITimeout)
+		if err != nil {
+			log.Fatal().Err(err).Str("socket", options.SPIFFEEndpointSocket).Msg("unable to retrieve the agent SVID from the SPIFFE Workload API")
+		}
+	}
+
+	var payloadCipher *crypto.PayloadCipher
+	if options.EdgePayloadServerKey != "" {
+		payloadKeyFile := path.Join(options.DataPath, agent.PayloadKeyFileName)
+
+		payloadCipher, err = crypto.LoadOrCreatePayloadCipher(payloadKeyFile, options.EdgePayloadServerKey)
+		if err != nil {
+			log.Fatal().Err(err).Str("path", payloadKeyFile).Msg("unable to load the key pair encrypting the Edge payloads")
+		}
+
+		log.Info().Str("public_key", payloadCipher.PublicKey()).Msg("encrypting the Edge payloads")
+	}
+
 	systemService := ghw.NewSystemService(agent.HostRoot)
 	containerPlatform := os.DetermineContainerPlatform()
 	runtimeConfiguration := &agent.RuntimeConfiguration{
@@ -85,6 +359,17 @@ func main() {
 	if containerPlatform == agent.PlatformDocker || containerPlatform == agent.PlatformPodman {
 		log.Info().Msg("agent running on Docker platform")
 
+		if containerPlatform == agent.PlatformPodman {
+			docker.SetRuntime(docker.NewRuntime(docker.RuntimePodman))
+		} else if containerRuntime, err := docker.DetectRuntime(context.Background()); err != nil {
+			log.Warn().Err(err).Msg("unable to detect the container runtime, assuming Docker")
+		} else if containerRuntime.Name() == docker.RuntimePodman {
+			log.Info().Msg("Podman engine detected, running in Podman mode")
+
+			docker.SetRuntime(containerRuntime)
+			containerPlatform = agent.PlatformPodman
+		}
+
 		dockerInfoService = docker.NewInfoService()
 
 		runtimeConfiguration, err = dockerInfoService.GetRuntimeConfigurationFromDockerEngine()
@@ -95,6 +380,18 @@ func main() {
 		runtimeConfiguration.AgentPort = options.AgentServerPort
 		log.Debug().Str("member_tags", fmt.Sprintf("%+v", runtimeConfiguration)).Msg("")
 
+		operationJournal, err := journal.Open(path.Join(options.DataPath, agent.JournalDirName))
+		if err != nil {
+			log.Warn().Err(err).Msg("unable to open the operation journal, the operations interrupted by a stop of the agent will not be recovered")
+		} else {
+			journal.Register(journal.TypeContainerRecreate, docker.RecoverContainerRecreate)
+			journal.Register(journal.TypeVolumeBackup, docker.RecoverVolumeBackup)
+			journal.Register(journal.TypeStackDeploy, docker.RecoverStackDeploy)
+
+			operationJournal.Recover(context.Background())
+			journal.Enable(operationJournal)
+		}
+
 		clusterMode := false
 		if runtimeConfiguration.DockerConfiguration.EngineStatus == agent.EngineStatusSwarm {
 			clusterMode = true
@@ -114,6 +411,19 @@ func main() {
 			advertiseAddr = options.AgentServerAddr
 		}
 
+		if containerPlatform == agent.PlatformDocker && options.KubernetesKubeconfig != "" {
+			if err := kubernetes.UseKubeconfig(options.KubernetesKubeconfig); err != nil {
+				log.Fatal().Err(err).Msg("unable to load the kubeconfig of the local Kubernetes cluster")
+			}
+
+			kubeClient, err = kubernetes.NewKubeClient()
+			if err != nil {
+				log.Fatal().Err(err).Msg("unable to create Kubernetes client")
+			}
+
+			log.Info().Msg("agent also managing the local Kubernetes cluster")
+		}
+
 		if containerPlatform == agent.PlatformDocker && options.EdgeMetaFields.UpdateID != 0 {
 			updaterCleaner = updates.NewDockerUpdaterCleaner(options.EdgeMetaFields.UpdateID)
 		}
@@ -295,6 +605,184 @@ func main() {
 	}
 	// !Nomad
 
+	if options.EventBusURL != "" {
+		transport, err := eventbus.NewTransport(options.EventBusURL)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to configure the event bus")
+		}
+
+		eventbus.Enable(eventbus.NewPublisher(transport, options.EventBusSubject, agentIdentity.ID))
+
+		go eventbus.PublishSnapshots(context.Background(), containerPlatform, options.EventBusSnapshotInterval)
+
+		if containerPlatform == agent.PlatformDocker || containerPlatform == agent.PlatformPodman {
+			go eventbus.PublishDockerEvents(context.Background())
+		}
+	}
+
+	if len(options.AlertNotifiers) > 0 {
+		var notifiers []notify.Notifier
+
+		for _, rawURL := range options.AlertNotifiers {
+			notifier, err := notify.NewNotifier(rawURL)
+			if err != nil {
+				log.Fatal().Err(err).Msg("unable to configure the alert notification channels")
+			}
+
+			notifiers = append(notifiers, notifier)
+		}
+
+		notify.Enable(notify.NewDispatcher(notifiers, agentIdentity.ID))
+
+		go notify.Run(context.Background(), options.AlertNotifyInterval)
+	}
+
+	if options.HooksPath != "" || slices.Contains(options.AllowedOperations, agent.OperationScriptHooks) {
+		engine, err := hooks.NewEngine(options.HooksPath, path.Join(options.DataPath, agent.HooksDirName), hooks.DockerActions{})
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to load the scripting hooks")
+		}
+
+		hooks.Enable(engine)
+
+		go engine.Run(context.Background(), containerPlatform, options.HooksSnapshotInterval)
+	}
+
+	if options.PowerUPS != "" {
+		source, err := power.NewSource(options.PowerUPS)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to configure the UPS")
+		}
+
+		shedding := options.PowerShedding && (containerPlatform == agent.PlatformDocker || containerPlatform == agent.PlatformPodman)
+
+		monitor, err := power.NewMonitor(source, shedding, options.PowerShedDelay, path.Join(options.DataPath, agent.PowerSheddingFileName))
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to load the low-priority containers stopped on battery")
+		}
+
+		power.Enable(monitor)
+
+		go monitor.Run(context.Background(), options.PowerCheckInterval)
+	}
+
+	if options.NetworkPolicy {
+		if containerPlatform != agent.PlatformDocker {
+			log.Fatal().Msg("the network policies are only supported on standalone Docker hosts")
+		}
+
+		enforcer, err := netpolicy.NewEnforcer(options.HostActionImage, path.Join(options.DataPath, agent.NetworkPolicyFileName))
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to load the network policies pushed by the server")
+		}
+
+		netpolicy.Enable(enforcer)
+
+		go enforcer.Run(context.Background(), options.NetworkPolicyInterval)
+	}
+
+	if slices.Contains(options.AllowedOperations, agent.OperationPortForward) {
+		broker, err := portforward.NewBroker(options.PortForwardNetworks, options.PortForwardMaxSessions, options.PortForwardMaxDuration)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to configure the port forwarding")
+		}
+
+		portforward.Enable(broker)
+	}
+
+	if slices.Contains(options.AllowedOperations, agent.OperationStackMigration) && containerPlatform == agent.PlatformDocker {
+		deployer, err := exec.NewDockerComposeStackService(options.AssetsPath)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to initialize the deployer of the migrated stacks")
+		}
+
+		migration.Enable(migration.NewManager(deployer))
+	}
+
+	var shutdownHook *shutdown.Hook
+	if len(options.ShutdownSignals) > 0 && options.EdgeMode && (containerPlatform == agent.PlatformDocker || containerPlatform == agent.PlatformPodman) {
+		shutdownHook, err = shutdown.NewHook(options.ShutdownSignals, options.ShutdownStopTimeout, options.ShutdownTimeout)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to configure the shutdown hook")
+		}
+
+		go shutdownHook.Listen(context.Background())
+	}
+
+	if options.CrashArtifacts && (containerPlatform == agent.PlatformDocker || containerPlatform == agent.PlatformPodman) {
+		store, err := crash.NewStore(path.Join(options.DataPath, agent.CrashArtifactsDirName), options.CrashArtifactsMaxSize)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to create the crash artifacts store")
+		}
+
+		collector := crash.NewCollector(store, crash.Options{
+			LogLines:     options.CrashLogLines,
+			CoreDumpPath: options.CrashCoreDumpPath,
+		})
+
+		crash.Enable(collector)
+
+		go collector.Run(context.Background())
+	}
+
+	if options.AuditSessions != agent.AuditSessionsOff {
+		recorder, err := audit.NewRecorder(path.Join(options.DataPath, agent.AuditDirName), options.AuditSessions, options.AuditMaxSize)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to open the audit trail")
+		}
+
+		audit.Enable(recorder)
+	}
+
+	if options.SnapshotHistoryInterval > 0 && (containerPlatform == agent.PlatformDocker || containerPlatform == agent.PlatformPodman) {
+		store, err := snapshots.NewStore(path.Join(options.DataPath, agent.SnapshotsDirName), docker.CreateSnapshot)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to create the snapshot history")
+		}
+
+		snapshots.Enable(store)
+
+		go store.Run(context.Background(), options.SnapshotHistoryInterval)
+	}
+
+	retentionPolicies, err := retention.ParsePolicies(options.RetentionPolicies)
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to parse the retention policies")
+	}
+
+	retentionManager := retention.NewManager(retention.Locations(options.DataPath), retentionPolicies)
+	retention.Enable(retentionManager)
+
+	go retentionManager.Run(context.Background(), options.RetentionInterval)
+
+	if options.AnomalyDetection {
+		anomalyConfig := anomaly.Config{
+			FailedAuthThreshold: options.AnomalyAuthThreshold,
+			FailedAuthWindow:    anomaly.DefaultFailedAuthWindow,
+			LearningPeriod:      options.AnomalyLearningPeriod,
+			BaselinePath:        path.Join(options.DataPath, agent.AccessBaselineFileName),
+		}
+
+		if options.AlertWebhookURL != "" {
+			anomalyConfig.Emitter = anomaly.NewWebhookEmitter(options.AlertWebhookURL, options.WebhookSecret)
+		}
+
+		detector, err := anomaly.NewDetector(anomalyConfig)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to enable the anomaly detection")
+		}
+
+		anomaly.Enable(detector)
+	}
+
+	if len(options.CredentialHelpers) > 0 {
+		registryauth.Enable(registryauth.NewResolver(options.CredentialHelpers, options.CredentialHelpersTTL))
+	}
+
+	if len(options.GitCredentialHelpers) > 0 {
+		registryauth.EnableGit(registryauth.NewGitResolver(options.GitCredentialHelpers, options.CredentialHelpersTTL))
+	}
+
 	// Clean the updater
 	if updaterCleaner != nil {
 		ctx := context.Background()
@@ -326,6 +814,23 @@ func main() {
 	}
 
 	// Edge
+	if options.RelayAddr != "" {
+		relayServer := relay.NewServer(agentIdentity.ID, options.RelaySecret, options.ClockSkewTolerance)
+		relay.Enable(relayServer)
+
+		relayTLSConfig, err := relay.TLSConfig(options.SSLCert, options.SSLKey, options.SSLCACert)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to load the TLS configuration of the Edge relay")
+		}
+
+		go func() {
+			err := relay.Serve(options.RelayAddr, relayServer, relayTLSConfig)
+			if err != nil {
+				log.Error().Err(err).Msg("unable to start the Edge relay")
+			}
+		}()
+	}
+
 	var edgeManager *edge.Manager
 	if options.EdgeMode {
 		edgeManagerParameters := &edge.ManagerParameters{
@@ -334,6 +839,9 @@ func main() {
 			ClusterService:    clusterService,
 			DockerInfoService: dockerInfoService,
 			ContainerPlatform: containerPlatform,
+			Identity:          agentIdentity,
+			SVIDSource:        svidSource,
+			PayloadCipher:     payloadCipher,
 		}
 
 		edgeManager = edge.NewManager(edgeManagerParameters)
@@ -343,6 +851,23 @@ func main() {
 			log.Error().Err(err).Msg("unable to retrieve Edge key")
 		}
 
+		if edgeKey == "" && len(options.ProvisioningSources) > 0 {
+			config := provisioning.Discover(context.Background(), provisioning.NewSources(options.ProvisioningSources, options.ProvisioningURL))
+			if config != nil {
+				config.Apply(options)
+				edgeKey = options.EdgeKey
+			}
+		}
+
+		if edgeKey == "" && options.EdgeEnrollCode != "" {
+			log.Info().Str("server_url", options.EdgeEnrollURL).Msg("exchanging the enrollment code for an Edge key")
+
+			edgeKey, err = edge.ExchangeEnrollmentCode(context.Background(), options.EdgeEnrollURL, options.EdgeEnrollCode, options.EdgeID, options.EdgeInsecurePoll)
+			if err != nil {
+				log.Fatal().Err(err).Msg("unable to enroll the agent")
+			}
+		}
+
 		if edgeKey != "" {
 			log.Debug().Msg("edge key found in environment. Associating Edge key")
 
@@ -357,14 +882,76 @@ func main() {
 			}
 		} else {
 			log.Debug().Msg("edge key not specified. Serving Edge UI")
-			serveEdgeUI(edgeManager, options.EdgeUIServerAddr, options.EdgeUIServerPort)
+
+			var claimer *edge.Claimer
+			if options.EdgeClaim {
+				claimer, err = edge.NewClaimer(edgeManager, options.EdgeEnrollURL)
+				if err != nil {
+					log.Fatal().Err(err).Msg("unable to claim the device")
+				}
+
+				go claimDevice(claimer, edgeManager)
+			}
+
+			serveEdgeUI(edgeManager, options.EdgeUIServerAddr, options.EdgeUIServerPort, options.EdgeEnrollment, claimer)
 		}
 	}
 
 	// !Edge
 
+	if options.LogShippingURL != "" && (containerPlatform == agent.PlatformDocker || containerPlatform == agent.PlatformPodman) {
+		sink, err := logship.NewSink(options.LogShippingURL)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to configure the log shipping")
+		}
+
+		shipperOptions := logship.Options{
+			Containers:    options.LogShippingContainers,
+			BatchSize:     options.LogShippingBatchSize,
+			FlushInterval: options.LogShippingFlushInterval,
+		}
+
+		if edgeManager != nil {
+			shipperOptions.EndpointID = func() int {
+				return int(edgeManager.GetEndpointID())
+			}
+		}
+
+		go logship.NewShipper(sink, shipperOptions).Run(context.Background())
+	}
+
+	if options.MetricsAddr != "" {
+		go func() {
+			err := metrics.Serve(options.MetricsAddr)
+			if err != nil {
+				log.Error().Err(err).Msg("unable to start the metrics server")
+			}
+		}()
+	}
+
+	if options.ImageCacheAddr != "" {
+		cache, err := imagecache.NewCache(path.Join(options.DataPath, agent.ImageCacheDirName), options.ImageCacheUpstream, options.ImageCacheMaxSize)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to create the image cache")
+		}
+
+		imagecache.Enable(cache)
+
+		go func() {
+			err := imagecache.Serve(options.ImageCacheAddr, cache)
+			if err != nil {
+				log.Error().Err(err).Msg("unable to start the image cache server")
+			}
+		}()
+	}
+
 	// API
 
+	proxyPolicyService, err := security.NewProxyPolicyService(options.ProxyPolicyFile, path.Join(options.DataPath, agent.ProxyPolicyFileName))
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to load the proxy policy")
+	}
+
 	config := &http.APIServerConfig{
 		Addr:                 options.AgentServerAddr,
 		Port:                 options.AgentServerPort,
@@ -378,6 +965,10 @@ func main() {
 		KubernetesDeployer:   kubernetesDeployer,
 		ContainerPlatform:    containerPlatform,
 		NomadConfig:          nomadConfig,
+		OperationManager:     operations.NewManager(),
+		AgentIdentity:        agentIdentity,
+		SVIDSource:           svidSource,
+		ProxyPolicyService:   proxyPolicyService,
 	}
 
 	if options.EdgeMode {
@@ -402,6 +993,10 @@ func main() {
 	s := <-sigs
 
 	log.Debug().Stringer("signal", s).Msg("shutting down")
+
+	if shutdownHook.Handles(s) {
+		shutdownHook.StopStacks(context.Background())
+	}
 }
 
 func startAPIServer(config *http.APIServerConfig, edgeMode bool) error {
@@ -410,9 +1005,148 @@ func startAPIServer(config *http.APIServerConfig, edgeMode bool) error {
 	return server.Start(edgeMode)
 }
 
-func parseOptions() (*agent.Options, error) {
-	optionParser := os.NewEnvOptionParser()
-	return optionParser.Options()
+// openTPM returns the TPM storing the key material of the agent, nil when the key material is stored in files
+func openTPM(options *agent.Options) *tpm.Device {
+	if options.TPM == agent.TPMOff {
+		return nil
+	}
+
+	device, err := tpm.Open(options.TPMDevice)
+	if err == nil {
+		log.Info().Msg("the key material of the agent is stored in the TPM")
+
+		return device
+	}
+
+	switch {
+	case options.TPM == agent.TPMRequired:
+		log.Fatal().Err(err).Msg("unable to open the TPM")
+	case errors.Is(err, goos.ErrNotExist):
+		log.Info().Msg("no TPM found, the key material of the agent is stored in files")
+	default:
+		log.Warn().Err(err).Msg("unable to open the TPM, the key material of the agent is stored in files")
+	}
+
+	return nil
+}
+
+// enableStateEncryption encrypts the persistent state of the agent with the key sealed by device, or derived from the
+// state secret when device is nil. The machine identifier is used when no state secret is set, it is stored on the
+// same disk as the state which is then only obfuscated.
+func enableStateEncryption(options *agent.Options, device *tpm.Device) {
+	secret := options.StateSecret
+	if secret == "" && device == nil {
+		var err error
+
+		secret, err = crypto.MachineSecret(agent.HostRoot)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to enable the encryption of the agent state")
+		}
+
+		log.Warn().
+			Str("env", os.EnvKeyStateSecret).
+			Msg("the key encrypting the agent state is derived from the machine identifier, which is stored on the same disk as the state: the state is only obfuscated, enable the TPM or provide a state secret stored outside the device to protect it")
+	}
+
+	stateKeyFile := path.Join(options.DataPath, agent.StateKeyFileName)
+
+	stateCipher, err := crypto.LoadOrCreateStateCipher(stateKeyFile, secret, device)
+	if err != nil {
+		log.Fatal().Err(err).Str("path", stateKeyFile).Msg("unable to load the key encrypting the agent state")
+	}
+
+	crypto.EnableStateEncryption(stateCipher)
+
+	log.Info().Bool("tpm", device != nil).Msg("the persistent state of the agent is encrypted")
+}
+
+// enrollMTLSCertificate blocks until the agent has a valid mTLS certificate issued by the server and renews it in the
+// background
+func enrollMTLSCertificate(options *agent.Options) {
+	commonName := options.EdgeID
+	if commonName == "" {
+		commonName, _ = goos.Hostname()
+	}
+
+	enroller, err := crypto.NewCertificateEnroller(crypto.EnrollmentConfig{
+		URL:        options.MTLSEnrollURL,
+		Token:      options.MTLSEnrollToken,
+		CACertPath: options.SSLCACert,
+		CertPath:   options.SSLCert,
+		KeyPath:    options.SSLKey,
+		CommonName: commonName,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to enroll the mTLS certificate")
+	}
+
+	err = enroller.EnsureCertificate(context.Background())
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to enroll the mTLS certificate")
+	}
+
+	go enroller.RenewalLoop(context.Background())
+}
+
+// exportProfile writes the configuration profile of the agent to path, - for the standard output
+func exportProfile(optionParser *os.EnvOptionParser, path string) {
+	w := io.Writer(goos.Stdout)
+	if path != "-" {
+		f, err := goos.OpenFile(path, goos.O_CREATE|goos.O_WRONLY|goos.O_TRUNC, 0600)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to create the configuration profile")
+		}
+		defer f.Close()
+
+		w = f
+	}
+
+	err := os.WriteProfile(w, optionParser.ExportProfile())
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to export the configuration profile")
+	}
+}
+
+// importProfile imports the configuration profile of the file at path inside the data folder under name
+func importProfile(dataPath, name, path string) {
+	f, err := goos.Open(path)
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to open the configuration profile")
+	}
+	defer f.Close()
+
+	profile, err := os.ReadProfile(f)
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to read the configuration profile")
+	}
+
+	requiredSecrets, err := os.ImportProfile(dataPath, name, profile)
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to import the configuration profile")
+	}
+
+	log.Info().Str("profile", name).Int("options", len(profile.Options)).Msg("configuration profile imported, it will be applied on the next start when selected")
+
+	if len(requiredSecrets) > 0 {
+		log.Warn().Strs("secrets", requiredSecrets).Msg("the secrets of the configuration profile must be provided to the agent")
+	}
+}
+
+// listProfiles prints the configuration profiles imported inside the data folder, the selected one is marked with *
+func listProfiles(dataPath string) {
+	profiles, err := os.ListProfiles(dataPath)
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to list the configuration profiles")
+	}
+
+	for _, profile := range profiles {
+		marker := " "
+		if profile.Active {
+			marker = "*"
+		}
+
+		fmt.Printf("%s %s\n", marker, profile.Name)
+	}
 }
 
 func setLoggingLevel(level string) {
@@ -448,8 +1182,31 @@ func formatMessage(i interface{}) string {
 	return fmt.Sprintf("%s |", i)
 }
 
-func serveEdgeUI(edgeManager *edge.Manager, serverAddr, serverPort string) {
-	edgeServer := httpEdge.NewEdgeServer(edgeManager)
+func claimDevice(claimer *edge.Claimer, edgeManager *edge.Manager) {
+	err := claimer.Run(context.Background())
+	if errors.Is(err, edge.ErrClaimAbandoned) {
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msg("unable to claim the device")
+
+		return
+	}
+
+	log.Info().Msg("the device is claimed")
+
+	err = edgeManager.Start()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Unable to start Edge manager")
+	}
+
+	err = edgeManager.PropagateKeyInCluster()
+	if err != nil {
+		log.Error().Err(err).Msg("unable to propagate key to cluster")
+	}
+}
+
+func serveEdgeUI(edgeManager *edge.Manager, serverAddr, serverPort string, enrollment bool, claimer *edge.Claimer) {
+	edgeServer := httpEdge.NewEdgeServer(edgeManager, enrollment, claimer)
 
 	go func() {
 		log.Info().Str("server_address", serverAddr).Str("server_port", serverPort).Msg("Starting Edge UI server")
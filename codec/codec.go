@@ -0,0 +1,183 @@
+// Package codec encodes the payloads exchanged with the Portainer server in the formats negotiated with it: JSON,
+// MessagePack and CBOR. The binary formats are smaller and cheaper to encode than JSON, which matters for the
+// snapshots of large environments and on tiny devices. The fields of the structs are encoded with the names of their
+// json tags, so that a payload has the same structure in every format.
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Names of the built-in codecs
+const (
+	JSON        = "json"
+	MessagePack = "msgpack"
+	CBOR        = "cbor"
+)
+
+// Codec encodes and decodes the payloads in a format
+type Codec interface {
+	// Name is the name of the format used in the options of the agent
+	Name() string
+	// ContentType is the media type of the encoded payloads
+	ContentType() string
+	Encode(w io.Writer, v any) error
+	Decode(r io.Reader, v any) error
+}
+
+var (
+	codecs   = map[string]Codec{}
+	codecsMu sync.RWMutex
+)
+
+func init() {
+	Register(jsonCodec{})
+	Register(msgpackCodec{})
+	Register(newCBORCodec())
+}
+
+// Register makes c available under its name, it replaces the codec registered with the same name
+func Register(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	codecs[c.Name()] = c
+}
+
+// Get returns the codec registered with name
+func Get(name string) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	c, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown payload format %q, supported formats are %s", name, strings.Join(names(), ", "))
+	}
+
+	return c, nil
+}
+
+// Default returns the JSON codec, used when no other format was negotiated
+func Default() Codec {
+	c, _ := Get(JSON)
+
+	return c
+}
+
+// ForContentType returns the codec of the media type of contentType, nil when no codec is registered for it
+func ForContentType(contentType string) Codec {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	for _, c := range codecs {
+		if c.ContentType() == mediaType {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// Accept returns the value of an Accept header preferring the media type of preferred, with JSON as a fallback
+func Accept(preferred Codec) string {
+	if preferred == nil || preferred.Name() == JSON {
+		return jsonContentType
+	}
+
+	return preferred.ContentType() + ", " + jsonContentType + ";q=0.5"
+}
+
+func names() []string {
+	names := make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+const jsonContentType = "application/json"
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string        { return JSON }
+func (jsonCodec) ContentType() string { return jsonContentType }
+
+func (jsonCodec) Encode(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func (jsonCodec) Decode(r io.Reader, v any) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+// msgpackCodec encodes the integers in their smallest representation and decodes the maps of interface values as
+// map[string]any, like the JSON decoder
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string        { return MessagePack }
+func (msgpackCodec) ContentType() string { return "application/msgpack" }
+
+func (msgpackCodec) Encode(w io.Writer, v any) error {
+	enc := msgpack.NewEncoder(w)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+
+	return enc.Encode(v)
+}
+
+func (msgpackCodec) Decode(r io.Reader, v any) error {
+	dec := msgpack.NewDecoder(r)
+	dec.SetCustomStructTag("json")
+
+	return dec.Decode(v)
+}
+
+// cborCodec encodes the times as RFC 3339 strings to keep their precision and decodes the maps of interface values
+// as map[string]any, like the JSON decoder
+type cborCodec struct {
+	enc cbor.EncMode
+	dec cbor.DecMode
+}
+
+func newCBORCodec() cborCodec {
+	enc, err := cbor.EncOptions{Time: cbor.TimeRFC3339Nano}.EncMode()
+	if err != nil {
+		panic(err)
+	}
+
+	dec, err := cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]any(nil))}.DecMode()
+	if err != nil {
+		panic(err)
+	}
+
+	return cborCodec{enc: enc, dec: dec}
+}
+
+func (cborCodec) Name() string        { return CBOR }
+func (cborCodec) ContentType() string { return "application/cbor" }
+
+func (c cborCodec) Encode(w io.Writer, v any) error {
+	return c.enc.NewEncoder(w).Encode(v)
+}
+
+func (c cborCodec) Decode(r io.Reader, v any) error {
+	return c.dec.NewDecoder(r).Decode(v)
+}
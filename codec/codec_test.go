@@ -0,0 +1,139 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+type payload struct {
+	Name      string         `json:"name"`
+	Skipped   string         `json:"-"`
+	Empty     string         `json:"empty,omitempty"`
+	Count     int            `json:"count"`
+	Timestamp time.Time      `json:"timestamp"`
+	Value     any            `json:"value"`
+	Labels    map[string]int `json:"labels"`
+}
+
+func TestRoundTrip(t *testing.T) {
+	in := payload{
+		Name:      "web",
+		Skipped:   "secret",
+		Count:     42,
+		Timestamp: time.Date(2024, 5, 1, 10, 0, 0, 123456789, time.UTC),
+		Value:     map[string]any{"stackName": "web", "replicas": 3},
+		Labels:    map[string]int{"a": 1},
+	}
+
+	for _, name := range []string{JSON, MessagePack, CBOR} {
+		t.Run(name, func(t *testing.T) {
+			c, err := Get(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var b bytes.Buffer
+			if err := c.Encode(&b, in); err != nil {
+				t.Fatal(err)
+			}
+
+			var out payload
+			if err := c.Decode(&b, &out); err != nil {
+				t.Fatal(err)
+			}
+
+			if out.Name != in.Name || out.Count != in.Count || out.Labels["a"] != 1 || !out.Timestamp.Equal(in.Timestamp) {
+				t.Fatalf("unexpected decoded payload: %+v", out)
+			}
+
+			if out.Skipped != "" {
+				t.Fatal("expected the fields ignored by the json tags to be skipped")
+			}
+
+			value, ok := out.Value.(map[string]any)
+			if !ok || value["stackName"] != "web" {
+				t.Fatalf("expected the interface value to be decoded as a map with string keys, got %#v", out.Value)
+			}
+		})
+	}
+}
+
+func TestFieldNames(t *testing.T) {
+	var b bytes.Buffer
+	if err := (msgpackCodec{}).Encode(&b, payload{Name: "web"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var fields map[string]any
+	if err := (msgpackCodec{}).Decode(&b, &fields); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := fields["name"]; !ok {
+		t.Fatalf("expected the fields to be named after their json tags, got %v", fields)
+	}
+
+	if _, ok := fields["empty"]; ok {
+		t.Fatal("expected the empty fields tagged with omitempty to be omitted")
+	}
+}
+
+func TestBinaryFormatsAreSmaller(t *testing.T) {
+	in := make([]payload, 100)
+	for i := range in {
+		in[i] = payload{Name: "container", Count: i, Timestamp: time.Unix(1700000000, 0)}
+	}
+
+	size := func(name string) int {
+		c, _ := Get(name)
+
+		var b bytes.Buffer
+		if err := c.Encode(&b, in); err != nil {
+			t.Fatal(err)
+		}
+
+		return b.Len()
+	}
+
+	jsonSize := size(JSON)
+	for _, name := range []string{MessagePack, CBOR} {
+		if size(name) >= jsonSize {
+			t.Fatalf("expected the %s payload to be smaller than the JSON payload of %d bytes, got %d", name, jsonSize, size(name))
+		}
+	}
+}
+
+func TestForContentType(t *testing.T) {
+	for contentType, expected := range map[string]string{
+		"application/json; charset=utf-8": JSON,
+		"application/msgpack":             MessagePack,
+		"application/cbor":                CBOR,
+	} {
+		c := ForContentType(contentType)
+		if c == nil || c.Name() != expected {
+			t.Fatalf("expected the %s codec for %q, got %v", expected, contentType, c)
+		}
+	}
+
+	if ForContentType("text/plain") != nil || ForContentType("") != nil {
+		t.Fatal("expected no codec for an unknown content type")
+	}
+}
+
+func TestGetUnknown(t *testing.T) {
+	if _, err := Get("xml"); err == nil {
+		t.Fatal("expected an error for an unknown format")
+	}
+}
+
+func TestAccept(t *testing.T) {
+	if Accept(Default()) != "application/json" {
+		t.Fatalf("unexpected Accept header for JSON: %s", Accept(Default()))
+	}
+
+	c, _ := Get(CBOR)
+	if Accept(c) != "application/cbor, application/json;q=0.5" {
+		t.Fatalf("unexpected Accept header for CBOR: %s", Accept(c))
+	}
+}
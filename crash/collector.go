@@ -0,0 +1,247 @@
+package crash
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/rs/zerolog/log"
+)
+
+// Names of the files of an artifact, the core dumps are stored with the core- prefix followed by their file name
+const (
+	InspectFileName = "inspect.json"
+	LogsFileName    = "logs.txt"
+	coreDumpPrefix  = "core-"
+)
+
+const (
+	eventsRetryDelay = 10 * time.Second
+	collectTimeout   = time.Minute
+	// collectInterval is the minimum duration between two collections for the same container, so that a container
+	// restarting in a loop does not evict all the other artifacts
+	collectInterval = time.Minute
+)
+
+var (
+	defaultCollector   *Collector
+	defaultCollectorMu sync.Mutex
+)
+
+// Options represents what is collected when a container crashes
+type Options struct {
+	// LogLines is the number of log lines collected
+	LogLines int
+	// CoreDumpPath is the folder of the host where the kernel writes the core dumps, they are not collected when empty
+	CoreDumpPath string
+}
+
+// Collector stores an artifact each time a container exits with a non-zero code or is killed when running out of
+// memory
+type Collector struct {
+	store   *Store
+	options Options
+
+	mu            sync.Mutex
+	lastCollected map[string]time.Time
+}
+
+// NewCollector returns a pointer to a Collector storing the artifacts in store
+func NewCollector(store *Store, options Options) *Collector {
+	return &Collector{
+		store:         store,
+		options:       options,
+		lastCollected: map[string]time.Time{},
+	}
+}
+
+// Run collects the artifacts of the crashing containers from the events of the Docker engine until ctx is done, the
+// stream of events is opened again when it fails
+func (collector *Collector) Run(ctx context.Context) {
+	for {
+		err := docker.WatchEvents(ctx, func(message events.Message) {
+			if message.Type != events.ContainerEventType || message.Action != "die" {
+				return
+			}
+
+			exitCode := message.Actor.Attributes["exitCode"]
+			if exitCode == "" || exitCode == "0" {
+				return
+			}
+
+			// The labels of the container are part of the attributes of the event
+			if enabled, set := docker.LabelOptIn(message.Actor.Attributes, agent.ContainerLabelCrash); set && !enabled {
+				return
+			}
+
+			go collector.collect(message.Actor.ID, time.Unix(0, message.TimeNano))
+		})
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Warn().Err(err).Msg("the stream of Docker events used to collect the crash artifacts failed")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(eventsRetryDelay):
+		}
+	}
+}
+
+func (collector *Collector) collect(containerID string, diedAt time.Time) {
+	collector.mu.Lock()
+	if last, ok := collector.lastCollected[containerID]; ok && diedAt.Sub(last) < collectInterval {
+		collector.mu.Unlock()
+
+		return
+	}
+	collector.lastCollected[containerID] = diedAt
+
+	for id, last := range collector.lastCollected {
+		if diedAt.Sub(last) >= collectInterval {
+			delete(collector.lastCollected, id)
+		}
+	}
+	collector.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+
+	inspect, logs, err := docker.ContainerCrashData(ctx, containerID, collector.options.LogLines)
+	if err != nil {
+		log.Warn().Err(err).Str("container_id", containerID).Msg("unable to collect the crash data of the container")
+
+		return
+	}
+
+	artifact := newArtifact(inspect, diedAt)
+
+	if inspect.Config != nil {
+		inspect.Config.Env = docker.SnapshotEnv(inspect.Config.Env)
+	}
+
+	inspectData, err := json.MarshalIndent(inspect, "", "  ")
+	if err != nil {
+		log.Warn().Err(err).Str("container_id", containerID).Msg("unable to encode the inspection of the container")
+
+		return
+	}
+
+	files := map[string]io.Reader{
+		InspectFileName: bytes.NewReader(inspectData),
+		LogsFileName:    bytes.NewReader(logs),
+	}
+
+	for _, path := range collector.coreDumps(inspect) {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Warn().Err(err).Str("path", path).Msg("unable to read the core dump")
+
+			continue
+		}
+		defer f.Close()
+
+		files[coreDumpPrefix+filepath.Base(path)] = f
+	}
+
+	if err := collector.store.Save(artifact, files); err != nil {
+		log.Warn().Err(err).Str("container_id", containerID).Msg("unable to store the crash artifact")
+
+		return
+	}
+
+	log.Info().
+		Str("container", artifact.ContainerName).
+		Int("exit_code", artifact.ExitCode).
+		Bool("oom_killed", artifact.OOMKilled).
+		Str("artifact", artifact.ID).
+		Msg("crash artifact collected")
+}
+
+func newArtifact(inspect types.ContainerJSON, diedAt time.Time) *Artifact {
+	artifact := &Artifact{
+		ContainerID:   inspect.ID,
+		ContainerName: strings.TrimPrefix(inspect.Name, "/"),
+		Time:          diedAt,
+	}
+
+	if inspect.Config != nil {
+		artifact.Image = inspect.Config.Image
+	}
+
+	if inspect.ContainerJSONBase != nil && inspect.State != nil {
+		artifact.ExitCode = inspect.State.ExitCode
+		artifact.OOMKilled = inspect.State.OOMKilled
+	}
+
+	return artifact
+}
+
+// coreDumps returns the paths of the core dumps written while the container was running. The kernel does not
+// record which container a core dump comes from, the core dumps of containers crashing at the same time are
+// collected with each of them.
+func (collector *Collector) coreDumps(inspect types.ContainerJSON) []string {
+	if collector.options.CoreDumpPath == "" || inspect.ContainerJSONBase == nil || inspect.State == nil {
+		return nil
+	}
+
+	startedAt, err := time.Parse(time.RFC3339Nano, inspect.State.StartedAt)
+	if err != nil {
+		return nil
+	}
+
+	dir := filepath.Join(agent.HostRoot, collector.options.CoreDumpPath)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Warn().Err(err).Str("path", dir).Msg("unable to list the core dumps")
+
+		return nil
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || info.ModTime().Before(startedAt) {
+			continue
+		}
+
+		paths = append(paths, filepath.Join(dir, entry.Name()))
+	}
+
+	return paths
+}
+
+// Enable makes collector the collector whose artifacts are served by the agent API
+func Enable(collector *Collector) {
+	defaultCollectorMu.Lock()
+	defer defaultCollectorMu.Unlock()
+
+	defaultCollector = collector
+}
+
+// DefaultStore returns the store of the enabled collector, ErrDisabled is returned when no collector is enabled
+func DefaultStore() (*Store, error) {
+	defaultCollectorMu.Lock()
+	defer defaultCollectorMu.Unlock()
+
+	if defaultCollector == nil {
+		return nil, ErrDisabled
+	}
+
+	return defaultCollector.store, nil
+}
@@ -0,0 +1,275 @@
+package crash
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// artifactFileName is the name of the file describing an artifact, inside the folder of the artifact
+const artifactFileName = "artifact.json"
+
+var (
+	// ErrDisabled is returned when the artifacts are requested while their collection is disabled
+	ErrDisabled = errors.New("the collection of the crash artifacts is disabled on this agent")
+	// ErrNotFound is returned when an artifact or one of its files does not exist
+	ErrNotFound = errors.New("crash artifact not found")
+)
+
+var artifactIDRegexp = regexp.MustCompile(`^[0-9]{8}T[0-9]{6}-[a-f0-9]{1,12}$`)
+
+// Artifact represents the data collected when a container exited with an error or was killed when running out of
+// memory
+type Artifact struct {
+	ID            string    `json:"Id"`
+	ContainerID   string    `json:"ContainerId"`
+	ContainerName string    `json:"ContainerName"`
+	Image         string    `json:"Image"`
+	ExitCode      int       `json:"ExitCode"`
+	OOMKilled     bool      `json:"OOMKilled"`
+	Time          time.Time `json:"Time"`
+	Files         []File    `json:"Files"`
+	// Omitted lists the files that were not stored because they exceed the size of the store
+	Omitted []string `json:"Omitted,omitempty"`
+	Size    int64    `json:"Size"`
+}
+
+// File represents a file of an artifact
+type File struct {
+	Name string `json:"Name"`
+	Size int64  `json:"Size"`
+}
+
+// Store persists the artifacts in a folder, the oldest artifacts are removed when their total size exceeds the
+// maximum size of the store
+type Store struct {
+	dir     string
+	maxSize int64
+	mu      sync.Mutex
+}
+
+// NewStore returns a pointer to a Store persisting the artifacts in dir, which is created when it does not exist
+func NewStore(dir string, maxSize int64) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &Store{dir: dir, maxSize: maxSize}, nil
+}
+
+// Save stores artifact with its files, read from the readers. The ID, the files and the size of the artifact are
+// set by the store.
+func (store *Store) Save(artifact *Artifact, files map[string]io.Reader) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	containerID := artifact.ContainerID
+	if len(containerID) > 12 {
+		containerID = containerID[:12]
+	}
+
+	artifact.ID = fmt.Sprintf("%s-%s", artifact.Time.UTC().Format("20060102T150405"), containerID)
+	artifact.Files = nil
+	artifact.Omitted = nil
+	artifact.Size = 0
+
+	dir := filepath.Join(store.dir, artifact.ID)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		size, err := writeLimitedFile(filepath.Join(dir, name), files[name], store.maxSize)
+		if errors.Is(err, errFileTooLarge) {
+			artifact.Omitted = append(artifact.Omitted, name)
+
+			continue
+		}
+		if err != nil {
+			os.RemoveAll(dir)
+
+			return err
+		}
+
+		artifact.Files = append(artifact.Files, File{Name: name, Size: size})
+		artifact.Size += size
+	}
+
+	data, err := json.Marshal(artifact)
+	if err != nil {
+		os.RemoveAll(dir)
+
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, artifactFileName), data, 0600); err != nil {
+		os.RemoveAll(dir)
+
+		return err
+	}
+
+	store.evict(artifact.ID)
+
+	return nil
+}
+
+// List returns the stored artifacts, the most recent first
+func (store *Store) List() ([]Artifact, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return store.list()
+}
+
+// Get returns the artifact identified by id
+func (store *Store) Get(id string) (*Artifact, error) {
+	if !artifactIDRegexp.MatchString(id) {
+		return nil, ErrNotFound
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return store.read(id)
+}
+
+// Open opens the file name of the artifact identified by id
+func (store *Store) Open(id, name string) (*os.File, error) {
+	artifact, err := store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range artifact.Files {
+		if file.Name == name {
+			return os.Open(filepath.Join(store.dir, id, name))
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// Delete removes the artifact identified by id
+func (store *Store) Delete(id string) error {
+	if !artifactIDRegexp.MatchString(id) {
+		return ErrNotFound
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, err := store.read(id); err != nil {
+		return err
+	}
+
+	return os.RemoveAll(filepath.Join(store.dir, id))
+}
+
+func (store *Store) list() ([]Artifact, error) {
+	entries, err := os.ReadDir(store.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	artifacts := []Artifact{}
+	for _, entry := range entries {
+		if !entry.IsDir() || !artifactIDRegexp.MatchString(entry.Name()) {
+			continue
+		}
+
+		artifact, err := store.read(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		artifacts = append(artifacts, *artifact)
+	}
+
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].Time.After(artifacts[j].Time)
+	})
+
+	return artifacts, nil
+}
+
+func (store *Store) read(id string) (*Artifact, error) {
+	data, err := os.ReadFile(filepath.Join(store.dir, id, artifactFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var artifact Artifact
+	if err := json.Unmarshal(data, &artifact); err != nil {
+		return nil, err
+	}
+
+	return &artifact, nil
+}
+
+// evict removes the oldest artifacts, except the artifact identified by keep, until the total size of the artifacts
+// fits in the store, the lock must be held
+func (store *Store) evict(keep string) {
+	artifacts, err := store.list()
+	if err != nil {
+		return
+	}
+
+	var total int64
+	for _, artifact := range artifacts {
+		total += artifact.Size
+	}
+
+	for i := len(artifacts) - 1; i >= 0 && total > store.maxSize; i-- {
+		if artifacts[i].ID == keep {
+			continue
+		}
+
+		if err := os.RemoveAll(filepath.Join(store.dir, artifacts[i].ID)); err != nil {
+			continue
+		}
+
+		total -= artifacts[i].Size
+	}
+}
+
+var errFileTooLarge = errors.New("the file exceeds the size of the store")
+
+// writeLimitedFile copies r to the file at path, the file is removed when its content exceeds limit bytes
+func writeLimitedFile(path string, r io.Reader, limit int64) (int64, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(f, io.LimitReader(r, limit+1))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil && n > limit {
+		err = errFileTooLarge
+	}
+
+	if err != nil {
+		os.Remove(path)
+
+		return 0, err
+	}
+
+	return n, nil
+}
@@ -0,0 +1,74 @@
+package crash
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStoreEvictsOldestArtifacts(t *testing.T) {
+	store, err := NewStore(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+
+	for i, containerID := range []string{"aaa", "bbb", "ccc"} {
+		artifact := &Artifact{ContainerID: containerID, Time: now.Add(time.Duration(i) * time.Minute)}
+
+		err := store.Save(artifact, map[string]io.Reader{LogsFileName: strings.NewReader("12345")})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	artifacts, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(artifacts) != 2 || artifacts[0].ContainerID != "ccc" || artifacts[1].ContainerID != "bbb" {
+		t.Fatalf("expected the two most recent artifacts, got %+v", artifacts)
+	}
+}
+
+func TestStoreOmitsFilesExceedingTheStore(t *testing.T) {
+	store, err := NewStore(t.TempDir(), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	artifact := &Artifact{ContainerID: "abc", Time: time.Now()}
+
+	err = store.Save(artifact, map[string]io.Reader{
+		LogsFileName:     strings.NewReader("log"),
+		"core-app.12345": strings.NewReader("core dump"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(artifact.Files) != 1 || artifact.Files[0].Name != LogsFileName {
+		t.Errorf("expected only the logs to be stored, got %+v", artifact.Files)
+	}
+
+	if len(artifact.Omitted) != 1 || artifact.Omitted[0] != "core-app.12345" {
+		t.Errorf("expected the core dump to be omitted, got %v", artifact.Omitted)
+	}
+
+	f, err := store.Open(artifact.ID, LogsFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := store.Open(artifact.ID, "core-app.12345"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound for an omitted file, got %v", err)
+	}
+
+	if _, err := store.Get("../" + artifact.ID); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound for an invalid identifier, got %v", err)
+	}
+}
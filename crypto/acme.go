@@ -0,0 +1,435 @@
+package crypto
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	acmeAccountKeyFileName     = "acme_account.key"
+	acmeDNS01CertificateName   = "dns01_certificate.pem"
+	acmeRenewalThreshold       = 30 * 24 * time.Hour
+	acmeRenewalCheckInterval   = 12 * time.Hour
+	acmeRenewalRetryInterval   = 1 * time.Minute
+	acmeCertificateObtainLimit = 10 * time.Minute
+)
+
+// ACMEConfig is the configuration used to obtain the certificate of the agent API from an ACME certificate authority
+type ACMEConfig struct {
+	Domains      []string
+	Email        string
+	DirectoryURL string
+	Solver       string
+	HTTPAddr     string
+	DNSHook      string
+	CacheDir     string
+}
+
+// CreateACMETLSConfiguration creates a tls.Config with recommended TLS settings serving a certificate obtained
+// and renewed automatically from an ACME certificate authority. Clients that do not send a server name (e.g. when
+// connecting with an IP address) are served the self-signed certificate of the agent.
+func CreateACMETLSConfiguration(ctx context.Context, config ACMEConfig) (*tls.Config, error) {
+	fallback, err := tls.LoadX509KeyPair(agent.TLSCertPath, agent.TLSKeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(config.CacheDir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &acme.Client{DirectoryURL: config.DirectoryURL}
+
+	var getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+
+	tlsConfig := CreateTLSConfiguration()
+
+	if config.Solver == agent.ACMESolverDNS01 {
+		manager, err := newDNS01CertificateManager(ctx, client, config)
+		if err != nil {
+			return nil, err
+		}
+
+		getCertificate = manager.getCertificate
+	} else {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(config.CacheDir),
+			HostPolicy: autocert.HostWhitelist(config.Domains...),
+			Email:      config.Email,
+			Client:     client,
+		}
+
+		if config.Solver == agent.ACMESolverHTTP01 {
+			go serveHTTP01Challenges(config.HTTPAddr, manager)
+		}
+
+		getCertificate = manager.GetCertificate
+		tlsConfig.NextProtos = append(tlsConfig.NextProtos, "h2", "http/1.1", acme.ALPNProto)
+	}
+
+	tlsConfig.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if hello.ServerName == "" {
+			return &fallback, nil
+		}
+
+		return getCertificate(hello)
+	}
+
+	return tlsConfig, nil
+}
+
+func serveHTTP01Challenges(addr string, manager *autocert.Manager) {
+	log.Info().Str("addr", addr).Msg("starting the ACME HTTP-01 challenge server")
+
+	err := http.ListenAndServe(addr, manager.HTTPHandler(nil))
+	if err != nil {
+		log.Error().Err(err).Str("addr", addr).Msg("the ACME HTTP-01 challenge server stopped")
+	}
+}
+
+// dns01CertificateManager obtains and renews a certificate using the DNS-01 challenge. The DNS records are
+// managed by an external hook command, called with the "present" or "cleanup" action, the record name and its
+// value. The hook is expected to return once the record is published.
+type dns01CertificateManager struct {
+	client      *acme.Client
+	config      ACMEConfig
+	certificate *tls.Certificate
+	mu          sync.RWMutex
+	// checkInterval is the interval between two checks of the expiration of the certificate
+	checkInterval time.Duration
+	// retryInterval is the delay before the first retry of a failed renewal, it doubles after each failure
+	retryInterval time.Duration
+}
+
+func newDNS01CertificateManager(ctx context.Context, client *acme.Client, config ACMEConfig) (*dns01CertificateManager, error) {
+	manager := &dns01CertificateManager{
+		client:        client,
+		config:        config,
+		checkInterval: acmeRenewalCheckInterval,
+		retryInterval: acmeRenewalRetryInterval,
+	}
+
+	err := manager.start(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return manager, nil
+}
+
+// start registers the ACME account and obtains the certificate, unless a cached one is still valid, before starting
+// the renewal loop. When the renewal fails, the cached certificate is served until it expires while the renewal is
+// retried.
+func (manager *dns01CertificateManager) start(ctx context.Context) error {
+	key, err := loadOrCreateACMEAccountKey(filepath.Join(manager.config.CacheDir, acmeAccountKeyFileName))
+	if err != nil {
+		return err
+	}
+
+	manager.client.Key = key
+
+	account := &acme.Account{}
+	if manager.config.Email != "" {
+		account.Contact = []string{"mailto:" + manager.config.Email}
+	}
+
+	_, err = manager.client.Register(ctx, account, acme.AcceptTOS)
+	if err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return err
+	}
+
+	failures := 0
+
+	certificate, err := tls.LoadX509KeyPair(manager.cachePath(), manager.cachePath())
+	if err == nil && !manager.needsRenewal(&certificate) {
+		manager.certificate = &certificate
+	} else {
+		cached := err == nil
+
+		err = manager.renew(ctx)
+		if err != nil {
+			if !cached || !manager.usable(&certificate, 0) {
+				return err
+			}
+
+			failures++
+
+			log.Warn().Err(err).Dur("retry_in", manager.nextCheck(failures)).Msg("unable to renew the ACME certificate, serving the cached certificate")
+
+			manager.certificate = &certificate
+		}
+	}
+
+	go manager.renewalLoop(ctx, failures)
+
+	return nil
+}
+
+func (manager *dns01CertificateManager) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+
+	return manager.certificate, nil
+}
+
+func (manager *dns01CertificateManager) cachePath() string {
+	return filepath.Join(manager.config.CacheDir, acmeDNS01CertificateName)
+}
+
+// needsRenewal returns true when the certificate expires soon or does not cover all the configured domains
+func (manager *dns01CertificateManager) needsRenewal(certificate *tls.Certificate) bool {
+	return !manager.usable(certificate, acmeRenewalThreshold)
+}
+
+// usable returns true when the certificate covers all the configured domains and stays valid for at least validFor
+func (manager *dns01CertificateManager) usable(certificate *tls.Certificate, validFor time.Duration) bool {
+	if len(certificate.Certificate) == 0 {
+		return false
+	}
+
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		return false
+	}
+
+	if time.Until(leaf.NotAfter) < validFor {
+		return false
+	}
+
+	for _, domain := range manager.config.Domains {
+		if leaf.VerifyHostname(domain) != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// nextCheck returns the delay before the next check of the certificate after the specified number of consecutive
+// failed renewals. The failed renewals are retried with an exponential backoff capped at the check interval.
+func (manager *dns01CertificateManager) nextCheck(failures int) time.Duration {
+	if failures == 0 {
+		return manager.checkInterval
+	}
+
+	delay := manager.retryInterval
+	for i := 1; i < failures && delay < manager.checkInterval; i++ {
+		delay *= 2
+	}
+
+	if delay > manager.checkInterval {
+		return manager.checkInterval
+	}
+
+	return delay
+}
+
+func (manager *dns01CertificateManager) renewalLoop(ctx context.Context, failures int) {
+	for {
+		timer := time.NewTimer(manager.nextCheck(failures))
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+
+		manager.mu.RLock()
+		needsRenewal := manager.needsRenewal(manager.certificate)
+		manager.mu.RUnlock()
+
+		if !needsRenewal {
+			failures = 0
+			continue
+		}
+
+		err := manager.renew(ctx)
+		if err != nil {
+			failures++
+
+			log.Error().Err(err).Dur("retry_in", manager.nextCheck(failures)).Msg("unable to renew the ACME certificate")
+
+			continue
+		}
+
+		failures = 0
+	}
+}
+
+func (manager *dns01CertificateManager) renew(ctx context.Context) error {
+	log.Info().Strs("domains", manager.config.Domains).Msg("requesting a certificate from the ACME certificate authority")
+
+	ctx, cancel := context.WithTimeout(ctx, acmeCertificateObtainLimit)
+	defer cancel()
+
+	order, err := manager.client.AuthorizeOrder(ctx, acme.DomainIDs(manager.config.Domains...))
+	if err != nil {
+		return err
+	}
+
+	for _, authzURL := range order.AuthzURLs {
+		err = manager.authorize(ctx, authzURL)
+		if err != nil {
+			return err
+		}
+	}
+
+	order, err = manager.client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: manager.config.Domains[0]},
+		DNSNames: manager.config.Domains,
+	}, key)
+	if err != nil {
+		return err
+	}
+
+	chain, _, err := manager.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return err
+	}
+
+	err = saveACMECertificate(manager.cachePath(), key, chain)
+	if err != nil {
+		return err
+	}
+
+	manager.mu.Lock()
+	manager.certificate = &tls.Certificate{Certificate: chain, PrivateKey: key}
+	manager.mu.Unlock()
+
+	return nil
+}
+
+func (manager *dns01CertificateManager) authorize(ctx context.Context, authzURL string) error {
+	authz, err := manager.client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return err
+	}
+
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	var challenge *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == agent.ACMESolverDNS01 {
+			challenge = c
+			break
+		}
+	}
+
+	if challenge == nil {
+		return fmt.Errorf("no DNS-01 challenge offered for %s", authz.Identifier.Value)
+	}
+
+	value, err := manager.client.DNS01ChallengeRecord(challenge.Token)
+	if err != nil {
+		return err
+	}
+
+	name := "_acme-challenge." + strings.TrimPrefix(authz.Identifier.Value, "*.")
+
+	err = manager.runDNSHook(ctx, "present", name, value)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err := manager.runDNSHook(context.Background(), "cleanup", name, value)
+		if err != nil {
+			log.Warn().Err(err).Str("record", name).Msg("unable to clean up the ACME challenge record")
+		}
+	}()
+
+	_, err = manager.client.Accept(ctx, challenge)
+	if err != nil {
+		return err
+	}
+
+	_, err = manager.client.WaitAuthorization(ctx, authz.URI)
+
+	return err
+}
+
+func (manager *dns01CertificateManager) runDNSHook(ctx context.Context, action, name, value string) error {
+	output, err := exec.CommandContext(ctx, manager.config.DNSHook, action, name, value).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("the DNS hook failed to %s the %s record: %w: %s", action, name, err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+func loadOrCreateACMEAccountKey(path string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("invalid ACME account key")
+		}
+
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, createPEMEncodedFile(path, "EC PRIVATE KEY", der)
+}
+
+func saveACMECertificate(path string, key *ecdsa.PrivateKey, chain [][]byte) error {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	for _, certificate := range chain {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate})...)
+	}
+
+	return os.WriteFile(path, data, 0600)
+}
@@ -0,0 +1,584 @@
+package crypto
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/portainer/agent"
+	"golang.org/x/crypto/acme"
+)
+
+const testACMEDomain = "agent.example.com"
+
+// acmeDirectory is a stub ACME certificate authority, it does not verify the signatures of the requests
+type acmeDirectory struct {
+	t      *testing.T
+	server *httptest.Server
+	caKey  *ecdsa.PrivateKey
+	ca     *x509.Certificate
+
+	mu sync.Mutex
+	// validity is the validity of the issued certificates
+	validity time.Duration
+	// failedOrders is the number of the next orders rejected by the directory
+	failedOrders int
+	// challengeType is the type of the challenge offered for the authorizations
+	challengeType string
+	orders        []time.Time
+	accepted      bool
+	certificate   []byte
+	nonce         int
+}
+
+func newACMEDirectory(t *testing.T) *acmeDirectory {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Stub ACME CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	directory := &acmeDirectory{
+		t:             t,
+		caKey:         key,
+		ca:            ca,
+		validity:      90 * 24 * time.Hour,
+		challengeType: agent.ACMESolverDNS01,
+	}
+
+	directory.server = httptest.NewServer(http.HandlerFunc(directory.serveHTTP))
+	t.Cleanup(directory.server.Close)
+
+	return directory
+}
+
+func (directory *acmeDirectory) url(path string) string {
+	return directory.server.URL + path
+}
+
+func (directory *acmeDirectory) orderCount() int {
+	directory.mu.Lock()
+	defer directory.mu.Unlock()
+
+	return len(directory.orders)
+}
+
+func (directory *acmeDirectory) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	directory.mu.Lock()
+	defer directory.mu.Unlock()
+
+	directory.nonce++
+	w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", directory.nonce))
+
+	switch r.URL.Path {
+	case "/directory":
+		directory.writeJSON(w, http.StatusOK, map[string]string{
+			"newNonce":   directory.url("/nonce"),
+			"newAccount": directory.url("/account"),
+			"newOrder":   directory.url("/order"),
+			"revokeCert": directory.url("/revoke"),
+			"keyChange":  directory.url("/key-change"),
+		})
+	case "/nonce":
+		w.WriteHeader(http.StatusOK)
+	case "/account":
+		w.Header().Set("Location", directory.url("/account/1"))
+		directory.writeJSON(w, http.StatusCreated, map[string]string{"status": acme.StatusValid})
+	case "/order":
+		directory.orders = append(directory.orders, time.Now())
+
+		if directory.failedOrders > 0 {
+			directory.failedOrders--
+			directory.writeError(w, http.StatusForbidden, "unauthorized", "the order is rejected")
+
+			return
+		}
+
+		directory.accepted = false
+
+		w.Header().Set("Location", directory.url("/order/1"))
+		directory.writeJSON(w, http.StatusCreated, directory.order(acme.StatusPending))
+	case "/order/1":
+		directory.writeJSON(w, http.StatusOK, directory.order(acme.StatusReady))
+	case "/authz/1":
+		status := acme.StatusPending
+		if directory.accepted {
+			status = acme.StatusValid
+		}
+
+		directory.writeJSON(w, http.StatusOK, map[string]interface{}{
+			"status":     status,
+			"identifier": map[string]string{"type": "dns", "value": testACMEDomain},
+			"challenges": []map[string]string{directory.challenge(status)},
+		})
+	case "/challenge/1":
+		directory.accepted = true
+		directory.writeJSON(w, http.StatusOK, directory.challenge(acme.StatusValid))
+	case "/finalize/1":
+		err := directory.issue(r)
+		if err != nil {
+			directory.writeError(w, http.StatusBadRequest, "badCSR", err.Error())
+			return
+		}
+
+		w.Header().Set("Location", directory.url("/order/1"))
+		directory.writeJSON(w, http.StatusOK, directory.order(acme.StatusValid))
+	case "/certificate/1":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		w.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: directory.certificate}))
+		w.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: directory.ca.Raw}))
+	default:
+		directory.writeError(w, http.StatusNotFound, "malformed", "unknown resource "+r.URL.Path)
+	}
+}
+
+func (directory *acmeDirectory) order(status string) map[string]interface{} {
+	order := map[string]interface{}{
+		"status":         status,
+		"identifiers":    []map[string]string{{"type": "dns", "value": testACMEDomain}},
+		"authorizations": []string{directory.url("/authz/1")},
+		"finalize":       directory.url("/finalize/1"),
+	}
+
+	if status == acme.StatusValid {
+		order["certificate"] = directory.url("/certificate/1")
+	}
+
+	return order
+}
+
+func (directory *acmeDirectory) challenge(status string) map[string]string {
+	return map[string]string{
+		"type":   directory.challengeType,
+		"url":    directory.url("/challenge/1"),
+		"token":  "token",
+		"status": status,
+	}
+}
+
+// issue signs the CSR sent in the payload of the finalize request
+func (directory *acmeDirectory) issue(r *http.Request) error {
+	var jws struct {
+		Payload string `json:"payload"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&jws)
+	if err != nil {
+		return err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+	if err != nil {
+		return err
+	}
+
+	var finalize struct {
+		CSR string `json:"csr"`
+	}
+
+	err = json.Unmarshal(payload, &finalize)
+	if err != nil {
+		return err
+	}
+
+	der, err := base64.RawURLEncoding.DecodeString(finalize.CSR)
+	if err != nil {
+		return err
+	}
+
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      csr.Subject,
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(directory.validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	directory.certificate, err = x509.CreateCertificate(rand.Reader, template, directory.ca, csr.PublicKey, directory.caKey)
+
+	return err
+}
+
+func (directory *acmeDirectory) writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(value)
+	if err != nil {
+		directory.t.Error(err)
+	}
+}
+
+func (directory *acmeDirectory) writeError(w http.ResponseWriter, status int, kind, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"type":   "urn:ietf:params:acme:error:" + kind,
+		"detail": detail,
+		"status": status,
+	})
+}
+
+// writeDNSHook writes a DNS hook logging its calls to the returned file, it fails with the specified exit code
+func writeDNSHook(t *testing.T, exitCode int) (string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	hook := filepath.Join(dir, "dns-hook.sh")
+	calls := filepath.Join(dir, "calls.log")
+
+	script := fmt.Sprintf("#!/bin/sh\necho \"$1 $2 $3\" >> %s\nexit %d\n", calls, exitCode)
+
+	err := os.WriteFile(hook, []byte(script), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return hook, calls
+}
+
+func newTestDNS01CertificateManager(directory *acmeDirectory, hook, cacheDir string) *dns01CertificateManager {
+	return &dns01CertificateManager{
+		client: &acme.Client{DirectoryURL: directory.url("/directory")},
+		config: ACMEConfig{
+			Domains:      []string{testACMEDomain},
+			DirectoryURL: directory.url("/directory"),
+			Solver:       agent.ACMESolverDNS01,
+			DNSHook:      hook,
+			CacheDir:     cacheDir,
+		},
+		checkInterval: time.Hour,
+		retryInterval: 10 * time.Millisecond,
+	}
+}
+
+// writeCachedCertificate writes a certificate of the domains valid for validity in the cache of the manager
+func writeCachedCertificate(t *testing.T, manager *dns01CertificateManager, domains []string, validity time.Duration) *tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: domains[0]},
+		DNSNames:     domains,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(validity),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = saveACMECertificate(manager.cachePath(), key, [][]byte{der})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func servedLeaf(t *testing.T, manager *dns01CertificateManager) *x509.Certificate {
+	t.Helper()
+
+	certificate, err := manager.getCertificate(&tls.ClientHelloInfo{ServerName: testACMEDomain})
+	if err != nil || certificate == nil {
+		t.Fatalf("expected a certificate to be served, got %v", err)
+	}
+
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return leaf
+}
+
+func TestDNS01CertificateManagerNeedsRenewal(t *testing.T) {
+	manager := &dns01CertificateManager{config: ACMEConfig{Domains: []string{testACMEDomain}, CacheDir: t.TempDir()}}
+
+	tests := []struct {
+		name     string
+		domains  []string
+		validity time.Duration
+		expected bool
+	}{
+		{name: "valid certificate", domains: []string{testACMEDomain}, validity: 60 * 24 * time.Hour, expected: false},
+		{name: "inside the renewal window", domains: []string{testACMEDomain}, validity: 29 * 24 * time.Hour, expected: true},
+		{name: "expired certificate", domains: []string{testACMEDomain}, validity: -time.Hour, expected: true},
+		{name: "missing domain", domains: []string{"other.example.com"}, validity: 60 * 24 * time.Hour, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certificate := writeCachedCertificate(t, manager, tt.domains, tt.validity)
+
+			if renewal := manager.needsRenewal(certificate); renewal != tt.expected {
+				t.Errorf("expected the renewal to be %t, got %t", tt.expected, renewal)
+			}
+		})
+	}
+
+	if !manager.needsRenewal(&tls.Certificate{Certificate: [][]byte{[]byte("invalid")}}) {
+		t.Error("expected an invalid certificate to be renewed")
+	}
+
+	if !manager.needsRenewal(&tls.Certificate{}) {
+		t.Error("expected a missing certificate to be renewed")
+	}
+}
+
+func TestDNS01CertificateManagerNextCheck(t *testing.T) {
+	manager := &dns01CertificateManager{checkInterval: 12 * time.Hour, retryInterval: time.Minute}
+
+	tests := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{0, 12 * time.Hour},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{10, 512 * time.Minute},
+		{11, 12 * time.Hour},
+		{1000, 12 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		if delay := manager.nextCheck(tt.failures); delay != tt.expected {
+			t.Errorf("%d failures: expected %s, got %s", tt.failures, tt.expected, delay)
+		}
+	}
+}
+
+func TestDNS01CertificateManagerObtain(t *testing.T) {
+	directory := newACMEDirectory(t)
+	hook, calls := writeDNSHook(t, 0)
+	cacheDir := t.TempDir()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	manager := newTestDNS01CertificateManager(directory, hook, cacheDir)
+
+	err := manager.start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf := servedLeaf(t, manager)
+	if leaf.VerifyHostname(testACMEDomain) != nil || leaf.Issuer.CommonName != "Stub ACME CA" {
+		t.Errorf("unexpected certificate %s issued by %s", leaf.Subject, leaf.Issuer)
+	}
+
+	output, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := manager.client.DNS01ChallengeRecord("token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := fmt.Sprintf("present _acme-challenge.%s %s\ncleanup _acme-challenge.%s %s\n", testACMEDomain, record, testACMEDomain, record)
+	if string(output) != expected {
+		t.Errorf("expected the DNS hook calls %q, got %q", expected, output)
+	}
+
+	// the cached certificate is served by the next managers
+	cached := newTestDNS01CertificateManager(directory, hook, cacheDir)
+
+	err = cached.start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if directory.orderCount() != 1 {
+		t.Errorf("expected the cached certificate to be reused, got %d orders", directory.orderCount())
+	}
+
+	if servedLeaf(t, cached).SerialNumber.Cmp(leaf.SerialNumber) != 0 {
+		t.Error("expected the cached certificate to be served")
+	}
+}
+
+func TestDNS01CertificateManagerErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(directory *acmeDirectory)
+		hookExit int
+		expected string
+	}{
+		{
+			name:     "rejected order",
+			setup:    func(directory *acmeDirectory) { directory.failedOrders = 1 },
+			expected: "the order is rejected",
+		},
+		{
+			name:     "failing DNS hook",
+			hookExit: 1,
+			expected: "the DNS hook failed to present the _acme-challenge." + testACMEDomain + " record",
+		},
+		{
+			name:     "missing DNS-01 challenge",
+			setup:    func(directory *acmeDirectory) { directory.challengeType = agent.ACMESolverHTTP01 },
+			expected: "no DNS-01 challenge offered for " + testACMEDomain,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			directory := newACMEDirectory(t)
+			if tt.setup != nil {
+				tt.setup(directory)
+			}
+
+			hook, _ := writeDNSHook(t, tt.hookExit)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			manager := newTestDNS01CertificateManager(directory, hook, t.TempDir())
+
+			err := manager.start(ctx)
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("expected %q, got %v", tt.expected, err)
+			}
+
+			if _, err := os.Stat(manager.cachePath()); err == nil {
+				t.Error("expected no certificate to be cached")
+			}
+		})
+	}
+}
+
+func TestDNS01CertificateManagerRenewalBackoff(t *testing.T) {
+	directory := newACMEDirectory(t)
+	directory.failedOrders = 3
+
+	hook, _ := writeDNSHook(t, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	manager := newTestDNS01CertificateManager(directory, hook, t.TempDir())
+	expiring := writeCachedCertificate(t, manager, []string{testACMEDomain}, 10*24*time.Hour)
+
+	// the renewal fails at startup, the cached certificate is served while the renewal is retried
+	err := manager.start(ctx)
+	if err != nil {
+		t.Fatalf("expected the cached certificate to be served, got %v", err)
+	}
+
+	if servedLeaf(t, manager).SerialNumber.Cmp(expiring.Leaf.SerialNumber) != 0 {
+		t.Error("expected the cached certificate to be served until the renewal succeeds")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for directory.orderCount() < 4 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if count := directory.orderCount(); count != 4 {
+		t.Fatalf("expected the renewal to succeed at the fourth order, got %d orders", count)
+	}
+
+	directory.mu.Lock()
+	orders := directory.orders
+	directory.mu.Unlock()
+
+	for i, minimum := range []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond} {
+		if delay := orders[i+1].Sub(orders[i]); delay < minimum {
+			t.Errorf("expected the retry %d to wait at least %s, it waited %s", i+1, minimum, delay)
+		}
+	}
+
+	deadline = time.Now().Add(5 * time.Second)
+	for manager.needsRenewal(&tls.Certificate{Certificate: [][]byte{servedLeaf(t, manager).Raw}}) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if leaf := servedLeaf(t, manager); leaf.Issuer.CommonName != "Stub ACME CA" {
+		t.Errorf("expected the renewed certificate to be served, got a certificate issued by %s", leaf.Issuer)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if count := directory.orderCount(); count != 4 {
+		t.Errorf("expected no order once the certificate is renewed, got %d orders", count)
+	}
+}
+
+func TestDNS01CertificateManagerExpiredCache(t *testing.T) {
+	directory := newACMEDirectory(t)
+	directory.failedOrders = 1
+
+	hook, _ := writeDNSHook(t, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	manager := newTestDNS01CertificateManager(directory, hook, t.TempDir())
+	writeCachedCertificate(t, manager, []string{testACMEDomain}, -time.Hour)
+
+	err := manager.start(ctx)
+	if err == nil {
+		t.Error("expected an expired cached certificate not to be served when the renewal fails")
+	}
+}
@@ -0,0 +1,313 @@
+package crypto
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// enrollmentRenewalRatio is the part of the lifetime of the certificate after which it is renewed
+	enrollmentRenewalRatio = 2.0 / 3
+	// enrollmentRetryInterval is the interval between two attempts to obtain a certificate
+	enrollmentRetryInterval = time.Minute
+	// enrollmentRequestTimeout is the maximum duration of a certificate signing request
+	enrollmentRequestTimeout = 30 * time.Second
+)
+
+// EnrollmentConfig represents the configuration of the enrollment of the mTLS client certificate of the agent
+type EnrollmentConfig struct {
+	// URL is the endpoint of the Portainer server signing the certificate signing requests of the agents
+	URL string
+	// Token authenticates the first enrollment, the renewals are authenticated with the current certificate
+	Token string
+	// CACertPath is the CA certificate verifying the server and the certificates it issues
+	CACertPath string
+	CertPath   string
+	KeyPath    string
+	CommonName string
+}
+
+type enrollmentRequest struct {
+	CSR string
+}
+
+type enrollmentResponse struct {
+	// Certificate is the PEM encoded certificate, followed by its intermediate certificates
+	Certificate string
+}
+
+// CertificateEnroller obtains the mTLS client certificate of the agent from the Portainer server with a certificate
+// signing request, and renews it before it expires. The certificate and its key are written to the mTLS certificate
+// files, which are reloaded by the Edge client when they change.
+type CertificateEnroller struct {
+	config EnrollmentConfig
+	caPool *x509.CertPool
+}
+
+// NewCertificateEnroller returns a pointer to a CertificateEnroller
+func NewCertificateEnroller(config EnrollmentConfig) (*CertificateEnroller, error) {
+	caCert, err := os.ReadFile(config.CACertPath)
+	if err != nil {
+		return nil, err
+	}
+
+	caPool := x509.NewCertPool()
+	if !caPool.AppendCertsFromPEM(caCert) {
+		return nil, errors.New("no CA certificate found in " + config.CACertPath)
+	}
+
+	return &CertificateEnroller{
+		config: config,
+		caPool: caPool,
+	}, nil
+}
+
+// EnsureCertificate requests a certificate when the current one is missing, invalid or due for renewal. It retries
+// until a certificate is obtained or ctx is cancelled.
+func (enroller *CertificateEnroller) EnsureCertificate(ctx context.Context) error {
+	for {
+		leaf, _ := enroller.currentCertificate()
+		if leaf != nil && time.Now().Before(renewalTime(leaf)) {
+			return nil
+		}
+
+		err := enroller.enroll(ctx)
+		if err == nil {
+			return nil
+		}
+
+		log.Error().Err(err).Dur("retry_in", enrollmentRetryInterval).Msg("unable to obtain the mTLS certificate from the server")
+
+		select {
+		case <-time.After(enrollmentRetryInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// RenewalLoop renews the certificate once enrollmentRenewalRatio of its lifetime has elapsed, until ctx is cancelled
+func (enroller *CertificateEnroller) RenewalLoop(ctx context.Context) {
+	for {
+		delay := enrollmentRetryInterval
+		if leaf, err := enroller.currentCertificate(); err == nil {
+			delay = time.Until(renewalTime(leaf))
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+
+		err := enroller.EnsureCertificate(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Msg("unable to renew the mTLS certificate")
+		}
+	}
+}
+
+// currentCertificate returns the leaf of the current certificate when it is valid
+func (enroller *CertificateEnroller) currentCertificate() (*x509.Certificate, error) {
+	certificate, err := tls.LoadX509KeyPair(enroller.config.CertPath, enroller.config.KeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(leaf.NotAfter) {
+		return nil, errors.New("the mTLS certificate has expired")
+	}
+
+	return leaf, nil
+}
+
+func renewalTime(leaf *x509.Certificate) time.Time {
+	lifetime := leaf.NotAfter.Sub(leaf.NotBefore)
+
+	return leaf.NotBefore.Add(time.Duration(float64(lifetime) * enrollmentRenewalRatio))
+}
+
+func (enroller *CertificateEnroller) enroll(ctx context.Context) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: enroller.config.CommonName},
+	}, key)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(enrollmentRequest{
+		CSR: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})),
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, enrollmentRequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, enroller.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	tlsConfig := CreateTLSConfiguration()
+	tlsConfig.RootCAs = enroller.caPool
+
+	// The renewals are authenticated with the current certificate, the token is only used for the first enrollment
+	if current, err := tls.LoadX509KeyPair(enroller.config.CertPath, enroller.config.KeyPath); err == nil && !certificateExpired(current) {
+		tlsConfig.Certificates = []tls.Certificate{current}
+	} else if enroller.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+enroller.config.Token)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("the certificate signing request was refused with the status %d", resp.StatusCode)
+	}
+
+	var response enrollmentResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return err
+	}
+
+	leaf, err := enroller.verifyIssuedCertificate([]byte(response.Certificate), key)
+	if err != nil {
+		return err
+	}
+
+	err = enroller.save(key, []byte(response.Certificate))
+	if err != nil {
+		return err
+	}
+
+	log.Info().
+		Str("subject", leaf.Subject.CommonName).
+		Time("not_after", leaf.NotAfter).
+		Msg("mTLS certificate obtained from the server")
+
+	return nil
+}
+
+// verifyIssuedCertificate checks that the certificate issued by the server is a client certificate of key signed by
+// the CA
+func (enroller *CertificateEnroller) verifyIssuedCertificate(chain []byte, key *ecdsa.PrivateKey) (*x509.Certificate, error) {
+	var certificates []*x509.Certificate
+	for block, rest := pem.Decode(chain); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		certificates = append(certificates, certificate)
+	}
+
+	if len(certificates) == 0 {
+		return nil, errors.New("no certificate found in the response of the server")
+	}
+
+	leaf := certificates[0]
+
+	if !key.PublicKey.Equal(leaf.PublicKey) {
+		return nil, errors.New("the issued certificate does not match the certificate signing request")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, certificate := range certificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+
+	_, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         enroller.caPool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return leaf, nil
+}
+
+// save writes the key and the certificate, each file is replaced atomically
+func (enroller *CertificateEnroller) save(key *ecdsa.PrivateKey, chain []byte) error {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	err = replaceFile(enroller.config.KeyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		return err
+	}
+
+	return replaceFile(enroller.config.CertPath, chain)
+}
+
+func replaceFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(tmp.Name(), 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func certificateExpired(certificate tls.Certificate) bool {
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+
+	return err != nil || time.Now().After(leaf.NotAfter)
+}
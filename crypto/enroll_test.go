@@ -0,0 +1,135 @@
+package crypto
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCertificateEnroller(t *testing.T) {
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "portainer-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, _ := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	ca, _ := x509.ParseCertificate(caDER)
+
+	issue := func(template *x509.Certificate, publicKey interface{}) []byte {
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, publicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+
+	serverKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	serverCert, _ := tls.X509KeyPair(issue(&x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}, &serverKey.PublicKey), pemKey(t, serverKey))
+
+	var enrollments, renewals int
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case len(r.TLS.PeerCertificates) > 0:
+			renewals++
+		case r.Header.Get("Authorization") == "Bearer bootstrap":
+			enrollments++
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var request enrollmentRequest
+		json.NewDecoder(r.Body).Decode(&request)
+		block, _ := pem.Decode([]byte(request.CSR))
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		// a short lifetime makes the certificate due for renewal
+		certificate := issue(&x509.Certificate{
+			SerialNumber: big.NewInt(time.Now().UnixNano()),
+			Subject:      csr.Subject,
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Minute),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}, csr.PublicKey)
+
+		json.NewEncoder(w).Encode(enrollmentResponse{Certificate: string(certificate)})
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}, ClientAuth: tls.RequestClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	dir := t.TempDir()
+	caPath := filepath.Join(dir, "ca.pem")
+	os.WriteFile(caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0600)
+
+	enroller, err := NewCertificateEnroller(EnrollmentConfig{
+		URL:        server.URL,
+		Token:      "bootstrap",
+		CACertPath: caPath,
+		CertPath:   filepath.Join(dir, "cert.pem"),
+		KeyPath:    filepath.Join(dir, "key.pem"),
+		CommonName: "edge-device",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := enroller.EnsureCertificate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := enroller.currentCertificate()
+	if err != nil || leaf.Subject.CommonName != "edge-device" {
+		t.Fatalf("expected the enrolled certificate to be stored, got %v %v", leaf, err)
+	}
+
+	if err := enroller.EnsureCertificate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if enrollments != 1 || renewals != 1 {
+		t.Fatalf("expected an enrollment with the token and a renewal with the certificate, got %d and %d", enrollments, renewals)
+	}
+}
+
+func pemKey(t *testing.T, key *ecdsa.PrivateKey) []byte {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
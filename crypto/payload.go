@@ -0,0 +1,360 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/portainer/agent/tpm"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// PayloadEncryptionNaClBoxStream is the encryption scheme of the payloads exchanged with the Portainer server
+const PayloadEncryptionNaClBoxStream = "nacl-box-stream"
+
+const (
+	// payloadNoncePrefixSize is the size of the random prefix of the nonces of the frames of a payload, the nonce of
+	// a frame ends with its counter
+	payloadNoncePrefixSize = 16
+	// payloadFrameSize is the maximum size of the plaintext of a frame
+	payloadFrameSize = 64 * 1024
+	// payloadFinalFrame flags the last frame of a payload, in the length of the frame and in its counter, so that a
+	// truncated payload is detected
+	payloadFinalFrame = 1 << 31
+)
+
+// ErrPayloadDecryption is returned when a payload cannot be decrypted with the keys of the agent and of the server
+var ErrPayloadDecryption = errors.New("unable to decrypt the payload")
+
+// PayloadCipher encrypts the payloads sent to the Portainer server and decrypts its responses with a NaCl box, using
+// the key pair of the device and the public key of the server. The payloads stay confidential and authenticated when
+// the TLS connection is terminated by a proxy between the agent and the server.
+type PayloadCipher struct {
+	publicKey *[32]byte
+	sharedKey [32]byte
+}
+
+type payloadKeyFile struct {
+	PublicKey  string `json:"PublicKey"`
+	PrivateKey string `json:"PrivateKey,omitempty"`
+	// SealedPrivateKey is the private key sealed by the TPM, when it is enabled
+	SealedPrivateKey *tpm.KeyBlob `json:"SealedPrivateKey,omitempty"`
+}
+
+// LoadOrCreatePayloadCipher returns a pointer to a PayloadCipher using the key pair of the device persisted at path,
+// generated when the file does not exist, and the base64 encoded public key of the server
+func LoadOrCreatePayloadCipher(path, serverPublicKey string) (*PayloadCipher, error) {
+	serverKey, err := decodePayloadKey(serverPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key of the server: %w", err)
+	}
+
+	publicKey, privateKey, err := loadOrCreatePayloadKeyPair(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cipher := &PayloadCipher{publicKey: publicKey}
+	box.Precompute(&cipher.sharedKey, serverKey, privateKey)
+
+	return cipher, nil
+}
+
+// PublicKey returns the base64 encoded public key of the device
+func (cipher *PayloadCipher) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(cipher.publicKey[:])
+}
+
+// SealReader returns a reader of the payload read from r encrypted as it is read. The payload is prefixed by the
+// random prefix of the nonces and is split in frames of up to 64 KiB, each frame is sealed with the counter of the
+// frame in its nonce and is prefixed by its length, so that the payloads are never held in memory as a whole.
+func (cipher *PayloadCipher) SealReader(r io.Reader) (io.Reader, error) {
+	sealer := &payloadSealer{cipher: cipher, r: r, plaintext: make([]byte, payloadFrameSize)}
+
+	sealer.buffer = make([]byte, payloadNoncePrefixSize, payloadNoncePrefixSize+4+payloadFrameSize+box.Overhead)
+	if _, err := rand.Read(sealer.buffer); err != nil {
+		return nil, err
+	}
+
+	copy(sealer.prefix[:], sealer.buffer)
+
+	return sealer, nil
+}
+
+// OpenReader returns a reader of the payload read from r as returned by SealReader, decrypted as it is read.
+// ErrPayloadDecryption is returned when a frame cannot be decrypted, when the frames are reordered or when the
+// payload is truncated.
+func (cipher *PayloadCipher) OpenReader(r io.Reader) io.Reader {
+	return &payloadOpener{cipher: cipher, r: r}
+}
+
+type payloadSealer struct {
+	cipher    *PayloadCipher
+	r         io.Reader
+	prefix    [payloadNoncePrefixSize]byte
+	counter   uint64
+	plaintext []byte
+	buffer    []byte
+	done      bool
+}
+
+func (s *payloadSealer) Read(p []byte) (int, error) {
+	for len(s.buffer) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+
+		if err := s.sealFrame(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, s.buffer)
+	s.buffer = s.buffer[n:]
+
+	return n, nil
+}
+
+// sealFrame seals the next frame in the buffer, the frame read up to the end of the payload is the final frame
+func (s *payloadSealer) sealFrame() error {
+	n, err := io.ReadFull(s.r, s.plaintext)
+
+	final := false
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		final = true
+	case err != nil:
+		return err
+	}
+
+	nonce := payloadFrameNonce(&s.prefix, s.counter, final)
+	s.counter++
+
+	length := uint32(n + box.Overhead)
+	if final {
+		length |= payloadFinalFrame
+		s.done = true
+	}
+
+	s.buffer = binary.BigEndian.AppendUint32(s.buffer[:0], length)
+	s.buffer = box.SealAfterPrecomputation(s.buffer, s.plaintext[:n], nonce, &s.cipher.sharedKey)
+
+	return nil
+}
+
+type payloadOpener struct {
+	cipher    *PayloadCipher
+	r         io.Reader
+	prefix    *[payloadNoncePrefixSize]byte
+	counter   uint64
+	sealed    []byte
+	opened    []byte
+	plaintext []byte
+	done      bool
+}
+
+func (o *payloadOpener) Read(p []byte) (int, error) {
+	for len(o.plaintext) == 0 {
+		if o.done {
+			return 0, io.EOF
+		}
+
+		if err := o.openFrame(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, o.plaintext)
+	o.plaintext = o.plaintext[n:]
+
+	return n, nil
+}
+
+// openFrame decrypts the next frame, the payload must end with the final frame
+func (o *payloadOpener) openFrame() error {
+	if o.prefix == nil {
+		o.prefix = &[payloadNoncePrefixSize]byte{}
+		if _, err := io.ReadFull(o.r, o.prefix[:]); err != nil {
+			return payloadReadError(err)
+		}
+	}
+
+	var header [4]byte
+	if _, err := io.ReadFull(o.r, header[:]); err != nil {
+		return payloadReadError(err)
+	}
+
+	length := binary.BigEndian.Uint32(header[:])
+	final := length&payloadFinalFrame != 0
+	length &^= payloadFinalFrame
+
+	if length < box.Overhead || length > payloadFrameSize+box.Overhead {
+		return ErrPayloadDecryption
+	}
+
+	if cap(o.sealed) < int(length) {
+		o.sealed = make([]byte, payloadFrameSize+box.Overhead)
+	}
+
+	o.sealed = o.sealed[:length]
+	if _, err := io.ReadFull(o.r, o.sealed); err != nil {
+		return payloadReadError(err)
+	}
+
+	nonce := payloadFrameNonce(o.prefix, o.counter, final)
+	o.counter++
+
+	opened, ok := box.OpenAfterPrecomputation(o.opened[:0], o.sealed, nonce, &o.cipher.sharedKey)
+	if !ok {
+		return ErrPayloadDecryption
+	}
+
+	o.opened = opened
+	o.plaintext = opened
+	o.done = final
+
+	return nil
+}
+
+// payloadFrameNonce returns the nonce of a frame, the random prefix of the payload followed by the counter of the
+// frame, the final frame being flagged in its counter
+func payloadFrameNonce(prefix *[payloadNoncePrefixSize]byte, counter uint64, final bool) *[24]byte {
+	var nonce [24]byte
+	copy(nonce[:], prefix[:])
+
+	if final {
+		counter |= 1 << 63
+	}
+
+	binary.BigEndian.PutUint64(nonce[payloadNoncePrefixSize:], counter)
+
+	return &nonce
+}
+
+// payloadReadError returns ErrPayloadDecryption when the payload is truncated
+func payloadReadError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrPayloadDecryption
+	}
+
+	return err
+}
+
+func loadOrCreatePayloadKeyPair(path string) (*[32]byte, *[32]byte, error) {
+	content, err := os.ReadFile(path)
+	if err == nil {
+		var file payloadKeyFile
+		if err := json.Unmarshal(content, &file); err != nil {
+			return nil, nil, err
+		}
+
+		publicKey, err := decodePayloadKey(file.PublicKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid public key in payload key file: %w", err)
+		}
+
+		if file.SealedPrivateKey != nil {
+			privateKey, err := unsealPayloadKey(file.SealedPrivateKey)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			return publicKey, privateKey, nil
+		}
+
+		privateKey, err := decodePayloadKey(file.PrivateKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid private key in payload key file: %w", err)
+		}
+
+		if tpm.DefaultDevice() != nil {
+			// The private key persisted before the TPM was enabled is sealed
+			return publicKey, privateKey, savePayloadKeyPair(path, publicKey, privateKey)
+		}
+
+		return publicKey, privateKey, nil
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, err
+	}
+
+	publicKey, privateKey, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return publicKey, privateKey, savePayloadKeyPair(path, publicKey, privateKey)
+}
+
+// savePayloadKeyPair persists the key pair at path, the private key is sealed by the TPM when it is enabled
+func savePayloadKeyPair(path string, publicKey, privateKey *[32]byte) error {
+	file := payloadKeyFile{PublicKey: base64.StdEncoding.EncodeToString(publicKey[:])}
+
+	if device := tpm.DefaultDevice(); device != nil {
+		blob, err := device.SealSecret(privateKey[:])
+		if err != nil {
+			return err
+		}
+
+		file.SealedPrivateKey = blob
+	} else {
+		file.PrivateKey = base64.StdEncoding.EncodeToString(privateKey[:])
+	}
+
+	content, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, content, 0600)
+}
+
+func unsealPayloadKey(blob *tpm.KeyBlob) (*[32]byte, error) {
+	device := tpm.DefaultDevice()
+	if device == nil {
+		return nil, errors.New("the private key of the payload key file is sealed by a TPM, the TPM must be enabled")
+	}
+
+	unsealed, err := device.UnsealSecret(blob)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(unsealed) != 32 {
+		return nil, errors.New("invalid sealed private key in payload key file")
+	}
+
+	var key [32]byte
+	copy(key[:], unsealed)
+
+	return &key, nil
+}
+
+func decodePayloadKey(encoded string) (*[32]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(decoded) != 32 {
+		return nil, errors.New("the key must be 32 bytes long")
+	}
+
+	var key [32]byte
+	copy(key[:], decoded)
+
+	return &key, nil
+}
@@ -0,0 +1,112 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+func newTestPayloadCiphers(t *testing.T) (*PayloadCipher, *PayloadCipher) {
+	t.Helper()
+
+	agentPublic, agentPrivate, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverPublic, serverPrivate, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	agentCipher := &PayloadCipher{publicKey: agentPublic}
+	box.Precompute(&agentCipher.sharedKey, serverPublic, agentPrivate)
+
+	serverCipher := &PayloadCipher{publicKey: serverPublic}
+	box.Precompute(&serverCipher.sharedKey, agentPublic, serverPrivate)
+
+	return agentCipher, serverCipher
+}
+
+func sealPayload(t *testing.T, cipher *PayloadCipher, payload []byte) []byte {
+	t.Helper()
+
+	r, err := cipher.SealReader(bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sealed
+}
+
+func TestPayloadStreamRoundTrip(t *testing.T) {
+	agentCipher, serverCipher := newTestPayloadCiphers(t)
+
+	for _, size := range []int{0, 1, payloadFrameSize, payloadFrameSize + 1, 3*payloadFrameSize + 17} {
+		payload := make([]byte, size)
+		rand.Read(payload)
+
+		sealed := sealPayload(t, agentCipher, payload)
+
+		opened, err := io.ReadAll(serverCipher.OpenReader(bytes.NewReader(sealed)))
+		if err != nil {
+			t.Fatalf("size %d: %s", size, err)
+		}
+
+		if !bytes.Equal(opened, payload) {
+			t.Fatalf("size %d: the opened payload differs", size)
+		}
+	}
+}
+
+func TestPayloadStreamRejected(t *testing.T) {
+	agentCipher, serverCipher := newTestPayloadCiphers(t)
+
+	payload := make([]byte, 2*payloadFrameSize+10)
+	rand.Read(payload)
+
+	sealed := sealPayload(t, agentCipher, payload)
+	frameLength := 4 + payloadFrameSize + box.Overhead
+
+	tampered := bytes.Clone(sealed)
+	tampered[payloadNoncePrefixSize+10] ^= 1
+
+	// the second frame flagged as final drops the rest of the payload
+	flagged := bytes.Clone(sealed)
+	header := flagged[payloadNoncePrefixSize+frameLength:]
+	binary.BigEndian.PutUint32(header, binary.BigEndian.Uint32(header)|payloadFinalFrame)
+
+	// the first two frames swapped
+	swapped := bytes.Clone(sealed[:payloadNoncePrefixSize])
+	swapped = append(swapped, sealed[payloadNoncePrefixSize+frameLength:payloadNoncePrefixSize+2*frameLength]...)
+	swapped = append(swapped, sealed[payloadNoncePrefixSize:payloadNoncePrefixSize+frameLength]...)
+	swapped = append(swapped, sealed[payloadNoncePrefixSize+2*frameLength:]...)
+
+	oversized := bytes.Clone(sealed[:payloadNoncePrefixSize])
+	oversized = binary.BigEndian.AppendUint32(oversized, payloadFrameSize+box.Overhead+1)
+
+	for name, data := range map[string][]byte{
+		"tampered":        tampered,
+		"truncated":       sealed[:payloadNoncePrefixSize+frameLength],
+		"truncated frame": sealed[:len(sealed)-1],
+		"flagged final":   flagged,
+		"swapped frames":  swapped,
+		"oversized frame": oversized,
+		"empty":           {},
+	} {
+		_, err := io.ReadAll(serverCipher.OpenReader(bytes.NewReader(data)))
+		if !errors.Is(err, ErrPayloadDecryption) {
+			t.Errorf("%s: expected ErrPayloadDecryption, got %v", name, err)
+		}
+	}
+}
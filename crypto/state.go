@@ -0,0 +1,279 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/portainer/agent/tpm"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// stateMagic prefixes the state encrypted by a StateCipher, the state persisted before the encryption was enabled is
+// read as is
+var stateMagic = []byte("PAES1\x00")
+
+// stateKeyInfo is the HKDF info deriving the key wrapping the state key from the machine secret
+const stateKeyInfo = "portainer-agent-state-key"
+
+// ErrStateDecryption is returned when the encrypted state cannot be decrypted with the state key of the agent
+var ErrStateDecryption = errors.New("unable to decrypt the agent state")
+
+var (
+	defaultStateCipher   *StateCipher
+	defaultStateCipherMu sync.Mutex
+)
+
+// StateCipher encrypts the persistent state of the agent (Edge key, queued commands and results, Edge stack
+// histories) with AES-256-GCM, so that the storage of a stolen device does not leak the server credentials and the
+// workload data. The state key is sealed by the TPM when it is enabled, wrapped with a key derived from a secret
+// otherwise. The state is only protected when that secret is not stored on the device, a secret read from the disk
+// holding the state, like the machine identifier, only obfuscates it.
+type StateCipher struct {
+	aead cipher.AEAD
+}
+
+type stateKeyFile struct {
+	// SealedKey is the state key sealed by the TPM
+	SealedKey *tpm.KeyBlob `json:"SealedKey,omitempty"`
+	// Salt and WrappedKey are the salt of the key derivation and the state key encrypted with the derived key
+	Salt       []byte `json:"Salt,omitempty"`
+	WrappedKey []byte `json:"WrappedKey,omitempty"`
+}
+
+// LoadOrCreateStateCipher returns a pointer to a StateCipher using the state key persisted at path, generated when the
+// file does not exist. The key is sealed by device when it is not nil, wrapped with a key derived from secret
+// otherwise.
+func LoadOrCreateStateCipher(path, secret string, device *tpm.Device) (*StateCipher, error) {
+	content, err := os.ReadFile(path)
+	if err == nil {
+		key, err := unwrapStateKey(content, secret, device)
+		if err != nil {
+			return nil, err
+		}
+
+		return newStateCipher(key)
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	file, err := wrapStateKey(key, secret, device)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err = json.Marshal(file)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.WriteFile(path, content, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return newStateCipher(key)
+}
+
+// MachineSecret returns the machine identifier of the host, read from the host filesystem when it is mounted. The
+// machine identifier is stored on the same disk as the state, the key derived from it does not protect the state of a
+// stolen device, it only obfuscates it.
+func MachineSecret(hostRoot string) (string, error) {
+	for _, path := range []string{filepath.Join(hostRoot, "etc", "machine-id"), "/etc/machine-id"} {
+		content, err := os.ReadFile(path)
+		if err == nil && strings.TrimSpace(string(content)) != "" {
+			return strings.TrimSpace(string(content)), nil
+		}
+	}
+
+	return "", errors.New("unable to read the machine identifier of the host, a state secret must be set")
+}
+
+// EnableStateEncryption makes stateCipher the cipher of the persistent state of the agent
+func EnableStateEncryption(stateCipher *StateCipher) {
+	defaultStateCipherMu.Lock()
+	defer defaultStateCipherMu.Unlock()
+
+	defaultStateCipher = stateCipher
+}
+
+// DefaultStateCipher returns the enabled state cipher, nil when the state is not encrypted
+func DefaultStateCipher() *StateCipher {
+	defaultStateCipherMu.Lock()
+	defer defaultStateCipherMu.Unlock()
+
+	return defaultStateCipher
+}
+
+// EncryptState encrypts data with the enabled state cipher, data is returned as is when the state is not encrypted
+func EncryptState(data []byte) ([]byte, error) {
+	stateCipher := DefaultStateCipher()
+	if stateCipher == nil {
+		return data, nil
+	}
+
+	return stateCipher.Encrypt(data)
+}
+
+// DecryptState decrypts data encrypted by EncryptState, data persisted before the encryption was enabled is returned
+// as is
+func DecryptState(data []byte) ([]byte, error) {
+	if !IsEncryptedState(data) {
+		return data, nil
+	}
+
+	stateCipher := DefaultStateCipher()
+	if stateCipher == nil {
+		return nil, errors.New("the agent state is encrypted, the state encryption must be enabled")
+	}
+
+	return stateCipher.Decrypt(data)
+}
+
+// IsEncryptedState returns true when data was encrypted by a StateCipher
+func IsEncryptedState(data []byte) bool {
+	return bytes.HasPrefix(data, stateMagic)
+}
+
+// Encrypt returns data encrypted with a random nonce, prefixed by a magic header and the nonce
+func (stateCipher *StateCipher) Encrypt(data []byte) ([]byte, error) {
+	nonce := make([]byte, stateCipher.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	encrypted := append(append([]byte{}, stateMagic...), nonce...)
+
+	return stateCipher.aead.Seal(encrypted, nonce, data, stateMagic), nil
+}
+
+// Decrypt returns the data encrypted by Encrypt
+func (stateCipher *StateCipher) Decrypt(encrypted []byte) ([]byte, error) {
+	nonceSize := stateCipher.aead.NonceSize()
+	if !IsEncryptedState(encrypted) || len(encrypted) < len(stateMagic)+nonceSize {
+		return nil, ErrStateDecryption
+	}
+
+	nonce := encrypted[len(stateMagic) : len(stateMagic)+nonceSize]
+
+	data, err := stateCipher.aead.Open(nil, nonce, encrypted[len(stateMagic)+nonceSize:], stateMagic)
+	if err != nil {
+		return nil, ErrStateDecryption
+	}
+
+	return data, nil
+}
+
+func newStateCipher(key []byte) (*StateCipher, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StateCipher{aead: aead}, nil
+}
+
+func wrapStateKey(key []byte, secret string, device *tpm.Device) (*stateKeyFile, error) {
+	if device != nil {
+		blob, err := device.SealSecret(key)
+		if err != nil {
+			return nil, err
+		}
+
+		return &stateKeyFile{SealedKey: blob}, nil
+	}
+
+	if secret == "" {
+		return nil, errors.New("a machine secret is required to encrypt the agent state without a TPM")
+	}
+
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	wrappingCipher, err := deriveStateCipher(secret, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	wrappedKey, err := wrappingCipher.Encrypt(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stateKeyFile{Salt: salt, WrappedKey: wrappedKey}, nil
+}
+
+func unwrapStateKey(content []byte, secret string, device *tpm.Device) ([]byte, error) {
+	var file stateKeyFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, err
+	}
+
+	if file.SealedKey != nil {
+		if device == nil {
+			return nil, errors.New("the state key is sealed by a TPM, the TPM must be enabled")
+		}
+
+		return device.UnsealSecret(file.SealedKey)
+	}
+
+	if secret == "" {
+		return nil, errors.New("a machine secret is required to decrypt the agent state without a TPM")
+	}
+
+	wrappingCipher, err := deriveStateCipher(secret, file.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := wrappingCipher.Decrypt(file.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unwrap the state key, the machine secret changed: %w", err)
+	}
+
+	return key, nil
+}
+
+// deriveStateCipher returns the cipher wrapping the state key, its key is derived from secret with HKDF-SHA256
+func deriveStateCipher(secret string, salt []byte) (*StateCipher, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(secret), salt, []byte(stateKeyInfo)), key); err != nil {
+		return nil, err
+	}
+
+	return newStateCipher(key)
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
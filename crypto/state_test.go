@@ -0,0 +1,78 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestStateCipher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent_state_key.json")
+
+	stateCipher, err := LoadOrCreateStateCipher(path, "machine-secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := stateCipher.Encrypt([]byte("edge key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsEncryptedState(encrypted) || bytes.Contains(encrypted, []byte("edge key")) {
+		t.Fatal("expected the state to be encrypted")
+	}
+
+	// The state key is read again from the key file with the same machine secret
+	reloaded, err := LoadOrCreateStateCipher(path, "machine-secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decrypted, err := reloaded.Decrypt(encrypted)
+	if err != nil || string(decrypted) != "edge key" {
+		t.Fatalf("expected the state to be decrypted, got %q (%v)", decrypted, err)
+	}
+
+	if _, err := LoadOrCreateStateCipher(path, "other-secret", nil); err == nil {
+		t.Error("expected the state key not to be unwrapped with another machine secret")
+	}
+
+	encrypted[len(encrypted)-1] ^= 0xff
+	if _, err := reloaded.Decrypt(encrypted); !errors.Is(err, ErrStateDecryption) {
+		t.Errorf("expected the altered state to be rejected, got %v", err)
+	}
+}
+
+func TestEncryptState(t *testing.T) {
+	stateCipher, err := LoadOrCreateStateCipher(filepath.Join(t.TempDir(), "agent_state_key.json"), "machine-secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The state persisted before the encryption was enabled is read as is
+	data, err := DecryptState([]byte("plain"))
+	if err != nil || string(data) != "plain" {
+		t.Fatalf("expected the plain state to be returned, got %q (%v)", data, err)
+	}
+
+	EnableStateEncryption(stateCipher)
+	defer EnableStateEncryption(nil)
+
+	encrypted, err := EncryptState([]byte("queued command"))
+	if err != nil || !IsEncryptedState(encrypted) {
+		t.Fatalf("expected the state to be encrypted, got %q (%v)", encrypted, err)
+	}
+
+	data, err = DecryptState(encrypted)
+	if err != nil || string(data) != "queued command" {
+		t.Fatalf("expected the state to be decrypted, got %q (%v)", data, err)
+	}
+
+	EnableStateEncryption(nil)
+
+	if _, err := DecryptState(encrypted); err == nil {
+		t.Error("expected an error when the encryption is disabled")
+	}
+}
@@ -0,0 +1,252 @@
+package declarative
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+)
+
+// ManagedLabel is the label of the networks and volumes created by the declarative apply, only the resources
+// holding it are replaced or removed
+const ManagedLabel = "io.portainer.agent.declarative"
+
+// Kinds of the resources
+const (
+	KindStack    = "stack"
+	KindNetwork  = "network"
+	KindVolume   = "volume"
+	KindSchedule = "schedule"
+)
+
+// Actions of the changes
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionReplace = "replace"
+	ActionDelete  = "delete"
+	// ActionConflict is reported for the resources that cannot be reconciled, they are left untouched
+	ActionConflict = "conflict"
+)
+
+// Change represents an action on a resource of the host
+type Change struct {
+	Kind   string `json:"Kind"`
+	Name   string `json:"Name"`
+	Action string `json:"Action"`
+	Reason string `json:"Reason,omitempty"`
+	// Error is the reason of the failure of the change, once applied
+	Error string `json:"Error,omitempty"`
+}
+
+// Plan represents the changes reconciling the host toward a spec, in the order they are applied
+type Plan struct {
+	Changes []Change `json:"Changes"`
+	// Unchanged is the number of resources of the spec already in the desired state
+	Unchanged int `json:"Unchanged"`
+	// Failed is the number of changes that failed, once applied
+	Failed int `json:"Failed"`
+}
+
+// State represents the resources of the host
+type State struct {
+	// Stacks maps the name of the stacks deployed by a previous apply to the digest of their spec
+	Stacks map[string]string
+	// Schedules are the schedules written by a previous apply
+	Schedules map[string]ScheduleSpec
+	// Networks and Volumes are all the networks and volumes of the host, the managed ones hold ManagedLabel
+	Networks map[string]NetworkSpec
+	Volumes  map[string]VolumeSpec
+}
+
+func computePlan(spec *Spec, state *State) *Plan {
+	plan := &Plan{Changes: []Change{}}
+
+	var deletions []Change
+
+	desiredNetworks := map[string]bool{}
+	networks := append([]NetworkSpec{}, spec.Networks...)
+	sort.Slice(networks, func(i, j int) bool { return networks[i].Name < networks[j].Name })
+
+	for _, network := range networks {
+		desiredNetworks[network.Name] = true
+
+		observed, ok := state.Networks[network.Name]
+		switch {
+		case !ok:
+			plan.add(KindNetwork, network.Name, ActionCreate, "")
+		case !isManaged(observed.Labels):
+			plan.add(KindNetwork, network.Name, ActionConflict, "a network with the same name was not created by the declarative apply")
+		case !networkMatches(network, observed):
+			plan.add(KindNetwork, network.Name, ActionReplace, "the configuration of the network changed")
+		default:
+			plan.Unchanged++
+		}
+	}
+
+	desiredVolumes := map[string]bool{}
+	volumes := append([]VolumeSpec{}, spec.Volumes...)
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].Name < volumes[j].Name })
+
+	for _, volume := range volumes {
+		desiredVolumes[volume.Name] = true
+
+		observed, ok := state.Volumes[volume.Name]
+		switch {
+		case !ok:
+			plan.add(KindVolume, volume.Name, ActionCreate, "")
+		case !isManaged(observed.Labels):
+			plan.add(KindVolume, volume.Name, ActionConflict, "a volume with the same name was not created by the declarative apply")
+		case !volumeMatches(volume, observed):
+			// The volumes are never replaced since their data would be lost
+			plan.add(KindVolume, volume.Name, ActionConflict, "the configuration of the volume changed, it must be removed to be created again")
+		default:
+			plan.Unchanged++
+		}
+	}
+
+	desiredStacks := map[string]bool{}
+	stacks := append([]StackSpec{}, spec.Stacks...)
+	sort.Slice(stacks, func(i, j int) bool { return stacks[i].Name < stacks[j].Name })
+
+	for _, stack := range stacks {
+		desiredStacks[stack.Name] = true
+
+		digest, ok := state.Stacks[stack.Name]
+		switch {
+		case !ok:
+			plan.add(KindStack, stack.Name, ActionCreate, "")
+		case digest != stackDigest(stack):
+			plan.add(KindStack, stack.Name, ActionUpdate, "the stack file or the environment changed")
+		default:
+			plan.Unchanged++
+		}
+	}
+
+	desiredSchedules := map[string]bool{}
+	var scheduleChanges []Change
+	schedules := append([]ScheduleSpec{}, spec.Schedules...)
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].Name < schedules[j].Name })
+
+	for _, schedule := range schedules {
+		desiredSchedules[schedule.Name] = true
+
+		applied, ok := state.Schedules[schedule.Name]
+		switch {
+		case !ok:
+			scheduleChanges = append(scheduleChanges, Change{Kind: KindSchedule, Name: schedule.Name, Action: ActionCreate})
+		case applied != schedule:
+			scheduleChanges = append(scheduleChanges, Change{Kind: KindSchedule, Name: schedule.Name, Action: ActionUpdate, Reason: "the cron expression or the script changed"})
+		default:
+			plan.Unchanged++
+		}
+	}
+
+	if spec.Prune {
+		var stackDeletions, networkDeletions, volumeDeletions []Change
+
+		for name := range state.Stacks {
+			if !desiredStacks[name] {
+				stackDeletions = append(stackDeletions, Change{Kind: KindStack, Name: name, Action: ActionDelete})
+			}
+		}
+
+		for name, network := range state.Networks {
+			if !desiredNetworks[name] && isManaged(network.Labels) {
+				networkDeletions = append(networkDeletions, Change{Kind: KindNetwork, Name: name, Action: ActionDelete})
+			}
+		}
+
+		for name, volume := range state.Volumes {
+			if !desiredVolumes[name] && isManaged(volume.Labels) {
+				volumeDeletions = append(volumeDeletions, Change{Kind: KindVolume, Name: name, Action: ActionDelete})
+			}
+		}
+
+		var scheduleDeletions []Change
+		for name := range state.Schedules {
+			if !desiredSchedules[name] {
+				scheduleDeletions = append(scheduleDeletions, Change{Kind: KindSchedule, Name: name, Action: ActionDelete})
+			}
+		}
+
+		deletions = append(deletions, sortChanges(stackDeletions)...)
+		deletions = append(deletions, sortChanges(networkDeletions)...)
+		deletions = append(deletions, sortChanges(volumeDeletions)...)
+		scheduleChanges = append(scheduleChanges, sortChanges(scheduleDeletions)...)
+	}
+
+	// The stacks are removed before the networks and volumes they might use
+	plan.Changes = append(plan.Changes, deletions...)
+	plan.Changes = append(plan.Changes, scheduleChanges...)
+
+	return plan
+}
+
+func (plan *Plan) add(kind, name, action, reason string) {
+	plan.Changes = append(plan.Changes, Change{Kind: kind, Name: name, Action: action, Reason: reason})
+}
+
+func isManaged(labels map[string]string) bool {
+	return labels[ManagedLabel] == "true"
+}
+
+func networkMatches(desired, observed NetworkSpec) bool {
+	if desired.Driver != "" && desired.Driver != observed.Driver {
+		return false
+	}
+
+	return desired.Internal == observed.Internal && desired.Attachable == observed.Attachable && labelsMatch(desired.Labels, observed.Labels)
+}
+
+func volumeMatches(desired, observed VolumeSpec) bool {
+	if desired.Driver != "" && desired.Driver != observed.Driver {
+		return false
+	}
+
+	return mapsEqual(desired.DriverOpts, observed.DriverOpts) && labelsMatch(desired.Labels, observed.Labels)
+}
+
+// labelsMatch compares the desired labels to the labels of a managed resource, without the managed label
+func labelsMatch(desired, observed map[string]string) bool {
+	withoutManaged := make(map[string]string, len(observed))
+	for key, value := range observed {
+		if key != ManagedLabel {
+			withoutManaged[key] = value
+		}
+	}
+
+	return mapsEqual(desired, withoutManaged)
+}
+
+func mapsEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for key, value := range a {
+		if other, ok := b[key]; !ok || other != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// stackDigest returns the digest of the stack file and environment of the stack
+func stackDigest(stack StackSpec) string {
+	hash := sha256.New()
+	hash.Write([]byte(stack.StackFileContent))
+	hash.Write([]byte{0})
+	hash.Write([]byte(strings.Join(stack.Env, "\n")))
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func sortChanges(changes []Change) []Change {
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+
+	return changes
+}
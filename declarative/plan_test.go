@@ -0,0 +1,104 @@
+package declarative
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestComputePlan(t *testing.T) {
+	managed := map[string]string{ManagedLabel: "true"}
+
+	web := StackSpec{Name: "web", StackFileContent: "services: {}"}
+
+	state := &State{
+		Stacks: map[string]string{
+			"web": stackDigest(StackSpec{Name: "web", StackFileContent: "services: {}", Env: []string{"A=1"}}),
+			"old": "digest",
+		},
+		Schedules: map[string]ScheduleSpec{
+			"backup": {Name: "backup", CronExpression: "@daily", Script: "backup.sh"},
+		},
+		Networks: map[string]NetworkSpec{
+			"bridge":   {Name: "bridge", Driver: "bridge"},
+			"frontend": {Name: "frontend", Driver: "bridge", Labels: managed},
+			"legacy":   {Name: "legacy", Driver: "bridge", Labels: managed},
+		},
+		Volumes: map[string]VolumeSpec{
+			"data": {Name: "data", Driver: "local", Labels: managed},
+			"logs": {Name: "logs", Driver: "local", Labels: managed},
+		},
+	}
+
+	spec := &Spec{
+		Stacks: []StackSpec{web},
+		Networks: []NetworkSpec{
+			{Name: "frontend", Internal: true},
+			{Name: "bridge"},
+		},
+		Volumes: []VolumeSpec{
+			{Name: "data"},
+			{Name: "cache", Driver: "local"},
+		},
+		Schedules: []ScheduleSpec{
+			{Name: "backup", CronExpression: "@daily", Script: "backup.sh"},
+		},
+		Prune: true,
+	}
+
+	plan := computePlan(spec, state)
+
+	expected := []Change{
+		{Kind: KindNetwork, Name: "bridge", Action: ActionConflict},
+		{Kind: KindNetwork, Name: "frontend", Action: ActionReplace},
+		{Kind: KindVolume, Name: "cache", Action: ActionCreate},
+		{Kind: KindStack, Name: "web", Action: ActionUpdate},
+		{Kind: KindStack, Name: "old", Action: ActionDelete},
+		{Kind: KindNetwork, Name: "legacy", Action: ActionDelete},
+		{Kind: KindVolume, Name: "logs", Action: ActionDelete},
+	}
+
+	actual := make([]Change, 0, len(plan.Changes))
+	for _, change := range plan.Changes {
+		actual = append(actual, Change{Kind: change.Kind, Name: change.Name, Action: change.Action})
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, actual)
+	}
+
+	// The data volume and the backup schedule are unchanged
+	if plan.Unchanged != 2 {
+		t.Fatalf("expected 2 unchanged resources, got %d", plan.Unchanged)
+	}
+
+	spec.Prune = false
+	if plan := computePlan(spec, state); len(plan.Changes) != 4 {
+		t.Fatalf("expected no deletion without prune, got %+v", plan.Changes)
+	}
+}
+
+func TestSpec_Validate(t *testing.T) {
+	invalid := []Spec{
+		{Stacks: []StackSpec{{Name: "Web", StackFileContent: "services: {}"}}},
+		{Stacks: []StackSpec{{Name: "web", StackFileContent: "a"}, {Name: "web", StackFileContent: "b"}}},
+		{Networks: []NetworkSpec{{Name: "-net"}}},
+		{Schedules: []ScheduleSpec{{Name: "job", CronExpression: "* * * *", Script: "true"}}},
+		{Schedules: []ScheduleSpec{{Name: "job", CronExpression: "* * * * *\n* * * * * root id", Script: "true"}}},
+	}
+
+	for _, spec := range invalid {
+		if err := spec.Validate(); err == nil {
+			t.Errorf("expected the spec %+v to be invalid", spec)
+		}
+	}
+
+	valid := Spec{
+		Stacks:    []StackSpec{{Name: "web", StackFileContent: "services: {}"}},
+		Volumes:   []VolumeSpec{{Name: "web_data"}},
+		Schedules: []ScheduleSpec{{Name: "job", CronExpression: "*/5 * * * 1-5", Script: "true"}, {Name: "daily", CronExpression: "@daily", Script: "true"}},
+	}
+
+	if err := valid.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
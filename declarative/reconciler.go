@@ -0,0 +1,384 @@
+package declarative
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/filesystem"
+	"github.com/portainer/agent/stacklock"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/volume"
+)
+
+const (
+	// cronFile is the file of the host holding the schedules of the declarative apply, next to the file of the
+	// Edge schedules
+	cronFile = "/etc/cron.d/portainer_agent_declarative"
+	// scheduleScriptPrefix is the prefix of the names of the scripts of the schedules
+	scheduleScriptPrefix = "declarative_"
+)
+
+// applyMu ensures that a single apply is executed at a time
+var applyMu sync.Mutex
+
+// persistedState represents the resources created by the previous applies, persisted in the data folder
+type persistedState struct {
+	Stacks    map[string]string
+	Schedules map[string]ScheduleSpec
+}
+
+// Reconciler reconciles the host toward a spec
+type Reconciler struct {
+	dataPath string
+	deployer agent.Deployer
+}
+
+// NewReconciler returns a pointer to a Reconciler deploying the stacks with deployer, the stack files and the state
+// of the previous applies are stored in dataPath
+func NewReconciler(dataPath string, deployer agent.Deployer) *Reconciler {
+	return &Reconciler{
+		dataPath: dataPath,
+		deployer: deployer,
+	}
+}
+
+// Plan returns the changes that would be applied to reconcile the host toward spec
+func (reconciler *Reconciler) Plan(ctx context.Context, spec *Spec) (*Plan, error) {
+	state, err := reconciler.observe(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return computePlan(spec, state), nil
+}
+
+// Apply reconciles the host toward spec and returns the applied changes. A failed change is reported in the plan
+// and does not prevent the following changes from being applied.
+func (reconciler *Reconciler) Apply(ctx context.Context, spec *Spec, progress func(message string)) (*Plan, error) {
+	applyMu.Lock()
+	defer applyMu.Unlock()
+
+	state, err := reconciler.observe(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := computePlan(spec, state)
+
+	stacks := map[string]StackSpec{}
+	for _, stack := range spec.Stacks {
+		stacks[stack.Name] = stack
+	}
+
+	networks := map[string]NetworkSpec{}
+	for _, network := range spec.Networks {
+		networks[network.Name] = network
+	}
+
+	volumes := map[string]VolumeSpec{}
+	for _, volume := range spec.Volumes {
+		volumes[volume.Name] = volume
+	}
+
+	scheduleChanged := false
+
+	for i := range plan.Changes {
+		change := &plan.Changes[i]
+		if change.Action == ActionConflict {
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		progress(fmt.Sprintf("%s %s %s", change.Action, change.Kind, change.Name))
+
+		var err error
+
+		switch change.Kind {
+		case KindNetwork:
+			err = reconciler.applyNetwork(ctx, change, networks[change.Name])
+		case KindVolume:
+			err = reconciler.applyVolume(ctx, change, volumes[change.Name])
+		case KindStack:
+			err = reconciler.applyStack(ctx, change, stacks[change.Name], state)
+		case KindSchedule:
+			scheduleChanged = true
+		}
+
+		if err != nil {
+			change.Error = err.Error()
+			plan.Failed++
+		}
+	}
+
+	if scheduleChanged {
+		err := reconciler.writeSchedules(spec, state)
+		if err != nil {
+			for i := range plan.Changes {
+				if plan.Changes[i].Kind == KindSchedule {
+					plan.Changes[i].Error = err.Error()
+					plan.Failed++
+				}
+			}
+		}
+	}
+
+	err = reconciler.saveState(&persistedState{Stacks: state.Stacks, Schedules: state.Schedules})
+	if err != nil {
+		return nil, fmt.Errorf("unable to persist the state of the declarative apply: %w", err)
+	}
+
+	return plan, nil
+}
+
+func (reconciler *Reconciler) applyNetwork(ctx context.Context, change *Change, spec NetworkSpec) error {
+	if change.Action == ActionReplace || change.Action == ActionDelete {
+		if err := docker.NetworkRemove(ctx, change.Name); err != nil {
+			return err
+		}
+	}
+
+	if change.Action == ActionDelete {
+		return nil
+	}
+
+	_, err := docker.NetworkCreate(ctx, spec.Name, types.NetworkCreate{
+		CheckDuplicate: true,
+		Driver:         spec.Driver,
+		Internal:       spec.Internal,
+		Attachable:     spec.Attachable,
+		Labels:         managedLabels(spec.Labels),
+	})
+
+	return err
+}
+
+func (reconciler *Reconciler) applyVolume(ctx context.Context, change *Change, spec VolumeSpec) error {
+	if change.Action == ActionDelete {
+		return docker.VolumeDelete(change.Name, false)
+	}
+
+	return docker.VolumeCreate(ctx, volume.CreateOptions{
+		Name:       spec.Name,
+		Driver:     spec.Driver,
+		DriverOpts: spec.DriverOpts,
+		Labels:     managedLabels(spec.Labels),
+	})
+}
+
+// applyStack deploys or removes the stack and records it in state once done
+func (reconciler *Reconciler) applyStack(ctx context.Context, change *Change, spec StackSpec, state *State) error {
+	release, err := stacklock.Acquire(ctx, change.Name, "apply")
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	stackFolder := filepath.Join(reconciler.dataPath, agent.StacksDirName, change.Name)
+	stackFile := filepath.Join(stackFolder, agent.StackFileName)
+
+	if change.Action == ActionDelete {
+		err := reconciler.deployer.Remove(ctx, change.Name, []string{stackFile}, agent.RemoveOptions{
+			DeployerBaseOptions: agent.DeployerBaseOptions{WorkingDir: stackFolder},
+		})
+		if err != nil {
+			return err
+		}
+
+		delete(state.Stacks, change.Name)
+
+		return os.RemoveAll(stackFolder)
+	}
+
+	err = filesystem.WriteFile(stackFolder, agent.StackFileName, []byte(spec.StackFileContent), 0600)
+	if err != nil {
+		return fmt.Errorf("unable to write the stack file: %w", err)
+	}
+
+	err = reconciler.deployer.Deploy(ctx, spec.Name, []string{stackFile}, agent.DeployOptions{
+		DeployerBaseOptions: agent.DeployerBaseOptions{
+			WorkingDir: stackFolder,
+			Env:        spec.Env,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	state.Stacks[spec.Name] = stackDigest(spec)
+
+	return nil
+}
+
+// writeSchedules writes the scripts of the schedules and replaces the cron file of the host. The schedules of the
+// previous applies missing from the spec are kept unless the spec is pruned.
+func (reconciler *Reconciler) writeSchedules(spec *Spec, state *State) error {
+	schedules := map[string]ScheduleSpec{}
+	if !spec.Prune {
+		for name, schedule := range state.Schedules {
+			schedules[name] = schedule
+		}
+	}
+
+	for _, schedule := range spec.Schedules {
+		schedules[schedule.Name] = schedule
+	}
+
+	scriptFolder := agent.HostRoot + agent.ScheduleScriptDirectory
+
+	for name := range state.Schedules {
+		if _, ok := schedules[name]; !ok {
+			os.Remove(filepath.Join(scriptFolder, scheduleScriptPrefix+name))
+		}
+	}
+
+	names := make([]string, 0, len(schedules))
+	for name := range schedules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := []string{
+		"## This file is managed by the Portainer agent. DO NOT EDIT MANUALLY ALL YOUR CHANGES WILL BE OVERWRITTEN.",
+		"SHELL=/bin/sh",
+		"PATH=/usr/local/sbin:/usr/local/bin:/sbin:/bin:/usr/sbin:/usr/bin",
+		"",
+	}
+
+	for _, name := range names {
+		schedule := schedules[name]
+		scriptName := scheduleScriptPrefix + name
+
+		err := filesystem.WriteFile(scriptFolder, scriptName, []byte(schedule.Script), 0744)
+		if err != nil {
+			return err
+		}
+
+		script := filepath.Join(agent.ScheduleScriptDirectory, scriptName)
+		lines = append(lines, fmt.Sprintf("%s root %s > %s.log 2>&1", schedule.CronExpression, script, script))
+	}
+
+	lines = append(lines, "")
+
+	if len(names) == 0 {
+		err := os.Remove(agent.HostRoot + cronFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	} else {
+		err := filesystem.WriteFile(agent.HostRoot+filepath.Dir(cronFile), filepath.Base(cronFile), []byte(strings.Join(lines, "\n")), 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	state.Schedules = schedules
+
+	return nil
+}
+
+// observe returns the networks and volumes of the host and the resources created by the previous applies
+func (reconciler *Reconciler) observe(ctx context.Context) (*State, error) {
+	persisted, err := reconciler.loadState()
+	if err != nil {
+		return nil, err
+	}
+
+	state := &State{
+		Stacks:    persisted.Stacks,
+		Schedules: persisted.Schedules,
+		Networks:  map[string]NetworkSpec{},
+		Volumes:   map[string]VolumeSpec{},
+	}
+
+	networks, err := docker.NetworkList(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, network := range networks {
+		state.Networks[network.Name] = NetworkSpec{
+			Name:       network.Name,
+			Driver:     network.Driver,
+			Internal:   network.Internal,
+			Attachable: network.Attachable,
+			Labels:     network.Labels,
+		}
+	}
+
+	volumes, err := docker.VolumeList(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, volume := range volumes {
+		state.Volumes[volume.Name] = VolumeSpec{
+			Name:       volume.Name,
+			Driver:     volume.Driver,
+			DriverOpts: volume.Options,
+			Labels:     volume.Labels,
+		}
+	}
+
+	return state, nil
+}
+
+func (reconciler *Reconciler) statePath() string {
+	return filepath.Join(reconciler.dataPath, agent.DeclarativeStateFileName)
+}
+
+func (reconciler *Reconciler) loadState() (*persistedState, error) {
+	state := &persistedState{}
+
+	data, err := os.ReadFile(reconciler.statePath())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if err == nil {
+		if err := json.Unmarshal(data, state); err != nil {
+			return nil, err
+		}
+	}
+
+	if state.Stacks == nil {
+		state.Stacks = map[string]string{}
+	}
+
+	if state.Schedules == nil {
+		state.Schedules = map[string]ScheduleSpec{}
+	}
+
+	return state, nil
+}
+
+func (reconciler *Reconciler) saveState(state *persistedState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return filesystem.WriteFile(reconciler.dataPath, agent.DeclarativeStateFileName, data, 0600)
+}
+
+// managedLabels returns labels with the managed label
+func managedLabels(labels map[string]string) map[string]string {
+	managed := map[string]string{ManagedLabel: "true"}
+	for key, value := range labels {
+		managed[key] = value
+	}
+
+	return managed
+}
@@ -0,0 +1,155 @@
+// Package declarative reconciles the host of the agent toward a declarative specification of its stacks, networks,
+// volumes and schedules, so that the Edge devices can be managed with infrastructure as code tools.
+package declarative
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	nameRegexp         = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	resourceNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+	cronFieldRegexp    = regexp.MustCompile(`^[0-9A-Za-z*/,-]+$`)
+)
+
+var cronMacros = map[string]bool{
+	"@yearly":   true,
+	"@annually": true,
+	"@monthly":  true,
+	"@weekly":   true,
+	"@daily":    true,
+	"@midnight": true,
+	"@hourly":   true,
+	"@reboot":   true,
+}
+
+// Spec represents the desired state of the host
+type Spec struct {
+	Stacks    []StackSpec
+	Networks  []NetworkSpec
+	Volumes   []VolumeSpec
+	Schedules []ScheduleSpec
+	// Prune removes the resources created by a previous apply that are not part of the spec anymore
+	Prune bool
+}
+
+// StackSpec represents a Compose stack, or a Swarm stack when the node is a Swarm manager
+type StackSpec struct {
+	Name             string
+	StackFileContent string
+	// Env contains KEY=value entries used for the variable substitution in the stack file
+	Env []string
+}
+
+// NetworkSpec represents a Docker network
+type NetworkSpec struct {
+	Name       string
+	Driver     string
+	Internal   bool
+	Attachable bool
+	Labels     map[string]string
+}
+
+// VolumeSpec represents a Docker volume
+type VolumeSpec struct {
+	Name       string
+	Driver     string
+	DriverOpts map[string]string
+	Labels     map[string]string
+}
+
+// ScheduleSpec represents a script executed by the cron daemon of the host
+type ScheduleSpec struct {
+	Name           string
+	CronExpression string
+	Script         string
+}
+
+// Validate checks the names of the resources, which must be unique per kind, and the cron expressions
+func (spec *Spec) Validate() error {
+	stacks := map[string]bool{}
+	for _, stack := range spec.Stacks {
+		if !nameRegexp.MatchString(stack.Name) {
+			return fmt.Errorf("invalid stack name %q", stack.Name)
+		}
+
+		if stack.StackFileContent == "" {
+			return fmt.Errorf("missing stack file content for the stack %s", stack.Name)
+		}
+
+		if stacks[stack.Name] {
+			return fmt.Errorf("duplicate stack %s", stack.Name)
+		}
+		stacks[stack.Name] = true
+	}
+
+	networks := map[string]bool{}
+	for _, network := range spec.Networks {
+		if !resourceNameRegexp.MatchString(network.Name) {
+			return fmt.Errorf("invalid network name %q", network.Name)
+		}
+
+		if networks[network.Name] {
+			return fmt.Errorf("duplicate network %s", network.Name)
+		}
+		networks[network.Name] = true
+	}
+
+	volumes := map[string]bool{}
+	for _, volume := range spec.Volumes {
+		if !resourceNameRegexp.MatchString(volume.Name) {
+			return fmt.Errorf("invalid volume name %q", volume.Name)
+		}
+
+		if volumes[volume.Name] {
+			return fmt.Errorf("duplicate volume %s", volume.Name)
+		}
+		volumes[volume.Name] = true
+	}
+
+	schedules := map[string]bool{}
+	for _, schedule := range spec.Schedules {
+		if !nameRegexp.MatchString(schedule.Name) {
+			return fmt.Errorf("invalid schedule name %q", schedule.Name)
+		}
+
+		if err := validateCronExpression(schedule.CronExpression); err != nil {
+			return fmt.Errorf("invalid cron expression for the schedule %s: %w", schedule.Name, err)
+		}
+
+		if schedule.Script == "" {
+			return fmt.Errorf("missing script for the schedule %s", schedule.Name)
+		}
+
+		if schedules[schedule.Name] {
+			return fmt.Errorf("duplicate schedule %s", schedule.Name)
+		}
+		schedules[schedule.Name] = true
+	}
+
+	return nil
+}
+
+// validateCronExpression checks the format of the expression, which is written as is in the cron file of the host
+func validateCronExpression(expression string) error {
+	fields := strings.Fields(expression)
+
+	if len(fields) == 1 && cronMacros[fields[0]] {
+		return nil
+	}
+
+	if len(fields) != 5 {
+		return errors.New("expected 5 fields or a macro such as @daily")
+	}
+
+	for _, field := range fields {
+		if !cronFieldRegexp.MatchString(field) {
+			return fmt.Errorf("invalid field %q", field)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,277 @@
+// Package discovery discovers the devices of the local network of the host through mDNS (DNS-SD) and SSDP (UPnP),
+// and reports a summarized inventory of them in the snapshots, which is useful for the gateways managing the
+// neighboring IoT equipment. The multicast groups of the local network are only reachable when the agent runs on the
+// host network.
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Protocols the devices are discovered with
+const (
+	ProtocolMDNS = "mdns"
+	ProtocolSSDP = "ssdp"
+)
+
+const (
+	// scanInterval is the duration during which the inventory is reused, the devices are given a few seconds to
+	// answer each scan
+	scanInterval = 10 * time.Minute
+	// retention is the duration after which a device that did not answer the scans is no longer reported
+	retention = time.Hour
+	// maxDevices bounds the number of devices reported, the most recently seen ones are kept
+	maxDevices = 200
+	// listenDuration is the duration during which the answers to a query are collected
+	listenDuration = 2 * time.Second
+)
+
+var (
+	defaultService   *Service
+	defaultServiceMu sync.Mutex
+)
+
+// Device is a device of the local network that answered the discovery queries
+type Device struct {
+	IPAddress string `json:"IPAddress"`
+	Hostname  string `json:"Hostname,omitempty"`
+	// Name is the instance name advertised with mDNS or the friendly name of the UPnP description
+	Name         string `json:"Name,omitempty"`
+	Manufacturer string `json:"Manufacturer,omitempty"`
+	Model        string `json:"Model,omitempty"`
+	// Services are the DNS-SD service types (e.g. _ipp._tcp) and the UPnP device types advertised by the device
+	Services  []string  `json:"Services"`
+	Protocols []string  `json:"Protocols"`
+	FirstSeen time.Time `json:"FirstSeen"`
+	LastSeen  time.Time `json:"LastSeen"`
+}
+
+// Report is the inventory of the devices of the local network reported in the snapshots
+type Report struct {
+	// Devices are the devices seen during the last hour, most recently seen first
+	Devices []Device `json:"Devices"`
+	// Total is the number of devices seen during the last hour, including the ones left out of Devices
+	Total     int       `json:"Total"`
+	ScannedAt time.Time `json:"ScannedAt"`
+	// Error is the failure of the last scan, e.g. when the multicast groups cannot be joined
+	Error string `json:"Error,omitempty"`
+}
+
+// scanner sends the discovery queries of a protocol and returns the devices that answered
+type scanner func(ctx context.Context) ([]Device, error)
+
+// Service discovers the devices of the local network at most once every ten minutes
+type Service struct {
+	scanners []scanner
+
+	mu      sync.Mutex
+	devices map[string]*Device
+	report  *Report
+}
+
+// NewService returns a pointer to a Service discovering the devices with mDNS and SSDP
+func NewService() *Service {
+	return &Service{
+		scanners: []scanner{scanMDNS, scanSSDP},
+		devices:  map[string]*Device{},
+	}
+}
+
+// Enable makes service the service reporting the devices of the local network in the snapshots
+func Enable(service *Service) {
+	defaultServiceMu.Lock()
+	defer defaultServiceMu.Unlock()
+
+	defaultService = service
+}
+
+// CurrentStatus returns the inventory of the devices of the local network, nil when the discovery is not enabled
+func CurrentStatus(ctx context.Context) *Report {
+	defaultServiceMu.Lock()
+	service := defaultService
+	defaultServiceMu.Unlock()
+
+	if service == nil {
+		return nil
+	}
+
+	return service.Status(ctx)
+}
+
+// Status returns the inventory of the devices seen during the last hour. The protocols are scanned in parallel, at
+// most once every ten minutes.
+func (service *Service) Status(ctx context.Context) *Report {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	if service.report != nil && time.Since(service.report.ScannedAt) < scanInterval {
+		return service.report
+	}
+
+	results := make([][]Device, len(service.scanners))
+	errs := make([]error, len(service.scanners))
+
+	var wg sync.WaitGroup
+	for i, scan := range service.scanners {
+		wg.Add(1)
+
+		go func(i int, scan scanner) {
+			defer wg.Done()
+
+			results[i], errs[i] = scan(ctx)
+		}(i, scan)
+	}
+	wg.Wait()
+
+	now := time.Now().UTC()
+
+	var messages []string
+	for i := range service.scanners {
+		if errs[i] != nil {
+			messages = append(messages, errs[i].Error())
+		}
+
+		service.record(results[i], now)
+	}
+
+	service.report = service.deviceReport(now)
+	service.report.Error = strings.Join(messages, "; ")
+
+	return service.report
+}
+
+// Diagnostics returns a diagnostic message when the last scan failed
+func (report *Report) Diagnostics() []string {
+	if report == nil || report.Error == "" {
+		return nil
+	}
+
+	return []string{fmt.Sprintf("the devices of the local network cannot be discovered: %s", report.Error)}
+}
+
+// record merges the devices found by a scan with the devices already seen
+func (service *Service) record(devices []Device, now time.Time) {
+	for _, device := range devices {
+		known, ok := service.devices[device.IPAddress]
+		if !ok {
+			known = &Device{IPAddress: device.IPAddress, FirstSeen: now}
+			service.devices[device.IPAddress] = known
+		}
+
+		mergeDevice(known, device)
+		known.LastSeen = now
+	}
+}
+
+// deviceReport forgets the devices that were not seen during the retention and returns the most recent ones
+func (service *Service) deviceReport(now time.Time) *Report {
+	devices := []Device{}
+	for address, device := range service.devices {
+		if now.Sub(device.LastSeen) > retention {
+			delete(service.devices, address)
+
+			continue
+		}
+
+		devices = append(devices, *device)
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		if !devices[i].LastSeen.Equal(devices[j].LastSeen) {
+			return devices[i].LastSeen.After(devices[j].LastSeen)
+		}
+
+		return compareAddresses(devices[i].IPAddress, devices[j].IPAddress)
+	})
+
+	report := &Report{Total: len(devices), ScannedAt: now}
+	if len(devices) > maxDevices {
+		devices = devices[:maxDevices]
+	}
+	report.Devices = devices
+
+	return report
+}
+
+// mergeDevice adds the information of src to dst, the most recent names and models take precedence
+func mergeDevice(dst *Device, src Device) {
+	for _, field := range []struct {
+		dst *string
+		src string
+	}{
+		{&dst.Hostname, src.Hostname},
+		{&dst.Name, src.Name},
+		{&dst.Manufacturer, src.Manufacturer},
+		{&dst.Model, src.Model},
+	} {
+		if field.src != "" {
+			*field.dst = field.src
+		}
+	}
+
+	dst.Services = union(dst.Services, src.Services)
+	dst.Protocols = union(dst.Protocols, src.Protocols)
+}
+
+// union returns the sorted union of a and b
+func union(a, b []string) []string {
+	set := make(map[string]bool, len(a)+len(b))
+	for _, s := range append(append([]string{}, a...), b...) {
+		set[s] = true
+	}
+
+	values := make([]string, 0, len(set))
+	for s := range set {
+		values = append(values, s)
+	}
+	sort.Strings(values)
+
+	return values
+}
+
+// compareAddresses orders the IPv4 addresses numerically and before the IPv6 addresses
+func compareAddresses(a, b string) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA == nil || ipB == nil {
+		return a < b
+	}
+
+	if (ipA.To4() == nil) != (ipB.To4() == nil) {
+		return ipA.To4() != nil
+	}
+
+	return string(ipA.To16()) < string(ipB.To16())
+}
+
+// collect reads the answers received on conn until the listen duration elapses or ctx is done, handle is called
+// with each answer and the address of its sender
+func collect(ctx context.Context, conn *net.UDPConn, handle func(packet []byte, from net.IP)) error {
+	deadline := time.Now().Add(listenDuration)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return err
+	}
+
+	buffer := make([]byte, 9000)
+	for {
+		n, from, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return nil
+			}
+
+			return err
+		}
+
+		handle(buffer[:n], from.IP)
+	}
+}
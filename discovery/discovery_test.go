@@ -0,0 +1,196 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func mdnsResponse(t *testing.T, resources ...dnsmessage.Resource) []byte {
+	t.Helper()
+
+	message := dnsmessage.Message{
+		Header:  dnsmessage.Header{Response: true, Authoritative: true},
+		Answers: resources,
+	}
+
+	packet, err := message.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return packet
+}
+
+func resourceHeader(name string) dnsmessage.ResourceHeader {
+	return dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Class: dnsmessage.ClassINET, TTL: 120}
+}
+
+func TestMDNSRecordsDevices(t *testing.T) {
+	records := newMDNSRecords()
+	sender := net.ParseIP("192.168.1.30")
+
+	records.add(mdnsResponse(t,
+		dnsmessage.Resource{Header: resourceHeader(servicesEnumeration), Body: &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName("_ipp._tcp.local.")}},
+		dnsmessage.Resource{Header: resourceHeader(servicesEnumeration), Body: &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName("_http._tcp.local.")}},
+	), sender)
+
+	records.add(mdnsResponse(t,
+		dnsmessage.Resource{Header: resourceHeader("_ipp._tcp.local."), Body: &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName("Office Printer._ipp._tcp.local.")}},
+		dnsmessage.Resource{Header: resourceHeader("Office Printer._ipp._tcp.local."), Body: &dnsmessage.SRVResource{Target: dnsmessage.MustNewName("printer-3.local."), Port: 631}},
+		dnsmessage.Resource{Header: resourceHeader("Office Printer._ipp._tcp.local."), Body: &dnsmessage.TXTResource{TXT: []string{"txtvers=1", "usb_MFG=Brother", "ty=Brother HL-L2350DW"}}},
+		dnsmessage.Resource{Header: resourceHeader("printer-3.local."), Body: &dnsmessage.AResource{A: [4]byte{192, 168, 1, 30}}},
+		dnsmessage.Resource{Header: resourceHeader("_http._tcp.local."), Body: &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName("Office Printer._http._tcp.local.")}},
+		dnsmessage.Resource{Header: resourceHeader("Office Printer._http._tcp.local."), Body: &dnsmessage.SRVResource{Target: dnsmessage.MustNewName("printer-3.local."), Port: 80}},
+	), sender)
+
+	// a device answering without address record is reported with the address of the sender
+	records.add(mdnsResponse(t,
+		dnsmessage.Resource{Header: resourceHeader("_http._tcp.local."), Body: &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName("plc-7._http._tcp.local.")}},
+	), net.ParseIP("192.168.1.7"))
+
+	// the queries are ignored
+	records.add(mustPackQuery(t), net.ParseIP("192.168.1.99"))
+
+	devices := records.devices()
+	if len(devices) != 2 {
+		t.Fatalf("expected 2 devices, got %+v", devices)
+	}
+
+	byAddress := map[string]Device{}
+	for _, device := range devices {
+		byAddress[device.IPAddress] = device
+	}
+
+	printer := byAddress["192.168.1.30"]
+	expected := Device{
+		IPAddress:    "192.168.1.30",
+		Hostname:     "printer-3",
+		Name:         "Office Printer",
+		Manufacturer: "Brother",
+		Model:        "Brother HL-L2350DW",
+		Services:     []string{"_http._tcp", "_ipp._tcp"},
+		Protocols:    []string{ProtocolMDNS},
+	}
+	if !reflect.DeepEqual(printer, expected) {
+		t.Errorf("expected %+v, got %+v", expected, printer)
+	}
+
+	if plc := byAddress["192.168.1.7"]; plc.Name != "plc-7" || !reflect.DeepEqual(plc.Services, []string{"_http._tcp"}) {
+		t.Errorf("unexpected device without address record: %+v", plc)
+	}
+}
+
+func mustPackQuery(t *testing.T) []byte {
+	t.Helper()
+
+	query, err := mdnsQueryMessage([]string{"_http._tcp.local."})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return query
+}
+
+func TestParseSearchResponse(t *testing.T) {
+	packet := []byte("HTTP/1.1 200 OK\r\nCACHE-CONTROL: max-age=1800\r\nLOCATION: http://192.168.1.40:49152/description.xml\r\nST: urn:schemas-upnp-org:device:MediaRenderer:1\r\nUSN: uuid:1234::urn:schemas-upnp-org:device:MediaRenderer:1\r\n\r\n")
+
+	searchType, location, ok := parseSearchResponse(packet)
+	if !ok || searchType != "urn:schemas-upnp-org:device:MediaRenderer:1" || location != "http://192.168.1.40:49152/description.xml" {
+		t.Errorf("unexpected response: %q %q %v", searchType, location, ok)
+	}
+
+	if _, _, ok := parseSearchResponse([]byte("M-SEARCH * HTTP/1.1\r\n\r\n")); ok {
+		t.Error("expected the searches of the other hosts to be ignored")
+	}
+}
+
+func TestUPnPDeviceType(t *testing.T) {
+	for urn, expected := range map[string]string{
+		"urn:schemas-upnp-org:device:MediaRenderer:1":     "upnp:MediaRenderer",
+		"urn:dial-multiscreen-org:device:dial:1":          "dial-multiscreen-org:dial",
+		"urn:schemas-upnp-org:service:ContentDirectory:1": "",
+		"upnp:rootdevice": "",
+		"uuid:4d696e69-444c-164e-9d41-b827eb2d8e0a": "",
+	} {
+		deviceType, ok := upnpDeviceType(urn)
+		if deviceType != expected || ok != (expected != "") {
+			t.Errorf("%s: expected %q, got %q", urn, expected, deviceType)
+		}
+	}
+}
+
+func TestFetchDescription(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:Basic:1</deviceType>
+    <friendlyName>Line 2 HMI</friendlyName>
+    <manufacturer>Siemens</manufacturer>
+    <modelName>SIMATIC HMI</modelName>
+  </device>
+</root>`))
+	}))
+	defer server.Close()
+
+	if !sameHost(server.URL, net.ParseIP("127.0.0.1")) || sameHost(server.URL, net.ParseIP("192.168.1.40")) {
+		t.Error("expected the description to be served by the device that answered the search only")
+	}
+
+	description, err := fetchDescription(context.Background(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if description.Device.FriendlyName != "Line 2 HMI" || description.Device.Manufacturer != "Siemens" || description.Device.ModelName != "SIMATIC HMI" {
+		t.Errorf("unexpected description: %+v", description)
+	}
+}
+
+func TestServiceStatus(t *testing.T) {
+	scans := 0
+	service := &Service{
+		scanners: []scanner{
+			func(ctx context.Context) ([]Device, error) {
+				scans++
+
+				return []Device{{IPAddress: "192.168.1.30", Name: "Office Printer", Services: []string{"_ipp._tcp"}, Protocols: []string{ProtocolMDNS}}}, nil
+			},
+			func(ctx context.Context) ([]Device, error) {
+				return []Device{{IPAddress: "192.168.1.30", Model: "HL-L2350DW", Services: []string{"upnp:Printer"}, Protocols: []string{ProtocolSSDP}}}, errors.New("SSDP: network is unreachable")
+			},
+		},
+		devices: map[string]*Device{
+			"192.168.1.99": {IPAddress: "192.168.1.99", LastSeen: time.Now().Add(-2 * retention)},
+		},
+	}
+
+	report := service.Status(context.Background())
+	if report.Total != 1 || len(report.Devices) != 1 {
+		t.Fatalf("expected the device not seen during the retention to be forgotten, got %+v", report)
+	}
+
+	device := report.Devices[0]
+	if device.Name != "Office Printer" || device.Model != "HL-L2350DW" ||
+		!reflect.DeepEqual(device.Services, []string{"_ipp._tcp", "upnp:Printer"}) ||
+		!reflect.DeepEqual(device.Protocols, []string{ProtocolMDNS, ProtocolSSDP}) {
+		t.Errorf("expected the answers of both protocols to be merged, got %+v", device)
+	}
+
+	if len(report.Diagnostics()) != 1 {
+		t.Errorf("expected a diagnostic for the failed scan, got %v", report.Diagnostics())
+	}
+
+	service.Status(context.Background())
+	if scans != 1 {
+		t.Errorf("expected the inventory to be reused during the scan interval, got %d scans", scans)
+	}
+}
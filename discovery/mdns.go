@@ -0,0 +1,199 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// servicesEnumeration is the DNS-SD meta-query listing the service types advertised on the local network
+const servicesEnumeration = "_services._dns-sd._udp.local."
+
+var mdnsAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// mdnsRecords are the records received from the devices, by name
+type mdnsRecords struct {
+	ptr   map[string][]string
+	srv   map[string]string
+	addrs map[string][]string
+	txt   map[string][]string
+	// senders are the addresses of the devices that sent the records of an instance, used when the instance has no
+	// address record
+	senders map[string]string
+}
+
+func newMDNSRecords() *mdnsRecords {
+	return &mdnsRecords{
+		ptr:     map[string][]string{},
+		srv:     map[string]string{},
+		addrs:   map[string][]string{},
+		txt:     map[string][]string{},
+		senders: map[string]string{},
+	}
+}
+
+// scanMDNS enumerates the service types advertised on the local network, then their instances. The queries are sent
+// from an ephemeral port, the devices answer them with unicast responses (legacy unicast queries of RFC 6762), so
+// the agent does not compete for the port 5353 with the mDNS responder of the host.
+func scanMDNS(ctx context.Context) ([]Device, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, fmt.Errorf("mDNS: %w", err)
+	}
+	defer conn.Close()
+
+	records := newMDNSRecords()
+
+	if err := mdnsQuery(ctx, conn, []string{servicesEnumeration}, records); err != nil {
+		return nil, fmt.Errorf("mDNS: %w", err)
+	}
+
+	if serviceTypes := records.ptr[servicesEnumeration]; len(serviceTypes) > 0 {
+		if err := mdnsQuery(ctx, conn, serviceTypes, records); err != nil {
+			return nil, fmt.Errorf("mDNS: %w", err)
+		}
+	}
+
+	return records.devices(), nil
+}
+
+// mdnsQuery sends a PTR query for names and adds the records of the answers to records
+func mdnsQuery(ctx context.Context, conn *net.UDPConn, names []string, records *mdnsRecords) error {
+	query, err := mdnsQueryMessage(names)
+	if err != nil {
+		return err
+	}
+
+	if _, err := conn.WriteToUDP(query, mdnsAddr); err != nil {
+		return err
+	}
+
+	return collect(ctx, conn, func(packet []byte, from net.IP) {
+		records.add(packet, from)
+	})
+}
+
+func mdnsQueryMessage(names []string) ([]byte, error) {
+	message := dnsmessage.Message{}
+	for _, name := range names {
+		dnsName, err := dnsmessage.NewName(name)
+		if err != nil {
+			return nil, err
+		}
+
+		message.Questions = append(message.Questions, dnsmessage.Question{
+			Name:  dnsName,
+			Type:  dnsmessage.TypePTR,
+			Class: dnsmessage.ClassINET,
+		})
+	}
+
+	return message.Pack()
+}
+
+// add parses an mDNS response and records its answers and additional records, the invalid packets are ignored
+func (records *mdnsRecords) add(packet []byte, from net.IP) {
+	var message dnsmessage.Message
+	if err := message.Unpack(packet); err != nil || !message.Header.Response {
+		return
+	}
+
+	for _, resource := range append(message.Answers, message.Additionals...) {
+		name := strings.ToLower(resource.Header.Name.String())
+
+		switch body := resource.Body.(type) {
+		case *dnsmessage.PTRResource:
+			target := body.PTR.String()
+			if !slices.Contains(records.ptr[name], target) {
+				records.ptr[name] = append(records.ptr[name], target)
+			}
+
+			if name != servicesEnumeration {
+				records.senders[strings.ToLower(target)] = from.String()
+			}
+		case *dnsmessage.SRVResource:
+			records.srv[name] = strings.ToLower(body.Target.String())
+		case *dnsmessage.AResource:
+			records.addAddress(name, net.IP(body.A[:]).String())
+		case *dnsmessage.AAAAResource:
+			ip := net.IP(body.AAAA[:])
+			// the link-local addresses are not reachable without their zone
+			if !ip.IsLinkLocalUnicast() {
+				records.addAddress(name, ip.String())
+			}
+		case *dnsmessage.TXTResource:
+			records.txt[name] = body.TXT
+		}
+	}
+}
+
+func (records *mdnsRecords) addAddress(name, address string) {
+	if !slices.Contains(records.addrs[name], address) {
+		records.addrs[name] = append(records.addrs[name], address)
+	}
+}
+
+// devices returns the devices advertising the instances of the service types, by address
+func (records *mdnsRecords) devices() []Device {
+	devices := map[string]*Device{}
+
+	for _, serviceType := range records.ptr[servicesEnumeration] {
+		serviceType = strings.ToLower(serviceType)
+
+		for _, instance := range records.ptr[serviceType] {
+			instanceKey := strings.ToLower(instance)
+			host := records.srv[instanceKey]
+
+			addresses := records.addrs[host]
+			if len(addresses) == 0 && records.senders[instanceKey] != "" {
+				addresses = []string{records.senders[instanceKey]}
+			}
+
+			for _, address := range addresses {
+				device, ok := devices[address]
+				if !ok {
+					device = &Device{IPAddress: address, Protocols: []string{ProtocolMDNS}}
+					devices[address] = device
+				}
+
+				mergeDevice(device, Device{
+					Hostname: strings.TrimSuffix(host, ".local."),
+					Name:     strings.TrimSuffix(strings.TrimSuffix(instance, serviceType), "."),
+					Services: []string{strings.TrimSuffix(serviceType, ".local.")},
+				})
+				applyTXT(device, records.txt[instanceKey])
+			}
+		}
+	}
+
+	list := make([]Device, 0, len(devices))
+	for _, device := range devices {
+		list = append(list, *device)
+	}
+
+	return list
+}
+
+// applyTXT sets the manufacturer and the model of the device from the usual keys of the TXT records of the
+// printers (usb_MFG, usb_MDL, ty), the Apple devices (model, md) and the other devices (manufacturer, vendor)
+func applyTXT(device *Device, txt []string) {
+	for _, entry := range txt {
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok || value == "" {
+			continue
+		}
+
+		switch strings.ToLower(key) {
+		case "usb_mfg", "manufacturer", "vendor", "mfg":
+			device.Manufacturer = value
+		case "usb_mdl", "ty", "md", "model":
+			if device.Model == "" || strings.ToLower(key) == "ty" {
+				device.Model = value
+			}
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package discovery
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ssdpSearch asks all the UPnP devices to answer within one second
+	ssdpSearch = "M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nMAN: \"ssdp:discover\"\r\nMX: 1\r\nST: ssdp:all\r\n\r\n"
+	// maxDescriptionSize bounds the size of the description documents read from the devices
+	maxDescriptionSize = 64 * 1024
+	// descriptionTimeout is the maximum duration of the download of a description document
+	descriptionTimeout = 2 * time.Second
+	// maxDescriptionFetches is the number of description documents downloaded at the same time
+	maxDescriptionFetches = 8
+)
+
+var ssdpAddr = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900}
+
+var descriptionClient = &http.Client{
+	Timeout: descriptionTimeout,
+	// the description must be served by the device that answered the search
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// ssdpDevice is a device that answered the search, with the location of its description document
+type ssdpDevice struct {
+	Device
+	location string
+}
+
+// upnpDescription is the part of the UPnP description document of a device reported in the inventory
+type upnpDescription struct {
+	Device struct {
+		DeviceType   string `xml:"deviceType"`
+		FriendlyName string `xml:"friendlyName"`
+		Manufacturer string `xml:"manufacturer"`
+		ModelName    string `xml:"modelName"`
+	} `xml:"device"`
+}
+
+// scanSSDP searches the UPnP devices of the local network and reads their description documents
+func scanSSDP(ctx context.Context) ([]Device, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, fmt.Errorf("SSDP: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.WriteToUDP([]byte(ssdpSearch), ssdpAddr); err != nil {
+		return nil, fmt.Errorf("SSDP: %w", err)
+	}
+
+	found := map[string]*ssdpDevice{}
+
+	err = collect(ctx, conn, func(packet []byte, from net.IP) {
+		searchType, location, ok := parseSearchResponse(packet)
+		if !ok {
+			return
+		}
+
+		address := from.String()
+
+		device, ok := found[address]
+		if !ok {
+			device = &ssdpDevice{Device: Device{IPAddress: address, Protocols: []string{ProtocolSSDP}}}
+			found[address] = device
+		}
+
+		if deviceType, ok := upnpDeviceType(searchType); ok {
+			device.Services = union(device.Services, []string{deviceType})
+		}
+
+		if device.location == "" && sameHost(location, from) {
+			device.location = location
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("SSDP: %w", err)
+	}
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, maxDescriptionFetches)
+
+	for _, device := range found {
+		if device.location == "" {
+			continue
+		}
+
+		wg.Add(1)
+
+		go func(device *ssdpDevice) {
+			defer wg.Done()
+
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			description, err := fetchDescription(ctx, device.location)
+			if err != nil {
+				return
+			}
+
+			mergeDevice(&device.Device, Device{
+				Name:         description.Device.FriendlyName,
+				Manufacturer: description.Device.Manufacturer,
+				Model:        description.Device.ModelName,
+			})
+
+			if deviceType, ok := upnpDeviceType(description.Device.DeviceType); ok {
+				device.Services = union(device.Services, []string{deviceType})
+			}
+		}(device)
+	}
+	wg.Wait()
+
+	devices := make([]Device, 0, len(found))
+	for _, device := range found {
+		devices = append(devices, device.Device)
+	}
+
+	return devices, nil
+}
+
+// parseSearchResponse returns the search target and the location of the description document of an answer to the
+// search
+func parseSearchResponse(packet []byte) (string, string, bool) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(packet)), nil)
+	if err != nil {
+		return "", "", false
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", "", false
+	}
+
+	return resp.Header.Get("ST"), resp.Header.Get("Location"), true
+}
+
+// upnpDeviceType returns the type of device of a search target or a device type, e.g. upnp:MediaRenderer for
+// urn:schemas-upnp-org:device:MediaRenderer:1. The services, the root devices and the UUIDs are not device types.
+func upnpDeviceType(urn string) (string, bool) {
+	parts := strings.Split(urn, ":")
+	if len(parts) != 5 || parts[0] != "urn" || parts[2] != "device" || parts[3] == "" {
+		return "", false
+	}
+
+	if parts[1] == "schemas-upnp-org" {
+		return "upnp:" + parts[3], true
+	}
+
+	return parts[1] + ":" + parts[3], true
+}
+
+// sameHost returns true when the description document is served over HTTP by the device that answered the search
+func sameHost(location string, from net.IP) bool {
+	u, err := url.Parse(location)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+
+	ip := net.ParseIP(u.Hostname())
+
+	return ip != nil && ip.Equal(from)
+}
+
+func fetchDescription(ctx context.Context, location string) (*upnpDescription, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := descriptionClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var description upnpDescription
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, maxDescriptionSize)).Decode(&description); err != nil {
+		return nil, err
+	}
+
+	return &description, nil
+}
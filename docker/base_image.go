@@ -0,0 +1,282 @@
+package docker
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// imageLicensesLabel is the OCI annotation listing the licenses of the software packaged in an image
+	imageLicensesLabel = "org.opencontainers.image.licenses"
+	// eolWarningPeriod is the period before the end of life of a distribution during which its images are reported
+	eolWarningPeriod = 180 * 24 * time.Hour
+	// maxOSReleaseSize is the maximum size of an os-release file read from an image
+	maxOSReleaseSize = 64 * 1024
+)
+
+// osReleasePaths are the locations of the os-release file, /etc/os-release is usually a link to the second one
+var osReleasePaths = []string{"/etc/os-release", "/usr/lib/os-release"}
+
+// distributionEOL are the end of life dates of the distributions, by ID and VERSION_ID of their os-release file.
+// The dates are the end of the standard or the free long term support.
+var distributionEOL = map[string]map[string]string{
+	"debian": {"7": "2018-05-31", "8": "2020-06-30", "9": "2022-06-30", "10": "2024-06-30", "11": "2026-08-31", "12": "2028-06-30"},
+	"ubuntu": {"14.04": "2019-04-30", "16.04": "2021-04-30", "18.04": "2023-05-31", "20.04": "2025-05-31", "22.04": "2027-06-01", "24.04": "2029-05-31"},
+	"centos": {"6": "2020-11-30", "7": "2024-06-30", "8": "2021-12-31"},
+	"rhel":   {"6": "2020-11-30", "7": "2024-06-30", "8": "2029-05-31", "9": "2032-05-31"},
+	"amzn":   {"2018.03": "2023-12-31", "2": "2026-06-30"},
+	"alpine": {
+		"3.12": "2022-05-01", "3.13": "2022-11-01", "3.14": "2023-05-01", "3.15": "2023-11-01", "3.16": "2024-05-23",
+		"3.17": "2024-11-22", "3.18": "2025-05-09", "3.19": "2025-11-01", "3.20": "2026-04-01", "3.21": "2026-11-01",
+		"3.22": "2027-05-01",
+	},
+}
+
+// oldestSupportedAlpine is the oldest minor release of Alpine listed in distributionEOL, the older ones are EOL
+const oldestSupportedAlpine = 12
+
+// BaseImage represents the distribution an image is based on and its licenses
+type BaseImage struct {
+	ImageID string `json:"ImageId"`
+	// Image is a reference of the image, its first tag when it has one
+	Image        string `json:"Image"`
+	Distribution string `json:"Distribution,omitempty"`
+	Version      string `json:"Version,omitempty"`
+	PrettyName   string `json:"PrettyName,omitempty"`
+	// EOLDate is the end of life date of the distribution, empty when unknown
+	EOLDate string `json:"EOLDate,omitempty"`
+	EOL     bool   `json:"EOL"`
+	// EOLSoon is true when the distribution reaches its end of life within 180 days
+	EOLSoon  bool   `json:"EOLSoon"`
+	Licenses string `json:"Licenses,omitempty"`
+}
+
+// baseImages caches the distribution of each image, the images are immutable so they are analyzed once
+var baseImages = struct {
+	mu     sync.Mutex
+	images map[string]BaseImage
+}{images: map[string]BaseImage{}}
+
+// GetBaseImages returns the distribution of the local images, read from their os-release file, and flags the ones
+// based on a distribution that reached or approaches its end of life. The file is copied from a container created
+// from the image and never started.
+func GetBaseImages(ctx context.Context) ([]BaseImage, error) {
+	var report []BaseImage
+
+	err := withCli(func(cli *client.Client) error {
+		images, err := cli.ImageList(ctx, types.ImageListOptions{})
+		if err != nil {
+			return err
+		}
+
+		present := make(map[string]bool, len(images))
+		now := time.Now()
+
+		for _, image := range images {
+			present[image.ID] = true
+
+			baseImages.mu.Lock()
+			base, ok := baseImages.images[image.ID]
+			baseImages.mu.Unlock()
+
+			if !ok {
+				base = BaseImage{
+					ImageID:  image.ID,
+					Image:    scanReference(image.ID, image.RepoTags, image.RepoDigests),
+					Licenses: image.Labels[imageLicensesLabel],
+				}
+
+				osRelease, err := readImageOSRelease(ctx, cli, image.ID)
+				if err != nil {
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+
+					log.Debug().Str("image", base.Image).Err(err).Msg("unable to read the os-release file of the image")
+				}
+
+				base.Distribution = osRelease["ID"]
+				base.Version = osRelease["VERSION_ID"]
+				base.PrettyName = osRelease["PRETTY_NAME"]
+
+				baseImages.mu.Lock()
+				baseImages.images[image.ID] = base
+				baseImages.mu.Unlock()
+			}
+
+			base.EOLDate, base.EOL, base.EOLSoon = distributionEndOfLife(base.Distribution, base.Version, now)
+
+			if base.Distribution != "" || base.Licenses != "" {
+				report = append(report, base)
+			}
+		}
+
+		// The removed images are forgotten
+		baseImages.mu.Lock()
+		for id := range baseImages.images {
+			if !present[id] {
+				delete(baseImages.images, id)
+			}
+		}
+		baseImages.mu.Unlock()
+
+		return nil
+	})
+
+	sort.Slice(report, func(i, j int) bool { return report[i].Image < report[j].Image })
+
+	return report, err
+}
+
+// BaseImageDiagnostics returns a diagnostic message for each image based on a distribution that reached or
+// approaches its end of life
+func BaseImageDiagnostics(images []BaseImage) []string {
+	var diagnostics []string
+	for _, image := range images {
+		switch {
+		case image.EOL:
+			diagnostics = append(diagnostics, fmt.Sprintf("end of life base image: %s is based on %s, unsupported since %s", image.Image, image.PrettyName, image.EOLDate))
+		case image.EOLSoon:
+			diagnostics = append(diagnostics, fmt.Sprintf("base image nearing end of life: %s is based on %s, unsupported from %s", image.Image, image.PrettyName, image.EOLDate))
+		}
+	}
+
+	return diagnostics
+}
+
+// distributionEndOfLife returns the end of life date of the distribution and whether it is reached or reached within
+// the warning period
+func distributionEndOfLife(distribution, version string, now time.Time) (date string, eol bool, soon bool) {
+	versions, ok := distributionEOL[distribution]
+	if !ok {
+		return "", false, false
+	}
+
+	// the os-release files of Alpine and Amazon Linux report the patch release, e.g. 3.18.4
+	date, ok = versions[version]
+	if !ok && distribution == "alpine" {
+		parts := strings.SplitN(version, ".", 3)
+		if len(parts) >= 2 {
+			date, ok = versions[parts[0]+"."+parts[1]]
+
+			if minor, err := strconv.Atoi(parts[1]); !ok && err == nil && parts[0] == "3" && minor < oldestSupportedAlpine {
+				return "", true, false
+			}
+		}
+	}
+
+	if !ok {
+		return "", false, false
+	}
+
+	end, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return "", false, false
+	}
+
+	return date, !now.Before(end), now.Before(end) && end.Sub(now) < eolWarningPeriod
+}
+
+// readImageOSRelease returns the fields of the os-release file of the image
+func readImageOSRelease(ctx context.Context, cli *client.Client, imageID string) (map[string]string, error) {
+	created, err := cli.ContainerCreate(ctx,
+		&container.Config{
+			Image:           imageID,
+			Cmd:             []string{"true"},
+			NetworkDisabled: true,
+			Labels:          map[string]string{"io.portainer.agent.baseimage": imageID},
+		},
+		nil, nil, nil, "")
+	if err != nil {
+		return nil, errors.WithMessage(err, "unable to create the container")
+	}
+	defer func() {
+		err := cli.ContainerRemove(context.Background(), created.ID, types.ContainerRemoveOptions{Force: true})
+		if err != nil {
+			log.Warn().Str("container_id", created.ID).Err(err).Msg("unable to remove the base image container")
+		}
+	}()
+
+	var lastErr error
+	for _, p := range osReleasePaths {
+		data, err := copyContainerFile(ctx, cli, created.ID, p)
+		if err == nil {
+			return parseOSRelease(data), nil
+		}
+
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+// copyContainerFile returns the content of the file at p in a container, following a single symbolic link
+func copyContainerFile(ctx context.Context, cli *client.Client, containerID, p string) ([]byte, error) {
+	for i := 0; i < 2; i++ {
+		reader, _, err := cli.CopyFromContainer(ctx, containerID, p)
+		if err != nil {
+			return nil, err
+		}
+
+		header, data, err := readSingleFile(reader)
+		reader.Close()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if header.Typeflag != tar.TypeSymlink {
+			return data, nil
+		}
+
+		if path.IsAbs(header.Linkname) {
+			p = header.Linkname
+		} else {
+			p = path.Join(path.Dir(p), header.Linkname)
+		}
+	}
+
+	return nil, errors.New("too many levels of symbolic links")
+}
+
+func readSingleFile(r io.Reader) (*tar.Header, []byte, error) {
+	reader := tar.NewReader(r)
+
+	header, err := reader.Next()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(reader, maxOSReleaseSize))
+
+	return header, data, err
+}
+
+// parseOSRelease returns the fields of an os-release file, without their quotes
+func parseOSRelease(data []byte) map[string]string {
+	fields := map[string]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok || strings.HasPrefix(key, "#") {
+			continue
+		}
+
+		fields[key] = strings.Trim(value, `"'`)
+	}
+
+	return fields
+}
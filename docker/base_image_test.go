@@ -0,0 +1,48 @@
+package docker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDistributionEndOfLife(t *testing.T) {
+	now := time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		distribution, version string
+		date                  string
+		eol, soon             bool
+	}{
+		{"debian", "9", "2022-06-30", true, false},
+		{"centos", "7", "2024-06-30", true, false},
+		{"ubuntu", "22.04", "2027-06-01", false, false},
+		{"alpine", "3.20.3", "2026-04-01", false, true},
+		{"alpine", "3.9.6", "", true, false},
+		{"debian", "13", "", false, false},
+		{"", "", "", false, false},
+	}
+
+	for _, test := range tests {
+		date, eol, soon := distributionEndOfLife(test.distribution, test.version, now)
+		if date != test.date || eol != test.eol || soon != test.soon {
+			t.Errorf("expected %s %s to be (%q, %t, %t), got (%q, %t, %t)", test.distribution, test.version, test.date, test.eol, test.soon, date, eol, soon)
+		}
+	}
+}
+
+func TestParseOSRelease(t *testing.T) {
+	fields := parseOSRelease([]byte("# comment\nPRETTY_NAME=\"Debian GNU/Linux 9 (stretch)\"\nID=debian\nVERSION_ID='9'\n"))
+
+	if fields["ID"] != "debian" || fields["VERSION_ID"] != "9" || fields["PRETTY_NAME"] != "Debian GNU/Linux 9 (stretch)" {
+		t.Errorf("unexpected os-release fields %v", fields)
+	}
+
+	diagnostics := BaseImageDiagnostics([]BaseImage{
+		{Image: "legacy:1", PrettyName: fields["PRETTY_NAME"], EOLDate: "2022-06-30", EOL: true},
+		{Image: "app:2", PrettyName: "Ubuntu 22.04.4 LTS", EOLDate: "2027-06-01"},
+	})
+
+	if len(diagnostics) != 1 || diagnostics[0] != "end of life base image: legacy:1 is based on Debian GNU/Linux 9 (stretch), unsupported since 2022-06-30" {
+		t.Errorf("unexpected diagnostics %v", diagnostics)
+	}
+}
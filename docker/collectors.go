@@ -0,0 +1,127 @@
+package docker
+
+import (
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Snapshot collectors that can be toggled per environment by the Portainer server
+const (
+	// CollectorStats collects the CPU and memory usage of the running containers
+	CollectorStats = "stats"
+	// CollectorDiskUsage collects the logging configuration and the size of the log files of the containers
+	CollectorDiskUsage = "diskUsage"
+	// CollectorSecurityPosture collects the vulnerabilities found by the image scans
+	CollectorSecurityPosture = "securityPosture"
+	// CollectorVirtualMachines collects the QEMU/KVM virtual machines managed by libvirt on the host
+	CollectorVirtualMachines = "virtualMachines"
+	// CollectorOverlayNetworks collects the status of the WireGuard, Tailscale and ZeroTier clients of the host
+	CollectorOverlayNetworks = "overlayNetworks"
+	// CollectorBaseImages collects the distributions the local images are based on and flags the end of life ones
+	CollectorBaseImages = "baseImages"
+	// CollectorStorageDriver collects the health data of the storage driver of the Docker daemon (ZFS pools, btrfs
+	// device errors, overlay2 inode usage)
+	CollectorStorageDriver = "storageDriver"
+	// CollectorSMART collects the SMART health of the disks of the host
+	CollectorSMART = "smart"
+	// CollectorKernelAnomalies collects the anomalies found in the kernel messages of the host
+	CollectorKernelAnomalies = "kernelAnomalies"
+	// CollectorLANDevices collects the devices of the local network discovered with mDNS and SSDP
+	CollectorLANDevices = "lanDevices"
+)
+
+var collectors = struct {
+	mu sync.RWMutex
+	// defaults are the collectors enabled by the options of the agent
+	defaults map[string]bool
+	// overrides are the settings sent by the Portainer server, they take precedence over the defaults
+	overrides map[string]bool
+}{
+	defaults: map[string]bool{
+		CollectorStats:           false,
+		CollectorDiskUsage:       true,
+		CollectorSecurityPosture: true,
+		CollectorVirtualMachines: false,
+		CollectorOverlayNetworks: false,
+		CollectorBaseImages:      true,
+		CollectorStorageDriver:   true,
+		CollectorSMART:           false,
+		CollectorKernelAnomalies: false,
+		CollectorLANDevices:      false,
+	},
+	overrides: map[string]bool{},
+}
+
+// SetCollectorOverrides applies the collector settings sent by the Portainer server. The collectors missing from
+// settings fall back to the options of the agent, unknown collectors are ignored.
+func SetCollectorOverrides(settings map[string]bool) {
+	collectors.mu.Lock()
+	defer collectors.mu.Unlock()
+
+	overrides := make(map[string]bool, len(settings))
+	for name, enabled := range settings {
+		if _, ok := collectors.defaults[name]; !ok {
+			log.Debug().Str("collector", name).Msg("ignoring the settings of an unknown snapshot collector")
+
+			continue
+		}
+
+		if previous, ok := collectors.overrides[name]; !ok || previous != enabled {
+			log.Info().Str("collector", name).Bool("enabled", enabled).Msg("snapshot collector updated by the server")
+		}
+
+		overrides[name] = enabled
+	}
+
+	collectors.overrides = overrides
+}
+
+// CollectorEnabled returns whether the collector must run when creating a snapshot
+func CollectorEnabled(name string) bool {
+	collectors.mu.RLock()
+	defer collectors.mu.RUnlock()
+
+	if enabled, ok := collectors.overrides[name]; ok {
+		return enabled
+	}
+
+	return collectors.defaults[name]
+}
+
+// EnableSnapshotVirtualMachines adds the virtual machines of the host to the snapshots, unless the collector is
+// disabled by the Portainer server
+func EnableSnapshotVirtualMachines() {
+	setCollectorDefault(CollectorVirtualMachines, true)
+}
+
+// EnableSnapshotOverlayNetworks adds the overlay networks of the host to the snapshots, unless the collector is
+// disabled by the Portainer server
+func EnableSnapshotOverlayNetworks() {
+	setCollectorDefault(CollectorOverlayNetworks, true)
+}
+
+// EnableSnapshotSMART adds the SMART health of the disks of the host to the snapshots, unless the collector is
+// disabled by the Portainer server
+func EnableSnapshotSMART() {
+	setCollectorDefault(CollectorSMART, true)
+}
+
+// EnableSnapshotKernelAnomalies adds the anomalies found in the kernel messages of the host to the snapshots, unless
+// the collector is disabled by the Portainer server
+func EnableSnapshotKernelAnomalies() {
+	setCollectorDefault(CollectorKernelAnomalies, true)
+}
+
+// EnableSnapshotLANDevices adds the devices of the local network to the snapshots, unless the collector is disabled
+// by the Portainer server
+func EnableSnapshotLANDevices() {
+	setCollectorDefault(CollectorLANDevices, true)
+}
+
+func setCollectorDefault(name string, enabled bool) {
+	collectors.mu.Lock()
+	defer collectors.mu.Unlock()
+
+	collectors.defaults[name] = enabled
+}
@@ -0,0 +1,27 @@
+package docker
+
+import "testing"
+
+func TestCollectorEnabled(t *testing.T) {
+	defer SetCollectorOverrides(nil)
+
+	if CollectorEnabled(CollectorStats) || !CollectorEnabled(CollectorSecurityPosture) {
+		t.Fatal("expected the defaults of the collectors")
+	}
+
+	SetCollectorOverrides(map[string]bool{CollectorStats: true, CollectorSecurityPosture: false, "unknown": true})
+
+	if !CollectorEnabled(CollectorStats) || CollectorEnabled(CollectorSecurityPosture) || !CollectorEnabled(CollectorDiskUsage) {
+		t.Fatal("expected the settings of the server to override the defaults")
+	}
+
+	if CollectorEnabled("unknown") {
+		t.Fatal("expected the unknown collector to be ignored")
+	}
+
+	SetCollectorOverrides(nil)
+
+	if CollectorEnabled(CollectorStats) {
+		t.Fatal("expected the defaults once the server stops managing the collectors")
+	}
+}
@@ -0,0 +1,119 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// Supported batch container actions
+const (
+	BatchActionStart   = "start"
+	BatchActionStop    = "stop"
+	BatchActionRestart = "restart"
+	BatchActionRemove  = "remove"
+)
+
+const (
+	// defaultBatchConcurrency is the maximum number of containers processed in parallel during a batch operation
+	defaultBatchConcurrency = 5
+	// MaxBatchSize is the maximum number of containers a batch operation can be applied to
+	MaxBatchSize = 100
+)
+
+// BatchResult represents the outcome of a batch action for a single container
+type BatchResult struct {
+	ID      string `json:"Id"`
+	Success bool   `json:"Success"`
+	Error   string `json:"Error,omitempty"`
+}
+
+// IsValidBatchAction returns true if the specified action is supported by ContainerBatch
+func IsValidBatchAction(action string) bool {
+	switch action {
+	case BatchActionStart, BatchActionStop, BatchActionRestart, BatchActionRemove:
+		return true
+	}
+
+	return false
+}
+
+// ContainerBatch executes an action against a list of containers with bounded parallelism.
+// A failure on a container does not prevent the action from being executed on the other containers,
+// the outcome of each container is reported in the returned results, in the same order as containerIDs.
+func ContainerBatch(ctx context.Context, action string, containerIDs []string, force bool, concurrency int) ([]BatchResult, error) {
+	if !IsValidBatchAction(action) {
+		return nil, fmt.Errorf("unsupported batch action: %s", action)
+	}
+
+	if len(containerIDs) > MaxBatchSize {
+		return nil, fmt.Errorf("a batch operation cannot be applied to more than %d containers", MaxBatchSize)
+	}
+
+	var results []BatchResult
+
+	err := withCli(func(cli *client.Client) error {
+		results = runBatch(containerIDs, concurrency, func(containerID string) error {
+			return executeBatchAction(ctx, cli, action, containerID, force)
+		})
+
+		return nil
+	})
+
+	return results, err
+}
+
+// runBatch calls fn for each identifier with at most concurrency calls running in parallel and returns
+// the outcome of each call, in the same order as ids
+func runBatch(ids []string, concurrency int, fn func(id string) error) []BatchResult {
+	if concurrency <= 0 {
+		concurrency = defaultBatchConcurrency
+	}
+
+	results := make([]BatchResult, len(ids))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+
+	for i, id := range ids {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int, id string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			results[i] = BatchResult{ID: id, Success: true}
+
+			if err := fn(id); err != nil {
+				results[i].Success = false
+				results[i].Error = err.Error()
+			}
+		}(i, id)
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+func executeBatchAction(ctx context.Context, cli *client.Client, action, containerID string, force bool) error {
+	switch action {
+	case BatchActionStart:
+		return cli.ContainerStart(ctx, containerID, types.ContainerStartOptions{})
+	case BatchActionStop:
+		return cli.ContainerStop(ctx, containerID, container.StopOptions{})
+	case BatchActionRestart:
+		return cli.ContainerRestart(ctx, containerID, container.StopOptions{})
+	case BatchActionRemove:
+		return cli.ContainerRemove(ctx, containerID, types.ContainerRemoveOptions{Force: force})
+	}
+
+	return fmt.Errorf("unsupported batch action: %s", action)
+}
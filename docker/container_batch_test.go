@@ -0,0 +1,51 @@
+package docker
+
+import (
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunBatchPartialFailure(t *testing.T) {
+	ids := []string{"a", "b", "c", "d", "e", "f"}
+
+	var running, maxRunning int32
+	results := runBatch(ids, 2, func(id string) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+
+		// The first containers finish last to make sure the results are not in completion order
+		time.Sleep(time.Duration(len(ids)-int(id[0]-'a')) * time.Millisecond)
+
+		if id == "b" || id == "e" {
+			return errors.New("failed " + id)
+		}
+
+		return nil
+	})
+
+	expected := []BatchResult{
+		{ID: "a", Success: true},
+		{ID: "b", Success: false, Error: "failed b"},
+		{ID: "c", Success: true},
+		{ID: "d", Success: true},
+		{ID: "e", Success: false, Error: "failed e"},
+		{ID: "f", Success: true},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected %v, got %v", expected, results)
+	}
+
+	if maxRunning > 2 {
+		t.Errorf("expected at most 2 concurrent calls, got %d", maxRunning)
+	}
+}
@@ -0,0 +1,54 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// ContainerCrashData returns the inspection of a container and its last log lines, the standard output and error
+// streams are interleaved in the order they were written
+func ContainerCrashData(ctx context.Context, containerID string, logLines int) (types.ContainerJSON, []byte, error) {
+	var inspect types.ContainerJSON
+	var logs bytes.Buffer
+
+	err := withCli(func(cli *client.Client) error {
+		var err error
+
+		inspect, err = cli.ContainerInspect(ctx, containerID)
+		if err != nil {
+			return err
+		}
+
+		if logLines <= 0 {
+			return nil
+		}
+
+		rd, err := cli.ContainerLogs(ctx, containerID, types.ContainerLogsOptions{
+			ShowStdout: true,
+			ShowStderr: true,
+			Timestamps: true,
+			Tail:       strconv.Itoa(logLines),
+		})
+		if err != nil {
+			return err
+		}
+		defer rd.Close()
+
+		// The logs of the containers with a TTY are not multiplexed
+		if inspect.Config != nil && inspect.Config.Tty {
+			_, err = io.Copy(&logs, rd)
+		} else {
+			_, err = stdcopy.StdCopy(&logs, &logs, rd)
+		}
+
+		return err
+	})
+
+	return inspect, logs.Bytes(), err
+}
@@ -0,0 +1,430 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/pkg/errors"
+	"github.com/portainer/agent/journal"
+	"github.com/rs/zerolog/log"
+)
+
+// recreateStartupDelay is the time given to a replacement container to prove that it keeps running before the
+// original container is removed.
+var recreateStartupDelay = 3 * time.Second
+
+// Steps of a container recreation recorded in the operation journal
+const (
+	// recreateStepReplacing is recorded before the container is renamed and its replacement is created
+	recreateStepReplacing = "replacing"
+	// recreateStepRemoving is recorded once the replacement is running, before the original container is removed
+	recreateStepRemoving = "removing"
+)
+
+// recreateJournalState is the state of a container recreation recorded in the operation journal
+type recreateJournalState struct {
+	ContainerID   string
+	Name          string
+	WasRunning    bool
+	ReplacementID string `json:",omitempty"`
+}
+
+// RecreateChanges represents the changes applied to the specification of a container when it is recreated
+type RecreateChanges struct {
+	// Image replaces the image (or image tag) of the container when set
+	Image string
+	// PullImage pulls the image before creating the replacement container
+	PullImage bool
+	// Env contains KEY=value entries that are added to or override the environment of the container
+	Env []string
+	// Mounts contains mounts that are added to the container, replacing any existing mount with the same target
+	Mounts []mount.Mount
+	// LogConfig replaces the logging configuration of the container when set
+	LogConfig *container.LogConfig
+}
+
+// ContainerRecreate stops a container and replaces it with a new container created from the same specification
+// with the specified changes applied. The name and the networks of the container are preserved.
+// If the replacement container fails to start, it is removed and the original container is restored.
+// It returns the identifier of the replacement container.
+func ContainerRecreate(ctx context.Context, containerID string, changes RecreateChanges) (string, error) {
+	var newContainerID string
+
+	err := withCli(func(cli *client.Client) error {
+		cli.HTTPClient().Timeout = largeClientTimeout
+
+		current, err := cli.ContainerInspect(ctx, containerID)
+		if err != nil {
+			return errors.WithMessage(err, "unable to inspect container")
+		}
+
+		config, hostConfig, networkingConfig, extraNetworks := buildRecreateSpec(current, changes)
+
+		if changes.PullImage && changes.Image != "" {
+			if err := pullImage(ctx, cli, changes.Image); err != nil {
+				return errors.WithMessage(err, "unable to pull image")
+			}
+		}
+
+		name := strings.TrimPrefix(current.Name, "/")
+		backupName := fmt.Sprintf("%s-recreate-%d", name, time.Now().Unix())
+		wasRunning := current.State != nil && current.State.Running
+
+		state := recreateJournalState{ContainerID: current.ID, Name: name, WasRunning: wasRunning}
+
+		entry, err := journal.Begin(journal.TypeContainerRecreate, name, state)
+		if err != nil {
+			return errors.WithMessage(err, "unable to record the recreation in the operation journal")
+		}
+		defer entry.Complete()
+
+		if wasRunning {
+			if err := cli.ContainerStop(ctx, current.ID, container.StopOptions{}); err != nil {
+				return errors.WithMessage(err, "unable to stop container")
+			}
+		}
+
+		if err := entry.Advance(recreateStepReplacing, nil); err != nil {
+			restoreContainer(cli, current.ID, "", wasRunning)
+			return errors.WithMessage(err, "unable to record the recreation in the operation journal")
+		}
+
+		if err := cli.ContainerRename(ctx, current.ID, backupName); err != nil {
+			restoreContainer(cli, current.ID, "", wasRunning)
+			return errors.WithMessage(err, "unable to rename container")
+		}
+
+		newContainerID, err = createAndStartReplacement(ctx, cli, name, config, hostConfig, networkingConfig, extraNetworks, wasRunning)
+		if err != nil {
+			restoreContainer(cli, current.ID, name, wasRunning)
+			return err
+		}
+
+		// the replacement is running, an interrupted recreation is completed rather than rolled back from now on
+		state.ReplacementID = newContainerID
+		if err := entry.Advance(recreateStepRemoving, state); err != nil {
+			log.Warn().Err(err).Str("container_id", current.ID).Msg("unable to record the recreation in the operation journal")
+		}
+
+		if err := cli.ContainerRemove(ctx, current.ID, types.ContainerRemoveOptions{}); err != nil {
+			log.Warn().Str("container_id", current.ID).Err(err).Msg("unable to remove the previous container")
+		}
+
+		return nil
+	})
+
+	return newContainerID, err
+}
+
+func createAndStartReplacement(
+	ctx context.Context,
+	cli *client.Client,
+	name string,
+	config *container.Config,
+	hostConfig *container.HostConfig,
+	networkingConfig *network.NetworkingConfig,
+	extraNetworks map[string]*network.EndpointSettings,
+	start bool,
+) (string, error) {
+	created, err := cli.ContainerCreate(ctx, config, hostConfig, networkingConfig, nil, name)
+	if err != nil {
+		return "", errors.WithMessage(err, "unable to create the replacement container")
+	}
+
+	err = func() error {
+		for networkName, settings := range extraNetworks {
+			if err := cli.NetworkConnect(ctx, networkName, created.ID, settings); err != nil {
+				return errors.WithMessagef(err, "unable to connect the replacement container to network %s", networkName)
+			}
+		}
+
+		// a stopped container is replaced by a stopped container
+		if !start {
+			return nil
+		}
+
+		if err := cli.ContainerStart(ctx, created.ID, types.ContainerStartOptions{}); err != nil {
+			return errors.WithMessage(err, "unable to start the replacement container")
+		}
+
+		return waitForRunning(ctx, cli, created.ID)
+	}()
+	if err != nil {
+		if rmErr := cli.ContainerRemove(context.Background(), created.ID, types.ContainerRemoveOptions{Force: true}); rmErr != nil {
+			log.Warn().Str("container_id", created.ID).Err(rmErr).Msg("unable to remove the replacement container")
+		}
+
+		return "", err
+	}
+
+	return created.ID, nil
+}
+
+// waitForRunning ensures that a started container is still running after recreateStartupDelay
+func waitForRunning(ctx context.Context, cli *client.Client, containerID string) error {
+	select {
+	case <-time.After(recreateStartupDelay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	replacement, err := cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return errors.WithMessage(err, "unable to inspect the replacement container")
+	}
+
+	if replacement.State == nil || !replacement.State.Running || replacement.State.Restarting {
+		exitCode := 0
+		if replacement.State != nil {
+			exitCode = replacement.State.ExitCode
+		}
+
+		return fmt.Errorf("the replacement container stopped after starting (exit code %d)", exitCode)
+	}
+
+	return nil
+}
+
+// restoreContainer rolls back a failed recreation by restoring the original name and state of a container
+func restoreContainer(cli *client.Client, containerID, name string, start bool) {
+	ctx := context.Background()
+
+	if name != "" {
+		if err := cli.ContainerRename(ctx, containerID, name); err != nil {
+			log.Error().Str("container_id", containerID).Err(err).Msg("unable to restore the container name")
+		}
+	}
+
+	if !start {
+		return
+	}
+
+	if err := cli.ContainerStart(ctx, containerID, types.ContainerStartOptions{}); err != nil {
+		log.Error().Str("container_id", containerID).Err(err).Msg("unable to restart the original container")
+	}
+}
+
+func pullImage(ctx context.Context, cli *client.Client, image string) error {
+	return withRegistryAuth(image, func(options types.ImagePullOptions) error {
+		reader, err := cli.ImagePull(ctx, image, options)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+
+		// The pull is only complete once the progress stream has been consumed
+		_, err = io.Copy(io.Discard, reader)
+
+		return err
+	})
+}
+
+// buildRecreateSpec computes the specification of the replacement container.
+// Only one network can be attached at creation time, the other networks are returned separately
+// so that they can be connected before the container is started.
+func buildRecreateSpec(current types.ContainerJSON, changes RecreateChanges) (*container.Config, *container.HostConfig, *network.NetworkingConfig, map[string]*network.EndpointSettings) {
+	config := *current.Config
+	hostConfig := *current.HostConfig
+
+	if changes.Image != "" {
+		config.Image = changes.Image
+	}
+
+	// An auto-generated hostname is derived from the container identifier and must not be reused
+	if strings.HasPrefix(current.ID, config.Hostname) {
+		config.Hostname = ""
+	}
+
+	config.Env = MergeEnv(config.Env, changes.Env)
+	hostConfig.Mounts = mergeMounts(mergeMounts(hostConfig.Mounts, anonymousVolumeMounts(current)), changes.Mounts)
+	hostConfig.Binds = removeOverriddenBinds(hostConfig.Binds, changes.Mounts)
+
+	if changes.LogConfig != nil {
+		hostConfig.LogConfig = *changes.LogConfig
+	}
+
+	networkingConfig := &network.NetworkingConfig{EndpointsConfig: map[string]*network.EndpointSettings{}}
+	extraNetworks := map[string]*network.EndpointSettings{}
+
+	if current.NetworkSettings == nil || hostConfig.NetworkMode.IsContainer() || hostConfig.NetworkMode.IsHost() || hostConfig.NetworkMode.IsNone() {
+		return &config, &hostConfig, networkingConfig, extraNetworks
+	}
+
+	for networkName, settings := range current.NetworkSettings.Networks {
+		endpoint := &network.EndpointSettings{
+			IPAMConfig: settings.IPAMConfig,
+			Links:      settings.Links,
+			Aliases:    removeAlias(settings.Aliases, current.ID[:12]),
+			DriverOpts: settings.DriverOpts,
+		}
+
+		if len(networkingConfig.EndpointsConfig) == 0 && (string(hostConfig.NetworkMode) == networkName || !hasNetwork(current, string(hostConfig.NetworkMode))) {
+			networkingConfig.EndpointsConfig[networkName] = endpoint
+			continue
+		}
+
+		extraNetworks[networkName] = endpoint
+	}
+
+	return &config, &hostConfig, networkingConfig, extraNetworks
+}
+
+// anonymousVolumeMounts returns the anonymous volumes of a container (created from a VOLUME instruction or
+// a volume without name) as mounts, so that the replacement container reuses them instead of new empty volumes.
+func anonymousVolumeMounts(current types.ContainerJSON) []mount.Mount {
+	mounts := []mount.Mount{}
+
+	if current.HostConfig == nil {
+		return mounts
+	}
+
+	declared := map[string]bool{}
+	for _, m := range current.HostConfig.Mounts {
+		declared[m.Target] = true
+	}
+
+	for _, b := range current.HostConfig.Binds {
+		parts := splitBind(b)
+		if len(parts) >= 2 {
+			declared[parts[1]] = true
+		}
+	}
+
+	for _, m := range current.Mounts {
+		if m.Type != mount.TypeVolume || m.Name == "" || declared[m.Destination] {
+			continue
+		}
+
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeVolume,
+			Source:   m.Name,
+			Target:   m.Destination,
+			ReadOnly: !m.RW,
+		})
+	}
+
+	return mounts
+}
+
+func hasNetwork(current types.ContainerJSON, networkName string) bool {
+	_, ok := current.NetworkSettings.Networks[networkName]
+	return ok
+}
+
+func removeAlias(aliases []string, alias string) []string {
+	filtered := []string{}
+
+	for _, a := range aliases {
+		if a != alias {
+			filtered = append(filtered, a)
+		}
+	}
+
+	return filtered
+}
+
+// MergeEnv returns base (in the KEY=value form) with the entries of overrides added or replacing the entries
+// sharing the same name. The order of base is preserved.
+func MergeEnv(base, overrides []string) []string {
+	merged := make([]string, 0, len(base)+len(overrides))
+	index := map[string]int{}
+
+	for _, e := range base {
+		name, _, _ := strings.Cut(e, "=")
+		index[name] = len(merged)
+		merged = append(merged, e)
+	}
+
+	for _, e := range overrides {
+		name, _, _ := strings.Cut(e, "=")
+		if i, ok := index[name]; ok {
+			merged[i] = e
+			continue
+		}
+
+		index[name] = len(merged)
+		merged = append(merged, e)
+	}
+
+	return merged
+}
+
+func mergeMounts(base, overrides []mount.Mount) []mount.Mount {
+	merged := []mount.Mount{}
+
+	for _, m := range base {
+		replaced := false
+		for _, o := range overrides {
+			if o.Target == m.Target {
+				replaced = true
+				break
+			}
+		}
+
+		if !replaced {
+			merged = append(merged, m)
+		}
+	}
+
+	return append(merged, overrides...)
+}
+
+// splitBind splits a bind (in the source:target[:options] form) into its parts, keeping the drive letters of the
+// Windows paths (e.g. C:\data:C:\data:ro) with their path. A single letter cannot be a volume name nor a Linux
+// path, so it is always a drive letter.
+func splitBind(bind string) []string {
+	fields := strings.Split(bind, ":")
+	parts := make([]string, 0, len(fields))
+
+	for i := 0; i < len(fields); i++ {
+		if isDriveLetter(fields[i]) && i+1 < len(fields) && strings.IndexAny(fields[i+1], `\/`) == 0 {
+			parts = append(parts, fields[i]+":"+fields[i+1])
+			i++
+
+			continue
+		}
+
+		parts = append(parts, fields[i])
+	}
+
+	return parts
+}
+
+func isDriveLetter(s string) bool {
+	return len(s) == 1 && ('a' <= s[0] && s[0] <= 'z' || 'A' <= s[0] && s[0] <= 'Z')
+}
+
+// removeOverriddenBinds removes the binds (in the source:target[:options] form) whose target is overridden by a mount
+func removeOverriddenBinds(binds []string, overrides []mount.Mount) []string {
+	filtered := []string{}
+
+	for _, b := range binds {
+		parts := splitBind(b)
+		if len(parts) < 2 {
+			filtered = append(filtered, b)
+			continue
+		}
+
+		overridden := false
+		for _, o := range overrides {
+			if o.Target == parts[1] {
+				overridden = true
+				break
+			}
+		}
+
+		if !overridden {
+			filtered = append(filtered, b)
+		}
+	}
+
+	return filtered
+}
@@ -0,0 +1,282 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+)
+
+func TestMergeEnv(t *testing.T) {
+	merged := MergeEnv(
+		[]string{"A=1", "B=2", "C"},
+		[]string{"B=3", "D=4", "C=5"},
+	)
+
+	expected := []string{"A=1", "B=3", "C=5", "D=4"}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("expected %v, got %v", expected, merged)
+	}
+}
+
+func TestMergeMounts(t *testing.T) {
+	merged := mergeMounts(
+		[]mount.Mount{
+			{Type: mount.TypeVolume, Source: "data", Target: "/data"},
+			{Type: mount.TypeBind, Source: "/etc/app", Target: "/config"},
+		},
+		[]mount.Mount{
+			{Type: mount.TypeVolume, Source: "data-v2", Target: "/data"},
+		},
+	)
+
+	expected := []mount.Mount{
+		{Type: mount.TypeBind, Source: "/etc/app", Target: "/config"},
+		{Type: mount.TypeVolume, Source: "data-v2", Target: "/data"},
+	}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("expected %v, got %v", expected, merged)
+	}
+}
+
+func TestRemoveOverriddenBinds(t *testing.T) {
+	binds := removeOverriddenBinds(
+		[]string{"/srv/data:/data:ro", "logs:/var/log", "invalid"},
+		[]mount.Mount{{Type: mount.TypeVolume, Source: "data", Target: "/data"}},
+	)
+
+	expected := []string{"logs:/var/log", "invalid"}
+	if !reflect.DeepEqual(binds, expected) {
+		t.Errorf("expected %v, got %v", expected, binds)
+	}
+}
+
+func TestBuildRecreateSpec(t *testing.T) {
+	current := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID: "0123456789abcdef",
+			HostConfig: &container.HostConfig{
+				NetworkMode: "frontend",
+				Binds:       []string{"/srv/config:/config"},
+			},
+		},
+		Mounts: []types.MountPoint{
+			{Type: mount.TypeBind, Source: "/srv/config", Destination: "/config", RW: true},
+			{Type: mount.TypeVolume, Name: "4f2a", Destination: "/var/lib/postgresql/data", RW: true},
+		},
+		Config: &container.Config{
+			Hostname: "0123456789ab",
+			Image:    "postgres:15",
+			Env:      []string{"POSTGRES_DB=app"},
+			Volumes:  map[string]struct{}{"/var/lib/postgresql/data": {}},
+		},
+		NetworkSettings: &types.NetworkSettings{
+			Networks: map[string]*network.EndpointSettings{
+				"frontend": {Aliases: []string{"db", "0123456789ab"}},
+				"backend":  {Aliases: []string{"db"}},
+			},
+		},
+	}
+
+	config, hostConfig, networkingConfig, extraNetworks := buildRecreateSpec(current, RecreateChanges{
+		Image: "postgres:16",
+		Env:   []string{"POSTGRES_DB=app2"},
+	})
+
+	if config.Image != "postgres:16" {
+		t.Errorf("expected image postgres:16, got %s", config.Image)
+	}
+
+	if config.Hostname != "" {
+		t.Errorf("expected the generated hostname to be cleared, got %s", config.Hostname)
+	}
+
+	if !reflect.DeepEqual(config.Env, []string{"POSTGRES_DB=app2"}) {
+		t.Errorf("unexpected env %v", config.Env)
+	}
+
+	expectedMounts := []mount.Mount{
+		{Type: mount.TypeVolume, Source: "4f2a", Target: "/var/lib/postgresql/data"},
+	}
+	if !reflect.DeepEqual(hostConfig.Mounts, expectedMounts) {
+		t.Errorf("expected the anonymous volume to be preserved, got %v", hostConfig.Mounts)
+	}
+
+	if !reflect.DeepEqual(hostConfig.Binds, []string{"/srv/config:/config"}) {
+		t.Errorf("unexpected binds %v", hostConfig.Binds)
+	}
+
+	frontend, ok := networkingConfig.EndpointsConfig["frontend"]
+	if !ok || len(networkingConfig.EndpointsConfig) != 1 {
+		t.Fatalf("expected the container to be created on the frontend network, got %v", networkingConfig.EndpointsConfig)
+	}
+
+	if !reflect.DeepEqual(frontend.Aliases, []string{"db"}) {
+		t.Errorf("expected the container identifier alias to be removed, got %v", frontend.Aliases)
+	}
+
+	if _, ok := extraNetworks["backend"]; !ok || len(extraNetworks) != 1 {
+		t.Errorf("expected backend to be connected after creation, got %v", extraNetworks)
+	}
+
+	// The specification of the original container must not be modified
+	if current.Config.Image != "postgres:15" || len(current.HostConfig.Mounts) != 0 {
+		t.Errorf("the original container specification was modified")
+	}
+}
+
+func TestSplitBind(t *testing.T) {
+	tests := []struct {
+		bind     string
+		expected []string
+	}{
+		{bind: "/srv/data:/data:ro", expected: []string{"/srv/data", "/data", "ro"}},
+		{bind: "logs:/var/log", expected: []string{"logs", "/var/log"}},
+		{bind: `C:\data:C:\app\data`, expected: []string{`C:\data`, `C:\app\data`}},
+		{bind: `C:\data:/data:ro`, expected: []string{`C:\data`, "/data", "ro"}},
+		{bind: `d:/data:c:/data`, expected: []string{"d:/data", "c:/data"}},
+		{bind: `\\.\pipe\docker_engine:\\.\pipe\docker_engine`, expected: []string{`\\.\pipe\docker_engine`, `\\.\pipe\docker_engine`}},
+		{bind: "invalid", expected: []string{"invalid"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.bind, func(t *testing.T) {
+			parts := splitBind(tt.bind)
+			if !reflect.DeepEqual(parts, tt.expected) {
+				t.Errorf("expected %q, got %q", tt.expected, parts)
+			}
+		})
+	}
+}
+
+func TestRemoveOverriddenWindowsBinds(t *testing.T) {
+	binds := removeOverriddenBinds(
+		[]string{`C:\data:C:\app\data`, `C:\logs:C:\app\logs:ro`},
+		[]mount.Mount{{Type: mount.TypeVolume, Source: "data", Target: `C:\app\data`}},
+	)
+
+	expected := []string{`C:\logs:C:\app\logs:ro`}
+	if !reflect.DeepEqual(binds, expected) {
+		t.Errorf("expected %v, got %v", expected, binds)
+	}
+}
+
+// fakeDaemon serves the container endpoints of the Docker API used to create the replacement of a container
+type fakeDaemon struct {
+	mu       sync.Mutex
+	calls    []string
+	running  bool
+	exitCode int
+}
+
+func (d *fakeDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// the version of the API prefixes the path
+	path := r.URL.Path[strings.Index(r.URL.Path[1:], "/")+1:]
+	d.calls = append(d.calls, r.Method+" "+path)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	switch {
+	case r.Method == http.MethodPost && path == "/containers/create":
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(container.CreateResponse{ID: "replacement"})
+	case r.Method == http.MethodGet && path == "/containers/replacement/json":
+		json.NewEncoder(w).Encode(types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{
+				ID:    "replacement",
+				State: &types.ContainerState{Running: d.running, ExitCode: d.exitCode},
+			},
+		})
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (d *fakeDaemon) callsMade() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]string{}, d.calls...)
+}
+
+func newFakeDaemonClient(t *testing.T, daemon http.Handler) *client.Client {
+	t.Helper()
+
+	server := httptest.NewServer(daemon)
+	t.Cleanup(server.Close)
+
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+server.Listener.Addr().String()), client.WithVersion("1.41"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cli.Close() })
+
+	return cli
+}
+
+func TestCreateAndStartReplacement(t *testing.T) {
+	delay := recreateStartupDelay
+	recreateStartupDelay = 10 * time.Millisecond
+	t.Cleanup(func() { recreateStartupDelay = delay })
+
+	tests := []struct {
+		name          string
+		start         bool
+		running       bool
+		expectedCalls []string
+		expectedErr   string
+	}{
+		{
+			name:          "stopped container",
+			start:         false,
+			expectedCalls: []string{"POST /containers/create"},
+		},
+		{
+			name:          "running container",
+			start:         true,
+			running:       true,
+			expectedCalls: []string{"POST /containers/create", "POST /containers/replacement/start", "GET /containers/replacement/json"},
+		},
+		{
+			name:          "exited replacement",
+			start:         true,
+			running:       false,
+			expectedCalls: []string{"POST /containers/create", "POST /containers/replacement/start", "GET /containers/replacement/json", "DELETE /containers/replacement"},
+			expectedErr:   "the replacement container stopped after starting (exit code 1)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			daemon := &fakeDaemon{running: tt.running, exitCode: 1}
+			cli := newFakeDaemonClient(t, daemon)
+
+			id, err := createAndStartReplacement(context.Background(), cli, "web", &container.Config{Image: "nginx"}, &container.HostConfig{}, &network.NetworkingConfig{}, nil, tt.start)
+			if tt.expectedErr != "" {
+				if err == nil || err.Error() != tt.expectedErr {
+					t.Errorf("expected %q, got %v", tt.expectedErr, err)
+				}
+			} else if err != nil || id != "replacement" {
+				t.Errorf("expected the replacement container, got %q and %v", id, err)
+			}
+
+			if calls := daemon.callsMade(); !reflect.DeepEqual(calls, tt.expectedCalls) {
+				t.Errorf("expected the calls %v, got %v", tt.expectedCalls, calls)
+			}
+		})
+	}
+}
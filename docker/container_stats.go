@@ -0,0 +1,170 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/portainer/agent"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/rs/zerolog/log"
+)
+
+// ContainerUsage represents the CPU and memory used by a running container
+type ContainerUsage struct {
+	ID   string `json:"Id"`
+	Name string `json:"Name"`
+	// CPUPercent is relative to a single CPU, a container fully using two CPUs is at 200%
+	CPUPercent  float64 `json:"CPUPercent"`
+	MemoryUsage uint64  `json:"MemoryUsage"`
+	MemoryLimit uint64  `json:"MemoryLimit"`
+}
+
+// ContainerStats represents the resources used by the running containers of the host
+type ContainerStats struct {
+	Containers  []ContainerUsage `json:"Containers"`
+	CPUPercent  float64          `json:"CPUPercent"`
+	MemoryUsage uint64           `json:"MemoryUsage"`
+}
+
+// EnableSnapshotStats adds the resource usage of the containers to the snapshots, unless the stats collector is
+// disabled by the Portainer server
+func EnableSnapshotStats() {
+	setCollectorDefault(CollectorStats, true)
+}
+
+// SnapshotStats returns the CPU and memory usage of the running containers, or nil when the stats collector is
+// not enabled and no container opted in with the stats label. The containers labelled with false are excluded. The
+// stats of a container that cannot be retrieved, e.g. because it was stopped in the meantime, are ignored.
+func SnapshotStats(ctx context.Context) (*ContainerStats, error) {
+	collectorEnabled := CollectorEnabled(CollectorStats)
+
+	var stats *ContainerStats
+
+	err := withCli(func(cli *client.Client) error {
+		containers, err := cli.ContainerList(ctx, types.ContainerListOptions{})
+		if err != nil {
+			return err
+		}
+
+		ids := make([]string, 0, len(containers))
+		for _, c := range containers {
+			if enabled, set := LabelOptIn(c.Labels, agent.ContainerLabelStats); enabled || (!set && collectorEnabled) {
+				ids = append(ids, c.ID)
+			}
+		}
+
+		if len(ids) == 0 && !collectorEnabled {
+			return nil
+		}
+
+		stats = &ContainerStats{Containers: []ContainerUsage{}}
+
+		var mu sync.Mutex
+
+		runBatch(ids, defaultBatchConcurrency, func(id string) error {
+			usage, err := getContainerUsage(ctx, cli, id)
+			if err != nil {
+				log.Debug().Err(err).Str("container_id", id).Msg("unable to retrieve the container stats")
+
+				return err
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			stats.Containers = append(stats.Containers, usage)
+			stats.CPUPercent += usage.CPUPercent
+			stats.MemoryUsage += usage.MemoryUsage
+
+			return nil
+		})
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+func getContainerUsage(ctx context.Context, cli *client.Client, containerID string) (ContainerUsage, error) {
+	// Without streaming, the engine waits for a second sample so that the CPU usage can be computed
+	response, err := cli.ContainerStats(ctx, containerID, false)
+	if err != nil {
+		return ContainerUsage{}, err
+	}
+	defer response.Body.Close()
+
+	var stats types.StatsJSON
+
+	err = json.NewDecoder(response.Body).Decode(&stats)
+	if err != nil {
+		return ContainerUsage{}, err
+	}
+
+	return computeContainerUsage(&stats, response.OSType), nil
+}
+
+// computeContainerUsage computes the usage of a container the same way as the docker stats command
+func computeContainerUsage(stats *types.StatsJSON, osType string) ContainerUsage {
+	usage := ContainerUsage{
+		ID:          stats.ID,
+		Name:        strings.TrimPrefix(stats.Name, "/"),
+		MemoryLimit: stats.MemoryStats.Limit,
+	}
+
+	if osType == "windows" {
+		usage.CPUPercent = windowsCPUPercent(stats)
+		usage.MemoryUsage = stats.MemoryStats.PrivateWorkingSet
+
+		return usage
+	}
+
+	usage.CPUPercent = linuxCPUPercent(stats)
+	usage.MemoryUsage = stats.MemoryStats.Usage
+
+	// The page cache is excluded, the key depends on the version of the cgroups
+	cacheKey := "inactive_file"
+	if _, ok := stats.MemoryStats.Stats["total_inactive_file"]; ok {
+		cacheKey = "total_inactive_file"
+	}
+
+	if cache := stats.MemoryStats.Stats[cacheKey]; cache < usage.MemoryUsage {
+		usage.MemoryUsage -= cache
+	}
+
+	return usage
+}
+
+func linuxCPUPercent(stats *types.StatsJSON) float64 {
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+
+	onlineCPUs := float64(stats.CPUStats.OnlineCPUs)
+	if onlineCPUs == 0 {
+		onlineCPUs = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+
+	return cpuDelta / systemDelta * onlineCPUs * 100
+}
+
+func windowsCPUPercent(stats *types.StatsJSON) float64 {
+	// The usage is expressed in 100ns intervals
+	possibleIntervals := float64(stats.Read.Sub(stats.PreRead).Nanoseconds()) / 100 * float64(stats.NumProcs)
+	usedIntervals := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+
+	if possibleIntervals <= 0 || usedIntervals <= 0 {
+		return 0
+	}
+
+	return usedIntervals / possibleIntervals * 100
+}
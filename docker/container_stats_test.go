@@ -0,0 +1,43 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestComputeContainerUsage(t *testing.T) {
+	stats := &types.StatsJSON{Name: "/web", ID: "abc"}
+	stats.CPUStats.CPUUsage.TotalUsage = 300
+	stats.CPUStats.SystemUsage = 2000
+	stats.CPUStats.OnlineCPUs = 4
+	stats.PreCPUStats.CPUUsage.TotalUsage = 100
+	stats.PreCPUStats.SystemUsage = 1000
+	stats.MemoryStats.Usage = 1000
+	stats.MemoryStats.Limit = 4000
+	stats.MemoryStats.Stats = map[string]uint64{"inactive_file": 200}
+
+	usage := computeContainerUsage(stats, "linux")
+
+	if usage.Name != "web" || usage.ID != "abc" {
+		t.Fatalf("unexpected container %s (%s)", usage.Name, usage.ID)
+	}
+
+	if usage.CPUPercent != 80 {
+		t.Fatalf("expected 80%% CPU, got %v", usage.CPUPercent)
+	}
+
+	if usage.MemoryUsage != 800 || usage.MemoryLimit != 4000 {
+		t.Fatalf("expected 800/4000 bytes of memory, got %d/%d", usage.MemoryUsage, usage.MemoryLimit)
+	}
+}
+
+func TestComputeContainerUsage_FirstSample(t *testing.T) {
+	stats := &types.StatsJSON{}
+	stats.CPUStats.CPUUsage.TotalUsage = 300
+	stats.CPUStats.SystemUsage = 2000
+
+	if usage := computeContainerUsage(stats, "linux"); usage.CPUPercent != 0 {
+		t.Fatalf("expected no CPU usage without a previous sample, got %v", usage.CPUPercent)
+	}
+}
@@ -14,10 +14,16 @@ import (
 
 const largeClientTimeout = 1 * time.Hour
 
+// ImagePull pulls an image, with the credentials returned by the credential helper of its registry when options does
+// not provide credentials
 func ImagePull(refStr string, options types.ImagePullOptions) (io.ReadCloser, error) {
 	var err error
 	var reader io.ReadCloser
 
+	if options.RegistryAuth == "" {
+		options.RegistryAuth = registryPullOptions(refStr).RegistryAuth
+	}
+
 	err = withCli(func(cli *client.Client) error {
 		cli.HTTPClient().Timeout = largeClientTimeout
 
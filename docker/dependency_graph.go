@@ -0,0 +1,257 @@
+package docker
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// composeDependsOnLabel is the label in which Compose records the depends_on of a service, e.g.
+// "db:service_healthy:true,cache:service_started:false"
+const composeDependsOnLabel = "com.docker.compose.depends_on"
+
+// Container dependency kinds. The links, depends_on, network_mode and volumes_from dependencies are directed from
+// the dependent container to the container it depends on, the network and volume dependencies are shared resources.
+const (
+	DependencyLink        = "link"
+	DependencyDependsOn   = "depends_on"
+	DependencyNetworkMode = "network_mode"
+	DependencyVolumesFrom = "volumes_from"
+	DependencyNetwork     = "network"
+	DependencyVolume      = "volume"
+)
+
+type (
+	// DependencyGraph represents the dependencies between the containers of the host
+	DependencyGraph struct {
+		Nodes []DependencyNode `json:"Nodes"`
+		Edges []DependencyEdge `json:"Edges"`
+	}
+
+	// DependencyNode represents a container of a dependency graph
+	DependencyNode struct {
+		ID    string `json:"Id"`
+		Name  string `json:"Name"`
+		Stack string `json:"Stack,omitempty"`
+	}
+
+	// DependencyEdge represents a dependency of the From container on the To container. Resource is the service,
+	// network or volume name, or the link alias.
+	DependencyEdge struct {
+		From     string `json:"From"`
+		To       string `json:"To"`
+		Kind     string `json:"Kind"`
+		Resource string `json:"Resource,omitempty"`
+	}
+)
+
+// GetDependencyGraph computes the dependency graph of all the containers of the host
+func GetDependencyGraph(ctx context.Context) (*DependencyGraph, error) {
+	var containers []types.ContainerJSON
+
+	err := withCli(func(cli *client.Client) error {
+		list, err := cli.ContainerList(ctx, types.ContainerListOptions{All: true})
+		if err != nil {
+			return err
+		}
+
+		for _, c := range list {
+			container, err := cli.ContainerInspect(ctx, c.ID)
+			if err != nil {
+				if client.IsErrNotFound(err) {
+					continue
+				}
+
+				return err
+			}
+
+			containers = append(containers, container)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return BuildDependencyGraph(containers), nil
+}
+
+// BuildDependencyGraph computes the dependency graph of the containers from their links, Compose depends_on labels,
+// network modes, volumes_from and the networks and volumes they share
+func BuildDependencyGraph(containers []types.ContainerJSON) *DependencyGraph {
+	graph := &DependencyGraph{
+		Nodes: []DependencyNode{},
+		Edges: []DependencyEdge{},
+	}
+
+	containers = append([]types.ContainerJSON{}, containers...)
+	sort.Slice(containers, func(i, j int) bool {
+		return containers[i].Name < containers[j].Name
+	})
+
+	names := map[string]string{}
+	services := map[string][]string{}
+	for _, c := range containers {
+		name := strings.TrimPrefix(c.Name, "/")
+		names[name] = c.ID
+
+		labels := containerLabels(c)
+		stack := labels[ComposeProjectLabel]
+		if stack == "" {
+			stack = labels[ServiceNameLabel]
+		}
+
+		if service := labels[composeServiceLabel]; service != "" {
+			services[stack+"/"+service] = append(services[stack+"/"+service], c.ID)
+		}
+
+		graph.Nodes = append(graph.Nodes, DependencyNode{ID: c.ID, Name: name, Stack: stack})
+	}
+
+	resolve := func(reference string) string {
+		reference = strings.TrimPrefix(reference, "/")
+		if id, ok := names[reference]; ok {
+			return id
+		}
+
+		for _, c := range containers {
+			if strings.HasPrefix(c.ID, reference) {
+				return c.ID
+			}
+		}
+
+		return ""
+	}
+
+	addEdge := func(from, to, kind, resource string) {
+		if to != "" && to != from {
+			graph.Edges = append(graph.Edges, DependencyEdge{From: from, To: to, Kind: kind, Resource: resource})
+		}
+	}
+
+	networks := map[string][]string{}
+	volumes := map[string][]string{}
+
+	for _, c := range containers {
+		if c.HostConfig != nil {
+			// Links are formatted as "/target:/container/alias"
+			for _, link := range c.HostConfig.Links {
+				target, alias, _ := strings.Cut(link, ":")
+				addEdge(c.ID, resolve(target), DependencyLink, path.Base(alias))
+			}
+
+			if reference, ok := strings.CutPrefix(string(c.HostConfig.NetworkMode), "container:"); ok {
+				addEdge(c.ID, resolve(reference), DependencyNetworkMode, "")
+			}
+
+			for _, volumesFrom := range c.HostConfig.VolumesFrom {
+				reference, _, _ := strings.Cut(volumesFrom, ":")
+				addEdge(c.ID, resolve(reference), DependencyVolumesFrom, "")
+			}
+		}
+
+		labels := containerLabels(c)
+		if dependsOn := labels[composeDependsOnLabel]; dependsOn != "" {
+			for _, dependency := range strings.Split(dependsOn, ",") {
+				service, _, _ := strings.Cut(dependency, ":")
+				for _, id := range services[labels[ComposeProjectLabel]+"/"+service] {
+					addEdge(c.ID, id, DependencyDependsOn, service)
+				}
+			}
+		}
+
+		if c.NetworkSettings != nil {
+			for network := range c.NetworkSettings.Networks {
+				switch network {
+				case "bridge", "host", "none":
+					continue
+				}
+
+				networks[network] = append(networks[network], c.ID)
+			}
+		}
+
+		for _, m := range c.Mounts {
+			if m.Type == "volume" && m.Name != "" {
+				volumes[m.Name] = append(volumes[m.Name], c.ID)
+			}
+		}
+	}
+
+	for _, shared := range []struct {
+		kind      string
+		resources map[string][]string
+	}{
+		{DependencyNetwork, networks},
+		{DependencyVolume, volumes},
+	} {
+		resourceNames := make([]string, 0, len(shared.resources))
+		for name := range shared.resources {
+			resourceNames = append(resourceNames, name)
+		}
+		sort.Strings(resourceNames)
+
+		for _, name := range resourceNames {
+			ids := shared.resources[name]
+			for i := range ids {
+				for j := i + 1; j < len(ids); j++ {
+					addEdge(ids[i], ids[j], shared.kind, name)
+				}
+			}
+		}
+	}
+
+	return graph
+}
+
+// Dependents returns the containers depending directly or transitively on the container, which are impacted when
+// it is stopped or restarted. Only the directed dependencies are followed.
+func (graph *DependencyGraph) Dependents(id string) []DependencyNode {
+	nodes := map[string]DependencyNode{}
+	for _, node := range graph.Nodes {
+		nodes[node.ID] = node
+	}
+
+	dependents := []DependencyNode{}
+	visited := map[string]bool{id: true}
+	queue := []string{id}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, edge := range graph.Edges {
+			if edge.To != current || visited[edge.From] || !isDirectedDependency(edge.Kind) {
+				continue
+			}
+
+			visited[edge.From] = true
+			queue = append(queue, edge.From)
+			dependents = append(dependents, nodes[edge.From])
+		}
+	}
+
+	return dependents
+}
+
+func isDirectedDependency(kind string) bool {
+	switch kind {
+	case DependencyLink, DependencyDependsOn, DependencyNetworkMode, DependencyVolumesFrom:
+		return true
+	}
+
+	return false
+}
+
+func containerLabels(c types.ContainerJSON) map[string]string {
+	if c.Config == nil {
+		return nil
+	}
+
+	return c.Config.Labels
+}
@@ -0,0 +1,75 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+)
+
+func dependencyTestContainer(id, name string, labels map[string]string, hostConfig *container.HostConfig, networks ...string) types.ContainerJSON {
+	if hostConfig == nil {
+		hostConfig = &container.HostConfig{}
+	}
+
+	settings := &types.NetworkSettings{Networks: map[string]*network.EndpointSettings{}}
+	for _, n := range networks {
+		settings.Networks[n] = &network.EndpointSettings{}
+	}
+
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{ID: id, Name: "/" + name, HostConfig: hostConfig},
+		Config:            &container.Config{Labels: labels},
+		NetworkSettings:   settings,
+	}
+}
+
+func TestBuildDependencyGraph(t *testing.T) {
+	web := dependencyTestContainer("web1", "app-web-1", map[string]string{
+		ComposeProjectLabel:   "app",
+		composeServiceLabel:   "web",
+		composeDependsOnLabel: "db:service_healthy:true",
+	}, &container.HostConfig{Links: []string{"/cache:/app-web-1/redis"}}, "app_default", "bridge")
+
+	db := dependencyTestContainer("db1", "app-db-1", map[string]string{
+		ComposeProjectLabel: "app",
+		composeServiceLabel: "db",
+	}, nil, "app_default")
+
+	cache := dependencyTestContainer("cache1", "cache", nil, nil, "bridge")
+
+	sidecar := dependencyTestContainer("sidecar1", "sidecar", nil, &container.HostConfig{NetworkMode: "container:web1"})
+
+	graph := BuildDependencyGraph([]types.ContainerJSON{web, db, cache, sidecar})
+
+	if len(graph.Nodes) != 4 {
+		t.Fatalf("expected 4 nodes, got %d", len(graph.Nodes))
+	}
+
+	expected := map[DependencyEdge]bool{
+		{From: "web1", To: "cache1", Kind: DependencyLink, Resource: "redis"}:       true,
+		{From: "web1", To: "db1", Kind: DependencyDependsOn, Resource: "db"}:        true,
+		{From: "sidecar1", To: "web1", Kind: DependencyNetworkMode}:                 true,
+		{From: "db1", To: "web1", Kind: DependencyNetwork, Resource: "app_default"}: true,
+	}
+
+	if len(graph.Edges) != len(expected) {
+		t.Fatalf("expected %d edges, got %v", len(expected), graph.Edges)
+	}
+
+	for _, edge := range graph.Edges {
+		if !expected[edge] {
+			t.Errorf("unexpected edge %+v", edge)
+		}
+	}
+
+	dependents := graph.Dependents("db1")
+	if len(dependents) != 2 || dependents[0].ID != "web1" || dependents[1].ID != "sidecar1" {
+		t.Errorf("unexpected dependents of db1: %+v", dependents)
+	}
+
+	if dependents := graph.Dependents("sidecar1"); len(dependents) != 0 {
+		t.Errorf("expected no dependents of sidecar1, got %+v", dependents)
+	}
+}
@@ -0,0 +1,323 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+)
+
+// Kinds of the devices passed to the containers
+const (
+	DeviceKindSerial    = "serial"
+	DeviceKindBluetooth = "bluetooth"
+	DeviceKindUSB       = "usb"
+	DeviceKindGPIO      = "gpio"
+	DeviceKindI2C       = "i2c"
+	DeviceKindSPI       = "spi"
+	DeviceKindVideo     = "video"
+	DeviceKindOther     = "other"
+)
+
+// bluetoothAdaptersPath lists the Bluetooth adapters of the host, the containers using Bluetooth through BlueZ do not
+// map a device file but require an adapter
+const bluetoothAdaptersPath = "/sys/class/bluetooth"
+
+// ignoredDevices are the device files that are always present and are not reported
+var ignoredDevices = map[string]bool{
+	"/dev":         true,
+	"/dev/null":    true,
+	"/dev/zero":    true,
+	"/dev/full":    true,
+	"/dev/random":  true,
+	"/dev/urandom": true,
+	"/dev/tty":     true,
+	"/dev/console": true,
+	"/dev/shm":     true,
+	"/dev/mqueue":  true,
+	"/dev/log":     true,
+	"/dev/kmsg":    true,
+	"/dev/fuse":    true,
+}
+
+// devicesMissingSince records when the devices of the containers were first found missing, to report how long the
+// containers have been without them after an unplug
+var devicesMissingSince = struct {
+	mu    sync.Mutex
+	paths map[string]time.Time
+}{paths: map[string]time.Time{}}
+
+// PassthroughDevice represents a device of the host passed to a container
+type PassthroughDevice struct {
+	Path string `json:"Path"`
+	Kind string `json:"Kind"`
+	// Present is false when the device no longer exists on the host
+	Present bool `json:"Present"`
+	// Healthy is false when the path exists but is not a device, Docker creates an empty directory when the source
+	// of a bind mount is missing
+	Healthy      bool       `json:"Healthy"`
+	MissingSince *time.Time `json:"MissingSince,omitempty"`
+}
+
+// DeviceContainer represents a container holding devices of the host
+type DeviceContainer struct {
+	ID      string              `json:"Id"`
+	Name    string              `json:"Name"`
+	State   string              `json:"State"`
+	Devices []PassthroughDevice `json:"Devices"`
+}
+
+// DeviceInventory represents the devices of the host passed to the containers
+type DeviceInventory struct {
+	BluetoothAdapters []string          `json:"BluetoothAdapters,omitempty"`
+	Containers        []DeviceContainer `json:"Containers"`
+}
+
+// GetDeviceInventory returns the containers holding serial, Bluetooth, USB and other devices of the host, mapped as
+// devices or bind mounted, and whether the devices are still present. It returns nil when no container holds a
+// device. The GPUs are reported by GetGPUInventory.
+func GetDeviceInventory(ctx context.Context) (*DeviceInventory, error) {
+	inventory := &DeviceInventory{
+		BluetoothAdapters: bluetoothAdapters(agent.HostRoot),
+		Containers:        []DeviceContainer{},
+	}
+
+	err := withCli(func(cli *client.Client) error {
+		list, err := cli.ContainerList(ctx, types.ContainerListOptions{All: true})
+		if err != nil {
+			return err
+		}
+
+		ids := make([]string, 0, len(list))
+		for _, c := range list {
+			ids = append(ids, c.ID)
+		}
+
+		var mu sync.Mutex
+
+		runBatch(ids, snapshotConcurrency, func(id string) error {
+			inspect, err := cli.ContainerInspect(ctx, id)
+			if err != nil {
+				return err
+			}
+
+			paths := containerDevices(inspect.HostConfig)
+			if len(paths) == 0 {
+				return nil
+			}
+
+			c := DeviceContainer{
+				ID:   inspect.ID,
+				Name: strings.TrimPrefix(inspect.Name, "/"),
+			}
+
+			if inspect.State != nil {
+				c.State = inspect.State.Status
+			}
+
+			for _, path := range paths {
+				c.Devices = append(c.Devices, checkDevice(agent.HostRoot, path, len(inventory.BluetoothAdapters) > 0))
+			}
+
+			mu.Lock()
+			inventory.Containers = append(inventory.Containers, c)
+			mu.Unlock()
+
+			return nil
+		})
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(inventory.Containers) == 0 {
+		return nil, nil
+	}
+
+	sort.Slice(inventory.Containers, func(i, j int) bool {
+		return inventory.Containers[i].Name < inventory.Containers[j].Name
+	})
+
+	return inventory, nil
+}
+
+// Diagnostics returns a diagnostic message for each container whose devices are missing or unhealthy
+func (inventory *DeviceInventory) Diagnostics() []string {
+	if inventory == nil {
+		return nil
+	}
+
+	var diagnostics []string
+	for _, c := range inventory.Containers {
+		for _, device := range c.Devices {
+			switch {
+			case !device.Present:
+				diagnostics = append(diagnostics, fmt.Sprintf("device missing: %s required by the container %s is no longer present on the host", device.Path, c.Name))
+			case !device.Healthy:
+				diagnostics = append(diagnostics, fmt.Sprintf("device unhealthy: %s required by the container %s is not a device", device.Path, c.Name))
+			}
+		}
+	}
+
+	return diagnostics
+}
+
+// containerDevices returns the devices of the host mapped in a container or bind mounted in it, sorted. The
+// containers sharing the D-Bus socket of the host with the NET_ADMIN capability use Bluetooth through BlueZ, they
+// require the Bluetooth adapters of the host.
+func containerDevices(hostConfig *container.HostConfig) []string {
+	if hostConfig == nil {
+		return nil
+	}
+
+	paths := map[string]bool{}
+	add := func(path string) {
+		path = filepath.Clean(path)
+		if strings.HasPrefix(path, "/dev/") && !ignoredDevices[path] && !isGPUDevice(path) {
+			paths[path] = true
+		}
+	}
+
+	for _, device := range hostConfig.Devices {
+		add(device.PathOnHost)
+	}
+
+	dbus := false
+	for _, bind := range hostConfig.Binds {
+		source, _, _ := strings.Cut(bind, ":")
+		add(source)
+
+		dbus = dbus || isDBusSocket(source)
+	}
+
+	for _, m := range hostConfig.Mounts {
+		if m.Type == mount.TypeBind {
+			add(m.Source)
+
+			dbus = dbus || isDBusSocket(m.Source)
+		}
+	}
+
+	if dbus && hasCapability(hostConfig.CapAdd, "NET_ADMIN") {
+		paths[bluetoothAdaptersPath] = true
+	}
+
+	result := make([]string, 0, len(paths))
+	for path := range paths {
+		result = append(result, path)
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+func isDBusSocket(path string) bool {
+	path = filepath.Clean(path)
+
+	return path == "/run/dbus" || path == "/var/run/dbus" || path == "/run/dbus/system_bus_socket" || path == "/var/run/dbus/system_bus_socket"
+}
+
+func hasCapability(capabilities []string, capability string) bool {
+	for _, c := range capabilities {
+		if strings.TrimPrefix(strings.ToUpper(c), "CAP_") == capability || strings.ToUpper(c) == "ALL" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkDevice returns the state of the device at path on the host mounted at root and records when it went missing
+func checkDevice(root, path string, bluetoothAdapter bool) PassthroughDevice {
+	device := PassthroughDevice{Path: path, Kind: deviceKind(path)}
+
+	if path == bluetoothAdaptersPath {
+		device.Present = bluetoothAdapter
+		device.Healthy = bluetoothAdapter
+	} else if info, err := os.Stat(filepath.Join(root, path)); err == nil {
+		device.Present = true
+		device.Healthy = info.Mode()&os.ModeDevice != 0 || (info.IsDir() && !isEmptyDir(filepath.Join(root, path)))
+	}
+
+	devicesMissingSince.mu.Lock()
+	defer devicesMissingSince.mu.Unlock()
+
+	if device.Healthy {
+		delete(devicesMissingSince.paths, path)
+
+		return device
+	}
+
+	since, ok := devicesMissingSince.paths[path]
+	if !ok {
+		since = time.Now()
+		devicesMissingSince.paths[path] = since
+	}
+
+	device.MissingSince = &since
+
+	return device
+}
+
+func isEmptyDir(path string) bool {
+	entries, err := os.ReadDir(path)
+
+	return err == nil && len(entries) == 0
+}
+
+// deviceKind returns the kind of the device at path, from the naming of the device files by the kernel and udev
+func deviceKind(path string) string {
+	name := strings.TrimPrefix(path, "/dev/")
+
+	switch {
+	case path == bluetoothAdaptersPath, strings.HasPrefix(name, "rfcomm"), name == "vhci":
+		return DeviceKindBluetooth
+	case strings.HasPrefix(name, "ttyUSB"), strings.HasPrefix(name, "ttyACM"), strings.HasPrefix(name, "ttyAMA"),
+		strings.HasPrefix(name, "ttyS"), strings.HasPrefix(name, "serial"):
+		return DeviceKindSerial
+	case strings.HasPrefix(name, "bus/usb"), strings.HasPrefix(name, "hidraw"):
+		return DeviceKindUSB
+	case strings.HasPrefix(name, "gpio"):
+		return DeviceKindGPIO
+	case strings.HasPrefix(name, "i2c-"):
+		return DeviceKindI2C
+	case strings.HasPrefix(name, "spidev"):
+		return DeviceKindSPI
+	case strings.HasPrefix(name, "video"), strings.HasPrefix(name, "media"):
+		return DeviceKindVideo
+	}
+
+	return DeviceKindOther
+}
+
+// bluetoothAdapters returns the names of the Bluetooth adapters of the host mounted at root
+func bluetoothAdapters(root string) []string {
+	adapters, err := filepath.Glob(filepath.Join(root, bluetoothAdaptersPath, "hci*"))
+	if err != nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(adapters))
+	for _, adapter := range adapters {
+		// the connections of the adapters are listed as hci0:12
+		if name := filepath.Base(adapter); !strings.Contains(name, ":") {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,74 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+)
+
+func TestContainerDevices(t *testing.T) {
+	hostConfig := &container.HostConfig{}
+	hostConfig.Devices = []container.DeviceMapping{
+		{PathOnHost: "/dev/ttyUSB0"},
+		{PathOnHost: "/dev/dri/renderD128"},
+	}
+	hostConfig.Binds = []string{"/dev/serial/by-id/usb-FTDI-if00:/dev/zigbee", "/dev/null:/dev/null", "/run/dbus:/run/dbus:ro", "data:/data"}
+	hostConfig.Mounts = []mount.Mount{{Type: mount.TypeBind, Source: "/dev/i2c-1"}, {Type: mount.TypeVolume, Source: "/dev/sda"}}
+	hostConfig.CapAdd = []string{"CAP_NET_ADMIN"}
+
+	expected := []string{"/dev/i2c-1", "/dev/serial/by-id/usb-FTDI-if00", "/dev/ttyUSB0", bluetoothAdaptersPath}
+	if paths := containerDevices(hostConfig); !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected %v, got %v", expected, paths)
+	}
+
+	if paths := containerDevices(&container.HostConfig{Binds: []string{"/var/run/dbus:/var/run/dbus"}}); len(paths) != 0 {
+		t.Errorf("expected no device without the NET_ADMIN capability, got %v", paths)
+	}
+}
+
+func TestCheckDevice(t *testing.T) {
+	root := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(root, "dev", "ttyUSB1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// device files cannot be created without privileges, a symbolic link to the null device of the test host is
+	// followed instead
+	if err := os.Symlink("/dev/null", filepath.Join(root, "dev", "ttyUSB0")); err != nil {
+		t.Fatal(err)
+	}
+
+	present := checkDevice(root, "/dev/ttyUSB0", false)
+	if !present.Present || !present.Healthy || present.MissingSince != nil || present.Kind != DeviceKindSerial {
+		t.Errorf("unexpected state of the present device: %+v", present)
+	}
+
+	// Docker creates an empty directory when the source of a bind mount is missing
+	unhealthy := checkDevice(root, "/dev/ttyUSB1", false)
+	if !unhealthy.Present || unhealthy.Healthy || unhealthy.MissingSince == nil {
+		t.Errorf("unexpected state of the unhealthy device: %+v", unhealthy)
+	}
+
+	missing := checkDevice(root, "/dev/ttyACM0", false)
+	if missing.Present || missing.MissingSince == nil {
+		t.Fatalf("unexpected state of the missing device: %+v", missing)
+	}
+
+	if again := checkDevice(root, "/dev/ttyACM0", false); !again.MissingSince.Equal(*missing.MissingSince) {
+		t.Errorf("expected the device to be missing since %v, got %v", missing.MissingSince, again.MissingSince)
+	}
+
+	if bluetooth := checkDevice(root, bluetoothAdaptersPath, true); !bluetooth.Healthy || bluetooth.Kind != DeviceKindBluetooth {
+		t.Errorf("unexpected state of the Bluetooth adapters: %+v", bluetooth)
+	}
+
+	inventory := &DeviceInventory{Containers: []DeviceContainer{{Name: "sensors", Devices: []PassthroughDevice{present, unhealthy, missing}}}}
+	if diagnostics := inventory.Diagnostics(); len(diagnostics) != 2 {
+		t.Errorf("expected 2 diagnostics, got %v", diagnostics)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/portainer/agent"
+	"github.com/portainer/agent/faults"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
@@ -152,6 +153,14 @@ func getSwarmConfiguration(config *agent.RuntimeConfiguration, dockerInfo types.
 }
 
 func NewClient() (*client.Client, error) {
+	// an injected hang of the daemon lasts until the timeout of the client
+	ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
+	defer cancel()
+
+	if err := faults.Hang(ctx, faults.DockerHang); err != nil {
+		return nil, err
+	}
+
 	return client.NewClientWithOpts(
 		client.FromEnv,
 		client.WithAPIVersionNegotiation(),
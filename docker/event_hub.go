@@ -0,0 +1,146 @@
+package docker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// eventSubscriberBuffer is the number of events queued for a subscriber, a subscriber falling further behind is
+	// closed
+	eventSubscriberBuffer = 64
+	eventHubRetryInterval = 10 * time.Second
+)
+
+// eventActions are the actions of the events relayed to the subscribers, by type of resource. These events change
+// the content of the snapshots.
+var eventActions = map[events.Type]map[string]struct{}{
+	events.ContainerEventType: {"create": {}, "start": {}, "stop": {}, "die": {}, "destroy": {}, "pause": {}, "unpause": {}},
+	events.ImageEventType:     {"pull": {}, "delete": {}, "tag": {}, "untag": {}},
+	events.VolumeEventType:    {"create": {}, "destroy": {}},
+	events.NetworkEventType:   {"create": {}, "destroy": {}},
+}
+
+var defaultEventHub = &eventHub{subscribers: map[*eventSubscriber]struct{}{}}
+
+// Event represents a change of a resource of the Docker engine
+type Event struct {
+	Type   string    `json:"Type"`
+	Action string    `json:"Action"`
+	ID     string    `json:"Id"`
+	Name   string    `json:"Name,omitempty"`
+	Time   time.Time `json:"Time"`
+}
+
+// eventHub relays a single stream of Docker events, opened with the first subscription, to all the subscribers
+type eventHub struct {
+	once        sync.Once
+	mu          sync.Mutex
+	subscribers map[*eventSubscriber]struct{}
+}
+
+type eventSubscriber struct {
+	types  map[string]struct{}
+	events chan Event
+}
+
+// SubscribeEvents returns a channel receiving the changes of the containers, images, volumes and networks of the
+// engine, limited to the given types of resource when not empty. The channel is closed when the subscriber does not
+// keep up with the events, it must then refresh its view of the engine. The returned function ends the subscription.
+func SubscribeEvents(types []string) (<-chan Event, func()) {
+	return defaultEventHub.subscribe(types)
+}
+
+func (hub *eventHub) subscribe(types []string) (<-chan Event, func()) {
+	hub.once.Do(func() {
+		go hub.run(context.Background())
+	})
+
+	subscriber := &eventSubscriber{
+		types:  map[string]struct{}{},
+		events: make(chan Event, eventSubscriberBuffer),
+	}
+
+	for _, t := range types {
+		subscriber.types[t] = struct{}{}
+	}
+
+	hub.mu.Lock()
+	hub.subscribers[subscriber] = struct{}{}
+	hub.mu.Unlock()
+
+	return subscriber.events, func() {
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+
+		if _, ok := hub.subscribers[subscriber]; ok {
+			delete(hub.subscribers, subscriber)
+			close(subscriber.events)
+		}
+	}
+}
+
+func (hub *eventHub) run(ctx context.Context) {
+	for {
+		err := WatchEvents(ctx, func(message events.Message) {
+			if event, ok := newEvent(message); ok {
+				hub.publish(event)
+			}
+		})
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Warn().Err(err).Msg("the stream of Docker events relayed to the subscribers failed")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(eventHubRetryInterval):
+		}
+	}
+}
+
+func (hub *eventHub) publish(event Event) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	for subscriber := range hub.subscribers {
+		if len(subscriber.types) > 0 {
+			if _, ok := subscriber.types[event.Type]; !ok {
+				continue
+			}
+		}
+
+		select {
+		case subscriber.events <- event:
+		default:
+			delete(hub.subscribers, subscriber)
+			close(subscriber.events)
+		}
+	}
+}
+
+func newEvent(message events.Message) (Event, bool) {
+	actions, ok := eventActions[message.Type]
+	if !ok {
+		return Event{}, false
+	}
+
+	if _, ok := actions[message.Action]; !ok {
+		return Event{}, false
+	}
+
+	return Event{
+		Type:   message.Type,
+		Action: message.Action,
+		ID:     message.Actor.ID,
+		Name:   message.Actor.Attributes["name"],
+		Time:   time.Unix(0, message.TimeNano),
+	}, true
+}
@@ -0,0 +1,93 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+func newTestEventHub() *eventHub {
+	hub := &eventHub{subscribers: map[*eventSubscriber]struct{}{}}
+	// The stream of events is not opened by the tests
+	hub.once.Do(func() {})
+
+	return hub
+}
+
+func TestNewEvent(t *testing.T) {
+	message := events.Message{
+		Type:     events.ContainerEventType,
+		Action:   "start",
+		Actor:    events.Actor{ID: "abc", Attributes: map[string]string{"name": "web"}},
+		TimeNano: 1e9,
+	}
+
+	event, ok := newEvent(message)
+	if !ok {
+		t.Fatal("expected the container start event to be relayed")
+	}
+
+	if event.Type != "container" || event.Action != "start" || event.ID != "abc" || event.Name != "web" || event.Time.Unix() != 1 {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+
+	message.Action = "exec_start"
+	if _, ok := newEvent(message); ok {
+		t.Fatal("expected the exec event to be ignored")
+	}
+
+	message.Type = events.PluginEventType
+	if _, ok := newEvent(message); ok {
+		t.Fatal("expected the plugin event to be ignored")
+	}
+}
+
+func TestEventHubPublish(t *testing.T) {
+	hub := newTestEventHub()
+
+	all, unsubscribeAll := hub.subscribe(nil)
+	defer unsubscribeAll()
+
+	images, unsubscribeImages := hub.subscribe([]string{"image"})
+	defer unsubscribeImages()
+
+	hub.publish(Event{Type: "container", Action: "die", ID: "abc"})
+	hub.publish(Event{Type: "image", Action: "pull", ID: "nginx"})
+
+	if event := <-all; event.Type != "container" {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+
+	if event := <-all; event.Type != "image" {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+
+	if event := <-images; event.Type != "image" {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+
+	if len(images) != 0 {
+		t.Fatal("expected the container event to be filtered out")
+	}
+}
+
+func TestEventHubSlowSubscriber(t *testing.T) {
+	hub := newTestEventHub()
+
+	slow, unsubscribe := hub.subscribe(nil)
+
+	for i := 0; i <= eventSubscriberBuffer; i++ {
+		hub.publish(Event{Type: "container", Action: "start"})
+	}
+
+	for i := 0; i < eventSubscriberBuffer; i++ {
+		<-slow
+	}
+
+	if _, ok := <-slow; ok {
+		t.Fatal("expected the subscriber falling behind to be closed")
+	}
+
+	// Ending the subscription of a closed subscriber must not panic
+	unsubscribe()
+}
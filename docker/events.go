@@ -0,0 +1,25 @@
+package docker
+
+import (
+	"context"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/client"
+)
+
+// WatchEvents calls fn with each event emitted by the Docker engine until ctx is done or the stream fails
+func WatchEvents(ctx context.Context, fn func(events.Message)) error {
+	return withCli(func(cli *client.Client) error {
+		messages, errs := cli.Events(ctx, types.EventsOptions{})
+
+		for {
+			select {
+			case message := <-messages:
+				fn(message)
+			case err := <-errs:
+				return err
+			}
+		}
+	})
+}
@@ -0,0 +1,271 @@
+package docker
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/portainer/agent"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// Vendors of the GPUs discovered on the host
+const (
+	GPUVendorNVIDIA = "nvidia"
+	GPUVendorAMD    = "amd"
+)
+
+// nvidiaRuntime is the name of the runtime registered by the NVIDIA Container Toolkit
+const nvidiaRuntime = "nvidia"
+
+// PCI vendor identifiers of the GPU vendors
+var gpuVendorIDs = map[string]string{
+	"0x10de": GPUVendorNVIDIA,
+	"0x1002": GPUVendorAMD,
+}
+
+// GPU represents a GPU of the host
+type GPU struct {
+	// ID is the UUID of the NVIDIA GPUs, the PCI address of the other GPUs
+	ID      string `json:"Id"`
+	Vendor  string `json:"Vendor"`
+	Model   string `json:"Model"`
+	Address string `json:"Address"`
+}
+
+// GPUContainer represents a running container bound to GPUs
+type GPUContainer struct {
+	ID   string `json:"Id"`
+	Name string `json:"Name"`
+	// DeviceIDs are the GPUs requested by the container, as indexes or UUIDs, or the GPU device files mapped in it
+	DeviceIDs []string `json:"DeviceIds,omitempty"`
+	// All is true when the container requested all the GPUs of the host
+	All bool `json:"All"`
+}
+
+// GPUInventory represents the GPUs of the host and the containers using them
+type GPUInventory struct {
+	// NvidiaRuntime is true when the NVIDIA runtime is registered in the Docker engine
+	NvidiaRuntime bool           `json:"NvidiaRuntime"`
+	Count         int            `json:"Count"`
+	GPUs          []GPU          `json:"GPUs"`
+	Containers    []GPUContainer `json:"Containers"`
+}
+
+// GetGPUInventory returns the GPUs of the host, read from the host filesystem mounted in the agent container, and the
+// running containers bound to GPUs. It returns nil when the host has no GPU and no container uses one.
+func GetGPUInventory(ctx context.Context) (*GPUInventory, error) {
+	inventory := &GPUInventory{
+		GPUs:       hostGPUs(agent.HostRoot),
+		Containers: []GPUContainer{},
+	}
+	inventory.Count = len(inventory.GPUs)
+
+	err := withCli(func(cli *client.Client) error {
+		info, err := cli.Info(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, inventory.NvidiaRuntime = info.Runtimes[nvidiaRuntime]
+		inventory.NvidiaRuntime = inventory.NvidiaRuntime || info.DefaultRuntime == nvidiaRuntime
+
+		list, err := cli.ContainerList(ctx, types.ContainerListOptions{
+			Filters: filters.NewArgs(filters.Arg("status", "running")),
+		})
+		if err != nil {
+			return err
+		}
+
+		ids := make([]string, 0, len(list))
+		for _, c := range list {
+			ids = append(ids, c.ID)
+		}
+
+		var mu sync.Mutex
+
+		runBatch(ids, snapshotConcurrency, func(id string) error {
+			inspect, err := cli.ContainerInspect(ctx, id)
+			if err != nil {
+				return err
+			}
+
+			deviceIDs, all, bound := containerGPUs(inspect.HostConfig)
+			if !bound {
+				return nil
+			}
+
+			mu.Lock()
+			inventory.Containers = append(inventory.Containers, GPUContainer{
+				ID:        inspect.ID,
+				Name:      strings.TrimPrefix(inspect.Name, "/"),
+				DeviceIDs: deviceIDs,
+				All:       all,
+			})
+			mu.Unlock()
+
+			return nil
+		})
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if inventory.Count == 0 && len(inventory.Containers) == 0 && !inventory.NvidiaRuntime {
+		return nil, nil
+	}
+
+	sort.Slice(inventory.Containers, func(i, j int) bool {
+		return inventory.Containers[i].Name < inventory.Containers[j].Name
+	})
+
+	return inventory, nil
+}
+
+// containerGPUs returns the GPUs requested by a container with a device request (--gpus) or mapped as devices, as
+// done for the AMD GPUs. all is true when all the GPUs are requested, bound is true when the container uses a GPU.
+func containerGPUs(hostConfig *container.HostConfig) (deviceIDs []string, all bool, bound bool) {
+	if hostConfig == nil {
+		return nil, false, false
+	}
+
+	for _, request := range hostConfig.DeviceRequests {
+		if !isGPURequest(request) {
+			continue
+		}
+
+		bound = true
+		if request.Count == -1 {
+			all = true
+		}
+
+		deviceIDs = append(deviceIDs, request.DeviceIDs...)
+	}
+
+	for _, device := range hostConfig.Devices {
+		if isGPUDevice(device.PathOnHost) {
+			bound = true
+			deviceIDs = append(deviceIDs, device.PathOnHost)
+		}
+	}
+
+	return deviceIDs, all, bound
+}
+
+func isGPURequest(request container.DeviceRequest) bool {
+	if request.Driver == nvidiaRuntime {
+		return true
+	}
+
+	for _, capabilities := range request.Capabilities {
+		for _, capability := range capabilities {
+			if capability == "gpu" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// isGPUDevice returns true when path is a device file giving access to a GPU: the NVIDIA devices, the DRM devices
+// and the AMD compute device
+func isGPUDevice(path string) bool {
+	name := strings.TrimPrefix(path, "/dev/")
+	if name == path {
+		return false
+	}
+
+	switch {
+	case name == "kfd", name == "dri", strings.HasPrefix(name, "dri/"):
+		return true
+	case strings.HasPrefix(name, "nvidia"):
+		suffix := strings.TrimPrefix(name, "nvidia")
+		return suffix != "" && strings.Trim(suffix, "0123456789") == ""
+	}
+
+	return false
+}
+
+// hostGPUs returns the NVIDIA and AMD display controllers listed in the PCI devices of the host mounted at root
+func hostGPUs(root string) []GPU {
+	devices, err := filepath.Glob(filepath.Join(root, "sys", "bus", "pci", "devices", "*"))
+	if err != nil {
+		return nil
+	}
+
+	gpus := []GPU{}
+	for _, device := range devices {
+		// The class of the display controllers starts with 0x03
+		if !strings.HasPrefix(readSysfsValue(filepath.Join(device, "class")), "0x03") {
+			continue
+		}
+
+		vendor, ok := gpuVendorIDs[readSysfsValue(filepath.Join(device, "vendor"))]
+		if !ok {
+			continue
+		}
+
+		address := filepath.Base(device)
+		gpu := GPU{ID: address, Vendor: vendor, Address: address}
+
+		switch vendor {
+		case GPUVendorNVIDIA:
+			information := readNvidiaInformation(filepath.Join(root, "proc", "driver", "nvidia", "gpus", address, "information"))
+			gpu.Model = information["Model"]
+			if uuid := information["GPU UUID"]; uuid != "" {
+				gpu.ID = uuid
+			}
+		case GPUVendorAMD:
+			gpu.Model = readSysfsValue(filepath.Join(device, "product_name"))
+		}
+
+		if gpu.Model == "" {
+			gpu.Model = strings.ToUpper(vendor) + " " + readSysfsValue(filepath.Join(device, "device"))
+		}
+
+		gpus = append(gpus, gpu)
+	}
+
+	return gpus
+}
+
+func readSysfsValue(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(data))
+}
+
+// readNvidiaInformation parses the "Key: value" lines of the information file of a GPU exposed by the NVIDIA driver
+func readNvidiaInformation(path string) map[string]string {
+	information := map[string]string{}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return information
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if ok {
+			information[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+
+	return information
+}
@@ -0,0 +1,77 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestHostGPUs(t *testing.T) {
+	root := t.TempDir()
+
+	writeFile := func(path, content string) {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	nvidia := "sys/bus/pci/devices/0000:00:1e.0/"
+	writeFile(nvidia+"class", "0x030200\n")
+	writeFile(nvidia+"vendor", "0x10de\n")
+	writeFile("proc/driver/nvidia/gpus/0000:00:1e.0/information", "Model: \t\t Tesla T4\nGPU UUID: \t GPU-1234\nBus Location: \t 0000:00:1e.0\n")
+
+	amd := "sys/bus/pci/devices/0000:03:00.0/"
+	writeFile(amd+"class", "0x030000\n")
+	writeFile(amd+"vendor", "0x1002\n")
+	writeFile(amd+"device", "0x73bf\n")
+
+	network := "sys/bus/pci/devices/0000:00:03.0/"
+	writeFile(network+"class", "0x020000\n")
+	writeFile(network+"vendor", "0x10de\n")
+
+	gpus := hostGPUs(root)
+	if len(gpus) != 2 {
+		t.Fatalf("expected 2 GPUs, got %+v", gpus)
+	}
+
+	if gpus[0].ID != "GPU-1234" || gpus[0].Model != "Tesla T4" || gpus[0].Vendor != GPUVendorNVIDIA {
+		t.Errorf("unexpected NVIDIA GPU: %+v", gpus[0])
+	}
+
+	if gpus[1].ID != "0000:03:00.0" || gpus[1].Model != "AMD 0x73bf" || gpus[1].Vendor != GPUVendorAMD {
+		t.Errorf("unexpected AMD GPU: %+v", gpus[1])
+	}
+}
+
+func TestContainerGPUs(t *testing.T) {
+	hostConfig := &container.HostConfig{}
+	hostConfig.DeviceRequests = []container.DeviceRequest{
+		{Capabilities: [][]string{{"gpu"}}, DeviceIDs: []string{"0"}},
+		{Driver: "other", Count: -1},
+	}
+	hostConfig.Devices = []container.DeviceMapping{
+		{PathOnHost: "/dev/kfd"},
+		{PathOnHost: "/dev/nvidiactl"},
+		{PathOnHost: "/dev/ttyUSB0"},
+	}
+
+	deviceIDs, all, bound := containerGPUs(hostConfig)
+	if !bound || all {
+		t.Errorf("expected a container bound to some GPUs, got bound=%t all=%t", bound, all)
+	}
+
+	if len(deviceIDs) != 2 || deviceIDs[0] != "0" || deviceIDs[1] != "/dev/kfd" {
+		t.Errorf("unexpected device identifiers: %v", deviceIDs)
+	}
+
+	if _, _, bound := containerGPUs(&container.HostConfig{}); bound {
+		t.Error("expected a container without GPU")
+	}
+}
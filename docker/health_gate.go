@@ -0,0 +1,172 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/client"
+)
+
+// Health gate states, by order of severity
+const (
+	HealthGatePassed  = "passed"
+	HealthGatePending = "pending"
+	HealthGateFailed  = "failed"
+)
+
+// ServiceHealthGate represents the state of the health gate of a service of a stack
+type ServiceHealthGate struct {
+	Service string
+	State   string
+	Reason  string
+}
+
+// GetComposeStackHealthGates returns the health gate of each service of a Compose stack. The containers of a
+// service pass the gate once healthy, or once running for minUptime when they have no healthcheck.
+func GetComposeStackHealthGates(ctx context.Context, projectName string, minUptime time.Duration) ([]ServiceHealthGate, error) {
+	gates := []ServiceHealthGate{}
+
+	err := withCli(func(cli *client.Client) error {
+		containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
+			All:     true,
+			Filters: filters.NewArgs(filters.Arg("label", fmt.Sprintf("%s=%s", ComposeProjectLabel, projectName))),
+		})
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, c := range containers {
+			container, err := cli.ContainerInspect(ctx, c.ID)
+			if err != nil {
+				if client.IsErrNotFound(err) {
+					continue
+				}
+
+				return err
+			}
+
+			state, reason := containerHealthGate(container.State, minUptime, now)
+			gates = append(gates, ServiceHealthGate{Service: c.Labels[composeServiceLabel], State: state, Reason: reason})
+		}
+
+		return nil
+	})
+
+	return aggregateHealthGates(gates), err
+}
+
+// GetSwarmStackHealthGates returns the health gate of each service of a Swarm stack. The tasks of a service pass
+// the gate once running for minUptime, Swarm only considers the tasks with a healthcheck as running once healthy.
+func GetSwarmStackHealthGates(ctx context.Context, namespace string, minUptime time.Duration) ([]ServiceHealthGate, error) {
+	gates := []ServiceHealthGate{}
+
+	err := withCli(func(cli *client.Client) error {
+		services, err := cli.ServiceList(ctx, types.ServiceListOptions{
+			Filters: filters.NewArgs(filters.Arg("label", fmt.Sprintf("%s=%s", ServiceNameLabel, namespace))),
+		})
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, s := range services {
+			tasks, err := cli.TaskList(ctx, types.TaskListOptions{
+				Filters: filters.NewArgs(filters.Arg("service", s.ID), filters.Arg("desired-state", "running")),
+			})
+			if err != nil {
+				return err
+			}
+
+			if len(tasks) == 0 {
+				gates = append(gates, ServiceHealthGate{Service: s.Spec.Name, State: HealthGatePending, Reason: "no task scheduled"})
+			}
+
+			for _, task := range tasks {
+				state, reason := taskHealthGate(task.Status, minUptime, now)
+				gates = append(gates, ServiceHealthGate{Service: s.Spec.Name, State: state, Reason: reason})
+			}
+		}
+
+		return nil
+	})
+
+	return aggregateHealthGates(gates), err
+}
+
+func containerHealthGate(state *types.ContainerState, minUptime time.Duration, now time.Time) (string, string) {
+	switch {
+	case state == nil:
+		return HealthGatePending, "unknown state"
+	case state.Restarting:
+		return HealthGatePending, fmt.Sprintf("restarting after exiting with code %d", state.ExitCode)
+	case state.Health != nil && state.Health.Status == types.Unhealthy:
+		return HealthGateFailed, "unhealthy"
+	case state.Running && state.Health != nil:
+		if state.Health.Status == types.Healthy {
+			return HealthGatePassed, ""
+		}
+
+		return HealthGatePending, "health check " + state.Health.Status
+	case state.Running:
+		startedAt, err := time.Parse(time.RFC3339Nano, state.StartedAt)
+		if err == nil && now.Sub(startedAt) >= minUptime {
+			return HealthGatePassed, ""
+		}
+
+		return HealthGatePending, fmt.Sprintf("running for less than %s", minUptime)
+	case state.Status == "exited" && state.ExitCode == 0:
+		// One-shot services (e.g. migrations) complete successfully
+		return HealthGatePassed, ""
+	case state.Status == "exited" || state.Dead:
+		return HealthGateFailed, fmt.Sprintf("exited with code %d", state.ExitCode)
+	}
+
+	return HealthGatePending, state.Status
+}
+
+func taskHealthGate(status swarm.TaskStatus, minUptime time.Duration, now time.Time) (string, string) {
+	switch status.State {
+	case swarm.TaskStateRunning:
+		if now.Sub(status.Timestamp) >= minUptime {
+			return HealthGatePassed, ""
+		}
+
+		return HealthGatePending, fmt.Sprintf("running for less than %s", minUptime)
+	case swarm.TaskStateComplete:
+		return HealthGatePassed, ""
+	case swarm.TaskStateFailed, swarm.TaskStateRejected:
+		return HealthGateFailed, status.Err
+	}
+
+	return HealthGatePending, string(status.State)
+}
+
+// aggregateHealthGates keeps the most severe gate of each service, ordered by service name
+func aggregateHealthGates(gates []ServiceHealthGate) []ServiceHealthGate {
+	severity := map[string]int{HealthGatePassed: 0, HealthGatePending: 1, HealthGateFailed: 2}
+
+	services := map[string]ServiceHealthGate{}
+	for _, gate := range gates {
+		current, ok := services[gate.Service]
+		if !ok || severity[gate.State] > severity[current.State] {
+			services[gate.Service] = gate
+		}
+	}
+
+	aggregated := make([]ServiceHealthGate, 0, len(services))
+	for _, gate := range services {
+		aggregated = append(aggregated, gate)
+	}
+
+	sort.Slice(aggregated, func(i, j int) bool {
+		return aggregated[i].Service < aggregated[j].Service
+	})
+
+	return aggregated
+}
@@ -0,0 +1,59 @@
+package docker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestContainerHealthGate(t *testing.T) {
+	now := time.Date(2023, 9, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		state    *types.ContainerState
+		expected string
+	}{
+		{"healthy", &types.ContainerState{Status: "running", Running: true, Health: &types.Health{Status: types.Healthy}}, HealthGatePassed},
+		{"health check starting", &types.ContainerState{Status: "running", Running: true, Health: &types.Health{Status: types.Starting}}, HealthGatePending},
+		{"unhealthy", &types.ContainerState{Status: "running", Running: true, Health: &types.Health{Status: types.Unhealthy}}, HealthGateFailed},
+		{"running long enough", &types.ContainerState{Status: "running", Running: true, StartedAt: "2023-09-01T09:59:00Z"}, HealthGatePassed},
+		{"running recently", &types.ContainerState{Status: "running", Running: true, StartedAt: "2023-09-01T09:59:55Z"}, HealthGatePending},
+		{"restarting", &types.ContainerState{Status: "restarting", Running: true, Restarting: true, ExitCode: 1}, HealthGatePending},
+		{"completed", &types.ContainerState{Status: "exited", ExitCode: 0}, HealthGatePassed},
+		{"crashed", &types.ContainerState{Status: "exited", ExitCode: 137}, HealthGateFailed},
+		{"created", &types.ContainerState{Status: "created"}, HealthGatePending},
+	}
+
+	for _, test := range tests {
+		state, _ := containerHealthGate(test.state, 10*time.Second, now)
+		if state != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, state)
+		}
+	}
+}
+
+func TestAggregateHealthGates(t *testing.T) {
+	gates := aggregateHealthGates([]ServiceHealthGate{
+		{Service: "web", State: HealthGatePassed},
+		{Service: "db", State: HealthGatePending, Reason: "health check starting"},
+		{Service: "web", State: HealthGateFailed, Reason: "unhealthy"},
+		{Service: "db", State: HealthGatePassed},
+	})
+
+	expected := []ServiceHealthGate{
+		{Service: "db", State: HealthGatePending, Reason: "health check starting"},
+		{Service: "web", State: HealthGateFailed, Reason: "unhealthy"},
+	}
+
+	if len(gates) != len(expected) {
+		t.Fatalf("expected %d gates, got %v", len(expected), gates)
+	}
+
+	for i := range expected {
+		if gates[i] != expected[i] {
+			t.Errorf("gate %d: expected %+v, got %+v", i, expected[i], gates[i])
+		}
+	}
+}
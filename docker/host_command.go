@@ -0,0 +1,116 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/strslice"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// RunHostCommand starts a privileged container sharing the PID namespace of the host and executes cmd in the
+// namespaces of the host init process. The container is not waited for: the commands restarting the Docker daemon
+// or rebooting the host terminate the container, and usually the agent, before they return.
+func RunHostCommand(ctx context.Context, image string, cmd []string) error {
+	return withCli(func(cli *client.Client) error {
+		cli.HTTPClient().Timeout = largeClientTimeout
+
+		id, err := createHostCommandContainer(ctx, cli, image, cmd, true)
+		if err != nil {
+			return err
+		}
+
+		if err := cli.ContainerStart(ctx, id, types.ContainerStartOptions{}); err != nil {
+			_ = cli.ContainerRemove(context.Background(), id, types.ContainerRemoveOptions{Force: true})
+
+			return errors.WithMessage(err, "unable to start the host command container")
+		}
+
+		return nil
+	})
+}
+
+// ExecHostCommand executes cmd in the namespaces of the host init process like RunHostCommand, but waits for the
+// command to exit. The standard and error outputs of the command are written to w. An error is returned when
+// the command exits with a non-zero code.
+func ExecHostCommand(ctx context.Context, image string, cmd []string, w io.Writer) error {
+	return withCli(func(cli *client.Client) error {
+		cli.HTTPClient().Timeout = largeClientTimeout
+
+		id, err := createHostCommandContainer(ctx, cli, image, cmd, false)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			err := cli.ContainerRemove(context.Background(), id, types.ContainerRemoveOptions{Force: true})
+			if err != nil {
+				log.Warn().Str("container_id", id).Err(err).Msg("unable to remove the host command container")
+			}
+		}()
+
+		attached, err := cli.ContainerAttach(ctx, id, types.ContainerAttachOptions{
+			Stream: true,
+			Stdout: true,
+			Stderr: true,
+		})
+		if err != nil {
+			return errors.WithMessage(err, "unable to attach to the host command container")
+		}
+		defer attached.Close()
+
+		if err := cli.ContainerStart(ctx, id, types.ContainerStartOptions{}); err != nil {
+			return errors.WithMessage(err, "unable to start the host command container")
+		}
+
+		if _, err := stdcopy.StdCopy(w, w, attached.Reader); err != nil && ctx.Err() == nil {
+			return errors.WithMessage(err, "unable to stream the host command output")
+		}
+
+		statusCh, errCh := cli.ContainerWait(ctx, id, container.WaitConditionNotRunning)
+		select {
+		case err := <-errCh:
+			return errors.WithMessage(err, "unable to wait for the host command")
+		case status := <-statusCh:
+			if status.StatusCode != 0 {
+				return fmt.Errorf("the host command exited with code %d", status.StatusCode)
+			}
+		}
+
+		return nil
+	})
+}
+
+func createHostCommandContainer(ctx context.Context, cli *client.Client, image string, cmd []string, detached bool) (string, error) {
+	if _, _, err := cli.ImageInspectWithRaw(ctx, image); client.IsErrNotFound(err) {
+		if err := pullImage(ctx, cli, image); err != nil {
+			return "", errors.WithMessage(err, "unable to pull the host command image")
+		}
+	}
+
+	created, err := cli.ContainerCreate(ctx,
+		&container.Config{
+			Image:        image,
+			Entrypoint:   strslice.StrSlice{"nsenter", "-t", "1", "-m", "-u", "-i", "-n", "-p", "--"},
+			Cmd:          cmd,
+			AttachStdout: !detached,
+			AttachStderr: !detached,
+			Labels:       map[string]string{"io.portainer.agent.host_command": "true"},
+		},
+		&container.HostConfig{
+			Privileged: true,
+			PidMode:    container.PidMode("host"),
+			AutoRemove: detached,
+		},
+		nil, nil, "")
+	if err != nil {
+		return "", errors.WithMessage(err, "unable to create the host command container")
+	}
+
+	return created.ID, nil
+}
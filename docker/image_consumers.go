@@ -0,0 +1,135 @@
+package docker
+
+import (
+	"context"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/rs/zerolog/log"
+)
+
+// ImageConsumer represents a container or a Swarm service running a specific image
+type ImageConsumer struct {
+	Type  string `json:"Type"`
+	ID    string `json:"Id"`
+	Name  string `json:"Name"`
+	Stack string `json:"Stack,omitempty"`
+	Image string `json:"Image"`
+}
+
+// Image consumer types
+const (
+	ImageConsumerContainer = "container"
+	ImageConsumerService   = "service"
+)
+
+// NormalizeImageTag returns the fully qualified name:tag form of an image reference, ignoring any digest.
+// The latest tag is used when the reference has no tag.
+func NormalizeImageTag(image string) (string, error) {
+	image, _, _ = strings.Cut(image, "@")
+
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", err
+	}
+
+	return reference.TagNameOnly(named).String(), nil
+}
+
+// FindImageConsumers returns the containers and Swarm services running one of the specified images.
+// Containers managed by a Swarm service are reported through their service only.
+func FindImageConsumers(ctx context.Context, images []string) ([]ImageConsumer, error) {
+	wanted := map[string]bool{}
+	for _, image := range images {
+		normalized, err := NormalizeImageTag(image)
+		if err != nil {
+			return nil, err
+		}
+
+		wanted[normalized] = true
+	}
+
+	consumers := []ImageConsumer{}
+
+	matches := func(image string) bool {
+		normalized, err := NormalizeImageTag(image)
+		return err == nil && wanted[normalized]
+	}
+
+	err := withCli(func(cli *client.Client) error {
+		containers, err := cli.ContainerList(ctx, types.ContainerListOptions{})
+		if err != nil {
+			return err
+		}
+
+		for _, c := range containers {
+			if _, ok := c.Labels["com.docker.swarm.service.id"]; ok {
+				continue
+			}
+
+			if !matches(c.Image) {
+				continue
+			}
+
+			name := c.ID
+			if len(c.Names) > 0 {
+				name = strings.TrimPrefix(c.Names[0], "/")
+			}
+
+			consumers = append(consumers, ImageConsumer{
+				Type:  ImageConsumerContainer,
+				ID:    c.ID,
+				Name:  name,
+				Stack: c.Labels[ComposeProjectLabel],
+				Image: c.Image,
+			})
+		}
+
+		info, err := cli.Info(ctx)
+		if err != nil {
+			return err
+		}
+
+		if !info.Swarm.ControlAvailable {
+			return nil
+		}
+
+		services, err := cli.ServiceList(ctx, types.ServiceListOptions{})
+		if err != nil {
+			return err
+		}
+
+		for _, s := range services {
+			if s.Spec.TaskTemplate.ContainerSpec == nil || !matches(s.Spec.TaskTemplate.ContainerSpec.Image) {
+				continue
+			}
+
+			consumers = append(consumers, ImageConsumer{
+				Type:  ImageConsumerService,
+				ID:    s.ID,
+				Name:  s.Spec.Name,
+				Stack: s.Spec.Labels[ServiceNameLabel],
+				Image: s.Spec.TaskTemplate.ContainerSpec.Image,
+			})
+		}
+
+		return nil
+	})
+
+	return consumers, err
+}
+
+// UpdateImageConsumer pulls the image of a consumer again and redeploys it
+func UpdateImageConsumer(ctx context.Context, consumer ImageConsumer) error {
+	log.Debug().Str("type", consumer.Type).Str("name", consumer.Name).Str("image", consumer.Image).Msg("updating image consumer")
+
+	if consumer.Type == ImageConsumerService {
+		return RedeployService(ctx, consumer.ID)
+	}
+
+	_, err := ContainerRecreate(ctx, consumer.ID, RecreateChanges{Image: consumer.Image, PullImage: true})
+
+	return err
+}
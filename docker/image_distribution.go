@@ -0,0 +1,85 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+)
+
+// ImageExists returns true when the image is present on the host
+func ImageExists(ctx context.Context, image string) (bool, error) {
+	exists := false
+
+	err := withCli(func(cli *client.Client) error {
+		_, _, err := cli.ImageInspectWithRaw(ctx, image)
+		if err != nil {
+			if client.IsErrNotFound(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		exists = true
+
+		return nil
+	})
+
+	return exists, err
+}
+
+// ImageSave returns the tar archive of the image
+func ImageSave(ctx context.Context, image string) (io.ReadCloser, error) {
+	cli, err := NewClient()
+	if err != nil {
+		return nil, err
+	}
+
+	cli.HTTPClient().Timeout = largeClientTimeout
+
+	archive, err := cli.ImageSave(ctx, []string{image})
+	if err != nil {
+		cli.Close()
+		return nil, err
+	}
+
+	return &cliReadCloser{ReadCloser: archive, cli: cli}, nil
+}
+
+// ImageLoad loads the images of a tar archive produced by ImageSave
+func ImageLoad(ctx context.Context, archive io.Reader) error {
+	return withCli(func(cli *client.Client) error {
+		cli.HTTPClient().Timeout = largeClientTimeout
+
+		resp, err := cli.ImageLoad(ctx, archive, true)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		return ReadJSONMessages(resp.Body)
+	})
+}
+
+// ReadJSONMessages reads a stream of JSON messages returned by the Docker API (e.g. when loading an image) and
+// returns the first error it reports
+func ReadJSONMessages(reader io.Reader) error {
+	decoder := json.NewDecoder(reader)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := decoder.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			return err
+		}
+
+		if msg.Error != nil {
+			return msg.Error
+		}
+	}
+}
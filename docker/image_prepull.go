@@ -0,0 +1,93 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// Statuses of the pull of an image of a pre-pull
+const (
+	ImagePullPending = "pending"
+	ImagePullPulling = "pulling"
+	ImagePullPulled  = "pulled"
+	ImagePullFailed  = "failed"
+)
+
+// ImagePullStatus represents the progress of the pull of an image by PrePullImages
+type ImagePullStatus struct {
+	Image    string `json:"Image"`
+	Status   string `json:"Status"`
+	Progress int    `json:"Progress"`
+	Error    string `json:"Error,omitempty"`
+}
+
+// PrePullImages pulls the images one after the other, so that a stack update on a slow link can be staged before the
+// redeployment. A failed pull does not stop the pulls of the other images, an error is returned once all the images
+// are processed when at least one of them could not be pulled. onProgress is called with the overall completion in
+// percent, a message and the status of each image, the statuses are not modified after the call.
+func PrePullImages(ctx context.Context, images []string, onProgress func(percent int, message string, statuses []ImagePullStatus)) ([]ImagePullStatus, error) {
+	statuses := make([]ImagePullStatus, len(images))
+	for i, image := range images {
+		statuses[i] = ImagePullStatus{Image: image, Status: ImagePullPending}
+	}
+
+	report := func(message string) {
+		var completion int
+		for _, status := range statuses {
+			// the failed pulls count as completed for the overall completion
+			if status.Status == ImagePullFailed {
+				completion += 100
+			} else {
+				completion += status.Progress
+			}
+		}
+
+		onProgress(completion/len(statuses), message, append([]ImagePullStatus{}, statuses...))
+	}
+
+	failed := 0
+
+	err := withCli(func(cli *client.Client) error {
+		cli.HTTPClient().Timeout = largeClientTimeout
+
+		for i, image := range images {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			statuses[i].Status = ImagePullPulling
+			report("pulling " + image)
+
+			err := withRegistryAuth(image, func(options types.ImagePullOptions) error {
+				return pullWithProgress(ctx, cli, image, options, func(percent int, message string) {
+					statuses[i].Progress = percent
+					report(image + ": " + message)
+				})
+			})
+			if err != nil {
+				failed++
+				statuses[i].Status = ImagePullFailed
+				statuses[i].Error = err.Error()
+			} else {
+				statuses[i].Status = ImagePullPulled
+				statuses[i].Progress = 100
+			}
+
+			report(image + ": " + statuses[i].Status)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return statuses, err
+	}
+
+	if failed > 0 {
+		return statuses, fmt.Errorf("%d of %d images could not be pulled", failed, len(images))
+	}
+
+	return statuses, nil
+}
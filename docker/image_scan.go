@@ -0,0 +1,335 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// imageScanCacheVolume is the volume keeping the vulnerability database of the scanner between the scans, it can
+	// be seeded beforehand on the air-gapped hosts
+	imageScanCacheVolume = "portainer_agent_trivy_cache"
+	imageScanCachePath   = "/root/.cache/trivy"
+	// maxImageScanOutput is the maximum size of the JSON report of a scan
+	maxImageScanOutput = 32 * 1024 * 1024
+)
+
+// Severities of the vulnerabilities reported by Trivy
+const (
+	SeverityCritical = "CRITICAL"
+	SeverityHigh     = "HIGH"
+	SeverityMedium   = "MEDIUM"
+	SeverityLow      = "LOW"
+	SeverityUnknown  = "UNKNOWN"
+)
+
+// ImageScanOptions represents the scanner used to scan the local images
+type ImageScanOptions struct {
+	// Image is the image providing Trivy
+	Image string
+	// Offline skips the update of the vulnerability database, the database already present in the cache volume is used
+	Offline bool
+}
+
+// ImageVulnerabilities represents the summary of the vulnerabilities found in an image
+type ImageVulnerabilities struct {
+	ImageID string `json:"ImageId"`
+	// Image is the reference of the image that was scanned
+	Image     string `json:"Image"`
+	ScannedAt int64  `json:"ScannedAt"`
+	// Counts are the numbers of distinct vulnerabilities per severity
+	Counts map[string]int `json:"Counts,omitempty"`
+	Error  string         `json:"Error,omitempty"`
+}
+
+// ImageScanReport represents the last scan of each local image
+type ImageScanReport struct {
+	Images []ImageVulnerabilities `json:"Images"`
+}
+
+var imageScans = struct {
+	// scanning is held during a scan so that only one scanner runs at a time
+	scanning sync.Mutex
+
+	mu      sync.Mutex
+	results map[string]ImageVulnerabilities
+}{results: map[string]ImageVulnerabilities{}}
+
+// ScanImages runs Trivy in a container against the local images identified by refs, or against all the local images
+// when refs is empty. The images are read through the Docker socket and never leave the node, only the number of
+// vulnerabilities per severity is kept. A failure on an image does not prevent the scan of the other images, the
+// outcome of each image is reported in the returned results and in the following snapshots.
+func ScanImages(ctx context.Context, refs []string, options ImageScanOptions) ([]ImageVulnerabilities, error) {
+	imageScans.scanning.Lock()
+	defer imageScans.scanning.Unlock()
+
+	var results []ImageVulnerabilities
+
+	err := withCli(func(cli *client.Client) error {
+		cli.HTTPClient().Timeout = largeClientTimeout
+
+		targets, err := scanTargets(ctx, cli, refs)
+		if err != nil {
+			return err
+		}
+
+		if _, _, err := cli.ImageInspectWithRaw(ctx, options.Image); client.IsErrNotFound(err) {
+			if err := pullImage(ctx, cli, options.Image); err != nil {
+				return errors.WithMessage(err, "unable to pull the scanner image")
+			}
+		}
+
+		results = make([]ImageVulnerabilities, 0, len(targets))
+		for _, target := range targets {
+			result := target
+			result.ScannedAt = time.Now().Unix()
+
+			counts, err := scanImage(ctx, cli, target.Image, options)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+
+				log.Warn().Str("image", target.Image).Err(err).Msg("unable to scan the image")
+
+				result.Error = err.Error()
+			}
+			result.Counts = counts
+
+			imageScans.mu.Lock()
+			imageScans.results[result.ImageID] = result
+			imageScans.mu.Unlock()
+
+			results = append(results, result)
+		}
+
+		return nil
+	})
+
+	return results, err
+}
+
+// GetImageScanReport returns the last scan of the local images that were scanned, nil when no image was scanned
+func GetImageScanReport(ctx context.Context) (*ImageScanReport, error) {
+	imageScans.mu.Lock()
+	empty := len(imageScans.results) == 0
+	imageScans.mu.Unlock()
+
+	if empty {
+		return nil, nil
+	}
+
+	var images []types.ImageSummary
+	err := withCli(func(cli *client.Client) error {
+		var err error
+		images, err = cli.ImageList(ctx, types.ImageListOptions{})
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	present := make(map[string]bool, len(images))
+	for _, image := range images {
+		present[image.ID] = true
+	}
+
+	imageScans.mu.Lock()
+	defer imageScans.mu.Unlock()
+
+	report := &ImageScanReport{Images: []ImageVulnerabilities{}}
+	for id, result := range imageScans.results {
+		// The scans of the removed images are forgotten
+		if !present[id] {
+			delete(imageScans.results, id)
+
+			continue
+		}
+
+		report.Images = append(report.Images, result)
+	}
+
+	sort.Slice(report.Images, func(i, j int) bool {
+		return report.Images[i].ImageID < report.Images[j].ImageID
+	})
+
+	return report, nil
+}
+
+// scanTargets resolves refs to the local images, the images are scanned by tag or digest so that Trivy reads them
+// from the Docker daemon
+func scanTargets(ctx context.Context, cli *client.Client, refs []string) ([]ImageVulnerabilities, error) {
+	var targets []ImageVulnerabilities
+
+	if len(refs) == 0 {
+		images, err := cli.ImageList(ctx, types.ImageListOptions{})
+		if err != nil {
+			return nil, errors.WithMessage(err, "unable to list the images")
+		}
+
+		for _, image := range images {
+			targets = append(targets, ImageVulnerabilities{ImageID: image.ID, Image: scanReference(image.ID, image.RepoTags, image.RepoDigests)})
+		}
+
+		return targets, nil
+	}
+
+	for _, ref := range refs {
+		image, _, err := cli.ImageInspectWithRaw(ctx, ref)
+		if err != nil {
+			return nil, errors.WithMessage(err, fmt.Sprintf("unable to inspect the image %s", ref))
+		}
+
+		reference := ref
+		if strings.HasPrefix(ref, "sha256:") || strings.HasPrefix(image.ID, "sha256:"+ref) {
+			reference = scanReference(image.ID, image.RepoTags, image.RepoDigests)
+		}
+
+		targets = append(targets, ImageVulnerabilities{ImageID: image.ID, Image: reference})
+	}
+
+	return targets, nil
+}
+
+func scanReference(id string, repoTags, repoDigests []string) string {
+	for _, tag := range repoTags {
+		if tag != "<none>:<none>" {
+			return tag
+		}
+	}
+
+	for _, digest := range repoDigests {
+		if digest != "<none>@<none>" {
+			return digest
+		}
+	}
+
+	return id
+}
+
+func scanImage(ctx context.Context, cli *client.Client, image string, options ImageScanOptions) (map[string]int, error) {
+	cmd := []string{"image", "--quiet", "--format", "json", "--scanners", "vuln", "--image-src", "docker"}
+	if options.Offline {
+		cmd = append(cmd, "--skip-db-update", "--skip-java-db-update", "--offline-scan")
+	}
+	cmd = append(cmd, "--", image)
+
+	created, err := cli.ContainerCreate(ctx,
+		&container.Config{
+			Image:        options.Image,
+			Cmd:          cmd,
+			AttachStdout: true,
+			AttachStderr: true,
+			Labels:       map[string]string{"io.portainer.agent.scan": image},
+		},
+		&container.HostConfig{
+			Binds: []string{"/var/run/docker.sock:/var/run/docker.sock:ro"},
+			Mounts: []mount.Mount{
+				{Type: mount.TypeVolume, Source: imageScanCacheVolume, Target: imageScanCachePath},
+			},
+		},
+		nil, nil, "")
+	if err != nil {
+		return nil, errors.WithMessage(err, "unable to create the scanner container")
+	}
+	defer func() {
+		err := cli.ContainerRemove(context.Background(), created.ID, types.ContainerRemoveOptions{Force: true})
+		if err != nil {
+			log.Warn().Str("container_id", created.ID).Err(err).Msg("unable to remove the scanner container")
+		}
+	}()
+
+	attached, err := cli.ContainerAttach(ctx, created.ID, types.ContainerAttachOptions{
+		Stream: true,
+		Stdout: true,
+		Stderr: true,
+	})
+	if err != nil {
+		return nil, errors.WithMessage(err, "unable to attach to the scanner container")
+	}
+	defer attached.Close()
+
+	if err := cli.ContainerStart(ctx, created.ID, types.ContainerStartOptions{}); err != nil {
+		return nil, errors.WithMessage(err, "unable to start the scanner container")
+	}
+
+	stdout := &limitedBuffer{limit: maxImageScanOutput}
+	stderr := &limitedBuffer{limit: 4096}
+	if _, err := stdcopy.StdCopy(stdout, stderr, attached.Reader); err != nil {
+		return nil, errors.WithMessage(err, "unable to read the scanner output")
+	}
+
+	statusCh, errCh := cli.ContainerWait(ctx, created.ID, container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		return nil, errors.WithMessage(err, "unable to wait for the scanner")
+	case status := <-statusCh:
+		if status.StatusCode != 0 {
+			return nil, fmt.Errorf("the scanner exited with code %d: %s", status.StatusCode, strings.TrimSpace(stderr.String()))
+		}
+	}
+
+	return summarizeTrivyReport([]byte(stdout.String()))
+}
+
+type trivyReport struct {
+	Results []struct {
+		Vulnerabilities []struct {
+			VulnerabilityID  string
+			PkgName          string
+			InstalledVersion string
+			Severity         string
+		}
+	}
+}
+
+// summarizeTrivyReport counts the vulnerabilities of a JSON report of Trivy per severity, a vulnerability of a
+// package found in several layers or targets is counted once
+func summarizeTrivyReport(data []byte) (map[string]int, error) {
+	var report trivyReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, errors.WithMessage(err, "unable to parse the scanner report")
+	}
+
+	counts := map[string]int{
+		SeverityCritical: 0,
+		SeverityHigh:     0,
+		SeverityMedium:   0,
+		SeverityLow:      0,
+		SeverityUnknown:  0,
+	}
+
+	seen := map[string]bool{}
+	for _, result := range report.Results {
+		for _, vulnerability := range result.Vulnerabilities {
+			key := vulnerability.VulnerabilityID + "\x00" + vulnerability.PkgName + "\x00" + vulnerability.InstalledVersion
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			severity := strings.ToUpper(vulnerability.Severity)
+			if _, ok := counts[severity]; !ok {
+				severity = SeverityUnknown
+			}
+
+			counts[severity]++
+		}
+	}
+
+	return counts, nil
+}
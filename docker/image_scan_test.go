@@ -0,0 +1,44 @@
+package docker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSummarizeTrivyReport(t *testing.T) {
+	report := `{
+		"Results": [
+			{"Target": "alpine", "Vulnerabilities": [
+				{"VulnerabilityID": "CVE-1", "PkgName": "openssl", "InstalledVersion": "1.0", "Severity": "CRITICAL"},
+				{"VulnerabilityID": "CVE-2", "PkgName": "openssl", "InstalledVersion": "1.0", "Severity": "HIGH"},
+				{"VulnerabilityID": "CVE-3", "PkgName": "zlib", "InstalledVersion": "1.2", "Severity": "low"}
+			]},
+			{"Target": "app", "Vulnerabilities": [
+				{"VulnerabilityID": "CVE-1", "PkgName": "openssl", "InstalledVersion": "1.0", "Severity": "CRITICAL"},
+				{"VulnerabilityID": "CVE-4", "PkgName": "lib", "InstalledVersion": "2.0", "Severity": "NEGLIGIBLE"}
+			]},
+			{"Target": "empty"}
+		]
+	}`
+
+	counts, err := summarizeTrivyReport([]byte(report))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]int{
+		SeverityCritical: 1,
+		SeverityHigh:     1,
+		SeverityMedium:   0,
+		SeverityLow:      1,
+		SeverityUnknown:  1,
+	}
+
+	if !reflect.DeepEqual(counts, expected) {
+		t.Fatalf("expected %v, got %v", expected, counts)
+	}
+
+	if _, err := summarizeTrivyReport([]byte("FATAL error")); err == nil {
+		t.Fatal("expected an error for an invalid report")
+	}
+}
@@ -0,0 +1,163 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/pkg/errors"
+	"github.com/portainer/agent/journal"
+
+	"github.com/rs/zerolog/log"
+)
+
+// StackDeployJournalState is the state of the deployment of a Compose stack recorded in the operation journal
+type StackDeployJournalState struct {
+	ProjectName string
+	StackID     int
+	Version     int
+}
+
+// RecoverContainerRecreate completes the recreation of a container interrupted once its replacement was running,
+// by removing the original container, and rolls it back otherwise: the replacement is removed and the original
+// container is renamed and started again.
+func RecoverContainerRecreate(ctx context.Context, entry journal.Entry) (string, error) {
+	var state recreateJournalState
+	if err := entry.Decode(&state); err != nil {
+		return "", err
+	}
+
+	outcome := journal.OutcomeRolledBack
+
+	err := withCli(func(cli *client.Client) error {
+		if entry.Step == recreateStepRemoving {
+			outcome = journal.OutcomeResumed
+
+			err := cli.ContainerRemove(ctx, state.ContainerID, types.ContainerRemoveOptions{Force: true})
+			if err != nil && !client.IsErrNotFound(err) {
+				return errors.WithMessage(err, "unable to remove the original container")
+			}
+
+			return nil
+		}
+
+		original, err := cli.ContainerInspect(ctx, state.ContainerID)
+		if err != nil {
+			return errors.WithMessage(err, "unable to inspect the original container")
+		}
+
+		// the replacement holds the name of the container once it is created
+		replacement, err := cli.ContainerInspect(ctx, state.Name)
+		if err == nil && replacement.ID != original.ID {
+			err = cli.ContainerRemove(ctx, replacement.ID, types.ContainerRemoveOptions{Force: true})
+			if err != nil {
+				return errors.WithMessage(err, "unable to remove the replacement container")
+			}
+		} else if err != nil && !client.IsErrNotFound(err) {
+			return errors.WithMessage(err, "unable to inspect the replacement container")
+		}
+
+		if strings.TrimPrefix(original.Name, "/") != state.Name {
+			if err := cli.ContainerRename(ctx, original.ID, state.Name); err != nil {
+				return errors.WithMessage(err, "unable to restore the container name")
+			}
+		}
+
+		if state.WasRunning && (original.State == nil || !original.State.Running) {
+			if err := cli.ContainerStart(ctx, original.ID, types.ContainerStartOptions{}); err != nil {
+				return errors.WithMessage(err, "unable to restart the original container")
+			}
+		}
+
+		return nil
+	})
+
+	return outcome, err
+}
+
+// RecoverVolumeBackup rolls back a volume backup interrupted during the archive: the containers paused for the
+// backup are unpaused and the partial archive is removed
+func RecoverVolumeBackup(ctx context.Context, entry journal.Entry) (string, error) {
+	var state volumeBackupJournalState
+	if err := entry.Decode(&state); err != nil {
+		return "", err
+	}
+
+	err := withCli(func(cli *client.Client) error {
+		failed := []string{}
+		for _, id := range state.Paused {
+			c, err := cli.ContainerInspect(ctx, id)
+			if client.IsErrNotFound(err) {
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			if c.State == nil || !c.State.Paused {
+				continue
+			}
+
+			if err := cli.ContainerUnpause(ctx, id); err != nil {
+				log.Error().Err(err).Str("container", strings.TrimPrefix(c.Name, "/")).Msg("unable to unpause the container after the interrupted volume backup")
+
+				failed = append(failed, strings.TrimPrefix(c.Name, "/"))
+			}
+		}
+
+		if len(failed) > 0 {
+			return fmt.Errorf("unable to unpause the containers %s", strings.Join(failed, ", "))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if state.Path != "" {
+		if err := os.Remove(state.Path); err != nil && !os.IsNotExist(err) {
+			return "", errors.WithMessage(err, "unable to remove the partial archive")
+		}
+	}
+
+	return journal.OutcomeRolledBack, nil
+}
+
+// RecoverStackDeploy removes the containers of a Compose stack created but never started by a deployment
+// interrupted by a stop of the agent. The stack is deployed again once the agent receives it from the server.
+func RecoverStackDeploy(ctx context.Context, entry journal.Entry) (string, error) {
+	var state StackDeployJournalState
+	if err := entry.Decode(&state); err != nil {
+		return "", err
+	}
+
+	err := withCli(func(cli *client.Client) error {
+		// Compose normalizes the project names to lowercase
+		containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
+			All: true,
+			Filters: filters.NewArgs(
+				filters.Arg("label", fmt.Sprintf("%s=%s", ComposeProjectLabel, strings.ToLower(state.ProjectName))),
+				filters.Arg("status", "created"),
+			),
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, c := range containers {
+			if err := cli.ContainerRemove(ctx, c.ID, types.ContainerRemoveOptions{Force: true}); err != nil && !client.IsErrNotFound(err) {
+				return errors.WithMessagef(err, "unable to remove the container %s", containerName(c))
+			}
+
+			log.Info().Str("stack", state.ProjectName).Str("container", containerName(c)).Msg("removed a container created by an interrupted deployment")
+		}
+
+		return nil
+	})
+
+	return journal.OutcomeRolledBack, err
+}
@@ -0,0 +1,169 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/portainer/agent"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// Logging drivers storing the logs of the containers in files on the host
+const (
+	LogDriverJSONFile = "json-file"
+	LogDriverLocal    = "local"
+)
+
+// ContainerLogAudit represents the logging configuration of a container and the disk space used by its logs
+type ContainerLogAudit struct {
+	ID      string `json:"Id"`
+	Name    string `json:"Name"`
+	Driver  string `json:"Driver"`
+	MaxSize string `json:"MaxSize,omitempty"`
+	MaxFile string `json:"MaxFile,omitempty"`
+	// Size is the size of the current and rotated log files, nil when the files cannot be read by the agent
+	Size *int64 `json:"Size,omitempty"`
+	// Unbounded is true when the log files grow without limit
+	Unbounded bool `json:"Unbounded"`
+}
+
+// LogAudit represents the logging configuration of the containers of the host
+type LogAudit struct {
+	Containers     []ContainerLogAudit `json:"Containers"`
+	UnboundedCount int                 `json:"UnboundedCount"`
+	TotalSize      int64               `json:"TotalSize"`
+}
+
+// GetLogAudit returns the logging configuration of all the containers of the host. The size of the log files is
+// read from the host filesystem, mounted in the agent container.
+func GetLogAudit(ctx context.Context) (*LogAudit, error) {
+	var containers []types.ContainerJSON
+
+	err := withCli(func(cli *client.Client) error {
+		list, err := cli.ContainerList(ctx, types.ContainerListOptions{All: true})
+		if err != nil {
+			return err
+		}
+
+		ids := make([]string, 0, len(list))
+		for _, c := range list {
+			ids = append(ids, c.ID)
+		}
+
+		var mu sync.Mutex
+
+		runBatch(ids, snapshotConcurrency, func(id string) error {
+			container, err := cli.ContainerInspect(ctx, id)
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			containers = append(containers, container)
+			mu.Unlock()
+
+			return nil
+		})
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(containers, func(i, j int) bool {
+		return containers[i].Name < containers[j].Name
+	})
+
+	audit := &LogAudit{Containers: make([]ContainerLogAudit, 0, len(containers))}
+
+	for _, container := range containers {
+		containerAudit := auditContainerLogs(container)
+		if container.LogPath != "" {
+			containerAudit.Size = logFilesSize(filepath.Join(agent.HostRoot, container.LogPath))
+		}
+
+		if containerAudit.Unbounded {
+			audit.UnboundedCount++
+		}
+
+		if containerAudit.Size != nil {
+			audit.TotalSize += *containerAudit.Size
+		}
+
+		audit.Containers = append(audit.Containers, containerAudit)
+	}
+
+	return audit, nil
+}
+
+// Diagnostics returns a diagnostic message for each container whose logs grow without limit
+func (audit *LogAudit) Diagnostics() []string {
+	if audit == nil {
+		return nil
+	}
+
+	var diagnostics []string
+	for _, container := range audit.Containers {
+		if !container.Unbounded {
+			continue
+		}
+
+		message := fmt.Sprintf("unbounded logs: container %s uses the %s logging driver without max-size", container.Name, container.Driver)
+		if container.Size != nil {
+			message += fmt.Sprintf(", %d bytes of logs", *container.Size)
+		}
+
+		diagnostics = append(diagnostics, message)
+	}
+
+	return diagnostics
+}
+
+func auditContainerLogs(container types.ContainerJSON) ContainerLogAudit {
+	audit := ContainerLogAudit{
+		ID:   container.ID,
+		Name: strings.TrimPrefix(container.Name, "/"),
+	}
+
+	if container.HostConfig == nil {
+		return audit
+	}
+
+	// The default options of the daemon are merged into the configuration of the containers when they are created
+	logConfig := container.HostConfig.LogConfig
+	audit.Driver = logConfig.Type
+	audit.MaxSize = logConfig.Config["max-size"]
+	audit.MaxFile = logConfig.Config["max-file"]
+
+	// The local driver rotates the files by default, unlike the json-file driver
+	audit.Unbounded = audit.Driver == LogDriverJSONFile && (audit.MaxSize == "" || audit.MaxSize == "-1")
+
+	return audit
+}
+
+// logFilesSize returns the size of the log file at path and of its rotated files, or nil when it cannot be read
+func logFilesSize(path string) *int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+
+	size := info.Size()
+
+	rotated, _ := filepath.Glob(path + ".*")
+	for _, p := range rotated {
+		if info, err := os.Stat(p); err == nil {
+			size += info.Size()
+		}
+	}
+
+	return &size
+}
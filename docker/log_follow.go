@@ -0,0 +1,124 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// Streams of the container logs
+const (
+	LogStreamStdout = "stdout"
+	LogStreamStderr = "stderr"
+)
+
+// maxLogLineSize is the size from which a line without line break is split
+const maxLogLineSize = 64 * 1024
+
+// LogLine represents a line written by a container
+type LogLine struct {
+	Time    time.Time
+	Stream  string
+	Message string
+}
+
+// ListRunningContainers returns the running containers of the host
+func ListRunningContainers(ctx context.Context) (r []types.Container, err error) {
+	err = withCli(func(cli *client.Client) error {
+		r, err = cli.ContainerList(ctx, types.ContainerListOptions{})
+
+		return err
+	})
+
+	return r, err
+}
+
+// FollowContainerLogs calls fn with each line written by the container since the given time, until ctx is done or
+// the container stops
+func FollowContainerLogs(ctx context.Context, containerID string, since time.Time, fn func(LogLine)) error {
+	return withCli(func(cli *client.Client) error {
+		container, err := cli.ContainerInspect(ctx, containerID)
+		if err != nil {
+			return err
+		}
+
+		rd, err := cli.ContainerLogs(ctx, containerID, types.ContainerLogsOptions{
+			ShowStdout: true,
+			ShowStderr: true,
+			Follow:     true,
+			Timestamps: true,
+			Since:      fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond()),
+		})
+		if err != nil {
+			return err
+		}
+		defer rd.Close()
+
+		stdout := &logLineWriter{stream: LogStreamStdout, fn: fn}
+		stderr := &logLineWriter{stream: LogStreamStderr, fn: fn}
+
+		// The output of the containers with a TTY is not multiplexed
+		if container.Config != nil && container.Config.Tty {
+			_, err = io.Copy(stdout, rd)
+		} else {
+			_, err = stdcopy.StdCopy(stdout, stderr, rd)
+		}
+
+		stdout.flush()
+		stderr.flush()
+
+		return err
+	})
+}
+
+// logLineWriter calls fn with each line written, prefixed with its timestamp
+type logLineWriter struct {
+	stream string
+	fn     func(LogLine)
+	buf    []byte
+}
+
+func (w *logLineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		w.emit(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+
+	if len(w.buf) >= maxLogLineSize {
+		w.flush()
+	}
+
+	return len(p), nil
+}
+
+func (w *logLineWriter) flush() {
+	if len(w.buf) > 0 {
+		w.emit(w.buf)
+		w.buf = nil
+	}
+}
+
+func (w *logLineWriter) emit(line []byte) {
+	timestamp, message, _ := strings.Cut(strings.TrimSuffix(string(line), "\r"), " ")
+
+	t, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		t, message = time.Now(), string(line)
+	}
+
+	w.fn(LogLine{Time: t, Stream: w.stream, Message: message})
+}
@@ -0,0 +1,165 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/portainer/agent"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/rs/zerolog/log"
+)
+
+// Log options applied to the recreated containers whose logs grow without limit
+const (
+	RecommendedLogMaxSize = "10m"
+	RecommendedLogMaxFile = "3"
+)
+
+// LogRemediationOptions represents the containers whose logs are remediated and how
+type LogRemediationOptions struct {
+	// ContainerIDs are the containers to remediate, all the containers with unbounded logs when empty
+	ContainerIDs []string
+	// MinSize is the size of the log files from which they are truncated, in bytes
+	MinSize int64
+	// ApplyLogOptions recreates the containers with unbounded logs with the recommended log options
+	ApplyLogOptions bool
+}
+
+// LogRemediationResult represents the outcome of the remediation of the logs of a container
+type LogRemediationResult struct {
+	ID        string `json:"Id"`
+	Name      string `json:"Name"`
+	Reclaimed int64  `json:"Reclaimed"`
+	// NewID is the identifier of the container once recreated with the recommended log options
+	NewID string `json:"NewId,omitempty"`
+	Error string `json:"Error,omitempty"`
+}
+
+// RemediateLogs truncates the json-file logs of the containers exceeding the minimum size and optionally recreates
+// the containers with unbounded logs with the recommended log options. A failure on a container does not prevent
+// the remediation of the other containers, the outcome of each container is reported in the returned results.
+func RemediateLogs(ctx context.Context, options LogRemediationOptions) ([]LogRemediationResult, error) {
+	ids := options.ContainerIDs
+	if len(ids) == 0 {
+		audit, err := GetLogAudit(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range audit.Containers {
+			if c.Unbounded {
+				ids = append(ids, c.ID)
+			}
+		}
+	}
+
+	results := make([]LogRemediationResult, 0, len(ids))
+
+	err := withCli(func(cli *client.Client) error {
+		for _, id := range ids {
+			results = append(results, remediateContainerLogs(ctx, cli, id, options))
+		}
+
+		return nil
+	})
+
+	return results, err
+}
+
+func remediateContainerLogs(ctx context.Context, cli *client.Client, containerID string, options LogRemediationOptions) LogRemediationResult {
+	result := LogRemediationResult{ID: containerID}
+
+	current, err := cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		result.Error = err.Error()
+
+		return result
+	}
+
+	audit := auditContainerLogs(current)
+	result.Name = audit.Name
+
+	if audit.Driver != LogDriverJSONFile {
+		result.Error = fmt.Sprintf("the logs of the %s logging driver cannot be remediated", audit.Driver)
+
+		return result
+	}
+
+	if current.LogPath == "" {
+		result.Error = "the container has no log file"
+
+		return result
+	}
+
+	result.Reclaimed, err = truncateLogFiles(filepath.Join(agent.HostRoot, current.LogPath), options.MinSize)
+	if err != nil {
+		result.Error = err.Error()
+
+		return result
+	}
+
+	if options.ApplyLogOptions && audit.Unbounded {
+		result.NewID, err = ContainerRecreate(ctx, containerID, RecreateChanges{
+			LogConfig: recommendedLogConfig(current.HostConfig.LogConfig),
+		})
+		if err != nil {
+			result.Error = err.Error()
+		}
+	}
+
+	return result
+}
+
+// truncateLogFiles removes the rotated files of the json-file log at path and truncates the current file when their
+// size reaches minSize. The daemon appends to the current file, so it keeps writing at its beginning once truncated.
+// It returns the number of bytes reclaimed.
+func truncateLogFiles(path string, minSize int64) (int64, error) {
+	size := logFilesSize(path)
+	if size == nil {
+		return 0, fmt.Errorf("unable to read the log file %s", path)
+	}
+
+	if *size < minSize {
+		return 0, nil
+	}
+
+	rotated, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return 0, err
+	}
+
+	for _, p := range rotated {
+		if err := os.Remove(p); err != nil {
+			log.Warn().Err(err).Str("path", p).Msg("unable to remove a rotated log file")
+		}
+	}
+
+	if err := os.Truncate(path, 0); err != nil {
+		return 0, err
+	}
+
+	remaining := logFilesSize(path)
+	if remaining == nil {
+		return *size, nil
+	}
+
+	return *size - *remaining, nil
+}
+
+func recommendedLogConfig(current container.LogConfig) *container.LogConfig {
+	config := map[string]string{}
+	for k, v := range current.Config {
+		config[k] = v
+	}
+
+	config["max-size"] = RecommendedLogMaxSize
+	if config["max-file"] == "" {
+		config["max-file"] = RecommendedLogMaxFile
+	}
+
+	return &container.LogConfig{Type: LogDriverJSONFile, Config: config}
+}
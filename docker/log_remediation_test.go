@@ -0,0 +1,43 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTruncateLogFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "container-json.log")
+
+	for p, size := range map[string]int{path: 100, path + ".1": 50} {
+		if err := os.WriteFile(p, make([]byte, size), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reclaimed, err := truncateLogFiles(path, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reclaimed != 0 {
+		t.Fatalf("expected the logs below the minimum size to be kept, %d bytes reclaimed", reclaimed)
+	}
+
+	reclaimed, err = truncateLogFiles(path, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reclaimed != 150 {
+		t.Fatalf("expected 150 bytes to be reclaimed, got %d", reclaimed)
+	}
+
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Fatal("expected the rotated log file to be removed")
+	}
+
+	if info, err := os.Stat(path); err != nil || info.Size() != 0 {
+		t.Fatal("expected the current log file to be kept and truncated")
+	}
+}
@@ -0,0 +1,305 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/strslice"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// Types of the network debug checks
+const (
+	NetworkCheckDNS  = "dns"
+	NetworkCheckHTTP = "http"
+)
+
+const (
+	// MaxNetworkChecks is the maximum number of checks executed by a network debug request
+	MaxNetworkChecks = 10
+	// DefaultNetworkCheckTimeout is the timeout of a check that does not specify it
+	DefaultNetworkCheckTimeout = 5 * time.Second
+	// MaxNetworkCheckTimeout is the maximum timeout of a check
+	MaxNetworkCheckTimeout = 30 * time.Second
+	// maxNetworkCheckOutput bounds the output of a check kept in its result
+	maxNetworkCheckOutput = 16 * 1024
+)
+
+// Exit codes of the checks
+const (
+	// digExitNoResponse is the exit code of dig when no server answered
+	digExitNoResponse = 9
+	// timeoutExitCode is the exit code of timeout when it killed the check
+	timeoutExitCode = 124
+)
+
+// curlWriteOut is the format of the metrics printed by curl after an HTTP probe
+const curlWriteOut = "%{http_code} %{remote_ip} %{time_namelookup} %{time_connect} %{time_appconnect} %{time_total}"
+
+var (
+	dnsNameRegexp   = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,252}$`)
+	dnsRecordTypes  = map[string]bool{"A": true, "AAAA": true, "CNAME": true, "MX": true, "NS": true, "PTR": true, "SOA": true, "SRV": true, "TXT": true}
+	digStatusRegexp = regexp.MustCompile(`status: ([A-Z]+)`)
+	digAnswerRegexp = regexp.MustCompile(`ANSWER: (\d+)`)
+)
+
+// NetworkCheck is a DNS lookup or an HTTP probe executed from the network namespace of a container
+type NetworkCheck struct {
+	// Type is dns or http
+	Type string
+	// Target is the name resolved by a DNS lookup or the URL requested by an HTTP probe
+	Target string
+	// RecordType is the type of the DNS records looked up, A when empty
+	RecordType string
+	// TimeoutSeconds is the timeout of the check, 5 seconds when 0
+	TimeoutSeconds int
+}
+
+// NetworkCheckResult is the outcome of a NetworkCheck
+type NetworkCheckResult struct {
+	Type       string `json:"Type"`
+	Target     string `json:"Target"`
+	RecordType string `json:"RecordType,omitempty"`
+	// Success is true when the name resolved to at least one record, or when the URL answered with any status code
+	Success bool `json:"Success"`
+	// Status is the DNS response code of a lookup (NOERROR, NXDOMAIN, SERVFAIL or timeout)
+	Status string `json:"Status,omitempty"`
+	// StatusCode, RemoteIP and the durations are reported by the HTTP probes
+	StatusCode     int     `json:"StatusCode,omitempty"`
+	RemoteIP       string  `json:"RemoteIP,omitempty"`
+	DNSSeconds     float64 `json:"DNSSeconds,omitempty"`
+	ConnectSeconds float64 `json:"ConnectSeconds,omitempty"`
+	TLSSeconds     float64 `json:"TLSSeconds,omitempty"`
+	TotalSeconds   float64 `json:"TotalSeconds,omitempty"`
+	// Output is the output of dig for a lookup
+	Output string `json:"Output,omitempty"`
+	// Error is the reason of the failure of the check
+	Error string `json:"Error,omitempty"`
+}
+
+// Validate returns an error when the check cannot be executed safely
+func (check *NetworkCheck) Validate() error {
+	if check.TimeoutSeconds < 0 || time.Duration(check.TimeoutSeconds)*time.Second > MaxNetworkCheckTimeout {
+		return fmt.Errorf("the timeout of a check must be between 1 and %d seconds", int(MaxNetworkCheckTimeout.Seconds()))
+	}
+
+	switch check.Type {
+	case NetworkCheckDNS:
+		if !dnsNameRegexp.MatchString(check.Target) {
+			return fmt.Errorf("invalid DNS name %q", check.Target)
+		}
+
+		if check.RecordType != "" && !dnsRecordTypes[check.RecordType] {
+			return fmt.Errorf("unsupported DNS record type %q", check.RecordType)
+		}
+	case NetworkCheckHTTP:
+		target, err := url.Parse(check.Target)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return fmt.Errorf("invalid HTTP probe URL %q", check.Target)
+		}
+	default:
+		return fmt.Errorf("invalid check type %q, expected dns or http", check.Type)
+	}
+
+	return nil
+}
+
+func (check *NetworkCheck) timeout() time.Duration {
+	if check.TimeoutSeconds == 0 {
+		return DefaultNetworkCheckTimeout
+	}
+
+	return time.Duration(check.TimeoutSeconds) * time.Second
+}
+
+// command returns the command of the check, the targets are validated and passed after the options
+func (check *NetworkCheck) command() []string {
+	seconds := strconv.Itoa(int(check.timeout().Seconds()))
+
+	if check.Type == NetworkCheckDNS {
+		recordType := check.RecordType
+		if recordType == "" {
+			recordType = "A"
+		}
+
+		return []string{"dig", "+search", "+nocmd", "+time=" + seconds, "+tries=1", check.Target, recordType}
+	}
+
+	return []string{"curl", "--silent", "--show-error", "--output", "/dev/null", "--max-time", seconds, "--write-out", curlWriteOut, "--", check.Target}
+}
+
+// DebugContainerNetwork executes the checks from the network namespace of a running container, with image which
+// must provide dig and curl. Each check runs in a temporary container sharing the network namespace, the /etc/hosts
+// and the /etc/resolv.conf of the container, so that the names are resolved exactly as the container resolves them
+// without modifying it.
+func DebugContainerNetwork(ctx context.Context, containerID, image string, checks []NetworkCheck) ([]NetworkCheckResult, error) {
+	var results []NetworkCheckResult
+
+	err := withCli(func(cli *client.Client) error {
+		cli.HTTPClient().Timeout = largeClientTimeout
+
+		target, err := cli.ContainerInspect(ctx, containerID)
+		if err != nil {
+			return errors.WithMessage(err, "unable to inspect container")
+		}
+
+		if target.State == nil || !target.State.Running {
+			return errors.New("the container must be running to debug its network")
+		}
+
+		if target.HostConfig != nil && target.HostConfig.NetworkMode.IsNone() {
+			return errors.New("the container has no network")
+		}
+
+		if _, _, err := cli.ImageInspectWithRaw(ctx, image); client.IsErrNotFound(err) {
+			if err := pullImage(ctx, cli, image); err != nil {
+				return errors.WithMessage(err, "unable to pull the network debug image")
+			}
+		}
+
+		for _, check := range checks {
+			stdout, stderr, exitCode, err := runInNetworkNamespace(ctx, cli, target.ID, image, check.timeout(), check.command())
+			if err != nil {
+				return err
+			}
+
+			results = append(results, networkCheckResult(check, stdout, stderr, exitCode))
+		}
+
+		return nil
+	})
+
+	return results, err
+}
+
+// runInNetworkNamespace runs cmd in a temporary container joining the network namespace of the target container and
+// returns its outputs and its exit code
+func runInNetworkNamespace(ctx context.Context, cli *client.Client, targetID, image string, timeout time.Duration, cmd []string) (string, string, int, error) {
+	// the command is killed a few seconds after its own timeout when the probed target hangs
+	deadline := strconv.Itoa(int(timeout.Seconds()) + 5)
+
+	created, err := cli.ContainerCreate(ctx,
+		&container.Config{
+			Image:        image,
+			Entrypoint:   strslice.StrSlice{"timeout"},
+			Cmd:          append([]string{deadline}, cmd...),
+			AttachStdout: true,
+			AttachStderr: true,
+			Labels:       map[string]string{"io.portainer.agent.netdebug": targetID},
+		},
+		&container.HostConfig{
+			NetworkMode: container.NetworkMode("container:" + targetID),
+		},
+		nil, nil, "")
+	if err != nil {
+		return "", "", 0, errors.WithMessage(err, "unable to create the network debug container")
+	}
+	defer func() {
+		err := cli.ContainerRemove(context.Background(), created.ID, types.ContainerRemoveOptions{Force: true})
+		if err != nil {
+			log.Warn().Str("container_id", created.ID).Err(err).Msg("unable to remove the network debug container")
+		}
+	}()
+
+	attached, err := cli.ContainerAttach(ctx, created.ID, types.ContainerAttachOptions{
+		Stream: true,
+		Stdout: true,
+		Stderr: true,
+	})
+	if err != nil {
+		return "", "", 0, errors.WithMessage(err, "unable to attach to the network debug container")
+	}
+	defer attached.Close()
+
+	if err := cli.ContainerStart(ctx, created.ID, types.ContainerStartOptions{}); err != nil {
+		return "", "", 0, errors.WithMessage(err, "unable to start the network debug container")
+	}
+
+	stdout := &limitedBuffer{limit: maxNetworkCheckOutput}
+	stderr := &limitedBuffer{limit: maxNetworkCheckOutput}
+	if _, err := stdcopy.StdCopy(stdout, stderr, attached.Reader); err != nil {
+		return "", "", 0, errors.WithMessage(err, "unable to read the output of the network debug container")
+	}
+
+	inspected, err := cli.ContainerInspect(ctx, created.ID)
+	if err != nil {
+		return "", "", 0, errors.WithMessage(err, "unable to inspect the network debug container")
+	}
+
+	exitCode := 0
+	if inspected.State != nil {
+		exitCode = inspected.State.ExitCode
+	}
+
+	return stdout.String(), stderr.String(), exitCode, nil
+}
+
+// networkCheckResult builds the result of a check from the output of dig or curl
+func networkCheckResult(check NetworkCheck, stdout, stderr string, exitCode int) NetworkCheckResult {
+	result := NetworkCheckResult{Type: check.Type, Target: check.Target, RecordType: check.RecordType}
+
+	if check.Type == NetworkCheckDNS {
+		result.Output = strings.TrimSpace(stdout)
+
+		if match := digStatusRegexp.FindStringSubmatch(stdout); match != nil {
+			result.Status = match[1]
+		} else if exitCode == digExitNoResponse {
+			result.Status = "timeout"
+		}
+
+		answers := 0
+		if match := digAnswerRegexp.FindStringSubmatch(stdout); match != nil {
+			answers, _ = strconv.Atoi(match[1])
+		}
+
+		result.Success = exitCode == 0 && result.Status == "NOERROR" && answers > 0
+		if !result.Success && exitCode != 0 {
+			result.Error = checkError(stderr, stdout, exitCode)
+		}
+
+		return result
+	}
+
+	fields := strings.Fields(stdout)
+	if len(fields) == 6 {
+		result.StatusCode, _ = strconv.Atoi(fields[0])
+		result.RemoteIP = fields[1]
+		result.DNSSeconds, _ = strconv.ParseFloat(fields[2], 64)
+		result.ConnectSeconds, _ = strconv.ParseFloat(fields[3], 64)
+		result.TLSSeconds, _ = strconv.ParseFloat(fields[4], 64)
+		result.TotalSeconds, _ = strconv.ParseFloat(fields[5], 64)
+	}
+
+	result.Success = exitCode == 0 && result.StatusCode > 0
+	if !result.Success {
+		result.Error = checkError(stderr, "", exitCode)
+	}
+
+	return result
+}
+
+func checkError(stderr, stdout string, exitCode int) string {
+	if message := strings.TrimSpace(stderr); message != "" {
+		return message
+	}
+
+	if message := strings.TrimSpace(stdout); message != "" {
+		return message
+	}
+
+	if exitCode == timeoutExitCode {
+		return "the check timed out"
+	}
+
+	return fmt.Sprintf("the check exited with code %d", exitCode)
+}
@@ -0,0 +1,91 @@
+package docker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNetworkCheckValidate(t *testing.T) {
+	valid := []NetworkCheck{
+		{Type: NetworkCheckDNS, Target: "db"},
+		{Type: NetworkCheckDNS, Target: "_postgres._tcp.db.internal", RecordType: "SRV", TimeoutSeconds: 30},
+		{Type: NetworkCheckHTTP, Target: "https://api.example.com/health?full=1"},
+	}
+
+	for _, check := range valid {
+		if err := check.Validate(); err != nil {
+			t.Errorf("expected the check %+v to be valid, got %v", check, err)
+		}
+	}
+
+	invalid := []NetworkCheck{
+		{Type: NetworkCheckDNS, Target: "-x"},
+		{Type: NetworkCheckDNS, Target: "db; reboot"},
+		{Type: NetworkCheckDNS, Target: "db", RecordType: "ANY"},
+		{Type: NetworkCheckDNS, Target: "db", TimeoutSeconds: 31},
+		{Type: NetworkCheckHTTP, Target: "file:///etc/shadow"},
+		{Type: NetworkCheckHTTP, Target: "--output=/tmp/x"},
+		{Type: "tcp", Target: "db:5432"},
+	}
+
+	for _, check := range invalid {
+		if err := check.Validate(); err == nil {
+			t.Errorf("expected the check %+v to be rejected", check)
+		}
+	}
+}
+
+func TestNetworkCheckCommand(t *testing.T) {
+	check := NetworkCheck{Type: NetworkCheckDNS, Target: "db"}
+
+	expected := []string{"dig", "+search", "+nocmd", "+time=5", "+tries=1", "db", "A"}
+	if cmd := check.command(); !reflect.DeepEqual(cmd, expected) {
+		t.Fatalf("expected %v, got %v", expected, cmd)
+	}
+
+	check = NetworkCheck{Type: NetworkCheckHTTP, Target: "http://api:8080", TimeoutSeconds: 2}
+
+	expected = []string{"curl", "--silent", "--show-error", "--output", "/dev/null", "--max-time", "2", "--write-out", curlWriteOut, "--", "http://api:8080"}
+	if cmd := check.command(); !reflect.DeepEqual(cmd, expected) {
+		t.Fatalf("expected %v, got %v", expected, cmd)
+	}
+}
+
+func TestNetworkCheckResult(t *testing.T) {
+	dig := `;; Got answer:
+;; ->>HEADER<<- opcode: QUERY, status: NXDOMAIN, id: 4242
+;; flags: qr rd ra; QUERY: 1, ANSWER: 0, AUTHORITY: 0, ADDITIONAL: 0
+`
+
+	result := networkCheckResult(NetworkCheck{Type: NetworkCheckDNS, Target: "db"}, dig, "", 0)
+	if result.Success || result.Status != "NXDOMAIN" || result.Output == "" {
+		t.Fatalf("unexpected lookup result %+v", result)
+	}
+
+	result = networkCheckResult(NetworkCheck{Type: NetworkCheckDNS, Target: "db"}, ";; connection timed out; no servers could be reached\n", "", digExitNoResponse)
+	if result.Success || result.Status != "timeout" || result.Error != ";; connection timed out; no servers could be reached" {
+		t.Fatalf("unexpected lookup result %+v", result)
+	}
+
+	result = networkCheckResult(NetworkCheck{Type: NetworkCheckHTTP, Target: "https://api"}, "503 10.0.1.5 0.004 0.006 0.020 0.031", "", 0)
+
+	expected := NetworkCheckResult{
+		Type:           NetworkCheckHTTP,
+		Target:         "https://api",
+		Success:        true,
+		StatusCode:     503,
+		RemoteIP:       "10.0.1.5",
+		DNSSeconds:     0.004,
+		ConnectSeconds: 0.006,
+		TLSSeconds:     0.02,
+		TotalSeconds:   0.031,
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, result)
+	}
+
+	result = networkCheckResult(NetworkCheck{Type: NetworkCheckHTTP, Target: "https://api"}, "000  0.000 0.000 0.000 0.000", "curl: (6) Could not resolve host: api\n", 6)
+	if result.Success || result.Error != "curl: (6) Could not resolve host: api" {
+		t.Fatalf("unexpected probe result %+v", result)
+	}
+}
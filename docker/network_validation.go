@@ -0,0 +1,171 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	agentnet "github.com/portainer/agent/net"
+)
+
+// Subnet conflict sources
+const (
+	ConflictSourceNetwork = "network"
+	ConflictSourceRoute   = "route"
+)
+
+type (
+	// IPAMSubnet represents a subnet requested for a new network
+	IPAMSubnet struct {
+		Subnet  string
+		Gateway string
+		IPRange string
+	}
+
+	// KnownSubnet represents a subnet already in use on the host
+	KnownSubnet struct {
+		Source string
+		Name   string
+		Subnet *net.IPNet
+	}
+
+	// SubnetConflict represents an overlap between a requested subnet and a subnet in use on the host
+	SubnetConflict struct {
+		Subnet        string `json:"Subnet"`
+		ConflictsWith string `json:"ConflictsWith"`
+		Source        string `json:"Source"`
+		Name          string `json:"Name"`
+	}
+
+	// NetworkValidation represents the outcome of the validation of the subnets requested for a new network
+	NetworkValidation struct {
+		Valid     bool             `json:"Valid"`
+		Errors    []string         `json:"Errors"`
+		Conflicts []SubnetConflict `json:"Conflicts"`
+	}
+)
+
+// GetKnownSubnets returns the subnets used by the Docker networks and the routes of the host
+func GetKnownSubnets(ctx context.Context) ([]KnownSubnet, error) {
+	known := []KnownSubnet{}
+
+	err := withCli(func(cli *client.Client) error {
+		networks, err := cli.NetworkList(ctx, types.NetworkListOptions{})
+		if err != nil {
+			return err
+		}
+
+		for _, n := range networks {
+			for _, config := range n.IPAM.Config {
+				_, subnet, err := net.ParseCIDR(config.Subnet)
+				if err != nil {
+					continue
+				}
+
+				known = append(known, KnownSubnet{Source: ConflictSourceNetwork, Name: n.Name, Subnet: subnet})
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	routes, err := agentnet.GetHostRoutes()
+	if err != nil {
+		return nil, err
+	}
+
+	networkSubnets := map[string]bool{}
+	for _, k := range known {
+		networkSubnets[k.Subnet.String()] = true
+	}
+
+	for _, route := range routes {
+		// The routes of the bridges created by Docker are already reported through their network
+		if networkSubnets[route.Destination.String()] {
+			continue
+		}
+
+		known = append(known, KnownSubnet{Source: ConflictSourceRoute, Name: route.Interface, Subnet: route.Destination})
+	}
+
+	return known, nil
+}
+
+// NetworkCreate creates a Docker network
+func NetworkCreate(ctx context.Context, name string, options types.NetworkCreate) (r types.NetworkCreateResponse, err error) {
+	err = withCli(func(cli *client.Client) error {
+		r, err = cli.NetworkCreate(ctx, name, options)
+		return err
+	})
+
+	return r, err
+}
+
+// ValidateNetworkSubnets validates the format of the requested subnets and checks that they do not overlap
+// with each other nor with the subnets already in use.
+func ValidateNetworkSubnets(requested []IPAMSubnet, known []KnownSubnet) NetworkValidation {
+	validation := NetworkValidation{
+		Errors:    []string{},
+		Conflicts: []SubnetConflict{},
+	}
+
+	parsed := []*net.IPNet{}
+
+	for _, r := range requested {
+		_, subnet, err := net.ParseCIDR(r.Subnet)
+		if err != nil {
+			validation.Errors = append(validation.Errors, fmt.Sprintf("invalid subnet %s", r.Subnet))
+			continue
+		}
+
+		if r.Gateway != "" {
+			gateway := net.ParseIP(r.Gateway)
+			if gateway == nil || !subnet.Contains(gateway) {
+				validation.Errors = append(validation.Errors, fmt.Sprintf("gateway %s is not part of subnet %s", r.Gateway, r.Subnet))
+			}
+		}
+
+		if r.IPRange != "" {
+			_, ipRange, err := net.ParseCIDR(r.IPRange)
+			if err != nil || !subnet.Contains(ipRange.IP) || prefixLength(ipRange) < prefixLength(subnet) {
+				validation.Errors = append(validation.Errors, fmt.Sprintf("IP range %s is not part of subnet %s", r.IPRange, r.Subnet))
+			}
+		}
+
+		for _, other := range parsed {
+			if subnetsOverlap(subnet, other) {
+				validation.Errors = append(validation.Errors, fmt.Sprintf("subnet %s overlaps with requested subnet %s", subnet, other))
+			}
+		}
+		parsed = append(parsed, subnet)
+
+		for _, k := range known {
+			if subnetsOverlap(subnet, k.Subnet) {
+				validation.Conflicts = append(validation.Conflicts, SubnetConflict{
+					Subnet:        subnet.String(),
+					ConflictsWith: k.Subnet.String(),
+					Source:        k.Source,
+					Name:          k.Name,
+				})
+			}
+		}
+	}
+
+	validation.Valid = len(validation.Errors) == 0 && len(validation.Conflicts) == 0
+
+	return validation
+}
+
+func subnetsOverlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+func prefixLength(n *net.IPNet) int {
+	ones, _ := n.Mask.Size()
+	return ones
+}
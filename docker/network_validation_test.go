@@ -0,0 +1,90 @@
+package docker
+
+import (
+	"net"
+	"testing"
+)
+
+func mustParseCIDR(t *testing.T, cidr string) *net.IPNet {
+	_, subnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return subnet
+}
+
+func TestValidateNetworkSubnets(t *testing.T) {
+	known := []KnownSubnet{
+		{Source: ConflictSourceNetwork, Name: "bridge", Subnet: mustParseCIDR(t, "172.17.0.0/16")},
+		{Source: ConflictSourceRoute, Name: "eth0", Subnet: mustParseCIDR(t, "192.168.1.0/24")},
+	}
+
+	tests := []struct {
+		name      string
+		requested []IPAMSubnet
+		errors    int
+		conflicts int
+	}{
+		{
+			name:      "valid subnet",
+			requested: []IPAMSubnet{{Subnet: "10.10.0.0/24", Gateway: "10.10.0.1", IPRange: "10.10.0.128/25"}},
+		},
+		{
+			name:      "invalid subnet",
+			requested: []IPAMSubnet{{Subnet: "10.10.0.0/33"}},
+			errors:    1,
+		},
+		{
+			name:      "gateway outside of the subnet",
+			requested: []IPAMSubnet{{Subnet: "10.10.0.0/24", Gateway: "10.10.1.1"}},
+			errors:    1,
+		},
+		{
+			name:      "invalid gateway",
+			requested: []IPAMSubnet{{Subnet: "10.10.0.0/24", Gateway: "gateway"}},
+			errors:    1,
+		},
+		{
+			name:      "IP range outside of the subnet",
+			requested: []IPAMSubnet{{Subnet: "10.10.0.0/24", IPRange: "10.10.1.0/25"}},
+			errors:    1,
+		},
+		{
+			name:      "IP range larger than the subnet",
+			requested: []IPAMSubnet{{Subnet: "10.10.0.0/24", IPRange: "10.10.0.0/16"}},
+			errors:    1,
+		},
+		{
+			name:      "overlapping requested subnets",
+			requested: []IPAMSubnet{{Subnet: "10.10.0.0/16"}, {Subnet: "10.10.5.0/24"}},
+			errors:    1,
+		},
+		{
+			name:      "subnet inside a Docker network",
+			requested: []IPAMSubnet{{Subnet: "172.17.5.0/24"}},
+			conflicts: 1,
+		},
+		{
+			name:      "subnet containing a host route",
+			requested: []IPAMSubnet{{Subnet: "192.168.0.0/16"}},
+			conflicts: 1,
+		},
+	}
+
+	for _, test := range tests {
+		validation := ValidateNetworkSubnets(test.requested, known)
+
+		if len(validation.Errors) != test.errors {
+			t.Errorf("%s: expected %d errors, got %v", test.name, test.errors, validation.Errors)
+		}
+
+		if len(validation.Conflicts) != test.conflicts {
+			t.Errorf("%s: expected %d conflicts, got %v", test.name, test.conflicts, validation.Conflicts)
+		}
+
+		if validation.Valid != (test.errors == 0 && test.conflicts == 0) {
+			t.Errorf("%s: unexpected validity %t", test.name, validation.Valid)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package docker
+
+import (
+	"context"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// NetworkList returns the networks of the host
+func NetworkList(ctx context.Context) (r []types.NetworkResource, err error) {
+	err = withCli(func(cli *client.Client) error {
+		r, err = cli.NetworkList(ctx, types.NetworkListOptions{})
+		return err
+	})
+
+	return r, err
+}
+
+// NetworkRemove removes a Docker network
+func NetworkRemove(ctx context.Context, name string) error {
+	return withCli(func(cli *client.Client) error {
+		return cli.NetworkRemove(ctx, name)
+	})
+}
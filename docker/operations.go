@@ -0,0 +1,259 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+)
+
+// PruneOptions represents the resource types removed by SystemPrune
+type PruneOptions struct {
+	Containers bool
+	Images     bool
+	Volumes    bool
+	Networks   bool
+	// All removes all the unused images instead of only the dangling ones
+	All bool
+}
+
+// BuildOptions represents the parameters of an image build
+type BuildOptions struct {
+	Tags []string
+	// Dockerfile is the content of the Dockerfile, it is used as the only file of the build context
+	// when RemoteContext is not set
+	Dockerfile string
+	// RemoteContext is the URL of a Git repository or of a tarball used as the build context
+	RemoteContext string
+	BuildArgs     map[string]*string
+}
+
+// PruneReport represents the outcome of SystemPrune
+type PruneReport struct {
+	ContainersDeleted []string `json:"ContainersDeleted"`
+	ImagesDeleted     []string `json:"ImagesDeleted"`
+	VolumesDeleted    []string `json:"VolumesDeleted"`
+	NetworksDeleted   []string `json:"NetworksDeleted"`
+	SpaceReclaimed    uint64   `json:"SpaceReclaimed"`
+}
+
+// ImagePullWithProgress pulls an image and reports the progress of the download, computed over all the layers.
+func ImagePullWithProgress(ctx context.Context, image string, onProgress func(percent int, message string)) error {
+	return withCli(func(cli *client.Client) error {
+		cli.HTTPClient().Timeout = largeClientTimeout
+
+		return withRegistryAuth(image, func(options types.ImagePullOptions) error {
+			return pullWithProgress(ctx, cli, image, options, onProgress)
+		})
+	})
+}
+
+func pullWithProgress(ctx context.Context, cli *client.Client, image string, options types.ImagePullOptions, onProgress func(percent int, message string)) error {
+	reader, err := cli.ImagePull(ctx, image, options)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	current := map[string]int64{}
+	total := map[string]int64{}
+
+	decoder := json.NewDecoder(reader)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := decoder.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			return err
+		}
+
+		if msg.Error != nil {
+			return msg.Error
+		}
+
+		if msg.Progress != nil && msg.Progress.Total > 0 {
+			current[msg.ID] = msg.Progress.Current
+			total[msg.ID] = msg.Progress.Total
+		}
+
+		var sumCurrent, sumTotal int64
+		for id := range total {
+			sumCurrent += current[id]
+			sumTotal += total[id]
+		}
+
+		percent := 0
+		if sumTotal > 0 {
+			percent = int(sumCurrent * 100 / sumTotal)
+		}
+
+		onProgress(percent, msg.Status)
+	}
+}
+
+var buildStepRegexp = regexp.MustCompile(`^Step (\d+)/(\d+)`)
+
+// ImageBuildWithProgress builds an image and reports the progress of the build, computed from the executed steps.
+func ImageBuildWithProgress(ctx context.Context, options BuildOptions, onProgress func(percent int, message string)) error {
+	var buildContext io.Reader
+	if options.RemoteContext == "" {
+		dockerfileContext, err := dockerfileBuildContext(options.Dockerfile)
+		if err != nil {
+			return err
+		}
+
+		buildContext = dockerfileContext
+	}
+
+	remoteContext := gitRemoteContext(options.RemoteContext)
+
+	// the daemon errors may contain the remote context, the credentials of the helpers must not leak through them
+	redact := func(err error) error {
+		if remoteContext == options.RemoteContext {
+			return err
+		}
+
+		return errors.New(strings.ReplaceAll(err.Error(), remoteContext, options.RemoteContext))
+	}
+
+	return withCli(func(cli *client.Client) error {
+		cli.HTTPClient().Timeout = largeClientTimeout
+
+		resp, err := cli.ImageBuild(ctx, buildContext, types.ImageBuildOptions{
+			Tags:          options.Tags,
+			RemoteContext: remoteContext,
+			BuildArgs:     options.BuildArgs,
+			Remove:        true,
+		})
+		if err != nil {
+			return redact(err)
+		}
+		defer resp.Body.Close()
+
+		decoder := json.NewDecoder(resp.Body)
+		for {
+			var msg jsonmessage.JSONMessage
+			if err := decoder.Decode(&msg); err != nil {
+				if err == io.EOF {
+					return nil
+				}
+
+				return err
+			}
+
+			if msg.Error != nil {
+				return redact(msg.Error)
+			}
+
+			matches := buildStepRegexp.FindStringSubmatch(msg.Stream)
+			if matches == nil {
+				continue
+			}
+
+			step, _ := strconv.Atoi(matches[1])
+			total, _ := strconv.Atoi(matches[2])
+			if total > 0 {
+				onProgress((step-1)*100/total, fmt.Sprintf("step %d/%d", step, total))
+			}
+		}
+	})
+}
+
+// dockerfileBuildContext returns a tar archive containing only the specified Dockerfile
+func dockerfileBuildContext(dockerfile string) (io.Reader, error) {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+
+	err := tw.WriteHeader(&tar.Header{
+		Name: "Dockerfile",
+		Mode: 0644,
+		Size: int64(len(dockerfile)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tw.Write([]byte(dockerfile)); err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// SystemPrune removes the unused resources of the selected types
+func SystemPrune(ctx context.Context, options PruneOptions) (*PruneReport, error) {
+	report := &PruneReport{
+		ContainersDeleted: []string{},
+		ImagesDeleted:     []string{},
+		VolumesDeleted:    []string{},
+		NetworksDeleted:   []string{},
+	}
+
+	err := withCli(func(cli *client.Client) error {
+		cli.HTTPClient().Timeout = largeClientTimeout
+
+		if options.Containers {
+			r, err := cli.ContainersPrune(ctx, filters.NewArgs())
+			if err != nil {
+				return err
+			}
+
+			report.ContainersDeleted = append(report.ContainersDeleted, r.ContainersDeleted...)
+			report.SpaceReclaimed += r.SpaceReclaimed
+		}
+
+		if options.Images {
+			r, err := cli.ImagesPrune(ctx, filters.NewArgs(filters.Arg("dangling", strconv.FormatBool(!options.All))))
+			if err != nil {
+				return err
+			}
+
+			for _, image := range r.ImagesDeleted {
+				if image.Deleted != "" {
+					report.ImagesDeleted = append(report.ImagesDeleted, image.Deleted)
+				}
+			}
+			report.SpaceReclaimed += r.SpaceReclaimed
+		}
+
+		if options.Volumes {
+			r, err := cli.VolumesPrune(ctx, filters.NewArgs())
+			if err != nil {
+				return err
+			}
+
+			report.VolumesDeleted = append(report.VolumesDeleted, r.VolumesDeleted...)
+			report.SpaceReclaimed += r.SpaceReclaimed
+		}
+
+		if options.Networks {
+			r, err := cli.NetworksPrune(ctx, filters.NewArgs())
+			if err != nil {
+				return err
+			}
+
+			report.NetworksDeleted = append(report.NetworksDeleted, r.NetworksDeleted...)
+		}
+
+		return nil
+	})
+
+	return report, err
+}
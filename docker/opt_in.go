@@ -0,0 +1,19 @@
+package docker
+
+import "strconv"
+
+// LabelOptIn returns whether the label of a container opts it in or out of a behavior of the agent. set is false
+// when the label is missing or when its value is not a boolean.
+func LabelOptIn(labels map[string]string, key string) (enabled, set bool) {
+	value, ok := labels[key]
+	if !ok {
+		return false, false
+	}
+
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, false
+	}
+
+	return enabled, true
+}
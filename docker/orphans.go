@@ -0,0 +1,106 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/portainer/agent"
+)
+
+const (
+	composeServiceLabel = "com.docker.compose.service"
+	composeVolumeLabel  = "com.docker.compose.volume"
+	composeNetworkLabel = "com.docker.compose.network"
+	swarmServiceIDLabel = "com.docker.swarm.service.id"
+	defaultNetworkName  = "default"
+)
+
+// StackReferences are the names of the resources referenced by the definition of a stack, indexed by resource type
+type StackReferences map[string][]string
+
+// FindOrphanedResources returns the resources labeled as belonging to the stack that are no longer referenced by
+// its definition (e.g. renamed services or removed volumes). projectName is the Compose project or Swarm stack
+// namespace used to deploy the stack.
+func FindOrphanedResources(ctx context.Context, stack, projectName string, references StackReferences) ([]LabeledResource, error) {
+	resources, err := ListLabeledResources(ctx, map[string]string{agent.ResourceLabelStack: stack})
+	if err != nil {
+		return nil, err
+	}
+
+	return orphanedResources(resources, projectName, references), nil
+}
+
+// orphanedResources returns the resources that are not referenced by the definition of their stack
+func orphanedResources(resources []LabeledResource, projectName string, references StackReferences) []LabeledResource {
+	referenced := map[string]map[string]bool{}
+	for resourceType, names := range references {
+		referenced[resourceType] = map[string]bool{}
+		for _, name := range names {
+			referenced[resourceType][name] = true
+		}
+	}
+
+	orphans := []LabeledResource{}
+	for _, resource := range resources {
+		// The containers of the Swarm services are collected through their service
+		if _, ok := resource.Labels[swarmServiceIDLabel]; ok {
+			continue
+		}
+
+		name := resourceDefinitionName(resource, projectName)
+		if name == "" || resource.Type == LabeledResourceNetwork && name == defaultNetworkName {
+			continue
+		}
+
+		if !referenced[resource.Type][name] {
+			orphans = append(orphans, resource)
+		}
+	}
+
+	return orphans
+}
+
+// resourceDefinitionName returns the name of the resource in the definition of its stack
+func resourceDefinitionName(resource LabeledResource, projectName string) string {
+	label := map[string]string{
+		LabeledResourceContainer: composeServiceLabel,
+		LabeledResourceVolume:    composeVolumeLabel,
+		LabeledResourceNetwork:   composeNetworkLabel,
+	}[resource.Type]
+
+	if name := resource.Labels[label]; label != "" && name != "" {
+		return name
+	}
+
+	if resource.Type == LabeledResourceContainer {
+		return ""
+	}
+
+	// Swarm stacks prefix the name of their resources with the stack namespace
+	return strings.TrimPrefix(resource.Name, projectName+"_")
+}
+
+// RemoveLabeledResource removes a resource, the volumes and networks still in use are not removed
+func RemoveLabeledResource(ctx context.Context, resource LabeledResource) error {
+	return withCli(func(cli *client.Client) error {
+		switch resource.Type {
+		case LabeledResourceContainer:
+			return cli.ContainerRemove(ctx, resource.ID, types.ContainerRemoveOptions{Force: true, RemoveVolumes: true})
+		case LabeledResourceVolume:
+			return cli.VolumeRemove(ctx, resource.ID, false)
+		case LabeledResourceNetwork:
+			return cli.NetworkRemove(ctx, resource.ID)
+		case LabeledResourceService:
+			return cli.ServiceRemove(ctx, resource.ID)
+		case LabeledResourceConfig:
+			return cli.ConfigRemove(ctx, resource.ID)
+		case LabeledResourceSecret:
+			return cli.SecretRemove(ctx, resource.ID)
+		}
+
+		return fmt.Errorf("unsupported resource type: %s", resource.Type)
+	})
+}
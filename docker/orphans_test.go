@@ -0,0 +1,94 @@
+package docker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResourceDefinitionName(t *testing.T) {
+	tests := []struct {
+		name     string
+		resource LabeledResource
+		expected string
+	}{
+		{
+			name:     "compose container",
+			resource: LabeledResource{Type: LabeledResourceContainer, Name: "edge_web-web-1", Labels: map[string]string{composeServiceLabel: "web"}},
+			expected: "web",
+		},
+		{
+			name:     "container without service",
+			resource: LabeledResource{Type: LabeledResourceContainer, Name: "edge_web_web"},
+			expected: "",
+		},
+		{
+			name:     "compose volume",
+			resource: LabeledResource{Type: LabeledResourceVolume, Name: "edge_web_data", Labels: map[string]string{composeVolumeLabel: "data"}},
+			expected: "data",
+		},
+		{
+			name:     "compose network",
+			resource: LabeledResource{Type: LabeledResourceNetwork, Name: "edge_web_default", Labels: map[string]string{composeNetworkLabel: "default"}},
+			expected: "default",
+		},
+		{
+			name:     "swarm service",
+			resource: LabeledResource{Type: LabeledResourceService, Name: "edge_web_api"},
+			expected: "api",
+		},
+		{
+			name:     "swarm secret",
+			resource: LabeledResource{Type: LabeledResourceSecret, Name: "edge_web_token"},
+			expected: "token",
+		},
+		{
+			name:     "external name",
+			resource: LabeledResource{Type: LabeledResourceConfig, Name: "nginx.conf"},
+			expected: "nginx.conf",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := resourceDefinitionName(tt.resource, "edge_web")
+			if name != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, name)
+			}
+		})
+	}
+}
+
+func TestOrphanedResources(t *testing.T) {
+	resources := []LabeledResource{
+		{Type: LabeledResourceContainer, ID: "1", Labels: map[string]string{composeServiceLabel: "web"}},
+		{Type: LabeledResourceContainer, ID: "2", Labels: map[string]string{composeServiceLabel: "legacy"}},
+		{Type: LabeledResourceContainer, ID: "3", Labels: map[string]string{swarmServiceIDLabel: "s1"}},
+		{Type: LabeledResourceContainer, ID: "4"},
+		{Type: LabeledResourceVolume, ID: "5", Labels: map[string]string{composeVolumeLabel: "data"}},
+		{Type: LabeledResourceVolume, ID: "6", Labels: map[string]string{composeVolumeLabel: "cache"}},
+		{Type: LabeledResourceNetwork, ID: "7", Labels: map[string]string{composeNetworkLabel: "default"}},
+		{Type: LabeledResourceNetwork, ID: "8", Name: "edge_web_backend"},
+		{Type: LabeledResourceService, ID: "9", Name: "edge_web_api"},
+		{Type: LabeledResourceService, ID: "10", Name: "edge_web_worker"},
+		{Type: LabeledResourceSecret, ID: "11", Name: "edge_web_token"},
+	}
+
+	references := StackReferences{
+		LabeledResourceContainer: {"web", "api"},
+		LabeledResourceService:   {"web", "api"},
+		LabeledResourceVolume:    {"data"},
+		LabeledResourceNetwork:   {"backend"},
+		LabeledResourceSecret:    {},
+	}
+
+	var orphans []string
+	for _, orphan := range orphanedResources(resources, "edge_web", references) {
+		orphans = append(orphans, orphan.ID)
+	}
+
+	// the containers of the services, the containers without service and the default network are never orphans
+	expected := []string{"2", "6", "10", "11"}
+	if !reflect.DeepEqual(orphans, expected) {
+		t.Errorf("expected the orphans %v, got %v", expected, orphans)
+	}
+}
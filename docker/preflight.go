@@ -0,0 +1,138 @@
+package docker
+
+import (
+	"context"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/portainer/agent/registryauth"
+
+	"github.com/rs/zerolog/log"
+)
+
+// PublishedPort is a port of the host published by a running container
+type PublishedPort struct {
+	Container string
+	// Stack is the Compose project or the Swarm stack of the container, empty when it does not belong to a stack
+	Stack    string
+	Port     int
+	Protocol string
+}
+
+// ImagePlatforms are the platforms an image can run on
+type ImagePlatforms struct {
+	// Local is true when the image is present on the host, its platform is the one of the local image
+	Local bool
+	// Platforms are the os/architecture[/variant] of the image, empty when the registry does not report them
+	Platforms []string
+}
+
+// HostCapacity is the memory of the host and the folder where the images and containers are stored
+type HostCapacity struct {
+	MemTotal      int64
+	DockerRootDir string
+}
+
+// GetPublishedPorts returns the host ports published by the running containers
+func GetPublishedPorts(ctx context.Context) ([]PublishedPort, error) {
+	ports := []PublishedPort{}
+
+	err := withCli(func(cli *client.Client) error {
+		containers, err := cli.ContainerList(ctx, types.ContainerListOptions{})
+		if err != nil {
+			return err
+		}
+
+		for _, c := range containers {
+			stack := c.Labels[ComposeProjectLabel]
+			if stack == "" {
+				stack = c.Labels[ServiceNameLabel]
+			}
+
+			name := c.ID
+			if len(c.Names) > 0 {
+				name = strings.TrimPrefix(c.Names[0], "/")
+			}
+
+			for _, p := range c.Ports {
+				if p.PublicPort == 0 {
+					continue
+				}
+
+				ports = append(ports, PublishedPort{Container: name, Stack: stack, Port: int(p.PublicPort), Protocol: p.Type})
+			}
+		}
+
+		return nil
+	})
+
+	return ports, err
+}
+
+// GetImagePlatforms returns the platform of the image when it is present on the host, the platforms of its
+// manifest in the registry otherwise. The registry is queried with the credentials of its credential helper, when
+// one is configured.
+func GetImagePlatforms(ctx context.Context, image string) (ImagePlatforms, error) {
+	result := ImagePlatforms{Platforms: []string{}}
+
+	err := withCli(func(cli *client.Client) error {
+		inspect, _, err := cli.ImageInspectWithRaw(ctx, image)
+		if err == nil {
+			result.Local = true
+			result.Platforms = append(result.Platforms, platformString(inspect.Os, inspect.Architecture, inspect.Variant))
+
+			return nil
+		}
+
+		if !client.IsErrNotFound(err) {
+			return err
+		}
+
+		auth, err := registryauth.ImageRegistryAuth(image)
+		if err != nil {
+			log.Warn().Err(err).Str("image", image).Msg("unable to retrieve the credentials of the registry, resolving the image anonymously")
+		}
+
+		distribution, err := cli.DistributionInspect(ctx, image, auth)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range distribution.Platforms {
+			result.Platforms = append(result.Platforms, platformString(p.OS, p.Architecture, p.Variant))
+		}
+
+		return nil
+	})
+
+	return result, err
+}
+
+// GetHostCapacity returns the total memory of the host and the root folder of the Docker daemon
+func GetHostCapacity(ctx context.Context) (HostCapacity, error) {
+	capacity := HostCapacity{}
+
+	err := withCli(func(cli *client.Client) error {
+		info, err := cli.Info(ctx)
+		if err != nil {
+			return err
+		}
+
+		capacity.MemTotal = info.MemTotal
+		capacity.DockerRootDir = info.DockerRootDir
+
+		return nil
+	})
+
+	return capacity, err
+}
+
+func platformString(platformOS, architecture, variant string) string {
+	platform := platformOS + "/" + architecture
+	if variant != "" {
+		platform += "/" + variant
+	}
+
+	return platform
+}
@@ -0,0 +1,89 @@
+package docker
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// RedactedValue is the placeholder used in place of a redacted value.
+const RedactedValue = "<redacted>"
+
+// DefaultRedactionPatterns are the environment variable name patterns whose values are redacted
+// when no other policy is configured.
+var DefaultRedactionPatterns = []string{"*PASSWORD*", "*SECRET*", "*TOKEN*", "*KEY*"}
+
+// assignmentRegexp matches the KEY=value, KEY: value and "KEY": value assignments found in configuration files
+// such as .env, YAML, JSON or INI files.
+var assignmentRegexp = regexp.MustCompile(`^(\s*(?:export\s+)?["']?)([A-Za-z_][A-Za-z0-9_.-]*)(["']?\s*[:=]\s*)(.*?)(,?\s*)$`)
+
+// EnvRedactor masks the values of environment variables whose name matches one of its patterns.
+// Patterns use the path.Match syntax and are matched case-insensitively.
+type EnvRedactor struct {
+	patterns []string
+}
+
+// NewEnvRedactor returns a pointer to an EnvRedactor. DefaultRedactionPatterns are used when patterns is empty.
+func NewEnvRedactor(patterns []string) *EnvRedactor {
+	if len(patterns) == 0 {
+		patterns = DefaultRedactionPatterns
+	}
+
+	upper := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		upper = append(upper, strings.ToUpper(p))
+	}
+
+	return &EnvRedactor{patterns: upper}
+}
+
+// Match returns true if the specified name matches one of the redaction patterns.
+func (redactor *EnvRedactor) Match(name string) bool {
+	name = strings.ToUpper(name)
+
+	for _, p := range redactor.patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Redact returns a copy of env (in the KEY=value form) where the values of the matching variables are masked.
+func (redactor *EnvRedactor) Redact(env []string) []string {
+	redacted := make([]string, 0, len(env))
+
+	for _, e := range env {
+		name, _, found := strings.Cut(e, "=")
+		if found && redactor.Match(name) {
+			e = name + "=" + RedactedValue
+		}
+
+		redacted = append(redacted, e)
+	}
+
+	return redacted
+}
+
+// RedactContent returns a copy of the content of a configuration file where the values assigned to the keys
+// matching the redaction patterns are masked. Assignments are detected line by line.
+func (redactor *EnvRedactor) RedactContent(content string) string {
+	lines := strings.Split(content, "\n")
+
+	for i, line := range lines {
+		m := assignmentRegexp.FindStringSubmatch(line)
+		if m == nil || m[4] == "" || !redactor.Match(m[2]) {
+			continue
+		}
+
+		value := RedactedValue
+		if strings.HasPrefix(m[4], `"`) {
+			value = `"` + RedactedValue + `"`
+		}
+
+		lines[i] = m[1] + m[2] + m[3] + value + m[5]
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,83 @@
+package docker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEnvRedactorRedact(t *testing.T) {
+	redactor := NewEnvRedactor(nil)
+
+	redacted := redactor.Redact([]string{"DB_PASSWORD=secret", "api_token=abc", "PATH=/usr/bin", "EMPTY", "APP_KEY=a=b"})
+
+	expected := []string{"DB_PASSWORD=<redacted>", "api_token=<redacted>", "PATH=/usr/bin", "EMPTY", "APP_KEY=<redacted>"}
+	if !reflect.DeepEqual(redacted, expected) {
+		t.Errorf("expected %v, got %v", expected, redacted)
+	}
+}
+
+func TestEnvRedactorCustomPatterns(t *testing.T) {
+	redactor := NewEnvRedactor([]string{"internal_*"})
+
+	if !redactor.Match("INTERNAL_URL") {
+		t.Error("expected INTERNAL_URL to match the custom pattern")
+	}
+
+	if redactor.Match("DB_PASSWORD") {
+		t.Error("expected the default patterns to be replaced by the custom patterns")
+	}
+}
+
+func TestEnvRedactorRedactContent(t *testing.T) {
+	redactor := NewEnvRedactor(nil)
+
+	content := `DB_HOST=db
+DB_PASSWORD=secret
+export API_TOKEN='abc'
+{
+  "user": "admin",
+  "password": "hunter2",
+  "secret_key": 42
+}
+database:
+  password: changeme
+  password:
+`
+
+	expected := `DB_HOST=db
+DB_PASSWORD=<redacted>
+export API_TOKEN=<redacted>
+{
+  "user": "admin",
+  "password": "<redacted>",
+  "secret_key": <redacted>
+}
+database:
+  password: <redacted>
+  password:
+`
+
+	if redacted := redactor.RedactContent(content); redacted != expected {
+		t.Errorf("unexpected redacted content:\n%s", redacted)
+	}
+}
+
+func TestSnapshotEnv(t *testing.T) {
+	defer func() {
+		snapshotEnvRedactor = NewEnvRedactor(nil)
+		snapshotEnvDisabled = false
+	}()
+
+	SetSnapshotEnvRedaction([]string{"DB_*"})
+
+	env := SnapshotEnv([]string{"DB_PASSWORD=secret", "API_TOKEN=abc"})
+	if len(env) != 2 || env[0] != "DB_PASSWORD="+RedactedValue || env[1] != "API_TOKEN=abc" {
+		t.Errorf("unexpected snapshot env: %v", env)
+	}
+
+	DisableSnapshotEnv()
+
+	if env := SnapshotEnv([]string{"PATH=/bin"}); env != nil {
+		t.Errorf("expected no env when disabled, got %v", env)
+	}
+}
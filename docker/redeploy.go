@@ -0,0 +1,99 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// RedeployService forces the update of a Swarm service, the image tag is resolved again against the registry
+// so that the latest pushed image is pulled.
+func RedeployService(ctx context.Context, serviceName string) error {
+	return withCli(func(cli *client.Client) error {
+		return redeployService(ctx, cli, serviceName)
+	})
+}
+
+// RedeployStack re-pulls the images and redeploys all the services (swarm) or containers (compose) of a stack
+func RedeployStack(ctx context.Context, stackName string) error {
+	var swarmManager bool
+	err := withCli(func(cli *client.Client) error {
+		info, err := cli.Info(ctx)
+		if err != nil {
+			return err
+		}
+
+		swarmManager = info.Swarm.ControlAvailable
+
+		return nil
+	})
+	if err != nil {
+		return errors.WithMessage(err, "unable to retrieve the Docker engine information")
+	}
+
+	// Services can only be listed on a Swarm manager, the stack is a compose project otherwise
+	if swarmManager {
+		services, err := GetStackServices(ctx, stackName)
+		if err != nil {
+			return errors.WithMessage(err, "unable to retrieve the stack services")
+		}
+
+		if len(services) > 0 {
+			return withCli(func(cli *client.Client) error {
+				for _, service := range services {
+					if err := redeployService(ctx, cli, service.ID); err != nil {
+						return err
+					}
+				}
+
+				return nil
+			})
+		}
+	}
+
+	containers, err := GetContainersWithLabel(fmt.Sprintf("%s=%s", ComposeProjectLabel, stackName))
+	if err != nil {
+		return errors.WithMessage(err, "unable to retrieve the stack containers")
+	}
+
+	if len(containers) == 0 {
+		return fmt.Errorf("no service or container found for stack %s", stackName)
+	}
+
+	for _, c := range containers {
+		log.Debug().Str("stack", stackName).Str("container_id", c.ID).Str("image", c.Image).Msg("redeploying container")
+
+		_, err := ContainerRecreate(ctx, c.ID, RecreateChanges{Image: c.Image, PullImage: true})
+		if err != nil {
+			return errors.WithMessagef(err, "unable to redeploy container %s", c.ID)
+		}
+	}
+
+	return nil
+}
+
+func redeployService(ctx context.Context, cli *client.Client, serviceID string) error {
+	service, _, err := cli.ServiceInspectWithRaw(ctx, serviceID, types.ServiceInspectOptions{})
+	if err != nil {
+		return errors.WithMessage(err, "unable to inspect service")
+	}
+
+	spec := service.Spec
+	if spec.TaskTemplate.ContainerSpec != nil {
+		// Removing the digest pinned by the Swarm manager forces the tag to be resolved again
+		image, _, _ := strings.Cut(spec.TaskTemplate.ContainerSpec.Image, "@")
+		spec.TaskTemplate.ContainerSpec.Image = image
+	}
+	spec.TaskTemplate.ForceUpdate++
+
+	log.Debug().Str("service", spec.Name).Msg("redeploying service")
+
+	_, err = cli.ServiceUpdate(ctx, service.ID, service.Version, spec, types.ServiceUpdateOptions{QueryRegistry: true})
+
+	return err
+}
@@ -0,0 +1,68 @@
+package docker
+
+import (
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/errdefs"
+	"github.com/portainer/agent/registryauth"
+
+	"github.com/rs/zerolog/log"
+)
+
+// registryPullOptions returns the options of the pull of an image, authenticated with the credentials returned by the
+// credential helper of its registry when one is configured
+func registryPullOptions(image string) types.ImagePullOptions {
+	auth, err := registryauth.ImageRegistryAuth(image)
+	if err != nil {
+		log.Warn().Err(err).Str("image", image).Msg("unable to retrieve the credentials of the registry, pulling anonymously")
+	}
+
+	return types.ImagePullOptions{RegistryAuth: auth}
+}
+
+// withRegistryAuth executes pull with the credentials of the registry of the image. The credentials of the helpers
+// are short-lived, when the registry refuses them they are requested again from the helper and the pull is retried
+// once.
+func withRegistryAuth(image string, pull func(options types.ImagePullOptions) error) error {
+	options := registryPullOptions(image)
+
+	err := pull(options)
+	if err == nil || options.RegistryAuth == "" || !isUnauthorized(err) {
+		return err
+	}
+
+	host, hostErr := registryauth.ImageRegistryHost(image)
+	if hostErr != nil {
+		return err
+	}
+
+	log.Debug().Str("image", image).Msg("the credentials of the registry were refused, requesting new credentials")
+
+	registryauth.Invalidate(host)
+
+	return pull(registryPullOptions(image))
+}
+
+// gitRemoteContext returns the remote context of a build, authenticated with the credentials returned by the credential
+// helper of its Git host when one is configured
+func gitRemoteContext(remoteContext string) string {
+	authenticated, err := registryauth.AuthenticatedGitURL(remoteContext)
+	if err != nil {
+		log.Warn().Err(err).Str("remote_context", remoteContext).Msg("unable to retrieve the credentials of the Git repository, cloning anonymously")
+	}
+
+	return authenticated
+}
+
+// isUnauthorized returns true when the registry refused the credentials, the errors of the progress stream of a pull
+// are only messages
+func isUnauthorized(err error) bool {
+	if errdefs.IsUnauthorized(err) {
+		return true
+	}
+
+	message := strings.ToLower(err.Error())
+
+	return strings.Contains(message, "unauthorized") || strings.Contains(message, "authentication required")
+}
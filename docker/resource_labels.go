@@ -0,0 +1,207 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/client"
+	"github.com/portainer/agent"
+)
+
+// LabeledResource is a Docker resource created through the agent
+type LabeledResource struct {
+	Type   string            `json:"Type"`
+	ID     string            `json:"Id"`
+	Name   string            `json:"Name"`
+	Labels map[string]string `json:"Labels"`
+}
+
+// Labeled resource types
+const (
+	LabeledResourceContainer = "container"
+	LabeledResourceNetwork   = "network"
+	LabeledResourceVolume    = "volume"
+	LabeledResourceService   = "service"
+	LabeledResourceConfig    = "config"
+	LabeledResourceSecret    = "secret"
+)
+
+// ResourceLabels returns the attribution labels of a resource created through the agent, the empty values are
+// omitted
+func ResourceLabels(endpoint, stack, owner string) map[string]string {
+	labels := map[string]string{}
+
+	for key, value := range map[string]string{
+		agent.ResourceLabelEndpoint: endpoint,
+		agent.ResourceLabelStack:    stack,
+		agent.ResourceLabelOwner:    owner,
+	} {
+		if value != "" {
+			labels[key] = value
+		}
+	}
+
+	return labels
+}
+
+// AddResourceLabels adds the labels to the Labels of the JSON body of a create request (containers, networks,
+// volumes, services, configs and secrets). The labels already defined in the body are kept. When no stack is
+// given, the stack label is derived from the Compose project or Swarm stack labels of the body.
+func AddResourceLabels(body []byte, labels map[string]string) ([]byte, error) {
+	var payload map[string]json.RawMessage
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		body = []byte("{}")
+	}
+
+	err := json.Unmarshal(body, &payload)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := map[string]string{}
+	if raw, ok := payload["Labels"]; ok && string(raw) != "null" {
+		err = json.Unmarshal(raw, &existing)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if _, ok := labels[agent.ResourceLabelStack]; !ok {
+		stack := existing[ComposeProjectLabel]
+		if stack == "" {
+			stack = existing[ServiceNameLabel]
+		}
+
+		if stack != "" {
+			existing[agent.ResourceLabelStack] = stack
+		}
+	}
+
+	for key, value := range labels {
+		if _, ok := existing[key]; !ok {
+			existing[key] = value
+		}
+	}
+
+	payload["Labels"], err = json.Marshal(existing)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(payload)
+}
+
+// IsResourceCreatePath returns true when path is the path of a create request of the Docker API accepting labels
+func IsResourceCreatePath(path string) bool {
+	resource, action, ok := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if !ok || action != "create" {
+		return false
+	}
+
+	switch resource {
+	case "containers", "networks", "volumes", "services", "configs", "secrets":
+		return true
+	}
+
+	return false
+}
+
+// ListLabeledResources returns the resources of the host matching all the labels, an empty value matches any
+// value of the label. The Swarm resources are only listed on a manager node.
+func ListLabeledResources(ctx context.Context, labels map[string]string) ([]LabeledResource, error) {
+	args := filters.NewArgs()
+	for key, value := range labels {
+		if value == "" {
+			args.Add("label", key)
+			continue
+		}
+
+		args.Add("label", key+"="+value)
+	}
+
+	resources := []LabeledResource{}
+
+	err := withCli(func(cli *client.Client) error {
+		containers, err := cli.ContainerList(ctx, types.ContainerListOptions{All: true, Filters: args})
+		if err != nil {
+			return err
+		}
+
+		for _, c := range containers {
+			name := c.ID
+			if len(c.Names) > 0 {
+				name = strings.TrimPrefix(c.Names[0], "/")
+			}
+
+			resources = append(resources, LabeledResource{LabeledResourceContainer, c.ID, name, c.Labels})
+		}
+
+		networks, err := cli.NetworkList(ctx, types.NetworkListOptions{Filters: args})
+		if err != nil {
+			return err
+		}
+
+		for _, n := range networks {
+			resources = append(resources, LabeledResource{LabeledResourceNetwork, n.ID, n.Name, n.Labels})
+		}
+
+		volumes, err := cli.VolumeList(ctx, args)
+		if err != nil {
+			return err
+		}
+
+		for _, v := range volumes.Volumes {
+			resources = append(resources, LabeledResource{LabeledResourceVolume, v.Name, v.Name, v.Labels})
+		}
+
+		info, err := cli.Info(ctx)
+		if err != nil {
+			return err
+		}
+
+		if !info.Swarm.ControlAvailable {
+			return nil
+		}
+
+		services, err := cli.ServiceList(ctx, types.ServiceListOptions{Filters: args})
+		if err != nil {
+			return err
+		}
+
+		for _, s := range services {
+			resources = append(resources, labeledSwarmResource(LabeledResourceService, s.ID, s.Spec.Annotations))
+		}
+
+		configs, err := cli.ConfigList(ctx, types.ConfigListOptions{Filters: args})
+		if err != nil {
+			return err
+		}
+
+		for _, c := range configs {
+			resources = append(resources, labeledSwarmResource(LabeledResourceConfig, c.ID, c.Spec.Annotations))
+		}
+
+		secrets, err := cli.SecretList(ctx, types.SecretListOptions{Filters: args})
+		if err != nil {
+			return err
+		}
+
+		for _, s := range secrets {
+			resources = append(resources, labeledSwarmResource(LabeledResourceSecret, s.ID, s.Spec.Annotations))
+		}
+
+		return nil
+	})
+
+	return resources, err
+}
+
+func labeledSwarmResource(resourceType, id string, annotations swarm.Annotations) LabeledResource {
+	return LabeledResource{resourceType, id, annotations.Name, annotations.Labels}
+}
@@ -0,0 +1,61 @@
+package docker
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/portainer/agent"
+)
+
+func TestAddResourceLabels(t *testing.T) {
+	body := []byte(`{"Image":"nginx","Labels":{"com.docker.compose.project":"web","io.portainer.agent.owner":"alice"}}`)
+
+	out, err := AddResourceLabels(body, ResourceLabels("edge-id", "", "bob"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var payload struct {
+		Image  string
+		Labels map[string]string
+	}
+
+	err = json.Unmarshal(out, &payload)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := map[string]string{
+		ComposeProjectLabel:         "web",
+		agent.ResourceLabelEndpoint: "edge-id",
+		agent.ResourceLabelStack:    "web",
+		agent.ResourceLabelOwner:    "alice",
+	}
+
+	if payload.Image != "nginx" || len(payload.Labels) != len(expected) {
+		t.Fatalf("unexpected payload: %s", out)
+	}
+
+	for key, value := range expected {
+		if payload.Labels[key] != value {
+			t.Errorf("expected label %s=%s, got %q", key, value, payload.Labels[key])
+		}
+	}
+}
+
+func TestIsResourceCreatePath(t *testing.T) {
+	tests := map[string]bool{
+		"/containers/create":      true,
+		"/volumes/create":         true,
+		"/services/create":        true,
+		"/images/create":          false,
+		"/containers/abc/start":   false,
+		"/containers/create/test": false,
+	}
+
+	for path, expected := range tests {
+		if IsResourceCreatePath(path) != expected {
+			t.Errorf("IsResourceCreatePath(%q) = %t, expected %t", path, !expected, expected)
+		}
+	}
+}
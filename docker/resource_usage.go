@@ -0,0 +1,74 @@
+package docker
+
+import (
+	"context"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// ResourceUsage represents the resources used by the containers and volumes of the Docker host
+type ResourceUsage struct {
+	Containers int
+	Volumes    int
+	Memory     int64
+	CPUs       float64
+}
+
+// GetResourceUsage returns the number of containers and volumes of the host and the memory and CPU reserved by
+// the containers. The resources of the stack named excludedStack are ignored, as they are replaced when the stack
+// is deployed again.
+func GetResourceUsage(ctx context.Context, excludedStack string) (ResourceUsage, error) {
+	usage := ResourceUsage{}
+
+	belongsToStack := func(labels map[string]string) bool {
+		return excludedStack != "" && (labels[ComposeProjectLabel] == excludedStack || labels[ServiceNameLabel] == excludedStack)
+	}
+
+	err := withCli(func(cli *client.Client) error {
+		containers, err := cli.ContainerList(ctx, types.ContainerListOptions{All: true})
+		if err != nil {
+			return err
+		}
+
+		for _, c := range containers {
+			if belongsToStack(c.Labels) {
+				continue
+			}
+
+			usage.Containers++
+
+			container, err := cli.ContainerInspect(ctx, c.ID)
+			if err != nil {
+				if client.IsErrNotFound(err) {
+					continue
+				}
+
+				return err
+			}
+
+			if container.HostConfig == nil {
+				continue
+			}
+
+			usage.Memory += container.HostConfig.MemoryReservation
+			usage.CPUs += float64(container.HostConfig.NanoCPUs) / 1e9
+		}
+
+		volumes, err := cli.VolumeList(ctx, filters.NewArgs())
+		if err != nil {
+			return err
+		}
+
+		for _, v := range volumes.Volumes {
+			if !belongsToStack(v.Labels) {
+				usage.Volumes++
+			}
+		}
+
+		return nil
+	})
+
+	return usage, err
+}
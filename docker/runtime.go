@@ -0,0 +1,155 @@
+package docker
+
+import (
+	"context"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// Container runtimes serving the Docker API
+const (
+	RuntimeDocker = "docker"
+	RuntimePodman = "podman"
+)
+
+// podmanEngineComponent is the name of the component reported in the version of a Podman engine
+const podmanEngineComponent = "Podman Engine"
+
+// Labels identifying the stack of a container created with docker compose or podman-compose
+const (
+	composeProjectLabel       = "com.docker.compose.project"
+	podmanComposeProjectLabel = "io.podman.compose.project"
+)
+
+var currentRuntime ContainerRuntime = dockerRuntime{}
+
+// ContainerRuntime represents the engine serving the Docker API. Podman implements the Docker API without
+// Swarm and reports the state of the containers differently.
+type ContainerRuntime interface {
+	// Name returns the name of the runtime reported to Portainer
+	Name() string
+	// SupportsSwarm returns true when the engine can be part of a Swarm cluster
+	SupportsSwarm() bool
+	// ContainerHealth returns the health of a container (healthy, unhealthy, starting), empty without healthcheck.
+	// The inspection of the container is nil when it could not be retrieved.
+	ContainerHealth(container types.Container, inspect *types.ContainerJSON) string
+	// ContainerStopped returns true when the container is not running anymore
+	ContainerStopped(container types.Container) bool
+	// StackName returns the name of the stack of a container from its labels, empty outside of a stack
+	StackName(labels map[string]string) string
+}
+
+type dockerRuntime struct{}
+
+func (dockerRuntime) Name() string {
+	return RuntimeDocker
+}
+
+func (dockerRuntime) SupportsSwarm() bool {
+	return true
+}
+
+func (dockerRuntime) ContainerHealth(container types.Container, inspect *types.ContainerJSON) string {
+	return healthFromStatus(container.Status)
+}
+
+func (dockerRuntime) ContainerStopped(container types.Container) bool {
+	return container.State == "exited"
+}
+
+func (dockerRuntime) StackName(labels map[string]string) string {
+	return labels[composeProjectLabel]
+}
+
+type podmanRuntime struct{}
+
+func (podmanRuntime) Name() string {
+	return RuntimePodman
+}
+
+func (podmanRuntime) SupportsSwarm() bool {
+	return false
+}
+
+// ContainerHealth relies on the inspection of the container, the status of the containers listed by Podman does not
+// always contain their health
+func (podmanRuntime) ContainerHealth(container types.Container, inspect *types.ContainerJSON) string {
+	if inspect != nil && inspect.ContainerJSONBase != nil && inspect.State != nil && inspect.State.Health != nil {
+		return inspect.State.Health.Status
+	}
+
+	return healthFromStatus(container.Status)
+}
+
+func (podmanRuntime) ContainerStopped(container types.Container) bool {
+	return container.State == "exited" || container.State == "stopped"
+}
+
+func (podmanRuntime) StackName(labels map[string]string) string {
+	if project := labels[composeProjectLabel]; project != "" {
+		return project
+	}
+
+	return labels[podmanComposeProjectLabel]
+}
+
+func healthFromStatus(status string) string {
+	switch {
+	case strings.Contains(status, "(healthy)"):
+		return types.Healthy
+	case strings.Contains(status, "(unhealthy)"):
+		return types.Unhealthy
+	case strings.Contains(status, "(health: starting)"):
+		return types.Starting
+	}
+
+	return ""
+}
+
+// NewRuntime returns the ContainerRuntime named name, Docker when the name is unknown
+func NewRuntime(name string) ContainerRuntime {
+	if name == RuntimePodman {
+		return podmanRuntime{}
+	}
+
+	return dockerRuntime{}
+}
+
+// DetectRuntime returns the ContainerRuntime of the engine the agent is connected to
+func DetectRuntime(ctx context.Context) (ContainerRuntime, error) {
+	var version types.Version
+
+	err := withCli(func(cli *client.Client) error {
+		var err error
+		version, err = cli.ServerVersion(ctx)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return runtimeFromVersion(version), nil
+}
+
+func runtimeFromVersion(version types.Version) ContainerRuntime {
+	for _, component := range version.Components {
+		if component.Name == podmanEngineComponent {
+			return podmanRuntime{}
+		}
+	}
+
+	return dockerRuntime{}
+}
+
+// SetRuntime sets the ContainerRuntime of the engine the agent is connected to, Docker by default
+func SetRuntime(runtime ContainerRuntime) {
+	currentRuntime = runtime
+}
+
+// CurrentRuntime returns the ContainerRuntime of the engine the agent is connected to
+func CurrentRuntime() ContainerRuntime {
+	return currentRuntime
+}
@@ -0,0 +1,51 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestRuntimeFromVersion(t *testing.T) {
+	podman := types.Version{Components: []types.ComponentVersion{{Name: "Podman Engine", Version: "4.6.1"}}}
+	if name := runtimeFromVersion(podman).Name(); name != RuntimePodman {
+		t.Errorf("expected %s, got %s", RuntimePodman, name)
+	}
+
+	engine := types.Version{Components: []types.ComponentVersion{{Name: "Engine", Version: "24.0.5"}, {Name: "containerd"}}}
+	if name := runtimeFromVersion(engine).Name(); name != RuntimeDocker {
+		t.Errorf("expected %s, got %s", RuntimeDocker, name)
+	}
+}
+
+func TestContainerHealth(t *testing.T) {
+	container := types.Container{Status: "Up 2 minutes"}
+	inspect := &types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{
+		State: &types.ContainerState{Health: &types.Health{Status: types.Unhealthy}},
+	}}
+
+	if health := NewRuntime(RuntimePodman).ContainerHealth(container, inspect); health != types.Unhealthy {
+		t.Errorf("expected the health of the inspection, got %q", health)
+	}
+
+	if health := NewRuntime(RuntimeDocker).ContainerHealth(container, inspect); health != "" {
+		t.Errorf("expected no health, got %q", health)
+	}
+
+	container.Status = "Up 2 minutes (healthy)"
+	if health := NewRuntime(RuntimePodman).ContainerHealth(container, nil); health != types.Healthy {
+		t.Errorf("expected the health of the status, got %q", health)
+	}
+}
+
+func TestStackName(t *testing.T) {
+	labels := map[string]string{podmanComposeProjectLabel: "web"}
+
+	if stack := NewRuntime(RuntimePodman).StackName(labels); stack != "web" {
+		t.Errorf("expected the podman-compose project, got %q", stack)
+	}
+
+	if stack := NewRuntime(RuntimeDocker).StackName(labels); stack != "" {
+		t.Errorf("expected no stack, got %q", stack)
+	}
+}
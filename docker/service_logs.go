@@ -0,0 +1,102 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// ServiceTaskContainer is the container of a task of a Swarm service
+type ServiceTaskContainer struct {
+	ID          string
+	Name        string
+	NodeName    string
+	ContainerID string
+	TTY         bool
+}
+
+// GetServiceTaskContainers returns the containers of the tasks of a Swarm service, the service is referenced by its
+// identifier or name. The node of each task is identified by its hostname.
+func GetServiceTaskContainers(ctx context.Context, serviceID string) ([]ServiceTaskContainer, error) {
+	tasks := []ServiceTaskContainer{}
+
+	err := withCli(func(cli *client.Client) error {
+		service, _, err := cli.ServiceInspectWithRaw(ctx, serviceID, types.ServiceInspectOptions{})
+		if err != nil {
+			return err
+		}
+
+		nodes, err := cli.NodeList(ctx, types.NodeListOptions{})
+		if err != nil {
+			return err
+		}
+
+		hostnames := map[string]string{}
+		for _, node := range nodes {
+			hostnames[node.ID] = node.Description.Hostname
+		}
+
+		serviceTasks, err := cli.TaskList(ctx, types.TaskListOptions{
+			Filters: filters.NewArgs(filters.Arg("service", service.ID)),
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, task := range serviceTasks {
+			if task.Status.ContainerStatus == nil || task.Status.ContainerStatus.ContainerID == "" {
+				continue
+			}
+
+			// The tasks of global services have no slot and are named after their node
+			name := fmt.Sprintf("%s.%d", service.Spec.Name, task.Slot)
+			if task.Slot == 0 {
+				name = fmt.Sprintf("%s.%s", service.Spec.Name, task.NodeID)
+			}
+
+			tasks = append(tasks, ServiceTaskContainer{
+				ID:          task.ID,
+				Name:        name,
+				NodeName:    hostnames[task.NodeID],
+				ContainerID: task.Status.ContainerStatus.ContainerID,
+				TTY:         task.Spec.ContainerSpec != nil && task.Spec.ContainerSpec.TTY,
+			})
+		}
+
+		return nil
+	})
+
+	return tasks, err
+}
+
+// cliReadCloser closes the client used to open a stream once the stream is closed
+type cliReadCloser struct {
+	io.ReadCloser
+	cli *client.Client
+}
+
+func (r *cliReadCloser) Close() error {
+	defer r.cli.Close()
+
+	return r.ReadCloser.Close()
+}
+
+// ContainerLogs returns the logs of a container, they are multiplexed unless the container has a TTY
+func ContainerLogs(ctx context.Context, containerID string, options types.ContainerLogsOptions) (io.ReadCloser, error) {
+	cli, err := NewClient()
+	if err != nil {
+		return nil, err
+	}
+
+	logs, err := cli.ContainerLogs(ctx, containerID, options)
+	if err != nil {
+		cli.Close()
+		return nil, err
+	}
+
+	return &cliReadCloser{ReadCloser: logs, cli: cli}, nil
+}
@@ -2,9 +2,10 @@ package docker
 
 import (
 	"context"
-	"strings"
+	"sort"
 	"time"
 
+	"github.com/portainer/agent/metrics"
 	portainer "github.com/portainer/portainer/api"
 
 	"github.com/docker/docker/api/types"
@@ -13,14 +14,61 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-func CreateSnapshot() (*portainer.DockerSnapshot, error) {
+// snapshotInspectTimeout is the maximum duration of the inspection of a container during a snapshot
+var snapshotInspectTimeout = 10 * time.Second
+
+var (
+	snapshotConcurrency = defaultBatchConcurrency
+	snapshotEnvRedactor = NewEnvRedactor(nil)
+	snapshotEnvDisabled bool
+)
+
+// SetSnapshotConcurrency sets the maximum number of containers inspected in parallel during a snapshot, it is set on
+// startup from the local configuration
+func SetSnapshotConcurrency(concurrency int) {
+	snapshotConcurrency = concurrency
+}
+
+// SetSnapshotEnvRedaction sets the patterns of the names of the environment variables whose values are masked in
+// the snapshots, DefaultRedactionPatterns are used when patterns is empty
+func SetSnapshotEnvRedaction(patterns []string) {
+	snapshotEnvRedactor = NewEnvRedactor(patterns)
+}
+
+// DisableSnapshotEnv removes the environment variables of the containers from the snapshots
+func DisableSnapshotEnv() {
+	snapshotEnvDisabled = true
+}
+
+// SnapshotEnv returns the environment variables of a container as sent in the snapshots: masked according to the
+// redaction patterns, or nil when their collection is disabled
+func SnapshotEnv(env []string) []string {
+	if snapshotEnvDisabled || env == nil {
+		return nil
+	}
+
+	return snapshotEnvRedactor.Redact(env)
+}
+
+// CreateSnapshot creates a snapshot of the Docker environment, its duration and counts are recorded in the metrics.
+// The requests to the Docker API are canceled once ctx is done.
+func CreateSnapshot(ctx context.Context) (*portainer.DockerSnapshot, error) {
+	start := time.Now()
+
+	snapshot, err := createSnapshot(ctx)
+	metrics.ObserveDockerSnapshot(snapshot, time.Since(start), err)
+
+	return snapshot, err
+}
+
+func createSnapshot(ctx context.Context) (*portainer.DockerSnapshot, error) {
 	cli, err := NewClient()
 	if err != nil {
 		return nil, err
 	}
 	defer cli.Close()
 
-	_, err = cli.Ping(context.Background())
+	_, err = cli.Ping(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -29,60 +77,65 @@ func CreateSnapshot() (*portainer.DockerSnapshot, error) {
 		StackCount: 0,
 	}
 
-	err = snapshotInfo(snapshot, cli)
+	err = snapshotInfo(ctx, snapshot, cli)
 	if err != nil {
 		log.Warn().Err(err).Msg("unable to snapshot engine information")
 	}
 
 	if snapshot.Swarm {
-		err = snapshotSwarmServices(snapshot, cli)
+		err = snapshotSwarmServices(ctx, snapshot, cli)
 		if err != nil {
 			log.Warn().Err(err).Msg("unable to snapshot Swarm services")
 		}
 
-		err = snapshotNodes(snapshot, cli)
+		err = snapshotNodes(ctx, snapshot, cli)
 		if err != nil {
 			log.Warn().Err(err).Msg("unable to snapshot Swarm nodes")
 		}
 	}
 
-	err = snapshotContainers(snapshot, cli)
+	err = snapshotContainers(ctx, snapshot, cli)
 	if err != nil {
 		log.Warn().Err(err).Msg("unable to snapshot containers")
 	}
 
-	err = snapshotImages(snapshot, cli)
+	err = snapshotImages(ctx, snapshot, cli)
 	if err != nil {
 		log.Warn().Err(err).Msg("unable to snapshot images")
 	}
 
-	err = snapshotVolumes(snapshot, cli)
+	err = snapshotVolumes(ctx, snapshot, cli)
 	if err != nil {
 		log.Warn().Err(err).Msg("unable to snapshot volumes")
 	}
 
-	err = snapshotNetworks(snapshot, cli)
+	err = snapshotNetworks(ctx, snapshot, cli)
 	if err != nil {
 		log.Warn().Err(err).Msg("unable to snapshot networks")
 	}
 
-	err = snapshotVersion(snapshot, cli)
+	err = snapshotVersion(ctx, snapshot, cli)
 	if err != nil {
 		log.Warn().Err(err).Msg("unable to snapshot engine version")
 	}
 
+	// the snapshot is incomplete when it was canceled
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	snapshot.Time = time.Now().Unix()
 
 	return snapshot, nil
 }
 
-func snapshotInfo(snapshot *portainer.DockerSnapshot, cli *client.Client) error {
-	info, err := cli.Info(context.Background())
+func snapshotInfo(ctx context.Context, snapshot *portainer.DockerSnapshot, cli *client.Client) error {
+	info, err := cli.Info(ctx)
 	if err != nil {
 		return err
 	}
 
-	snapshot.Swarm = info.Swarm.ControlAvailable
+	snapshot.Swarm = info.Swarm.ControlAvailable && currentRuntime.SupportsSwarm()
 	snapshot.DockerVersion = info.ServerVersion
 	snapshot.TotalCPU = info.NCPU
 	snapshot.TotalMemory = info.MemTotal
@@ -91,8 +144,8 @@ func snapshotInfo(snapshot *portainer.DockerSnapshot, cli *client.Client) error
 	return nil
 }
 
-func snapshotNodes(snapshot *portainer.DockerSnapshot, cli *client.Client) error {
-	nodes, err := cli.NodeList(context.Background(), types.NodeListOptions{})
+func snapshotNodes(ctx context.Context, snapshot *portainer.DockerSnapshot, cli *client.Client) error {
+	nodes, err := cli.NodeList(ctx, types.NodeListOptions{})
 	if err != nil {
 		return err
 	}
@@ -109,10 +162,10 @@ func snapshotNodes(snapshot *portainer.DockerSnapshot, cli *client.Client) error
 	return nil
 }
 
-func snapshotSwarmServices(snapshot *portainer.DockerSnapshot, cli *client.Client) error {
+func snapshotSwarmServices(ctx context.Context, snapshot *portainer.DockerSnapshot, cli *client.Client) error {
 	stacks := make(map[string]struct{})
 
-	services, err := cli.ServiceList(context.Background(), types.ServiceListOptions{})
+	services, err := cli.ServiceList(ctx, types.ServiceListOptions{})
 	if err != nil {
 		return err
 	}
@@ -131,8 +184,8 @@ func snapshotSwarmServices(snapshot *portainer.DockerSnapshot, cli *client.Clien
 	return nil
 }
 
-func snapshotContainers(snapshot *portainer.DockerSnapshot, cli *client.Client) error {
-	rawContainers, err := cli.ContainerList(context.Background(), types.ContainerListOptions{All: true})
+func snapshotContainers(ctx context.Context, snapshot *portainer.DockerSnapshot, cli *client.Client) error {
+	rawContainers, err := cli.ContainerList(ctx, types.ContainerListOptions{All: true})
 	if err != nil {
 		return err
 	}
@@ -142,44 +195,80 @@ func snapshotContainers(snapshot *portainer.DockerSnapshot, cli *client.Client)
 	healthyContainers := 0
 	unhealthyContainers := 0
 	stacks := make(map[string]struct{})
+	gpuUseSet := make(map[string]struct{})
+	gpuUseAll := false
+
+	containers := make([]portainer.DockerContainerSnapshot, len(rawContainers))
+	inspects := make([]*types.ContainerJSON, len(rawContainers))
+
+	ids := make([]string, len(rawContainers))
+	indexes := make(map[string]int, len(rawContainers))
+	for i, container := range rawContainers {
+		ids[i] = container.ID
+		indexes[container.ID] = i
+		containers[i] = portainer.DockerContainerSnapshot{Container: container}
+	}
+
+	// Each goroutine fills a distinct container, the env is left empty when the container cannot be inspected
+	runBatch(ids, snapshotConcurrency, func(id string) error {
+		// the containers left once the snapshot is canceled are not inspected
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
-	containers := make([]portainer.DockerContainerSnapshot, 0)
+		inspectCtx, cancel := context.WithTimeout(ctx, snapshotInspectTimeout)
+		defer cancel()
 
-	for _, container := range rawContainers {
-		response, err := cli.ContainerInspect(context.Background(), container.ID)
+		response, err := cli.ContainerInspect(inspectCtx, id)
 		if err != nil {
-			log.Warn().Err(err).Msg("failed to retrieve env for container " + container.ID + ". Skipping.")
-			containers = append(containers, portainer.DockerContainerSnapshot{Container: container})
+			log.Warn().Err(err).Msg("failed to retrieve env for container " + id + ". Skipping.")
 
-			continue
+			return err
 		}
 
-		containers = append(containers, portainer.DockerContainerSnapshot{
-			Container: container,
-			Env:       response.Config.Env,
-		})
-	}
+		if response.Config != nil {
+			containers[indexes[id]].Env = SnapshotEnv(response.Config.Env)
+		}
+		inspects[indexes[id]] = &response
+
+		return nil
+	})
 
-	for _, container := range containers {
-		if container.State == "exited" {
+	for i, container := range containers {
+		if currentRuntime.ContainerStopped(container.Container) {
 			stoppedContainers++
 		} else if container.State == "running" {
 			runningContainers++
+
+			if inspects[i] != nil && inspects[i].ContainerJSONBase != nil {
+				deviceIDs, all, _ := containerGPUs(inspects[i].HostConfig)
+				gpuUseAll = gpuUseAll || all
+				for _, id := range deviceIDs {
+					gpuUseSet[id] = struct{}{}
+				}
+			}
 		}
 
-		if strings.Contains(container.Status, "(healthy)") {
+		switch currentRuntime.ContainerHealth(container.Container, inspects[i]) {
+		case types.Healthy:
 			healthyContainers++
-		} else if strings.Contains(container.Status, "(unhealthy)") {
+		case types.Unhealthy:
 			unhealthyContainers++
 		}
 
-		for k, v := range container.Labels {
-			if k == "com.docker.compose.project" {
-				stacks[v] = struct{}{}
-			}
+		if stack := currentRuntime.StackName(container.Labels); stack != "" {
+			stacks[stack] = struct{}{}
 		}
 	}
 
+	gpuUseList := make([]string, 0, len(gpuUseSet))
+	for id := range gpuUseSet {
+		gpuUseList = append(gpuUseList, id)
+	}
+	sort.Strings(gpuUseList)
+
+	snapshot.GpuUseAll = gpuUseAll
+	snapshot.GpuUseList = gpuUseList
 	snapshot.RunningContainerCount = runningContainers
 	snapshot.StoppedContainerCount = stoppedContainers
 	snapshot.HealthyContainerCount = healthyContainers
@@ -190,8 +279,8 @@ func snapshotContainers(snapshot *portainer.DockerSnapshot, cli *client.Client)
 	return nil
 }
 
-func snapshotImages(snapshot *portainer.DockerSnapshot, cli *client.Client) error {
-	images, err := cli.ImageList(context.Background(), types.ImageListOptions{})
+func snapshotImages(ctx context.Context, snapshot *portainer.DockerSnapshot, cli *client.Client) error {
+	images, err := cli.ImageList(ctx, types.ImageListOptions{})
 	if err != nil {
 		return err
 	}
@@ -202,8 +291,8 @@ func snapshotImages(snapshot *portainer.DockerSnapshot, cli *client.Client) erro
 	return nil
 }
 
-func snapshotVolumes(snapshot *portainer.DockerSnapshot, cli *client.Client) error {
-	volumes, err := cli.VolumeList(context.Background(), filters.Args{})
+func snapshotVolumes(ctx context.Context, snapshot *portainer.DockerSnapshot, cli *client.Client) error {
+	volumes, err := cli.VolumeList(ctx, filters.Args{})
 	if err != nil {
 		return err
 	}
@@ -214,8 +303,8 @@ func snapshotVolumes(snapshot *portainer.DockerSnapshot, cli *client.Client) err
 	return nil
 }
 
-func snapshotNetworks(snapshot *portainer.DockerSnapshot, cli *client.Client) error {
-	networks, err := cli.NetworkList(context.Background(), types.NetworkListOptions{})
+func snapshotNetworks(ctx context.Context, snapshot *portainer.DockerSnapshot, cli *client.Client) error {
+	networks, err := cli.NetworkList(ctx, types.NetworkListOptions{})
 	if err != nil {
 		return err
 	}
@@ -225,8 +314,8 @@ func snapshotNetworks(snapshot *portainer.DockerSnapshot, cli *client.Client) er
 	return nil
 }
 
-func snapshotVersion(snapshot *portainer.DockerSnapshot, cli *client.Client) error {
-	version, err := cli.ServerVersion(context.Background())
+func snapshotVersion(ctx context.Context, snapshot *portainer.DockerSnapshot, cli *client.Client) error {
+	version, err := cli.ServerVersion(ctx)
 	if err != nil {
 		return err
 	}
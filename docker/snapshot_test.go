@@ -0,0 +1,157 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	portainer "github.com/portainer/portainer/api"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+// snapshotDaemon serves the container endpoints of the Docker API used by the snapshots, the inspection of the
+// blocked containers only ends with its request
+type snapshotDaemon struct {
+	ids     []string
+	blocked map[string]bool
+
+	mu          sync.Mutex
+	inspected   int
+	inFlight    int
+	maxInFlight int
+}
+
+func (d *snapshotDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// the version of the API prefixes the path
+	path := r.URL.Path[strings.Index(r.URL.Path[1:], "/")+1:]
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if path == "/containers/json" {
+		containers := make([]types.Container, 0, len(d.ids))
+		for _, id := range d.ids {
+			containers = append(containers, types.Container{ID: id, State: "running"})
+		}
+
+		json.NewEncoder(w).Encode(containers)
+		return
+	}
+
+	id := strings.TrimSuffix(strings.TrimPrefix(path, "/containers/"), "/json")
+
+	d.mu.Lock()
+	d.inspected++
+	d.inFlight++
+	d.maxInFlight = max(d.maxInFlight, d.inFlight)
+	d.mu.Unlock()
+
+	defer func() {
+		d.mu.Lock()
+		d.inFlight--
+		d.mu.Unlock()
+	}()
+
+	if d.blocked[id] {
+		<-r.Context().Done()
+		return
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	json.NewEncoder(w).Encode(types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{ID: id},
+		Config:            &container.Config{Env: []string{"MODE=" + id}},
+	})
+}
+
+func (d *snapshotDaemon) stats() (inspected, maxInFlight int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.inspected, d.maxInFlight
+}
+
+func TestSnapshotContainers(t *testing.T) {
+	defer func(concurrency int, timeout time.Duration) {
+		snapshotConcurrency, snapshotInspectTimeout = concurrency, timeout
+	}(snapshotConcurrency, snapshotInspectTimeout)
+
+	snapshotConcurrency = 2
+	snapshotInspectTimeout = 200 * time.Millisecond
+
+	daemon := &snapshotDaemon{
+		ids:     []string{"a", "b", "slow", "c", "d", "e"},
+		blocked: map[string]bool{"slow": true},
+	}
+	cli := newFakeDaemonClient(t, daemon)
+
+	snapshot := &portainer.DockerSnapshot{}
+
+	start := time.Now()
+	err := snapshotContainers(context.Background(), snapshot, cli)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the slow container only holds one of the workers until its inspection times out
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the slow container to time out, the snapshot took %s", elapsed)
+	}
+
+	if _, concurrency := daemon.stats(); concurrency > 2 {
+		t.Errorf("expected at most 2 containers to be inspected in parallel, got %d", concurrency)
+	}
+
+	containers := snapshot.SnapshotRaw.Containers
+	if len(containers) != len(daemon.ids) || snapshot.RunningContainerCount != len(daemon.ids) {
+		t.Fatalf("expected %d running containers, got %d", len(daemon.ids), len(containers))
+	}
+
+	for i, id := range daemon.ids {
+		if containers[i].ID != id {
+			t.Errorf("expected the containers to keep their order, got %s at %d", containers[i].ID, i)
+		}
+
+		switch {
+		case id == "slow" && containers[i].Env != nil:
+			t.Errorf("expected the environment of the container that timed out to be left empty, got %v", containers[i].Env)
+		case id != "slow" && (len(containers[i].Env) != 1 || containers[i].Env[0] != "MODE="+id):
+			t.Errorf("expected the environment of %s to be collected, got %v", id, containers[i].Env)
+		}
+	}
+}
+
+func TestSnapshotContainersCanceled(t *testing.T) {
+	defer func(concurrency int) { snapshotConcurrency = concurrency }(snapshotConcurrency)
+	snapshotConcurrency = 2
+
+	daemon := &snapshotDaemon{
+		ids:     []string{"a", "b", "c", "d", "e", "f"},
+		blocked: map[string]bool{"a": true, "b": true, "c": true, "d": true, "e": true, "f": true},
+	}
+	cli := newFakeDaemonClient(t, daemon)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := snapshotContainers(ctx, &portainer.DockerSnapshot{}, cli)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the inspections are canceled with the snapshot instead of waiting for their own timeout
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the inspections to be canceled with the snapshot, the snapshot took %s", elapsed)
+	}
+
+	if inspected, _ := daemon.stats(); inspected != 2 {
+		t.Errorf("expected the containers left once the snapshot is canceled not to be inspected, got %d inspections", inspected)
+	}
+}
@@ -0,0 +1,225 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	"github.com/portainer/agent"
+)
+
+const (
+	ComposeProjectLabel = "com.docker.compose.project"
+
+	// maxConfigFileSize is the maximum size of a mounted configuration file whose content is returned.
+	maxConfigFileSize = 64 * 1024
+)
+
+type (
+	// StackConfiguration represents the effective configuration received by the containers and services of a stack
+	StackConfiguration struct {
+		Name       string                   `json:"Name"`
+		Containers []ContainerConfiguration `json:"Containers"`
+		Services   []ServiceConfiguration   `json:"Services"`
+	}
+
+	// ContainerConfiguration represents the effective configuration of a container
+	ContainerConfiguration struct {
+		ID          string       `json:"Id"`
+		Name        string       `json:"Name"`
+		Env         []string     `json:"Env"`
+		ConfigFiles []ConfigFile `json:"ConfigFiles"`
+	}
+
+	// ServiceConfiguration represents the effective configuration of a Swarm service
+	ServiceConfiguration struct {
+		ID      string       `json:"Id"`
+		Name    string       `json:"Name"`
+		Env     []string     `json:"Env"`
+		Configs []ConfigFile `json:"Configs"`
+		Secrets []string     `json:"Secrets"`
+	}
+
+	// ConfigFile represents a configuration file mounted inside a container
+	ConfigFile struct {
+		Source   string `json:"Source"`
+		Target   string `json:"Target"`
+		Content  string `json:"Content,omitempty"`
+		Redacted bool   `json:"Redacted,omitempty"`
+		Error    string `json:"Error,omitempty"`
+	}
+)
+
+// GetStackConfiguration retrieves the environment variables and the mounted configuration files of
+// all the containers (compose) and services (swarm) associated to a stack.
+// Environment variables and the values assigned in configuration files are redacted according to the specified redactor.
+func GetStackConfiguration(ctx context.Context, stackName string, redactor *EnvRedactor) (*StackConfiguration, error) {
+	stackConfig := &StackConfiguration{
+		Name:       stackName,
+		Containers: []ContainerConfiguration{},
+		Services:   []ServiceConfiguration{},
+	}
+
+	err := withCli(func(cli *client.Client) error {
+		containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
+			All:     true,
+			Filters: filters.NewArgs(filters.Arg("label", fmt.Sprintf("%s=%s", ComposeProjectLabel, stackName))),
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, c := range containers {
+			containerConfig, err := inspectContainerConfiguration(ctx, cli, c.ID, redactor)
+			if err != nil {
+				return err
+			}
+
+			stackConfig.Containers = append(stackConfig.Containers, *containerConfig)
+		}
+
+		info, err := cli.Info(ctx)
+		if err != nil {
+			return err
+		}
+
+		if !info.Swarm.ControlAvailable {
+			return nil
+		}
+
+		services, err := cli.ServiceList(ctx, types.ServiceListOptions{
+			Filters: filters.NewArgs(filters.Arg("label", fmt.Sprintf("%s=%s", ServiceNameLabel, stackName))),
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, s := range services {
+			spec := s.Spec.TaskTemplate.ContainerSpec
+			serviceConfig := ServiceConfiguration{
+				ID:      s.ID,
+				Name:    s.Spec.Name,
+				Env:     []string{},
+				Configs: []ConfigFile{},
+				Secrets: []string{},
+			}
+
+			if spec == nil {
+				stackConfig.Services = append(stackConfig.Services, serviceConfig)
+				continue
+			}
+
+			serviceConfig.Env = redactor.Redact(spec.Env)
+
+			for _, cfg := range spec.Configs {
+				configFile := ConfigFile{Source: cfg.ConfigName}
+				if cfg.File != nil {
+					configFile.Target = cfg.File.Name
+				}
+
+				if redactor.Match(filepath.Base(configFile.Target)) {
+					configFile.Redacted = true
+				} else if config, _, err := cli.ConfigInspectWithRaw(ctx, cfg.ConfigID); err != nil {
+					configFile.Error = err.Error()
+				} else {
+					configFile.Content = redactor.RedactContent(string(config.Spec.Data))
+				}
+
+				serviceConfig.Configs = append(serviceConfig.Configs, configFile)
+			}
+
+			// Secret contents are never exposed, only their names
+			for _, secret := range spec.Secrets {
+				serviceConfig.Secrets = append(serviceConfig.Secrets, secret.SecretName)
+			}
+
+			stackConfig.Services = append(stackConfig.Services, serviceConfig)
+		}
+
+		return nil
+	})
+
+	return stackConfig, err
+}
+
+func inspectContainerConfiguration(ctx context.Context, cli *client.Client, containerID string, redactor *EnvRedactor) (*ContainerConfiguration, error) {
+	container, err := cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	containerConfig := &ContainerConfiguration{
+		ID:          container.ID,
+		Name:        container.Name,
+		Env:         []string{},
+		ConfigFiles: []ConfigFile{},
+	}
+
+	if container.Config != nil {
+		containerConfig.Env = redactor.Redact(container.Config.Env)
+	}
+
+	for _, m := range container.Mounts {
+		if m.Type != mount.TypeBind {
+			continue
+		}
+
+		configFile, ok := readBindMountedFile(m.Source, m.Destination, redactor)
+		if ok {
+			containerConfig.ConfigFiles = append(containerConfig.ConfigFiles, configFile)
+		}
+	}
+
+	return containerConfig, nil
+}
+
+// readBindMountedFile reads a bind mounted file through the host filesystem mount point.
+// It returns false when the source is a directory or any other non-regular file (device, FIFO, socket).
+func readBindMountedFile(source, target string, redactor *EnvRedactor) (ConfigFile, bool) {
+	configFile := ConfigFile{Source: source, Target: target}
+
+	hostPath := filepath.Join(agent.HostRoot, source)
+
+	fileInfo, err := os.Stat(hostPath)
+	if err != nil {
+		configFile.Error = err.Error()
+		return configFile, true
+	}
+
+	if !fileInfo.Mode().IsRegular() {
+		return configFile, false
+	}
+
+	if redactor.Match(filepath.Base(target)) {
+		configFile.Redacted = true
+		return configFile, true
+	}
+
+	if fileInfo.Size() > maxConfigFileSize {
+		configFile.Error = fmt.Sprintf("file size exceeds %d bytes", maxConfigFileSize)
+		return configFile, true
+	}
+
+	f, err := os.Open(hostPath)
+	if err != nil {
+		configFile.Error = err.Error()
+		return configFile, true
+	}
+	defer f.Close()
+
+	content, err := io.ReadAll(io.LimitReader(f, maxConfigFileSize))
+	if err != nil {
+		configFile.Error = err.Error()
+		return configFile, true
+	}
+
+	configFile.Content = redactor.RedactContent(string(content))
+
+	return configFile, true
+}
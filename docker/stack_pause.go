@@ -0,0 +1,160 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/client"
+)
+
+// pausedReplicasLabel is the label storing the number of replicas of a Swarm service scaled to zero by PauseStack
+const pausedReplicasLabel = "io.portainer.agent.paused-replicas"
+
+// StackPauseResult represents the outcome of pausing or resuming a container or a service of a stack
+type StackPauseResult struct {
+	Type    string `json:"Type"`
+	ID      string `json:"Id"`
+	Name    string `json:"Name"`
+	Success bool   `json:"Success"`
+	Error   string `json:"Error,omitempty"`
+}
+
+// PauseStack pauses the running containers of a Compose stack and scales the replicated services of a Swarm stack
+// to zero, the number of replicas of each service being kept in a label until the stack is resumed. The state of
+// the paused containers is preserved. Global services cannot be scaled to zero and are reported as failed.
+func PauseStack(ctx context.Context, stackName string) ([]StackPauseResult, error) {
+	return setStackPaused(ctx, stackName, true)
+}
+
+// ResumeStack unpauses the paused containers of a Compose stack and restores the replicas of the services of a
+// Swarm stack paused by PauseStack
+func ResumeStack(ctx context.Context, stackName string) ([]StackPauseResult, error) {
+	return setStackPaused(ctx, stackName, false)
+}
+
+func setStackPaused(ctx context.Context, stackName string, pause bool) ([]StackPauseResult, error) {
+	var results []StackPauseResult
+
+	err := withCli(func(cli *client.Client) error {
+		var err error
+		results, err = setStackResourcesPaused(ctx, cli, stackName, pause)
+
+		return err
+	})
+
+	return results, err
+}
+
+func setStackResourcesPaused(ctx context.Context, cli *client.Client, stackName string, pause bool) ([]StackPauseResult, error) {
+	results := []StackPauseResult{}
+
+	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", fmt.Sprintf("%s=%s", ComposeProjectLabel, stackName))),
+	})
+	if err != nil {
+		return results, err
+	}
+
+	for _, c := range containers {
+		name := c.ID
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+
+		switch {
+		case pause && c.State == "running":
+			err = cli.ContainerPause(ctx, c.ID)
+		case !pause && c.State == "paused":
+			err = cli.ContainerUnpause(ctx, c.ID)
+		default:
+			continue
+		}
+
+		results = append(results, newStackPauseResult(LabeledResourceContainer, c.ID, name, err))
+	}
+
+	info, err := cli.Info(ctx)
+	if err != nil {
+		return results, err
+	}
+
+	if !info.Swarm.ControlAvailable {
+		return results, nil
+	}
+
+	services, err := cli.ServiceList(ctx, types.ServiceListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", fmt.Sprintf("%s=%s", ServiceNameLabel, stackName))),
+	})
+	if err != nil {
+		return results, err
+	}
+
+	for _, s := range services {
+		updated, err := setServicePaused(ctx, cli, s, pause)
+		if !updated && err == nil {
+			continue
+		}
+
+		results = append(results, newStackPauseResult(LabeledResourceService, s.ID, s.Spec.Name, err))
+	}
+
+	return results, nil
+}
+
+// setServicePaused scales the service to zero or restores its replicas, it returns false when the service is
+// already in the expected state
+func setServicePaused(ctx context.Context, cli *client.Client, service swarm.Service, pause bool) (bool, error) {
+	spec := service.Spec
+
+	if spec.Mode.Replicated == nil || spec.Mode.Replicated.Replicas == nil {
+		if pause {
+			return false, errors.New("only the replicated services can be paused")
+		}
+
+		return false, nil
+	}
+
+	pausedReplicas, paused := spec.Labels[pausedReplicasLabel]
+	if paused == pause {
+		return false, nil
+	}
+
+	if pause {
+		if spec.Labels == nil {
+			spec.Labels = map[string]string{}
+		}
+
+		spec.Labels[pausedReplicasLabel] = strconv.FormatUint(*spec.Mode.Replicated.Replicas, 10)
+
+		replicas := uint64(0)
+		spec.Mode.Replicated.Replicas = &replicas
+	} else {
+		replicas, err := strconv.ParseUint(pausedReplicas, 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("invalid number of paused replicas %q", pausedReplicas)
+		}
+
+		delete(spec.Labels, pausedReplicasLabel)
+		spec.Mode.Replicated.Replicas = &replicas
+	}
+
+	_, err := cli.ServiceUpdate(ctx, service.ID, service.Version, spec, types.ServiceUpdateOptions{})
+
+	return true, err
+}
+
+func newStackPauseResult(resourceType, id, name string, err error) StackPauseResult {
+	result := StackPauseResult{Type: resourceType, ID: id, Name: name, Success: err == nil}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	return result
+}
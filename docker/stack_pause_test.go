@@ -0,0 +1,234 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// stackPauseDaemon serves the container and service endpoints of the Docker API used to pause a stack, the
+// updates of the services are applied to their spec
+type stackPauseDaemon struct {
+	containers []types.Container
+	services   []swarm.Service
+	manager    bool
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func (d *stackPauseDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// the version of the API prefixes the path
+	path := r.URL.Path[strings.Index(r.URL.Path[1:], "/")+1:]
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	switch {
+	case path == "/containers/json":
+		json.NewEncoder(w).Encode(d.containers)
+	case path == "/info":
+		json.NewEncoder(w).Encode(types.Info{Swarm: swarm.Info{ControlAvailable: d.manager}})
+	case path == "/services":
+		json.NewEncoder(w).Encode(d.services)
+	case strings.HasSuffix(path, "/update"):
+		id := strings.TrimSuffix(strings.TrimPrefix(path, "/services/"), "/update")
+		d.calls = append(d.calls, "update "+id)
+
+		for i := range d.services {
+			if d.services[i].ID != id {
+				continue
+			}
+
+			spec := swarm.ServiceSpec{}
+			json.NewDecoder(r.Body).Decode(&spec)
+			d.services[i].Spec = spec
+		}
+
+		json.NewEncoder(w).Encode(types.ServiceUpdateResponse{})
+	default:
+		// pause and unpause of the containers
+		d.calls = append(d.calls, strings.TrimPrefix(path, "/containers/"))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (d *stackPauseDaemon) service(id string) swarm.ServiceSpec {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, s := range d.services {
+		if s.ID == id {
+			return s.Spec
+		}
+	}
+
+	return swarm.ServiceSpec{}
+}
+
+func replicatedService(id string, replicas uint64, labels map[string]string) swarm.Service {
+	return swarm.Service{
+		ID: id,
+		Spec: swarm.ServiceSpec{
+			Annotations: swarm.Annotations{Name: id, Labels: labels},
+			Mode:        swarm.ServiceMode{Replicated: &swarm.ReplicatedService{Replicas: &replicas}},
+		},
+	}
+}
+
+func TestSetStackResourcesPaused(t *testing.T) {
+	daemon := &stackPauseDaemon{
+		containers: []types.Container{
+			{ID: "web", Names: []string{"/stack-web-1"}, State: "running"},
+			{ID: "worker", State: "exited"},
+		},
+		services: []swarm.Service{
+			replicatedService("api", 3, map[string]string{ServiceNameLabel: "stack"}),
+			replicatedService("idle", 0, nil),
+			{
+				ID: "monitor",
+				Spec: swarm.ServiceSpec{
+					Annotations: swarm.Annotations{Name: "monitor"},
+					Mode:        swarm.ServiceMode{Global: &swarm.GlobalService{}},
+				},
+			},
+		},
+		manager: true,
+	}
+	cli := newFakeDaemonClient(t, daemon)
+
+	results, err := setStackResourcesPaused(context.Background(), cli, "stack", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []StackPauseResult{
+		{Type: LabeledResourceContainer, ID: "web", Name: "stack-web-1", Success: true},
+		{Type: LabeledResourceService, ID: "api", Name: "api", Success: true},
+		{Type: LabeledResourceService, ID: "idle", Name: "idle", Success: true},
+		{Type: LabeledResourceService, ID: "monitor", Name: "monitor", Error: "only the replicated services can be paused"},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected the results %+v, got %+v", expected, results)
+	}
+
+	for id, replicas := range map[string]string{"api": "3", "idle": "0"} {
+		spec := daemon.service(id)
+		if *spec.Mode.Replicated.Replicas != 0 || spec.Labels[pausedReplicasLabel] != replicas {
+			t.Errorf("expected %s to be scaled to zero with %s replicas stored, got %d replicas and the labels %v", id, replicas, *spec.Mode.Replicated.Replicas, spec.Labels)
+		}
+	}
+
+	if spec := daemon.service("api"); spec.Labels[ServiceNameLabel] != "stack" {
+		t.Errorf("expected the labels of the service to be kept, got %v", spec.Labels)
+	}
+
+	// the containers are paused again once resumed, the services are left as they are
+	daemon.containers[0].State = "paused"
+
+	results, err = setStackResourcesPaused(context.Background(), cli, "stack", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = []StackPauseResult{
+		{Type: LabeledResourceService, ID: "monitor", Name: "monitor", Error: "only the replicated services can be paused"},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected the paused stack to be left as it is, got %+v", results)
+	}
+
+	results, err = setStackResourcesPaused(context.Background(), cli, "stack", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = []StackPauseResult{
+		{Type: LabeledResourceContainer, ID: "web", Name: "stack-web-1", Success: true},
+		{Type: LabeledResourceService, ID: "api", Name: "api", Success: true},
+		{Type: LabeledResourceService, ID: "idle", Name: "idle", Success: true},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected the results %+v, got %+v", expected, results)
+	}
+
+	for id, replicas := range map[string]uint64{"api": 3, "idle": 0} {
+		spec := daemon.service(id)
+		if _, ok := spec.Labels[pausedReplicasLabel]; ok || *spec.Mode.Replicated.Replicas != replicas {
+			t.Errorf("expected the %d replicas of %s to be restored, got %d replicas and the labels %v", replicas, id, *spec.Mode.Replicated.Replicas, spec.Labels)
+		}
+	}
+
+	expectedCalls := []string{"web/pause", "update api", "update idle", "web/unpause", "update api", "update idle"}
+	if !reflect.DeepEqual(daemon.calls, expectedCalls) {
+		t.Errorf("expected the calls %v, got %v", expectedCalls, daemon.calls)
+	}
+}
+
+func TestSetStackResourcesPaused_NotPaused(t *testing.T) {
+	daemon := &stackPauseDaemon{
+		containers: []types.Container{{ID: "web", State: "running"}},
+		services: []swarm.Service{
+			replicatedService("api", 3, nil),
+			replicatedService("broken", 0, map[string]string{pausedReplicasLabel: "three"}),
+			{
+				ID: "monitor",
+				Spec: swarm.ServiceSpec{
+					Annotations: swarm.Annotations{Name: "monitor"},
+					Mode:        swarm.ServiceMode{Global: &swarm.GlobalService{}},
+				},
+			},
+		},
+		manager: true,
+	}
+	cli := newFakeDaemonClient(t, daemon)
+
+	results, err := setStackResourcesPaused(context.Background(), cli, "stack", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the service with an invalid number of paused replicas is reported, it is not updated
+	expected := []StackPauseResult{
+		{Type: LabeledResourceService, ID: "broken", Name: "broken", Error: `invalid number of paused replicas "three"`},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected the results %+v, got %+v", expected, results)
+	}
+
+	if len(daemon.calls) > 0 {
+		t.Errorf("expected a stack that is not paused to be left as it is, got the calls %v", daemon.calls)
+	}
+
+	if spec := daemon.service("api"); *spec.Mode.Replicated.Replicas != 3 {
+		t.Errorf("expected the replicas of a service without the label to be kept, got %d", *spec.Mode.Replicated.Replicas)
+	}
+}
+
+func TestSetStackResourcesPaused_Standalone(t *testing.T) {
+	daemon := &stackPauseDaemon{
+		containers: []types.Container{{ID: "web", State: "running"}},
+		services:   []swarm.Service{replicatedService("api", 3, nil)},
+	}
+	cli := newFakeDaemonClient(t, daemon)
+
+	results, err := setStackResourcesPaused(context.Background(), cli, "stack", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the services are only listed on a Swarm manager
+	expected := []StackPauseResult{{Type: LabeledResourceContainer, ID: "web", Name: "web", Success: true}}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected the results %+v, got %+v", expected, results)
+	}
+}
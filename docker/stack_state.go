@@ -0,0 +1,112 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// StackServiceState represents the containers, or the Swarm service, currently running a service of a stack
+type StackServiceState struct {
+	Name string
+	// Instances are the configurations of the containers of the service, the one of its specification for a Swarm
+	// service
+	Instances []StackServiceInstance
+	// Running is the number of running containers or tasks
+	Running int
+	// Global is true for a global Swarm service
+	Global bool
+}
+
+// StackServiceInstance is the image and the environment a container of a service was created with
+type StackServiceInstance struct {
+	Container string
+	Image     string
+	Env       []string
+}
+
+// GetComposeStackStates returns the state of the services of the Compose project, from the containers labeled
+// with the project name
+func GetComposeStackStates(ctx context.Context, projectName string) ([]StackServiceState, error) {
+	states := map[string]*StackServiceState{}
+
+	err := withCli(func(cli *client.Client) error {
+		// Compose normalizes the project names to lowercase
+		containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
+			All:     true,
+			Filters: filters.NewArgs(filters.Arg("label", fmt.Sprintf("%s=%s", ComposeProjectLabel, strings.ToLower(projectName)))),
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, c := range containers {
+			name := c.Labels[composeServiceLabel]
+
+			state, ok := states[name]
+			if !ok {
+				state = &StackServiceState{Name: name}
+				states[name] = state
+			}
+
+			if c.State == "running" {
+				state.Running++
+			}
+
+			container, err := cli.ContainerInspect(ctx, c.ID)
+			if err != nil {
+				return err
+			}
+
+			instance := StackServiceInstance{Container: strings.TrimPrefix(container.Name, "/")}
+			if container.Config != nil {
+				instance.Image = container.Config.Image
+				instance.Env = container.Config.Env
+			}
+
+			state.Instances = append(state.Instances, instance)
+		}
+
+		return nil
+	})
+
+	result := make([]StackServiceState, 0, len(states))
+	for _, state := range states {
+		result = append(result, *state)
+	}
+
+	return result, err
+}
+
+// GetSwarmStackStates returns the state of the services of the Swarm stack deployed in namespace, from the
+// specification of the services and their running tasks
+func GetSwarmStackStates(ctx context.Context, namespace string) ([]StackServiceState, error) {
+	services, err := GetStackServices(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]StackServiceState, 0, len(services))
+	for _, s := range services {
+		state := StackServiceState{
+			Name:   strings.TrimPrefix(s.Spec.Name, namespace+"_"),
+			Global: s.Spec.Mode.Global != nil,
+		}
+
+		if s.ServiceStatus != nil {
+			state.Running = int(s.ServiceStatus.RunningTasks)
+		}
+
+		if spec := s.Spec.TaskTemplate.ContainerSpec; spec != nil {
+			state.Instances = []StackServiceInstance{{Container: s.Spec.Name, Image: spec.Image, Env: spec.Env}}
+		}
+
+		states = append(states, state)
+	}
+
+	return states, nil
+}
@@ -0,0 +1,67 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+)
+
+// ErrBindMountNotFound is returned when no container of a stack bind mounts a directory on the target path
+var ErrBindMountNotFound = errors.New("no container of the stack has a bind mount on the target path")
+
+// StackBindMount represents a host directory bind mounted by containers of a Compose stack
+type StackBindMount struct {
+	Source     string
+	Containers []string
+}
+
+// GetStackBindMount returns the host directory bind mounted on the target path by the containers of a Compose stack
+// and the containers mounting it
+func GetStackBindMount(ctx context.Context, projectName, target string) (*StackBindMount, error) {
+	var bindMount *StackBindMount
+
+	err := withCli(func(cli *client.Client) error {
+		containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
+			All:     true,
+			Filters: filters.NewArgs(filters.Arg("label", fmt.Sprintf("%s=%s", ComposeProjectLabel, projectName))),
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, c := range containers {
+			for _, m := range c.Mounts {
+				if m.Type != mount.TypeBind || path.Clean(m.Destination) != path.Clean(target) {
+					continue
+				}
+
+				if bindMount == nil {
+					bindMount = &StackBindMount{Source: m.Source}
+				}
+
+				if m.Source != bindMount.Source {
+					return fmt.Errorf("the containers of the stack bind mount different directories on %s", target)
+				}
+
+				bindMount.Containers = append(bindMount.Containers, c.ID)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if bindMount == nil {
+		return nil, ErrBindMountNotFound
+	}
+
+	return bindMount, nil
+}
@@ -0,0 +1,208 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// Causes of the start failures of the containers
+const (
+	StartFailurePortConflict  = "port_conflict"
+	StartFailureMissingMount  = "missing_mount"
+	StartFailureBadEntrypoint = "bad_entrypoint"
+	StartFailurePullError     = "pull_error"
+	StartFailureOOM           = "oom"
+	StartFailureUnknown       = "unknown"
+)
+
+// startFailurePatterns match the daemon and runtime errors of each cause, the first matching cause is reported
+var startFailurePatterns = []struct {
+	cause   string
+	pattern *regexp.Regexp
+}{
+	{StartFailurePortConflict, regexp.MustCompile(`(?i)port is already allocated|address already in use|bind for .* failed`)},
+	{StartFailureMissingMount, regexp.MustCompile(`(?i)bind source path does not exist|invalid mount config|error while mounting volume|mounting .* to rootfs|no such device`)},
+	{StartFailurePullError, regexp.MustCompile(`(?i)pull access denied|manifest unknown|manifest for .* not found|repository does not exist|no matching manifest|toomanyrequests|unauthorized: |error pulling image|no such image`)},
+	{StartFailureOOM, regexp.MustCompile(`(?i)oomkilled|out of memory|cannot allocate memory|memory limit`)},
+	{StartFailureBadEntrypoint, regexp.MustCompile(`(?i)executable file not found|exec format error|no such file or directory|permission denied|starting container process caused|exec: `)},
+}
+
+// StartFailure is the diagnosis of a container of a stack that failed to start
+type StartFailure struct {
+	Cause string `json:"Cause"`
+	// Service is the name of the Compose service of the container
+	Service   string `json:"Service,omitempty"`
+	Container string `json:"Container,omitempty"`
+	ExitCode  int    `json:"ExitCode,omitempty"`
+	// Message is the error of the daemon or the runtime the cause was identified from
+	Message string `json:"Message"`
+}
+
+// StackStartFailure is the diagnosis of the last failed deployment of a stack
+type StackStartFailure struct {
+	StackID  int            `json:"StackID"`
+	Name     string         `json:"Name"`
+	Failures []StartFailure `json:"Failures"`
+	FailedAt time.Time      `json:"FailedAt"`
+}
+
+var (
+	startFailures   = map[int]StackStartFailure{}
+	startFailuresMu sync.Mutex
+)
+
+// ClassifyStartError returns the cause of a start failure from the error returned by the daemon or the runtime
+func ClassifyStartError(message string) string {
+	for _, p := range startFailurePatterns {
+		if p.pattern.MatchString(message) {
+			return p.cause
+		}
+	}
+
+	return StartFailureUnknown
+}
+
+// DiagnoseStartFailures returns the diagnosis of the containers of the Compose project that failed to start. The
+// deployment error is classified when no container could be blamed, the images that cannot be pulled prevent the
+// containers from being created.
+func DiagnoseStartFailures(ctx context.Context, projectName string, deployErr string) []StartFailure {
+	failures := []StartFailure{}
+
+	_ = withCli(func(cli *client.Client) error {
+		// Compose normalizes the project names to lowercase
+		containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
+			All:     true,
+			Filters: filters.NewArgs(filters.Arg("label", fmt.Sprintf("%s=%s", ComposeProjectLabel, strings.ToLower(projectName)))),
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, c := range containers {
+			if c.State == "running" {
+				continue
+			}
+
+			inspect, err := cli.ContainerInspect(ctx, c.ID)
+			if err != nil || inspect.ContainerJSONBase == nil || inspect.State == nil {
+				continue
+			}
+
+			failure, ok := diagnoseContainerState(inspect.State)
+			if !ok {
+				continue
+			}
+
+			failure.Service = c.Labels[composeServiceLabel]
+			failure.Container = strings.TrimPrefix(inspect.Name, "/")
+
+			failures = append(failures, failure)
+		}
+
+		return nil
+	})
+
+	if len(failures) == 0 && deployErr != "" {
+		failures = append(failures, StartFailure{Cause: ClassifyStartError(deployErr), Message: deployErr})
+	}
+
+	return failures
+}
+
+// diagnoseContainerState returns the diagnosis of a container that is not running, false when the container
+// exited successfully or was never started
+func diagnoseContainerState(state *types.ContainerState) (StartFailure, bool) {
+	switch {
+	case state.OOMKilled:
+		return StartFailure{Cause: StartFailureOOM, ExitCode: state.ExitCode, Message: "the container was killed when it ran out of memory"}, true
+	case state.Error != "":
+		return StartFailure{Cause: ClassifyStartError(state.Error), ExitCode: state.ExitCode, Message: state.Error}, true
+	// the shells exit with 126 when the command cannot be executed and 127 when it is not found
+	case state.ExitCode == 126 || state.ExitCode == 127:
+		return StartFailure{Cause: StartFailureBadEntrypoint, ExitCode: state.ExitCode, Message: fmt.Sprintf("the entrypoint exited with code %d", state.ExitCode)}, true
+	case state.ExitCode != 0 && state.Restarting:
+		return StartFailure{Cause: StartFailureUnknown, ExitCode: state.ExitCode, Message: fmt.Sprintf("the container is restarting after exiting with code %d", state.ExitCode)}, true
+	case state.ExitCode != 0:
+		return StartFailure{Cause: StartFailureUnknown, ExitCode: state.ExitCode, Message: fmt.Sprintf("the container exited with code %d", state.ExitCode)}, true
+	}
+
+	return StartFailure{}, false
+}
+
+// StartFailuresMessage summarizes the diagnosis in the status message of a stack
+func StartFailuresMessage(failures []StartFailure) string {
+	parts := make([]string, 0, len(failures))
+	for _, failure := range failures {
+		if failure.Container == "" {
+			parts = append(parts, fmt.Sprintf("%s: %s", failure.Cause, failure.Message))
+
+			continue
+		}
+
+		parts = append(parts, fmt.Sprintf("%s: %s: %s", failure.Container, failure.Cause, failure.Message))
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// SetStartFailures records the diagnosis of the last failed deployment of a stack, reported in the snapshots
+func SetStartFailures(report StackStartFailure) {
+	startFailuresMu.Lock()
+	defer startFailuresMu.Unlock()
+
+	startFailures[report.StackID] = report
+}
+
+// RemoveStartFailures removes the diagnosis of a stack that was deployed or removed
+func RemoveStartFailures(stackID int) {
+	startFailuresMu.Lock()
+	defer startFailuresMu.Unlock()
+
+	delete(startFailures, stackID)
+}
+
+// StartFailures returns the diagnosis of the stacks whose last deployment failed, sorted by stack identifier
+func StartFailures() []StackStartFailure {
+	startFailuresMu.Lock()
+	defer startFailuresMu.Unlock()
+
+	if len(startFailures) == 0 {
+		return nil
+	}
+
+	result := make([]StackStartFailure, 0, len(startFailures))
+	for _, report := range startFailures {
+		result = append(result, report)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].StackID < result[j].StackID })
+
+	return result
+}
+
+// StartFailureDiagnostics returns a diagnostic message for each container that failed to start
+func StartFailureDiagnostics() []string {
+	diagnostics := []string{}
+	for _, report := range StartFailures() {
+		for _, failure := range report.Failures {
+			if failure.Container == "" {
+				diagnostics = append(diagnostics, fmt.Sprintf("stack %s failed to deploy: %s", report.Name, failure.Cause))
+
+				continue
+			}
+
+			diagnostics = append(diagnostics, fmt.Sprintf("container %s of stack %s failed to start: %s", failure.Container, report.Name, failure.Cause))
+		}
+	}
+
+	return diagnostics
+}
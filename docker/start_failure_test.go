@@ -0,0 +1,50 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestClassifyStartError(t *testing.T) {
+	tests := []struct {
+		message string
+		cause   string
+	}{
+		{"driver failed programming external connectivity on endpoint web: Bind for 0.0.0.0:80 failed: port is already allocated", StartFailurePortConflict},
+		{"Error response from daemon: invalid mount config for type \"bind\": bind source path does not exist: /data", StartFailureMissingMount},
+		{"pull access denied for private/app, repository does not exist or may require 'docker login'", StartFailurePullError},
+		{"no matching manifest for linux/arm64/v8 in the manifest list entries", StartFailurePullError},
+		{"OCI runtime create failed: runc create failed: unable to start container process: exec: \"/app\": stat /app: no such file or directory: unknown", StartFailureBadEntrypoint},
+		{"exec /entrypoint.sh: exec format error", StartFailureBadEntrypoint},
+		{"container init was OOM-killed (memory limit too low?)", StartFailureOOM},
+		{"something unexpected happened", StartFailureUnknown},
+	}
+
+	for _, test := range tests {
+		if cause := ClassifyStartError(test.message); cause != test.cause {
+			t.Errorf("expected %q to be classified as %s, got %s", test.message, test.cause, cause)
+		}
+	}
+}
+
+func TestDiagnoseContainerState(t *testing.T) {
+	tests := []struct {
+		state  types.ContainerState
+		cause  string
+		failed bool
+	}{
+		{types.ContainerState{OOMKilled: true, ExitCode: 137}, StartFailureOOM, true},
+		{types.ContainerState{Error: "Bind for 0.0.0.0:8080 failed: port is already allocated", ExitCode: 128}, StartFailurePortConflict, true},
+		{types.ContainerState{ExitCode: 127}, StartFailureBadEntrypoint, true},
+		{types.ContainerState{ExitCode: 1}, StartFailureUnknown, true},
+		{types.ContainerState{ExitCode: 0}, "", false},
+	}
+
+	for _, test := range tests {
+		failure, failed := diagnoseContainerState(&test.state)
+		if failed != test.failed || failure.Cause != test.cause {
+			t.Errorf("expected %+v to be diagnosed as %s (%t), got %s (%t)", test.state, test.cause, test.failed, failure.Cause, failed)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package docker
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// StopOrder returns the containers of the graph selected by keep, grouped in the waves in which they must be
+// stopped: the containers of a wave are only depended on by the containers of the previous waves, so that each
+// container is stopped before the containers it depends on. The containers of a dependency cycle are stopped in the
+// same wave.
+func (graph *DependencyGraph) StopOrder(keep func(node DependencyNode) bool) [][]DependencyNode {
+	remaining := map[string]DependencyNode{}
+	for _, node := range graph.Nodes {
+		if keep(node) {
+			remaining[node.ID] = node
+		}
+	}
+
+	waves := [][]DependencyNode{}
+
+	for len(remaining) > 0 {
+		dependedOn := map[string]bool{}
+		for _, edge := range graph.Edges {
+			if _, ok := remaining[edge.From]; ok && isDirectedDependency(edge.Kind) {
+				dependedOn[edge.To] = true
+			}
+		}
+
+		wave := []DependencyNode{}
+		for id, node := range remaining {
+			if !dependedOn[id] {
+				wave = append(wave, node)
+			}
+		}
+
+		// every remaining container is part of or depends on a cycle
+		if len(wave) == 0 {
+			for _, node := range remaining {
+				wave = append(wave, node)
+			}
+		}
+
+		sort.Slice(wave, func(i, j int) bool {
+			return wave[i].Name < wave[j].Name
+		})
+
+		for _, node := range wave {
+			delete(remaining, node.ID)
+		}
+
+		waves = append(waves, wave)
+	}
+
+	return waves
+}
+
+// ContainerStopWithTimeout stops the container, which is killed when it is still running after timeout
+func ContainerStopWithTimeout(ctx context.Context, id string, timeout time.Duration) error {
+	seconds := int(timeout.Seconds())
+
+	return withCli(func(cli *client.Client) error {
+		return cli.ContainerStop(ctx, id, container.StopOptions{Timeout: &seconds})
+	})
+}
+
+// LabeledStacksStopOrder returns the running containers of the Compose stacks having at least one running container
+// labeled with label=value, in the order they must be stopped, and the names of these stacks
+func LabeledStacksStopOrder(ctx context.Context, label, value string) ([]DependencyNode, []string, error) {
+	running := map[string]bool{}
+	stacks := map[string]bool{}
+
+	err := withCli(func(cli *client.Client) error {
+		containers, err := cli.ContainerList(ctx, types.ContainerListOptions{})
+		if err != nil {
+			return err
+		}
+
+		for _, c := range containers {
+			running[c.ID] = true
+
+			if project := c.Labels[ComposeProjectLabel]; project != "" && c.Labels[label] == value {
+				stacks[project] = true
+			}
+		}
+
+		return nil
+	})
+	if err != nil || len(stacks) == 0 {
+		return nil, nil, err
+	}
+
+	graph, err := GetDependencyGraph(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var nodes []DependencyNode
+	for _, wave := range graph.StopOrder(func(node DependencyNode) bool {
+		return running[node.ID] && stacks[node.Stack]
+	}) {
+		nodes = append(nodes, wave...)
+	}
+
+	names := make([]string, 0, len(stacks))
+	for name := range stacks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return nodes, names, nil
+}
@@ -0,0 +1,54 @@
+package docker
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDependencyGraph_StopOrder(t *testing.T) {
+	graph := &DependencyGraph{
+		Nodes: []DependencyNode{
+			{ID: "web", Name: "shop-web-1", Stack: "edge_shop"},
+			{ID: "db", Name: "shop-db-1", Stack: "edge_shop"},
+			{ID: "cache", Name: "shop-cache-1", Stack: "edge_shop"},
+			{ID: "proxy", Name: "proxy", Stack: "edge_proxy"},
+			{ID: "a", Name: "loop-a", Stack: "edge_loop"},
+			{ID: "b", Name: "loop-b", Stack: "edge_loop"},
+			{ID: "portainer", Name: "portainer_agent"},
+		},
+		Edges: []DependencyEdge{
+			{From: "web", To: "db", Kind: DependencyDependsOn},
+			{From: "web", To: "cache", Kind: DependencyLink},
+			{From: "proxy", To: "web", Kind: DependencyNetworkMode},
+			{From: "db", To: "cache", Kind: DependencyNetwork},
+			{From: "a", To: "b", Kind: DependencyVolumesFrom},
+			{From: "b", To: "a", Kind: DependencyVolumesFrom},
+			{From: "portainer", To: "db", Kind: DependencyLink},
+		},
+	}
+
+	waves := graph.StopOrder(func(node DependencyNode) bool {
+		return strings.HasPrefix(node.Stack, "edge_")
+	})
+
+	var names [][]string
+	for _, wave := range waves {
+		var wn []string
+		for _, node := range wave {
+			wn = append(wn, node.Name)
+		}
+		names = append(names, wn)
+	}
+
+	expected := [][]string{
+		{"proxy"},
+		{"shop-web-1"},
+		{"shop-cache-1", "shop-db-1"},
+		{"loop-a", "loop-b"},
+	}
+
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected %v, got %v", expected, names)
+	}
+}
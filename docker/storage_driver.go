@@ -0,0 +1,39 @@
+package docker
+
+import (
+	"context"
+
+	"github.com/docker/docker/client"
+)
+
+// StorageDriver is the storage driver of the Docker daemon
+type StorageDriver struct {
+	Name string
+	// RootDir is the root folder of the Docker daemon, where the layers of the images and containers are stored
+	RootDir string
+	// Status is the driver status reported by the Docker info, by key
+	Status map[string]string
+}
+
+// GetStorageDriver returns the storage driver of the Docker daemon and its status
+func GetStorageDriver(ctx context.Context) (StorageDriver, error) {
+	driver := StorageDriver{Status: map[string]string{}}
+
+	err := withCli(func(cli *client.Client) error {
+		info, err := cli.Info(ctx)
+		if err != nil {
+			return err
+		}
+
+		driver.Name = info.Driver
+		driver.RootDir = info.DockerRootDir
+
+		for _, status := range info.DriverStatus {
+			driver.Status[status[0]] = status[1]
+		}
+
+		return nil
+	})
+
+	return driver, err
+}
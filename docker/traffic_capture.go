@@ -0,0 +1,129 @@
+package docker
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/strslice"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// CaptureOptions represents the limits of a network traffic capture
+type CaptureOptions struct {
+	// Image is the image providing tcpdump
+	Image string
+	// Duration is the maximum duration of the capture
+	Duration time.Duration
+	// MaxPackets is the maximum number of captured packets
+	MaxPackets int
+	// Filter is an optional pcap filter expression, split in words
+	Filter []string
+}
+
+// CaptureTraffic runs tcpdump inside the network namespace of a container and writes the captured packets
+// in the pcap format to w. The capture stops when the duration or the packet limit is reached, or when ctx is cancelled.
+func CaptureTraffic(ctx context.Context, containerID string, options CaptureOptions, w io.Writer) error {
+	return withCli(func(cli *client.Client) error {
+		cli.HTTPClient().Timeout = largeClientTimeout
+
+		target, err := cli.ContainerInspect(ctx, containerID)
+		if err != nil {
+			return errors.WithMessage(err, "unable to inspect container")
+		}
+
+		if target.State == nil || !target.State.Running {
+			return errors.New("the container must be running to capture its traffic")
+		}
+
+		if _, _, err := cli.ImageInspectWithRaw(ctx, options.Image); client.IsErrNotFound(err) {
+			if err := pullImage(ctx, cli, options.Image); err != nil {
+				return errors.WithMessage(err, "unable to pull the capture image")
+			}
+		}
+
+		cmd := []string{
+			strconv.Itoa(int(options.Duration.Seconds())),
+			"tcpdump", "-i", "any", "-U", "-w", "-", "-c", strconv.Itoa(options.MaxPackets),
+		}
+		if len(options.Filter) > 0 {
+			// The filter expression must never be parsed as tcpdump options
+			cmd = append(append(cmd, "--"), options.Filter...)
+		}
+
+		created, err := cli.ContainerCreate(ctx,
+			&container.Config{
+				Image:        options.Image,
+				Entrypoint:   strslice.StrSlice{"timeout"},
+				Cmd:          cmd,
+				AttachStdout: true,
+				AttachStderr: true,
+				Labels:       map[string]string{"io.portainer.agent.capture": target.ID},
+			},
+			&container.HostConfig{
+				NetworkMode: container.NetworkMode("container:" + target.ID),
+				CapAdd:      strslice.StrSlice{"NET_ADMIN", "NET_RAW"},
+			},
+			nil, nil, "")
+		if err != nil {
+			return errors.WithMessage(err, "unable to create the capture container")
+		}
+		defer func() {
+			err := cli.ContainerRemove(context.Background(), created.ID, types.ContainerRemoveOptions{Force: true})
+			if err != nil {
+				log.Warn().Str("container_id", created.ID).Err(err).Msg("unable to remove the capture container")
+			}
+		}()
+
+		attached, err := cli.ContainerAttach(ctx, created.ID, types.ContainerAttachOptions{
+			Stream: true,
+			Stdout: true,
+			Stderr: true,
+		})
+		if err != nil {
+			return errors.WithMessage(err, "unable to attach to the capture container")
+		}
+		defer attached.Close()
+
+		if err := cli.ContainerStart(ctx, created.ID, types.ContainerStartOptions{}); err != nil {
+			return errors.WithMessage(err, "unable to start the capture container")
+		}
+
+		stderr := &limitedBuffer{limit: 4096}
+		if _, err := stdcopy.StdCopy(w, stderr, attached.Reader); err != nil && ctx.Err() == nil {
+			return errors.WithMessage(err, "unable to stream the capture")
+		}
+
+		log.Debug().Str("container_id", target.ID).Str("output", stderr.String()).Msg("traffic capture finished")
+
+		return nil
+	})
+}
+
+// limitedBuffer keeps the first bytes written to it, up to its limit
+type limitedBuffer struct {
+	limit int
+	data  []byte
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if remaining := b.limit - len(b.data); remaining > 0 {
+		if len(p) > remaining {
+			b.data = append(b.data, p[:remaining]...)
+		} else {
+			b.data = append(b.data, p...)
+		}
+	}
+
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	return string(b.data)
+}
@@ -0,0 +1,303 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/pkg/errors"
+	"github.com/portainer/agent/filesystem"
+	"github.com/portainer/agent/journal"
+
+	"github.com/rs/zerolog/log"
+)
+
+// volumeBackupStepPausing is recorded in the operation journal before the containers mounting the volume are paused
+const volumeBackupStepPausing = "pausing"
+
+// volumeBackupJournalState is the state of a volume backup recorded in the operation journal
+type volumeBackupJournalState struct {
+	// Path is the archive written by the backup, empty when the archive is streamed
+	Path   string   `json:",omitempty"`
+	Paused []string `json:",omitempty"`
+}
+
+// VolumeBackup represents a volume archive created by BackupVolume
+type VolumeBackup struct {
+	Volume string `json:"Volume"`
+	Path   string `json:"Path"`
+	Size   int64  `json:"Size"`
+	// Paused are the containers paused during the backup
+	Paused []string `json:"Paused,omitempty"`
+}
+
+// VolumeRestore represents the outcome of RestoreVolume
+type VolumeRestore struct {
+	Volume string `json:"Volume"`
+	// Created is true when the volume did not exist and was created by the restore
+	Created bool `json:"Created"`
+	Files   int  `json:"Files"`
+}
+
+// BackupVolume writes a gzip compressed tar archive of the content of a local volume inside backupDir and
+// reports the progress of the archive. The volume content is read through the volume folder mounted inside the agent.
+// When pause is true, the running containers mounting the volume are paused during the archive so that the backup is
+// consistent.
+func BackupVolume(ctx context.Context, volumeName, backupDir string, pause bool, onProgress func(percent int, message string)) (*VolumeBackup, error) {
+	err := os.MkdirAll(backupDir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	backup := &VolumeBackup{
+		Volume: volumeName,
+		Path:   filepath.Join(backupDir, fmt.Sprintf("%s-%s.tar.gz", volumeName, time.Now().UTC().Format("20060102T150405Z"))),
+	}
+
+	state := &volumeBackupJournalState{Path: backup.Path}
+
+	entry, err := journal.Begin(journal.TypeVolumeBackup, volumeName, state)
+	if err != nil {
+		return nil, errors.WithMessage(err, "unable to record the backup in the operation journal")
+	}
+	defer entry.Complete()
+
+	f, err := os.OpenFile(backup.Path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	backup.Paused, err = archiveVolume(ctx, volumeName, pause, f, onProgress, entry, state)
+	if err != nil {
+		f.Close()
+		os.Remove(backup.Path)
+
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	backup.Size = info.Size()
+
+	return backup, nil
+}
+
+// ArchiveVolume writes a gzip compressed tar archive of the content of a local volume to w and returns the names of
+// the containers paused during the archive. When pause is true, the running containers mounting the volume are
+// paused until the archive is written, they are unpaused even when the archive fails.
+func ArchiveVolume(ctx context.Context, volumeName string, pause bool, w io.Writer, onProgress func(percent int, message string)) ([]string, error) {
+	state := &volumeBackupJournalState{}
+
+	entry, err := journal.Begin(journal.TypeVolumeBackup, volumeName, state)
+	if err != nil {
+		return nil, errors.WithMessage(err, "unable to record the backup in the operation journal")
+	}
+	defer entry.Complete()
+
+	return archiveVolume(ctx, volumeName, pause, w, onProgress, entry, state)
+}
+
+// archiveVolume archives the volume, the containers are recorded in the journal entry of the backup before they
+// are paused so that they can be unpaused when the agent is stopped during the archive
+func archiveVolume(ctx context.Context, volumeName string, pause bool, w io.Writer, onProgress func(percent int, message string), entry *journal.Entry, state *volumeBackupJournalState) ([]string, error) {
+	paused := []string{}
+
+	err := withCli(func(cli *client.Client) error {
+		volumePath, err := localVolumePath(ctx, cli, volumeName)
+		if err != nil {
+			return err
+		}
+
+		if pause {
+			containers, err := volumeContainers(ctx, cli, volumeName, "running")
+			if err != nil {
+				return err
+			}
+
+			var pausedContainers []types.Container
+			defer func() {
+				unpauseContainers(cli, pausedContainers)
+			}()
+
+			for _, c := range containers {
+				state.Paused = append(state.Paused, c.ID)
+			}
+
+			if err := entry.Advance(volumeBackupStepPausing, state); err != nil {
+				return errors.WithMessage(err, "unable to record the backup in the operation journal")
+			}
+
+			for _, c := range containers {
+				err := cli.ContainerPause(ctx, c.ID)
+				if err != nil {
+					return errors.WithMessagef(err, "unable to pause container %s", containerName(c))
+				}
+
+				pausedContainers = append(pausedContainers, c)
+				paused = append(paused, containerName(c))
+			}
+		}
+
+		err = filesystem.ArchiveDirectory(ctx, volumePath, w, func(archived, total int64) {
+			if total > 0 && onProgress != nil {
+				onProgress(int(archived*100/total), fmt.Sprintf("%d/%d bytes archived", archived, total))
+			}
+		})
+
+		return errors.WithMessage(err, "unable to archive volume")
+	})
+
+	return paused, err
+}
+
+// RestoreVolume extracts a gzip compressed tar archive, as written by ArchiveVolume, inside a local volume. The volume
+// is created when it does not exist, its content is removed first when clearVolume is true. The volume must not be
+// mounted by a running container. size is the size of the archive used to report the progress, it is not reported
+// when 0.
+func RestoreVolume(ctx context.Context, volumeName string, r io.Reader, size int64, clearVolume bool, onProgress func(percent int, message string)) (*VolumeRestore, error) {
+	restore := &VolumeRestore{Volume: volumeName}
+
+	err := withCli(func(cli *client.Client) error {
+		_, err := cli.VolumeInspect(ctx, volumeName)
+		if client.IsErrNotFound(err) {
+			_, err = cli.VolumeCreate(ctx, volume.CreateOptions{Name: volumeName, Driver: "local"})
+			restore.Created = err == nil
+		}
+		if err != nil {
+			return errors.WithMessage(err, "unable to retrieve volume")
+		}
+
+		volumePath, err := localVolumePath(ctx, cli, volumeName)
+		if err != nil {
+			return err
+		}
+
+		containers, err := volumeContainers(ctx, cli, volumeName, "running", "paused", "restarting")
+		if err != nil {
+			return err
+		}
+
+		if len(containers) > 0 {
+			names := make([]string, 0, len(containers))
+			for _, c := range containers {
+				names = append(names, containerName(c))
+			}
+
+			return fmt.Errorf("the volume is used by the running containers %s", strings.Join(names, ", "))
+		}
+
+		if clearVolume {
+			err = clearDirectory(volumePath)
+			if err != nil {
+				return errors.WithMessage(err, "unable to clear volume")
+			}
+		}
+
+		reader := r
+		if size > 0 && onProgress != nil {
+			reader = &progressReader{reader: r, total: size, onProgress: onProgress}
+		}
+
+		extracted, err := filesystem.ExtractArchive(ctx, reader, volumePath)
+		restore.Files = len(extracted)
+
+		return errors.WithMessage(err, "unable to extract archive")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return restore, nil
+}
+
+// localVolumePath returns the folder of a local volume inside the agent
+func localVolumePath(ctx context.Context, cli *client.Client, volumeName string) (string, error) {
+	inspected, err := cli.VolumeInspect(ctx, volumeName)
+	if err != nil {
+		return "", errors.WithMessage(err, "unable to retrieve volume")
+	}
+
+	if inspected.Driver != "local" {
+		return "", fmt.Errorf("volume driver %s is not supported", inspected.Driver)
+	}
+
+	return filesystem.BuildPathToFileInsideVolume(inspected.Name, "")
+}
+
+// volumeContainers returns the containers mounting the volume in one of the states
+func volumeContainers(ctx context.Context, cli *client.Client, volumeName string, states ...string) ([]types.Container, error) {
+	args := filters.NewArgs(filters.Arg("volume", volumeName))
+	for _, state := range states {
+		args.Add("status", state)
+	}
+
+	return cli.ContainerList(ctx, types.ContainerListOptions{All: true, Filters: args})
+}
+
+// unpauseContainers unpauses the containers paused for a backup, the backup context may already be cancelled
+func unpauseContainers(cli *client.Client, containers []types.Container) {
+	for _, c := range containers {
+		err := cli.ContainerUnpause(context.Background(), c.ID)
+		if err != nil {
+			log.Error().Err(err).Str("container", containerName(c)).Msg("unable to unpause the container after the volume backup")
+		}
+	}
+}
+
+func containerName(c types.Container) string {
+	if len(c.Names) > 0 {
+		return strings.TrimPrefix(c.Names[0], "/")
+	}
+
+	return c.ID
+}
+
+// clearDirectory removes the content of a directory, the directory itself is kept
+func clearDirectory(directoryPath string) error {
+	entries, err := os.ReadDir(directoryPath)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		err := os.RemoveAll(filepath.Join(directoryPath, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// progressReader reports the progress of the read of an archive of a known size
+type progressReader struct {
+	reader     io.Reader
+	read       int64
+	total      int64
+	percent    int
+	onProgress func(percent int, message string)
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.reader.Read(p)
+	pr.read += int64(n)
+
+	// the progress is only reported when the percentage changes, the reads of an archive are small and frequent
+	if percent := int(pr.read * 100 / pr.total); percent != pr.percent && percent <= 100 {
+		pr.percent = percent
+		pr.onProgress(percent, fmt.Sprintf("%d/%d bytes restored", pr.read, pr.total))
+	}
+
+	return n, err
+}
@@ -0,0 +1,57 @@
+package docker
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProgressReader(t *testing.T) {
+	var percents []int
+
+	reader := &progressReader{
+		reader: bytes.NewReader(make([]byte, 1000)),
+		total:  1000,
+		onProgress: func(percent int, message string) {
+			percents = append(percents, percent)
+		},
+	}
+
+	buf := make([]byte, 100)
+	for {
+		_, err := reader.Read(buf)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(percents) != 10 || percents[9] != 100 {
+		t.Fatalf("expected the progress to be reported every 10%%, got %v", percents)
+	}
+}
+
+func TestClearDirectory(t *testing.T) {
+	dir := t.TempDir()
+
+	os.MkdirAll(filepath.Join(dir, "sub", "nested"), 0755)
+	os.WriteFile(filepath.Join(dir, "file"), []byte("data"), 0644)
+	os.WriteFile(filepath.Join(dir, "sub", "nested", "file"), []byte("data"), 0644)
+
+	err := clearDirectory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("expected the directory to be kept, got %s", err)
+	}
+
+	if len(entries) != 0 {
+		t.Fatalf("expected the directory to be empty, got %d entries", len(entries))
+	}
+}
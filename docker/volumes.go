@@ -3,6 +3,8 @@ package docker
 import (
 	"context"
 
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
 )
 
@@ -11,3 +13,23 @@ func VolumeDelete(name string, force bool) error {
 		return cli.VolumeRemove(context.Background(), name, force)
 	})
 }
+
+// VolumeList returns the volumes of the host
+func VolumeList(ctx context.Context) (r []*volume.Volume, err error) {
+	err = withCli(func(cli *client.Client) error {
+		volumes, err := cli.VolumeList(ctx, filters.Args{})
+		r = volumes.Volumes
+
+		return err
+	})
+
+	return r, err
+}
+
+// VolumeCreate creates a Docker volume
+func VolumeCreate(ctx context.Context, options volume.CreateOptions) error {
+	return withCli(func(cli *client.Client) error {
+		_, err := cli.VolumeCreate(ctx, options)
+		return err
+	})
+}
@@ -0,0 +1,229 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/edge/yaml"
+)
+
+// Fields of a service compared to its definition
+const (
+	FieldService  = "service"
+	FieldImage    = "image"
+	FieldEnv      = "env"
+	FieldReplicas = "replicas"
+)
+
+// StackDrift reports the differences between the services running a stack and the stack file deployed by the agent
+type StackDrift struct {
+	StackID   int          `json:"StackID"`
+	Name      string       `json:"Name"`
+	Drifted   bool         `json:"Drifted"`
+	Diffs     []Difference `json:"Diffs,omitempty"`
+	CheckedAt time.Time    `json:"CheckedAt"`
+	// Error is the reason why the stack could not be compared to its stack file
+	Error string `json:"Error,omitempty"`
+}
+
+// Difference is a field of a service that no longer matches the stack file. The values of the environment variables
+// are not reported, only their names.
+type Difference struct {
+	Service   string `json:"Service"`
+	Container string `json:"Container,omitempty"`
+	Field     string `json:"Field"`
+	Expected  string `json:"Expected"`
+	Actual    string `json:"Actual"`
+}
+
+var (
+	reports   = map[int]StackDrift{}
+	reportsMu sync.Mutex
+)
+
+// Detect compares the services of the stack deployed with fileContent, in the Compose project or the Swarm
+// namespace projectName, to their definition
+func Detect(ctx context.Context, stackID int, name, projectName, fileContent string, swarm bool) StackDrift {
+	report := StackDrift{StackID: stackID, Name: name, CheckedAt: time.Now()}
+
+	definitions, err := yaml.GetComposeServiceDefinitions(fileContent)
+	if err != nil {
+		report.Error = err.Error()
+
+		return report
+	}
+
+	var states []docker.StackServiceState
+	if swarm {
+		states, err = docker.GetSwarmStackStates(ctx, projectName)
+	} else {
+		states, err = docker.GetComposeStackStates(ctx, projectName)
+	}
+
+	if err != nil {
+		report.Error = err.Error()
+
+		return report
+	}
+
+	report.Diffs = Compare(definitions, states)
+	report.Drifted = len(report.Diffs) > 0
+
+	return report
+}
+
+// Compare returns the differences between the definitions of the services and their running state. The services
+// running without definition are orphans, they are not reported as drift.
+func Compare(definitions []yaml.ComposeServiceDefinition, states []docker.StackServiceState) []Difference {
+	byName := map[string]docker.StackServiceState{}
+	for _, state := range states {
+		byName[state.Name] = state
+	}
+
+	diffs := []Difference{}
+	for _, definition := range definitions {
+		state, ok := byName[definition.Name]
+		if !ok {
+			diffs = append(diffs, Difference{Service: definition.Name, Field: FieldService, Expected: "present", Actual: "missing"})
+
+			continue
+		}
+
+		if definition.Replicas > 0 && !state.Global && state.Running != definition.Replicas {
+			diffs = append(diffs, Difference{
+				Service:  definition.Name,
+				Field:    FieldReplicas,
+				Expected: fmt.Sprint(definition.Replicas),
+				Actual:   fmt.Sprint(state.Running),
+			})
+		}
+
+		for _, instance := range state.Instances {
+			if definition.Image != "" && !sameImage(definition.Image, instance.Image) {
+				diffs = append(diffs, Difference{
+					Service:   definition.Name,
+					Container: instance.Container,
+					Field:     FieldImage,
+					Expected:  definition.Image,
+					Actual:    instance.Image,
+				})
+			}
+
+			diffs = append(diffs, compareEnv(definition, instance)...)
+		}
+	}
+
+	return diffs
+}
+
+func compareEnv(definition yaml.ComposeServiceDefinition, instance docker.StackServiceInstance) []Difference {
+	env := map[string]string{}
+	for _, entry := range instance.Env {
+		key, value, _ := strings.Cut(entry, "=")
+		env[key] = value
+	}
+
+	keys := make([]string, 0, len(definition.Environment))
+	for key := range definition.Environment {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	diffs := []Difference{}
+	for _, key := range keys {
+		value, ok := env[key]
+
+		actual := "changed"
+		switch {
+		case !ok:
+			actual = "unset"
+		case value == definition.Environment[key]:
+			continue
+		}
+
+		diffs = append(diffs, Difference{Service: definition.Name, Container: instance.Container, Field: FieldEnv, Expected: key, Actual: actual})
+	}
+
+	return diffs
+}
+
+// sameImage returns true when the image of a container is the one of the stack file. Swarm pins the digest of the
+// image in the specification of the services, the tags are compared when the stack file does not pin it.
+func sameImage(expected, actual string) bool {
+	if expected == actual {
+		return true
+	}
+
+	if strings.Contains(expected, "@") {
+		return false
+	}
+
+	actual, _, _ = strings.Cut(actual, "@")
+
+	return normalizeImage(expected) == normalizeImage(actual)
+}
+
+// normalizeImage adds the implicit latest tag and Docker Hub library repository to an image reference
+func normalizeImage(image string) string {
+	image = strings.TrimPrefix(image, "docker.io/")
+	image = strings.TrimPrefix(image, "library/")
+
+	if i := strings.LastIndex(image, ":"); i <= strings.LastIndex(image, "/") {
+		image += ":latest"
+	}
+
+	return image
+}
+
+// SetReport records the last drift report of a stack, reported in the snapshots
+func SetReport(report StackDrift) {
+	reportsMu.Lock()
+	defer reportsMu.Unlock()
+
+	reports[report.StackID] = report
+}
+
+// RemoveReport removes the drift report of a stack that is no longer deployed
+func RemoveReport(stackID int) {
+	reportsMu.Lock()
+	defer reportsMu.Unlock()
+
+	delete(reports, stackID)
+}
+
+// Reports returns the last drift reports of the deployed stacks, sorted by stack identifier
+func Reports() []StackDrift {
+	reportsMu.Lock()
+	defer reportsMu.Unlock()
+
+	if len(reports) == 0 {
+		return nil
+	}
+
+	result := make([]StackDrift, 0, len(reports))
+	for _, report := range reports {
+		result = append(result, report)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].StackID < result[j].StackID })
+
+	return result
+}
+
+// Diagnostics returns a diagnostic message for each stack that drifted from its stack file
+func Diagnostics() []string {
+	diagnostics := []string{}
+	for _, report := range Reports() {
+		if report.Drifted {
+			diagnostics = append(diagnostics, fmt.Sprintf("stack %s drifted from its stack file: %d differences", report.Name, len(report.Diffs)))
+		}
+	}
+
+	return diagnostics
+}
@@ -0,0 +1,60 @@
+package drift
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/edge/yaml"
+)
+
+func TestCompare(t *testing.T) {
+	definitions := []yaml.ComposeServiceDefinition{
+		{Name: "web", Image: "nginx", Environment: map[string]string{"MODE": "prod", "PORT": "80"}, Replicas: 2},
+		{Name: "worker", Image: "registry:5000/worker:1.2", Replicas: 1},
+		{Name: "db", Image: "postgres:15", Replicas: 1},
+	}
+
+	states := []docker.StackServiceState{
+		{Name: "web", Running: 2, Instances: []docker.StackServiceInstance{
+			{Container: "web-1", Image: "docker.io/library/nginx:latest", Env: []string{"MODE=prod", "PORT=80", "PATH=/bin"}},
+			{Container: "web-2", Image: "nginx:latest", Env: []string{"MODE=debug"}},
+		}},
+		{Name: "worker", Running: 0, Instances: []docker.StackServiceInstance{
+			{Container: "worker", Image: "registry:5000/worker:1.3@sha256:abc"},
+		}},
+		{Name: "orphan", Running: 1},
+	}
+
+	expected := []Difference{
+		{Service: "web", Container: "web-2", Field: FieldEnv, Expected: "MODE", Actual: "changed"},
+		{Service: "web", Container: "web-2", Field: FieldEnv, Expected: "PORT", Actual: "unset"},
+		{Service: "worker", Field: FieldReplicas, Expected: "1", Actual: "0"},
+		{Service: "worker", Container: "worker", Field: FieldImage, Expected: "registry:5000/worker:1.2", Actual: "registry:5000/worker:1.3@sha256:abc"},
+		{Service: "db", Field: FieldService, Expected: "present", Actual: "missing"},
+	}
+
+	diffs := Compare(definitions, states)
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, diffs)
+	}
+}
+
+func TestSameImage(t *testing.T) {
+	tests := []struct {
+		expected, actual string
+		same             bool
+	}{
+		{"nginx", "nginx:latest@sha256:abc", true},
+		{"nginx:1.25", "nginx:1.25", true},
+		{"nginx:1.25", "nginx:1.24", false},
+		{"nginx@sha256:abc", "nginx@sha256:def", false},
+		{"ghcr.io/org/app", "ghcr.io/org/app:latest", true},
+	}
+
+	for _, test := range tests {
+		if sameImage(test.expected, test.actual) != test.same {
+			t.Errorf("expected sameImage(%q, %q) to be %t", test.expected, test.actual, test.same)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package edge
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// claimPollInterval is the interval between two checks of the approval of the claim
+	claimPollInterval = 5 * time.Second
+	// claimCodeAlphabet excludes the characters that are easily confused when read on a label or a screen
+	claimCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	claimCodeLength   = 8
+)
+
+// ErrClaimAbandoned is returned when an Edge key is associated to the agent otherwise while the device is claimed
+var ErrClaimAbandoned = errors.New("an Edge key was associated to the agent, the claim is abandoned")
+
+var (
+	errClaimPending = errors.New("the claim is not approved yet")
+	errClaimExpired = errors.New("the claim expired")
+	errClaimDenied  = errors.New("the claim was denied")
+)
+
+// claimState is persisted in the data folder, so that the code displayed or printed for the device stays the same
+// across restarts until the device is claimed
+type claimState struct {
+	Code   string
+	Secret string
+}
+
+type claimRequest struct {
+	Code     string
+	Secret   string
+	EdgeID   string
+	Hostname string
+}
+
+type claimResponse struct {
+	EdgeKey string
+}
+
+// Claimer binds the device to a Portainer instance without an Edge key: the agent registers a short claim code with
+// the instance, the user enters the code in Portainer (or scans the claim URL) to approve the device, and the agent
+// polls the instance until the claim is approved to obtain its Edge key. The polls are authenticated with a secret
+// only known to the agent, the code alone does not give access to the key.
+type Claimer struct {
+	manager   *Manager
+	serverURL string
+	state     claimState
+	interval  time.Duration
+
+	claimed     chan struct{}
+	claimedOnce sync.Once
+}
+
+// NewClaimer returns a pointer to a Claimer of the device with the Portainer instance at serverURL, the claim code is
+// generated on the first call and persisted in the data folder
+func NewClaimer(manager *Manager, serverURL string) (*Claimer, error) {
+	if _, err := portainerURL(serverURL, agent.EdgeClaimPath); err != nil {
+		return nil, err
+	}
+
+	state, err := loadClaimState(manager.agentOptions.DataPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Claimer{
+		manager:   manager,
+		serverURL: serverURL,
+		state:     state,
+		interval:  claimPollInterval,
+		claimed:   make(chan struct{}),
+	}, nil
+}
+
+// Code returns the claim code to enter in Portainer, formatted as XXXX-XXXX
+func (claimer *Claimer) Code() string {
+	return claimer.state.Code[:claimCodeLength/2] + "-" + claimer.state.Code[claimCodeLength/2:]
+}
+
+// URL returns the page of the Portainer instance approving the claim, it can be encoded in a QR code
+func (claimer *Claimer) URL() string {
+	return strings.TrimSuffix(strings.TrimSpace(claimer.serverURL), "/") + agent.EdgeClaimUIPath + "?code=" + claimer.Code()
+}
+
+// Claimed returns a channel closed once the device is claimed
+func (claimer *Claimer) Claimed() <-chan struct{} {
+	return claimer.claimed
+}
+
+// Run registers the claim code and polls the Portainer instance until the claim is approved, then associates the
+// Edge key obtained to the agent. An expired claim is registered again, an error is returned when the claim is denied
+// or ctx is done.
+func (claimer *Claimer) Run(ctx context.Context) error {
+	registered := false
+
+	for {
+		if claimer.manager.IsKeySet() {
+			removeClaimState(claimer.manager.agentOptions.DataPath)
+
+			return ErrClaimAbandoned
+		}
+
+		var err error
+		if !registered {
+			err = claimer.register(ctx)
+			registered = err == nil
+		}
+
+		if err == nil {
+			var key string
+			key, err = claimer.poll(ctx)
+			if err == nil {
+				err = claimer.manager.SetKey(key)
+				if err != nil {
+					return err
+				}
+
+				removeClaimState(claimer.manager.agentOptions.DataPath)
+				claimer.claimedOnce.Do(func() { close(claimer.claimed) })
+
+				return nil
+			}
+		}
+
+		switch {
+		case errors.Is(err, errClaimDenied):
+			removeClaimState(claimer.manager.agentOptions.DataPath)
+
+			return err
+		case errors.Is(err, errClaimExpired):
+			registered = false
+		case errors.Is(err, errClaimPending):
+		default:
+			log.Warn().Err(err).Msg("unable to claim the device")
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(claimer.interval):
+		}
+	}
+}
+
+func (claimer *Claimer) register(ctx context.Context) error {
+	u, err := portainerURL(claimer.serverURL, agent.EdgeClaimPath)
+	if err != nil {
+		return err
+	}
+
+	hostname, _ := os.Hostname()
+
+	body, err := json.Marshal(claimRequest{
+		Code:     claimer.state.Code,
+		Secret:   claimer.state.Secret,
+		EdgeID:   claimer.manager.agentOptions.EdgeID,
+		Hostname: hostname,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, enrollmentRequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := enrollmentClient(claimer.manager.agentOptions.EdgeInsecurePoll).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("the registration of the claim was refused with the status %d", resp.StatusCode)
+	}
+
+	log.Info().Str("claim_code", claimer.Code()).Str("claim_url", claimer.URL()).Msg("enter the claim code in Portainer to claim the device")
+
+	return nil
+}
+
+// poll returns the Edge key of the device once the claim is approved
+func (claimer *Claimer) poll(ctx context.Context) (string, error) {
+	u, err := portainerURL(claimer.serverURL, agent.EdgeClaimPath+"/"+claimer.state.Code)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, enrollmentRequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+claimer.state.Secret)
+
+	resp, err := enrollmentClient(claimer.manager.agentOptions.EdgeInsecurePoll).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusAccepted:
+		return "", errClaimPending
+	case http.StatusNotFound, http.StatusGone:
+		return "", errClaimExpired
+	case http.StatusForbidden:
+		return "", errClaimDenied
+	default:
+		return "", fmt.Errorf("the claim was checked with the status %d", resp.StatusCode)
+	}
+
+	var response claimResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := ParseEdgeKey(response.EdgeKey); err != nil {
+		return "", errors.New("the Portainer instance returned an invalid Edge key")
+	}
+
+	return response.EdgeKey, nil
+}
+
+func loadClaimState(dataPath string) (claimState, error) {
+	path := filepath.Join(dataPath, agent.EdgeClaimFile)
+
+	var state claimState
+
+	content, err := os.ReadFile(path)
+	if err == nil && json.Unmarshal(content, &state) == nil && len(state.Code) == claimCodeLength && state.Secret != "" {
+		return state, nil
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return state, err
+	}
+
+	state, err = newClaimState()
+	if err != nil {
+		return state, err
+	}
+
+	content, err = json.Marshal(state)
+	if err != nil {
+		return state, err
+	}
+
+	return state, os.WriteFile(path, content, 0600)
+}
+
+func newClaimState() (claimState, error) {
+	random := make([]byte, claimCodeLength+32)
+	if _, err := rand.Read(random); err != nil {
+		return claimState{}, err
+	}
+
+	// len(claimCodeAlphabet) divides 256, the characters are uniformly distributed
+	code := make([]byte, claimCodeLength)
+	for i := range code {
+		code[i] = claimCodeAlphabet[int(random[i])%len(claimCodeAlphabet)]
+	}
+
+	return claimState{
+		Code:   string(code),
+		Secret: hex.EncodeToString(random[claimCodeLength:]),
+	}, nil
+}
+
+func removeClaimState(dataPath string) {
+	err := os.Remove(filepath.Join(dataPath, agent.EdgeClaimFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Warn().Err(err).Msg("unable to remove the claim of the device")
+	}
+}
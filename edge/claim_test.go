@@ -0,0 +1,98 @@
+package edge
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/portainer/agent"
+)
+
+func TestClaimer(t *testing.T) {
+	key := encodeKey(&edgeKey{PortainerInstanceURL: "https://portainer.example.com", TunnelServerAddr: "portainer.example.com:8000", EndpointID: 1})
+
+	var (
+		mu         sync.Mutex
+		registered claimRequest
+		polls      int
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == agent.EdgeClaimPath:
+			json.NewDecoder(r.Body).Decode(&registered)
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodGet && r.URL.Path == agent.EdgeClaimPath+"/"+registered.Code:
+			if r.Header.Get("Authorization") != "Bearer "+registered.Secret {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+
+			polls++
+			if polls < 3 {
+				w.WriteHeader(http.StatusAccepted)
+				return
+			}
+
+			json.NewEncoder(w).Encode(claimResponse{EdgeKey: key})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dataPath := t.TempDir()
+	manager := NewManager(&ManagerParameters{
+		Options: &agent.Options{DataPath: dataPath, EdgeID: "device-1"},
+	})
+
+	claimer, err := NewClaimer(manager, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimer.interval = 10 * time.Millisecond
+
+	restarted, err := NewClaimer(manager, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claimer.Code() != restarted.Code() || len(claimer.Code()) != claimCodeLength+1 {
+		t.Errorf("expected the claim code to be persisted, got %s and %s", claimer.Code(), restarted.Code())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = claimer.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-claimer.Claimed():
+	default:
+		t.Error("expected the device to be claimed")
+	}
+
+	if manager.GetKey() != key || registered.EdgeID != "device-1" {
+		t.Errorf("expected the Edge key to be associated, got %q", manager.GetKey())
+	}
+
+	if _, err := os.Stat(filepath.Join(dataPath, agent.EdgeClaimFile)); !os.IsNotExist(err) {
+		t.Error("expected the claim code to be removed once the device is claimed")
+	}
+
+	if err := claimer.Run(ctx); err != ErrClaimAbandoned {
+		t.Errorf("expected the claim to be abandoned once a key is associated, got %v", err)
+	}
+}
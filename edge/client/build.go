@@ -1,9 +1,11 @@
 package client
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"net/http"
+	"net/url"
 	"os"
 	"sync"
 	"time"
@@ -14,19 +16,36 @@ import (
 	"github.com/portainer/agent"
 	"github.com/portainer/agent/crypto"
 	"github.com/portainer/agent/edge/revoke"
+	"github.com/portainer/agent/faults"
+	"github.com/portainer/agent/identity"
+	agentnet "github.com/portainer/agent/net"
+	"github.com/portainer/agent/relay"
+	"github.com/portainer/agent/spiffe"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
 )
 
 type edgeHTTPClient struct {
 	httpClient    *http.Client
 	options       *agent.Options
+	identity      *identity.Identity
+	svidSource    *spiffe.X509Source
+	payloadCipher *crypto.PayloadCipher
+	tokenSource   oauth2.TokenSource
 	revokeService *revoke.Service
+	endpoints     *endpointPool
 	certMTime     time.Time
 	keyMTime      time.Time
 	caMTime       time.Time
 	mu            sync.RWMutex
 }
 
-func BuildHTTPClient(timeout float64, options *agent.Options) *edgeHTTPClient {
+// BuildHTTPClient returns a client used to communicate with the Portainer server. When agentIdentity is not
+// nil, the identity headers are added to every request. When svidSource is not nil, its X509 SVID is used as the
+// client certificate instead of the mTLS certificate files. When an OIDC token URL is configured, every request is
+// authenticated with an access token obtained with the client credentials grant. When payloadCipher is not nil, the
+// payloads of the Edge Async mode are encrypted.
+func BuildHTTPClient(timeout float64, options *agent.Options, agentIdentity *identity.Identity, svidSource *spiffe.X509Source, payloadCipher *crypto.PayloadCipher) *edgeHTTPClient {
 	revokeService := revoke.NewService()
 
 	c := &edgeHTTPClient{
@@ -34,29 +53,144 @@ func BuildHTTPClient(timeout float64, options *agent.Options) *edgeHTTPClient {
 			Timeout: time.Duration(timeout) * time.Second,
 		},
 		options:       options,
+		identity:      agentIdentity,
+		svidSource:    svidSource,
+		payloadCipher: payloadCipher,
 		revokeService: revokeService,
 	}
 
 	c.mu.Lock()
-	c.httpClient.Transport = c.buildTransport()
+	c.httpClient.Transport = c.buildRoundTripper()
 	c.mu.Unlock()
 
+	if options.EdgeOIDCTokenURL != "" {
+		c.tokenSource = buildTokenSource(options)
+	}
+
 	return c
 }
 
+// buildTokenSource returns a source of access tokens issued by the identity provider, tokens are cached and
+// requested again shortly before they expire
+func buildTokenSource(options *agent.Options) oauth2.TokenSource {
+	config := &clientcredentials.Config{
+		ClientID:     options.EdgeOIDCClientID,
+		ClientSecret: options.EdgeOIDCClientSecret,
+		TokenURL:     options.EdgeOIDCTokenURL,
+		Scopes:       options.EdgeOIDCScopes,
+	}
+
+	if options.EdgeOIDCAudience != "" {
+		config.EndpointParams = url.Values{"audience": {options.EdgeOIDCAudience}}
+	}
+
+	return config.TokenSource(context.Background())
+}
+
 func (c *edgeHTTPClient) Do(req *http.Request) (*http.Response, error) {
 	if c.certsNeedsRotation() {
 		log.Debug().Msg("reloading certificates")
 
 		c.mu.Lock()
-		c.httpClient.Transport = c.buildTransport()
+		previous := c.httpClient.Transport
+		c.httpClient.Transport = c.buildRoundTripper()
 		c.mu.Unlock()
+
+		// the connections established with the previous certificates are not reused
+		switch transport := previous.(type) {
+		case *quicTransport:
+			transport.Close()
+		case *http.Transport:
+			transport.CloseIdleConnections()
+		}
+	}
+
+	if c.identity != nil {
+		err := c.identity.SetHeaders(req.Header)
+		if err != nil {
+			return nil, err
+		}
 	}
 
+	if c.tokenSource != nil {
+		token, err := c.tokenSource.Token()
+		if err != nil {
+			recordConnectivity(ConnectivityIdentityProvider, 0, err)
+
+			return nil, &ConnectivityError{State: ConnectivityIdentityProvider, Err: err}
+		}
+
+		token.SetAuthHeader(req)
+	}
+
+	resp, err := c.send(req)
+
+	// the requests canceled by the agent do not reveal the connectivity
+	if req.Context().Err() != nil {
+		return resp, err
+	}
+
+	state := classifyConnectivity(resp, err)
+	if err != nil {
+		recordConnectivity(state, 0, err)
+
+		return nil, &ConnectivityError{State: state, Err: err}
+	}
+
+	if state != ConnectivityOK {
+		recordConnectivity(state, resp.StatusCode, errors.New(resp.Status))
+	} else {
+		recordConnectivity(state, 0, nil)
+	}
+
+	return resp, nil
+}
+
+// Relay sends a request relayed for a peer agent to the Portainer server. The request keeps the identity of the peer,
+// only the hop is signed with the relay secret.
+func (c *edgeHTTPClient) Relay(req *http.Request) (*http.Response, error) {
+	return c.send(req)
+}
+
+// send sends req to the Portainer server, through the available URL when failover is enabled. The hop is signed for
+// the relay of the site when the relay secret is set, each attempt is signed once its URL is known since the
+// signature covers the URI of the request.
+func (c *edgeHTTPClient) send(req *http.Request) (*http.Response, error) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	return c.httpClient.Do(req)
+	do := c.httpClient.Do
+	if c.options.RelaySecret != "" {
+		do = func(attempt *http.Request) (*http.Response, error) {
+			err := relay.Sign(attempt, c.options.RelaySecret, faults.Now())
+			if err != nil {
+				return nil, err
+			}
+
+			return c.httpClient.Do(attempt)
+		}
+	}
+
+	if c.endpoints != nil {
+		return c.endpoints.doWithFailover(req, do)
+	}
+
+	return do(req)
+}
+
+// EnableFailover sends the requests built with baseURL to the first available URL of urls, which are the URLs of the
+// Portainer instance by priority. baseURL is attempted after urls when it is not part of them.
+func (c *edgeHTTPClient) EnableFailover(baseURL string, urls []string) error {
+	endpoints, err := newEndpointPool(baseURL, urls)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.endpoints = endpoints
+	c.mu.Unlock()
+
+	return nil
 }
 
 func fileModified(filename string, mtime time.Time) bool {
@@ -75,19 +209,34 @@ func (c *edgeHTTPClient) certsNeedsRotation() bool {
 		fileModified(c.options.SSLCACert, c.caMTime)
 }
 
+// buildRoundTripper returns the transport of the requests, the TCP transport is wrapped in a QUIC transport when
+// the experimental QUIC transport is enabled
+func (c *edgeHTTPClient) buildRoundTripper() http.RoundTripper {
+	transport := c.buildTransport()
+
+	if c.options.EdgePollTransport == agent.EdgePollTransportQUIC {
+		return newQUICTransport(transport, c.options.EdgeIdleConnTimeout)
+	}
+
+	return transport
+}
+
 func (c *edgeHTTPClient) buildTransport() *http.Transport {
 	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = agentnet.MeterDialContext(agentnet.BandwidthSnapshots, agentnet.SplitHorizonDialContext(transport.DialContext))
 
 	transport.TLSClientConfig = crypto.CreateTLSConfiguration()
 	transport.TLSClientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(0)
 
+	configureConnectionPool(transport, c.options)
+
 	if c.options.EdgeInsecurePoll {
 		transport.TLSClientConfig.InsecureSkipVerify = true
 
 		return transport
 	}
 
-	if c.options.SSLCert == "" || c.options.SSLKey == "" {
+	if c.svidSource == nil && (c.options.SSLCert == "" || c.options.SSLKey == "") {
 		return transport
 	}
 
@@ -117,6 +266,10 @@ func (c *edgeHTTPClient) buildTransport() *http.Transport {
 	}
 
 	transport.TLSClientConfig.GetClientCertificate = func(cri *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		if c.svidSource != nil {
+			return c.svidSource.GetCertificate()
+		}
+
 		cert, err := tls.LoadX509KeyPair(c.options.SSLCert, c.options.SSLKey)
 
 		return &cert, err
@@ -131,7 +284,7 @@ func (c *edgeHTTPClient) buildTransport() *http.Transport {
 				}
 
 				if revoked {
-					return errors.New("certificate has been revoked")
+					return errCertificateRevoked
 				}
 			}
 		}
@@ -141,3 +294,24 @@ func (c *edgeHTTPClient) buildTransport() *http.Transport {
 
 	return transport
 }
+
+// configureConnectionPool tunes the connections kept open to the Portainer instance. All the requests are sent to
+// the same instance so the idle connections per host are bounded like the idle connections. HTTP/2 must be forced
+// because the transport uses a custom dialer and TLS configuration, it multiplexes the requests on a single
+// connection when the instance supports it and falls back to HTTP/1.1 otherwise.
+func configureConnectionPool(transport *http.Transport, options *agent.Options) {
+	if options.EdgeMaxIdleConns > 0 {
+		transport.MaxIdleConns = options.EdgeMaxIdleConns
+		transport.MaxIdleConnsPerHost = options.EdgeMaxIdleConns
+	}
+
+	if options.EdgeIdleConnTimeout > 0 {
+		transport.IdleConnTimeout = options.EdgeIdleConnTimeout
+	}
+
+	transport.ForceAttemptHTTP2 = options.EdgeHTTP2
+	if !options.EdgeHTTP2 {
+		// a non-nil empty map disables HTTP/2
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+}
@@ -0,0 +1,252 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/portainer/agent"
+	"golang.org/x/oauth2"
+)
+
+func TestConfigureConnectionPool(t *testing.T) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	configureConnectionPool(transport, &agent.Options{EdgeHTTP2: true, EdgeMaxIdleConns: 4, EdgeIdleConnTimeout: time.Minute})
+
+	if transport.MaxIdleConns != 4 || transport.MaxIdleConnsPerHost != 4 {
+		t.Errorf("expected 4 idle connections, got %d and %d per host", transport.MaxIdleConns, transport.MaxIdleConnsPerHost)
+	}
+
+	if transport.IdleConnTimeout != time.Minute {
+		t.Errorf("expected an idle connection timeout of 1m, got %s", transport.IdleConnTimeout)
+	}
+
+	if !transport.ForceAttemptHTTP2 || transport.TLSNextProto != nil {
+		t.Error("expected HTTP/2 to be attempted")
+	}
+}
+
+func TestConfigureConnectionPoolDefaults(t *testing.T) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	defaults := transport.Clone()
+
+	configureConnectionPool(transport, &agent.Options{})
+
+	if transport.MaxIdleConns != defaults.MaxIdleConns || transport.MaxIdleConnsPerHost != defaults.MaxIdleConnsPerHost || transport.IdleConnTimeout != defaults.IdleConnTimeout {
+		t.Error("expected the defaults of the transport to be kept")
+	}
+
+	if transport.ForceAttemptHTTP2 || transport.TLSNextProto == nil || len(transport.TLSNextProto) != 0 {
+		t.Error("expected HTTP/2 to be disabled")
+	}
+}
+
+// tokenEndpoint is a stub token endpoint of an identity provider issuing access tokens with the client credentials
+// grant
+type tokenEndpoint struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu sync.Mutex
+	// expiresIn is the lifetime in seconds of the issued tokens
+	expiresIn int
+	// status is the status of the error responses, tokens are issued when it is zero
+	status   int
+	requests int
+}
+
+func newTokenEndpoint(t *testing.T) *tokenEndpoint {
+	endpoint := &tokenEndpoint{t: t, expiresIn: 3600}
+
+	endpoint.server = httptest.NewServer(http.HandlerFunc(endpoint.serveHTTP))
+	t.Cleanup(endpoint.server.Close)
+
+	return endpoint
+}
+
+func (endpoint *tokenEndpoint) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	endpoint.mu.Lock()
+	defer endpoint.mu.Unlock()
+
+	endpoint.requests++
+
+	err := r.ParseForm()
+	if err != nil {
+		endpoint.t.Error(err)
+	}
+
+	// the credentials are sent in the parameters when the identity provider rejects the basic authentication
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	if clientID != "agent" || clientSecret != "secret" {
+		endpoint.t.Errorf("expected the client credentials, got %q %q", clientID, clientSecret)
+	}
+
+	expected := map[string]string{"grant_type": "client_credentials", "scope": "edge:read edge:write", "audience": "portainer"}
+	for name, value := range expected {
+		if r.PostForm.Get(name) != value {
+			endpoint.t.Errorf("expected the %s parameter to be %q, got %q", name, value, r.PostForm.Get(name))
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if endpoint.status != 0 {
+		w.WriteHeader(endpoint.status)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": fmt.Sprintf("token-%d", endpoint.requests),
+		"token_type":   "Bearer",
+		"expires_in":   endpoint.expiresIn,
+	})
+}
+
+func (endpoint *tokenEndpoint) set(expiresIn, status int) {
+	endpoint.mu.Lock()
+	defer endpoint.mu.Unlock()
+
+	endpoint.expiresIn = expiresIn
+	endpoint.status = status
+}
+
+func (endpoint *tokenEndpoint) requestCount() int {
+	endpoint.mu.Lock()
+	defer endpoint.mu.Unlock()
+
+	return endpoint.requests
+}
+
+func newTestTokenSource(tokenURL string) oauth2.TokenSource {
+	return buildTokenSource(&agent.Options{
+		EdgeOIDCTokenURL:     tokenURL,
+		EdgeOIDCClientID:     "agent",
+		EdgeOIDCClientSecret: "secret",
+		EdgeOIDCScopes:       []string{"edge:read", "edge:write"},
+		EdgeOIDCAudience:     "portainer",
+	})
+}
+
+func TestTokenSourceCaching(t *testing.T) {
+	endpoint := newTokenEndpoint(t)
+	source := newTestTokenSource(endpoint.server.URL)
+
+	for i := 0; i < 3; i++ {
+		token, err := source.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if token.AccessToken != "token-1" || token.Type() != "Bearer" {
+			t.Errorf("expected the cached token, got %q %q", token.Type(), token.AccessToken)
+		}
+	}
+
+	if count := endpoint.requestCount(); count != 1 {
+		t.Errorf("expected the token to be requested once, got %d requests", count)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/endpoints/1/edge/status", nil)
+
+	token, _ := source.Token()
+	token.SetAuthHeader(req)
+
+	if header := req.Header.Get("Authorization"); header != "Bearer token-1" {
+		t.Errorf("expected the access token in the Authorization header, got %q", header)
+	}
+}
+
+func TestTokenSourceExpiry(t *testing.T) {
+	endpoint := newTokenEndpoint(t)
+
+	// the tokens are requested again shortly before they expire
+	endpoint.set(1, 0)
+
+	source := newTestTokenSource(endpoint.server.URL)
+
+	first, err := source.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := source.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.AccessToken != "token-1" || second.AccessToken != "token-2" {
+		t.Errorf("expected a new token once the previous one expires, got %q and %q", first.AccessToken, second.AccessToken)
+	}
+
+	endpoint.set(3600, 0)
+
+	third, err := source.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fourth, err := source.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if third.AccessToken != "token-3" || fourth.AccessToken != "token-3" {
+		t.Errorf("expected the refreshed token to be cached, got %q and %q", third.AccessToken, fourth.AccessToken)
+	}
+}
+
+func TestTokenSourceErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+	}{
+		{name: "invalid client", status: http.StatusUnauthorized},
+		{name: "identity provider failure", status: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoint := newTokenEndpoint(t)
+			endpoint.set(3600, tt.status)
+
+			source := newTestTokenSource(endpoint.server.URL)
+
+			_, err := source.Token()
+
+			var retrieveErr *oauth2.RetrieveError
+			if !errors.As(err, &retrieveErr) || retrieveErr.Response.StatusCode != tt.status {
+				t.Fatalf("expected the error of the token endpoint, got %v", err)
+			}
+
+			// the errors are not cached
+			endpoint.set(3600, 0)
+
+			requests := endpoint.requestCount()
+
+			token, err := source.Token()
+			if err != nil || token.AccessToken != fmt.Sprintf("token-%d", requests+1) {
+				t.Errorf("expected a new token once the identity provider recovers, got %v", err)
+			}
+		})
+	}
+
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	_, err := newTestTokenSource(unreachable.URL).Token()
+	if err == nil {
+		t.Error("expected an error when the identity provider is unreachable")
+	}
+}
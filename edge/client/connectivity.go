@@ -0,0 +1,217 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/portainer/agent/metrics"
+	agentnet "github.com/portainer/agent/net"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ConnectivityState is the outcome of the last request sent to the Portainer instance
+type ConnectivityState string
+
+// States of the connectivity to the Portainer instance
+const (
+	ConnectivityOK ConnectivityState = "ok"
+	// ConnectivityDNS is the failure to resolve the host of the instance
+	ConnectivityDNS ConnectivityState = "dns"
+	// ConnectivityConnectionRefused is a host that resolves but does not accept connections on the port
+	ConnectivityConnectionRefused ConnectivityState = "connection_refused"
+	// ConnectivityTimeout is a connection or a response that did not complete in time
+	ConnectivityTimeout ConnectivityState = "timeout"
+	// ConnectivityNetwork is a host or a network that cannot be reached, or a connection reset
+	ConnectivityNetwork ConnectivityState = "network"
+	// ConnectivityEgressDenied is a connection refused by the egress allowlist of the agent
+	ConnectivityEgressDenied ConnectivityState = "egress_denied"
+	// ConnectivityTLSCertificate is a certificate of the instance that is not trusted, expired, revoked or issued
+	// for another host
+	ConnectivityTLSCertificate ConnectivityState = "tls_certificate"
+	// ConnectivityTLS is a TLS handshake failure other than the verification of the certificate, e.g. an instance
+	// that does not speak TLS or refuses the client certificate
+	ConnectivityTLS ConnectivityState = "tls"
+	// ConnectivityProxyAuth is a proxy that requires credentials
+	ConnectivityProxyAuth ConnectivityState = "proxy_auth"
+	// ConnectivityIdentityProvider is the failure to obtain an access token from the identity provider
+	ConnectivityIdentityProvider ConnectivityState = "identity_provider"
+	// ConnectivityKeyRejected is the instance refusing the Edge key or the Edge ID of the agent
+	ConnectivityKeyRejected ConnectivityState = "key_rejected"
+	// ConnectivityHTTPStatus is a server error answered by the instance or a proxy
+	ConnectivityHTTPStatus ConnectivityState = "http_status"
+	// ConnectivityUnknown is a failure that could not be classified
+	ConnectivityUnknown ConnectivityState = "unknown"
+)
+
+// connectivityDescriptions are the explanations of the failures, logged and reported in the diagnostics
+var connectivityDescriptions = map[ConnectivityState]string{
+	ConnectivityDNS:               "the host of the Portainer instance cannot be resolved, check the DNS configuration of the device",
+	ConnectivityConnectionRefused: "the Portainer instance refused the connection, check that it listens on the port of its URL",
+	ConnectivityTimeout:           "the Portainer instance did not answer in time, check the network path and the firewalls",
+	ConnectivityNetwork:           "the network of the Portainer instance cannot be reached",
+	ConnectivityEgressDenied:      "the connection to the Portainer instance is denied by the egress allowlist of the agent",
+	ConnectivityTLSCertificate:    "the certificate of the Portainer instance is not trusted, check its validity and the CA of the agent",
+	ConnectivityTLS:               "the TLS handshake with the Portainer instance failed",
+	ConnectivityProxyAuth:         "the HTTP proxy requires authentication, check the credentials of HTTPS_PROXY",
+	ConnectivityIdentityProvider:  "unable to obtain an access token from the identity provider",
+	ConnectivityKeyRejected:       "the Portainer instance rejected the Edge key or the Edge ID of the agent",
+	ConnectivityHTTPStatus:        "the Portainer instance or a proxy answered with a server error",
+	ConnectivityUnknown:           "unable to contact the Portainer instance",
+}
+
+// errCertificateRevoked is returned by the verification of a revoked certificate of the Portainer instance
+var errCertificateRevoked = errors.New("certificate has been revoked")
+
+// ConnectivityError is a request to the Portainer instance that failed, with the classification of the failure
+type ConnectivityError struct {
+	State ConnectivityState
+	Err   error
+}
+
+func (e *ConnectivityError) Error() string {
+	return fmt.Sprintf("%s: %s", connectivityDescriptions[e.State], e.Err)
+}
+
+func (e *ConnectivityError) Unwrap() error {
+	return e.Err
+}
+
+// ConnectivityStatus is the state of the connectivity to the Portainer instance
+type ConnectivityStatus struct {
+	State ConnectivityState `json:"State"`
+	// Since is the time of the first request in the state
+	Since time.Time `json:"Since"`
+	// StatusCode is the HTTP status code of the http_status and key_rejected states
+	StatusCode int `json:"StatusCode,omitempty"`
+	// Error is the last error of the failed states
+	Error string `json:"Error,omitempty"`
+	// Failures is the number of consecutive failed requests
+	Failures int `json:"Failures,omitempty"`
+}
+
+var connectivity = struct {
+	mu     sync.Mutex
+	status ConnectivityStatus
+}{}
+
+// classifyConnectivity returns the state of a request from its response and its error
+func classifyConnectivity(resp *http.Response, err error) ConnectivityState {
+	if err == nil {
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+			return ConnectivityKeyRejected
+		case resp.StatusCode == http.StatusProxyAuthRequired:
+			return ConnectivityProxyAuth
+		case resp.StatusCode >= http.StatusInternalServerError:
+			return ConnectivityHTTPStatus
+		}
+
+		return ConnectivityOK
+	}
+
+	var dnsErr *net.DNSError
+	var certInvalidErr x509.CertificateInvalidError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var verificationErr *tls.CertificateVerificationError
+	var recordHeaderErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, agentnet.ErrEgressDenied):
+		return ConnectivityEgressDenied
+	case errors.As(err, &dnsErr):
+		return ConnectivityDNS
+	case errors.As(err, &certInvalidErr), errors.As(err, &unknownAuthorityErr), errors.As(err, &hostnameErr),
+		errors.As(err, &verificationErr), errors.Is(err, errCertificateRevoked):
+		return ConnectivityTLSCertificate
+	case errors.As(err, &recordHeaderErr), errors.As(err, &alertErr):
+		return ConnectivityTLS
+	case strings.Contains(err.Error(), http.StatusText(http.StatusProxyAuthRequired)):
+		// the transport returns the status of the CONNECT request to the proxy as an error
+		return ConnectivityProxyAuth
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ConnectivityConnectionRefused
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ConnectivityTimeout
+	case errors.Is(err, syscall.ENETUNREACH), errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ECONNRESET):
+		return ConnectivityNetwork
+	}
+
+	return ConnectivityUnknown
+}
+
+// recordConnectivity updates the state of the connectivity, a change of state is logged
+func recordConnectivity(state ConnectivityState, statusCode int, err error) {
+	connectivity.mu.Lock()
+	defer connectivity.mu.Unlock()
+
+	previous := connectivity.status
+
+	status := ConnectivityStatus{State: state, Since: previous.Since, StatusCode: statusCode}
+	if state != previous.State || statusCode != previous.StatusCode {
+		status.Since = time.Now()
+	}
+
+	if state != ConnectivityOK {
+		status.Failures = previous.Failures + 1
+		if err != nil {
+			status.Error = err.Error()
+		}
+	}
+
+	connectivity.status = status
+	metrics.SetEdgeConnectivityState(string(state))
+
+	if state == previous.State && statusCode == previous.StatusCode {
+		return
+	}
+
+	if state == ConnectivityOK {
+		if previous.State != "" {
+			log.Info().Str("previous_state", string(previous.State)).Msg("the Portainer instance can be contacted again")
+		}
+
+		return
+	}
+
+	log.Warn().
+		Str("connectivity_state", string(state)).
+		Int("status_code", statusCode).
+		Str("error", status.Error).
+		Msg(connectivityDescriptions[state])
+}
+
+// CurrentConnectivity returns the state of the connectivity to the Portainer instance
+func CurrentConnectivity() ConnectivityStatus {
+	connectivity.mu.Lock()
+	defer connectivity.mu.Unlock()
+
+	return connectivity.status
+}
+
+// ConnectivityDiagnostics returns a diagnostic message when the last requests to the Portainer instance failed
+func ConnectivityDiagnostics() []string {
+	status := CurrentConnectivity()
+	if status.State == "" || status.State == ConnectivityOK {
+		return nil
+	}
+
+	message := fmt.Sprintf("%s (%s) since %s, %d failed requests", connectivityDescriptions[status.State], status.State, status.Since.Format(time.RFC3339), status.Failures)
+	if status.StatusCode != 0 {
+		message += fmt.Sprintf(", status %d", status.StatusCode)
+	}
+
+	return []string{message}
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+
+	agentnet "github.com/portainer/agent/net"
+)
+
+func TestClassifyConnectivity(t *testing.T) {
+	urlError := func(err error) error {
+		return &url.Error{Op: "Get", URL: "https://portainer.example.com/api/status", Err: err}
+	}
+
+	dialError := func(errno syscall.Errno) error {
+		return urlError(&net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: errno}})
+	}
+
+	tests := []struct {
+		name       string
+		statusCode int
+		err        error
+		expected   ConnectivityState
+	}{
+		{name: "ok", statusCode: http.StatusOK, expected: ConnectivityOK},
+		{name: "not found", statusCode: http.StatusNotFound, expected: ConnectivityOK},
+		{name: "key rejected", statusCode: http.StatusForbidden, expected: ConnectivityKeyRejected},
+		{name: "proxy authentication", statusCode: http.StatusProxyAuthRequired, expected: ConnectivityProxyAuth},
+		{name: "bad gateway", statusCode: http.StatusBadGateway, expected: ConnectivityHTTPStatus},
+		{name: "dns", err: urlError(&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "portainer.example.com", IsNotFound: true}}), expected: ConnectivityDNS},
+		{name: "unknown authority", err: urlError(x509.UnknownAuthorityError{}), expected: ConnectivityTLSCertificate},
+		{name: "revoked", err: urlError(errCertificateRevoked), expected: ConnectivityTLSCertificate},
+		{name: "proxy CONNECT", err: urlError(errors.New("Proxy Authentication Required")), expected: ConnectivityProxyAuth},
+		{name: "connection refused", err: dialError(syscall.ECONNREFUSED), expected: ConnectivityConnectionRefused},
+		{name: "host unreachable", err: dialError(syscall.EHOSTUNREACH), expected: ConnectivityNetwork},
+		{name: "timeout", err: urlError(context.DeadlineExceeded), expected: ConnectivityTimeout},
+		{name: "egress denied", err: urlError(fmt.Errorf("%w: portainer.example.com:443", agentnet.ErrEgressDenied)), expected: ConnectivityEgressDenied},
+		{name: "unknown", err: urlError(errors.New("unexpected EOF")), expected: ConnectivityUnknown},
+	}
+
+	for _, test := range tests {
+		var resp *http.Response
+		if test.err == nil {
+			resp = &http.Response{StatusCode: test.statusCode}
+		}
+
+		if state := classifyConnectivity(resp, test.err); state != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, state)
+		}
+	}
+}
+
+func TestRecordConnectivity(t *testing.T) {
+	recordConnectivity(ConnectivityOK, 0, nil)
+	if diagnostics := ConnectivityDiagnostics(); diagnostics != nil {
+		t.Errorf("expected no diagnostic, got %v", diagnostics)
+	}
+
+	recordConnectivity(ConnectivityDNS, 0, errors.New("no such host"))
+	since := CurrentConnectivity().Since
+	recordConnectivity(ConnectivityDNS, 0, errors.New("no such host"))
+
+	status := CurrentConnectivity()
+	if status.State != ConnectivityDNS || status.Failures != 2 || !status.Since.Equal(since) {
+		t.Errorf("expected two DNS failures since %s, got %+v", since, status)
+	}
+
+	if diagnostics := ConnectivityDiagnostics(); len(diagnostics) != 1 {
+		t.Errorf("expected a diagnostic, got %v", diagnostics)
+	}
+
+	recordConnectivity(ConnectivityOK, 0, nil)
+	if status := CurrentConnectivity(); status.Failures != 0 || status.Error != "" {
+		t.Errorf("expected the failures to be reset, got %+v", status)
+	}
+}
@@ -0,0 +1,211 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// failoverMinRetryDelay is the delay before an endpoint that failed once is attempted again
+	failoverMinRetryDelay = 30 * time.Second
+	// failoverMaxRetryDelay bounds the delay before an endpoint that keeps failing is attempted again
+	failoverMaxRetryDelay = 5 * time.Minute
+)
+
+// serverEndpoint is a URL of the Portainer instance and its health
+type serverEndpoint struct {
+	url      *url.URL
+	failures int
+	retryAt  time.Time
+}
+
+// endpointPool holds the prioritized URLs of the Portainer instance, e.g. the primary instance, its disaster recovery
+// instance and the primary instance reached through a VPN. The requests are sent to the healthy endpoint with the
+// highest priority, an endpoint that fails is skipped with a growing delay and attempted again once the delay
+// elapsed, so that the agent returns to the primary instance once it is available again.
+type endpointPool struct {
+	// base is the URL the requests are built with, it is replaced with the URL of the endpoint
+	base      *url.URL
+	endpoints []*serverEndpoint
+	active    *serverEndpoint
+	mu        sync.Mutex
+}
+
+func newEndpointPool(baseURL string, urls []string) (*endpointPool, error) {
+	base, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Portainer URL %q: %w", baseURL, err)
+	}
+
+	pool := &endpointPool{base: base}
+
+	seen := map[string]bool{}
+	// the URL of the Edge key is attempted last when it is not part of the list
+	for _, rawURL := range append(urls, baseURL) {
+		rawURL = strings.TrimSuffix(rawURL, "/")
+		if seen[rawURL] {
+			continue
+		}
+		seen[rawURL] = true
+
+		endpointURL, err := url.Parse(rawURL)
+		if err != nil || (endpointURL.Scheme != "http" && endpointURL.Scheme != "https") || endpointURL.Host == "" {
+			return nil, fmt.Errorf("invalid Portainer URL %q", rawURL)
+		}
+
+		pool.endpoints = append(pool.endpoints, &serverEndpoint{url: endpointURL})
+	}
+
+	pool.active = pool.endpoints[0]
+
+	return pool, nil
+}
+
+// candidates returns the endpoints in the order they are attempted: the endpoints that can be attempted by priority,
+// then the endpoints waiting for their retry delay by the end of the delay so that a request is attempted even
+// when all the endpoints failed recently
+func (pool *endpointPool) candidates(now time.Time) []*serverEndpoint {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	var available, waiting []*serverEndpoint
+	for _, endpoint := range pool.endpoints {
+		if endpoint.retryAt.After(now) {
+			waiting = append(waiting, endpoint)
+
+			continue
+		}
+
+		available = append(available, endpoint)
+	}
+
+	sort.SliceStable(waiting, func(i, j int) bool { return waiting[i].retryAt.Before(waiting[j].retryAt) })
+
+	return append(available, waiting...)
+}
+
+func (pool *endpointPool) markHealthy(endpoint *serverEndpoint) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	endpoint.failures = 0
+	endpoint.retryAt = time.Time{}
+
+	if pool.active != endpoint {
+		log.Warn().Str("from", pool.active.url.String()).Str("to", endpoint.url.String()).Msg("switching to another URL of the Portainer instance")
+
+		pool.active = endpoint
+	}
+}
+
+func (pool *endpointPool) markFailed(endpoint *serverEndpoint, now time.Time, err error) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	endpoint.failures++
+
+	delay := failoverMinRetryDelay
+	for i := 1; i < endpoint.failures && delay < failoverMaxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > failoverMaxRetryDelay {
+		delay = failoverMaxRetryDelay
+	}
+
+	endpoint.retryAt = now.Add(delay)
+
+	log.Debug().Str("url", endpoint.url.String()).Int("failures", endpoint.failures).Dur("retry_in", delay).Err(err).Msg("the Portainer URL is unavailable")
+}
+
+// rewrite returns the URL of the request for endpoint, the base URL prefix is replaced with the endpoint URL
+func (pool *endpointPool) rewrite(requestURL *url.URL, endpoint *serverEndpoint) *url.URL {
+	rewritten := *requestURL
+	if requestURL.Scheme != pool.base.Scheme || requestURL.Host != pool.base.Host {
+		return &rewritten
+	}
+
+	rewritten.Scheme = endpoint.url.Scheme
+	rewritten.Host = endpoint.url.Host
+	rewritten.Path = endpoint.url.Path + strings.TrimPrefix(requestURL.Path, pool.base.Path)
+	rewritten.RawPath = ""
+
+	return &rewritten
+}
+
+// ActiveURL returns the URL of the Portainer instance the requests are currently sent to
+func (pool *endpointPool) ActiveURL() string {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	return pool.active.url.String()
+}
+
+// endpointUnavailable returns true when the response of an endpoint shows that the instance behind it cannot serve the
+// requests, the proxies in front of a stopped instance answer with these codes
+func endpointUnavailable(statusCode int) bool {
+	return statusCode == http.StatusBadGateway || statusCode == http.StatusServiceUnavailable || statusCode == http.StatusGatewayTimeout
+}
+
+// doWithFailover sends req to the endpoints of the pool until one of them answers, send is the function sending a
+// request to a single endpoint
+func (pool *endpointPool) doWithFailover(req *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	candidates := pool.candidates(time.Now())
+
+	var lastErr error
+	for i, endpoint := range candidates {
+		attempt := req.Clone(req.Context())
+		attempt.URL = pool.rewrite(req.URL, endpoint)
+		attempt.Host = ""
+
+		if i > 0 && req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				// the body was consumed by the previous attempt
+				break
+			}
+
+			body, err := req.GetBody()
+			if err != nil {
+				break
+			}
+
+			attempt.Body = body
+		}
+
+		resp, err := send(attempt)
+
+		switch {
+		case err != nil && req.Context().Err() != nil:
+			return nil, err
+		case err != nil:
+			lastErr = err
+		case endpointUnavailable(resp.StatusCode) && i < len(candidates)-1:
+			resp.Body.Close()
+			lastErr = fmt.Errorf("the Portainer instance answered with status %d", resp.StatusCode)
+		case endpointUnavailable(resp.StatusCode):
+			pool.markFailed(endpoint, time.Now(), fmt.Errorf("the Portainer instance answered with status %d", resp.StatusCode))
+
+			return resp, nil
+		default:
+			pool.markHealthy(endpoint)
+
+			return resp, nil
+		}
+
+		pool.markFailed(endpoint, time.Now(), lastErr)
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("no Portainer URL is available")
+	}
+
+	return nil, lastErr
+}
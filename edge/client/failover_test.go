@@ -0,0 +1,108 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestEndpointPoolRewrite(t *testing.T) {
+	pool, err := newEndpointPool("https://portainer.example.com", []string{"https://dr.example.com/portainer/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://portainer.example.com/api/endpoints/edge/async?full=true", nil)
+
+	rewritten := pool.rewrite(req.URL, pool.endpoints[0])
+	if rewritten.String() != "https://dr.example.com/portainer/api/endpoints/edge/async?full=true" {
+		t.Errorf("unexpected rewritten URL %s", rewritten)
+	}
+
+	if len(pool.endpoints) != 2 || pool.endpoints[1].url.String() != "https://portainer.example.com" {
+		t.Errorf("expected the URL of the key to be attempted last, got %d endpoints", len(pool.endpoints))
+	}
+}
+
+func TestEndpointPoolFailover(t *testing.T) {
+	pool, err := newEndpointPool("https://primary.example.com", []string{"https://primary.example.com", "https://dr.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	primaryDown := true
+	var hosts []string
+	send := func(req *http.Request) (*http.Response, error) {
+		hosts = append(hosts, req.URL.Host)
+
+		body, _ := io.ReadAll(req.Body)
+		if string(body) != "snapshot" {
+			t.Errorf("expected the body to be sent to %s, got %q", req.URL.Host, body)
+		}
+
+		if req.URL.Host == "primary.example.com" && primaryDown {
+			return nil, errors.New("connection refused")
+		}
+
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	}
+
+	do := func() {
+		req, _ := http.NewRequest(http.MethodPost, "https://primary.example.com/api/endpoints/edge/async", bytes.NewReader([]byte("snapshot")))
+
+		if _, err := pool.doWithFailover(req, send); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	do()
+	if pool.ActiveURL() != "https://dr.example.com" {
+		t.Errorf("expected to fail over to the DR URL, got %s", pool.ActiveURL())
+	}
+
+	// the primary URL is skipped during its retry delay
+	hosts = nil
+	do()
+	if len(hosts) != 1 || hosts[0] != "dr.example.com" {
+		t.Errorf("expected the request to be sent to the DR URL only, got %v", hosts)
+	}
+
+	// the primary URL is attempted again once its retry delay elapsed
+	primaryDown = false
+	pool.endpoints[0].retryAt = time.Now().Add(-time.Second)
+	do()
+	if pool.ActiveURL() != "https://primary.example.com" {
+		t.Errorf("expected to return to the primary URL, got %s", pool.ActiveURL())
+	}
+}
+
+func TestEndpointPoolRetryDelay(t *testing.T) {
+	pool, err := newEndpointPool("https://primary.example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	endpoint := pool.endpoints[0]
+
+	for _, expected := range []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute} {
+		pool.markFailed(endpoint, now, errors.New("timeout"))
+
+		if delay := endpoint.retryAt.Sub(now); delay != expected {
+			t.Errorf("expected a retry delay of %s after %d failures, got %s", expected, endpoint.failures, delay)
+		}
+	}
+
+	if candidates := pool.candidates(now); len(candidates) != 1 {
+		t.Errorf("expected the failed endpoint to be attempted when no other endpoint is available, got %d", len(candidates))
+	}
+}
+
+func TestNewEndpointPoolInvalidURL(t *testing.T) {
+	if _, err := newEndpointPool("https://primary.example.com", []string{"dr.example.com"}); err == nil {
+		t.Error("expected an URL without scheme to be rejected")
+	}
+}
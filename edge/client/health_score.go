@@ -0,0 +1,44 @@
+package client
+
+import (
+	"time"
+
+	"github.com/portainer/agent/healthscore"
+	"github.com/portainer/agent/kubernetes"
+)
+
+// healthScore returns the health score of the environment, computed from inputs completed with the sections of s,
+// the connectivity to the server and the time of the last snapshot it received
+func (client *PortainerAsyncClient) healthScore(inputs healthscore.Inputs, s *snapshot) *healthscore.Score {
+	if summary := s.KubernetesSummary; summary != nil {
+		for _, workloads := range []kubernetes.WorkloadCount{summary.Deployments, summary.StatefulSets, summary.DaemonSets} {
+			inputs.Workloads += workloads.Total
+			inputs.UnhealthyWorkloads += workloads.Total - workloads.Ready
+		}
+	}
+
+	if s.HostInventory != nil {
+		for _, partition := range s.HostInventory.Partitions {
+			inputs.PartitionsUsedPercent = append(inputs.PartitionsUsedPercent, partition.UsedPercent)
+		}
+	}
+
+	for _, disk := range s.Disks {
+		if disk.Passed != nil && !*disk.Passed {
+			inputs.FailingDisks++
+		} else if len(disk.Warnings) > 0 {
+			inputs.WarningDisks++
+		}
+	}
+
+	if status := CurrentConnectivity(); status.State != "" && status.State != ConnectivityOK {
+		inputs.Disconnected = true
+		inputs.DisconnectedSince = status.Since
+	}
+
+	inputs.LastSnapshot = client.lastSnapshotTime
+	inputs.SnapshotInterval = client.lastAsyncResponse.SnapshotInterval
+	inputs.Alerts = len(s.Diagnostics)
+
+	return healthscore.Compute(inputs, time.Now())
+}
@@ -67,6 +67,11 @@ type PollStatusResponse struct {
 	Credentials        string                               `json:"credentials"`
 	Stacks             []StackStatus                        `json:"stacks"`
 	EdgeConfigurations map[EdgeConfigID]EdgeConfigStateType `json:"edge_configurations"`
+	// Collectors enables or disables the snapshot collectors, nil when the server does not manage them
+	Collectors map[string]bool `json:"collectors"`
+	// StackPriorityClasses are the priority classes of the stacks by stack name, nil when the server does not manage
+	// them
+	StackPriorityClasses map[string]string `json:"stackPriorityClasses"`
 
 	// Async mode only
 	EndpointID       int            `json:"endpointID"`
@@ -74,6 +79,7 @@ type PollStatusResponse struct {
 	SnapshotInterval time.Duration  `json:"snapshotInterval"`
 	CommandInterval  time.Duration  `json:"commandInterval"`
 	AsyncCommands    []AsyncCommand `json:"commands"`
+	ServerTime       time.Time      `json:"-"`
 }
 
 type StackStatus struct {
@@ -87,9 +93,9 @@ type setEndpointIDFn func(portainer.EndpointID)
 type getEndpointIDFn func() portainer.EndpointID
 
 // NewPortainerClient returns a pointer to a new PortainerClient instance
-func NewPortainerClient(serverAddress string, setEIDFn setEndpointIDFn, getEIDFn getEndpointIDFn, edgeID string, edgeAsyncMode bool, agentPlatform agent.ContainerPlatform, metaFields agent.EdgeMetaFields, httpClient *edgeHTTPClient) PortainerClient {
+func NewPortainerClient(serverAddress string, setEIDFn setEndpointIDFn, getEIDFn getEndpointIDFn, edgeID string, edgeAsyncMode, snapshotDelta bool, agentPlatform agent.ContainerPlatform, metaFields agent.EdgeMetaFields, httpClient *edgeHTTPClient, clusterService agent.ClusterService) PortainerClient {
 	if edgeAsyncMode {
-		return NewPortainerAsyncClient(serverAddress, setEIDFn, getEIDFn, edgeID, agentPlatform, metaFields, httpClient)
+		return NewPortainerAsyncClient(serverAddress, setEIDFn, getEIDFn, edgeID, agentPlatform, metaFields, httpClient, clusterService, snapshotDelta)
 	}
 
 	return NewPortainerEdgeClient(serverAddress, setEIDFn, getEIDFn, edgeID, agentPlatform, metaFields, httpClient)
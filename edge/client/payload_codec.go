@@ -0,0 +1,79 @@
+package client
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/portainer/agent/codec"
+	"github.com/rs/zerolog/log"
+)
+
+// payloadNegotiation selects the codec of the payloads of the Edge Async mode. The preferred codec is requested with
+// the Accept header and is used for the requests once the server answered with it, so that the agent keeps sending
+// JSON to the servers that do not support it. A server rejecting the media type of a request returns the agent to
+// JSON until it answers with the preferred codec again.
+type payloadNegotiation struct {
+	preferred codec.Codec
+	accepted  atomic.Bool
+}
+
+// newPayloadNegotiation returns the negotiation of the codec named format, nil when JSON is preferred
+func newPayloadNegotiation(format string) *payloadNegotiation {
+	if format == "" || format == codec.JSON {
+		return nil
+	}
+
+	preferred, err := codec.Get(format)
+	if err != nil {
+		log.Warn().Err(err).Msg("the payloads of the Edge Async mode are encoded in JSON")
+
+		return nil
+	}
+
+	return &payloadNegotiation{preferred: preferred}
+}
+
+// requestCodec returns the codec of the next request
+func (n *payloadNegotiation) requestCodec() codec.Codec {
+	if n == nil || !n.accepted.Load() {
+		return codec.Default()
+	}
+
+	return n.preferred
+}
+
+// setRequestHeaders sets the Accept header and the media type of a request encoded with c, contentTypeHeader is the
+// header of the media type of the body
+func (n *payloadNegotiation) setRequestHeaders(req *http.Request, c codec.Codec, contentTypeHeader string) {
+	if n == nil {
+		return
+	}
+
+	req.Header.Set("Accept", codec.Accept(n.preferred))
+
+	if c.Name() != codec.JSON {
+		req.Header.Set(contentTypeHeader, c.ContentType())
+	}
+}
+
+// responseCodec returns the codec of the media type of a response, JSON when it is unknown. The preferred codec is
+// used for the next requests once the server answered with it.
+func (n *payloadNegotiation) responseCodec(contentType string) codec.Codec {
+	c := codec.ForContentType(contentType)
+	if c == nil {
+		return codec.Default()
+	}
+
+	if n != nil && c.Name() == n.preferred.Name() && !n.accepted.Swap(true) {
+		log.Info().Str("format", c.Name()).Msg("the Portainer server accepts the payloads of the Edge Async mode in a binary format")
+	}
+
+	return c
+}
+
+// rejected returns the agent to JSON after the server rejected the media type of a request
+func (n *payloadNegotiation) rejected() {
+	if n != nil && n.accepted.Swap(false) {
+		log.Warn().Str("format", n.preferred.Name()).Msg("the Portainer server rejected the format of the payloads, sending JSON")
+	}
+}
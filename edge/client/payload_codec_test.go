@@ -0,0 +1,63 @@
+package client
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/portainer/agent/codec"
+)
+
+func TestPayloadNegotiation(t *testing.T) {
+	n := newPayloadNegotiation(codec.MessagePack)
+
+	if c := n.requestCodec(); c.Name() != codec.JSON {
+		t.Fatalf("expected JSON before the server answered in the preferred format, got %s", c.Name())
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "https://portainer.example.com/api/endpoints/edge/async", nil)
+	n.setRequestHeaders(req, n.requestCodec(), "Content-Type")
+
+	if req.Header.Get("Accept") != "application/msgpack, application/json;q=0.5" {
+		t.Fatalf("unexpected Accept header: %s", req.Header.Get("Accept"))
+	}
+
+	if req.Header.Get("Content-Type") != "" {
+		t.Fatal("expected no media type for a JSON request")
+	}
+
+	if c := n.responseCodec("application/json"); c.Name() != codec.JSON || n.requestCodec().Name() != codec.JSON {
+		t.Fatal("expected a JSON response to keep the requests in JSON")
+	}
+
+	if c := n.responseCodec("application/msgpack"); c.Name() != codec.MessagePack {
+		t.Fatalf("expected the response to be decoded with the MessagePack codec, got %s", c.Name())
+	}
+
+	if c := n.requestCodec(); c.Name() != codec.MessagePack {
+		t.Fatalf("expected the requests to use the format the server answered with, got %s", c.Name())
+	}
+
+	n.rejected()
+
+	if c := n.requestCodec(); c.Name() != codec.JSON {
+		t.Fatalf("expected JSON after the server rejected the format, got %s", c.Name())
+	}
+}
+
+func TestPayloadNegotiationDisabled(t *testing.T) {
+	n := newPayloadNegotiation(codec.JSON)
+	if n != nil {
+		t.Fatal("expected no negotiation when JSON is preferred")
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "https://portainer.example.com/api/endpoints/edge/async", nil)
+	n.setRequestHeaders(req, n.requestCodec(), "Content-Type")
+
+	if req.Header.Get("Accept") != "" {
+		t.Fatal("expected the requests to be unchanged when JSON is preferred")
+	}
+
+	if c := n.responseCodec(""); c.Name() != codec.JSON {
+		t.Fatalf("expected a response without media type to be decoded as JSON, got %s", c.Name())
+	}
+}
@@ -3,11 +3,14 @@ package client
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"hash/fnv"
+	"io"
 	"net/http"
+	"slices"
 	"sort"
 	"strconv"
 	"sync"
@@ -15,14 +18,44 @@ import (
 
 	"github.com/docker/docker/api/types"
 	"github.com/portainer/agent"
+	"github.com/portainer/agent/anomaly"
+	"github.com/portainer/agent/codec"
+	"github.com/portainer/agent/crypto"
+	"github.com/portainer/agent/discovery"
 	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/drift"
+	"github.com/portainer/agent/healthscore"
+	"github.com/portainer/agent/hooks"
+	"github.com/portainer/agent/hostaction"
+	"github.com/portainer/agent/imagecache"
+	"github.com/portainer/agent/inventory"
+	"github.com/portainer/agent/journal"
+	"github.com/portainer/agent/kernellog"
 	"github.com/portainer/agent/kubernetes"
+	"github.com/portainer/agent/memory"
+	agentnet "github.com/portainer/agent/net"
+	"github.com/portainer/agent/netpolicy"
+	"github.com/portainer/agent/osupdate"
+	"github.com/portainer/agent/overlay"
+	"github.com/portainer/agent/posture"
+	"github.com/portainer/agent/power"
+	"github.com/portainer/agent/probe"
+	"github.com/portainer/agent/relay"
+	"github.com/portainer/agent/sbom"
+	"github.com/portainer/agent/smart"
+	"github.com/portainer/agent/storage"
+	"github.com/portainer/agent/systemd"
+	"github.com/portainer/agent/thermal"
+	"github.com/portainer/agent/wasm"
 	portainer "github.com/portainer/portainer/api"
 	"github.com/portainer/portainer/api/edge"
 	"github.com/rs/zerolog/log"
 	"github.com/wI2L/jsondiff"
 )
 
+// maxAsyncResponseSize is the maximum size of the encrypted responses of the Portainer server
+const maxAsyncResponseSize = 32 << 20
+
 // PortainerAsyncClient is used to execute HTTP requests using only the /api/entrypoint/async api endpoint
 type PortainerAsyncClient struct {
 	httpClient              *edgeHTTPClient
@@ -33,18 +66,36 @@ type PortainerAsyncClient struct {
 	agentPlatformIdentifier agent.ContainerPlatform
 	commandTimestamp        *time.Time
 	metaFields              agent.EdgeMetaFields
+	clusterService          agent.ClusterService
+	snapshotDelta           bool
+	payloadNegotiation      *payloadNegotiation
 
 	lastAsyncResponse AsyncResponse
 	lastSnapshot      snapshot
+	// acknowledgedState is the state described by the last snapshot received by the server in delta mode
+	acknowledgedState *snapshotState
 	nextSnapshot      snapshot
 	nextSnapshotMutex sync.Mutex
 	snapshotRetried   bool
+	// lastSnapshotTime is the time of the last snapshot received by the server
+	lastSnapshotTime time.Time
 
 	stackLogCollectionQueue []LogCommandData
+
+	// pendingDataStore persists the pending data while the server cannot be reached, nil when it is not persisted
+	pendingDataStore PendingDataStore
+	pendingPersisted bool
+}
+
+// PendingDataStore persists the data waiting to be sent to the Portainer server, so that the statuses and results
+// produced while the server cannot be reached survive a restart of the agent
+type PendingDataStore interface {
+	SavePendingData(data []byte) error
+	LoadPendingData() ([]byte, error)
 }
 
 // NewPortainerAsyncClient returns a pointer to a new PortainerAsyncClient instance
-func NewPortainerAsyncClient(serverAddress string, setEIDFn setEndpointIDFn, getEIDFn getEndpointIDFn, edgeID string, containerPlatform agent.ContainerPlatform, metaFields agent.EdgeMetaFields, httpClient *edgeHTTPClient) *PortainerAsyncClient {
+func NewPortainerAsyncClient(serverAddress string, setEIDFn setEndpointIDFn, getEIDFn getEndpointIDFn, edgeID string, containerPlatform agent.ContainerPlatform, metaFields agent.EdgeMetaFields, httpClient *edgeHTTPClient, clusterService agent.ClusterService, snapshotDelta bool) *PortainerAsyncClient {
 	initialCommandTimestamp := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
 	return &PortainerAsyncClient{
 		serverAddress:           serverAddress,
@@ -55,6 +106,9 @@ func NewPortainerAsyncClient(serverAddress string, setEIDFn setEndpointIDFn, get
 		agentPlatformIdentifier: containerPlatform,
 		commandTimestamp:        &initialCommandTimestamp,
 		metaFields:              metaFields,
+		clusterService:          clusterService,
+		snapshotDelta:           snapshotDelta,
+		payloadNegotiation:      newPayloadNegotiation(httpClient.options.EdgePayloadFormat),
 	}
 }
 
@@ -90,15 +144,71 @@ type snapshot struct {
 	Docker      *portainer.DockerSnapshot `json:"docker,omitempty"`
 	DockerPatch jsondiff.Patch            `json:"dockerPatch,omitempty"`
 	DockerHash  *uint32                   `json:"dockerHash,omitempty"`
+	DockerDelta *dockerSnapshotDelta      `json:"dockerDelta,omitempty"`
 
 	Kubernetes      *portainer.KubernetesSnapshot `json:"kubernetes,omitempty"`
 	KubernetesPatch jsondiff.Patch                `json:"kubernetesPatch,omitempty"`
 	KubernetesHash  *uint32                       `json:"kubernetesHash,omitempty"`
+	// KubernetesSummary is sent in full with every snapshot, it is not covered by the patch
+	KubernetesSummary *kubernetes.ClusterSummary `json:"kubernetesSummary,omitempty"`
+	// KubernetesPolicies is sent in full with every snapshot, it is not covered by the patch
+	KubernetesPolicies *kubernetes.PolicyReport `json:"kubernetesPolicies,omitempty"`
+	// KubernetesRestarts is sent in full with every snapshot, it is not covered by the patch
+	KubernetesRestarts *kubernetes.PodRestartReport `json:"kubernetesRestarts,omitempty"`
+	// KubernetesVolumes is sent in full with every snapshot, it is not covered by the patch
+	KubernetesVolumes *kubernetes.VolumeUsageReport `json:"kubernetesVolumes,omitempty"`
+	// KubernetesControlPlane is sent in full with every snapshot, it is not covered by the patch
+	KubernetesControlPlane *kubernetes.ControlPlaneHealth `json:"kubernetesControlPlane,omitempty"`
+	// KubernetesDistribution is sent in full with every snapshot, it is not covered by the patch
+	KubernetesDistribution *kubernetes.Distribution `json:"kubernetesDistribution,omitempty"`
 
 	StackLogs        []EdgeStackLog                                                  `json:"stackLogs,omitempty"`
 	StackStatusArray map[portainer.EdgeStackID][]portainer.EdgeStackDeploymentStatus `json:"stackStatusArray,omitempty"`
 	JobsStatus       map[portainer.EdgeJobID]agent.EdgeJobStatus                     `json:"jobsStatus,omitempty"`
 	EdgeConfigStates map[EdgeConfigID]EdgeConfigStateType                            `json:"edgeConfigStates,omitempty"`
+
+	DependencyGraph *docker.DependencyGraph    `json:"dependencyGraph,omitempty"`
+	ContainerStats  *docker.ContainerStats     `json:"containerStats,omitempty"`
+	LogAudit        *docker.LogAudit           `json:"logAudit,omitempty"`
+	GPUs            *docker.GPUInventory       `json:"gpus,omitempty"`
+	Devices         *docker.DeviceInventory    `json:"devices,omitempty"`
+	BaseImages      []docker.BaseImage         `json:"baseImages,omitempty"`
+	ImageScans      *docker.ImageScanReport    `json:"imageScans,omitempty"`
+	BandwidthUsage  *agentnet.BandwidthReport  `json:"bandwidthUsage,omitempty"`
+	OSUpdate        *osupdate.Status           `json:"osUpdate,omitempty"`
+	HostInventory   *inventory.HostInventory   `json:"hostInventory,omitempty"`
+	VirtualMachines []inventory.VirtualMachine `json:"virtualMachines,omitempty"`
+	StackDrift      []drift.StackDrift         `json:"stackDrift,omitempty"`
+	Probes          []probe.Result             `json:"probes,omitempty"`
+	StartFailures   []docker.StackStartFailure `json:"startFailures,omitempty"`
+	SystemdUnits    []systemd.UnitStatus       `json:"systemdUnits,omitempty"`
+	OverlayNetworks []overlay.Network          `json:"overlayNetworks,omitempty"`
+	SBOMs           []sbom.Result              `json:"sboms,omitempty"`
+	StorageDriver   *storage.Report            `json:"storageDriver,omitempty"`
+	Disks           []smart.Disk               `json:"disks,omitempty"`
+	Thermal         *thermal.Report            `json:"thermal,omitempty"`
+	Memory          *memory.Report             `json:"memory,omitempty"`
+	ImageCache      *imagecache.Report         `json:"imageCache,omitempty"`
+	Relay           *relay.Report              `json:"relay,omitempty"`
+	Power           *power.Report              `json:"power,omitempty"`
+	NetworkPolicy   *netpolicy.Report          `json:"networkPolicy,omitempty"`
+	Posture         *posture.Posture           `json:"posture,omitempty"`
+	KernelAnomalies []kernellog.Anomaly        `json:"kernelAnomalies,omitempty"`
+	LANDevices      *discovery.Report          `json:"lanDevices,omitempty"`
+
+	// Plugins is the data collected by the WebAssembly plugins, by plugin name
+	Plugins map[string]json.RawMessage `json:"plugins,omitempty"`
+
+	// ClusterMembers is the health of the agents of the Swarm cluster, including the ones that left or failed
+	ClusterMembers []agent.ClusterMemberHealth `json:"clusterMembers,omitempty"`
+
+	Diagnostics []string `json:"diagnostics,omitempty"`
+	// HealthScore is sent in full with every snapshot, so that the environments can be sorted by risk
+	HealthScore *healthscore.Score `json:"healthScore,omitempty"`
+
+	// UnchangedSections are the sections omitted because they did not change since the last snapshot received by
+	// the server
+	UnchangedSections []string `json:"unchangedSections,omitempty"`
 }
 
 type AsyncResponse struct {
@@ -109,6 +219,12 @@ type AsyncResponse struct {
 	EndpointID       portainer.EndpointID `json:"endpointID"`
 	Commands         []AsyncCommand       `json:"commands"`
 	NeedFullSnapshot bool                 `json:"needFullSnapshot"`
+	Collectors       map[string]bool      `json:"collectors"`
+
+	StackPriorityClasses map[string]string `json:"stackPriorityClasses"`
+
+	// ServerTime is the time of the server read from the Date header of the response, zero when missing
+	ServerTime time.Time `json:"-"`
 }
 
 type AsyncCommand struct {
@@ -128,6 +244,8 @@ type EdgeJobData struct {
 	CronExpression    string
 	ScriptFileContent string
 	Version           int
+	Interpreter       string
+	Image             string
 }
 
 type LogCommandData struct {
@@ -161,6 +279,45 @@ type NormalStackCommandData struct {
 	StackOperation   string
 }
 
+type OSUpdateCommandData struct {
+	Artifact string
+}
+
+type LogRemediationCommandData struct {
+	ContainerIDs    []string
+	MinSize         int64
+	ApplyLogOptions bool
+}
+
+// ScriptHookCommandData is a scripting hook pushed by the server, the script is only set to add or replace the hook
+type ScriptHookCommandData struct {
+	Name   string
+	Script string
+}
+
+// NetworkPolicyCommandData are the network policies pushed by the server, replacing the previous ones
+type NetworkPolicyCommandData struct {
+	Policies []netpolicy.Policy
+}
+
+type ImageScanCommandData struct {
+	Images  []string
+	Offline bool
+}
+
+type SBOMCommandData struct {
+	Images    []string
+	Format    string
+	UploadURL string
+}
+
+type StackTransactionCommandData struct {
+	TransactionID string
+	// Stack is the version of the stack prepared by the transaction, only its identifier and version are used by
+	// the commit and the abort
+	Stack edge.StackPayload
+}
+
 func (client *PortainerAsyncClient) GetEnvironmentID() (portainer.EndpointID, error) {
 	return 0, errors.New("GetEnvironmentID is not available in async mode")
 }
@@ -181,111 +338,245 @@ func (client *PortainerAsyncClient) GetEnvironmentStatus(flags ...string) (*Poll
 	}
 
 	var currentSnapshot snapshot
+	var currentState *snapshotState
+	var healthInputs healthscore.Inputs
 	if doSnapshot {
 		payload.Snapshot = &snapshot{}
 
 		switch client.agentPlatformIdentifier {
 		case agent.PlatformDocker:
-			dockerSnapshot, err := docker.CreateSnapshot()
+			dockerSnapshot, err := docker.CreateSnapshot(context.Background())
 			if err != nil {
 				log.Warn().Err(err).Msg("could not create the Docker snapshot")
 			}
 
 			optimizeDockerSnapshot(dockerSnapshot)
 
+			if dockerSnapshot != nil {
+				healthInputs.Workloads = dockerSnapshot.RunningContainerCount
+				healthInputs.UnhealthyWorkloads = dockerSnapshot.UnhealthyContainerCount
+			}
+
 			payload.Snapshot.Docker = dockerSnapshot
 			currentSnapshot.Docker = dockerSnapshot
 
-			if client.lastSnapshot.Docker != nil && !client.snapshotRetried {
-				h, ok := snapshotHash(client.lastSnapshot.Docker)
-				if ok {
-					dockerPatch, err := jsondiff.Compare(client.lastSnapshot.Docker, dockerSnapshot)
-					if err == nil {
-						payload.Snapshot.DockerPatch = dockerPatch
-						payload.Snapshot.DockerHash = &h
-						payload.Snapshot.Docker = nil
-					} else {
-						log.Warn().Err(err).Msg("could not generate the Docker snapshot patch")
-					}
-				}
+			dependencyGraph, err := docker.GetDependencyGraph(context.TODO())
+			if err != nil {
+				log.Warn().Err(err).Msg("could not compute the container dependency graph")
 			}
 
-			for _, stack := range client.stackLogCollectionQueue {
-				cs, err := docker.GetContainersWithLabel("com.docker.compose.project=edge_" + stack.EdgeStackName)
-				if err != nil {
-					log.Warn().
-						Str("stack", stack.EdgeStackName).
-						Err(err).
-						Msg("could not retrieve containers for stack")
+			payload.Snapshot.DependencyGraph = dependencyGraph
 
-					continue
-				}
+			containerStats, err := docker.SnapshotStats(context.TODO())
+			if err != nil {
+				log.Warn().Err(err).Msg("could not retrieve the container stats")
+			}
 
-				cs2, err := docker.GetContainersWithLabel("com.docker.stack.namespace=edge_" + stack.EdgeStackName)
-				if err != nil {
-					log.Warn().Err(err).Msg("could not retrieve containers for stack")
+			payload.Snapshot.ContainerStats = containerStats
 
-					continue
+			if docker.CollectorEnabled(docker.CollectorDiskUsage) {
+				logAudit, err := docker.GetLogAudit(context.TODO())
+				if err != nil {
+					log.Warn().Err(err).Msg("could not audit the container logs")
 				}
 
-				cs = append(cs, cs2...)
+				payload.Snapshot.LogAudit = logAudit
+			}
 
-				edgeStackLog := EdgeStackLog{
-					EdgeStackID: stack.EdgeStackID,
-				}
+			gpus, err := docker.GetGPUInventory(context.TODO())
+			if err != nil {
+				log.Warn().Err(err).Msg("could not retrieve the GPU inventory")
+			}
 
-				for _, c := range cs {
-					stdOut, stdErr, err := docker.GetContainerLogs(c.ID, strconv.Itoa(stack.Tail))
-					if err != nil {
-						log.Warn().
-							Str("container_id", c.ID).
-							Err(err).
-							Msg("could not retrieve logs for container")
+			payload.Snapshot.GPUs = gpus
 
-						continue
-					}
+			devices, err := docker.GetDeviceInventory(context.TODO())
+			if err != nil {
+				log.Warn().Err(err).Msg("could not retrieve the device inventory")
+			}
 
-					edgeStackLog.Logs = append(edgeStackLog.Logs, EndpointLog{
-						DockerContainerID: c.ID,
-						StdOut:            string(stdOut),
-						StdErr:            string(stdErr),
-					})
+			payload.Snapshot.Devices = devices
+
+			if docker.CollectorEnabled(docker.CollectorBaseImages) {
+				baseImages, err := docker.GetBaseImages(context.TODO())
+				if err != nil {
+					log.Warn().Err(err).Msg("could not retrieve the base images")
 				}
 
-				if len(edgeStackLog.Logs) > 0 {
-					payload.Snapshot.StackLogs = append(payload.Snapshot.StackLogs, edgeStackLog)
+				payload.Snapshot.BaseImages = baseImages
+			}
+
+			if docker.CollectorEnabled(docker.CollectorSecurityPosture) {
+				imageScans, err := docker.GetImageScanReport(context.TODO())
+				if err != nil {
+					log.Warn().Err(err).Msg("could not retrieve the image scans")
 				}
+
+				payload.Snapshot.ImageScans = imageScans
 			}
 
-		case agent.PlatformKubernetes:
-			kubeSnapshot, err := kubernetes.CreateSnapshot()
-			if err != nil {
-				log.Warn().Err(err).Msg("could not create the Kubernetes snapshot")
+			if docker.CollectorEnabled(docker.CollectorStorageDriver) {
+				storageDriver, err := storage.Collect(context.TODO())
+				if err != nil {
+					log.Warn().Err(err).Msg("could not retrieve the health of the storage driver")
+				}
+
+				payload.Snapshot.StorageDriver = storageDriver
 			}
 
-			payload.Snapshot.Kubernetes = kubeSnapshot
-			currentSnapshot.Kubernetes = kubeSnapshot
+			// In Swarm mode, the snapshots are sent by the agent of the leader node
+			if client.clusterService != nil {
+				payload.Snapshot.ClusterMembers = client.clusterService.MembersHealth()
+			}
 
-			if client.lastSnapshot.Kubernetes != nil && !client.snapshotRetried {
-				h, ok := snapshotHash(client.lastSnapshot.Kubernetes)
+			if client.snapshotDelta && dockerSnapshot != nil {
+				state, err := newSnapshotState(dockerSnapshot, payload.Snapshot)
+				if err != nil {
+					log.Warn().Err(err).Msg("could not generate the Docker snapshot delta")
+				} else {
+					// Only the hashes of the snapshot are kept in delta mode
+					currentState = state
+					currentSnapshot.Docker = nil
+
+					if client.acknowledgedState != nil && !client.snapshotRetried {
+						payload.Snapshot.DockerDelta = client.acknowledgedState.dockerDelta(dockerSnapshot, state)
+						payload.Snapshot.Docker = nil
+					}
+				}
+			} else if client.lastSnapshot.Docker != nil && dockerSnapshot != nil && !client.snapshotRetried {
+				h, ok := snapshotHash(client.lastSnapshot.Docker)
 				if ok {
-					kubePatch, err := jsondiff.Compare(client.lastSnapshot.Docker, kubeSnapshot)
+					dockerPatch, err := jsondiff.Compare(client.lastSnapshot.Docker, dockerSnapshot)
 					if err == nil {
-						payload.Snapshot.KubernetesPatch = kubePatch
-						payload.Snapshot.KubernetesHash = &h
-						payload.Snapshot.KubernetesPatch = nil
+						payload.Snapshot.DockerPatch = dockerPatch
+						payload.Snapshot.DockerHash = &h
+						payload.Snapshot.Docker = nil
 					} else {
-						log.Warn().Err(err).Msg("could not generate the Kubernetes snapshot patch")
+						log.Warn().Err(err).Msg("could not generate the Docker snapshot patch")
 					}
 				}
 			}
+
+			// The Kubernetes cluster running next to the Docker daemon is snapshotted as well
+			if kubernetes.UsesKubeconfig() {
+				client.snapshotKubernetes(payload.Snapshot, &currentSnapshot)
+			}
+
+		case agent.PlatformKubernetes:
+			client.snapshotKubernetes(payload.Snapshot, &currentSnapshot)
 		}
 
-		client.nextSnapshotMutex.Lock()
-		payload.Snapshot.StackStatusArray = client.nextSnapshot.StackStatusArray
-		payload.Snapshot.JobsStatus = client.nextSnapshot.JobsStatus
-		payload.Snapshot.EdgeConfigStates = client.nextSnapshot.EdgeConfigStates
-		client.nextSnapshotMutex.Unlock()
+		payload.Snapshot.BandwidthUsage = agentnet.GetBandwidthReport()
+		payload.Snapshot.OSUpdate = osupdate.CurrentStatus()
+
+		hostInventory, err := inventory.GetHostInventory()
+		if err != nil {
+			log.Warn().Err(err).Msg("could not retrieve the host inventory")
+		}
+
+		payload.Snapshot.HostInventory = hostInventory
+
+		if docker.CollectorEnabled(docker.CollectorVirtualMachines) {
+			vms, err := inventory.GetVirtualMachines()
+			if err != nil {
+				log.Warn().Err(err).Msg("could not retrieve the virtual machines")
+			}
+
+			payload.Snapshot.VirtualMachines = vms
+		}
+
+		payload.Snapshot.StackDrift = drift.Reports()
+		payload.Snapshot.Probes = probe.Results()
+		payload.Snapshot.StartFailures = docker.StartFailures()
+		payload.Snapshot.SBOMs = sbom.Results()
+
+		systemdUnits, err := systemd.CurrentStatus(context.TODO())
+		if err != nil {
+			log.Warn().Err(err).Msg("could not retrieve the status of the systemd units")
+		}
+
+		payload.Snapshot.SystemdUnits = systemdUnits
+
+		if docker.CollectorEnabled(docker.CollectorOverlayNetworks) {
+			payload.Snapshot.OverlayNetworks = overlay.CurrentStatus(context.TODO())
+		}
+
+		if docker.CollectorEnabled(docker.CollectorSMART) {
+			payload.Snapshot.Disks = smart.CurrentStatus(context.TODO())
+		}
+
+		payload.Snapshot.Thermal = thermal.CurrentStatus(context.TODO())
+		payload.Snapshot.Memory = memory.CurrentStatus(context.TODO())
+		payload.Snapshot.ImageCache = imagecache.DefaultCache().Report()
+		payload.Snapshot.Relay = relay.DefaultServer().Report()
+		payload.Snapshot.Power = power.DefaultMonitor().Report()
+		payload.Snapshot.NetworkPolicy = netpolicy.DefaultEnforcer().Report()
+		payload.Snapshot.Posture = posture.Current()
+		payload.Snapshot.Plugins = wasm.DefaultRuntime().Collect(context.TODO())
+
+		if docker.CollectorEnabled(docker.CollectorKernelAnomalies) {
+			payload.Snapshot.KernelAnomalies = kernellog.CurrentStatus(context.TODO())
+		}
+
+		if docker.CollectorEnabled(docker.CollectorLANDevices) {
+			payload.Snapshot.LANDevices = discovery.CurrentStatus(context.TODO())
+		}
+
+		payload.Snapshot.Diagnostics = append(client.versionSkewDiagnostics(), egressDiagnostics()...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, agentnet.BandwidthDiagnostics()...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, hostaction.Diagnostics()...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, journal.Diagnostics()...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, osupdate.Diagnostics()...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, payload.Snapshot.LogAudit.Diagnostics()...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, payload.Snapshot.HostInventory.Diagnostics()...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, payload.Snapshot.Devices.Diagnostics()...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, docker.BaseImageDiagnostics(payload.Snapshot.BaseImages)...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, payload.Snapshot.StorageDriver.Diagnostics()...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, drift.Diagnostics()...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, probe.Diagnostics()...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, docker.StartFailureDiagnostics()...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, sbom.Diagnostics()...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, systemd.Diagnostics(systemdUnits)...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, overlay.Diagnostics(payload.Snapshot.OverlayNetworks)...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, smart.Diagnostics(payload.Snapshot.Disks)...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, payload.Snapshot.Thermal.Diagnostics()...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, payload.Snapshot.Memory.Diagnostics()...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, payload.Snapshot.ImageCache.Diagnostics()...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, payload.Snapshot.Relay.Diagnostics()...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, payload.Snapshot.Power.Diagnostics()...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, payload.Snapshot.NetworkPolicy.Diagnostics()...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, payload.Snapshot.Posture.Diagnostics()...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, kernellog.Diagnostics(payload.Snapshot.KernelAnomalies)...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, payload.Snapshot.LANDevices.Diagnostics()...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, clusterMemberDiagnostics(payload.Snapshot.ClusterMembers)...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, ConnectivityDiagnostics()...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, anomaly.Diagnostics()...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, wasm.DefaultRuntime().Diagnostics()...)
+		payload.Snapshot.Diagnostics = append(payload.Snapshot.Diagnostics, hooks.DefaultEngine().Diagnostics()...)
+
+		payload.Snapshot.HealthScore = client.healthScore(healthInputs, payload.Snapshot)
+
+		if currentState != nil && client.acknowledgedState != nil && !client.snapshotRetried {
+			client.acknowledgedState.omitUnchangedSections(payload.Snapshot, currentState)
+		}
+
+		if runtime := wasm.DefaultRuntime(); runtime.Transforms() {
+			payload.Snapshot = transformSnapshot(runtime, payload.Snapshot)
+		}
+	}
+
+	// The pending stack statuses, job results, configuration states and stack logs are piggybacked on every
+	// poll request, including the ones only fetching commands, instead of waiting for the next snapshot
+	pending := client.takePendingData()
+	if !pending.isEmpty() {
+		if payload.Snapshot == nil {
+			payload.Snapshot = &snapshot{}
+		}
+
+		payload.Snapshot.StackStatusArray = pending.stackStatuses
+		payload.Snapshot.JobsStatus = pending.jobsStatus
+		payload.Snapshot.EdgeConfigStates = pending.edgeConfigStates
+		payload.Snapshot.StackLogs = client.collectStackLogs(pending.stackLogCommands)
 	}
 
 	if doCommand {
@@ -302,9 +593,14 @@ func (client *PortainerAsyncClient) GetEnvironmentStatus(flags ...string) (*Poll
 
 	asyncResponse, err := client.executeAsyncRequest(payload, pollURL)
 	if err != nil {
+		client.restorePendingData(pending)
+		client.persistPendingData()
+
 		return nil, err
 	}
 
+	client.persistPendingData()
+
 	if doSnapshot && asyncResponse.NeedFullSnapshot && !client.snapshotRetried {
 		log.Debug().Msg("retrying with full snapshot")
 		client.snapshotRetried = true
@@ -315,22 +611,26 @@ func (client *PortainerAsyncClient) GetEnvironmentStatus(flags ...string) (*Poll
 		}
 	} else if doSnapshot {
 		client.snapshotRetried = false
+		client.lastSnapshotTime = time.Now()
 
 		client.lastSnapshot.Docker = currentSnapshot.Docker
 		client.lastSnapshot.Kubernetes = currentSnapshot.Kubernetes
+		client.acknowledgedState = currentState
+	} else if asyncResponse.NeedFullSnapshot {
+		// The server requested a full resync outside of a snapshot, the next snapshot is sent in full
+		log.Debug().Msg("full snapshot requested by the server")
+
+		client.lastSnapshot.Docker = nil
+		client.lastSnapshot.Kubernetes = nil
+		client.acknowledgedState = nil
+	}
 
-		if client.lastSnapshot.StackStatusArray == nil {
-			client.lastSnapshot.StackStatusArray = make(map[portainer.EdgeStackID][]portainer.EdgeStackDeploymentStatus)
-		}
-
-		for k, v := range client.nextSnapshot.StackStatusArray {
-			client.lastSnapshot.StackStatusArray[k] = v
-		}
+	if client.lastSnapshot.StackStatusArray == nil {
+		client.lastSnapshot.StackStatusArray = make(map[portainer.EdgeStackID][]portainer.EdgeStackDeploymentStatus)
+	}
 
-		client.nextSnapshot.StackStatusArray = nil
-		client.nextSnapshot.JobsStatus = nil
-		client.nextSnapshot.EdgeConfigStates = nil
-		client.stackLogCollectionQueue = nil
+	for k, v := range pending.stackStatuses {
+		client.lastSnapshot.StackStatusArray[k] = v
 	}
 
 	client.setEndpointIDFn(asyncResponse.EndpointID)
@@ -340,6 +640,10 @@ func (client *PortainerAsyncClient) GetEnvironmentStatus(flags ...string) (*Poll
 		PingInterval:     asyncResponse.PingInterval,
 		SnapshotInterval: asyncResponse.SnapshotInterval,
 		CommandInterval:  asyncResponse.CommandInterval,
+		Collectors:       asyncResponse.Collectors,
+		ServerTime:       asyncResponse.ServerTime,
+
+		StackPriorityClasses: asyncResponse.StackPriorityClasses,
 	}
 
 	client.lastAsyncResponse = *asyncResponse
@@ -347,58 +651,409 @@ func (client *PortainerAsyncClient) GetEnvironmentStatus(flags ...string) (*Poll
 	return response, nil
 }
 
-func gzipCompress(data []byte) (*bytes.Buffer, error) {
-	buf := &bytes.Buffer{}
+// pendingData holds the data waiting to be sent to the Portainer server with the next poll request
+type pendingData struct {
+	stackStatuses    map[portainer.EdgeStackID][]portainer.EdgeStackDeploymentStatus
+	jobsStatus       map[portainer.EdgeJobID]agent.EdgeJobStatus
+	edgeConfigStates map[EdgeConfigID]EdgeConfigStateType
+	stackLogCommands []LogCommandData
+}
 
-	gz, err := gzip.NewWriterLevel(buf, gzip.BestCompression)
+// snapshotKubernetes adds the snapshot of the Kubernetes cluster and its reports to s, the snapshot is replaced by
+// a patch of the last acknowledged one when possible
+func (client *PortainerAsyncClient) snapshotKubernetes(s *snapshot, current *snapshot) {
+	kubeSnapshot, err := kubernetes.CreateSnapshot()
 	if err != nil {
-		return nil, err
+		log.Warn().Err(err).Msg("could not create the Kubernetes snapshot")
 	}
 
-	_, err = gz.Write(data)
+	s.Kubernetes = kubeSnapshot
+	current.Kubernetes = kubeSnapshot
+
+	kubeSummary, err := kubernetes.GetClusterSummary(context.TODO())
 	if err != nil {
-		return nil, err
+		log.Warn().Err(err).Msg("could not create the Kubernetes cluster summary")
 	}
 
-	err = gz.Close()
+	s.KubernetesSummary = kubeSummary
+
+	kubePolicies, err := kubernetes.GetPolicyReport(context.TODO())
 	if err != nil {
-		return nil, err
+		log.Warn().Err(err).Msg("could not evaluate the Kubernetes policy checks")
 	}
 
-	return buf, nil
+	s.KubernetesPolicies = kubePolicies
+
+	kubeRestarts, err := kubernetes.GetPodRestartReport(context.TODO())
+	if err != nil {
+		log.Warn().Err(err).Msg("could not create the Kubernetes pod restart report")
+	}
+
+	s.KubernetesRestarts = kubeRestarts
+
+	kubeVolumes, err := kubernetes.GetVolumeUsageReport(context.TODO())
+	if err != nil {
+		log.Warn().Err(err).Msg("could not create the Kubernetes volume usage report")
+	}
+
+	s.KubernetesVolumes = kubeVolumes
+
+	kubeControlPlane, err := kubernetes.GetControlPlaneHealth(context.TODO())
+	if err != nil {
+		log.Warn().Err(err).Msg("could not probe the health of the Kubernetes control plane")
+	}
+
+	s.KubernetesControlPlane = kubeControlPlane
+
+	kubeDistribution, err := kubernetes.GetDistribution(context.TODO())
+	if err != nil {
+		log.Warn().Err(err).Msg("could not detect the Kubernetes distribution")
+	}
+
+	s.KubernetesDistribution = kubeDistribution
+
+	if client.lastSnapshot.Kubernetes != nil && !client.snapshotRetried {
+		h, ok := snapshotHash(client.lastSnapshot.Kubernetes)
+		if ok {
+			kubePatch, err := jsondiff.Compare(client.lastSnapshot.Kubernetes, kubeSnapshot)
+			if err == nil {
+				s.KubernetesPatch = kubePatch
+				s.KubernetesHash = &h
+				s.Kubernetes = nil
+			} else {
+				log.Warn().Err(err).Msg("could not generate the Kubernetes snapshot patch")
+			}
+		}
+	}
 }
 
-func (client *PortainerAsyncClient) executeAsyncRequest(payload AsyncRequest, pollURL string) (*AsyncResponse, error) {
-	data, err := json.Marshal(payload)
+func (pending pendingData) isEmpty() bool {
+	return len(pending.stackStatuses) == 0 && len(pending.jobsStatus) == 0 && len(pending.edgeConfigStates) == 0 && len(pending.stackLogCommands) == 0
+}
+
+// takePendingData removes the pending data from the client so that it can be sent with a poll request
+func (client *PortainerAsyncClient) takePendingData() pendingData {
+	client.nextSnapshotMutex.Lock()
+	defer client.nextSnapshotMutex.Unlock()
+
+	pending := pendingData{
+		stackStatuses:    client.nextSnapshot.StackStatusArray,
+		jobsStatus:       client.nextSnapshot.JobsStatus,
+		edgeConfigStates: client.nextSnapshot.EdgeConfigStates,
+		stackLogCommands: client.stackLogCollectionQueue,
+	}
+
+	client.nextSnapshot.StackStatusArray = nil
+	client.nextSnapshot.JobsStatus = nil
+	client.nextSnapshot.EdgeConfigStates = nil
+	client.stackLogCollectionQueue = nil
+
+	return pending
+}
+
+// restorePendingData puts back the data of a failed poll request, the data added since then takes precedence
+func (client *PortainerAsyncClient) restorePendingData(pending pendingData) {
+	client.nextSnapshotMutex.Lock()
+	defer client.nextSnapshotMutex.Unlock()
+
+	if len(pending.stackStatuses) > 0 && client.nextSnapshot.StackStatusArray == nil {
+		client.nextSnapshot.StackStatusArray = make(map[portainer.EdgeStackID][]portainer.EdgeStackDeploymentStatus)
+	}
+
+	for id, statuses := range pending.stackStatuses {
+		current, ok := client.nextSnapshot.StackStatusArray[id]
+		if ok && len(current) == 0 {
+			// The stack was removed in the meantime
+			continue
+		}
+
+		client.nextSnapshot.StackStatusArray[id] = append(statuses, current...)
+	}
+
+	if len(pending.jobsStatus) > 0 && client.nextSnapshot.JobsStatus == nil {
+		client.nextSnapshot.JobsStatus = make(map[portainer.EdgeJobID]agent.EdgeJobStatus)
+	}
+
+	for id, status := range pending.jobsStatus {
+		if _, ok := client.nextSnapshot.JobsStatus[id]; !ok {
+			client.nextSnapshot.JobsStatus[id] = status
+		}
+	}
+
+	if len(pending.edgeConfigStates) > 0 && client.nextSnapshot.EdgeConfigStates == nil {
+		client.nextSnapshot.EdgeConfigStates = make(map[EdgeConfigID]EdgeConfigStateType)
+	}
+
+	for id, state := range pending.edgeConfigStates {
+		if _, ok := client.nextSnapshot.EdgeConfigStates[id]; !ok {
+			client.nextSnapshot.EdgeConfigStates[id] = state
+		}
+	}
+
+	// the logs of a stack requested again in the meantime are only collected once, with the newer command
+	queue := make([]LogCommandData, 0, len(pending.stackLogCommands)+len(client.stackLogCollectionQueue))
+	for _, cmd := range pending.stackLogCommands {
+		if !slices.ContainsFunc(client.stackLogCollectionQueue, func(queued LogCommandData) bool {
+			return queued.EdgeStackID == cmd.EdgeStackID
+		}) {
+			queue = append(queue, cmd)
+		}
+	}
+
+	client.stackLogCollectionQueue = append(queue, client.stackLogCollectionQueue...)
+}
+
+// persistedPendingData is the representation of the pending data in the PendingDataStore
+type persistedPendingData struct {
+	StackStatuses    map[portainer.EdgeStackID][]portainer.EdgeStackDeploymentStatus `json:"stackStatuses,omitempty"`
+	JobsStatus       map[portainer.EdgeJobID]agent.EdgeJobStatus                     `json:"jobsStatus,omitempty"`
+	EdgeConfigStates map[EdgeConfigID]EdgeConfigStateType                            `json:"edgeConfigStates,omitempty"`
+	StackLogCommands []LogCommandData                                                `json:"stackLogCommands,omitempty"`
+}
+
+// SetPendingDataStore persists the pending data in store from now on, the data persisted by the previous run of
+// the agent is restored to be sent with the next poll request
+func (client *PortainerAsyncClient) SetPendingDataStore(store PendingDataStore) error {
+	data, err := store.LoadPendingData()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	var buf *bytes.Buffer
-	if payload.Snapshot != nil {
-		buf, err = gzipCompress(data)
+	client.pendingDataStore = store
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	var persisted persistedPendingData
+	if err := json.Unmarshal(data, &persisted); err != nil {
+		return err
+	}
+
+	client.restorePendingData(pendingData{
+		stackStatuses:    persisted.StackStatuses,
+		jobsStatus:       persisted.JobsStatus,
+		edgeConfigStates: persisted.EdgeConfigStates,
+		stackLogCommands: persisted.StackLogCommands,
+	})
+	client.pendingPersisted = true
+
+	return nil
+}
+
+// persistPendingData saves the data waiting to be sent to the server in the PendingDataStore, the store is only
+// written when there is pending data or when the data it holds was sent
+func (client *PortainerAsyncClient) persistPendingData() {
+	if client.pendingDataStore == nil {
+		return
+	}
+
+	client.nextSnapshotMutex.Lock()
+	persisted := persistedPendingData{
+		StackStatuses:    client.nextSnapshot.StackStatusArray,
+		JobsStatus:       client.nextSnapshot.JobsStatus,
+		EdgeConfigStates: client.nextSnapshot.EdgeConfigStates,
+		StackLogCommands: client.stackLogCollectionQueue,
+	}
+
+	var data []byte
+	var err error
+	empty := len(persisted.StackStatuses) == 0 && len(persisted.JobsStatus) == 0 && len(persisted.EdgeConfigStates) == 0 && len(persisted.StackLogCommands) == 0
+	if !empty {
+		data, err = json.Marshal(persisted)
+	}
+	client.nextSnapshotMutex.Unlock()
+
+	if err != nil {
+		log.Warn().Err(err).Msg("unable to encode the pending data")
+
+		return
+	}
+
+	if empty && !client.pendingPersisted {
+		return
+	}
+
+	if err := client.pendingDataStore.SavePendingData(data); err != nil {
+		log.Warn().Err(err).Msg("unable to persist the pending data")
+
+		return
+	}
+
+	client.pendingPersisted = !empty
+}
+
+// the Docker calls of the collection of the stack logs, replaced in the tests
+var (
+	getContainersWithLabel = docker.GetContainersWithLabel
+	getContainerLogs       = docker.GetContainerLogs
+)
+
+// collectStackLogs retrieves the logs of the containers of the requested Edge stacks
+func (client *PortainerAsyncClient) collectStackLogs(commands []LogCommandData) []EdgeStackLog {
+	if len(commands) == 0 || client.agentPlatformIdentifier != agent.PlatformDocker {
+		return nil
+	}
+
+	var stackLogs []EdgeStackLog
+
+	for _, stack := range commands {
+		cs, err := getContainersWithLabel("com.docker.compose.project=edge_" + stack.EdgeStackName)
+		if err != nil {
+			log.Warn().
+				Str("stack", stack.EdgeStackName).
+				Err(err).
+				Msg("could not retrieve containers for stack")
+
+			continue
+		}
+
+		cs2, err := getContainersWithLabel("com.docker.stack.namespace=edge_" + stack.EdgeStackName)
+		if err != nil {
+			log.Warn().Err(err).Msg("could not retrieve containers for stack")
+
+			continue
+		}
+
+		cs = append(cs, cs2...)
+
+		edgeStackLog := EdgeStackLog{
+			EdgeStackID: stack.EdgeStackID,
+		}
+
+		for _, c := range cs {
+			stdOut, stdErr, err := getContainerLogs(c.ID, strconv.Itoa(stack.Tail))
+			if err != nil {
+				log.Warn().
+					Str("container_id", c.ID).
+					Err(err).
+					Msg("could not retrieve logs for container")
+
+				continue
+			}
+
+			edgeStackLog.Logs = append(edgeStackLog.Logs, EndpointLog{
+				DockerContainerID: c.ID,
+				StdOut:            string(stdOut),
+				StdErr:            string(stdErr),
+			})
+		}
+
+		if len(edgeStackLog.Logs) > 0 {
+			stackLogs = append(stackLogs, edgeStackLog)
+		}
+	}
+
+	return stackLogs
+}
+
+// maxAsyncRequestSize bounds the size of the encoded async requests, the relays of the sites read the whole body of
+// the requests up to the same size to verify their signature
+var maxAsyncRequestSize = relay.MaxBodySize
+
+// encodeAsyncRequest returns the payload encoded with c, gzip compressed when it contains a snapshot and encrypted
+// when payloadCipher is not nil. The payload is compressed and encrypted as it is encoded, only the resulting body is
+// held in memory, up to maxAsyncRequestSize bytes, so that it can be hashed by the relay signature and sent again to
+// another URL of the Portainer instance.
+func encodeAsyncRequest(payload AsyncRequest, c codec.Codec, payloadCipher *crypto.PayloadCipher) ([]byte, error) {
+	pr, pw := io.Pipe()
+	encodeErrCh := make(chan error, 1)
+
+	go func() {
+		err := writeAsyncRequest(pw, payload, c)
+		pw.CloseWithError(err)
+		encodeErrCh <- err
+	}()
+
+	// The payload references data shared with the rest of the client, make sure it is not read anymore once
+	// the body is built
+	defer func() {
+		pr.Close()
+		<-encodeErrCh
+	}()
+
+	var r io.Reader = pr
+	if payloadCipher != nil {
+		sealed, err := payloadCipher.SealReader(pr)
 		if err != nil {
 			return nil, err
 		}
-	} else {
-		buf = bytes.NewBuffer(data)
+
+		r = sealed
 	}
 
-	req, err := http.NewRequest("POST", pollURL, buf)
+	body, err := io.ReadAll(io.LimitReader(r, int64(maxAsyncRequestSize)+1))
 	if err != nil {
 		return nil, err
 	}
 
+	if len(body) > maxAsyncRequestSize {
+		return nil, fmt.Errorf("the async request exceeds %d bytes", maxAsyncRequestSize)
+	}
+
+	return body, nil
+}
+
+func writeAsyncRequest(w io.Writer, payload AsyncRequest, c codec.Codec) error {
+	if payload.Snapshot == nil {
+		return c.Encode(w, payload)
+	}
+
+	gz, err := gzip.NewWriterLevel(w, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+
+	err = c.Encode(gz, payload)
+	if err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+func (client *PortainerAsyncClient) executeAsyncRequest(payload AsyncRequest, pollURL string) (*AsyncResponse, error) {
+	requestCodec := client.payloadNegotiation.requestCodec()
+	payloadCipher := client.httpClient.payloadCipher
+
+	body, err := encodeAsyncRequest(payload, requestCodec, payloadCipher)
+	if err != nil {
+		return nil, err
+	}
+
+	// the body can be read again to sign the request for the relay and to fail over to another URL
+	req, err := http.NewRequest("POST", pollURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	contentEncodingHeaderName := "Content-Encoding"
+	contentTypeHeaderName := "Content-Type"
+	if payloadCipher != nil {
+		contentEncodingHeaderName = agent.HTTPPayloadContentEncodingHeaderName
+		contentTypeHeaderName = agent.HTTPPayloadContentTypeHeaderName
+
+		req.Header.Set("Content-Type", "application/octet-stream")
+		req.Header.Set(agent.HTTPPayloadEncryptionHeaderName, crypto.PayloadEncryptionNaClBoxStream)
+		req.Header.Set(agent.HTTPPayloadPublicKeyHeaderName, payloadCipher.PublicKey())
+	}
+
 	if payload.Snapshot != nil {
-		req.Header.Set("Content-Encoding", "gzip")
+		req.Header.Set(contentEncodingHeaderName, "gzip")
 	}
 
+	client.payloadNegotiation.setRequestHeaders(req, requestCodec, contentTypeHeaderName)
+
 	req.Header.Set(agent.HTTPEdgeIdentifierHeaderName, client.edgeID)
 	req.Header.Set(agent.HTTPResponseAgentHeaderName, agent.Version)
 	req.Header.Set(agent.HTTPResponseAgentTimeZone, time.Local.String())
 	req.Header.Set(agent.HTTPResponseUpdateIDHeaderName, strconv.Itoa(client.metaFields.UpdateID))
 	req.Header.Set(agent.HTTPResponseAgentPlatform, strconv.Itoa(int(client.agentPlatformIdentifier)))
 
+	if client.agentPlatformIdentifier == agent.PlatformDocker {
+		req.Header.Set(agent.HTTPResponseAgentRuntime, docker.CurrentRuntime().Name())
+	}
+
 	log.Debug().
 		Str(agent.HTTPEdgeIdentifierHeaderName, client.edgeID).
 		Int(agent.HTTPResponseUpdateIDHeaderName, (client.metaFields.UpdateID)).
@@ -413,6 +1068,12 @@ func (client *PortainerAsyncClient) executeAsyncRequest(payload AsyncRequest, po
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusUnsupportedMediaType && requestCodec.Name() != codec.JSON {
+		client.payloadNegotiation.rejected()
+
+		return nil, fmt.Errorf("the Portainer server does not support the %s format", requestCodec.Name())
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		errorData := parseError(resp)
 		logError(resp, errorData)
@@ -424,15 +1085,61 @@ func (client *PortainerAsyncClient) executeAsyncRequest(payload AsyncRequest, po
 		return nil, errors.New("short poll request failed")
 	}
 
+	var respBody io.Reader = resp.Body
+	if payloadCipher != nil {
+		respBody, err = openAsyncResponse(payloadCipher, resp)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	responseCodec := client.payloadNegotiation.responseCodec(resp.Header.Get(contentTypeHeaderName))
+
 	var asyncResponse AsyncResponse
-	err = json.NewDecoder(resp.Body).Decode(&asyncResponse)
+	err = responseCodec.Decode(respBody, &asyncResponse)
 	if err != nil {
 		return nil, err
 	}
 
+	if serverTime, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		asyncResponse.ServerTime = serverTime
+	}
+
 	return &asyncResponse, nil
 }
 
+// transformSnapshot returns the snapshot transformed by the WebAssembly plugins, the fields of the transformed
+// snapshot unknown to the agent are dropped. The snapshot is returned as is when it cannot be transformed.
+func transformSnapshot(runtime *wasm.Runtime, s *snapshot) *snapshot {
+	document, err := json.Marshal(s)
+	if err != nil {
+		log.Warn().Err(err).Msg("could not encode the snapshot for the WebAssembly plugins")
+
+		return s
+	}
+
+	var transformed snapshot
+	err = json.Unmarshal(runtime.Transform(context.TODO(), document), &transformed)
+	if err != nil {
+		log.Warn().Err(err).Msg("could not decode the snapshot transformed by the WebAssembly plugins")
+
+		return s
+	}
+
+	return &transformed
+}
+
+// openAsyncResponse returns the response body decrypted as it is read, up to maxAsyncResponseSize bytes. The
+// unencrypted responses are refused, so that the commands cannot be altered by a proxy between the agent and the
+// server.
+func openAsyncResponse(payloadCipher *crypto.PayloadCipher, resp *http.Response) (io.Reader, error) {
+	if resp.Header.Get(agent.HTTPPayloadEncryptionHeaderName) != crypto.PayloadEncryptionNaClBoxStream {
+		return nil, errors.New("the response of the server is not encrypted")
+	}
+
+	return payloadCipher.OpenReader(io.LimitReader(resp.Body, maxAsyncResponseSize)), nil
+}
+
 // SetEdgeStackStatus updates the status of an Edge stack on the Portainer server
 func (client *PortainerAsyncClient) SetEdgeStackStatus(edgeStackID int, edgeStackStatus portainer.EdgeStackStatusType, rollbackTo *int, err string) error {
 	client.nextSnapshotMutex.Lock()
@@ -550,3 +1257,52 @@ func optimizeDockerSnapshot(s *portainer.DockerSnapshot) {
 		})
 	}
 }
+
+// egressDiagnostics returns a diagnostic message for each host the agent was denied to connect to by the egress
+// allowlist
+func egressDiagnostics() []string {
+	var diagnostics []string
+	for _, violation := range agentnet.EgressViolations() {
+		diagnostics = append(diagnostics, fmt.Sprintf("egress denied: %d connection attempts to %s, last at %s", violation.Count, violation.Address, violation.LastSeen.UTC().Format(time.RFC3339)))
+	}
+
+	return diagnostics
+}
+
+// clusterMemberDiagnostics returns a diagnostic message for each cluster member that cannot be reached
+func clusterMemberDiagnostics(members []agent.ClusterMemberHealth) []string {
+	var diagnostics []string
+	for _, member := range members {
+		if member.Reachable {
+			continue
+		}
+
+		lastSeen := "never"
+		if !member.LastSeen.IsZero() {
+			lastSeen = member.LastSeen.UTC().Format(time.RFC3339)
+		}
+
+		diagnostics = append(diagnostics, fmt.Sprintf("cluster member unreachable: the agent of node %s is %s, last seen at %s", member.NodeName, member.Status, lastSeen))
+	}
+
+	return diagnostics
+}
+
+// versionSkewDiagnostics returns a diagnostic message for each cluster member running a different agent version
+func (client *PortainerAsyncClient) versionSkewDiagnostics() []string {
+	if client.clusterService == nil {
+		return nil
+	}
+
+	var diagnostics []string
+	for _, member := range client.clusterService.GetMismatchedVersionMembers() {
+		version := member.Version
+		if version == "" {
+			version = "unknown"
+		}
+
+		diagnostics = append(diagnostics, fmt.Sprintf("agent version mismatch: node %s runs version %s, expected %s", member.NodeName, version, agent.Version))
+	}
+
+	return diagnostics
+}
@@ -0,0 +1,396 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/codec"
+	"github.com/portainer/agent/crypto"
+	"github.com/portainer/agent/relay"
+	portainer "github.com/portainer/portainer/api"
+
+	"github.com/docker/docker/api/types"
+)
+
+const testRelaySecret = "site-secret"
+
+// decodeAsyncRequest decodes a body built by encodeAsyncRequest, like the Portainer server
+func decodeAsyncRequest(t *testing.T, body []byte, c codec.Codec, compressed bool, payloadCipher *crypto.PayloadCipher) AsyncRequest {
+	t.Helper()
+
+	var r io.Reader = bytes.NewReader(body)
+	if payloadCipher != nil {
+		r = payloadCipher.OpenReader(r)
+	}
+
+	if compressed {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer gz.Close()
+
+		r = gz
+	}
+
+	var payload AsyncRequest
+	if err := c.Decode(r, &payload); err != nil {
+		t.Fatal(err)
+	}
+
+	return payload
+}
+
+// newTestPayloadCiphers returns the cipher of the agent and the cipher of the server decrypting its payloads
+func newTestPayloadCiphers(t *testing.T) (*crypto.PayloadCipher, *crypto.PayloadCipher) {
+	t.Helper()
+
+	dir := t.TempDir()
+	serverKeyPath := filepath.Join(dir, "server.json")
+
+	// the key pair of the server is generated first to get its public key
+	server, err := crypto.LoadOrCreatePayloadCipher(serverKeyPath, base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := crypto.LoadOrCreatePayloadCipher(filepath.Join(dir, "agent.json"), server.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err = crypto.LoadOrCreatePayloadCipher(serverKeyPath, client.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client, server
+}
+
+func TestEncodeAsyncRequest(t *testing.T) {
+	clientCipher, serverCipher := newTestPayloadCiphers(t)
+	hash := uint32(42)
+
+	tests := []struct {
+		name     string
+		codec    string
+		snapshot *snapshot
+		cipher   bool
+	}{
+		{name: "json", codec: codec.JSON},
+		{name: "json with snapshot", codec: codec.JSON, snapshot: &snapshot{DockerHash: &hash}},
+		{name: "msgpack with snapshot", codec: codec.MessagePack, snapshot: &snapshot{DockerHash: &hash}},
+		{name: "encrypted", codec: codec.JSON, cipher: true},
+		{name: "encrypted with snapshot", codec: codec.MessagePack, snapshot: &snapshot{DockerHash: &hash}, cipher: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := codec.Get(tt.codec)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var sealCipher, openCipher *crypto.PayloadCipher
+			if tt.cipher {
+				sealCipher, openCipher = clientCipher, serverCipher
+			}
+
+			body, err := encodeAsyncRequest(AsyncRequest{EndpointId: 3, Snapshot: tt.snapshot}, c, sealCipher)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			payload := decodeAsyncRequest(t, body, c, tt.snapshot != nil, openCipher)
+			if payload.EndpointId != 3 {
+				t.Errorf("expected the endpoint 3, got %d", payload.EndpointId)
+			}
+
+			if tt.snapshot != nil && (payload.Snapshot == nil || payload.Snapshot.DockerHash == nil || *payload.Snapshot.DockerHash != hash) {
+				t.Errorf("expected the snapshot to be decoded, got %+v", payload.Snapshot)
+			}
+		})
+	}
+}
+
+func TestEncodeAsyncRequestTooLarge(t *testing.T) {
+	defer func(size int) { maxAsyncRequestSize = size }(maxAsyncRequestSize)
+	maxAsyncRequestSize = 16
+
+	_, err := encodeAsyncRequest(AsyncRequest{EndpointId: 3, MetaFields: &MetaFields{TagsIDs: []int{1, 2, 3, 4, 5}}}, codec.Default(), nil)
+	if err == nil || !strings.Contains(err.Error(), "exceeds 16 bytes") {
+		t.Errorf("expected the request to be rejected, got %v", err)
+	}
+}
+
+// bodyRecorder records the bodies of the requests it receives
+type bodyRecorder struct {
+	mu     sync.Mutex
+	bodies []string
+}
+
+func (r *bodyRecorder) record(req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	r.bodies = append(r.bodies, string(body))
+	r.mu.Unlock()
+}
+
+func (r *bodyRecorder) received() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.bodies...)
+}
+
+// forwarderFunc relays the requests of a relay server
+type forwarderFunc func(req *http.Request) (*http.Response, error)
+
+func (f forwarderFunc) Relay(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestSendAsyncRequestFailover(t *testing.T) {
+	c, err := codec.Get(codec.JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := uint32(42)
+	body, err := encodeAsyncRequest(AsyncRequest{EndpointId: 3, Snapshot: &snapshot{DockerHash: &hash}}, c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		relay bool
+	}{
+		{name: "direct"},
+		{name: "through the relay", relay: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primaryBodies := &bodyRecorder{}
+			primary := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				primaryBodies.record(r)
+				rw.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer primary.Close()
+
+			secondaryBodies := &bodyRecorder{}
+			var secondary http.Handler = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				secondaryBodies.record(r)
+			})
+
+			options := &agent.Options{}
+			if tt.relay {
+				options.RelaySecret = testRelaySecret
+
+				// the relay verifies the signature of the hop, which covers the body, before it forwards the request
+				relayServer := relay.NewServer("gateway", testRelaySecret, time.Minute)
+				err := relayServer.SetUpstream("https://portainer.example.com", forwarderFunc(func(req *http.Request) (*http.Response, error) {
+					secondaryBodies.record(req)
+
+					return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Header: http.Header{}}, nil
+				}))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				secondary = relayServer
+			}
+
+			secondaryServer := httptest.NewServer(secondary)
+			defer secondaryServer.Close()
+
+			edgeClient := &edgeHTTPClient{httpClient: &http.Client{}, options: options}
+
+			err := edgeClient.EnableFailover(primary.URL, []string{primary.URL, secondaryServer.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequest(http.MethodPost, primary.URL+"/api/endpoints/edge/async", bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set(agent.HTTPEdgeIdentifierHeaderName, "edge-id")
+
+			resp, err := edgeClient.send(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected the request to be sent to the secondary URL, got %d", resp.StatusCode)
+			}
+
+			if received := primaryBodies.received(); len(received) != 1 || received[0] != string(body) {
+				t.Errorf("expected the primary URL to receive the whole body once, got %d requests", len(received))
+			}
+
+			if received := secondaryBodies.received(); len(received) != 1 || received[0] != string(body) {
+				t.Errorf("expected the secondary URL to receive the whole body once, got %d requests", len(received))
+			}
+		})
+	}
+}
+
+func stackStatusTypes(statuses []portainer.EdgeStackDeploymentStatus) []portainer.EdgeStackStatusType {
+	statusTypes := make([]portainer.EdgeStackStatusType, 0, len(statuses))
+	for _, status := range statuses {
+		statusTypes = append(statusTypes, status.Type)
+	}
+
+	return statusTypes
+}
+
+func TestRestorePendingData(t *testing.T) {
+	client := &PortainerAsyncClient{}
+
+	client.SetEdgeStackStatus(1, portainer.EdgeStackStatusError, nil, "failed")
+	client.SetEdgeStackStatus(2, portainer.EdgeStackStatusRunning, nil, "")
+	client.SetEdgeJobStatus(agent.EdgeJobStatus{JobID: 1, LogFileContent: "old"})
+	client.SetEdgeConfigState(1, EdgeConfigSavingState)
+	client.EnqueueLogCollectionForStack(LogCommandData{EdgeStackID: 1, EdgeStackName: "web", Tail: 10})
+	client.EnqueueLogCollectionForStack(LogCommandData{EdgeStackID: 2, EdgeStackName: "db", Tail: 20})
+
+	pending := client.takePendingData()
+	if pending.isEmpty() {
+		t.Fatal("expected the pending data to be taken")
+	}
+
+	if taken := client.takePendingData(); !taken.isEmpty() {
+		t.Fatalf("expected the pending data to be removed from the client, got %+v", taken)
+	}
+
+	// the data added while the poll request is sent
+	client.SetEdgeStackStatus(1, portainer.EdgeStackStatusRunning, nil, "")
+	client.SetEdgeStackStatus(2, portainer.EdgeStackStatusRemoved, nil, "")
+	client.SetEdgeJobStatus(agent.EdgeJobStatus{JobID: 1, LogFileContent: "new"})
+	client.SetEdgeJobStatus(agent.EdgeJobStatus{JobID: 2, LogFileContent: "other"})
+	client.SetEdgeConfigState(1, EdgeConfigIdleState)
+	client.EnqueueLogCollectionForStack(LogCommandData{EdgeStackID: 2, EdgeStackName: "db", Tail: 50})
+	client.EnqueueLogCollectionForStack(LogCommandData{EdgeStackID: 3, EdgeStackName: "cache", Tail: 30})
+
+	client.restorePendingData(pending)
+
+	// a second failed poll request puts back the same data
+	client.restorePendingData(client.takePendingData())
+
+	expectedStatuses := map[portainer.EdgeStackID][]portainer.EdgeStackStatusType{
+		1: {portainer.EdgeStackStatusError, portainer.EdgeStackStatusRunning},
+		2: {},
+	}
+
+	statuses := client.nextSnapshot.StackStatusArray
+	if len(statuses) != len(expectedStatuses) {
+		t.Errorf("expected %d stacks, got %d", len(expectedStatuses), len(statuses))
+	}
+
+	for id, expected := range expectedStatuses {
+		if statusTypes := stackStatusTypes(statuses[id]); !reflect.DeepEqual(statusTypes, expected) {
+			t.Errorf("expected the statuses %v for the stack %d, got %v", expected, id, statusTypes)
+		}
+	}
+
+	jobs := client.nextSnapshot.JobsStatus
+	if len(jobs) != 2 || jobs[1].LogFileContent != "new" || jobs[2].LogFileContent != "other" {
+		t.Errorf("expected the newer job statuses to be kept, got %+v", jobs)
+	}
+
+	states := client.nextSnapshot.EdgeConfigStates
+	if len(states) != 1 || states[1] != EdgeConfigIdleState {
+		t.Errorf("expected the newer configuration state to be kept, got %v", states)
+	}
+
+	expectedCommands := []LogCommandData{
+		{EdgeStackID: 1, EdgeStackName: "web", Tail: 10},
+		{EdgeStackID: 2, EdgeStackName: "db", Tail: 50},
+		{EdgeStackID: 3, EdgeStackName: "cache", Tail: 30},
+	}
+
+	if !reflect.DeepEqual(client.stackLogCollectionQueue, expectedCommands) {
+		t.Errorf("expected the log commands %+v, got %+v", expectedCommands, client.stackLogCollectionQueue)
+	}
+}
+
+func TestCollectStackLogs(t *testing.T) {
+	defer func(list func(string) ([]types.Container, error), logs func(string, string) ([]byte, []byte, error)) {
+		getContainersWithLabel, getContainerLogs = list, logs
+	}(getContainersWithLabel, getContainerLogs)
+
+	containers := map[string][]types.Container{
+		"com.docker.compose.project=edge_web":  {{ID: "web-1"}, {ID: "web-2"}},
+		"com.docker.stack.namespace=edge_web":  {{ID: "web-service"}},
+		"com.docker.compose.project=edge_idle": {{ID: "idle-1"}},
+	}
+
+	getContainersWithLabel = func(label string) ([]types.Container, error) {
+		if label == "com.docker.compose.project=edge_broken" {
+			return nil, errors.New("the daemon cannot be reached")
+		}
+
+		return containers[label], nil
+	}
+
+	var tails []string
+	getContainerLogs = func(id string, tail string) ([]byte, []byte, error) {
+		tails = append(tails, tail)
+
+		if id == "web-2" || id == "idle-1" {
+			return nil, nil, errors.New("no such container")
+		}
+
+		return []byte("out " + id), []byte("err " + id), nil
+	}
+
+	commands := []LogCommandData{
+		{EdgeStackID: 1, EdgeStackName: "web", Tail: 10},
+		{EdgeStackID: 2, EdgeStackName: "broken", Tail: 10},
+		{EdgeStackID: 3, EdgeStackName: "idle", Tail: 10},
+		{EdgeStackID: 4, EdgeStackName: "missing", Tail: 10},
+	}
+
+	client := &PortainerAsyncClient{agentPlatformIdentifier: agent.PlatformDocker}
+
+	expected := []EdgeStackLog{{
+		EdgeStackID: 1,
+		Logs: []EndpointLog{
+			{DockerContainerID: "web-1", StdOut: "out web-1", StdErr: "err web-1"},
+			{DockerContainerID: "web-service", StdOut: "out web-service", StdErr: "err web-service"},
+		},
+	}}
+
+	if logs := client.collectStackLogs(commands); !reflect.DeepEqual(logs, expected) {
+		t.Errorf("expected the logs %+v, got %+v", expected, logs)
+	}
+
+	for _, tail := range tails {
+		if tail != "10" {
+			t.Errorf("expected the logs to be tailed to 10 lines, got %s", tail)
+		}
+	}
+
+	// the logs of the stacks are only collected on Docker
+	client.agentPlatformIdentifier = agent.PlatformKubernetes
+	if logs := client.collectStackLogs(commands); logs != nil {
+		t.Errorf("expected no logs outside of Docker, got %+v", logs)
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"time"
 
 	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/schema"
 	portainer "github.com/portainer/portainer/api"
 	"github.com/portainer/portainer/api/edge"
 
@@ -154,6 +156,10 @@ func (client *PortainerEdgeClient) GetEnvironmentStatus(flags ...string) (*PollS
 	req.Header.Set(agent.HTTPResponseAgentPlatform, strconv.Itoa(int(client.agentPlatform)))
 	log.Debug().Int("header", int(client.agentPlatform)).Msg("sending agent platform header")
 
+	if client.agentPlatform == agent.PlatformDocker {
+		req.Header.Set(agent.HTTPResponseAgentRuntime, docker.CurrentRuntime().Name())
+	}
+
 	req.Header.Set(agent.HTTPResponseUpdateIDHeaderName, strconv.Itoa(client.metaFields.UpdateID))
 
 	resp, err := client.httpClient.Do(req)
@@ -216,8 +222,19 @@ func (client *PortainerEdgeClient) GetEdgeStackConfig(edgeStackID int, version *
 		return nil, errors.New("GetEdgeStackConfig operation failed")
 	}
 
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// the configuration of the stack is the value of the edgeStack commands of the Edge Async mode
+	err = schema.Validate(schema.CommandSchema("edgeStack"), body)
+	if err != nil {
+		return nil, err
+	}
+
 	var data edge.StackPayload
-	err = json.NewDecoder(resp.Body).Decode(&data)
+	err = json.Unmarshal(body, &data)
 	if err != nil {
 		return nil, err
 	}
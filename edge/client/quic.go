@@ -0,0 +1,161 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	agentnet "github.com/portainer/agent/net"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// quicHandshakeTimeout bounds the establishment of a QUIC connection, the request is sent over TCP after it
+	quicHandshakeTimeout = 10 * time.Second
+	// quicDefaultIdleTimeout is the duration after which an idle QUIC connection is closed when no idle connection
+	// timeout is configured
+	quicDefaultIdleTimeout = 90 * time.Second
+	// quicRetryDelay is the duration during which the requests are sent over TCP after QUIC failed
+	quicRetryDelay = 5 * time.Minute
+)
+
+// quicRoundTripper is implemented by http3.RoundTripper
+type quicRoundTripper interface {
+	http.RoundTripper
+	io.Closer
+	CloseIdleConnections()
+}
+
+// quicTransport sends the requests to the Portainer instance over HTTP/3. QUIC recovers from packet loss without
+// blocking the other streams and resumes the TLS sessions in fewer round trips than TCP, which suits the cellular
+// and satellite links. When the instance cannot be reached over QUIC, e.g. when UDP is blocked or the instance does
+// not support HTTP/3, the requests are sent over TCP and QUIC is attempted again after quicRetryDelay.
+type quicTransport struct {
+	quic          quicRoundTripper
+	fallback      *http.Transport
+	mu            sync.Mutex
+	disabledUntil time.Time
+}
+
+func newQUICTransport(fallback *http.Transport, idleTimeout time.Duration) *quicTransport {
+	if idleTimeout <= 0 {
+		idleTimeout = quicDefaultIdleTimeout
+	}
+
+	tlsConfig := fallback.TLSClientConfig.Clone()
+	// the sessions resumed over QUIC must be negotiated over QUIC
+	tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+
+	return &quicTransport{
+		quic: &http3.RoundTripper{
+			TLSClientConfig: tlsConfig,
+			QuicConfig: &quic.Config{
+				HandshakeIdleTimeout: quicHandshakeTimeout,
+				MaxIdleTimeout:       idleTimeout,
+			},
+			// the server name of the TLS configuration is set before dialing, the address can be replaced
+			Dial: func(ctx context.Context, addr string, tlsConfig *tls.Config, config *quic.Config) (quic.EarlyConnection, error) {
+				return quic.DialAddrEarly(ctx, agentnet.ResolveServerAddress(addr), tlsConfig, config)
+			},
+		},
+		fallback: fallback,
+	}
+}
+
+func (transport *quicTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "https" || !transport.quicAvailable() {
+		return transport.fallback.RoundTrip(req)
+	}
+
+	resp, err := transport.quic.RoundTrip(req)
+	if err == nil {
+		// the dialer of the TCP transport is metered, only the payloads are metered over QUIC
+		if req.ContentLength > 0 {
+			agentnet.RecordBandwidth(agentnet.BandwidthSnapshots, int(req.ContentLength), 0)
+		}
+
+		resp.Body = &meteredBody{Reader: agentnet.MeterReceivedReader(agentnet.BandwidthSnapshots, resp.Body), Closer: resp.Body}
+
+		return resp, nil
+	}
+
+	if req.Context().Err() != nil || !quicUnreachable(err) {
+		return nil, err
+	}
+
+	// the body was consumed by the QUIC attempt
+	fallbackReq := req
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, err
+		}
+
+		body, bodyErr := req.GetBody()
+		if bodyErr != nil {
+			return nil, err
+		}
+
+		fallbackReq = req.Clone(req.Context())
+		fallbackReq.Body = body
+	}
+
+	log.Warn().Err(err).Dur("retry_in", quicRetryDelay).Msg("unable to reach the Portainer instance over QUIC, falling back to TCP")
+
+	transport.mu.Lock()
+	transport.disabledUntil = time.Now().Add(quicRetryDelay)
+	transport.mu.Unlock()
+
+	return transport.fallback.RoundTrip(fallbackReq)
+}
+
+func (transport *quicTransport) quicAvailable() bool {
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+
+	return time.Now().After(transport.disabledUntil)
+}
+
+// CloseIdleConnections closes the idle connections of both transports
+func (transport *quicTransport) CloseIdleConnections() {
+	transport.quic.CloseIdleConnections()
+	transport.fallback.CloseIdleConnections()
+}
+
+// Close closes the connections of both transports
+func (transport *quicTransport) Close() error {
+	transport.fallback.CloseIdleConnections()
+
+	return transport.quic.Close()
+}
+
+// quicUnreachable returns true when err reveals that no QUIC connection could be established, the request was then
+// not received by the instance and can be sent again over TCP
+func quicUnreachable(err error) bool {
+	var handshakeErr *quic.HandshakeTimeoutError
+	var versionErr *quic.VersionNegotiationError
+	var transportErr *quic.TransportError
+	var opErr *net.OpError
+
+	switch {
+	case errors.As(err, &handshakeErr), errors.As(err, &versionErr), errors.As(err, &opErr):
+		return true
+	case errors.As(err, &transportErr):
+		// the TLS alerts, e.g. when the instance does not offer the h3 protocol
+		return transportErr.ErrorCode.IsCryptoError() || transportErr.ErrorCode == quic.ConnectionRefused
+	}
+
+	return false
+}
+
+type meteredBody struct {
+	io.Reader
+	io.Closer
+}
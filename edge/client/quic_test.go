@@ -0,0 +1,84 @@
+package client
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/quic-go/quic-go"
+)
+
+type stubQUICRoundTripper struct {
+	err   error
+	calls int
+}
+
+func (rt *stubQUICRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.calls++
+
+	if req.Body != nil {
+		io.Copy(io.Discard, req.Body)
+		req.Body.Close()
+	}
+
+	return nil, rt.err
+}
+
+func (rt *stubQUICRoundTripper) Close() error { return nil }
+
+func (rt *stubQUICRoundTripper) CloseIdleConnections() {}
+
+func TestQUICTransportFallback(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	stub := &stubQUICRoundTripper{err: &quic.HandshakeTimeoutError{}}
+	transport := &quicTransport{quic: stub, fallback: server.Client().Transport.(*http.Transport)}
+	client := &http.Client{Transport: transport}
+
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader([]byte("snapshot")))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("expected the request to be sent over TCP, got %s", err)
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if string(body) != "snapshot" {
+			t.Errorf("expected the body to be sent again over TCP, got %q", body)
+		}
+	}
+
+	if stub.calls != 1 {
+		t.Errorf("expected QUIC to be attempted once before the retry delay, got %d attempts", stub.calls)
+	}
+}
+
+func TestQUICTransportNoFallback(t *testing.T) {
+	stub := &stubQUICRoundTripper{err: &quic.ApplicationError{ErrorCode: 0x102}}
+	transport := &quicTransport{quic: stub, fallback: &http.Transport{}}
+
+	req, err := http.NewRequest(http.MethodPost, "https://portainer.example.com/api", bytes.NewReader([]byte("status")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := transport.RoundTrip(req); err == nil {
+		t.Fatal("expected the error of a request received by the instance to be returned")
+	}
+
+	if !transport.quicAvailable() {
+		t.Error("expected QUIC to stay enabled")
+	}
+}
@@ -0,0 +1,292 @@
+package client
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"sort"
+
+	portainer "github.com/portainer/portainer/api"
+)
+
+// Sections of the snapshot omitted when they did not change since the last snapshot received by the server
+const (
+	sectionDependencyGraph = "dependencyGraph"
+	sectionContainerStats  = "containerStats"
+	sectionLogAudit        = "logAudit"
+	sectionGPUs            = "gpus"
+	sectionDevices         = "devices"
+	sectionBaseImages      = "baseImages"
+	sectionImageScans      = "imageScans"
+	sectionStorageDriver   = "storageDriver"
+)
+
+// Collections of the resources of the Docker snapshots
+const (
+	collectionContainers = "containers"
+	collectionImages     = "images"
+	collectionVolumes    = "volumes"
+	collectionNetworks   = "networks"
+)
+
+// snapshotState is the state of the node described by a snapshot, kept as the hash of each resource and section so
+// that the last snapshot received by the server does not need to be kept in memory
+type snapshotState struct {
+	dockerHash uint32
+	resources  map[string]map[string]uint32
+	sections   map[string]uint32
+}
+
+// dockerSnapshotDelta is the difference between a Docker snapshot and the last snapshot received by the server,
+// identified by its hash. The resources are compared by identifier so that a new container does not shift the
+// other ones, the snapshot itself is sent without the containers, images, volumes and networks.
+type dockerSnapshotDelta struct {
+	BaseHash   uint32                    `json:"baseHash"`
+	Snapshot   *portainer.DockerSnapshot `json:"snapshot"`
+	Containers resourceDelta             `json:"containers"`
+	Images     resourceDelta             `json:"images"`
+	Volumes    resourceDelta             `json:"volumes"`
+	Networks   resourceDelta             `json:"networks"`
+}
+
+// resourceDelta lists the resources of a collection added, changed or removed since the base snapshot. The added
+// and changed resources are sent in full, the removed resources by identifier.
+type resourceDelta struct {
+	Added   []interface{} `json:"added,omitempty"`
+	Changed []interface{} `json:"changed,omitempty"`
+	Removed []string      `json:"removed,omitempty"`
+}
+
+// newSnapshotState returns the state described by the Docker snapshot s and the sections of the snapshot payload
+func newSnapshotState(s *portainer.DockerSnapshot, payload *snapshot) (*snapshotState, error) {
+	dockerHash, err := resourceHash(s)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &snapshotState{
+		dockerHash: dockerHash,
+		resources:  map[string]map[string]uint32{},
+		sections:   map[string]uint32{},
+	}
+
+	for collection, resources := range dockerResources(s) {
+		state.resources[collection], err = resourceHashes(resources)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for name, section := range payloadSections(payload) {
+		state.sections[name], err = resourceHash(section)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return state, nil
+}
+
+// dockerDelta returns the difference between the Docker snapshot current, described by state, and the snapshot
+// described by base
+func (base *snapshotState) dockerDelta(current *portainer.DockerSnapshot, state *snapshotState) *dockerSnapshotDelta {
+	summary := *current
+	summary.SnapshotRaw.Containers = nil
+	summary.SnapshotRaw.Images = nil
+	summary.SnapshotRaw.Volumes.Volumes = nil
+	summary.SnapshotRaw.Networks = nil
+
+	resources := dockerResources(current)
+
+	return &dockerSnapshotDelta{
+		BaseHash:   base.dockerHash,
+		Snapshot:   &summary,
+		Containers: diffResources(base.resources[collectionContainers], state.resources[collectionContainers], resources[collectionContainers]),
+		Images:     diffResources(base.resources[collectionImages], state.resources[collectionImages], resources[collectionImages]),
+		Volumes:    diffResources(base.resources[collectionVolumes], state.resources[collectionVolumes], resources[collectionVolumes]),
+		Networks:   diffResources(base.resources[collectionNetworks], state.resources[collectionNetworks], resources[collectionNetworks]),
+	}
+}
+
+// omitUnchangedSections removes from payload the sections described by state that have the same hash in base, their
+// names are listed in the unchanged sections of the payload so that the server keeps its copy
+func (base *snapshotState) omitUnchangedSections(payload *snapshot, state *snapshotState) {
+	for name, h := range state.sections {
+		if baseHash, ok := base.sections[name]; !ok || baseHash != h {
+			continue
+		}
+
+		payload.UnchangedSections = append(payload.UnchangedSections, name)
+
+		switch name {
+		case sectionDependencyGraph:
+			payload.DependencyGraph = nil
+		case sectionContainerStats:
+			payload.ContainerStats = nil
+		case sectionLogAudit:
+			payload.LogAudit = nil
+		case sectionGPUs:
+			payload.GPUs = nil
+		case sectionDevices:
+			payload.Devices = nil
+		case sectionBaseImages:
+			payload.BaseImages = nil
+		case sectionImageScans:
+			payload.ImageScans = nil
+		case sectionStorageDriver:
+			payload.StorageDriver = nil
+		}
+	}
+
+	sort.Strings(payload.UnchangedSections)
+}
+
+// payloadSections returns the sections of payload that can be omitted, the sections missing from the snapshot are
+// not returned so that their removal is reported to the server
+func payloadSections(payload *snapshot) map[string]interface{} {
+	sections := map[string]interface{}{}
+
+	if payload.DependencyGraph != nil {
+		sections[sectionDependencyGraph] = payload.DependencyGraph
+	}
+
+	if payload.ContainerStats != nil {
+		sections[sectionContainerStats] = payload.ContainerStats
+	}
+
+	if payload.LogAudit != nil {
+		sections[sectionLogAudit] = payload.LogAudit
+	}
+
+	if payload.GPUs != nil {
+		sections[sectionGPUs] = payload.GPUs
+	}
+
+	if payload.Devices != nil {
+		sections[sectionDevices] = payload.Devices
+	}
+
+	if payload.BaseImages != nil {
+		sections[sectionBaseImages] = payload.BaseImages
+	}
+
+	if payload.ImageScans != nil {
+		sections[sectionImageScans] = payload.ImageScans
+	}
+
+	if payload.StorageDriver != nil {
+		sections[sectionStorageDriver] = payload.StorageDriver
+	}
+
+	return sections
+}
+
+// diffResources compares the resources of a collection, current are described by currentHashes, with the resources
+// described by baseHashes
+func diffResources(baseHashes, currentHashes map[string]uint32, current map[string]interface{}) resourceDelta {
+	delta := resourceDelta{}
+
+	for _, key := range sortedKeys(currentHashes) {
+		baseHash, ok := baseHashes[key]
+
+		switch {
+		case !ok:
+			delta.Added = append(delta.Added, current[key])
+		case baseHash != currentHashes[key]:
+			delta.Changed = append(delta.Changed, current[key])
+		}
+	}
+
+	for _, key := range sortedKeys(baseHashes) {
+		if _, ok := currentHashes[key]; !ok {
+			delta.Removed = append(delta.Removed, key)
+		}
+	}
+
+	return delta
+}
+
+func resourceHashes(resources map[string]interface{}) (map[string]uint32, error) {
+	hashes := make(map[string]uint32, len(resources))
+
+	for key, resource := range resources {
+		h, err := resourceHash(resource)
+		if err != nil {
+			return nil, err
+		}
+
+		hashes[key] = h
+	}
+
+	return hashes, nil
+}
+
+// resourceHash returns the hash of the JSON encoding of resource, it matches the hash computed by snapshotHash
+func resourceHash(resource interface{}) (uint32, error) {
+	b, err := json.Marshal(resource)
+	if err != nil {
+		return 0, err
+	}
+
+	h := fnv.New32a()
+	h.Write(b)
+
+	return h.Sum32(), nil
+}
+
+func sortedKeys(hashes map[string]uint32) []string {
+	keys := make([]string, 0, len(hashes))
+	for key := range hashes {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func dockerResources(s *portainer.DockerSnapshot) map[string]map[string]interface{} {
+	return map[string]map[string]interface{}{
+		collectionContainers: containersByID(s),
+		collectionImages:     imagesByID(s),
+		collectionVolumes:    volumesByName(s),
+		collectionNetworks:   networksByID(s),
+	}
+}
+
+func containersByID(s *portainer.DockerSnapshot) map[string]interface{} {
+	resources := make(map[string]interface{}, len(s.SnapshotRaw.Containers))
+	for _, container := range s.SnapshotRaw.Containers {
+		resources[container.ID] = container
+	}
+
+	return resources
+}
+
+func imagesByID(s *portainer.DockerSnapshot) map[string]interface{} {
+	resources := make(map[string]interface{}, len(s.SnapshotRaw.Images))
+	for _, image := range s.SnapshotRaw.Images {
+		resources[image.ID] = image
+	}
+
+	return resources
+}
+
+func volumesByName(s *portainer.DockerSnapshot) map[string]interface{} {
+	resources := make(map[string]interface{}, len(s.SnapshotRaw.Volumes.Volumes))
+	for _, volume := range s.SnapshotRaw.Volumes.Volumes {
+		if volume != nil {
+			resources[volume.Name] = volume
+		}
+	}
+
+	return resources
+}
+
+func networksByID(s *portainer.DockerSnapshot) map[string]interface{} {
+	resources := make(map[string]interface{}, len(s.SnapshotRaw.Networks))
+	for _, network := range s.SnapshotRaw.Networks {
+		resources[network.ID] = network
+	}
+
+	return resources
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/portainer/agent/docker"
+)
+
+func TestDiffResources(t *testing.T) {
+	base := map[string]interface{}{
+		"a": map[string]string{"State": "running"},
+		"b": map[string]string{"State": "running"},
+		"c": map[string]string{"State": "running"},
+	}
+
+	current := map[string]interface{}{
+		"a": map[string]string{"State": "running"},
+		"b": map[string]string{"State": "exited"},
+		"d": map[string]string{"State": "created"},
+	}
+
+	baseHashes, err := resourceHashes(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	currentHashes, err := resourceHashes(current)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	delta := diffResources(baseHashes, currentHashes, current)
+
+	expected := resourceDelta{
+		Added:   []interface{}{current["d"]},
+		Changed: []interface{}{current["b"]},
+		Removed: []string{"c"},
+	}
+
+	if !reflect.DeepEqual(delta, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, delta)
+	}
+}
+
+func TestOmitUnchangedSections(t *testing.T) {
+	sections := func(payload *snapshot) map[string]uint32 {
+		hashes := map[string]uint32{}
+		for name, section := range payloadSections(payload) {
+			h, err := resourceHash(section)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			hashes[name] = h
+		}
+
+		return hashes
+	}
+
+	base := &snapshotState{sections: sections(&snapshot{
+		GPUs:     &docker.GPUInventory{Count: 1},
+		LogAudit: &docker.LogAudit{},
+	})}
+
+	payload := &snapshot{
+		GPUs:           &docker.GPUInventory{Count: 1},
+		ContainerStats: &docker.ContainerStats{},
+	}
+	base.omitUnchangedSections(payload, &snapshotState{sections: sections(payload)})
+
+	if payload.GPUs != nil || payload.ContainerStats == nil {
+		t.Fatal("expected only the unchanged GPU inventory to be omitted")
+	}
+
+	// The log audit removed since the base snapshot must not be reported as unchanged
+	if !reflect.DeepEqual(payload.UnchangedSections, []string{sectionGPUs}) {
+		t.Fatalf("unexpected unchanged sections: %v", payload.UnchangedSections)
+	}
+}
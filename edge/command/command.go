@@ -0,0 +1,114 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/portainer/agent/edge/client"
+	"github.com/portainer/agent/schema"
+)
+
+var (
+	// ErrUnsupportedCommand is returned when no executor is registered for the type of a command
+	ErrUnsupportedCommand = errors.New("command type not supported")
+	// ErrInvalidCommand wraps the validation errors of the commands, processing them again would fail the same way
+	ErrInvalidCommand = errors.New("invalid command")
+)
+
+// Executor executes the commands of one type pushed by the Portainer server. The executors are registered in a
+// Registry, either by the agent or by a plugin.
+type Executor interface {
+	// Type returns the type of the commands handled by the executor
+	Type() string
+	// Validate decodes and validates the command, the command is not executed when an error is returned
+	Validate(cmd client.AsyncCommand) error
+	// Execute executes the command, it must not block for long as the commands are processed sequentially
+	Execute(ctx context.Context, cmd client.AsyncCommand) error
+	// Report is called with the outcome of the validation and the execution of the command, err is nil on success
+	Report(cmd client.AsyncCommand, err error)
+}
+
+// Registry dispatches the commands to the executor registered for their type
+type Registry struct {
+	executors map[string]Executor
+	mu        sync.RWMutex
+}
+
+// NewRegistry returns a pointer to an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		executors: map[string]Executor{},
+	}
+}
+
+// Register registers executor for its command type. An error is returned when an executor is already registered
+// for this type.
+func (registry *Registry) Register(executor Executor) error {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	if _, ok := registry.executors[executor.Type()]; ok {
+		return fmt.Errorf("an executor is already registered for the %s commands", executor.Type())
+	}
+
+	registry.executors[executor.Type()] = executor
+
+	return nil
+}
+
+// Types returns the command types supported by the registered executors, sorted
+func (registry *Registry) Types() []string {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	types := make([]string, 0, len(registry.executors))
+	for commandType := range registry.executors {
+		types = append(types, commandType)
+	}
+	sort.Strings(types)
+
+	return types
+}
+
+// Process validates and executes cmd with the executor registered for its type, then reports the outcome
+func (registry *Registry) Process(ctx context.Context, cmd client.AsyncCommand) error {
+	registry.mu.RLock()
+	executor, ok := registry.executors[cmd.Type]
+	registry.mu.RUnlock()
+
+	if !ok {
+		return ErrUnsupportedCommand
+	}
+
+	err := validateSchema(cmd)
+	if err == nil {
+		err = executor.Validate(cmd)
+	}
+
+	invalid := err != nil
+	if !invalid {
+		err = executor.Execute(ctx, cmd)
+	}
+
+	executor.Report(cmd, err)
+
+	if invalid {
+		return fmt.Errorf("%w: %w", ErrInvalidCommand, err)
+	}
+
+	return err
+}
+
+// validateSchema validates the value of cmd against the schema embedded for its type, the commands handled by the
+// plugins have no schema and are validated by their executor only
+func validateSchema(cmd client.AsyncCommand) error {
+	name := schema.CommandSchema(cmd.Type)
+	if !schema.Has(name) {
+		return nil
+	}
+
+	return schema.Validate(name, cmd.Value)
+}
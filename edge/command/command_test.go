@@ -0,0 +1,125 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/portainer/agent/edge/client"
+	"github.com/portainer/agent/schema"
+)
+
+type fakeExecutor struct {
+	validationErr error
+	executed      bool
+	reported      bool
+	reportedErr   error
+}
+
+func (executor *fakeExecutor) Type() string {
+	return "fake"
+}
+
+func (executor *fakeExecutor) Validate(cmd client.AsyncCommand) error {
+	return executor.validationErr
+}
+
+func (executor *fakeExecutor) Execute(ctx context.Context, cmd client.AsyncCommand) error {
+	executor.executed = true
+
+	return nil
+}
+
+func (executor *fakeExecutor) Report(cmd client.AsyncCommand, err error) {
+	executor.reported = true
+	executor.reportedErr = err
+}
+
+func TestRegistry_Process(t *testing.T) {
+	executor := &fakeExecutor{}
+
+	registry := NewRegistry()
+	if err := registry.Register(executor); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := registry.Register(&fakeExecutor{}); err == nil {
+		t.Fatal("expected the registration of a second executor for the same type to fail")
+	}
+
+	if err := registry.Process(context.Background(), client.AsyncCommand{Type: "unknown"}); !errors.Is(err, ErrUnsupportedCommand) {
+		t.Fatalf("expected ErrUnsupportedCommand, got %v", err)
+	}
+
+	if err := registry.Process(context.Background(), client.AsyncCommand{Type: "fake"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !executor.executed || !executor.reported || executor.reportedErr != nil {
+		t.Fatalf("expected the command to be executed and reported, got %+v", executor)
+	}
+}
+
+func TestRegistry_ProcessInvalidCommand(t *testing.T) {
+	validationErr := errors.New("invalid command")
+	executor := &fakeExecutor{validationErr: validationErr}
+
+	registry := NewRegistry()
+	if err := registry.Register(executor); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := registry.Process(context.Background(), client.AsyncCommand{Type: "fake"}); !errors.Is(err, validationErr) || !errors.Is(err, ErrInvalidCommand) {
+		t.Fatalf("expected the validation error, got %v", err)
+	}
+
+	if executor.executed {
+		t.Fatal("expected an invalid command not to be executed")
+	}
+
+	if !executor.reported || executor.reportedErr != validationErr {
+		t.Fatalf("expected the validation error to be reported, got %v", executor.reportedErr)
+	}
+}
+
+// volumeExecutor is a fake executor of the volume commands, whose value is validated against an embedded schema
+type volumeExecutor struct {
+	fakeExecutor
+}
+
+func (executor *volumeExecutor) Type() string {
+	return "volume"
+}
+
+func TestRegistry_ProcessSchemaValidation(t *testing.T) {
+	executor := &volumeExecutor{}
+
+	registry := NewRegistry()
+	if err := registry.Register(executor); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := client.AsyncCommand{Type: "volume", Value: map[string]any{"VolumeName": "", "VolumeOperation": "delete"}}
+
+	var validationErr *schema.ValidationError
+	if err := registry.Process(context.Background(), cmd); !errors.As(err, &validationErr) || !errors.Is(err, ErrInvalidCommand) {
+		t.Fatalf("expected a schema validation error, got %v", err)
+	}
+
+	if executor.executed {
+		t.Fatal("expected a command not matching its schema not to be executed")
+	}
+
+	if !executor.reported || executor.reportedErr == nil {
+		t.Fatal("expected the schema validation error to be reported")
+	}
+
+	cmd.Value = map[string]any{"VolumeName": "data", "VolumeOperation": "delete", "ForceRemove": true}
+	if err := registry.Process(context.Background(), cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	if !executor.executed {
+		t.Fatal("expected a valid command to be executed")
+	}
+}
@@ -0,0 +1,63 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"plugin"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// PluginSymbol is the name of the function exported by the plugins, its signature must be func() []command.Executor
+const PluginSymbol = "Executors"
+
+// LoadPlugins opens the Go plugins (*.so files) located in dir and registers the executors they provide. The plugins
+// must be built with the same Go version and the same version of the agent module.
+func (registry *Registry) LoadPlugins(dir string) error {
+	if _, err := os.Stat(dir); err != nil {
+		return errors.WithMessage(err, "unable to access the command plugins folder")
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.so"))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		executors, err := openPlugin(path)
+		if err != nil {
+			return errors.WithMessagef(err, "unable to load the command plugin %s", path)
+		}
+
+		for _, executor := range executors {
+			if err := registry.Register(executor); err != nil {
+				return errors.WithMessagef(err, "unable to load the command plugin %s", path)
+			}
+
+			log.Info().Str("plugin", path).Str("type", executor.Type()).Msg("command executor loaded")
+		}
+	}
+
+	return nil
+}
+
+func openPlugin(path string) ([]Executor, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	symbol, err := p.Lookup(PluginSymbol)
+	if err != nil {
+		return nil, err
+	}
+
+	newExecutors, ok := symbol.(func() []Executor)
+	if !ok {
+		return nil, fmt.Errorf("%s must be a func() []command.Executor, got %T", PluginSymbol, symbol)
+	}
+
+	return newExecutors(), nil
+}
@@ -0,0 +1,86 @@
+package command
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent/edge/client"
+)
+
+var (
+	// ErrReplayedCommand is returned for a command that was already processed, or older than the last processed command
+	ErrReplayedCommand = errors.New("the command was already processed")
+	// ErrFutureCommand is returned for a command whose timestamp is ahead of the clock of the server by more than the
+	// tolerated skew
+	ErrFutureCommand = errors.New("the command timestamp is in the future")
+)
+
+// Sequencer tracks the commands processed by the agent so that a command is never processed twice. The timestamps
+// set by the server are used as monotonic nonces: the clock of the device is never compared with them, only the
+// clock of the server as estimated from the last response it sent, so that a device whose clock drifted or was reset
+// while disconnected keeps accepting the commands.
+type Sequencer struct {
+	skewTolerance time.Duration
+
+	mu sync.Mutex
+	// last is the timestamp of the last processed command, and seen the identifiers of the commands processed with
+	// this timestamp
+	last time.Time
+	seen map[int]struct{}
+	// serverTime is the time of the server when observedAt was read from the monotonic clock of the device
+	serverTime time.Time
+	observedAt time.Time
+}
+
+// NewSequencer returns a pointer to a Sequencer accepting the commands stamped at most skewTolerance after the
+// estimated time of the server
+func NewSequencer(skewTolerance time.Duration) *Sequencer {
+	return &Sequencer{
+		skewTolerance: skewTolerance,
+		seen:          map[int]struct{}{},
+	}
+}
+
+// ObserveServerTime records the time of the server, as reported by its last response
+func (sequencer *Sequencer) ObserveServerTime(serverTime time.Time) {
+	sequencer.mu.Lock()
+	defer sequencer.mu.Unlock()
+
+	sequencer.serverTime = serverTime
+	sequencer.observedAt = time.Now()
+}
+
+// Accept returns nil and records cmd when it was not processed yet. ErrReplayedCommand is returned when cmd is older
+// than the last processed command or was already processed, ErrFutureCommand when cmd is stamped too far ahead of the
+// server time so that it can be accepted once the server time is observed again.
+func (sequencer *Sequencer) Accept(cmd client.AsyncCommand) error {
+	sequencer.mu.Lock()
+	defer sequencer.mu.Unlock()
+
+	if cmd.Timestamp.Before(sequencer.last) {
+		return ErrReplayedCommand
+	}
+
+	if cmd.Timestamp.Equal(sequencer.last) {
+		if _, ok := sequencer.seen[cmd.ID]; ok {
+			return ErrReplayedCommand
+		}
+	}
+
+	if !sequencer.serverTime.IsZero() {
+		// time.Since uses the monotonic clock, the estimation is not affected by a change of the wall clock
+		now := sequencer.serverTime.Add(time.Since(sequencer.observedAt))
+		if cmd.Timestamp.After(now.Add(sequencer.skewTolerance)) {
+			return ErrFutureCommand
+		}
+	}
+
+	if !cmd.Timestamp.Equal(sequencer.last) {
+		sequencer.last = cmd.Timestamp
+		sequencer.seen = map[int]struct{}{}
+	}
+	sequencer.seen[cmd.ID] = struct{}{}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package command
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/portainer/agent/edge/client"
+)
+
+func TestSequencer_Accept(t *testing.T) {
+	sequencer := NewSequencer(time.Minute)
+
+	// The server clock is 2 hours behind the clock of the device
+	serverTime := time.Now().Add(-2 * time.Hour)
+	sequencer.ObserveServerTime(serverTime)
+
+	first := client.AsyncCommand{ID: 1, Timestamp: serverTime.Add(-time.Hour)}
+	second := client.AsyncCommand{ID: 2, Timestamp: first.Timestamp}
+	third := client.AsyncCommand{ID: 3, Timestamp: serverTime.Add(30 * time.Second)}
+
+	for _, cmd := range []client.AsyncCommand{first, second, third} {
+		if err := sequencer.Accept(cmd); err != nil {
+			t.Fatalf("expected the command %d to be accepted, got %v", cmd.ID, err)
+		}
+	}
+
+	for _, cmd := range []client.AsyncCommand{first, second, third} {
+		if err := sequencer.Accept(cmd); !errors.Is(err, ErrReplayedCommand) {
+			t.Errorf("expected the command %d to be refused as replayed, got %v", cmd.ID, err)
+		}
+	}
+
+	future := client.AsyncCommand{ID: 4, Timestamp: serverTime.Add(10 * time.Minute)}
+	if err := sequencer.Accept(future); !errors.Is(err, ErrFutureCommand) {
+		t.Fatalf("expected the command to be refused as future, got %v", err)
+	}
+
+	// The command is accepted once the server clock caught up
+	sequencer.ObserveServerTime(serverTime.Add(10 * time.Minute))
+	if err := sequencer.Accept(future); err != nil {
+		t.Fatalf("expected the command to be accepted, got %v", err)
+	}
+}
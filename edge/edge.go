@@ -1,6 +1,7 @@
 package edge
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -8,10 +9,14 @@ import (
 	"time"
 
 	"github.com/portainer/agent"
+	"github.com/portainer/agent/crypto"
 	"github.com/portainer/agent/edge/aws"
 	"github.com/portainer/agent/edge/client"
 	"github.com/portainer/agent/edge/scheduler"
 	"github.com/portainer/agent/edge/stack"
+	"github.com/portainer/agent/identity"
+	"github.com/portainer/agent/relay"
+	"github.com/portainer/agent/spiffe"
 	portainer "github.com/portainer/portainer/api"
 	"github.com/portainer/portainer/api/filesystem"
 
@@ -24,6 +29,9 @@ type (
 		containerPlatform agent.ContainerPlatform
 		advertiseAddr     string
 		agentOptions      *agent.Options
+		identity          *identity.Identity
+		svidSource        *spiffe.X509Source
+		payloadCipher     *crypto.PayloadCipher
 		clusterService    agent.ClusterService
 		dockerInfoService agent.DockerInfoService
 		key               *edgeKey
@@ -40,6 +48,9 @@ type (
 		ClusterService    agent.ClusterService
 		DockerInfoService agent.DockerInfoService
 		ContainerPlatform agent.ContainerPlatform
+		Identity          *identity.Identity
+		SVIDSource        *spiffe.X509Source
+		PayloadCipher     *crypto.PayloadCipher
 	}
 )
 
@@ -55,6 +66,9 @@ func NewManager(parameters *ManagerParameters) *Manager {
 		agentOptions:      parameters.Options,
 		advertiseAddr:     parameters.AdvertiseAddr,
 		containerPlatform: parameters.ContainerPlatform,
+		identity:          parameters.Identity,
+		svidSource:        parameters.SVIDSource,
+		payloadCipher:     parameters.PayloadCipher,
 	}
 }
 
@@ -71,11 +85,16 @@ func (manager *Manager) Start() error {
 		EdgeID:                  manager.agentOptions.EdgeID,
 		PollFrequency:           agent.DefaultEdgePollInterval,
 		InactivityTimeout:       manager.agentOptions.EdgeInactivityTimeout,
+		TunnelGracePeriod:       manager.agentOptions.EdgeTunnelGracePeriod,
 		TunnelCapability:        manager.agentOptions.EdgeTunnel,
+		TunnelTransport:         manager.agentOptions.EdgeTunnelTransport,
 		PortainerURL:            manager.key.PortainerInstanceURL,
 		TunnelServerAddr:        manager.key.TunnelServerAddr,
 		TunnelServerFingerprint: manager.key.TunnelServerFingerprint,
 		ContainerPlatform:       manager.containerPlatform,
+		CommandPluginsPath:      manager.agentOptions.CommandPluginsPath,
+		DataPath:                manager.agentOptions.DataPath,
+		OfflineQueue:            manager.agentOptions.EdgeOfflineQueue,
 	}
 
 	log.Debug().
@@ -85,6 +104,7 @@ func (manager *Manager) Start() error {
 		Str("inactivity_timeout", pollServiceConfig.InactivityTimeout).
 		Bool("insecure_poll", manager.agentOptions.EdgeInsecurePoll).
 		Bool("tunnel_capability", manager.agentOptions.EdgeTunnel).
+		Str("tunnel_transport", manager.agentOptions.EdgeTunnelTransport).
 		Msg("")
 
 	// When the header is not set to PlatformDocker Portainer assumes the platform to be kubernetes.
@@ -94,22 +114,40 @@ func (manager *Manager) Start() error {
 		agentPlatform = agent.PlatformDocker
 	}
 
+	httpClient := client.BuildHTTPClient(30, manager.agentOptions, manager.identity, manager.svidSource, manager.payloadCipher)
+
+	if len(manager.agentOptions.EdgeServerURLs) > 0 {
+		err := httpClient.EnableFailover(manager.key.PortainerInstanceURL, manager.agentOptions.EdgeServerURLs)
+		if err != nil {
+			return fmt.Errorf("unable to use the Portainer URLs: %w", err)
+		}
+	}
+
+	if relayServer := relay.DefaultServer(); relayServer != nil {
+		err := relayServer.SetUpstream(manager.key.PortainerInstanceURL, httpClient)
+		if err != nil {
+			return fmt.Errorf("unable to relay the requests of the peers: %w", err)
+		}
+	}
+
 	portainerClient := client.NewPortainerClient(
 		manager.key.PortainerInstanceURL,
 		manager.SetEndpointID,
 		manager.GetEndpointID,
 		manager.agentOptions.EdgeID,
 		manager.agentOptions.EdgeAsyncMode,
+		manager.agentOptions.EdgeSnapshotDelta,
 		agentPlatform,
 		manager.agentOptions.EdgeMetaFields,
-		client.BuildHTTPClient(30, manager.agentOptions),
+		httpClient,
+		manager.clusterService,
 	)
 
 	manager.stackManager = stack.NewStackManager(
 		portainerClient,
 		manager.agentOptions.AssetsPath,
 		aws.ExtractAwsConfig(manager.agentOptions),
-		manager.agentOptions.EdgeID,
+		manager.agentOptions,
 	)
 
 	manager.logsManager = scheduler.NewLogsManager(portainerClient)
@@ -136,6 +174,30 @@ func (manager *Manager) ResetActivityTimer() {
 	manager.pollService.resetActivityTimer()
 }
 
+// StartTunnelSession records a session using the reverse tunnel, the tunnel is not closed for inactivity until
+// the returned function is called
+func (manager *Manager) StartTunnelSession() func() {
+	return manager.pollService.startSession()
+}
+
+// IsTunnelOpen returns true when the reverse tunnel to the Portainer instance is open, it is never open in async mode
+func (manager *Manager) IsTunnelOpen() bool {
+	if manager == nil || manager.pollService == nil || manager.pollService.tunnelClient == nil {
+		return false
+	}
+
+	return manager.pollService.tunnelClient.IsTunnelOpen()
+}
+
+// ExecuteCommand processes cmd with the executors of the Edge async commands
+func (manager *Manager) ExecuteCommand(ctx context.Context, cmd client.AsyncCommand) error {
+	if manager.pollService == nil {
+		return errors.New("the Edge manager is not started")
+	}
+
+	return manager.pollService.commandRegistry.Process(ctx, cmd)
+}
+
 // SetEndpointID set the endpointID of the agent
 func (manager *Manager) SetEndpointID(endpointID portainer.EndpointID) {
 	manager.mu.Lock()
@@ -0,0 +1,118 @@
+package edge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/crypto"
+)
+
+// enrollmentRequestTimeout is the maximum duration of the exchange of an enrollment code
+const enrollmentRequestTimeout = 30 * time.Second
+
+type enrollmentRequest struct {
+	Code   string
+	EdgeID string
+}
+
+type enrollmentResponse struct {
+	EdgeKey string
+}
+
+// ExchangeEnrollmentCode exchanges the one-time enrollment code generated by the Portainer instance at serverURL for
+// the Edge key of the agent identified by edgeID. The code is consumed by the instance, the key is only known to the
+// agent that exchanged it.
+func ExchangeEnrollmentCode(ctx context.Context, serverURL, code, edgeID string, insecure bool) (string, error) {
+	u, err := portainerURL(serverURL, agent.EdgeEnrollmentPath)
+	if err != nil {
+		return "", err
+	}
+
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return "", errors.New("missing enrollment code")
+	}
+
+	body, err := json.Marshal(enrollmentRequest{Code: code, EdgeID: edgeID})
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, enrollmentRequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := enrollmentClient(insecure).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+	case http.StatusNotFound, http.StatusForbidden, http.StatusUnauthorized:
+		return "", errors.New("the enrollment code is invalid, expired or was already used")
+	default:
+		return "", fmt.Errorf("the enrollment was refused with the status %d", resp.StatusCode)
+	}
+
+	var response enrollmentResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := ParseEdgeKey(response.EdgeKey); err != nil {
+		return "", errors.New("the Portainer instance returned an invalid Edge key")
+	}
+
+	return response.EdgeKey, nil
+}
+
+// portainerURL returns the URL of the API path of the Portainer instance at serverURL
+func portainerURL(serverURL, path string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(serverURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid Portainer URL %q", serverURL)
+	}
+
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+
+	return u, nil
+}
+
+// enrollmentClient returns the client of the requests sent to the Portainer instance before an Edge key is
+// associated to the agent
+func enrollmentClient(insecure bool) *http.Client {
+	tlsConfig := crypto.CreateTLSConfiguration()
+	tlsConfig.InsecureSkipVerify = insecure
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{Transport: transport}
+}
+
+// Enroll exchanges the one-time enrollment code with the Portainer instance at serverURL and associates the Edge key
+// obtained to the agent
+func (manager *Manager) Enroll(ctx context.Context, serverURL, code string) error {
+	key, err := ExchangeEnrollmentCode(ctx, serverURL, code, manager.agentOptions.EdgeID, manager.agentOptions.EdgeInsecurePoll)
+	if err != nil {
+		return err
+	}
+
+	return manager.SetKey(key)
+}
@@ -0,0 +1,57 @@
+package edge
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/portainer/agent"
+)
+
+func TestExchangeEnrollmentCode(t *testing.T) {
+	key := encodeKey(&edgeKey{PortainerInstanceURL: "https://portainer.example.com", TunnelServerAddr: "portainer.example.com:8000", EndpointID: 1})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/portainer"+agent.EdgeEnrollmentPath {
+			http.NotFound(w, r)
+			return
+		}
+
+		var request enrollmentRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.EdgeID != "device-1" {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		switch request.Code {
+		case "valid":
+			json.NewEncoder(w).Encode(enrollmentResponse{EdgeKey: key})
+		case "invalid-key":
+			json.NewEncoder(w).Encode(enrollmentResponse{EdgeKey: "not a key"})
+		default:
+			http.Error(w, "unknown code", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	got, err := ExchangeEnrollmentCode(context.Background(), srv.URL+"/portainer/", " valid ", "device-1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != key {
+		t.Errorf("expected the key %q, got %q", key, got)
+	}
+
+	for _, code := range []string{"used", "invalid-key", ""} {
+		if _, err := ExchangeEnrollmentCode(context.Background(), srv.URL+"/portainer", code, "device-1", false); err == nil {
+			t.Errorf("%q: expected the enrollment to fail", code)
+		}
+	}
+
+	if _, err := ExchangeEnrollmentCode(context.Background(), "portainer.example.com", "valid", "device-1", false); err == nil {
+		t.Error("expected an invalid URL to be rejected")
+	}
+}
@@ -0,0 +1,805 @@
+package edge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/edge/client"
+	"github.com/portainer/agent/edge/command"
+	"github.com/portainer/agent/hooks"
+	"github.com/portainer/agent/memory"
+	"github.com/portainer/agent/netpolicy"
+	"github.com/portainer/agent/osupdate"
+	"github.com/portainer/agent/sbom"
+	"github.com/portainer/agent/wasm"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/portainer/portainer/api/edge"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/rs/zerolog/log"
+)
+
+var errOperationNotSupported = errors.New("operation not supported")
+
+const (
+	// imageScanTimeout is the maximum duration of the scan of the images requested by a command
+	imageScanTimeout = time.Hour
+	// sbomTimeout is the maximum duration of the generation of the SBOMs requested by a command
+	sbomTimeout = time.Hour
+)
+
+// newCommandRegistry returns a registry of the executors of the commands supported by the agent, the executors
+// provided by the plugins located in pluginsPath and by the WebAssembly plugins are registered as well
+func newCommandRegistry(service *PollService, pluginsPath string) (*command.Registry, error) {
+	registry := command.NewRegistry()
+
+	executors := []command.Executor{
+		&stackCommandExecutor{service: service},
+		&scheduleCommandExecutor{service: service},
+		&logCommandExecutor{service: service},
+		&containerCommandExecutor{},
+		&imageCommandExecutor{},
+		&volumeCommandExecutor{},
+		&normalStackCommandExecutor{service: service},
+		&edgeConfigCommandExecutor{service: service},
+		&osUpdateCommandExecutor{service: service},
+		&logRemediationCommandExecutor{service: service},
+		&imageScanCommandExecutor{service: service},
+		&sbomCommandExecutor{service: service},
+		&stackTransactionCommandExecutor{service: service},
+		&scriptHookCommandExecutor{service: service},
+		&networkPolicyCommandExecutor{service: service},
+		&zramCommandExecutor{service: service},
+	}
+
+	for _, executor := range executors {
+		if err := registry.Register(executor); err != nil {
+			return nil, err
+		}
+	}
+
+	if pluginsPath != "" {
+		if err := registry.LoadPlugins(pluginsPath); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, plugin := range wasm.DefaultRuntime().Plugins() {
+		for _, commandType := range plugin.Commands {
+			if err := registry.Register(&wasmCommandExecutor{plugin: plugin, commandType: commandType}); err != nil {
+				return nil, fmt.Errorf("unable to load the WebAssembly plugin %s: %w", plugin.Name, err)
+			}
+		}
+	}
+
+	return registry, nil
+}
+
+// noReport is embedded by the executors that do not report the outcome of their commands
+type noReport struct{}
+
+func (noReport) Report(cmd client.AsyncCommand, err error) {}
+
+type stackCommandExecutor struct {
+	service *PollService
+}
+
+func (executor *stackCommandExecutor) Type() string {
+	return string(EdgeAsyncCommandTypeStack)
+}
+
+func (executor *stackCommandExecutor) Validate(cmd client.AsyncCommand) error {
+	var stackData edge.StackPayload
+	if err := mapstructure.Decode(cmd.Value, &stackData); err != nil {
+		return err
+	}
+
+	switch cmd.Operation {
+	case "add", "replace", "remove":
+		return nil
+	}
+
+	return errOperationNotSupported
+}
+
+func (executor *stackCommandExecutor) Execute(ctx context.Context, cmd client.AsyncCommand) error {
+	var stackData edge.StackPayload
+	if err := mapstructure.Decode(cmd.Value, &stackData); err != nil {
+		return err
+	}
+
+	portainerClient := executor.service.portainerClient
+
+	err := portainerClient.SetEdgeStackStatus(stackData.ID, portainer.EdgeStackStatusAcknowledged, stackData.RollbackTo, "")
+	if err != nil {
+		return err
+	}
+
+	if cmd.Operation == "remove" {
+		err = portainerClient.SetEdgeStackStatus(stackData.ID, portainer.EdgeStackStatusRemoving, stackData.RollbackTo, "")
+		if err != nil {
+			return err
+		}
+
+		return executor.service.edgeStackManager.DeleteStack(ctx, stackData)
+	}
+
+	return executor.service.edgeStackManager.DeployStack(ctx, stackData)
+}
+
+// Report sets the status of the stack to deploying or removed on success, or to error
+func (executor *stackCommandExecutor) Report(cmd client.AsyncCommand, err error) {
+	var stackData edge.StackPayload
+	if mapstructure.Decode(cmd.Value, &stackData) != nil || errors.Is(err, errOperationNotSupported) {
+		return
+	}
+
+	status, message := portainer.EdgeStackStatusDeploying, ""
+	if err != nil {
+		status, message = portainer.EdgeStackStatusError, err.Error()
+	} else if cmd.Operation == "remove" {
+		status = portainer.EdgeStackStatusRemoved
+	}
+
+	if err := executor.service.portainerClient.SetEdgeStackStatus(stackData.ID, status, stackData.RollbackTo, message); err != nil {
+		log.Error().Err(err).Int("stack_identifier", stackData.ID).Msg("unable to report the Edge stack status")
+	}
+}
+
+type scheduleCommandExecutor struct {
+	noReport
+	service *PollService
+}
+
+func (executor *scheduleCommandExecutor) Type() string {
+	return string(EdgeAsyncCommandTypeJob)
+}
+
+func (executor *scheduleCommandExecutor) Validate(cmd client.AsyncCommand) error {
+	var jobData client.EdgeJobData
+	if err := mapstructure.Decode(cmd.Value, &jobData); err != nil {
+		return err
+	}
+
+	switch cmd.Operation {
+	case "add", "replace", "remove":
+		return nil
+	}
+
+	return errOperationNotSupported
+}
+
+func (executor *scheduleCommandExecutor) Execute(ctx context.Context, cmd client.AsyncCommand) error {
+	var jobData client.EdgeJobData
+	if err := mapstructure.Decode(cmd.Value, &jobData); err != nil {
+		return err
+	}
+
+	schedule := agent.Schedule{
+		ID:             int(jobData.ID),
+		CronExpression: jobData.CronExpression,
+		Script:         jobData.ScriptFileContent,
+		Version:        jobData.Version,
+		CollectLogs:    jobData.CollectLogs,
+		Interpreter:    jobData.Interpreter,
+		Image:          jobData.Image,
+	}
+
+	if cmd.Operation == "remove" {
+		return executor.service.scheduleManager.RemoveSchedule(schedule)
+	}
+
+	return executor.service.scheduleManager.AddSchedule(schedule)
+}
+
+type logCommandExecutor struct {
+	noReport
+	service *PollService
+}
+
+func (executor *logCommandExecutor) Type() string {
+	return string(EdgeAsyncCommandTypeLog)
+}
+
+func (executor *logCommandExecutor) Validate(cmd client.AsyncCommand) error {
+	var logCmd client.LogCommandData
+
+	return mapstructure.Decode(cmd.Value, &logCmd)
+}
+
+func (executor *logCommandExecutor) Execute(ctx context.Context, cmd client.AsyncCommand) error {
+	var logCmd client.LogCommandData
+	if err := mapstructure.Decode(cmd.Value, &logCmd); err != nil {
+		return err
+	}
+
+	executor.service.portainerClient.EnqueueLogCollectionForStack(logCmd)
+
+	return nil
+}
+
+type containerCommandExecutor struct {
+	noReport
+}
+
+func (executor *containerCommandExecutor) Type() string {
+	return string(EdgeAsyncCommandTypeContainer)
+}
+
+func (executor *containerCommandExecutor) Validate(cmd client.AsyncCommand) error {
+	var containerCmd client.ContainerCommandData
+
+	return mapstructure.Decode(cmd.Value, &containerCmd)
+}
+
+func (executor *containerCommandExecutor) Execute(ctx context.Context, cmd client.AsyncCommand) error {
+	var containerCmd client.ContainerCommandData
+	if err := mapstructure.Decode(cmd.Value, &containerCmd); err != nil {
+		return err
+	}
+
+	switch containerCmd.ContainerOperation {
+	case "start":
+		return docker.ContainerStart(containerCmd.ContainerName, containerCmd.ContainerStartOptions)
+	case "restart":
+		return docker.ContainerRestart(containerCmd.ContainerName)
+	case "stop":
+		return docker.ContainerStop(containerCmd.ContainerName)
+	case "delete":
+		return docker.ContainerDelete(containerCmd.ContainerName, containerCmd.ContainerRemoveOptions)
+	case "kill":
+		return docker.ContainerKill(containerCmd.ContainerName)
+	}
+
+	return nil
+}
+
+type imageCommandExecutor struct {
+	noReport
+}
+
+func (executor *imageCommandExecutor) Type() string {
+	return string(EdgeAsyncCommandTypeImage)
+}
+
+func (executor *imageCommandExecutor) Validate(cmd client.AsyncCommand) error {
+	var imageCommand client.ImageCommandData
+	if err := mapstructure.Decode(cmd.Value, &imageCommand); err != nil {
+		return errors.New("failed to decode ImageCommandData")
+	}
+
+	return nil
+}
+
+func (executor *imageCommandExecutor) Execute(ctx context.Context, cmd client.AsyncCommand) error {
+	var imageCommand client.ImageCommandData
+	if err := mapstructure.Decode(cmd.Value, &imageCommand); err != nil {
+		return errors.New("failed to decode ImageCommandData")
+	}
+
+	if imageCommand.ImageOperation == "delete" {
+		_, err := docker.ImageDelete(imageCommand.ImageName, imageCommand.ImageRemoveOptions)
+
+		return err
+	}
+
+	return nil
+}
+
+type volumeCommandExecutor struct {
+	noReport
+}
+
+func (executor *volumeCommandExecutor) Type() string {
+	return string(EdgeAsyncCommandTypeVolume)
+}
+
+func (executor *volumeCommandExecutor) Validate(cmd client.AsyncCommand) error {
+	var volumeCommand client.VolumeCommandData
+
+	return mapstructure.Decode(cmd.Value, &volumeCommand)
+}
+
+func (executor *volumeCommandExecutor) Execute(ctx context.Context, cmd client.AsyncCommand) error {
+	var volumeCommand client.VolumeCommandData
+	if err := mapstructure.Decode(cmd.Value, &volumeCommand); err != nil {
+		return err
+	}
+
+	if volumeCommand.VolumeOperation == "delete" {
+		return docker.VolumeDelete(volumeCommand.VolumeName, volumeCommand.ForceRemove)
+	}
+
+	return nil
+}
+
+type normalStackCommandExecutor struct {
+	noReport
+	service *PollService
+}
+
+func (executor *normalStackCommandExecutor) Type() string {
+	return string(EdgeAsyncCommandTypeNormalStack)
+}
+
+func (executor *normalStackCommandExecutor) Validate(cmd client.AsyncCommand) error {
+	var normalStackCommand client.NormalStackCommandData
+
+	return mapstructure.Decode(cmd.Value, &normalStackCommand)
+}
+
+func (executor *normalStackCommandExecutor) Execute(ctx context.Context, cmd client.AsyncCommand) error {
+	var normalStackCommand client.NormalStackCommandData
+	if err := mapstructure.Decode(cmd.Value, &normalStackCommand); err != nil {
+		return err
+	}
+
+	if normalStackCommand.StackOperation == "remove" {
+		return executor.service.edgeManager.stackManager.DeleteNormalStack(ctx, normalStackCommand.Name)
+	}
+
+	return nil
+}
+
+type edgeConfigCommandExecutor struct {
+	service *PollService
+}
+
+func (executor *edgeConfigCommandExecutor) Type() string {
+	return string(EdgeAsyncCommandTypeConfig)
+}
+
+func (executor *edgeConfigCommandExecutor) Validate(cmd client.AsyncCommand) error {
+	var configData client.EdgeConfig
+
+	return mapstructure.Decode(cmd.Value, &configData)
+}
+
+func (executor *edgeConfigCommandExecutor) Execute(ctx context.Context, cmd client.AsyncCommand) error {
+	var configData client.EdgeConfig
+	if err := mapstructure.Decode(cmd.Value, &configData); err != nil {
+		return err
+	}
+
+	switch EdgeAsyncCommandOperation(cmd.Operation) {
+	case EdgeAsyncCommandOpAdd:
+		return executor.service.edgeManager.CreateEdgeConfig(&configData)
+	case EdgeAsyncCommandOpReplace:
+		return executor.service.edgeManager.UpdateEdgeConfig(&configData)
+	case EdgeAsyncCommandOpRemove:
+		return executor.service.edgeManager.DeleteEdgeConfig(&configData)
+	}
+
+	return nil
+}
+
+// Report sets the state of the configuration to idle on success, or to failure
+func (executor *edgeConfigCommandExecutor) Report(cmd client.AsyncCommand, err error) {
+	var configData client.EdgeConfig
+	if mapstructure.Decode(cmd.Value, &configData) != nil {
+		return
+	}
+
+	if err == nil {
+		executor.service.portainerClient.SetEdgeConfigState(configData.ID, client.EdgeConfigIdleState)
+	} else {
+		executor.service.portainerClient.SetEdgeConfigState(configData.ID, client.EdgeConfigFailureState)
+	}
+}
+
+// osUpdateCommandExecutor starts the OS update in the background, its progress is reported in the snapshots
+type osUpdateCommandExecutor struct {
+	noReport
+	service *PollService
+}
+
+func (executor *osUpdateCommandExecutor) Type() string {
+	return string(EdgeAsyncCommandTypeOSUpdate)
+}
+
+func (executor *osUpdateCommandExecutor) Validate(cmd client.AsyncCommand) error {
+	if !slices.Contains(executor.service.edgeManager.agentOptions.AllowedOperations, agent.OperationOSUpdate) {
+		return errors.New("the os_update operation is not allowed on this agent")
+	}
+
+	var osUpdateCommand client.OSUpdateCommandData
+	if err := mapstructure.Decode(cmd.Value, &osUpdateCommand); err != nil {
+		return err
+	}
+
+	return osupdate.ValidateArtifact(osUpdateCommand.Artifact)
+}
+
+func (executor *osUpdateCommandExecutor) Execute(ctx context.Context, cmd client.AsyncCommand) error {
+	var osUpdateCommand client.OSUpdateCommandData
+	if err := mapstructure.Decode(cmd.Value, &osUpdateCommand); err != nil {
+		return err
+	}
+
+	go func() {
+		err := osupdate.Run(context.Background(), osUpdateCommand.Artifact, nil)
+		if err != nil {
+			log.Error().Err(err).Msg("unable to apply the OS update")
+		}
+	}()
+
+	return nil
+}
+
+// logRemediationCommandExecutor reclaims the disk space used by the container logs in the background, the outcome
+// is visible in the log audit of the next snapshots
+type logRemediationCommandExecutor struct {
+	noReport
+	service *PollService
+}
+
+func (executor *logRemediationCommandExecutor) Type() string {
+	return string(EdgeAsyncCommandTypeLogRemediation)
+}
+
+func (executor *logRemediationCommandExecutor) Validate(cmd client.AsyncCommand) error {
+	if !slices.Contains(executor.service.edgeManager.agentOptions.AllowedOperations, agent.OperationLogRemediation) {
+		return errors.New("the log_remediation operation is not allowed on this agent")
+	}
+
+	var logRemediationCommand client.LogRemediationCommandData
+	if err := mapstructure.Decode(cmd.Value, &logRemediationCommand); err != nil {
+		return err
+	}
+
+	if logRemediationCommand.MinSize < 0 {
+		return errors.New("invalid minimum size")
+	}
+
+	return nil
+}
+
+func (executor *logRemediationCommandExecutor) Execute(ctx context.Context, cmd client.AsyncCommand) error {
+	var logRemediationCommand client.LogRemediationCommandData
+	if err := mapstructure.Decode(cmd.Value, &logRemediationCommand); err != nil {
+		return err
+	}
+
+	go func() {
+		results, err := docker.RemediateLogs(context.Background(), docker.LogRemediationOptions{
+			ContainerIDs:    logRemediationCommand.ContainerIDs,
+			MinSize:         logRemediationCommand.MinSize,
+			ApplyLogOptions: logRemediationCommand.ApplyLogOptions,
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("unable to remediate the container logs")
+
+			return
+		}
+
+		for _, result := range results {
+			if result.Error != "" {
+				log.Warn().Str("container", result.Name).Str("error", result.Error).Msg("unable to remediate the container logs")
+
+				continue
+			}
+
+			log.Info().Str("container", result.Name).Int64("reclaimed", result.Reclaimed).Msg("container logs remediated")
+		}
+	}()
+
+	return nil
+}
+
+// imageScanCommandExecutor scans the local images for vulnerabilities in the background, the summary of each image is
+// sent in the next snapshots
+type imageScanCommandExecutor struct {
+	noReport
+	service *PollService
+}
+
+func (executor *imageScanCommandExecutor) Type() string {
+	return string(EdgeAsyncCommandTypeImageScan)
+}
+
+func (executor *imageScanCommandExecutor) Validate(cmd client.AsyncCommand) error {
+	if !slices.Contains(executor.service.edgeManager.agentOptions.AllowedOperations, agent.OperationImageScan) {
+		return errors.New("the image_scan operation is not allowed on this agent")
+	}
+
+	var imageScanCommand client.ImageScanCommandData
+
+	return mapstructure.Decode(cmd.Value, &imageScanCommand)
+}
+
+func (executor *imageScanCommandExecutor) Execute(ctx context.Context, cmd client.AsyncCommand) error {
+	var imageScanCommand client.ImageScanCommandData
+	if err := mapstructure.Decode(cmd.Value, &imageScanCommand); err != nil {
+		return err
+	}
+
+	options := docker.ImageScanOptions{
+		Image:   executor.service.edgeManager.agentOptions.ScanImage,
+		Offline: imageScanCommand.Offline,
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), imageScanTimeout)
+		defer cancel()
+
+		results, err := docker.ScanImages(ctx, imageScanCommand.Images, options)
+		if err != nil {
+			log.Error().Err(err).Msg("unable to scan the images")
+
+			return
+		}
+
+		log.Info().Int("images", len(results)).Msg("images scanned")
+	}()
+
+	return nil
+}
+
+// sbomCommandExecutor generates the SBOMs of the selected images in the background and uploads them to the URL of the
+// command, the outcome of each image is sent in the next snapshots
+type sbomCommandExecutor struct {
+	noReport
+	service *PollService
+}
+
+func (executor *sbomCommandExecutor) Type() string {
+	return string(EdgeAsyncCommandTypeSBOM)
+}
+
+func (executor *sbomCommandExecutor) Validate(cmd client.AsyncCommand) error {
+	if !slices.Contains(executor.service.edgeManager.agentOptions.AllowedOperations, agent.OperationSBOM) {
+		return errors.New("the sbom operation is not allowed on this agent")
+	}
+
+	var sbomCommand client.SBOMCommandData
+	if err := mapstructure.Decode(cmd.Value, &sbomCommand); err != nil {
+		return err
+	}
+
+	if len(sbomCommand.Images) == 0 {
+		return errors.New("no image selected")
+	}
+
+	if !strings.HasPrefix(sbomCommand.UploadURL, "https://") && !strings.HasPrefix(sbomCommand.UploadURL, "http://") {
+		return errors.New("invalid SBOM upload URL")
+	}
+
+	return sbom.ValidateFormat(sbomCommand.Format)
+}
+
+func (executor *sbomCommandExecutor) Execute(ctx context.Context, cmd client.AsyncCommand) error {
+	var sbomCommand client.SBOMCommandData
+	if err := mapstructure.Decode(cmd.Value, &sbomCommand); err != nil {
+		return err
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), sbomTimeout)
+		defer cancel()
+
+		results := sbom.GenerateAndUpload(ctx, sbomCommand.Images, sbomCommand.Format, sbomCommand.UploadURL)
+
+		log.Info().Int("images", len(results)).Msg("SBOMs generated")
+	}()
+
+	return nil
+}
+
+// stackTransactionCommandExecutor prepares, commits or aborts a version of a stack deployed on all the devices of a
+// site, the version is only deployed once it is prepared on all the devices so that a site never runs mixed versions
+type stackTransactionCommandExecutor struct {
+	service *PollService
+}
+
+func (executor *stackTransactionCommandExecutor) Type() string {
+	return string(EdgeAsyncCommandTypeStackTransaction)
+}
+
+func (executor *stackTransactionCommandExecutor) Validate(cmd client.AsyncCommand) error {
+	var txCommand client.StackTransactionCommandData
+	if err := mapstructure.Decode(cmd.Value, &txCommand); err != nil {
+		return err
+	}
+
+	if txCommand.TransactionID == "" {
+		return errors.New("missing transaction identifier")
+	}
+
+	switch cmd.Operation {
+	case "prepare", "commit", "abort":
+		return nil
+	}
+
+	return errOperationNotSupported
+}
+
+func (executor *stackTransactionCommandExecutor) Execute(ctx context.Context, cmd client.AsyncCommand) error {
+	var txCommand client.StackTransactionCommandData
+	if err := mapstructure.Decode(cmd.Value, &txCommand); err != nil {
+		return err
+	}
+
+	manager := executor.service.edgeStackManager
+	stackData := txCommand.Stack
+
+	switch cmd.Operation {
+	case "commit":
+		return manager.CommitStack(txCommand.TransactionID, stackData.ID, stackData.Version)
+	case "abort":
+		return manager.AbortStack(txCommand.TransactionID, stackData.ID)
+	}
+
+	err := executor.service.portainerClient.SetEdgeStackStatus(stackData.ID, portainer.EdgeStackStatusAcknowledged, stackData.RollbackTo, "")
+	if err != nil {
+		return err
+	}
+
+	return manager.PrepareStack(ctx, txCommand.TransactionID, stackData)
+}
+
+// Report sets the status of the stack to error when the transaction command failed, the outcome of the prepare is
+// reported once the images of the stack are pulled
+func (executor *stackTransactionCommandExecutor) Report(cmd client.AsyncCommand, err error) {
+	var txCommand client.StackTransactionCommandData
+	if err == nil || errors.Is(err, errOperationNotSupported) || mapstructure.Decode(cmd.Value, &txCommand) != nil {
+		return
+	}
+
+	message := fmt.Sprintf("unable to %s the transaction %s: %s", cmd.Operation, txCommand.TransactionID, err)
+
+	if err := executor.service.portainerClient.SetEdgeStackStatus(txCommand.Stack.ID, portainer.EdgeStackStatusError, txCommand.Stack.RollbackTo, message); err != nil {
+		log.Error().Err(err).Int("stack_identifier", txCommand.Stack.ID).Msg("unable to report the Edge stack status")
+	}
+}
+
+// scriptHookCommandExecutor installs, replaces and removes the scripting hooks pushed by the server
+type scriptHookCommandExecutor struct {
+	noReport
+	service *PollService
+}
+
+func (executor *scriptHookCommandExecutor) Type() string {
+	return string(EdgeAsyncCommandTypeScriptHook)
+}
+
+func (executor *scriptHookCommandExecutor) Validate(cmd client.AsyncCommand) error {
+	if !slices.Contains(executor.service.edgeManager.agentOptions.AllowedOperations, agent.OperationScriptHooks) {
+		return errors.New("the script_hooks operation is not allowed on this agent")
+	}
+
+	if hooks.DefaultEngine() == nil {
+		return errors.New("the scripting hooks are not enabled on this agent")
+	}
+
+	var hookCommand client.ScriptHookCommandData
+	if err := mapstructure.Decode(cmd.Value, &hookCommand); err != nil {
+		return err
+	}
+
+	switch EdgeAsyncCommandOperation(cmd.Operation) {
+	case EdgeAsyncCommandOpAdd, EdgeAsyncCommandOpReplace:
+		return hooks.Validate(hookCommand.Name, hookCommand.Script)
+	case EdgeAsyncCommandOpRemove:
+		return nil
+	}
+
+	return fmt.Errorf("operation %v: %w", cmd.Operation, errOperationNotSupported)
+}
+
+func (executor *scriptHookCommandExecutor) Execute(ctx context.Context, cmd client.AsyncCommand) error {
+	var hookCommand client.ScriptHookCommandData
+	if err := mapstructure.Decode(cmd.Value, &hookCommand); err != nil {
+		return err
+	}
+
+	if EdgeAsyncCommandOperation(cmd.Operation) == EdgeAsyncCommandOpRemove {
+		return hooks.DefaultEngine().Remove(hookCommand.Name)
+	}
+
+	return hooks.DefaultEngine().Install(hookCommand.Name, hookCommand.Script)
+}
+
+// networkPolicyCommandExecutor replaces the network policies pushed by the server
+type networkPolicyCommandExecutor struct {
+	noReport
+	service *PollService
+}
+
+func (executor *networkPolicyCommandExecutor) Type() string {
+	return string(EdgeAsyncCommandTypeNetworkPolicy)
+}
+
+func (executor *networkPolicyCommandExecutor) Validate(cmd client.AsyncCommand) error {
+	if !slices.Contains(executor.service.edgeManager.agentOptions.AllowedOperations, agent.OperationNetworkPolicy) {
+		return errors.New("the network_policy operation is not allowed on this agent")
+	}
+
+	if netpolicy.DefaultEnforcer() == nil {
+		return netpolicy.ErrDisabled
+	}
+
+	if EdgeAsyncCommandOperation(cmd.Operation) != EdgeAsyncCommandOpReplace {
+		return fmt.Errorf("operation %v: %w", cmd.Operation, errOperationNotSupported)
+	}
+
+	var policyCommand client.NetworkPolicyCommandData
+	if err := mapstructure.Decode(cmd.Value, &policyCommand); err != nil {
+		return err
+	}
+
+	for i := range policyCommand.Policies {
+		if err := policyCommand.Policies[i].Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (executor *networkPolicyCommandExecutor) Execute(ctx context.Context, cmd client.AsyncCommand) error {
+	var policyCommand client.NetworkPolicyCommandData
+	if err := mapstructure.Decode(cmd.Value, &policyCommand); err != nil {
+		return err
+	}
+
+	return netpolicy.DefaultEnforcer().UpdateServerPolicies(ctx, policyCommand.Policies)
+}
+
+// zramCommandExecutor applies the zram configuration recommended for the host, the outcome is visible in the memory
+// report of the next snapshots
+type zramCommandExecutor struct {
+	noReport
+	service *PollService
+}
+
+func (executor *zramCommandExecutor) Type() string {
+	return string(EdgeAsyncCommandTypeZRAM)
+}
+
+func (executor *zramCommandExecutor) Validate(cmd client.AsyncCommand) error {
+	if !slices.Contains(executor.service.edgeManager.agentOptions.AllowedOperations, agent.OperationZRAM) {
+		return errors.New("the zram operation is not allowed on this agent")
+	}
+
+	if memory.DefaultService() == nil {
+		return errors.New("the memory service is not enabled")
+	}
+
+	return nil
+}
+
+func (executor *zramCommandExecutor) Execute(ctx context.Context, cmd client.AsyncCommand) error {
+	return memory.DefaultService().ApplyRecommendation(ctx)
+}
+
+// wasmCommandExecutor executes the commands of one type handled by a WebAssembly plugin, the plugin receives the
+// command encoded in JSON and validates it itself
+type wasmCommandExecutor struct {
+	noReport
+	plugin      *wasm.Plugin
+	commandType string
+}
+
+func (executor *wasmCommandExecutor) Type() string {
+	return executor.commandType
+}
+
+func (executor *wasmCommandExecutor) Validate(cmd client.AsyncCommand) error {
+	return nil
+}
+
+func (executor *wasmCommandExecutor) Execute(ctx context.Context, cmd client.AsyncCommand) error {
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+
+	return executor.plugin.Handle(ctx, executor.commandType, data)
+}
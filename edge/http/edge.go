@@ -2,9 +2,12 @@ package http
 
 import (
 	"context"
+	"html/template"
 	"net/http"
+	"sync"
 	"time"
 
+	"github.com/portainer/agent"
 	"github.com/portainer/agent/edge"
 
 	"github.com/gorilla/mux"
@@ -12,27 +15,53 @@ import (
 )
 
 // EdgeServer expose an UI to associate an Edge key with the agent.
+// In enrollment mode, the UI asks for the URL of the Portainer instance and a one-time enrollment code instead of
+// the Edge key, the key is never entered or displayed. When the device is claimed, the UI displays the claim code to
+// enter in Portainer and shuts down once the device is claimed.
 type EdgeServer struct {
 	httpServer  *http.Server
 	edgeManager *edge.Manager
+	enrollment  bool
+	claimer     *edge.Claimer
+
+	mu             sync.Mutex
+	failedAttempts int
 }
 
 // NewEdgeServer returns a pointer to a new instance of EdgeServer.
-func NewEdgeServer(edgeManager *edge.Manager) *EdgeServer {
+func NewEdgeServer(edgeManager *edge.Manager, enrollment bool, claimer *edge.Claimer) *EdgeServer {
 	return &EdgeServer{
 		edgeManager: edgeManager,
+		enrollment:  enrollment,
+		claimer:     claimer,
 	}
 }
 
 // Start starts a new web server by listening on the specified addr and port.
 func (server *EdgeServer) Start(addr, port string) error {
 	router := mux.NewRouter()
-	router.HandleFunc("/init", server.handleKeySetup()).Methods(http.MethodPost)
+	if server.claimer != nil {
+		router.HandleFunc("/", server.handleClaimPage()).Methods(http.MethodGet)
+	}
+
+	if server.enrollment {
+		router.HandleFunc("/enroll", server.handleEnrollment()).Methods(http.MethodPost)
+		router.HandleFunc("/", serveFile("./static/enroll.html")).Methods(http.MethodGet)
+	} else {
+		router.HandleFunc("/init", server.handleKeySetup()).Methods(http.MethodPost)
+	}
 	router.PathPrefix("/").Handler(http.FileServer(http.Dir("./static")))
 
 	listenAddr := addr + ":" + port
 	server.httpServer = &http.Server{Addr: listenAddr, Handler: router}
 
+	if server.claimer != nil {
+		go func() {
+			<-server.claimer.Claimed()
+			server.Shutdown()
+		}()
+	}
+
 	err := server.httpServer.ListenAndServe()
 	if err != http.ErrServerClosed {
 		return err
@@ -73,6 +102,92 @@ func (server *EdgeServer) handleKeySetup() http.HandlerFunc {
 	}
 }
 
+func (server *EdgeServer) handleEnrollment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, "Unable to parse form", http.StatusInternalServerError)
+			return
+		}
+
+		serverURL := r.Form.Get("url")
+		code := r.Form.Get("code")
+		if serverURL == "" || code == "" {
+			http.Error(w, "Missing url or code parameter", http.StatusBadRequest)
+			return
+		}
+
+		// The attempts are serialized, so that a code cannot be guessed with concurrent requests
+		server.mu.Lock()
+		defer server.mu.Unlock()
+
+		if server.failedAttempts >= agent.EdgeEnrollmentMaxAttempts || server.edgeManager.IsKeySet() {
+			http.Error(w, "The enrollment is locked", http.StatusForbidden)
+			return
+		}
+
+		err = server.edgeManager.Enroll(r.Context(), serverURL, code)
+		if err != nil {
+			server.failedAttempts++
+
+			log.Warn().Err(err).Int("failed_attempts", server.failedAttempts).Msg("unable to enroll the agent")
+
+			if server.failedAttempts >= agent.EdgeEnrollmentMaxAttempts {
+				log.Warn().Int("max_attempts", agent.EdgeEnrollmentMaxAttempts).Msg("Shutting down Edge UI server after max_attempts failed enrollments")
+
+				http.Error(w, "Unable to enroll the agent: "+err.Error()+". The enrollment is locked, restart the agent to retry", http.StatusForbidden)
+				go server.Shutdown()
+
+				return
+			}
+
+			http.Error(w, "Unable to enroll the agent: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		log.Info().Msg("the agent is enrolled with the Portainer instance")
+
+		err = server.edgeManager.Start()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		go server.propagateKeyInCluster()
+
+		w.Write([]byte("Agent enrolled. You can close this page."))
+		go server.Shutdown()
+	}
+}
+
+func (server *EdgeServer) handleClaimPage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, err := template.ParseFiles("./static/claim.html")
+		if err != nil {
+			http.Error(w, "Unable to load the claim page", http.StatusInternalServerError)
+			return
+		}
+
+		data := struct {
+			Code       string
+			URL        string
+			Enrollment bool
+		}{
+			Code:       server.claimer.Code(),
+			URL:        server.claimer.URL(),
+			Enrollment: server.enrollment,
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		page.Execute(w, data)
+	}
+}
+
+func serveFile(path string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, path)
+	}
+}
+
 func (server *EdgeServer) propagateKeyInCluster() {
 	err := server.edgeManager.PropagateKeyInCluster()
 	if err != nil {
@@ -5,12 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"os"
 	"strconv"
 	"strings"
 
 	"github.com/portainer/agent"
+	"github.com/portainer/agent/crypto"
 	"github.com/portainer/agent/edge/client"
 	"github.com/portainer/agent/filesystem"
+	"github.com/portainer/agent/tpm"
 	portainer "github.com/portainer/portainer/api"
 
 	"github.com/rs/zerolog/log"
@@ -42,7 +45,7 @@ func (manager *Manager) SetKey(key string) error {
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
 
-	err = filesystem.WriteFile(manager.agentOptions.DataPath, agent.EdgeKeyFile, []byte(key), 0644)
+	err = writeEdgeKey(manager.agentOptions.DataPath, key)
 	if err != nil {
 		return err
 	}
@@ -167,7 +170,68 @@ func RetrieveEdgeKey(edgeKey string, clusterService agent.ClusterService, dataPa
 	return edgeKey, nil
 }
 
+// writeEdgeKey persists the Edge key in the data folder, sealed by the TPM when it is enabled
+func writeEdgeKey(dataPath, key string) error {
+	device := tpm.DefaultDevice()
+	if device == nil {
+		content, err := crypto.EncryptState([]byte(key))
+		if err != nil {
+			return err
+		}
+
+		return filesystem.WriteFile(dataPath, agent.EdgeKeyFile, content, 0600)
+	}
+
+	sealed, err := device.Seal([]byte(key))
+	if err != nil {
+		return err
+	}
+
+	err = filesystem.WriteFile(dataPath, agent.EdgeKeySealedFile, sealed, 0600)
+	if err != nil {
+		return err
+	}
+
+	// The plain text key persisted before the TPM was enabled is removed
+	err = filesystem.RemoveFile(fmt.Sprintf("%s/%s", dataPath, agent.EdgeKeyFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func retrieveSealedEdgeKey(dataPath string) (string, error) {
+	sealedKeyFilePath := fmt.Sprintf("%s/%s", dataPath, agent.EdgeKeySealedFile)
+
+	sealed, err := filesystem.ReadFromFile(sealedKeyFilePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	device := tpm.DefaultDevice()
+	if device == nil {
+		return "", errors.New("the edge key is sealed by a TPM, the TPM must be enabled")
+	}
+
+	key, err := device.Unseal(sealed)
+	if err != nil {
+		return "", fmt.Errorf("unable to unseal the edge key: %w", err)
+	}
+
+	log.Info().Msg("edge key unsealed from the filesystem")
+
+	return string(key), nil
+}
+
 func retrieveEdgeKeyFromFilesystem(dataPath string) (string, error) {
+	sealedKey, err := retrieveSealedEdgeKey(dataPath)
+	if err != nil || sealedKey != "" {
+		return sealedKey, err
+	}
+
 	edgeKeyFilePath := fmt.Sprintf("%s/%s", dataPath, agent.EdgeKeyFile)
 
 	keyFileExists, err := filesystem.FileExists(edgeKeyFilePath)
@@ -186,6 +250,21 @@ func retrieveEdgeKeyFromFilesystem(dataPath string) (string, error) {
 
 	log.Info().Msg("edge key loaded from the filesystem")
 
+	encrypted := crypto.IsEncryptedState(filesystemKey)
+
+	filesystemKey, err = crypto.DecryptState(filesystemKey)
+	if err != nil {
+		return "", err
+	}
+
+	// The key persisted in plain text before the TPM or the state encryption was enabled is written again
+	if tpm.DefaultDevice() != nil || (!encrypted && crypto.DefaultStateCipher() != nil) {
+		err = writeEdgeKey(dataPath, string(filesystemKey))
+		if err != nil {
+			log.Warn().Err(err).Msg("unable to protect the edge key persisted in plain text")
+		}
+	}
+
 	return string(filesystemKey), nil
 }
 
@@ -4,14 +4,20 @@ import (
 	"encoding/base64"
 	"errors"
 	"math/rand"
+	"path/filepath"
 	"strconv"
 	"time"
 
 	"github.com/portainer/agent"
-	"github.com/portainer/agent/chisel"
+	"github.com/portainer/agent/docker"
 	"github.com/portainer/agent/edge/client"
+	"github.com/portainer/agent/edge/command"
+	"github.com/portainer/agent/edge/queue"
 	"github.com/portainer/agent/edge/scheduler"
 	"github.com/portainer/agent/edge/stack"
+	"github.com/portainer/agent/faults"
+	"github.com/portainer/agent/metrics"
+	agentnet "github.com/portainer/agent/net"
 	"github.com/portainer/portainer/pkg/libcrypto"
 
 	"github.com/rs/zerolog/log"
@@ -23,23 +29,25 @@ const tunnelActivityCheckInterval = 30 * time.Second
 // It is responsible for managing the state of the reverse tunnel (open and closing after inactivity).
 // It is also responsible for retrieving the data associated to Edge stacks and schedules.
 type PollService struct {
-	apiServerAddr            string
-	pollIntervalInSeconds    float64
-	pollTicker               *time.Ticker
-	inactivityTimeout        time.Duration
-	edgeID                   string
-	portainerClient          client.PortainerClient
-	tunnelClient             agent.ReverseTunnelClient
-	scheduleManager          agent.Scheduler
-	lastActivity             time.Time
-	updateLastActivitySignal chan struct{}
-	startSignal              chan struct{}
-	stopSignal               chan struct{}
-	edgeManager              *Manager
-	edgeStackManager         *stack.StackManager
-	portainerURL             string
-	tunnelServerAddr         string
-	tunnelServerFingerprint  string
+	apiServerAddr           string
+	pollIntervalInSeconds   float64
+	pollTicker              *time.Ticker
+	inactivityTimeout       time.Duration
+	tunnelGracePeriod       time.Duration
+	edgeID                  string
+	portainerClient         client.PortainerClient
+	tunnelClient            agent.ReverseTunnelClient
+	scheduleManager         agent.Scheduler
+	activity                tunnelActivity
+	startSignal             chan struct{}
+	stopSignal              chan struct{}
+	edgeManager             *Manager
+	edgeStackManager        *stack.StackManager
+	commandRegistry         *command.Registry
+	commandSequencer        *command.Sequencer
+	portainerURL            string
+	tunnelServerAddr        string
+	tunnelServerFingerprint string
 
 	// Async mode only
 	pingInterval     time.Duration
@@ -48,18 +56,25 @@ type PollService struct {
 	pingTicker       *time.Ticker
 	snapshotTicker   *time.Ticker
 	commandTicker    *time.Ticker
+	// commandQueue persists the commands before they are executed, nil when the offline queue is disabled
+	commandQueue *queue.Queue
 }
 
 type pollServiceConfig struct {
 	APIServerAddr           string
 	EdgeID                  string
 	InactivityTimeout       string
+	TunnelGracePeriod       string
 	PollFrequency           string
 	TunnelCapability        bool
+	TunnelTransport         string
 	PortainerURL            string
 	TunnelServerAddr        string
 	TunnelServerFingerprint string
 	ContainerPlatform       agent.ContainerPlatform
+	CommandPluginsPath      string
+	DataPath                string
+	OfflineQueue            bool
 }
 
 // newPollService returns a pointer to a new instance of PollService, and will start two loops in go routines.
@@ -79,25 +94,52 @@ func newPollService(edgeManager *Manager, edgeStackManager *stack.StackManager,
 		return nil, err
 	}
 
+	tunnelGracePeriod, err := time.ParseDuration(config.TunnelGracePeriod)
+	if err != nil {
+		return nil, err
+	}
+
 	pollService := &PollService{
-		apiServerAddr:            config.APIServerAddr,
-		edgeID:                   config.EdgeID,
-		pollIntervalInSeconds:    pollFrequency.Seconds(),
-		inactivityTimeout:        inactivityTimeout,
-		scheduleManager:          scheduler.NewCronManager(logsManager),
-		updateLastActivitySignal: make(chan struct{}),
-		startSignal:              make(chan struct{}),
-		stopSignal:               make(chan struct{}),
-		edgeManager:              edgeManager,
-		edgeStackManager:         edgeStackManager,
-		portainerURL:             config.PortainerURL,
-		tunnelServerAddr:         config.TunnelServerAddr,
-		tunnelServerFingerprint:  config.TunnelServerFingerprint,
-		portainerClient:          portainerClient,
+		apiServerAddr:           config.APIServerAddr,
+		edgeID:                  config.EdgeID,
+		pollIntervalInSeconds:   pollFrequency.Seconds(),
+		inactivityTimeout:       inactivityTimeout,
+		tunnelGracePeriod:       tunnelGracePeriod,
+		scheduleManager:         scheduler.NewCronManager(logsManager, config.DataPath),
+		startSignal:             make(chan struct{}),
+		stopSignal:              make(chan struct{}),
+		edgeManager:             edgeManager,
+		edgeStackManager:        edgeStackManager,
+		portainerURL:            config.PortainerURL,
+		tunnelServerAddr:        config.TunnelServerAddr,
+		tunnelServerFingerprint: config.TunnelServerFingerprint,
+		portainerClient:         portainerClient,
+		commandSequencer:        command.NewSequencer(edgeManager.agentOptions.ClockSkewTolerance),
+	}
+
+	pollService.commandRegistry, err = newCommandRegistry(pollService, config.CommandPluginsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if edgeAsyncMode && config.OfflineQueue {
+		pollService.commandQueue, err = queue.Open(filepath.Join(config.DataPath, agent.EdgeQueueFileName), queue.DefaultMaxAttempts)
+		if err != nil {
+			return nil, err
+		}
+
+		if asyncClient, ok := portainerClient.(*client.PortainerAsyncClient); ok {
+			if err := asyncClient.SetPendingDataStore(pollService.commandQueue); err != nil {
+				log.Warn().Err(err).Msg("unable to restore the pending data persisted by the offline queue")
+			}
+		}
 	}
 
 	if config.TunnelCapability {
-		pollService.tunnelClient = chisel.NewClient()
+		pollService.tunnelClient, err = newTunnelClient(config.TunnelTransport)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	if edgeAsyncMode {
@@ -113,9 +155,11 @@ func newPollService(edgeManager *Manager, edgeStackManager *stack.StackManager,
 }
 
 func (service *PollService) resetActivityTimer() {
-	if service.tunnelClient != nil && service.tunnelClient.IsTunnelOpen() {
-		service.updateLastActivitySignal <- struct{}{}
-	}
+	service.activity.touch()
+}
+
+func (service *PollService) startSession() func() {
+	return service.activity.startSession()
 }
 
 func (service *PollService) Start() {
@@ -148,7 +192,8 @@ func (service *PollService) startStatusPollLoop() {
 
 			err := service.poll()
 			if err != nil {
-				log.Error().Err(err).Msg("an error occured during short poll")
+				log.Error().Err(err).Str("connectivity_state", string(client.CurrentConnectivity().State)).Msg("an error occured during short poll")
+				metrics.EdgePollFailed()
 
 				lastPollFailed = true
 				service.pollTicker.Reset(time.Duration(service.pollIntervalInSeconds) * time.Second)
@@ -173,18 +218,26 @@ func (service *PollService) startActivityMonitoringLoop() {
 
 	for {
 		select {
+		case <-faults.Changed():
+			if faults.Active(faults.TunnelDrop) && service.tunnelClient != nil && service.tunnelClient.IsTunnelOpen() {
+				log.Warn().Msg("dropping the tunnel")
+
+				err := service.tunnelClient.CloseTunnel()
+				if err != nil {
+					log.Error().Err(err).Msg("unable to shutdown tunnel")
+				}
+			}
 		case <-ticker.C:
-			if service.lastActivity.IsZero() {
+			elapsed, idle := service.activity.idleDuration()
+			if !idle {
 				continue
 			}
 
-			elapsed := time.Since(service.lastActivity)
-
 			log.Debug().
 				Float64("tunnel_last_activity_seconds", elapsed.Seconds()).
 				Msg("tunnel activity monitoring")
 
-			if service.tunnelClient != nil && service.tunnelClient.IsTunnelOpen() && elapsed.Seconds() > service.inactivityTimeout.Seconds() {
+			if service.tunnelClient != nil && service.tunnelClient.IsTunnelOpen() && elapsed > service.inactivityTimeout {
 				log.Info().
 					Float64("tunnel_last_activity_seconds", elapsed.Seconds()).
 					Msg("shutting down tunnel after inactivity period")
@@ -194,8 +247,6 @@ func (service *PollService) startActivityMonitoringLoop() {
 					log.Error().Err(err).Msg("unable to shutdown tunnel")
 				}
 			}
-		case <-service.updateLastActivitySignal:
-			service.lastActivity = time.Now()
 		}
 	}
 }
@@ -234,6 +285,10 @@ func (service *PollService) poll() error {
 
 	service.processSchedules(environmentStatus.Schedules)
 
+	docker.SetCollectorOverrides(environmentStatus.Collectors)
+
+	service.edgeStackManager.SetPriorityClasses(environmentStatus.StackPriorityClasses)
+
 	if environmentStatus.CheckinInterval > 0 && environmentStatus.CheckinInterval != service.pollIntervalInSeconds {
 		log.Debug().
 			Float64("old_interval", service.pollIntervalInSeconds).
@@ -256,13 +311,19 @@ func (service *PollService) manageUpdateTunnel(environmentStatus client.PollStat
 	}
 
 	if environmentStatus.Status == agent.TunnelStatusIdle && service.tunnelClient.IsTunnelOpen() {
-		log.Debug().
-			Str("status", environmentStatus.Status).
-			Msg("idle status detected, shutting down tunnel")
+		// The tunnel is kept open while sessions such as container consoles are using it and during a grace
+		// period after the last activity, so that users are not disconnected when the server stops requiring it
+		elapsed, idle := service.activity.idleDuration()
+		if idle && elapsed >= service.tunnelGracePeriod {
+			log.Debug().
+				Str("status", environmentStatus.Status).
+				Float64("tunnel_last_activity_seconds", elapsed.Seconds()).
+				Msg("idle status detected, shutting down tunnel")
 
-		err := service.tunnelClient.CloseTunnel()
-		if err != nil {
-			log.Error().Err(err).Msg("unable to shutdown tunnel")
+			err := service.tunnelClient.CloseTunnel()
+			if err != nil {
+				log.Error().Err(err).Msg("unable to shutdown tunnel")
+			}
 		}
 	}
 
@@ -293,12 +354,17 @@ func (service *PollService) createTunnel(encodedCredentials string, remotePort i
 
 	tunnelConfig := agent.TunnelConfig{
 		LocalAddr:         service.apiServerAddr,
-		ServerAddr:        service.tunnelServerAddr,
+		ServerAddr:        agentnet.ResolveServerAddress(service.tunnelServerAddr),
 		ServerFingerprint: service.tunnelServerFingerprint,
 		Credentials:       string(credentials),
 		RemotePort:        strconv.Itoa(remotePort),
 	}
 
+	err = faults.Fail(faults.TunnelDrop)
+	if err != nil {
+		return err
+	}
+
 	err = service.tunnelClient.CreateTunnel(tunnelConfig)
 	if err != nil {
 		return err
@@ -5,13 +5,11 @@ import (
 	"errors"
 	"time"
 
-	"github.com/portainer/agent"
 	"github.com/portainer/agent/docker"
 	"github.com/portainer/agent/edge/client"
-	portainer "github.com/portainer/portainer/api"
-	"github.com/portainer/portainer/api/edge"
+	"github.com/portainer/agent/edge/command"
+	"github.com/portainer/agent/metrics"
 
-	"github.com/mitchellh/mapstructure"
 	"github.com/rs/zerolog/log"
 )
 
@@ -20,14 +18,22 @@ const (
 	coalescingInterval = 100 * time.Millisecond
 	failSafeInterval   = time.Minute
 
-	EdgeAsyncCommandTypeConfig      EdgeAsyncCommandType = "edgeConfig"
-	EdgeAsyncCommandTypeStack       EdgeAsyncCommandType = "edgeStack"
-	EdgeAsyncCommandTypeJob         EdgeAsyncCommandType = "edgeJob"
-	EdgeAsyncCommandTypeLog         EdgeAsyncCommandType = "edgeLog"
-	EdgeAsyncCommandTypeContainer   EdgeAsyncCommandType = "container"
-	EdgeAsyncCommandTypeImage       EdgeAsyncCommandType = "image"
-	EdgeAsyncCommandTypeVolume      EdgeAsyncCommandType = "volume"
-	EdgeAsyncCommandTypeNormalStack EdgeAsyncCommandType = "normalStack"
+	EdgeAsyncCommandTypeConfig           EdgeAsyncCommandType = "edgeConfig"
+	EdgeAsyncCommandTypeStack            EdgeAsyncCommandType = "edgeStack"
+	EdgeAsyncCommandTypeJob              EdgeAsyncCommandType = "edgeJob"
+	EdgeAsyncCommandTypeLog              EdgeAsyncCommandType = "edgeLog"
+	EdgeAsyncCommandTypeContainer        EdgeAsyncCommandType = "container"
+	EdgeAsyncCommandTypeImage            EdgeAsyncCommandType = "image"
+	EdgeAsyncCommandTypeVolume           EdgeAsyncCommandType = "volume"
+	EdgeAsyncCommandTypeNormalStack      EdgeAsyncCommandType = "normalStack"
+	EdgeAsyncCommandTypeOSUpdate         EdgeAsyncCommandType = "osUpdate"
+	EdgeAsyncCommandTypeLogRemediation   EdgeAsyncCommandType = "logRemediation"
+	EdgeAsyncCommandTypeImageScan        EdgeAsyncCommandType = "imageScan"
+	EdgeAsyncCommandTypeSBOM             EdgeAsyncCommandType = "sbom"
+	EdgeAsyncCommandTypeStackTransaction EdgeAsyncCommandType = "edgeStackTransaction"
+	EdgeAsyncCommandTypeScriptHook       EdgeAsyncCommandType = "scriptHook"
+	EdgeAsyncCommandTypeNetworkPolicy    EdgeAsyncCommandType = "networkPolicy"
+	EdgeAsyncCommandTypeZRAM             EdgeAsyncCommandType = "zram"
 
 	EdgeAsyncCommandOpAdd     EdgeAsyncCommandOperation = "add"
 	EdgeAsyncCommandOpRemove  EdgeAsyncCommandOperation = "remove"
@@ -39,33 +45,6 @@ type (
 	EdgeAsyncCommandOperation string
 )
 
-type operationError struct {
-	Command   string
-	Operation string
-	Err       error
-}
-
-func newOperationError(cmd, op string, err error) error {
-	if err == nil {
-		return nil
-	}
-
-	return &operationError{
-		Command:   cmd,
-		Operation: op,
-		Err:       err,
-	}
-}
-
-func (o *operationError) Error() string {
-	return o.Err.Error()
-}
-
-func (o *operationError) Is(target error) bool {
-	_, ok := target.(*operationError)
-	return ok
-}
-
 func createTicker(interval time.Duration) *time.Ticker {
 	if interval > zeroDuration {
 		return time.NewTicker(interval)
@@ -143,13 +122,24 @@ func (service *PollService) startStatusPollLoopAsync() {
 		case <-coalescingTicker.C:
 			coalescingTicker.Stop()
 
+			// Every request fetches the commands, so that the command ticker is postponed instead of sending a
+			// separate request shortly after a ping or a snapshot
+			if service.commandInterval > zeroDuration {
+				commandFlag = true
+				service.commandTicker.Reset(service.commandInterval)
+			}
+
 			log.Debug().Bool("snapshot", snapshotFlag).Bool("command", commandFlag).Msg("sending async-poll")
 
 			err := service.pollAsync(snapshotFlag, commandFlag)
 			if err != nil {
-				log.Error().Err(err).Msg("an error occurred during async poll")
+				log.Error().Err(err).Str("connectivity_state", string(client.CurrentConnectivity().State)).Msg("an error occurred during async poll")
+				metrics.EdgePollFailed()
 			}
 
+			// The queued commands are attempted again even when the server cannot be reached
+			service.processQueuedCommands()
+
 			snapshotFlag, commandFlag, coalescingFlag = false, false, false
 
 			pingCh = service.pingTicker.C
@@ -185,8 +175,16 @@ func (service *PollService) pollAsync(doSnapshot, doCommand bool) error {
 		return err
 	}
 
+	if !status.ServerTime.IsZero() {
+		service.commandSequencer.ObserveServerTime(status.ServerTime)
+	}
+
 	service.processAsyncCommands(status.AsyncCommands)
 
+	docker.SetCollectorOverrides(status.Collectors)
+
+	service.edgeStackManager.SetPriorityClasses(status.StackPriorityClasses)
+
 	service.scheduleManager.ProcessScheduleLogsCollection()
 
 	if status.PingInterval != service.pingInterval ||
@@ -210,224 +208,86 @@ func (service *PollService) pollAsync(doSnapshot, doCommand bool) error {
 func (service *PollService) processAsyncCommands(commands []client.AsyncCommand) {
 	ctx := context.Background()
 
-	for _, command := range commands {
-		var err error
-
-		switch command.Type {
-		case "edgeStack":
-			err = service.processStackCommand(ctx, command)
-		case "edgeJob":
-			err = service.processScheduleCommand(command)
-		case "edgeLog":
-			err = service.processLogCommand(command)
-		case "container":
-			err = service.processContainerCommand(command)
-		case "image":
-			err = service.processImageCommand(command)
-		case "volume":
-			err = service.processVolumeCommand(command)
-		case "normalStack":
-			err = service.processNormalStackCommand(ctx, command)
-		case "edgeConfig":
-			err = service.processEdgeConfigCommand(command)
-		default:
-			err = newOperationError(command.Type, "n/a", errors.New("command type not supported"))
-		}
-
-		var opErr *operationError
-		if errors.As(err, &opErr) {
-			log.Error().
-				Str("command", opErr.Command).
-				Str("operation", opErr.Operation).
+	for _, cmd := range commands {
+		if err := service.commandSequencer.Accept(cmd); errors.Is(err, command.ErrFutureCommand) {
+			// The following commands are processed once the server time caught up, the last command timestamp is not
+			// moved past this command so that the server sends it again
+			log.Warn().
+				Str("command", cmd.Type).
+				Time("timestamp", cmd.Timestamp).
 				Err(err).
-				Msg("error with command operation")
-		}
-
-		service.portainerClient.SetLastCommandTimestamp(command.Timestamp)
-	}
-}
-
-func (service *PollService) processStackCommand(ctx context.Context, command client.AsyncCommand) error {
-	var stackData edge.StackPayload
-	err := mapstructure.Decode(command.Value, &stackData)
-	if err != nil {
-		return newOperationError("stack", command.Operation, err)
-	}
-
-	err = service.portainerClient.SetEdgeStackStatus(stackData.ID, portainer.EdgeStackStatusAcknowledged, stackData.RollbackTo, "")
-	if err != nil {
-		return newOperationError("stack", command.Operation, err)
-	}
+				Msg("postponing the commands stamped ahead of the server time")
 
-	switch command.Operation {
-	case "add", "replace":
-		err = service.edgeStackManager.DeployStack(ctx, stackData)
+			return
+		} else if err != nil {
+			log.Warn().
+				Str("command", cmd.Type).
+				Int("id", cmd.ID).
+				Err(err).
+				Msg("ignoring command")
 
-		if err != nil {
-			return service.portainerClient.SetEdgeStackStatus(stackData.ID, portainer.EdgeStackStatusError, stackData.RollbackTo, err.Error())
+			continue
 		}
 
-		err = service.portainerClient.SetEdgeStackStatus(stackData.ID, portainer.EdgeStackStatusDeploying, stackData.RollbackTo, "")
-		if err != nil {
-			return newOperationError("stack", command.Operation, err)
-		}
+		// The command is persisted before being acknowledged so that it is not lost when the agent stops, it is
+		// executed by processQueuedCommands
+		if service.commandQueue != nil {
+			err := service.commandQueue.Enqueue(cmd)
+			if err == nil {
+				service.portainerClient.SetLastCommandTimestamp(cmd.Timestamp)
 
-	case "remove":
-		err = service.portainerClient.SetEdgeStackStatus(stackData.ID, portainer.EdgeStackStatusRemoving, stackData.RollbackTo, "")
-		if err != nil {
-			return newOperationError("stack", command.Operation, err)
-		}
-
-		err = service.edgeStackManager.DeleteStack(ctx, stackData)
-		if err != nil {
-			return service.portainerClient.SetEdgeStackStatus(stackData.ID, portainer.EdgeStackStatusError, stackData.RollbackTo, err.Error())
-		}
+				continue
+			}
 
-		err = service.portainerClient.SetEdgeStackStatus(stackData.ID, portainer.EdgeStackStatusRemoved, stackData.RollbackTo, "")
-		if err != nil {
-			return newOperationError("stack", command.Operation, err)
+			log.Error().
+				Str("command", cmd.Type).
+				Int("id", cmd.ID).
+				Err(err).
+				Msg("unable to queue the command, executing it right away")
 		}
 
-	default:
-		return newOperationError("schedule", command.Operation, errors.New("operation not supported"))
-	}
-
-	return nil
-}
-
-func (service *PollService) processScheduleCommand(command client.AsyncCommand) error {
-	var jobData client.EdgeJobData
-	err := mapstructure.Decode(command.Value, &jobData)
-	if err != nil {
-		return newOperationError("schedule", "n/a", err)
-	}
+		service.processCommand(ctx, cmd)
 
-	schedule := agent.Schedule{
-		ID:             int(jobData.ID),
-		CronExpression: jobData.CronExpression,
-		Script:         jobData.ScriptFileContent,
-		Version:        jobData.Version,
-		CollectLogs:    jobData.CollectLogs,
+		service.portainerClient.SetLastCommandTimestamp(cmd.Timestamp)
 	}
-
-	switch command.Operation {
-	case "add", "replace":
-		err = service.scheduleManager.AddSchedule(schedule)
-
-	case "remove":
-		err = service.scheduleManager.RemoveSchedule(schedule)
-
-	default:
-		err = errors.New("operation not supported")
-	}
-
-	return newOperationError("schedule", command.Operation, err)
 }
 
-func (service *PollService) processLogCommand(command client.AsyncCommand) error {
-	var logCmd client.LogCommandData
-
-	err := mapstructure.Decode(command.Value, &logCmd)
+func (service *PollService) processCommand(ctx context.Context, cmd client.AsyncCommand) error {
+	err := service.commandRegistry.Process(ctx, cmd)
 	if err != nil {
-		return newOperationError("log", "n/a", err)
-	}
-
-	service.portainerClient.EnqueueLogCollectionForStack(logCmd)
-
-	return nil
-}
-
-func (service *PollService) processContainerCommand(command client.AsyncCommand) error {
-	var containerCmd client.ContainerCommandData
-
-	err := mapstructure.Decode(command.Value, &containerCmd)
-	if err != nil {
-		return newOperationError("container", "n/a", err)
-	}
-
-	switch containerCmd.ContainerOperation {
-	case "start":
-		err = docker.ContainerStart(containerCmd.ContainerName, containerCmd.ContainerStartOptions)
-	case "restart":
-		err = docker.ContainerRestart(containerCmd.ContainerName)
-	case "stop":
-		err = docker.ContainerStop(containerCmd.ContainerName)
-	case "delete":
-		err = docker.ContainerDelete(containerCmd.ContainerName, containerCmd.ContainerRemoveOptions)
-	case "kill":
-		err = docker.ContainerKill(containerCmd.ContainerName)
+		log.Error().
+			Str("command", cmd.Type).
+			Str("operation", cmd.Operation).
+			Err(err).
+			Msg("error with command operation")
 	}
 
-	return newOperationError("container", command.Operation, err)
+	return err
 }
 
-func (service *PollService) processImageCommand(command client.AsyncCommand) error {
-	var imageCommand client.ImageCommandData
-
-	err := mapstructure.Decode(command.Value, &imageCommand)
-	if err != nil {
-		return newOperationError("image", "n/a", errors.New("failed to decode ImageCommandData"))
-	}
-
-	switch imageCommand.ImageOperation {
-	case "delete":
-		_, err = docker.ImageDelete(imageCommand.ImageName, imageCommand.ImageRemoveOptions)
-	}
-
-	return newOperationError("image", command.Operation, err)
-}
-
-func (service *PollService) processVolumeCommand(command client.AsyncCommand) error {
-	var volumeCommand client.VolumeCommandData
-
-	err := mapstructure.Decode(command.Value, &volumeCommand)
-	if err != nil {
-		return newOperationError("volume", "n/a", err)
-	}
-
-	switch volumeCommand.VolumeOperation {
-	case "delete":
-		err = docker.VolumeDelete(volumeCommand.VolumeName, volumeCommand.ForceRemove)
+// processQueuedCommands executes the commands waiting in the offline queue, in the order they were received
+func (service *PollService) processQueuedCommands() {
+	if service.commandQueue == nil {
+		return
 	}
 
-	return newOperationError("volume", command.Operation, err)
-}
-
-func (service *PollService) processNormalStackCommand(ctx context.Context, command client.AsyncCommand) error {
-	var normalStackCommand client.NormalStackCommandData
-	err := mapstructure.Decode(command.Value, &normalStackCommand)
+	err := service.commandQueue.Process(context.Background(), service.processCommand, retryableCommand)
 	if err != nil {
-		return newOperationError("normalStack", "n/a", err)
+		log.Error().Err(err).Msg("unable to process the queued commands")
 	}
-
-	switch normalStackCommand.StackOperation {
-	case "remove":
-		err = service.edgeManager.stackManager.DeleteNormalStack(ctx, normalStackCommand.Name)
-	}
-
-	return newOperationError("normalStack", command.Operation, err)
 }
-func (service *PollService) processEdgeConfigCommand(cmd client.AsyncCommand) error {
-	var configData client.EdgeConfig
-	err := mapstructure.Decode(cmd.Value, &configData)
-	if err != nil {
-		return newOperationError("edgeConfig", cmd.Operation, err)
-	}
 
-	switch EdgeAsyncCommandOperation(cmd.Operation) {
-	case EdgeAsyncCommandOpAdd:
-		err = service.edgeManager.CreateEdgeConfig(&configData)
-	case EdgeAsyncCommandOpReplace:
-		err = service.edgeManager.UpdateEdgeConfig(&configData)
-	case EdgeAsyncCommandOpRemove:
-		err = service.edgeManager.DeleteEdgeConfig(&configData)
+// retryableCommand returns true when the failed cmd is attempted again. The stack, job and configuration commands
+// usually fail because the server cannot be reached, the other commands are only relevant when they are received.
+func retryableCommand(cmd client.AsyncCommand, err error) bool {
+	if errors.Is(err, command.ErrInvalidCommand) || errors.Is(err, command.ErrUnsupportedCommand) {
+		return false
 	}
 
-	if err == nil {
-		service.portainerClient.SetEdgeConfigState(configData.ID, client.EdgeConfigIdleState)
-	} else {
-		service.portainerClient.SetEdgeConfigState(configData.ID, client.EdgeConfigFailureState)
+	switch EdgeAsyncCommandType(cmd.Type) {
+	case EdgeAsyncCommandTypeStack, EdgeAsyncCommandTypeJob, EdgeAsyncCommandTypeConfig, EdgeAsyncCommandTypeNormalStack, EdgeAsyncCommandTypeStackTransaction:
+		return true
 	}
 
-	return newOperationError("edgeConfig", cmd.Operation, err)
+	return false
 }
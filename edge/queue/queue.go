@@ -0,0 +1,297 @@
+package queue
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/portainer/agent/crypto"
+	"github.com/portainer/agent/edge/client"
+
+	"github.com/rs/zerolog/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// DefaultMaxAttempts is the number of times a command is executed before being dropped
+	DefaultMaxAttempts = 5
+	// initialRetryDelay is the delay before the second attempt of a command, doubled after each failed attempt
+	initialRetryDelay = 30 * time.Second
+	maxRetryDelay     = 30 * time.Minute
+	openTimeout       = time.Second
+)
+
+var (
+	commandsBucket = []byte("commands")
+	resultsBucket  = []byte("results")
+	pendingDataKey = []byte("pendingData")
+)
+
+// Handler executes a command, the command is attempted again later when the returned error is retryable
+type Handler func(ctx context.Context, cmd client.AsyncCommand) error
+
+// entry is a command waiting in the queue
+type entry struct {
+	Command     client.AsyncCommand `json:"command"`
+	Attempts    int                 `json:"attempts"`
+	NextAttempt time.Time           `json:"nextAttempt"`
+	LastError   string              `json:"lastError,omitempty"`
+}
+
+// Queue is a persistent queue of the commands received from the Portainer server, executed in the order they were
+// received. It survives the restarts of the agent so that the commands received by a device that goes offline are
+// not lost, and it also keeps the results waiting to be sent to the server.
+type Queue struct {
+	db          *bolt.DB
+	maxAttempts int
+}
+
+// Open opens or creates the queue stored in the BoltDB database at path, a command is dropped after maxAttempts
+// failed attempts
+func Open(path string, maxAttempts int) (*Queue, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(commandsBucket); err != nil {
+			return err
+		}
+
+		_, err := tx.CreateBucketIfNotExists(resultsBucket)
+
+		return err
+	})
+	if err != nil {
+		db.Close()
+
+		return nil, err
+	}
+
+	if maxAttempts < 1 {
+		maxAttempts = DefaultMaxAttempts
+	}
+
+	return &Queue{db: db, maxAttempts: maxAttempts}, nil
+}
+
+// Close closes the database of the queue
+func (queue *Queue) Close() error {
+	return queue.db.Close()
+}
+
+// Enqueue appends cmd to the queue. A command already in the queue, sent again by the server because the agent
+// restarted before acknowledging it, is ignored.
+func (queue *Queue) Enqueue(cmd client.AsyncCommand) error {
+	return queue.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(commandsBucket)
+
+		c := bucket.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var e entry
+			if err := decodeEntry(v, &e); err != nil {
+				continue
+			}
+
+			if e.Command.ID == cmd.ID && e.Command.Timestamp.Equal(cmd.Timestamp) {
+				return nil
+			}
+		}
+
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		data, err := encodeEntry(&entry{Command: cmd})
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(sequenceKey(seq), data)
+	})
+}
+
+// Len returns the number of commands waiting in the queue
+func (queue *Queue) Len() int {
+	n := 0
+
+	queue.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(commandsBucket).Stats().KeyN
+
+		return nil
+	})
+
+	return n
+}
+
+// Process executes the commands of the queue in order with handler. A command is removed from the queue once it
+// succeeded, failed with an error that is not retryable, or failed maxAttempts times. A command that failed with a
+// retryable error is attempted again after a growing delay, the following commands wait for it so that the
+// commands are always executed in order.
+func (queue *Queue) Process(ctx context.Context, handler Handler, retryable func(cmd client.AsyncCommand, err error) bool) error {
+	for ctx.Err() == nil {
+		key, e, err := queue.head()
+		if err != nil || e == nil {
+			return err
+		}
+
+		if time.Now().Before(e.NextAttempt) {
+			return nil
+		}
+
+		err = handler(ctx, e.Command)
+		e.Attempts++
+
+		if err == nil || !retryable(e.Command, err) || e.Attempts >= queue.maxAttempts {
+			if err != nil {
+				log.Warn().
+					Str("command", e.Command.Type).
+					Int("id", e.Command.ID).
+					Int("attempts", e.Attempts).
+					Err(err).
+					Msg("dropping the queued command")
+			}
+
+			if err := queue.remove(key); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		e.LastError = err.Error()
+		e.NextAttempt = time.Now().Add(retryDelay(e.Attempts))
+
+		log.Info().
+			Str("command", e.Command.Type).
+			Int("id", e.Command.ID).
+			Int("attempts", e.Attempts).
+			Time("next_attempt", e.NextAttempt).
+			Err(err).
+			Msg("the queued command will be attempted again")
+
+		return queue.update(key, e)
+	}
+
+	return ctx.Err()
+}
+
+// SavePendingData persists the results waiting to be sent to the server, they are removed when data is empty
+func (queue *Queue) SavePendingData(data []byte) error {
+	if len(data) > 0 {
+		var err error
+
+		data, err = crypto.EncryptState(data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return queue.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(resultsBucket)
+		if len(data) == 0 {
+			return bucket.Delete(pendingDataKey)
+		}
+
+		return bucket.Put(pendingDataKey, data)
+	})
+}
+
+// LoadPendingData returns the results persisted by SavePendingData, nil when there are none
+func (queue *Queue) LoadPendingData() ([]byte, error) {
+	var data []byte
+
+	err := queue.db.View(func(tx *bolt.Tx) error {
+		// the value is only valid during the transaction
+		if v := tx.Bucket(resultsBucket).Get(pendingDataKey); v != nil {
+			data = append([]byte{}, v...)
+		}
+
+		return nil
+	})
+	if err != nil || data == nil {
+		return data, err
+	}
+
+	return crypto.DecryptState(data)
+}
+
+func (queue *Queue) head() ([]byte, *entry, error) {
+	var key []byte
+	var e *entry
+
+	err := queue.db.View(func(tx *bolt.Tx) error {
+		k, v := tx.Bucket(commandsBucket).Cursor().First()
+		if k == nil {
+			return nil
+		}
+
+		key = append([]byte{}, k...)
+		e = &entry{}
+
+		return decodeEntry(v, e)
+	})
+
+	return key, e, err
+}
+
+func (queue *Queue) update(key []byte, e *entry) error {
+	data, err := encodeEntry(e)
+	if err != nil {
+		return err
+	}
+
+	return queue.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(commandsBucket).Put(key, data)
+	})
+}
+
+func (queue *Queue) remove(key []byte) error {
+	return queue.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(commandsBucket).Delete(key)
+	})
+}
+
+// encodeEntry returns the entry persisted in the database, encrypted when the state encryption is enabled
+func encodeEntry(e *entry) ([]byte, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+
+	return crypto.EncryptState(data)
+}
+
+func decodeEntry(data []byte, e *entry) error {
+	data, err := crypto.DecryptState(data)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, e)
+}
+
+// retryDelay returns the delay before the next attempt of a command that failed attempts times
+func retryDelay(attempts int) time.Duration {
+	delay := initialRetryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+
+	return delay
+}
+
+// sequenceKey returns the key of the n-th command, the keys are sorted in the order the commands were enqueued
+func sequenceKey(n uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, n)
+
+	return key
+}
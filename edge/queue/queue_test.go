@@ -0,0 +1,186 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/portainer/agent/crypto"
+	"github.com/portainer/agent/edge/client"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func openTestQueue(t *testing.T, maxAttempts int) *Queue {
+	queue, err := Open(filepath.Join(t.TempDir(), "queue.db"), maxAttempts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { queue.Close() })
+
+	return queue
+}
+
+func TestQueue_ProcessInOrder(t *testing.T) {
+	queue := openTestQueue(t, 3)
+	timestamp := time.Now()
+
+	for id := 1; id <= 3; id++ {
+		if err := queue.Enqueue(client.AsyncCommand{ID: id, Timestamp: timestamp}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a command sent again by the server is not queued twice
+	if err := queue.Enqueue(client.AsyncCommand{ID: 2, Timestamp: timestamp}); err != nil {
+		t.Fatal(err)
+	}
+
+	if queue.Len() != 3 {
+		t.Fatalf("expected 3 queued commands, got %d", queue.Len())
+	}
+
+	var processed []int
+	err := queue.Process(context.Background(), func(ctx context.Context, cmd client.AsyncCommand) error {
+		processed = append(processed, cmd.ID)
+
+		return nil
+	}, func(cmd client.AsyncCommand, err error) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(processed) != 3 || processed[0] != 1 || processed[1] != 2 || processed[2] != 3 {
+		t.Fatalf("expected the commands to be processed in order, got %v", processed)
+	}
+
+	if queue.Len() != 0 {
+		t.Fatalf("expected an empty queue, got %d commands", queue.Len())
+	}
+}
+
+func TestQueue_ProcessRetries(t *testing.T) {
+	queue := openTestQueue(t, 2)
+
+	queue.Enqueue(client.AsyncCommand{ID: 1, Type: "edgeStack"})
+	queue.Enqueue(client.AsyncCommand{ID: 2, Type: "container"})
+
+	offline := errors.New("offline")
+	attempts := map[int]int{}
+	handler := func(ctx context.Context, cmd client.AsyncCommand) error {
+		attempts[cmd.ID]++
+
+		return offline
+	}
+	retryable := func(cmd client.AsyncCommand, err error) bool { return cmd.Type == "edgeStack" }
+
+	if err := queue.Process(context.Background(), handler, retryable); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first command is kept for a retry and blocks the following one
+	if attempts[1] != 1 || attempts[2] != 0 || queue.Len() != 2 {
+		t.Fatalf("expected the first command to wait for a retry, got %v attempts and %d queued commands", attempts, queue.Len())
+	}
+
+	key, e, err := queue.head()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e.NextAttempt = time.Time{}
+	queue.update(key, e)
+
+	if err := queue.Process(context.Background(), handler, retryable); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first command reached the maximum number of attempts, the second one is not retryable
+	if attempts[1] != 2 || attempts[2] != 1 || queue.Len() != 0 {
+		t.Fatalf("expected the commands to be dropped, got %v attempts and %d queued commands", attempts, queue.Len())
+	}
+}
+
+func TestQueue_PendingData(t *testing.T) {
+	queue := openTestQueue(t, 0)
+
+	if err := queue.SavePendingData([]byte(`{"jobsStatus":{}}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := queue.LoadPendingData()
+	if err != nil || string(data) != `{"jobsStatus":{}}` {
+		t.Fatalf("unexpected pending data %s, %v", data, err)
+	}
+
+	queue.SavePendingData(nil)
+
+	data, _ = queue.LoadPendingData()
+	if data != nil {
+		t.Fatalf("expected the pending data to be removed, got %s", data)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	if retryDelay(1) != initialRetryDelay || retryDelay(3) != 4*initialRetryDelay || retryDelay(20) != maxRetryDelay {
+		t.Fatalf("unexpected retry delays %s, %s, %s", retryDelay(1), retryDelay(3), retryDelay(20))
+	}
+}
+
+func TestQueue_EncryptedState(t *testing.T) {
+	stateCipher, err := crypto.LoadOrCreateStateCipher(filepath.Join(t.TempDir(), "agent_state_key.json"), "machine-secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queue := openTestQueue(t, 3)
+
+	// a command queued before the encryption was enabled is still processed
+	if err := queue.Enqueue(client.AsyncCommand{ID: 1, Timestamp: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	crypto.EnableStateEncryption(stateCipher)
+	defer crypto.EnableStateEncryption(nil)
+
+	if err := queue.Enqueue(client.AsyncCommand{ID: 2, Timestamp: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := queue.SavePendingData([]byte("results")); err != nil {
+		t.Fatal(err)
+	}
+
+	queue.db.View(func(tx *bolt.Tx) error {
+		if !crypto.IsEncryptedState(tx.Bucket(commandsBucket).Get(sequenceKey(2))) {
+			t.Error("expected the command to be encrypted")
+		}
+
+		if !crypto.IsEncryptedState(tx.Bucket(resultsBucket).Get(pendingDataKey)) {
+			t.Error("expected the pending results to be encrypted")
+		}
+
+		return nil
+	})
+
+	data, err := queue.LoadPendingData()
+	if err != nil || string(data) != "results" {
+		t.Fatalf("expected the pending results to be decrypted, got %q (%v)", data, err)
+	}
+
+	var processed []int
+	err = queue.Process(context.Background(), func(ctx context.Context, cmd client.AsyncCommand) error {
+		processed = append(processed, cmd.ID)
+
+		return nil
+	}, func(cmd client.AsyncCommand, err error) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(processed) != 2 || processed[0] != 1 || processed[1] != 2 {
+		t.Fatalf("expected both commands to be processed, got %v", processed)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/portainer/agent"
 	"github.com/portainer/agent/edge"
 	"github.com/portainer/agent/edge/aws"
+	"github.com/portainer/agent/registryauth"
 	httperror "github.com/portainer/portainer/pkg/libhttp/error"
 	"github.com/portainer/portainer/pkg/libhttp/request"
 	"github.com/portainer/portainer/pkg/libhttp/response"
@@ -94,6 +95,16 @@ func (handler *Handler) LookupHandler(rw http.ResponseWriter, r *http.Request) *
 		}
 	}
 
+	// The registries without static credentials fall back to the Docker credential helpers configured on the agent
+	c, err := registryauth.Lookup(serverUrl)
+	if err != nil && !errors.Is(err, registryauth.ErrNoCredentials) {
+		return httperror.InternalServerError("Unable to retrieve credentials from the credential helper", err)
+	}
+
+	if c != nil {
+		return response.JSON(rw, c)
+	}
+
 	return response.Empty(rw)
 }
 
@@ -2,6 +2,9 @@ package scheduler
 
 import (
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
 
 	"github.com/portainer/agent"
 	"github.com/portainer/agent/edge/client"
@@ -59,6 +62,8 @@ func (manager *LogsManager) loop() {
 				JobID:          jobID,
 				LogFileContent: string(file),
 			}
+			edgeJobStatus.ExitCode, edgeJobStatus.FinishedAt = readExitCode(jobID)
+
 			err = manager.portainerClient.SetEdgeJobStatus(edgeJobStatus)
 			if err != nil {
 				log.Error().Err(err).Msg("failed sending log file to portainer")
@@ -74,3 +79,32 @@ func (manager *LogsManager) HandleReceivedLogsRequests(jobs []int) {
 		manager.jobsCh <- jobs
 	}
 }
+
+func exitFilePath(jobID int) string {
+	return fmt.Sprintf("%s%s/schedule_%d.exit", agent.HostRoot, agent.ScheduleScriptDirectory, jobID)
+}
+
+// readExitCode returns the exit code of the last run of the job and the Unix time at which it finished, the exit code
+// is nil when the job has not run yet
+func readExitCode(jobID int) (*int, int64) {
+	path := exitFilePath(jobID)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, 0
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0
+	}
+
+	exitCode, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		log.Debug().Err(err).Int("job_identifier", jobID).Msg("unable to parse the exit code of the job")
+
+		return nil, 0
+	}
+
+	return &exitCode, info.ModTime().Unix()
+}
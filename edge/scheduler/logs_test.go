@@ -15,9 +15,11 @@ func TestDataRace(t *testing.T) {
 		func() portainer.EndpointID { return 1 },
 		"edgeID",
 		false,
+		false,
 		agent.PlatformDocker,
 		agent.EdgeMetaFields{},
-		client.BuildHTTPClient(10, &agent.Options{}),
+		client.BuildHTTPClient(10, &agent.Options{}, nil, nil, nil),
+		nil,
 	)
 
 	m := NewLogsManager(cli)
@@ -5,8 +5,13 @@ package scheduler
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/portainer/agent"
 	"github.com/portainer/agent/filesystem"
@@ -18,22 +23,76 @@ const (
 	cronDirectory = "/etc/cron.d"
 	cronFile      = "portainer_agent"
 	cronJobUser   = "root"
+	// defaultContainerInterpreter runs the scripts in the ephemeral containers when the schedule has no interpreter,
+	// the interpreter of the shebang might not exist in the image
+	defaultContainerInterpreter = "/bin/sh"
 )
 
+// safeArgument matches the interpreters and images that can be written in the cron file without being interpreted
+// by the shell
+var safeArgument = regexp.MustCompile(`^[A-Za-z0-9_./:@+=-]+$`)
+
 // CronManager is a service that manage schedules by creating a new entry inside the host filesystem under
 // the /etc/cron.d folder.
 type CronManager struct {
 	logsManager      *LogsManager
 	cronFileExists   bool
 	managedSchedules map[int]agent.Schedule
+	// statePath is the file persisting the managed schedules, so that the schedules received as async commands are
+	// not dropped from the cron file when it is written again after a restart
+	statePath string
+	// reportedRuns is the end of the last run reported for each schedule
+	reportedRuns map[int]time.Time
+	started      time.Time
 }
 
-// NewCronManager returns a pointer to a new instance of CronManager.
-func NewCronManager(logsManager *LogsManager) *CronManager {
-	return &CronManager{
+// NewCronManager returns a pointer to a new instance of CronManager, the schedules persisted in the data folder are
+// managed again.
+func NewCronManager(logsManager *LogsManager, dataPath string) *CronManager {
+	manager := &CronManager{
 		logsManager:      logsManager,
 		cronFileExists:   false,
 		managedSchedules: make(map[int]agent.Schedule),
+		statePath:        path.Join(dataPath, agent.ScheduleFileName),
+		reportedRuns:     make(map[int]time.Time),
+		started:          time.Now(),
+	}
+
+	err := manager.loadSchedules()
+	if err != nil {
+		log.Warn().Err(err).Msg("unable to load the persisted schedules")
+	}
+
+	return manager
+}
+
+func (manager *CronManager) loadSchedules() error {
+	content, err := os.ReadFile(manager.statePath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	schedules := map[int]agent.Schedule{}
+	if err := json.Unmarshal(content, &schedules); err != nil {
+		return err
+	}
+
+	manager.managedSchedules = schedules
+	manager.cronFileExists = len(schedules) > 0
+
+	return nil
+}
+
+func (manager *CronManager) saveSchedules() {
+	content, err := json.Marshal(manager.managedSchedules)
+	if err == nil {
+		err = os.WriteFile(manager.statePath, content, 0600)
+	}
+
+	if err != nil {
+		log.Warn().Err(err).Msg("unable to persist the schedules")
 	}
 }
 
@@ -102,6 +161,8 @@ func (manager *CronManager) Schedule(schedules []agent.Schedule) error {
 
 func (manager *CronManager) removeCronFile() error {
 	manager.managedSchedules = map[int]agent.Schedule{}
+	manager.saveSchedules()
+
 	if manager.cronFileExists {
 		log.Debug().Msg("no schedules available, removing cron file")
 
@@ -145,6 +206,7 @@ func (manager *CronManager) flushEntries(schedules map[int]agent.Schedule) error
 
 	manager.cronFileExists = true
 	manager.managedSchedules = schedules
+	manager.saveSchedules()
 
 	return nil
 }
@@ -161,17 +223,49 @@ func createCronEntry(schedule *agent.Schedule) (string, error) {
 	}
 
 	cronExpression := schedule.CronExpression
-	command := fmt.Sprintf("%s/schedule_%d", agent.ScheduleScriptDirectory, schedule.ID)
+	script := fmt.Sprintf("%s/schedule_%d", agent.ScheduleScriptDirectory, schedule.ID)
 	logFile := fmt.Sprintf("%s/schedule_%d.log", agent.ScheduleScriptDirectory, schedule.ID)
+	exitFile := fmt.Sprintf("%s/schedule_%d.exit", agent.ScheduleScriptDirectory, schedule.ID)
+
+	command, err := scheduleCommand(schedule, script)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s %s %s > %s 2>&1; echo $? > %s", cronExpression, cronJobUser, command, logFile, exitFile), nil
+}
+
+// scheduleCommand returns the command running the script with the interpreter of the schedule, in an ephemeral
+// container when the schedule has an image
+func scheduleCommand(schedule *agent.Schedule, script string) (string, error) {
+	interpreter := strings.Fields(schedule.Interpreter)
+
+	for _, arg := range append([]string{schedule.Image}, interpreter...) {
+		if arg != "" && !safeArgument.MatchString(arg) {
+			return "", fmt.Errorf("invalid interpreter or image: %q", arg)
+		}
+	}
+
+	if schedule.Image == "" {
+		return strings.Join(append(interpreter, script), " "), nil
+	}
+
+	if len(interpreter) == 0 {
+		interpreter = []string{defaultContainerInterpreter}
+	}
 
-	return fmt.Sprintf("%s %s %s > %s 2>&1", cronExpression, cronJobUser, command, logFile), nil
+	// the name of the container prevents two runs of the schedule from overlapping
+	return fmt.Sprintf("docker run --rm --name portainer_schedule_%d -v %s:%s:ro %s %s",
+		schedule.ID, script, script, schedule.Image, strings.Join(append(interpreter, script), " ")), nil
 }
 
+// ProcessScheduleLogsCollection sends the logs requested by Portainer, and the logs and exit codes of the runs that
+// finished since the last call
 func (manager *CronManager) ProcessScheduleLogsCollection() {
 	logsToCollect := []int{}
 
 	for _, schedule := range manager.managedSchedules {
-		if schedule.CollectLogs {
+		if schedule.CollectLogs || manager.runFinished(schedule.ID) {
 			logsToCollect = append(logsToCollect, schedule.ID)
 			schedule.CollectLogs = false
 		}
@@ -180,6 +274,28 @@ func (manager *CronManager) ProcessScheduleLogsCollection() {
 	manager.logsManager.HandleReceivedLogsRequests(logsToCollect)
 }
 
+// runFinished returns true when a run of the schedule finished since the last reported run, or since the start of the
+// agent
+func (manager *CronManager) runFinished(scheduleID int) bool {
+	info, err := os.Stat(exitFilePath(scheduleID))
+	if err != nil {
+		return false
+	}
+
+	reported, ok := manager.reportedRuns[scheduleID]
+	if !ok {
+		reported = manager.started
+	}
+
+	if !info.ModTime().After(reported) {
+		return false
+	}
+
+	manager.reportedRuns[scheduleID] = info.ModTime()
+
+	return true
+}
+
 func (manager *CronManager) AddSchedule(schedule agent.Schedule) error {
 	manager.managedSchedules[schedule.ID] = schedule
 
@@ -0,0 +1,53 @@
+//go:build !windows
+// +build !windows
+
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/portainer/agent"
+)
+
+func TestScheduleCommand(t *testing.T) {
+	script := "/opt/portainer/scripts/schedule_1"
+
+	tests := []struct {
+		schedule agent.Schedule
+		expected string
+	}{
+		{agent.Schedule{ID: 1}, script},
+		{agent.Schedule{ID: 1, Interpreter: "python3 -u"}, "python3 -u " + script},
+		{agent.Schedule{ID: 1, Image: "alpine:3.19"}, "docker run --rm --name portainer_schedule_1 -v " + script + ":" + script + ":ro alpine:3.19 /bin/sh " + script},
+	}
+
+	for _, test := range tests {
+		command, err := scheduleCommand(&test.schedule, script)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if command != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, command)
+		}
+	}
+
+	for _, schedule := range []agent.Schedule{{Interpreter: "sh; reboot"}, {Image: "alpine $(id)"}} {
+		if _, err := scheduleCommand(&schedule, script); err == nil {
+			t.Errorf("expected %+v to be rejected", schedule)
+		}
+	}
+}
+
+func TestCronManagerPersistsSchedules(t *testing.T) {
+	dataPath := t.TempDir()
+
+	manager := NewCronManager(nil, dataPath)
+	manager.managedSchedules = map[int]agent.Schedule{3: {ID: 3, CronExpression: "0 * * * *", Version: 2}}
+	manager.saveSchedules()
+
+	manager = NewCronManager(nil, dataPath)
+	if schedule, ok := manager.managedSchedules[3]; !ok || schedule.Version != 2 || !manager.cronFileExists {
+		t.Fatalf("expected the persisted schedule to be loaded, got %+v", manager.managedSchedules)
+	}
+}
@@ -8,7 +8,7 @@ import "github.com/portainer/agent"
 type CronManager struct {
 }
 
-func NewCronManager(logsManager *LogsManager) *CronManager {
+func NewCronManager(logsManager *LogsManager, dataPath string) *CronManager {
 	return &CronManager{}
 }
 
@@ -0,0 +1,72 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/portainer/agent/drift"
+
+	"github.com/rs/zerolog/log"
+)
+
+// driftDetectionInterval is the interval at which the deployed stacks are compared to their stack file
+const driftDetectionInterval = 5 * time.Minute
+
+// driftDetectionLoop periodically compares the containers and services of the deployed stacks to their stack file
+// until stopSignal is closed
+func (manager *StackManager) driftDetectionLoop(stopSignal chan struct{}) {
+	ticker := time.NewTicker(driftDetectionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			manager.detectDrift(context.TODO())
+		case <-stopSignal:
+			return
+		}
+	}
+}
+
+// detectDrift records the drift report of each deployed stack, reported in the snapshots
+func (manager *StackManager) detectDrift(ctx context.Context) {
+	manager.mu.Lock()
+
+	if manager.engineType != EngineTypeDockerStandalone && manager.engineType != EngineTypeDockerSwarm {
+		manager.mu.Unlock()
+		return
+	}
+
+	swarm := manager.engineType == EngineTypeDockerSwarm
+
+	stacks := make([]edgeStack, 0, len(manager.stacks))
+	for _, stack := range manager.stacks {
+		if stack.Status == StatusDeployed {
+			stacks = append(stacks, *stack)
+		}
+	}
+
+	manager.mu.Unlock()
+
+	for _, stack := range stacks {
+		content, err := os.ReadFile(filepath.Join(SuccessStackFileFolder(stack.FileFolder), stack.FileName))
+		if err != nil {
+			log.Warn().Err(err).Int("stack_identifier", stack.ID).Msg("unable to read the deployed stack file")
+
+			continue
+		}
+
+		report := drift.Detect(ctx, stack.ID, stack.Name, fmt.Sprintf("edge_%s", stack.Name), string(content), swarm)
+		if report.Drifted {
+			log.Warn().
+				Int("stack_identifier", stack.ID).
+				Int("differences", len(report.Diffs)).
+				Msg("stack drifted from its stack file")
+		}
+
+		drift.SetReport(report)
+	}
+}
@@ -0,0 +1,81 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/portainer/agent/docker"
+	portainer "github.com/portainer/portainer/api"
+
+	"github.com/rs/zerolog/log"
+)
+
+// healthGateEnabled returns true when the deployments are only successful once the services pass their health gate
+func (manager *StackManager) healthGateEnabled() bool {
+	if manager.agentOptions.HealthGateWindow <= 0 {
+		return false
+	}
+
+	return manager.engineType == EngineTypeDockerStandalone || manager.engineType == EngineTypeDockerSwarm
+}
+
+// checkHealthGate reports the deployment of the stack as successful once all its services pass their health gate,
+// or as failed when a service fails its gate or does not pass it before the end of the window. It returns false
+// while the gate is pending.
+func (manager *StackManager) checkHealthGate(ctx context.Context, stackName string, stack *edgeStack) (bool, error) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	var gates []docker.ServiceHealthGate
+	var err error
+
+	minUptime := manager.agentOptions.HealthGateMinUptime
+	if manager.engineType == EngineTypeDockerSwarm {
+		gates, err = docker.GetSwarmStackHealthGates(ctx, stackName, minUptime)
+	} else {
+		gates, err = docker.GetComposeStackHealthGates(ctx, stackName, minUptime)
+	}
+
+	expired := time.Now().After(stack.HealthGateDeadline)
+	if err != nil && !expired {
+		return false, err
+	}
+
+	var blocking *docker.ServiceHealthGate
+	for i, gate := range gates {
+		if gate.State == docker.HealthGateFailed {
+			blocking = &gates[i]
+			break
+		}
+
+		if gate.State == docker.HealthGatePending && blocking == nil {
+			blocking = &gates[i]
+		}
+	}
+
+	var message string
+	switch {
+	case err != nil:
+		message = fmt.Sprintf("unable to check the health gate of the services: %s", err)
+	case blocking == nil:
+		log.Debug().Int("stack_identifier", int(stack.ID)).Msg("stack passed its health gate")
+
+		stack.Status = StatusDeployed
+		manager.markKnownGood(stack)
+		manager.startProbes(stack)
+		docker.RemoveStartFailures(int(stack.ID))
+
+		return true, manager.portainerClient.SetEdgeStackStatus(int(stack.ID), portainer.EdgeStackStatusRunning, stack.RollbackTo, "")
+	case blocking.State == docker.HealthGateFailed:
+		message = fmt.Sprintf("service %s failed its health gate: %s", blocking.Service, blocking.Reason)
+	case !expired:
+		return false, nil
+	default:
+		message = fmt.Sprintf("service %s did not pass its health gate within %s: %s", blocking.Service, manager.agentOptions.HealthGateWindow, blocking.Reason)
+	}
+
+	log.Error().Int("stack_identifier", int(stack.ID)).Msg(message)
+
+	return true, manager.failDeployment(ctx, stack, stackName, message)
+}
@@ -0,0 +1,160 @@
+package stack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	portainer "github.com/portainer/portainer/api"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Edge stack hooks, the scripts are bundled with the stack files in the hooks folder and named after the hook
+// (e.g. .portainer/hooks/pre-deploy.sh)
+const (
+	hookPreDeploy  = "pre-deploy"
+	hookPostDeploy = "post-deploy"
+	hookPreRemove  = "pre-remove"
+
+	hooksFolder = ".portainer/hooks"
+
+	// maxHookOutputSize is the maximum size of the end of the output of a failed hook reported in the stack status
+	maxHookOutputSize = 2048
+
+	// hookWaitDelay is the time the output of a hook killed on timeout is still read for, the processes started by the
+	// script can keep it open
+	hookWaitDelay = time.Second
+)
+
+// stackHook is the script of a hook of a stack, it is prepared with the lock of the manager held and run without it
+type stackHook struct {
+	stackID int
+	name    string
+	script  string
+	folder  string
+	env     []string
+	timeout time.Duration
+}
+
+// prepareHook returns the script of the hook bundled in the folder of the stack files, nil when the hooks are disabled
+// or the stack has no script for the hook. It must be called with the lock of the manager held.
+func (manager *StackManager) prepareHook(stack *edgeStack, folder, hook string) (*stackHook, error) {
+	if !manager.agentOptions.StackHooks {
+		return nil, nil
+	}
+
+	script := filepath.Join(folder, hooksFolder, hook+".sh")
+
+	_, err := os.Stat(script)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &stackHook{
+		stackID: int(stack.ID),
+		name:    hook,
+		script:  script,
+		folder:  folder,
+		env:     hookEnv(stack, hook),
+		timeout: manager.agentOptions.StackHookTimeout,
+	}, nil
+}
+
+// hookEnv returns the environment of the script of a hook, the hooks do not inherit the environment of the agent, which
+// contains its secrets, they only get the PATH, the environment variables of the stack and the EDGE_STACK_ variables
+// describing the stack
+func hookEnv(stack *edgeStack, hook string) []string {
+	env := []string{"PATH=" + os.Getenv("PATH")}
+	env = append(env, buildEnvVarsForDeployer(stack.EnvVars)...)
+
+	return append(env,
+		fmt.Sprintf("EDGE_STACK_ID=%d", stack.ID),
+		fmt.Sprintf("EDGE_STACK_NAME=%s", stack.Name),
+		fmt.Sprintf("EDGE_STACK_VERSION=%d", stack.Version),
+		fmt.Sprintf("EDGE_STACK_HOOK=%s", hook),
+	)
+}
+
+// run executes the script of the hook with sh from the folder of the stack files, a nil hook is a no-op
+func (hook *stackHook) run(ctx context.Context) error {
+	if hook == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, hook.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", hook.script)
+	cmd.Dir = hook.folder
+	cmd.Env = hook.env
+	cmd.WaitDelay = hookWaitDelay
+
+	output, err := cmd.CombinedOutput()
+
+	log.Debug().
+		Int("stack_identifier", hook.stackID).
+		Str("hook", hook.name).
+		Str("output", string(output)).
+		Msg("stack hook executed")
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", hook.timeout)
+	}
+
+	if err != nil {
+		if len(output) > maxHookOutputSize {
+			output = output[len(output)-maxHookOutputSize:]
+		}
+
+		return fmt.Errorf("%s hook failed: %w, output: %s", hook.name, err, output)
+	}
+
+	return nil
+}
+
+// runHook runs the script of the hook bundled in the folder of the stack files, when the hooks are enabled. It must be
+// called without the lock of the manager, which is only held while the hook is prepared.
+func (manager *StackManager) runHook(ctx context.Context, stack *edgeStack, folder, hook string) error {
+	manager.mu.Lock()
+	prepared, err := manager.prepareHook(stack, folder, hook)
+	manager.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return prepared.run(ctx)
+}
+
+// runDeploymentHook runs a deployment hook and sends the error status of the stack when it fails, it must be called
+// without the lock of the manager
+func (manager *StackManager) runDeploymentHook(ctx context.Context, stack *edgeStack, hook string) error {
+	manager.mu.Lock()
+	folder := stack.FileFolder
+	manager.mu.Unlock()
+
+	err := manager.runHook(ctx, stack, folder, hook)
+	if err == nil {
+		return nil
+	}
+
+	log.Error().Err(err).Int("stack_identifier", int(stack.ID)).Msg("stack hook failed")
+
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	stack.Status = StatusError
+
+	statusUpdateErr := manager.portainerClient.SetEdgeStackStatus(int(stack.ID), portainer.EdgeStackStatusError, stack.RollbackTo, err.Error())
+	if statusUpdateErr != nil {
+		log.Error().Err(statusUpdateErr).Msg("unable to update Edge stack status")
+	}
+
+	return err
+}
@@ -0,0 +1,239 @@
+package stack
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/portainer/agent"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/portainer/portainer/api/edge"
+)
+
+// statusUpdate is a status of an Edge stack sent to the server
+type statusUpdate struct {
+	stackID    int
+	status     portainer.EdgeStackStatusType
+	rollbackTo *int
+	message    string
+}
+
+// fakePortainerClient records the statuses of the Edge stacks sent to the server
+type fakePortainerClient struct {
+	mu       sync.Mutex
+	statuses []statusUpdate
+}
+
+func (c *fakePortainerClient) GetEdgeStackConfig(edgeStackID int, version *int) (*edge.StackPayload, error) {
+	return nil, os.ErrNotExist
+}
+
+func (c *fakePortainerClient) SetEdgeStackStatus(edgeStackID int, edgeStackStatus portainer.EdgeStackStatusType, rollbackTo *int, error string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.statuses = append(c.statuses, statusUpdate{stackID: edgeStackID, status: edgeStackStatus, rollbackTo: rollbackTo, message: error})
+
+	return nil
+}
+
+func (c *fakePortainerClient) lastStatus() (statusUpdate, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.statuses) == 0 {
+		return statusUpdate{}, false
+	}
+
+	return c.statuses[len(c.statuses)-1], true
+}
+
+func newTestManager(t *testing.T, options *agent.Options) (*StackManager, *fakePortainerClient) {
+	t.Helper()
+
+	if options.DataPath == "" {
+		options.DataPath = t.TempDir()
+	}
+
+	cli := &fakePortainerClient{}
+
+	return NewStackManager(cli, "", nil, options), cli
+}
+
+// writeHook writes the script of the hook in the hooks folder of folder
+func writeHook(t *testing.T, folder, hook, script string) {
+	t.Helper()
+
+	path := filepath.Join(folder, hooksFolder, hook+".sh")
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(path, []byte(script), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newHookStack(folder string) *edgeStack {
+	return &edgeStack{
+		StackPayload: edge.StackPayload{
+			ID:      7,
+			Name:    "web",
+			Version: 3,
+			EnvVars: []portainer.Pair{{Name: "STACK_MODE", Value: "production"}},
+		},
+		FileFolder: folder,
+		Status:     StatusDeploying,
+	}
+}
+
+func TestRunHook(t *testing.T) {
+	folder := t.TempDir()
+	manager, _ := newTestManager(t, &agent.Options{StackHooks: true, StackHookTimeout: 5 * time.Second})
+	stack := newHookStack(folder)
+
+	writeHook(t, folder, hookPreDeploy, "echo ok > hook.out\n")
+	writeHook(t, folder, hookPostDeploy, "echo failing output\nexit 3\n")
+
+	err := manager.runHook(context.Background(), stack, folder, hookPreDeploy)
+	if err != nil {
+		t.Fatalf("expected the hook to succeed, got %v", err)
+	}
+
+	if output, _ := os.ReadFile(filepath.Join(folder, "hook.out")); string(output) != "ok\n" {
+		t.Errorf("expected the hook to run from the stack folder, got %q", output)
+	}
+
+	err = manager.runHook(context.Background(), stack, folder, hookPostDeploy)
+	if err == nil || !strings.Contains(err.Error(), "exit status 3") || !strings.Contains(err.Error(), "failing output") {
+		t.Errorf("expected the exit status and the output of the failed hook, got %v", err)
+	}
+
+	err = manager.runHook(context.Background(), stack, folder, hookPreRemove)
+	if err != nil {
+		t.Errorf("expected a missing hook to be skipped, got %v", err)
+	}
+
+	manager.agentOptions.StackHooks = false
+
+	err = manager.runHook(context.Background(), stack, folder, hookPostDeploy)
+	if err != nil {
+		t.Errorf("expected the hooks to be disabled, got %v", err)
+	}
+}
+
+func TestRunHookTimeout(t *testing.T) {
+	folder := t.TempDir()
+	manager, _ := newTestManager(t, &agent.Options{StackHooks: true, StackHookTimeout: 100 * time.Millisecond})
+	stack := newHookStack(folder)
+
+	writeHook(t, folder, hookPreDeploy, "sleep 5\n")
+
+	start := time.Now()
+
+	err := manager.runHook(context.Background(), stack, folder, hookPreDeploy)
+	if err == nil || !strings.Contains(err.Error(), "timed out after 100ms") {
+		t.Errorf("expected the hook to time out, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("expected the hook to be killed on timeout, it ran for %s", elapsed)
+	}
+}
+
+func TestRunHookEnv(t *testing.T) {
+	folder := t.TempDir()
+	manager, _ := newTestManager(t, &agent.Options{StackHooks: true, StackHookTimeout: 5 * time.Second})
+	stack := newHookStack(folder)
+
+	t.Setenv("AGENT_SECRET", "s3cr3t")
+
+	writeHook(t, folder, hookPreDeploy, "env > hook.env\n")
+
+	err := manager.runHook(context.Background(), stack, folder, hookPreDeploy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := os.ReadFile(filepath.Join(folder, "hook.env"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		name, value, _ := strings.Cut(line, "=")
+		env[name] = value
+	}
+
+	expected := map[string]string{
+		"PATH":               os.Getenv("PATH"),
+		"STACK_MODE":         "production",
+		"EDGE_STACK_ID":      "7",
+		"EDGE_STACK_NAME":    "web",
+		"EDGE_STACK_VERSION": "3",
+		"EDGE_STACK_HOOK":    hookPreDeploy,
+	}
+
+	for name, value := range expected {
+		if env[name] != value {
+			t.Errorf("%s: expected %q, got %q", name, value, env[name])
+		}
+	}
+
+	if _, ok := env["AGENT_SECRET"]; ok {
+		t.Error("expected the environment of the agent not to be inherited")
+	}
+
+	// the shell sets some variables of its own, e.g. PWD
+	for name := range env {
+		if _, ok := expected[name]; !ok && !strings.HasPrefix(name, "PWD") && name != "SHLVL" && name != "_" && name != "OLDPWD" {
+			t.Errorf("unexpected environment variable %s", name)
+		}
+	}
+}
+
+func TestRunDeploymentHookWithoutLock(t *testing.T) {
+	folder := t.TempDir()
+	manager, cli := newTestManager(t, &agent.Options{StackHooks: true, StackHookTimeout: 5 * time.Second})
+	stack := newHookStack(folder)
+
+	writeHook(t, folder, hookPostDeploy, "sleep 0.3\nexit 1\n")
+
+	done := make(chan error)
+	go func() {
+		done <- manager.runDeploymentHook(context.Background(), stack, hookPostDeploy)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	if !manager.mu.TryLock() {
+		t.Error("expected the lock of the manager to be released while the hook runs")
+	} else {
+		manager.mu.Unlock()
+	}
+
+	if err := <-done; err == nil {
+		t.Fatal("expected the hook to fail")
+	}
+
+	manager.mu.Lock()
+	status := stack.Status
+	manager.mu.Unlock()
+
+	if status != StatusError {
+		t.Errorf("expected the stack to be in error, got %d", status)
+	}
+
+	update, ok := cli.lastStatus()
+	if !ok || update.stackID != 7 || update.status != portainer.EdgeStackStatusError || !strings.Contains(update.message, "post-deploy hook failed") {
+		t.Errorf("expected the error to be sent to the server, got %+v", update)
+	}
+}
@@ -0,0 +1,28 @@
+package stack
+
+import (
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/journal"
+
+	"github.com/rs/zerolog/log"
+)
+
+// beginDeployJournal records the deployment of a Compose stack in the operation journal, so that the containers
+// it leaves half-created are removed when the agent is stopped during the deployment. The deployment is not
+// blocked when it cannot be recorded, the deployer does not leave the stack inconsistent once it completes.
+func (manager *StackManager) beginDeployJournal(stack *edgeStack, stackName string) *journal.Entry {
+	if manager.engineType != EngineTypeDockerStandalone {
+		return nil
+	}
+
+	entry, err := journal.Begin(journal.TypeStackDeploy, stackName, docker.StackDeployJournalState{
+		ProjectName: stackName,
+		StackID:     int(stack.ID),
+		Version:     stack.Version,
+	})
+	if err != nil {
+		log.Warn().Err(err).Int("stack_identifier", int(stack.ID)).Msg("unable to record the deployment in the operation journal")
+	}
+
+	return entry
+}
@@ -0,0 +1,36 @@
+package stack
+
+import (
+	"time"
+
+	"github.com/portainer/agent/maintenance"
+	portainer "github.com/portainer/portainer/api"
+
+	"github.com/rs/zerolog/log"
+)
+
+// isDisruptive returns true when the action modifies or removes a stack that is already deployed, these actions
+// are only executed during the maintenance windows
+func isDisruptive(stack *edgeStack) bool {
+	return stack.Action == actionUpdate || stack.Action == actionDelete
+}
+
+// deferStack postpones a disruptive action until the next maintenance window, the deferral is reported once.
+// It must be called with the lock held.
+func (manager *StackManager) deferStack(stack *edgeStack) error {
+	if stack.Status == StatusDeferred {
+		return nil
+	}
+
+	stack.Status = StatusDeferred
+
+	next := maintenance.NextOpening()
+
+	log.Info().
+		Int("stack_identifier", int(stack.ID)).
+		Str("stack_name", stack.Name).
+		Time("next_window", next).
+		Msg("stack action deferred until the next maintenance window")
+
+	return manager.portainerClient.SetEdgeStackStatus(int(stack.ID), portainer.EdgeStackStatusPending, stack.RollbackTo, "deferred until the next maintenance window at "+next.Format(time.RFC3339))
+}
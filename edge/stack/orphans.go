@@ -0,0 +1,140 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/edge/yaml"
+	"github.com/portainer/agent/stacklock"
+
+	"github.com/rs/zerolog/log"
+)
+
+// orphanCollectionLoop periodically looks for the orphaned resources of the deployed stacks until stopSignal is
+// closed
+func (manager *StackManager) orphanCollectionLoop(stopSignal chan struct{}) {
+	ticker := time.NewTicker(manager.agentOptions.OrphanGCInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			manager.collectOrphanedResources(context.TODO())
+		case <-stopSignal:
+			return
+		}
+	}
+}
+
+// collectOrphanedResources reports or removes, depending on the policy, the resources labeled as belonging to a
+// deployed stack that its definition no longer references
+func (manager *StackManager) collectOrphanedResources(ctx context.Context) {
+	manager.mu.Lock()
+
+	if manager.engineType != EngineTypeDockerStandalone && manager.engineType != EngineTypeDockerSwarm {
+		manager.mu.Unlock()
+		return
+	}
+
+	stacks := make([]edgeStack, 0, len(manager.stacks))
+	for _, stack := range manager.stacks {
+		if stack.Status == StatusDeployed {
+			stacks = append(stacks, *stack)
+		}
+	}
+
+	manager.mu.Unlock()
+
+	for _, stack := range stacks {
+		err := manager.collectStackOrphanedResources(ctx, stack)
+		if err != nil {
+			log.Error().Err(err).Int("stack_identifier", stack.ID).Msg("unable to collect the orphaned resources of the stack")
+		}
+	}
+}
+
+func (manager *StackManager) collectStackOrphanedResources(ctx context.Context, stack edgeStack) error {
+	projectName := fmt.Sprintf("edge_%s", stack.Name)
+
+	// The deployments hold the lock of the stack, the resources they add must not be collected against the
+	// previous definition of the stack
+	release, err := stacklock.Acquire(ctx, projectName, "orphan_collection")
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if !manager.isDeployedVersion(stack) {
+		return nil
+	}
+
+	content, err := os.ReadFile(filepath.Join(SuccessStackFileFolder(stack.FileFolder), stack.FileName))
+	if err != nil {
+		return err
+	}
+
+	names, err := yaml.GetComposeResourceNames(string(content))
+	if err != nil {
+		return err
+	}
+
+	references := docker.StackReferences{
+		docker.LabeledResourceContainer: names.Services,
+		docker.LabeledResourceService:   names.Services,
+		docker.LabeledResourceVolume:    names.Volumes,
+		docker.LabeledResourceNetwork:   names.Networks,
+		docker.LabeledResourceConfig:    names.Configs,
+		docker.LabeledResourceSecret:    names.Secrets,
+	}
+
+	orphans, err := manager.findOrphans(ctx, stack.Name, projectName, references)
+	if err != nil {
+		return err
+	}
+
+	for _, orphan := range orphans {
+		if manager.agentOptions.OrphanGCPolicy != agent.OrphanGCPolicyRemove {
+			log.Warn().
+				Int("stack_identifier", stack.ID).
+				Str("type", orphan.Type).
+				Str("name", orphan.Name).
+				Msg("orphaned resource detected")
+
+			continue
+		}
+
+		err := manager.removeOrphan(ctx, orphan)
+		if err != nil {
+			log.Warn().Err(err).
+				Int("stack_identifier", stack.ID).
+				Str("type", orphan.Type).
+				Str("name", orphan.Name).
+				Msg("unable to remove the orphaned resource")
+
+			continue
+		}
+
+		log.Info().
+			Int("stack_identifier", stack.ID).
+			Str("type", orphan.Type).
+			Str("name", orphan.Name).
+			Msg("orphaned resource removed")
+	}
+
+	return nil
+}
+
+// isDeployedVersion returns true when the stack is still deployed with the version of the snapshot of the stack
+func (manager *StackManager) isDeployedVersion(stack edgeStack) bool {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	current, ok := manager.stacks[edgeStackID(stack.ID)]
+
+	return ok && current.Status == StatusDeployed && current.Version == stack.Version
+}
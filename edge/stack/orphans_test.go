@@ -0,0 +1,158 @@
+package stack
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/stacklock"
+)
+
+const orphansComposeFile = `services:
+  web:
+    image: nginx
+volumes:
+  data: {}
+`
+
+// fakeOrphans returns the orphans of the stacks and records the orphans removed, errors are returned by the
+// removals of the resources with the same identifier
+type fakeOrphans struct {
+	mu           sync.Mutex
+	orphans      []docker.LabeledResource
+	removeErrors map[string]error
+	projectNames []string
+	references   []docker.StackReferences
+	removed      []string
+}
+
+func (f *fakeOrphans) find(ctx context.Context, stack, projectName string, references docker.StackReferences) ([]docker.LabeledResource, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.projectNames = append(f.projectNames, projectName)
+	f.references = append(f.references, references)
+
+	return f.orphans, nil
+}
+
+func (f *fakeOrphans) remove(ctx context.Context, resource docker.LabeledResource) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err, ok := f.removeErrors[resource.ID]; ok {
+		return err
+	}
+
+	f.removed = append(f.removed, resource.ID)
+
+	return nil
+}
+
+func (f *fakeOrphans) searches() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.projectNames)
+}
+
+func newOrphansTest(t *testing.T, policy string) (*StackManager, *fakeOrphans) {
+	t.Helper()
+
+	manager, _ := newTestManager(t, &agent.Options{OrphanGCPolicy: policy})
+	manager.engineType = EngineTypeDockerStandalone
+
+	orphans := &fakeOrphans{
+		orphans: []docker.LabeledResource{
+			{Type: docker.LabeledResourceContainer, ID: "c1", Name: "edge_web-legacy-1"},
+			{Type: docker.LabeledResourceVolume, ID: "v1", Name: "edge_web_cache"},
+		},
+	}
+	manager.findOrphans = orphans.find
+	manager.removeOrphan = orphans.remove
+
+	deployTestStack(t, manager, newStackPayload(t.TempDir(), 1, orphansComposeFile))
+
+	return manager, orphans
+}
+
+func TestCollectOrphanedResourcesReport(t *testing.T) {
+	manager, orphans := newOrphansTest(t, agent.OrphanGCPolicyReport)
+
+	manager.collectOrphanedResources(context.Background())
+
+	if !reflect.DeepEqual(orphans.projectNames, []string{"edge_web"}) {
+		t.Fatalf("expected the orphans of the stack edge_web to be searched, got %v", orphans.projectNames)
+	}
+
+	references := orphans.references[0]
+	if !reflect.DeepEqual(references[docker.LabeledResourceService], []string{"web"}) || !reflect.DeepEqual(references[docker.LabeledResourceVolume], []string{"data"}) {
+		t.Errorf("expected the resources of the deployed definition to be referenced, got %v", references)
+	}
+
+	if len(orphans.removed) != 0 {
+		t.Errorf("expected the orphans to be reported only, removed %v", orphans.removed)
+	}
+}
+
+func TestCollectOrphanedResourcesRemove(t *testing.T) {
+	manager, orphans := newOrphansTest(t, agent.OrphanGCPolicyRemove)
+	orphans.removeErrors = map[string]error{"c1": errors.New("container is in use")}
+
+	manager.collectOrphanedResources(context.Background())
+
+	// the removal continues after a failure
+	if !reflect.DeepEqual(orphans.removed, []string{"v1"}) {
+		t.Errorf("expected the volume to be removed, got %v", orphans.removed)
+	}
+}
+
+func TestCollectOrphanedResourcesSkipsUndeployedStacks(t *testing.T) {
+	manager, orphans := newOrphansTest(t, agent.OrphanGCPolicyRemove)
+	manager.stacks[7].Status = StatusDeploying
+
+	manager.collectOrphanedResources(context.Background())
+
+	if orphans.searches() != 0 || len(orphans.removed) != 0 {
+		t.Error("expected the stack being deployed to be skipped")
+	}
+}
+
+func TestCollectOrphanedResourcesWaitsForDeployment(t *testing.T) {
+	manager, orphans := newOrphansTest(t, agent.OrphanGCPolicyRemove)
+
+	release, err := stacklock.Acquire(context.Background(), "edge_web", "edge_deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		manager.collectOrphanedResources(context.Background())
+		close(done)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	if orphans.searches() != 0 {
+		t.Fatal("expected the collection to wait for the deployment of the stack")
+	}
+
+	// the deployment of the version 2 starts while the collection waits
+	manager.mu.Lock()
+	manager.stacks[7].Version = 2
+	manager.stacks[7].Status = StatusDeploying
+	manager.mu.Unlock()
+
+	release()
+	<-done
+
+	if orphans.searches() != 0 || len(orphans.removed) != 0 {
+		t.Error("expected the collection of the redeployed stack to be skipped")
+	}
+}
@@ -0,0 +1,54 @@
+package stack
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/portainer/agent/preflight"
+	portainer "github.com/portainer/portainer/api"
+
+	"github.com/rs/zerolog/log"
+)
+
+// runPreflightChecks refuses to deploy a stack whose ports are already in use, whose bind mounted paths are
+// missing, whose images cannot be pulled for the platform of the host or that does not fit in the memory or the
+// disk of the host. The failed checks are sent to the server, the stack is retried when the checks cannot be run.
+func (manager *StackManager) runPreflightChecks(ctx context.Context, stack *edgeStack, stackName, stackFileLocation string) error {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	if !manager.agentOptions.EdgeStackPreflight || manager.engineType != EngineTypeDockerStandalone {
+		return nil
+	}
+
+	content, err := os.ReadFile(stackFileLocation)
+	if err != nil {
+		return manager.retryStackCheck(stack, "preflight checks", err)
+	}
+
+	report, err := preflight.Run(ctx, stackName, string(content))
+	if err != nil {
+		// The deployer validation is responsible for the invalid files
+		log.Warn().Err(err).Int("stack_identifier", int(stack.ID)).Msg("unable to run the preflight checks of the stack")
+
+		return nil
+	}
+
+	if report.Passed {
+		return nil
+	}
+
+	message := "preflight checks failed: " + report.Failures()
+
+	log.Error().Int("stack_identifier", int(stack.ID)).Str("stack_name", stackName).Msg(message)
+
+	stack.Status = StatusError
+
+	statusUpdateErr := manager.portainerClient.SetEdgeStackStatus(int(stack.ID), portainer.EdgeStackStatusError, stack.RollbackTo, message)
+	if statusUpdateErr != nil {
+		log.Error().Err(statusUpdateErr).Msg("unable to update Edge stack status")
+	}
+
+	return errors.New(message)
+}
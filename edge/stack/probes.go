@@ -0,0 +1,33 @@
+package stack
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/portainer/agent/edge/yaml"
+	"github.com/portainer/agent/probe"
+
+	"github.com/rs/zerolog/log"
+)
+
+// startProbes runs the synthetic probes defined in the deployed stack file of the stack, replacing the probes of its
+// previous version
+func (manager *StackManager) startProbes(stack *edgeStack) {
+	if manager.engineType != EngineTypeDockerStandalone && manager.engineType != EngineTypeDockerSwarm {
+		return
+	}
+
+	content, err := os.ReadFile(filepath.Join(SuccessStackFileFolder(stack.FileFolder), stack.FileName))
+	if err != nil {
+		log.Warn().Err(err).Int("stack_identifier", int(stack.ID)).Msg("unable to read the deployed stack file")
+
+		return
+	}
+
+	definitions, err := yaml.ComposeProbes(string(content))
+	if err != nil {
+		log.Warn().Err(err).Int("stack_identifier", int(stack.ID)).Msg("unable to parse the probes of the stack")
+	}
+
+	probe.Start(int(stack.ID), stack.Name, definitions)
+}
@@ -0,0 +1,111 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/portainer/agent"
+	portainer "github.com/portainer/portainer/api"
+
+	"github.com/rs/zerolog/log"
+)
+
+// saveDeployedVersion keeps a copy of the files of the deployed version of the stack
+func (manager *StackManager) saveDeployedVersion(stack *edgeStack) {
+	if manager.versions.historySize <= 0 || IsRelativePathStack(stack) {
+		return
+	}
+
+	err := manager.versions.save(stack)
+	if err != nil {
+		log.Error().Err(err).Int("stack_identifier", int(stack.ID)).Msg("unable to save the deployed version of the Edge stack")
+	}
+}
+
+// markKnownGood records the deployed version of the stack as a version it can be rolled back to
+func (manager *StackManager) markKnownGood(stack *edgeStack) {
+	if manager.versions.historySize <= 0 || IsRelativePathStack(stack) {
+		return
+	}
+
+	err := manager.versions.markKnownGood(int(stack.ID), stack.Version)
+	if err != nil {
+		log.Error().Err(err).Int("stack_identifier", int(stack.ID)).Msg("unable to record the known-good version of the Edge stack")
+	}
+}
+
+// failDeployment reports the deployment of the stack as failed, then redeploys the last known-good version of the
+// stack when the automatic rollback is enabled
+func (manager *StackManager) failDeployment(ctx context.Context, stack *edgeStack, stackName, message string) error {
+	stack.Status = StatusError
+
+	err := manager.portainerClient.SetEdgeStackStatus(int(stack.ID), portainer.EdgeStackStatusError, stack.RollbackTo, message)
+	if !manager.agentOptions.EdgeStackAutoRollback || manager.versions.historySize <= 0 || IsRelativePathStack(stack) {
+		return err
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("unable to update Edge stack status")
+	}
+
+	return manager.rollbackStack(ctx, stack, stackName)
+}
+
+// rollbackStack redeploys the last known-good version of the stack and reports the result of the rollback
+func (manager *StackManager) rollbackStack(ctx context.Context, stack *edgeStack, stackName string) error {
+	target, err := manager.versions.lastKnownGood(int(stack.ID), stack.Version)
+	if err != nil {
+		return err
+	}
+
+	if target == nil {
+		log.Warn().Int("stack_identifier", int(stack.ID)).Msg("no known-good version of the Edge stack to roll back to")
+
+		return nil
+	}
+
+	log.Info().
+		Int("stack_identifier", int(stack.ID)).
+		Int("failed_version", stack.Version).
+		Int("rollback_version", target.Version).
+		Msg("rolling back the Edge stack")
+
+	// The files of the version are restored as the files of the last successful deployment, the stack is removed
+	// with them
+	folder := SuccessStackFileFolder(stack.FileFolder)
+	err = os.RemoveAll(folder)
+	if err == nil {
+		err = manager.versions.restore(int(stack.ID), target.Version, folder)
+	}
+	if err != nil {
+		log.Error().Err(err).Int("stack_identifier", int(stack.ID)).Msg("unable to restore the files of the Edge stack version")
+
+		message := fmt.Sprintf("deployment of version %d failed and the files of version %d could not be restored: %s", stack.Version, target.Version, err)
+		return manager.portainerClient.SetEdgeStackStatus(int(stack.ID), portainer.EdgeStackStatusError, &target.Version, message)
+	}
+
+	err = manager.deployer.Deploy(ctx, stackName, []string{filepath.Join(folder, target.FileName)},
+		agent.DeployOptions{
+			DeployerBaseOptions: agent.DeployerBaseOptions{
+				Namespace:  target.Namespace,
+				WorkingDir: folder,
+				Env:        buildEnvVarsForDeployer(target.EnvVars),
+			},
+		},
+	)
+	if err != nil {
+		log.Error().Err(err).Int("stack_identifier", int(stack.ID)).Msg("unable to roll back the Edge stack")
+
+		message := fmt.Sprintf("deployment of version %d failed and the rollback to version %d failed: %s", stack.Version, target.Version, err)
+		return manager.portainerClient.SetEdgeStackStatus(int(stack.ID), portainer.EdgeStackStatusError, &target.Version, message)
+	}
+
+	stack.Status = StatusDeployed
+	stack.Action = actionIdle
+	manager.startProbes(stack)
+
+	message := fmt.Sprintf("deployment of version %d failed, rolled back to version %d", stack.Version, target.Version)
+	return manager.portainerClient.SetEdgeStackStatus(int(stack.ID), portainer.EdgeStackStatusRunning, &target.Version, message)
+}
@@ -0,0 +1,257 @@
+package stack
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/portainer/agent"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/portainer/portainer/pkg/libstack"
+)
+
+// deployment is a call to the Deploy function of the fake deployer, with the content of the deployed file
+type deployment struct {
+	name    string
+	file    string
+	content string
+	options agent.DeployOptions
+}
+
+// fakeDeployer records the deployments and the removals of the stacks, errors are returned by the next calls to
+// Deploy
+type fakeDeployer struct {
+	mu          sync.Mutex
+	deployments []deployment
+	removals    []string
+	errors      []error
+}
+
+func (d *fakeDeployer) Deploy(ctx context.Context, name string, filePaths []string, options agent.DeployOptions) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	content, _ := os.ReadFile(filePaths[0])
+	d.deployments = append(d.deployments, deployment{name: name, file: filePaths[0], content: string(content), options: options})
+
+	if len(d.errors) > 0 {
+		err := d.errors[0]
+		d.errors = d.errors[1:]
+
+		return err
+	}
+
+	return nil
+}
+
+func (d *fakeDeployer) Remove(ctx context.Context, name string, filePaths []string, options agent.RemoveOptions) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.removals = append(d.removals, name)
+
+	return nil
+}
+
+func (d *fakeDeployer) Pull(ctx context.Context, name string, filePaths []string, options agent.PullOptions) error {
+	return nil
+}
+
+func (d *fakeDeployer) Validate(ctx context.Context, name string, filePaths []string, options agent.ValidateOptions) error {
+	return nil
+}
+
+func (d *fakeDeployer) WaitForStatus(ctx context.Context, name string, status libstack.Status) <-chan string {
+	return nil
+}
+
+// writeStackVersion writes the file of the version of the stack in its folder
+func writeStackVersion(t *testing.T, stack *edgeStack, version int, content string) {
+	t.Helper()
+
+	stack.Version = version
+	stack.EnvVars = []portainer.Pair{{Name: "VERSION", Value: content}}
+
+	err := os.MkdirAll(stack.FileFolder, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(stack.FileFolder, stack.FileName), []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newRollbackTest(t *testing.T, options *agent.Options) (*StackManager, *fakePortainerClient, *fakeDeployer, *edgeStack) {
+	t.Helper()
+
+	manager, cli := newTestManager(t, options)
+
+	deployer := &fakeDeployer{}
+	manager.deployer = deployer
+
+	stack := newHookStack(filepath.Join(t.TempDir(), "web"))
+	stack.FileName = "docker-compose.yml"
+
+	return manager, cli, deployer, stack
+}
+
+func TestFailDeploymentRollsBack(t *testing.T) {
+	manager, cli, deployer, stack := newRollbackTest(t, &agent.Options{EdgeStackAutoRollback: true, EdgeStackHistorySize: 3})
+
+	writeStackVersion(t, stack, 1, "version 1")
+	manager.saveDeployedVersion(stack)
+	manager.markKnownGood(stack)
+
+	writeStackVersion(t, stack, 2, "version 2")
+	manager.saveDeployedVersion(stack)
+
+	err := manager.failDeployment(context.Background(), stack, "edge_web", "the container web exited")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deployer.deployments) != 1 {
+		t.Fatalf("expected the previous version to be deployed, got %d deployments", len(deployer.deployments))
+	}
+
+	rollback := deployer.deployments[0]
+	if rollback.name != "edge_web" || rollback.content != "version 1" {
+		t.Errorf("expected the files of the version 1 to be deployed, got %q", rollback.content)
+	}
+
+	if rollback.file != filepath.Join(SuccessStackFileFolder(stack.FileFolder), "docker-compose.yml") {
+		t.Errorf("expected the files to be restored as the last successful deployment, got %s", rollback.file)
+	}
+
+	if env := rollback.options.Env; len(env) != 1 || env[0] != "VERSION=version 1" {
+		t.Errorf("expected the environment of the version 1, got %v", env)
+	}
+
+	if stack.Status != StatusDeployed || stack.Action != actionIdle {
+		t.Errorf("expected the rolled back stack to be deployed, got the status %d", stack.Status)
+	}
+
+	if len(cli.statuses) != 2 {
+		t.Fatalf("expected the failure and the rollback to be reported, got %+v", cli.statuses)
+	}
+
+	if failure := cli.statuses[0]; failure.status != portainer.EdgeStackStatusError || failure.message != "the container web exited" {
+		t.Errorf("expected the failure of the deployment to be reported, got %+v", failure)
+	}
+
+	update, _ := cli.lastStatus()
+	if update.status != portainer.EdgeStackStatusRunning || update.rollbackTo == nil || *update.rollbackTo != 1 || update.message != "deployment of version 2 failed, rolled back to version 1" {
+		t.Errorf("expected the rollback to the version 1 to be reported, got %+v", update)
+	}
+}
+
+func TestFailDeploymentWithoutPreviousVersion(t *testing.T) {
+	manager, cli, deployer, stack := newRollbackTest(t, &agent.Options{EdgeStackAutoRollback: true, EdgeStackHistorySize: 3})
+
+	// the first version fails before it was ever reported as running
+	writeStackVersion(t, stack, 1, "version 1")
+	manager.saveDeployedVersion(stack)
+
+	err := manager.failDeployment(context.Background(), stack, "edge_web", "the container web exited")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deployer.deployments) != 0 {
+		t.Errorf("expected no rollback, got %d deployments", len(deployer.deployments))
+	}
+
+	if stack.Status != StatusError {
+		t.Errorf("expected the stack to stay in error, got %d", stack.Status)
+	}
+
+	update, _ := cli.lastStatus()
+	if len(cli.statuses) != 1 || update.status != portainer.EdgeStackStatusError || update.message != "the container web exited" {
+		t.Errorf("expected only the failure to be reported, got %+v", cli.statuses)
+	}
+}
+
+func TestFailDeploymentRollbackFailure(t *testing.T) {
+	manager, cli, deployer, stack := newRollbackTest(t, &agent.Options{EdgeStackAutoRollback: true, EdgeStackHistorySize: 3})
+
+	writeStackVersion(t, stack, 1, "version 1")
+	manager.saveDeployedVersion(stack)
+	manager.markKnownGood(stack)
+
+	writeStackVersion(t, stack, 2, "version 2")
+	manager.saveDeployedVersion(stack)
+
+	deployer.errors = []error{errors.New("port 80 already allocated")}
+
+	err := manager.failDeployment(context.Background(), stack, "edge_web", "the container web exited")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stack.Status != StatusError {
+		t.Errorf("expected the stack to stay in error, got %d", stack.Status)
+	}
+
+	update, _ := cli.lastStatus()
+	if update.status != portainer.EdgeStackStatusError || update.rollbackTo == nil || *update.rollbackTo != 1 || !strings.Contains(update.message, "the rollback to version 1 failed: port 80 already allocated") {
+		t.Errorf("expected the failed rollback to be reported, got %+v", update)
+	}
+}
+
+func TestFailDeploymentRollbackDisabled(t *testing.T) {
+	manager, cli, deployer, stack := newRollbackTest(t, &agent.Options{EdgeStackHistorySize: 3})
+
+	writeStackVersion(t, stack, 1, "version 1")
+	manager.saveDeployedVersion(stack)
+	manager.markKnownGood(stack)
+
+	writeStackVersion(t, stack, 2, "version 2")
+	manager.saveDeployedVersion(stack)
+
+	err := manager.failDeployment(context.Background(), stack, "edge_web", "the container web exited")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deployer.deployments) != 0 || stack.Status != StatusError || len(cli.statuses) != 1 {
+		t.Errorf("expected no rollback without the automatic rollback, got %d deployments", len(deployer.deployments))
+	}
+}
+
+func TestSaveDeployedVersionHistory(t *testing.T) {
+	manager, _, _, stack := newRollbackTest(t, &agent.Options{EdgeStackHistorySize: 2})
+
+	writeStackVersion(t, stack, 1, "version 1")
+	manager.saveDeployedVersion(stack)
+	manager.markKnownGood(stack)
+
+	for version := 2; version <= 4; version++ {
+		writeStackVersion(t, stack, version, "failing version")
+		manager.saveDeployedVersion(stack)
+	}
+
+	versions, err := manager.versions.list(int(stack.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var kept []int
+	for _, v := range versions {
+		kept = append(kept, v.Version)
+	}
+
+	// the last known-good version is kept beyond the history size
+	if len(kept) != 3 || kept[0] != 4 || kept[1] != 3 || kept[2] != 1 {
+		t.Errorf("expected the versions 4, 3 and 1 to be kept, got %v", kept)
+	}
+
+	if _, err := os.Stat(manager.versions.versionPath(int(stack.ID), 2)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the files of the version 2 to be removed, got %v", err)
+	}
+}
@@ -2,19 +2,26 @@ package stack
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/portainer/agent"
 	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/drift"
 	"github.com/portainer/agent/edge/client"
 	"github.com/portainer/agent/edge/yaml"
 	"github.com/portainer/agent/exec"
+	"github.com/portainer/agent/maintenance"
 	"github.com/portainer/agent/nomad"
+	"github.com/portainer/agent/probe"
+	"github.com/portainer/agent/stacklock"
 	portainer "github.com/portainer/portainer/api"
 	"github.com/portainer/portainer/api/edge"
 	"github.com/portainer/portainer/api/filesystem"
@@ -36,6 +43,10 @@ type edgeStack struct {
 	PullCount    int
 	PullFinished bool
 	DeployCount  int
+	// CheckCount is the number of attempts to run the checks preceding the deployment that could not be completed
+	CheckCount int
+
+	HealthGateDeadline time.Time
 }
 
 type edgeStackStatus int
@@ -50,6 +61,9 @@ const (
 	StatusRemoving
 	StatusAwaitingDeployedStatus
 	StatusAwaitingRemovedStatus
+	StatusAwaitingHealthGate
+	StatusDeferred
+	StatusPrepared
 )
 
 type edgeStackAction int
@@ -80,7 +94,6 @@ const (
 // StackManager represents a service for managing Edge stacks
 type StackManager struct {
 	engineType      engineType
-	edgeID          string
 	stacks          map[edgeStackID]*edgeStack
 	stopSignal      chan struct{}
 	deployer        agent.Deployer
@@ -88,18 +101,30 @@ type StackManager struct {
 	portainerClient client.PortainerClient
 	assetsPath      string
 	awsConfig       *agent.AWSConfig
-	mu              sync.Mutex
+	agentOptions    *agent.Options
+	versions        *versionStore
+	transactions    map[edgeStackID]*stackTransaction
+	// priorityClasses are the priority classes of the stacks configured by the server, by stack name
+	priorityClasses map[string]string
+	// findOrphans and removeOrphan look for and remove the orphaned resources of the stacks
+	findOrphans  func(ctx context.Context, stack, projectName string, references docker.StackReferences) ([]docker.LabeledResource, error)
+	removeOrphan func(ctx context.Context, resource docker.LabeledResource) error
+	mu           sync.Mutex
 }
 
 // NewStackManager returns a pointer to a new instance of StackManager
-func NewStackManager(cli client.PortainerClient, assetsPath string, config *agent.AWSConfig, edgeID string) *StackManager {
+func NewStackManager(cli client.PortainerClient, assetsPath string, config *agent.AWSConfig, agentOptions *agent.Options) *StackManager {
 	return &StackManager{
 		stacks:          map[edgeStackID]*edgeStack{},
 		stopSignal:      nil,
 		portainerClient: cli,
 		assetsPath:      assetsPath,
 		awsConfig:       config,
-		edgeID:          edgeID,
+		agentOptions:    agentOptions,
+		versions:        newVersionStore(agentOptions.DataPath, agentOptions.EdgeStackHistorySize),
+		transactions:    map[edgeStackID]*stackTransaction{},
+		findOrphans:     docker.FindOrphanedResources,
+		removeOrphan:    docker.RemoveLabeledResource,
 	}
 }
 
@@ -123,31 +148,32 @@ func (manager *StackManager) UpdateStacksStatus(pollResponseStacks map[int]int)
 	return nil
 }
 
-func (manager *StackManager) addRegistryToEntryFile(stackPayload *edge.StackPayload) error {
-	var fileContent *string
-
+// entryFileContent returns a pointer to the content of the entry file of a stack
+func entryFileContent(stackPayload *edge.StackPayload) (*string, error) {
 	for index, dirEntry := range stackPayload.DirEntries {
 		if dirEntry.IsFile && dirEntry.Name == stackPayload.EntryFileName {
-			fileContent = &stackPayload.DirEntries[index].Content
-			break
+			return &stackPayload.DirEntries[index].Content, nil
 		}
 	}
 
-	if fileContent == nil {
-		return fmt.Errorf("EntryFileName not found in DirEntries")
+	return nil, fmt.Errorf("EntryFileName not found in DirEntries")
+}
+
+func (manager *StackManager) addRegistryToEntryFile(stackPayload *edge.StackPayload) error {
+	fileContent, err := entryFileContent(stackPayload)
+	if err != nil {
+		return err
 	}
 
 	switch manager.engineType {
 	case EngineTypeDockerStandalone, EngineTypeDockerSwarm:
 		if (len(stackPayload.RegistryCredentials) > 0 || manager.awsConfig != nil) && stackPayload.EdgeUpdateID > 0 {
-			var err error
 			yml := yaml.NewDockerComposeYAML(*fileContent, stackPayload.RegistryCredentials, manager.awsConfig)
 			*fileContent, err = yml.AddCredentialsAsEnvForSpecificService("updater")
 			if err != nil {
 				return err
 			}
 		}
-
 	case EngineTypeKubernetes:
 		if len(stackPayload.RegistryCredentials) > 0 {
 			yml := yaml.NewKubernetesYAML(*fileContent, stackPayload.RegistryCredentials)
@@ -158,6 +184,79 @@ func (manager *StackManager) addRegistryToEntryFile(stackPayload *edge.StackPayl
 	return nil
 }
 
+// addDNSOverridesToEntryFile injects the configured extra hosts and DNS servers in the services of a compose entry file
+func (manager *StackManager) addDNSOverridesToEntryFile(stackPayload *edge.StackPayload) error {
+	if manager.engineType != EngineTypeDockerStandalone && manager.engineType != EngineTypeDockerSwarm {
+		return nil
+	}
+
+	fileContent, err := entryFileContent(stackPayload)
+	if err != nil {
+		return err
+	}
+
+	*fileContent, err = yaml.AddDNSOverrides(*fileContent, manager.agentOptions.DNSOverrides.ExtraHosts, manager.agentOptions.DNSOverrides.DNS)
+
+	return err
+}
+
+// SetPriorityClasses replaces the priority classes of the stacks configured by the server, by stack name. They apply
+// to the services without priority class label on their next deployment. The classes are left unchanged when
+// classes is nil, i.e. when the server does not manage them.
+func (manager *StackManager) SetPriorityClasses(classes map[string]string) {
+	if classes == nil {
+		return
+	}
+
+	valid := make(map[string]string, len(classes))
+	for name, class := range classes {
+		if !yaml.ValidPriorityClass(class) {
+			log.Warn().Str("stack_name", name).Str("priority_class", class).Msg("ignoring the unknown priority class of the stack")
+
+			continue
+		}
+
+		valid[name] = class
+	}
+
+	manager.mu.Lock()
+	manager.priorityClasses = valid
+	manager.mu.Unlock()
+}
+
+// addPriorityClassesToEntryFile sets the CPU and IO weights of the services of a compose entry file from their
+// priority class. The weights are only supported by standalone Docker engines, Swarm services ignore them.
+func (manager *StackManager) addPriorityClassesToEntryFile(stackPayload *edge.StackPayload) error {
+	if manager.engineType != EngineTypeDockerStandalone {
+		return nil
+	}
+
+	fileContent, err := entryFileContent(stackPayload)
+	if err != nil {
+		return err
+	}
+
+	*fileContent, err = yaml.AddPriorityClasses(*fileContent, agent.ContainerLabelPriorityClass, manager.priorityClasses[stackPayload.Name])
+
+	return err
+}
+
+// addResourceLabelsToEntryFile stamps the environment and stack labels on the resources of a compose entry file
+func (manager *StackManager) addResourceLabelsToEntryFile(stackPayload *edge.StackPayload) error {
+	if manager.engineType != EngineTypeDockerStandalone && manager.engineType != EngineTypeDockerSwarm {
+		return nil
+	}
+
+	fileContent, err := entryFileContent(stackPayload)
+	if err != nil {
+		return err
+	}
+
+	*fileContent, err = yaml.AddResourceLabels(*fileContent, docker.ResourceLabels(manager.agentOptions.EdgeID, stackPayload.Name, ""))
+
+	return err
+}
+
 func getStackFileFolder(stack *edgeStack) string {
 	stackIDStr := strconv.Itoa(stack.ID)
 
@@ -172,6 +271,11 @@ func getStackFileFolder(stack *edgeStack) string {
 func (manager *StackManager) processStack(stackID int, version int) error {
 	var stack *edgeStack
 
+	// the version of a stack prepared by a transaction is only changed by the commit or the abort
+	if _, ok := manager.transactions[edgeStackID(stackID)]; ok {
+		return nil
+	}
+
 	originalStack, processedStack := manager.stacks[edgeStackID(stackID)]
 	if processedStack {
 		// update the cloned stack to keep data consistency
@@ -191,6 +295,7 @@ func (manager *StackManager) processStack(stackID int, version int) error {
 		stack.PullFinished = false
 		stack.PullCount = 0
 		stack.DeployCount = 0
+		stack.CheckCount = 0
 	} else {
 		log.Debug().Int("stack_identifier", stackID).Msg("marking stack for deployment")
 
@@ -209,7 +314,7 @@ func (manager *StackManager) processStack(stackID int, version int) error {
 		return err
 	}
 
-	edgeIdPair := portainer.Pair{Name: agent.EdgeIdEnvVarName, Value: manager.edgeID}
+	edgeIdPair := portainer.Pair{Name: agent.EdgeIdEnvVarName, Value: manager.agentOptions.EdgeID}
 
 	stack.Name = stackPayload.Name
 	stack.RegistryCredentials = stackPayload.RegistryCredentials
@@ -234,6 +339,21 @@ func (manager *StackManager) processStack(stackID int, version int) error {
 		return err
 	}
 
+	err = manager.addDNSOverridesToEntryFile(stackPayload)
+	if err != nil {
+		return err
+	}
+
+	err = manager.addPriorityClassesToEntryFile(stackPayload)
+	if err != nil {
+		return err
+	}
+
+	err = manager.addResourceLabelsToEntryFile(stackPayload)
+	if err != nil {
+		return err
+	}
+
 	err = filesystem.PersistDir(stack.FileFolder, stackPayload.DirEntries)
 	if err != nil {
 		return err
@@ -252,6 +372,10 @@ func (manager *StackManager) processStack(stackID int, version int) error {
 
 func (manager *StackManager) processRemovedStacks(pollResponseStacks map[int]int) {
 	for stackID, stack := range manager.stacks {
+		if _, ok := manager.transactions[stackID]; ok {
+			continue
+		}
+
 		if _, ok := pollResponseStacks[int(stackID)]; !ok {
 			log.Debug().Int("stack_identifier", int(stackID)).Msg("marking stack for deletion")
 
@@ -310,6 +434,12 @@ func (manager *StackManager) Start() error {
 		}
 	}()
 
+	if manager.agentOptions.OrphanGCPolicy != agent.OrphanGCPolicyOff {
+		go manager.orphanCollectionLoop(manager.stopSignal)
+	}
+
+	go manager.driftDetectionLoop(manager.stopSignal)
+
 	return nil
 }
 
@@ -336,8 +466,51 @@ func (manager *StackManager) performActionOnStack(queueSleepInterval time.Durati
 		return
 	}
 
+	if stack.Status == StatusAwaitingHealthGate {
+		done, err := manager.checkHealthGate(ctx, stackName, stack)
+		if err != nil {
+			log.Error().Err(err).Msg("unable to check Edge stack health gate")
+		}
+
+		if !done {
+			time.Sleep(queueSleepInterval)
+		}
+
+		return
+	}
+
+	if isDisruptive(stack) && !maintenance.IsOpen() && !manager.preparingStack(stack) {
+		manager.mu.Lock()
+		err := manager.deferStack(stack)
+		manager.mu.Unlock()
+		if err != nil {
+			log.Error().Err(err).Msg("unable to report the deferral of the Edge stack")
+		}
+
+		return
+	}
+
+	operation := "edge_deploy"
+	if stack.Action == actionDelete {
+		operation = "edge_remove"
+	}
+
+	// The Edge stacks share the locks of the stacks managed through the agent API, so that their operations
+	// cannot interleave
+	release, err := stacklock.Acquire(ctx, stackName, operation)
+	if err != nil {
+		log.Error().Err(err).Msg("unable to lock the Edge stack")
+
+		return
+	}
+	defer release()
+
 	switch stack.Action {
 	case actionDeploy, actionUpdate:
+		if !manager.checksDue(stack) {
+			return
+		}
+
 		// validate the stack file and fail-fast if the stack format is invalid
 		// each deployer has its own Validate function
 		err := manager.validateStackFile(ctx, stack, stackName, stackFileLocation)
@@ -345,11 +518,35 @@ func (manager *StackManager) performActionOnStack(queueSleepInterval time.Durati
 			return
 		}
 
+		err = manager.lintStackFile(stack, stackFileLocation)
+		if err != nil {
+			return
+		}
+
+		err = manager.checkDeploymentQuotas(ctx, stack, stackName, stackFileLocation)
+		if err != nil {
+			return
+		}
+
+		err = manager.runPreflightChecks(ctx, stack, stackName, stackFileLocation)
+		if err != nil {
+			return
+		}
+
 		err = manager.pullImages(ctx, stack, stackName, stackFileLocation)
 		if err != nil {
 			return
 		}
 
+		if manager.holdPreparedStack(stack) {
+			return
+		}
+
+		err = manager.runDeploymentHook(ctx, stack, hookPreDeploy)
+		if err != nil {
+			return
+		}
+
 		if IsRelativePathStack(stack) {
 			dst := filepath.Join(stack.FilesystemPath, agent.ComposePathPrefix)
 			err := docker.CopyGitStackToHost(stack.FileFolder, dst, stack.ID, stackName, manager.assetsPath)
@@ -358,7 +555,18 @@ func (manager *StackManager) performActionOnStack(queueSleepInterval time.Durati
 			}
 		}
 
-		manager.deployStack(ctx, stack, stackName, stackFileLocation)
+		if !manager.deployStack(ctx, stack, stackName, stackFileLocation) {
+			return
+		}
+
+		err = manager.runDeploymentHook(ctx, stack, hookPostDeploy)
+		if err != nil {
+			return
+		}
+
+		manager.mu.Lock()
+		stack.Status = StatusAwaitingDeployedStatus
+		manager.mu.Unlock()
 	case actionDelete:
 		stackFileLocation = fmt.Sprintf("%s/%s", SuccessStackFileFolder(stack.FileFolder), stack.FileName)
 		manager.deleteStack(ctx, stack, stackName, stackFileLocation)
@@ -384,13 +592,15 @@ func (manager *StackManager) nextPendingStack() *edgeStack {
 	}
 
 	for _, stack := range manager.stacks {
-		if stack.Status == StatusAwaitingDeployedStatus || stack.Status == StatusAwaitingRemovedStatus {
+		if stack.Status == StatusAwaitingDeployedStatus || stack.Status == StatusAwaitingRemovedStatus || stack.Status == StatusAwaitingHealthGate {
 			return stack
 		}
 	}
 
+	manager.abortExpiredTransactions()
+
 	for _, stack := range manager.stacks {
-		if stack.Status == StatusRetry {
+		if stack.Status == StatusRetry || (stack.Status == StatusDeferred && maintenance.IsOpen()) {
 			stack.Status = StatusPending
 		}
 	}
@@ -398,6 +608,22 @@ func (manager *StackManager) nextPendingStack() *edgeStack {
 	return nil
 }
 
+// DeploymentInProgress returns true when an Edge stack is waiting to be deployed or removed, or is being deployed
+// or removed
+func (manager *StackManager) DeploymentInProgress() bool {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	for _, stack := range manager.stacks {
+		switch stack.Status {
+		case StatusPending, StatusDeploying, StatusRemoving, StatusAwaitingDeployedStatus, StatusAwaitingRemovedStatus, StatusAwaitingHealthGate:
+			return true
+		}
+	}
+
+	return false
+}
+
 func (manager *StackManager) checkStackStatus(ctx context.Context, stackName string, stack *edgeStack) error {
 	log.Debug().
 		Int("stack_identifier", int(stack.ID)).
@@ -426,17 +652,31 @@ func (manager *StackManager) checkStackStatus(ctx context.Context, stackName str
 		Msg("stack status")
 
 	if status == libstack.StatusError {
-		stack.Status = StatusError
-		return manager.portainerClient.SetEdgeStackStatus(int(stack.ID), portainer.EdgeStackStatusError, stack.RollbackTo, statusMessage)
+		return manager.failDeployment(ctx, stack, stackName, manager.diagnoseStartFailure(ctx, stack, stackName, statusMessage))
+	}
+
+	if status == libstack.StatusRunning && manager.healthGateEnabled() {
+		stack.Status = StatusAwaitingHealthGate
+		stack.HealthGateDeadline = time.Now().Add(manager.agentOptions.HealthGateWindow)
+
+		return nil
 	}
 
 	if status == libstack.StatusRunning {
 		stack.Status = StatusDeployed
+		manager.markKnownGood(stack)
+		manager.startProbes(stack)
+		docker.RemoveStartFailures(int(stack.ID))
+
 		return manager.portainerClient.SetEdgeStackStatus(int(stack.ID), portainer.EdgeStackStatusRunning, stack.RollbackTo, "")
 	}
 
 	if status == libstack.StatusRemoved {
 		delete(manager.stacks, edgeStackID(stack.ID))
+		drift.RemoveReport(int(stack.ID))
+		probe.Stop(int(stack.ID))
+		docker.RemoveStartFailures(int(stack.ID))
+
 		return manager.portainerClient.SetEdgeStackStatus(int(stack.ID), portainer.EdgeStackStatusRemoved, stack.RollbackTo, "")
 	}
 
@@ -492,6 +732,165 @@ func (manager *StackManager) validateStackFile(ctx context.Context, stack *edgeS
 	return err
 }
 
+// lintStackFile looks for the settings allowing the containers of the stack to escape their isolation. Depending
+// on the lint policy, the findings are logged or the deployment is refused and the findings are sent to the server.
+func (manager *StackManager) lintStackFile(stack *edgeStack, stackFileLocation string) error {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	if manager.agentOptions.DeploymentLintPolicy == agent.DeploymentLintPolicyOff {
+		return nil
+	}
+
+	content, err := os.ReadFile(stackFileLocation)
+	if err != nil {
+		return manager.retryStackCheck(stack, "deployment lint", err)
+	}
+
+	var findings []yaml.SecurityFinding
+	switch manager.engineType {
+	case EngineTypeDockerStandalone, EngineTypeDockerSwarm:
+		findings, err = yaml.LintDockerCompose(string(content))
+	case EngineTypeKubernetes:
+		findings, err = yaml.LintKubernetesManifest(string(content))
+	}
+
+	// The deployer validation is responsible for the invalid files
+	if err != nil || len(findings) == 0 {
+		return nil
+	}
+
+	for _, finding := range findings {
+		log.Warn().
+			Int("stack_identifier", int(stack.ID)).
+			Str("resource", finding.Resource).
+			Str("rule", finding.Rule).
+			Msg(finding.Message)
+	}
+
+	if manager.agentOptions.DeploymentLintPolicy != agent.DeploymentLintPolicyBlock {
+		return nil
+	}
+
+	stack.Status = StatusError
+
+	data, err := json.Marshal(findings)
+	if err != nil {
+		data = []byte(fmt.Sprintf("%d findings", len(findings)))
+	}
+
+	statusUpdateErr := manager.portainerClient.SetEdgeStackStatus(int(stack.ID), portainer.EdgeStackStatusError, stack.RollbackTo, "stack blocked by the deployment lint policy: "+string(data))
+	if statusUpdateErr != nil {
+		log.Error().Err(statusUpdateErr).Msg("unable to update Edge stack status")
+	}
+
+	return errors.New("stack blocked by the deployment lint policy")
+}
+
+// checkDeploymentQuotas refuses to deploy a stack when the resources it requires, added to the resources already
+// used on the host, exceed the deployment quotas of the agent
+func (manager *StackManager) checkDeploymentQuotas(ctx context.Context, stack *edgeStack, stackName, stackFileLocation string) error {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	quotas := manager.agentOptions.DeploymentQuotas
+	if quotas == (agent.DeploymentQuotas{}) || (manager.engineType != EngineTypeDockerStandalone && manager.engineType != EngineTypeDockerSwarm) {
+		return nil
+	}
+
+	content, err := os.ReadFile(stackFileLocation)
+	if err != nil {
+		return manager.retryStackCheck(stack, "deployment quotas check", err)
+	}
+
+	requirements, err := yaml.ComposeResourceRequirements(string(content))
+	if err != nil {
+		// The deployer validation is responsible for the invalid files
+		return nil
+	}
+
+	usage, err := docker.GetResourceUsage(ctx, stackName)
+	if err != nil {
+		return manager.retryStackCheck(stack, "deployment quotas check", fmt.Errorf("unable to retrieve the resource usage of the host: %w", err))
+	}
+
+	var violations []string
+
+	if quotas.MaxContainers > 0 && usage.Containers+requirements.Containers > quotas.MaxContainers {
+		violations = append(violations, fmt.Sprintf("%d containers required, %d available", requirements.Containers, max(quotas.MaxContainers-usage.Containers, 0)))
+	}
+
+	if quotas.MaxVolumes > 0 && usage.Volumes+requirements.Volumes > quotas.MaxVolumes {
+		violations = append(violations, fmt.Sprintf("%d volumes required, %d available", requirements.Volumes, max(quotas.MaxVolumes-usage.Volumes, 0)))
+	}
+
+	if quotas.MaxMemory > 0 && usage.Memory+requirements.Memory > quotas.MaxMemory {
+		violations = append(violations, fmt.Sprintf("%d bytes of memory required, %d available", requirements.Memory, max(quotas.MaxMemory-usage.Memory, 0)))
+	}
+
+	if quotas.MaxCPUs > 0 && usage.CPUs+requirements.CPUs > quotas.MaxCPUs {
+		violations = append(violations, fmt.Sprintf("%.2f CPUs required, %.2f available", requirements.CPUs, max(quotas.MaxCPUs-usage.CPUs, 0)))
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+
+	message := "deployment quota exceeded: " + strings.Join(violations, ", ")
+
+	log.Error().Int("stack_identifier", int(stack.ID)).Str("stack_name", stackName).Msg(message)
+
+	stack.Status = StatusError
+
+	statusUpdateErr := manager.portainerClient.SetEdgeStackStatus(int(stack.ID), portainer.EdgeStackStatusError, stack.RollbackTo, message)
+	if statusUpdateErr != nil {
+		log.Error().Err(statusUpdateErr).Msg("unable to update Edge stack status")
+	}
+
+	return errors.New(message)
+}
+
+// checksDue returns false when the checks preceding the deployment of the stack could not be completed recently, the
+// stack is then retried later. Like the deployments, the checks are retried on every loop during the first hour and
+// hourly afterwards.
+func (manager *StackManager) checksDue(stack *edgeStack) bool {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	if stack.CheckCount <= RetryInterval || stack.CheckCount%RetryInterval == 0 {
+		return true
+	}
+
+	stack.CheckCount += 1
+	stack.Status = StatusRetry
+
+	return false
+}
+
+// retryStackCheck is called with manager.mu held when the check of the stack could not be completed, e.g. because the
+// stack file or the Docker daemon is unavailable. The stack is retried until MaxRetries attempts failed, it is then
+// set in error and the error is sent to the server. It returns err.
+func (manager *StackManager) retryStackCheck(stack *edgeStack, check string, err error) error {
+	stack.CheckCount += 1
+
+	log.Error().Err(err).Int("stack_identifier", int(stack.ID)).Int("CheckCount", stack.CheckCount).Str("check", check).Msg("unable to run the check of the stack")
+
+	if stack.CheckCount < MaxRetries {
+		stack.Status = StatusRetry
+
+		return err
+	}
+
+	stack.Status = StatusError
+
+	statusUpdateErr := manager.portainerClient.SetEdgeStackStatus(int(stack.ID), portainer.EdgeStackStatusError, stack.RollbackTo, "unable to run the "+check+": "+err.Error())
+	if statusUpdateErr != nil {
+		log.Error().Err(statusUpdateErr).Msg("unable to update Edge stack status")
+	}
+
+	return err
+}
+
 func (manager *StackManager) pullImages(ctx context.Context, stack *edgeStack, stackName, stackFileLocation string) error {
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
@@ -543,7 +942,8 @@ func (manager *StackManager) pullImages(ctx context.Context, stack *edgeStack, s
 	return nil
 }
 
-func (manager *StackManager) deployStack(ctx context.Context, stack *edgeStack, stackName, stackFileLocation string) {
+// deployStack deploys the stack, it returns true when the stack was deployed and its post-deploy hook must be run
+func (manager *StackManager) deployStack(ctx context.Context, stack *edgeStack, stackName, stackFileLocation string) bool {
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
 
@@ -567,6 +967,8 @@ func (manager *StackManager) deployStack(ctx context.Context, stack *edgeStack,
 
 		envVars := buildEnvVarsForDeployer(stack.EnvVars)
 
+		entry := manager.beginDeployJournal(stack, stackName)
+
 		err = manager.deployer.Deploy(ctx, stackName, []string{stackFileLocation},
 			agent.DeployOptions{
 				DeployerBaseOptions: agent.DeployerBaseOptions{
@@ -577,6 +979,8 @@ func (manager *StackManager) deployStack(ctx context.Context, stack *edgeStack,
 			},
 		)
 
+		entry.Complete()
+
 		if err == nil {
 			stack.Action = actionIdle
 
@@ -592,23 +996,24 @@ func (manager *StackManager) deployStack(ctx context.Context, stack *edgeStack,
 				log.Error().Err(err).Msg("unable to backup successful Edge stack")
 			}
 
-			stack.Status = StatusAwaitingDeployedStatus
+			manager.saveDeployedVersion(stack)
 
-		} else {
-			log.Error().Err(err).Int("DeployCount", stack.DeployCount).Msg("stack deployment failed")
+			return true
+		}
 
-			if stack.RetryDeploy && stack.DeployCount < MaxRetries {
-				stack.Status = StatusRetry
-			} else {
-				stack.Status = StatusError
+		log.Error().Err(err).Int("DeployCount", stack.DeployCount).Msg("stack deployment failed")
 
-				err = manager.portainerClient.SetEdgeStackStatus(int(stack.ID), portainer.EdgeStackStatusError, stack.RollbackTo, "failed to redeploy stack")
-				if err != nil {
-					log.Error().Err(err).Msg("unable to update Edge stack status")
-				}
+		if stack.RetryDeploy && stack.DeployCount < MaxRetries {
+			stack.Status = StatusRetry
+		} else {
+			err = manager.failDeployment(ctx, stack, stackName, manager.diagnoseStartFailure(ctx, stack, stackName, err.Error()))
+			if err != nil {
+				log.Error().Err(err).Msg("unable to update Edge stack status")
 			}
 		}
 	}
+
+	return false
 }
 
 func buildEnvVarsForDeployer(envVars []portainer.Pair) []string {
@@ -621,13 +1026,21 @@ func buildEnvVarsForDeployer(envVars []portainer.Pair) []string {
 
 func (manager *StackManager) deleteStack(ctx context.Context, stack *edgeStack, stackName, stackFileLocation string) {
 	manager.mu.Lock()
-	defer manager.mu.Unlock()
-
 	stack.Status = StatusRemoving
+	successFileFolder := SuccessStackFileFolder(stack.FileFolder)
+	manager.mu.Unlock()
+
 	log.Debug().Int("stack_identifier", int(stack.ID)).Msg("removing stack")
 
-	successFileFolder := SuccessStackFileFolder(stack.FileFolder)
-	err := manager.deployer.Remove(
+	err := manager.runHook(ctx, stack, successFileFolder, hookPreRemove)
+	if err != nil {
+		log.Warn().Err(err).Int("stack_identifier", int(stack.ID)).Msg("stack hook failed, removing the stack anyway")
+	}
+
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	err = manager.deployer.Remove(
 		ctx,
 		stackName,
 		[]string{stackFileLocation},
@@ -665,6 +1078,11 @@ func (manager *StackManager) deleteStack(ctx context.Context, stack *edgeStack,
 	if err != nil {
 		log.Error().Err(err).Msgf("unable to delete Edge stack folder %s", successFileFolder)
 	}
+
+	err = manager.versions.remove(int(stack.ID))
+	if err != nil {
+		log.Error().Err(err).Msg("unable to delete the deployed versions of the Edge stack")
+	}
 }
 
 func (manager *StackManager) SetEngineStatus(engineStatus engineType) error {
@@ -679,7 +1097,7 @@ func (manager *StackManager) SetEngineStatus(engineStatus engineType) error {
 		return err
 	}
 
-	deployer, err := buildDeployerService(manager.assetsPath, engineStatus)
+	deployer, err := buildDeployerService(manager.assetsPath, engineStatus, manager.agentOptions)
 	if err != nil {
 		return err
 	}
@@ -688,7 +1106,7 @@ func (manager *StackManager) SetEngineStatus(engineStatus engineType) error {
 	return nil
 }
 
-func buildDeployerService(assetsPath string, engineStatus engineType) (agent.Deployer, error) {
+func buildDeployerService(assetsPath string, engineStatus engineType, agentOptions *agent.Options) (agent.Deployer, error) {
 	switch engineStatus {
 	case EngineTypeDockerStandalone:
 		return exec.NewDockerComposeStackService(assetsPath)
@@ -697,7 +1115,7 @@ func buildDeployerService(assetsPath string, engineStatus engineType) (agent.Dep
 	case EngineTypeKubernetes:
 		return exec.NewKubernetesDeployer(assetsPath), nil
 	case EngineTypeNomad:
-		return nomad.NewDeployer()
+		return nomad.NewDeployer(agentOptions)
 	}
 
 	return nil, fmt.Errorf("engine status %d not supported", engineStatus)
@@ -772,6 +1190,7 @@ func (manager *StackManager) buildDeployerParams(stackPayload edge.StackPayload,
 	stack.PullCount = 0
 	stack.PullFinished = false
 	stack.DeployCount = 0
+	stack.CheckCount = 0
 
 	stack.SupportRelativePath = stackPayload.SupportRelativePath
 	stack.FilesystemPath = stackPayload.FilesystemPath
@@ -789,6 +1208,16 @@ func (manager *StackManager) buildDeployerParams(stackPayload edge.StackPayload,
 		return err
 	}
 
+	err = manager.addDNSOverridesToEntryFile(&stackPayload)
+	if err != nil {
+		return err
+	}
+
+	err = manager.addPriorityClassesToEntryFile(&stackPayload)
+	if err != nil {
+		return err
+	}
+
 	if !deleteStack {
 		err = filesystem.PersistDir(stack.FileFolder, stackPayload.DirEntries)
 		if err != nil {
@@ -814,7 +1243,13 @@ func (manager *StackManager) GetEdgeRegistryCredentials() []edge.RegistryCredent
 func (manager *StackManager) DeleteNormalStack(ctx context.Context, stackName string) error {
 	log.Debug().Str("stack_name", stackName).Msg("removing normal stack")
 
-	err := manager.deployer.Remove(ctx, stackName, []string{}, agent.RemoveOptions{})
+	release, err := stacklock.Acquire(ctx, stackName, "remove")
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	err = manager.deployer.Remove(ctx, stackName, []string{}, agent.RemoveOptions{})
 	if err != nil {
 		log.Error().Err(err).Msg("unable to remove normal stack")
 		return err
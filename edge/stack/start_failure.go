@@ -0,0 +1,48 @@
+package stack
+
+import (
+	"context"
+	"time"
+
+	"github.com/portainer/agent/docker"
+
+	"github.com/rs/zerolog/log"
+)
+
+// diagnoseStartFailure identifies the cause of a failed deployment from the containers of the stack that failed to
+// start, or from the deployment error when no container was created, and records the diagnosis reported in the
+// snapshots. It returns the status message of the stack.
+func (manager *StackManager) diagnoseStartFailure(ctx context.Context, stack *edgeStack, stackName, message string) string {
+	var failures []docker.StartFailure
+
+	switch manager.engineType {
+	case EngineTypeDockerStandalone:
+		failures = docker.DiagnoseStartFailures(ctx, stackName, message)
+	case EngineTypeDockerSwarm:
+		if message != "" {
+			failures = []docker.StartFailure{{Cause: docker.ClassifyStartError(message), Message: message}}
+		}
+	}
+
+	if len(failures) == 0 {
+		return message
+	}
+
+	for _, failure := range failures {
+		log.Error().
+			Int("stack_identifier", int(stack.ID)).
+			Str("container", failure.Container).
+			Str("cause", failure.Cause).
+			Str("message", failure.Message).
+			Msg("stack container failed to start")
+	}
+
+	docker.SetStartFailures(docker.StackStartFailure{
+		StackID:  int(stack.ID),
+		Name:     stack.Name,
+		Failures: failures,
+		FailedAt: time.Now(),
+	})
+
+	return docker.StartFailuresMessage(failures)
+}
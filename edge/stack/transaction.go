@@ -0,0 +1,283 @@
+package stack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	portainer "github.com/portainer/portainer/api"
+	"github.com/portainer/portainer/api/edge"
+	"github.com/portainer/portainer/api/filesystem"
+
+	"github.com/rs/zerolog/log"
+)
+
+// preparedTransactionTimeout is the duration after which a transaction that was not committed is aborted, the
+// prepared version is dropped and the deployed version is kept
+const preparedTransactionTimeout = time.Hour
+
+var errUnknownTransaction = errors.New("unknown transaction")
+
+// stackTransaction is a version of a stack prepared on all the devices of a site before it is deployed on any of
+// them. The images of the version are pulled and the version is validated during the prepare, the version is
+// deployed on commit.
+type stackTransaction struct {
+	ID       string
+	Version  int
+	Prepared bool
+	Deadline time.Time
+
+	// previous is the stack replaced by the prepared version, nil when the stack was not deployed
+	previous *edgeStack
+}
+
+// PrepareStack stages the version of the stack of the transaction: its files are persisted, validated and its
+// images are pulled, the version is only deployed once the transaction is committed. The outcome of the prepare is
+// sent to the server with the status of the stack.
+func (manager *StackManager) PrepareStack(ctx context.Context, transactionID string, stackData edge.StackPayload) error {
+	manager.mu.Lock()
+
+	id := edgeStackID(stackData.ID)
+
+	if tx, ok := manager.transactions[id]; ok {
+		manager.mu.Unlock()
+
+		if tx.ID == transactionID && tx.Version == stackData.Version {
+			return nil
+		}
+
+		return fmt.Errorf("the stack is already prepared by the transaction %s", tx.ID)
+	}
+
+	var previous *edgeStack
+	if stack, ok := manager.stacks[id]; ok {
+		if stack.Version == stackData.Version {
+			manager.mu.Unlock()
+
+			return nil
+		}
+
+		clonedStack := *stack
+		previous = &clonedStack
+	}
+
+	manager.mu.Unlock()
+
+	if err := manager.buildDeployerParams(stackData, false); err != nil {
+		manager.mu.Lock()
+		defer manager.mu.Unlock()
+
+		// the files of the version can be partially persisted over the files of the deployed version
+		var cleanupErr error
+		if previous != nil {
+			cleanupErr = restoreStackFiles(previous)
+		} else if _, ok := manager.stacks[id]; !ok {
+			cleanupErr = os.RemoveAll(getStackFileFolder(&edgeStack{StackPayload: stackData}))
+		}
+
+		if cleanupErr != nil {
+			log.Error().Err(cleanupErr).Int("stack_identifier", stackData.ID).Msg("unable to clean up the files of the stack that could not be prepared")
+		}
+
+		return err
+	}
+
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	stack, ok := manager.stacks[id]
+	if !ok {
+		return errors.New("the prepared stack cannot be found")
+	}
+
+	// the images are always pulled during the prepare, so that the commit does not depend on the registries
+	stack.PrePullImage = true
+
+	manager.transactions[id] = &stackTransaction{
+		ID:       transactionID,
+		Version:  stackData.Version,
+		Deadline: time.Now().Add(preparedTransactionTimeout),
+		previous: previous,
+	}
+
+	log.Info().
+		Int("stack_identifier", stackData.ID).
+		Int("stack_version", stackData.Version).
+		Str("transaction", transactionID).
+		Msg("preparing the stack")
+
+	return nil
+}
+
+// CommitStack deploys the version of the stack prepared by the transaction. The version of the stack is returned
+// when it is already deployed, an error is returned when the prepare did not complete.
+func (manager *StackManager) CommitStack(transactionID string, stackID, version int) error {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	id := edgeStackID(stackID)
+
+	tx, ok := manager.transactions[id]
+	if !ok || tx.ID != transactionID {
+		if stack, ok := manager.stacks[id]; ok && stack.Version == version {
+			return nil
+		}
+
+		return errUnknownTransaction
+	}
+
+	if !tx.Prepared {
+		return errors.New("the stack is not prepared yet")
+	}
+
+	stack, ok := manager.stacks[id]
+	if !ok {
+		delete(manager.transactions, id)
+
+		return errors.New("the prepared stack cannot be found")
+	}
+
+	delete(manager.transactions, id)
+
+	stack.Status = StatusPending
+
+	log.Info().
+		Int("stack_identifier", stackID).
+		Int("stack_version", tx.Version).
+		Str("transaction", transactionID).
+		Msg("committing the prepared stack")
+
+	return nil
+}
+
+// AbortStack drops the version of the stack prepared by the transaction and restores the version deployed before
+// the prepare
+func (manager *StackManager) AbortStack(transactionID string, stackID int) error {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	tx, ok := manager.transactions[edgeStackID(stackID)]
+	if !ok || tx.ID != transactionID {
+		return errUnknownTransaction
+	}
+
+	return manager.abortTransaction(stackID, tx)
+}
+
+// abortTransaction must be called with the lock held
+func (manager *StackManager) abortTransaction(stackID int, tx *stackTransaction) error {
+	id := edgeStackID(stackID)
+
+	delete(manager.transactions, id)
+
+	log.Info().
+		Int("stack_identifier", stackID).
+		Int("stack_version", tx.Version).
+		Str("transaction", tx.ID).
+		Msg("aborting the prepared stack")
+
+	stack, ok := manager.stacks[id]
+	if !ok {
+		return nil
+	}
+
+	if tx.previous == nil {
+		delete(manager.stacks, id)
+
+		return os.RemoveAll(stack.FileFolder)
+	}
+
+	manager.stacks[id] = tx.previous
+
+	return restoreStackFiles(tx.previous)
+}
+
+// restoreStackFiles restores the files of the deployed version of the stack, replaced by the files of a prepared
+// version, from the copy of the last successful deployment
+func restoreStackFiles(stack *edgeStack) error {
+	if stack == nil {
+		return nil
+	}
+
+	successFolder := SuccessStackFileFolder(stack.FileFolder)
+	if _, err := os.Stat(successFolder); err != nil {
+		return nil
+	}
+
+	if err := os.RemoveAll(stack.FileFolder); err != nil {
+		return err
+	}
+
+	return filesystem.CopyDir(successFolder, stack.FileFolder, false)
+}
+
+// abortExpiredTransactions aborts the transactions that were not committed before their deadline, it must be
+// called with the lock held
+func (manager *StackManager) abortExpiredTransactions() {
+	for id, tx := range manager.transactions {
+		if time.Now().Before(tx.Deadline) {
+			continue
+		}
+
+		rollbackTo := tx.previous.rollbackTo()
+
+		if err := manager.abortTransaction(int(id), tx); err != nil {
+			log.Error().Err(err).Int("stack_identifier", int(id)).Msg("unable to restore the stack of the expired transaction")
+		}
+
+		message := fmt.Sprintf("the transaction %s was not committed before its deadline, the prepared version %d was dropped", tx.ID, tx.Version)
+
+		statusUpdateErr := manager.portainerClient.SetEdgeStackStatus(int(id), portainer.EdgeStackStatusError, rollbackTo, message)
+		if statusUpdateErr != nil {
+			log.Error().Err(statusUpdateErr).Msg("unable to update Edge stack status")
+		}
+	}
+}
+
+// preparingStack returns true when the stack is staged by a transaction that was not prepared yet
+func (manager *StackManager) preparingStack(stack *edgeStack) bool {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	tx, ok := manager.transactions[edgeStackID(stack.ID)]
+
+	return ok && tx.Version == stack.Version
+}
+
+// holdPreparedStack stops the deployment of a stack staged by a transaction once its images are pulled, the
+// stack is prepared and waits for the commit of the transaction
+func (manager *StackManager) holdPreparedStack(stack *edgeStack) bool {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	tx, ok := manager.transactions[edgeStackID(stack.ID)]
+	if !ok || tx.Version != stack.Version {
+		return false
+	}
+
+	tx.Prepared = true
+	stack.Status = StatusPrepared
+
+	log.Info().
+		Int("stack_identifier", int(stack.ID)).
+		Int("stack_version", stack.Version).
+		Str("transaction", tx.ID).
+		Msg("stack prepared, waiting for the commit")
+
+	statusUpdateErr := manager.portainerClient.SetEdgeStackStatus(int(stack.ID), portainer.EdgeStackStatusImagesPulled, stack.RollbackTo, "prepared for the transaction "+tx.ID)
+	if statusUpdateErr != nil {
+		log.Error().Err(statusUpdateErr).Msg("unable to update Edge stack status")
+	}
+
+	return true
+}
+
+func (stack *edgeStack) rollbackTo() *int {
+	if stack == nil {
+		return nil
+	}
+
+	return stack.RollbackTo
+}
@@ -0,0 +1,347 @@
+package stack
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/portainer/agent"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/portainer/portainer/api/edge"
+	"github.com/portainer/portainer/api/filesystem"
+)
+
+const testTransactionID = "tx-1"
+
+// newStackPayload returns the payload of the version of a stack whose files are persisted under filesystemPath
+func newStackPayload(filesystemPath string, version int, content string) edge.StackPayload {
+	return edge.StackPayload{
+		ID:                  7,
+		Name:                "web",
+		Version:             version,
+		EntryFileName:       "docker-compose.yml",
+		SupportRelativePath: true,
+		FilesystemPath:      filesystemPath,
+		DirEntries: []filesystem.DirEntry{
+			{Name: "docker-compose.yml", Content: base64.StdEncoding.EncodeToString([]byte(content)), IsFile: true, Permissions: 0644},
+		},
+	}
+}
+
+// deployTestStack records the version of the stack as deployed, along with the copy of its files
+func deployTestStack(t *testing.T, manager *StackManager, payload edge.StackPayload) *edgeStack {
+	t.Helper()
+
+	err := manager.buildDeployerParams(payload, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stack := manager.stacks[edgeStackID(payload.ID)]
+	stack.Status = StatusDeployed
+	stack.Action = actionIdle
+
+	err = backupSuccessStack(stack)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return stack
+}
+
+func stackFileContent(t *testing.T, manager *StackManager) string {
+	t.Helper()
+
+	stack, ok := manager.stacks[7]
+	if !ok {
+		t.Fatal("the stack cannot be found")
+	}
+
+	content, err := os.ReadFile(filepath.Join(stack.FileFolder, stack.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(content)
+}
+
+func TestPrepareStack(t *testing.T) {
+	manager, _ := newTestManager(t, &agent.Options{})
+	dir := t.TempDir()
+
+	deployTestStack(t, manager, newStackPayload(dir, 1, "version 1"))
+
+	err := manager.PrepareStack(context.Background(), testTransactionID, newStackPayload(dir, 2, "version 2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, ok := manager.transactions[7]
+	if !ok || tx.ID != testTransactionID || tx.Version != 2 || tx.Prepared || tx.previous == nil || tx.previous.Version != 1 {
+		t.Fatalf("expected the transaction to stage the version 2, got %+v", tx)
+	}
+
+	stack := manager.stacks[7]
+	if stack.Version != 2 || stack.Status != StatusPending || !stack.PrePullImage {
+		t.Errorf("expected the version 2 to be pulled, got the version %d with the status %d", stack.Version, stack.Status)
+	}
+
+	if content := stackFileContent(t, manager); content != "version 2" {
+		t.Errorf("expected the files of the version 2, got %q", content)
+	}
+
+	if !manager.preparingStack(stack) {
+		t.Error("expected the stack to be prepared by the transaction")
+	}
+
+	// the prepare is idempotent
+	err = manager.PrepareStack(context.Background(), testTransactionID, newStackPayload(dir, 2, "version 2"))
+	if err != nil {
+		t.Errorf("expected the prepare to be idempotent, got %v", err)
+	}
+
+	err = manager.PrepareStack(context.Background(), "tx-2", newStackPayload(dir, 3, "version 3"))
+	if err == nil || !strings.Contains(err.Error(), "already prepared by the transaction "+testTransactionID) {
+		t.Errorf("expected the stack to be locked by the transaction, got %v", err)
+	}
+}
+
+func TestPrepareStackFailure(t *testing.T) {
+	// the second entry cannot be written as the entry file is not a folder
+	failingPayload := func(dir string, version int) edge.StackPayload {
+		payload := newStackPayload(dir, version, "partial version")
+		payload.DirEntries = append(payload.DirEntries, filesystem.DirEntry{Name: "docker-compose.yml/config", Content: "", IsFile: true, Permissions: 0644})
+
+		return payload
+	}
+
+	t.Run("deployed stack", func(t *testing.T) {
+		manager, _ := newTestManager(t, &agent.Options{})
+		dir := t.TempDir()
+
+		deployTestStack(t, manager, newStackPayload(dir, 1, "version 1"))
+
+		err := manager.PrepareStack(context.Background(), testTransactionID, failingPayload(dir, 2))
+		if err == nil {
+			t.Fatal("expected the prepare to fail")
+		}
+
+		if len(manager.transactions) != 0 {
+			t.Error("expected no transaction to be recorded")
+		}
+
+		stack := manager.stacks[7]
+		if stack.Version != 1 || stack.Status != StatusDeployed {
+			t.Errorf("expected the deployed version to be kept, got the version %d with the status %d", stack.Version, stack.Status)
+		}
+
+		if content := stackFileContent(t, manager); content != "version 1" {
+			t.Errorf("expected the files of the deployed version to be restored, got %q", content)
+		}
+	})
+
+	t.Run("new stack", func(t *testing.T) {
+		manager, _ := newTestManager(t, &agent.Options{})
+		dir := t.TempDir()
+
+		payload := failingPayload(dir, 1)
+
+		err := manager.PrepareStack(context.Background(), testTransactionID, payload)
+		if err == nil {
+			t.Fatal("expected the prepare to fail")
+		}
+
+		if len(manager.transactions) != 0 || len(manager.stacks) != 0 {
+			t.Error("expected no transaction and no stack to be recorded")
+		}
+
+		if _, err := os.Stat(getStackFileFolder(&edgeStack{StackPayload: payload})); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected the partially persisted files to be removed, got %v", err)
+		}
+	})
+}
+
+func TestCommitStack(t *testing.T) {
+	manager, cli := newTestManager(t, &agent.Options{})
+	dir := t.TempDir()
+
+	deployTestStack(t, manager, newStackPayload(dir, 1, "version 1"))
+
+	err := manager.PrepareStack(context.Background(), testTransactionID, newStackPayload(dir, 2, "version 2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = manager.CommitStack(testTransactionID, 7, 2)
+	if err == nil || !strings.Contains(err.Error(), "not prepared yet") {
+		t.Errorf("expected the commit to wait for the prepare, got %v", err)
+	}
+
+	if _, ok := manager.transactions[7]; !ok {
+		t.Fatal("expected the transaction to be kept after a failed commit")
+	}
+
+	err = manager.CommitStack("tx-2", 7, 3)
+	if !errors.Is(err, errUnknownTransaction) {
+		t.Errorf("expected errUnknownTransaction, got %v", err)
+	}
+
+	stack := manager.stacks[7]
+	if !manager.holdPreparedStack(stack) {
+		t.Fatal("expected the stack to be held once prepared")
+	}
+
+	if stack.Status != StatusPrepared {
+		t.Errorf("expected the stack to be prepared, got %d", stack.Status)
+	}
+
+	update, _ := cli.lastStatus()
+	if update.status != portainer.EdgeStackStatusImagesPulled || update.message != "prepared for the transaction "+testTransactionID {
+		t.Errorf("expected the prepare to be reported, got %+v", update)
+	}
+
+	err = manager.CommitStack(testTransactionID, 7, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := manager.transactions[7]; ok {
+		t.Error("expected the transaction to be removed once committed")
+	}
+
+	if stack.Status != StatusPending || stack.Version != 2 {
+		t.Errorf("expected the version 2 to be deployed, got the version %d with the status %d", stack.Version, stack.Status)
+	}
+
+	// the commit is idempotent
+	err = manager.CommitStack(testTransactionID, 7, 2)
+	if err != nil {
+		t.Errorf("expected the commit to be idempotent, got %v", err)
+	}
+}
+
+func TestCommitStackRemovedStack(t *testing.T) {
+	manager, _ := newTestManager(t, &agent.Options{})
+
+	err := manager.PrepareStack(context.Background(), testTransactionID, newStackPayload(t.TempDir(), 1, "version 1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager.transactions[7].Prepared = true
+	delete(manager.stacks, 7)
+
+	err = manager.CommitStack(testTransactionID, 7, 1)
+	if err == nil || !strings.Contains(err.Error(), "cannot be found") {
+		t.Errorf("expected the commit to fail, got %v", err)
+	}
+
+	if len(manager.transactions) != 0 {
+		t.Error("expected the transaction of the removed stack to be dropped")
+	}
+}
+
+func TestAbortStack(t *testing.T) {
+	t.Run("deployed stack", func(t *testing.T) {
+		manager, _ := newTestManager(t, &agent.Options{})
+		dir := t.TempDir()
+
+		deployTestStack(t, manager, newStackPayload(dir, 1, "version 1"))
+
+		err := manager.PrepareStack(context.Background(), testTransactionID, newStackPayload(dir, 2, "version 2"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = manager.AbortStack("tx-2", 7)
+		if !errors.Is(err, errUnknownTransaction) {
+			t.Errorf("expected errUnknownTransaction, got %v", err)
+		}
+
+		err = manager.AbortStack(testTransactionID, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(manager.transactions) != 0 {
+			t.Error("expected the transaction to be removed")
+		}
+
+		stack := manager.stacks[7]
+		if stack.Version != 1 || stack.Status != StatusDeployed {
+			t.Errorf("expected the deployed version to be restored, got the version %d with the status %d", stack.Version, stack.Status)
+		}
+
+		if content := stackFileContent(t, manager); content != "version 1" {
+			t.Errorf("expected the files of the deployed version to be restored, got %q", content)
+		}
+	})
+
+	t.Run("new stack", func(t *testing.T) {
+		manager, _ := newTestManager(t, &agent.Options{})
+
+		err := manager.PrepareStack(context.Background(), testTransactionID, newStackPayload(t.TempDir(), 1, "version 1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		folder := manager.stacks[7].FileFolder
+
+		err = manager.AbortStack(testTransactionID, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(manager.stacks) != 0 {
+			t.Error("expected the prepared stack to be removed")
+		}
+
+		if _, err := os.Stat(folder); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected the files of the prepared stack to be removed, got %v", err)
+		}
+	})
+}
+
+func TestAbortExpiredTransactions(t *testing.T) {
+	manager, cli := newTestManager(t, &agent.Options{})
+	dir := t.TempDir()
+
+	deployTestStack(t, manager, newStackPayload(dir, 1, "version 1"))
+
+	err := manager.PrepareStack(context.Background(), testTransactionID, newStackPayload(dir, 2, "version 2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager.mu.Lock()
+	manager.abortExpiredTransactions()
+	manager.mu.Unlock()
+
+	if _, ok := manager.transactions[7]; !ok {
+		t.Fatal("expected the transaction to be kept before its deadline")
+	}
+
+	manager.transactions[7].Deadline = time.Now().Add(-time.Second)
+
+	manager.mu.Lock()
+	manager.abortExpiredTransactions()
+	manager.mu.Unlock()
+
+	if len(manager.transactions) != 0 || manager.stacks[7].Version != 1 {
+		t.Error("expected the expired transaction to be aborted")
+	}
+
+	if content := stackFileContent(t, manager); content != "version 1" {
+		t.Errorf("expected the files of the deployed version to be restored, got %q", content)
+	}
+
+	update, _ := cli.lastStatus()
+	if update.status != portainer.EdgeStackStatusError || !strings.Contains(update.message, "was not committed before its deadline, the prepared version 2 was dropped") {
+		t.Errorf("expected the expiration to be reported, got %+v", update)
+	}
+}
@@ -0,0 +1,250 @@
+package stack
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/crypto"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/portainer/portainer/api/filesystem"
+)
+
+// versionsIndexFileName is the name of the file describing the versions kept for a stack
+const versionsIndexFileName = "versions.json"
+
+// stackVersion represents a version of an Edge stack deployed by the agent
+type stackVersion struct {
+	Version    int
+	FileName   string
+	Namespace  string           `json:",omitempty"`
+	EnvVars    []portainer.Pair `json:",omitempty"`
+	DeployedAt time.Time
+	// KnownGood is true once the version was reported as running
+	KnownGood bool
+}
+
+// versionStore persists the files of the last deployed versions of the Edge stacks inside the data folder, so that
+// a failed deployment can be rolled back to the last version known to be running
+type versionStore struct {
+	path        string
+	historySize int
+}
+
+func newVersionStore(dataPath string, historySize int) *versionStore {
+	return &versionStore{
+		path:        filepath.Join(dataPath, agent.EdgeStackVersionsDirName),
+		historySize: historySize,
+	}
+}
+
+func (store *versionStore) stackPath(stackID int) string {
+	return filepath.Join(store.path, strconv.Itoa(stackID))
+}
+
+// versionPath returns the folder containing the files of the version of the stack
+func (store *versionStore) versionPath(stackID, version int) string {
+	return filepath.Join(store.stackPath(stackID), strconv.Itoa(version))
+}
+
+func (store *versionStore) list(stackID int) ([]stackVersion, error) {
+	data, err := os.ReadFile(filepath.Join(store.stackPath(stackID), versionsIndexFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	data, err = crypto.DecryptState(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []stackVersion
+	err = json.Unmarshal(data, &versions)
+
+	return versions, err
+}
+
+func (store *versionStore) write(stackID int, versions []stackVersion) error {
+	data, err := json.Marshal(versions)
+	if err != nil {
+		return err
+	}
+
+	data, err = crypto.EncryptState(data)
+	if err != nil {
+		return err
+	}
+
+	return filesystem.WriteToFile(filepath.Join(store.stackPath(stackID), versionsIndexFileName), data)
+}
+
+// save copies the files of the deployed stack, replacing a previous copy of the same version, and removes the oldest
+// versions beyond the history size. The last known-good version is always kept.
+func (store *versionStore) save(stack *edgeStack) error {
+	stackID := int(stack.ID)
+
+	versions, err := store.list(stackID)
+	if err != nil {
+		return err
+	}
+
+	dst := store.versionPath(stackID, stack.Version)
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+
+	if err := filesystem.CopyDir(stack.FileFolder, dst, false); err != nil {
+		return err
+	}
+
+	if err := encryptFiles(dst); err != nil {
+		return err
+	}
+
+	saved := stackVersion{
+		Version:    stack.Version,
+		FileName:   stack.FileName,
+		Namespace:  stack.Namespace,
+		EnvVars:    stack.EnvVars,
+		DeployedAt: time.Now(),
+	}
+
+	kept := []stackVersion{saved}
+	for _, v := range versions {
+		if v.Version != stack.Version {
+			kept = append(kept, v)
+		}
+	}
+
+	sort.SliceStable(kept, func(i, j int) bool {
+		return kept[i].DeployedAt.After(kept[j].DeployedAt)
+	})
+
+	kept = store.prune(stackID, kept)
+
+	return store.write(stackID, kept)
+}
+
+// prune removes the files of the versions beyond the history size, except the most recent known-good version, and
+// returns the versions kept
+func (store *versionStore) prune(stackID int, versions []stackVersion) []stackVersion {
+	knownGood := -1
+	for i, v := range versions {
+		if v.KnownGood {
+			knownGood = i
+			break
+		}
+	}
+
+	var kept []stackVersion
+	for i, v := range versions {
+		if i < store.historySize || i == knownGood {
+			kept = append(kept, v)
+			continue
+		}
+
+		os.RemoveAll(store.versionPath(stackID, v.Version))
+	}
+
+	return kept
+}
+
+// markKnownGood records that the version of the stack was reported as running
+func (store *versionStore) markKnownGood(stackID, version int) error {
+	versions, err := store.list(stackID)
+	if err != nil {
+		return err
+	}
+
+	for i := range versions {
+		if versions[i].Version == version {
+			versions[i].KnownGood = true
+
+			return store.write(stackID, versions)
+		}
+	}
+
+	return nil
+}
+
+// lastKnownGood returns the most recently deployed known-good version of the stack other than excludedVersion, or
+// nil when there is none
+func (store *versionStore) lastKnownGood(stackID, excludedVersion int) (*stackVersion, error) {
+	versions, err := store.list(stackID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range versions {
+		if v.KnownGood && v.Version != excludedVersion {
+			return &v, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// restore copies the files of the version of the stack to dst, decrypted
+func (store *versionStore) restore(stackID, version int, dst string) error {
+	src := store.versionPath(stackID, version)
+
+	if err := filesystem.CopyDir(src, dst, false); err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(dst, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil || !crypto.IsEncryptedState(data) {
+			return err
+		}
+
+		data, err = crypto.DecryptState(data)
+		if err != nil {
+			return err
+		}
+
+		return os.WriteFile(path, data, 0600)
+	})
+}
+
+// encryptFiles encrypts the files of the folder in place when the state encryption is enabled
+func encryptFiles(folder string) error {
+	if crypto.DefaultStateCipher() == nil {
+		return nil
+	}
+
+	return filepath.WalkDir(folder, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		data, err = crypto.EncryptState(data)
+		if err != nil {
+			return err
+		}
+
+		return os.WriteFile(path, data, 0600)
+	})
+}
+
+// remove deletes all the versions of the stack
+func (store *versionStore) remove(stackID int) error {
+	return os.RemoveAll(store.stackPath(stackID))
+}
@@ -0,0 +1,54 @@
+package edge
+
+import (
+	"sync"
+	"time"
+)
+
+// tunnelActivity tracks the use of the reverse tunnel: the time of the last request and the number of
+// sessions currently open through it (in-flight requests and websockets such as container consoles).
+type tunnelActivity struct {
+	mu           sync.Mutex
+	lastActivity time.Time
+	sessions     int
+}
+
+// touch records an activity on the tunnel
+func (activity *tunnelActivity) touch() {
+	activity.mu.Lock()
+	activity.lastActivity = time.Now()
+	activity.mu.Unlock()
+}
+
+// startSession records the start of a session, the tunnel is considered active until the returned function
+// is called
+func (activity *tunnelActivity) startSession() func() {
+	activity.mu.Lock()
+	activity.lastActivity = time.Now()
+	activity.sessions++
+	activity.mu.Unlock()
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			activity.mu.Lock()
+			activity.lastActivity = time.Now()
+			activity.sessions--
+			activity.mu.Unlock()
+		})
+	}
+}
+
+// idleDuration returns the time elapsed since the last activity. It returns false when a session is still open
+// or when no activity was ever recorded.
+func (activity *tunnelActivity) idleDuration() (time.Duration, bool) {
+	activity.mu.Lock()
+	defer activity.mu.Unlock()
+
+	if activity.sessions > 0 || activity.lastActivity.IsZero() {
+		return 0, false
+	}
+
+	return time.Since(activity.lastActivity), true
+}
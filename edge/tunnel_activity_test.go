@@ -0,0 +1,27 @@
+package edge
+
+import "testing"
+
+func TestTunnelActivityOpenSessionsKeepTunnelActive(t *testing.T) {
+	activity := tunnelActivity{}
+
+	if _, idle := activity.idleDuration(); idle {
+		t.Error("expected no idle duration before any activity")
+	}
+
+	endSession := activity.startSession()
+	if _, idle := activity.idleDuration(); idle {
+		t.Error("expected the tunnel to be active while a session is open")
+	}
+
+	endSession()
+	endSession()
+
+	if _, idle := activity.idleDuration(); !idle {
+		t.Error("expected the tunnel to be idle once the session is closed")
+	}
+
+	if activity.sessions != 0 {
+		t.Errorf("expected no open session, got %d", activity.sessions)
+	}
+}
@@ -0,0 +1,32 @@
+package edge
+
+import (
+	"fmt"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/chisel"
+)
+
+// tunnelTransports are the transports of the reverse tunnel, by the name selected with EDGE_TUNNEL_TRANSPORT. A new
+// transport only has to implement agent.ReverseTunnelClient and to be registered here.
+var tunnelTransports = map[string]func() agent.ReverseTunnelClient{
+	agent.EdgeTunnelTransportChisel: func() agent.ReverseTunnelClient {
+		return chisel.NewClient()
+	},
+	agent.EdgeTunnelTransportWebSocket: func() agent.ReverseTunnelClient {
+		return chisel.NewWebSocketClient()
+	},
+}
+
+func newTunnelClient(transport string) (agent.ReverseTunnelClient, error) {
+	if transport == "" {
+		transport = agent.EdgeTunnelTransportChisel
+	}
+
+	newClient, ok := tunnelTransports[transport]
+	if !ok {
+		return nil, fmt.Errorf("unsupported tunnel transport: %s", transport)
+	}
+
+	return newClient(), nil
+}
@@ -0,0 +1,118 @@
+package yaml
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// AddDNSOverrides injects the extra hosts (in the host:ip form) and the DNS servers into every service of a
+// compose file. The definitions of the compose file take precedence: a host already defined in the extra_hosts
+// of a service is not overridden and the DNS servers are only set on the services that do not define any.
+func AddDNSOverrides(fileContent string, extraHosts []string, dnsServers []string) (string, error) {
+	if len(extraHosts) == 0 && len(dnsServers) == 0 {
+		return fileContent, nil
+	}
+
+	var document yaml.Node
+	err := yaml.Unmarshal([]byte(fileContent), &document)
+	if err != nil {
+		return "", errors.Wrap(err, "Error while unmarshalling the docker compose file content")
+	}
+
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return fileContent, nil
+	}
+
+	services := mappingValue(document.Content[0], "services")
+	if services == nil || services.Kind != yaml.MappingNode {
+		return fileContent, nil
+	}
+
+	for i := 1; i < len(services.Content); i += 2 {
+		service := services.Content[i]
+		if service.Kind != yaml.MappingNode {
+			continue
+		}
+
+		addExtraHosts(service, extraHosts)
+		addDNSServers(service, dnsServers)
+	}
+
+	out, err := yaml.Marshal(&document)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode compose to yaml file")
+	}
+
+	return string(out), nil
+}
+
+func addExtraHosts(service *yaml.Node, extraHosts []string) {
+	if len(extraHosts) == 0 {
+		return
+	}
+
+	node := mappingValue(service, "extra_hosts")
+	if node == nil {
+		node = &yaml.Node{Kind: yaml.SequenceNode}
+		appendMappingEntry(service, "extra_hosts", node)
+	}
+
+	defined := map[string]bool{}
+
+	switch node.Kind {
+	case yaml.SequenceNode:
+		for _, entry := range node.Content {
+			host, _, _ := strings.Cut(strings.Replace(entry.Value, "=", ":", 1), ":")
+			defined[host] = true
+		}
+	case yaml.MappingNode:
+		for i := 0; i < len(node.Content); i += 2 {
+			defined[node.Content[i].Value] = true
+		}
+	default:
+		return
+	}
+
+	for _, extraHost := range extraHosts {
+		host, ip, found := strings.Cut(extraHost, ":")
+		if !found || defined[host] {
+			continue
+		}
+
+		if node.Kind == yaml.MappingNode {
+			appendMappingEntry(node, host, &yaml.Node{Kind: yaml.ScalarNode, Value: ip})
+			continue
+		}
+
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: extraHost})
+	}
+}
+
+func addDNSServers(service *yaml.Node, dnsServers []string) {
+	if len(dnsServers) == 0 || mappingValue(service, "dns") != nil {
+		return
+	}
+
+	node := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, server := range dnsServers {
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: server})
+	}
+
+	appendMappingEntry(service, "dns", node)
+}
+
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+func appendMappingEntry(mapping *yaml.Node, key string, value *yaml.Node) {
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+}
@@ -0,0 +1,49 @@
+package yaml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAddDNSOverrides(t *testing.T) {
+	compose := `version: "3"
+services:
+  web:
+    image: nginx
+    extra_hosts:
+      - "registry.internal:10.0.0.1"
+  worker:
+    image: busybox
+    dns: 1.1.1.1
+`
+
+	out, err := AddDNSOverrides(compose, []string{"registry.internal:192.168.1.10", "db.internal:192.168.1.11"}, []string{"192.168.1.1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if strings.Contains(out, "registry.internal:192.168.1.10") {
+		t.Errorf("expected the extra host defined by the service to take precedence, got:\n%s", out)
+	}
+
+	if strings.Count(out, "db.internal:192.168.1.11") != 2 {
+		t.Errorf("expected the extra host to be added to both services, got:\n%s", out)
+	}
+
+	if strings.Count(out, "192.168.1.1\n") != 1 || !strings.Contains(out, "dns: 1.1.1.1") {
+		t.Errorf("expected the DNS server to be added only to the service without DNS configuration, got:\n%s", out)
+	}
+}
+
+func TestAddDNSOverridesWithoutOverrides(t *testing.T) {
+	compose := "services:\n  web:\n    image: nginx\n"
+
+	out, err := AddDNSOverrides(compose, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if out != compose {
+		t.Errorf("expected the file content to be unchanged, got:\n%s", out)
+	}
+}
@@ -0,0 +1,209 @@
+package yaml
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// ComposePublishedPort is a port of the host published by a service of a compose file
+type ComposePublishedPort struct {
+	Service  string
+	Port     int
+	Protocol string
+}
+
+// ComposeBindMount is a path of the host bind mounted by a service of a compose file
+type ComposeBindMount struct {
+	Service string
+	Source  string
+	// CreateHostPath is true when the path is created by the deployment when it does not exist, as for the short
+	// syntax of the volumes
+	CreateHostPath bool
+}
+
+// ComposeServiceImage is the image of a service of a compose file
+type ComposeServiceImage struct {
+	Service string
+	Image   string
+}
+
+// ComposePreflightRequirements are the ports, the paths and the images a compose file requires on the host
+type ComposePreflightRequirements struct {
+	Ports      []ComposePublishedPort
+	BindMounts []ComposeBindMount
+	Images     []ComposeServiceImage
+}
+
+// GetComposePreflightRequirements returns the ports published, the host paths bind mounted and the images of the
+// services of a compose file, sorted by service. The values that are interpolated at deployment time are left out.
+func GetComposePreflightRequirements(fileContent string) (ComposePreflightRequirements, error) {
+	var compose struct {
+		Services map[string]struct {
+			Image   string        `yaml:"image"`
+			Ports   []interface{} `yaml:"ports"`
+			Volumes []interface{} `yaml:"volumes"`
+		} `yaml:"services"`
+	}
+
+	requirements := ComposePreflightRequirements{}
+
+	err := yaml.Unmarshal([]byte(fileContent), &compose)
+	if err != nil {
+		return requirements, errors.Wrap(err, "Error while unmarshalling the docker compose file content")
+	}
+
+	names := make([]string, 0, len(compose.Services))
+	for name := range compose.Services {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		service := compose.Services[name]
+
+		if service.Image != "" && !strings.Contains(service.Image, "$") {
+			requirements.Images = append(requirements.Images, ComposeServiceImage{Service: name, Image: service.Image})
+		}
+
+		for _, port := range service.Ports {
+			ports, err := parsePublishedPorts(port)
+			if err != nil {
+				return requirements, errors.WithMessagef(err, "invalid port of the service %s", name)
+			}
+
+			for _, p := range ports {
+				p.Service = name
+				requirements.Ports = append(requirements.Ports, p)
+			}
+		}
+
+		for _, volume := range service.Volumes {
+			if mount, ok := parseBindMount(volume); ok {
+				mount.Service = name
+				requirements.BindMounts = append(requirements.BindMounts, mount)
+			}
+		}
+	}
+
+	return requirements, nil
+}
+
+// parsePublishedPorts returns the host ports published by an entry of the ports of a service, in the short
+// ([ip:]published:target[/protocol]) or the long syntax. The ports that are not published are left out.
+func parsePublishedPorts(value interface{}) ([]ComposePublishedPort, error) {
+	protocol := "tcp"
+	published := ""
+
+	switch v := value.(type) {
+	case int:
+		// only the target port, a random host port is published
+		return nil, nil
+	case string:
+		if strings.Contains(v, "$") {
+			return nil, nil
+		}
+
+		mapping, proto, ok := strings.Cut(v, "/")
+		if ok {
+			protocol = proto
+		}
+
+		// the IPv6 host addresses are enclosed in brackets
+		if strings.HasPrefix(mapping, "[") {
+			if i := strings.Index(mapping, "]:"); i >= 0 {
+				mapping = mapping[i+2:]
+			}
+		}
+
+		parts := strings.Split(mapping, ":")
+		if len(parts) < 2 {
+			return nil, nil
+		}
+
+		published = parts[len(parts)-2]
+	case map[string]interface{}:
+		if p, ok := v["protocol"].(string); ok {
+			protocol = p
+		}
+
+		if v["published"] == nil {
+			return nil, nil
+		}
+
+		published = fmt.Sprint(v["published"])
+		if strings.Contains(published, "$") {
+			return nil, nil
+		}
+	default:
+		return nil, fmt.Errorf("unexpected value %v", value)
+	}
+
+	if published == "" {
+		return nil, nil
+	}
+
+	first, last, isRange := strings.Cut(published, "-")
+	if !isRange {
+		last = first
+	}
+
+	start, err := strconv.Atoi(first)
+	if err != nil {
+		return nil, fmt.Errorf("invalid published port %q", published)
+	}
+
+	end, err := strconv.Atoi(last)
+	if err != nil || end < start {
+		return nil, fmt.Errorf("invalid published port %q", published)
+	}
+
+	ports := make([]ComposePublishedPort, 0, end-start+1)
+	for port := start; port <= end; port++ {
+		ports = append(ports, ComposePublishedPort{Port: port, Protocol: protocol})
+	}
+
+	return ports, nil
+}
+
+// parseBindMount returns the host path of an entry of the volumes of a service, false when the entry is a named
+// volume or is interpolated
+func parseBindMount(value interface{}) (ComposeBindMount, bool) {
+	switch v := value.(type) {
+	case string:
+		source, _, ok := strings.Cut(v, ":")
+		if !ok || !isHostPath(source) {
+			return ComposeBindMount{}, false
+		}
+
+		return ComposeBindMount{Source: source, CreateHostPath: true}, true
+	case map[string]interface{}:
+		source, _ := v["source"].(string)
+		if v["type"] != "bind" || !isHostPath(source) {
+			return ComposeBindMount{}, false
+		}
+
+		mount := ComposeBindMount{Source: source}
+		if bind, ok := v["bind"].(map[string]interface{}); ok {
+			mount.CreateHostPath = isTrue(bind["create_host_path"])
+		}
+
+		return mount, true
+	}
+
+	return ComposeBindMount{}, false
+}
+
+// isHostPath returns true when the source of a volume is a path of the host rather than the name of a volume
+func isHostPath(source string) bool {
+	if strings.Contains(source, "$") {
+		return false
+	}
+
+	return strings.HasPrefix(source, "/") || strings.HasPrefix(source, ".") || strings.HasPrefix(source, "~")
+}
@@ -0,0 +1,77 @@
+package yaml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetComposePreflightRequirements(t *testing.T) {
+	compose := `services:
+  web:
+    image: nginx:1.25
+    ports:
+      - "8080:80"
+      - "127.0.0.1:8443:443/tcp"
+      - "[::1]:9000-9001:9000-9001"
+      - 3000
+      - "${PORT}:80"
+    volumes:
+      - /srv/web:/usr/share/nginx/html:ro
+      - ./conf:/etc/nginx/conf.d
+      - cache:/var/cache/nginx
+  dns:
+    image: ${DNS_IMAGE}
+    ports:
+      - target: 53
+        published: 53
+        protocol: udp
+      - target: 8053
+    volumes:
+      - type: bind
+        source: /etc/dns
+        target: /config
+      - type: bind
+        source: /var/lib/dns
+        target: /data
+        bind:
+          create_host_path: true
+      - type: volume
+        source: leases
+        target: /leases
+`
+
+	requirements, err := GetComposePreflightRequirements(compose)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := ComposePreflightRequirements{
+		Ports: []ComposePublishedPort{
+			{Service: "dns", Port: 53, Protocol: "udp"},
+			{Service: "web", Port: 8080, Protocol: "tcp"},
+			{Service: "web", Port: 8443, Protocol: "tcp"},
+			{Service: "web", Port: 9000, Protocol: "tcp"},
+			{Service: "web", Port: 9001, Protocol: "tcp"},
+		},
+		BindMounts: []ComposeBindMount{
+			{Service: "dns", Source: "/etc/dns"},
+			{Service: "dns", Source: "/var/lib/dns", CreateHostPath: true},
+			{Service: "web", Source: "/srv/web", CreateHostPath: true},
+			{Service: "web", Source: "./conf", CreateHostPath: true},
+		},
+		Images: []ComposeServiceImage{
+			{Service: "web", Image: "nginx:1.25"},
+		},
+	}
+
+	if !reflect.DeepEqual(requirements, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, requirements)
+	}
+}
+
+func TestGetComposePreflightRequirementsInvalidPort(t *testing.T) {
+	_, err := GetComposePreflightRequirements("services:\n  web:\n    ports:\n      - \"http:80\"\n")
+	if err == nil {
+		t.Fatal("expected an error for an invalid published port")
+	}
+}
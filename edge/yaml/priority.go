@@ -0,0 +1,134 @@
+package yaml
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Priority classes of the services of a stack
+const (
+	// PriorityClassCritical favors the service when the CPU or the disks are contended
+	PriorityClassCritical = "critical"
+	// PriorityClassNormal gives the service the default share of the CPU and the disks
+	PriorityClassNormal = "normal"
+	// PriorityClassBatch yields the CPU and the disks to the other services when they are contended
+	PriorityClassBatch = "batch"
+)
+
+// priorityWeights are the CPU shares and the block IO weight of each priority class, the runtime maps them to the
+// cpu.weight and io.weight of the cgroup v2 of the containers (cpu.shares and blkio.weight with cgroup v1)
+var priorityWeights = map[string]struct {
+	cpuShares int
+	ioWeight  int
+}{
+	PriorityClassCritical: {cpuShares: 4096, ioWeight: 1000},
+	PriorityClassNormal:   {cpuShares: 1024, ioWeight: 500},
+	PriorityClassBatch:    {cpuShares: 128, ioWeight: 100},
+}
+
+// ValidPriorityClass returns true when class is a known priority class
+func ValidPriorityClass(class string) bool {
+	_, ok := priorityWeights[class]
+
+	return ok
+}
+
+// AddPriorityClasses sets the CPU shares and the block IO weight of the services of a compose file from their
+// priority class. The class of a service is read from its label (labelKey), defaultClass applies to the services
+// without label. The cpu_shares and the blkio_config weight defined by a service take precedence.
+func AddPriorityClasses(fileContent, labelKey, defaultClass string) (string, error) {
+	if defaultClass != "" && !ValidPriorityClass(defaultClass) {
+		return "", errors.Errorf("invalid priority class %q, critical, normal or batch expected", defaultClass)
+	}
+
+	var document yaml.Node
+	err := yaml.Unmarshal([]byte(fileContent), &document)
+	if err != nil {
+		return "", errors.Wrap(err, "Error while unmarshalling the docker compose file content")
+	}
+
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return fileContent, nil
+	}
+
+	services := mappingValue(document.Content[0], "services")
+	if services == nil || services.Kind != yaml.MappingNode {
+		return fileContent, nil
+	}
+
+	changed := false
+
+	for i := 1; i < len(services.Content); i += 2 {
+		service := services.Content[i]
+		if service.Kind != yaml.MappingNode {
+			continue
+		}
+
+		class := serviceLabel(service, labelKey)
+		if class == "" {
+			class = defaultClass
+		}
+
+		if class == "" {
+			continue
+		}
+
+		weights, ok := priorityWeights[class]
+		if !ok {
+			return "", errors.Errorf("invalid priority class %q of the service %s, critical, normal or batch expected", class, services.Content[i-1].Value)
+		}
+
+		if mappingValue(service, "cpu_shares") == nil {
+			appendMappingEntry(service, "cpu_shares", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(weights.cpuShares)})
+			changed = true
+		}
+
+		blkio := mappingValue(service, "blkio_config")
+		if blkio == nil {
+			blkio = &yaml.Node{Kind: yaml.MappingNode}
+			appendMappingEntry(service, "blkio_config", blkio)
+		}
+
+		if blkio.Kind == yaml.MappingNode && mappingValue(blkio, "weight") == nil {
+			appendMappingEntry(blkio, "weight", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(weights.ioWeight)})
+			changed = true
+		}
+	}
+
+	if !changed {
+		return fileContent, nil
+	}
+
+	out, err := yaml.Marshal(&document)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode compose to yaml file")
+	}
+
+	return string(out), nil
+}
+
+// serviceLabel returns the value of a label of a service, defined either as a mapping or as a list of key=value
+func serviceLabel(service *yaml.Node, key string) string {
+	node := mappingValue(service, "labels")
+	if node == nil {
+		return ""
+	}
+
+	switch node.Kind {
+	case yaml.SequenceNode:
+		for _, entry := range node.Content {
+			if k, v, _ := strings.Cut(entry.Value, "="); k == key {
+				return v
+			}
+		}
+	case yaml.MappingNode:
+		if value := mappingValue(node, key); value != nil {
+			return value.Value
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,76 @@
+package yaml
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestAddPriorityClasses(t *testing.T) {
+	compose := `version: "3"
+services:
+  plc-gateway:
+    image: gateway
+    labels:
+      io.portainer.agent.priority-class: critical
+  reports:
+    image: reports
+    labels:
+      - "io.portainer.agent.priority-class=batch"
+    cpu_shares: 256
+  web:
+    image: nginx
+    blkio_config:
+      weight: 300
+`
+
+	out, err := AddPriorityClasses(compose, "io.portainer.agent.priority-class", PriorityClassNormal)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var result struct {
+		Services map[string]struct {
+			CPUShares   int `yaml:"cpu_shares"`
+			BlkioConfig struct {
+				Weight int `yaml:"weight"`
+			} `yaml:"blkio_config"`
+		} `yaml:"services"`
+	}
+
+	if err := yaml.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for name, expected := range map[string][2]int{
+		"plc-gateway": {4096, 1000},
+		"reports":     {256, 100},
+		"web":         {1024, 300},
+	} {
+		service := result.Services[name]
+		if service.CPUShares != expected[0] || service.BlkioConfig.Weight != expected[1] {
+			t.Errorf("%s: expected cpu_shares %d and blkio weight %d, got %+v", name, expected[0], expected[1], service)
+		}
+	}
+}
+
+func TestAddPriorityClassesWithoutClass(t *testing.T) {
+	compose := "services:\n  web:\n    image: nginx\n"
+
+	out, err := AddPriorityClasses(compose, "io.portainer.agent.priority-class", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if out != compose {
+		t.Errorf("expected the file content to be unchanged, got:\n%s", out)
+	}
+}
+
+func TestAddPriorityClassesInvalidClass(t *testing.T) {
+	compose := "services:\n  web:\n    image: nginx\n    labels:\n      io.portainer.agent.priority-class: urgent\n"
+
+	if _, err := AddPriorityClasses(compose, "io.portainer.agent.priority-class", ""); err == nil {
+		t.Error("expected an error for an unknown priority class")
+	}
+}
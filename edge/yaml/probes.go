@@ -0,0 +1,97 @@
+package yaml
+
+import (
+	"time"
+
+	"github.com/portainer/agent/probe"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+type composeProbes struct {
+	Probes []struct {
+		Name           string            `yaml:"name"`
+		HTTP           string            `yaml:"http"`
+		TCP            string            `yaml:"tcp"`
+		Modbus         string            `yaml:"modbus"`
+		OPCUA          string            `yaml:"opcua"`
+		ExpectedStatus int               `yaml:"expected_status"`
+		Options        map[string]string `yaml:"options"`
+		Interval       string            `yaml:"interval"`
+		Timeout        string            `yaml:"timeout"`
+	} `yaml:"x-portainer-probes"`
+}
+
+// ComposeProbes returns the synthetic probes defined in the x-portainer-probes extension of a compose file, each
+// probe targets either an http URL, a tcp address, a modbus address or an opcua endpoint. The options are specific to
+// the type of the probe, e.g. the unit and the register read by a modbus probe.
+func ComposeProbes(fileContent string) ([]probe.Definition, error) {
+	var compose composeProbes
+
+	err := yaml.Unmarshal([]byte(fileContent), &compose)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error while unmarshalling the docker compose file content")
+	}
+
+	definitions := make([]probe.Definition, 0, len(compose.Probes))
+	names := make(map[string]bool, len(compose.Probes))
+
+	for _, p := range compose.Probes {
+		definition := probe.Definition{
+			Name:           p.Name,
+			ExpectedStatus: p.ExpectedStatus,
+			Options:        p.Options,
+		}
+
+		for probeType, target := range map[string]string{
+			probe.TypeHTTP:   p.HTTP,
+			probe.TypeTCP:    p.TCP,
+			probe.TypeModbus: p.Modbus,
+			probe.TypeOPCUA:  p.OPCUA,
+		} {
+			if target == "" {
+				continue
+			}
+
+			if definition.Type != "" {
+				return nil, errors.Errorf("the probe %s must define a single target: http, tcp, modbus or opcua", p.Name)
+			}
+
+			definition.Type, definition.Target = probeType, target
+		}
+
+		if definition.Type == "" {
+			return nil, errors.Errorf("the probe %s must define a target: http, tcp, modbus or opcua", p.Name)
+		}
+
+		if definition.Interval, err = parseProbeDuration(p.Interval); err != nil {
+			return nil, errors.WithMessagef(err, "invalid interval of the probe %s", p.Name)
+		}
+
+		if definition.Timeout, err = parseProbeDuration(p.Timeout); err != nil {
+			return nil, errors.WithMessagef(err, "invalid timeout of the probe %s", p.Name)
+		}
+
+		if err := definition.Validate(); err != nil {
+			return nil, err
+		}
+
+		if names[definition.Name] {
+			return nil, errors.Errorf("the probe %s is defined twice", definition.Name)
+		}
+		names[definition.Name] = true
+
+		definitions = append(definitions, definition)
+	}
+
+	return definitions, nil
+}
+
+func parseProbeDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	return time.ParseDuration(value)
+}
@@ -0,0 +1,74 @@
+package yaml
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/portainer/agent/probe"
+)
+
+func TestComposeProbes(t *testing.T) {
+	compose := `version: "3"
+services:
+  web:
+    image: nginx
+x-portainer-probes:
+  - name: homepage
+    http: http://localhost:8080/health
+    expected_status: 204
+    interval: 1m
+  - name: database
+    tcp: localhost:5432
+    timeout: 2s
+  - name: press
+    modbus: 192.168.10.20
+    options:
+      unit: 3
+      register: 100
+  - name: scada
+    opcua: opc.tcp://192.168.10.30:4840/UA/Server
+`
+
+	definitions, err := ComposeProbes(compose)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []probe.Definition{
+		{Name: "homepage", Type: probe.TypeHTTP, Target: "http://localhost:8080/health", ExpectedStatus: 204, Interval: time.Minute, Timeout: probe.DefaultTimeout},
+		{Name: "database", Type: probe.TypeTCP, Target: "localhost:5432", Interval: probe.DefaultInterval, Timeout: 2 * time.Second},
+		{Name: "press", Type: probe.TypeModbus, Target: "192.168.10.20:502", Options: map[string]string{"unit": "3", "register": "100"}, Interval: probe.DefaultInterval, Timeout: probe.DefaultTimeout},
+		{Name: "scada", Type: probe.TypeOPCUA, Target: "opc.tcp://192.168.10.30:4840/UA/Server", Interval: probe.DefaultInterval, Timeout: probe.DefaultTimeout},
+	}
+
+	if len(definitions) != len(expected) {
+		t.Fatalf("expected %d probes, got %+v", len(expected), definitions)
+	}
+
+	for i := range expected {
+		if !reflect.DeepEqual(definitions[i], expected[i]) {
+			t.Errorf("expected %+v, got %+v", expected[i], definitions[i])
+		}
+	}
+}
+
+func TestComposeProbes_Invalid(t *testing.T) {
+	for _, probes := range []string{
+		"  - name: both\n    http: http://localhost\n    tcp: localhost:80\n",
+		"  - name: none\n",
+		"  - http: http://localhost\n",
+		"  - name: ftp\n    http: ftp://localhost\n",
+		"  - name: port\n    tcp: localhost\n",
+		"  - name: fast\n    tcp: localhost:80\n    interval: 1s\n",
+		"  - name: status\n    http: http://localhost\n    expected_status: 42\n",
+		"  - name: plc\n    modbus: 192.168.10.20\n    options:\n      unit: 300\n",
+		"  - name: plc\n    modbus: 192.168.10.20\n    tcp: 192.168.10.20:502\n",
+		"  - name: scada\n    opcua: http://192.168.10.30:4840\n",
+		"  - name: twice\n    tcp: localhost:80\n  - name: twice\n    tcp: localhost:81\n",
+	} {
+		if _, err := ComposeProbes("x-portainer-probes:\n" + probes); err == nil {
+			t.Errorf("expected an error for %q", probes)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package yaml
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// AddResourceLabels adds the labels to the services, networks, volumes, configs and secrets of a compose file.
+// The labels already defined in the compose file are kept and the external resources are left untouched.
+func AddResourceLabels(fileContent string, labels map[string]string) (string, error) {
+	if len(labels) == 0 {
+		return fileContent, nil
+	}
+
+	var document yaml.Node
+	err := yaml.Unmarshal([]byte(fileContent), &document)
+	if err != nil {
+		return "", errors.Wrap(err, "Error while unmarshalling the docker compose file content")
+	}
+
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return fileContent, nil
+	}
+
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, section := range []string{"services", "networks", "volumes", "configs", "secrets"} {
+		resources := mappingValue(document.Content[0], section)
+		if resources == nil || resources.Kind != yaml.MappingNode {
+			continue
+		}
+
+		for i := 1; i < len(resources.Content); i += 2 {
+			resource := resources.Content[i]
+
+			// Resources declared without any option (e.g. "data:") are null
+			if resource.Kind == yaml.ScalarNode && resource.Tag == "!!null" {
+				*resource = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			}
+
+			if resource.Kind != yaml.MappingNode || mappingValue(resource, "external") != nil {
+				continue
+			}
+
+			addLabels(resource, keys, labels)
+		}
+	}
+
+	out, err := yaml.Marshal(&document)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode compose to yaml file")
+	}
+
+	return string(out), nil
+}
+
+func addLabels(resource *yaml.Node, keys []string, labels map[string]string) {
+	node := mappingValue(resource, "labels")
+	if node == nil {
+		node = &yaml.Node{Kind: yaml.MappingNode}
+		appendMappingEntry(resource, "labels", node)
+	}
+
+	defined := map[string]bool{}
+
+	switch node.Kind {
+	case yaml.SequenceNode:
+		for _, entry := range node.Content {
+			key, _, _ := strings.Cut(entry.Value, "=")
+			defined[key] = true
+		}
+	case yaml.MappingNode:
+		for i := 0; i < len(node.Content); i += 2 {
+			defined[node.Content[i].Value] = true
+		}
+	default:
+		return
+	}
+
+	for _, key := range keys {
+		if defined[key] {
+			continue
+		}
+
+		if node.Kind == yaml.MappingNode {
+			appendMappingEntry(node, key, &yaml.Node{Kind: yaml.ScalarNode, Value: labels[key], Style: yaml.DoubleQuotedStyle})
+			continue
+		}
+
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key + "=" + labels[key]})
+	}
+}
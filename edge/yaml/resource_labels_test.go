@@ -0,0 +1,64 @@
+package yaml
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestAddResourceLabels(t *testing.T) {
+	compose := `version: "3"
+services:
+  web:
+    image: nginx
+    labels:
+      - "io.portainer.agent.stack=custom"
+  worker:
+    image: busybox
+volumes:
+  data:
+networks:
+  shared:
+    external: true
+`
+
+	out, err := AddResourceLabels(compose, map[string]string{
+		"io.portainer.agent.stack":    "edge_web",
+		"io.portainer.agent.endpoint": "edge-id",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var result struct {
+		Services map[string]struct {
+			Labels interface{} `yaml:"labels"`
+		} `yaml:"services"`
+		Volumes  map[string]map[string]interface{} `yaml:"volumes"`
+		Networks map[string]map[string]interface{} `yaml:"networks"`
+	}
+
+	err = yaml.Unmarshal([]byte(out), &result)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	webLabels, _ := result.Services["web"].Labels.([]interface{})
+	if len(webLabels) != 2 || webLabels[0] != "io.portainer.agent.stack=custom" || webLabels[1] != "io.portainer.agent.endpoint=edge-id" {
+		t.Errorf("unexpected web labels: %v", result.Services["web"].Labels)
+	}
+
+	workerLabels, _ := result.Services["worker"].Labels.(map[string]interface{})
+	if workerLabels["io.portainer.agent.stack"] != "edge_web" || workerLabels["io.portainer.agent.endpoint"] != "edge-id" {
+		t.Errorf("unexpected worker labels: %v", result.Services["worker"].Labels)
+	}
+
+	if _, ok := result.Volumes["data"]["labels"]; !ok {
+		t.Errorf("expected the data volume to be labeled, got:\n%s", out)
+	}
+
+	if _, ok := result.Networks["shared"]["labels"]; ok || strings.Count(out, "external: true") != 1 {
+		t.Errorf("expected the external network to be left untouched, got:\n%s", out)
+	}
+}
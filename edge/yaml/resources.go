@@ -0,0 +1,246 @@
+package yaml
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-units"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// ResourceRequirements are the resources required by the services of a compose file
+type ResourceRequirements struct {
+	Containers int
+	Volumes    int
+	Memory     int64
+	CPUs       float64
+}
+
+type composeResources struct {
+	Services map[string]struct {
+		MemReservation interface{} `yaml:"mem_reservation"`
+		CPUs           interface{} `yaml:"cpus"`
+		Deploy         struct {
+			Mode      string `yaml:"mode"`
+			Replicas  *int   `yaml:"replicas"`
+			Resources struct {
+				Reservations struct {
+					Memory interface{} `yaml:"memory"`
+					CPUs   interface{} `yaml:"cpus"`
+				} `yaml:"reservations"`
+			} `yaml:"resources"`
+		} `yaml:"deploy"`
+	} `yaml:"services"`
+	Volumes map[string]*struct {
+		External interface{} `yaml:"external"`
+	} `yaml:"volumes"`
+}
+
+// ComposeResourceRequirements returns the number of containers, the number of volumes created and the memory and
+// CPU reservations of the services of a compose file. Global services are counted as a single container.
+func ComposeResourceRequirements(fileContent string) (ResourceRequirements, error) {
+	var compose composeResources
+
+	requirements := ResourceRequirements{}
+
+	err := yaml.Unmarshal([]byte(fileContent), &compose)
+	if err != nil {
+		return requirements, errors.Wrap(err, "Error while unmarshalling the docker compose file content")
+	}
+
+	for name, service := range compose.Services {
+		replicas := 1
+		if service.Deploy.Mode != "global" && service.Deploy.Replicas != nil {
+			replicas = *service.Deploy.Replicas
+		}
+
+		memoryValue := service.Deploy.Resources.Reservations.Memory
+		if memoryValue == nil {
+			memoryValue = service.MemReservation
+		}
+
+		memory, err := parseMemory(memoryValue)
+		if err != nil {
+			return requirements, errors.WithMessagef(err, "invalid memory reservation of the service %s", name)
+		}
+
+		cpusValue := service.Deploy.Resources.Reservations.CPUs
+		if cpusValue == nil {
+			cpusValue = service.CPUs
+		}
+
+		cpus, err := parseCPUs(cpusValue)
+		if err != nil {
+			return requirements, errors.WithMessagef(err, "invalid CPU reservation of the service %s", name)
+		}
+
+		requirements.Containers += replicas
+		requirements.Memory += memory * int64(replicas)
+		requirements.CPUs += cpus * float64(replicas)
+	}
+
+	for _, volume := range compose.Volumes {
+		// External volumes are either a boolean or the name of the existing volume
+		external := volume != nil && volume.External != nil && volume.External != false
+		if !external {
+			requirements.Volumes++
+		}
+	}
+
+	return requirements, nil
+}
+
+func parseMemory(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return int64(v), nil
+	case string:
+		return units.RAMInBytes(v)
+	}
+
+	return 0, fmt.Errorf("unexpected value %v", value)
+}
+
+func parseCPUs(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+
+	return 0, fmt.Errorf("unexpected value %v", value)
+}
+
+// ComposeResourceNames are the names of the resources declared in a compose file
+type ComposeResourceNames struct {
+	Services []string
+	Volumes  []string
+	Networks []string
+	Configs  []string
+	Secrets  []string
+}
+
+// GetComposeResourceNames returns the names of the services, volumes, networks, configs and secrets declared in a
+// compose file
+func GetComposeResourceNames(fileContent string) (ComposeResourceNames, error) {
+	var compose struct {
+		Services map[string]interface{} `yaml:"services"`
+		Volumes  map[string]interface{} `yaml:"volumes"`
+		Networks map[string]interface{} `yaml:"networks"`
+		Configs  map[string]interface{} `yaml:"configs"`
+		Secrets  map[string]interface{} `yaml:"secrets"`
+	}
+
+	err := yaml.Unmarshal([]byte(fileContent), &compose)
+	if err != nil {
+		return ComposeResourceNames{}, errors.Wrap(err, "Error while unmarshalling the docker compose file content")
+	}
+
+	return ComposeResourceNames{
+		Services: mapKeys(compose.Services),
+		Volumes:  mapKeys(compose.Volumes),
+		Networks: mapKeys(compose.Networks),
+		Configs:  mapKeys(compose.Configs),
+		Secrets:  mapKeys(compose.Secrets),
+	}, nil
+}
+
+func mapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// ComposeServiceDefinition is the definition of a service of a compose file, as compared to the running containers
+type ComposeServiceDefinition struct {
+	Name  string
+	Image string
+	// Environment are the variables set by the compose file, the ones whose value is interpolated are left out
+	Environment map[string]string
+	// Replicas is the number of containers of the service, 0 for a global service
+	Replicas int
+}
+
+// GetComposeServiceDefinitions returns the image, the environment and the number of replicas of the services of a
+// compose file, sorted by name
+func GetComposeServiceDefinitions(fileContent string) ([]ComposeServiceDefinition, error) {
+	var compose struct {
+		Services map[string]struct {
+			Image       string      `yaml:"image"`
+			Environment interface{} `yaml:"environment"`
+			Scale       *int        `yaml:"scale"`
+			Deploy      struct {
+				Mode     string `yaml:"mode"`
+				Replicas *int   `yaml:"replicas"`
+			} `yaml:"deploy"`
+		} `yaml:"services"`
+	}
+
+	err := yaml.Unmarshal([]byte(fileContent), &compose)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error while unmarshalling the docker compose file content")
+	}
+
+	definitions := make([]ComposeServiceDefinition, 0, len(compose.Services))
+	for name, service := range compose.Services {
+		definition := ComposeServiceDefinition{
+			Name:        name,
+			Image:       service.Image,
+			Environment: map[string]string{},
+			Replicas:    1,
+		}
+
+		switch {
+		case service.Deploy.Mode == "global":
+			definition.Replicas = 0
+		case service.Deploy.Replicas != nil:
+			definition.Replicas = *service.Deploy.Replicas
+		case service.Scale != nil:
+			definition.Replicas = *service.Scale
+		}
+
+		// The environment is either a list of KEY=value entries or a mapping
+		switch environment := service.Environment.(type) {
+		case []interface{}:
+			for _, entry := range environment {
+				key, value, ok := strings.Cut(fmt.Sprint(entry), "=")
+				if ok {
+					definition.Environment[key] = value
+				}
+			}
+		case map[string]interface{}:
+			for key, value := range environment {
+				if value != nil {
+					definition.Environment[key] = fmt.Sprint(value)
+				}
+			}
+		}
+
+		for key, value := range definition.Environment {
+			if strings.Contains(value, "$") {
+				delete(definition.Environment, key)
+			}
+		}
+
+		definitions = append(definitions, definition)
+	}
+
+	sort.Slice(definitions, func(i, j int) bool { return definitions[i].Name < definitions[j].Name })
+
+	return definitions, nil
+}
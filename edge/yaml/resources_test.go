@@ -0,0 +1,88 @@
+package yaml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestComposeResourceRequirements(t *testing.T) {
+	compose := `version: "3"
+services:
+  web:
+    image: nginx
+    deploy:
+      replicas: 3
+      resources:
+        reservations:
+          memory: 128M
+          cpus: "0.5"
+  worker:
+    image: busybox
+    mem_reservation: 64m
+    cpus: 0.25
+  agent:
+    image: agent
+    deploy:
+      mode: global
+      replicas: 5
+volumes:
+  data:
+  logs:
+    driver: local
+  shared:
+    external: true
+`
+
+	requirements, err := ComposeResourceRequirements(compose)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := ResourceRequirements{
+		Containers: 5,
+		Volumes:    2,
+		Memory:     3*128*1024*1024 + 64*1024*1024,
+		CPUs:       1.75,
+	}
+
+	if requirements != expected {
+		t.Errorf("expected %+v, got %+v", expected, requirements)
+	}
+}
+
+func TestGetComposeServiceDefinitions(t *testing.T) {
+	compose := `services:
+  web:
+    image: nginx
+    environment:
+      - MODE=prod
+      - TOKEN=${TOKEN}
+    deploy:
+      replicas: 2
+  worker:
+    image: worker
+    scale: 3
+    environment:
+      QUEUE: jobs
+      RETRIES: 5
+  agent:
+    image: agent
+    deploy:
+      mode: global
+`
+
+	definitions, err := GetComposeServiceDefinitions(compose)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []ComposeServiceDefinition{
+		{Name: "agent", Image: "agent", Environment: map[string]string{}, Replicas: 0},
+		{Name: "web", Image: "nginx", Environment: map[string]string{"MODE": "prod"}, Replicas: 2},
+		{Name: "worker", Image: "worker", Environment: map[string]string{"QUEUE": "jobs", "RETRIES": "5"}, Replicas: 3},
+	}
+
+	if !reflect.DeepEqual(definitions, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, definitions)
+	}
+}
@@ -0,0 +1,225 @@
+package yaml
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Rules reported by the security linter
+const (
+	RulePrivileged   = "privileged"
+	RuleHostPID      = "host_pid"
+	RuleHostIPC      = "host_ipc"
+	RuleDockerSocket = "docker_socket"
+	RuleCapSysAdmin  = "cap_sys_admin"
+)
+
+// SecurityFinding is a dangerous pattern found in a compose file or a Kubernetes manifest, allowing a container to
+// escape its isolation or to gain privileges on the host
+type SecurityFinding struct {
+	Resource string `json:"resource"`
+	Rule     string `json:"rule"`
+	Message  string `json:"message"`
+}
+
+var dockerSocketPaths = []string{"/var/run/docker.sock", "/run/docker.sock"}
+
+// LintDockerCompose returns the security findings of the services of a compose file
+func LintDockerCompose(fileContent string) ([]SecurityFinding, error) {
+	var compose struct {
+		Services map[string]map[string]interface{} `yaml:"services"`
+	}
+
+	err := yaml.Unmarshal([]byte(fileContent), &compose)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error while unmarshalling the docker compose file content")
+	}
+
+	var findings []SecurityFinding
+	for name, service := range compose.Services {
+		resource := "service " + name
+
+		if isTrue(service["privileged"]) {
+			findings = append(findings, SecurityFinding{resource, RulePrivileged, "the container runs in privileged mode"})
+		}
+
+		if service["pid"] == "host" {
+			findings = append(findings, SecurityFinding{resource, RuleHostPID, "the container shares the PID namespace of the host"})
+		}
+
+		if service["ipc"] == "host" {
+			findings = append(findings, SecurityFinding{resource, RuleHostIPC, "the container shares the IPC namespace of the host"})
+		}
+
+		if hasSysAdminCapability(service["cap_add"]) {
+			findings = append(findings, SecurityFinding{resource, RuleCapSysAdmin, "the container is granted the SYS_ADMIN capability"})
+		}
+
+		volumes, _ := service["volumes"].([]interface{})
+		for _, volume := range volumes {
+			var source string
+			switch v := volume.(type) {
+			case string:
+				source = strings.SplitN(v, ":", 2)[0]
+			case map[string]interface{}:
+				source, _ = v["source"].(string)
+			}
+
+			if isDockerSocket(source) {
+				findings = append(findings, SecurityFinding{resource, RuleDockerSocket, fmt.Sprintf("the Docker socket %s is mounted in the container", source)})
+			}
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Resource < findings[j].Resource
+	})
+
+	return findings, nil
+}
+
+// LintKubernetesManifest returns the security findings of the workloads of a Kubernetes manifest
+func LintKubernetesManifest(fileContent string) ([]SecurityFinding, error) {
+	decoder := yaml.NewDecoder(strings.NewReader(fileContent))
+
+	var findings []SecurityFinding
+	for {
+		var object map[string]interface{}
+
+		err := decoder.Decode(&object)
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, errors.Wrap(err, "Error while unmarshalling the Kubernetes manifest")
+		}
+
+		if object == nil {
+			continue
+		}
+
+		kind, _ := object["kind"].(string)
+		metadata, _ := object["metadata"].(map[string]interface{})
+		name, _ := metadata["name"].(string)
+
+		podSpec := kubernetesPodSpec(kind, object)
+		if podSpec == nil {
+			continue
+		}
+
+		findings = append(findings, lintPodSpec(strings.ToLower(kind)+" "+name, podSpec)...)
+	}
+
+	return findings, nil
+}
+
+func kubernetesPodSpec(kind string, object map[string]interface{}) map[string]interface{} {
+	var path []string
+
+	switch kind {
+	case "Pod":
+		path = []string{"spec"}
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "ReplicationController", "Job":
+		path = []string{"spec", "template", "spec"}
+	case "CronJob":
+		path = []string{"spec", "jobTemplate", "spec", "template", "spec"}
+	default:
+		return nil
+	}
+
+	current := object
+	for _, key := range path {
+		current, _ = current[key].(map[string]interface{})
+		if current == nil {
+			return nil
+		}
+	}
+
+	return current
+}
+
+func lintPodSpec(resource string, podSpec map[string]interface{}) []SecurityFinding {
+	var findings []SecurityFinding
+
+	if isTrue(podSpec["hostPID"]) {
+		findings = append(findings, SecurityFinding{resource, RuleHostPID, "the pod shares the PID namespace of the host"})
+	}
+
+	if isTrue(podSpec["hostIPC"]) {
+		findings = append(findings, SecurityFinding{resource, RuleHostIPC, "the pod shares the IPC namespace of the host"})
+	}
+
+	volumes, _ := podSpec["volumes"].([]interface{})
+	for _, volume := range volumes {
+		v, _ := volume.(map[string]interface{})
+		hostPath, _ := v["hostPath"].(map[string]interface{})
+		path, _ := hostPath["path"].(string)
+
+		if isDockerSocket(path) {
+			findings = append(findings, SecurityFinding{resource, RuleDockerSocket, fmt.Sprintf("the Docker socket %s is mounted in the pod", path)})
+		}
+	}
+
+	for _, key := range []string{"initContainers", "containers", "ephemeralContainers"} {
+		containers, _ := podSpec[key].([]interface{})
+		for _, container := range containers {
+			c, _ := container.(map[string]interface{})
+			containerName, _ := c["name"].(string)
+			securityContext, _ := c["securityContext"].(map[string]interface{})
+
+			if isTrue(securityContext["privileged"]) {
+				findings = append(findings, SecurityFinding{resource, RulePrivileged, fmt.Sprintf("the container %s runs in privileged mode", containerName)})
+			}
+
+			capabilities, _ := securityContext["capabilities"].(map[string]interface{})
+			if hasSysAdminCapability(capabilities["add"]) {
+				findings = append(findings, SecurityFinding{resource, RuleCapSysAdmin, fmt.Sprintf("the container %s is granted the SYS_ADMIN capability", containerName)})
+			}
+		}
+	}
+
+	return findings
+}
+
+func isTrue(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return strings.EqualFold(v, "true")
+	}
+
+	return false
+}
+
+func hasSysAdminCapability(value interface{}) bool {
+	capabilities, _ := value.([]interface{})
+	for _, capability := range capabilities {
+		name, _ := capability.(string)
+		name = strings.TrimPrefix(strings.ToUpper(name), "CAP_")
+
+		if name == "SYS_ADMIN" || name == "ALL" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isDockerSocket(path string) bool {
+	path = strings.TrimSuffix(path, "/")
+
+	for _, socketPath := range dockerSocketPaths {
+		if path == socketPath {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,109 @@
+package yaml
+
+import (
+	"testing"
+)
+
+func TestLintDockerCompose(t *testing.T) {
+	compose := `version: "3"
+services:
+  web:
+    image: nginx
+    volumes:
+      - ./html:/usr/share/nginx/html
+  monitor:
+    image: monitor
+    privileged: true
+    pid: host
+    cap_add:
+      - CAP_SYS_ADMIN
+    volumes:
+      - /var/run/docker.sock:/var/run/docker.sock:ro
+  debug:
+    image: busybox
+    ipc: host
+    volumes:
+      - type: bind
+        source: /run/docker.sock
+        target: /var/run/docker.sock
+`
+
+	findings, err := LintDockerCompose(compose)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []SecurityFinding{
+		{Resource: "service debug", Rule: RuleHostIPC},
+		{Resource: "service debug", Rule: RuleDockerSocket},
+		{Resource: "service monitor", Rule: RulePrivileged},
+		{Resource: "service monitor", Rule: RuleHostPID},
+		{Resource: "service monitor", Rule: RuleCapSysAdmin},
+		{Resource: "service monitor", Rule: RuleDockerSocket},
+	}
+
+	if len(findings) != len(expected) {
+		t.Fatalf("expected %d findings, got %+v", len(expected), findings)
+	}
+
+	for i, finding := range findings {
+		if finding.Resource != expected[i].Resource || finding.Rule != expected[i].Rule {
+			t.Errorf("expected finding %s/%s, got %s/%s", expected[i].Resource, expected[i].Rule, finding.Resource, finding.Rule)
+		}
+	}
+}
+
+func TestLintKubernetesManifest(t *testing.T) {
+	manifest := `apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  ports:
+    - port: 80
+---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: node-agent
+spec:
+  template:
+    spec:
+      hostPID: true
+      containers:
+        - name: agent
+          image: agent
+          securityContext:
+            privileged: true
+            capabilities:
+              add: ["SYS_ADMIN"]
+      volumes:
+        - name: docker
+          hostPath:
+            path: /var/run/docker.sock
+`
+
+	findings, err := LintKubernetesManifest(manifest)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	rules := map[string]bool{}
+	for _, finding := range findings {
+		if finding.Resource != "daemonset node-agent" {
+			t.Errorf("unexpected resource %q", finding.Resource)
+		}
+
+		rules[finding.Rule] = true
+	}
+
+	for _, rule := range []string{RuleHostPID, RulePrivileged, RuleCapSysAdmin, RuleDockerSocket} {
+		if !rules[rule] {
+			t.Errorf("expected a %s finding, got %+v", rule, findings)
+		}
+	}
+
+	if len(findings) != 4 {
+		t.Errorf("expected 4 findings, got %d", len(findings))
+	}
+}
@@ -0,0 +1,133 @@
+package eventbus
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Types of the messages published on the event bus, the subject of a message is the configured prefix followed by
+// its type, e.g. portainer.agent.snapshot
+const (
+	TypeSnapshot    = "snapshot"
+	TypeDockerEvent = "docker_event"
+	TypeAlert       = "alert"
+	TypeAudit       = "audit"
+)
+
+// queueSize is the number of messages waiting to be published from which the new messages are dropped
+const queueSize = 256
+
+var defaultPublisher *Publisher
+
+// Transport sends the messages to an event bus
+type Transport interface {
+	Publish(subject string, payload []byte) error
+	Close() error
+}
+
+// Message is the envelope of the data published on the event bus
+type Message struct {
+	Type    string      `json:"type"`
+	AgentID string      `json:"agentId"`
+	Time    time.Time   `json:"time"`
+	Data    interface{} `json:"data"`
+}
+
+// Publisher publishes the messages of the agent in the background, so that an unavailable event bus never slows
+// down the agent. The messages are dropped when the event bus cannot keep up.
+type Publisher struct {
+	transport     Transport
+	subjectPrefix string
+	agentID       string
+	queue         chan Message
+	mu            sync.Mutex
+	lastAlerts    map[string]struct{}
+}
+
+// NewPublisher returns a pointer to a Publisher sending the messages with transport
+func NewPublisher(transport Transport, subjectPrefix, agentID string) *Publisher {
+	return &Publisher{
+		transport:     transport,
+		subjectPrefix: subjectPrefix,
+		agentID:       agentID,
+		queue:         make(chan Message, queueSize),
+		lastAlerts:    map[string]struct{}{},
+	}
+}
+
+// Publish queues a message of the given type
+func (publisher *Publisher) Publish(messageType string, data interface{}) {
+	message := Message{
+		Type:    messageType,
+		AgentID: publisher.agentID,
+		Time:    time.Now().UTC(),
+		Data:    data,
+	}
+
+	select {
+	case publisher.queue <- message:
+	default:
+		log.Warn().Str("type", messageType).Msg("the event bus queue is full, dropping the message")
+	}
+}
+
+// PublishAlerts publishes the alerts that were not part of the previous call
+func (publisher *Publisher) PublishAlerts(alerts []string) {
+	publisher.mu.Lock()
+
+	current := make(map[string]struct{}, len(alerts))
+	var raised []string
+
+	for _, alert := range alerts {
+		current[alert] = struct{}{}
+
+		if _, ok := publisher.lastAlerts[alert]; !ok {
+			raised = append(raised, alert)
+		}
+	}
+
+	publisher.lastAlerts = current
+	publisher.mu.Unlock()
+
+	for _, alert := range raised {
+		publisher.Publish(TypeAlert, alert)
+	}
+}
+
+func (publisher *Publisher) run() {
+	for message := range publisher.queue {
+		payload, err := json.Marshal(message)
+		if err != nil {
+			log.Warn().Err(err).Str("type", message.Type).Msg("unable to encode the event bus message")
+
+			continue
+		}
+
+		err = publisher.transport.Publish(publisher.subjectPrefix+"."+message.Type, payload)
+		if err != nil {
+			log.Debug().Err(err).Str("type", message.Type).Msg("unable to publish the message on the event bus")
+		}
+	}
+}
+
+// Enable makes publisher the publisher used by the subsystems of the agent and starts publishing its messages
+func Enable(publisher *Publisher) {
+	defaultPublisher = publisher
+
+	go publisher.run()
+}
+
+// Enabled returns true when a publisher is enabled
+func Enabled() bool {
+	return defaultPublisher != nil
+}
+
+// Publish queues a message on the enabled publisher, if any
+func Publish(messageType string, data interface{}) {
+	if defaultPublisher != nil {
+		defaultPublisher.Publish(messageType, data)
+	}
+}
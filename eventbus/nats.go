@@ -0,0 +1,250 @@
+package eventbus
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent"
+	agentnet "github.com/portainer/agent/net"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	natsDefaultPort = "4222"
+	natsDialTimeout = 10 * time.Second
+)
+
+// natsTransport publishes the messages on a NATS server using the client protocol. The connection is opened on the
+// first message and opened again after a failure.
+type natsTransport struct {
+	addr      string
+	tlsConfig *tls.Config
+	connect   natsConnectOptions
+
+	mu     sync.Mutex
+	conn   net.Conn
+	writer *bufio.Writer
+}
+
+type natsConnectOptions struct {
+	Verbose  bool   `json:"verbose"`
+	Pedantic bool   `json:"pedantic"`
+	Name     string `json:"name"`
+	Lang     string `json:"lang"`
+	Version  string `json:"version"`
+	User     string `json:"user,omitempty"`
+	Pass     string `json:"pass,omitempty"`
+	Token    string `json:"auth_token,omitempty"`
+}
+
+type natsServerInfo struct {
+	TLSRequired bool `json:"tls_required"`
+}
+
+// NewTransport returns the Transport of the event bus at rawURL. The NATS servers are supported, with the
+// nats://[user:password@]host[:port] or tls:// URLs, a token can be used instead of the user and password.
+func NewTransport(rawURL string) (Transport, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "nats" && u.Scheme != "tls" {
+		return nil, fmt.Errorf("unsupported event bus scheme: %q", u.Scheme)
+	}
+
+	if u.Hostname() == "" {
+		return nil, errors.New("the event bus URL must contain a host")
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = natsDefaultPort
+	}
+
+	transport := &natsTransport{
+		addr: net.JoinHostPort(u.Hostname(), port),
+		connect: natsConnectOptions{
+			Name:    "portainer-agent",
+			Lang:    "go",
+			Version: agent.Version,
+		},
+	}
+
+	if u.Scheme == "tls" {
+		transport.tlsConfig = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+	}
+
+	if u.User != nil {
+		password, ok := u.User.Password()
+		if ok {
+			transport.connect.User, transport.connect.Pass = u.User.Username(), password
+		} else {
+			transport.connect.Token = u.User.Username()
+		}
+	}
+
+	return transport, nil
+}
+
+func (transport *natsTransport) Publish(subject string, payload []byte) error {
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+
+	if transport.conn == nil {
+		if err := transport.open(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(transport.writer, "PUB %s %d\r\n", subject, len(payload))
+	transport.writer.Write(payload)
+	transport.writer.WriteString("\r\n")
+
+	if err := transport.writer.Flush(); err != nil {
+		transport.closeConn()
+
+		return err
+	}
+
+	return nil
+}
+
+func (transport *natsTransport) Close() error {
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+
+	transport.closeConn()
+
+	return nil
+}
+
+// open connects to the server and waits for the acknowledgment of the connection, the lock must be held
+func (transport *natsTransport) open() error {
+	conn, err := net.DialTimeout("tcp", transport.addr, natsDialTimeout)
+	if err != nil {
+		return err
+	}
+
+	conn = agentnet.MeterConn(agentnet.BandwidthEventBus, conn)
+	conn.SetDeadline(time.Now().Add(natsDialTimeout))
+
+	reader := bufio.NewReader(conn)
+
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+
+		return err
+	}
+
+	var info natsServerInfo
+	if !strings.HasPrefix(line, "INFO ") || json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info) != nil {
+		conn.Close()
+
+		return fmt.Errorf("unexpected greeting from the NATS server: %q", strings.TrimSpace(line))
+	}
+
+	if transport.tlsConfig != nil {
+		tlsConn := tls.Client(conn, transport.tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+
+			return err
+		}
+
+		conn = tlsConn
+		reader = bufio.NewReader(conn)
+	} else if info.TLSRequired {
+		conn.Close()
+
+		return errors.New("the NATS server requires TLS, use a tls:// URL")
+	}
+
+	connect, err := json.Marshal(transport.connect)
+	if err != nil {
+		conn.Close()
+
+		return err
+	}
+
+	writer := bufio.NewWriter(conn)
+	fmt.Fprintf(writer, "CONNECT %s\r\nPING\r\n", connect)
+
+	if err := writer.Flush(); err != nil {
+		conn.Close()
+
+		return err
+	}
+
+	// The server answers the PING once the connection is accepted, or reports an error (e.g. authorization)
+	line, err = reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+
+		return err
+	}
+
+	if !strings.HasPrefix(line, "PONG") {
+		conn.Close()
+
+		return fmt.Errorf("connection refused by the NATS server: %s", strings.TrimSpace(line))
+	}
+
+	conn.SetDeadline(time.Time{})
+
+	transport.conn = conn
+	transport.writer = writer
+
+	go transport.readLoop(conn, reader)
+
+	return nil
+}
+
+// readLoop answers the keepalive requests of the server and closes the connection on failure
+func (transport *natsTransport) readLoop(conn net.Conn, reader *bufio.Reader) {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			break
+		}
+
+		switch {
+		case strings.HasPrefix(line, "PING"):
+			transport.mu.Lock()
+			if transport.conn == conn {
+				transport.writer.WriteString("PONG\r\n")
+				transport.writer.Flush()
+			}
+			transport.mu.Unlock()
+		case strings.HasPrefix(line, "-ERR"):
+			log.Warn().Str("error", strings.TrimSpace(strings.TrimPrefix(line, "-ERR"))).Msg("error reported by the NATS server")
+		}
+	}
+
+	transport.mu.Lock()
+	if transport.conn == conn {
+		transport.closeConn()
+	}
+	transport.mu.Unlock()
+}
+
+// closeConn closes the current connection, if any, the lock must be held
+func (transport *natsTransport) closeConn() {
+	if transport.conn == nil {
+		return
+	}
+
+	transport.conn.Close()
+	transport.conn = nil
+	transport.writer = nil
+}
@@ -0,0 +1,85 @@
+package eventbus
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestNATSTransport_Publish(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	received := make(chan string, 1)
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		conn.Write([]byte("INFO {\"server_id\":\"test\"}\r\n"))
+
+		var lines []string
+		for len(lines) < 4 {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			lines = append(lines, strings.TrimSpace(line))
+			if strings.HasPrefix(line, "PING") {
+				conn.Write([]byte("PONG\r\n"))
+			}
+		}
+
+		received <- strings.Join(lines, "\n")
+	}()
+
+	transport, err := NewTransport("nats://token@" + listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transport.Close()
+
+	if err := transport.Publish("portainer.agent.alert", []byte(`"disk full"`)); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(<-received, "\n")
+	if !strings.HasPrefix(lines[0], "CONNECT ") || !strings.Contains(lines[0], `"auth_token":"token"`) {
+		t.Fatalf("unexpected CONNECT: %s", lines[0])
+	}
+
+	if lines[2] != "PUB portainer.agent.alert 11" || lines[3] != `"disk full"` {
+		t.Fatalf("unexpected PUB: %v", lines[2:])
+	}
+}
+
+func TestNewTransport_UnsupportedScheme(t *testing.T) {
+	if _, err := NewTransport("kafka://localhost:9092"); err == nil {
+		t.Fatal("expected an error for an unsupported scheme")
+	}
+}
+
+func TestPublisher_PublishAlerts(t *testing.T) {
+	publisher := NewPublisher(nil, "portainer.agent", "agent")
+
+	publisher.PublishAlerts([]string{"a", "b"})
+	publisher.PublishAlerts([]string{"b", "c"})
+
+	var alerts []string
+	for len(publisher.queue) > 0 {
+		alerts = append(alerts, (<-publisher.queue).Data.(string))
+	}
+
+	if strings.Join(alerts, ",") != "a,b,c" {
+		t.Fatalf("expected the alerts a, b and c to be published once, got %v", alerts)
+	}
+}
@@ -0,0 +1,86 @@
+package eventbus
+
+import (
+	"context"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/kubernetes"
+	"github.com/portainer/agent/notify"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/rs/zerolog/log"
+)
+
+const dockerEventsRetryInterval = 10 * time.Second
+
+// PublishSnapshots publishes a snapshot of the environment and the new alerts of the agent at each interval,
+// until ctx is done
+func PublishSnapshots(ctx context.Context, containerPlatform agent.ContainerPlatform, interval time.Duration) {
+	if defaultPublisher == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		publishSnapshot(ctx, containerPlatform)
+
+		defaultPublisher.PublishAlerts(notify.CurrentAlerts(ctx))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func publishSnapshot(ctx context.Context, containerPlatform agent.ContainerPlatform) {
+	var snapshot interface{}
+	var err error
+
+	switch containerPlatform {
+	case agent.PlatformDocker, agent.PlatformPodman:
+		snapshot, err = docker.CreateSnapshot(ctx)
+	case agent.PlatformKubernetes:
+		snapshot, err = kubernetes.CreateSnapshot()
+	default:
+		return
+	}
+
+	if err != nil {
+		log.Warn().Err(err).Msg("unable to create the snapshot published on the event bus")
+
+		return
+	}
+
+	Publish(TypeSnapshot, snapshot)
+}
+
+// PublishDockerEvents publishes the events of the Docker engine until ctx is done, the stream is opened again
+// when it fails
+func PublishDockerEvents(ctx context.Context) {
+	if defaultPublisher == nil {
+		return
+	}
+
+	for {
+		err := docker.WatchEvents(ctx, func(message events.Message) {
+			Publish(TypeDockerEvent, message)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Debug().Err(err).Msg("the Docker events stream was interrupted")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(dockerEventsRetryInterval):
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Package faults injects faults in the agent to exercise its resilience logic, e.g. the retries of the Docker
+// requests, the backoff of the Edge tunnel and the journaling of the operations, during the acceptance testing on a
+// device. The faults are only injected by the agents built with the chaos build tag, the functions of the package are
+// no-ops in the other builds.
+//
+// The faults active when the agent starts are read from the AGENT_FAULTS environment variable, a comma separated list
+// of kind[:duration] items, e.g. docker_hang:2m,clock_skew=-10m. The skew of the clock is set after the = sign of
+// the clock_skew item. A fault without duration stays active until it is cleared.
+package faults
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// EnvKey is the environment variable listing the faults active when the agent starts
+const EnvKey = "AGENT_FAULTS"
+
+// Kind is a kind of fault
+type Kind string
+
+const (
+	// DockerHang makes the Docker daemon stop answering, the requests hang until their timeout
+	DockerHang Kind = "docker_hang"
+	// TunnelDrop closes the reverse tunnel and fails its creation
+	TunnelDrop Kind = "tunnel_drop"
+	// DiskFull fails the writes of the agent data with ENOSPC
+	DiskFull Kind = "disk_full"
+	// ClockSkew shifts the clock used to sign the requests sent to the Portainer server
+	ClockSkew Kind = "clock_skew"
+)
+
+// Kinds lists the kinds of fault
+var Kinds = []Kind{DockerHang, TunnelDrop, DiskFull, ClockSkew}
+
+var (
+	// ErrInjected is matched by the errors returned by the injected faults
+	ErrInjected = errors.New("injected fault")
+	// ErrDisabled is returned when the agent is not built with the chaos build tag
+	ErrDisabled = errors.New("the agent is not built with the fault injection")
+)
+
+// Fault is an injected fault
+type Fault struct {
+	Kind Kind `json:"Kind"`
+	// Skew is the shift of the clock of a ClockSkew fault
+	Skew time.Duration `json:"Skew,omitempty"`
+	// Until is the time the fault is cleared at, zero when it stays active until it is cleared
+	Until time.Time `json:"Until"`
+}
+
+// Error is the error of an injected fault, a DiskFull error also matches syscall.ENOSPC
+type Error struct {
+	Kind Kind
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", ErrInjected, e.Kind)
+}
+
+// Is matches ErrInjected and the errno of the simulated fault
+func (e *Error) Is(target error) bool {
+	return target == ErrInjected || (e.Kind == DiskFull && target == syscall.ENOSPC)
+}
+
+// ValidKind returns true when kind is a known kind of fault
+func ValidKind(kind Kind) bool {
+	for _, k := range Kinds {
+		if k == kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Parse parses a comma separated list of kind[:duration] items, the skew of a clock_skew item is set after a = sign
+func Parse(spec string, now time.Time) ([]Fault, error) {
+	var faults []Fault
+
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		name, duration, _ := strings.Cut(item, ":")
+		name, skew, hasSkew := strings.Cut(name, "=")
+
+		fault := Fault{Kind: Kind(name)}
+		if !ValidKind(fault.Kind) {
+			return nil, fmt.Errorf("unknown fault %q", name)
+		}
+
+		if hasSkew != (fault.Kind == ClockSkew) {
+			return nil, fmt.Errorf("invalid fault %q, only the clock_skew fault has a skew", item)
+		}
+
+		if hasSkew {
+			d, err := time.ParseDuration(skew)
+			if err != nil {
+				return nil, fmt.Errorf("invalid skew of the fault %q: %w", item, err)
+			}
+
+			fault.Skew = d
+		}
+
+		if duration != "" {
+			d, err := time.ParseDuration(duration)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid duration of the fault %q", item)
+			}
+
+			fault.Until = now.Add(d)
+		}
+
+		faults = append(faults, fault)
+	}
+
+	return faults, nil
+}
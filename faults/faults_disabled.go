@@ -0,0 +1,53 @@
+//go:build !chaos
+// +build !chaos
+
+package faults
+
+import (
+	"context"
+	"time"
+)
+
+// Enabled is true when the agent is built with the chaos build tag
+const Enabled = false
+
+// Inject returns ErrDisabled
+func Inject(fault Fault) error {
+	return ErrDisabled
+}
+
+// Clear is a no-op without the chaos build tag
+func Clear(kind Kind) {}
+
+// ClearAll is a no-op without the chaos build tag
+func ClearAll() {}
+
+// List returns no fault without the chaos build tag
+func List() []Fault {
+	return nil
+}
+
+// Active returns false without the chaos build tag
+func Active(kind Kind) bool {
+	return false
+}
+
+// Changed returns a nil channel without the chaos build tag, it never receives
+func Changed() <-chan struct{} {
+	return nil
+}
+
+// Hang returns immediately without the chaos build tag
+func Hang(ctx context.Context, kind Kind) error {
+	return nil
+}
+
+// Fail returns nil without the chaos build tag
+func Fail(kind Kind) error {
+	return nil
+}
+
+// Now returns the current time
+func Now() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,206 @@
+//go:build chaos
+// +build chaos
+
+package faults
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Enabled is true when the agent is built with the chaos build tag
+const Enabled = true
+
+var state = struct {
+	mu      sync.Mutex
+	active  map[Kind]Fault
+	changed chan struct{}
+}{
+	active:  make(map[Kind]Fault),
+	changed: make(chan struct{}),
+}
+
+func init() {
+	log.Warn().Msg("the agent is built with the fault injection, it must not be used in production")
+
+	spec := os.Getenv(EnvKey)
+	if spec == "" {
+		return
+	}
+
+	faults, err := Parse(spec, time.Now())
+	if err != nil {
+		log.Error().Err(err).Str("env", EnvKey).Msg("unable to parse the faults to inject")
+
+		return
+	}
+
+	for _, fault := range faults {
+		Inject(fault)
+	}
+}
+
+// Inject activates a fault, replacing the active fault of the same kind
+func Inject(fault Fault) error {
+	if !ValidKind(fault.Kind) {
+		return fmt.Errorf("unknown fault %q", fault.Kind)
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	state.active[fault.Kind] = fault
+	notify()
+
+	log.Warn().
+		Str("fault", string(fault.Kind)).
+		Str("skew", fault.Skew.String()).
+		Time("until", fault.Until).
+		Msg("fault injected")
+
+	return nil
+}
+
+// Clear clears the fault of kind
+func Clear(kind Kind) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if _, ok := state.active[kind]; ok {
+		delete(state.active, kind)
+		notify()
+
+		log.Warn().Str("fault", string(kind)).Msg("fault cleared")
+	}
+}
+
+// ClearAll clears the active faults
+func ClearAll() {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if len(state.active) > 0 {
+		state.active = make(map[Kind]Fault)
+		notify()
+
+		log.Warn().Msg("faults cleared")
+	}
+}
+
+// List returns the active faults sorted by kind
+func List() []Fault {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	now := time.Now()
+
+	faults := make([]Fault, 0, len(state.active))
+	for _, fault := range state.active {
+		if isActive(fault, now) {
+			faults = append(faults, fault)
+		}
+	}
+
+	sort.Slice(faults, func(i, j int) bool { return faults[i].Kind < faults[j].Kind })
+
+	return faults
+}
+
+// Active returns true when the fault of kind is active
+func Active(kind Kind) bool {
+	_, ok := get(kind)
+
+	return ok
+}
+
+// Changed returns a channel closed at the next injection or clearing of a fault
+func Changed() <-chan struct{} {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	return state.changed
+}
+
+// Hang blocks while the fault of kind is active, it returns the error of ctx when it is done first
+func Hang(ctx context.Context, kind Kind) error {
+	for {
+		state.mu.Lock()
+		fault, ok := state.active[kind]
+		changed := state.changed
+		state.mu.Unlock()
+
+		if !ok || !isActive(fault, time.Now()) {
+			return nil
+		}
+
+		var expired <-chan time.Time
+		var timer *time.Timer
+		if !fault.Until.IsZero() {
+			timer = time.NewTimer(time.Until(fault.Until))
+			expired = timer.C
+		}
+
+		var err error
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-changed:
+		case <-expired:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Fail returns the error of the fault of kind when it is active
+func Fail(kind Kind) error {
+	if !Active(kind) {
+		return nil
+	}
+
+	return &Error{Kind: kind}
+}
+
+// Now returns the current time shifted by the skew of the active ClockSkew fault
+func Now() time.Time {
+	fault, ok := get(ClockSkew)
+	if !ok {
+		return time.Now()
+	}
+
+	return time.Now().Add(fault.Skew)
+}
+
+func get(kind Kind) (Fault, bool) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	fault, ok := state.active[kind]
+	if !ok || !isActive(fault, time.Now()) {
+		return Fault{}, false
+	}
+
+	return fault, true
+}
+
+func isActive(fault Fault, now time.Time) bool {
+	return fault.Until.IsZero() || now.Before(fault.Until)
+}
+
+// notify wakes up the goroutines waiting for a change, state.mu must be held
+func notify() {
+	close(state.changed)
+	state.changed = make(chan struct{})
+}
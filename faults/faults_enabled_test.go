@@ -0,0 +1,102 @@
+//go:build chaos
+// +build chaos
+
+package faults
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestHang(t *testing.T) {
+	t.Cleanup(ClearAll)
+
+	if err := Hang(context.Background(), DockerHang); err != nil {
+		t.Fatalf("expected no hang without fault, got %s", err)
+	}
+
+	Inject(Fault{Kind: DockerHang})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := Hang(ctx, DockerHang); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the hang to last until the timeout, got %v", err)
+	}
+
+	done := make(chan error)
+	go func() { done <- Hang(context.Background(), DockerHang) }()
+
+	Clear(DockerHang)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the hang to stop when the fault is cleared")
+	}
+}
+
+func TestHangExpires(t *testing.T) {
+	t.Cleanup(ClearAll)
+
+	Inject(Fault{Kind: DockerHang, Until: time.Now().Add(20 * time.Millisecond)})
+
+	if err := Hang(context.Background(), DockerHang); err != nil {
+		t.Fatal(err)
+	}
+
+	if Active(DockerHang) {
+		t.Fatal("expected the fault to expire")
+	}
+}
+
+func TestFail(t *testing.T) {
+	t.Cleanup(ClearAll)
+
+	if err := Fail(DiskFull); err != nil {
+		t.Fatalf("expected no error without fault, got %s", err)
+	}
+
+	Inject(Fault{Kind: DiskFull})
+
+	if err := Fail(DiskFull); !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("expected ENOSPC, got %v", err)
+	}
+
+	if len(List()) != 1 {
+		t.Fatalf("expected 1 active fault, got %+v", List())
+	}
+}
+
+func TestNow(t *testing.T) {
+	t.Cleanup(ClearAll)
+
+	Inject(Fault{Kind: ClockSkew, Skew: -time.Hour})
+
+	if skew := time.Since(Now()); skew < 59*time.Minute || skew > 61*time.Minute {
+		t.Fatalf("expected the clock to be shifted by an hour, got %s", skew)
+	}
+}
+
+func TestChanged(t *testing.T) {
+	t.Cleanup(ClearAll)
+
+	changed := Changed()
+	Inject(Fault{Kind: TunnelDrop})
+
+	select {
+	case <-changed:
+	default:
+		t.Fatal("expected the channel to be closed when a fault is injected")
+	}
+
+	if err := Inject(Fault{Kind: "oom"}); err == nil {
+		t.Fatal("expected an error for an unknown fault")
+	}
+}
@@ -0,0 +1,52 @@
+package faults
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	faults, err := Parse("docker_hang:2m, tunnel_drop,clock_skew=-10m:1h", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(faults) != 3 {
+		t.Fatalf("expected 3 faults, got %+v", faults)
+	}
+
+	if faults[0].Kind != DockerHang || !faults[0].Until.Equal(now.Add(2*time.Minute)) {
+		t.Fatalf("unexpected Docker fault: %+v", faults[0])
+	}
+
+	if faults[1].Kind != TunnelDrop || !faults[1].Until.IsZero() {
+		t.Fatalf("expected the tunnel fault to stay active until it is cleared, got %+v", faults[1])
+	}
+
+	if faults[2].Kind != ClockSkew || faults[2].Skew != -10*time.Minute || !faults[2].Until.Equal(now.Add(time.Hour)) {
+		t.Fatalf("unexpected clock fault: %+v", faults[2])
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, spec := range []string{"oom", "docker_hang:soon", "docker_hang:-1m", "disk_full=1m", "clock_skew", "clock_skew=later"} {
+		if _, err := Parse(spec, time.Now()); err == nil {
+			t.Fatalf("expected an error for %q", spec)
+		}
+	}
+}
+
+func TestError(t *testing.T) {
+	err := error(&Error{Kind: DiskFull})
+	if !errors.Is(err, ErrInjected) || !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("expected the disk fault to match ErrInjected and ENOSPC, got %v", err)
+	}
+
+	if errors.Is(&Error{Kind: TunnelDrop}, syscall.ENOSPC) {
+		t.Fatal("expected only the disk fault to match ENOSPC")
+	}
+}
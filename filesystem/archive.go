@@ -0,0 +1,262 @@
+package filesystem
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/portainer/agent/constants"
+)
+
+// ErrArchiveTooLarge is returned when the content of an archive exceeds the maximum size
+var ErrArchiveTooLarge = errors.New("the archive exceeds the maximum size")
+
+// ArchiveDirectory writes the content of a directory as a gzip compressed tar archive to w.
+// Paths inside the archive are relative to the directory. Files that are not regular files,
+// directories or symbolic links are skipped. onProgress, when not nil, is called after each file
+// with the number of bytes archived and the total size of the directory.
+func ArchiveDirectory(ctx context.Context, directoryPath string, w io.Writer, onProgress func(archived, total int64)) error {
+	total, err := DirectorySize(directoryPath)
+	if err != nil {
+		return err
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	var archived int64
+	err = filepath.Walk(directoryPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		relPath, err := filepath.Rel(directoryPath, path)
+		if err != nil || relPath == "." {
+			return err
+		}
+
+		mode := info.Mode()
+		if !mode.IsRegular() && !mode.IsDir() && mode&os.ModeSymlink == 0 {
+			return nil
+		}
+
+		link := ""
+		if mode&os.ModeSymlink != 0 {
+			link, err = os.Readlink(path)
+			if err != nil {
+				return err
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relPath)
+		if mode.IsDir() {
+			header.Name += "/"
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if !mode.IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		n, err := io.Copy(tw, f)
+		if err != nil {
+			return err
+		}
+
+		archived += n
+		if onProgress != nil {
+			onProgress(archived, total)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return gw.Close()
+}
+
+// DirectorySize returns the total size of the regular files of a directory
+func DirectorySize(directoryPath string) (int64, error) {
+	var total int64
+	err := filepath.Walk(directoryPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.Mode().IsRegular() {
+			total += info.Size()
+		}
+
+		return nil
+	})
+
+	return total, err
+}
+
+// ExtractArchive extracts a gzip compressed tar archive, as written by ArchiveDirectory, inside a directory and
+// returns the paths of the extracted files relative to the directory. The entries escaping the directory, either
+// through their path or through a symbolic link of the directory, are refused. The symbolic links and the files that
+// are not regular files or directories are skipped.
+func ExtractArchive(ctx context.Context, r io.Reader, directoryPath string) ([]string, error) {
+	return ExtractArchiveWithLimit(ctx, r, directoryPath, 0)
+}
+
+// ExtractArchiveWithLimit extracts an archive like ExtractArchive, ErrArchiveTooLarge is returned once the extracted
+// files exceed maxSize bytes. The size is not limited when maxSize is 0.
+func ExtractArchiveWithLimit(ctx context.Context, r io.Reader, directoryPath string, maxSize int64) ([]string, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+
+	extracted := []string{}
+
+	var size int64
+
+	tr := tar.NewReader(gr)
+	for {
+		if ctx.Err() != nil {
+			return extracted, ctx.Err()
+		}
+
+		header, err := tr.Next()
+		if err == io.EOF {
+			return extracted, nil
+		} else if err != nil {
+			return extracted, err
+		}
+
+		relPath := filepath.Clean(filepath.FromSlash(header.Name))
+		if filepath.IsAbs(relPath) || relPath == "." || containsDotDot(relPath) {
+			return extracted, fmt.Errorf("invalid path in archive: %s", header.Name)
+		}
+
+		err = checkNoSymlink(directoryPath, filepath.Dir(relPath))
+		if err != nil {
+			return extracted, err
+		}
+
+		path := filepath.Join(directoryPath, relPath)
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(path, 0755)
+		case tar.TypeReg:
+			size += header.Size
+			if maxSize > 0 && size > maxSize {
+				return extracted, ErrArchiveTooLarge
+			}
+
+			err = extractFile(tr, path, os.FileMode(header.Mode).Perm())
+			if err == nil {
+				extracted = append(extracted, filepath.ToSlash(relPath))
+			}
+		}
+
+		if err != nil {
+			return extracted, err
+		}
+	}
+}
+
+func extractFile(r io.Reader, path string, mode os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	// The existing file is removed so that a symbolic link is replaced instead of being followed
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, r)
+
+	return err
+}
+
+// BuildDirectoryPathInsideVolume returns the path on the host of a directory of a volume, the paths escaping the
+// volume through a '..' element or through a symbolic link of the volume are refused
+func BuildDirectoryPathInsideVolume(volumeID, directoryPath string) (string, error) {
+	if !isValidPath(volumeID) || strings.ContainsAny(volumeID, "/\\") {
+		return "", errors.New("Invalid volume identifier")
+	}
+
+	relPath := filepath.Clean(filepath.FromSlash(strings.TrimLeft(directoryPath, "/\\")))
+	if containsDotDot(relPath) {
+		return "", errors.New("Invalid path. Ensure that the path do not contain '..' elements")
+	}
+
+	volumePath := path.Join(constants.SystemVolumePath, volumeID, "_data")
+
+	err := checkNoSymlink(volumePath, relPath)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(volumePath, relPath), nil
+}
+
+// checkNoSymlink returns an error when one of the existing components of relPath inside the directory is a
+// symbolic link
+func checkNoSymlink(directoryPath, relPath string) error {
+	if relPath == "." {
+		return nil
+	}
+
+	path := directoryPath
+	for _, component := range strings.Split(relPath, string(filepath.Separator)) {
+		path = filepath.Join(path, component)
+
+		info, err := os.Lstat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("invalid path in archive: %s is a symbolic link", filepath.ToSlash(relPath))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package filesystem
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractArchive(t *testing.T) {
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "static", "css"), 0755)
+	os.WriteFile(filepath.Join(src, "index.html"), []byte("<html></html>"), 0644)
+	os.WriteFile(filepath.Join(src, "static", "css", "site.css"), []byte("body {}"), 0644)
+
+	var archive bytes.Buffer
+	err := ArchiveDirectory(context.Background(), src, &archive, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := t.TempDir()
+	extracted, err := ExtractArchive(context.Background(), &archive, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(extracted) != 2 {
+		t.Fatalf("expected 2 extracted files, got %v", extracted)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dst, "static", "css", "site.css"))
+	if err != nil || string(content) != "body {}" {
+		t.Errorf("unexpected extracted content %q: %v", content, err)
+	}
+}
+
+func TestExtractArchive_RefusesEscapingEntries(t *testing.T) {
+	dst := t.TempDir()
+	outside := t.TempDir()
+	os.Symlink(outside, filepath.Join(dst, "link"))
+
+	for _, name := range []string{"../escape.txt", "/etc/escape.txt", "link/escape.txt"} {
+		var archive bytes.Buffer
+		gw := gzip.NewWriter(&archive)
+		tw := tar.NewWriter(gw)
+		tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: 1})
+		tw.Write([]byte("x"))
+		tw.Close()
+		gw.Close()
+
+		_, err := ExtractArchive(context.Background(), &archive, dst)
+		if err == nil {
+			t.Errorf("expected the entry %s to be refused", name)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(outside, "escape.txt")); err == nil {
+		t.Error("a file was written outside of the directory")
+	}
+}
+
+func TestExtractArchiveWithLimit(t *testing.T) {
+	src := t.TempDir()
+	os.WriteFile(filepath.Join(src, "a.txt"), bytes.Repeat([]byte("a"), 64), 0644)
+	os.WriteFile(filepath.Join(src, "b.txt"), bytes.Repeat([]byte("b"), 64), 0644)
+
+	var archive bytes.Buffer
+	err := ArchiveDirectory(context.Background(), src, &archive, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ExtractArchiveWithLimit(context.Background(), bytes.NewReader(archive.Bytes()), t.TempDir(), 100)
+	if !errors.Is(err, ErrArchiveTooLarge) {
+		t.Fatalf("expected ErrArchiveTooLarge, got %v", err)
+	}
+
+	extracted, err := ExtractArchiveWithLimit(context.Background(), bytes.NewReader(archive.Bytes()), t.TempDir(), 128)
+	if err != nil || len(extracted) != 2 {
+		t.Fatalf("expected 2 extracted files, got %v: %v", extracted, err)
+	}
+}
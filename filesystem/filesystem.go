@@ -2,14 +2,17 @@ package filesystem
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"mime/multipart"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/portainer/agent/constants"
+	"github.com/portainer/agent/faults"
 )
 
 // FileInfo represents information about a file on the filesystem
@@ -109,6 +112,10 @@ func RenameFile(oldPath, newPath string) error {
 // WriteFile takes a path, filename, a file and the mode that should be associated
 // to the file and writes it to disk
 func WriteFile(folder, filename string, file []byte, mode uint32) error {
+	if err := faults.Fail(faults.DiskFull); err != nil {
+		return err
+	}
+
 	err := os.MkdirAll(folder, 0755)
 	if err != nil {
 		return err
@@ -170,3 +177,19 @@ func containsDotDot(v string) bool {
 }
 
 func isSlashRune(r rune) bool { return r == '/' || r == '\\' }
+
+// RemoveInsideDirectory removes a file or directory whose path is relative to the directory, the paths escaping the
+// directory are refused
+func RemoveInsideDirectory(directoryPath, relPath string) error {
+	relPath = filepath.Clean(filepath.FromSlash(relPath))
+	if filepath.IsAbs(relPath) || relPath == "." || containsDotDot(relPath) {
+		return fmt.Errorf("invalid path: %s", relPath)
+	}
+
+	err := checkNoSymlink(directoryPath, filepath.Dir(relPath))
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(filepath.Join(directoryPath, relPath))
+}
@@ -0,0 +1,124 @@
+package grpcapi
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/portainer/agent/operations"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The messages are encoded by hand following agent.proto, the numbers of the fields must be kept in sync
+
+type status struct {
+	AgentVersion  string
+	APIVersion    string
+	Platform      string
+	AgentID       string
+	EdgeMode      bool
+	EndpointID    int64
+	UptimeSeconds int64
+}
+
+func (s *status) marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, s.AgentVersion)
+	b = appendString(b, 2, s.APIVersion)
+	b = appendString(b, 3, s.Platform)
+	b = appendString(b, 4, s.AgentID)
+	b = appendBool(b, 5, s.EdgeMode)
+	b = appendInt(b, 6, s.EndpointID)
+	b = appendInt(b, 7, s.UptimeSeconds)
+
+	return b
+}
+
+type snapshot struct {
+	CreatedAt      time.Time
+	DockerJSON     []byte
+	KubernetesJSON []byte
+}
+
+func (s *snapshot) marshal() []byte {
+	var b []byte
+	b = appendInt(b, 1, s.CreatedAt.Unix())
+	b = appendBytes(b, 2, s.DockerJSON)
+	b = appendBytes(b, 3, s.KubernetesJSON)
+
+	return b
+}
+
+func marshalOperation(op operations.Operation) []byte {
+	var result []byte
+	if op.Result != nil {
+		// The result is only informative, an operation is still sent when it cannot be encoded
+		result, _ = json.Marshal(op.Result)
+	}
+
+	var b []byte
+	b = appendString(b, 1, op.ID)
+	b = appendString(b, 2, op.Type)
+	b = appendString(b, 3, op.Status)
+	b = appendInt(b, 4, int64(op.Progress))
+	b = appendString(b, 5, op.Message)
+	b = appendString(b, 6, op.Error)
+	b = appendInt(b, 7, op.CreatedAt.Unix())
+	b = appendInt(b, 8, op.UpdatedAt.Unix())
+	b = appendBytes(b, 9, result)
+
+	return b
+}
+
+func marshalListOperationsResponse(ops []operations.Operation) []byte {
+	var b []byte
+	for _, op := range ops {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, marshalOperation(op))
+	}
+
+	return b
+}
+
+type watchSnapshotsRequest struct {
+	IntervalSeconds uint32
+}
+
+func (req *watchSnapshotsRequest) unmarshal(message []byte) error {
+	return decodeFields(message, func(num protowire.Number, varint uint64, bytes []byte) {
+		if num == 1 {
+			req.IntervalSeconds = uint32(varint)
+		}
+	})
+}
+
+type watchOperationRequest struct {
+	ID string
+}
+
+func (req *watchOperationRequest) unmarshal(message []byte) error {
+	return decodeFields(message, func(num protowire.Number, varint uint64, bytes []byte) {
+		if num == 1 {
+			req.ID = string(bytes)
+		}
+	})
+}
+
+type commandRequest struct {
+	Type      string
+	Operation string
+	ValueJSON []byte
+}
+
+func (cmd *commandRequest) unmarshal(message []byte) error {
+	return decodeFields(message, func(num protowire.Number, varint uint64, bytes []byte) {
+		switch num {
+		case 1:
+			cmd.Type = string(bytes)
+		case 2:
+			cmd.Operation = string(bytes)
+		case 3:
+			cmd.ValueJSON = bytes
+		}
+	})
+}
@@ -0,0 +1,184 @@
+package grpcapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/portainer/agent/operations"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// fields decodes the varint and the length-delimited fields of message by number
+func fields(t *testing.T, message []byte) (map[protowire.Number]uint64, map[protowire.Number][]byte) {
+	t.Helper()
+
+	varints := map[protowire.Number]uint64{}
+	values := map[protowire.Number][]byte{}
+
+	err := decodeFields(message, func(num protowire.Number, varint uint64, bytes []byte) {
+		if bytes != nil {
+			values[num] = bytes
+			return
+		}
+
+		varints[num] = varint
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return varints, values
+}
+
+// unknownFields returns the fields 100 to 104 with each wire type, they must be skipped by the decoders
+func unknownFields() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 100, protowire.VarintType)
+	b = protowire.AppendVarint(b, 42)
+	b = protowire.AppendTag(b, 101, protowire.Fixed32Type)
+	b = protowire.AppendFixed32(b, 42)
+	b = protowire.AppendTag(b, 102, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, 42)
+	b = protowire.AppendTag(b, 103, protowire.BytesType)
+	b = protowire.AppendString(b, "unknown")
+	b = protowire.AppendTag(b, 104, protowire.StartGroupType)
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, 1)
+	b = protowire.AppendTag(b, 104, protowire.EndGroupType)
+
+	return b
+}
+
+func TestStatusMarshal(t *testing.T) {
+	s := &status{
+		AgentVersion:  "2.19.0",
+		APIVersion:    "2",
+		Platform:      "docker",
+		AgentID:       "agent-1",
+		EdgeMode:      true,
+		EndpointID:    12,
+		UptimeSeconds: 3600,
+	}
+
+	varints, values := fields(t, s.marshal())
+
+	for num, expected := range map[protowire.Number]string{1: "2.19.0", 2: "2", 3: "docker", 4: "agent-1"} {
+		if string(values[num]) != expected {
+			t.Errorf("field %d: expected %q, got %q", num, expected, values[num])
+		}
+	}
+
+	for num, expected := range map[protowire.Number]uint64{5: 1, 6: 12, 7: 3600} {
+		if varints[num] != expected {
+			t.Errorf("field %d: expected %d, got %d", num, expected, varints[num])
+		}
+	}
+
+	if message := (&status{}).marshal(); len(message) != 0 {
+		t.Errorf("expected the default values to be omitted, got %x", message)
+	}
+}
+
+func TestSnapshotMarshal(t *testing.T) {
+	createdAt := time.Unix(1700000000, 0)
+	s := &snapshot{CreatedAt: createdAt, DockerJSON: []byte(`{"Containers":3}`)}
+
+	varints, values := fields(t, s.marshal())
+
+	if varints[1] != uint64(createdAt.Unix()) {
+		t.Errorf("expected the creation time %d, got %d", createdAt.Unix(), varints[1])
+	}
+
+	if string(values[2]) != `{"Containers":3}` {
+		t.Errorf("unexpected Docker snapshot %q", values[2])
+	}
+
+	if _, ok := values[3]; ok {
+		t.Error("expected the empty Kubernetes snapshot to be omitted")
+	}
+}
+
+func TestMarshalListOperationsResponse(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	ops := []operations.Operation{
+		{ID: "a", Type: "image_pull", Status: operations.StatusRunning, Progress: 50, CreatedAt: now, UpdatedAt: now},
+		{ID: "b", Type: "stack_deploy", Status: operations.StatusFailed, Error: "boom", Result: map[string]int{"Deployed": 1}, CreatedAt: now, UpdatedAt: now.Add(time.Minute)},
+	}
+
+	var decoded [][]byte
+	err := decodeFields(marshalListOperationsResponse(ops), func(num protowire.Number, varint uint64, bytes []byte) {
+		if num == 1 {
+			decoded = append(decoded, bytes)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(decoded) != len(ops) {
+		t.Fatalf("expected %d operations, got %d", len(ops), len(decoded))
+	}
+
+	varints, values := fields(t, decoded[0])
+	if string(values[1]) != "a" || string(values[3]) != operations.StatusRunning || varints[4] != 50 {
+		t.Errorf("unexpected first operation %v %q", varints, values)
+	}
+
+	varints, values = fields(t, decoded[1])
+	if string(values[1]) != "b" || string(values[6]) != "boom" || varints[8] != uint64(now.Add(time.Minute).Unix()) {
+		t.Errorf("unexpected second operation %v %q", varints, values)
+	}
+
+	var result map[string]int
+	if err := json.Unmarshal(values[9], &result); err != nil || result["Deployed"] != 1 {
+		t.Errorf("expected the JSON result of the operation, got %q", values[9])
+	}
+}
+
+func TestRequestsUnmarshal(t *testing.T) {
+	var message []byte
+	message = append(message, unknownFields()...)
+	message = protowire.AppendTag(message, 1, protowire.BytesType)
+	message = protowire.AppendString(message, "container")
+	message = protowire.AppendTag(message, 2, protowire.BytesType)
+	message = protowire.AppendString(message, "restart")
+	message = protowire.AppendTag(message, 3, protowire.BytesType)
+	message = protowire.AppendString(message, `{"Id":"web"}`)
+	message = append(message, unknownFields()...)
+
+	var cmd commandRequest
+	err := cmd.unmarshal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cmd.Type != "container" || cmd.Operation != "restart" || !bytes.Equal(cmd.ValueJSON, []byte(`{"Id":"web"}`)) {
+		t.Errorf("unexpected command %+v", cmd)
+	}
+
+	message = protowire.AppendTag(unknownFields(), 1, protowire.VarintType)
+	message = protowire.AppendVarint(message, 30)
+
+	var watch watchSnapshotsRequest
+	err = watch.unmarshal(message)
+	if err != nil || watch.IntervalSeconds != 30 {
+		t.Errorf("expected an interval of 30 seconds, got %d, %v", watch.IntervalSeconds, err)
+	}
+
+	message = protowire.AppendTag(nil, 1, protowire.BytesType)
+	message = protowire.AppendString(message, "op-1")
+
+	var op watchOperationRequest
+	err = op.unmarshal(append(message, unknownFields()...))
+	if err != nil || op.ID != "op-1" {
+		t.Errorf("expected the operation op-1, got %q, %v", op.ID, err)
+	}
+
+	err = op.unmarshal(message[:len(message)-1])
+	if err == nil {
+		t.Error("expected an error for a truncated request")
+	}
+}
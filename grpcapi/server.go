@@ -0,0 +1,276 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/edge"
+	"github.com/portainer/agent/edge/client"
+	"github.com/portainer/agent/edge/command"
+	"github.com/portainer/agent/identity"
+	"github.com/portainer/agent/kubernetes"
+	"github.com/portainer/agent/operations"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	servicePrefix = "/portainer.agent.v1.AgentService/"
+
+	defaultSnapshotInterval = 60 * time.Second
+	minSnapshotInterval     = 10 * time.Second
+)
+
+// method handles a call, request is the single message sent by the client and send writes a response message
+type method func(ctx context.Context, request []byte, send func(message []byte) error) error
+
+// Handler serves the AgentService defined in agent.proto. It is served by the API server alongside the REST API,
+// on HTTP/2 connections only.
+type Handler struct {
+	operationManager  *operations.Manager
+	edgeManager       *edge.Manager
+	containerPlatform agent.ContainerPlatform
+	agentIdentity     *identity.Identity
+	startedAt         time.Time
+	methods           map[string]method
+}
+
+// NewHandler returns a pointer to a Handler, edgeManager and agentIdentity are nil when not available
+func NewHandler(operationManager *operations.Manager, edgeManager *edge.Manager, containerPlatform agent.ContainerPlatform, agentIdentity *identity.Identity) *Handler {
+	h := &Handler{
+		operationManager:  operationManager,
+		edgeManager:       edgeManager,
+		containerPlatform: containerPlatform,
+		agentIdentity:     agentIdentity,
+		startedAt:         time.Now(),
+	}
+
+	h.methods = map[string]method{
+		"GetStatus":      h.getStatus,
+		"GetSnapshot":    h.getSnapshot,
+		"WatchSnapshots": h.watchSnapshots,
+		"ListOperations": h.listOperations,
+		"WatchOperation": h.watchOperation,
+		"ExecuteCommand": h.executeCommand,
+	}
+
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", grpcContentType)
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, servicePrefix)
+	fn, ok := h.methods[name]
+	if !ok || !strings.HasPrefix(r.URL.Path, servicePrefix) {
+		writeStatus(w, &statusError{code: codeUnimplemented, message: fmt.Sprintf("unknown method %s", r.URL.Path)})
+		return
+	}
+
+	request, err := readMessage(r.Body)
+	if err != nil {
+		writeStatus(w, newStatusError(codeInvalidArgument, err))
+		return
+	}
+
+	err = fn(r.Context(), request, func(message []byte) error {
+		return writeMessage(w, message)
+	})
+	if err != nil && r.Context().Err() == nil {
+		log.Debug().Err(err).Str("method", name).Msg("gRPC call failed")
+	}
+
+	writeStatus(w, err)
+}
+
+func (h *Handler) getStatus(ctx context.Context, request []byte, send func([]byte) error) error {
+	s := &status{
+		AgentVersion:  agent.Version,
+		APIVersion:    agent.APIVersion,
+		Platform:      platformName(h.containerPlatform),
+		EdgeMode:      h.edgeManager != nil,
+		UptimeSeconds: int64(time.Since(h.startedAt).Seconds()),
+	}
+
+	if h.agentIdentity != nil {
+		s.AgentID = h.agentIdentity.ID
+	}
+
+	if h.edgeManager != nil && h.edgeManager.IsKeySet() {
+		s.EndpointID = int64(h.edgeManager.GetEndpointID())
+	}
+
+	return send(s.marshal())
+}
+
+func (h *Handler) getSnapshot(ctx context.Context, request []byte, send func([]byte) error) error {
+	s, err := h.createSnapshot(ctx)
+	if err != nil {
+		return err
+	}
+
+	return send(s.marshal())
+}
+
+func (h *Handler) watchSnapshots(ctx context.Context, request []byte, send func([]byte) error) error {
+	var req watchSnapshotsRequest
+	if err := req.unmarshal(request); err != nil {
+		return newStatusError(codeInvalidArgument, err)
+	}
+
+	interval := defaultSnapshotInterval
+	if req.IntervalSeconds > 0 {
+		interval = max(time.Duration(req.IntervalSeconds)*time.Second, minSnapshotInterval)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s, err := h.createSnapshot(ctx)
+		if err != nil {
+			return err
+		}
+
+		if err := send(s.marshal()); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *Handler) listOperations(ctx context.Context, request []byte, send func([]byte) error) error {
+	return send(marshalListOperationsResponse(h.operationManager.List()))
+}
+
+func (h *Handler) watchOperation(ctx context.Context, request []byte, send func([]byte) error) error {
+	var req watchOperationRequest
+	if err := req.unmarshal(request); err != nil {
+		return newStatusError(codeInvalidArgument, err)
+	}
+
+	updates, unsubscribe, err := h.operationManager.Subscribe(req.ID)
+	if errors.Is(err, operations.ErrOperationNotFound) {
+		return newStatusError(codeNotFound, err)
+	} else if err != nil {
+		return err
+	}
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case op, ok := <-updates:
+			if !ok {
+				return nil
+			}
+
+			if err := send(marshalOperation(op)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (h *Handler) executeCommand(ctx context.Context, request []byte, send func([]byte) error) error {
+	if h.edgeManager == nil {
+		return &statusError{code: codeFailedPrecondition, message: "the commands are only supported by the Edge agents"}
+	}
+
+	var cmd commandRequest
+	if err := cmd.unmarshal(request); err != nil {
+		return newStatusError(codeInvalidArgument, err)
+	}
+
+	var value interface{}
+	if len(cmd.ValueJSON) > 0 {
+		if err := json.Unmarshal(cmd.ValueJSON, &value); err != nil {
+			return newStatusError(codeInvalidArgument, err)
+		}
+	}
+
+	err := h.edgeManager.ExecuteCommand(ctx, client.AsyncCommand{
+		Type:      cmd.Type,
+		Operation: cmd.Operation,
+		Value:     value,
+		Timestamp: time.Now(),
+	})
+	if errors.Is(err, command.ErrUnsupportedCommand) {
+		return newStatusError(codeUnimplemented, err)
+	} else if err != nil {
+		return err
+	}
+
+	// Empty CommandResult message
+	return send(nil)
+}
+
+func (h *Handler) createSnapshot(ctx context.Context) (*snapshot, error) {
+	s := &snapshot{CreatedAt: time.Now()}
+
+	var err error
+	switch h.containerPlatform {
+	case agent.PlatformDocker, agent.PlatformPodman:
+		dockerSnapshot, snapshotErr := docker.CreateSnapshot(ctx)
+		if snapshotErr != nil {
+			return nil, snapshotErr
+		}
+
+		s.DockerJSON, err = json.Marshal(dockerSnapshot)
+		if err != nil || !kubernetes.UsesKubeconfig() {
+			break
+		}
+
+		// The Kubernetes cluster running next to the Docker daemon is snapshotted as well
+		kubernetesSnapshot, snapshotErr := kubernetes.CreateSnapshot()
+		if snapshotErr != nil {
+			return nil, snapshotErr
+		}
+
+		s.KubernetesJSON, err = json.Marshal(kubernetesSnapshot)
+	case agent.PlatformKubernetes:
+		kubernetesSnapshot, snapshotErr := kubernetes.CreateSnapshot()
+		if snapshotErr != nil {
+			return nil, snapshotErr
+		}
+
+		s.KubernetesJSON, err = json.Marshal(kubernetesSnapshot)
+	default:
+		return nil, &statusError{code: codeFailedPrecondition, message: "the snapshots are not supported on this platform"}
+	}
+
+	return s, err
+}
+
+func platformName(platform agent.ContainerPlatform) string {
+	switch platform {
+	case agent.PlatformDocker:
+		return "docker"
+	case agent.PlatformKubernetes:
+		return "kubernetes"
+	case agent.PlatformPodman:
+		return "podman"
+	case agent.PlatformNomad:
+		return "nomad"
+	}
+
+	return "unknown"
+}
@@ -0,0 +1,208 @@
+package grpcapi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	grpcContentType       = "application/grpc"
+	grpcMessageHeaderSize = 5
+	maxRequestMessageSize = 4 * 1024 * 1024
+)
+
+// gRPC status codes
+const (
+	codeOK                 = 0
+	codeInvalidArgument    = 3
+	codeNotFound           = 5
+	codeFailedPrecondition = 9
+	codeUnimplemented      = 12
+	codeInternal           = 13
+)
+
+// statusError is an error reported to the client with a gRPC status code
+type statusError struct {
+	code    int
+	message string
+}
+
+func (err *statusError) Error() string {
+	return err.message
+}
+
+func newStatusError(code int, err error) *statusError {
+	return &statusError{code: code, message: err.Error()}
+}
+
+// IsGRPCRequest returns true when r is a gRPC request
+func IsGRPCRequest(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), grpcContentType)
+}
+
+// readMessage reads a length-prefixed message, the compressed messages are not supported
+func readMessage(r io.Reader) ([]byte, error) {
+	header := make([]byte, grpcMessageHeaderSize)
+
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, err
+	}
+
+	if header[0] != 0 {
+		return nil, errors.New("compressed messages are not supported")
+	}
+
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxRequestMessageSize {
+		return nil, fmt.Errorf("message too large: %d bytes", size)
+	}
+
+	message := make([]byte, size)
+
+	_, err = io.ReadFull(r, message)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return message, err
+}
+
+// writeMessage writes a length-prefixed message and flushes it to the client
+func writeMessage(w http.ResponseWriter, message []byte) error {
+	frame := make([]byte, grpcMessageHeaderSize, grpcMessageHeaderSize+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+
+	if _, err := w.Write(append(frame, message...)); err != nil {
+		return err
+	}
+
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+
+	return nil
+}
+
+// writeStatus sends the status of the call in the trailers of the response
+func writeStatus(w http.ResponseWriter, err error) {
+	code, message := codeOK, ""
+	if err != nil {
+		code, message = codeInternal, err.Error()
+
+		var statusErr *statusError
+		if errors.As(err, &statusErr) {
+			code = statusErr.code
+		}
+	}
+
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", encodeGRPCMessage(message))
+	}
+}
+
+// encodeGRPCMessage percent-encodes the characters that are not allowed in the Grpc-Message trailer
+func encodeGRPCMessage(message string) string {
+	var b strings.Builder
+
+	for _, c := range []byte(message) {
+		if c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+
+			continue
+		}
+
+		b.WriteByte(c)
+	}
+
+	return b.String()
+}
+
+// decodeFields calls fn with each field of message, the value is the raw varint or the content of the length-delimited
+// fields. The other wire types are skipped.
+func decodeFields(message []byte, fn func(num protowire.Number, varint uint64, bytes []byte)) error {
+	for len(message) > 0 {
+		num, typ, n := protowire.ConsumeTag(message)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		message = message[n:]
+
+		switch typ {
+		case protowire.VarintType:
+			value, n := protowire.ConsumeVarint(message)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			message = message[n:]
+
+			fn(num, value, nil)
+		case protowire.BytesType:
+			value, n := protowire.ConsumeBytes(message)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			message = message[n:]
+
+			fn(num, 0, value)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, message)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			message = message[n:]
+		}
+	}
+
+	return nil
+}
+
+// The append functions omit the default values, as proto3 does
+
+func appendString(b []byte, num protowire.Number, value string) []byte {
+	if value == "" {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+
+	return protowire.AppendString(b, value)
+}
+
+func appendBytes(b []byte, num protowire.Number, value []byte) []byte {
+	if len(value) == 0 {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+
+	return protowire.AppendBytes(b, value)
+}
+
+func appendInt(b []byte, num protowire.Number, value int64) []byte {
+	if value == 0 {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+
+	return protowire.AppendVarint(b, uint64(value))
+}
+
+func appendBool(b []byte, num protowire.Number, value bool) []byte {
+	if !value {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+
+	return protowire.AppendVarint(b, 1)
+}
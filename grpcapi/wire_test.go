@@ -0,0 +1,205 @@
+package grpcapi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func frame(flag byte, size uint32, message []byte) []byte {
+	header := make([]byte, grpcMessageHeaderSize)
+	header[0] = flag
+	binary.BigEndian.PutUint32(header[1:], size)
+
+	return append(header, message...)
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	messages := [][]byte{
+		{},
+		[]byte("status"),
+		bytes.Repeat([]byte{0xff}, 64*1024),
+		make([]byte, maxRequestMessageSize),
+	}
+
+	rec := httptest.NewRecorder()
+	for _, message := range messages {
+		err := writeMessage(rec, message)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !rec.Flushed {
+		t.Error("expected the messages to be flushed")
+	}
+
+	body := bytes.NewReader(rec.Body.Bytes())
+	for i, expected := range messages {
+		message, err := readMessage(body)
+		if err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+
+		if !bytes.Equal(message, expected) {
+			t.Errorf("message %d: expected %d bytes, got %d bytes", i, len(expected), len(message))
+		}
+	}
+
+	_, err := readMessage(body)
+	if err != io.EOF {
+		t.Errorf("expected io.EOF after the last message, got %v", err)
+	}
+}
+
+func TestReadMessageMalformed(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []byte
+		expected error
+		message  string
+	}{
+		{
+			name:     "empty stream",
+			input:    nil,
+			expected: io.EOF,
+		},
+		{
+			name:     "truncated length prefix",
+			input:    frame(0, 4, nil)[:3],
+			expected: io.ErrUnexpectedEOF,
+		},
+		{
+			name:     "truncated message",
+			input:    frame(0, 10, []byte("short")),
+			expected: io.ErrUnexpectedEOF,
+		},
+		{
+			name:     "missing message",
+			input:    frame(0, 10, nil),
+			expected: io.ErrUnexpectedEOF,
+		},
+		{
+			name:    "compressed message",
+			input:   frame(1, 2, []byte("ok")),
+			message: "compressed messages are not supported",
+		},
+		{
+			name:    "oversized message",
+			input:   frame(0, maxRequestMessageSize+1, []byte("ok")),
+			message: "message too large: 4194305 bytes",
+		},
+		{
+			name:    "maximum length prefix",
+			input:   frame(0, 0xffffffff, nil),
+			message: "message too large",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readMessage(bytes.NewReader(tt.input))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if tt.expected != nil && !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+
+			if tt.message != "" && !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("expected %q, got %q", tt.message, err)
+			}
+		})
+	}
+}
+
+func TestDecodeFieldsMalformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		message []byte
+	}{
+		{
+			name:    "truncated tag",
+			message: []byte{0x80},
+		},
+		{
+			name:    "invalid field number",
+			message: []byte{0x00, 0x01},
+		},
+		{
+			name:    "truncated varint",
+			message: []byte{0x08, 0x80},
+		},
+		{
+			name:    "truncated length",
+			message: []byte{0x0a},
+		},
+		{
+			name:    "length past the end of the message",
+			message: []byte{0x0a, 0x05, 'a', 'b'},
+		},
+		{
+			name:    "truncated fixed64",
+			message: []byte{0x09, 0x01, 0x02},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := decodeFields(tt.message, func(num protowire.Number, varint uint64, bytes []byte) {})
+			if err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestWriteStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		code    string
+		message string
+	}{
+		{
+			name: "ok",
+			code: "0",
+		},
+		{
+			name:    "status error",
+			err:     &statusError{code: codeNotFound, message: "operation not found"},
+			code:    "5",
+			message: "operation not found",
+		},
+		{
+			name:    "other error",
+			err:     errors.New("100% failed\nretry"),
+			code:    "13",
+			message: "100%25 failed%0Aretry",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writeStatus(rec, tt.err)
+
+			header := rec.Header()
+			if code := header.Get(http.TrailerPrefix + "Grpc-Status"); code != tt.code {
+				t.Errorf("expected the status %s, got %s", tt.code, code)
+			}
+
+			if message := header.Get(http.TrailerPrefix + "Grpc-Message"); message != tt.message {
+				t.Errorf("expected the message %q, got %q", tt.message, message)
+			}
+		})
+	}
+}
@@ -15,6 +15,10 @@ import (
 )
 
 func Run(options *agent.Options, clusterService agent.ClusterService) error {
+	if clusterService != nil {
+		checkClusterVersions(clusterService)
+	}
+
 	if !options.EdgeMode {
 
 		// Healthcheck not considered for regular agent in the scope of the agent auto-upgrade POC
@@ -61,6 +65,14 @@ func Run(options *agent.Options, clusterService agent.ClusterService) error {
 	return nil
 }
 
+// checkClusterVersions warns about the cluster members running a different agent version, mixed version
+// clusters are not supported and cause proxied requests to fail in ways that are hard to diagnose
+func checkClusterVersions(clusterService agent.ClusterService) {
+	for _, member := range clusterService.GetMismatchedVersionMembers() {
+		log.Printf("[WARN] [healthcheck] [message: Agent version mismatch] [node: %s] [member_version: %s] [agent_version: %s]", member.NodeName, member.Version, agent.Version)
+	}
+}
+
 func checkUrl(keyUrl string) (*url.URL, error) {
 	parsedUrl, err := url.Parse(keyUrl)
 	if err != nil {
@@ -87,7 +99,7 @@ func checkPolling(portainerUrl string, options *agent.Options) error {
 		return errors.WithMessage(err, "Failed creating request")
 	}
 
-	cli := client.BuildHTTPClient(10, options)
+	cli := client.BuildHTTPClient(10, options, nil, nil, nil)
 
 	resp, err := cli.Do(req)
 	if err != nil {
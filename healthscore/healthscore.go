@@ -0,0 +1,207 @@
+// Package healthscore computes a single health score of the environment, weighted across the health of the
+// workloads, the disks, the connection to the Portainer server, the freshness of the snapshots and the alerts, so
+// that the fleet dashboard can sort thousands of devices by risk.
+package healthscore
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Levels of the health score
+const (
+	LevelHealthy  = "healthy"
+	LevelDegraded = "degraded"
+	LevelCritical = "critical"
+)
+
+// Components of the health score
+const (
+	ComponentWorkloads    = "workloads"
+	ComponentDisks        = "disks"
+	ComponentConnectivity = "connectivity"
+	ComponentSnapshots    = "snapshots"
+	ComponentAlerts       = "alerts"
+)
+
+const (
+	// healthyScore and degradedScore are the minimum scores of the healthy and degraded levels
+	healthyScore  = 80
+	degradedScore = 50
+	// diskUsageThreshold is the usage of a partition from which the disk score decreases, down to 0 when full
+	diskUsageThreshold = 80
+	// disconnectedOutage is the duration of the loss of the server after which the connectivity score is 0
+	disconnectedOutage = time.Hour
+	// staleSnapshotIntervals and expiredSnapshotIntervals are the numbers of snapshot intervals since the last
+	// snapshot received by the server from which the snapshot score decreases, and after which it is 0
+	staleSnapshotIntervals   = 2
+	expiredSnapshotIntervals = 10
+	// alertPenalty is the points removed from the alert score for each alert
+	alertPenalty = 20
+)
+
+// weights are the weights of the components in the score, they add up to 100
+var weights = map[string]int{
+	ComponentWorkloads:    30,
+	ComponentDisks:        25,
+	ComponentConnectivity: 15,
+	ComponentSnapshots:    15,
+	ComponentAlerts:       15,
+}
+
+// Inputs are the conditions of the environment the score is computed from
+type Inputs struct {
+	// Workloads is the number of running containers and Kubernetes workloads, UnhealthyWorkloads the ones that are
+	// unhealthy or not ready
+	Workloads          int
+	UnhealthyWorkloads int
+	// PartitionsUsedPercent are the usages of the partitions of the host
+	PartitionsUsedPercent []float64
+	// FailingDisks are the disks failing their SMART self-assessment, WarningDisks the ones with warnings
+	FailingDisks int
+	WarningDisks int
+	// Disconnected is true when the last requests to the Portainer server failed, since DisconnectedSince
+	Disconnected      bool
+	DisconnectedSince time.Time
+	// LastSnapshot is the time of the last snapshot received by the server, zero before the first one
+	LastSnapshot     time.Time
+	SnapshotInterval time.Duration
+	// Alerts is the number of diagnostics of the snapshot
+	Alerts int
+}
+
+// Score is the health score of the environment, from 0 for an environment at risk to 100 for a healthy one
+type Score struct {
+	Score      int         `json:"Score"`
+	Level      string      `json:"Level"`
+	Components []Component `json:"Components"`
+}
+
+// Component is the score of a component of the health score
+type Component struct {
+	Name   string `json:"Name"`
+	Score  int    `json:"Score"`
+	Weight int    `json:"Weight"`
+	// Reason explains a score below 100
+	Reason string `json:"Reason,omitempty"`
+}
+
+// Compute returns the health score of the environment at now
+func Compute(inputs Inputs, now time.Time) *Score {
+	components := []Component{
+		workloadsComponent(inputs),
+		disksComponent(inputs),
+		connectivityComponent(inputs, now),
+		snapshotsComponent(inputs, now),
+		alertsComponent(inputs),
+	}
+
+	total := 0
+	for i := range components {
+		components[i].Weight = weights[components[i].Name]
+		total += components[i].Score * components[i].Weight
+	}
+
+	score := &Score{
+		Score:      int(math.Round(float64(total) / 100)),
+		Level:      LevelCritical,
+		Components: components,
+	}
+
+	switch {
+	case score.Score >= healthyScore:
+		score.Level = LevelHealthy
+	case score.Score >= degradedScore:
+		score.Level = LevelDegraded
+	}
+
+	return score
+}
+
+func workloadsComponent(inputs Inputs) Component {
+	component := Component{Name: ComponentWorkloads, Score: 100}
+
+	if inputs.Workloads > 0 && inputs.UnhealthyWorkloads > 0 {
+		component.Score = clamp((inputs.Workloads - inputs.UnhealthyWorkloads) * 100 / inputs.Workloads)
+		component.Reason = fmt.Sprintf("%d of %d workloads are unhealthy", inputs.UnhealthyWorkloads, inputs.Workloads)
+	}
+
+	return component
+}
+
+func disksComponent(inputs Inputs) Component {
+	component := Component{Name: ComponentDisks, Score: 100}
+
+	for _, usedPercent := range inputs.PartitionsUsedPercent {
+		if usedPercent <= diskUsageThreshold {
+			continue
+		}
+
+		score := clamp(int((100 - usedPercent) * 100 / (100 - diskUsageThreshold)))
+		if score < component.Score {
+			component.Score = score
+			component.Reason = fmt.Sprintf("a partition is %.0f%% used", usedPercent)
+		}
+	}
+
+	switch {
+	case inputs.FailingDisks > 0:
+		component.Score = 0
+		component.Reason = fmt.Sprintf("%d disks are failing", inputs.FailingDisks)
+	case inputs.WarningDisks > 0 && component.Score > 50:
+		component.Score = 50
+		component.Reason = fmt.Sprintf("%d disks report warnings", inputs.WarningDisks)
+	}
+
+	return component
+}
+
+func connectivityComponent(inputs Inputs, now time.Time) Component {
+	component := Component{Name: ComponentConnectivity, Score: 100}
+
+	if inputs.Disconnected {
+		outage := now.Sub(inputs.DisconnectedSince)
+
+		// a failed request already costs a quarter of the score, the rest is lost over the outage
+		component.Score = clamp(75 - int(75*outage/disconnectedOutage))
+		component.Reason = fmt.Sprintf("the Portainer server cannot be reached since %s", outage.Round(time.Second))
+	}
+
+	return component
+}
+
+func snapshotsComponent(inputs Inputs, now time.Time) Component {
+	component := Component{Name: ComponentSnapshots, Score: 100}
+
+	if inputs.LastSnapshot.IsZero() || inputs.SnapshotInterval <= 0 {
+		return component
+	}
+
+	age := now.Sub(inputs.LastSnapshot)
+	stale := staleSnapshotIntervals * inputs.SnapshotInterval
+	if age <= stale {
+		return component
+	}
+
+	expired := expiredSnapshotIntervals * inputs.SnapshotInterval
+	component.Score = clamp(int(100 * (expired - age) / (expired - stale)))
+	component.Reason = fmt.Sprintf("the last snapshot received by the server is %s old", age.Round(time.Second))
+
+	return component
+}
+
+func alertsComponent(inputs Inputs) Component {
+	component := Component{Name: ComponentAlerts, Score: 100}
+
+	if inputs.Alerts > 0 {
+		component.Score = clamp(100 - alertPenalty*inputs.Alerts)
+		component.Reason = fmt.Sprintf("%d alerts are raised", inputs.Alerts)
+	}
+
+	return component
+}
+
+func clamp(score int) int {
+	return max(0, min(100, score))
+}
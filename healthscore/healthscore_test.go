@@ -0,0 +1,104 @@
+package healthscore
+
+import (
+	"testing"
+	"time"
+)
+
+func componentScore(score *Score, name string) int {
+	for _, component := range score.Components {
+		if component.Name == name {
+			return component.Score
+		}
+	}
+
+	return -1
+}
+
+func TestCompute_Healthy(t *testing.T) {
+	now := time.Now()
+
+	score := Compute(Inputs{
+		Workloads:             12,
+		PartitionsUsedPercent: []float64{42, 75},
+		LastSnapshot:          now.Add(-time.Minute),
+		SnapshotInterval:      time.Minute,
+	}, now)
+
+	if score.Score != 100 || score.Level != LevelHealthy {
+		t.Fatalf("expected a healthy score of 100, got %+v", score)
+	}
+
+	for _, component := range score.Components {
+		if component.Reason != "" {
+			t.Errorf("unexpected reason for %s: %s", component.Name, component.Reason)
+		}
+	}
+}
+
+func TestCompute_Components(t *testing.T) {
+	now := time.Now()
+
+	score := Compute(Inputs{
+		Workloads:             10,
+		UnhealthyWorkloads:    5,
+		PartitionsUsedPercent: []float64{90},
+		Disconnected:          true,
+		DisconnectedSince:     now.Add(-30 * time.Minute),
+		LastSnapshot:          now.Add(-6 * time.Minute),
+		SnapshotInterval:      time.Minute,
+		Alerts:                2,
+	}, now)
+
+	expected := map[string]int{
+		ComponentWorkloads:    50,
+		ComponentDisks:        50,
+		ComponentConnectivity: 38,
+		ComponentSnapshots:    50,
+		ComponentAlerts:       60,
+	}
+
+	for name, value := range expected {
+		if actual := componentScore(score, name); actual != value {
+			t.Errorf("expected a %s score of %d, got %d", name, value, actual)
+		}
+	}
+
+	// (50*30 + 50*25 + 38*15 + 50*15 + 60*15) / 100
+	if score.Score != 50 || score.Level != LevelDegraded {
+		t.Fatalf("expected a degraded score of 50, got %d (%s)", score.Score, score.Level)
+	}
+}
+
+func TestCompute_Critical(t *testing.T) {
+	now := time.Now()
+
+	score := Compute(Inputs{
+		Workloads:          4,
+		UnhealthyWorkloads: 4,
+		FailingDisks:       1,
+		Disconnected:       true,
+		DisconnectedSince:  now.Add(-2 * time.Hour),
+		LastSnapshot:       now.Add(-time.Hour),
+		SnapshotInterval:   time.Minute,
+		Alerts:             8,
+	}, now)
+
+	if score.Score != 0 || score.Level != LevelCritical {
+		t.Fatalf("expected a critical score of 0, got %+v", score)
+	}
+}
+
+func TestCompute_DiskWarnings(t *testing.T) {
+	score := Compute(Inputs{WarningDisks: 1, PartitionsUsedPercent: []float64{99}}, time.Now())
+
+	if disks := componentScore(score, ComponentDisks); disks != 5 {
+		t.Fatalf("expected the usage of the partition to prevail over the warnings, got %d", disks)
+	}
+
+	score = Compute(Inputs{WarningDisks: 1}, time.Now())
+
+	if disks := componentScore(score, ComponentDisks); disks != 50 {
+		t.Fatalf("expected a disk score of 50 with warnings, got %d", disks)
+	}
+}
@@ -0,0 +1,553 @@
+// Package hooks runs the scripting hooks of the agent: small Starlark scripts reacting to the Docker events and to the
+// snapshots of the environment for site-specific automation, e.g. restarting the containers matching a pattern when
+// they become unhealthy. The hooks are read from a local folder or pushed by the Portainer server. They have no access
+// to the filesystem, the network or the environment of the agent and only act through the builtins of the agent, each
+// call is bounded in steps and in time.
+//
+// A hook defines at least one of the following functions, their argument is the JSON document of the event or of the
+// snapshot converted to Starlark values:
+//
+//	def on_docker_event(event): ...   # called for each event of the Docker engine
+//	def on_snapshot(snapshot): ...    # called with each snapshot of the environment
+//
+// The builtins available to the hooks are restart_container(id), start_container(id), stop_container(id),
+// match(pattern, value) for regular expressions, alert(message) and print(...) which logs its arguments. An action on
+// a container is performed at most once per minute by a hook, it returns False when it is skipped.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent/eventbus"
+	"github.com/portainer/agent/notify"
+
+	"github.com/rs/zerolog/log"
+	"go.starlark.net/starlark"
+)
+
+const (
+	// OnDockerEvent is the function of a hook called for each Docker event
+	OnDockerEvent = "on_docker_event"
+	// OnSnapshot is the function of a hook called with each snapshot
+	OnSnapshot = "on_snapshot"
+
+	// fileExtension is the extension of the files of the hooks
+	fileExtension = ".star"
+
+	// maxExecutionSteps bounds the computation of a call to a hook
+	maxExecutionSteps = 10_000_000
+	// callTimeout bounds the duration of a call to a hook, including the actions it performs
+	callTimeout = 30 * time.Second
+	// actionCooldown is the minimum interval between two identical actions of a hook
+	actionCooldown = time.Minute
+
+	// hookLocalKey, engineLocalKey and contextLocalKey are the thread locals storing the name of the hook being
+	// called, the engine calling it and the context of the call
+	hookLocalKey    = "hook"
+	engineLocalKey  = "engine"
+	contextLocalKey = "context"
+)
+
+// ErrLocalHook is returned when a pushed hook has the name of a local hook
+var ErrLocalHook = errors.New("a local hook has the same name")
+
+// nameRegexp matches the valid names of the hooks
+var nameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+var (
+	defaultEngine   *Engine
+	defaultEngineMu sync.Mutex
+)
+
+// Actions are the actions on the containers the hooks can perform
+type Actions interface {
+	RestartContainer(ctx context.Context, id string) error
+	StartContainer(ctx context.Context, id string) error
+	StopContainer(ctx context.Context, id string) error
+}
+
+// hook is a compiled hook
+type hook struct {
+	name string
+	// local is true for the hooks read from the local folder, false for the hooks pushed by the server
+	local   bool
+	globals starlark.StringDict
+}
+
+// Engine loads the hooks and calls them with the events and the snapshots
+type Engine struct {
+	actions Actions
+	// pushedDir is the folder persisting the hooks pushed by the server
+	pushedDir string
+
+	mu    sync.Mutex
+	hooks map[string]*hook
+	// lastActions are the times of the last actions of the hooks, by hook, action and container
+	lastActions map[string]time.Time
+	// failures are the last errors of the hooks, by hook name
+	failures map[string]string
+}
+
+// NewEngine returns a pointer to an Engine running the hooks of localDir, when not empty, and the hooks pushed by the
+// server persisted in pushedDir, acting on the containers with actions
+func NewEngine(localDir, pushedDir string, actions Actions) (*Engine, error) {
+	engine := &Engine{
+		actions:     actions,
+		pushedDir:   pushedDir,
+		hooks:       map[string]*hook{},
+		lastActions: map[string]time.Time{},
+		failures:    map[string]string{},
+	}
+
+	if localDir != "" {
+		if err := engine.loadDir(localDir, true); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.MkdirAll(pushedDir, 0700); err != nil {
+		return nil, err
+	}
+
+	if err := engine.loadDir(pushedDir, false); err != nil {
+		return nil, err
+	}
+
+	return engine, nil
+}
+
+// Enable makes engine the engine receiving the hooks pushed by the server
+func Enable(engine *Engine) {
+	defaultEngineMu.Lock()
+	defer defaultEngineMu.Unlock()
+
+	defaultEngine = engine
+}
+
+// DefaultEngine returns the enabled engine, nil when the hooks are disabled
+func DefaultEngine() *Engine {
+	defaultEngineMu.Lock()
+	defer defaultEngineMu.Unlock()
+
+	return defaultEngine
+}
+
+// Validate returns an error when name is not a valid hook name or source is not a valid hook
+func Validate(name, source string) error {
+	if !nameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid hook name %q", name)
+	}
+
+	_, err := compile(name, source)
+
+	return err
+}
+
+// Names returns the names of the loaded hooks, sorted
+func (engine *Engine) Names() []string {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	names := make([]string, 0, len(engine.hooks))
+	for name := range engine.hooks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Install compiles and persists the hook pushed by the server, it replaces the pushed hook with the same name
+func (engine *Engine) Install(name, source string) error {
+	if !nameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid hook name %q", name)
+	}
+
+	compiled, err := compile(name, source)
+	if err != nil {
+		return err
+	}
+
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	if existing, ok := engine.hooks[name]; ok && existing.local {
+		return ErrLocalHook
+	}
+
+	err = os.WriteFile(filepath.Join(engine.pushedDir, name+fileExtension), []byte(source), 0600)
+	if err != nil {
+		return err
+	}
+
+	engine.hooks[name] = compiled
+	delete(engine.failures, name)
+
+	log.Info().Str("hook", name).Msg("hook installed")
+
+	return nil
+}
+
+// Remove removes the hook pushed by the server with the given name
+func (engine *Engine) Remove(name string) error {
+	if !nameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid hook name %q", name)
+	}
+
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	if existing, ok := engine.hooks[name]; ok && existing.local {
+		return ErrLocalHook
+	}
+
+	err := os.Remove(filepath.Join(engine.pushedDir, name+fileExtension))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	delete(engine.hooks, name)
+	delete(engine.failures, name)
+
+	return nil
+}
+
+// Diagnostics returns the last failures of the hooks
+func (engine *Engine) Diagnostics() []string {
+	if engine == nil {
+		return nil
+	}
+
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	diagnostics := make([]string, 0, len(engine.failures))
+	for name, failure := range engine.failures {
+		diagnostics = append(diagnostics, fmt.Sprintf("the hook %s failed: %s", name, failure))
+	}
+	sort.Strings(diagnostics)
+
+	return diagnostics
+}
+
+// Dispatch calls the function of the hooks defining it with data, encoded in JSON and converted to Starlark values
+func (engine *Engine) Dispatch(ctx context.Context, function string, data interface{}) {
+	engine.mu.Lock()
+	hooks := make([]*hook, 0, len(engine.hooks))
+	for _, h := range engine.hooks {
+		if _, ok := h.globals[function].(*starlark.Function); ok {
+			hooks = append(hooks, h)
+		}
+	}
+	engine.mu.Unlock()
+
+	if len(hooks) == 0 {
+		return
+	}
+
+	arg, err := toStarlark(data)
+	if err != nil {
+		log.Warn().Err(err).Str("function", function).Msg("unable to convert the data of the hooks")
+
+		return
+	}
+
+	// the hooks share the argument, it is frozen so that a hook cannot change what the next ones receive
+	arg.Freeze()
+
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].name < hooks[j].name })
+
+	for _, h := range hooks {
+		err := engine.call(ctx, h, function, arg)
+
+		engine.mu.Lock()
+		if err != nil {
+			engine.failures[h.name] = err.Error()
+		} else {
+			delete(engine.failures, h.name)
+		}
+		engine.mu.Unlock()
+
+		if err != nil {
+			log.Warn().Str("hook", h.name).Str("function", function).Err(err).Msg("hook failure")
+		}
+	}
+}
+
+func (engine *Engine) loadDir(dir string, local bool) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+fileExtension))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), fileExtension)
+		if !nameRegexp.MatchString(name) {
+			return fmt.Errorf("invalid hook name %q", name)
+		}
+
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		compiled, err := compile(name, string(source))
+		if err != nil {
+			return fmt.Errorf("unable to load the hook %s: %w", path, err)
+		}
+
+		if existing, ok := engine.hooks[name]; ok && existing.local {
+			log.Warn().Str("hook", name).Msg("the pushed hook is ignored, a local hook has the same name")
+
+			continue
+		}
+
+		compiled.local = local
+		engine.hooks[name] = compiled
+
+		log.Info().Str("hook", name).Bool("local", local).Msg("hook loaded")
+	}
+
+	return nil
+}
+
+// compile executes the top level statements of the hook, the hook must define at least one of the hook functions
+func compile(name, source string) (*hook, error) {
+	thread := newThread(name)
+
+	globals, err := starlark.ExecFile(thread, name+fileExtension, source, builtins)
+	if err != nil {
+		return nil, err
+	}
+
+	_, onDockerEvent := globals[OnDockerEvent].(*starlark.Function)
+	_, onSnapshot := globals[OnSnapshot].(*starlark.Function)
+	if !onDockerEvent && !onSnapshot {
+		return nil, fmt.Errorf("the hook defines neither %s nor %s", OnDockerEvent, OnSnapshot)
+	}
+
+	return &hook{name: name, globals: globals}, nil
+}
+
+// call calls the function of the hook with arg, the call is cancelled after callTimeout
+func (engine *Engine) call(ctx context.Context, h *hook, function string, arg starlark.Value) error {
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+
+	// the builtins are bound to the engine and to the context of the call through the thread locals
+	thread := newThread(h.name)
+	thread.SetLocal(engineLocalKey, engine)
+	thread.SetLocal(contextLocalKey, ctx)
+
+	stop := context.AfterFunc(ctx, func() {
+		thread.Cancel(ctx.Err().Error())
+	})
+	defer stop()
+
+	_, err := starlark.Call(thread, h.globals[function], starlark.Tuple{arg}, nil)
+
+	return err
+}
+
+func newThread(name string) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: name,
+		Print: func(thread *starlark.Thread, msg string) {
+			log.Info().Str("hook", thread.Name).Msg(msg)
+		},
+		Load: func(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+			return nil, errors.New("the hooks cannot load modules")
+		},
+	}
+	thread.SetMaxExecutionSteps(maxExecutionSteps)
+	thread.SetLocal(hookLocalKey, name)
+
+	return thread
+}
+
+// builtins are the functions of the agent available to the hooks
+var builtins = starlark.StringDict{
+	"restart_container": starlark.NewBuiltin("restart_container", containerAction("restart")),
+	"start_container":   starlark.NewBuiltin("start_container", containerAction("start")),
+	"stop_container":    starlark.NewBuiltin("stop_container", containerAction("stop")),
+	"match":             starlark.NewBuiltin("match", match),
+	"alert":             starlark.NewBuiltin("alert", alert),
+}
+
+// containerAction returns the builtin performing action on the container whose identifier or name is its argument
+func containerAction(action string) func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error) {
+	return func(thread *starlark.Thread, builtin *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var id string
+		if err := starlark.UnpackPositionalArgs(builtin.Name(), args, kwargs, 1, &id); err != nil {
+			return nil, err
+		}
+
+		engine, ok := thread.Local(engineLocalKey).(*Engine)
+		if !ok {
+			return nil, fmt.Errorf("%s cannot be called while the hook is loaded", builtin.Name())
+		}
+
+		ctx, _ := thread.Local(contextLocalKey).(context.Context)
+		name, _ := thread.Local(hookLocalKey).(string)
+
+		if !engine.reserveAction(name, action, id) {
+			log.Debug().Str("hook", name).Str("action", action).Str("container", id).Msg("the action was performed less than a minute ago, skipping it")
+
+			return starlark.False, nil
+		}
+
+		var err error
+		switch action {
+		case "restart":
+			err = engine.actions.RestartContainer(ctx, id)
+		case "start":
+			err = engine.actions.StartContainer(ctx, id)
+		case "stop":
+			err = engine.actions.StopContainer(ctx, id)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s(%q): %w", builtin.Name(), id, err)
+		}
+
+		log.Info().Str("hook", name).Str("action", action).Str("container", id).Msg("container action performed by a hook")
+
+		return starlark.True, nil
+	}
+}
+
+// reserveAction returns true and records the action when the hook did not perform it on the container during the
+// last actionCooldown
+func (engine *Engine) reserveAction(name, action, id string) bool {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	key := name + "/" + action + "/" + id
+	if last, ok := engine.lastActions[key]; ok && time.Since(last) < actionCooldown {
+		return false
+	}
+
+	for k, last := range engine.lastActions {
+		if time.Since(last) >= actionCooldown {
+			delete(engine.lastActions, k)
+		}
+	}
+
+	engine.lastActions[key] = time.Now()
+
+	return true
+}
+
+func match(thread *starlark.Thread, builtin *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pattern, value string
+	if err := starlark.UnpackPositionalArgs(builtin.Name(), args, kwargs, 2, &pattern, &value); err != nil {
+		return nil, err
+	}
+
+	matched, err := regexp.MatchString(pattern, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return starlark.Bool(matched), nil
+}
+
+func alert(thread *starlark.Thread, builtin *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var message string
+	if err := starlark.UnpackPositionalArgs(builtin.Name(), args, kwargs, 1, &message); err != nil {
+		return nil, err
+	}
+
+	log.Warn().Str("hook", thread.Name).Msg(message)
+
+	message = fmt.Sprintf("hook %s: %s", thread.Name, message)
+	eventbus.Publish(eventbus.TypeAlert, message)
+	notify.Notify(notify.SourceHook, message)
+
+	return starlark.None, nil
+}
+
+// toStarlark returns data encoded in JSON as Starlark values: the objects are dicts, the arrays lists
+func toStarlark(data interface{}) (starlark.Value, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, err
+	}
+
+	return convert(decoded)
+}
+
+func convert(value interface{}) (starlark.Value, error) {
+	switch value := value.(type) {
+	case nil:
+		return starlark.None, nil
+	case bool:
+		return starlark.Bool(value), nil
+	case string:
+		return starlark.String(value), nil
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return starlark.MakeInt64(i), nil
+		}
+
+		f, err := value.Float64()
+		if err != nil {
+			return nil, err
+		}
+
+		return starlark.Float(f), nil
+	case []interface{}:
+		elems := make([]starlark.Value, 0, len(value))
+		for _, elem := range value {
+			converted, err := convert(elem)
+			if err != nil {
+				return nil, err
+			}
+
+			elems = append(elems, converted)
+		}
+
+		return starlark.NewList(elems), nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		dict := starlark.NewDict(len(value))
+		for _, key := range keys {
+			converted, err := convert(value[key])
+			if err != nil {
+				return nil, err
+			}
+
+			if err := dict.SetKey(starlark.String(key), converted); err != nil {
+				return nil, err
+			}
+		}
+
+		return dict, nil
+	}
+
+	return nil, fmt.Errorf("unsupported value %T", value)
+}
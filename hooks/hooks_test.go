@@ -0,0 +1,136 @@
+package hooks
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type fakeActions struct {
+	restarted []string
+}
+
+func (actions *fakeActions) RestartContainer(ctx context.Context, id string) error {
+	actions.restarted = append(actions.restarted, id)
+
+	return nil
+}
+
+func (actions *fakeActions) StartContainer(ctx context.Context, id string) error {
+	return nil
+}
+
+func (actions *fakeActions) StopContainer(ctx context.Context, id string) error {
+	return nil
+}
+
+const restartUnhealthy = `
+def on_docker_event(event):
+    name = event["Actor"]["Attributes"].get("name", "")
+    if event["Action"] == "health_status: unhealthy" and match("^web-", name):
+        restart_container(event["Actor"]["ID"])
+`
+
+func unhealthyEvent(id, name string) map[string]interface{} {
+	return map[string]interface{}{
+		"Type":   "container",
+		"Action": "health_status: unhealthy",
+		"Actor":  map[string]interface{}{"ID": id, "Attributes": map[string]string{"name": name}},
+	}
+}
+
+func TestEngine_Dispatch(t *testing.T) {
+	localDir := t.TempDir()
+	os.WriteFile(filepath.Join(localDir, "restart.star"), []byte(restartUnhealthy), 0600)
+
+	actions := &fakeActions{}
+
+	engine, err := NewEngine(localDir, t.TempDir(), actions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine.Dispatch(context.Background(), OnDockerEvent, unhealthyEvent("1", "web-1"))
+	engine.Dispatch(context.Background(), OnDockerEvent, unhealthyEvent("2", "db-1"))
+	// the container was restarted less than a minute ago
+	engine.Dispatch(context.Background(), OnDockerEvent, unhealthyEvent("1", "web-1"))
+
+	if !reflect.DeepEqual(actions.restarted, []string{"1"}) {
+		t.Errorf("expected web-1 to be restarted once, got %v", actions.restarted)
+	}
+
+	if diagnostics := engine.Diagnostics(); len(diagnostics) != 0 {
+		t.Errorf("expected no failures, got %v", diagnostics)
+	}
+}
+
+func TestEngine_DispatchFailure(t *testing.T) {
+	engine, err := NewEngine("", t.TempDir(), &fakeActions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := "def on_snapshot(snapshot):\n    snapshot[\"Containers\"].append(1)\n"
+	if err := engine.Install("mutate", source); err != nil {
+		t.Fatal(err)
+	}
+
+	engine.Dispatch(context.Background(), OnSnapshot, map[string]interface{}{"Containers": []int{}})
+
+	diagnostics := engine.Diagnostics()
+	if len(diagnostics) != 1 || !strings.Contains(diagnostics[0], "frozen") {
+		t.Errorf("expected the hook not to be able to modify the snapshot, got %v", diagnostics)
+	}
+
+	source = "def on_snapshot(snapshot):\n    while True:\n        pass\n"
+	if err := Validate("loop", source); err == nil || !strings.Contains(err.Error(), "while") {
+		t.Errorf("expected the loops to be rejected, got %v", err)
+	}
+}
+
+func TestEngine_InstallAndRemove(t *testing.T) {
+	localDir := t.TempDir()
+	pushedDir := t.TempDir()
+	os.WriteFile(filepath.Join(localDir, "restart.star"), []byte(restartUnhealthy), 0600)
+
+	engine, err := NewEngine(localDir, pushedDir, &fakeActions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := engine.Install("restart", restartUnhealthy); err != ErrLocalHook {
+		t.Errorf("expected a pushed hook not to replace a local hook, got %v", err)
+	}
+
+	if err := engine.Install("../escape", restartUnhealthy); err == nil {
+		t.Error("expected an invalid name to be rejected")
+	}
+
+	if err := engine.Install("noop", "x = 1\n"); err == nil {
+		t.Error("expected a hook without hook functions to be rejected")
+	}
+
+	if err := engine.Install("log", "def on_snapshot(snapshot):\n    print(len(snapshot))\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewEngine(localDir, pushedDir, &fakeActions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := reloaded.Names(); !reflect.DeepEqual(names, []string{"log", "restart"}) {
+		t.Errorf("expected the pushed hook to be persisted, got %v", names)
+	}
+
+	if err := reloaded.Remove("log"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(pushedDir, "log.star")); !os.IsNotExist(err) {
+		t.Errorf("expected the pushed hook to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package hooks
+
+import (
+	"context"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/kubernetes"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/client"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	dockerEventsRetryInterval = 10 * time.Second
+	// eventQueueSize is the number of Docker events waiting to be processed by the hooks from which the new events are
+	// dropped
+	eventQueueSize = 256
+)
+
+// Run calls the hooks with the Docker events and with a snapshot of the environment at each interval, until ctx is
+// done
+func (engine *Engine) Run(ctx context.Context, containerPlatform agent.ContainerPlatform, interval time.Duration) {
+	if containerPlatform == agent.PlatformDocker || containerPlatform == agent.PlatformPodman {
+		go engine.watchDockerEvents(ctx)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if !engine.defines(OnSnapshot) {
+			continue
+		}
+
+		var snapshot interface{}
+		var err error
+
+		switch containerPlatform {
+		case agent.PlatformDocker, agent.PlatformPodman:
+			snapshot, err = docker.CreateSnapshot(ctx)
+		case agent.PlatformKubernetes:
+			snapshot, err = kubernetes.CreateSnapshot()
+		default:
+			continue
+		}
+
+		if err != nil {
+			log.Warn().Err(err).Msg("unable to create the snapshot of the hooks")
+
+			continue
+		}
+
+		engine.Dispatch(ctx, OnSnapshot, snapshot)
+	}
+}
+
+// watchDockerEvents calls the hooks with the Docker events, the events are processed in the background so that the
+// actions of the hooks never block the stream. The stream is opened again when it fails.
+func (engine *Engine) watchDockerEvents(ctx context.Context) {
+	queue := make(chan events.Message, eventQueueSize)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case message := <-queue:
+				engine.Dispatch(ctx, OnDockerEvent, message)
+			}
+		}
+	}()
+
+	for {
+		err := docker.WatchEvents(ctx, func(message events.Message) {
+			if !engine.defines(OnDockerEvent) {
+				return
+			}
+
+			select {
+			case queue <- message:
+			default:
+				log.Warn().Str("action", string(message.Action)).Msg("the hooks cannot keep up with the Docker events, dropping the event")
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Debug().Err(err).Msg("the Docker events stream of the hooks was interrupted")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(dockerEventsRetryInterval):
+		}
+	}
+}
+
+// defines returns true when a hook defines function
+func (engine *Engine) defines(function string) bool {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	for _, h := range engine.hooks {
+		if _, ok := h.globals[function]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DockerActions performs the actions of the hooks with the Docker API
+type DockerActions struct{}
+
+func (DockerActions) RestartContainer(ctx context.Context, id string) error {
+	return withClient(func(cli *client.Client) error {
+		return cli.ContainerRestart(ctx, id, container.StopOptions{})
+	})
+}
+
+func (DockerActions) StartContainer(ctx context.Context, id string) error {
+	return withClient(func(cli *client.Client) error {
+		return cli.ContainerStart(ctx, id, types.ContainerStartOptions{})
+	})
+}
+
+func (DockerActions) StopContainer(ctx context.Context, id string) error {
+	return withClient(func(cli *client.Client) error {
+		return cli.ContainerStop(ctx, id, container.StopOptions{})
+	})
+}
+
+func withClient(callback func(cli *client.Client) error) error {
+	cli, err := docker.NewClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	return callback(cli)
+}
@@ -0,0 +1,273 @@
+package hostaction
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/kubernetes"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Host actions
+const (
+	// ActionReboot reboots the host
+	ActionReboot = "reboot"
+	// ActionDockerRestart restarts the Docker daemon
+	ActionDockerRestart = "docker_restart"
+	// ActionKubernetesRestart restarts the service of the Kubernetes distribution installed on the host
+	ActionKubernetesRestart = "kubernetes_restart"
+)
+
+// Statuses of a host action
+const (
+	// StatusExecuting is the status of an action that was triggered but whose outcome is not known yet
+	StatusExecuting = "executing"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// reportRetention is the duration during which the outcome of the last action is reported in the diagnostics
+const reportRetention = 24 * time.Hour
+
+// bootIDPath exposes the identifier of the current boot of the kernel shared by the host and the containers
+var bootIDPath = "/proc/sys/kernel/random/boot_id"
+
+// ErrDeploymentInProgress is returned when an action is requested while a deployment is in progress
+var ErrDeploymentInProgress = errors.New("a deployment is in progress")
+
+var commands = map[string][]string{
+	ActionReboot:        {"reboot"},
+	ActionDockerRestart: {"systemctl", "restart", "docker"},
+}
+
+var (
+	lastRecord   *Record
+	lastRecordMu sync.Mutex
+)
+
+// Record represents the last host action executed by the agent. It is persisted before the action is executed
+// so that its outcome can be determined once the agent is started again.
+type Record struct {
+	Action      string     `json:"Action"`
+	Status      string     `json:"Status"`
+	Error       string     `json:"Error,omitempty"`
+	BootID      string     `json:"BootID"`
+	RequestedAt time.Time  `json:"RequestedAt"`
+	ExecutedAt  time.Time  `json:"ExecutedAt"`
+	CompletedAt *time.Time `json:"CompletedAt,omitempty"`
+}
+
+// Orchestrator executes the host actions once no deployment is in progress
+type Orchestrator struct {
+	statePath          string
+	image              string
+	deploymentCheckers []func() bool
+	mu                 sync.Mutex
+}
+
+// IsValidAction returns true when action is a supported host action
+func IsValidAction(action string) bool {
+	_, ok := commands[action]
+
+	return ok || action == ActionKubernetesRestart
+}
+
+// command returns the host command of action, the service restarted by ActionKubernetesRestart depends on the
+// Kubernetes distribution installed on the host
+func command(action string) ([]string, error) {
+	if action == ActionKubernetesRestart {
+		distribution := kubernetes.DetectHostDistribution()
+		if distribution == nil {
+			return nil, errors.New("no Kubernetes distribution was found on the host")
+		}
+
+		return distribution.RestartCommand, nil
+	}
+
+	cmd, ok := commands[action]
+	if !ok {
+		return nil, fmt.Errorf("unsupported host action: %s", action)
+	}
+
+	return cmd, nil
+}
+
+// NewOrchestrator returns a pointer to an Orchestrator persisting its record in statePath and running the host
+// commands with image. The deployment checkers report whether a deployment is in progress.
+func NewOrchestrator(statePath, image string, deploymentCheckers ...func() bool) *Orchestrator {
+	return &Orchestrator{
+		statePath:          statePath,
+		image:              image,
+		deploymentCheckers: deploymentCheckers,
+	}
+}
+
+// CheckPreconditions returns ErrDeploymentInProgress when one of the deployment checkers reports a deployment
+func (orchestrator *Orchestrator) CheckPreconditions() error {
+	for _, inProgress := range orchestrator.deploymentCheckers {
+		if inProgress() {
+			return ErrDeploymentInProgress
+		}
+	}
+
+	return nil
+}
+
+// Execute checks the preconditions again and triggers action on the host. The action is recorded before being
+// triggered, its outcome is reported by Reconcile once the agent is started again.
+func (orchestrator *Orchestrator) Execute(ctx context.Context, action string, requestedAt time.Time) error {
+	cmd, err := command(action)
+	if err != nil {
+		return err
+	}
+
+	orchestrator.mu.Lock()
+	defer orchestrator.mu.Unlock()
+
+	if err := orchestrator.CheckPreconditions(); err != nil {
+		return err
+	}
+
+	record := &Record{
+		Action:      action,
+		Status:      StatusExecuting,
+		BootID:      readBootID(),
+		RequestedAt: requestedAt,
+		ExecutedAt:  time.Now(),
+	}
+
+	if err := saveRecord(orchestrator.statePath, record); err != nil {
+		return err
+	}
+
+	log.Info().Str("action", action).Msg("executing host action")
+
+	err = docker.RunHostCommand(ctx, orchestrator.image, cmd)
+
+	// the agent usually outlives a restart of Kubernetes, its outcome is known once the command returns
+	if err != nil || action == ActionKubernetesRestart {
+		now := time.Now()
+		record.Status = StatusSucceeded
+		record.CompletedAt = &now
+
+		if err != nil {
+			record.Status = StatusFailed
+			record.Error = err.Error()
+		}
+
+		if err := saveRecord(orchestrator.statePath, record); err != nil {
+			log.Warn().Err(err).Msg("unable to persist the host action record")
+		}
+
+		setLastRecord(record)
+	}
+
+	return err
+}
+
+// Reconcile determines the outcome of the action recorded in statePath when the agent was stopped while it was
+// executing. A reboot succeeded when the boot identifier changed, a Docker daemon restart succeeded when the agent
+// was restarted with it. The outcome is persisted, logged and reported by Diagnostics.
+func Reconcile(statePath string) (*Record, error) {
+	content, err := os.ReadFile(statePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	record := &Record{}
+	if err := json.Unmarshal(content, record); err != nil {
+		return nil, err
+	}
+
+	if record.Status == StatusExecuting {
+		now := time.Now()
+		record.CompletedAt = &now
+		record.Status = StatusSucceeded
+
+		if record.Action == ActionReboot && record.BootID != "" && record.BootID == readBootID() {
+			record.Status = StatusFailed
+			record.Error = "the host was not rebooted"
+		}
+
+		if err := saveRecord(statePath, record); err != nil {
+			return nil, err
+		}
+
+		log.Info().
+			Str("action", record.Action).
+			Str("status", record.Status).
+			Str("error", record.Error).
+			Time("executed_at", record.ExecutedAt).
+			Msg("host action completed")
+	}
+
+	setLastRecord(record)
+
+	return record, nil
+}
+
+// LastRecord returns a copy of the last host action known by the agent, or nil
+func LastRecord() *Record {
+	lastRecordMu.Lock()
+	defer lastRecordMu.Unlock()
+
+	if lastRecord == nil {
+		return nil
+	}
+
+	record := *lastRecord
+
+	return &record
+}
+
+// Diagnostics returns a diagnostic message describing the outcome of the last host action, during one day
+func Diagnostics() []string {
+	record := LastRecord()
+	if record == nil || record.CompletedAt == nil || time.Since(*record.CompletedAt) > reportRetention {
+		return nil
+	}
+
+	message := fmt.Sprintf("host action %s executed at %s %s", record.Action, record.ExecutedAt.Format(time.RFC3339), record.Status)
+	if record.Error != "" {
+		message += ": " + record.Error
+	}
+
+	return []string{message}
+}
+
+func setLastRecord(record *Record) {
+	lastRecordMu.Lock()
+	defer lastRecordMu.Unlock()
+
+	lastRecord = record
+}
+
+func saveRecord(statePath string, record *Record) error {
+	content, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(statePath, content, 0600)
+}
+
+func readBootID() string {
+	content, err := os.ReadFile(bootIDPath)
+	if err != nil {
+		log.Debug().Err(err).Msg("unable to read the boot identifier")
+
+		return ""
+	}
+
+	return strings.TrimSpace(string(content))
+}
@@ -0,0 +1,61 @@
+package hostaction
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReconcile(t *testing.T) {
+	dir := t.TempDir()
+
+	bootIDPath = filepath.Join(dir, "boot_id")
+	t.Cleanup(func() { bootIDPath = "/proc/sys/kernel/random/boot_id" })
+
+	if err := os.WriteFile(bootIDPath, []byte("current\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		record         Record
+		expectedStatus string
+	}{
+		{"rebooted", Record{Action: ActionReboot, Status: StatusExecuting, BootID: "previous"}, StatusSucceeded},
+		{"not rebooted", Record{Action: ActionReboot, Status: StatusExecuting, BootID: "current"}, StatusFailed},
+		{"docker restarted", Record{Action: ActionDockerRestart, Status: StatusExecuting, BootID: "current"}, StatusSucceeded},
+		{"already reconciled", Record{Action: ActionReboot, Status: StatusFailed, BootID: "current"}, StatusFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statePath := filepath.Join(dir, "state.json")
+			tt.record.ExecutedAt = time.Now()
+
+			if err := saveRecord(statePath, &tt.record); err != nil {
+				t.Fatal(err)
+			}
+
+			record, err := Reconcile(statePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if record.Status != tt.expectedStatus {
+				t.Fatalf("expected status %s, got %s", tt.expectedStatus, record.Status)
+			}
+
+			if tt.record.Status == StatusExecuting && len(Diagnostics()) != 1 {
+				t.Fatalf("expected the outcome to be reported, got %v", Diagnostics())
+			}
+		})
+	}
+}
+
+func TestReconcile_NoRecord(t *testing.T) {
+	record, err := Reconcile(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil || record != nil {
+		t.Fatalf("expected no record, got %v (%v)", record, err)
+	}
+}
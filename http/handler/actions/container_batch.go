@@ -0,0 +1,62 @@
+package actions
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/portainer/agent/docker"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// maxBatchConcurrency is the upper bound of the concurrency that can be requested by a client
+const maxBatchConcurrency = 20
+
+type containerBatchPayload struct {
+	// Action is one of start, stop, restart or remove
+	Action string
+	// IDs is the list of container identifiers the action is applied to
+	IDs []string
+	// Force is used with the remove action to remove running containers
+	Force bool
+	// Concurrency is the maximum number of containers processed in parallel
+	Concurrency int
+}
+
+func (payload *containerBatchPayload) Validate(r *http.Request) error {
+	if !docker.IsValidBatchAction(payload.Action) {
+		return errors.New("Invalid action, expected one of start, stop, restart or remove")
+	}
+
+	if len(payload.IDs) == 0 {
+		return errors.New("Missing container identifiers")
+	}
+
+	if len(payload.IDs) > docker.MaxBatchSize {
+		return fmt.Errorf("Too many container identifiers, the maximum is %d", docker.MaxBatchSize)
+	}
+
+	if payload.Concurrency < 0 || payload.Concurrency > maxBatchConcurrency {
+		return errors.New("Invalid concurrency")
+	}
+
+	return nil
+}
+
+// POST request on /actions/containers/batch
+func (handler *Handler) containerBatch(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	var payload containerBatchPayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	results, err := docker.ContainerBatch(r.Context(), payload.Action, payload.IDs, payload.Force, payload.Concurrency)
+	if err != nil {
+		return httperror.InternalServerError("Unable to execute the batch operation", err)
+	}
+
+	return response.JSON(rw, results)
+}
@@ -0,0 +1,132 @@
+package actions
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/portainer/agent/docker"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultCaptureDuration = 30
+	maxCaptureDuration     = 300
+	defaultCapturePackets  = 1000
+	maxCapturePackets      = 100000
+	maxCaptureFilterLength = 256
+)
+
+var captureFilterRegexp = regexp.MustCompile(`^[a-zA-Z0-9 .:/\[\]()!<>=&|-]*$`)
+
+// flushWriter flushes the response after each write so that the capture is streamed to the client
+type flushWriter struct {
+	rw      http.ResponseWriter
+	flusher http.Flusher
+	// written is true once the response was sent to the client
+	written bool
+}
+
+func (w *flushWriter) Write(p []byte) (int, error) {
+	w.written = true
+
+	n, err := w.rw.Write(p)
+	if w.flusher != nil {
+		w.flusher.Flush()
+	}
+
+	return n, err
+}
+
+// GET request on /actions/containers/{id}/capture?duration=:seconds&packets=:count&filter=:expression
+func (handler *Handler) containerCapture(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	containerID, err := request.RetrieveRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid container identifier route variable", err)
+	}
+
+	duration, err := request.RetrieveNumericQueryParameter(r, "duration", true)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: duration", err)
+	}
+	if duration == 0 {
+		duration = defaultCaptureDuration
+	}
+	if duration < 0 || duration > maxCaptureDuration {
+		return httperror.BadRequest("Invalid query parameter: duration", errors.New("duration must be between 1 and 300 seconds"))
+	}
+
+	packets, err := request.RetrieveNumericQueryParameter(r, "packets", true)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: packets", err)
+	}
+	if packets == 0 {
+		packets = defaultCapturePackets
+	}
+	if packets < 0 || packets > maxCapturePackets {
+		return httperror.BadRequest("Invalid query parameter: packets", errors.New("packets must be between 1 and 100000"))
+	}
+
+	filter, _ := request.RetrieveQueryParameter(r, "filter", true)
+	filterWords, err := parseCaptureFilter(filter)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: filter", err)
+	}
+
+	return streamCapture(rw, func(w io.Writer) error {
+		return docker.CaptureTraffic(r.Context(), containerID, docker.CaptureOptions{
+			Image:      handler.captureImage,
+			Duration:   time.Duration(duration) * time.Second,
+			MaxPackets: packets,
+			Filter:     filterWords,
+		}, w)
+	})
+}
+
+// parseCaptureFilter returns the words of a capture filter expression, the expression is passed to tcpdump
+func parseCaptureFilter(filter string) ([]string, error) {
+	if len(filter) > maxCaptureFilterLength || !captureFilterRegexp.MatchString(filter) {
+		return nil, errors.New("invalid capture filter")
+	}
+
+	filterWords := strings.Fields(filter)
+	for _, word := range filterWords {
+		// Words starting with a dash would be interpreted as tcpdump options
+		if strings.HasPrefix(word, "-") {
+			return nil, errors.New("capture filter words cannot start with a dash")
+		}
+	}
+
+	return filterWords, nil
+}
+
+// streamCapture streams the capture written by capture to the client. The error of a capture that already sent
+// packets cannot be reported in the response anymore, it is logged and the capture ends with the packets sent so far.
+func streamCapture(rw http.ResponseWriter, capture func(w io.Writer) error) *httperror.HandlerError {
+	rw.Header().Set("Content-Type", "application/vnd.tcpdump.pcap")
+	rw.Header().Set("Content-Disposition", "attachment; filename=capture.pcap")
+
+	flusher, _ := rw.(http.Flusher)
+	w := &flushWriter{rw: rw, flusher: flusher}
+
+	err := capture(w)
+	if err != nil && w.written {
+		log.Warn().Err(err).Msg("the container traffic capture ended with an error")
+
+		return nil
+	}
+
+	if err != nil {
+		// the capture headers do not describe the error
+		rw.Header().Del("Content-Disposition")
+
+		return httperror.InternalServerError("Unable to capture the container traffic", err)
+	}
+
+	return nil
+}
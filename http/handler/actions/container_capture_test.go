@@ -0,0 +1,97 @@
+package actions
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCaptureFilter(t *testing.T) {
+	tests := []struct {
+		filter   string
+		expected []string
+		valid    bool
+	}{
+		{filter: "", expected: []string{}, valid: true},
+		{filter: "tcp port 80", expected: []string{"tcp", "port", "80"}, valid: true},
+		{filter: "host 10.0.0.1 and not (udp or icmp)", expected: []string{"host", "10.0.0.1", "and", "not", "(udp", "or", "icmp)"}, valid: true},
+		{filter: "net 192.168.0.0/16 && port != 22", expected: []string{"net", "192.168.0.0/16", "&&", "port", "!=", "22"}, valid: true},
+		{filter: "ip6 host fe80::1", expected: []string{"ip6", "host", "fe80::1"}, valid: true},
+		{filter: "tcp[13] & 2 != 0", expected: []string{"tcp[13]", "&", "2", "!=", "0"}, valid: true},
+		{filter: "port 1-1024", expected: []string{"port", "1-1024"}, valid: true},
+		{filter: "-w /tmp/out"},
+		{filter: "port 80 -Z root"},
+		{filter: "port 80; reboot"},
+		{filter: "port `id`"},
+		{filter: "port $(id)"},
+		{filter: "host 'a'"},
+		{filter: "port 80\n-w /tmp/out"},
+		{filter: "port 80\t-w"},
+		{filter: strings.Repeat("a", maxCaptureFilterLength+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			words, err := parseCaptureFilter(tt.filter)
+			if !tt.valid {
+				if err == nil {
+					t.Errorf("expected the filter to be rejected, got %q", words)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(words, tt.expected) {
+				t.Errorf("expected %q, got %q", tt.expected, words)
+			}
+		})
+	}
+}
+
+func TestStreamCapture(t *testing.T) {
+	t.Run("capture that fails before sending packets", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+
+		handlerErr := streamCapture(rec, func(w io.Writer) error {
+			return errors.New("no such container")
+		})
+		if handlerErr == nil || handlerErr.StatusCode != http.StatusInternalServerError {
+			t.Fatalf("expected the error to be reported, got %v", handlerErr)
+		}
+
+		if rec.Header().Get("Content-Disposition") != "" {
+			t.Error("expected the error not to be sent as an attachment")
+		}
+	})
+
+	t.Run("capture that fails once the packets are sent", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+
+		handlerErr := streamCapture(rec, func(w io.Writer) error {
+			if _, err := w.Write([]byte("pcap")); err != nil {
+				return err
+			}
+
+			return errors.New("the capture container exited")
+		})
+		if handlerErr != nil {
+			t.Fatalf("expected the capture to end with the packets sent, got %v", handlerErr)
+		}
+
+		if rec.Code != http.StatusOK || rec.Body.String() != "pcap" || !rec.Flushed {
+			t.Errorf("expected the packets to be streamed, got %d %q", rec.Code, rec.Body.String())
+		}
+
+		if rec.Header().Get("Content-Type") != "application/vnd.tcpdump.pcap" {
+			t.Errorf("unexpected content type %s", rec.Header().Get("Content-Type"))
+		}
+	})
+}
@@ -0,0 +1,49 @@
+package actions
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/portainer/agent/docker"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type containerLogRemediationPayload struct {
+	// IDs is the list of containers to remediate, all the containers with unbounded logs when empty
+	IDs []string
+	// MinSize is the size in bytes of the log files from which they are truncated
+	MinSize int64
+	// ApplyLogOptions recreates the containers with unbounded logs with a max-size of 10m and a max-file of 3
+	ApplyLogOptions bool
+}
+
+func (payload *containerLogRemediationPayload) Validate(r *http.Request) error {
+	if payload.MinSize < 0 {
+		return errors.New("Invalid minimum size")
+	}
+
+	return nil
+}
+
+// POST request on /actions/containers/logs/remediate
+// Reclaims the disk space used by the json-file logs of the containers
+func (handler *Handler) containerLogRemediation(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	var payload containerLogRemediationPayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	results, err := docker.RemediateLogs(r.Context(), docker.LogRemediationOptions{
+		ContainerIDs:    payload.IDs,
+		MinSize:         payload.MinSize,
+		ApplyLogOptions: payload.ApplyLogOptions,
+	})
+	if err != nil {
+		return httperror.InternalServerError("Unable to remediate the container logs", err)
+	}
+
+	return response.JSON(rw, results)
+}
@@ -0,0 +1,57 @@
+package actions
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/portainer/agent/docker"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type containerNetworkDebugPayload struct {
+	// Checks are the DNS lookups and HTTP probes executed in order from the network namespace of the container
+	Checks []docker.NetworkCheck
+}
+
+func (payload *containerNetworkDebugPayload) Validate(r *http.Request) error {
+	if len(payload.Checks) == 0 {
+		return errors.New("At least one check is required")
+	}
+
+	if len(payload.Checks) > docker.MaxNetworkChecks {
+		return fmt.Errorf("At most %d checks can be executed at once", docker.MaxNetworkChecks)
+	}
+
+	for i := range payload.Checks {
+		if err := payload.Checks[i].Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// POST request on /actions/containers/{id}/netdebug
+// Executes DNS lookups and HTTP probes from the network namespace of the container, with its DNS configuration
+func (handler *Handler) containerNetworkDebug(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	containerID, err := request.RetrieveRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid container identifier route variable", err)
+	}
+
+	var payload containerNetworkDebugPayload
+	err = request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	results, err := docker.DebugContainerNetwork(r.Context(), containerID, handler.captureImage, payload.Checks)
+	if err != nil {
+		return httperror.InternalServerError("Unable to debug the network of the container", err)
+	}
+
+	return response.JSON(rw, results)
+}
@@ -0,0 +1,65 @@
+package actions
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/portainer/agent/docker"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type (
+	containerRecreatePayload struct {
+		Image     string
+		PullImage bool
+		Env       []string
+		Mounts    []mount.Mount
+	}
+
+	containerRecreateResponse struct {
+		ID string `json:"Id"`
+	}
+)
+
+func (payload *containerRecreatePayload) Validate(r *http.Request) error {
+	if payload.PullImage && payload.Image == "" {
+		return errors.New("An image is required when PullImage is set")
+	}
+
+	for _, m := range payload.Mounts {
+		if m.Target == "" {
+			return errors.New("Missing mount target")
+		}
+	}
+
+	return nil
+}
+
+// POST request on /actions/containers/{id}/recreate
+func (handler *Handler) containerRecreate(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	containerID, err := request.RetrieveRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid container identifier route variable", err)
+	}
+
+	var payload containerRecreatePayload
+	err = request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	newContainerID, err := docker.ContainerRecreate(r.Context(), containerID, docker.RecreateChanges{
+		Image:     payload.Image,
+		PullImage: payload.PullImage,
+		Env:       payload.Env,
+		Mounts:    payload.Mounts,
+	})
+	if err != nil {
+		return httperror.InternalServerError("Unable to recreate the container", err)
+	}
+
+	return response.JSON(rw, &containerRecreateResponse{ID: newContainerID})
+}
@@ -0,0 +1,59 @@
+package actions
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/http/proxy"
+	"github.com/portainer/agent/http/security"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+)
+
+// Handler represents an HTTP API Handler for multi-step container, image and network actions executed on the agent side
+type Handler struct {
+	*mux.Router
+	captureImage         string
+	scanImage            string
+	clusterService       agent.ClusterService
+	runtimeConfiguration *agent.RuntimeConfiguration
+	useTLS               bool
+	client               *http.Client
+}
+
+// NewHandler returns a new instance of Handler
+func NewHandler(agentProxy *proxy.AgentProxy, notaryService *security.NotaryService, policyService *security.PolicyService, captureImage, scanImage string, clusterService agent.ClusterService, config *agent.RuntimeConfiguration, useTLS bool) *Handler {
+	h := &Handler{
+		Router:               mux.NewRouter(),
+		captureImage:         captureImage,
+		scanImage:            scanImage,
+		clusterService:       clusterService,
+		runtimeConfiguration: config,
+		useTLS:               useTLS,
+		client:               proxy.NewMemberClient(),
+	}
+
+	h.Handle("/actions/containers/batch",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.containerBatch)))).Methods(http.MethodPost)
+	h.Handle("/actions/containers/logs/remediate",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(policyService.RequireOperation(agent.OperationLogRemediation, httperror.LoggerHandler(h.containerLogRemediation))))).Methods(http.MethodPost)
+	h.Handle("/actions/containers/{id}/capture",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(policyService.RequireOperation(agent.OperationTrafficCapture, httperror.LoggerHandler(h.containerCapture))))).Methods(http.MethodGet)
+	h.Handle("/actions/containers/{id}/netdebug",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(policyService.RequireOperation(agent.OperationNetworkDebug, httperror.LoggerHandler(h.containerNetworkDebug))))).Methods(http.MethodPost)
+	h.Handle("/actions/containers/{id}/recreate",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.containerRecreate)))).Methods(http.MethodPost)
+	h.Handle("/actions/images/distribute",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.imageDistribute)))).Methods(http.MethodPost)
+	h.Handle("/actions/images/scan",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(policyService.RequireOperation(agent.OperationImageScan, httperror.LoggerHandler(h.imageScan))))).Methods(http.MethodPost)
+	h.Handle("/actions/images/sbom",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(policyService.RequireOperation(agent.OperationSBOM, httperror.LoggerHandler(h.imageSBOM))))).Methods(http.MethodPost)
+	h.Handle("/actions/networks",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.networkCreate)))).Methods(http.MethodPost)
+	h.Handle("/actions/networks/validate",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.networkValidate)))).Methods(http.MethodPost)
+
+	return h
+}
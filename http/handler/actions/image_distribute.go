@@ -0,0 +1,215 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/http/proxy"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// Image distribution statuses
+const (
+	imageDistributionLoaded  = "loaded"
+	imageDistributionPresent = "present"
+	imageDistributionFailed  = "failed"
+)
+
+type imageDistributePayload struct {
+	// Image is the name or identifier of the image to distribute
+	Image string
+	// Source is the name of the node holding the image, the node of the agent receiving the request is used when empty
+	Source string
+	// Targets are the names of the nodes the image is distributed to, all the other nodes of the cluster are used
+	// when empty
+	Targets []string
+	// Force loads the image on the targets already holding it
+	Force bool
+}
+
+func (payload *imageDistributePayload) Validate(r *http.Request) error {
+	if payload.Image == "" {
+		return errors.New("Missing image")
+	}
+
+	return nil
+}
+
+type imageDistributionResult struct {
+	Node   string `json:"Node"`
+	Status string `json:"Status"`
+	Error  string `json:"Error,omitempty"`
+}
+
+// POST request on /actions/images/distribute
+// Exports the image from the source node and loads it on the target nodes missing it, so that the Swarm services
+// using locally built images can be scheduled on any node. The targets are processed one after the other to
+// limit the load of the source node.
+func (handler *Handler) imageDistribute(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	if handler.clusterService == nil {
+		return httperror.BadRequest("Image distribution is only available in a cluster", errors.New("The agent is not part of a cluster"))
+	}
+
+	var payload imageDistributePayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	source := payload.Source
+	if source == "" {
+		source = handler.runtimeConfiguration.NodeName
+	}
+
+	if handler.clusterService.GetMemberByNodeName(source) == nil {
+		return httperror.BadRequest("Invalid source node", fmt.Errorf("unable to find the agent of the node %s", source))
+	}
+
+	targets := payload.Targets
+	if len(targets) == 0 {
+		for _, member := range handler.clusterService.Members() {
+			if member.NodeName != source {
+				targets = append(targets, member.NodeName)
+			}
+		}
+	}
+
+	exists, err := handler.imageExists(r.Context(), r, source, payload.Image)
+	if err != nil {
+		return httperror.InternalServerError("Unable to inspect the image on the source node", err)
+	}
+
+	if !exists {
+		return httperror.NotFound("Unable to find the image on the source node", fmt.Errorf("the image %s is not present on the node %s", payload.Image, source))
+	}
+
+	results := make([]imageDistributionResult, 0, len(targets))
+	for _, target := range targets {
+		status, err := handler.distributeImage(r.Context(), r, payload.Image, source, target, payload.Force)
+
+		result := imageDistributionResult{Node: target, Status: status}
+		if err != nil {
+			result.Status = imageDistributionFailed
+			result.Error = err.Error()
+		}
+
+		results = append(results, result)
+	}
+
+	return response.JSON(rw, results)
+}
+
+func (handler *Handler) distributeImage(ctx context.Context, r *http.Request, image, source, target string, force bool) (string, error) {
+	if target == source {
+		return imageDistributionPresent, nil
+	}
+
+	if !force {
+		exists, err := handler.imageExists(ctx, r, target, image)
+		if err != nil {
+			return "", err
+		}
+
+		if exists {
+			return imageDistributionPresent, nil
+		}
+	}
+
+	archive, err := handler.imageSave(ctx, r, source, image)
+	if err != nil {
+		return "", err
+	}
+	defer archive.Close()
+
+	err = handler.imageLoad(ctx, r, target, archive)
+	if err != nil {
+		return "", err
+	}
+
+	return imageDistributionLoaded, nil
+}
+
+// imageExists returns true when the image is present on the node
+func (handler *Handler) imageExists(ctx context.Context, r *http.Request, node, image string) (bool, error) {
+	if node == handler.runtimeConfiguration.NodeName {
+		return docker.ImageExists(ctx, image)
+	}
+
+	resp, err := handler.memberRequest(ctx, r, node, http.MethodGet, fmt.Sprintf("/images/%s/json", image), nil, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+
+	return false, fmt.Errorf("unexpected status code %d from the agent of the node %s", resp.StatusCode, node)
+}
+
+// imageSave returns the archive of the image exported from the node
+func (handler *Handler) imageSave(ctx context.Context, r *http.Request, node, image string) (io.ReadCloser, error) {
+	if node == handler.runtimeConfiguration.NodeName {
+		return docker.ImageSave(ctx, image)
+	}
+
+	resp, err := handler.memberRequest(ctx, r, node, http.MethodGet, fmt.Sprintf("/images/%s/get", image), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status code %d from the agent of the node %s", resp.StatusCode, node)
+	}
+
+	return resp.Body, nil
+}
+
+// imageLoad loads the archive of an image on the node
+func (handler *Handler) imageLoad(ctx context.Context, r *http.Request, node string, archive io.Reader) error {
+	if node == handler.runtimeConfiguration.NodeName {
+		return docker.ImageLoad(ctx, archive)
+	}
+
+	resp, err := handler.memberRequest(ctx, r, node, http.MethodPost, "/images/load", url.Values{"quiet": {"1"}}, archive)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d from the agent of the node %s", resp.StatusCode, node)
+	}
+
+	return docker.ReadJSONMessages(resp.Body)
+}
+
+func (handler *Handler) memberRequest(ctx context.Context, r *http.Request, node, method, path string, query url.Values, body io.Reader) (*http.Response, error) {
+	member := handler.clusterService.GetMemberByNodeName(node)
+	if member == nil {
+		return nil, fmt.Errorf("unable to find the agent of the node %s", node)
+	}
+
+	memberRequest, err := proxy.NewMemberRequest(ctx, r, member, handler.useTLS, method, path, query, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		memberRequest.Header.Set("Content-Type", "application/x-tar")
+	}
+
+	return handler.client.Do(memberRequest)
+}
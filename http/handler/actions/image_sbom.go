@@ -0,0 +1,48 @@
+package actions
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+
+	"github.com/portainer/agent/sbom"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+)
+
+type imageSBOMPayload struct {
+	// Image is the name or the identifier of the image
+	Image string
+	// Format is spdx-json (default) or cyclonedx-json
+	Format string
+}
+
+func (payload *imageSBOMPayload) Validate(r *http.Request) error {
+	if payload.Image == "" {
+		return errors.New("missing image")
+	}
+
+	return sbom.ValidateFormat(payload.Format)
+}
+
+// POST request on /actions/images/sbom
+// Returns the SBOM of a local image in the SPDX or CycloneDX JSON format
+func (handler *Handler) imageSBOM(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	var payload imageSBOMPayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	var document bytes.Buffer
+
+	result, err := sbom.Generate(r.Context(), payload.Image, payload.Format, &document)
+	if err != nil {
+		return httperror.InternalServerError("Unable to generate the SBOM of the image", err)
+	}
+
+	rw.Header().Set("Content-Type", sbom.ContentType(result.Format))
+	_, _ = rw.Write(document.Bytes())
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package actions
+
+import (
+	"net/http"
+
+	"github.com/portainer/agent/docker"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type imageScanPayload struct {
+	// Images are the names or identifiers of the images to scan, all the local images when empty
+	Images []string
+	// Offline skips the update of the vulnerability database of the scanner
+	Offline bool
+}
+
+func (payload *imageScanPayload) Validate(r *http.Request) error {
+	return nil
+}
+
+// POST request on /actions/images/scan
+// Scans the local images for vulnerabilities and returns the number of vulnerabilities per severity of each image
+func (handler *Handler) imageScan(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	var payload imageScanPayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	results, err := docker.ScanImages(r.Context(), payload.Images, docker.ImageScanOptions{
+		Image:   handler.scanImage,
+		Offline: payload.Offline,
+	})
+	if err != nil {
+		return httperror.InternalServerError("Unable to scan the images", err)
+	}
+
+	return response.JSON(rw, results)
+}
@@ -0,0 +1,95 @@
+package actions
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/portainer/agent/docker"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type networkCreatePayload struct {
+	Name       string
+	Driver     string
+	Subnets    []docker.IPAMSubnet
+	Internal   bool
+	Attachable bool
+	EnableIPv6 bool
+	Options    map[string]string
+	Labels     map[string]string
+	// Force creates the network even if its subnets conflict with the subnets in use on the host
+	Force bool
+}
+
+type networkCreateResponse struct {
+	ID         string                   `json:"Id"`
+	Warning    string                   `json:"Warning,omitempty"`
+	Validation docker.NetworkValidation `json:"Validation"`
+}
+
+func (payload *networkCreatePayload) Validate(r *http.Request) error {
+	if payload.Name == "" {
+		return errors.New("Missing network name")
+	}
+
+	return nil
+}
+
+// POST request on /actions/networks
+// The network is only created when its subnets are valid and do not conflict with the subnets in use on the host.
+// A 400 response is returned for invalid subnets and a 409 response containing the validation result is returned
+// for conflicts.
+func (handler *Handler) networkCreate(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	var payload networkCreatePayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	known, err := docker.GetKnownSubnets(r.Context())
+	if err != nil {
+		return httperror.InternalServerError("Unable to retrieve the subnets in use on the host", err)
+	}
+
+	validation := docker.ValidateNetworkSubnets(payload.Subnets, known)
+	if len(validation.Errors) > 0 {
+		return httperror.BadRequest("Invalid network subnets", errors.New(strings.Join(validation.Errors, ", ")))
+	}
+
+	if len(validation.Conflicts) > 0 && !payload.Force {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusConflict)
+
+		return response.JSON(rw, &networkCreateResponse{Validation: validation})
+	}
+
+	ipam := &network.IPAM{Driver: "default", Config: []network.IPAMConfig{}}
+	for _, subnet := range payload.Subnets {
+		ipam.Config = append(ipam.Config, network.IPAMConfig{
+			Subnet:  subnet.Subnet,
+			Gateway: subnet.Gateway,
+			IPRange: subnet.IPRange,
+		})
+	}
+
+	created, err := docker.NetworkCreate(r.Context(), payload.Name, types.NetworkCreate{
+		CheckDuplicate: true,
+		Driver:         payload.Driver,
+		IPAM:           ipam,
+		Internal:       payload.Internal,
+		Attachable:     payload.Attachable,
+		EnableIPv6:     payload.EnableIPv6,
+		Options:        payload.Options,
+		Labels:         payload.Labels,
+	})
+	if err != nil {
+		return httperror.InternalServerError("Unable to create the network", err)
+	}
+
+	return response.JSON(rw, &networkCreateResponse{ID: created.ID, Warning: created.Warning, Validation: validation})
+}
@@ -0,0 +1,39 @@
+package actions
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/portainer/agent/docker"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type networkValidatePayload struct {
+	Subnets []docker.IPAMSubnet
+}
+
+func (payload *networkValidatePayload) Validate(r *http.Request) error {
+	if len(payload.Subnets) == 0 {
+		return errors.New("Missing subnets")
+	}
+
+	return nil
+}
+
+// POST request on /actions/networks/validate
+func (handler *Handler) networkValidate(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	var payload networkValidatePayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	known, err := docker.GetKnownSubnets(r.Context())
+	if err != nil {
+		return httperror.InternalServerError("Unable to retrieve the subnets in use on the host", err)
+	}
+
+	return response.JSON(rw, docker.ValidateNetworkSubnets(payload.Subnets, known))
+}
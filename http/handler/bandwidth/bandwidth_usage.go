@@ -0,0 +1,21 @@
+package bandwidth
+
+import (
+	"errors"
+	"net/http"
+
+	agentnet "github.com/portainer/agent/net"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// GET request on /bandwidth
+// Returns the bytes sent and received by each subsystem of the agent during the current month
+func (handler *Handler) bandwidthUsage(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	report := agentnet.GetBandwidthReport()
+	if report == nil {
+		return httperror.NotFound("Bandwidth accounting is not enabled", errors.New("bandwidth accounting is not enabled"))
+	}
+
+	return response.JSON(rw, report)
+}
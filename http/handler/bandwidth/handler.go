@@ -0,0 +1,28 @@
+package bandwidth
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/portainer/agent/http/proxy"
+	"github.com/portainer/agent/http/security"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+)
+
+// Handler represents an HTTP API Handler for inspecting the bandwidth usage of the agent
+type Handler struct {
+	*mux.Router
+}
+
+// NewHandler returns a new instance of Handler
+func NewHandler(agentProxy *proxy.AgentProxy, notaryService *security.NotaryService) *Handler {
+	h := &Handler{
+		Router: mux.NewRouter(),
+	}
+
+	h.Handle("/bandwidth",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.bandwidthUsage)))).Methods(http.MethodGet)
+
+	return h
+}
@@ -0,0 +1,91 @@
+package browse
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/portainer/agent/filesystem"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+
+	"github.com/rs/zerolog/log"
+)
+
+// GET request on /browse/archive?volumeID=:id&path=:path
+// Streams the content of a directory as a gzip compressed tar archive
+func (handler *Handler) browseArchive(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	volumeID, _ := request.RetrieveQueryParameter(r, "volumeID", true)
+	path, err := request.RetrieveQueryParameter(r, "path", false)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: path", err)
+	}
+
+	if volumeID != "" {
+		path, err = filesystem.BuildDirectoryPathInsideVolume(volumeID, path)
+		if err != nil {
+			return httperror.BadRequest("Invalid volume", err)
+		}
+	}
+
+	return handler.writeArchive(rw, r, path)
+}
+
+// GET request on /v1/browse/:id/archive?path=:path
+func (handler *Handler) browseArchiveV1(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	volumeID, err := request.RetrieveRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid volume identifier route variable", err)
+	}
+
+	path, err := request.RetrieveQueryParameter(r, "path", false)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: path", err)
+	}
+
+	path, err = filesystem.BuildDirectoryPathInsideVolume(volumeID, path)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: path", err)
+	}
+
+	return handler.writeArchive(rw, r, path)
+}
+
+func (handler *Handler) writeArchive(rw http.ResponseWriter, r *http.Request, path string) *httperror.HandlerError {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return httperror.NotFound("Unable to find the directory", err)
+	} else if err != nil {
+		return httperror.InternalServerError("Unable to retrieve the directory", err)
+	}
+
+	if !info.IsDir() {
+		return httperror.BadRequest("Invalid query parameter: path", errors.New("the path is not a directory"))
+	}
+
+	size, err := filesystem.DirectorySize(path)
+	if err != nil {
+		return httperror.InternalServerError("Unable to compute the size of the directory", err)
+	}
+
+	if size > handler.archiveMaxSize {
+		return &httperror.HandlerError{
+			StatusCode: http.StatusRequestEntityTooLarge,
+			Message:    "The directory exceeds the maximum archive size",
+			Err:        filesystem.ErrArchiveTooLarge,
+		}
+	}
+
+	rw.Header().Set("Content-Type", "application/gzip")
+	rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(path)+".tar.gz"))
+
+	// The status is sent with the first bytes of the archive, the errors can only be logged afterwards
+	err = filesystem.ArchiveDirectory(r.Context(), path, rw, nil)
+	if err != nil {
+		log.Warn().Err(err).Str("path", path).Msg("unable to archive the directory")
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package browse
+
+import (
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/portainer/agent/filesystem"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type browseExtractResponse struct {
+	Extracted []string `json:"Extracted"`
+}
+
+// POST request on /browse/extract?volumeID=:id&path=:path
+// Extracts the gzip compressed tar archive of the request body inside a directory, created when missing
+func (handler *Handler) browseExtract(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	volumeID, _ := request.RetrieveQueryParameter(r, "volumeID", true)
+	path, err := request.RetrieveQueryParameter(r, "path", false)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: path", err)
+	}
+
+	if volumeID != "" {
+		path, err = filesystem.BuildDirectoryPathInsideVolume(volumeID, path)
+		if err != nil {
+			return httperror.BadRequest("Invalid volume", err)
+		}
+	}
+
+	return handler.extractArchive(rw, r, path)
+}
+
+// POST request on /v1/browse/:id/extract?path=:path
+func (handler *Handler) browseExtractV1(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	volumeID, err := request.RetrieveRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid volume identifier route variable", err)
+	}
+
+	path, err := request.RetrieveQueryParameter(r, "path", false)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: path", err)
+	}
+
+	path, err = filesystem.BuildDirectoryPathInsideVolume(volumeID, path)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: path", err)
+	}
+
+	return handler.extractArchive(rw, r, path)
+}
+
+func (handler *Handler) extractArchive(rw http.ResponseWriter, r *http.Request, path string) *httperror.HandlerError {
+	if r.ContentLength > handler.archiveMaxSize {
+		return &httperror.HandlerError{
+			StatusCode: http.StatusRequestEntityTooLarge,
+			Message:    "The archive exceeds the maximum archive size",
+			Err:        filesystem.ErrArchiveTooLarge,
+		}
+	}
+
+	err := os.MkdirAll(path, 0755)
+	if err != nil {
+		return httperror.InternalServerError("Unable to create the directory", err)
+	}
+
+	body := http.MaxBytesReader(rw, r.Body, handler.archiveMaxSize)
+
+	extracted, err := filesystem.ExtractArchiveWithLimit(r.Context(), body, path, handler.archiveMaxSize)
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.Is(err, filesystem.ErrArchiveTooLarge) || errors.As(err, &maxBytesErr) {
+		return &httperror.HandlerError{
+			StatusCode: http.StatusRequestEntityTooLarge,
+			Message:    "The archive exceeds the maximum archive size",
+			Err:        err,
+		}
+	} else if err != nil {
+		return httperror.BadRequest("Unable to extract the archive", err)
+	}
+
+	return response.JSON(rw, browseExtractResponse{Extracted: extracted})
+}
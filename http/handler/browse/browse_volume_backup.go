@@ -0,0 +1,85 @@
+package browse
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/portainer/agent/docker"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+
+	"github.com/rs/zerolog/log"
+)
+
+// GET request on /browse/volume_backup?volumeID=:id&pause=:pause
+// Streams a gzip compressed tar archive of the whole volume. When pause is true, the running containers mounting the
+// volume are paused until the archive is sent. The archive is not limited by the maximum archive size.
+func (handler *Handler) browseVolumeBackup(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	volumeID, err := request.RetrieveQueryParameter(r, "volumeID", false)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: volumeID", err)
+	}
+
+	pause, _ := request.RetrieveBooleanQueryParameter(r, "pause", true)
+
+	w := &archiveResponseWriter{
+		rw:       rw,
+		filename: fmt.Sprintf("%s-%s.tar.gz", volumeID, time.Now().UTC().Format("20060102T150405Z")),
+	}
+
+	_, err = docker.ArchiveVolume(r.Context(), volumeID, pause, w, nil)
+	if err != nil && !w.started {
+		return httperror.InternalServerError("Unable to back up the volume", err)
+	} else if err != nil {
+		// The status is sent with the first bytes of the archive, the errors can only be logged afterwards
+		log.Warn().Err(err).Str("volume", volumeID).Msg("unable to back up the volume")
+	}
+
+	return nil
+}
+
+// archiveResponseWriter sends the headers of the archive with its first bytes, so that an error occurring before
+// the archive starts can still be returned as an error response
+type archiveResponseWriter struct {
+	rw       http.ResponseWriter
+	filename string
+	started  bool
+}
+
+func (w *archiveResponseWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.started = true
+		w.rw.Header().Set("Content-Type", "application/gzip")
+		w.rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", w.filename))
+	}
+
+	return w.rw.Write(p)
+}
+
+// POST request on /browse/volume_restore?volumeID=:id&clear=:clear
+// Restores a volume from the gzip compressed tar archive of the request body, the volume is created when missing.
+// When clear is true, the content of the volume is removed before the restore.
+func (handler *Handler) browseVolumeRestore(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	volumeID, err := request.RetrieveQueryParameter(r, "volumeID", false)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: volumeID", err)
+	}
+
+	clearVolume, _ := request.RetrieveBooleanQueryParameter(r, "clear", true)
+
+	if r.ContentLength == 0 {
+		return httperror.BadRequest("Missing archive", errors.New("the request body is empty"))
+	}
+
+	restore, err := docker.RestoreVolume(r.Context(), volumeID, r.Body, r.ContentLength, clearVolume, func(percent int, message string) {
+		log.Debug().Str("volume", volumeID).Int("percent", percent).Msg(message)
+	})
+	if err != nil {
+		return httperror.InternalServerError("Unable to restore the volume", err)
+	}
+
+	return response.JSON(rw, restore)
+}
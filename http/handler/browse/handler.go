@@ -6,50 +6,68 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/portainer/agent/http/proxy"
 	"github.com/portainer/agent/http/security"
+	agentnet "github.com/portainer/agent/net"
 	httperror "github.com/portainer/portainer/pkg/libhttp/error"
 )
 
 // Handler is the HTTP handler used to handle volume browsing operations.
 type Handler struct {
 	*mux.Router
+	archiveMaxSize int64
 }
 
 // NewHandler returns a pointer to an Handler
 // It sets the associated handle functions for all the Browse related HTTP endpoints.
-func NewHandler(agentProxy *proxy.AgentProxy, notaryService *security.NotaryService) *Handler {
+// In clustered mode, the requests are forwarded to the agent of the node specified by the node query parameter.
+func NewHandler(agentProxy *proxy.AgentProxy, notaryService *security.NotaryService, archiveMaxSize int64) *Handler {
 	h := &Handler{
-		Router: mux.NewRouter(),
+		Router:         mux.NewRouter(),
+		archiveMaxSize: archiveMaxSize,
 	}
 
 	h.Handle("/browse/ls",
-		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browseList)))).Methods(http.MethodGet)
+		notaryService.DigitalSignatureVerification(agentProxy.RedirectToNode(httperror.LoggerHandler(h.browseList)))).Methods(http.MethodGet)
 	h.Handle("/browse/get",
-		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browseGet)))).Methods(http.MethodGet)
+		notaryService.DigitalSignatureVerification(agentnet.MeterHandler(agentnet.BandwidthFileTransfers, agentProxy.RedirectToNode(httperror.LoggerHandler(h.browseGet))))).Methods(http.MethodGet)
 	h.Handle("/browse/delete",
-		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browseDelete)))).Methods(http.MethodDelete)
+		notaryService.DigitalSignatureVerification(agentProxy.RedirectToNode(httperror.LoggerHandler(h.browseDelete)))).Methods(http.MethodDelete)
 	h.Handle("/browse/rename",
-		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browseRename)))).Methods(http.MethodPut)
+		notaryService.DigitalSignatureVerification(agentProxy.RedirectToNode(httperror.LoggerHandler(h.browseRename)))).Methods(http.MethodPut)
 	h.Handle("/browse/put",
-		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browsePut)))).Methods(http.MethodPost)
+		notaryService.DigitalSignatureVerification(agentnet.MeterHandler(agentnet.BandwidthFileTransfers, agentProxy.RedirectToNode(httperror.LoggerHandler(h.browsePut))))).Methods(http.MethodPost)
+	h.Handle("/browse/archive",
+		notaryService.DigitalSignatureVerification(agentnet.MeterHandler(agentnet.BandwidthFileTransfers, agentProxy.RedirectToNode(httperror.LoggerHandler(h.browseArchive))))).Methods(http.MethodGet)
+	h.Handle("/browse/extract",
+		notaryService.DigitalSignatureVerification(agentnet.MeterHandler(agentnet.BandwidthFileTransfers, agentProxy.RedirectToNode(httperror.LoggerHandler(h.browseExtract))))).Methods(http.MethodPost)
+	h.Handle("/browse/volume_backup",
+		notaryService.DigitalSignatureVerification(agentnet.MeterHandler(agentnet.BandwidthFileTransfers, agentProxy.RedirectToNode(httperror.LoggerHandler(h.browseVolumeBackup))))).Methods(http.MethodGet)
+	h.Handle("/browse/volume_restore",
+		notaryService.DigitalSignatureVerification(agentnet.MeterHandler(agentnet.BandwidthFileTransfers, agentProxy.RedirectToNode(httperror.LoggerHandler(h.browseVolumeRestore))))).Methods(http.MethodPost)
 	return h
 }
 
 // NewHandlerV1 returns a pointer to an Handler
 // It sets the associated handle functions for all the Browse related HTTP endpoints.
-func NewHandlerV1(agentProxy *proxy.AgentProxy, notaryService *security.NotaryService) *Handler {
+// In clustered mode, the requests are forwarded to the agent of the node specified by the node query parameter.
+func NewHandlerV1(agentProxy *proxy.AgentProxy, notaryService *security.NotaryService, archiveMaxSize int64) *Handler {
 	h := &Handler{
-		Router: mux.NewRouter(),
+		Router:         mux.NewRouter(),
+		archiveMaxSize: archiveMaxSize,
 	}
 
 	h.Handle("/browse/{id}/ls",
-		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browseListV1)))).Methods(http.MethodGet)
+		notaryService.DigitalSignatureVerification(agentProxy.RedirectToNode(httperror.LoggerHandler(h.browseListV1)))).Methods(http.MethodGet)
 	h.Handle("/browse/{id}/get",
-		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browseGetV1)))).Methods(http.MethodGet)
+		notaryService.DigitalSignatureVerification(agentnet.MeterHandler(agentnet.BandwidthFileTransfers, agentProxy.RedirectToNode(httperror.LoggerHandler(h.browseGetV1))))).Methods(http.MethodGet)
 	h.Handle("/browse/{id}/delete",
-		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browseDeleteV1)))).Methods(http.MethodDelete)
+		notaryService.DigitalSignatureVerification(agentProxy.RedirectToNode(httperror.LoggerHandler(h.browseDeleteV1)))).Methods(http.MethodDelete)
 	h.Handle("/browse/{id}/rename",
-		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browseRenameV1)))).Methods(http.MethodPut)
+		notaryService.DigitalSignatureVerification(agentProxy.RedirectToNode(httperror.LoggerHandler(h.browseRenameV1)))).Methods(http.MethodPut)
 	h.Handle("/browse/{id}/put",
-		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browsePutV1)))).Methods(http.MethodPost)
+		notaryService.DigitalSignatureVerification(agentnet.MeterHandler(agentnet.BandwidthFileTransfers, agentProxy.RedirectToNode(httperror.LoggerHandler(h.browsePutV1))))).Methods(http.MethodPost)
+	h.Handle("/browse/{id}/archive",
+		notaryService.DigitalSignatureVerification(agentnet.MeterHandler(agentnet.BandwidthFileTransfers, agentProxy.RedirectToNode(httperror.LoggerHandler(h.browseArchiveV1))))).Methods(http.MethodGet)
+	h.Handle("/browse/{id}/extract",
+		notaryService.DigitalSignatureVerification(agentnet.MeterHandler(agentnet.BandwidthFileTransfers, agentProxy.RedirectToNode(httperror.LoggerHandler(h.browseExtractV1))))).Methods(http.MethodPost)
 	return h
 }
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"errors"
+	"net/http"
+
+	agentos "github.com/portainer/agent/os"
+	"github.com/portainer/agent/schema"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+	"github.com/rs/zerolog/log"
+)
+
+type configUpdatePayload struct {
+	// Options maps option names (flag names or environment variable names) to values
+	Options map[string]string
+}
+
+func (payload *configUpdatePayload) Validate(r *http.Request) error {
+	return nil
+}
+
+// PUT request on /config
+// The configuration replaces the previously pushed one and is applied on the next start of the agent,
+// to the options that are not defined via a flag, an environment variable or the configuration file.
+// The options gating the operations and the security of the agent cannot be pushed, they are rejected with a 403.
+func (handler *Handler) configUpdate(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	var payload configUpdatePayload
+	err := schema.DecodeAndValidateJSONPayload(r, schema.APIConfigUpdate, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	if payload.Options == nil {
+		payload.Options = map[string]string{}
+	}
+
+	err = agentos.SaveServerConfig(handler.dataPath, payload.Options)
+	if errors.Is(err, agentos.ErrRestrictedOption) {
+		return httperror.Forbidden("Unable to save the server configuration", err)
+	} else if err != nil {
+		return httperror.BadRequest("Unable to save the server configuration", err)
+	}
+
+	log.Info().Int("options", len(payload.Options)).Msg("server configuration updated, it will be applied on the next start")
+
+	return response.Empty(rw)
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/portainer/agent/http/proxy"
+	"github.com/portainer/agent/http/security"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+)
+
+// Handler represents an HTTP API Handler for the configuration pushed by the Portainer server
+type Handler struct {
+	*mux.Router
+	proxyPolicyService *security.ProxyPolicyService
+	dataPath           string
+}
+
+// NewHandler returns a new instance of Handler
+func NewHandler(agentProxy *proxy.AgentProxy, notaryService *security.NotaryService, proxyPolicyService *security.ProxyPolicyService, dataPath string) *Handler {
+	h := &Handler{
+		Router:             mux.NewRouter(),
+		proxyPolicyService: proxyPolicyService,
+		dataPath:           dataPath,
+	}
+
+	h.Handle("/config",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.configUpdate)))).Methods(http.MethodPut)
+	h.Handle("/config/profile",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.profileExport)))).Methods(http.MethodGet)
+	h.Handle("/config/profile",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.profileImport)))).Methods(http.MethodPut)
+	h.Handle("/config/profiles",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.profileList)))).Methods(http.MethodGet)
+	h.Handle("/config/proxy_policy",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.proxyPolicyInspect)))).Methods(http.MethodGet)
+	h.Handle("/config/proxy_policy",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.proxyPolicyUpdate)))).Methods(http.MethodPut)
+
+	return h
+}
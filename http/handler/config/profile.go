@@ -0,0 +1,64 @@
+package config
+
+import (
+	"errors"
+	"net/http"
+
+	agentos "github.com/portainer/agent/os"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+	"github.com/rs/zerolog/log"
+)
+
+type profileImportResponse struct {
+	// RequiredSecrets are the secrets of the profile that are not read from a file and must be provided to the agent
+	RequiredSecrets []string
+}
+
+// GET request on /config/profile
+// Returns the configuration profile of the agent, the secrets are only referenced by the files they are read from
+func (handler *Handler) profileExport(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	profile, err := agentos.CurrentProfile()
+	if err != nil {
+		return httperror.InternalServerError("Unable to export the configuration profile", err)
+	}
+
+	return response.JSON(rw, profile)
+}
+
+// GET request on /config/profiles
+// Returns the configuration profiles imported on the agent and the one selected for the next starts
+func (handler *Handler) profileList(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	profiles, err := agentos.ListProfiles(handler.dataPath)
+	if err != nil {
+		return httperror.InternalServerError("Unable to list the configuration profiles", err)
+	}
+
+	return response.JSON(rw, profiles)
+}
+
+// PUT request on /config/profile?name=<name>
+// The profile replaces the previously imported one of the same name, the unnamed profile when the name is omitted. It
+// is applied on the next start of the agent when selected, to the options that are not defined via a flag, an
+// environment variable or the configuration file. The profiles setting the options gating the operations and the
+// security of the agent are rejected with a 403.
+func (handler *Handler) profileImport(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	name, _ := request.RetrieveQueryParameter(r, "name", true)
+
+	profile, err := agentos.ReadProfile(r.Body)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	requiredSecrets, err := agentos.ImportProfile(handler.dataPath, name, profile)
+	if errors.Is(err, agentos.ErrRestrictedOption) {
+		return httperror.Forbidden("Unable to import the configuration profile", err)
+	} else if err != nil {
+		return httperror.BadRequest("Unable to import the configuration profile", err)
+	}
+
+	log.Info().Str("profile", name).Int("options", len(profile.Options)).Msg("configuration profile imported, it will be applied on the next start when selected")
+
+	return response.JSON(rw, profileImportResponse{RequiredSecrets: requiredSecrets})
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"net/http"
+
+	"github.com/portainer/agent/http/security"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+	"github.com/rs/zerolog/log"
+)
+
+type proxyPolicyUpdatePayload struct {
+	security.ProxyPolicy
+}
+
+func (payload *proxyPolicyUpdatePayload) Validate(r *http.Request) error {
+	return payload.ProxyPolicy.Validate()
+}
+
+// GET request on /config/proxy_policy
+// Returns the proxy policy pushed by the server, an empty policy when there is none
+func (handler *Handler) proxyPolicyInspect(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	policy := handler.proxyPolicyService.ServerPolicy()
+	if policy == nil {
+		policy = &security.ProxyPolicy{}
+	}
+
+	return response.JSON(rw, policy)
+}
+
+// PUT request on /config/proxy_policy
+// The policy replaces the previously pushed one and is enforced immediately, along with the local policy of the
+// agent that it cannot loosen. An empty policy removes it.
+func (handler *Handler) proxyPolicyUpdate(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	var payload proxyPolicyUpdatePayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	err = handler.proxyPolicyService.UpdateServerPolicy(&payload.ProxyPolicy)
+	if err != nil {
+		return httperror.InternalServerError("Unable to update the proxy policy", err)
+	}
+
+	log.Info().Int("rules", len(payload.Rules)).Float64("rate_limit", payload.RateLimit).Msg("proxy policy updated")
+
+	return response.Empty(rw)
+}
@@ -0,0 +1,47 @@
+package crashes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/portainer/agent/crash"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+)
+
+// GET request on /crashes/{id}/files/{name}
+func (handler *Handler) crashFile(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	artifactID, err := request.RetrieveRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid crash artifact identifier route variable", err)
+	}
+
+	name, err := request.RetrieveRouteVariableValue(r, "name")
+	if err != nil {
+		return httperror.BadRequest("Invalid file name route variable", err)
+	}
+
+	store, err := crash.DefaultStore()
+	if err != nil {
+		return httperror.NotFound("The collection of the crash artifacts is disabled", err)
+	}
+
+	f, err := store.Open(artifactID, name)
+	if errors.Is(err, crash.ErrNotFound) {
+		return httperror.NotFound("Unable to find the file of the crash artifact", err)
+	} else if err != nil {
+		return httperror.InternalServerError("Unable to open the file of the crash artifact", err)
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return httperror.InternalServerError("Unable to open the file of the crash artifact", err)
+	}
+
+	rw.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(name))
+	http.ServeContent(rw, r, name, stat.ModTime(), f)
+
+	return nil
+}
@@ -0,0 +1,33 @@
+package crashes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/portainer/agent/crash"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// GET request on /crashes/{id}
+func (handler *Handler) crashInspect(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	artifactID, err := request.RetrieveRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid crash artifact identifier route variable", err)
+	}
+
+	store, err := crash.DefaultStore()
+	if err != nil {
+		return httperror.NotFound("The collection of the crash artifacts is disabled", err)
+	}
+
+	artifact, err := store.Get(artifactID)
+	if errors.Is(err, crash.ErrNotFound) {
+		return httperror.NotFound("Unable to find the crash artifact", err)
+	} else if err != nil {
+		return httperror.InternalServerError("Unable to read the crash artifact", err)
+	}
+
+	return response.JSON(rw, artifact)
+}
@@ -0,0 +1,24 @@
+package crashes
+
+import (
+	"net/http"
+
+	"github.com/portainer/agent/crash"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// GET request on /crashes
+func (handler *Handler) crashList(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	store, err := crash.DefaultStore()
+	if err != nil {
+		return httperror.NotFound("The collection of the crash artifacts is disabled", err)
+	}
+
+	artifacts, err := store.List()
+	if err != nil {
+		return httperror.InternalServerError("Unable to list the crash artifacts", err)
+	}
+
+	return response.JSON(rw, artifacts)
+}
@@ -0,0 +1,34 @@
+package crashes
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/portainer/agent/http/proxy"
+	"github.com/portainer/agent/http/security"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+)
+
+// Handler represents an HTTP API Handler serving the artifacts collected when the containers crash
+type Handler struct {
+	*mux.Router
+}
+
+// NewHandler returns a new instance of Handler
+func NewHandler(agentProxy *proxy.AgentProxy, notaryService *security.NotaryService) *Handler {
+	h := &Handler{
+		Router: mux.NewRouter(),
+	}
+
+	h.Handle("/crashes",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.crashList)))).Methods(http.MethodGet)
+	h.Handle("/crashes/{id}",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.crashInspect)))).Methods(http.MethodGet)
+	h.Handle("/crashes/{id}",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.crashDelete)))).Methods(http.MethodDelete)
+	h.Handle("/crashes/{id}/files/{name}",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.crashFile)))).Methods(http.MethodGet)
+
+	return h
+}
@@ -0,0 +1,54 @@
+package dependencies
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/portainer/agent/docker"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type dependencyImpactResponse struct {
+	Container  docker.DependencyNode   `json:"Container"`
+	Dependents []docker.DependencyNode `json:"Dependents"`
+}
+
+// GET request on /dependencies
+// Returns the dependency graph of the containers of the node
+func (handler *Handler) dependencyGraph(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	graph, err := docker.GetDependencyGraph(r.Context())
+	if err != nil {
+		return httperror.InternalServerError("Unable to compute the dependency graph", err)
+	}
+
+	return response.JSON(rw, graph)
+}
+
+// GET request on /dependencies/{id}
+// Returns the containers depending directly or transitively on the container, to warn about the downstream impact
+// of stopping or restarting it. The container is referenced by its identifier, identifier prefix or name.
+func (handler *Handler) dependencyImpact(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	containerID, err := request.RetrieveRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid container identifier route variable", err)
+	}
+
+	graph, err := docker.GetDependencyGraph(r.Context())
+	if err != nil {
+		return httperror.InternalServerError("Unable to compute the dependency graph", err)
+	}
+
+	for _, node := range graph.Nodes {
+		if node.Name == strings.TrimPrefix(containerID, "/") || strings.HasPrefix(node.ID, containerID) {
+			return response.JSON(rw, dependencyImpactResponse{
+				Container:  node,
+				Dependents: graph.Dependents(node.ID),
+			})
+		}
+	}
+
+	return httperror.NotFound("Unable to find the container", errors.New("No such container: "+containerID))
+}
@@ -0,0 +1,30 @@
+package dependencies
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/portainer/agent/http/proxy"
+	"github.com/portainer/agent/http/security"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+)
+
+// Handler represents an HTTP API Handler for inspecting the dependencies between containers
+type Handler struct {
+	*mux.Router
+}
+
+// NewHandler returns a new instance of Handler
+func NewHandler(agentProxy *proxy.AgentProxy, notaryService *security.NotaryService) *Handler {
+	h := &Handler{
+		Router: mux.NewRouter(),
+	}
+
+	h.Handle("/dependencies",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.dependencyGraph)))).Methods(http.MethodGet)
+	h.Handle("/dependencies/{id}",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.dependencyImpact)))).Methods(http.MethodGet)
+
+	return h
+}
@@ -1,11 +1,15 @@
 package docker
 
 import (
+	"bytes"
 	"errors"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker"
 	"github.com/portainer/agent/http/proxy"
 	httperror "github.com/portainer/portainer/pkg/libhttp/error"
 	"github.com/portainer/portainer/pkg/libhttp/response"
@@ -14,6 +18,18 @@ import (
 )
 
 func (handler *Handler) dockerOperation(rw http.ResponseWriter, request *http.Request) *httperror.HandlerError {
+	if request.Method == http.MethodPost && docker.IsResourceCreatePath(request.URL.Path) {
+		err := handler.addResourceLabels(request)
+		if err != nil {
+			return httperror.BadRequest("Invalid request payload", err)
+		}
+	}
+
+	if !docker.CurrentRuntime().SupportsSwarm() && isSwarmPath(request.URL.Path) {
+		// Answer as a standalone Docker engine does, the Swarm endpoints are not implemented by Podman
+		return &httperror.HandlerError{StatusCode: http.StatusServiceUnavailable, Message: "This node is not a swarm manager", Err: errors.New("Swarm is not supported by the container runtime")}
+	}
+
 	if handler.clusterService == nil {
 		handler.dockerProxy.ServeHTTP(rw, request)
 		return nil
@@ -28,6 +44,28 @@ func (handler *Handler) dockerOperation(rw http.ResponseWriter, request *http.Re
 	return handler.dispatchOperation(rw, request)
 }
 
+// addResourceLabels stamps the environment, stack and owner labels on the resource created by the request
+func (handler *Handler) addResourceLabels(request *http.Request) error {
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		return err
+	}
+	request.Body.Close()
+
+	labels := docker.ResourceLabels(handler.endpoint, "", request.Header.Get(agent.HTTPResourceOwnerHeaderName))
+
+	body, err = docker.AddResourceLabels(body, labels)
+	if err != nil {
+		return err
+	}
+
+	request.Body = io.NopCloser(bytes.NewReader(body))
+	request.ContentLength = int64(len(body))
+	request.Header.Set("Content-Length", strconv.Itoa(len(body)))
+
+	return nil
+}
+
 func (handler *Handler) dispatchOperation(rw http.ResponseWriter, request *http.Request) *httperror.HandlerError {
 	path := request.URL.Path
 
@@ -59,6 +97,18 @@ func (handler *Handler) dispatchOperation(rw http.ResponseWriter, request *http.
 	}
 }
 
+// isSwarmPath returns true when path is the path of an endpoint of the Docker API only available in Swarm mode
+func isSwarmPath(path string) bool {
+	resource, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+
+	switch resource {
+	case "swarm", "services", "tasks", "secrets", "configs", "nodes":
+		return true
+	}
+
+	return false
+}
+
 func (handler *Handler) executeOperationOnManagerNode(rw http.ResponseWriter, request *http.Request) *httperror.HandlerError {
 	if handler.runtimeConfiguration.DockerConfiguration.NodeRole == agent.NodeRoleManager {
 		handler.dockerProxy.ServeHTTP(rw, request)
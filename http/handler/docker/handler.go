@@ -5,6 +5,7 @@ import (
 	"github.com/portainer/agent"
 	"github.com/portainer/agent/http/proxy"
 	"github.com/portainer/agent/http/security"
+	agentnet "github.com/portainer/agent/net"
 	httperror "github.com/portainer/portainer/pkg/libhttp/error"
 )
 
@@ -16,20 +17,31 @@ type Handler struct {
 	clusterService       agent.ClusterService
 	runtimeConfiguration *agent.RuntimeConfiguration
 	useTLS               bool
+	endpoint             string
 }
 
 // NewHandler returns a new instance of Handler.
 // It sets the associated handle functions for all the Docker related HTTP endpoints.
-func NewHandler(clusterService agent.ClusterService, config *agent.RuntimeConfiguration, notaryService *security.NotaryService, useTLS bool) *Handler {
+// The requests are filtered by the proxy policy before being proxied.
+func NewHandler(clusterService agent.ClusterService, config *agent.RuntimeConfiguration, notaryService *security.NotaryService, proxyPolicyService *security.ProxyPolicyService, useTLS bool, agentOptions *agent.Options) *Handler {
 	h := &Handler{
 		Router:               mux.NewRouter(),
-		dockerProxy:          proxy.NewLocalProxy(),
+		dockerProxy:          proxy.NewLocalProxy(agentOptions.DockerProxyTimeout, agentOptions.DockerProxyRetries),
 		clusterProxy:         proxy.NewClusterProxy(useTLS),
 		clusterService:       clusterService,
 		runtimeConfiguration: config,
 		useTLS:               useTLS,
+		endpoint:             agentOptions.EdgeID,
 	}
 
-	h.PathPrefix("/").Handler(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.dockerOperation)))
+	if h.endpoint == "" {
+		h.endpoint = config.NodeName
+	}
+
+	h.Path("/{resource:containers|services|tasks}/{id}/logs").Handler(
+		notaryService.DigitalSignatureVerification(proxyPolicyService.Filter(agentnet.MeterHandler(agentnet.BandwidthLogStreams, httperror.LoggerHandler(h.dockerOperation)))))
+	h.Path("/containers/{id}/archive").Handler(
+		notaryService.DigitalSignatureVerification(proxyPolicyService.Filter(agentnet.MeterHandler(agentnet.BandwidthFileTransfers, httperror.LoggerHandler(h.dockerOperation)))))
+	h.PathPrefix("/").Handler(notaryService.DigitalSignatureVerification(proxyPolicyService.Filter(httperror.LoggerHandler(h.dockerOperation))))
 	return h
 }
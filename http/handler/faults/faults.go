@@ -0,0 +1,107 @@
+package faults
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/portainer/agent/faults"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type faultInjectPayload struct {
+	Kind string
+	// Duration of the fault, e.g. 2m, the fault stays active until it is cleared when it is empty
+	Duration string
+	// Skew of the clock of the clock_skew fault, e.g. -10m
+	Skew string
+
+	fault faults.Fault
+}
+
+func (payload *faultInjectPayload) Validate(r *http.Request) error {
+	payload.fault = faults.Fault{Kind: faults.Kind(payload.Kind)}
+	if !faults.ValidKind(payload.fault.Kind) {
+		return errors.New("unknown fault")
+	}
+
+	if (payload.Skew != "") != (payload.fault.Kind == faults.ClockSkew) {
+		return errors.New("only the clock_skew fault has a skew")
+	}
+
+	if payload.Skew != "" {
+		skew, err := time.ParseDuration(payload.Skew)
+		if err != nil {
+			return errors.New("invalid skew")
+		}
+
+		payload.fault.Skew = skew
+	}
+
+	if payload.Duration != "" {
+		duration, err := time.ParseDuration(payload.Duration)
+		if err != nil || duration <= 0 {
+			return errors.New("invalid duration")
+		}
+
+		payload.fault.Until = time.Now().Add(duration)
+	}
+
+	return nil
+}
+
+// GET request on /faults
+// Returns the active faults
+func (handler *Handler) faultList(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	if !faults.Enabled {
+		return httperror.NotFound("The agent is not built with the fault injection", faults.ErrDisabled)
+	}
+
+	return response.JSON(rw, faults.List())
+}
+
+// POST request on /faults
+// Injects a fault, replacing the active fault of the same kind
+func (handler *Handler) faultInject(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	if !faults.Enabled {
+		return httperror.NotFound("The agent is not built with the fault injection", faults.ErrDisabled)
+	}
+
+	var payload faultInjectPayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	err = faults.Inject(payload.fault)
+	if err != nil {
+		return httperror.InternalServerError("Unable to inject the fault", err)
+	}
+
+	return response.JSON(rw, payload.fault)
+}
+
+// DELETE request on /faults and /faults/{kind}
+// Clears the fault of kind, or all the active faults
+func (handler *Handler) faultClear(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	if !faults.Enabled {
+		return httperror.NotFound("The agent is not built with the fault injection", faults.ErrDisabled)
+	}
+
+	kind, err := request.RetrieveRouteVariableValue(r, "kind")
+	if err != nil {
+		faults.ClearAll()
+
+		return response.Empty(rw)
+	}
+
+	if !faults.ValidKind(faults.Kind(kind)) {
+		return httperror.BadRequest("Invalid fault", errors.New("unknown fault"))
+	}
+
+	faults.Clear(faults.Kind(kind))
+
+	return response.Empty(rw)
+}
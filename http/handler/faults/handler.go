@@ -0,0 +1,34 @@
+package faults
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/portainer/agent/http/proxy"
+	"github.com/portainer/agent/http/security"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+)
+
+// Handler represents an HTTP API Handler for injecting faults in the agents built with the chaos build tag
+type Handler struct {
+	*mux.Router
+}
+
+// NewHandler returns a new instance of Handler
+func NewHandler(agentProxy *proxy.AgentProxy, notaryService *security.NotaryService) *Handler {
+	h := &Handler{
+		Router: mux.NewRouter(),
+	}
+
+	h.Handle("/faults",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.faultList)))).Methods(http.MethodGet)
+	h.Handle("/faults",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.faultInject)))).Methods(http.MethodPost)
+	h.Handle("/faults",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.faultClear)))).Methods(http.MethodDelete)
+	h.Handle("/faults/{kind}",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.faultClear)))).Methods(http.MethodDelete)
+
+	return h
+}
@@ -2,45 +2,85 @@ package handler
 
 import (
 	"net/http"
+	"path"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/portainer/agent"
+	agentdocker "github.com/portainer/agent/docker"
 	"github.com/portainer/agent/edge"
 	"github.com/portainer/agent/exec"
+	"github.com/portainer/agent/grpcapi"
+	"github.com/portainer/agent/hostaction"
+	"github.com/portainer/agent/http/handler/actions"
 	httpagenthandler "github.com/portainer/agent/http/handler/agent"
+	"github.com/portainer/agent/http/handler/bandwidth"
 	"github.com/portainer/agent/http/handler/browse"
+	httpconfighandler "github.com/portainer/agent/http/handler/config"
+	"github.com/portainer/agent/http/handler/crashes"
+	"github.com/portainer/agent/http/handler/dependencies"
 	"github.com/portainer/agent/http/handler/docker"
 	"github.com/portainer/agent/http/handler/dockerhub"
+	"github.com/portainer/agent/http/handler/faults"
 	"github.com/portainer/agent/http/handler/host"
 	"github.com/portainer/agent/http/handler/key"
 	"github.com/portainer/agent/http/handler/kubernetes"
 	"github.com/portainer/agent/http/handler/kubernetesproxy"
+	"github.com/portainer/agent/http/handler/logs"
 	"github.com/portainer/agent/http/handler/nomadproxy"
+	"github.com/portainer/agent/http/handler/operations"
 	"github.com/portainer/agent/http/handler/ping"
+	"github.com/portainer/agent/http/handler/replica"
+	"github.com/portainer/agent/http/handler/resources"
+	"github.com/portainer/agent/http/handler/retention"
+	"github.com/portainer/agent/http/handler/snapshots"
+	"github.com/portainer/agent/http/handler/stacks"
+	"github.com/portainer/agent/http/handler/webhooks"
 	"github.com/portainer/agent/http/handler/websocket"
+	"github.com/portainer/agent/http/idempotency"
 	"github.com/portainer/agent/http/proxy"
 	"github.com/portainer/agent/http/security"
+	"github.com/portainer/agent/identity"
 	kubecli "github.com/portainer/agent/kubernetes"
+	"github.com/portainer/agent/metrics"
+	agentoperations "github.com/portainer/agent/operations"
 )
 
 // Handler is the main handler of the application.
 // Redirection to sub handlers is done in the ServeHTTP function.
 type Handler struct {
+	actionsHandler         *actions.Handler
 	agentHandler           *httpagenthandler.Handler
+	bandwidthHandler       *bandwidth.Handler
 	browseHandler          *browse.Handler
 	browseHandlerV1        *browse.Handler
+	configHandler          *httpconfighandler.Handler
+	crashesHandler         *crashes.Handler
+	dependenciesHandler    *dependencies.Handler
 	dockerProxyHandler     *docker.Handler
 	dockerhubHandler       *dockerhub.Handler
+	faultsHandler          *faults.Handler
 	keyHandler             *key.Handler
 	kubernetesHandler      *kubernetes.Handler
 	kubernetesProxyHandler *kubernetesproxy.Handler
+	logsHandler            *logs.Handler
 	nomadProxyHandler      *nomadproxy.Handler
+	operationsHandler      *operations.Handler
 	webSocketHandler       *websocket.Handler
 	hostHandler            *host.Handler
 	pingHandler            *ping.Handler
+	replicaHandler         *replica.Handler
+	resourcesHandler       *resources.Handler
+	retentionHandler       *retention.Handler
+	snapshotsHandler       *snapshots.Handler
+	stacksHandler          *stacks.Handler
+	webhooksHandler        *webhooks.Handler
+	grpcHandler            http.Handler
+	idempotentHandler      http.Handler
 	containerPlatform      agent.ContainerPlatform
+	agentIdentity          *identity.Identity
 }
 
 // Config represents a server handler configuration
@@ -54,8 +94,12 @@ type Config struct {
 	EdgeManager          *edge.Manager
 	RuntimeConfiguration *agent.RuntimeConfiguration
 	NomadConfig          agent.NomadConfig
+	OperationManager     *agentoperations.Manager
+	AgentOptions         *agent.Options
 	UseTLS               bool
 	ContainerPlatform    agent.ContainerPlatform
+	AgentIdentity        *identity.Identity
+	ProxyPolicyService   *security.ProxyPolicyService
 }
 
 var dockerAPIVersionRegexp = regexp.MustCompile(`(/v[0-9]\.[0-9]*)?`)
@@ -64,22 +108,57 @@ var dockerAPIVersionRegexp = regexp.MustCompile(`(/v[0-9]\.[0-9]*)?`)
 func NewHandler(config *Config) *Handler {
 	agentProxy := proxy.NewAgentProxy(config.ClusterService, config.RuntimeConfiguration, config.UseTLS)
 	notaryService := security.NewNotaryService(config.SignatureService, true)
+	policyService := security.NewPolicyService(config.AgentOptions.AllowedOperations)
+	hostActionOrchestrator := hostaction.NewOrchestrator(
+		path.Join(config.AgentOptions.DataPath, agent.HostActionFileName),
+		config.AgentOptions.HostActionImage,
+		func() bool { return config.OperationManager.IsRunning("stack_deploy") },
+		func() bool {
+			return config.EdgeManager != nil && config.EdgeManager.GetStackManager() != nil && config.EdgeManager.GetStackManager().DeploymentInProgress()
+		},
+	)
 
-	return &Handler{
+	h := &Handler{
+		actionsHandler:         actions.NewHandler(agentProxy, notaryService, policyService, config.AgentOptions.CaptureImage, config.AgentOptions.ScanImage, config.ClusterService, config.RuntimeConfiguration, config.UseTLS),
 		agentHandler:           httpagenthandler.NewHandler(config.ClusterService, notaryService),
-		browseHandler:          browse.NewHandler(agentProxy, notaryService),
-		browseHandlerV1:        browse.NewHandlerV1(agentProxy, notaryService),
-		dockerProxyHandler:     docker.NewHandler(config.ClusterService, config.RuntimeConfiguration, notaryService, config.UseTLS),
+		bandwidthHandler:       bandwidth.NewHandler(agentProxy, notaryService),
+		browseHandler:          browse.NewHandler(agentProxy, notaryService, config.AgentOptions.BrowseArchiveMaxSize),
+		browseHandlerV1:        browse.NewHandlerV1(agentProxy, notaryService, config.AgentOptions.BrowseArchiveMaxSize),
+		crashesHandler:         crashes.NewHandler(agentProxy, notaryService),
+		configHandler:          httpconfighandler.NewHandler(agentProxy, notaryService, config.ProxyPolicyService, config.AgentOptions.DataPath),
+		dependenciesHandler:    dependencies.NewHandler(agentProxy, notaryService),
+		dockerProxyHandler:     docker.NewHandler(config.ClusterService, config.RuntimeConfiguration, notaryService, config.ProxyPolicyService, config.UseTLS, config.AgentOptions),
 		dockerhubHandler:       dockerhub.NewHandler(notaryService),
+		faultsHandler:          faults.NewHandler(agentProxy, notaryService),
 		keyHandler:             key.NewHandler(notaryService, config.EdgeManager),
 		kubernetesHandler:      kubernetes.NewHandler(notaryService, config.KubernetesDeployer),
 		kubernetesProxyHandler: kubernetesproxy.NewHandler(notaryService),
+		logsHandler:            logs.NewHandler(config.ClusterService, config.RuntimeConfiguration, notaryService, config.UseTLS),
 		nomadProxyHandler:      nomadproxy.NewHandler(notaryService, config.NomadConfig),
-		webSocketHandler:       websocket.NewHandler(config.ClusterService, config.RuntimeConfiguration, notaryService, config.KubeClient),
-		hostHandler:            host.NewHandler(config.SystemService, agentProxy, notaryService),
+		operationsHandler:      operations.NewHandler(config.OperationManager, agentProxy, notaryService, config.RuntimeConfiguration, config.AgentOptions),
+		webSocketHandler:       websocket.NewHandler(config.ClusterService, config.RuntimeConfiguration, notaryService, policyService, config.KubeClient, config.ContainerPlatform),
+		hostHandler:            host.NewHandler(config.SystemService, agentProxy, notaryService, policyService, config.OperationManager, hostActionOrchestrator),
 		pingHandler:            ping.NewHandler(),
+		replicaHandler:         replica.NewHandler(security.NewReplicaService(config.AgentOptions.ReplicaToken), config.ContainerPlatform, config.EdgeManager),
+		resourcesHandler:       resources.NewHandler(agentProxy, notaryService),
+		retentionHandler:       retention.NewHandler(agentProxy, notaryService),
+		snapshotsHandler:       snapshots.NewHandler(agentProxy, notaryService),
+		stacksHandler:          stacks.NewHandler(agentProxy, notaryService, policyService, config.AgentOptions.RedactionPatterns),
+		webhooksHandler:        webhooks.NewHandler(security.NewWebhookService(config.AgentOptions.WebhookSecret, config.AgentOptions.RegistryWebhookToken, config.AgentOptions.ClockSkewTolerance), config.OperationManager, config.AgentOptions.RegistryAutoUpdate),
 		containerPlatform:      config.ContainerPlatform,
+		agentIdentity:          config.AgentIdentity,
 	}
+
+	if config.AgentOptions.GRPCAPI {
+		h.grpcHandler = notaryService.DigitalSignatureVerification(grpcapi.NewHandler(config.OperationManager, config.EdgeManager, config.ContainerPlatform, config.AgentIdentity))
+	}
+
+	if config.AgentOptions.IdempotencyWindow > 0 {
+		// The responses are only replayed to the clients allowed to send the request
+		h.idempotentHandler = notaryService.DigitalSignatureVerification(idempotency.NewCache(config.AgentOptions.IdempotencyWindow).Handler(http.HandlerFunc(h.route)))
+	}
+
+	return h
 }
 
 func (h *Handler) ServeHTTP(rw http.ResponseWriter, request *http.Request) {
@@ -88,9 +167,27 @@ func (h *Handler) ServeHTTP(rw http.ResponseWriter, request *http.Request) {
 		return
 	}
 
+	if h.grpcHandler != nil && grpcapi.IsGRPCRequest(request) {
+		h.grpcHandler.ServeHTTP(rw, request)
+		return
+	}
+
+	// The websocket sessions are not measured, they last as long as the consoles and the attachments
+	if request.Header.Get("Upgrade") == "" {
+		start := time.Now()
+		defer func() {
+			metrics.ObserveProxyRequest(time.Since(start))
+		}()
+
+		request = request.WithContext(metrics.WithRequestStart(request.Context(), start))
+	}
+
 	request.URL.Path = dockerAPIVersionRegexp.ReplaceAllString(request.URL.Path, "")
 	rw.Header().Set(agent.HTTPResponseAgentHeaderName, agent.Version)
 	rw.Header().Set(agent.HTTPResponseAgentApiVersion, agent.APIVersion)
+	if h.agentIdentity != nil {
+		rw.Header().Set(agent.HTTPAgentIdentityHeaderName, h.agentIdentity.ID)
+	}
 
 	// When the header is not set to PlatformDocker Portainer assumes the platform to be kubernetes.
 	// However, Portainer should handle podman agents the same way as docker agents.
@@ -98,8 +195,38 @@ func (h *Handler) ServeHTTP(rw http.ResponseWriter, request *http.Request) {
 	if h.containerPlatform == agent.PlatformPodman {
 		agentPlatformIdentifier = agent.PlatformDocker
 	}
+
+	// An agent managing the Kubernetes cluster running next to the Docker daemon is registered as two environments,
+	// the requests of the Kubernetes one target its platform
+	if agentPlatformIdentifier == agent.PlatformDocker && kubecli.UsesKubeconfig() &&
+		request.Header.Get(agent.HTTPTargetPlatformHeaderName) == strconv.Itoa(int(agent.PlatformKubernetes)) {
+		agentPlatformIdentifier = agent.PlatformKubernetes
+	}
 	rw.Header().Set(agent.HTTPResponseAgentPlatform, strconv.Itoa(int(agentPlatformIdentifier)))
 
+	if agentPlatformIdentifier == agent.PlatformDocker {
+		rw.Header().Set(agent.HTTPResponseAgentRuntime, agentdocker.CurrentRuntime().Name())
+	}
+
+	if h.idempotentHandler != nil && isIdempotentRequest(request) {
+		h.idempotentHandler.ServeHTTP(rw, request)
+		return
+	}
+
+	h.route(rw, request)
+}
+
+// isIdempotentRequest returns true when the response of the request must be replayed to its retries. The webhooks
+// and the replica API are not signed by the server and are never replayed.
+func isIdempotentRequest(request *http.Request) bool {
+	if request.Header.Get(idempotency.HeaderName) == "" || !idempotency.IsMutating(request) {
+		return false
+	}
+
+	return !strings.HasPrefix(request.URL.Path, "/webhooks") && !strings.HasPrefix(request.URL.Path, "/replica")
+}
+
+func (h *Handler) route(rw http.ResponseWriter, request *http.Request) {
 	switch {
 	case strings.HasPrefix(request.URL.Path, "/v1"):
 		h.ServeHTTPV1(rw, request)
@@ -109,10 +236,39 @@ func (h *Handler) ServeHTTP(rw http.ResponseWriter, request *http.Request) {
 		h.pingHandler.ServeHTTP(rw, request)
 	case strings.HasPrefix(request.URL.Path, "/agents"):
 		h.agentHandler.ServeHTTP(rw, request)
+	case strings.HasPrefix(request.URL.Path, "/actions"):
+		h.actionsHandler.ServeHTTP(rw, request)
+	case strings.HasPrefix(request.URL.Path, "/bandwidth"):
+		h.bandwidthHandler.ServeHTTP(rw, request)
+	case strings.HasPrefix(request.URL.Path, "/dependencies"):
+		h.dependenciesHandler.ServeHTTP(rw, request)
 	case strings.HasPrefix(request.URL.Path, "/host"):
 		h.hostHandler.ServeHTTP(rw, request)
 	case strings.HasPrefix(request.URL.Path, "/browse"):
 		h.browseHandler.ServeHTTP(rw, request)
+	case strings.HasPrefix(request.URL.Path, "/crashes"):
+		h.crashesHandler.ServeHTTP(rw, request)
+	case strings.HasPrefix(request.URL.Path, "/faults"):
+		h.faultsHandler.ServeHTTP(rw, request)
+	case request.URL.Path == "/config" || strings.HasPrefix(request.URL.Path, "/config/"):
+		// the Swarm configs (/configs) are served by the Docker API
+		h.configHandler.ServeHTTP(rw, request)
+	case strings.HasPrefix(request.URL.Path, "/logs"):
+		h.logsHandler.ServeHTTP(rw, request)
+	case strings.HasPrefix(request.URL.Path, "/operations"):
+		h.operationsHandler.ServeHTTP(rw, request)
+	case strings.HasPrefix(request.URL.Path, "/replica"):
+		h.replicaHandler.ServeHTTP(rw, request)
+	case strings.HasPrefix(request.URL.Path, "/resources"):
+		h.resourcesHandler.ServeHTTP(rw, request)
+	case strings.HasPrefix(request.URL.Path, "/retention"):
+		h.retentionHandler.ServeHTTP(rw, request)
+	case strings.HasPrefix(request.URL.Path, "/snapshots"):
+		h.snapshotsHandler.ServeHTTP(rw, request)
+	case strings.HasPrefix(request.URL.Path, "/stacks"):
+		h.stacksHandler.ServeHTTP(rw, request)
+	case strings.HasPrefix(request.URL.Path, "/webhooks"):
+		h.webhooksHandler.ServeHTTP(rw, request)
 	case strings.HasPrefix(request.URL.Path, "/websocket"):
 		h.webSocketHandler.ServeHTTP(rw, request)
 	case strings.HasPrefix(request.URL.Path, "/kubernetes"):
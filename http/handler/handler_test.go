@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	httpconfighandler "github.com/portainer/agent/http/handler/config"
+	"github.com/portainer/agent/http/handler/docker"
+)
+
+// recordingRouter returns a router recording the name of the handler serving the requests in served
+func recordingRouter(name string, served *string) *mux.Router {
+	router := mux.NewRouter()
+	router.PathPrefix("/").HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		*served = name
+	})
+
+	return router
+}
+
+func TestRouteConfig(t *testing.T) {
+	var served string
+
+	h := &Handler{
+		configHandler:      &httpconfighandler.Handler{Router: recordingRouter("config", &served)},
+		dockerProxyHandler: &docker.Handler{Router: recordingRouter("docker", &served)},
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{path: "/config", expected: "config"},
+		{path: "/config/profile", expected: "config"},
+		{path: "/config/proxy_policy", expected: "config"},
+		{path: "/configs", expected: "docker"},
+		{path: "/configs/create", expected: "docker"},
+		{path: "/configs/xk2m4d8v1p0y", expected: "docker"},
+		{path: "/configuration", expected: "docker"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			served = ""
+
+			h.route(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if served != tt.expected {
+				t.Errorf("expected the request to be served by the %s handler, got %q", tt.expected, served)
+			}
+		})
+	}
+}
@@ -12,12 +12,22 @@ func (h *Handler) ServeHTTPV2(rw http.ResponseWriter, request *http.Request) {
 		http.StripPrefix("/v2", h.pingHandler).ServeHTTP(rw, request)
 	case strings.HasPrefix(request.URL.Path, "/v2/agents"):
 		http.StripPrefix("/v2", h.agentHandler).ServeHTTP(rw, request)
+	case strings.HasPrefix(request.URL.Path, "/v2/actions"):
+		http.StripPrefix("/v2", h.actionsHandler).ServeHTTP(rw, request)
 	case strings.HasPrefix(request.URL.Path, "/v2/dockerhub"):
 		http.StripPrefix("/v2", h.dockerhubHandler).ServeHTTP(rw, request)
 	case strings.HasPrefix(request.URL.Path, "/v2/host"):
 		http.StripPrefix("/v2", h.hostHandler).ServeHTTP(rw, request)
 	case strings.HasPrefix(request.URL.Path, "/v2/browse"):
 		http.StripPrefix("/v2", h.browseHandler).ServeHTTP(rw, request)
+	case strings.HasPrefix(request.URL.Path, "/v2/config"):
+		http.StripPrefix("/v2", h.configHandler).ServeHTTP(rw, request)
+	case strings.HasPrefix(request.URL.Path, "/v2/operations"):
+		http.StripPrefix("/v2", h.operationsHandler).ServeHTTP(rw, request)
+	case strings.HasPrefix(request.URL.Path, "/v2/stacks"):
+		http.StripPrefix("/v2", h.stacksHandler).ServeHTTP(rw, request)
+	case strings.HasPrefix(request.URL.Path, "/v2/webhooks"):
+		http.StripPrefix("/v2", h.webhooksHandler).ServeHTTP(rw, request)
 	case strings.HasPrefix(request.URL.Path, "/v2/websocket"):
 		http.StripPrefix("/v2", h.webSocketHandler).ServeHTTP(rw, request)
 	case strings.HasPrefix(request.URL.Path, "/v2/kubernetes"):
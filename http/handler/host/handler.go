@@ -6,26 +6,69 @@ import (
 	"github.com/gorilla/mux"
 
 	"github.com/portainer/agent"
+	"github.com/portainer/agent/hostaction"
 	"github.com/portainer/agent/http/proxy"
 	"github.com/portainer/agent/http/security"
+	agentnet "github.com/portainer/agent/net"
+	"github.com/portainer/agent/operations"
 	httperror "github.com/portainer/portainer/pkg/libhttp/error"
 )
 
 // Handler represents an HTTP API Handler for host specific actions
 type Handler struct {
 	*mux.Router
-	systemService agent.SystemService
+	systemService    agent.SystemService
+	operationManager *operations.Manager
+	orchestrator     *hostaction.Orchestrator
 }
 
 // NewHandler returns a new instance of Handler
-func NewHandler(systemService agent.SystemService, agentProxy *proxy.AgentProxy, notaryService *security.NotaryService) *Handler {
+func NewHandler(systemService agent.SystemService, agentProxy *proxy.AgentProxy, notaryService *security.NotaryService, policyService *security.PolicyService, operationManager *operations.Manager, orchestrator *hostaction.Orchestrator) *Handler {
 	h := &Handler{
-		Router:        mux.NewRouter(),
-		systemService: systemService,
+		Router:           mux.NewRouter(),
+		systemService:    systemService,
+		operationManager: operationManager,
+		orchestrator:     orchestrator,
 	}
 
 	h.Handle("/host/info",
 		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.hostInfo)))).Methods(http.MethodGet)
+	h.Handle("/host/reboot",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(policyService.RequireOperation(agent.OperationHostReboot, h.hostAction(hostaction.ActionReboot))))).Methods(http.MethodPost)
+	h.Handle("/host/docker/restart",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(policyService.RequireOperation(agent.OperationDockerRestart, h.hostAction(hostaction.ActionDockerRestart))))).Methods(http.MethodPost)
+	h.Handle("/host/kubernetes/restart",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(policyService.RequireOperation(agent.OperationKubernetesRestart, h.hostAction(hostaction.ActionKubernetesRestart))))).Methods(http.MethodPost)
+	h.Handle("/host/os/update",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(policyService.RequireOperation(agent.OperationOSUpdate, httperror.LoggerHandler(h.osUpdate))))).Methods(http.MethodPost)
+	h.Handle("/host/os/update",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.osUpdateStatus)))).Methods(http.MethodGet)
+	h.Handle("/host/systemd",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.systemdUnits)))).Methods(http.MethodGet)
+	h.Handle("/host/systemd/{unit}/restart",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(policyService.RequireOperation(agent.OperationSystemdRestart, httperror.LoggerHandler(h.systemdUnitRestart))))).Methods(http.MethodPost)
+	h.Handle("/host/journal",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(policyService.RequireOperation(agent.OperationJournalQuery, agentnet.MeterHandler(agentnet.BandwidthLogStreams, httperror.LoggerHandler(h.hostJournal)))))).Methods(http.MethodGet)
+	h.Handle("/host/overlay",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.overlayNetworks)))).Methods(http.MethodGet)
+	h.Handle("/host/overlay/{client}/{action}",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(policyService.RequireOperation(agent.OperationOverlayControl, httperror.LoggerHandler(h.overlayControl))))).Methods(http.MethodPost)
+	h.Handle("/host/network_policy",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.networkPolicyInspect)))).Methods(http.MethodGet)
+	h.Handle("/host/network_policy",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(policyService.RequireOperation(agent.OperationNetworkPolicy, httperror.LoggerHandler(h.networkPolicyUpdate))))).Methods(http.MethodPut)
+	h.Handle("/host/port_forward",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.portForwardList)))).Methods(http.MethodGet)
+	h.Handle("/host/port_forward",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(policyService.RequireOperation(agent.OperationPortForward, httperror.LoggerHandler(h.portForwardOpen))))).Methods(http.MethodPost)
+	h.Handle("/host/port_forward/{id}",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(policyService.RequireOperation(agent.OperationPortForward, httperror.LoggerHandler(h.portForwardClose))))).Methods(http.MethodDelete)
+	h.Handle("/host/memory",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.memoryStatus)))).Methods(http.MethodGet)
+	h.Handle("/host/memory/zram",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(policyService.RequireOperation(agent.OperationZRAM, httperror.LoggerHandler(h.memoryZRAMApply))))).Methods(http.MethodPost)
+	h.Handle("/host/actions/last",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.hostActionLast)))).Methods(http.MethodGet)
 
 	return h
 }
@@ -0,0 +1,69 @@
+package host
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/portainer/agent/hostaction"
+	"github.com/portainer/agent/operations"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// hostAction returns the handler of the POST requests on /host/reboot, /host/docker/restart and
+// /host/kubernetes/restart.
+// The action is executed in a disruptive operation, optionally delayed until the scheduledAt query
+// parameter (RFC3339). It is refused with a HTTP 409 while a deployment is in progress.
+func (handler *Handler) hostAction(action string) httperror.LoggerHandler {
+	return func(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+		var scheduledAt time.Time
+
+		scheduledAtParam, _ := request.RetrieveQueryParameter(r, "scheduledAt", true)
+		if scheduledAtParam != "" {
+			var err error
+			scheduledAt, err = time.Parse(time.RFC3339, scheduledAtParam)
+			if err != nil {
+				return httperror.BadRequest("Invalid scheduledAt query parameter", err)
+			}
+
+			if scheduledAt.Before(time.Now()) {
+				return httperror.BadRequest("Invalid scheduledAt query parameter", errors.New("the scheduled time must be in the future"))
+			}
+		}
+
+		err := handler.orchestrator.CheckPreconditions()
+		if err != nil {
+			return &httperror.HandlerError{StatusCode: http.StatusConflict, Message: "Unable to execute the host action", Err: err}
+		}
+
+		requestedAt := time.Now()
+		op := handler.operationManager.StartDisruptive("host_"+action, func(ctx context.Context, progress *operations.Progress) (interface{}, error) {
+			if wait := time.Until(scheduledAt); wait > 0 {
+				progress.Update(0, "scheduled at "+scheduledAt.Format(time.RFC3339))
+
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(wait):
+				}
+			}
+
+			return nil, handler.orchestrator.Execute(ctx, action, requestedAt)
+		})
+
+		return response.JSON(rw, op)
+	}
+}
+
+// GET request on /host/actions/last
+func (handler *Handler) hostActionLast(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	record := hostaction.LastRecord()
+	if record == nil {
+		return httperror.NotFound("No host action was executed", errors.New("no host action record"))
+	}
+
+	return response.JSON(rw, record)
+}
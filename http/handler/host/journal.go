@@ -0,0 +1,71 @@
+package host
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/portainer/agent/systemd"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+
+	"github.com/rs/zerolog/log"
+)
+
+// flushWriter flushes the response after each write so that the entries are streamed to the client
+type flushWriter struct {
+	rw      http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (w *flushWriter) Write(p []byte) (int, error) {
+	n, err := w.rw.Write(p)
+	if w.flusher != nil {
+		w.flusher.Flush()
+	}
+
+	return n, err
+}
+
+// GET request on /host/journal?unit=:unit&priority=:priority&since=:since&until=:until&kernel=:kernel&lines=:lines
+// Streams the entries of the journal of the host matching the filters, the unit parameter can be repeated. since
+// and until are RFC3339 timestamps or durations before the query (e.g. 2h).
+func (handler *Handler) hostJournal(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	lines, err := request.RetrieveNumericQueryParameter(r, "lines", true)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: lines", err)
+	}
+
+	kernel, _ := request.RetrieveBooleanQueryParameter(r, "kernel", true)
+	priority, _ := request.RetrieveQueryParameter(r, "priority", true)
+	since, _ := request.RetrieveQueryParameter(r, "since", true)
+	until, _ := request.RetrieveQueryParameter(r, "until", true)
+
+	query := systemd.JournalQuery{
+		Units:    r.URL.Query()["unit"],
+		Priority: priority,
+		Since:    since,
+		Until:    until,
+		Kernel:   kernel,
+		Lines:    lines,
+	}
+
+	if err := query.Validate(); err != nil {
+		return httperror.BadRequest("Invalid journal query", err)
+	}
+
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	flusher, _ := rw.(http.Flusher)
+
+	err = systemd.QueryJournal(r.Context(), query, &flushWriter{rw: rw, flusher: flusher})
+	if errors.Is(err, systemd.ErrJournalDisabled) {
+		return httperror.NotFound("The journal of the host cannot be queried", err)
+	}
+
+	// the status is already sent once the entries are streamed
+	if err != nil && r.Context().Err() == nil {
+		log.Warn().Err(err).Msg("unable to query the journal of the host")
+	}
+
+	return nil
+}
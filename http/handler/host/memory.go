@@ -0,0 +1,40 @@
+package host
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/portainer/agent/memory"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+var errMemoryDisabled = errors.New("the memory service is not enabled")
+
+// GET request on /host/memory
+func (handler *Handler) memoryStatus(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	report := memory.CurrentStatus(r.Context())
+	if report == nil {
+		return httperror.NotFound("The memory report is not available", errMemoryDisabled)
+	}
+
+	return response.JSON(rw, report)
+}
+
+// POST request on /host/memory/zram
+// The recommended zram swap is configured until the next reboot of the host
+func (handler *Handler) memoryZRAMApply(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	service := memory.DefaultService()
+	if service == nil {
+		return httperror.NotFound("The memory report is not available", errMemoryDisabled)
+	}
+
+	err := service.ApplyRecommendation(r.Context())
+	if errors.Is(err, memory.ErrNoRecommendation) {
+		return &httperror.HandlerError{StatusCode: http.StatusConflict, Message: "Unable to configure the zram swap", Err: err}
+	} else if err != nil {
+		return httperror.InternalServerError("Unable to configure the zram swap", err)
+	}
+
+	return response.JSON(rw, service.Status(r.Context()))
+}
@@ -0,0 +1,70 @@
+package host
+
+import (
+	"net/http"
+
+	"github.com/portainer/agent/netpolicy"
+	"github.com/portainer/agent/schema"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+	"github.com/rs/zerolog/log"
+)
+
+type networkPolicyUpdatePayload struct {
+	// Policies replace the policies previously pushed by the server, an empty list removes them
+	Policies []netpolicy.Policy
+}
+
+func (payload *networkPolicyUpdatePayload) Validate(r *http.Request) error {
+	for i := range payload.Policies {
+		if err := payload.Policies[i].Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type networkPolicyInspectResponse struct {
+	// Policies are the policies pushed by the server
+	Policies []netpolicy.Policy
+	// Report is the state of the policies enforced on the running containers, from their labels and the server
+	Report *netpolicy.Report
+}
+
+// GET request on /host/network_policy
+func (handler *Handler) networkPolicyInspect(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	enforcer := netpolicy.DefaultEnforcer()
+	if enforcer == nil {
+		return httperror.NotFound("The network policies are not enabled", netpolicy.ErrDisabled)
+	}
+
+	return response.JSON(rw, networkPolicyInspectResponse{
+		Policies: enforcer.ServerPolicies(),
+		Report:   enforcer.Report(),
+	})
+}
+
+// PUT request on /host/network_policy
+// The policies replace the previously pushed ones and are applied immediately
+func (handler *Handler) networkPolicyUpdate(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	enforcer := netpolicy.DefaultEnforcer()
+	if enforcer == nil {
+		return httperror.NotFound("The network policies are not enabled", netpolicy.ErrDisabled)
+	}
+
+	var payload networkPolicyUpdatePayload
+	err := schema.DecodeAndValidateJSONPayload(r, schema.APINetworkPolicy, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	err = enforcer.UpdateServerPolicies(r.Context(), payload.Policies)
+	if err != nil {
+		return httperror.InternalServerError("Unable to apply the network policies", err)
+	}
+
+	log.Info().Int("policies", len(payload.Policies)).Msg("network policies updated")
+
+	return response.Empty(rw)
+}
@@ -0,0 +1,61 @@
+package host
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/portainer/agent/operations"
+	"github.com/portainer/agent/osupdate"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type osUpdatePayload struct {
+	// Artifact is the bundle path or URL for rauc, mender and swupdate, or the space-separated list of the
+	// packages to upgrade for apt (all the packages when empty)
+	Artifact string
+}
+
+func (payload *osUpdatePayload) Validate(r *http.Request) error {
+	return nil
+}
+
+// POST request on /host/os/update
+func (handler *Handler) osUpdate(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	var payload osUpdatePayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	err = osupdate.ValidateArtifact(payload.Artifact)
+	if errors.Is(err, osupdate.ErrDisabled) {
+		return httperror.NotFound("OS updates are disabled", err)
+	} else if err != nil {
+		return httperror.BadRequest("Invalid artifact", err)
+	}
+
+	if status := osupdate.CurrentStatus(); status != nil && status.State == osupdate.StateRunning {
+		return &httperror.HandlerError{StatusCode: http.StatusConflict, Message: "Unable to start the OS update", Err: osupdate.ErrUpdateInProgress}
+	}
+
+	op := handler.operationManager.StartDisruptive("os_update", func(ctx context.Context, progress *operations.Progress) (interface{}, error) {
+		err := osupdate.Run(ctx, payload.Artifact, progress.Update)
+
+		return osupdate.CurrentStatus(), err
+	})
+
+	return response.JSON(rw, op)
+}
+
+// GET request on /host/os/update
+func (handler *Handler) osUpdateStatus(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	status := osupdate.CurrentStatus()
+	if status == nil {
+		return httperror.NotFound("No OS update was applied", errors.New("no OS update status"))
+	}
+
+	return response.JSON(rw, status)
+}
@@ -0,0 +1,68 @@
+package host
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/portainer/agent/overlay"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type overlayControlPayload struct {
+	// Network is the WireGuard interface or the ZeroTier network identifier, empty for Tailscale
+	Network string
+}
+
+func (payload *overlayControlPayload) Validate(r *http.Request) error {
+	return nil
+}
+
+// GET request on /host/overlay
+func (handler *Handler) overlayNetworks(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	networks := overlay.CurrentStatus(r.Context())
+	if networks == nil {
+		return httperror.NotFound("The overlay networks cannot be managed", overlay.ErrDisabled)
+	}
+
+	return response.JSON(rw, networks)
+}
+
+// POST request on /host/overlay/{client}/{action}
+func (handler *Handler) overlayControl(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	client, err := request.RetrieveRouteVariableValue(r, "client")
+	if err != nil {
+		return httperror.BadRequest("Invalid client route variable", err)
+	}
+
+	action, err := request.RetrieveRouteVariableValue(r, "action")
+	if err != nil {
+		return httperror.BadRequest("Invalid action route variable", err)
+	}
+
+	var payload overlayControlPayload
+	err = request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	overlayClient, err := overlay.Get(client)
+	if err != nil {
+		return httperror.NotFound("Unknown overlay client", err)
+	}
+
+	if _, err := overlayClient.ControlCommand(action, payload.Network); err != nil {
+		return httperror.BadRequest("Invalid overlay network action", err)
+	}
+
+	err = overlay.Control(r.Context(), client, action, payload.Network)
+	switch {
+	case errors.Is(err, overlay.ErrDisabled), errors.Is(err, overlay.ErrClientNotInstalled):
+		return httperror.NotFound("Unable to update the overlay network", err)
+	case err != nil:
+		return httperror.InternalServerError("Unable to update the overlay network", err)
+	}
+
+	return response.Empty(rw)
+}
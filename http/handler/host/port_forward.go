@@ -0,0 +1,90 @@
+package host
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/portforward"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type portForwardOpenPayload struct {
+	// Target is the host:port address of the TCP service of the device, e.g. 192.168.1.20:80
+	Target string
+	// DurationSeconds is the duration of the session, the maximum duration configured on the agent when zero
+	DurationSeconds int
+}
+
+func (payload *portForwardOpenPayload) Validate(r *http.Request) error {
+	if payload.Target == "" {
+		return errors.New("Missing target")
+	}
+
+	if payload.DurationSeconds < 0 {
+		return errors.New("Invalid duration")
+	}
+
+	return nil
+}
+
+// GET request on /host/port_forward
+func (handler *Handler) portForwardList(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	broker := portforward.DefaultBroker()
+	if broker == nil {
+		return httperror.NotFound("The port forwarding is not enabled", portforward.ErrDisabled)
+	}
+
+	return response.JSON(rw, broker.Sessions())
+}
+
+// POST request on /host/port_forward
+// The connections to the target are then opened with the websocket of /websocket/portforward?id=<session>
+func (handler *Handler) portForwardOpen(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	broker := portforward.DefaultBroker()
+	if broker == nil {
+		return httperror.NotFound("The port forwarding is not enabled", portforward.ErrDisabled)
+	}
+
+	var payload portForwardOpenPayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	duration := time.Duration(payload.DurationSeconds) * time.Second
+
+	session, err := broker.Open(r.Context(), payload.Target, duration, r.Header.Get(agent.HTTPResourceOwnerHeaderName), r.RemoteAddr)
+	switch {
+	case errors.Is(err, portforward.ErrSessionLimit):
+		return httperror.NewError(http.StatusTooManyRequests, "Unable to open the port-forward session", err)
+	case errors.Is(err, portforward.ErrTargetNotAllowed):
+		return httperror.Forbidden("Unable to open the port-forward session", err)
+	case err != nil:
+		return httperror.BadRequest("Unable to open the port-forward session", err)
+	}
+
+	return response.JSON(rw, session)
+}
+
+// DELETE request on /host/port_forward/{id}
+func (handler *Handler) portForwardClose(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	broker := portforward.DefaultBroker()
+	if broker == nil {
+		return httperror.NotFound("The port forwarding is not enabled", portforward.ErrDisabled)
+	}
+
+	id, err := request.RetrieveRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid id route variable", err)
+	}
+
+	if err := broker.Close(id); err != nil {
+		return httperror.NotFound("Unable to close the port-forward session", err)
+	}
+
+	return response.Empty(rw)
+}
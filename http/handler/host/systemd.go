@@ -0,0 +1,45 @@
+package host
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/portainer/agent/systemd"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// GET request on /host/systemd
+func (handler *Handler) systemdUnits(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	status, err := systemd.CurrentStatus(r.Context())
+	if err != nil {
+		return httperror.InternalServerError("Unable to retrieve the status of the systemd units", err)
+	}
+
+	if status == nil {
+		return httperror.NotFound("No systemd unit is monitored", systemd.ErrDisabled)
+	}
+
+	return response.JSON(rw, status)
+}
+
+// POST request on /host/systemd/{unit}/restart
+func (handler *Handler) systemdUnitRestart(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	unit, err := request.RetrieveRouteVariableValue(r, "unit")
+	if err != nil {
+		return httperror.BadRequest("Invalid unit route variable", err)
+	}
+
+	err = systemd.Restart(r.Context(), unit)
+	switch {
+	case errors.Is(err, systemd.ErrDisabled):
+		return httperror.NotFound("No systemd unit is monitored", err)
+	case errors.Is(err, systemd.ErrUnitNotAllowed), errors.Is(err, systemd.ErrAgentUnit):
+		return httperror.Forbidden("Unable to restart the systemd unit", err)
+	case err != nil:
+		return httperror.InternalServerError("Unable to restart the systemd unit", err)
+	}
+
+	return response.Empty(rw)
+}
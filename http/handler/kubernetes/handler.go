@@ -24,6 +24,8 @@ func NewHandler(notaryService *security.NotaryService, kubernetesDeployer *exec.
 
 	h.Handle("/kubernetes/stack",
 		notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.kubernetesDeploy))).Methods(http.MethodPost)
+	h.Handle("/kubernetes/kubeconfig",
+		notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.kubeconfigIssue))).Methods(http.MethodPost)
 
 	return h
 }
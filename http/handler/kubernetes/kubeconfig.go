@@ -0,0 +1,89 @@
+package kubernetes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/audit"
+	kubecli "github.com/portainer/agent/kubernetes"
+
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+	"github.com/rs/zerolog/log"
+)
+
+// defaultKubeconfigExpiration is the validity of a kubeconfig when the request does not specify it
+const defaultKubeconfigExpiration = time.Hour
+
+type kubeconfigPayload struct {
+	// Role is the role of the Portainer user, admin, operator or readonly
+	Role      string
+	Namespace string
+	// ExpirationSeconds is the validity of the kubeconfig, one hour when zero
+	ExpirationSeconds int
+	// ServerURL is the URL of the API server reachable by kubectl, the in-cluster URL is used when empty
+	ServerURL string
+}
+
+func (payload *kubeconfigPayload) Validate(r *http.Request) error {
+	if payload.Role == "" {
+		return errors.New("Missing role")
+	}
+
+	if payload.Namespace == "" {
+		return errors.New("Missing namespace")
+	}
+
+	return nil
+}
+
+func (handler *Handler) kubeconfigIssue(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	var payload kubeconfigPayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	expiration := defaultKubeconfigExpiration
+	if payload.ExpirationSeconds != 0 {
+		expiration = time.Duration(payload.ExpirationSeconds) * time.Second
+	}
+
+	user := r.Header.Get(agent.HTTPResourceOwnerHeaderName)
+
+	req := kubecli.KubeconfigRequest{
+		Role:       payload.Role,
+		Namespace:  payload.Namespace,
+		User:       user,
+		Expiration: expiration,
+		ServerURL:  payload.ServerURL,
+	}
+
+	err = kubecli.ValidateKubeconfigRequest(req)
+	if err != nil {
+		return httperror.BadRequest("Invalid kubeconfig request", err)
+	}
+
+	kubeconfig, err := kubecli.IssueKubeconfig(r.Context(), req)
+	if err != nil {
+		return httperror.InternalServerError("Unable to issue the kubeconfig", err)
+	}
+
+	audit.RecordIssue(audit.SessionKubeconfig, kubeconfig.ServiceAccount,
+		fmt.Sprintf("role=%s expires_at=%s", payload.Role, kubeconfig.ExpiresAt.UTC().Format(time.RFC3339)),
+		user, r.RemoteAddr)
+
+	log.Info().
+		Str("user", user).
+		Str("remote_addr", r.RemoteAddr).
+		Str("service_account", kubeconfig.ServiceAccount).
+		Str("role", payload.Role).
+		Time("expires_at", kubeconfig.ExpiresAt).
+		Msg("kubeconfig issued")
+
+	return response.JSON(rw, kubeconfig)
+}
@@ -5,9 +5,9 @@ import (
 	"net/http"
 
 	"github.com/portainer/agent"
+	"github.com/portainer/agent/schema"
 
 	httperror "github.com/portainer/portainer/pkg/libhttp/error"
-	"github.com/portainer/portainer/pkg/libhttp/request"
 	"github.com/portainer/portainer/pkg/libhttp/response"
 )
 
@@ -32,7 +32,7 @@ func (payload *deployPayload) Validate(r *http.Request) error {
 
 func (handler *Handler) kubernetesDeploy(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
 	var payload deployPayload
-	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	err := schema.DecodeAndValidateJSONPayload(r, schema.APIKubernetesDeploy, &payload)
 	if err != nil {
 		return httperror.BadRequest("Invalid request payload", err)
 	}
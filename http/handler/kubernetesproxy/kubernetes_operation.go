@@ -6,11 +6,20 @@ import (
 	"os"
 
 	"github.com/portainer/agent"
+	"github.com/portainer/agent/kubernetes"
 	httperror "github.com/portainer/portainer/pkg/libhttp/error"
 )
 
 func (handler *Handler) kubernetesOperation(rw http.ResponseWriter, request *http.Request) *httperror.HandlerError {
 	token := request.Header.Get(agent.HTTPKubernetesSATokenHeaderName)
+
+	// the transport of a cluster running next to the Docker daemon authenticates with the kubeconfig credentials
+	if token == "" && kubernetes.UsesKubeconfig() {
+		request.Header.Del("Authorization")
+		http.StripPrefix("/kubernetes", handler.kubernetesProxy).ServeHTTP(rw, request)
+		return nil
+	}
+
 	if token == "" {
 		adminToken, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/token")
 		if err != nil {
@@ -0,0 +1,38 @@
+package logs
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/http/proxy"
+	"github.com/portainer/agent/http/security"
+	agentnet "github.com/portainer/agent/net"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+)
+
+// Handler represents an HTTP API Handler for aggregating the logs of Swarm services
+type Handler struct {
+	*mux.Router
+	clusterService       agent.ClusterService
+	runtimeConfiguration *agent.RuntimeConfiguration
+	useTLS               bool
+	client               *http.Client
+}
+
+// NewHandler returns a new instance of Handler
+func NewHandler(clusterService agent.ClusterService, config *agent.RuntimeConfiguration, notaryService *security.NotaryService, useTLS bool) *Handler {
+	h := &Handler{
+		Router:               mux.NewRouter(),
+		clusterService:       clusterService,
+		runtimeConfiguration: config,
+		useTLS:               useTLS,
+		client:               proxy.NewMemberClient(),
+	}
+
+	h.Handle("/logs/services/{id}",
+		notaryService.DigitalSignatureVerification(agentnet.MeterHandler(agentnet.BandwidthLogStreams, httperror.LoggerHandler(h.serviceLogs)))).Methods(http.MethodGet)
+
+	return h
+}
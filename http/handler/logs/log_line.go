@@ -0,0 +1,130 @@
+package logs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type logLine struct {
+	prefix       string
+	timestamp    time.Time
+	rawTimestamp string
+	message      string
+}
+
+// parseLogLine splits a log line into the timestamp added by Docker and its message
+func parseLogLine(prefix, text string) logLine {
+	text = strings.TrimSuffix(text, "\r")
+	line := logLine{prefix: prefix, message: text}
+
+	rawTimestamp, message, _ := strings.Cut(text, " ")
+
+	timestamp, err := time.Parse(time.RFC3339Nano, rawTimestamp)
+	if err != nil {
+		return line
+	}
+
+	line.timestamp = timestamp
+	line.rawTimestamp = rawTimestamp
+	line.message = message
+
+	return line
+}
+
+func (line logLine) format(timestamps bool) string {
+	if timestamps && line.rawTimestamp != "" {
+		return fmt.Sprintf("%s | %s %s\n", line.prefix, line.rawTimestamp, line.message)
+	}
+
+	return fmt.Sprintf("%s | %s\n", line.prefix, line.message)
+}
+
+// mergeLogLines emits the lines of the streams ordered by timestamp as they are read, keeping the order of the lines
+// of a same stream. The lines of each stream are ordered by Docker, only the next line of each stream is held.
+func mergeLogLines(streams []<-chan logLine, emit func(logLine) error) error {
+	heads := make([]*logLine, len(streams))
+
+	next := func(i int) {
+		line, ok := <-streams[i]
+		if !ok {
+			heads[i] = nil
+			return
+		}
+
+		heads[i] = &line
+	}
+
+	for i := range streams {
+		next(i)
+	}
+
+	for {
+		earliest := -1
+		for i, head := range heads {
+			if head != nil && (earliest < 0 || head.timestamp.Before(heads[earliest].timestamp)) {
+				earliest = i
+			}
+		}
+
+		if earliest < 0 {
+			return nil
+		}
+
+		if err := emit(*heads[earliest]); err != nil {
+			return err
+		}
+
+		next(earliest)
+	}
+}
+
+// lineWriter sends each complete line written to it
+type lineWriter struct {
+	ctx    context.Context
+	prefix string
+	lines  chan<- logLine
+	buffer []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buffer = append(w.buffer, p...)
+
+	for {
+		i := bytes.IndexByte(w.buffer, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+
+		text := string(w.buffer[:i])
+		w.buffer = w.buffer[i+1:]
+
+		err := w.send(text)
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// flush sends the last line when it is not terminated by a new line
+func (w *lineWriter) flush() error {
+	if len(w.buffer) == 0 {
+		return nil
+	}
+
+	text := string(w.buffer)
+	w.buffer = nil
+
+	return w.send(text)
+}
+
+func (w *lineWriter) send(text string) error {
+	select {
+	case w.lines <- parseLogLine(w.prefix, text):
+		return nil
+	case <-w.ctx.Done():
+		return w.ctx.Err()
+	}
+}
@@ -0,0 +1,84 @@
+package logs
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLineWriter(t *testing.T) {
+	lines := make(chan logLine, 10)
+	w := &lineWriter{ctx: context.Background(), prefix: "web.1.abc@node1", lines: lines}
+
+	w.Write([]byte("2023-09-01T10:00:00.000000002Z first\n2023-09-01T10:00:00.000000001Z sec"))
+	w.Write([]byte("ond\r\nnot a timestamp"))
+	w.flush()
+	close(lines)
+
+	expected := []string{
+		"web.1.abc@node1 | 2023-09-01T10:00:00.000000002Z first\n",
+		"web.1.abc@node1 | 2023-09-01T10:00:00.000000001Z second\n",
+		"web.1.abc@node1 | not a timestamp\n",
+	}
+
+	collected := []logLine{}
+	for line := range lines {
+		collected = append(collected, line)
+	}
+
+	if len(collected) != len(expected) {
+		t.Fatalf("expected %d lines, got %d", len(expected), len(collected))
+	}
+
+	for i, line := range collected {
+		if got := line.format(true); got != expected[i] {
+			t.Errorf("line %d: expected %q, got %q", i, expected[i], got)
+		}
+	}
+
+	if got := collected[0].format(false); got != "web.1.abc@node1 | first\n" {
+		t.Errorf("unexpected line without timestamp %q", got)
+	}
+}
+
+func TestMergeLogLines(t *testing.T) {
+	stream := func(texts ...string) <-chan logLine {
+		lines := make(chan logLine)
+
+		go func() {
+			defer close(lines)
+
+			for _, text := range texts {
+				lines <- parseLogLine("", text)
+			}
+		}()
+
+		return lines
+	}
+
+	streams := []<-chan logLine{
+		stream("2023-09-01T10:00:02Z third", "2023-09-01T10:00:04Z fifth"),
+		stream("2023-09-01T10:00:01Z first", "2023-09-01T10:00:01Z second", "2023-09-01T10:00:03Z fourth"),
+		stream(),
+	}
+
+	merged := []string{}
+	err := mergeLogLines(streams, func(line logLine) error {
+		merged = append(merged, line.message)
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"first", "second", "third", "fourth", "fifth"}
+	if len(merged) != len(expected) {
+		t.Fatalf("expected %d lines, got %v", len(expected), merged)
+	}
+
+	for i := range expected {
+		if merged[i] != expected[i] {
+			t.Errorf("line %d: expected %q, got %q", i, expected[i], merged[i])
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package logs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/http/proxy"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/rs/zerolog/log"
+)
+
+// GET request on /logs/services/{id}?follow=<follow>&tail=<tail>&since=<since>&timestamps=<timestamps>
+// Aggregates the logs of all the tasks of a Swarm service, the logs of each task being retrieved from the agent of
+// the node running it. Each line is prefixed with the name of the task and its node. Unless the logs are followed,
+// the lines are ordered by timestamp, they are merged from the streams of the tasks as they are read and are never
+// held in memory.
+func (handler *Handler) serviceLogs(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	if handler.clusterService != nil && handler.runtimeConfiguration.DockerConfiguration.NodeRole != agent.NodeRoleManager {
+		targetMember := handler.clusterService.GetMemberByRole(agent.NodeRoleManager)
+		if targetMember == nil {
+			return httperror.InternalServerError("The agent was unable to contact any other agent located on a manager node", errors.New("Unable to find an agent on any manager node"))
+		}
+
+		proxy.AgentHTTPRequest(rw, r, targetMember, handler.useTLS)
+		return nil
+	}
+
+	serviceID, err := request.RetrieveRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid service identifier route variable", err)
+	}
+
+	follow, _ := request.RetrieveBooleanQueryParameter(r, "follow", true)
+	timestamps, _ := request.RetrieveBooleanQueryParameter(r, "timestamps", true)
+	tail, _ := request.RetrieveQueryParameter(r, "tail", true)
+	since, _ := request.RetrieveQueryParameter(r, "since", true)
+
+	tasks, err := docker.GetServiceTaskContainers(r.Context(), serviceID)
+	if err != nil {
+		return httperror.InternalServerError("Unable to retrieve the service tasks", err)
+	}
+
+	options := types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Timestamps: true,
+		Follow:     follow,
+		Tail:       tail,
+		Since:      since,
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	// the followed lines are written as they come, the others are merged from one stream per task
+	lines := make(chan logLine)
+	streams := make([]<-chan logLine, 0, len(tasks))
+
+	wg := &sync.WaitGroup{}
+	for _, task := range tasks {
+		taskLines := lines
+		if !follow {
+			taskLines = make(chan logLine)
+			streams = append(streams, taskLines)
+		}
+
+		wg.Add(1)
+
+		go func(task docker.ServiceTaskContainer, taskLines chan logLine) {
+			defer wg.Done()
+
+			if !follow {
+				defer close(taskLines)
+			}
+
+			err := handler.readTaskLogs(ctx, r, task, options, taskLines)
+			if err != nil && ctx.Err() == nil {
+				log.Warn().Err(err).
+					Str("task", task.ID).
+					Str("node", task.NodeName).
+					Msg("unable to retrieve the task logs")
+			}
+		}(task, taskLines)
+	}
+
+	go func() {
+		wg.Wait()
+		close(lines)
+	}()
+
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	if !follow {
+		// the readers of the tasks blocked on a line are stopped by the cancellation of ctx when the client is gone
+		mergeLogLines(streams, func(line logLine) error {
+			_, err := io.WriteString(rw, line.format(timestamps))
+
+			return err
+		})
+
+		return nil
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	flusher, _ := rw.(http.Flusher)
+
+	for line := range lines {
+		_, err := io.WriteString(rw, line.format(timestamps))
+		if err != nil {
+			return nil
+		}
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	return nil
+}
+
+// readTaskLogs sends the lines of the logs of the task until they are fully read or ctx is done
+func (handler *Handler) readTaskLogs(ctx context.Context, r *http.Request, task docker.ServiceTaskContainer, options types.ContainerLogsOptions, lines chan<- logLine) error {
+	logs, err := handler.openTaskLogs(ctx, r, task, options)
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+
+	prefix := fmt.Sprintf("%s.%s@%s", task.Name, task.ID, task.NodeName)
+	stdout := &lineWriter{ctx: ctx, prefix: prefix, lines: lines}
+	stderr := &lineWriter{ctx: ctx, prefix: prefix, lines: lines}
+
+	if task.TTY {
+		_, err = io.Copy(stdout, logs)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, logs)
+	}
+
+	if flushErr := stdout.flush(); err == nil {
+		err = flushErr
+	}
+
+	if flushErr := stderr.flush(); err == nil {
+		err = flushErr
+	}
+
+	return err
+}
+
+// openTaskLogs returns the logs of the container of the task, from the local Docker engine or through the agent of
+// the node running the task
+func (handler *Handler) openTaskLogs(ctx context.Context, r *http.Request, task docker.ServiceTaskContainer, options types.ContainerLogsOptions) (io.ReadCloser, error) {
+	if handler.clusterService == nil || task.NodeName == handler.runtimeConfiguration.NodeName {
+		return docker.ContainerLogs(ctx, task.ContainerID, options)
+	}
+
+	member := handler.clusterService.GetMemberByNodeName(task.NodeName)
+	if member == nil {
+		return nil, fmt.Errorf("unable to find the agent of the node %s", task.NodeName)
+	}
+
+	query := url.Values{}
+	query.Set("stdout", "1")
+	query.Set("stderr", "1")
+	query.Set("timestamps", "1")
+	query.Set("follow", fmt.Sprint(options.Follow))
+	query.Set("tail", options.Tail)
+	query.Set("since", options.Since)
+
+	logsRequest, err := proxy.NewMemberRequest(ctx, r, member, handler.useTLS, http.MethodGet, fmt.Sprintf("/containers/%s/logs", task.ContainerID), query, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := handler.client.Do(logsRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status code %d from the agent of the node %s", resp.StatusCode, task.NodeName)
+	}
+
+	return resp.Body, nil
+}
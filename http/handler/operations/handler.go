@@ -0,0 +1,60 @@
+package operations
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/http/proxy"
+	"github.com/portainer/agent/http/security"
+	"github.com/portainer/agent/operations"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+)
+
+// Handler represents an HTTP API Handler for long-running operations
+type Handler struct {
+	*mux.Router
+	operationManager     *operations.Manager
+	runtimeConfiguration *agent.RuntimeConfiguration
+	agentOptions         *agent.Options
+}
+
+// NewHandler returns a new instance of Handler
+func NewHandler(operationManager *operations.Manager, agentProxy *proxy.AgentProxy, notaryService *security.NotaryService, runtimeConfiguration *agent.RuntimeConfiguration, agentOptions *agent.Options) *Handler {
+	h := &Handler{
+		Router:               mux.NewRouter(),
+		operationManager:     operationManager,
+		runtimeConfiguration: runtimeConfiguration,
+		agentOptions:         agentOptions,
+	}
+
+	h.Handle("/operations",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.operationList)))).Methods(http.MethodGet)
+	h.Handle("/operations/apply",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.operationApply)))).Methods(http.MethodPost)
+	h.Handle("/operations/image_build",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.operationImageBuild)))).Methods(http.MethodPost)
+	h.Handle("/operations/image_pull",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.operationImagePull)))).Methods(http.MethodPost)
+	h.Handle("/operations/image_prepull",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.operationImagePrePull)))).Methods(http.MethodPost)
+	h.Handle("/operations/node_drain",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.operationNodeDrain)))).Methods(http.MethodPost)
+	h.Handle("/operations/prune",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.operationPrune)))).Methods(http.MethodPost)
+	h.Handle("/operations/stack_deploy",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.operationStackDeploy)))).Methods(http.MethodPost)
+	h.Handle("/operations/volume_backup",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.operationVolumeBackup)))).Methods(http.MethodPost)
+	h.Handle("/operations/volume_restore",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.operationVolumeRestore)))).Methods(http.MethodPost)
+	h.Handle("/operations/{id}",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.operationInspect)))).Methods(http.MethodGet)
+	h.Handle("/operations/{id}/events",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.operationEvents)))).Methods(http.MethodGet)
+	h.Handle("/operations/{id}",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.operationCancel)))).Methods(http.MethodDelete)
+
+	return h
+}
@@ -0,0 +1,62 @@
+package operations
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/portainer/agent/declarative"
+	"github.com/portainer/agent/operations"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type applyPayload struct {
+	declarative.Spec
+}
+
+func (payload *applyPayload) Validate(r *http.Request) error {
+	return payload.Spec.Validate()
+}
+
+// POST request on /operations/apply?dryRun=true
+// Reconciles the stacks, networks, volumes and schedules of the host toward the spec. The changes are returned
+// without being applied when dryRun is true, they are applied by an operation otherwise.
+func (handler *Handler) operationApply(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	var payload applyPayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	dryRun, _ := request.RetrieveBooleanQueryParameter(r, "dryRun", true)
+
+	deployer, err := handler.stackDeployer()
+	if err != nil {
+		return httperror.InternalServerError("Unable to initialize the stack deployer", err)
+	}
+
+	reconciler := declarative.NewReconciler(handler.agentOptions.DataPath, deployer)
+
+	if dryRun {
+		plan, err := reconciler.Plan(r.Context(), &payload.Spec)
+		if err != nil {
+			return httperror.InternalServerError("Unable to plan the changes", err)
+		}
+
+		return response.JSON(rw, plan)
+	}
+
+	op := handler.operationManager.StartDisruptive("apply", func(ctx context.Context, progress *operations.Progress) (interface{}, error) {
+		plan, err := reconciler.Apply(ctx, &payload.Spec, func(message string) {
+			progress.Update(0, message)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return plan, nil
+	})
+
+	return response.JSON(rw, op)
+}
@@ -0,0 +1,28 @@
+package operations
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/portainer/agent/operations"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// DELETE request on /operations/{id}
+func (handler *Handler) operationCancel(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	operationID, err := request.RetrieveRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid operation identifier route variable", err)
+	}
+
+	err = handler.operationManager.Cancel(operationID)
+	if errors.Is(err, operations.ErrOperationNotFound) {
+		return httperror.NotFound("Unable to find the operation", err)
+	} else if err != nil {
+		return httperror.InternalServerError("Unable to cancel the operation", err)
+	}
+
+	return response.Empty(rw)
+}
@@ -0,0 +1,59 @@
+package operations
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/portainer/agent/operations"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+)
+
+// GET request on /operations/{id}/events
+// The state of the operation is streamed as server-sent events until the operation is finished.
+func (handler *Handler) operationEvents(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	operationID, err := request.RetrieveRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid operation identifier route variable", err)
+	}
+
+	updates, unsubscribe, err := handler.operationManager.Subscribe(operationID)
+	if errors.Is(err, operations.ErrOperationNotFound) {
+		return httperror.NotFound("Unable to find the operation", err)
+	} else if err != nil {
+		return httperror.InternalServerError("Unable to subscribe to the operation", err)
+	}
+	defer unsubscribe()
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.WriteHeader(http.StatusOK)
+
+	flusher, _ := rw.(http.Flusher)
+
+	for {
+		select {
+		case op, ok := <-updates:
+			if !ok {
+				return nil
+			}
+
+			data, err := json.Marshal(op)
+			if err != nil {
+				return nil
+			}
+
+			if _, err := fmt.Fprintf(rw, "event: %s\ndata: %s\n\n", op.Status, data); err != nil {
+				return nil
+			}
+
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-r.Context().Done():
+			return nil
+		}
+	}
+}
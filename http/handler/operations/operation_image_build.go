@@ -0,0 +1,60 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/operations"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type imageBuildPayload struct {
+	Tags []string
+	// Dockerfile is the content of the Dockerfile, used when RemoteContext is not set
+	Dockerfile string
+	// RemoteContext is the URL of a Git repository or of a tarball used as the build context
+	RemoteContext string
+	BuildArgs     map[string]string
+}
+
+func (payload *imageBuildPayload) Validate(r *http.Request) error {
+	if len(payload.Tags) == 0 {
+		return errors.New("Missing image tags")
+	}
+
+	if (payload.Dockerfile == "") == (payload.RemoteContext == "") {
+		return errors.New("Either a Dockerfile or a remote context must be specified")
+	}
+
+	return nil
+}
+
+// POST request on /operations/image_build
+func (handler *Handler) operationImageBuild(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	var payload imageBuildPayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	buildArgs := map[string]*string{}
+	for name, value := range payload.BuildArgs {
+		value := value
+		buildArgs[name] = &value
+	}
+
+	op := handler.operationManager.Start("image_build", func(ctx context.Context, progress *operations.Progress) (interface{}, error) {
+		return nil, docker.ImageBuildWithProgress(ctx, docker.BuildOptions{
+			Tags:          payload.Tags,
+			Dockerfile:    payload.Dockerfile,
+			RemoteContext: payload.RemoteContext,
+			BuildArgs:     buildArgs,
+		}, progress.Update)
+	})
+
+	return response.JSON(rw, op)
+}
@@ -0,0 +1,49 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/operations"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type imagePrePullPayload struct {
+	Images []string
+}
+
+func (payload *imagePrePullPayload) Validate(r *http.Request) error {
+	if len(payload.Images) == 0 {
+		return errors.New("Missing images")
+	}
+
+	for _, image := range payload.Images {
+		if image == "" {
+			return errors.New("Invalid image")
+		}
+	}
+
+	return nil
+}
+
+// POST request on /operations/image_prepull
+// The result of the operation is the status of the pull of each image, it is updated while the images are pulled
+func (handler *Handler) operationImagePrePull(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	var payload imagePrePullPayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	op := handler.operationManager.Start("image_prepull", func(ctx context.Context, progress *operations.Progress) (interface{}, error) {
+		return docker.PrePullImages(ctx, payload.Images, func(percent int, message string, statuses []docker.ImagePullStatus) {
+			progress.UpdateResult(percent, message, statuses)
+		})
+	})
+
+	return response.JSON(rw, op)
+}
@@ -0,0 +1,40 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/operations"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type imagePullPayload struct {
+	Image string
+}
+
+func (payload *imagePullPayload) Validate(r *http.Request) error {
+	if payload.Image == "" {
+		return errors.New("Missing image")
+	}
+
+	return nil
+}
+
+// POST request on /operations/image_pull
+func (handler *Handler) operationImagePull(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	var payload imagePullPayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	op := handler.operationManager.Start("image_pull", func(ctx context.Context, progress *operations.Progress) (interface{}, error) {
+		return nil, docker.ImagePullWithProgress(ctx, payload.Image, progress.Update)
+	})
+
+	return response.JSON(rw, op)
+}
@@ -0,0 +1,28 @@
+package operations
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/portainer/agent/operations"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// GET request on /operations/{id}
+func (handler *Handler) operationInspect(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	operationID, err := request.RetrieveRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid operation identifier route variable", err)
+	}
+
+	op, err := handler.operationManager.Get(operationID)
+	if errors.Is(err, operations.ErrOperationNotFound) {
+		return httperror.NotFound("Unable to find the operation", err)
+	} else if err != nil {
+		return httperror.InternalServerError("Unable to retrieve the operation", err)
+	}
+
+	return response.JSON(rw, op)
+}
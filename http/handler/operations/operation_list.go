@@ -0,0 +1,13 @@
+package operations
+
+import (
+	"net/http"
+
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// GET request on /operations
+func (handler *Handler) operationList(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	return response.JSON(rw, handler.operationManager.List())
+}
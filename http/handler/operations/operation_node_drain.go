@@ -0,0 +1,74 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/portainer/agent/kubernetes"
+	"github.com/portainer/agent/operations"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type nodeDrainPayload struct {
+	Node string
+	// GracePeriodSeconds overrides the termination grace period of the pods when set
+	GracePeriodSeconds *int64
+	DeleteEmptyDirData bool
+	Force              bool
+	// Timeout aborts the drain after the duration (e.g. 10m), the drain waits for the PodDisruptionBudgets without
+	// limit when empty
+	Timeout string
+}
+
+func (payload *nodeDrainPayload) Validate(r *http.Request) error {
+	if payload.Node == "" {
+		return errors.New("Missing node name")
+	}
+
+	if payload.GracePeriodSeconds != nil && *payload.GracePeriodSeconds < 0 {
+		return errors.New("Invalid grace period")
+	}
+
+	if payload.Timeout != "" {
+		if _, err := time.ParseDuration(payload.Timeout); err != nil {
+			return errors.New("Invalid timeout")
+		}
+	}
+
+	return nil
+}
+
+// POST request on /operations/node_drain
+// The node is cordoned and its pods are evicted, the drain is aborted by cancelling the operation. The node is left
+// cordoned when the drain fails or is aborted.
+func (handler *Handler) operationNodeDrain(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	var payload nodeDrainPayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	op := handler.operationManager.Start("node_drain", func(ctx context.Context, progress *operations.Progress) (interface{}, error) {
+		if payload.Timeout != "" {
+			timeout, _ := time.ParseDuration(payload.Timeout)
+
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		options := kubernetes.DrainOptions{
+			GracePeriodSeconds: payload.GracePeriodSeconds,
+			DeleteEmptyDirData: payload.DeleteEmptyDirData,
+			Force:              payload.Force,
+		}
+
+		return kubernetes.DrainNode(ctx, payload.Node, options, progress.Update)
+	})
+
+	return response.JSON(rw, op)
+}
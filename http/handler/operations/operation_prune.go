@@ -0,0 +1,45 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/operations"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type prunePayload struct {
+	Containers bool
+	Images     bool
+	Volumes    bool
+	Networks   bool
+	// All removes all the unused images instead of only the dangling ones
+	All bool
+}
+
+func (payload *prunePayload) Validate(r *http.Request) error {
+	if !payload.Containers && !payload.Images && !payload.Volumes && !payload.Networks {
+		return errors.New("At least one resource type must be selected")
+	}
+
+	return nil
+}
+
+// POST request on /operations/prune
+func (handler *Handler) operationPrune(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	var payload prunePayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	op := handler.operationManager.StartDisruptive("prune", func(ctx context.Context, progress *operations.Progress) (interface{}, error) {
+		return docker.SystemPrune(ctx, docker.PruneOptions(payload))
+	})
+
+	return response.JSON(rw, op)
+}
@@ -0,0 +1,96 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"regexp"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/exec"
+	"github.com/portainer/agent/filesystem"
+	"github.com/portainer/agent/operations"
+	"github.com/portainer/agent/schema"
+	"github.com/portainer/agent/stacklock"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+var stackNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+type stackDeployPayload struct {
+	Name             string
+	StackFileContent string
+	// Env contains KEY=value entries used for the variable substitution in the stack file
+	Env   []string
+	Prune bool
+}
+
+func (payload *stackDeployPayload) Validate(r *http.Request) error {
+	if !stackNameRegexp.MatchString(payload.Name) {
+		return errors.New("Invalid stack name")
+	}
+
+	if payload.StackFileContent == "" {
+		return errors.New("Missing stack file content")
+	}
+
+	return nil
+}
+
+// POST request on /operations/stack_deploy
+// The stack is deployed as a Swarm stack when the node is a Swarm manager, as a Compose project otherwise.
+func (handler *Handler) operationStackDeploy(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	var payload stackDeployPayload
+	err := schema.DecodeAndValidateJSONPayload(r, schema.APIStackDeploy, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	deployer, err := handler.stackDeployer()
+	if err != nil {
+		return httperror.InternalServerError("Unable to initialize the stack deployer", err)
+	}
+
+	stackFolder := filepath.Join(handler.agentOptions.DataPath, agent.StacksDirName, payload.Name)
+
+	op := handler.operationManager.StartDisruptive("stack_deploy", func(ctx context.Context, progress *operations.Progress) (interface{}, error) {
+		progress.Update(0, "waiting for the stack lock")
+
+		// The stack file is written once the lock is held, so that it is not replaced during another deployment
+		release, err := stacklock.Acquire(ctx, payload.Name, "deploy")
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+
+		err = filesystem.WriteFile(stackFolder, agent.StackFileName, []byte(payload.StackFileContent), 0600)
+		if err != nil {
+			return nil, fmt.Errorf("unable to write the stack file: %w", err)
+		}
+
+		progress.Update(0, "deploying stack")
+
+		return nil, deployer.Deploy(ctx, payload.Name, []string{filepath.Join(stackFolder, agent.StackFileName)}, agent.DeployOptions{
+			DeployerBaseOptions: agent.DeployerBaseOptions{
+				WorkingDir: stackFolder,
+				Env:        payload.Env,
+			},
+			Prune: payload.Prune,
+		})
+	})
+
+	return response.JSON(rw, op)
+}
+
+// stackDeployer returns the deployer of the stacks, they are deployed as Swarm stacks when the node is a Swarm manager,
+// as Compose projects otherwise
+func (handler *Handler) stackDeployer() (agent.Deployer, error) {
+	if handler.runtimeConfiguration.DockerConfiguration.EngineStatus == agent.EngineStatusSwarm {
+		return exec.NewDockerSwarmStackService(handler.agentOptions.AssetsPath)
+	}
+
+	return exec.NewDockerComposeStackService(handler.agentOptions.AssetsPath)
+}
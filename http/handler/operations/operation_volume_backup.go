@@ -0,0 +1,46 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/operations"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type volumeBackupPayload struct {
+	Volume string
+	// Pause pauses the running containers mounting the volume during the backup
+	Pause bool
+}
+
+func (payload *volumeBackupPayload) Validate(r *http.Request) error {
+	if payload.Volume == "" {
+		return errors.New("Missing volume")
+	}
+
+	return nil
+}
+
+// POST request on /operations/volume_backup
+func (handler *Handler) operationVolumeBackup(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	var payload volumeBackupPayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	backupDir := filepath.Join(handler.agentOptions.DataPath, agent.BackupsDirName)
+
+	op := handler.operationManager.Start("volume_backup", func(ctx context.Context, progress *operations.Progress) (interface{}, error) {
+		return docker.BackupVolume(ctx, payload.Volume, backupDir, payload.Pause, progress.Update)
+	})
+
+	return response.JSON(rw, op)
+}
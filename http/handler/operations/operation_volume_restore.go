@@ -0,0 +1,66 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/operations"
+	"github.com/portainer/agent/schema"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type volumeRestorePayload struct {
+	Volume string
+	// Backup is the file name of a backup created by the volume_backup operation
+	Backup string
+	// Clear removes the content of the volume before the restore
+	Clear bool
+}
+
+func (payload *volumeRestorePayload) Validate(r *http.Request) error {
+	if payload.Volume == "" {
+		return errors.New("Missing volume")
+	}
+
+	if payload.Backup == "" || payload.Backup != filepath.Base(payload.Backup) {
+		return errors.New("Invalid backup")
+	}
+
+	return nil
+}
+
+// POST request on /operations/volume_restore
+func (handler *Handler) operationVolumeRestore(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	var payload volumeRestorePayload
+	err := schema.DecodeAndValidateJSONPayload(r, schema.APIVolumeRestore, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	backupPath := filepath.Join(handler.agentOptions.DataPath, agent.BackupsDirName, payload.Backup)
+
+	info, err := os.Stat(backupPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return httperror.NotFound("Unable to find the backup", err)
+	} else if err != nil {
+		return httperror.InternalServerError("Unable to retrieve the backup", err)
+	}
+
+	op := handler.operationManager.Start("volume_restore", func(ctx context.Context, progress *operations.Progress) (interface{}, error) {
+		f, err := os.Open(backupPath)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		return docker.RestoreVolume(ctx, payload.Volume, f, info.Size(), payload.Clear, progress.Update)
+	})
+
+	return response.JSON(rw, op)
+}
@@ -0,0 +1,44 @@
+package replica
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/mux"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/edge"
+	"github.com/portainer/agent/http/security"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+)
+
+// Handler represents an HTTP API Handler serving a read-only view of the environment to the local consumers
+type Handler struct {
+	*mux.Router
+	containerPlatform agent.ContainerPlatform
+	edgeManager       *edge.Manager
+	mu                sync.Mutex
+	snapshot          *cachedSnapshot
+}
+
+// NewHandler returns a new instance of Handler.
+// The replica requests are not signed by a Portainer instance, they are authenticated with the replica token instead.
+func NewHandler(replicaService *security.ReplicaService, containerPlatform agent.ContainerPlatform, edgeManager *edge.Manager) *Handler {
+	h := &Handler{
+		Router:            mux.NewRouter(),
+		containerPlatform: containerPlatform,
+		edgeManager:       edgeManager,
+	}
+
+	h.Handle("/replica/snapshot",
+		replicaService.ReplicaTokenVerification(httperror.LoggerHandler(h.replicaSnapshot))).Methods(http.MethodGet)
+	h.Handle("/replica/metrics",
+		replicaService.ReplicaTokenVerification(httperror.LoggerHandler(h.replicaMetrics))).Methods(http.MethodGet)
+	h.Handle("/replica/inventory",
+		replicaService.ReplicaTokenVerification(httperror.LoggerHandler(h.replicaInventory))).Methods(http.MethodGet)
+
+	h.Handle("/replica/status",
+		replicaService.ReplicaTokenVerification(httperror.LoggerHandler(h.replicaStatus))).Methods(http.MethodGet)
+
+	return h
+}
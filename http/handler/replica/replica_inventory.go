@@ -0,0 +1,219 @@
+package replica
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/portainer/agent"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// Kinds of the records of the inventory export
+const (
+	inventoryKindHost      = "host"
+	inventoryKindFact      = "fact"
+	inventoryKindContainer = "container"
+	inventoryKindImage     = "image"
+)
+
+// imageVersionLabel is the OCI annotation set by the image authors to the version of the packaged software
+const imageVersionLabel = "org.opencontainers.image.version"
+
+// inventoryColumns are the columns of the CSV export, in the order of the fields of inventoryRecord
+var inventoryColumns = []string{"host", "kind", "id", "name", "image", "digest", "version", "state", "value"}
+
+// inventoryRecord is a row of the inventory export, the host, its facts, the containers and the images share the
+// same columns so that the export can be ingested by asset-management tools as a single table
+type inventoryRecord struct {
+	Host    string `json:"host"`
+	Kind    string `json:"kind"`
+	ID      string `json:"id,omitempty"`
+	Name    string `json:"name"`
+	Image   string `json:"image,omitempty"`
+	Digest  string `json:"digest,omitempty"`
+	Version string `json:"version,omitempty"`
+	State   string `json:"state,omitempty"`
+	Value   string `json:"value,omitempty"`
+}
+
+// GET request on /replica/inventory?format=<json|csv>
+// Returns the inventory of the environment as a flat list of records, computed from the cached snapshot
+func (handler *Handler) replicaInventory(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	format, _ := request.RetrieveQueryParameter(r, "format", true)
+	if format != "" && format != "json" && format != "csv" {
+		return httperror.BadRequest("Invalid format query parameter", errors.New("the format must be json or csv"))
+	}
+
+	snapshot, err := handler.getSnapshot(r.Context())
+	if err != nil {
+		return httperror.InternalServerError("Unable to create the snapshot", err)
+	}
+
+	records := inventoryRecords(snapshot)
+
+	if format != "csv" {
+		return response.JSON(rw, records)
+	}
+
+	rw.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	rw.Header().Set("Content-Disposition", `attachment; filename="inventory.csv"`)
+
+	if err := writeInventoryCSV(rw, records); err != nil {
+		return httperror.InternalServerError("Unable to write the inventory", err)
+	}
+
+	return nil
+}
+
+// inventoryRecords flattens the host facts, the containers and the images of snapshot
+func inventoryRecords(snapshot *cachedSnapshot) []inventoryRecord {
+	records := []inventoryRecord{}
+
+	fact := func(host, name, value string) {
+		if value != "" {
+			records = append(records, inventoryRecord{Host: host, Kind: inventoryKindFact, Name: name, Value: value})
+		}
+	}
+
+	if s := snapshot.Docker; s != nil {
+		info := s.SnapshotRaw.Info
+		host := info.Name
+
+		records = append(records, inventoryRecord{Host: host, Kind: inventoryKindHost, ID: info.ID, Name: host, Version: s.DockerVersion})
+		fact(host, "agent_version", agent.Version)
+		fact(host, "os", info.OperatingSystem)
+		fact(host, "kernel", info.KernelVersion)
+		fact(host, "architecture", info.Architecture)
+		fact(host, "cpus", strconv.Itoa(s.TotalCPU))
+		fact(host, "memory_bytes", strconv.FormatInt(s.TotalMemory, 10))
+
+		// the containers reference the identifier of their image, which is resolved to its repository digest
+		digests := map[string]string{}
+		images := []inventoryRecord{}
+		for _, image := range s.SnapshotRaw.Images {
+			tags := image.RepoTags
+			if len(tags) == 0 {
+				tags = []string{"<none>"}
+			}
+
+			for _, tag := range tags {
+				digest := imageDigest(tag, image.RepoDigests)
+				if digests[image.ID] == "" {
+					digests[image.ID] = digest
+				}
+
+				images = append(images, inventoryRecord{
+					Host:    host,
+					Kind:    inventoryKindImage,
+					ID:      image.ID,
+					Name:    tag,
+					Digest:  digest,
+					Version: imageTag(tag),
+				})
+			}
+		}
+
+		containers := []inventoryRecord{}
+		for _, c := range s.SnapshotRaw.Containers {
+			name := c.ID
+			if len(c.Names) > 0 {
+				name = strings.TrimPrefix(c.Names[0], "/")
+			}
+
+			version := c.Labels[imageVersionLabel]
+			if version == "" {
+				version = imageTag(c.Image)
+			}
+
+			containers = append(containers, inventoryRecord{
+				Host:    host,
+				Kind:    inventoryKindContainer,
+				ID:      c.ID,
+				Name:    name,
+				Image:   c.Image,
+				Digest:  digests[c.ImageID],
+				Version: version,
+				State:   c.State,
+			})
+		}
+
+		sort.SliceStable(containers, func(i, j int) bool { return containers[i].Name < containers[j].Name })
+		sort.SliceStable(images, func(i, j int) bool { return images[i].Name < images[j].Name })
+
+		records = append(append(records, containers...), images...)
+	}
+
+	if s := snapshot.Kubernetes; s != nil {
+		host := "kubernetes"
+
+		records = append(records, inventoryRecord{Host: host, Kind: inventoryKindHost, Name: host, Version: s.KubernetesVersion})
+		fact(host, "agent_version", agent.Version)
+		fact(host, "nodes", strconv.Itoa(s.NodeCount))
+		fact(host, "cpus", strconv.FormatInt(s.TotalCPU, 10))
+		fact(host, "memory_bytes", strconv.FormatInt(s.TotalMemory, 10))
+	}
+
+	return records
+}
+
+// imageDigest returns the digest of the repository digest matching the repository of reference, or of the first
+// repository digest
+func imageDigest(reference string, repoDigests []string) string {
+	repository := strings.TrimSuffix(reference, ":"+imageTag(reference))
+
+	digest := ""
+	for _, repoDigest := range repoDigests {
+		name, d, ok := strings.Cut(repoDigest, "@")
+		if !ok {
+			continue
+		}
+
+		if name == repository {
+			return d
+		}
+
+		if digest == "" {
+			digest = d
+		}
+	}
+
+	return digest
+}
+
+// imageTag returns the tag of an image reference, empty when the reference has no tag
+func imageTag(reference string) string {
+	reference, _, _ = strings.Cut(reference, "@")
+
+	i := strings.LastIndex(reference, ":")
+	if i <= strings.LastIndex(reference, "/") {
+		return ""
+	}
+
+	return reference[i+1:]
+}
+
+func writeInventoryCSV(w io.Writer, records []inventoryRecord) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write(inventoryColumns); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		err := writer.Write([]string{record.Host, record.Kind, record.ID, record.Name, record.Image, record.Digest, record.Version, record.State, record.Value})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
@@ -0,0 +1,76 @@
+package replica
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/portainer/agent"
+	portainer "github.com/portainer/portainer/api"
+)
+
+func TestInventoryRecords(t *testing.T) {
+	snapshot := &cachedSnapshot{
+		Docker: &portainer.DockerSnapshot{
+			DockerVersion: "24.0.7",
+			TotalCPU:      4,
+			SnapshotRaw: portainer.DockerSnapshotRaw{
+				Info: types.Info{ID: "ABCD", Name: "gateway-1", OperatingSystem: "Debian GNU/Linux 12 (bookworm)"},
+				Images: []types.ImageSummary{
+					{ID: "sha256:1", RepoTags: []string{"registry:5000/app:1.2"}, RepoDigests: []string{"registry:5000/app@sha256:aaa"}},
+					{ID: "sha256:2"},
+				},
+				Containers: []portainer.DockerContainerSnapshot{
+					{Container: types.Container{ID: "c1", Names: []string{"/app"}, Image: "registry:5000/app:1.2", ImageID: "sha256:1", State: "running", Labels: map[string]string{imageVersionLabel: "1.2.3"}}},
+				},
+			},
+		},
+	}
+
+	expected := []inventoryRecord{
+		{Host: "gateway-1", Kind: inventoryKindHost, ID: "ABCD", Name: "gateway-1", Version: "24.0.7"},
+		{Host: "gateway-1", Kind: inventoryKindFact, Name: "agent_version", Value: agent.Version},
+		{Host: "gateway-1", Kind: inventoryKindFact, Name: "os", Value: "Debian GNU/Linux 12 (bookworm)"},
+		{Host: "gateway-1", Kind: inventoryKindFact, Name: "cpus", Value: "4"},
+		{Host: "gateway-1", Kind: inventoryKindFact, Name: "memory_bytes", Value: "0"},
+		{Host: "gateway-1", Kind: inventoryKindContainer, ID: "c1", Name: "app", Image: "registry:5000/app:1.2", Digest: "sha256:aaa", Version: "1.2.3", State: "running"},
+		{Host: "gateway-1", Kind: inventoryKindImage, ID: "sha256:2", Name: "<none>"},
+		{Host: "gateway-1", Kind: inventoryKindImage, ID: "sha256:1", Name: "registry:5000/app:1.2", Digest: "sha256:aaa", Version: "1.2"},
+	}
+
+	records := inventoryRecords(snapshot)
+	if !reflect.DeepEqual(records, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, records)
+	}
+
+	var b bytes.Buffer
+	if err := writeInventoryCSV(&b, records); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != len(records)+1 || lines[0] != strings.Join(inventoryColumns, ",") {
+		t.Fatalf("unexpected CSV export:\n%s", b.String())
+	}
+
+	if lines[6] != "gateway-1,container,c1,app,registry:5000/app:1.2,sha256:aaa,1.2.3,running," {
+		t.Errorf("unexpected container row %q", lines[6])
+	}
+}
+
+func TestImageTag(t *testing.T) {
+	for reference, tag := range map[string]string{
+		"nginx":                        "",
+		"nginx:1.25":                   "1.25",
+		"registry:5000/app":            "",
+		"registry:5000/app:2":          "2",
+		"nginx:1.25@sha256:abc":        "1.25",
+		"ghcr.io/org/app@sha256:abcde": "",
+	} {
+		if actual := imageTag(reference); actual != tag {
+			t.Errorf("expected the tag of %s to be %q, got %q", reference, tag, actual)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package replica
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	agentnet "github.com/portainer/agent/net"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+)
+
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// GET request on /replica/metrics
+// Returns the metrics of the environment in the Prometheus text format, computed from the cached snapshot
+func (handler *Handler) replicaMetrics(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	snapshot, err := handler.getSnapshot(r.Context())
+	if err != nil {
+		return httperror.InternalServerError("Unable to create the snapshot", err)
+	}
+
+	rw.Header().Set("Content-Type", metricsContentType)
+	writeMetrics(rw, snapshot, agentnet.GetBandwidthReport())
+
+	return nil
+}
+
+func writeMetrics(w io.Writer, snapshot *cachedSnapshot, bandwidth *agentnet.BandwidthReport) {
+	gauge := func(name, help string) {
+		fmt.Fprintf(w, "# HELP portainer_agent_%s %s\n# TYPE portainer_agent_%s gauge\n", name, help, name)
+	}
+
+	sample := func(name string, value float64, labels ...string) {
+		var pairs []string
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, fmt.Sprintf("%s=%q", labels[i], labels[i+1]))
+		}
+
+		if len(pairs) > 0 {
+			name += "{" + strings.Join(pairs, ",") + "}"
+		}
+
+		fmt.Fprintf(w, "portainer_agent_%s %s\n", name, strconv.FormatFloat(value, 'g', -1, 64))
+	}
+
+	gauge("snapshot_timestamp_seconds", "Unix time of the creation of the snapshot.")
+	sample("snapshot_timestamp_seconds", float64(snapshot.CreatedAt.Unix()))
+
+	if s := snapshot.Docker; s != nil {
+		gauge("cpus", "Number of CPUs of the host or of the Swarm cluster.")
+		sample("cpus", float64(s.TotalCPU))
+		gauge("memory_bytes", "Memory of the host or of the Swarm cluster.")
+		sample("memory_bytes", float64(s.TotalMemory))
+		gauge("containers", "Number of containers by state.")
+		sample("containers", float64(s.RunningContainerCount), "state", "running")
+		sample("containers", float64(s.StoppedContainerCount), "state", "stopped")
+		sample("containers", float64(s.HealthyContainerCount), "state", "healthy")
+		sample("containers", float64(s.UnhealthyContainerCount), "state", "unhealthy")
+		gauge("images", "Number of images.")
+		sample("images", float64(s.ImageCount))
+		gauge("volumes", "Number of volumes.")
+		sample("volumes", float64(s.VolumeCount))
+		gauge("stacks", "Number of stacks.")
+		sample("stacks", float64(s.StackCount))
+
+		if s.Swarm {
+			gauge("services", "Number of Swarm services.")
+			sample("services", float64(s.ServiceCount))
+			gauge("nodes", "Number of Swarm nodes.")
+			sample("nodes", float64(s.NodeCount))
+		}
+	}
+
+	if s := snapshot.Kubernetes; s != nil {
+		gauge("cpus", "Number of CPUs of the cluster.")
+		sample("cpus", float64(s.TotalCPU))
+		gauge("memory_bytes", "Memory of the cluster.")
+		sample("memory_bytes", float64(s.TotalMemory))
+		gauge("nodes", "Number of nodes of the cluster.")
+		sample("nodes", float64(s.NodeCount))
+	}
+
+	if stats := snapshot.ContainerStats; stats != nil {
+		gauge("container_cpu_percent", "CPU usage of the running containers, relative to a single CPU.")
+		for _, c := range stats.Containers {
+			sample("container_cpu_percent", c.CPUPercent, "name", c.Name)
+		}
+
+		gauge("container_memory_usage_bytes", "Memory used by the running containers.")
+		for _, c := range stats.Containers {
+			sample("container_memory_usage_bytes", float64(c.MemoryUsage), "name", c.Name)
+		}
+	}
+
+	if bandwidth != nil {
+		gauge("bandwidth_sent_bytes", "Bytes sent by the subsystems of the agent during the current month.")
+		for _, usage := range bandwidth.Subsystems {
+			sample("bandwidth_sent_bytes", float64(usage.Sent), "subsystem", usage.Subsystem)
+		}
+
+		gauge("bandwidth_received_bytes", "Bytes received by the subsystems of the agent during the current month.")
+		for _, usage := range bandwidth.Subsystems {
+			sample("bandwidth_received_bytes", float64(usage.Received), "subsystem", usage.Subsystem)
+		}
+	}
+}
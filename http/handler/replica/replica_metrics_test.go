@@ -0,0 +1,51 @@
+package replica
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/portainer/agent/docker"
+	agentnet "github.com/portainer/agent/net"
+	portainer "github.com/portainer/portainer/api"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	snapshot := &cachedSnapshot{
+		CreatedAt: time.Unix(1700000000, 0),
+		Docker: &portainer.DockerSnapshot{
+			RunningContainerCount: 3,
+			StoppedContainerCount: 1,
+			ImageCount:            5,
+		},
+		ContainerStats: &docker.ContainerStats{
+			Containers: []docker.ContainerUsage{{Name: "web", CPUPercent: 12.5, MemoryUsage: 1024}},
+		},
+	}
+
+	bandwidth := &agentnet.BandwidthReport{
+		Subsystems: []agentnet.BandwidthUsage{{Subsystem: "tunnel", Sent: 10, Received: 20}},
+	}
+
+	var b bytes.Buffer
+	writeMetrics(&b, snapshot, bandwidth)
+
+	for _, expected := range []string{
+		"portainer_agent_snapshot_timestamp_seconds 1.7e+09\n",
+		`portainer_agent_containers{state="running"} 3` + "\n",
+		`portainer_agent_containers{state="stopped"} 1` + "\n",
+		"portainer_agent_images 5\n",
+		`portainer_agent_container_cpu_percent{name="web"} 12.5` + "\n",
+		`portainer_agent_container_memory_usage_bytes{name="web"} 1024` + "\n",
+		`portainer_agent_bandwidth_received_bytes{subsystem="tunnel"} 20` + "\n",
+	} {
+		if !strings.Contains(b.String(), expected) {
+			t.Fatalf("expected the metrics to contain %q, got:\n%s", expected, b.String())
+		}
+	}
+
+	if strings.Contains(b.String(), "portainer_agent_services") {
+		t.Fatal("expected no Swarm metrics outside of a Swarm cluster")
+	}
+}
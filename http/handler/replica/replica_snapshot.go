@@ -0,0 +1,130 @@
+package replica
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/anonymize"
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/kubernetes"
+	portainer "github.com/portainer/portainer/api"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// snapshotCacheDuration is the duration during which a snapshot is served before a new one is created, so that
+// the consumers polling the replica API frequently do not add load on the host
+const snapshotCacheDuration = 30 * time.Second
+
+type cachedSnapshot struct {
+	CreatedAt         time.Time                     `json:"createdAt"`
+	Docker            *portainer.DockerSnapshot     `json:"docker,omitempty"`
+	Kubernetes        *portainer.KubernetesSnapshot `json:"kubernetes,omitempty"`
+	KubernetesSummary *kubernetes.ClusterSummary    `json:"kubernetesSummary,omitempty"`
+	ContainerStats    *docker.ContainerStats        `json:"containerStats,omitempty"`
+	GPUs              *docker.GPUInventory          `json:"gpus,omitempty"`
+	Devices           *docker.DeviceInventory       `json:"devices,omitempty"`
+	ImageScans        *docker.ImageScanReport       `json:"imageScans,omitempty"`
+}
+
+// GET request on /replica/snapshot?anonymize=<true|false>
+// Returns the last snapshot of the environment, created at most 30 seconds ago. The anonymized snapshot can be
+// attached to support tickets: the names and the identifiers are hashed, the environment variables, labels, commands
+// and addresses are stripped.
+func (handler *Handler) replicaSnapshot(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	anonymized, _ := request.RetrieveBooleanQueryParameter(r, "anonymize", true)
+
+	snapshot, err := handler.getSnapshot(r.Context())
+	if err != nil {
+		return httperror.InternalServerError("Unable to create the snapshot", err)
+	}
+
+	if !anonymized {
+		return response.JSON(rw, snapshot)
+	}
+
+	anonymizer, err := anonymize.New()
+	if err != nil {
+		return httperror.InternalServerError("Unable to anonymize the snapshot", err)
+	}
+
+	data, err := anonymizer.Anonymize(snapshot)
+	if err != nil {
+		return httperror.InternalServerError("Unable to anonymize the snapshot", err)
+	}
+
+	return response.JSON(rw, data)
+}
+
+func (handler *Handler) getSnapshot(ctx context.Context) (*cachedSnapshot, error) {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+
+	if handler.snapshot != nil && time.Since(handler.snapshot.CreatedAt) < snapshotCacheDuration {
+		return handler.snapshot, nil
+	}
+
+	snapshot := &cachedSnapshot{CreatedAt: time.Now()}
+
+	var err error
+	switch handler.containerPlatform {
+	case agent.PlatformDocker, agent.PlatformPodman:
+		snapshot.Docker, err = docker.CreateSnapshot(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		snapshot.ContainerStats, err = docker.SnapshotStats(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		snapshot.GPUs, err = docker.GetGPUInventory(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		snapshot.Devices, err = docker.GetDeviceInventory(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if docker.CollectorEnabled(docker.CollectorSecurityPosture) {
+			snapshot.ImageScans, err = docker.GetImageScanReport(ctx)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// The Kubernetes cluster running next to the Docker daemon is snapshotted as well
+		if kubernetes.UsesKubeconfig() {
+			snapshot.Kubernetes, err = kubernetes.CreateSnapshot()
+			if err != nil {
+				return nil, err
+			}
+
+			snapshot.KubernetesSummary, err = kubernetes.GetClusterSummary(ctx)
+		}
+	case agent.PlatformKubernetes:
+		snapshot.Kubernetes, err = kubernetes.CreateSnapshot()
+		if err != nil {
+			return nil, err
+		}
+
+		snapshot.KubernetesSummary, err = kubernetes.GetClusterSummary(ctx)
+	default:
+		err = errors.New("the snapshots are not supported on this platform")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	handler.snapshot = snapshot
+
+	return snapshot, nil
+}
@@ -0,0 +1,149 @@
+package replica
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/edge/client"
+	"github.com/portainer/agent/healthscore"
+	"github.com/portainer/agent/kubernetes"
+	"github.com/portainer/agent/notify"
+	"github.com/portainer/agent/smart"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type statusResponse struct {
+	Version    string             `json:"version"`
+	APIVersion string             `json:"apiVersion"`
+	CreatedAt  time.Time          `json:"createdAt"`
+	Health     *healthscore.Score `json:"health"`
+	Summary    statusSummary      `json:"summary"`
+	Alerts     []string           `json:"alerts"`
+	Edge       *statusEdge        `json:"edge,omitempty"`
+}
+
+// statusSummary are the counters of the cached snapshot, the Kubernetes counters are set when a cluster is snapshotted
+type statusSummary struct {
+	RunningContainers   int `json:"runningContainers"`
+	StoppedContainers   int `json:"stoppedContainers"`
+	HealthyContainers   int `json:"healthyContainers"`
+	UnhealthyContainers int `json:"unhealthyContainers"`
+	Images              int `json:"images"`
+	Volumes             int `json:"volumes"`
+	Stacks              int `json:"stacks"`
+	Services            int `json:"services,omitempty"`
+	Nodes               int `json:"nodes,omitempty"`
+	Workloads           int `json:"workloads,omitempty"`
+	ReadyWorkloads      int `json:"readyWorkloads,omitempty"`
+	Pods                int `json:"pods,omitempty"`
+	RunningPods         int `json:"runningPods,omitempty"`
+	FailedPods          int `json:"failedPods,omitempty"`
+}
+
+// statusEdge is the connection of an Edge agent to the Portainer instance
+type statusEdge struct {
+	Connectivity client.ConnectivityStatus `json:"connectivity"`
+	TunnelOpen   bool                      `json:"tunnelOpen"`
+}
+
+// GET request on /replica/status
+// Returns the version of the agent, its health score, the counters of the cached snapshot, the active alerts and
+// the connection to the Portainer instance in a single response, so that the monitoring integrations polling the
+// devices need a single request per device
+func (handler *Handler) replicaStatus(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	snapshot, err := handler.getSnapshot(r.Context())
+	if err != nil {
+		return httperror.InternalServerError("Unable to create the snapshot", err)
+	}
+
+	alerts := notify.CurrentAlerts(r.Context())
+
+	var disks []smart.Disk
+	if docker.CollectorEnabled(docker.CollectorSMART) {
+		disks = smart.CurrentStatus(r.Context())
+		alerts = append(alerts, smart.Diagnostics(disks)...)
+	}
+
+	var edge *statusEdge
+	if handler.edgeManager != nil {
+		alerts = append(alerts, client.ConnectivityDiagnostics()...)
+		edge = &statusEdge{
+			Connectivity: client.CurrentConnectivity(),
+			TunnelOpen:   handler.edgeManager.IsTunnelOpen(),
+		}
+	}
+
+	return response.JSON(rw, buildStatus(snapshot, alerts, disks, edge, time.Now()))
+}
+
+func buildStatus(snapshot *cachedSnapshot, alerts []string, disks []smart.Disk, edge *statusEdge, now time.Time) *statusResponse {
+	status := &statusResponse{
+		Version:    agent.Version,
+		APIVersion: agent.APIVersion,
+		CreatedAt:  snapshot.CreatedAt,
+		Alerts:     alerts,
+		Edge:       edge,
+	}
+
+	if status.Alerts == nil {
+		status.Alerts = []string{}
+	}
+
+	summary := &status.Summary
+
+	if s := snapshot.Docker; s != nil {
+		summary.RunningContainers = s.RunningContainerCount
+		summary.StoppedContainers = s.StoppedContainerCount
+		summary.HealthyContainers = s.HealthyContainerCount
+		summary.UnhealthyContainers = s.UnhealthyContainerCount
+		summary.Images = s.ImageCount
+		summary.Volumes = s.VolumeCount
+		summary.Stacks = s.StackCount
+
+		if s.Swarm {
+			summary.Services = s.ServiceCount
+			summary.Nodes = s.NodeCount
+		}
+	}
+
+	if s := snapshot.Kubernetes; s != nil {
+		summary.Nodes += s.NodeCount
+	}
+
+	if s := snapshot.KubernetesSummary; s != nil {
+		for _, workloads := range []kubernetes.WorkloadCount{s.Deployments, s.StatefulSets, s.DaemonSets} {
+			summary.Workloads += workloads.Total
+			summary.ReadyWorkloads += workloads.Ready
+		}
+
+		summary.Pods = s.Pods.Total
+		summary.RunningPods = s.Pods.Running
+		summary.FailedPods = s.Pods.Failed
+	}
+
+	inputs := healthscore.Inputs{
+		Workloads:          summary.RunningContainers + summary.Workloads,
+		UnhealthyWorkloads: summary.UnhealthyContainers + summary.Workloads - summary.ReadyWorkloads,
+		Alerts:             len(alerts),
+	}
+
+	for _, disk := range disks {
+		if disk.Passed != nil && !*disk.Passed {
+			inputs.FailingDisks++
+		} else if len(disk.Warnings) > 0 {
+			inputs.WarningDisks++
+		}
+	}
+
+	if edge != nil && edge.Connectivity.State != "" && edge.Connectivity.State != client.ConnectivityOK {
+		inputs.Disconnected = true
+		inputs.DisconnectedSince = edge.Connectivity.Since
+	}
+
+	status.Health = healthscore.Compute(inputs, now)
+
+	return status
+}
@@ -0,0 +1,75 @@
+package replica
+
+import (
+	"testing"
+	"time"
+
+	"github.com/portainer/agent/edge/client"
+	"github.com/portainer/agent/healthscore"
+	"github.com/portainer/agent/kubernetes"
+	portainer "github.com/portainer/portainer/api"
+)
+
+func TestBuildStatus(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	snapshot := &cachedSnapshot{
+		CreatedAt: now.Add(-10 * time.Second),
+		Docker: &portainer.DockerSnapshot{
+			RunningContainerCount:   4,
+			StoppedContainerCount:   1,
+			UnhealthyContainerCount: 1,
+			ImageCount:              6,
+			NodeCount:               1,
+		},
+		KubernetesSummary: &kubernetes.ClusterSummary{
+			Deployments: kubernetes.WorkloadCount{Total: 3, Ready: 2},
+			Pods:        kubernetes.PodCount{Total: 5, Running: 4, Failed: 1},
+		},
+	}
+
+	edge := &statusEdge{
+		Connectivity: client.ConnectivityStatus{State: client.ConnectivityOK},
+		TunnelOpen:   true,
+	}
+
+	status := buildStatus(snapshot, nil, nil, edge, now)
+
+	if status.Summary.RunningContainers != 4 || status.Summary.Images != 6 || status.Summary.Workloads != 3 || status.Summary.RunningPods != 4 {
+		t.Fatalf("unexpected summary: %+v", status.Summary)
+	}
+
+	if status.Summary.Nodes != 0 {
+		t.Fatalf("expected no node count outside of a Swarm cluster, got %d", status.Summary.Nodes)
+	}
+
+	if status.Alerts == nil || len(status.Alerts) != 0 {
+		t.Fatalf("expected an empty list of alerts, got %v", status.Alerts)
+	}
+
+	if !status.Edge.TunnelOpen {
+		t.Fatal("expected the tunnel status to be reported")
+	}
+
+	for _, component := range status.Health.Components {
+		if component.Name == healthscore.ComponentWorkloads && component.Score == 100 {
+			t.Fatal("expected the unhealthy container and the unready deployment to lower the workloads score")
+		}
+
+		if component.Name == healthscore.ComponentConnectivity && component.Score != 100 {
+			t.Fatalf("expected a connected agent to have a full connectivity score, got %d", component.Score)
+		}
+	}
+
+	status = buildStatus(snapshot, []string{"disk sda may be failing"}, nil, nil, now)
+
+	if status.Edge != nil {
+		t.Fatal("expected no Edge status outside of Edge mode")
+	}
+
+	for _, component := range status.Health.Components {
+		if component.Name == healthscore.ComponentAlerts && component.Score != 80 {
+			t.Fatalf("expected an alert to lower the alerts score to 80, got %d", component.Score)
+		}
+	}
+}
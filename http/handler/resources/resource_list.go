@@ -0,0 +1,40 @@
+package resources
+
+import (
+	"net/http"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// GET request on /resources?endpoint=<endpoint>&stack=<stack>&owner=<owner>
+// Lists the containers, networks, volumes and Swarm services, configs and secrets labeled with all the specified
+// values. Without any filter, all the resources created through the agent are listed.
+func (handler *Handler) resourceList(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	labels := map[string]string{}
+
+	for parameter, label := range map[string]string{
+		"endpoint": agent.ResourceLabelEndpoint,
+		"stack":    agent.ResourceLabelStack,
+		"owner":    agent.ResourceLabelOwner,
+	} {
+		value, _ := request.RetrieveQueryParameter(r, parameter, true)
+		if value != "" {
+			labels[label] = value
+		}
+	}
+
+	if len(labels) == 0 {
+		labels[agent.ResourceLabelEndpoint] = ""
+	}
+
+	resources, err := docker.ListLabeledResources(r.Context(), labels)
+	if err != nil {
+		return httperror.InternalServerError("Unable to retrieve the resources", err)
+	}
+
+	return response.JSON(rw, resources)
+}
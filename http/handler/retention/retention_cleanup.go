@@ -0,0 +1,20 @@
+package retention
+
+import (
+	"net/http"
+
+	"github.com/portainer/agent/retention"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// POST request on /retention/cleanup
+// Applies the retention policies immediately and returns the items removed in each category
+func (handler *Handler) retentionCleanup(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	manager, err := retention.DefaultManager()
+	if err != nil {
+		return httperror.NotFound("The retention of the agent data is disabled", err)
+	}
+
+	return response.JSON(rw, manager.Cleanup())
+}
@@ -0,0 +1,29 @@
+package retention
+
+import (
+	"net/http"
+
+	"github.com/portainer/agent/retention"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type retentionUsageResponse struct {
+	Usage retention.Report
+	// LastCleanup is the report of the last cleanup, omitted when no cleanup ran yet
+	LastCleanup *retention.Report `json:",omitempty"`
+}
+
+// GET request on /retention
+// Returns the data stored by the agent in each category, its retention policy and the report of the last cleanup
+func (handler *Handler) retentionUsage(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	manager, err := retention.DefaultManager()
+	if err != nil {
+		return httperror.NotFound("The retention of the agent data is disabled", err)
+	}
+
+	return response.JSON(rw, retentionUsageResponse{
+		Usage:       manager.Usage(),
+		LastCleanup: manager.LastCleanup(),
+	})
+}
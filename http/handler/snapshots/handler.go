@@ -0,0 +1,96 @@
+package snapshots
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/portainer/agent/anonymize"
+	"github.com/portainer/agent/http/proxy"
+	"github.com/portainer/agent/http/security"
+	"github.com/portainer/agent/snapshots"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+)
+
+// currentSnapshotID identifies the snapshot created when the request is received
+const currentSnapshotID = "current"
+
+// minKeySize is the minimum size of the anonymization key shared by two environments, in bytes
+const minKeySize = 16
+
+// Handler represents an HTTP API Handler for inspecting and comparing the history of the snapshots of the environment
+type Handler struct {
+	*mux.Router
+}
+
+// NewHandler returns a new instance of Handler
+func NewHandler(agentProxy *proxy.AgentProxy, notaryService *security.NotaryService) *Handler {
+	h := &Handler{
+		Router: mux.NewRouter(),
+	}
+
+	h.Handle("/snapshots",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.snapshotList)))).Methods(http.MethodGet)
+	h.Handle("/snapshots/diff",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.snapshotDiff)))).Methods(http.MethodGet)
+	h.Handle("/snapshots/diff",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.snapshotDiffExternal)))).Methods(http.MethodPost)
+	h.Handle("/snapshots/{id}",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.snapshotInspect)))).Methods(http.MethodGet)
+
+	return h
+}
+
+// loadSnapshot returns the stored snapshot identified by id, or a new snapshot created within ctx when id is current
+func loadSnapshot(ctx context.Context, store *snapshots.Store, id string) (json.RawMessage, *httperror.HandlerError) {
+	if id == currentSnapshotID {
+		snapshot, err := store.Current(ctx)
+		if err != nil {
+			return nil, httperror.InternalServerError("Unable to create the snapshot", err)
+		}
+
+		data, err := json.Marshal(snapshot)
+		if err != nil {
+			return nil, httperror.InternalServerError("Unable to create the snapshot", err)
+		}
+
+		return data, nil
+	}
+
+	snapshot, err := store.Load(id)
+	if errors.Is(err, snapshots.ErrNotFound) {
+		return nil, httperror.NotFound("Unable to find the snapshot", err)
+	} else if err != nil {
+		return nil, httperror.InternalServerError("Unable to read the snapshot", err)
+	}
+
+	return snapshot, nil
+}
+
+// anonymizeSnapshot returns the snapshot anonymized with the hex encoded key, or with a random key when key is empty
+func anonymizeSnapshot(snapshot json.RawMessage, key string) (json.RawMessage, *httperror.HandlerError) {
+	anonymizer, err := anonymize.New()
+	if err != nil {
+		return nil, httperror.InternalServerError("Unable to anonymize the snapshot", err)
+	}
+
+	if key != "" {
+		decoded, err := hex.DecodeString(key)
+		if err != nil || len(decoded) < minKeySize {
+			return nil, httperror.BadRequest("Invalid anonymization key", errors.New("the key must be hex encoded and at least 16 bytes long"))
+		}
+
+		anonymizer = anonymize.NewWithKey(decoded)
+	}
+
+	data, err := anonymizer.Anonymize(snapshot)
+	if err != nil {
+		return nil, httperror.InternalServerError("Unable to anonymize the snapshot", err)
+	}
+
+	return data, nil
+}
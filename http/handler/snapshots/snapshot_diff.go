@@ -0,0 +1,119 @@
+package snapshots
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/portainer/agent/snapshots"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type snapshotDiffExternalPayload struct {
+	// Snapshot is the snapshot of another environment, as returned by /snapshots/{id} or /replica/snapshot
+	Snapshot json.RawMessage
+	// Key is the hex encoded key the snapshot was anonymized with, the current snapshot is anonymized with the same
+	// key before the comparison. Empty when the snapshot is not anonymized.
+	Key string
+}
+
+func (payload *snapshotDiffExternalPayload) Validate(r *http.Request) error {
+	if len(payload.Snapshot) == 0 {
+		return errors.New("missing snapshot")
+	}
+
+	return nil
+}
+
+// GET request on /snapshots/diff?since=<duration>&from=<id>&to=<id>
+// Returns the containers, images, volumes and networks added, removed and changed, and the changed engine settings,
+// between two snapshots. The snapshot to compare from is the one identified by from, or the last one stored at
+// least since ago (e.g. 6h). The snapshot to compare to is the one identified by to, current by default.
+func (handler *Handler) snapshotDiff(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	store, err := snapshots.DefaultStore()
+	if err != nil {
+		return httperror.NotFound("The history of the snapshots is disabled", err)
+	}
+
+	fromID, _ := request.RetrieveQueryParameter(r, "from", true)
+	toID, _ := request.RetrieveQueryParameter(r, "to", true)
+	since, _ := request.RetrieveQueryParameter(r, "since", true)
+
+	if toID == "" {
+		toID = currentSnapshotID
+	}
+
+	if fromID == "" {
+		if since == "" {
+			return httperror.BadRequest("Invalid query parameters", errors.New("either from or since must be set"))
+		}
+
+		duration, err := time.ParseDuration(since)
+		if err != nil || duration <= 0 {
+			return httperror.BadRequest("Invalid since query parameter", errors.New("since must be a positive duration, e.g. 6h"))
+		}
+
+		entry, err := store.Before(time.Now().Add(-duration))
+		if err != nil {
+			return httperror.NotFound("No snapshot was stored "+since+" ago", err)
+		}
+
+		fromID = entry.ID
+	}
+
+	from, handlerErr := loadSnapshot(r.Context(), store, fromID)
+	if handlerErr != nil {
+		return handlerErr
+	}
+
+	to, handlerErr := loadSnapshot(r.Context(), store, toID)
+	if handlerErr != nil {
+		return handlerErr
+	}
+
+	diff, err := snapshots.Compare(from, to)
+	if err != nil {
+		return httperror.InternalServerError("Unable to compare the snapshots", err)
+	}
+
+	return response.JSON(rw, diff)
+}
+
+// POST request on /snapshots/diff
+// Returns the differences between the snapshot of another environment and the current snapshot of this one. When
+// the snapshot is anonymized, the current snapshot is anonymized with the same key so that the resources are matched
+// by their hashed names.
+func (handler *Handler) snapshotDiffExternal(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	var payload snapshotDiffExternalPayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	store, err := snapshots.DefaultStore()
+	if err != nil {
+		return httperror.NotFound("The history of the snapshots is disabled", err)
+	}
+
+	current, handlerErr := loadSnapshot(r.Context(), store, currentSnapshotID)
+	if handlerErr != nil {
+		return handlerErr
+	}
+
+	if payload.Key != "" {
+		current, handlerErr = anonymizeSnapshot(current, payload.Key)
+		if handlerErr != nil {
+			return handlerErr
+		}
+	}
+
+	diff, err := snapshots.Compare(payload.Snapshot, current)
+	if err != nil {
+		return httperror.BadRequest("Unable to compare the snapshots", err)
+	}
+
+	return response.JSON(rw, diff)
+}
@@ -0,0 +1,42 @@
+package snapshots
+
+import (
+	"net/http"
+
+	"github.com/portainer/agent/snapshots"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// GET request on /snapshots/{id}?anonymize=<true|false>&key=<hex>
+// Returns the stored snapshot identified by id (its Unix time), or a new snapshot when id is current. The anonymized
+// snapshot can be compared with the snapshot of another environment anonymized with the same key.
+func (handler *Handler) snapshotInspect(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	id, err := request.RetrieveRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid snapshot identifier route variable", err)
+	}
+
+	store, err := snapshots.DefaultStore()
+	if err != nil {
+		return httperror.NotFound("The history of the snapshots is disabled", err)
+	}
+
+	snapshot, handlerErr := loadSnapshot(r.Context(), store, id)
+	if handlerErr != nil {
+		return handlerErr
+	}
+
+	anonymized, _ := request.RetrieveBooleanQueryParameter(r, "anonymize", true)
+	if anonymized {
+		key, _ := request.RetrieveQueryParameter(r, "key", true)
+
+		snapshot, handlerErr = anonymizeSnapshot(snapshot, key)
+		if handlerErr != nil {
+			return handlerErr
+		}
+	}
+
+	return response.JSON(rw, snapshot)
+}
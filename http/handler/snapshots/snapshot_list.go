@@ -0,0 +1,20 @@
+package snapshots
+
+import (
+	"net/http"
+
+	"github.com/portainer/agent/snapshots"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// GET request on /snapshots
+// Returns the stored snapshots of the environment, the most recent first
+func (handler *Handler) snapshotList(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	store, err := snapshots.DefaultStore()
+	if err != nil {
+		return httperror.NotFound("The history of the snapshots is disabled", err)
+	}
+
+	return response.JSON(rw, store.List())
+}
@@ -0,0 +1,52 @@
+package stacks
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/http/proxy"
+	"github.com/portainer/agent/http/security"
+	agentnet "github.com/portainer/agent/net"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+)
+
+// Handler represents an HTTP API Handler for stack inspection and maintenance
+type Handler struct {
+	*mux.Router
+	redactor *docker.EnvRedactor
+}
+
+// NewHandler returns a new instance of Handler
+// The values whose name matches one of redactionPatterns are redacted, DefaultRedactionPatterns are used when empty.
+func NewHandler(agentProxy *proxy.AgentProxy, notaryService *security.NotaryService, policyService *security.PolicyService, redactionPatterns []string) *Handler {
+	h := &Handler{
+		Router:   mux.NewRouter(),
+		redactor: docker.NewEnvRedactor(redactionPatterns),
+	}
+
+	h.Handle("/stacks/locks",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.stackLocks)))).Methods(http.MethodGet)
+	h.Handle("/stacks/preflight",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.stackPreflight)))).Methods(http.MethodPost)
+	h.Handle("/stacks/migrations",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.stackMigrationList)))).Methods(http.MethodGet)
+	h.Handle("/stacks/{name}/migration",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(policyService.RequireOperation(agent.OperationStackMigration, httperror.LoggerHandler(h.stackMigrationExport))))).Methods(http.MethodGet)
+	h.Handle("/stacks/{name}/migration",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(policyService.RequireOperation(agent.OperationStackMigration, httperror.LoggerHandler(h.stackMigrationImport))))).Methods(http.MethodPut)
+	h.Handle("/stacks/{name}/migration/{action}",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(policyService.RequireOperation(agent.OperationStackMigration, httperror.LoggerHandler(h.stackMigrationAction))))).Methods(http.MethodPost)
+	h.Handle("/stacks/{name}/config",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.stackConfig)))).Methods(http.MethodGet)
+	h.Handle("/stacks/{name}/pause",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.stackPause)))).Methods(http.MethodPost)
+	h.Handle("/stacks/{name}/resume",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.stackResume)))).Methods(http.MethodPost)
+	h.Handle("/stacks/{name}/sync",
+		agentProxy.Redirect(notaryService.DigitalSignatureVerification(policyService.RequireOperation(agent.OperationStackSync, agentnet.MeterHandler(agentnet.BandwidthFileTransfers, httperror.LoggerHandler(h.stackSync)))))).Methods(http.MethodPost)
+
+	return h
+}
@@ -0,0 +1,25 @@
+package stacks
+
+import (
+	"net/http"
+
+	"github.com/portainer/agent/docker"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// GET request on /stacks/{name}/config
+func (handler *Handler) stackConfig(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	stackName, err := request.RetrieveRouteVariableValue(r, "name")
+	if err != nil {
+		return httperror.BadRequest("Invalid stack name route variable", err)
+	}
+
+	stackConfig, err := docker.GetStackConfiguration(r.Context(), stackName, handler.redactor)
+	if err != nil {
+		return httperror.InternalServerError("Unable to retrieve the stack configuration", err)
+	}
+
+	return response.JSON(rw, stackConfig)
+}
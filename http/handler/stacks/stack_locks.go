@@ -0,0 +1,15 @@
+package stacks
+
+import (
+	"net/http"
+
+	"github.com/portainer/agent/stacklock"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// GET request on /stacks/locks
+// Returns the operations running or waiting to run on the stacks of the node, the oldest first
+func (handler *Handler) stackLocks(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	return response.JSON(rw, stacklock.Locks())
+}
@@ -0,0 +1,133 @@
+package stacks
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/portainer/agent/migration"
+	"github.com/portainer/agent/stacklock"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+
+	"github.com/rs/zerolog/log"
+)
+
+type stackMigrationImportPayload struct {
+	migration.Bundle
+}
+
+func (payload *stackMigrationImportPayload) Validate(r *http.Request) error {
+	return payload.Bundle.Validate()
+}
+
+// GET request on /stacks/migrations
+func (handler *Handler) stackMigrationList(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	manager := migration.DefaultManager()
+	if manager == nil {
+		return httperror.NotFound("The stack migrations are not enabled", migration.ErrDisabled)
+	}
+
+	return response.JSON(rw, manager.Records())
+}
+
+// GET request on /stacks/{name}/migration
+// Exports the bundle of the stack migrated from this agent, which contains the content of its secret files
+func (handler *Handler) stackMigrationExport(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	manager := migration.DefaultManager()
+	if manager == nil {
+		return httperror.NotFound("The stack migrations are not enabled", migration.ErrDisabled)
+	}
+
+	stackName, err := request.RetrieveRouteVariableValue(r, "name")
+	if err != nil {
+		return httperror.BadRequest("Invalid stack name route variable", err)
+	}
+
+	bundle, err := manager.Export(r.Context(), stackName)
+	if errors.Is(err, migration.ErrStackNotFound) {
+		return httperror.NotFound("Unable to find the stack", err)
+	} else if err != nil {
+		return httperror.InternalServerError("Unable to export the stack", err)
+	}
+
+	log.Info().Str("stack", stackName).Int("volumes", len(bundle.Volumes)).Msg("stack exported for a migration")
+
+	return response.JSON(rw, bundle)
+}
+
+// PUT request on /stacks/{name}/migration
+// Imports the bundle of a stack migrated to this agent, the stack is started once its volumes are restored
+func (handler *Handler) stackMigrationImport(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	manager := migration.DefaultManager()
+	if manager == nil {
+		return httperror.NotFound("The stack migrations are not enabled", migration.ErrDisabled)
+	}
+
+	stackName, err := request.RetrieveRouteVariableValue(r, "name")
+	if err != nil {
+		return httperror.BadRequest("Invalid stack name route variable", err)
+	}
+
+	// the content of the files is encoded in base64 in the payload
+	r.Body = http.MaxBytesReader(rw, r.Body, 2*migration.MaxBundleSize)
+
+	var payload stackMigrationImportPayload
+	err = request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	if payload.Stack != stackName {
+		return httperror.BadRequest("Invalid request payload", errors.New("the bundle is not the bundle of the stack"))
+	}
+
+	release, err := stacklock.Acquire(r.Context(), stackName, "migration_import")
+	if err != nil {
+		return httperror.InternalServerError("Unable to lock the stack", err)
+	}
+	defer release()
+
+	err = manager.Import(r.Context(), &payload.Bundle)
+	if err != nil {
+		return httperror.InternalServerError("Unable to import the stack", err)
+	}
+
+	return response.Empty(rw)
+}
+
+// POST request on /stacks/{name}/migration/{action}
+// Executes a step of the migration: cutover, complete and rollback on the source, start and abort on the target
+func (handler *Handler) stackMigrationAction(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	manager := migration.DefaultManager()
+	if manager == nil {
+		return httperror.NotFound("The stack migrations are not enabled", migration.ErrDisabled)
+	}
+
+	stackName, err := request.RetrieveRouteVariableValue(r, "name")
+	if err != nil {
+		return httperror.BadRequest("Invalid stack name route variable", err)
+	}
+
+	action, err := request.RetrieveRouteVariableValue(r, "action")
+	if err != nil {
+		return httperror.BadRequest("Invalid action route variable", err)
+	}
+
+	release, err := stacklock.Acquire(r.Context(), stackName, "migration_"+action)
+	if err != nil {
+		return httperror.InternalServerError("Unable to lock the stack", err)
+	}
+	defer release()
+
+	err = manager.Execute(r.Context(), stackName, action)
+	if errors.Is(err, migration.ErrUnknownAction) {
+		return httperror.BadRequest("Invalid action route variable", err)
+	} else if errors.Is(err, migration.ErrInvalidState) {
+		return &httperror.HandlerError{StatusCode: http.StatusConflict, Message: "Unable to execute the migration step", Err: err}
+	} else if err != nil {
+		return httperror.InternalServerError("Unable to execute the migration step", err)
+	}
+
+	return response.Empty(rw)
+}
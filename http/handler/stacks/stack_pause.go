@@ -0,0 +1,53 @@
+package stacks
+
+import (
+	"net/http"
+
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/stacklock"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// POST request on /stacks/{name}/pause
+func (handler *Handler) stackPause(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	stackName, err := request.RetrieveRouteVariableValue(r, "name")
+	if err != nil {
+		return httperror.BadRequest("Invalid stack name route variable", err)
+	}
+
+	release, err := stacklock.Acquire(r.Context(), stackName, "pause")
+	if err != nil {
+		return httperror.InternalServerError("Unable to lock the stack", err)
+	}
+	defer release()
+
+	results, err := docker.PauseStack(r.Context(), stackName)
+	if err != nil {
+		return httperror.InternalServerError("Unable to pause the stack", err)
+	}
+
+	return response.JSON(rw, results)
+}
+
+// POST request on /stacks/{name}/resume
+func (handler *Handler) stackResume(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	stackName, err := request.RetrieveRouteVariableValue(r, "name")
+	if err != nil {
+		return httperror.BadRequest("Invalid stack name route variable", err)
+	}
+
+	release, err := stacklock.Acquire(r.Context(), stackName, "resume")
+	if err != nil {
+		return httperror.InternalServerError("Unable to lock the stack", err)
+	}
+	defer release()
+
+	results, err := docker.ResumeStack(r.Context(), stackName)
+	if err != nil {
+		return httperror.InternalServerError("Unable to resume the stack", err)
+	}
+
+	return response.JSON(rw, results)
+}
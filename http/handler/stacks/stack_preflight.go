@@ -0,0 +1,45 @@
+package stacks
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/portainer/agent/preflight"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type stackPreflightPayload struct {
+	// Name is the name of the stack, the resources of the stack already deployed with this name are replaced by the
+	// deployment
+	Name             string
+	StackFileContent string
+}
+
+func (payload *stackPreflightPayload) Validate(r *http.Request) error {
+	if payload.StackFileContent == "" {
+		return errors.New("Missing stack file content")
+	}
+
+	return nil
+}
+
+// POST request on /stacks/preflight
+// Checks that the ports published by a compose file are free, that the host paths it bind mounts exist, that its
+// images can be pulled for the platform of the host and that the host has enough memory and disk, before the stack
+// is deployed. The report is returned whether the checks passed or not.
+func (handler *Handler) stackPreflight(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	var payload stackPreflightPayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	report, err := preflight.Run(r.Context(), payload.Name, payload.StackFileContent)
+	if err != nil {
+		return httperror.BadRequest("Unable to run the preflight checks of the stack", err)
+	}
+
+	return response.JSON(rw, report)
+}
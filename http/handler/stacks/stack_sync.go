@@ -0,0 +1,94 @@
+package stacks
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/filesystem"
+	"github.com/portainer/agent/stacklock"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type stackSyncResponse struct {
+	Source    string   `json:"Source"`
+	Written   []string `json:"Written"`
+	Deleted   []string `json:"Deleted"`
+	Restarted []string `json:"Restarted"`
+}
+
+// POST request on /stacks/{name}/sync?target=<target>&delete=<path>&restart=<restart>
+// Synchronizes a local directory with the host directory bind mounted on the target path by the containers of a
+// Compose stack, to develop against the stack running on the agent. The gzip compressed tar archive of the request
+// body, containing the changed files, is extracted inside the directory and the delete paths, relative to the
+// directory, are removed. The containers mounting the directory are restarted when restart is set.
+func (handler *Handler) stackSync(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	stackName, err := request.RetrieveRouteVariableValue(r, "name")
+	if err != nil {
+		return httperror.BadRequest("Invalid stack name route variable", err)
+	}
+
+	target, err := request.RetrieveQueryParameter(r, "target", false)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: target", err)
+	}
+
+	restart, _ := request.RetrieveBooleanQueryParameter(r, "restart", true)
+
+	release, err := stacklock.Acquire(r.Context(), stackName, "sync")
+	if err != nil {
+		return httperror.InternalServerError("Unable to lock the stack", err)
+	}
+	defer release()
+
+	bindMount, err := docker.GetStackBindMount(r.Context(), stackName, target)
+	if errors.Is(err, docker.ErrBindMountNotFound) {
+		return httperror.NotFound("Unable to find the bind mount of the target path", err)
+	} else if err != nil {
+		return httperror.InternalServerError("Unable to retrieve the bind mount of the target path", err)
+	}
+
+	hostPath := filepath.Join(agent.HostRoot, bindMount.Source)
+
+	resp := stackSyncResponse{
+		Source:    bindMount.Source,
+		Written:   []string{},
+		Deleted:   []string{},
+		Restarted: []string{},
+	}
+
+	if r.ContentLength != 0 {
+		resp.Written, err = filesystem.ExtractArchive(r.Context(), r.Body, hostPath)
+		if err != nil {
+			return httperror.BadRequest("Unable to extract the archive", err)
+		}
+	}
+
+	for _, path := range r.URL.Query()["delete"] {
+		err := filesystem.RemoveInsideDirectory(hostPath, path)
+		if err != nil {
+			return httperror.BadRequest("Unable to delete the file", err)
+		}
+
+		resp.Deleted = append(resp.Deleted, path)
+	}
+
+	if !restart {
+		return response.JSON(rw, resp)
+	}
+
+	for _, containerID := range bindMount.Containers {
+		err := docker.ContainerRestart(containerID)
+		if err != nil {
+			return httperror.InternalServerError("Unable to restart the container", err)
+		}
+
+		resp.Restarted = append(resp.Restarted, containerID)
+	}
+
+	return response.JSON(rw, resp)
+}
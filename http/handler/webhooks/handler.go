@@ -0,0 +1,37 @@
+package webhooks
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/portainer/agent/http/security"
+	"github.com/portainer/agent/operations"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+)
+
+// Handler represents an HTTP API Handler for webhooks sent directly to the agent by external systems
+type Handler struct {
+	*mux.Router
+	operationManager *operations.Manager
+	autoUpdate       bool
+}
+
+// NewHandler returns a new instance of Handler.
+// Webhook requests are not signed by a Portainer instance, they are authenticated via an HMAC payload signature or a shared token instead.
+// When autoUpdate is set, the containers and services using an image pushed to a registry are redeployed
+// in the background through operations.
+func NewHandler(webhookService *security.WebhookService, operationManager *operations.Manager, autoUpdate bool) *Handler {
+	h := &Handler{
+		Router:           mux.NewRouter(),
+		operationManager: operationManager,
+		autoUpdate:       autoUpdate,
+	}
+
+	h.Handle("/webhooks/redeploy",
+		webhookService.WebhookSignatureVerification(httperror.LoggerHandler(h.webhookRedeploy))).Methods(http.MethodPost)
+	h.Handle("/webhooks/registry",
+		webhookService.WebhookTokenVerification(httperror.LoggerHandler(h.webhookRegistry))).Methods(http.MethodPost)
+
+	return h
+}
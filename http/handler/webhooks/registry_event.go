@@ -0,0 +1,95 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+type (
+	// dockerHubEvent is the payload sent by Docker Hub when an image is pushed
+	dockerHubEvent struct {
+		PushData struct {
+			Tag string `json:"tag"`
+		} `json:"push_data"`
+		Repository struct {
+			RepoName string `json:"repo_name"`
+		} `json:"repository"`
+	}
+
+	// harborEvent is the payload sent by Harbor when an artifact is pushed
+	harborEvent struct {
+		Type      string `json:"type"`
+		EventData struct {
+			Resources []struct {
+				Tag         string `json:"tag"`
+				ResourceURL string `json:"resource_url"`
+			} `json:"resources"`
+		} `json:"event_data"`
+	}
+
+	// distributionEvents is the payload sent by a Docker distribution registry (notifications endpoint)
+	distributionEvents struct {
+		Events []struct {
+			Action string `json:"action"`
+			Target struct {
+				Repository string `json:"repository"`
+				Tag        string `json:"tag"`
+			} `json:"target"`
+			Request struct {
+				Host string `json:"host"`
+			} `json:"request"`
+		} `json:"events"`
+	}
+)
+
+// parseRegistryEvent extracts the pushed image references from a Docker Hub, Harbor or
+// Docker distribution registry notification payload.
+func parseRegistryEvent(payload []byte) ([]string, error) {
+	var harbor harborEvent
+	if err := json.Unmarshal(payload, &harbor); err == nil && harbor.Type != "" {
+		if harbor.Type != "PUSH_ARTIFACT" {
+			return []string{}, nil
+		}
+
+		images := []string{}
+		for _, resource := range harbor.EventData.Resources {
+			if resource.ResourceURL != "" && resource.Tag != "" {
+				images = append(images, resource.ResourceURL)
+			}
+		}
+
+		return images, nil
+	}
+
+	var distribution distributionEvents
+	if err := json.Unmarshal(payload, &distribution); err == nil && len(distribution.Events) > 0 {
+		images := []string{}
+		for _, event := range distribution.Events {
+			if event.Action != "push" || event.Target.Tag == "" {
+				continue
+			}
+
+			image := event.Target.Repository + ":" + event.Target.Tag
+			if event.Request.Host != "" {
+				image = event.Request.Host + "/" + image
+			}
+
+			images = append(images, image)
+		}
+
+		return images, nil
+	}
+
+	var hub dockerHubEvent
+	if err := json.Unmarshal(payload, &hub); err == nil && hub.Repository.RepoName != "" {
+		tag := hub.PushData.Tag
+		if tag == "" {
+			tag = "latest"
+		}
+
+		return []string{strings.TrimSuffix(hub.Repository.RepoName, "/") + ":" + tag}, nil
+	}
+
+	return nil, errors.New("unsupported registry event payload")
+}
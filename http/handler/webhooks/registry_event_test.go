@@ -0,0 +1,59 @@
+package webhooks
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRegistryEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  string
+		expected []string
+		wantErr  bool
+	}{
+		{
+			name:     "docker hub push",
+			payload:  `{"push_data":{"tag":"1.2"},"repository":{"repo_name":"portainer/agent"}}`,
+			expected: []string{"portainer/agent:1.2"},
+		},
+		{
+			name:     "docker hub push without tag",
+			payload:  `{"push_data":{},"repository":{"repo_name":"portainer/agent"}}`,
+			expected: []string{"portainer/agent:latest"},
+		},
+		{
+			name:     "harbor push",
+			payload:  `{"type":"PUSH_ARTIFACT","event_data":{"resources":[{"tag":"v1","resource_url":"harbor.local/library/nginx:v1"}]}}`,
+			expected: []string{"harbor.local/library/nginx:v1"},
+		},
+		{
+			name:     "harbor non push event",
+			payload:  `{"type":"DELETE_ARTIFACT","event_data":{"resources":[{"tag":"v1","resource_url":"harbor.local/library/nginx:v1"}]}}`,
+			expected: []string{},
+		},
+		{
+			name:     "distribution push and pull",
+			payload:  `{"events":[{"action":"push","target":{"repository":"app","tag":"2"},"request":{"host":"registry.internal:5000"}},{"action":"pull","target":{"repository":"app","tag":"2"}}]}`,
+			expected: []string{"registry.internal:5000/app:2"},
+		},
+		{
+			name:    "unknown payload",
+			payload: `{"foo":"bar"}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			images, err := parseRegistryEvent([]byte(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(images, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, images)
+			}
+		})
+	}
+}
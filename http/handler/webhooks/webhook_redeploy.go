@@ -0,0 +1,56 @@
+package webhooks
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/portainer/agent/docker"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+	"github.com/rs/zerolog/log"
+)
+
+type redeployPayload struct {
+	// Stack is the name of the stack to redeploy
+	Stack string
+	// Service is the name of the Swarm service to redeploy
+	Service string
+}
+
+func (payload *redeployPayload) Validate(r *http.Request) error {
+	if (payload.Stack == "") == (payload.Service == "") {
+		return errors.New("Either a stack or a service must be specified")
+	}
+
+	return nil
+}
+
+// POST request on /webhooks/redeploy
+func (handler *Handler) webhookRedeploy(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	var payload redeployPayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	if payload.Service != "" {
+		log.Info().Str("service", payload.Service).Msg("redeploying service from webhook")
+
+		err = docker.RedeployService(r.Context(), payload.Service)
+		if err != nil {
+			return httperror.InternalServerError("Unable to redeploy the service", err)
+		}
+
+		return response.Empty(rw)
+	}
+
+	log.Info().Str("stack", payload.Stack).Msg("redeploying stack from webhook")
+
+	err = docker.RedeployStack(r.Context(), payload.Stack)
+	if err != nil {
+		return httperror.InternalServerError("Unable to redeploy the stack", err)
+	}
+
+	return response.Empty(rw)
+}
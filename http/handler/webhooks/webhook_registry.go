@@ -0,0 +1,69 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/http/security"
+	"github.com/portainer/agent/operations"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+	"github.com/rs/zerolog/log"
+)
+
+type registryWebhookResult struct {
+	docker.ImageConsumer
+	// OperationID is the identifier of the operation updating the consumer, when auto update is enabled
+	OperationID string `json:"OperationId,omitempty"`
+}
+
+// POST request on /webhooks/registry
+func (handler *Handler) webhookRegistry(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	payload, err := io.ReadAll(io.LimitReader(r.Body, security.MaxWebhookPayloadSize))
+	if err != nil {
+		return httperror.BadRequest("Unable to read request payload", err)
+	}
+
+	images, err := parseRegistryEvent(payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	results := []registryWebhookResult{}
+	if len(images) == 0 {
+		return response.JSON(rw, results)
+	}
+
+	consumers, err := docker.FindImageConsumers(r.Context(), images)
+	if err != nil {
+		return httperror.InternalServerError("Unable to find the containers and services using the pushed images", err)
+	}
+
+	// Registries expect a quick answer, the updates are executed in the background
+	for _, consumer := range consumers {
+		result := registryWebhookResult{ImageConsumer: consumer}
+
+		if handler.autoUpdate {
+			consumer := consumer
+
+			op := handler.operationManager.StartDisruptive("image_consumer_update", func(ctx context.Context, progress *operations.Progress) (interface{}, error) {
+				err := docker.UpdateImageConsumer(ctx, consumer)
+				if err != nil {
+					log.Warn().Str("name", consumer.Name).Err(err).Msg("unable to update image consumer")
+				}
+
+				return consumer, err
+			})
+
+			result.OperationID = op.ID
+		}
+
+		results = append(results, result)
+	}
+
+	log.Info().Strs("images", images).Int("matches", len(results)).Bool("auto_update", handler.autoUpdate).Msg("registry webhook received")
+
+	return response.JSON(rw, results)
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/portainer/agent"
+	"github.com/portainer/agent/audit"
 	"github.com/portainer/agent/http/proxy"
 	httperror "github.com/portainer/portainer/pkg/libhttp/error"
 	"github.com/portainer/portainer/pkg/libhttp/request"
@@ -53,7 +54,10 @@ func (handler *Handler) handleAttachRequest(w http.ResponseWriter, r *http.Reque
 	}
 	defer websocketConn.Close()
 
-	err = hijackAttachStartOperation(websocketConn, attachID)
+	session := startSession(r, audit.SessionAttach, attachID, "")
+
+	err = hijackAttachStartOperation(websocketConn, attachID, session)
+	session.End(err)
 	if err != nil {
 		return httperror.InternalServerError("An error occurred during websocket attach operation", err)
 	}
@@ -61,7 +65,7 @@ func (handler *Handler) handleAttachRequest(w http.ResponseWriter, r *http.Reque
 	return nil
 }
 
-func hijackAttachStartOperation(websocketConn *websocket.Conn, attachID string) error {
+func hijackAttachStartOperation(websocketConn *websocket.Conn, attachID string, session *audit.Session) error {
 	dial, err := createDial()
 	if err != nil {
 		return err
@@ -85,7 +89,7 @@ func hijackAttachStartOperation(websocketConn *websocket.Conn, attachID string)
 		return err
 	}
 
-	return hijackRequest(websocketConn, httpConn, attachStartRequest)
+	return hijackRequest(websocketConn, httpConn, attachStartRequest, session)
 }
 
 func createAttachStartRequest(attachID string) (*http.Request, error) {
@@ -0,0 +1,48 @@
+package websocket
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/audit"
+)
+
+// auditReader records the data read from the session as its output
+type auditReader struct {
+	reader  io.Reader
+	session *audit.Session
+}
+
+func (ar auditReader) Read(p []byte) (int, error) {
+	n, err := ar.reader.Read(p)
+	ar.session.Output(p[:n])
+
+	return n, err
+}
+
+// auditWriter records the data written to the session as its input
+type auditWriter struct {
+	writer  io.Writer
+	session *audit.Session
+}
+
+func (aw auditWriter) Write(p []byte) (int, error) {
+	aw.session.Input(p)
+
+	return aw.writer.Write(p)
+}
+
+// recordStreams returns the output and input streams of the session, recorded when the session records its data
+func recordStreams(session *audit.Session, reader io.Reader, writer io.Writer) (io.Reader, io.Writer) {
+	if !session.RecordsData() {
+		return reader, writer
+	}
+
+	return auditReader{reader: reader, session: session}, auditWriter{writer: writer, session: session}
+}
+
+// startSession records the start of a session opened by the request
+func startSession(r *http.Request, kind, target, command string) *audit.Session {
+	return audit.StartSession(kind, target, command, r.Header.Get(agent.HTTPResourceOwnerHeaderName), r.RemoteAddr)
+}
@@ -4,8 +4,10 @@ package websocket
 
 import (
 	"net"
+
+	"github.com/portainer/agent/broker"
 )
 
 func createDial() (net.Conn, error) {
-	return net.Dial("unix", "/var/run/docker.sock")
+	return net.Dial("unix", broker.DockerSocketPath())
 }
@@ -0,0 +1,114 @@
+package websocket
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/http/proxy"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	eventsWriteTimeout = 10 * time.Second
+	eventsPingInterval = 30 * time.Second
+	eventsPongTimeout  = 2 * eventsPingInterval
+)
+
+// websocketEvents streams the changes of the containers, images, volumes and networks of the node as JSON messages,
+// so that the server can refresh its view as soon as they happen. The optional type query parameter is a comma
+// separated list of the types of resource to stream. In Edge mode the tunnel stays open while the websocket is
+// connected. The websocket is closed when the client does not keep up with the events, the client must then refresh
+// its view before connecting again.
+func (handler *Handler) websocketEvents(w http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	if handler.containerPlatform != agent.PlatformDocker && handler.containerPlatform != agent.PlatformPodman {
+		return httperror.NotFound("The events are only available on the Docker platform", errors.New("unsupported platform"))
+	}
+
+	if handler.clusterService == nil {
+		return handler.handleEventsRequest(w, r)
+	}
+
+	agentTargetHeader := r.Header.Get(agent.HTTPTargetHeaderName)
+	if agentTargetHeader == "" || agentTargetHeader == handler.runtimeConfiguration.NodeName {
+		return handler.handleEventsRequest(w, r)
+	}
+
+	targetMember := handler.clusterService.GetMemberByNodeName(agentTargetHeader)
+	if targetMember == nil {
+		return httperror.InternalServerError("The agent was unable to contact any other agent", errors.New("Unable to find the targeted agent"))
+	}
+
+	proxy.WebsocketRequest(w, r, targetMember)
+	return nil
+}
+
+func (handler *Handler) handleEventsRequest(w http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	var types []string
+	if typeFilter, _ := request.RetrieveQueryParameter(r, "type", true); typeFilter != "" {
+		types = strings.Split(typeFilter, ",")
+	}
+
+	r.Header.Del("Origin")
+
+	websocketConn, err := handler.connectionUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return httperror.InternalServerError("An error occurred during websocket events operation: unable to upgrade connection", err)
+	}
+	defer websocketConn.Close()
+
+	events, unsubscribe := docker.SubscribeEvents(types)
+	defer unsubscribe()
+
+	closed := make(chan struct{})
+	go readUntilClosed(websocketConn, closed)
+
+	ticker := time.NewTicker(eventsPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				websocketConn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "events dropped"), time.Now().Add(eventsWriteTimeout))
+
+				return nil
+			}
+
+			websocketConn.SetWriteDeadline(time.Now().Add(eventsWriteTimeout))
+			if err := websocketConn.WriteJSON(event); err != nil {
+				return nil
+			}
+		case <-ticker.C:
+			if err := websocketConn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventsWriteTimeout)); err != nil {
+				return nil
+			}
+		case <-closed:
+			return nil
+		}
+	}
+}
+
+// readUntilClosed discards the messages of the client and closes closed when the connection is closed or when no pong
+// is received in time
+func readUntilClosed(websocketConn *websocket.Conn, closed chan struct{}) {
+	defer close(closed)
+
+	websocketConn.SetReadLimit(maxWebsocketMessageSize)
+	websocketConn.SetReadDeadline(time.Now().Add(eventsPongTimeout))
+	websocketConn.SetPongHandler(func(string) error {
+		return websocketConn.SetReadDeadline(time.Now().Add(eventsPongTimeout))
+	})
+
+	for {
+		if _, _, err := websocketConn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
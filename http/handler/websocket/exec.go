@@ -4,18 +4,22 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"net/http/httputil"
+	"strings"
 	"time"
 
 	"github.com/portainer/agent"
+	"github.com/portainer/agent/audit"
 	"github.com/portainer/agent/http/proxy"
 	httperror "github.com/portainer/portainer/pkg/libhttp/error"
 	"github.com/portainer/portainer/pkg/libhttp/request"
 
 	"github.com/asaskevich/govalidator"
 	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
 )
 
 func (handler *Handler) websocketExec(w http.ResponseWriter, r *http.Request) *httperror.HandlerError {
@@ -54,7 +58,22 @@ func (handler *Handler) handleExecRequest(rw http.ResponseWriter, r *http.Reques
 	}
 	defer websocketConn.Close()
 
-	err = hijackExecStartOperation(websocketConn, execID)
+	var session *audit.Session
+	if audit.Enabled() {
+		target, command := execID, ""
+
+		process, err := inspectExec(execID)
+		if err != nil {
+			log.Warn().Err(err).Str("exec_id", execID).Msg("unable to inspect the exec instance of the audited session")
+		} else {
+			target, command = process.ContainerID, process.command()
+		}
+
+		session = startSession(r, audit.SessionExec, target, command)
+	}
+
+	err = hijackExecStartOperation(websocketConn, execID, session)
+	session.End(err)
 	if err != nil {
 		return httperror.InternalServerError("An error occurred during websocket exec hijack operation", err)
 	}
@@ -62,7 +81,7 @@ func (handler *Handler) handleExecRequest(rw http.ResponseWriter, r *http.Reques
 	return nil
 }
 
-func hijackExecStartOperation(websocketConn *websocket.Conn, execID string) error {
+func hijackExecStartOperation(websocketConn *websocket.Conn, execID string, session *audit.Session) error {
 	dial, err := createDial()
 	if err != nil {
 		return err
@@ -86,7 +105,51 @@ func hijackExecStartOperation(websocketConn *websocket.Conn, execID string) erro
 		return err
 	}
 
-	return hijackRequest(websocketConn, httpConn, execStartRequest)
+	return hijackRequest(websocketConn, httpConn, execStartRequest, session)
+}
+
+// execProcess represents the process of an exec instance, as returned by the inspection of the Docker API
+type execProcess struct {
+	ContainerID   string
+	ProcessConfig struct {
+		Entrypoint string   `json:"entrypoint"`
+		Arguments  []string `json:"arguments"`
+	}
+}
+
+func (process *execProcess) command() string {
+	return strings.Join(append([]string{process.ProcessConfig.Entrypoint}, process.ProcessConfig.Arguments...), " ")
+}
+
+func inspectExec(execID string) (*execProcess, error) {
+	dial, err := createDial()
+	if err != nil {
+		return nil, err
+	}
+
+	httpConn := httputil.NewClientConn(dial, nil)
+	defer httpConn.Close()
+
+	request, err := http.NewRequest(http.MethodGet, "/exec/"+execID+"/json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpConn.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to inspect the exec instance, received %d", resp.StatusCode)
+	}
+
+	var process execProcess
+
+	err = json.NewDecoder(resp.Body).Decode(&process)
+
+	return &process, err
 }
 
 func createExecStartRequest(execID string) (*http.Request, error) {
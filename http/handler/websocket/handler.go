@@ -18,6 +18,7 @@ type (
 		connectionUpgrader   websocket.Upgrader
 		runtimeConfiguration *agent.RuntimeConfiguration
 		kubeClient           *kubernetes.KubeClient
+		containerPlatform    agent.ContainerPlatform
 	}
 
 	execStartOperationPayload struct {
@@ -27,17 +28,21 @@ type (
 )
 
 // NewHandler returns a new instance of Handler.
-func NewHandler(clusterService agent.ClusterService, config *agent.RuntimeConfiguration, notaryService *security.NotaryService, kubeClient *kubernetes.KubeClient) *Handler {
+func NewHandler(clusterService agent.ClusterService, config *agent.RuntimeConfiguration, notaryService *security.NotaryService, policyService *security.PolicyService, kubeClient *kubernetes.KubeClient, containerPlatform agent.ContainerPlatform) *Handler {
 	h := &Handler{
 		Router:               mux.NewRouter(),
 		connectionUpgrader:   websocket.Upgrader{},
 		clusterService:       clusterService,
 		runtimeConfiguration: config,
 		kubeClient:           kubeClient,
+		containerPlatform:    containerPlatform,
 	}
 
 	h.Handle("/websocket/attach", notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.websocketAttach)))
 	h.Handle("/websocket/exec", notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.websocketExec)))
+	h.Handle("/websocket/events", notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.websocketEvents)))
 	h.Handle("/websocket/pod", notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.websocketPodExec)))
+	h.Handle("/websocket/portforward", notaryService.DigitalSignatureVerification(policyService.RequireOperation(agent.OperationPortForward, httperror.LoggerHandler(h.websocketPortForward))))
+	h.Handle("/websocket/sftp", notaryService.DigitalSignatureVerification(policyService.RequireOperation(agent.OperationSFTP, httperror.LoggerHandler(h.websocketSFTP))))
 	return h
 }
@@ -5,10 +5,12 @@ import (
 	"net/http"
 	"net/http/httputil"
 
+	"github.com/portainer/agent/audit"
+
 	"github.com/gorilla/websocket"
 )
 
-func hijackRequest(websocketConn *websocket.Conn, httpConn *httputil.ClientConn, request *http.Request) error {
+func hijackRequest(websocketConn *websocket.Conn, httpConn *httputil.ClientConn, request *http.Request, session *audit.Session) error {
 	// Server hijacks the connection, error 'connection closed' expected
 	resp, err := httpConn.Do(request)
 	if err != httputil.ErrPersistEOF {
@@ -24,9 +26,11 @@ func hijackRequest(websocketConn *websocket.Conn, httpConn *httputil.ClientConn,
 	tcpConn, brw := httpConn.Hijack()
 	defer tcpConn.Close()
 
+	reader, writer := recordStreams(session, brw, tcpConn)
+
 	errorChan := make(chan error, 1)
-	go streamFromReaderToWebsocket(websocketConn, brw, errorChan)
-	go streamFromWebsocketToWriter(websocketConn, tcpConn, errorChan)
+	go streamFromReaderToWebsocket(websocketConn, reader, errorChan)
+	go streamFromWebsocketToWriter(websocketConn, writer, errorChan)
 
 	err = <-errorChan
 	if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
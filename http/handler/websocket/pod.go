@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/portainer/agent"
+	"github.com/portainer/agent/audit"
 	httperror "github.com/portainer/portainer/pkg/libhttp/error"
 	"github.com/portainer/portainer/pkg/libhttp/request"
 
@@ -49,17 +50,28 @@ func (handler *Handler) websocketPodExec(w http.ResponseWriter, r *http.Request)
 	stdoutReader, stdoutWriter := io.Pipe()
 	defer stdoutWriter.Close()
 
+	session := startSession(r, audit.SessionPod, namespace+"/"+podName+"/"+containerName, command)
+	reader, writer := recordStreams(session, stdoutReader, stdinWriter)
+
 	errorChan := make(chan error, 1)
-	go streamFromWebsocketToWriter(websocketConn, stdinWriter, errorChan)
-	go streamFromReaderToWebsocket(websocketConn, stdoutReader, errorChan)
+	go streamFromWebsocketToWriter(websocketConn, writer, errorChan)
+	go streamFromReaderToWebsocket(websocketConn, reader, errorChan)
 
 	err = handler.kubeClient.StartExecProcess(token, namespace, podName, containerName, commandArray, stdinReader, stdoutWriter)
 	if err != nil {
+		session.End(err)
+
 		return httperror.InternalServerError("Unable to start exec process inside container", err)
 	}
 
 	err = <-errorChan
-	if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+	if !websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+		err = nil
+	}
+
+	session.End(err)
+
+	if err != nil {
 		log.Error().Err(err).Msg("websocket error")
 	}
 
@@ -0,0 +1,103 @@
+package websocket
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/http/proxy"
+	"github.com/portainer/agent/portforward"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+
+	"github.com/gorilla/websocket"
+)
+
+// portForwardBufferSize is the size of the binary messages sent to the client
+const portForwardBufferSize = 32 * 1024
+
+// websocketPortForward forwards a connection of a port-forward session opened with POST /host/port_forward, the
+// data of the connection is exchanged as binary messages
+func (handler *Handler) websocketPortForward(w http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	if handler.clusterService == nil {
+		return handler.handlePortForwardRequest(w, r)
+	}
+
+	agentTargetHeader := r.Header.Get(agent.HTTPTargetHeaderName)
+	if agentTargetHeader == handler.runtimeConfiguration.NodeName {
+		return handler.handlePortForwardRequest(w, r)
+	}
+
+	targetMember := handler.clusterService.GetMemberByNodeName(agentTargetHeader)
+	if targetMember == nil {
+		return httperror.InternalServerError("The agent was unable to contact any other agent", errors.New("Unable to find the targeted agent"))
+	}
+
+	proxy.WebsocketRequest(w, r, targetMember)
+	return nil
+}
+
+func (handler *Handler) handlePortForwardRequest(w http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	broker := portforward.DefaultBroker()
+	if broker == nil {
+		return httperror.NotFound("The port forwarding is not enabled", portforward.ErrDisabled)
+	}
+
+	sessionID, err := request.RetrieveQueryParameter(r, "id", false)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: id", err)
+	}
+
+	// the connection to the target is opened before the upgrade, so that its failure is reported to the client
+	conn, err := broker.Dial(r.Context(), sessionID)
+	switch {
+	case errors.Is(err, portforward.ErrSessionNotFound):
+		return httperror.NotFound("Unable to find the port-forward session", err)
+	case errors.Is(err, portforward.ErrConnectionLimit):
+		return httperror.NewError(http.StatusTooManyRequests, "Unable to open the port-forward connection", err)
+	case err != nil:
+		return httperror.NewError(http.StatusBadGateway, "Unable to connect to the target of the port-forward session", err)
+	}
+	defer conn.Close()
+
+	r.Header.Del("Origin")
+
+	websocketConn, err := handler.connectionUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return httperror.InternalServerError("An error occurred during websocket port-forward operation: unable to upgrade connection", err)
+	}
+	defer websocketConn.Close()
+
+	// both streams report their error, the first one ends the connection and the deferred closes stop the other
+	errorChan := make(chan error, 2)
+	go streamFromConnToWebsocket(websocketConn, conn, errorChan)
+	go streamFromWebsocketToWriter(websocketConn, conn, errorChan)
+
+	err = <-errorChan
+	if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNoStatusReceived, websocket.CloseNormalClosure) {
+		return httperror.InternalServerError("An error occurred during websocket port-forward operation", err)
+	}
+
+	return nil
+}
+
+// streamFromConnToWebsocket sends the data received from the target to the websocket as binary messages, unlike the
+// consoles the data is not text
+func streamFromConnToWebsocket(websocketConn *websocket.Conn, conn net.Conn, errorChan chan error) {
+	out := make([]byte, portForwardBufferSize)
+	for {
+		n, err := conn.Read(out)
+		if n > 0 {
+			if err := websocketConn.WriteMessage(websocket.BinaryMessage, out[:n]); err != nil {
+				errorChan <- err
+				return
+			}
+		}
+
+		if err != nil {
+			errorChan <- err
+			return
+		}
+	}
+}
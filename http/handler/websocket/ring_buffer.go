@@ -0,0 +1,109 @@
+package websocket
+
+import (
+	"io"
+	"sync"
+)
+
+// ringBuffer is a fixed capacity byte buffer shared by a single producer and a single consumer.
+// Writes block while the buffer is full so that a slow consumer (e.g. a distant browser reading a websocket)
+// slows down the producer instead of growing the memory usage of the agent.
+type ringBuffer struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	data   []byte
+	start  int
+	size   int
+	closed bool
+	err    error
+}
+
+func newRingBuffer(capacity int) *ringBuffer {
+	buffer := &ringBuffer{data: make([]byte, capacity)}
+	buffer.cond = sync.NewCond(&buffer.mu)
+
+	return buffer
+}
+
+// Write copies p into the buffer, blocking while the buffer is full. It returns io.ErrClosedPipe once the
+// buffer is closed.
+func (buffer *ringBuffer) Write(p []byte) (int, error) {
+	buffer.mu.Lock()
+	defer buffer.mu.Unlock()
+
+	written := 0
+	for written < len(p) {
+		for buffer.size == len(buffer.data) && !buffer.closed {
+			buffer.cond.Wait()
+		}
+
+		if buffer.closed {
+			return written, io.ErrClosedPipe
+		}
+
+		end := (buffer.start + buffer.size) % len(buffer.data)
+		limit := len(buffer.data)
+		if end < buffer.start {
+			limit = buffer.start
+		}
+
+		n := copy(buffer.data[end:limit], p[written:])
+		buffer.size += n
+		written += n
+
+		buffer.cond.Broadcast()
+	}
+
+	return written, nil
+}
+
+// Read copies the buffered data into p, blocking while the buffer is empty. Once the buffer is closed and
+// drained, it returns the error the buffer was closed with.
+func (buffer *ringBuffer) Read(p []byte) (int, error) {
+	buffer.mu.Lock()
+	defer buffer.mu.Unlock()
+
+	for buffer.size == 0 && !buffer.closed {
+		buffer.cond.Wait()
+	}
+
+	if buffer.size == 0 {
+		return 0, buffer.err
+	}
+
+	read := 0
+	for read < len(p) && buffer.size > 0 {
+		limit := buffer.start + buffer.size
+		if limit > len(buffer.data) {
+			limit = len(buffer.data)
+		}
+
+		n := copy(p[read:], buffer.data[buffer.start:limit])
+		buffer.start = (buffer.start + n) % len(buffer.data)
+		buffer.size -= n
+		read += n
+	}
+
+	buffer.cond.Broadcast()
+
+	return read, nil
+}
+
+// CloseWithError closes the buffer, pending writes are aborted and reads return err once the buffer is drained.
+// A nil err is reported as io.EOF.
+func (buffer *ringBuffer) CloseWithError(err error) {
+	buffer.mu.Lock()
+	defer buffer.mu.Unlock()
+
+	if buffer.closed {
+		return
+	}
+
+	if err == nil {
+		err = io.EOF
+	}
+
+	buffer.closed = true
+	buffer.err = err
+	buffer.cond.Broadcast()
+}
@@ -0,0 +1,92 @@
+package websocket
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRingBufferTransfersDataInOrder(t *testing.T) {
+	buffer := newRingBuffer(7)
+
+	input := bytes.Repeat([]byte("0123456789abcdef"), 1000)
+
+	go func() {
+		for i := 0; i < len(input); i += 5 {
+			end := i + 5
+			if end > len(input) {
+				end = len(input)
+			}
+
+			buffer.Write(input[i:end])
+		}
+
+		buffer.CloseWithError(nil)
+	}()
+
+	output, err := io.ReadAll(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(input, output) {
+		t.Errorf("the data read from the buffer does not match the data written")
+	}
+}
+
+func TestRingBufferBlocksWritesWhenFull(t *testing.T) {
+	buffer := newRingBuffer(4)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := buffer.Write([]byte("abcdef"))
+		done <- err
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("expected the write to block while the buffer is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	out := make([]byte, 4)
+	n, err := buffer.Read(out)
+	if err != nil || string(out[:n]) != "abcd" {
+		t.Fatalf("unexpected read %q, %v", out[:n], err)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRingBufferClose(t *testing.T) {
+	buffer := newRingBuffer(2)
+	closeErr := errors.New("closed")
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := buffer.Write([]byte("abcd"))
+		done <- err
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	buffer.CloseWithError(closeErr)
+
+	if err := <-done; err != io.ErrClosedPipe {
+		t.Errorf("expected the pending write to be aborted, got %v", err)
+	}
+
+	out := make([]byte, 4)
+	n, err := buffer.Read(out)
+	if err != nil || string(out[:n]) != "ab" {
+		t.Errorf("expected the buffered data to be readable after close, got %q, %v", out[:n], err)
+	}
+
+	_, err = buffer.Read(out)
+	if err != closeErr {
+		t.Errorf("expected %v, got %v", closeErr, err)
+	}
+}
@@ -0,0 +1,91 @@
+package websocket
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/http/proxy"
+	agentnet "github.com/portainer/agent/net"
+	"github.com/portainer/agent/sftp"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+)
+
+// websocketSFTP serves an SFTP session tunneled by the Portainer instance, the packets of the session are exchanged
+// as binary messages
+func (handler *Handler) websocketSFTP(w http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	if handler.clusterService == nil {
+		return handler.handleSFTPRequest(w, r)
+	}
+
+	agentTargetHeader := r.Header.Get(agent.HTTPTargetHeaderName)
+	if agentTargetHeader == handler.runtimeConfiguration.NodeName {
+		return handler.handleSFTPRequest(w, r)
+	}
+
+	targetMember := handler.clusterService.GetMemberByNodeName(agentTargetHeader)
+	if targetMember == nil {
+		return httperror.InternalServerError("The agent was unable to contact any other agent", errors.New("Unable to find the targeted agent"))
+	}
+
+	proxy.WebsocketRequest(w, r, targetMember)
+	return nil
+}
+
+func (handler *Handler) handleSFTPRequest(w http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	if agentnet.BandwidthCapExceeded() {
+		return httperror.NewError(http.StatusTooManyRequests, "Unable to open the SFTP session", agentnet.ErrBandwidthCapExceeded)
+	}
+
+	r.Header.Del("Origin")
+
+	websocketConn, err := handler.connectionUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return httperror.InternalServerError("An error occurred during websocket SFTP operation: unable to upgrade connection", err)
+	}
+	defer websocketConn.Close()
+
+	requests, requestsWriter := io.Pipe()
+	defer requests.Close()
+
+	// both streams report their error, the first one ends the session and the deferred closes stop the other
+	errorChan := make(chan error, 2)
+	go streamFromWebsocketToWriter(websocketConn, requestsWriter, errorChan)
+	go func() {
+		err := sftp.Serve(struct {
+			io.Reader
+			io.Writer
+		}{requests, &binaryMessageWriter{conn: websocketConn}})
+		if err != nil {
+			log.Debug().Err(err).Msg("SFTP session ended with an error")
+		}
+
+		errorChan <- io.EOF
+	}()
+
+	err = <-errorChan
+	requestsWriter.Close()
+
+	if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNoStatusReceived, websocket.CloseNormalClosure) {
+		return httperror.InternalServerError("An error occurred during websocket SFTP operation", err)
+	}
+
+	return nil
+}
+
+// binaryMessageWriter sends each write as a binary message, the SFTP session writes a whole packet at once
+type binaryMessageWriter struct {
+	conn *websocket.Conn
+}
+
+func (w *binaryMessageWriter) Write(p []byte) (int, error) {
+	if err := w.conn.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
@@ -7,9 +7,17 @@ import (
 	"github.com/gorilla/websocket"
 )
 
-const readerBufferSize = 2048
+const (
+	readerBufferSize = 2048
+	// streamBufferSize is the maximum amount of output buffered for a client before the reads are paused
+	streamBufferSize = 256 * 1024
+	// maxWebsocketMessageSize is the maximum size of a message received from a client
+	maxWebsocketMessageSize = 1024 * 1024
+)
 
 func streamFromWebsocketToWriter(websocketConn *websocket.Conn, writer io.Writer, errorChan chan error) {
+	websocketConn.SetReadLimit(maxWebsocketMessageSize)
+
 	for {
 		_, in, err := websocketConn.ReadMessage()
 		if err != nil {
@@ -25,18 +33,29 @@ func streamFromWebsocketToWriter(websocketConn *websocket.Conn, writer io.Writer
 	}
 }
 
+// streamFromReaderToWebsocket sends the output of reader to the websocket through a bounded buffer: the reader
+// is consumed while the client is busy receiving the previous messages, up to streamBufferSize bytes, after
+// which the reads are paused until the client catches up.
 func streamFromReaderToWebsocket(websocketConn *websocket.Conn, reader io.Reader, errorChan chan error) {
+	buffer := newRingBuffer(streamBufferSize)
+
+	go func() {
+		_, err := io.Copy(buffer, reader)
+		buffer.CloseWithError(err)
+	}()
+
+	out := make([]byte, readerBufferSize)
 	for {
-		out := make([]byte, readerBufferSize)
-		_, err := reader.Read(out)
+		n, err := buffer.Read(out)
 		if err != nil {
 			errorChan <- err
 			break
 		}
 
-		processedOutput := validString(string(out[:]))
+		processedOutput := validString(string(out[:n]))
 		err = websocketConn.WriteMessage(websocket.TextMessage, []byte(processedOutput))
 		if err != nil {
+			buffer.CloseWithError(err)
 			errorChan <- err
 			break
 		}
@@ -0,0 +1,291 @@
+package idempotency
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+)
+
+// HeaderName is the name of the header containing the key identifying the retries of a request
+const HeaderName = "Idempotency-Key"
+
+// ReplayedHeaderName is the name of the header set on the responses replayed from the cache
+const ReplayedHeaderName = "Idempotent-Replayed"
+
+const (
+	maxKeyLength = 255
+	// maxRequestSize is the maximum size of a request body fingerprinted with the key, the larger requests are not
+	// replayed
+	maxRequestSize = 1024 * 1024
+	// maxResponseSize is the maximum size of a response body stored in the cache, the larger responses are not
+	// replayed
+	maxResponseSize = 1024 * 1024
+	// maxCacheSize is the maximum total size of the response bodies stored in the cache, the oldest responses are
+	// evicted first
+	maxCacheSize = 64 * 1024 * 1024
+)
+
+type entry struct {
+	key         string
+	fingerprint string
+	expiresAt   time.Time
+	done        bool
+
+	statusCode int
+	header     http.Header
+	body       []byte
+
+	element *list.Element
+}
+
+// Cache stores the responses of the mutating requests sent with an Idempotency-Key header, so that a request sent
+// again by a client that did not receive the response is not executed twice. The cache is kept in memory, it does
+// not survive a restart of the agent.
+type Cache struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	order   *list.List
+	size    int
+}
+
+// NewCache returns a pointer to a Cache storing the responses for window
+func NewCache(window time.Duration) *Cache {
+	return &Cache{
+		window:  window,
+		entries: map[string]*entry{},
+		order:   list.New(),
+	}
+}
+
+// IsMutating returns true when the request method can change the state of the node
+func IsMutating(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+
+	return false
+}
+
+// Handler executes next for the first request sent with a key and replays its response to the following requests
+// sent with the same key during the window. The keys are scoped to the public key of the client. A key reused for
+// another request (another method, URL or body) is rejected with a HTTP 422, a request sent again while the first
+// one is still executed is rejected with a HTTP 409. The requests larger than 1MB, the server errors, the responses
+// of the hijacked connections and the responses larger than 1MB are not stored, the request is executed again when
+// it is retried.
+func (cache *Cache) Handler(next http.Handler) http.Handler {
+	return httperror.LoggerHandler(func(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+		idempotencyKey := r.Header.Get(HeaderName)
+		if idempotencyKey == "" || !IsMutating(r) {
+			next.ServeHTTP(rw, r)
+			return nil
+		}
+
+		if len(idempotencyKey) > maxKeyLength {
+			return httperror.BadRequest("Invalid header: "+HeaderName, errors.New("the key must not exceed 255 characters"))
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize+1))
+		if err != nil {
+			return httperror.BadRequest("Unable to read the request body", err)
+		}
+
+		if len(body) > maxRequestSize {
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+
+			next.ServeHTTP(rw, r)
+			return nil
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		bodyHash := sha256.Sum256(body)
+
+		key := r.Header.Get(agent.HTTPPublicKeyHeaderName) + "\x00" + idempotencyKey
+		fingerprint := r.Method + " " + r.URL.RequestURI() + " " + hex.EncodeToString(bodyHash[:])
+
+		e, found := cache.reserve(key, fingerprint)
+		if found {
+			switch {
+			case e.fingerprint != fingerprint:
+				return &httperror.HandlerError{StatusCode: http.StatusUnprocessableEntity, Message: "The idempotency key was used for another request", Err: errors.New("idempotency key reused")}
+			case !e.done:
+				return &httperror.HandlerError{StatusCode: http.StatusConflict, Message: "A request with the same idempotency key is being processed", Err: errors.New("idempotency key in use")}
+			}
+
+			replay(rw, e)
+			return nil
+		}
+
+		completed := false
+		defer func() {
+			// The key is released when next panics
+			if !completed {
+				cache.remove(e)
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: rw, statusCode: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		// a server error can be transient, the request is executed again when it is retried
+		if !recorder.hijacked && !recorder.overflow && recorder.statusCode < http.StatusInternalServerError {
+			cache.complete(e, recorder)
+			completed = true
+		}
+
+		return nil
+	})
+}
+
+// reserve returns a copy of the entry of key, a new pending entry is created when the key is not in the cache
+func (cache *Cache) reserve(key, fingerprint string) (*entry, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.evictExpired(time.Now())
+
+	if e, ok := cache.entries[key]; ok {
+		copied := *e
+
+		return &copied, true
+	}
+
+	e := &entry{
+		key:         key,
+		fingerprint: fingerprint,
+		expiresAt:   time.Now().Add(cache.window),
+	}
+	e.element = cache.order.PushBack(e)
+	cache.entries[key] = e
+
+	return e, false
+}
+
+func (cache *Cache) complete(e *entry, recorder *responseRecorder) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	e.statusCode = recorder.statusCode
+	e.header = recorder.Header().Clone()
+	e.body = recorder.body
+	e.done = true
+
+	if current, ok := cache.entries[e.key]; !ok || current != e {
+		return
+	}
+
+	cache.size += len(e.body)
+
+	for cache.size > maxCacheSize && cache.order.Len() > 0 {
+		cache.removeLocked(cache.order.Front().Value.(*entry))
+	}
+}
+
+func (cache *Cache) remove(e *entry) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.removeLocked(e)
+}
+
+func (cache *Cache) removeLocked(e *entry) {
+	if current, ok := cache.entries[e.key]; !ok || current != e {
+		return
+	}
+
+	delete(cache.entries, e.key)
+	cache.order.Remove(e.element)
+	cache.size -= len(e.body)
+}
+
+// evictExpired removes the entries older than the window, the entries are ordered by expiration
+func (cache *Cache) evictExpired(now time.Time) {
+	for cache.order.Len() > 0 {
+		e := cache.order.Front().Value.(*entry)
+		if now.Before(e.expiresAt) {
+			return
+		}
+
+		cache.removeLocked(e)
+	}
+}
+
+func replay(rw http.ResponseWriter, e *entry) {
+	for name, values := range e.header {
+		rw.Header()[name] = values
+	}
+
+	rw.Header().Set(ReplayedHeaderName, "true")
+	rw.Header().Set("Content-Length", strconv.Itoa(len(e.body)))
+	rw.WriteHeader(e.statusCode)
+	rw.Write(e.body)
+}
+
+// responseRecorder copies the response sent to the client, up to maxResponseSize bytes
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        []byte
+	overflow    bool
+	hijacked    bool
+}
+
+func (rw *responseRecorder) WriteHeader(statusCode int) {
+	if !rw.wroteHeader {
+		rw.statusCode = statusCode
+		rw.wroteHeader = true
+	}
+
+	rw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rw *responseRecorder) Write(p []byte) (int, error) {
+	rw.wroteHeader = true
+
+	if !rw.overflow {
+		if len(rw.body)+len(p) > maxResponseSize {
+			rw.overflow = true
+			rw.body = nil
+		} else {
+			rw.body = append(rw.body, p...)
+		}
+	}
+
+	return rw.ResponseWriter.Write(p)
+}
+
+func (rw *responseRecorder) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (rw *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the response writer does not support hijacking")
+	}
+
+	rw.hijacked = true
+
+	return hijacker.Hijack()
+}
@@ -0,0 +1,198 @@
+package idempotency
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestHandler(calls *int32) http.Handler {
+	return NewCache(time.Hour).Handler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(calls, 1)
+
+		rw.Header().Set("X-Call", string(rune('0'+n)))
+		rw.WriteHeader(http.StatusCreated)
+		rw.Write([]byte(`{"Id":"abc"}`))
+	}))
+}
+
+func serve(handler http.Handler, method, target, key string) *httptest.ResponseRecorder {
+	return serveBody(handler, method, target, key, "{}")
+}
+
+func serveBody(handler http.Handler, method, target, key, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if key != "" {
+		r.Header.Set(HeaderName, key)
+	}
+
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, r)
+
+	return rw
+}
+
+func TestHandlerReplay(t *testing.T) {
+	var calls int32
+	handler := newTestHandler(&calls)
+
+	first := serve(handler, http.MethodPost, "/containers/create", "key-1")
+	second := serve(handler, http.MethodPost, "/containers/create", "key-1")
+
+	if calls != 1 {
+		t.Fatalf("expected the request to be executed once, executed %d times", calls)
+	}
+
+	if second.Code != http.StatusCreated || second.Body.String() != first.Body.String() || second.Header().Get("X-Call") != "1" {
+		t.Fatalf("unexpected replayed response: %d %s", second.Code, second.Body.String())
+	}
+
+	if second.Header().Get(ReplayedHeaderName) != "true" || first.Header().Get(ReplayedHeaderName) != "" {
+		t.Fatal("expected only the replayed response to be marked")
+	}
+
+	serve(handler, http.MethodPost, "/containers/create", "key-2")
+	serve(handler, http.MethodPost, "/containers/create", "")
+	serve(handler, http.MethodGet, "/containers/json", "key-3")
+	serve(handler, http.MethodGet, "/containers/json", "key-3")
+
+	if calls != 5 {
+		t.Fatalf("expected 5 executions, got %d", calls)
+	}
+}
+
+func TestHandlerKeyReused(t *testing.T) {
+	var calls int32
+	handler := newTestHandler(&calls)
+
+	serve(handler, http.MethodPost, "/containers/create", "key-1")
+
+	rw := serve(handler, http.MethodDelete, "/containers/abc", "key-1")
+	if rw.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected a HTTP 422, got %d", rw.Code)
+	}
+}
+
+func TestHandlerBodyReused(t *testing.T) {
+	var calls int32
+	var bodies []string
+
+	handler := NewCache(time.Hour).Handler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+	}))
+
+	serveBody(handler, http.MethodPost, "/containers/create", "key-1", `{"Image":"nginx"}`)
+
+	rw := serveBody(handler, http.MethodPost, "/containers/create", "key-1", `{"Image":"redis"}`)
+	if rw.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected a HTTP 422, got %d", rw.Code)
+	}
+
+	rw = serveBody(handler, http.MethodPost, "/containers/create", "key-1", `{"Image":"nginx"}`)
+	if rw.Code != http.StatusOK || rw.Header().Get(ReplayedHeaderName) != "true" {
+		t.Fatalf("expected the response to be replayed, got %d", rw.Code)
+	}
+
+	if calls != 1 || len(bodies) != 1 || bodies[0] != `{"Image":"nginx"}` {
+		t.Fatalf("expected the request to be executed once with its body, got %v", bodies)
+	}
+}
+
+func TestHandlerServerError(t *testing.T) {
+	var calls int32
+
+	handler := NewCache(time.Hour).Handler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		rw.WriteHeader(http.StatusCreated)
+	}))
+
+	first := serve(handler, http.MethodPost, "/containers/create", "key-1")
+	second := serve(handler, http.MethodPost, "/containers/create", "key-1")
+	third := serve(handler, http.MethodPost, "/containers/create", "key-1")
+
+	if first.Code != http.StatusServiceUnavailable || second.Code != http.StatusCreated || second.Header().Get(ReplayedHeaderName) != "" {
+		t.Fatalf("expected the request to be executed again after the server error, got %d and %d", first.Code, second.Code)
+	}
+
+	if third.Code != http.StatusCreated || third.Header().Get(ReplayedHeaderName) != "true" || calls != 2 {
+		t.Fatalf("expected the successful response to be replayed, executed %d times", calls)
+	}
+}
+
+func TestHandlerLargeRequest(t *testing.T) {
+	var calls int32
+	var size int
+
+	handler := NewCache(time.Hour).Handler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+
+		body, _ := io.ReadAll(r.Body)
+		size = len(body)
+	}))
+
+	body := strings.Repeat("a", maxRequestSize+10)
+
+	serveBody(handler, http.MethodPost, "/images/load", "key-1", body)
+	serveBody(handler, http.MethodPost, "/images/load", "key-1", body)
+
+	if calls != 2 || size != len(body) {
+		t.Fatalf("expected the large request to be executed each time with its whole body, executed %d times with %d bytes", calls, size)
+	}
+}
+
+func TestHandlerInProgress(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	handler := NewCache(time.Hour).Handler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		serve(handler, http.MethodPost, "/stacks/deploy", "key-1")
+		close(done)
+	}()
+
+	<-started
+
+	rw := serve(handler, http.MethodPost, "/stacks/deploy", "key-1")
+	if rw.Code != http.StatusConflict {
+		t.Fatalf("expected a HTTP 409, got %d", rw.Code)
+	}
+
+	close(release)
+	<-done
+}
+
+func TestHandlerExpiration(t *testing.T) {
+	var calls int32
+	cache := NewCache(time.Millisecond)
+	handler := cache.Handler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+
+	serve(handler, http.MethodPost, "/containers/create", "key-1")
+	time.Sleep(5 * time.Millisecond)
+	serve(handler, http.MethodPost, "/containers/create", "key-1")
+
+	if calls != 2 {
+		t.Fatalf("expected the request to be executed again after the window, executed %d times", calls)
+	}
+
+	if len(cache.entries) != 1 || cache.order.Len() != 1 {
+		t.Fatal("expected the expired entry to be evicted")
+	}
+}
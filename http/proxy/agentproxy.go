@@ -2,6 +2,7 @@ package proxy
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/portainer/agent"
@@ -10,6 +11,9 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// NodeQueryParameter is the name of the query parameter used to specify the node targeted by a request
+const NodeQueryParameter = "node"
+
 // AgentProxy enables redirection to different nodes
 type AgentProxy struct {
 	clusterService       agent.ClusterService
@@ -56,3 +60,40 @@ func (p *AgentProxy) Redirect(next http.Handler) http.Handler {
 		return nil
 	})
 }
+
+// RedirectToNode is redirecting request to the agent node specified by the node query parameter, the target header
+// is used when the parameter is not set. The parameter must name the current node or a member of the cluster.
+func (p *AgentProxy) RedirectToNode(next http.Handler) http.Handler {
+	redirect := p.Redirect(next)
+
+	return httperror.LoggerHandler(func(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+		query := r.URL.Query()
+		if !query.Has(NodeQueryParameter) {
+			redirect.ServeHTTP(rw, r)
+			return nil
+		}
+
+		node := query.Get(NodeQueryParameter)
+		if node == "" {
+			return httperror.BadRequest("Invalid query parameter: node", errors.New("the node cannot be empty"))
+		}
+
+		if !p.isKnownNode(node) {
+			return httperror.NotFound("Unable to find the targeted node", fmt.Errorf("the node %q is not a member of the cluster", node))
+		}
+
+		r.Header.Set(agent.HTTPTargetHeaderName, node)
+		redirect.ServeHTTP(rw, r)
+
+		return nil
+	})
+}
+
+// isKnownNode returns true when the node is the current node or a member of the cluster
+func (p *AgentProxy) isKnownNode(node string) bool {
+	if p.runtimeConfiguration != nil && node == p.runtimeConfiguration.NodeName {
+		return true
+	}
+
+	return p.clusterService != nil && p.clusterService.GetMemberByNodeName(node) != nil
+}
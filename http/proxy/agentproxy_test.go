@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/portainer/agent"
+)
+
+// fakeClusterService only knows the members of the cluster by their node name
+type fakeClusterService struct {
+	agent.ClusterService
+	members map[string]*agent.ClusterMember
+}
+
+func (s *fakeClusterService) GetMemberByNodeName(nodeName string) *agent.ClusterMember {
+	return s.members[nodeName]
+}
+
+func TestRedirectToNode(t *testing.T) {
+	var forwardedTarget string
+	member := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		forwardedTarget = r.Header.Get(agent.HTTPTargetHeaderName)
+		rw.WriteHeader(http.StatusAccepted)
+	}))
+	defer member.Close()
+
+	host, port, err := net.SplitHostPort(member.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cluster := &fakeClusterService{members: map[string]*agent.ClusterMember{
+		"node-2": {IPAddress: host, Port: port, NodeName: "node-2"},
+	}}
+
+	tests := []struct {
+		name            string
+		clusterService  agent.ClusterService
+		url             string
+		header          string
+		expectedStatus  int
+		expectedTarget  string
+		expectedForward string
+	}{
+		{name: "no node", clusterService: cluster, url: "/browse/ls", expectedStatus: http.StatusOK},
+		{name: "target header", clusterService: cluster, url: "/browse/ls", header: "node-2", expectedStatus: http.StatusAccepted, expectedForward: "node-2"},
+		{name: "current node", clusterService: cluster, url: "/browse/ls?node=node-1", expectedStatus: http.StatusOK, expectedTarget: "node-1"},
+		{name: "member of the cluster", clusterService: cluster, url: "/browse/ls?node=node-2", expectedStatus: http.StatusAccepted, expectedForward: "node-2"},
+		{name: "node overriding the target header", clusterService: cluster, url: "/browse/ls?node=node-1", header: "node-2", expectedStatus: http.StatusOK, expectedTarget: "node-1"},
+		{name: "empty node", clusterService: cluster, url: "/browse/ls?node=", header: "node-2", expectedStatus: http.StatusBadRequest},
+		{name: "unknown node", clusterService: cluster, url: "/browse/ls?node=node-3", expectedStatus: http.StatusNotFound},
+		{name: "header injection", clusterService: cluster, url: "/browse/ls?node=node-2%0d%0aX-Injected:%201", expectedStatus: http.StatusNotFound},
+		{name: "current node without cluster", url: "/browse/ls?node=node-1", expectedStatus: http.StatusOK, expectedTarget: "node-1"},
+		{name: "other node without cluster", url: "/browse/ls?node=node-2", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forwardedTarget = ""
+
+			served := false
+			var target string
+			next := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				served = true
+				target = r.Header.Get(agent.HTTPTargetHeaderName)
+			})
+
+			agentProxy := NewAgentProxy(tt.clusterService, &agent.RuntimeConfiguration{NodeName: "node-1"}, false)
+
+			request := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.header != "" {
+				request.Header.Set(agent.HTTPTargetHeaderName, tt.header)
+			}
+
+			rw := httptest.NewRecorder()
+			agentProxy.RedirectToNode(next).ServeHTTP(rw, request)
+
+			if rw.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rw.Code)
+			}
+
+			if served != (tt.expectedStatus == http.StatusOK) {
+				t.Errorf("expected the request to be served locally: %t, got %t", tt.expectedStatus == http.StatusOK, served)
+			}
+
+			if target != tt.expectedTarget {
+				t.Errorf("expected the target %q, got %q", tt.expectedTarget, target)
+			}
+
+			if forwardedTarget != tt.expectedForward {
+				t.Errorf("expected the request to be forwarded to %q, got %q", tt.expectedForward, forwardedTarget)
+			}
+		})
+	}
+}
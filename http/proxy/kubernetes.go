@@ -6,11 +6,23 @@ import (
 	"net/url"
 
 	"github.com/portainer/agent/crypto"
+	"github.com/portainer/agent/kubernetes"
 )
 
 const kubernetesAPIURL = "https://kubernetes.default.svc"
 
 func NewKubernetesProxy() http.Handler {
+	// the API server of a cluster running next to the Docker daemon is reached with the credentials of its kubeconfig
+	if kubernetes.UsesKubeconfig() {
+		remoteURL, transport, err := kubernetes.KubeconfigTransport()
+		if err == nil {
+			proxy := httputil.NewSingleHostReverseProxy(remoteURL)
+			proxy.Transport = transport
+
+			return proxy
+		}
+	}
+
 	remoteURL, _ := url.Parse(kubernetesAPIURL)
 	proxy := httputil.NewSingleHostReverseProxy(remoteURL)
 
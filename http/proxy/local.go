@@ -1,32 +1,65 @@
 package proxy
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/portainer/agent/metrics"
 	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/rs/zerolog/log"
 )
 
+// localRetryDelay is the delay between two attempts of an idempotent request, multiplied by the attempt number
+const localRetryDelay = 250 * time.Millisecond
+
+var errUpstreamTimeout = errors.New("the Docker daemon did not answer in time")
+
 // LocalProxy is a service used to proxy requests to a Unix socket (Linux) or named pipe (Windows).
 // The proxy operation implementation is defined in the ServeHTTP function.
 type LocalProxy struct {
-	transport *http.Transport
+	transport http.RoundTripper
+	timeout   time.Duration
+	retries   int
 }
 
 func (proxy *LocalProxy) ServeHTTP(rw http.ResponseWriter, request *http.Request) {
 	request.URL.Scheme = "http"
 	request.URL.Host = "unixsocket"
 
-	res, err := proxy.transport.RoundTrip(request)
+	var timings []string
+
+	start := time.Now()
+	if received, ok := metrics.RequestStart(request.Context()); ok {
+		metrics.ObserveDockerRequest(request.Method, request.URL.Path, metrics.StageAgent, start.Sub(received))
+		timings = append(timings, serverTiming(metrics.StageAgent, start.Sub(received)))
+	}
+
+	res, cancel, err := proxy.roundTrip(request)
+
+	metrics.ObserveDockerRequest(request.Method, request.URL.Path, metrics.StageDaemon, time.Since(start))
+	timings = append(timings, serverTiming(metrics.StageDaemon, time.Since(start)))
+
+	statusCode := 0
+	if err == nil {
+		statusCode = res.StatusCode
+	}
+	metrics.CountDockerResponse(request.Method, request.URL.Path, statusCode)
+
 	if err != nil {
 		code := http.StatusInternalServerError
-		if res != nil && res.StatusCode != 0 {
-			code = res.StatusCode
+		if errors.Is(err, errUpstreamTimeout) {
+			code = http.StatusGatewayTimeout
 		}
 		httperror.WriteError(rw, code, "Unable to proxy the request via the Docker socket", err)
 		return
 	}
 
+	defer cancel()
 	defer res.Body.Close()
 
 	for k, vv := range res.Header {
@@ -35,9 +68,89 @@ func (proxy *LocalProxy) ServeHTTP(rw http.ResponseWriter, request *http.Request
 		}
 	}
 
+	// the server compares the timings with the duration it measured to tell the latency of the tunnel apart
+	rw.Header().Set("Server-Timing", strings.Join(timings, ", "))
 	rw.WriteHeader(res.StatusCode)
 
 	// TODO: resource duplication error: it seems that the body size is different here
 	// from the size retrieve in cluster.go
 	io.Copy(rw, res.Body)
 }
+
+// roundTrip sends the request to the Docker daemon. The timeout only covers the wait for the response headers,
+// so that streamed responses (logs, events, image pulls) are not interrupted once the daemon has answered.
+// Idempotent requests are retried when the daemon cannot be reached or does not answer in time, other
+// requests are sent only once. The returned cancel function must be called once the response body is consumed.
+func (proxy *LocalProxy) roundTrip(request *http.Request) (*http.Response, context.CancelFunc, error) {
+	attempts := 1
+	if isIdempotentRequest(request) {
+		attempts += proxy.retries
+	}
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			log.Debug().
+				Err(err).
+				Str("method", request.Method).
+				Str("path", request.URL.Path).
+				Int("attempt", attempt+1).
+				Msg("retrying the request to the Docker daemon")
+
+			select {
+			case <-time.After(time.Duration(attempt) * localRetryDelay):
+			case <-request.Context().Done():
+				return nil, nil, request.Context().Err()
+			}
+		}
+
+		ctx, cancel := context.WithCancel(request.Context())
+
+		var timer *time.Timer
+		if proxy.timeout > 0 && !isLongRunningRequest(request) {
+			timer = time.AfterFunc(proxy.timeout, cancel)
+		}
+
+		var res *http.Response
+		res, err = proxy.transport.RoundTrip(request.WithContext(ctx))
+
+		timedOut := timer != nil && !timer.Stop()
+		if timedOut {
+			if res != nil {
+				res.Body.Close()
+			}
+			err = errUpstreamTimeout
+		}
+
+		if err == nil {
+			return res, cancel, nil
+		}
+
+		cancel()
+
+		if request.Context().Err() != nil {
+			break
+		}
+	}
+
+	return nil, nil, err
+}
+
+// isIdempotentRequest returns true when the request can safely be sent again to the Docker daemon
+func isIdempotentRequest(request *http.Request) bool {
+	return (request.Method == http.MethodGet || request.Method == http.MethodHead) && request.ContentLength == 0
+}
+
+// isLongRunningRequest returns true when the Docker daemon is expected to take an unbounded time before
+// answering: requests waiting for a container, upgraded connections and uploads.
+func isLongRunningRequest(request *http.Request) bool {
+	return strings.HasSuffix(request.URL.Path, "/wait") ||
+		strings.HasSuffix(request.URL.Path, "/attach") ||
+		request.Header.Get("Upgrade") != "" ||
+		request.ContentLength != 0
+}
+
+// serverTiming returns a metric of the Server-Timing header, the duration is in milliseconds
+func serverTiming(name string, duration time.Duration) string {
+	return fmt.Sprintf("%s;dur=%.1f", name, float64(duration.Microseconds())/1000)
+}
@@ -5,14 +5,19 @@ package proxy
 import (
 	"net"
 	"net/http"
+	"time"
 
 	"github.com/Microsoft/go-winio"
 )
 
 // NewLocalProxy returns a pointer to a LocalProxy.
-func NewLocalProxy() *LocalProxy {
+// timeout is the maximum duration to wait for the Docker daemon to answer (0 to disable it) and retries
+// is the number of times an idempotent request is sent again after a failure.
+func NewLocalProxy(timeout time.Duration, retries int) *LocalProxy {
 	proxy := &LocalProxy{
 		transport: newNamedPipeTransport("//./pipe/docker_engine"),
+		timeout:   timeout,
+		retries:   retries,
 	}
 	return proxy
 }
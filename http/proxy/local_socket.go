@@ -5,12 +5,19 @@ package proxy
 import (
 	"net"
 	"net/http"
+	"time"
+
+	"github.com/portainer/agent/broker"
 )
 
 // NewLocalProxy returns a pointer to a LocalProxy.
-func NewLocalProxy() *LocalProxy {
+// timeout is the maximum duration to wait for the Docker daemon to answer (0 to disable it) and retries
+// is the number of times an idempotent request is sent again after a failure.
+func NewLocalProxy(timeout time.Duration, retries int) *LocalProxy {
 	proxy := &LocalProxy{
-		transport: newSocketTransport("/var/run/docker.sock"),
+		transport: newSocketTransport(broker.DockerSocketPath()),
+		timeout:   timeout,
+		retries:   retries,
 	}
 	return proxy
 }
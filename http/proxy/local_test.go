@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/portainer/agent/metrics"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return fn(request)
+}
+
+func TestLocalProxyRetriesReadRequests(t *testing.T) {
+	calls := 0
+	proxy := &LocalProxy{
+		retries: 2,
+		transport: roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			calls++
+			if calls < 3 {
+				return nil, errors.New("connection refused")
+			}
+
+			return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("[]"))}, nil
+		}),
+	}
+
+	rw := httptest.NewRecorder()
+	proxy.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/containers/json", nil))
+
+	if rw.Code != http.StatusOK || calls != 3 {
+		t.Errorf("expected the request to succeed after 3 attempts, got status %d after %d attempts", rw.Code, calls)
+	}
+}
+
+func TestLocalProxyDoesNotRetryWriteRequests(t *testing.T) {
+	calls := 0
+	proxy := &LocalProxy{
+		retries: 2,
+		transport: roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			calls++
+			return nil, errors.New("connection refused")
+		}),
+	}
+
+	rw := httptest.NewRecorder()
+	proxy.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/containers/abc/start", nil))
+
+	if rw.Code != http.StatusInternalServerError || calls != 1 {
+		t.Errorf("expected a single failed attempt, got status %d after %d attempts", rw.Code, calls)
+	}
+}
+
+func TestLocalProxyTimeout(t *testing.T) {
+	proxy := &LocalProxy{
+		timeout: 20 * time.Millisecond,
+		transport: roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			<-request.Context().Done()
+			return nil, request.Context().Err()
+		}),
+	}
+
+	rw := httptest.NewRecorder()
+	proxy.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/containers/abc/stop", nil))
+
+	if rw.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected status %d, got %d", http.StatusGatewayTimeout, rw.Code)
+	}
+}
+
+func TestIsLongRunningRequest(t *testing.T) {
+	tests := []struct {
+		method   string
+		path     string
+		body     string
+		expected bool
+	}{
+		{http.MethodGet, "/containers/json", "", false},
+		{http.MethodPost, "/containers/abc/wait", "", true},
+		{http.MethodPost, "/containers/abc/attach", "", true},
+		{http.MethodPost, "/images/load", "archive", true},
+	}
+
+	for _, test := range tests {
+		var body io.Reader
+		if test.body != "" {
+			body = strings.NewReader(test.body)
+		}
+
+		if isLongRunningRequest(httptest.NewRequest(test.method, test.path, body)) != test.expected {
+			t.Errorf("%s %s: expected %t", test.method, test.path, test.expected)
+		}
+	}
+}
+
+func TestLocalProxyServerTiming(t *testing.T) {
+	proxy := &LocalProxy{
+		transport: roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("{}"))}, nil
+		}),
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/info", nil)
+	request = request.WithContext(metrics.WithRequestStart(request.Context(), time.Now().Add(-5*time.Millisecond)))
+
+	rw := httptest.NewRecorder()
+	proxy.ServeHTTP(rw, request)
+
+	timing := rw.Header().Get("Server-Timing")
+	if !strings.HasPrefix(timing, "agent;dur=") || !strings.Contains(timing, ", daemon;dur=") {
+		t.Errorf("unexpected Server-Timing header %q", timing)
+	}
+}
@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/crypto"
+)
+
+// NewMemberClient returns a client used to send requests to the other agents of the cluster. It has no timeout so
+// that it can be used for streams and large transfers.
+func NewMemberClient() *http.Client {
+	tlsConfig := crypto.CreateTLSConfiguration()
+	tlsConfig.InsecureSkipVerify = true
+
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: tlsConfig,
+		},
+	}
+}
+
+// NewMemberRequest returns a request targeting the agent of a cluster member, authenticated with the signature of
+// the request received by the agent
+func NewMemberRequest(ctx context.Context, request *http.Request, member *agent.ClusterMember, useTLS bool, method, path string, query url.Values, body io.Reader) (*http.Request, error) {
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+
+	memberURL := url.URL{
+		Scheme:   scheme,
+		Host:     member.IPAddress + ":" + member.Port,
+		Path:     path,
+		RawQuery: query.Encode(),
+	}
+
+	memberRequest, err := http.NewRequestWithContext(ctx, method, memberURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	memberRequest.Header.Set(agent.HTTPSignatureHeaderName, request.Header.Get(agent.HTTPSignatureHeaderName))
+	memberRequest.Header.Set(agent.HTTPPublicKeyHeaderName, request.Header.Get(agent.HTTPPublicKeyHeaderName))
+	memberRequest.Header.Set(agent.HTTPTargetHeaderName, member.NodeName)
+
+	return memberRequest, nil
+}
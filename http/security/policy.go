@@ -0,0 +1,43 @@
+package security
+
+import (
+	"fmt"
+	"net/http"
+
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+)
+
+// PolicyService restricts the access to the operations that are disabled unless explicitly allowed
+// in the configuration of the agent.
+type PolicyService struct {
+	allowed map[string]bool
+}
+
+// NewPolicyService returns a pointer to a PolicyService allowing the specified operations
+func NewPolicyService(allowedOperations []string) *PolicyService {
+	allowed := map[string]bool{}
+	for _, op := range allowedOperations {
+		allowed[op] = true
+	}
+
+	return &PolicyService{
+		allowed: allowed,
+	}
+}
+
+// IsAllowed returns true if the operation is allowed by the policy
+func (service *PolicyService) IsAllowed(operation string) bool {
+	return service.allowed[operation]
+}
+
+// RequireOperation rejects the requests with a HTTP 403 when the operation is not allowed by the policy
+func (service *PolicyService) RequireOperation(operation string, next http.Handler) http.Handler {
+	return httperror.LoggerHandler(func(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+		if !service.IsAllowed(operation) {
+			return httperror.Forbidden("Operation not allowed by the agent policy", fmt.Errorf("operation %s is not allowed", operation))
+		}
+
+		next.ServeHTTP(rw, r)
+		return nil
+	})
+}
@@ -0,0 +1,330 @@
+package security
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/time/rate"
+)
+
+// Actions of the proxy policy rules
+const (
+	ProxyPolicyAllow = "allow"
+	ProxyPolicyDeny  = "deny"
+)
+
+// limiterIdleTimeout is the duration after which the rate limiter of a client that stopped sending requests is removed
+const limiterIdleTimeout = 10 * time.Minute
+
+// ProxyPolicy restricts the Docker API requests proxied by the agent
+type ProxyPolicy struct {
+	// DefaultAction is applied to the requests matching no rule, the requests are allowed when empty
+	DefaultAction string `json:"DefaultAction,omitempty"`
+	// Rules are evaluated in order, the first rule matching a request decides whether it is proxied
+	Rules []ProxyRule `json:"Rules,omitempty"`
+	// RateLimit is the number of requests per second proxied for each client, unlimited when 0
+	RateLimit float64 `json:"RateLimit,omitempty"`
+	// RateBurst is the number of requests a client can send at once, defaults to the rate limit
+	RateBurst int `json:"RateBurst,omitempty"`
+}
+
+// ProxyRule allows or denies the requests sent with one of its methods to its path
+type ProxyRule struct {
+	Action string `json:"Action"`
+	// Methods are the HTTP methods matched by the rule, all of them when empty
+	Methods []string `json:"Methods,omitempty"`
+	// Path is the Docker API path, without version, matched by the rule along with its sub-paths (e.g. /images).
+	// A * segment matches any segment (e.g. /containers/*/exec).
+	Path string `json:"Path"`
+}
+
+// ProxyPolicyService enforces the proxy policy of the local policy file and the one pushed by the Portainer server.
+// A request must be allowed by both of them, so that the server can further restrict the requests but cannot
+// loosen the local policy.
+type ProxyPolicyService struct {
+	local      *proxyPolicyEnforcer
+	server     *proxyPolicyEnforcer
+	serverPath string
+	mu         sync.RWMutex
+}
+
+// proxyPolicyEnforcer enforces a policy, with a rate limiter per client
+type proxyPolicyEnforcer struct {
+	policy    *ProxyPolicy
+	limiters  map[string]*clientLimiter
+	lastPrune time.Time
+	mu        sync.Mutex
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewProxyPolicyService returns a pointer to a ProxyPolicyService enforcing the policy of the localPath file, if
+// any, and the policy pushed by the server persisted in serverPath
+func NewProxyPolicyService(localPath, serverPath string) (*ProxyPolicyService, error) {
+	service := &ProxyPolicyService{serverPath: serverPath}
+
+	if localPath != "" {
+		policy, err := LoadProxyPolicy(localPath)
+		if err != nil {
+			return nil, err
+		}
+
+		service.local = newProxyPolicyEnforcer(policy)
+	}
+
+	policy, err := LoadProxyPolicy(serverPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if policy != nil {
+		service.server = newProxyPolicyEnforcer(policy)
+	}
+
+	return service, nil
+}
+
+// LoadProxyPolicy reads and validates the proxy policy of a JSON file
+func LoadProxyPolicy(path string) (*ProxyPolicy, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &ProxyPolicy{}
+	if err := json.Unmarshal(content, policy); err != nil {
+		return nil, fmt.Errorf("invalid proxy policy %s: %w", path, err)
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid proxy policy %s: %w", path, err)
+	}
+
+	return policy, nil
+}
+
+// Validate checks the actions, the paths and the rate limit of the policy
+func (policy *ProxyPolicy) Validate() error {
+	if policy.DefaultAction != "" && policy.DefaultAction != ProxyPolicyAllow && policy.DefaultAction != ProxyPolicyDeny {
+		return fmt.Errorf("unsupported default action %q", policy.DefaultAction)
+	}
+
+	for _, rule := range policy.Rules {
+		if rule.Action != ProxyPolicyAllow && rule.Action != ProxyPolicyDeny {
+			return fmt.Errorf("unsupported action %q", rule.Action)
+		}
+
+		if !strings.HasPrefix(rule.Path, "/") {
+			return fmt.Errorf("the path %q of a rule must start with /", rule.Path)
+		}
+	}
+
+	if policy.RateLimit < 0 || policy.RateBurst < 0 {
+		return errors.New("the rate limit and the burst cannot be negative")
+	}
+
+	return nil
+}
+
+// isEmpty returns true when the policy allows all the requests
+func (policy *ProxyPolicy) isEmpty() bool {
+	return len(policy.Rules) == 0 && policy.DefaultAction != ProxyPolicyDeny && policy.RateLimit == 0
+}
+
+// Allows returns true when the request is allowed by the rules of the policy
+func (policy *ProxyPolicy) Allows(method, path string) bool {
+	for _, rule := range policy.Rules {
+		if rule.matches(method, path) {
+			return rule.Action == ProxyPolicyAllow
+		}
+	}
+
+	return policy.DefaultAction != ProxyPolicyDeny
+}
+
+func (rule *ProxyRule) matches(method, path string) bool {
+	if len(rule.Methods) > 0 {
+		found := false
+		for _, m := range rule.Methods {
+			if strings.EqualFold(m, method) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	ruleSegments := strings.Split(strings.Trim(rule.Path, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+
+	// the rule of / matches all the paths
+	if len(ruleSegments) == 1 && ruleSegments[0] == "" {
+		return true
+	}
+
+	if len(pathSegments) < len(ruleSegments) {
+		return false
+	}
+
+	for i, segment := range ruleSegments {
+		if segment != "*" && segment != pathSegments[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ServerPolicy returns the policy pushed by the server, or nil
+func (service *ProxyPolicyService) ServerPolicy() *ProxyPolicy {
+	service.mu.RLock()
+	defer service.mu.RUnlock()
+
+	if service.server == nil {
+		return nil
+	}
+
+	return service.server.policy
+}
+
+// UpdateServerPolicy persists and enforces the policy pushed by the server, an empty policy removes it
+func (service *ProxyPolicyService) UpdateServerPolicy(policy *ProxyPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	if policy.isEmpty() {
+		if err := os.Remove(service.serverPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		service.server = nil
+
+		return nil
+	}
+
+	content, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(service.serverPath, content, 0600); err != nil {
+		return err
+	}
+
+	service.server = newProxyPolicyEnforcer(policy)
+
+	return nil
+}
+
+// Filter rejects with a HTTP 403 the requests denied by one of the policies, and with a HTTP 429 the requests of
+// the clients exceeding one of the rate limits
+func (service *ProxyPolicyService) Filter(next http.Handler) http.Handler {
+	return httperror.LoggerHandler(func(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+		service.mu.RLock()
+		enforcers := []*proxyPolicyEnforcer{service.local, service.server}
+		service.mu.RUnlock()
+
+		client := clientKey(r)
+
+		for _, enforcer := range enforcers {
+			if enforcer == nil {
+				continue
+			}
+
+			if !enforcer.policy.Allows(r.Method, r.URL.Path) {
+				log.Warn().Str("method", r.Method).Str("path", r.URL.Path).Msg("request denied by the proxy policy")
+
+				return httperror.Forbidden("Request denied by the agent proxy policy", fmt.Errorf("%s %s is denied", r.Method, r.URL.Path))
+			}
+
+			if !enforcer.allowRate(client) {
+				rw.Header().Set("Retry-After", "1")
+
+				return &httperror.HandlerError{StatusCode: http.StatusTooManyRequests, Message: "Rate limit of the agent proxy policy exceeded", Err: errors.New("too many requests")}
+			}
+		}
+
+		next.ServeHTTP(rw, r)
+		return nil
+	})
+}
+
+func newProxyPolicyEnforcer(policy *ProxyPolicy) *proxyPolicyEnforcer {
+	return &proxyPolicyEnforcer{
+		policy:   policy,
+		limiters: map[string]*clientLimiter{},
+	}
+}
+
+// allowRate returns true when the client has not exceeded the rate limit of the policy
+func (enforcer *proxyPolicyEnforcer) allowRate(client string) bool {
+	if enforcer.policy.RateLimit == 0 {
+		return true
+	}
+
+	enforcer.mu.Lock()
+	defer enforcer.mu.Unlock()
+
+	now := time.Now()
+
+	if now.Sub(enforcer.lastPrune) > limiterIdleTimeout {
+		for key, l := range enforcer.limiters {
+			if now.Sub(l.lastSeen) > limiterIdleTimeout {
+				delete(enforcer.limiters, key)
+			}
+		}
+
+		enforcer.lastPrune = now
+	}
+
+	l, ok := enforcer.limiters[client]
+	if !ok {
+		burst := enforcer.policy.RateBurst
+		if burst == 0 {
+			burst = max(int(enforcer.policy.RateLimit), 1)
+		}
+
+		l = &clientLimiter{limiter: rate.NewLimiter(rate.Limit(enforcer.policy.RateLimit), burst)}
+		enforcer.limiters[client] = l
+	}
+
+	l.lastSeen = now
+
+	return l.limiter.AllowN(now, 1)
+}
+
+// clientKey identifies the client of a request by the public key of the Portainer instance that signed it, or by
+// its remote address
+func clientKey(r *http.Request) string {
+	if publicKey := r.Header.Get(agent.HTTPPublicKeyHeaderName); publicKey != "" {
+		return publicKey
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
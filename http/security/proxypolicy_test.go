@@ -0,0 +1,88 @@
+package security
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestProxyPolicy_Allows(t *testing.T) {
+	policy := &ProxyPolicy{
+		Rules: []ProxyRule{
+			{Action: ProxyPolicyAllow, Methods: []string{"GET"}, Path: "/images"},
+			{Action: ProxyPolicyDeny, Methods: []string{"DELETE"}, Path: "/images"},
+			{Action: ProxyPolicyDeny, Path: "/plugins"},
+			{Action: ProxyPolicyDeny, Methods: []string{"POST"}, Path: "/containers/*/exec"},
+		},
+	}
+
+	tests := []struct {
+		method  string
+		path    string
+		allowed bool
+	}{
+		{http.MethodGet, "/images/json", true},
+		{http.MethodDelete, "/images/nginx:latest", false},
+		{http.MethodGet, "/plugins", false},
+		{http.MethodPost, "/plugins/pull", false},
+		{http.MethodPost, "/containers/abc/exec", false},
+		{http.MethodPost, "/containers/abc/start", true},
+		{http.MethodGet, "/pluginsx", true},
+	}
+
+	for _, test := range tests {
+		if policy.Allows(test.method, test.path) != test.allowed {
+			t.Errorf("expected %s %s allowed to be %t", test.method, test.path, test.allowed)
+		}
+	}
+
+	policy.DefaultAction = ProxyPolicyDeny
+	if policy.Allows(http.MethodPost, "/containers/abc/start") {
+		t.Error("expected the requests matching no rule to be denied")
+	}
+}
+
+func TestProxyPolicyService_Filter(t *testing.T) {
+	service, err := NewProxyPolicyService("", filepath.Join(t.TempDir(), "policy.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = service.UpdateServerPolicy(&ProxyPolicy{
+		Rules:     []ProxyRule{{Action: ProxyPolicyDeny, Methods: []string{"DELETE"}, Path: "/images"}},
+		RateLimit: 1,
+		RateBurst: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := service.Filter(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(method, path string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+
+		return rec.Code
+	}
+
+	if code := serve(http.MethodDelete, "/images/nginx"); code != http.StatusForbidden {
+		t.Fatalf("expected the request to be denied, got %d", code)
+	}
+
+	serve(http.MethodGet, "/containers/json")
+	if code := serve(http.MethodGet, "/containers/json"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected the request to be rate limited, got %d", code)
+	}
+
+	// the policy pushed by the server is persisted
+	reloaded, err := NewProxyPolicyService("", service.serverPath)
+	if err != nil || reloaded.ServerPolicy() == nil {
+		t.Fatalf("expected the server policy to be persisted, got %v", err)
+	}
+
+	if err := service.UpdateServerPolicy(&ProxyPolicy{}); err != nil || service.ServerPolicy() != nil {
+		t.Fatalf("expected the server policy to be removed, got %v", err)
+	}
+}
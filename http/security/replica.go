@@ -0,0 +1,44 @@
+package security
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+)
+
+// ReplicaService authenticates the local consumers of the read-only replica API (dashboards, site controllers)
+// with a bearer token. The token only grants access to the replica API, not to the rest of the agent API.
+type ReplicaService struct {
+	token []byte
+}
+
+// NewReplicaService returns a pointer to a ReplicaService, the replica API is disabled when token is empty
+func NewReplicaService(token string) *ReplicaService {
+	return &ReplicaService{token: []byte(token)}
+}
+
+// Enabled returns true if a replica token is configured
+func (service *ReplicaService) Enabled() bool {
+	return len(service.token) > 0
+}
+
+// ReplicaTokenVerification rejects the requests that do not provide the replica token as a bearer token in the
+// Authorization header
+func (service *ReplicaService) ReplicaTokenVerification(next http.Handler) http.Handler {
+	return httperror.LoggerHandler(func(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+		if !service.Enabled() {
+			return httperror.NotFound("The replica API is not enabled on this agent", errors.New("replica token not set"))
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), service.token) != 1 {
+			return httperror.Forbidden("Invalid replica token", errors.New("Unauthorized"))
+		}
+
+		next.ServeHTTP(rw, r)
+		return nil
+	})
+}
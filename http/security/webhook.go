@@ -0,0 +1,161 @@
+package security
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/anomaly"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+)
+
+const webhookSignaturePrefix = "sha256="
+
+// MaxWebhookPayloadSize is the maximum size of a webhook request payload
+const MaxWebhookPayloadSize = 1024 * 1024
+
+// WebhookService verifies the HMAC-SHA256 signature of the payload of webhook requests, or the token of the
+// webhook requests sent by registries
+type WebhookService struct {
+	secret        []byte
+	registryToken []byte
+	// timestampTolerance is the maximum difference between the timestamp of a signed webhook request and the time
+	// it is received, requests outside of this window are rejected to prevent replays
+	timestampTolerance time.Duration
+	mu                 sync.Mutex
+	// seen contains the signatures of the requests received within the tolerated window, with their expiration
+	seen map[string]time.Time
+}
+
+// NewWebhookService returns a pointer to a WebhookService. Signed webhooks are disabled when secret is empty and
+// registry webhooks are disabled when registryToken is empty. The signed requests are accepted when their timestamp
+// differs from the clock of the agent by at most timestampTolerance.
+func NewWebhookService(secret, registryToken string, timestampTolerance time.Duration) *WebhookService {
+	return &WebhookService{
+		secret:             []byte(secret),
+		registryToken:      []byte(registryToken),
+		timestampTolerance: timestampTolerance,
+		seen:               map[string]time.Time{},
+	}
+}
+
+// Enabled returns true if a webhook secret is configured
+func (service *WebhookService) Enabled() bool {
+	return len(service.secret) > 0
+}
+
+// RegistryEnabled returns true if a registry webhook token is configured
+func (service *WebhookService) RegistryEnabled() bool {
+	return len(service.registryToken) > 0
+}
+
+// Sign returns the signature of the "<timestamp>.<payload>" string, in the sha256=<hex> form.
+// timestamp is the Unix time (in seconds) sent in the webhook timestamp header.
+func (service *WebhookService) Sign(timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, service.secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+
+	return webhookSignaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookSignatureVerification rejects the requests whose signature does not match the one specified in the
+// webhook signature header, or whose timestamp is outside of the tolerated window.
+func (service *WebhookService) WebhookSignatureVerification(next http.Handler) http.Handler {
+	return httperror.LoggerHandler(func(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+		if !service.Enabled() {
+			return httperror.NotFound("Webhooks are not enabled on this agent", errors.New("webhook secret not set"))
+		}
+
+		signature := r.Header.Get(agent.HTTPWebhookSignatureHeaderName)
+		if !strings.HasPrefix(signature, webhookSignaturePrefix) {
+			return httperror.Forbidden("Missing webhook signature header", errors.New("Unauthorized"))
+		}
+
+		timestamp := r.Header.Get(agent.HTTPWebhookTimestampHeaderName)
+		unixTime, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return httperror.Forbidden("Missing or invalid webhook timestamp header", errors.New("Unauthorized"))
+		}
+
+		if delta := time.Since(time.Unix(unixTime, 0)); delta > service.timestampTolerance || delta < -service.timestampTolerance {
+			return httperror.Forbidden("Expired webhook timestamp", errors.New("Unauthorized"))
+		}
+
+		payload, err := io.ReadAll(io.LimitReader(r.Body, MaxWebhookPayloadSize))
+		if err != nil {
+			return httperror.BadRequest("Unable to read request payload", err)
+		}
+		r.Body.Close()
+
+		if !hmac.Equal([]byte(signature), []byte(service.Sign(timestamp, payload))) {
+			return httperror.Forbidden("Invalid webhook signature", errors.New("Unauthorized"))
+		}
+
+		if !service.markSeen(signature, time.Unix(unixTime, 0).Add(service.timestampTolerance)) {
+			anomaly.RecordReplay(r)
+
+			return httperror.Forbidden("Webhook request already received", errors.New("Unauthorized"))
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(payload))
+
+		next.ServeHTTP(rw, r)
+		return nil
+	})
+}
+
+// markSeen records a signature until its expiration and returns false if it was already recorded
+func (service *WebhookService) markSeen(signature string, expiration time.Time) bool {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	now := time.Now()
+	for s, exp := range service.seen {
+		if now.After(exp) {
+			delete(service.seen, s)
+		}
+	}
+
+	if _, ok := service.seen[signature]; ok {
+		return false
+	}
+
+	service.seen[signature] = expiration
+
+	return true
+}
+
+// WebhookTokenVerification rejects the requests that do not provide the registry webhook token, either as a bearer
+// token in the Authorization header or in the token query parameter. It is used for the senders that cannot sign their
+// payload, such as container registries. The token is distinct from the webhook secret as it can end up in the
+// configuration and the access logs of the registry.
+func (service *WebhookService) WebhookTokenVerification(next http.Handler) http.Handler {
+	return httperror.LoggerHandler(func(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+		if !service.RegistryEnabled() {
+			return httperror.NotFound("Registry webhooks are not enabled on this agent", errors.New("registry webhook token not set"))
+		}
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" {
+			token = r.URL.Query().Get("token")
+		}
+
+		if subtle.ConstantTimeCompare([]byte(token), service.registryToken) != 1 {
+			return httperror.Forbidden("Invalid webhook token", errors.New("Unauthorized"))
+		}
+
+		next.ServeHTTP(rw, r)
+		return nil
+	})
+}
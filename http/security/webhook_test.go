@@ -0,0 +1,224 @@
+package security
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/portainer/agent"
+)
+
+const testWebhookTolerance = 5 * time.Minute
+
+// newWebhookRequest returns a webhook request whose headers are set when signature and timestamp are not empty
+func newWebhookRequest(payload, signature, timestamp string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/webhooks/stacks", strings.NewReader(payload))
+
+	if signature != "" {
+		r.Header.Set(agent.HTTPWebhookSignatureHeaderName, signature)
+	}
+
+	if timestamp != "" {
+		r.Header.Set(agent.HTTPWebhookTimestampHeaderName, timestamp)
+	}
+
+	return r
+}
+
+// webhookHandler returns a handler verifying the signature of the webhooks, the payload received by the next handler
+// is written to payload
+func webhookHandler(service *WebhookService, payload *string) http.Handler {
+	return service.WebhookSignatureVerification(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		*payload = string(body)
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+func TestWebhookSignatureVerification(t *testing.T) {
+	service := NewWebhookService("secret", "", testWebhookTolerance)
+	other := NewWebhookService("other", "", testWebhookTolerance)
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-testWebhookTolerance-time.Minute).Unix(), 10)
+	future := strconv.FormatInt(time.Now().Add(testWebhookTolerance+time.Minute).Unix(), 10)
+
+	payload := `{"stack":"web"}`
+
+	tests := []struct {
+		name     string
+		request  *http.Request
+		expected int
+	}{
+		{
+			name:     "valid signature",
+			request:  newWebhookRequest(payload, service.Sign(now, []byte(payload)), now),
+			expected: http.StatusNoContent,
+		},
+		{
+			name:     "tampered body",
+			request:  newWebhookRequest(`{"stack":"db"}`, service.Sign(now, []byte(payload)), now),
+			expected: http.StatusForbidden,
+		},
+		{
+			name:     "tampered timestamp",
+			request:  newWebhookRequest(payload, service.Sign(now, []byte(payload)), strconv.FormatInt(time.Now().Unix()-1, 10)),
+			expected: http.StatusForbidden,
+		},
+		{
+			name:     "signed with another secret",
+			request:  newWebhookRequest(payload, other.Sign(now, []byte(payload)), now),
+			expected: http.StatusForbidden,
+		},
+		{
+			name:     "stale timestamp",
+			request:  newWebhookRequest(payload, service.Sign(stale, []byte(payload)), stale),
+			expected: http.StatusForbidden,
+		},
+		{
+			name:     "timestamp in the future",
+			request:  newWebhookRequest(payload, service.Sign(future, []byte(payload)), future),
+			expected: http.StatusForbidden,
+		},
+		{
+			name:     "invalid timestamp",
+			request:  newWebhookRequest(payload, service.Sign("now", []byte(payload)), "now"),
+			expected: http.StatusForbidden,
+		},
+		{
+			name:     "missing signature header",
+			request:  newWebhookRequest(payload, "", now),
+			expected: http.StatusForbidden,
+		},
+		{
+			name:     "signature without prefix",
+			request:  newWebhookRequest(payload, strings.TrimPrefix(service.Sign(now, []byte(payload)), webhookSignaturePrefix), now),
+			expected: http.StatusForbidden,
+		},
+		{
+			name:     "missing timestamp header",
+			request:  newWebhookRequest(payload, service.Sign("", []byte(payload)), ""),
+			expected: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received string
+
+			rec := httptest.NewRecorder()
+			webhookHandler(service, &received).ServeHTTP(rec, tt.request)
+
+			if rec.Code != tt.expected {
+				t.Fatalf("expected the status %d, got %d: %s", tt.expected, rec.Code, rec.Body)
+			}
+
+			if tt.expected == http.StatusNoContent && received != payload {
+				t.Errorf("expected the next handler to receive the payload, got %q", received)
+			}
+
+			if tt.expected != http.StatusNoContent && received != "" {
+				t.Error("expected the next handler not to be called")
+			}
+		})
+	}
+}
+
+func TestWebhookSignatureVerificationReplay(t *testing.T) {
+	service := NewWebhookService("secret", "", testWebhookTolerance)
+
+	var received string
+	handler := webhookHandler(service, &received)
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signature := service.Sign(timestamp, []byte("first"))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newWebhookRequest("first", signature, timestamp))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected the first request to be accepted, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, newWebhookRequest("first", signature, timestamp))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected the replayed request to be rejected, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, newWebhookRequest("second", service.Sign(timestamp, []byte("second")), timestamp))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("expected another payload sent at the same time to be accepted, got %d", rec.Code)
+	}
+}
+
+func TestMarkSeenExpiration(t *testing.T) {
+	service := NewWebhookService("secret", "", testWebhookTolerance)
+
+	if !service.markSeen("expired", time.Now().Add(-time.Second)) {
+		t.Fatal("expected the first signature to be recorded")
+	}
+
+	if !service.markSeen("expired", time.Now().Add(time.Minute)) {
+		t.Error("expected an expired signature to be forgotten")
+	}
+
+	if service.markSeen("expired", time.Now().Add(time.Minute)) {
+		t.Error("expected the signature to be recorded until its expiration")
+	}
+}
+
+func TestWebhookSignatureVerificationDisabled(t *testing.T) {
+	service := NewWebhookService("", "", testWebhookTolerance)
+
+	var received string
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	rec := httptest.NewRecorder()
+	webhookHandler(service, &received).ServeHTTP(rec, newWebhookRequest("payload", service.Sign(timestamp, []byte("payload")), timestamp))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected the webhooks to be disabled without secret, got %d", rec.Code)
+	}
+}
+
+func TestWebhookTokenVerification(t *testing.T) {
+	service := NewWebhookService("", "token", testWebhookTolerance)
+
+	handler := service.WebhookTokenVerification(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name          string
+		url           string
+		authorization string
+		expected      int
+	}{
+		{name: "bearer token", url: "/webhooks/registry", authorization: "Bearer token", expected: http.StatusNoContent},
+		{name: "query token", url: "/webhooks/registry?token=token", expected: http.StatusNoContent},
+		{name: "invalid token", url: "/webhooks/registry", authorization: "Bearer other", expected: http.StatusForbidden},
+		{name: "missing token", url: "/webhooks/registry", expected: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.url, nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+
+			if rec.Code != tt.expected {
+				t.Errorf("expected the status %d, got %d", tt.expected, rec.Code)
+			}
+		})
+	}
+}
@@ -2,19 +2,29 @@ package http
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"net/http"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/portainer/agent"
+	"github.com/portainer/agent/anomaly"
 	"github.com/portainer/agent/crypto"
 	"github.com/portainer/agent/edge"
 	"github.com/portainer/agent/exec"
 	"github.com/portainer/agent/http/handler"
+	"github.com/portainer/agent/http/security"
+	"github.com/portainer/agent/identity"
 	"github.com/portainer/agent/kubernetes"
+	"github.com/portainer/agent/operations"
+	"github.com/portainer/agent/spiffe"
 	httpError "github.com/portainer/portainer/pkg/libhttp/error"
 
 	"github.com/rs/zerolog/log"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 // APIServer is the web server exposing the API of an agent.
@@ -31,6 +41,10 @@ type APIServer struct {
 	kubernetesDeployer *exec.KubernetesDeployer
 	containerPlatform  agent.ContainerPlatform
 	nomadConfig        agent.NomadConfig
+	operationManager   *operations.Manager
+	agentIdentity      *identity.Identity
+	svidSource         *spiffe.X509Source
+	proxyPolicyService *security.ProxyPolicyService
 }
 
 // APIServerConfig represents a server configuration
@@ -48,6 +62,10 @@ type APIServerConfig struct {
 	AgentOptions         *agent.Options
 	ContainerPlatform    agent.ContainerPlatform
 	NomadConfig          agent.NomadConfig
+	OperationManager     *operations.Manager
+	AgentIdentity        *identity.Identity
+	SVIDSource           *spiffe.X509Source
+	ProxyPolicyService   *security.ProxyPolicyService
 }
 
 // NewAPIServer returns a pointer to a APIServer.
@@ -65,6 +83,10 @@ func NewAPIServer(config *APIServerConfig) *APIServer {
 		kubernetesDeployer: config.KubernetesDeployer,
 		containerPlatform:  config.ContainerPlatform,
 		nomadConfig:        config.NomadConfig,
+		operationManager:   config.OperationManager,
+		agentIdentity:      config.AgentIdentity,
+		svidSource:         config.SVIDSource,
+		proxyPolicyService: config.ProxyPolicyService,
 	}
 }
 
@@ -81,9 +103,13 @@ func (server *APIServer) Start(edgeMode bool) error {
 		UseTLS:               !edgeMode,
 		ContainerPlatform:    server.containerPlatform,
 		NomadConfig:          server.nomadConfig,
+		OperationManager:     server.operationManager,
+		AgentOptions:         server.agentOptions,
+		AgentIdentity:        server.agentIdentity,
+		ProxyPolicyService:   server.proxyPolicyService,
 	}
 
-	httpHandler := handler.NewHandler(config)
+	httpHandler := anomaly.Middleware(handler.NewHandler(config))
 	httpServer := &http.Server{
 		Addr:         server.addr + ":" + server.port,
 		Handler:      httpHandler,
@@ -100,14 +126,44 @@ func (server *APIServer) Start(edgeMode bool) error {
 
 	if edgeMode {
 		httpServer.Handler = server.edgeHandler(httpHandler)
+		if server.agentOptions.GRPCAPI {
+			// The Edge API server does not use TLS, the gRPC clients connect with HTTP/2 over cleartext
+			httpServer.Handler = h2c.NewHandler(httpServer.Handler, &http2.Server{})
+		}
+
 		return httpServer.ListenAndServe()
 	}
 
 	httpServer.TLSConfig = crypto.CreateTLSConfiguration()
 
+	certPath, keyPath := agent.TLSCertPath, agent.TLSKeyPath
+
+	if len(server.agentOptions.ACMEDomains) > 0 {
+		tlsConfig, err := crypto.CreateACMETLSConfiguration(context.Background(), crypto.ACMEConfig{
+			Domains:      server.agentOptions.ACMEDomains,
+			Email:        server.agentOptions.ACMEEmail,
+			DirectoryURL: server.agentOptions.ACMEDirectoryURL,
+			Solver:       server.agentOptions.ACMESolver,
+			HTTPAddr:     server.agentOptions.ACMEHTTPAddr,
+			DNSHook:      server.agentOptions.ACMEDNSHook,
+			CacheDir:     filepath.Join(server.agentOptions.DataPath, agent.ACMECacheDirName),
+		})
+		if err != nil {
+			return err
+		}
+
+		httpServer.TLSConfig = tlsConfig
+	} else if server.svidSource != nil {
+		// Serve the SVID to every client, including the ones that do not send a server name
+		certPath, keyPath = "", ""
+		httpServer.TLSConfig.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return server.svidSource.GetCertificate()
+		}
+	}
+
 	go server.securityShutdown(httpServer)
 
-	return httpServer.ListenAndServeTLS(agent.TLSCertPath, agent.TLSKeyPath)
+	return httpServer.ListenAndServeTLS(certPath, keyPath)
 }
 
 func (server *APIServer) securityShutdown(httpServer *http.Server) {
@@ -134,7 +190,11 @@ func (server *APIServer) edgeHandler(next http.Handler) http.Handler {
 			return
 		}
 
-		server.edgeManager.ResetActivityTimer()
+		// The replica API is used by local consumers, it does not keep the tunnel open
+		if !strings.HasPrefix(r.URL.Path, "/replica") {
+			endSession := server.edgeManager.StartTunnelSession()
+			defer endSession()
+		}
 
 		next.ServeHTTP(w, r)
 	})
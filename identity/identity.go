@@ -0,0 +1,217 @@
+package identity
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/faults"
+	"github.com/portainer/agent/tpm"
+	"github.com/rs/zerolog/log"
+)
+
+// Identity is the durable identity of an agent. It is generated once and does not depend on the hostname
+// or the network interfaces of the host, so that a reinstalled agent reusing the identity file can reclaim
+// its environment on the Portainer server.
+// When a TPM is enabled, the private key of a new identity is generated inside the TPM and the identity file only
+// contains the key blob wrapped by the TPM.
+type Identity struct {
+	ID     string
+	signer crypto.Signer
+	// tpmKey is the blob of the private key generated inside the TPM, nil when the private key is stored in the file
+	tpmKey *tpm.KeyBlob
+}
+
+type identityFile struct {
+	ID         string       `json:"ID"`
+	PrivateKey string       `json:"PrivateKey,omitempty"`
+	TPMKey     *tpm.KeyBlob `json:"TPMKey,omitempty"`
+}
+
+// LoadOrCreate loads the identity persisted at path or generates and persists a new identity when the file
+// does not exist. The private key of a new identity is generated inside device when it is not nil.
+func LoadOrCreate(path string, device *tpm.Device) (*Identity, error) {
+	content, err := os.ReadFile(path)
+	if err == nil {
+		return parse(content, device)
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	identity, err := generate(device)
+	if err != nil {
+		return nil, err
+	}
+
+	err = identity.save(path)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Str("identity", identity.ID).Str("path", path).Bool("tpm", identity.tpmKey != nil).Msg("new agent identity generated")
+
+	return identity, nil
+}
+
+func generate(device *tpm.Device) (*Identity, error) {
+	if device != nil {
+		blob, err := device.CreateSigningKey()
+		if err != nil {
+			return nil, err
+		}
+
+		signer, err := device.LoadSigningKey(blob)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Identity{ID: uuid.NewString(), signer: signer, tpmKey: blob}, nil
+	}
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Identity{ID: uuid.NewString(), signer: privateKey}, nil
+}
+
+func parse(content []byte, device *tpm.Device) (*Identity, error) {
+	var file identityFile
+	err := json.Unmarshal(content, &file)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := uuid.Parse(file.ID); err != nil {
+		return nil, errors.New("invalid identifier in identity file")
+	}
+
+	if file.TPMKey != nil {
+		if device == nil {
+			return nil, errors.New("the private key of the identity is stored in a TPM, the TPM must be enabled")
+		}
+
+		signer, err := device.LoadSigningKey(file.TPMKey)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Identity{ID: file.ID, signer: signer, tpmKey: file.TPMKey}, nil
+	}
+
+	block, _ := pem.Decode([]byte(file.PrivateKey))
+	if block == nil {
+		return nil, errors.New("invalid private key in identity file")
+	}
+
+	privateKey, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if device != nil {
+		// The key cannot be moved into the TPM, the server recognizes the identity by its public key
+		log.Warn().Str("identity", file.ID).Msg("the private key of the agent identity was generated before the TPM was enabled and stays in the identity file")
+	}
+
+	return &Identity{ID: file.ID, signer: privateKey}, nil
+}
+
+func (identity *Identity) save(path string) error {
+	file := identityFile{ID: identity.ID, TPMKey: identity.tpmKey}
+
+	if privateKey, ok := identity.signer.(*ecdsa.PrivateKey); ok {
+		der, err := x509.MarshalECPrivateKey(privateKey)
+		if err != nil {
+			return err
+		}
+
+		file.PrivateKey = string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	}
+
+	content, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, content, 0600)
+}
+
+// PublicKey returns the public key of the identity, hexadecimal encoded PKIX DER data
+func (identity *Identity) PublicKey() (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(identity.signer.Public())
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(der), nil
+}
+
+// Sign returns the signature of the SHA-256 digest of message, base64 encoded r and s values
+func (identity *Identity) Sign(message string) (string, error) {
+	hash := sha256.Sum256([]byte(message))
+
+	der, err := identity.signer.Sign(rand.Reader, hash[:], crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+
+	var values struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(der, &values); err != nil {
+		return "", err
+	}
+
+	keySize := identity.signer.Public().(*ecdsa.PublicKey).Params().BitSize / 8
+	signature := make([]byte, 2*keySize)
+	values.R.FillBytes(signature[:keySize])
+	values.S.FillBytes(signature[keySize:])
+
+	return base64.RawStdEncoding.EncodeToString(signature), nil
+}
+
+// SetHeaders adds the identity headers to a request sent to the Portainer server. The signature covers the
+// identifier and the timestamp so that the server can verify that the agent holds the private key.
+func (identity *Identity) SetHeaders(header http.Header) error {
+	publicKey, err := identity.PublicKey()
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(faults.Now().Unix(), 10)
+
+	signature, err := identity.Sign(identity.ID + "." + timestamp)
+	if err != nil {
+		return err
+	}
+
+	header.Set(agent.HTTPAgentIdentityHeaderName, identity.ID)
+	header.Set(agent.HTTPAgentIdentityPublicKeyHeaderName, publicKey)
+	header.Set(agent.HTTPAgentIdentityTimestampHeaderName, timestamp)
+	header.Set(agent.HTTPAgentIdentitySignatureHeaderName, signature)
+
+	return nil
+}
@@ -0,0 +1,780 @@
+// Package imagecache lets an agent act as the registry mirror of the other hosts of its site. The mirror serves the
+// pull endpoints of the registry API from a cache of the manifests and the layers already pulled over the LAN, the
+// missing ones are fetched once from the upstream registry. The Docker daemons of the site use the mirror with the
+// registry-mirrors setting of their daemon.json, including the daemon of the agent hosting the cache so that its own
+// pulls fill the cache. Only the public repositories are cached, the daemons pull the private images from the
+// upstream registry when the mirror fails.
+package imagecache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// partialSuffix marks the layers being downloaded from the upstream registry
+	partialSuffix = ".partial"
+	// maxManifestSize bounds the size of the manifests read from the upstream registry
+	maxManifestSize = 4 << 20
+	// defaultTokenLifetime is the lifetime of the tokens of the upstream registry that do not set their expiry
+	defaultTokenLifetime = 60 * time.Second
+	// errorRetention is the duration during which the last upstream error is reported in the diagnostics
+	errorRetention = time.Hour
+	// defaultManifestType is the media type of the cached manifests that do not declare theirs
+	defaultManifestType = "application/vnd.docker.distribution.manifest.v2+json"
+)
+
+var (
+	nameRegexp   = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+	tagRegexp    = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+	digestRegexp = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+)
+
+var (
+	defaultCache   *Cache
+	defaultCacheMu sync.Mutex
+)
+
+// Report is the state of the image cache served to the other hosts of the site
+type Report struct {
+	Upstream     string `json:"Upstream"`
+	SizeBytes    int64  `json:"SizeBytes"`
+	MaxSizeBytes int64  `json:"MaxSizeBytes"`
+	Layers       int    `json:"Layers"`
+	// Hits and Misses count the layers served from the cache and fetched from the upstream registry
+	Hits         uint64 `json:"Hits"`
+	Misses       uint64 `json:"Misses"`
+	ServedBytes  uint64 `json:"ServedBytes"`
+	FetchedBytes uint64 `json:"FetchedBytes"`
+	// LastError is the last failure of the upstream registry
+	LastError   string     `json:"LastError,omitempty"`
+	LastErrorAt *time.Time `json:"LastErrorAt,omitempty"`
+}
+
+// Cache is a pull-through cache of the manifests and the layers of an upstream registry
+type Cache struct {
+	path     string
+	upstream *url.URL
+	maxSize  int64
+	client   *http.Client
+
+	mu      sync.Mutex
+	size    int64
+	layers  int
+	fetches map[string]chan struct{}
+	tokens  map[string]token
+	report  Report
+}
+
+type token struct {
+	value     string
+	expiresAt time.Time
+}
+
+// NewCache returns a pointer to a Cache of the upstream registry storing at most maxSize bytes of layers inside
+// path, the least recently used layers are removed once exceeded
+func NewCache(path, upstream string, maxSize int64) (*Cache, error) {
+	upstreamURL, err := url.Parse(strings.TrimSuffix(upstream, "/"))
+	if err != nil || (upstreamURL.Scheme != "https" && upstreamURL.Scheme != "http") || upstreamURL.Host == "" {
+		return nil, fmt.Errorf("invalid upstream registry URL: %q", upstream)
+	}
+
+	cache := &Cache{
+		path:     path,
+		upstream: upstreamURL,
+		maxSize:  maxSize,
+		client:   &http.Client{},
+		fetches:  map[string]chan struct{}{},
+		tokens:   map[string]token{},
+		report:   Report{Upstream: upstreamURL.String(), MaxSizeBytes: maxSize},
+	}
+
+	for _, dir := range []string{"blobs", "manifests", "tags"} {
+		if err := os.MkdirAll(filepath.Join(path, dir), 0700); err != nil {
+			return nil, err
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Join(path, "blobs"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), partialSuffix) {
+			os.Remove(filepath.Join(path, "blobs", entry.Name()))
+			continue
+		}
+
+		if info, err := entry.Info(); err == nil {
+			cache.size += info.Size()
+			cache.layers++
+		}
+	}
+
+	return cache, nil
+}
+
+// ServeHTTP serves the pull endpoints of the registry API
+func (cache *Cache) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(rw, http.StatusMethodNotAllowed, "UNSUPPORTED", "the image cache only serves the pulls")
+		return
+	}
+
+	if r.URL.Path == "/v2/" || r.URL.Path == "/v2" {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write([]byte("{}"))
+		return
+	}
+
+	name, kind, reference, ok := parsePath(r.URL.Path)
+	if !ok {
+		writeError(rw, http.StatusNotFound, "NAME_UNKNOWN", "invalid repository path")
+		return
+	}
+
+	if kind == "blobs" {
+		cache.serveBlob(rw, r, name, reference)
+		return
+	}
+
+	cache.serveManifest(rw, r, name, reference)
+}
+
+// parsePath returns the repository, the kind (manifests or blobs) and the reference of a path of the registry API,
+// e.g. /v2/library/nginx/manifests/1.25
+func parsePath(path string) (string, string, string, bool) {
+	path, found := strings.CutPrefix(path, "/v2/")
+	if !found {
+		return "", "", "", false
+	}
+
+	for _, kind := range []string{"manifests", "blobs"} {
+		index := strings.LastIndex(path, "/"+kind+"/")
+		if index <= 0 {
+			continue
+		}
+
+		name, reference := path[:index], path[index+len(kind)+2:]
+		if !nameRegexp.MatchString(name) {
+			return "", "", "", false
+		}
+
+		if digestRegexp.MatchString(reference) || (kind == "manifests" && tagRegexp.MatchString(reference)) {
+			return name, kind, reference, true
+		}
+
+		return "", "", "", false
+	}
+
+	return "", "", "", false
+}
+
+func (cache *Cache) serveBlob(rw http.ResponseWriter, r *http.Request, name, digest string) {
+	path := cache.blobPath(digest)
+
+	for {
+		if cache.serveCachedBlob(rw, r, digest, path) {
+			return
+		}
+
+		cache.mu.Lock()
+		wait, fetching := cache.fetches[digest]
+		if !fetching {
+			cache.fetches[digest] = make(chan struct{})
+		}
+		cache.mu.Unlock()
+
+		if !fetching {
+			break
+		}
+
+		// the layer is downloaded for another host, it is served from the cache once downloaded
+		select {
+		case <-wait:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	defer func() {
+		cache.mu.Lock()
+		close(cache.fetches[digest])
+		delete(cache.fetches, digest)
+		cache.mu.Unlock()
+	}()
+
+	cache.mu.Lock()
+	cache.report.Misses++
+	cache.mu.Unlock()
+
+	if err := cache.fetchBlob(rw, r, name, digest, path); err != nil {
+		cache.upstreamFailed(err)
+
+		log.Warn().Err(err).Str("repository", name).Str("digest", digest).Msg("unable to fetch the layer from the upstream registry")
+	}
+}
+
+// serveCachedBlob serves the layer from the cache and returns true when it is cached
+func (cache *Cache) serveCachedBlob(rw http.ResponseWriter, r *http.Request, digest, path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	// the modification time orders the layers for the eviction
+	now := time.Now()
+	os.Chtimes(path, now, now)
+
+	cache.mu.Lock()
+	cache.report.Hits++
+	if r.Method == http.MethodGet {
+		cache.report.ServedBytes += uint64(info.Size())
+	}
+	cache.mu.Unlock()
+
+	rw.Header().Set("Docker-Content-Digest", digest)
+	rw.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(rw, r, "", info.ModTime(), f)
+
+	return true
+}
+
+// fetchBlob downloads the layer from the upstream registry while it is sent to the client. The download continues
+// when the client disconnects, so that the layer is cached for the next hosts.
+func (cache *Cache) fetchBlob(rw http.ResponseWriter, r *http.Request, name, digest, path string) error {
+	ctx := context.WithoutCancel(r.Context())
+
+	resp, err := cache.upstreamRequest(ctx, r.Method, name, "blobs/"+digest, r.Header)
+	if err != nil {
+		writeError(rw, http.StatusBadGateway, "UNAVAILABLE", "the upstream registry is unreachable")
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || r.Method == http.MethodHead {
+		copyResponse(rw, resp)
+
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("the upstream registry answered with the status code %d", resp.StatusCode)
+		}
+
+		return nil
+	}
+
+	partial, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*"+partialSuffix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(partial.Name())
+	defer partial.Close()
+
+	rw.Header().Set("Docker-Content-Digest", digest)
+	rw.Header().Set("Content-Type", "application/octet-stream")
+	if resp.ContentLength >= 0 {
+		rw.Header().Set("Content-Length", fmt.Sprint(resp.ContentLength))
+	}
+	rw.WriteHeader(http.StatusOK)
+
+	hash := sha256.New()
+	client := &clientWriter{writer: rw}
+
+	size, err := io.Copy(io.MultiWriter(partial, hash, client), resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if computed := "sha256:" + hex.EncodeToString(hash.Sum(nil)); computed != digest {
+		return fmt.Errorf("the digest of the layer is %s", computed)
+	}
+
+	if err := partial.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(partial.Name(), path); err != nil {
+		return err
+	}
+
+	cache.mu.Lock()
+	cache.size += size
+	cache.layers++
+	cache.report.FetchedBytes += uint64(size)
+	cache.report.ServedBytes += uint64(client.written)
+	cache.mu.Unlock()
+
+	cache.evict()
+
+	return nil
+}
+
+// clientWriter writes to the client until it fails, the following writes are discarded
+type clientWriter struct {
+	writer  io.Writer
+	written int64
+	failed  bool
+}
+
+func (w *clientWriter) Write(p []byte) (int, error) {
+	if !w.failed {
+		n, err := w.writer.Write(p)
+		w.written += int64(n)
+		w.failed = err != nil
+	}
+
+	return len(p), nil
+}
+
+// serveManifest serves the manifest from the upstream registry and caches it. The cached manifest is served when
+// the upstream registry is unreachable, so that the hosts of the site can still pull the images already cached.
+func (cache *Cache) serveManifest(rw http.ResponseWriter, r *http.Request, name, reference string) {
+	if digestRegexp.MatchString(reference) {
+		if content, err := os.ReadFile(cache.manifestPath(reference)); err == nil {
+			writeManifest(rw, r, reference, content)
+			return
+		}
+	}
+
+	content, digest, contentType, err := cache.fetchManifest(r.Context(), name, reference, r.Header)
+
+	var statusErr *upstreamStatusError
+	if errors.As(err, &statusErr) {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(statusErr.statusCode)
+		rw.Write(statusErr.body)
+		return
+	}
+
+	if err != nil {
+		cache.upstreamFailed(err)
+
+		if digest, readErr := os.ReadFile(cache.tagPath(name, reference)); readErr == nil {
+			if content, readErr := os.ReadFile(cache.manifestPath(string(digest))); readErr == nil {
+				log.Debug().Err(err).Str("repository", name).Str("tag", reference).Msg("serving the cached manifest, the upstream registry is unreachable")
+
+				writeManifest(rw, r, string(digest), content)
+				return
+			}
+		}
+
+		writeError(rw, http.StatusBadGateway, "UNAVAILABLE", "the upstream registry is unreachable")
+		return
+	}
+
+	rw.Header().Set("Content-Type", contentType)
+	writeManifest(rw, r, digest, content)
+}
+
+type upstreamStatusError struct {
+	statusCode int
+	body       []byte
+}
+
+func (err *upstreamStatusError) Error() string {
+	return fmt.Sprintf("the upstream registry answered with the status code %d", err.statusCode)
+}
+
+// fetchManifest returns the manifest of the upstream registry, its digest and its media type, the manifest is
+// cached by digest and by tag
+func (cache *Cache) fetchManifest(ctx context.Context, name, reference string, header http.Header) ([]byte, string, string, error) {
+	resp, err := cache.upstreamRequest(ctx, http.MethodGet, name, "manifests/"+reference, header)
+	if err != nil {
+		return nil, "", "", err
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize))
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return nil, "", "", fmt.Errorf("the upstream registry answered with the status code %d", resp.StatusCode)
+		}
+
+		return nil, "", "", &upstreamStatusError{statusCode: resp.StatusCode, body: content}
+	}
+
+	hash := sha256.Sum256(content)
+	digest := "sha256:" + hex.EncodeToString(hash[:])
+
+	if digestRegexp.MatchString(reference) && reference != digest {
+		return nil, "", "", fmt.Errorf("the digest of the manifest is %s", digest)
+	}
+
+	if err := writeFile(cache.manifestPath(digest), content); err != nil {
+		return nil, "", "", err
+	}
+
+	if !digestRegexp.MatchString(reference) {
+		if err := writeFile(cache.tagPath(name, reference), []byte(digest)); err != nil {
+			return nil, "", "", err
+		}
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = manifestType(content)
+	}
+
+	return content, digest, contentType, nil
+}
+
+func writeManifest(rw http.ResponseWriter, r *http.Request, digest string, content []byte) {
+	if rw.Header().Get("Content-Type") == "" {
+		rw.Header().Set("Content-Type", manifestType(content))
+	}
+
+	rw.Header().Set("Docker-Content-Digest", digest)
+	rw.Header().Set("Content-Length", fmt.Sprint(len(content)))
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	rw.Write(content)
+}
+
+// manifestType returns the media type declared by a manifest
+func manifestType(content []byte) string {
+	var manifest struct {
+		MediaType string `json:"mediaType"`
+	}
+
+	if err := json.Unmarshal(content, &manifest); err != nil || manifest.MediaType == "" {
+		return defaultManifestType
+	}
+
+	return manifest.MediaType
+}
+
+// upstreamRequest sends a request of the registry API to the upstream registry, the anonymous pull token of the
+// repository is requested when the registry asks for it
+func (cache *Cache) upstreamRequest(ctx context.Context, method, name, path string, header http.Header) (*http.Response, error) {
+	scope := "repository:" + name + ":pull"
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, cache.upstream.JoinPath("v2", name, path).String(), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, accept := range header.Values("Accept") {
+			req.Header.Add("Accept", accept)
+		}
+
+		if token := cache.token(scope); token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := cache.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		challenge := resp.Header.Get("WWW-Authenticate")
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 || !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+			return resp, nil
+		}
+
+		resp.Body.Close()
+
+		if err := cache.authenticate(ctx, challenge, scope); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (cache *Cache) token(scope string) string {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	token, ok := cache.tokens[scope]
+	if !ok || time.Now().After(token.expiresAt) {
+		return ""
+	}
+
+	return token.value
+}
+
+// authenticate requests an anonymous token for scope from the realm of the Bearer challenge of the registry
+func (cache *Cache) authenticate(ctx context.Context, challenge, scope string) error {
+	params := parseChallenge(challenge[len("bearer "):])
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil || (realm.Scheme != "https" && realm.Scheme != "http") {
+		return fmt.Errorf("invalid authentication realm %q", params["realm"])
+	}
+
+	query := realm.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := cache.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("the authentication realm answered with the status code %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return err
+	}
+
+	value := body.Token
+	if value == "" {
+		value = body.AccessToken
+	}
+
+	lifetime := defaultTokenLifetime
+	if body.ExpiresIn > 0 {
+		lifetime = time.Duration(body.ExpiresIn) * time.Second
+	}
+
+	cache.mu.Lock()
+	// the token is renewed before it expires during a request
+	cache.tokens[scope] = token{value: value, expiresAt: time.Now().Add(lifetime * 9 / 10)}
+	cache.mu.Unlock()
+
+	return nil
+}
+
+// parseChallenge returns the parameters of a challenge, e.g. realm="https://auth.docker.io/token",service="registry.docker.io"
+func parseChallenge(challenge string) map[string]string {
+	params := map[string]string{}
+
+	for challenge != "" {
+		key, rest, found := strings.Cut(challenge, "=")
+		if !found {
+			break
+		}
+
+		key = strings.ToLower(strings.TrimSpace(key))
+		rest = strings.TrimSpace(rest)
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				break
+			}
+
+			value, rest = rest[1:end+1], rest[end+2:]
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+			rest = "," + rest
+		}
+
+		params[key] = value
+		_, challenge, _ = strings.Cut(rest, ",")
+	}
+
+	return params
+}
+
+// evict removes the least recently used layers until the size of the cache is within its maximum size
+func (cache *Cache) evict() {
+	cache.mu.Lock()
+	size := cache.size
+	cache.mu.Unlock()
+
+	if size <= cache.maxSize {
+		return
+	}
+
+	type layer struct {
+		path   string
+		size   int64
+		usedAt time.Time
+	}
+
+	var layers []layer
+	filepath.WalkDir(filepath.Join(cache.path, "blobs"), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || strings.HasSuffix(path, partialSuffix) {
+			return nil
+		}
+
+		if info, err := entry.Info(); err == nil {
+			layers = append(layers, layer{path: path, size: info.Size(), usedAt: info.ModTime()})
+		}
+
+		return nil
+	})
+
+	sort.Slice(layers, func(i, j int) bool {
+		return layers[i].usedAt.Before(layers[j].usedAt)
+	})
+
+	for _, layer := range layers {
+		if size <= cache.maxSize {
+			break
+		}
+
+		if err := os.Remove(layer.path); err != nil {
+			continue
+		}
+
+		size -= layer.size
+
+		cache.mu.Lock()
+		cache.size -= layer.size
+		cache.layers--
+		cache.mu.Unlock()
+	}
+}
+
+func (cache *Cache) upstreamFailed(err error) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	now := time.Now()
+	cache.report.LastError = err.Error()
+	cache.report.LastErrorAt = &now
+}
+
+func (cache *Cache) blobPath(digest string) string {
+	return filepath.Join(cache.path, "blobs", strings.TrimPrefix(digest, "sha256:"))
+}
+
+func (cache *Cache) manifestPath(digest string) string {
+	return filepath.Join(cache.path, "manifests", strings.TrimPrefix(digest, "sha256:"))
+}
+
+// tagPath returns the file holding the digest of the manifest of a tag
+func (cache *Cache) tagPath(name, tag string) string {
+	return filepath.Join(cache.path, "tags", filepath.FromSlash(name), tag)
+}
+
+// writeFile writes the file atomically, so that a partially written manifest is never served
+func writeFile(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	partial := path + partialSuffix
+	if err := os.WriteFile(partial, content, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(partial, path)
+}
+
+func copyResponse(rw http.ResponseWriter, resp *http.Response) {
+	for _, header := range []string{"Content-Type", "Content-Length", "Docker-Content-Digest"} {
+		if value := resp.Header.Get(header); value != "" {
+			rw.Header().Set(header, value)
+		}
+	}
+
+	rw.WriteHeader(resp.StatusCode)
+	io.Copy(rw, resp.Body)
+}
+
+// writeError writes an error of the registry API
+func writeError(rw http.ResponseWriter, statusCode int, code, message string) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(statusCode)
+
+	json.NewEncoder(rw).Encode(map[string]interface{}{
+		"errors": []map[string]string{{"code": code, "message": message}},
+	})
+}
+
+// Report returns the state of the cache, nil when the cache is not enabled
+func (cache *Cache) Report() *Report {
+	if cache == nil {
+		return nil
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	report := cache.report
+	report.SizeBytes = cache.size
+	report.Layers = cache.layers
+
+	return &report
+}
+
+// Diagnostics returns the last failure of the upstream registry when it is recent
+func (report *Report) Diagnostics() []string {
+	if report == nil || report.LastErrorAt == nil || time.Since(*report.LastErrorAt) > errorRetention {
+		return nil
+	}
+
+	return []string{"the image cache is unable to reach the upstream registry: " + report.LastError}
+}
+
+// Serve exposes the cache on addr, it blocks until the listener fails
+func Serve(addr string, cache *Cache) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           cache,
+		ReadHeaderTimeout: 15 * time.Second,
+		IdleTimeout:       60 * time.Second,
+	}
+
+	log.Info().Str("addr", addr).Str("upstream", cache.upstream.String()).Msg("starting the image cache")
+
+	return server.ListenAndServe()
+}
+
+// Enable makes cache the default cache returned by DefaultCache
+func Enable(cache *Cache) {
+	defaultCacheMu.Lock()
+	defer defaultCacheMu.Unlock()
+
+	defaultCache = cache
+}
+
+// DefaultCache returns the default cache, nil when the agent does not serve an image cache
+func DefaultCache() *Cache {
+	defaultCacheMu.Lock()
+	defer defaultCacheMu.Unlock()
+
+	return defaultCache
+}
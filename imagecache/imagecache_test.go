@@ -0,0 +1,246 @@
+package imagecache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+type registry struct {
+	server     *httptest.Server
+	blobs      map[string][]byte
+	manifest   []byte
+	blobPulls  atomic.Int32
+	tokenPulls atomic.Int32
+}
+
+func digestOf(content []byte) string {
+	hash := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(hash[:])
+}
+
+func newRegistry(t *testing.T) *registry {
+	reg := &registry{
+		blobs:    map[string][]byte{},
+		manifest: []byte(`{"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[]}`),
+	}
+
+	reg.server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			reg.tokenPulls.Add(1)
+
+			if r.URL.Query().Get("scope") != "repository:library/nginx:pull" || r.URL.Query().Get("service") != "registry.test" {
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			rw.Write([]byte(`{"token":"secret","expires_in":300}`))
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			rw.Header().Set("WWW-Authenticate", `Bearer realm="`+reg.server.URL+`/token",service="registry.test",scope="repository:library/nginx:pull"`)
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.URL.Path == "/v2/library/nginx/manifests/1.25":
+			rw.Write(reg.manifest)
+		case strings.HasPrefix(r.URL.Path, "/v2/library/nginx/blobs/"):
+			reg.blobPulls.Add(1)
+
+			content, ok := reg.blobs[strings.TrimPrefix(r.URL.Path, "/v2/library/nginx/blobs/")]
+			if !ok {
+				rw.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			rw.Write(content)
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(reg.server.Close)
+
+	return reg
+}
+
+func get(t *testing.T, cache *Cache, path string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	cache.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	return rec
+}
+
+func TestServeBlob(t *testing.T) {
+	reg := newRegistry(t)
+	layer := []byte(strings.Repeat("layer", 1000))
+	digest := digestOf(layer)
+	reg.blobs[digest] = layer
+
+	cache, err := NewCache(t.TempDir(), reg.server.URL, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		rec := get(t, cache, "/v2/library/nginx/blobs/"+digest)
+		if rec.Code != http.StatusOK || rec.Body.String() != string(layer) {
+			t.Fatalf("unexpected response %d of %d bytes", rec.Code, rec.Body.Len())
+		}
+
+		if rec.Header().Get("Docker-Content-Digest") != digest {
+			t.Errorf("unexpected digest %q", rec.Header().Get("Docker-Content-Digest"))
+		}
+	}
+
+	if reg.blobPulls.Load() != 1 || reg.tokenPulls.Load() != 1 {
+		t.Errorf("expected a single pull of the layer and the token, got %d and %d", reg.blobPulls.Load(), reg.tokenPulls.Load())
+	}
+
+	report := cache.Report()
+	if report.Hits != 2 || report.Misses != 1 || report.Layers != 1 || report.SizeBytes != int64(len(layer)) {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	if report.ServedBytes != uint64(3*len(layer)) || report.FetchedBytes != uint64(len(layer)) {
+		t.Errorf("unexpected transferred bytes %+v", report)
+	}
+}
+
+func TestServeBlobDigestMismatch(t *testing.T) {
+	reg := newRegistry(t)
+	digest := digestOf([]byte("expected"))
+	reg.blobs[digest] = []byte("tampered")
+
+	cache, err := NewCache(t.TempDir(), reg.server.URL, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get(t, cache, "/v2/library/nginx/blobs/"+digest)
+	get(t, cache, "/v2/library/nginx/blobs/"+digest)
+
+	if reg.blobPulls.Load() != 2 {
+		t.Errorf("expected the tampered layer not to be cached, got %d pulls", reg.blobPulls.Load())
+	}
+
+	report := cache.Report()
+	if report.Layers != 0 || len(report.Diagnostics()) != 1 {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
+
+func TestServeManifestFallback(t *testing.T) {
+	reg := newRegistry(t)
+
+	cache, err := NewCache(t.TempDir(), reg.server.URL, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := get(t, cache, "/v2/library/nginx/manifests/1.25")
+	if rec.Code != http.StatusOK || rec.Header().Get("Docker-Content-Digest") != digestOf(reg.manifest) {
+		t.Fatalf("unexpected response %d %v", rec.Code, rec.Header())
+	}
+
+	reg.server.Close()
+
+	rec = get(t, cache, "/v2/library/nginx/manifests/1.25")
+	if rec.Code != http.StatusOK || rec.Body.String() != string(reg.manifest) {
+		t.Fatalf("expected the cached manifest, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	if rec.Header().Get("Content-Type") != "application/vnd.oci.image.manifest.v1+json" {
+		t.Errorf("unexpected content type %q", rec.Header().Get("Content-Type"))
+	}
+
+	rec = get(t, cache, "/v2/library/nginx/manifests/1.26")
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("expected a bad gateway for an uncached tag, got %d", rec.Code)
+	}
+}
+
+func TestEvict(t *testing.T) {
+	reg := newRegistry(t)
+
+	var digests []string
+	for _, content := range []string{"first", "second", "third"} {
+		layer := []byte(strings.Repeat(content, 100))
+		digests = append(digests, digestOf(layer))
+		reg.blobs[digestOf(layer)] = layer
+	}
+
+	cache, err := NewCache(t.TempDir(), reg.server.URL, 1100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, digest := range digests {
+		get(t, cache, "/v2/library/nginx/blobs/"+digest)
+	}
+
+	report := cache.Report()
+	if report.SizeBytes > 1100 || report.Layers != 2 {
+		t.Errorf("unexpected report after the eviction %+v", report)
+	}
+
+	get(t, cache, "/v2/library/nginx/blobs/"+digests[2])
+	if reg.blobPulls.Load() != 3 {
+		t.Errorf("expected the most recent layer to be kept, got %d pulls", reg.blobPulls.Load())
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	digest := digestOf(nil)
+
+	tests := []struct {
+		path string
+		ok   bool
+	}{
+		{"/v2/library/nginx/manifests/1.25", true},
+		{"/v2/portainer/agent/blobs/" + digest, true},
+		{"/v2/nginx/manifests/" + digest, true},
+		{"/v2/library/nginx/blobs/latest", false},
+		{"/v2/library/../nginx/manifests/latest", false},
+		{"/v2/Library/nginx/manifests/latest", false},
+		{"/v2/library/nginx/tags/list", false},
+		{"/v1/library/nginx/manifests/latest", false},
+	}
+
+	for _, test := range tests {
+		if _, _, _, ok := parsePath(test.path); ok != test.ok {
+			t.Errorf("parsePath(%q): expected %t", test.path, test.ok)
+		}
+	}
+}
+
+func TestServeHTTPReadOnly(t *testing.T) {
+	cache, err := NewCache(t.TempDir(), "https://registry-1.docker.io", 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := get(t, cache, "/v2/")
+	if rec.Code != http.StatusOK || rec.Header().Get("Docker-Distribution-API-Version") != "registry/2.0" {
+		t.Errorf("unexpected version check %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	cache.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/v2/library/nginx/manifests/latest", io.NopCloser(strings.NewReader("{}"))))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected the push to be refused, got %d", rec.Code)
+	}
+
+	if _, err := NewCache(t.TempDir(), "ftp://registry", 0); err == nil {
+		t.Error("expected an invalid upstream to be refused")
+	}
+}
@@ -0,0 +1,298 @@
+package inventory
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/portainer/agent"
+)
+
+// nearFullDiskPercent is the usage of a partition from which it is reported in the diagnostics
+const nearFullDiskPercent = 90
+
+// hostRoot is the folder mapping to the host filesystem, the files of the agent container are used when it is not mounted
+var hostRoot = agent.HostRoot
+
+var (
+	procPath    = "/proc"
+	thermalPath = "/sys/class/thermal"
+)
+
+// HostInventory represents the operating system and the hardware of the host, beyond what the Docker info reports
+type HostInventory struct {
+	OS            OSInfo      `json:"OS"`
+	KernelVersion string      `json:"KernelVersion"`
+	UptimeSeconds int64       `json:"UptimeSeconds"`
+	Partitions    []Partition `json:"Partitions"`
+	// NetworkInterfaces are the interfaces of the network namespace of the agent, the ones of the host when the agent
+	// runs on the host network
+	NetworkInterfaces []NetworkInterface `json:"NetworkInterfaces"`
+	// RebootRequired is true when the package manager of the host requested a reboot
+	RebootRequired bool `json:"RebootRequired"`
+	// RebootRequiredPackages are the packages that requested the reboot, when reported by the package manager
+	RebootRequiredPackages []string `json:"RebootRequiredPackages,omitempty"`
+	// Temperatures are the thermal zones of the host, usually only available on ARM devices and laptops
+	Temperatures []Temperature `json:"Temperatures,omitempty"`
+}
+
+// OSInfo represents the distribution of the host, read from its os-release file
+type OSInfo struct {
+	ID           string `json:"ID"`
+	Name         string `json:"Name"`
+	Version      string `json:"Version"`
+	Architecture string `json:"Architecture"`
+}
+
+// Partition represents a mounted partition of the host and its free space
+type Partition struct {
+	Device     string `json:"Device"`
+	MountPoint string `json:"MountPoint"`
+	FSType     string `json:"FSType"`
+	TotalBytes uint64 `json:"TotalBytes"`
+	FreeBytes  uint64 `json:"FreeBytes"`
+	// UsedPercent is the share of the partition used, as reported by df
+	UsedPercent float64 `json:"UsedPercent"`
+}
+
+// NetworkInterface represents a network interface and its addresses
+type NetworkInterface struct {
+	Name       string   `json:"Name"`
+	MACAddress string   `json:"MACAddress,omitempty"`
+	Up         bool     `json:"Up"`
+	Addresses  []string `json:"Addresses"`
+}
+
+// Temperature represents the temperature of a thermal zone
+type Temperature struct {
+	Zone    string  `json:"Zone"`
+	Celsius float64 `json:"Celsius"`
+}
+
+// Diagnostics returns a diagnostic message for each partition that is nearly full and when a reboot is pending
+func (inventory *HostInventory) Diagnostics() []string {
+	if inventory == nil {
+		return nil
+	}
+
+	var diagnostics []string
+	for _, partition := range inventory.Partitions {
+		if partition.UsedPercent >= nearFullDiskPercent {
+			diagnostics = append(diagnostics, fmt.Sprintf("disk nearly full: %s mounted on %s is %.0f%% used, %d bytes free", partition.Device, partition.MountPoint, partition.UsedPercent, partition.FreeBytes))
+		}
+	}
+
+	if inventory.RebootRequired {
+		diagnostics = append(diagnostics, "reboot required: the package manager of the host requested a reboot")
+	}
+
+	return diagnostics
+}
+
+// hostPath returns the path of name on the host filesystem, or inside the agent container when the host
+// filesystem is not mounted
+func hostPath(name string) string {
+	path := filepath.Join(hostRoot, name)
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+
+	return name
+}
+
+func readOSInfo() OSInfo {
+	for _, name := range []string{"/etc/os-release", "/usr/lib/os-release"} {
+		f, err := os.Open(hostPath(name))
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+
+		return parseOSRelease(f)
+	}
+
+	return OSInfo{}
+}
+
+// parseOSRelease parses the content of an os-release file, made of KEY="value" lines
+func parseOSRelease(r io.Reader) OSInfo {
+	values := map[string]string{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok || strings.HasPrefix(key, "#") {
+			continue
+		}
+
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `'"`)
+		}
+
+		values[key] = value
+	}
+
+	name := values["PRETTY_NAME"]
+	if name == "" {
+		name = values["NAME"]
+	}
+
+	return OSInfo{
+		ID:      values["ID"],
+		Name:    name,
+		Version: values["VERSION_ID"],
+	}
+}
+
+// parseUptime returns the uptime in seconds from the content of /proc/uptime, e.g. "350735.47 234388.90"
+func parseUptime(content string) (int64, error) {
+	fields := strings.Fields(content)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("unexpected uptime %q", content)
+	}
+
+	uptime, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(uptime), nil
+}
+
+// mount represents an entry of a mounts file
+type mount struct {
+	device     string
+	mountPoint string
+	fsType     string
+}
+
+// parseMounts returns the mounts of block devices of the content of a /proc/mounts file, each device only being
+// reported for its first mount point
+func parseMounts(r io.Reader) []mount {
+	mounts := []mount{}
+	devices := map[string]bool{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || !strings.HasPrefix(fields[0], "/dev/") || devices[fields[0]] {
+			continue
+		}
+
+		// the spaces of the mount points are escaped as \040
+		mountPoint := strings.ReplaceAll(fields[1], `\040`, " ")
+
+		devices[fields[0]] = true
+		mounts = append(mounts, mount{device: fields[0], mountPoint: mountPoint, fsType: fields[2]})
+	}
+
+	return mounts
+}
+
+// readRebootRequired returns true when the Debian based distributions flagged the host for a reboot, along with
+// the packages that requested it
+func readRebootRequired() (bool, []string) {
+	for _, dir := range []string{"/run", "/var/run"} {
+		if _, err := os.Stat(filepath.Join(hostRoot, dir, "reboot-required")); err != nil {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(hostRoot, dir, "reboot-required.pkgs"))
+		if err != nil {
+			return true, nil
+		}
+
+		packages := []string{}
+		for _, pkg := range strings.Fields(string(data)) {
+			if !containsString(packages, pkg) {
+				packages = append(packages, pkg)
+			}
+		}
+		sort.Strings(packages)
+
+		return true, packages
+	}
+
+	return false, nil
+}
+
+// readTemperatures returns the temperature of the thermal zones exposed by the kernel, which reports them in
+// millidegrees Celsius
+func readTemperatures() []Temperature {
+	zones, err := filepath.Glob(filepath.Join(thermalPath, "thermal_zone*"))
+	if err != nil {
+		return nil
+	}
+
+	var temperatures []Temperature
+	for _, zone := range zones {
+		data, err := os.ReadFile(filepath.Join(zone, "temp"))
+		if err != nil {
+			continue
+		}
+
+		milliCelsius, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		name := filepath.Base(zone)
+		if zoneType, err := os.ReadFile(filepath.Join(zone, "type")); err == nil && len(strings.TrimSpace(string(zoneType))) > 0 {
+			name = strings.TrimSpace(string(zoneType))
+		}
+
+		temperatures = append(temperatures, Temperature{Zone: name, Celsius: float64(milliCelsius) / 1000})
+	}
+
+	return temperatures
+}
+
+func readNetworkInterfaces() ([]NetworkInterface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	interfaces := make([]NetworkInterface, 0, len(ifaces))
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		networkInterface := NetworkInterface{
+			Name:       iface.Name,
+			MACAddress: iface.HardwareAddr.String(),
+			Up:         iface.Flags&net.FlagUp != 0,
+			Addresses:  []string{},
+		}
+
+		addrs, err := iface.Addrs()
+		if err == nil {
+			for _, addr := range addrs {
+				networkInterface.Addresses = append(networkInterface.Addresses, addr.String())
+			}
+		}
+
+		interfaces = append(interfaces, networkInterface)
+	}
+
+	return interfaces, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,102 @@
+//go:build linux
+// +build linux
+
+package inventory
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// GetHostInventory collects the inventory of the host through its filesystem mounted in the agent container. The
+// parts of the inventory that cannot be read are left out.
+func GetHostInventory() (*HostInventory, error) {
+	inventory := &HostInventory{
+		OS:                readOSInfo(),
+		Partitions:        []Partition{},
+		NetworkInterfaces: []NetworkInterface{},
+	}
+	inventory.OS.Architecture = runtime.GOARCH
+
+	// the kernel and its uptime are shared by the host and the containers
+	if data, err := os.ReadFile(filepath.Join(procPath, "sys", "kernel", "osrelease")); err == nil {
+		inventory.KernelVersion = strings.TrimSpace(string(data))
+	}
+
+	data, err := os.ReadFile(filepath.Join(procPath, "uptime"))
+	if err != nil {
+		return nil, err
+	}
+
+	inventory.UptimeSeconds, err = parseUptime(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	inventory.Partitions = readPartitions()
+
+	interfaces, err := readNetworkInterfaces()
+	if err != nil {
+		return nil, err
+	}
+	inventory.NetworkInterfaces = interfaces
+
+	inventory.RebootRequired, inventory.RebootRequiredPackages = readRebootRequired()
+	inventory.Temperatures = readTemperatures()
+
+	return inventory, nil
+}
+
+// GetPartitions returns the partitions mounted on the host and their free space
+func GetPartitions() ([]Partition, error) {
+	return readPartitions(), nil
+}
+
+// readPartitions returns the partitions mounted in the mount namespace of the host init process when the host
+// filesystem is mounted, the ones of the agent container otherwise
+func readPartitions() []Partition {
+	root := hostRoot
+	mountsPath := filepath.Join(hostRoot, "proc", "1", "mounts")
+	if _, err := os.Stat(mountsPath); err != nil {
+		root = "/"
+		mountsPath = filepath.Join(procPath, "mounts")
+	}
+
+	f, err := os.Open(mountsPath)
+	if err != nil {
+		return []Partition{}
+	}
+	defer f.Close()
+
+	partitions := []Partition{}
+	for _, mount := range parseMounts(f) {
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(filepath.Join(root, mount.mountPoint), &stat); err != nil {
+			continue
+		}
+
+		total := stat.Blocks * uint64(stat.Bsize)
+		free := stat.Bavail * uint64(stat.Bsize)
+		used := (stat.Blocks - stat.Bfree) * uint64(stat.Bsize)
+
+		partition := Partition{
+			Device:     mount.device,
+			MountPoint: mount.mountPoint,
+			FSType:     mount.fsType,
+			TotalBytes: total,
+			FreeBytes:  free,
+		}
+
+		// the blocks reserved to root are excluded, like df does
+		if used+free > 0 {
+			partition.UsedPercent = float64(used) * 100 / float64(used+free)
+		}
+
+		partitions = append(partitions, partition)
+	}
+
+	return partitions
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package inventory
+
+import "errors"
+
+// GetHostInventory is only supported on Linux hosts
+func GetHostInventory() (*HostInventory, error) {
+	return nil, errors.New("the host inventory is only available on Linux hosts")
+}
+
+// GetPartitions is only supported on Linux hosts
+func GetPartitions() ([]Partition, error) {
+	return nil, errors.New("the partitions are only available on Linux hosts")
+}
@@ -0,0 +1,98 @@
+package inventory
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseOSRelease(t *testing.T) {
+	content := `NAME="Ubuntu"
+VERSION_ID="22.04"
+# comment
+ID=ubuntu
+PRETTY_NAME="Ubuntu 22.04.3 LTS"
+`
+
+	info := parseOSRelease(strings.NewReader(content))
+
+	expected := OSInfo{ID: "ubuntu", Name: "Ubuntu 22.04.3 LTS", Version: "22.04"}
+	if info != expected {
+		t.Fatalf("expected %+v, got %+v", expected, info)
+	}
+}
+
+func TestParseUptime(t *testing.T) {
+	uptime, err := parseUptime("350735.47 234388.90\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uptime != 350735 {
+		t.Fatalf("expected an uptime of 350735 seconds, got %d", uptime)
+	}
+
+	if _, err := parseUptime(""); err == nil {
+		t.Fatal("expected an error for an empty uptime")
+	}
+}
+
+func TestParseMounts(t *testing.T) {
+	content := `sysfs /sys sysfs rw,nosuid,nodev,noexec,relatime 0 0
+proc /proc proc rw,nosuid,nodev,noexec,relatime 0 0
+/dev/mmcblk0p2 / ext4 rw,noatime 0 0
+/dev/mmcblk0p1 /boot/firmware vfat rw,relatime 0 0
+/dev/mmcblk0p2 /var/lib/docker ext4 rw,noatime 0 0
+/dev/sda1 /mnt/usb\040drive ext4 rw,relatime 0 0
+`
+
+	mounts := parseMounts(strings.NewReader(content))
+
+	expected := []mount{
+		{device: "/dev/mmcblk0p2", mountPoint: "/", fsType: "ext4"},
+		{device: "/dev/mmcblk0p1", mountPoint: "/boot/firmware", fsType: "vfat"},
+		{device: "/dev/sda1", mountPoint: "/mnt/usb drive", fsType: "ext4"},
+	}
+
+	if !reflect.DeepEqual(mounts, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, mounts)
+	}
+}
+
+func TestReadTemperatures(t *testing.T) {
+	thermalPath = t.TempDir()
+	defer func() { thermalPath = "/sys/class/thermal" }()
+
+	zone := filepath.Join(thermalPath, "thermal_zone0")
+	os.MkdirAll(zone, 0o755)
+	os.WriteFile(filepath.Join(zone, "type"), []byte("cpu-thermal\n"), 0o644)
+	os.WriteFile(filepath.Join(zone, "temp"), []byte("48312\n"), 0o644)
+
+	temperatures := readTemperatures()
+
+	if len(temperatures) != 1 || temperatures[0].Zone != "cpu-thermal" || temperatures[0].Celsius != 48.312 {
+		t.Fatalf("unexpected temperatures %+v", temperatures)
+	}
+}
+
+func TestHostInventory_Diagnostics(t *testing.T) {
+	inventory := &HostInventory{
+		Partitions: []Partition{
+			{Device: "/dev/mmcblk0p2", MountPoint: "/", UsedPercent: 95.2, FreeBytes: 1024},
+			{Device: "/dev/mmcblk0p1", MountPoint: "/boot/firmware", UsedPercent: 20},
+		},
+		RebootRequired: true,
+	}
+
+	diagnostics := inventory.Diagnostics()
+	if len(diagnostics) != 2 || !strings.Contains(diagnostics[0], "/dev/mmcblk0p2") {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+
+	var nilInventory *HostInventory
+	if nilInventory.Diagnostics() != nil {
+		t.Fatal("expected no diagnostics without inventory")
+	}
+}
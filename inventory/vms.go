@@ -0,0 +1,168 @@
+package inventory
+
+import (
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// States of the virtual machines, the state of a running domain is the one reported by libvirt (e.g. paused)
+const (
+	VMStateRunning = "running"
+	VMStateShutOff = "shut off"
+)
+
+var (
+	// libvirtConfigPath contains the definitions of the persistent QEMU/KVM domains and their autostart links
+	libvirtConfigPath = "/etc/libvirt/qemu"
+	// libvirtRunPath contains the status of the running QEMU/KVM domains, transient domains included
+	libvirtRunPath = "/run/libvirt/qemu"
+)
+
+// VirtualMachine represents a QEMU/KVM domain managed by libvirt on the host
+type VirtualMachine struct {
+	Name  string `json:"Name"`
+	UUID  string `json:"UUID"`
+	State string `json:"State"`
+	VCPUs int    `json:"VCPUs"`
+	// MemoryBytes is the memory currently allocated to the domain
+	MemoryBytes uint64 `json:"MemoryBytes"`
+	// MaxMemoryBytes is the memory the domain can be ballooned up to
+	MaxMemoryBytes uint64 `json:"MaxMemoryBytes"`
+	Autostart      bool   `json:"Autostart"`
+	// Persistent is false for the transient domains, which disappear once stopped
+	Persistent bool `json:"Persistent"`
+}
+
+// domain is the part of the libvirt domain XML reported by the agent
+type domain struct {
+	Name          string        `xml:"name"`
+	UUID          string        `xml:"uuid"`
+	Memory        domainMemory  `xml:"memory"`
+	CurrentMemory *domainMemory `xml:"currentMemory"`
+	VCPU          int           `xml:"vcpu"`
+}
+
+type domainMemory struct {
+	Unit  string `xml:"unit,attr"`
+	Value uint64 `xml:",chardata"`
+}
+
+// domainStatus is the status file libvirt keeps for a running domain
+type domainStatus struct {
+	State  string `xml:"state,attr"`
+	Domain domain `xml:"domain"`
+}
+
+// GetVirtualMachines returns the QEMU/KVM domains defined or running on the host, read from the libvirt files
+// through the host filesystem. It returns nil when libvirt is not installed.
+func GetVirtualMachines() ([]VirtualMachine, error) {
+	configPath := filepath.Join(hostRoot, libvirtConfigPath)
+	runPath := filepath.Join(hostRoot, libvirtRunPath)
+
+	if _, err := os.Stat(configPath); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	vms := map[string]*VirtualMachine{}
+
+	definitions, err := filepath.Glob(filepath.Join(configPath, "*.xml"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range definitions {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var d domain
+		if err := xml.Unmarshal(data, &d); err != nil {
+			continue
+		}
+
+		vm := newVirtualMachine(d, VMStateShutOff)
+		vm.Persistent = true
+
+		if _, err := os.Stat(filepath.Join(configPath, "autostart", filepath.Base(path))); err == nil {
+			vm.Autostart = true
+		}
+
+		vms[vm.Name] = vm
+	}
+
+	statuses, _ := filepath.Glob(filepath.Join(runPath, "*.xml"))
+	for _, path := range statuses {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		var status domainStatus
+		if err := xml.Unmarshal(data, &status); err != nil || status.Domain.Name == "" {
+			continue
+		}
+
+		vm := newVirtualMachine(status.Domain, status.State)
+		if defined, ok := vms[vm.Name]; ok {
+			vm.Persistent = true
+			vm.Autostart = defined.Autostart
+		}
+
+		vms[vm.Name] = vm
+	}
+
+	result := make([]VirtualMachine, 0, len(vms))
+	for _, vm := range vms {
+		result = append(result, *vm)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+
+	return result, nil
+}
+
+func newVirtualMachine(d domain, state string) *VirtualMachine {
+	if state == "" {
+		state = VMStateRunning
+	}
+
+	vm := &VirtualMachine{
+		Name:           d.Name,
+		UUID:           d.UUID,
+		State:          state,
+		VCPUs:          d.VCPU,
+		MaxMemoryBytes: d.Memory.bytes(),
+	}
+
+	vm.MemoryBytes = vm.MaxMemoryBytes
+	if d.CurrentMemory != nil {
+		vm.MemoryBytes = d.CurrentMemory.bytes()
+	}
+
+	return vm
+}
+
+// bytes returns the memory in bytes, libvirt defaults to KiB when the unit is omitted
+func (memory domainMemory) bytes() uint64 {
+	switch strings.ToLower(memory.Unit) {
+	case "b", "bytes":
+		return memory.Value
+	case "kb":
+		return memory.Value * 1000
+	case "mb":
+		return memory.Value * 1000 * 1000
+	case "m", "mib":
+		return memory.Value << 20
+	case "gb":
+		return memory.Value * 1000 * 1000 * 1000
+	case "g", "gib":
+		return memory.Value << 30
+	}
+
+	return memory.Value << 10
+}
@@ -0,0 +1,63 @@
+package inventory
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetVirtualMachines(t *testing.T) {
+	original := hostRoot
+	hostRoot = t.TempDir()
+	t.Cleanup(func() { hostRoot = original })
+
+	if vms, err := GetVirtualMachines(); err != nil || vms != nil {
+		t.Fatalf("expected no virtual machine without libvirt, got %v, %v", vms, err)
+	}
+
+	configPath := filepath.Join(hostRoot, libvirtConfigPath)
+	runPath := filepath.Join(hostRoot, libvirtRunPath)
+	for _, dir := range []string{filepath.Join(configPath, "autostart"), runPath} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := map[string]string{
+		filepath.Join(configPath, "router.xml"): `<domain type='kvm'><name>router</name><uuid>1</uuid><memory unit='KiB'>1048576</memory><currentMemory unit='KiB'>524288</currentMemory><vcpu placement='static'>2</vcpu></domain>`,
+		filepath.Join(configPath, "nvr.xml"):    `<domain type='kvm'><name>nvr</name><uuid>2</uuid><memory unit='GiB'>4</memory><vcpu>4</vcpu></domain>`,
+		filepath.Join(runPath, "router.xml"):    `<domstatus state='running' reason='booted' pid='42'><domain type='kvm' id='1'><name>router</name><uuid>1</uuid><memory unit='KiB'>1048576</memory><currentMemory unit='KiB'>524288</currentMemory><vcpu>2</vcpu></domain></domstatus>`,
+		filepath.Join(runPath, "scratch.xml"):   `<domstatus state='paused'><domain type='kvm'><name>scratch</name><uuid>3</uuid><memory>2048</memory><vcpu>1</vcpu></domain></domstatus>`,
+	}
+
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Symlink("../router.xml", filepath.Join(configPath, "autostart", "router.xml")); err != nil {
+		t.Fatal(err)
+	}
+
+	vms, err := GetVirtualMachines()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []VirtualMachine{
+		{Name: "nvr", UUID: "2", State: VMStateShutOff, VCPUs: 4, MemoryBytes: 4 << 30, MaxMemoryBytes: 4 << 30, Persistent: true},
+		{Name: "router", UUID: "1", State: VMStateRunning, VCPUs: 2, MemoryBytes: 512 << 20, MaxMemoryBytes: 1 << 30, Autostart: true, Persistent: true},
+		{Name: "scratch", UUID: "3", State: "paused", VCPUs: 1, MemoryBytes: 2 << 20, MaxMemoryBytes: 2 << 20},
+	}
+
+	if len(vms) != len(expected) {
+		t.Fatalf("expected %d virtual machines, got %+v", len(expected), vms)
+	}
+
+	for i := range expected {
+		if vms[i] != expected[i] {
+			t.Errorf("expected %+v, got %+v", expected[i], vms[i])
+		}
+	}
+}
@@ -0,0 +1,405 @@
+package journal
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent/faults"
+	"github.com/rs/zerolog/log"
+)
+
+// Types of the operations recorded in the journal
+const (
+	// TypeContainerRecreate is the replacement of a container by a container with an updated specification
+	TypeContainerRecreate = "container_recreate"
+	// TypeVolumeBackup is the archive of a volume while the containers mounting it are paused
+	TypeVolumeBackup = "volume_backup"
+	// TypeStackDeploy is the deployment of an Edge stack
+	TypeStackDeploy = "stack_deploy"
+)
+
+// Outcomes of the recovery of an interrupted operation
+const (
+	OutcomeResumed    = "resumed"
+	OutcomeRolledBack = "rolled_back"
+	OutcomeFailed     = "failed"
+)
+
+const (
+	// entryFileExtension is the extension of the files of the entries, the temporary files are ignored
+	entryFileExtension = ".json"
+	// maxRecoveryAttempts is the number of starts of the agent during which the recovery of an operation is
+	// attempted before it is dropped from the journal
+	maxRecoveryAttempts = 3
+	// reportRetention is the duration during which the recoveries are reported in the diagnostics
+	reportRetention = 24 * time.Hour
+)
+
+var (
+	defaultJournal   *Journal
+	defaultJournalMu sync.Mutex
+
+	recoverers   = map[string]RecoverFunc{}
+	recoverersMu sync.Mutex
+
+	recoveries   []Recovery
+	recoveriesMu sync.Mutex
+)
+
+// RecoverFunc resumes or rolls back an operation interrupted by a stop of the agent, from the last step recorded
+// in its entry. It returns OutcomeResumed or OutcomeRolledBack.
+type RecoverFunc func(ctx context.Context, entry Entry) (string, error)
+
+// Entry is an operation in progress recorded in the journal, it is removed once the operation completes
+type Entry struct {
+	ID       string `json:"ID"`
+	Type     string `json:"Type"`
+	Resource string `json:"Resource"`
+	// Step is the last step reached by the operation, empty until the first step
+	Step string `json:"Step,omitempty"`
+	// Data is the state required to resume or roll back the operation from its step
+	Data      json.RawMessage `json:"Data,omitempty"`
+	Attempts  int             `json:"Attempts,omitempty"`
+	StartedAt time.Time       `json:"StartedAt"`
+	UpdatedAt time.Time       `json:"UpdatedAt"`
+
+	journal *Journal
+}
+
+// Recovery is the outcome of the recovery of an interrupted operation
+type Recovery struct {
+	Type        string    `json:"Type"`
+	Resource    string    `json:"Resource"`
+	Step        string    `json:"Step,omitempty"`
+	Outcome     string    `json:"Outcome"`
+	Error       string    `json:"Error,omitempty"`
+	RecoveredAt time.Time `json:"RecoveredAt"`
+}
+
+// Journal persists the multi-step operations in progress, each entry is written before the step it describes is
+// executed so that the operations interrupted by a crash or a power loss can be recovered when the agent starts
+type Journal struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// Open returns a pointer to a Journal persisting its entries in dir, which is created when it does not exist
+func Open(dir string) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &Journal{dir: dir}, nil
+}
+
+// Begin records the start of an operation on resource, data is the state required to recover it before its
+// first step
+func (journal *Journal) Begin(opType, resource string, data interface{}) (*Entry, error) {
+	now := time.Now()
+
+	entry := &Entry{
+		ID:        newID(),
+		Type:      opType,
+		Resource:  resource,
+		StartedAt: now,
+		UpdatedAt: now,
+		journal:   journal,
+	}
+
+	if err := entry.setData(data); err != nil {
+		return nil, err
+	}
+
+	if err := journal.write(entry); err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// Advance records that the operation reached step, data replaces the state of the operation when it is not nil.
+// It does nothing on a nil entry, returned when the journal is not enabled.
+func (entry *Entry) Advance(step string, data interface{}) error {
+	if entry == nil {
+		return nil
+	}
+
+	if err := entry.setData(data); err != nil {
+		return err
+	}
+
+	entry.Step = step
+	entry.UpdatedAt = time.Now()
+
+	return entry.journal.write(entry)
+}
+
+// Complete removes the entry of an operation that completed, successfully or not, once its resources are
+// consistent. It does nothing on a nil entry.
+func (entry *Entry) Complete() {
+	if entry == nil {
+		return
+	}
+
+	if err := entry.journal.remove(entry.ID); err != nil {
+		log.Warn().Err(err).Str("type", entry.Type).Str("resource", entry.Resource).Msg("unable to remove the operation from the journal")
+	}
+}
+
+// Decode decodes the state of the operation into v
+func (entry Entry) Decode(v interface{}) error {
+	if len(entry.Data) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(entry.Data, v)
+}
+
+func (entry *Entry) setData(data interface{}) error {
+	if data == nil {
+		return nil
+	}
+
+	content, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	entry.Data = content
+
+	return nil
+}
+
+// Pending returns the operations recorded in the journal, sorted by start time
+func (journal *Journal) Pending() ([]Entry, error) {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+
+	files, err := os.ReadDir(journal.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []Entry{}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), entryFileExtension) {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(journal.dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(content, &entry); err != nil {
+			log.Warn().Err(err).Str("file", file.Name()).Msg("ignoring a corrupted entry of the operation journal")
+
+			continue
+		}
+
+		entry.journal = journal
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].StartedAt.Before(entries[j].StartedAt) })
+
+	return entries, nil
+}
+
+// Recover resumes or rolls back the operations left in the journal by a previous run of the agent, with the
+// function registered for their type, and returns the outcome of each recovery. The entries of the recovered
+// operations are removed, the failed recoveries are attempted again on the next starts of the agent.
+func (journal *Journal) Recover(ctx context.Context) []Recovery {
+	entries, err := journal.Pending()
+	if err != nil {
+		log.Error().Err(err).Msg("unable to read the operation journal")
+
+		return nil
+	}
+
+	result := []Recovery{}
+	for _, entry := range entries {
+		recovery := Recovery{
+			Type:        entry.Type,
+			Resource:    entry.Resource,
+			Step:        entry.Step,
+			RecoveredAt: time.Now(),
+		}
+
+		outcome, err := recoverEntry(ctx, entry)
+		recovery.Outcome = outcome
+
+		entry.Attempts++
+
+		switch {
+		case err == nil:
+			entry.Complete()
+		case entry.Attempts >= maxRecoveryAttempts:
+			recovery.Error = fmt.Sprintf("%s, the operation was dropped from the journal after %d attempts", err, entry.Attempts)
+
+			entry.Complete()
+		default:
+			recovery.Error = err.Error()
+
+			if err := journal.write(&entry); err != nil {
+				log.Warn().Err(err).Str("type", entry.Type).Msg("unable to record the recovery attempt in the journal")
+			}
+		}
+
+		log.Info().
+			Str("type", recovery.Type).
+			Str("resource", recovery.Resource).
+			Str("step", recovery.Step).
+			Str("outcome", recovery.Outcome).
+			Str("error", recovery.Error).
+			Msg("recovered an interrupted operation")
+
+		result = append(result, recovery)
+	}
+
+	recoveriesMu.Lock()
+	recoveries = result
+	recoveriesMu.Unlock()
+
+	return result
+}
+
+func recoverEntry(ctx context.Context, entry Entry) (string, error) {
+	recoverersMu.Lock()
+	fn, ok := recoverers[entry.Type]
+	recoverersMu.Unlock()
+
+	if !ok {
+		return OutcomeFailed, fmt.Errorf("no recovery is registered for the operations of type %s", entry.Type)
+	}
+
+	outcome, err := fn(ctx, entry)
+	if err != nil {
+		return OutcomeFailed, err
+	}
+
+	return outcome, nil
+}
+
+// write persists the entry in a temporary file synced to the disk before replacing the previous version of the
+// entry, a power loss leaves either version
+func (journal *Journal) write(entry *Entry) error {
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+
+	path := filepath.Join(journal.dir, entry.ID+entryFileExtension)
+
+	if err := faults.Fail(faults.DiskFull); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(journal.dir, entry.ID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+func (journal *Journal) remove(id string) error {
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+
+	err := os.Remove(filepath.Join(journal.dir, id+entryFileExtension))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+// Register sets the function recovering the interrupted operations of opType
+func Register(opType string, fn RecoverFunc) {
+	recoverersMu.Lock()
+	defer recoverersMu.Unlock()
+
+	recoverers[opType] = fn
+}
+
+// Enable makes journal the journal used by Begin
+func Enable(journal *Journal) {
+	defaultJournalMu.Lock()
+	defer defaultJournalMu.Unlock()
+
+	defaultJournal = journal
+}
+
+// Begin records the start of an operation in the default journal. A nil entry is returned when no journal is
+// enabled, the operation is not recorded.
+func Begin(opType, resource string, data interface{}) (*Entry, error) {
+	defaultJournalMu.Lock()
+	journal := defaultJournal
+	defaultJournalMu.Unlock()
+
+	if journal == nil {
+		return nil, nil
+	}
+
+	return journal.Begin(opType, resource, data)
+}
+
+// Diagnostics returns a diagnostic message for each operation recovered during the last day
+func Diagnostics() []string {
+	recoveriesMu.Lock()
+	defer recoveriesMu.Unlock()
+
+	diagnostics := []string{}
+	for _, recovery := range recoveries {
+		if time.Since(recovery.RecoveredAt) > reportRetention {
+			continue
+		}
+
+		message := fmt.Sprintf("interrupted operation %s of %s %s", recovery.Type, recovery.Resource, strings.ReplaceAll(recovery.Outcome, "_", " "))
+		if recovery.Error != "" {
+			message += ": " + recovery.Error
+		}
+
+		diagnostics = append(diagnostics, message)
+	}
+
+	return diagnostics
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,101 @@
+package journal
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestJournalRecover(t *testing.T) {
+	dir := t.TempDir()
+
+	journal, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type state struct {
+		Containers []string
+	}
+
+	entry, err := journal.Begin("test_rollback", "volume", state{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := entry.Advance("pausing", state{Containers: []string{"a", "b"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	completed, err := journal.Begin("test_rollback", "completed", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	completed.Complete()
+
+	if _, err := journal.Begin("test_failure", "stack", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var recovered state
+	Register("test_rollback", func(ctx context.Context, entry Entry) (string, error) {
+		if entry.Step != "pausing" {
+			t.Errorf("expected the step pausing, got %q", entry.Step)
+		}
+
+		return OutcomeRolledBack, entry.Decode(&recovered)
+	})
+	Register("test_failure", func(ctx context.Context, entry Entry) (string, error) {
+		return "", errors.New("unreachable daemon")
+	})
+
+	for attempt := 1; attempt <= maxRecoveryAttempts; attempt++ {
+		recoveries := journal.Recover(context.Background())
+
+		expected := 1
+		if attempt == 1 {
+			expected = 2
+		}
+
+		if len(recoveries) != expected {
+			t.Fatalf("expected %d recoveries on attempt %d, got %+v", expected, attempt, recoveries)
+		}
+
+		failure := recoveries[len(recoveries)-1]
+		if failure.Outcome != OutcomeFailed || failure.Error == "" {
+			t.Errorf("expected the recovery of the stack to fail, got %+v", failure)
+		}
+	}
+
+	if len(recovered.Containers) != 2 {
+		t.Errorf("expected the state of the last step to be recovered, got %+v", recovered)
+	}
+
+	pending, err := journal.Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pending) != 0 {
+		t.Errorf("expected the journal to be empty, got %+v", pending)
+	}
+
+	files, _ := os.ReadDir(dir)
+	if len(files) != 0 {
+		t.Errorf("expected no file left in the journal folder, got %d", len(files))
+	}
+}
+
+func TestNilEntry(t *testing.T) {
+	entry, err := Begin(TypeStackDeploy, "stack", nil)
+	if err != nil || entry != nil {
+		t.Fatalf("expected no entry when the journal is not enabled, got %+v, %v", entry, err)
+	}
+
+	if err := entry.Advance("step", nil); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	entry.Complete()
+}
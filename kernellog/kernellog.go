@@ -0,0 +1,314 @@
+package kernellog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// scanInterval is the duration during which the anomalies are reused, each scan runs a container on the host
+	scanInterval = 5 * time.Minute
+	// retention is the duration after which an anomaly that did not occur again is no longer reported
+	retention = 24 * time.Hour
+	// maxAnomalies bounds the number of anomalies reported, the most recent ones are kept
+	maxAnomalies = 50
+	// maxMessageLength bounds the length of the example message of an anomaly
+	maxMessageLength = 256
+)
+
+var (
+	// hostRoot is where the host filesystem is mounted in the agent container
+	hostRoot = agent.HostRoot
+	// binaryPaths are the folders of the host searched for journalctl
+	binaryPaths = []string{"/usr/local/sbin", "/usr/local/bin", "/usr/sbin", "/usr/bin", "/sbin", "/bin"}
+
+	procPath = "/proc"
+)
+
+var (
+	defaultService   *Service
+	defaultServiceMu sync.Mutex
+)
+
+// CommandRunner executes a command on the host and returns its output
+type CommandRunner func(ctx context.Context, cmd []string) ([]byte, error)
+
+// Anomaly groups the kernel messages revealing the same issue of the host
+type Anomaly struct {
+	Category string `json:"Category"`
+	Summary  string `json:"Summary"`
+	// Count is the number of messages of the anomaly in the last 24 hours
+	Count     int       `json:"Count"`
+	FirstSeen time.Time `json:"FirstSeen"`
+	LastSeen  time.Time `json:"LastSeen"`
+	// Message is the last kernel message of the anomaly
+	Message string `json:"Message"`
+}
+
+// entry is a message of the kernel ring buffer
+type entry struct {
+	time    time.Time
+	message string
+}
+
+// Service scans the kernel messages of the host for anomalies such as the OOM killer activations, the filesystem
+// errors and the USB disconnections. The messages are read with journalctl, or with dmesg on the hosts without
+// journald, and only the messages logged since the previous scan are processed.
+type Service struct {
+	run       CommandRunner
+	mu        sync.Mutex
+	anomalies map[string]*Anomaly
+	lastEntry time.Time
+	report    []Anomaly
+	checkedAt time.Time
+}
+
+// NewService returns a pointer to a Service executing journalctl or dmesg on the host with image, which must provide
+// nsenter
+func NewService(image string) *Service {
+	return &Service{
+		run: func(ctx context.Context, cmd []string) ([]byte, error) {
+			var output bytes.Buffer
+			err := docker.ExecHostCommand(ctx, image, cmd, &output)
+
+			return output.Bytes(), err
+		},
+		anomalies: map[string]*Anomaly{},
+	}
+}
+
+// Status returns the anomalies of the last 24 hours, most recent first. The kernel messages are scanned at most once
+// every five minutes.
+func (service *Service) Status(ctx context.Context) []Anomaly {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	if service.report != nil && time.Since(service.checkedAt) < scanInterval {
+		return service.report
+	}
+
+	entries, err := service.readEntries(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("unable to read the kernel messages of the host")
+	}
+
+	service.record(entries)
+	service.report = service.anomalyList(time.Now())
+	service.checkedAt = time.Now()
+
+	return service.report
+}
+
+func (service *Service) readEntries(ctx context.Context) ([]entry, error) {
+	if installed("journalctl") {
+		cmd := []string{"journalctl", "--dmesg", "--no-pager", "--quiet", "--output=short-unix"}
+		if !service.lastEntry.IsZero() {
+			cmd = append(cmd, "--since=@"+strconv.FormatInt(service.lastEntry.Unix(), 10))
+		}
+
+		output, err := service.run(ctx, cmd)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", err, bytes.TrimSpace(output))
+		}
+
+		return parseJournalctl(output), nil
+	}
+
+	output, err := service.run(ctx, []string{"dmesg"})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, bytes.TrimSpace(output))
+	}
+
+	return parseDmesg(output, bootTime()), nil
+}
+
+// record adds the anomalies of the entries logged after the previous scan
+func (service *Service) record(entries []entry) {
+	for _, e := range entries {
+		if !e.time.After(service.lastEntry) {
+			continue
+		}
+
+		service.lastEntry = e.time
+
+		category, summary, ok := match(e.message)
+		if !ok {
+			continue
+		}
+
+		message := e.message
+		if len(message) > maxMessageLength {
+			message = message[:maxMessageLength]
+		}
+
+		key := category + "\x00" + summary
+
+		anomaly, found := service.anomalies[key]
+		if !found {
+			anomaly = &Anomaly{Category: category, Summary: summary, FirstSeen: e.time}
+			service.anomalies[key] = anomaly
+		}
+
+		anomaly.Count++
+		anomaly.LastSeen = e.time
+		anomaly.Message = message
+	}
+}
+
+// anomalyList forgets the anomalies that did not occur during the retention and returns the most recent ones
+func (service *Service) anomalyList(now time.Time) []Anomaly {
+	anomalies := []Anomaly{}
+	for key, anomaly := range service.anomalies {
+		if now.Sub(anomaly.LastSeen) > retention {
+			delete(service.anomalies, key)
+
+			continue
+		}
+
+		anomalies = append(anomalies, *anomaly)
+	}
+
+	sort.Slice(anomalies, func(i, j int) bool { return anomalies[i].LastSeen.After(anomalies[j].LastSeen) })
+
+	if len(anomalies) > maxAnomalies {
+		anomalies = anomalies[:maxAnomalies]
+	}
+
+	return anomalies
+}
+
+// parseJournalctl parses the output of journalctl --output=short-unix, e.g.
+// 1709632800.123456 edge-01 kernel: Out of memory: Killed process 1234 (java)
+func parseJournalctl(output []byte) []entry {
+	var entries []entry
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		timestamp, rest, found := strings.Cut(scanner.Text(), " ")
+		if !found {
+			continue
+		}
+
+		seconds, err := strconv.ParseFloat(timestamp, 64)
+		if err != nil {
+			continue
+		}
+
+		_, message, found := strings.Cut(rest, "kernel: ")
+		if !found {
+			continue
+		}
+
+		entries = append(entries, entry{time: unixTime(seconds), message: message})
+	}
+
+	return entries
+}
+
+// parseDmesg parses the output of dmesg, whose messages are prefixed with the seconds elapsed since the boot, e.g.
+// [  123.456789] usb 1-1.2: USB disconnect, device number 3
+func parseDmesg(output []byte, boot time.Time) []entry {
+	var entries []entry
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "[") {
+			continue
+		}
+
+		uptime, message, found := strings.Cut(line[1:], "] ")
+		if !found {
+			continue
+		}
+
+		seconds, err := strconv.ParseFloat(strings.TrimSpace(uptime), 64)
+		if err != nil {
+			continue
+		}
+
+		entries = append(entries, entry{time: boot.Add(time.Duration(seconds * float64(time.Second))), message: message})
+	}
+
+	return entries
+}
+
+func unixTime(seconds float64) time.Time {
+	whole, fraction := math.Modf(seconds)
+
+	return time.Unix(int64(whole), int64(fraction*1e9)).UTC()
+}
+
+// bootTime returns the boot time of the host, read from /proc/stat which reports it for the whole kernel
+func bootTime() time.Time {
+	content, err := os.ReadFile(filepath.Join(procPath, "stat"))
+	if err != nil {
+		return time.Time{}
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		if value, found := strings.CutPrefix(line, "btime "); found {
+			if seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+				return time.Unix(seconds, 0).UTC()
+			}
+		}
+	}
+
+	return time.Time{}
+}
+
+func installed(binary string) bool {
+	for _, path := range binaryPaths {
+		if _, err := os.Stat(filepath.Join(hostRoot, path, binary)); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Enable makes service the default service used by CurrentStatus
+func Enable(service *Service) {
+	defaultServiceMu.Lock()
+	defer defaultServiceMu.Unlock()
+
+	defaultService = service
+}
+
+// CurrentStatus returns the anomalies reported by the default service, nil when no service is enabled
+func CurrentStatus(ctx context.Context) []Anomaly {
+	defaultServiceMu.Lock()
+	service := defaultService
+	defaultServiceMu.Unlock()
+
+	if service == nil {
+		return nil
+	}
+
+	return service.Status(ctx)
+}
+
+// Diagnostics returns a diagnostic message for each anomaly
+func Diagnostics(anomalies []Anomaly) []string {
+	var diagnostics []string
+	for _, anomaly := range anomalies {
+		diagnostics = append(diagnostics, fmt.Sprintf("kernel %s anomaly: %s, %d times in the last 24 hours (last at %s)", anomaly.Category, anomaly.Summary, anomaly.Count, anomaly.LastSeen.Format(time.RFC3339)))
+	}
+
+	return diagnostics
+}
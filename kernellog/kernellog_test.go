@@ -0,0 +1,97 @@
+package kernellog
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		message  string
+		category string
+		summary  string
+	}{
+		{"Out of memory: Killed process 1234 (java) total-vm:4096kB, anon-rss:2048kB", CategoryOOM, "the OOM killer killed java"},
+		{"Memory cgroup out of memory: Killed process 42 (node) total-vm:1024kB", CategoryOOM, "the OOM killer killed node"},
+		{"EXT4-fs error (device mmcblk0p2): ext4_find_entry:1455: inode #2: comm ls: reading directory lblock 0", CategoryFilesystem, "EXT4-fs error on mmcblk0p2"},
+		{"XFS (sda1): Metadata corruption detected at xfs_buf_ioend+0x50/0x110", CategoryFilesystem, "XFS error on sda1"},
+		{"EXT4-fs (sda1): Remounting filesystem read-only", CategoryFilesystem, "the filesystem of sda1 was remounted read-only"},
+		{"blk_update_request: I/O error, dev sdb, sector 2048 op 0x0:(READ)", CategoryIO, "I/O error on sdb"},
+		{"usb 1-1.2: USB disconnect, device number 3", CategoryUSB, "USB device disconnected from port 1-1.2"},
+		{"INFO: task dockerd:812 blocked for more than 120 seconds.", CategoryHungTask, "the task dockerd was blocked"},
+		{"Oops: 0000 [#1] SMP", CategoryKernelBug, "kernel bug or oops"},
+		{"mce: [Hardware Error]: Machine check events logged", CategoryHardware, "hardware error reported by the CPU or the memory controller"},
+		{"hwmon hwmon1: Undervoltage detected!", CategoryPower, "under-voltage detected"},
+	}
+
+	for _, test := range tests {
+		category, summary, ok := match(test.message)
+		if !ok || category != test.category || summary != test.summary {
+			t.Errorf("unexpected anomaly %q %q for the message %q", category, summary, test.message)
+		}
+	}
+
+	if _, _, ok := match("usb 1-1.2: new high-speed USB device number 4 using xhci_hcd"); ok {
+		t.Error("expected a regular message not to be an anomaly")
+	}
+}
+
+func TestParseJournalctl(t *testing.T) {
+	output := `1709632800.500000 edge-01 kernel: usb 1-1.2: USB disconnect, device number 3
+-- Boot 1a2b3c --
+1709632801.000000 edge-01 kernel: Out of memory: Killed process 1234 (java)
+`
+
+	expected := []entry{
+		{time: time.Date(2024, 3, 5, 10, 0, 0, 500000000, time.UTC), message: "usb 1-1.2: USB disconnect, device number 3"},
+		{time: time.Date(2024, 3, 5, 10, 0, 1, 0, time.UTC), message: "Out of memory: Killed process 1234 (java)"},
+	}
+	if entries := parseJournalctl([]byte(output)); !reflect.DeepEqual(entries, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, entries)
+	}
+}
+
+func TestParseDmesg(t *testing.T) {
+	boot := time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC)
+	output := `[    0.000000] Booting Linux on physical CPU 0x0
+[  120.250000] EXT4-fs (sda1): Remounting filesystem read-only
+`
+
+	entries := parseDmesg([]byte(output), boot)
+	if len(entries) != 2 || !entries[1].time.Equal(boot.Add(120250*time.Millisecond)) || entries[1].message != "EXT4-fs (sda1): Remounting filesystem read-only" {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	now := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	service := &Service{anomalies: map[string]*Anomaly{}}
+
+	service.record([]entry{
+		{time: now.Add(-30 * time.Hour), message: "usb 1-1: USB disconnect, device number 2"},
+		{time: now.Add(-2 * time.Hour), message: "Out of memory: Killed process 1 (java)"},
+		{time: now.Add(-time.Hour), message: "Out of memory: Killed process 2 (java)"},
+	})
+
+	// the entries already processed are ignored when the scans overlap
+	service.record([]entry{
+		{time: now.Add(-time.Hour), message: "Out of memory: Killed process 2 (java)"},
+		{time: now.Add(-time.Minute), message: "I/O error, dev sda, sector 0"},
+	})
+
+	anomalies := service.anomalyList(now)
+	if len(anomalies) != 2 {
+		t.Fatalf("expected the USB disconnection to be forgotten, got %+v", anomalies)
+	}
+
+	if anomalies[0].Category != CategoryIO || anomalies[1].Count != 2 || !anomalies[1].FirstSeen.Equal(now.Add(-2*time.Hour)) {
+		t.Fatalf("unexpected anomalies %+v", anomalies)
+	}
+
+	diagnostics := Diagnostics(anomalies[1:])
+	if len(diagnostics) != 1 || !strings.HasPrefix(diagnostics[0], "kernel oom anomaly: the OOM killer killed java, 2 times in the last 24 hours") {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+}
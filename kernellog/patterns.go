@@ -0,0 +1,93 @@
+package kernellog
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Categories of the anomalies
+const (
+	CategoryOOM        = "oom"
+	CategoryFilesystem = "filesystem"
+	CategoryIO         = "io"
+	CategoryUSB        = "usb"
+	CategoryHungTask   = "hungTask"
+	CategoryKernelBug  = "kernelBug"
+	CategoryHardware   = "hardware"
+	CategoryPower      = "power"
+)
+
+// pattern matches a kernel message revealing an anomaly, summarize returns the summary of the anomaly from the
+// submatches of regexp so that the repeated messages of the same anomaly are grouped
+type pattern struct {
+	category  string
+	regexp    *regexp.Regexp
+	summarize func(match []string) string
+}
+
+var patterns = []pattern{
+	{
+		category:  CategoryOOM,
+		regexp:    regexp.MustCompile(`[Oo]ut of memory: Kill(?:ed)? process \d+ \(([^)]+)\)`),
+		summarize: func(match []string) string { return fmt.Sprintf("the OOM killer killed %s", match[1]) },
+	},
+	{
+		category:  CategoryFilesystem,
+		regexp:    regexp.MustCompile(`^(EXT[234]-fs|BTRFS|F2FS-fs|FAT-fs) error \(device ([^)]+)\)`),
+		summarize: func(match []string) string { return fmt.Sprintf("%s error on %s", match[1], match[2]) },
+	},
+	{
+		category:  CategoryFilesystem,
+		regexp:    regexp.MustCompile(`^XFS \(([^)]+)\): .*(?:[Cc]orruption|I/O error|[Ss]hut(?:ting)? down)`),
+		summarize: func(match []string) string { return fmt.Sprintf("XFS error on %s", match[1]) },
+	},
+	{
+		category: CategoryFilesystem,
+		regexp:   regexp.MustCompile(`\(([^)]+)\): [Rr]emounting filesystem read-only`),
+		summarize: func(match []string) string {
+			return fmt.Sprintf("the filesystem of %s was remounted read-only", match[1])
+		},
+	},
+	{
+		category:  CategoryIO,
+		regexp:    regexp.MustCompile(`I/O error, dev ([A-Za-z0-9]+)`),
+		summarize: func(match []string) string { return fmt.Sprintf("I/O error on %s", match[1]) },
+	},
+	{
+		category:  CategoryUSB,
+		regexp:    regexp.MustCompile(`usb (\d+-[\d.]+): USB disconnect`),
+		summarize: func(match []string) string { return fmt.Sprintf("USB device disconnected from port %s", match[1]) },
+	},
+	{
+		category:  CategoryHungTask,
+		regexp:    regexp.MustCompile(`task (\S+?):\d+ blocked for more than \d+ seconds`),
+		summarize: func(match []string) string { return fmt.Sprintf("the task %s was blocked", match[1]) },
+	},
+	{
+		category:  CategoryKernelBug,
+		regexp:    regexp.MustCompile(`^(?:BUG: |kernel BUG at |Oops: |general protection fault|Kernel panic)`),
+		summarize: func(match []string) string { return "kernel bug or oops" },
+	},
+	{
+		category:  CategoryHardware,
+		regexp:    regexp.MustCompile(`\[Hardware Error\]|EDAC .* error`),
+		summarize: func(match []string) string { return "hardware error reported by the CPU or the memory controller" },
+	},
+	{
+		category:  CategoryPower,
+		regexp:    regexp.MustCompile(`[Uu]nder-?voltage detected`),
+		summarize: func(match []string) string { return "under-voltage detected" },
+	},
+}
+
+// match returns the category and the summary of the anomaly revealed by message, ok is false when message is not
+// an anomaly
+func match(message string) (category, summary string, ok bool) {
+	for _, p := range patterns {
+		if submatches := p.regexp.FindStringSubmatch(message); submatches != nil {
+			return p.category, p.summarize(submatches), true
+		}
+	}
+
+	return "", "", false
+}
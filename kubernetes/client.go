@@ -1,9 +1,19 @@
 package kubernetes
 
 import (
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
 
+	"github.com/portainer/agent"
+
+	"gopkg.in/yaml.v3"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -30,8 +40,157 @@ func NewKubeClient() (*KubeClient, error) {
 	return kubeCli, nil
 }
 
+// KubeconfigAuto is the kubeconfig path selecting the kubeconfig of the Kubernetes distribution installed on the host
+const KubeconfigAuto = "auto"
+
+var (
+	// kubeconfigRESTConfig is the configuration loaded by UseKubeconfig, the in-cluster configuration is used when nil
+	kubeconfigRESTConfig *rest.Config
+	kubeconfigMu         sync.RWMutex
+)
+
+// UseKubeconfig makes the agent manage the cluster of the kubeconfig at path instead of the cluster it runs in, so
+// that an agent running on the Docker platform also manages a Kubernetes cluster running on the same host. The
+// kubeconfig of the distribution installed on the host is used when path is KubeconfigAuto.
+func UseKubeconfig(path string) error {
+	if path == KubeconfigAuto {
+		distribution := DetectHostDistribution()
+		if distribution == nil {
+			return errors.New("no Kubernetes distribution was found on the host")
+		}
+
+		path = filepath.Join(agent.HostRoot, distribution.KubeconfigPath)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	config, err := parseKubeconfig(data)
+	if err != nil {
+		return fmt.Errorf("invalid kubeconfig %s: %w", path, err)
+	}
+
+	kubeconfigMu.Lock()
+	kubeconfigRESTConfig = config
+	kubeconfigMu.Unlock()
+
+	return nil
+}
+
+// UsesKubeconfig returns true when the cluster is accessed through the kubeconfig loaded by UseKubeconfig
+func UsesKubeconfig() bool {
+	kubeconfigMu.RLock()
+	defer kubeconfigMu.RUnlock()
+
+	return kubeconfigRESTConfig != nil
+}
+
+// KubeconfigTransport returns the URL of the API server of the kubeconfig loaded by UseKubeconfig, and a transport
+// authenticated with the credentials of the kubeconfig
+func KubeconfigTransport() (*url.URL, http.RoundTripper, error) {
+	kubeconfigMu.RLock()
+	config := kubeconfigRESTConfig
+	kubeconfigMu.RUnlock()
+
+	if config == nil {
+		return nil, nil, errors.New("no kubeconfig is loaded")
+	}
+
+	apiURL, err := url.Parse(config.Host)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	transport, err := rest.TransportFor(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return apiURL, transport, nil
+}
+
+// restConfig returns the configuration of the kubeconfig loaded by UseKubeconfig, or the in-cluster configuration
+func restConfig() (*rest.Config, error) {
+	kubeconfigMu.RLock()
+	defer kubeconfigMu.RUnlock()
+
+	if kubeconfigRESTConfig != nil {
+		return rest.CopyConfig(kubeconfigRESTConfig), nil
+	}
+
+	return rest.InClusterConfig()
+}
+
+// parseKubeconfig returns the configuration of the current context of a kubeconfig, the credentials are expected
+// to be embedded as it is the case with the kubeconfigs generated by k3s, RKE2 and MicroK8s
+func parseKubeconfig(data []byte) (*rest.Config, error) {
+	var file kubeconfigFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	kubeContext := kubeconfigContext{}
+	for _, c := range file.Contexts {
+		if c.Name == file.CurrentContext {
+			kubeContext = c
+		}
+	}
+
+	// a kubeconfig without context usually has a single cluster and user
+	if kubeContext.Context.Cluster == "" && len(file.Clusters) == 1 && len(file.Users) == 1 {
+		kubeContext.Context.Cluster = file.Clusters[0].Name
+		kubeContext.Context.User = file.Users[0].Name
+	}
+
+	config := &rest.Config{}
+
+	found := false
+	for _, cluster := range file.Clusters {
+		if cluster.Name != kubeContext.Context.Cluster {
+			continue
+		}
+
+		found = true
+		config.Host = cluster.Cluster.Server
+
+		caData, err := base64.StdEncoding.DecodeString(cluster.Cluster.CertificateAuthorityData)
+		if err != nil {
+			return nil, err
+		}
+		config.TLSClientConfig.CAData = caData
+	}
+
+	if !found || config.Host == "" {
+		return nil, errors.New("the cluster of the current context was not found")
+	}
+
+	for _, user := range file.Users {
+		if user.Name != kubeContext.Context.User {
+			continue
+		}
+
+		certData, err := base64.StdEncoding.DecodeString(user.User.ClientCertificateData)
+		if err != nil {
+			return nil, err
+		}
+
+		keyData, err := base64.StdEncoding.DecodeString(user.User.ClientKeyData)
+		if err != nil {
+			return nil, err
+		}
+
+		config.BearerToken = user.User.Token
+		config.TLSClientConfig.CertData = certData
+		config.TLSClientConfig.KeyData = keyData
+	}
+
+	return config, nil
+}
+
 func buildLocalClient() (*kubernetes.Clientset, error) {
-	config, err := rest.InClusterConfig()
+	config, err := restConfig()
 	if err != nil {
 		return nil, err
 	}
@@ -42,9 +201,9 @@ func buildLocalClient() (*kubernetes.Clientset, error) {
 // StartExecProcess will start an exec process inside a container located inside a pod inside a specific namespace
 // using the specified command. The stdin parameter will be bound to the stdin process and the stdout process will write
 // to the stdout parameter.
-// This function only works against a local endpoint using an in-cluster config.
+// This function only works against a local endpoint using an in-cluster config or the kubeconfig loaded by UseKubeconfig.
 func (kcl *KubeClient) StartExecProcess(token, namespace, podName, containerName string, command []string, stdin io.Reader, stdout io.Writer) error {
-	config, err := rest.InClusterConfig()
+	config, err := restConfig()
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,41 @@
+package kubernetes
+
+import (
+	"testing"
+)
+
+func TestParseKubeconfig(t *testing.T) {
+	// kubeconfig generated by k3s, the credentials are embedded
+	data := []byte(`apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    certificate-authority-data: Y2E=
+    server: https://127.0.0.1:6443
+  name: default
+contexts:
+- context:
+    cluster: default
+    user: default
+  name: default
+current-context: default
+users:
+- name: default
+  user:
+    client-certificate-data: Y2VydA==
+    client-key-data: a2V5
+`)
+
+	config, err := parseKubeconfig(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Host != "https://127.0.0.1:6443" || string(config.CAData) != "ca" || string(config.CertData) != "cert" || string(config.KeyData) != "key" {
+		t.Fatalf("unexpected configuration %+v", config)
+	}
+
+	if _, err := parseKubeconfig([]byte(`current-context: missing`)); err == nil {
+		t.Fatal("expected a kubeconfig without cluster to be refused")
+	}
+}
@@ -0,0 +1,221 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Statuses of the etcd check of the API server
+const (
+	EtcdStatusOK      = "ok"
+	EtcdStatusFailed  = "failed"
+	EtcdStatusUnknown = "unknown"
+)
+
+const (
+	// slowAPIServerLatency is the duration of the readiness check from which the API server is reported as degraded
+	slowAPIServerLatency = time.Second
+	// controlPlaneLabel and masterLabel are the labels of the control plane nodes, k3s still sets the master label
+	controlPlaneLabel = "node-role.kubernetes.io/control-plane"
+	masterLabel       = "node-role.kubernetes.io/master"
+	// etcdNoLeaderReason is the reason of the health of an etcd member that lost its leader
+	etcdNoLeaderReason = "RAFT NO LEADER"
+)
+
+// ControlPlaneHealth represents the health of the control plane of the cluster, as seen from the agent
+type ControlPlaneHealth struct {
+	// Degraded is true when the API server is slow or not ready, or when a component or a control plane node is not
+	// healthy
+	Degraded bool `json:"Degraded"`
+	// APIServerLatencyMs is the duration of the readiness check of the API server
+	APIServerLatencyMs int64 `json:"APIServerLatencyMs"`
+	APIServerReady     bool  `json:"APIServerReady"`
+	// APIServerError is the error of the readiness check when the API server could not be reached
+	APIServerError string `json:"APIServerError,omitempty"`
+	// FailedChecks are the readiness checks of the API server that failed
+	FailedChecks []string `json:"FailedChecks"`
+	// Etcd is the status of the etcd check of the API server, unknown when the API server does not report it
+	Etcd string `json:"Etcd"`
+	// Components are the scheduler, the controller manager and the etcd members, on the clusters still reporting
+	// the component statuses
+	Components        []ComponentHealth  `json:"Components,omitempty"`
+	ControlPlaneNodes []ControlPlaneNode `json:"ControlPlaneNodes"`
+}
+
+// ComponentHealth represents the health of a component of the control plane
+type ComponentHealth struct {
+	Name    string `json:"Name"`
+	Healthy bool   `json:"Healthy"`
+	Message string `json:"Message,omitempty"`
+	// NoLeader is true for an etcd member that lost its leader
+	NoLeader bool `json:"NoLeader,omitempty"`
+}
+
+// ControlPlaneNode represents the readiness of a control plane node
+type ControlPlaneNode struct {
+	Name  string `json:"Name"`
+	Ready bool   `json:"Ready"`
+}
+
+// GetControlPlaneHealth probes the readiness checks of the API server, the component statuses and the control plane
+// nodes. The probes the agent is not allowed to run are left out of the report.
+func GetControlPlaneHealth(ctx context.Context) (*ControlPlaneHealth, error) {
+	cli, err := buildLocalClient()
+	if err != nil {
+		return nil, err
+	}
+
+	health := &ControlPlaneHealth{
+		FailedChecks:      []string{},
+		Etcd:              EtcdStatusUnknown,
+		ControlPlaneNodes: []ControlPlaneNode{},
+	}
+
+	start := time.Now()
+	data, err := cli.RESTClient().Get().AbsPath("/readyz").Param("verbose", "true").DoRaw(ctx)
+	health.APIServerLatencyMs = time.Since(start).Milliseconds()
+
+	// the API server answers with the status of each check when it is not ready, along with an error
+	health.APIServerReady = err == nil
+	if err != nil && len(data) == 0 {
+		health.APIServerError = err.Error()
+	}
+	health.FailedChecks, health.Etcd = parseReadinessChecks(string(data))
+
+	// the component statuses are deprecated, they are not available on every cluster
+	componentStatuses, err := cli.CoreV1().ComponentStatuses().List(ctx, metav1.ListOptions{})
+	if err == nil {
+		health.Components = componentHealths(componentStatuses.Items)
+	}
+
+	nodes, err := cli.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	health.ControlPlaneNodes = controlPlaneNodes(nodes.Items)
+
+	health.Degraded = health.isDegraded()
+
+	return health, nil
+}
+
+func (health *ControlPlaneHealth) isDegraded() bool {
+	if !health.APIServerReady || health.APIServerLatencyMs >= slowAPIServerLatency.Milliseconds() || health.Etcd == EtcdStatusFailed {
+		return true
+	}
+
+	for _, component := range health.Components {
+		if !component.Healthy {
+			return true
+		}
+	}
+
+	for _, node := range health.ControlPlaneNodes {
+		if !node.Ready {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseReadinessChecks returns the failed checks of the verbose output of the readiness endpoint of the API server,
+// made of lines such as "[+]etcd ok" and "[-]etcd failed: reason withheld", and the status of its etcd check
+func parseReadinessChecks(output string) ([]string, string) {
+	failed := []string{}
+	etcd := EtcdStatusUnknown
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) < 4 || line[0] != '[' || line[2] != ']' {
+			continue
+		}
+
+		ok := line[1] == '+'
+		name, _, _ := strings.Cut(line[3:], " ")
+
+		if !ok {
+			failed = append(failed, name)
+		}
+
+		// the etcd check is the connectivity to etcd, etcd-readiness its readiness on recent versions
+		if name == "etcd" || name == "etcd-readiness" {
+			if !ok {
+				etcd = EtcdStatusFailed
+			} else if etcd == EtcdStatusUnknown {
+				etcd = EtcdStatusOK
+			}
+		}
+	}
+
+	return failed, etcd
+}
+
+func componentHealths(componentStatuses []v1.ComponentStatus) []ComponentHealth {
+	components := make([]ComponentHealth, 0, len(componentStatuses))
+
+	for _, componentStatus := range componentStatuses {
+		component := ComponentHealth{Name: componentStatus.Name}
+
+		for _, condition := range componentStatus.Conditions {
+			if condition.Type != v1.ComponentHealthy {
+				continue
+			}
+
+			component.Healthy = condition.Status == v1.ConditionTrue
+			component.Message = condition.Message
+			if condition.Error != "" {
+				component.Message = condition.Error
+			}
+		}
+
+		// the message of an etcd member is the output of its health endpoint, e.g. {"health":"false","reason":"RAFT NO LEADER"}
+		var etcdHealth struct {
+			Reason string `json:"reason"`
+		}
+		if json.Unmarshal([]byte(component.Message), &etcdHealth) == nil && etcdHealth.Reason == etcdNoLeaderReason {
+			component.NoLeader = true
+		}
+
+		components = append(components, component)
+	}
+
+	sort.Slice(components, func(i, j int) bool {
+		return components[i].Name < components[j].Name
+	})
+
+	return components
+}
+
+func controlPlaneNodes(nodes []v1.Node) []ControlPlaneNode {
+	controlPlane := []ControlPlaneNode{}
+
+	for _, node := range nodes {
+		_, isControlPlane := node.Labels[controlPlaneLabel]
+		_, isMaster := node.Labels[masterLabel]
+		if !isControlPlane && !isMaster {
+			continue
+		}
+
+		ready := false
+		for _, condition := range node.Status.Conditions {
+			if condition.Type == v1.NodeReady {
+				ready = condition.Status == v1.ConditionTrue
+			}
+		}
+
+		controlPlane = append(controlPlane, ControlPlaneNode{Name: node.Name, Ready: ready})
+	}
+
+	sort.Slice(controlPlane, func(i, j int) bool {
+		return controlPlane[i].Name < controlPlane[j].Name
+	})
+
+	return controlPlane
+}
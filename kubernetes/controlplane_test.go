@@ -0,0 +1,84 @@
+package kubernetes
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseReadinessChecks(t *testing.T) {
+	output := `[+]ping ok
+[+]log ok
+[-]etcd failed: reason withheld
+[+]etcd-readiness ok
+[+]informer-sync ok
+[-]poststarthook/start-apiextensions-controllers failed: reason withheld
+readyz check failed`
+
+	failed, etcd := parseReadinessChecks(output)
+
+	if !reflect.DeepEqual(failed, []string{"etcd", "poststarthook/start-apiextensions-controllers"}) {
+		t.Fatalf("unexpected failed checks %v", failed)
+	}
+
+	if etcd != EtcdStatusFailed {
+		t.Fatalf("expected the etcd check to have failed, got %s", etcd)
+	}
+
+	failed, etcd = parseReadinessChecks("[+]ping ok\n[+]etcd ok\nreadyz check passed")
+	if len(failed) != 0 || etcd != EtcdStatusOK {
+		t.Fatalf("expected a ready API server, got %v, %s", failed, etcd)
+	}
+
+	_, etcd = parseReadinessChecks("[+]ping ok\nreadyz check passed")
+	if etcd != EtcdStatusUnknown {
+		t.Fatalf("expected an unknown etcd status without etcd check, got %s", etcd)
+	}
+}
+
+func TestComponentHealths(t *testing.T) {
+	components := componentHealths([]v1.ComponentStatus{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "scheduler"},
+			Conditions: []v1.ComponentCondition{{Type: v1.ComponentHealthy, Status: v1.ConditionTrue, Message: "ok"}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "etcd-0"},
+			Conditions: []v1.ComponentCondition{{Type: v1.ComponentHealthy, Status: v1.ConditionFalse, Message: `{"health":"false","reason":"RAFT NO LEADER"}`}},
+		},
+	})
+
+	if len(components) != 2 || components[0].Name != "etcd-0" || components[0].Healthy || !components[0].NoLeader {
+		t.Fatalf("expected etcd-0 to be reported without leader, got %+v", components)
+	}
+
+	if !components[1].Healthy || components[1].NoLeader {
+		t.Fatalf("expected the scheduler to be healthy, got %+v", components[1])
+	}
+}
+
+func TestControlPlaneHealth_IsDegraded(t *testing.T) {
+	health := &ControlPlaneHealth{
+		APIServerReady:     true,
+		APIServerLatencyMs: 20,
+		Etcd:               EtcdStatusOK,
+		ControlPlaneNodes:  []ControlPlaneNode{{Name: "server-0", Ready: true}},
+	}
+
+	if health.isDegraded() {
+		t.Fatal("expected a healthy control plane")
+	}
+
+	health.APIServerLatencyMs = 2500
+	if !health.isDegraded() {
+		t.Fatal("expected a slow API server to degrade the control plane")
+	}
+
+	health.APIServerLatencyMs = 20
+	health.ControlPlaneNodes[0].Ready = false
+	if !health.isDegraded() {
+		t.Fatal("expected a control plane node not ready to degrade the control plane")
+	}
+}
@@ -0,0 +1,268 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/portainer/agent"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Kubernetes distributions detected by the agent
+const (
+	DistributionK3s      = "k3s"
+	DistributionRKE2     = "rke2"
+	DistributionMicroK8s = "microk8s"
+	// DistributionKubernetes is any other distribution, usually deployed with kubeadm
+	DistributionKubernetes = "kubernetes"
+)
+
+const (
+	// k3sInstanceType is the instance type k3s sets on its nodes when no cloud provider is configured
+	k3sInstanceType = "k3s"
+	// microK8sClusterLabel is the label MicroK8s sets on its nodes
+	microK8sClusterLabel = "microk8s.io/cluster"
+	// k3sAddonsPath and helmChartsPath are the bundled manifests and Helm charts deployed by k3s and RKE2
+	k3sAddonsPath  = "/apis/k3s.cattle.io/v1/namespaces/kube-system/addons"
+	helmChartsPath = "/apis/helm.cattle.io/v1/namespaces/kube-system/helmcharts"
+)
+
+// Distribution represents the Kubernetes distribution of the cluster and its defaults on the hosts
+type Distribution struct {
+	Name string `json:"Name"`
+	// Version is the version of the kubelet, e.g. v1.27.4+k3s1
+	Version string `json:"Version,omitempty"`
+	// Addons are the bundled components enabled in the cluster, only reported for k3s, RKE2 and MicroK8s
+	Addons []string `json:"Addons,omitempty"`
+	// ServiceName is the service running Kubernetes on the hosts
+	ServiceName string `json:"ServiceName"`
+	// RestartCommand is the command restarting Kubernetes on the host
+	RestartCommand []string `json:"-"`
+	// KubeconfigPath is the path of the admin kubeconfig on the control plane hosts
+	KubeconfigPath   string `json:"KubeconfigPath"`
+	ContainerdSocket string `json:"ContainerdSocket"`
+	// LocalStoragePath is the folder of the volumes of the bundled local storage provisioner, if any
+	LocalStoragePath string `json:"LocalStoragePath,omitempty"`
+}
+
+// distributionDefaults are the defaults of the distributions on the hosts
+var distributionDefaults = map[string]Distribution{
+	DistributionK3s: {
+		ServiceName:      "k3s",
+		RestartCommand:   []string{"systemctl", "restart", "k3s"},
+		KubeconfigPath:   "/etc/rancher/k3s/k3s.yaml",
+		ContainerdSocket: "/run/k3s/containerd/containerd.sock",
+		LocalStoragePath: "/var/lib/rancher/k3s/storage",
+	},
+	DistributionRKE2: {
+		ServiceName:      "rke2-server",
+		RestartCommand:   []string{"systemctl", "restart", "rke2-server"},
+		KubeconfigPath:   "/etc/rancher/rke2/rke2.yaml",
+		ContainerdSocket: "/run/k3s/containerd/containerd.sock",
+	},
+	DistributionMicroK8s: {
+		ServiceName:      "snap.microk8s.daemon-kubelite",
+		RestartCommand:   []string{"snap", "restart", "microk8s"},
+		KubeconfigPath:   "/var/snap/microk8s/current/credentials/client.config",
+		ContainerdSocket: "/var/snap/microk8s/common/run/containerd.sock",
+		LocalStoragePath: "/var/snap/microk8s/common/default-storage",
+	},
+	DistributionKubernetes: {
+		ServiceName:      "kubelet",
+		RestartCommand:   []string{"systemctl", "restart", "kubelet"},
+		KubeconfigPath:   "/etc/kubernetes/admin.conf",
+		ContainerdSocket: "/run/containerd/containerd.sock",
+	},
+}
+
+// hostServices are the systemd units or snaps identifying a distribution installed on the host, a k3s or RKE2
+// agent node runs a different service than a server node
+var hostServices = []struct {
+	distribution string
+	service      string
+	paths        []string
+}{
+	{DistributionK3s, "k3s", []string{"/etc/systemd/system/k3s.service"}},
+	{DistributionK3s, "k3s-agent", []string{"/etc/systemd/system/k3s-agent.service"}},
+	{DistributionRKE2, "rke2-server", []string{"/usr/local/lib/systemd/system/rke2-server.service", "/usr/lib/systemd/system/rke2-server.service"}},
+	{DistributionRKE2, "rke2-agent", []string{"/usr/local/lib/systemd/system/rke2-agent.service", "/usr/lib/systemd/system/rke2-agent.service"}},
+	{DistributionMicroK8s, "snap.microk8s.daemon-kubelite", []string{"/snap/microk8s/current"}},
+}
+
+// microK8sAddons maps the workloads deployed by the MicroK8s addons, identified by namespace/name, to their addon
+var microK8sAddons = map[string]string{
+	"kube-system/coredns":                               "dns",
+	"kube-system/hostpath-provisioner":                  "hostpath-storage",
+	"kube-system/metrics-server":                        "metrics-server",
+	"kube-system/kubernetes-dashboard":                  "dashboard",
+	"ingress/nginx-ingress-microk8s-controller":         "ingress",
+	"container-registry/registry":                       "registry",
+	"metallb-system/controller":                         "metallb",
+	"cert-manager/cert-manager":                         "cert-manager",
+	"observability/kube-prom-stack-kube-prome-operator": "observability",
+}
+
+// GetDistribution detects the Kubernetes distribution of the cluster from its nodes and lists its enabled addons.
+// The addons the agent is not allowed to list are left out.
+func GetDistribution(ctx context.Context) (*Distribution, error) {
+	cli, err := buildLocalClient()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := cli.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	distribution := detectDistribution(nodes.Items)
+
+	switch distribution.Name {
+	case DistributionK3s, DistributionRKE2:
+		for _, path := range []string{k3sAddonsPath, helmChartsPath} {
+			data, err := cli.RESTClient().Get().AbsPath(path).DoRaw(ctx)
+			if err != nil {
+				continue
+			}
+
+			distribution.Addons = append(distribution.Addons, parseObjectNames(data)...)
+		}
+
+	case DistributionMicroK8s:
+		workloads := []string{}
+
+		deployments, err := cli.AppsV1().Deployments("").List(ctx, metav1.ListOptions{})
+		if err == nil {
+			for _, deployment := range deployments.Items {
+				workloads = append(workloads, deployment.Namespace+"/"+deployment.Name)
+			}
+		}
+
+		daemonSets, err := cli.AppsV1().DaemonSets("").List(ctx, metav1.ListOptions{})
+		if err == nil {
+			for _, daemonSet := range daemonSets.Items {
+				workloads = append(workloads, daemonSet.Namespace+"/"+daemonSet.Name)
+			}
+		}
+
+		distribution.Addons = microK8sEnabledAddons(workloads)
+	}
+
+	distribution.Addons = uniqueSorted(distribution.Addons)
+
+	return distribution, nil
+}
+
+// DetectHostDistribution returns the Kubernetes distribution installed on the host, detected from its services
+// through the host filesystem mounted in the agent container, or nil
+func DetectHostDistribution() *Distribution {
+	for _, hostService := range hostServices {
+		for _, path := range hostService.paths {
+			if _, err := os.Stat(filepath.Join(agent.HostRoot, path)); err != nil {
+				continue
+			}
+
+			distribution := newDistribution(hostService.distribution, "")
+			if distribution.ServiceName != hostService.service {
+				distribution.ServiceName = hostService.service
+				distribution.RestartCommand = []string{"systemctl", "restart", hostService.service}
+			}
+
+			return distribution
+		}
+	}
+
+	return nil
+}
+
+func newDistribution(name, version string) *Distribution {
+	distribution := distributionDefaults[name]
+	distribution.Name = name
+	distribution.Version = version
+	distribution.RestartCommand = append([]string{}, distribution.RestartCommand...)
+
+	return &distribution
+}
+
+// detectDistribution detects the distribution from the version of the kubelet of the nodes, k3s and RKE2 add
+// their name to it, and from the labels MicroK8s sets on its nodes
+func detectDistribution(nodes []v1.Node) *Distribution {
+	if len(nodes) == 0 {
+		return newDistribution(DistributionKubernetes, "")
+	}
+
+	node := nodes[0]
+	version := node.Status.NodeInfo.KubeletVersion
+
+	_, _, build := strings.Cut(version, "+")
+	switch {
+	case strings.HasPrefix(build, "k3s") || node.Labels[v1.LabelInstanceTypeStable] == k3sInstanceType:
+		return newDistribution(DistributionK3s, version)
+	case strings.HasPrefix(build, "rke2"):
+		return newDistribution(DistributionRKE2, version)
+	}
+
+	if _, ok := node.Labels[microK8sClusterLabel]; ok {
+		return newDistribution(DistributionMicroK8s, version)
+	}
+
+	return newDistribution(DistributionKubernetes, version)
+}
+
+// parseObjectNames returns the names of the objects of a list returned by the API server
+func parseObjectNames(data []byte) []string {
+	var list struct {
+		Items []struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+		} `json:"items"`
+	}
+
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(list.Items))
+	for _, item := range list.Items {
+		names = append(names, item.Metadata.Name)
+	}
+
+	return names
+}
+
+func microK8sEnabledAddons(workloads []string) []string {
+	addons := []string{}
+	for _, workload := range workloads {
+		if addon, ok := microK8sAddons[workload]; ok {
+			addons = append(addons, addon)
+		}
+	}
+
+	return addons
+}
+
+func uniqueSorted(values []string) []string {
+	if len(values) == 0 {
+		return values
+	}
+
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+
+	sort.Strings(unique)
+
+	return unique
+}
@@ -0,0 +1,63 @@
+package kubernetes
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDetectDistribution(t *testing.T) {
+	node := func(version string, labels map[string]string) []v1.Node {
+		return []v1.Node{{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-0", Labels: labels},
+			Status:     v1.NodeStatus{NodeInfo: v1.NodeSystemInfo{KubeletVersion: version}},
+		}}
+	}
+
+	tests := []struct {
+		nodes    []v1.Node
+		expected string
+	}{
+		{node("v1.27.4+k3s1", nil), DistributionK3s},
+		{node("v1.27.4", map[string]string{v1.LabelInstanceTypeStable: "k3s"}), DistributionK3s},
+		{node("v1.28.3+rke2r1", nil), DistributionRKE2},
+		{node("v1.28.3", map[string]string{microK8sClusterLabel: "true"}), DistributionMicroK8s},
+		{node("v1.28.3", nil), DistributionKubernetes},
+		{nil, DistributionKubernetes},
+	}
+
+	for _, test := range tests {
+		distribution := detectDistribution(test.nodes)
+		if distribution.Name != test.expected {
+			t.Errorf("expected %s, got %s", test.expected, distribution.Name)
+		}
+
+		if distribution.ServiceName == "" || distribution.KubeconfigPath == "" || len(distribution.RestartCommand) == 0 {
+			t.Errorf("expected the defaults of %s, got %+v", test.expected, distribution)
+		}
+	}
+}
+
+func TestParseObjectNames(t *testing.T) {
+	data := []byte(`{"apiVersion":"k3s.cattle.io/v1","kind":"AddonList","items":[{"metadata":{"name":"coredns"}},{"metadata":{"name":"traefik"}}]}`)
+
+	names := parseObjectNames(data)
+	if !reflect.DeepEqual(names, []string{"coredns", "traefik"}) {
+		t.Fatalf("unexpected names %v", names)
+	}
+}
+
+func TestMicroK8sEnabledAddons(t *testing.T) {
+	addons := uniqueSorted(microK8sEnabledAddons([]string{
+		"kube-system/coredns",
+		"kube-system/calico-kube-controllers",
+		"ingress/nginx-ingress-microk8s-controller",
+		"default/nginx",
+	}))
+
+	if !reflect.DeepEqual(addons, []string{"dns", "ingress"}) {
+		t.Fatalf("unexpected addons %v", addons)
+	}
+}
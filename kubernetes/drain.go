@@ -0,0 +1,211 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// mirrorPodAnnotation is set on the pods created by the kubelet for its static pods, they cannot be evicted
+	mirrorPodAnnotation = "kubernetes.io/config.mirror"
+	// evictionRetryInterval is the interval between two evictions of a pod refused by its PodDisruptionBudget
+	evictionRetryInterval = 5 * time.Second
+	// podDeletionCheckInterval is the interval between two checks of the deletion of an evicted pod
+	podDeletionCheckInterval = 2 * time.Second
+)
+
+// DrainOptions represents the options of the drain of a node
+type DrainOptions struct {
+	// GracePeriodSeconds overrides the termination grace period of the pods when set
+	GracePeriodSeconds *int64
+	// DeleteEmptyDirData evicts the pods using emptyDir volumes, the data of these volumes is lost
+	DeleteEmptyDirData bool
+	// Force evicts the pods that are not managed by a controller, they are not recreated
+	Force bool
+}
+
+// DrainResult represents the pods evicted from a node and the pods left on it
+type DrainResult struct {
+	Node    string   `json:"Node"`
+	Evicted []string `json:"Evicted"`
+	// Skipped are the DaemonSet pods, the mirror pods and the finished pods
+	Skipped []string `json:"Skipped"`
+}
+
+// CordonNode marks the node as unschedulable, or as schedulable again when cordon is false
+func CordonNode(ctx context.Context, name string, cordon bool) error {
+	cli, err := buildLocalClient()
+	if err != nil {
+		return err
+	}
+
+	return cordonNode(ctx, cli, name, cordon)
+}
+
+func cordonNode(ctx context.Context, cli *kubernetes.Clientset, name string, cordon bool) error {
+	patch := []byte(fmt.Sprintf(`{"spec":{"unschedulable":%t}}`, cordon))
+
+	_, err := cli.CoreV1().Nodes().Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+
+	return err
+}
+
+// DrainNode cordons the node and evicts its pods. The evictions refused by a PodDisruptionBudget are retried until
+// ctx is cancelled, and the drain waits for the evicted pods to be deleted. The node is left cordoned when the drain
+// fails or is cancelled. progress is called with the completion in percent and a message.
+func DrainNode(ctx context.Context, name string, options DrainOptions, progress func(percent int, message string)) (*DrainResult, error) {
+	cli, err := buildLocalClient()
+	if err != nil {
+		return nil, err
+	}
+
+	progress(0, "cordoning the node")
+
+	err = cordonNode(ctx, cli, name, true)
+	if err != nil {
+		return nil, fmt.Errorf("unable to cordon the node: %w", err)
+	}
+
+	pods, err := cli.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", name).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DrainResult{Node: name, Evicted: []string{}, Skipped: []string{}}
+
+	evictable, skipped, err := selectPodsToEvict(pods.Items, options)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pod := range skipped {
+		result.Skipped = append(result.Skipped, podName(pod))
+	}
+
+	for i, pod := range evictable {
+		progress(i*100/len(evictable), "evicting "+podName(pod))
+
+		err := evictPod(ctx, cli, pod, options.GracePeriodSeconds)
+		if err != nil {
+			return result, fmt.Errorf("unable to evict %s: %w", podName(pod), err)
+		}
+
+		result.Evicted = append(result.Evicted, podName(pod))
+	}
+
+	for i, pod := range evictable {
+		progress(i*100/len(evictable), "waiting for the deletion of "+podName(pod))
+
+		err := waitForPodDeletion(ctx, cli, pod)
+		if err != nil {
+			return result, fmt.Errorf("unable to wait for the deletion of %s: %w", podName(pod), err)
+		}
+	}
+
+	return result, nil
+}
+
+// selectPodsToEvict returns the pods to evict and the pods left on the node. Like kubectl drain, it fails before
+// evicting any pod when a pod cannot be evicted without losing data or without being recreated.
+func selectPodsToEvict(pods []v1.Pod, options DrainOptions) (evictable []v1.Pod, skipped []v1.Pod, err error) {
+	var blocking []string
+
+	for _, pod := range pods {
+		if _, ok := pod.Annotations[mirrorPodAnnotation]; ok || pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			skipped = append(skipped, pod)
+			continue
+		}
+
+		controller := metav1.GetControllerOf(&pod)
+		if controller != nil && controller.Kind == "DaemonSet" {
+			skipped = append(skipped, pod)
+			continue
+		}
+
+		if controller == nil && !options.Force {
+			blocking = append(blocking, podName(pod)+" is not managed by a controller")
+			continue
+		}
+
+		if usesEmptyDir(pod) && !options.DeleteEmptyDirData {
+			blocking = append(blocking, podName(pod)+" uses an emptyDir volume")
+			continue
+		}
+
+		evictable = append(evictable, pod)
+	}
+
+	if len(blocking) > 0 {
+		return nil, nil, errors.New("the node cannot be drained: " + strings.Join(blocking, ", "))
+	}
+
+	return evictable, skipped, nil
+}
+
+func usesEmptyDir(pod v1.Pod) bool {
+	for _, volume := range pod.Spec.Volumes {
+		if volume.EmptyDir != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// evictPod evicts the pod, retrying while its PodDisruptionBudget does not allow the disruption
+func evictPod(ctx context.Context, cli *kubernetes.Clientset, pod v1.Pod, gracePeriodSeconds *int64) error {
+	eviction := &policyv1.Eviction{
+		ObjectMeta:    metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+		DeleteOptions: &metav1.DeleteOptions{GracePeriodSeconds: gracePeriodSeconds},
+	}
+
+	for {
+		err := cli.PolicyV1().Evictions(pod.Namespace).Evict(ctx, eviction)
+		if err == nil || apierrors.IsNotFound(err) {
+			return nil
+		} else if !apierrors.IsTooManyRequests(err) {
+			return err
+		}
+
+		select {
+		case <-time.After(evictionRetryInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// waitForPodDeletion waits until the pod is deleted, a pod recreated with the same name has another UID
+func waitForPodDeletion(ctx context.Context, cli *kubernetes.Clientset, pod v1.Pod) error {
+	for {
+		current, err := cli.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) || (err == nil && current.UID != pod.UID) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		select {
+		case <-time.After(podDeletionCheckInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func podName(pod v1.Pod) string {
+	return pod.Namespace + "/" + pod.Name
+}
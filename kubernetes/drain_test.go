@@ -0,0 +1,49 @@
+package kubernetes
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSelectPodsToEvict(t *testing.T) {
+	controller := true
+
+	pod := func(name, ownerKind string) v1.Pod {
+		p := v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}}
+		if ownerKind != "" {
+			p.OwnerReferences = []metav1.OwnerReference{{Kind: ownerKind, Name: name, Controller: &controller}}
+		}
+
+		return p
+	}
+
+	mirror := pod("etcd", "")
+	mirror.Annotations = map[string]string{mirrorPodAnnotation: "hash"}
+
+	completed := pod("migration", "Job")
+	completed.Status.Phase = v1.PodSucceeded
+
+	cache := pod("cache", "ReplicaSet")
+	cache.Spec.Volumes = []v1.Volume{{Name: "tmp", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}}}
+
+	pods := []v1.Pod{pod("web", "ReplicaSet"), pod("agent", "DaemonSet"), mirror, completed, cache, pod("debug", "")}
+
+	if _, _, err := selectPodsToEvict(pods, DrainOptions{}); err == nil {
+		t.Fatal("expected the drain to be refused because of the standalone pod and the emptyDir volume")
+	}
+
+	evictable, skipped, err := selectPodsToEvict(pods, DrainOptions{Force: true, DeleteEmptyDirData: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(evictable) != 3 || evictable[0].Name != "web" || evictable[1].Name != "cache" || evictable[2].Name != "debug" {
+		t.Fatalf("unexpected pods to evict %+v", evictable)
+	}
+
+	if len(skipped) != 3 {
+		t.Fatalf("expected the DaemonSet, mirror and completed pods to be skipped, got %+v", skipped)
+	}
+}
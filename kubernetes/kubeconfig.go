@@ -0,0 +1,293 @@
+package kubernetes
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Roles of the Portainer users a kubeconfig can be issued for
+const (
+	KubeconfigRoleAdmin    = "admin"
+	KubeconfigRoleOperator = "operator"
+	KubeconfigRoleReadOnly = "readonly"
+)
+
+const (
+	// kubeconfigLabel identifies the service accounts and the role bindings created for the kubeconfigs
+	kubeconfigLabel = "io.portainer.agent.kubeconfig"
+	// kubeconfigExpiresAtAnnotation is the Unix time after which the service account and its binding are removed
+	kubeconfigExpiresAtAnnotation = "io.portainer.agent.kubeconfig-expires-at"
+	// kubeconfigUserAnnotation is the Portainer user the kubeconfig was issued for
+	kubeconfigUserAnnotation = "io.portainer.agent.kubeconfig-user"
+	// MinKubeconfigExpiration is the minimum validity of a kubeconfig, the minimum accepted by the TokenRequest API
+	MinKubeconfigExpiration = 10 * time.Minute
+	// MaxKubeconfigExpiration is the maximum validity of a kubeconfig
+	MaxKubeconfigExpiration = 24 * time.Hour
+)
+
+// kubeconfigClusterRoles are the built-in cluster roles bound in the namespace for each Portainer role
+var kubeconfigClusterRoles = map[string]string{
+	KubeconfigRoleAdmin:    "admin",
+	KubeconfigRoleOperator: "edit",
+	KubeconfigRoleReadOnly: "view",
+}
+
+// KubeconfigRequest represents the scope of a kubeconfig
+type KubeconfigRequest struct {
+	// Role is one of the KubeconfigRole constants
+	Role      string
+	Namespace string
+	// User is the Portainer user the kubeconfig is issued for, it is recorded on the service account
+	User       string
+	Expiration time.Duration
+	// ServerURL is the URL of the API server written in the kubeconfig, the in-cluster URL is used when empty
+	ServerURL string
+}
+
+// Kubeconfig represents an issued kubeconfig
+type Kubeconfig struct {
+	ServiceAccount string    `json:"ServiceAccount"`
+	ExpiresAt      time.Time `json:"ExpiresAt"`
+	// Content is the kubeconfig file, in YAML
+	Content string `json:"Kubeconfig"`
+}
+
+// kubeconfigFile is the subset of the kubeconfig file format written by the agent
+type kubeconfigFile struct {
+	APIVersion     string              `yaml:"apiVersion"`
+	Kind           string              `yaml:"kind"`
+	Clusters       []kubeconfigCluster `yaml:"clusters"`
+	Users          []kubeconfigUser    `yaml:"users"`
+	Contexts       []kubeconfigContext `yaml:"contexts"`
+	CurrentContext string              `yaml:"current-context"`
+}
+
+type kubeconfigCluster struct {
+	Name    string `yaml:"name"`
+	Cluster struct {
+		Server                   string `yaml:"server"`
+		CertificateAuthorityData string `yaml:"certificate-authority-data,omitempty"`
+	} `yaml:"cluster"`
+}
+
+type kubeconfigUser struct {
+	Name string `yaml:"name"`
+	User struct {
+		Token                 string `yaml:"token"`
+		ClientCertificateData string `yaml:"client-certificate-data,omitempty"`
+		ClientKeyData         string `yaml:"client-key-data,omitempty"`
+	} `yaml:"user"`
+}
+
+type kubeconfigContext struct {
+	Name    string `yaml:"name"`
+	Context struct {
+		Cluster   string `yaml:"cluster"`
+		User      string `yaml:"user"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"context"`
+}
+
+// ValidateKubeconfigRequest checks the role and the expiration of the request
+func ValidateKubeconfigRequest(req KubeconfigRequest) error {
+	if _, ok := kubeconfigClusterRoles[req.Role]; !ok {
+		return fmt.Errorf("unsupported role %q", req.Role)
+	}
+
+	if req.Namespace == "" {
+		return errors.New("the namespace is required")
+	}
+
+	if req.Expiration < MinKubeconfigExpiration || req.Expiration > MaxKubeconfigExpiration {
+		return fmt.Errorf("the expiration must be between %s and %s", MinKubeconfigExpiration, MaxKubeconfigExpiration)
+	}
+
+	return nil
+}
+
+// IssueKubeconfig creates a service account bound to the cluster role of the role in the namespace, and returns a
+// kubeconfig authenticated with a token of this service account expiring after the expiration. The service accounts
+// and the bindings of the expired kubeconfigs are removed before issuing a new one.
+func IssueKubeconfig(ctx context.Context, req KubeconfigRequest) (*Kubeconfig, error) {
+	err := ValidateKubeconfigRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := restConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	cli, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	removeExpiredKubeconfigs(ctx, cli, time.Now())
+
+	_, err = cli.CoreV1().Namespaces().Get(ctx, req.Namespace, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(req.Expiration).Truncate(time.Second)
+	name := newServiceAccountName()
+
+	meta := metav1.ObjectMeta{
+		Name:      name,
+		Namespace: req.Namespace,
+		Labels:    map[string]string{kubeconfigLabel: "true"},
+		Annotations: map[string]string{
+			kubeconfigExpiresAtAnnotation: strconv.FormatInt(expiresAt.Unix(), 10),
+			kubeconfigUserAnnotation:      req.User,
+		},
+	}
+
+	_, err = cli.CoreV1().ServiceAccounts(req.Namespace).Create(ctx, &v1.ServiceAccount{ObjectMeta: meta}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the service account: %w", err)
+	}
+
+	_, err = cli.RbacV1().RoleBindings(req.Namespace).Create(ctx, &rbacv1.RoleBinding{
+		ObjectMeta: meta,
+		Subjects: []rbacv1.Subject{
+			{Kind: rbacv1.ServiceAccountKind, Name: name, Namespace: req.Namespace},
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "ClusterRole",
+			Name:     kubeconfigClusterRoles[req.Role],
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		removeKubeconfig(ctx, cli, req.Namespace, name)
+
+		return nil, fmt.Errorf("unable to bind the role: %w", err)
+	}
+
+	expirationSeconds := int64(req.Expiration.Seconds())
+
+	token, err := cli.CoreV1().ServiceAccounts(req.Namespace).CreateToken(ctx, name, &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{ExpirationSeconds: &expirationSeconds},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		removeKubeconfig(ctx, cli, req.Namespace, name)
+
+		return nil, fmt.Errorf("unable to create the token: %w", err)
+	}
+
+	server := req.ServerURL
+	if server == "" {
+		server = config.Host
+	}
+
+	caData := config.TLSClientConfig.CAData
+	if len(caData) == 0 && config.TLSClientConfig.CAFile != "" {
+		caData, err = os.ReadFile(config.TLSClientConfig.CAFile)
+		if err != nil {
+			removeKubeconfig(ctx, cli, req.Namespace, name)
+
+			return nil, err
+		}
+	}
+
+	content, err := buildKubeconfig(server, caData, req.Namespace, name, token.Status.Token)
+	if err != nil {
+		removeKubeconfig(ctx, cli, req.Namespace, name)
+
+		return nil, err
+	}
+
+	return &Kubeconfig{
+		ServiceAccount: req.Namespace + "/" + name,
+		ExpiresAt:      expiresAt,
+		Content:        string(content),
+	}, nil
+}
+
+func buildKubeconfig(server string, caData []byte, namespace, serviceAccount, token string) ([]byte, error) {
+	cluster := kubeconfigCluster{Name: "portainer"}
+	cluster.Cluster.Server = server
+	if len(caData) > 0 {
+		cluster.Cluster.CertificateAuthorityData = base64.StdEncoding.EncodeToString(caData)
+	}
+
+	user := kubeconfigUser{Name: serviceAccount}
+	user.User.Token = token
+
+	kubeContext := kubeconfigContext{Name: serviceAccount + "@portainer"}
+	kubeContext.Context.Cluster = cluster.Name
+	kubeContext.Context.User = user.Name
+	kubeContext.Context.Namespace = namespace
+
+	return yaml.Marshal(kubeconfigFile{
+		APIVersion:     "v1",
+		Kind:           "Config",
+		Clusters:       []kubeconfigCluster{cluster},
+		Users:          []kubeconfigUser{user},
+		Contexts:       []kubeconfigContext{kubeContext},
+		CurrentContext: kubeContext.Name,
+	})
+}
+
+// removeExpiredKubeconfigs removes the service accounts and the role bindings of the kubeconfigs expired at now. The
+// tokens expire by themselves, the removal prevents new tokens from being requested for these service accounts.
+func removeExpiredKubeconfigs(ctx context.Context, cli *kubernetes.Clientset, now time.Time) {
+	serviceAccounts, err := cli.CoreV1().ServiceAccounts(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		LabelSelector: kubeconfigLabel + "=true",
+	})
+	if err != nil {
+		log.Warn().Err(err).Msg("unable to list the service accounts of the kubeconfigs")
+
+		return
+	}
+
+	for _, serviceAccount := range serviceAccounts.Items {
+		if kubeconfigExpired(serviceAccount.ObjectMeta, now) {
+			removeKubeconfig(ctx, cli, serviceAccount.Namespace, serviceAccount.Name)
+		}
+	}
+}
+
+// kubeconfigExpired returns true when the expiration annotation is in the past, or is missing or invalid
+func kubeconfigExpired(meta metav1.ObjectMeta, now time.Time) bool {
+	expiresAt, err := strconv.ParseInt(meta.Annotations[kubeconfigExpiresAtAnnotation], 10, 64)
+
+	return err != nil || !now.Before(time.Unix(expiresAt, 0))
+}
+
+func removeKubeconfig(ctx context.Context, cli *kubernetes.Clientset, namespace, name string) {
+	err := cli.RbacV1().RoleBindings(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Warn().Err(err).Str("namespace", namespace).Str("name", name).Msg("unable to remove the role binding of a kubeconfig")
+	}
+
+	err = cli.CoreV1().ServiceAccounts(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Warn().Err(err).Str("namespace", namespace).Str("name", name).Msg("unable to remove the service account of a kubeconfig")
+	}
+}
+
+func newServiceAccountName() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+
+	return "portainer-kubeconfig-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,73 @@
+package kubernetes
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidateKubeconfigRequest(t *testing.T) {
+	valid := KubeconfigRequest{Role: KubeconfigRoleReadOnly, Namespace: "default", Expiration: time.Hour}
+	if err := ValidateKubeconfigRequest(valid); err != nil {
+		t.Fatalf("expected the request to be valid, got %s", err)
+	}
+
+	invalid := []KubeconfigRequest{
+		{Role: "cluster-admin", Namespace: "default", Expiration: time.Hour},
+		{Role: KubeconfigRoleAdmin, Expiration: time.Hour},
+		{Role: KubeconfigRoleAdmin, Namespace: "default", Expiration: time.Minute},
+		{Role: KubeconfigRoleAdmin, Namespace: "default", Expiration: 48 * time.Hour},
+	}
+
+	for _, req := range invalid {
+		if err := ValidateKubeconfigRequest(req); err == nil {
+			t.Errorf("expected %+v to be refused", req)
+		}
+	}
+}
+
+func TestBuildKubeconfig(t *testing.T) {
+	content, err := buildKubeconfig("https://10.0.0.1:6443", []byte("ca"), "team-a", "portainer-kubeconfig-1", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var file kubeconfigFile
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		t.Fatal(err)
+	}
+
+	if file.CurrentContext != "portainer-kubeconfig-1@portainer" || len(file.Contexts) != 1 || file.Contexts[0].Context.Namespace != "team-a" {
+		t.Fatalf("unexpected contexts in\n%s", content)
+	}
+
+	if file.Users[0].User.Token != "secret" || file.Clusters[0].Cluster.Server != "https://10.0.0.1:6443" {
+		t.Fatalf("unexpected credentials in\n%s", content)
+	}
+
+	if !strings.Contains(string(content), "certificate-authority-data: Y2E=") {
+		t.Fatalf("expected the CA to be embedded in\n%s", content)
+	}
+}
+
+func TestKubeconfigExpired(t *testing.T) {
+	now := time.Unix(1000, 0)
+
+	cases := map[string]bool{
+		"2000":    false,
+		"1000":    true,
+		"500":     true,
+		"invalid": true,
+	}
+
+	for expiresAt, expected := range cases {
+		meta := metav1.ObjectMeta{Annotations: map[string]string{kubeconfigExpiresAtAnnotation: expiresAt}}
+
+		if kubeconfigExpired(meta, now) != expected {
+			t.Errorf("expected kubeconfigExpired to be %t for %s", expected, expiresAt)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package kubernetes
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Policy checks evaluated against the workloads of the cluster
+const (
+	// PolicyNoResourceLimits reports the containers without a CPU or a memory limit
+	PolicyNoResourceLimits = "NoResourceLimits"
+	// PolicyLatestTag reports the containers running an image without a tag or with the latest tag
+	PolicyLatestTag = "LatestTag"
+	// PolicyPrivileged reports the containers running in privileged mode
+	PolicyPrivileged = "Privileged"
+)
+
+// maxPolicyViolations is the maximum number of violations listed per namespace, the counts cover all of them
+const maxPolicyViolations = 50
+
+// PolicyReport represents the violations of the policy checks, per namespace. Only the namespaces with at least one
+// violation are reported.
+type PolicyReport struct {
+	Namespaces []NamespacePolicyReport `json:"Namespaces"`
+}
+
+// NamespacePolicyReport represents the violations of the policy checks in a namespace
+type NamespacePolicyReport struct {
+	Namespace string `json:"Namespace"`
+	// Counts is the number of violations per policy
+	Counts     map[string]int    `json:"Counts"`
+	Violations []PolicyViolation `json:"Violations"`
+	// Truncated is true when the namespace has more than maxPolicyViolations violations
+	Truncated bool `json:"Truncated,omitempty"`
+}
+
+// PolicyViolation represents a container of a workload failing a policy check
+type PolicyViolation struct {
+	Policy    string `json:"Policy"`
+	Kind      string `json:"Kind"`
+	Name      string `json:"Name"`
+	Container string `json:"Container"`
+}
+
+// workload is a workload of the cluster with the template of its pods
+type workload struct {
+	kind      string
+	namespace string
+	name      string
+	spec      v1.PodSpec
+}
+
+// GetPolicyReport evaluates the deployments, the stateful sets, the daemon sets and the pods that are not managed by a
+// controller against the policy checks
+func GetPolicyReport(ctx context.Context) (*PolicyReport, error) {
+	cli, err := buildLocalClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var workloads []workload
+
+	deployments, err := cli.AppsV1().Deployments(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	workloads = append(workloads, deploymentWorkloads(deployments.Items)...)
+
+	statefulSets, err := cli.AppsV1().StatefulSets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	workloads = append(workloads, statefulSetWorkloads(statefulSets.Items)...)
+
+	daemonSets, err := cli.AppsV1().DaemonSets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	workloads = append(workloads, daemonSetWorkloads(daemonSets.Items)...)
+
+	pods, err := cli.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	workloads = append(workloads, standalonePodWorkloads(pods.Items)...)
+
+	return evaluatePolicies(workloads), nil
+}
+
+func deploymentWorkloads(deployments []appsv1.Deployment) []workload {
+	workloads := make([]workload, 0, len(deployments))
+	for _, deployment := range deployments {
+		workloads = append(workloads, workload{"Deployment", deployment.Namespace, deployment.Name, deployment.Spec.Template.Spec})
+	}
+
+	return workloads
+}
+
+func statefulSetWorkloads(statefulSets []appsv1.StatefulSet) []workload {
+	workloads := make([]workload, 0, len(statefulSets))
+	for _, statefulSet := range statefulSets {
+		workloads = append(workloads, workload{"StatefulSet", statefulSet.Namespace, statefulSet.Name, statefulSet.Spec.Template.Spec})
+	}
+
+	return workloads
+}
+
+func daemonSetWorkloads(daemonSets []appsv1.DaemonSet) []workload {
+	workloads := make([]workload, 0, len(daemonSets))
+	for _, daemonSet := range daemonSets {
+		workloads = append(workloads, workload{"DaemonSet", daemonSet.Namespace, daemonSet.Name, daemonSet.Spec.Template.Spec})
+	}
+
+	return workloads
+}
+
+// standalonePodWorkloads returns the pods without a controller, the other pods are evaluated through their workload
+func standalonePodWorkloads(pods []v1.Pod) []workload {
+	var workloads []workload
+	for _, pod := range pods {
+		if metav1.GetControllerOf(&pod) != nil {
+			continue
+		}
+
+		workloads = append(workloads, workload{"Pod", pod.Namespace, pod.Name, pod.Spec})
+	}
+
+	return workloads
+}
+
+func evaluatePolicies(workloads []workload) *PolicyReport {
+	namespaces := map[string]*NamespacePolicyReport{}
+
+	for _, w := range workloads {
+		containers := append(append([]v1.Container{}, w.spec.InitContainers...), w.spec.Containers...)
+
+		for _, container := range containers {
+			for _, policy := range failedPolicies(container) {
+				report, ok := namespaces[w.namespace]
+				if !ok {
+					report = &NamespacePolicyReport{Namespace: w.namespace, Counts: map[string]int{}}
+					namespaces[w.namespace] = report
+				}
+
+				report.Counts[policy]++
+
+				if len(report.Violations) >= maxPolicyViolations {
+					report.Truncated = true
+
+					continue
+				}
+
+				report.Violations = append(report.Violations, PolicyViolation{
+					Policy:    policy,
+					Kind:      w.kind,
+					Name:      w.name,
+					Container: container.Name,
+				})
+			}
+		}
+	}
+
+	report := &PolicyReport{Namespaces: make([]NamespacePolicyReport, 0, len(namespaces))}
+	for _, namespace := range namespaces {
+		report.Namespaces = append(report.Namespaces, *namespace)
+	}
+
+	sort.Slice(report.Namespaces, func(i, j int) bool {
+		return report.Namespaces[i].Namespace < report.Namespaces[j].Namespace
+	})
+
+	return report
+}
+
+func failedPolicies(container v1.Container) []string {
+	var policies []string
+
+	limits := container.Resources.Limits
+	if limits.Cpu().IsZero() || limits.Memory().IsZero() {
+		policies = append(policies, PolicyNoResourceLimits)
+	}
+
+	if usesLatestTag(container.Image) {
+		policies = append(policies, PolicyLatestTag)
+	}
+
+	if sc := container.SecurityContext; sc != nil && sc.Privileged != nil && *sc.Privileged {
+		policies = append(policies, PolicyPrivileged)
+	}
+
+	return policies
+}
+
+// usesLatestTag returns true when the image is not pinned by a digest and has no tag or the latest tag
+func usesLatestTag(image string) bool {
+	if strings.Contains(image, "@") {
+		return false
+	}
+
+	name := image[strings.LastIndex(image, "/")+1:]
+
+	i := strings.LastIndex(name, ":")
+	if i == -1 {
+		return true
+	}
+
+	return name[i+1:] == "latest"
+}
@@ -0,0 +1,64 @@
+package kubernetes
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestUsesLatestTag(t *testing.T) {
+	tests := map[string]bool{
+		"nginx":                          true,
+		"nginx:latest":                   true,
+		"registry:5000/team/app":         true,
+		"registry:5000/team/app:1.2":     false,
+		"nginx:1.25":                     false,
+		"nginx@sha256:0123456789abcdef":  false,
+		"nginx:latest@sha256:0123456789": false,
+	}
+
+	for image, expected := range tests {
+		if got := usesLatestTag(image); got != expected {
+			t.Errorf("usesLatestTag(%q) = %t, expected %t", image, got, expected)
+		}
+	}
+}
+
+func TestEvaluatePolicies(t *testing.T) {
+	privileged := true
+
+	limited := v1.Container{
+		Name:  "app",
+		Image: "app:1.0",
+		Resources: v1.ResourceRequirements{Limits: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse("500m"),
+			v1.ResourceMemory: resource.MustParse("128Mi"),
+		}},
+	}
+
+	unlimited := v1.Container{
+		Name:            "sidecar",
+		Image:           "sidecar",
+		SecurityContext: &v1.SecurityContext{Privileged: &privileged},
+	}
+
+	report := evaluatePolicies([]workload{
+		{"Deployment", "web", "front", v1.PodSpec{Containers: []v1.Container{limited, unlimited}}},
+		{"Deployment", "compliant", "api", v1.PodSpec{Containers: []v1.Container{limited}}},
+		{"Pod", "default", "debug", v1.PodSpec{Containers: []v1.Container{unlimited}}},
+	})
+
+	if len(report.Namespaces) != 2 || report.Namespaces[0].Namespace != "default" || report.Namespaces[1].Namespace != "web" {
+		t.Fatalf("expected the violations of the default and web namespaces, got %+v", report.Namespaces)
+	}
+
+	web := report.Namespaces[1]
+	if len(web.Violations) != 3 || web.Counts[PolicyNoResourceLimits] != 1 || web.Counts[PolicyLatestTag] != 1 || web.Counts[PolicyPrivileged] != 1 {
+		t.Fatalf("unexpected violations in the web namespace: %+v", web)
+	}
+
+	if v := web.Violations[0]; v.Kind != "Deployment" || v.Name != "front" || v.Container != "sidecar" {
+		t.Fatalf("unexpected violation %+v", v)
+	}
+}
@@ -0,0 +1,216 @@
+package kubernetes
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// restartWindow is the duration during which the restarts are counted in the report
+	restartWindow = time.Hour
+	// crashLoopRestarts is the number of restarts within the window from which a container is considered crashlooping,
+	// even when Kubernetes is not backing off its restarts
+	crashLoopRestarts = 3
+	// maxCrashLoopingPods is the maximum number of crashlooping containers listed in the report
+	maxCrashLoopingPods = 50
+	// maxTerminationMessageLength is the maximum length of the termination messages reported
+	maxTerminationMessageLength = 1024
+	// crashLoopBackOffReason is the waiting reason of a container Kubernetes is backing off the restarts of
+	crashLoopBackOffReason = "CrashLoopBackOff"
+)
+
+// PodRestartReport represents the restarts of the containers of the cluster during the last restartWindow
+type PodRestartReport struct {
+	WindowSeconds int `json:"WindowSeconds"`
+	Restarts      int `json:"Restarts"`
+	// ExitReasons is the number of restarts per reason of the termination of the container (Error, OOMKilled...)
+	ExitReasons  map[string]int    `json:"ExitReasons"`
+	CrashLooping []CrashLoopingPod `json:"CrashLooping"`
+}
+
+// CrashLoopingPod represents a container that Kubernetes is backing off the restarts of, or that restarted
+// repeatedly during the window
+type CrashLoopingPod struct {
+	Namespace      string `json:"Namespace"`
+	Pod            string `json:"Pod"`
+	Container      string `json:"Container"`
+	RestartCount   int32  `json:"RestartCount"`
+	RecentRestarts int    `json:"RecentRestarts"`
+	// Reason is the reason the container is waiting, CrashLoopBackOff when Kubernetes is backing off its restarts
+	Reason string `json:"Reason,omitempty"`
+	// LastExitCode, LastReason and LastMessage describe the last termination of the container
+	LastExitCode     int32      `json:"LastExitCode"`
+	LastReason       string     `json:"LastReason,omitempty"`
+	LastMessage      string     `json:"LastMessage,omitempty"`
+	LastTerminatedAt *time.Time `json:"LastTerminatedAt,omitempty"`
+}
+
+// containerKey identifies a container of a pod, the UID distinguishes the pods recreated with the same name
+type containerKey struct {
+	pod       types.UID
+	container string
+}
+
+type restartEvent struct {
+	time   time.Time
+	key    containerKey
+	reason string
+}
+
+// restartTracker compares the restart counts of the containers between the snapshots to date their restarts
+type restartTracker struct {
+	mu            sync.Mutex
+	restartCounts map[containerKey]int32
+	events        []restartEvent
+}
+
+var restarts = newRestartTracker()
+
+func newRestartTracker() *restartTracker {
+	return &restartTracker{
+		restartCounts: map[containerKey]int32{},
+	}
+}
+
+// GetPodRestartReport returns the restarts of the containers of the cluster during the last hour. The restarts are
+// dated by comparing the pods with the previous report, the first report only lists the containers that Kubernetes
+// is backing off the restarts of.
+func GetPodRestartReport(ctx context.Context) (*PodRestartReport, error) {
+	cli, err := buildLocalClient()
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := cli.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return restarts.observe(pods.Items, time.Now()), nil
+}
+
+func (tracker *restartTracker) observe(pods []v1.Pod, now time.Time) *PodRestartReport {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	restartCounts := make(map[containerKey]int32, len(tracker.restartCounts))
+
+	for _, pod := range pods {
+		statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+
+		for _, status := range statuses {
+			key := containerKey{pod: pod.UID, container: status.Name}
+			restartCounts[key] = status.RestartCount
+
+			previous, ok := tracker.restartCounts[key]
+			if !ok || status.RestartCount <= previous {
+				continue
+			}
+
+			reason := "Unknown"
+			if terminated := status.LastTerminationState.Terminated; terminated != nil && terminated.Reason != "" {
+				reason = terminated.Reason
+			}
+
+			for i := previous; i < status.RestartCount; i++ {
+				tracker.events = append(tracker.events, restartEvent{time: now, key: key, reason: reason})
+			}
+		}
+	}
+
+	tracker.restartCounts = restartCounts
+
+	cutoff := now.Add(-restartWindow)
+	events := tracker.events[:0]
+	for _, event := range tracker.events {
+		if event.time.After(cutoff) {
+			events = append(events, event)
+		}
+	}
+	tracker.events = events
+
+	return tracker.report(pods)
+}
+
+func (tracker *restartTracker) report(pods []v1.Pod) *PodRestartReport {
+	report := &PodRestartReport{
+		WindowSeconds: int(restartWindow.Seconds()),
+		Restarts:      len(tracker.events),
+		ExitReasons:   map[string]int{},
+		CrashLooping:  []CrashLoopingPod{},
+	}
+
+	recentRestarts := map[containerKey]int{}
+	for _, event := range tracker.events {
+		report.ExitReasons[event.reason]++
+		recentRestarts[event.key]++
+	}
+
+	for _, pod := range pods {
+		statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+
+		for _, status := range statuses {
+			recent := recentRestarts[containerKey{pod: pod.UID, container: status.Name}]
+
+			var waitingReason string
+			if status.State.Waiting != nil {
+				waitingReason = status.State.Waiting.Reason
+			}
+
+			if waitingReason != crashLoopBackOffReason && recent < crashLoopRestarts {
+				continue
+			}
+
+			crashLooping := CrashLoopingPod{
+				Namespace:      pod.Namespace,
+				Pod:            pod.Name,
+				Container:      status.Name,
+				RestartCount:   status.RestartCount,
+				RecentRestarts: recent,
+				Reason:         waitingReason,
+			}
+
+			if terminated := status.LastTerminationState.Terminated; terminated != nil {
+				crashLooping.LastExitCode = terminated.ExitCode
+				crashLooping.LastReason = terminated.Reason
+				crashLooping.LastMessage = truncateMessage(terminated.Message)
+
+				if !terminated.FinishedAt.IsZero() {
+					finishedAt := terminated.FinishedAt.Time
+					crashLooping.LastTerminatedAt = &finishedAt
+				}
+			}
+
+			report.CrashLooping = append(report.CrashLooping, crashLooping)
+		}
+	}
+
+	sort.Slice(report.CrashLooping, func(i, j int) bool {
+		a, b := report.CrashLooping[i], report.CrashLooping[j]
+		if a.RecentRestarts != b.RecentRestarts {
+			return a.RecentRestarts > b.RecentRestarts
+		}
+
+		return a.Namespace+"/"+a.Pod+"/"+a.Container < b.Namespace+"/"+b.Pod+"/"+b.Container
+	})
+
+	if len(report.CrashLooping) > maxCrashLoopingPods {
+		report.CrashLooping = report.CrashLooping[:maxCrashLoopingPods]
+	}
+
+	return report
+}
+
+func truncateMessage(message string) string {
+	if len(message) <= maxTerminationMessageLength {
+		return message
+	}
+
+	return message[:maxTerminationMessageLength] + "..."
+}
@@ -0,0 +1,58 @@
+package kubernetes
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestRestartTracker(t *testing.T) {
+	pod := func(uid types.UID, restartCount int32, waitingReason string) v1.Pod {
+		status := v1.ContainerStatus{
+			Name:         "app",
+			RestartCount: restartCount,
+			LastTerminationState: v1.ContainerState{
+				Terminated: &v1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled", Message: "out of memory"},
+			},
+		}
+
+		if waitingReason != "" {
+			status.State.Waiting = &v1.ContainerStateWaiting{Reason: waitingReason}
+		}
+
+		p := v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: string(uid), UID: uid}}
+		p.Status.ContainerStatuses = []v1.ContainerStatus{status}
+
+		return p
+	}
+
+	tracker := newRestartTracker()
+	now := time.Now()
+
+	// the restarts that happened before the first observation cannot be dated
+	report := tracker.observe([]v1.Pod{pod("web", 10, ""), pod("worker", 5, crashLoopBackOffReason)}, now)
+	if report.Restarts != 0 || len(report.CrashLooping) != 1 || report.CrashLooping[0].Pod != "worker" {
+		t.Fatalf("expected only the backed off container to be reported, got %+v", report)
+	}
+
+	report = tracker.observe([]v1.Pod{pod("web", 13, ""), pod("worker", 6, crashLoopBackOffReason)}, now.Add(10*time.Minute))
+	if report.Restarts != 4 || report.ExitReasons["OOMKilled"] != 4 {
+		t.Fatalf("expected 4 restarts killed by the OOM killer, got %+v", report)
+	}
+
+	if len(report.CrashLooping) != 2 || report.CrashLooping[0].Pod != "web" || report.CrashLooping[0].RecentRestarts != 3 {
+		t.Fatalf("expected web to be crashlooping first with 3 recent restarts, got %+v", report.CrashLooping)
+	}
+
+	if c := report.CrashLooping[1]; c.LastExitCode != 137 || c.LastMessage != "out of memory" || c.RestartCount != 6 {
+		t.Fatalf("unexpected last termination %+v", c)
+	}
+
+	report = tracker.observe([]v1.Pod{pod("web", 13, "")}, now.Add(2*time.Hour))
+	if report.Restarts != 0 || len(report.CrashLooping) != 0 {
+		t.Fatalf("expected the restarts to leave the window, got %+v", report)
+	}
+}
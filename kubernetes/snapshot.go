@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/portainer/agent/metrics"
 	portainer "github.com/portainer/portainer/api"
 
 	"github.com/rs/zerolog/log"
@@ -13,6 +14,15 @@ import (
 
 // CreateSnapshot creates a snapshot of a specific Kubernetes environment(endpoint)
 func CreateSnapshot() (*portainer.KubernetesSnapshot, error) {
+	start := time.Now()
+
+	snapshot, err := createSnapshot()
+	metrics.ObserveSnapshot(metrics.PlatformKubernetes, time.Since(start), err)
+
+	return snapshot, err
+}
+
+func createSnapshot() (*portainer.KubernetesSnapshot, error) {
 	cli, err := buildLocalClient()
 	if err != nil {
 		return nil, err
@@ -0,0 +1,252 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/rs/zerolog/log"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// nodeMetricsPath is the path of the node metrics exposed by the metrics-server
+const nodeMetricsPath = "/apis/metrics.k8s.io/v1beta1/nodes"
+
+// ClusterSummary represents the nodes, the workloads and the resource usage of the cluster, it complements the
+// Kubernetes snapshot with the data displayed in the dashboards of the environment
+type ClusterSummary struct {
+	Nodes                  NodeSummary           `json:"Nodes"`
+	Namespaces             int                   `json:"Namespaces"`
+	Deployments            WorkloadCount         `json:"Deployments"`
+	StatefulSets           WorkloadCount         `json:"StatefulSets"`
+	DaemonSets             WorkloadCount         `json:"DaemonSets"`
+	Pods                   PodCount              `json:"Pods"`
+	PersistentVolumeClaims VolumeClaimSummary    `json:"PersistentVolumeClaims"`
+	Usage                  *ClusterResourceUsage `json:"Usage,omitempty"`
+}
+
+// NodeSummary represents the number and the allocatable resources of the nodes
+type NodeSummary struct {
+	Count int `json:"Count"`
+	Ready int `json:"Ready"`
+	// AllocatableCPU is in millicores
+	AllocatableCPU    int64 `json:"AllocatableCPU"`
+	AllocatableMemory int64 `json:"AllocatableMemory"`
+}
+
+// WorkloadCount represents the number of workloads of a kind, and how many have all their replicas ready
+type WorkloadCount struct {
+	Total int `json:"Total"`
+	Ready int `json:"Ready"`
+}
+
+// PodCount represents the number of pods per phase
+type PodCount struct {
+	Total     int `json:"Total"`
+	Running   int `json:"Running"`
+	Pending   int `json:"Pending"`
+	Succeeded int `json:"Succeeded"`
+	Failed    int `json:"Failed"`
+}
+
+// VolumeClaimSummary represents the persistent volume claims and the storage they request and are bound to, in bytes
+type VolumeClaimSummary struct {
+	Count            int   `json:"Count"`
+	Bound            int   `json:"Bound"`
+	RequestedStorage int64 `json:"RequestedStorage"`
+	CapacityStorage  int64 `json:"CapacityStorage"`
+}
+
+// ClusterResourceUsage represents the CPU, in millicores, and the memory, in bytes, used on all the nodes
+type ClusterResourceUsage struct {
+	CPU    int64 `json:"CPU"`
+	Memory int64 `json:"Memory"`
+}
+
+// GetClusterSummary returns the summary of the cluster. The usage is only reported when the metrics-server is
+// installed in the cluster.
+func GetClusterSummary(ctx context.Context) (*ClusterSummary, error) {
+	cli, err := buildLocalClient()
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &ClusterSummary{}
+
+	nodes, err := cli.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	summary.Nodes = summarizeNodes(nodes.Items)
+
+	namespaces, err := cli.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	summary.Namespaces = len(namespaces.Items)
+
+	deployments, err := cli.AppsV1().Deployments(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	summary.Deployments = summarizeDeployments(deployments.Items)
+
+	statefulSets, err := cli.AppsV1().StatefulSets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	summary.StatefulSets = summarizeStatefulSets(statefulSets.Items)
+
+	daemonSets, err := cli.AppsV1().DaemonSets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	summary.DaemonSets = summarizeDaemonSets(daemonSets.Items)
+
+	pods, err := cli.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	summary.Pods = summarizePods(pods.Items)
+
+	claims, err := cli.CoreV1().PersistentVolumeClaims(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	summary.PersistentVolumeClaims = summarizeVolumeClaims(claims.Items)
+
+	summary.Usage, err = getClusterResourceUsage(ctx, cli)
+	if err != nil {
+		log.Debug().Err(err).Msg("unable to retrieve the node metrics, the metrics-server might not be installed")
+	}
+
+	return summary, nil
+}
+
+func summarizeNodes(nodes []v1.Node) NodeSummary {
+	summary := NodeSummary{Count: len(nodes)}
+
+	for _, node := range nodes {
+		summary.AllocatableCPU += node.Status.Allocatable.Cpu().MilliValue()
+		summary.AllocatableMemory += node.Status.Allocatable.Memory().Value()
+
+		for _, condition := range node.Status.Conditions {
+			if condition.Type == v1.NodeReady && condition.Status == v1.ConditionTrue {
+				summary.Ready++
+			}
+		}
+	}
+
+	return summary
+}
+
+// desiredReplicas returns the number of replicas of a workload, 1 when not specified
+func desiredReplicas(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+
+	return *replicas
+}
+
+func summarizeDeployments(deployments []appsv1.Deployment) WorkloadCount {
+	count := WorkloadCount{Total: len(deployments)}
+
+	for _, deployment := range deployments {
+		if deployment.Status.ReadyReplicas >= desiredReplicas(deployment.Spec.Replicas) {
+			count.Ready++
+		}
+	}
+
+	return count
+}
+
+func summarizeStatefulSets(statefulSets []appsv1.StatefulSet) WorkloadCount {
+	count := WorkloadCount{Total: len(statefulSets)}
+
+	for _, statefulSet := range statefulSets {
+		if statefulSet.Status.ReadyReplicas >= desiredReplicas(statefulSet.Spec.Replicas) {
+			count.Ready++
+		}
+	}
+
+	return count
+}
+
+func summarizeDaemonSets(daemonSets []appsv1.DaemonSet) WorkloadCount {
+	count := WorkloadCount{Total: len(daemonSets)}
+
+	for _, daemonSet := range daemonSets {
+		if daemonSet.Status.NumberReady >= daemonSet.Status.DesiredNumberScheduled {
+			count.Ready++
+		}
+	}
+
+	return count
+}
+
+func summarizePods(pods []v1.Pod) PodCount {
+	count := PodCount{Total: len(pods)}
+
+	for _, pod := range pods {
+		switch pod.Status.Phase {
+		case v1.PodRunning:
+			count.Running++
+		case v1.PodPending:
+			count.Pending++
+		case v1.PodSucceeded:
+			count.Succeeded++
+		case v1.PodFailed:
+			count.Failed++
+		}
+	}
+
+	return count
+}
+
+func summarizeVolumeClaims(claims []v1.PersistentVolumeClaim) VolumeClaimSummary {
+	summary := VolumeClaimSummary{Count: len(claims)}
+
+	for _, claim := range claims {
+		summary.RequestedStorage += claim.Spec.Resources.Requests.Storage().Value()
+
+		if claim.Status.Phase == v1.ClaimBound {
+			summary.Bound++
+			summary.CapacityStorage += claim.Status.Capacity.Storage().Value()
+		}
+	}
+
+	return summary
+}
+
+type nodeMetricsList struct {
+	Items []struct {
+		Usage v1.ResourceList `json:"usage"`
+	} `json:"items"`
+}
+
+func getClusterResourceUsage(ctx context.Context, cli *kubernetes.Clientset) (*ClusterResourceUsage, error) {
+	data, err := cli.RESTClient().Get().AbsPath(nodeMetricsPath).DoRaw(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseNodeMetrics(data)
+}
+
+func parseNodeMetrics(data []byte) (*ClusterResourceUsage, error) {
+	var metrics nodeMetricsList
+	if err := json.Unmarshal(data, &metrics); err != nil {
+		return nil, err
+	}
+
+	usage := &ClusterResourceUsage{}
+	for _, item := range metrics.Items {
+		usage.CPU += item.Usage.Cpu().MilliValue()
+		usage.Memory += item.Usage.Memory().Value()
+	}
+
+	return usage, nil
+}
@@ -0,0 +1,62 @@
+package kubernetes
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestSummarizeDeployments(t *testing.T) {
+	three := int32(3)
+
+	deployments := []appsv1.Deployment{
+		{Spec: appsv1.DeploymentSpec{Replicas: &three}, Status: appsv1.DeploymentStatus{ReadyReplicas: 3}},
+		{Spec: appsv1.DeploymentSpec{Replicas: &three}, Status: appsv1.DeploymentStatus{ReadyReplicas: 1}},
+		{Status: appsv1.DeploymentStatus{ReadyReplicas: 1}},
+	}
+
+	count := summarizeDeployments(deployments)
+	if count.Total != 3 || count.Ready != 2 {
+		t.Fatalf("expected 2 ready deployments out of 3, got %+v", count)
+	}
+}
+
+func TestSummarizeVolumeClaims(t *testing.T) {
+	claim := func(request string, phase v1.PersistentVolumeClaimPhase, capacity string) v1.PersistentVolumeClaim {
+		c := v1.PersistentVolumeClaim{Status: v1.PersistentVolumeClaimStatus{Phase: phase}}
+		c.Spec.Resources.Requests = v1.ResourceList{v1.ResourceStorage: resource.MustParse(request)}
+		if capacity != "" {
+			c.Status.Capacity = v1.ResourceList{v1.ResourceStorage: resource.MustParse(capacity)}
+		}
+
+		return c
+	}
+
+	summary := summarizeVolumeClaims([]v1.PersistentVolumeClaim{
+		claim("1Gi", v1.ClaimBound, "2Gi"),
+		claim("1Gi", v1.ClaimPending, ""),
+	})
+
+	expected := VolumeClaimSummary{Count: 2, Bound: 1, RequestedStorage: 2 << 30, CapacityStorage: 2 << 30}
+	if summary != expected {
+		t.Fatalf("expected %+v, got %+v", expected, summary)
+	}
+}
+
+func TestParseNodeMetrics(t *testing.T) {
+	data := []byte(`{"kind":"NodeMetricsList","items":[
+		{"metadata":{"name":"a"},"usage":{"cpu":"250m","memory":"1Gi"}},
+		{"metadata":{"name":"b"},"usage":{"cpu":"1500000000n","memory":"512Mi"}}
+	]}`)
+
+	usage, err := parseNodeMetrics(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if usage.CPU != 1750 || usage.Memory != 1536<<20 {
+		t.Fatalf("unexpected usage %+v", usage)
+	}
+}
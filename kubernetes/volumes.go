@@ -0,0 +1,171 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/rs/zerolog/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// nodeStatsSummaryPath is the path of the stats summary of the kubelet, through the proxy of the API server
+	nodeStatsSummaryPath = "/api/v1/nodes/%s/proxy/stats/summary"
+	// nearFullVolumeRatio is the used ratio of the capacity from which a volume is reported as near full
+	nearFullVolumeRatio = 0.85
+)
+
+// VolumeUsageReport represents the usage of the persistent volume claims mounted by the pods, as measured by the
+// kubelets. The claims that are not mounted are not measured.
+type VolumeUsageReport struct {
+	// Measured is the number of claims whose usage was measured
+	Measured       int   `json:"Measured"`
+	CapacityBytes  int64 `json:"CapacityBytes"`
+	UsedBytes      int64 `json:"UsedBytes"`
+	AvailableBytes int64 `json:"AvailableBytes"`
+	// NearFull lists the claims using at least 85% of their capacity or of their inodes
+	NearFull []VolumeUsage `json:"NearFull"`
+	// UnreachableNodes lists the nodes whose kubelet could not be queried
+	UnreachableNodes []string `json:"UnreachableNodes,omitempty"`
+}
+
+// VolumeUsage represents the usage of a persistent volume claim
+type VolumeUsage struct {
+	Namespace      string  `json:"Namespace"`
+	Claim          string  `json:"Claim"`
+	Node           string  `json:"Node"`
+	CapacityBytes  int64   `json:"CapacityBytes"`
+	UsedBytes      int64   `json:"UsedBytes"`
+	AvailableBytes int64   `json:"AvailableBytes"`
+	UsedRatio      float64 `json:"UsedRatio"`
+	InodesUsed     int64   `json:"InodesUsed,omitempty"`
+	Inodes         int64   `json:"Inodes,omitempty"`
+}
+
+// statsSummary is the part of the stats summary of the kubelet describing the volumes of the pods
+type statsSummary struct {
+	Pods []struct {
+		Volumes []struct {
+			CapacityBytes  *int64 `json:"capacityBytes"`
+			UsedBytes      *int64 `json:"usedBytes"`
+			AvailableBytes *int64 `json:"availableBytes"`
+			Inodes         *int64 `json:"inodes"`
+			InodesUsed     *int64 `json:"inodesUsed"`
+			PVCRef         *struct {
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"pvcRef"`
+		} `json:"volume"`
+	} `json:"pods"`
+}
+
+// GetVolumeUsageReport returns the usage of the persistent volume claims, queried from the kubelet of each node
+func GetVolumeUsageReport(ctx context.Context) (*VolumeUsageReport, error) {
+	cli, err := buildLocalClient()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := cli.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &VolumeUsageReport{NearFull: []VolumeUsage{}}
+	seen := map[string]bool{}
+
+	for _, node := range nodes.Items {
+		data, err := cli.RESTClient().Get().AbsPath(fmt.Sprintf(nodeStatsSummaryPath, node.Name)).DoRaw(ctx)
+		if err != nil {
+			log.Debug().Err(err).Str("node", node.Name).Msg("unable to retrieve the stats summary of the kubelet")
+
+			report.UnreachableNodes = append(report.UnreachableNodes, node.Name)
+
+			continue
+		}
+
+		volumes, err := parseVolumeStats(node.Name, data)
+		if err != nil {
+			log.Debug().Err(err).Str("node", node.Name).Msg("unable to parse the stats summary of the kubelet")
+
+			report.UnreachableNodes = append(report.UnreachableNodes, node.Name)
+
+			continue
+		}
+
+		for _, volume := range volumes {
+			// a claim mounted by several pods is reported by each of them
+			key := volume.Namespace + "/" + volume.Claim
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			report.add(volume)
+		}
+	}
+
+	sort.Slice(report.NearFull, func(i, j int) bool {
+		return report.NearFull[i].UsedRatio > report.NearFull[j].UsedRatio
+	})
+
+	return report, nil
+}
+
+func (report *VolumeUsageReport) add(volume VolumeUsage) {
+	report.Measured++
+	report.CapacityBytes += volume.CapacityBytes
+	report.UsedBytes += volume.UsedBytes
+	report.AvailableBytes += volume.AvailableBytes
+
+	inodesFull := volume.Inodes > 0 && float64(volume.InodesUsed)/float64(volume.Inodes) >= nearFullVolumeRatio
+	if volume.UsedRatio >= nearFullVolumeRatio || inodesFull {
+		report.NearFull = append(report.NearFull, volume)
+	}
+}
+
+// parseVolumeStats returns the usage of the persistent volume claims found in the stats summary of a kubelet
+func parseVolumeStats(node string, data []byte) ([]VolumeUsage, error) {
+	var summary statsSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return nil, err
+	}
+
+	value := func(v *int64) int64 {
+		if v == nil {
+			return 0
+		}
+
+		return *v
+	}
+
+	var volumes []VolumeUsage
+	for _, pod := range summary.Pods {
+		for _, volume := range pod.Volumes {
+			if volume.PVCRef == nil || volume.CapacityBytes == nil {
+				continue
+			}
+
+			usage := VolumeUsage{
+				Namespace:      volume.PVCRef.Namespace,
+				Claim:          volume.PVCRef.Name,
+				Node:           node,
+				CapacityBytes:  value(volume.CapacityBytes),
+				UsedBytes:      value(volume.UsedBytes),
+				AvailableBytes: value(volume.AvailableBytes),
+				Inodes:         value(volume.Inodes),
+				InodesUsed:     value(volume.InodesUsed),
+			}
+
+			if usage.CapacityBytes > 0 {
+				usage.UsedRatio = float64(usage.UsedBytes) / float64(usage.CapacityBytes)
+			}
+
+			volumes = append(volumes, usage)
+		}
+	}
+
+	return volumes, nil
+}
@@ -0,0 +1,40 @@
+package kubernetes
+
+import (
+	"testing"
+)
+
+func TestParseVolumeStats(t *testing.T) {
+	data := []byte(`{"node":{"nodeName":"a"},"pods":[
+		{"podRef":{"name":"db-0","namespace":"prod"},"volume":[
+			{"name":"data","capacityBytes":1000,"usedBytes":900,"availableBytes":100,"inodes":100,"inodesUsed":10,"pvcRef":{"name":"data-db-0","namespace":"prod"}},
+			{"name":"kube-api-access","capacityBytes":1000,"usedBytes":10}
+		]},
+		{"podRef":{"name":"web","namespace":"prod"},"volume":[
+			{"name":"cache","capacityBytes":1000,"usedBytes":100,"availableBytes":900,"inodes":100,"inodesUsed":95,"pvcRef":{"name":"cache","namespace":"prod"}},
+			{"name":"uploads","capacityBytes":1000,"usedBytes":100,"availableBytes":900,"pvcRef":{"name":"uploads","namespace":"prod"}}
+		]}
+	]}`)
+
+	volumes, err := parseVolumeStats("a", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(volumes) != 3 {
+		t.Fatalf("expected the 3 persistent volume claims, got %+v", volumes)
+	}
+
+	report := &VolumeUsageReport{}
+	for _, volume := range volumes {
+		report.add(volume)
+	}
+
+	if report.Measured != 3 || report.CapacityBytes != 3000 || report.UsedBytes != 1100 {
+		t.Fatalf("unexpected totals %+v", report)
+	}
+
+	if len(report.NearFull) != 2 || report.NearFull[0].Claim != "data-db-0" || report.NearFull[0].UsedRatio != 0.9 || report.NearFull[1].Claim != "cache" {
+		t.Fatalf("expected data-db-0 and cache to be near full, got %+v", report.NearFull)
+	}
+}
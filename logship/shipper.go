@@ -0,0 +1,309 @@
+// Package logship ships the logs of the containers of the host to an external sink (Loki, syslog or a HTTP
+// endpoint), so that the logs of the Edge devices can be queried without opening their tunnel.
+package logship
+
+import (
+	"context"
+	"errors"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/rs/zerolog/log"
+)
+
+// ShipLabel is the former label selecting the containers whose logs are shipped, agent.ContainerLabelLogShip is
+// preferred
+const ShipLabel = "io.portainer.agent.log-shipping"
+
+// Labels added to the shipped lines
+const (
+	LabelEndpointID = "endpoint_id"
+	LabelStack      = "stack"
+	LabelContainer  = "container"
+	LabelStream     = "stream"
+)
+
+const (
+	eventsRetryDelay = 10 * time.Second
+	minSendBackoff   = time.Second
+	maxSendBackoff   = time.Minute
+)
+
+// stackLabels are the labels of the containers holding the name of their stack
+var stackLabels = []string{"com.docker.compose.project", "com.docker.stack.namespace"}
+
+// ErrBatchRejected is returned by the sinks when a batch is refused and must not be sent again
+var ErrBatchRejected = errors.New("the batch was rejected by the log sink")
+
+// Entry represents a line written by a container
+type Entry struct {
+	Time    time.Time
+	Message string
+	Labels  map[string]string
+}
+
+// Sink sends the lines to an external log system
+type Sink interface {
+	Send(ctx context.Context, entries []Entry) error
+}
+
+// Options represents the containers whose logs are shipped and how they are batched
+type Options struct {
+	// Containers are the patterns of the names of the containers whose logs are shipped, as supported by path.Match
+	Containers []string
+	// BatchSize is the number of lines from which a batch is sent before the flush interval
+	BatchSize     int
+	FlushInterval time.Duration
+	// EndpointID returns the identifier of the environment of the agent in Portainer, 0 when unknown
+	EndpointID func() int
+}
+
+// Shipper tails the logs of the selected containers and sends them to a sink in batches. The tailing is paused
+// while the sink is unavailable, the lines written in the meantime are sent once it is available again.
+type Shipper struct {
+	sink     Sink
+	sinkKind string
+	options  Options
+	entries  chan Entry
+
+	mu sync.Mutex
+	// tailed are the containers whose logs are tailed
+	tailed map[string]struct{}
+	// positions are the times of the last line shipped for each container, so that the tailing resumes from there
+	positions map[string]time.Time
+}
+
+// NewShipper returns a pointer to a Shipper sending the lines to sink
+func NewShipper(sink Sink, options Options) *Shipper {
+	return &Shipper{
+		sink:      sink,
+		sinkKind:  sinkKind(sink),
+		options:   options,
+		entries:   make(chan Entry, options.BatchSize),
+		tailed:    map[string]struct{}{},
+		positions: map[string]time.Time{},
+	}
+}
+
+// Run ships the logs of the selected containers until ctx is done. The containers started later are tailed from the
+// events of the Docker engine, the stream of events is opened again when it fails.
+func (shipper *Shipper) Run(ctx context.Context) {
+	go shipper.ship(ctx)
+
+	for {
+		shipper.tailRunningContainers(ctx)
+
+		err := docker.WatchEvents(ctx, func(message events.Message) {
+			if message.Type != events.ContainerEventType {
+				return
+			}
+
+			switch message.Action {
+			case "start":
+				if shipper.selected(message.Actor.Attributes["name"], message.Actor.Attributes) {
+					shipper.tail(ctx, message.Actor.ID, message.Actor.Attributes["name"], message.Actor.Attributes)
+				}
+			case "destroy":
+				shipper.mu.Lock()
+				delete(shipper.positions, message.Actor.ID)
+				shipper.mu.Unlock()
+			}
+		})
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Warn().Err(err).Msg("the stream of Docker events used to ship the container logs failed")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(eventsRetryDelay):
+		}
+	}
+}
+
+func (shipper *Shipper) tailRunningContainers(ctx context.Context) {
+	containers, err := docker.ListRunningContainers(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("unable to list the containers whose logs are shipped")
+
+		return
+	}
+
+	for _, container := range containers {
+		var name string
+		if len(container.Names) > 0 {
+			name = strings.TrimPrefix(container.Names[0], "/")
+		}
+
+		if shipper.selected(name, container.Labels) {
+			shipper.tail(ctx, container.ID, name, container.Labels)
+		}
+	}
+}
+
+// selected returns true when the logs of the container must be shipped. The log shipping label takes precedence
+// over the name patterns, a container labelled with another kind of sink is not shipped.
+func (shipper *Shipper) selected(name string, labels map[string]string) bool {
+	if value, ok := labels[agent.ContainerLabelLogShip]; ok {
+		if enabled, set := docker.LabelOptIn(labels, agent.ContainerLabelLogShip); set {
+			return enabled
+		}
+
+		return value == shipper.sinkKind
+	}
+
+	if labels[ShipLabel] == "true" {
+		return true
+	}
+
+	for _, pattern := range shipper.options.Containers {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// tail ships the logs of the container in the background until it stops, unless they are already tailed
+func (shipper *Shipper) tail(ctx context.Context, containerID, name string, containerLabels map[string]string) {
+	shipper.mu.Lock()
+	defer shipper.mu.Unlock()
+
+	if _, ok := shipper.tailed[containerID]; ok {
+		return
+	}
+	shipper.tailed[containerID] = struct{}{}
+
+	// The lines written before the agent started are not shipped
+	since, ok := shipper.positions[containerID]
+	if !ok {
+		since = time.Now()
+	}
+
+	labels := map[string]string{LabelContainer: name}
+	for _, label := range stackLabels {
+		if stack := containerLabels[label]; stack != "" {
+			labels[LabelStack] = stack
+			break
+		}
+	}
+
+	go func() {
+		err := docker.FollowContainerLogs(ctx, containerID, since, func(line docker.LogLine) {
+			shipper.enqueue(ctx, containerID, labels, line)
+		})
+		if err != nil && ctx.Err() == nil {
+			log.Debug().Err(err).Str("container", name).Msg("the stream of the logs of the container was interrupted")
+		}
+
+		shipper.mu.Lock()
+		delete(shipper.tailed, containerID)
+		shipper.mu.Unlock()
+	}()
+}
+
+// enqueue queues the line, it blocks while the queue is full
+func (shipper *Shipper) enqueue(ctx context.Context, containerID string, containerLabels map[string]string, line docker.LogLine) {
+	entry := Entry{
+		Time:    line.Time,
+		Message: line.Message,
+		Labels:  shipper.entryLabels(containerLabels, line.Stream),
+	}
+
+	select {
+	case shipper.entries <- entry:
+	case <-ctx.Done():
+		return
+	}
+
+	shipper.mu.Lock()
+	// The lines of the same time are not shipped again when the tailing resumes
+	shipper.positions[containerID] = line.Time.Add(time.Nanosecond)
+	shipper.mu.Unlock()
+}
+
+func (shipper *Shipper) entryLabels(containerLabels map[string]string, stream string) map[string]string {
+	labels := make(map[string]string, len(containerLabels)+2)
+	for key, value := range containerLabels {
+		labels[key] = value
+	}
+
+	labels[LabelStream] = stream
+
+	if shipper.options.EndpointID != nil {
+		if endpointID := shipper.options.EndpointID(); endpointID != 0 {
+			labels[LabelEndpointID] = strconv.Itoa(endpointID)
+		}
+	}
+
+	return labels
+}
+
+// ship sends the queued lines once the batch size is reached or at each flush interval
+func (shipper *Shipper) ship(ctx context.Context) {
+	ticker := time.NewTicker(shipper.options.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Entry, 0, shipper.options.BatchSize)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case entry := <-shipper.entries:
+			batch = append(batch, entry)
+			if len(batch) < shipper.options.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+
+		shipper.send(ctx, batch)
+		batch = batch[:0]
+	}
+}
+
+// send sends the batch until it is accepted or rejected by the sink, with an exponential backoff
+func (shipper *Shipper) send(ctx context.Context, batch []Entry) {
+	backoff := minSendBackoff
+
+	for {
+		err := shipper.sink.Send(ctx, batch)
+		if err == nil {
+			return
+		}
+
+		if errors.Is(err, ErrBatchRejected) {
+			log.Warn().Err(err).Int("lines", len(batch)).Msg("the container logs were rejected by the log sink, dropping them")
+
+			return
+		}
+
+		log.Debug().Err(err).Dur("backoff", backoff).Msg("unable to ship the container logs")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxSendBackoff {
+			backoff = maxSendBackoff
+		}
+	}
+}
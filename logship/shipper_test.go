@@ -0,0 +1,31 @@
+package logship
+
+import (
+	"testing"
+
+	"github.com/portainer/agent"
+)
+
+func TestShipper_Selected(t *testing.T) {
+	shipper := NewShipper(&lokiSink{}, Options{Containers: []string{"web-*"}, BatchSize: 1})
+
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		expected bool
+	}{
+		{"web-1", nil, true},
+		{"db", nil, false},
+		{"db", map[string]string{agent.ContainerLabelLogShip: "true"}, true},
+		{"db", map[string]string{agent.ContainerLabelLogShip: "loki"}, true},
+		{"db", map[string]string{agent.ContainerLabelLogShip: "syslog"}, false},
+		{"web-1", map[string]string{agent.ContainerLabelLogShip: "false"}, false},
+		{"db", map[string]string{ShipLabel: "true"}, true},
+	}
+
+	for _, test := range tests {
+		if selected := shipper.selected(test.name, test.labels); selected != test.expected {
+			t.Errorf("expected %s with %v to be selected: %t, got %t", test.name, test.labels, test.expected, selected)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package logship
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	agentnet "github.com/portainer/agent/net"
+)
+
+const (
+	lokiDefaultPath = "/loki/api/v1/push"
+	sendTimeout     = 30 * time.Second
+	// maxErrorSize is the maximum size of an error response read from a sink
+	maxErrorSize = 4 * 1024
+)
+
+// NewSink returns the Sink at rawURL:
+//   - loki+http://[user:password@]host:port[/path][?tenant=id] or loki+https://... for the push API of Loki
+//   - syslog+udp://host:port, syslog+tcp://... or syslog+tls://... for a syslog server (RFC 5424)
+//   - http://[user:password@]host[:port]/path or https://... for an endpoint receiving the lines in JSON
+func NewSink(rawURL string) (Sink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Hostname() == "" {
+		return nil, errors.New("the log sink URL must contain a host")
+	}
+
+	switch u.Scheme {
+	case "loki+http", "loki+https":
+		return newLokiSink(u), nil
+	case "syslog+udp", "syslog+tcp", "syslog+tls":
+		return newSyslogSink(u), nil
+	case "http", "https":
+		return &httpSink{endpoint: newHTTPEndpoint(u)}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported log sink scheme: %q", u.Scheme)
+}
+
+// sinkKind returns the kind of the sink as used in the values of the log shipping label
+func sinkKind(sink Sink) string {
+	switch sink.(type) {
+	case *lokiSink:
+		return "loki"
+	case *syslogSink:
+		return "syslog"
+	case *httpSink:
+		return "http"
+	}
+
+	return ""
+}
+
+// httpEndpoint sends the batches to a HTTP server
+type httpEndpoint struct {
+	url     string
+	user    *url.Userinfo
+	headers http.Header
+	client  *http.Client
+}
+
+func newHTTPEndpoint(u *url.URL) *httpEndpoint {
+	endpoint := &httpEndpoint{
+		user:    u.User,
+		headers: http.Header{},
+	}
+
+	target := *u
+	target.User = nil
+	endpoint.url = target.String()
+
+	// The default transport enforces the egress policy of the agent
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = agentnet.MeterDialContext(agentnet.BandwidthLogShipping, transport.DialContext)
+
+	endpoint.client = &http.Client{Transport: transport, Timeout: sendTimeout}
+
+	return endpoint
+}
+
+func (endpoint *httpEndpoint) post(ctx context.Context, contentType string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header = endpoint.headers.Clone()
+	req.Header.Set("Content-Type", contentType)
+
+	if endpoint.user != nil {
+		password, _ := endpoint.user.Password()
+		req.SetBasicAuth(endpoint.user.Username(), password)
+	}
+
+	resp, err := endpoint.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorSize))
+
+	err = fmt.Errorf("the log sink answered with the status code %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		err = fmt.Errorf("%w: %s", ErrBatchRejected, err)
+	}
+
+	return err
+}
+
+// lokiSink sends the lines to the push API of Loki, the labels of the lines are the labels of the Loki streams
+type lokiSink struct {
+	endpoint *httpEndpoint
+}
+
+type lokiPushRequest struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func newLokiSink(u *url.URL) *lokiSink {
+	target := *u
+	target.Scheme = strings.TrimPrefix(u.Scheme, "loki+")
+
+	if target.Path == "" || target.Path == "/" {
+		target.Path = lokiDefaultPath
+	}
+
+	query := target.Query()
+	tenant := query.Get("tenant")
+	query.Del("tenant")
+	target.RawQuery = query.Encode()
+
+	endpoint := newHTTPEndpoint(&target)
+	if tenant != "" {
+		endpoint.headers.Set("X-Scope-OrgID", tenant)
+	}
+
+	return &lokiSink{endpoint: endpoint}
+}
+
+func (sink *lokiSink) Send(ctx context.Context, entries []Entry) error {
+	body, err := json.Marshal(buildLokiPushRequest(entries))
+	if err != nil {
+		return err
+	}
+
+	return sink.endpoint.post(ctx, "application/json", body)
+}
+
+// buildLokiPushRequest groups the entries by label set, in chronological order
+func buildLokiPushRequest(entries []Entry) lokiPushRequest {
+	sorted := make([]Entry, len(entries))
+	copy(sorted, entries)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+
+	request := lokiPushRequest{}
+	streams := map[string]int{}
+
+	for _, entry := range sorted {
+		key := labelsKey(entry.Labels)
+
+		i, ok := streams[key]
+		if !ok {
+			i = len(request.Streams)
+			streams[key] = i
+			request.Streams = append(request.Streams, lokiStream{Stream: entry.Labels})
+		}
+
+		request.Streams[i].Values = append(request.Streams[i].Values, [2]string{strconv.FormatInt(entry.Time.UnixNano(), 10), entry.Message})
+	}
+
+	return request
+}
+
+func labelsKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[key]))
+		b.WriteByte(',')
+	}
+
+	return b.String()
+}
+
+// httpSink sends the lines to a HTTP endpoint as a JSON array
+type httpSink struct {
+	endpoint *httpEndpoint
+}
+
+type httpEntry struct {
+	Time    time.Time         `json:"time"`
+	Message string            `json:"message"`
+	Labels  map[string]string `json:"labels"`
+}
+
+func (sink *httpSink) Send(ctx context.Context, entries []Entry) error {
+	payload := make([]httpEntry, 0, len(entries))
+	for _, entry := range entries {
+		payload = append(payload, httpEntry(entry))
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return sink.endpoint.post(ctx, "application/json", body)
+}
@@ -0,0 +1,98 @@
+package logship
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLokiSink_Send(t *testing.T) {
+	var received lokiPushRequest
+	var tenant string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != lokiDefaultPath {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+
+		tenant = r.Header.Get("X-Scope-OrgID")
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink, err := NewSink(strings.Replace(server.URL, "http://", "loki+http://", 1) + "?tenant=edge")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	web := map[string]string{LabelContainer: "web", LabelStream: "stdout"}
+	db := map[string]string{LabelContainer: "db", LabelStream: "stdout"}
+
+	err = sink.Send(context.Background(), []Entry{
+		{Time: now.Add(time.Second), Message: "second", Labels: web},
+		{Time: now, Message: "first", Labels: map[string]string{LabelStream: "stdout", LabelContainer: "web"}},
+		{Time: now, Message: "db", Labels: db},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tenant != "edge" {
+		t.Errorf("expected the edge tenant, got %q", tenant)
+	}
+
+	if len(received.Streams) != 2 {
+		t.Fatalf("expected 2 streams, got %+v", received.Streams)
+	}
+
+	values := received.Streams[0].Values
+	if received.Streams[0].Stream[LabelContainer] != "web" || len(values) != 2 || values[0][1] != "first" || values[1][0] != "1700000001000000000" {
+		t.Fatalf("unexpected stream %+v", received.Streams[0])
+	}
+}
+
+func TestHTTPSink_Rejected(t *testing.T) {
+	status := http.StatusBadRequest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink, err := NewSink(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []Entry{{Time: time.Now(), Message: "line"}}
+
+	if err := sink.Send(context.Background(), entries); !errors.Is(err, ErrBatchRejected) {
+		t.Fatalf("expected the batch to be rejected, got %v", err)
+	}
+
+	status = http.StatusServiceUnavailable
+	if err := sink.Send(context.Background(), entries); err == nil || errors.Is(err, ErrBatchRejected) {
+		t.Fatalf("expected a retryable error, got %v", err)
+	}
+}
+
+func TestFormatSyslogMessage(t *testing.T) {
+	entry := Entry{
+		Time:    time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC),
+		Message: "connection refused",
+		Labels:  map[string]string{LabelContainer: "web", LabelStream: "stderr", LabelStack: `a"b]`},
+	}
+
+	expected := `<131>1 2023-11-14T22:13:20Z host web - - [labels@32473 container="web" stack="a\"b\]" stream="stderr"] connection refused`
+
+	if message := formatSyslogMessage(entry, "host"); message != expected {
+		t.Fatalf("expected %s, got %s", expected, message)
+	}
+}
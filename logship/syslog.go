@@ -0,0 +1,199 @@
+package logship
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent/docker"
+	agentnet "github.com/portainer/agent/net"
+)
+
+const (
+	syslogDefaultPort = "514"
+	syslogDialTimeout = 10 * time.Second
+	// syslogFacility is the local0 facility
+	syslogFacility = 16
+	// syslogSDID is the identifier of the structured data holding the labels of the lines, 32473 is the private
+	// enterprise number reserved for the documentation
+	syslogSDID = "labels@32473"
+	// syslogMaxAppName is the maximum length of the APP-NAME field
+	syslogMaxAppName = 48
+)
+
+// Severities of the lines written on the standard output and the standard error of the containers
+const (
+	syslogSeverityError = 3
+	syslogSeverityInfo  = 6
+)
+
+// syslogSink sends the lines to a syslog server using the RFC 5424 format. The messages are framed with their
+// length on the stream transports (RFC 6587). The connection is opened on the first batch and opened again after
+// a failure.
+type syslogSink struct {
+	network   string
+	addr      string
+	tlsConfig *tls.Config
+	hostname  string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func newSyslogSink(u *url.URL) *syslogSink {
+	port := u.Port()
+	if port == "" {
+		port = syslogDefaultPort
+	}
+
+	sink := &syslogSink{
+		network:  strings.TrimPrefix(u.Scheme, "syslog+"),
+		addr:     net.JoinHostPort(u.Hostname(), port),
+		hostname: "-",
+	}
+
+	if sink.network == "tls" {
+		sink.network = "tcp"
+		sink.tlsConfig = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+	}
+
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		sink.hostname = hostname
+	}
+
+	return sink
+}
+
+func (sink *syslogSink) Send(ctx context.Context, entries []Entry) error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	if sink.conn == nil {
+		if err := sink.open(ctx); err != nil {
+			return err
+		}
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		sink.conn.SetWriteDeadline(deadline)
+	} else {
+		sink.conn.SetWriteDeadline(time.Now().Add(sendTimeout))
+	}
+
+	for _, entry := range entries {
+		message := formatSyslogMessage(entry, sink.hostname)
+
+		// Each datagram is a message, the messages sent on a stream are prefixed with their length
+		if sink.network == "tcp" {
+			message = fmt.Sprintf("%d %s", len(message), message)
+		}
+
+		if _, err := sink.conn.Write([]byte(message)); err != nil {
+			sink.conn.Close()
+			sink.conn = nil
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// open connects to the server, the lock must be held
+func (sink *syslogSink) open(ctx context.Context) error {
+	dialer := &net.Dialer{Timeout: syslogDialTimeout}
+
+	conn, err := dialer.DialContext(ctx, sink.network, sink.addr)
+	if err != nil {
+		return err
+	}
+
+	conn = agentnet.MeterConn(agentnet.BandwidthLogShipping, conn)
+
+	if sink.tlsConfig != nil {
+		tlsConn := tls.Client(conn, sink.tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+
+			return err
+		}
+
+		conn = tlsConn
+	}
+
+	sink.conn = conn
+
+	return nil
+}
+
+// formatSyslogMessage returns the entry in the RFC 5424 format, the name of the container is the APP-NAME and the
+// labels are sent as structured data
+func formatSyslogMessage(entry Entry, hostname string) string {
+	severity := syslogSeverityInfo
+	if entry.Labels[LabelStream] == docker.LogStreamStderr {
+		severity = syslogSeverityError
+	}
+
+	appName := syslogHeaderField(entry.Labels[LabelContainer], syslogMaxAppName)
+
+	keys := make([]string, 0, len(entry.Labels))
+	for key := range entry.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	structuredData := "-"
+	if len(keys) > 0 {
+		var b strings.Builder
+		b.WriteString("[" + syslogSDID)
+		for _, key := range keys {
+			fmt.Fprintf(&b, ` %s="%s"`, key, escapeSDParam(entry.Labels[key]))
+		}
+		b.WriteString("]")
+
+		structuredData = b.String()
+	}
+
+	return fmt.Sprintf("<%d>1 %s %s %s - - %s %s",
+		syslogFacility*8+severity,
+		entry.Time.UTC().Format(time.RFC3339Nano),
+		syslogHeaderField(hostname, 255),
+		appName,
+		structuredData,
+		entry.Message,
+	)
+}
+
+// syslogHeaderField returns value truncated to max, with the characters not allowed in the header fields replaced,
+// or the nil value when empty
+func syslogHeaderField(value string, max int) string {
+	if value == "" {
+		return "-"
+	}
+
+	field := []byte(value)
+	if len(field) > max {
+		field = field[:max]
+	}
+
+	for i, c := range field {
+		if c <= ' ' || c > '~' {
+			field[i] = '_'
+		}
+	}
+
+	return string(field)
+}
+
+var sdParamEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+func escapeSDParam(value string) string {
+	return sdParamEscaper.Replace(value)
+}
@@ -0,0 +1,87 @@
+package maintenance
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Schedule represents the maintenance windows during which the disruptive operations (stack updates, prunes,
+// host reboots) are executed. The operations requested outside the windows are deferred until the next window
+// opens. A schedule without windows allows the operations at any time.
+type Schedule struct {
+	windows []Window
+}
+
+// defaultSchedule is read by the deferred operations while the schedule can be enforced
+var defaultSchedule atomic.Pointer[Schedule]
+
+// NewSchedule parses the specified windows, see ParseWindow for their format
+func NewSchedule(windows []string) (*Schedule, error) {
+	schedule := &Schedule{}
+
+	for _, value := range windows {
+		window, err := ParseWindow(value)
+		if err != nil {
+			return nil, err
+		}
+
+		schedule.windows = append(schedule.windows, window)
+	}
+
+	return schedule, nil
+}
+
+// IsOpen returns true when the disruptive operations are allowed at t
+func (schedule *Schedule) IsOpen(t time.Time) bool {
+	if len(schedule.windows) == 0 {
+		return true
+	}
+
+	for _, window := range schedule.windows {
+		if window.Contains(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NextOpening returns t when the schedule is open at t, or the time at which the next window opens
+func (schedule *Schedule) NextOpening(t time.Time) time.Time {
+	if schedule.IsOpen(t) {
+		return t
+	}
+
+	var next time.Time
+	for _, window := range schedule.windows {
+		start := window.nextStart(t)
+		if next.IsZero() || start.Before(next) {
+			next = start
+		}
+	}
+
+	return next
+}
+
+// EnforceSchedule makes schedule the maintenance schedule applied to the disruptive operations of the agent
+func EnforceSchedule(schedule *Schedule) {
+	defaultSchedule.Store(schedule)
+}
+
+// IsOpen returns true when the disruptive operations are allowed now by the enforced schedule, if any
+func IsOpen() bool {
+	schedule := defaultSchedule.Load()
+
+	return schedule == nil || schedule.IsOpen(time.Now())
+}
+
+// NextOpening returns the time at which the next window of the enforced schedule opens, or now when the
+// disruptive operations are currently allowed
+func NextOpening() time.Time {
+	schedule := defaultSchedule.Load()
+	if schedule == nil {
+		return time.Now()
+	}
+
+	return schedule.NextOpening(time.Now())
+}
@@ -0,0 +1,60 @@
+package maintenance
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleIsOpen(t *testing.T) {
+	schedule, err := NewSchedule([]string{"Sat-Sun 10:00-12:00", "Mon-Fri 22:00-02:00"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// 2024-01-06 is a Saturday
+	tests := map[string]bool{
+		"2024-01-06 10:30": true,
+		"2024-01-06 12:00": false,
+		"2024-01-07 11:59": true,
+		"2024-01-08 10:30": false,
+		"2024-01-08 23:00": true,
+		"2024-01-09 01:59": true,
+		"2024-01-09 02:00": false,
+		"2024-01-06 01:00": true, // the Friday window ends on Saturday
+		"2024-01-07 01:00": false,
+	}
+
+	for value, expected := range tests {
+		at, _ := time.ParseInLocation("2006-01-02 15:04", value, time.UTC)
+		if open := schedule.IsOpen(at); open != expected {
+			t.Errorf("IsOpen(%s) = %t, expected %t", value, open, expected)
+		}
+	}
+}
+
+func TestScheduleNextOpening(t *testing.T) {
+	schedule, err := NewSchedule([]string{"Sat 02:00-04:00", "Wed 22:00-23:00"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Thursday
+	at := time.Date(2024, 1, 4, 12, 0, 0, 0, time.UTC)
+	if next := schedule.NextOpening(at); !next.Equal(time.Date(2024, 1, 6, 2, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected next opening: %s", next)
+	}
+
+	// Saturday, after the window
+	at = time.Date(2024, 1, 6, 5, 0, 0, 0, time.UTC)
+	if next := schedule.NextOpening(at); !next.Equal(time.Date(2024, 1, 10, 22, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected next opening: %s", next)
+	}
+}
+
+func TestParseWindowErrors(t *testing.T) {
+	for _, value := range []string{"", "Sat", "Someday 02:00-04:00", "02:00-02:00", "25:00-26:00", "Mon 02:00"} {
+		if _, err := ParseWindow(value); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package maintenance
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Window represents a recurring period of the week during which the disruptive operations are allowed.
+// A window ending before its start time ends on the next day.
+type Window struct {
+	// days are the days on which the window starts, indexed by time.Weekday
+	days  [7]bool
+	start time.Duration
+	end   time.Duration
+}
+
+// ParseWindow parses a window in the [days ]HH:MM-HH:MM format, where days is a day (Sat) or a range of days
+// (Mon-Fri). The window applies to every day when the days are omitted. The times are in the local timezone.
+func ParseWindow(value string) (Window, error) {
+	var window Window
+
+	fields := strings.Fields(value)
+	if len(fields) == 0 || len(fields) > 2 {
+		return window, fmt.Errorf("invalid maintenance window %q, expected [days ]HH:MM-HH:MM", value)
+	}
+
+	if len(fields) == 1 {
+		for day := range window.days {
+			window.days[day] = true
+		}
+	} else {
+		err := window.parseDays(fields[0])
+		if err != nil {
+			return window, fmt.Errorf("invalid maintenance window %q: %w", value, err)
+		}
+	}
+
+	start, end, found := strings.Cut(fields[len(fields)-1], "-")
+	if !found {
+		return window, fmt.Errorf("invalid maintenance window %q, expected [days ]HH:MM-HH:MM", value)
+	}
+
+	var err error
+	if window.start, err = parseTimeOfDay(start); err != nil {
+		return window, fmt.Errorf("invalid maintenance window %q: %w", value, err)
+	}
+
+	if window.end, err = parseTimeOfDay(end); err != nil {
+		return window, fmt.Errorf("invalid maintenance window %q: %w", value, err)
+	}
+
+	if window.start == window.end {
+		return window, fmt.Errorf("invalid maintenance window %q: the window is empty", value)
+	}
+
+	return window, nil
+}
+
+func (window *Window) parseDays(value string) error {
+	first, last, isRange := strings.Cut(strings.ToLower(value), "-")
+
+	firstDay, ok := weekdays[first]
+	if !ok {
+		return fmt.Errorf("unknown day %q", first)
+	}
+
+	lastDay := firstDay
+	if isRange {
+		if lastDay, ok = weekdays[last]; !ok {
+			return fmt.Errorf("unknown day %q", last)
+		}
+	}
+
+	for day := firstDay; ; day = (day + 1) % 7 {
+		window.days[day] = true
+
+		if day == lastDay {
+			return nil
+		}
+	}
+}
+
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains returns true when t is inside the window
+func (window Window) Contains(t time.Time) bool {
+	offset := sinceMidnight(t)
+
+	if window.start < window.end {
+		return window.days[t.Weekday()] && offset >= window.start && offset < window.end
+	}
+
+	if window.days[t.Weekday()] && offset >= window.start {
+		return true
+	}
+
+	return window.days[(t.Weekday()+6)%7] && offset < window.end
+}
+
+// nextStart returns the first start of the window strictly after t
+func (window Window) nextStart(t time.Time) time.Time {
+	year, month, day := t.Date()
+
+	for i := 0; i <= 7; i++ {
+		start := time.Date(year, month, day+i, 0, 0, 0, 0, t.Location()).Add(window.start)
+		if start.After(t) && window.days[start.Weekday()] {
+			return start
+		}
+	}
+
+	return time.Time{}
+}
+
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+}
@@ -0,0 +1,369 @@
+package memory
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// smallHostMemory is the memory below which a zram swap is recommended when the host has none
+	smallHostMemory = 4 << 30
+	// pressureAlertThreshold is the share in percent of the last minute during which all the tasks stalled waiting
+	// for memory from which an alert is raised
+	pressureAlertThreshold = 10
+	// swapAlertThreshold is the share in percent of the swap used from which an alert is raised
+	swapAlertThreshold = 90
+	// recommendedSwappiness favors the swap to zram over the eviction of the page cache, the swap is cheap when it is
+	// compressed in memory
+	recommendedSwappiness = 100
+	// recommendedAlgorithm is the preferred compression algorithm of the zram device, lz4 is used when the kernel
+	// does not support it
+	recommendedAlgorithm = "zstd"
+)
+
+var (
+	procPath = "/proc"
+	sysPath  = "/sys"
+)
+
+var (
+	defaultService   *Service
+	defaultServiceMu sync.Mutex
+)
+
+// Report is the memory, swap and zram configuration of the host and its memory pressure
+type Report struct {
+	TotalBytes     uint64 `json:"TotalBytes"`
+	AvailableBytes uint64 `json:"AvailableBytes"`
+	SwapTotalBytes uint64 `json:"SwapTotalBytes"`
+	SwapFreeBytes  uint64 `json:"SwapFreeBytes"`
+	// Swappiness is the value of vm.swappiness, nil when it cannot be read
+	Swappiness *int   `json:"Swappiness,omitempty"`
+	Swaps      []Swap `json:"Swaps,omitempty"`
+	// ZRAM are the zram devices of the host, whether they are used as swap or not
+	ZRAM []ZRAMDevice `json:"ZRAM,omitempty"`
+	// Pressure is the memory pressure stall information of the host, nil when the kernel does not expose it
+	Pressure *Pressure `json:"Pressure,omitempty"`
+	// Recommendation is the zram configuration recommended for the host, nil when the host needs none
+	Recommendation *Recommendation `json:"Recommendation,omitempty"`
+	// LastApply is the outcome of the last application of the recommended zram configuration
+	LastApply *Apply `json:"LastApply,omitempty"`
+	// Alerts are the memory and swap issues of the host
+	Alerts []string `json:"Alerts,omitempty"`
+}
+
+// Swap is an active swap area of the host
+type Swap struct {
+	Device    string `json:"Device"`
+	Type      string `json:"Type"`
+	SizeBytes uint64 `json:"SizeBytes"`
+	UsedBytes uint64 `json:"UsedBytes"`
+	Priority  int    `json:"Priority"`
+}
+
+// ZRAMDevice is a compressed block device in memory
+type ZRAMDevice struct {
+	Name          string `json:"Name"`
+	Algorithm     string `json:"Algorithm,omitempty"`
+	DiskSizeBytes uint64 `json:"DiskSizeBytes"`
+	// OriginalBytes and CompressedBytes are the size of the data stored in the device before and after compression
+	OriginalBytes   uint64 `json:"OriginalBytes"`
+	CompressedBytes uint64 `json:"CompressedBytes"`
+}
+
+// Pressure is the share in percent of the last 10 and 60 seconds during which some or all of the tasks stalled
+// waiting for memory
+type Pressure struct {
+	Some10 float64 `json:"Some10"`
+	Some60 float64 `json:"Some60"`
+	Full10 float64 `json:"Full10"`
+	Full60 float64 `json:"Full60"`
+}
+
+// Recommendation is the zram swap recommended for a host with little memory and no zram swap
+type Recommendation struct {
+	DiskSizeBytes uint64 `json:"DiskSizeBytes"`
+	Algorithm     string `json:"Algorithm"`
+	Swappiness    int    `json:"Swappiness"`
+}
+
+// Apply is the outcome of the application of the recommended zram configuration
+type Apply struct {
+	Time           time.Time      `json:"Time"`
+	Recommendation Recommendation `json:"Recommendation"`
+	Error          string         `json:"Error,omitempty"`
+}
+
+// Service reports the memory configuration of the host and applies the recommended zram configuration
+type Service struct {
+	run CommandRunner
+
+	mu        sync.Mutex
+	lastApply *Apply
+}
+
+// Status returns the memory configuration and pressure of the host
+func (service *Service) Status(ctx context.Context) *Report {
+	report := readReport()
+
+	service.mu.Lock()
+	report.LastApply = service.lastApply
+	service.mu.Unlock()
+
+	report.Alerts = raiseAlerts(report)
+
+	return report
+}
+
+// readReport returns the memory configuration read from the kernel
+func readReport() *Report {
+	meminfo := readMeminfo(filepath.Join(procPath, "meminfo"))
+
+	report := &Report{
+		TotalBytes:     meminfo["MemTotal"],
+		AvailableBytes: meminfo["MemAvailable"],
+		SwapTotalBytes: meminfo["SwapTotal"],
+		SwapFreeBytes:  meminfo["SwapFree"],
+		Swaps:          readSwaps(filepath.Join(procPath, "swaps")),
+		ZRAM:           readZRAMDevices(filepath.Join(sysPath, "block")),
+		Pressure:       readPressure(filepath.Join(procPath, "pressure", "memory")),
+	}
+
+	if swappiness, err := strconv.Atoi(readString(filepath.Join(procPath, "sys", "vm", "swappiness"))); err == nil {
+		report.Swappiness = &swappiness
+	}
+
+	report.Recommendation = recommend(report)
+
+	return report
+}
+
+// recommend returns the zram swap recommended for the hosts with little memory and no zram swap, half of their
+// memory is the usual size of the device with a compression ratio of 2 to 3
+func recommend(report *Report) *Recommendation {
+	if report.TotalBytes == 0 || report.TotalBytes > smallHostMemory {
+		return nil
+	}
+
+	for _, swap := range report.Swaps {
+		if strings.HasPrefix(filepath.Base(swap.Device), "zram") {
+			return nil
+		}
+	}
+
+	return &Recommendation{
+		DiskSizeBytes: report.TotalBytes / 2,
+		Algorithm:     recommendedAlgorithm,
+		Swappiness:    recommendedSwappiness,
+	}
+}
+
+func raiseAlerts(report *Report) []string {
+	var alerts []string
+
+	if report.Pressure != nil && report.Pressure.Full60 >= pressureAlertThreshold {
+		alerts = append(alerts, fmt.Sprintf("all the tasks of the host stalled waiting for memory %.1f%% of the last minute", report.Pressure.Full60))
+	}
+
+	if report.SwapTotalBytes > 0 {
+		used := 100 * (report.SwapTotalBytes - report.SwapFreeBytes) / report.SwapTotalBytes
+		if used >= swapAlertThreshold {
+			alerts = append(alerts, fmt.Sprintf("%d%% of the swap of the host is used", used))
+		}
+	} else if report.Recommendation != nil {
+		alerts = append(alerts, fmt.Sprintf("no swap is configured on the host with %d MiB of memory, a zram swap is recommended", report.TotalBytes>>20))
+	}
+
+	if report.LastApply != nil && report.LastApply.Error != "" {
+		alerts = append(alerts, "unable to apply the recommended zram configuration: "+report.LastApply.Error)
+	}
+
+	return alerts
+}
+
+// readMeminfo returns the values of /proc/meminfo in bytes
+func readMeminfo(path string) map[string]uint64 {
+	values := map[string]uint64{}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return values
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+
+		parsed, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		if len(fields) > 1 && fields[1] == "kB" {
+			parsed *= 1024
+		}
+
+		values[key] = parsed
+	}
+
+	return values
+}
+
+// readSwaps returns the active swap areas listed in /proc/swaps, whose sizes are in KiB
+func readSwaps(path string) []Swap {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	var swaps []Swap
+	for i, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if i == 0 || len(fields) < 5 {
+			continue
+		}
+
+		size, _ := strconv.ParseUint(fields[2], 10, 64)
+		used, _ := strconv.ParseUint(fields[3], 10, 64)
+		priority, _ := strconv.Atoi(fields[4])
+
+		swaps = append(swaps, Swap{
+			Device:    fields[0],
+			Type:      fields[1],
+			SizeBytes: size * 1024,
+			UsedBytes: used * 1024,
+			Priority:  priority,
+		})
+	}
+
+	return swaps
+}
+
+// readZRAMDevices returns the zram devices of the host, the selected algorithm is the one between brackets, e.g.
+// "lzo lz4 [zstd]"
+func readZRAMDevices(blockPath string) []ZRAMDevice {
+	paths, err := filepath.Glob(filepath.Join(blockPath, "zram*"))
+	if err != nil {
+		return nil
+	}
+
+	var devices []ZRAMDevice
+	for _, path := range paths {
+		device := ZRAMDevice{Name: filepath.Base(path)}
+
+		device.DiskSizeBytes, _ = strconv.ParseUint(readString(filepath.Join(path, "disksize")), 10, 64)
+
+		for _, algorithm := range strings.Fields(readString(filepath.Join(path, "comp_algorithm"))) {
+			if strings.HasPrefix(algorithm, "[") && strings.HasSuffix(algorithm, "]") {
+				device.Algorithm = strings.Trim(algorithm, "[]")
+			}
+		}
+
+		if stats := strings.Fields(readString(filepath.Join(path, "mm_stat"))); len(stats) >= 2 {
+			device.OriginalBytes, _ = strconv.ParseUint(stats[0], 10, 64)
+			device.CompressedBytes, _ = strconv.ParseUint(stats[1], 10, 64)
+		}
+
+		devices = append(devices, device)
+	}
+
+	return devices
+}
+
+// readPressure returns the memory pressure stall information, e.g.
+// "some avg10=0.00 avg60=0.00 avg300=0.00 total=0"
+func readPressure(path string) *Pressure {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	pressure := &Pressure{}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+
+		var avg10, avg60 float64
+		for _, field := range fields[1:] {
+			key, value, _ := strings.Cut(field, "=")
+
+			switch key {
+			case "avg10":
+				avg10, _ = strconv.ParseFloat(value, 64)
+			case "avg60":
+				avg60, _ = strconv.ParseFloat(value, 64)
+			}
+		}
+
+		switch fields[0] {
+		case "some":
+			pressure.Some10, pressure.Some60 = avg10, avg60
+		case "full":
+			pressure.Full10, pressure.Full60 = avg10, avg60
+		}
+	}
+
+	return pressure
+}
+
+func readString(path string) string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(content))
+}
+
+// Diagnostics returns the alerts of the report
+func (report *Report) Diagnostics() []string {
+	if report == nil {
+		return nil
+	}
+
+	return report.Alerts
+}
+
+// Enable makes service the default service used by CurrentStatus and DefaultService
+func Enable(service *Service) {
+	defaultServiceMu.Lock()
+	defer defaultServiceMu.Unlock()
+
+	defaultService = service
+}
+
+// DefaultService returns the default service, nil when no service is enabled
+func DefaultService() *Service {
+	defaultServiceMu.Lock()
+	defer defaultServiceMu.Unlock()
+
+	return defaultService
+}
+
+// CurrentStatus returns the report of the default service, nil when no service is enabled
+func CurrentStatus(ctx context.Context) *Report {
+	service := DefaultService()
+	if service == nil {
+		return nil
+	}
+
+	return service.Status(ctx)
+}
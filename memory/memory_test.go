@@ -0,0 +1,129 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func withHost(t *testing.T, proc, sys map[string]string) {
+	t.Helper()
+
+	previousProc, previousSys := procPath, sysPath
+	procPath, sysPath = t.TempDir(), t.TempDir()
+	t.Cleanup(func() { procPath, sysPath = previousProc, previousSys })
+
+	writeFiles(t, procPath, proc)
+	writeFiles(t, sysPath, sys)
+}
+
+func TestStatusSmallHostWithoutSwap(t *testing.T) {
+	withHost(t, map[string]string{
+		"meminfo":           "MemTotal:        1918256 kB\nMemFree:          102400 kB\nMemAvailable:     204800 kB\nSwapTotal:             0 kB\nSwapFree:              0 kB\n",
+		"swaps":             "Filename\t\t\t\tType\t\tSize\t\tUsed\t\tPriority\n",
+		"sys/vm/swappiness": "60\n",
+		"pressure/memory":   "some avg10=35.20 avg60=28.12 avg300=10.01 total=123456\nfull avg10=18.00 avg60=12.50 avg300=4.20 total=65432\n",
+	}, nil)
+
+	report := (&Service{}).Status(context.Background())
+
+	if report.TotalBytes != 1918256*1024 || report.AvailableBytes != 204800*1024 || report.Swappiness == nil || *report.Swappiness != 60 {
+		t.Errorf("unexpected memory: %+v", report)
+	}
+
+	if report.Pressure == nil || report.Pressure.Some60 != 28.12 || report.Pressure.Full60 != 12.5 {
+		t.Errorf("unexpected pressure: %+v", report.Pressure)
+	}
+
+	expected := Recommendation{DiskSizeBytes: 1918256 * 1024 / 2, Algorithm: "zstd", Swappiness: 100}
+	if report.Recommendation == nil || *report.Recommendation != expected {
+		t.Errorf("expected %+v, got %+v", expected, report.Recommendation)
+	}
+
+	if len(report.Diagnostics()) != 2 {
+		t.Errorf("expected the pressure and the missing swap alerts, got %v", report.Diagnostics())
+	}
+}
+
+func TestStatusZRAMSwap(t *testing.T) {
+	withHost(t, map[string]string{
+		"meminfo": "MemTotal:        1918256 kB\nMemAvailable:     904800 kB\nSwapTotal:        959124 kB\nSwapFree:          20480 kB\n",
+		"swaps":   "Filename\t\t\t\tType\t\tSize\t\tUsed\t\tPriority\n/dev/zram0                              partition\t959124\t\t938644\t\t100\n",
+	}, map[string]string{
+		"block/zram0/disksize":       "982142976\n",
+		"block/zram0/comp_algorithm": "lzo lzo-rle lz4 [zstd]\n",
+		"block/zram0/mm_stat":        "961171456 240292864 251658240 0 251658240 12 0 0 0\n",
+	})
+
+	report := (&Service{}).Status(context.Background())
+
+	if report.Recommendation != nil {
+		t.Errorf("expected no recommendation for a host with a zram swap, got %+v", report.Recommendation)
+	}
+
+	if len(report.Swaps) != 1 || report.Swaps[0].Device != "/dev/zram0" || report.Swaps[0].Priority != 100 {
+		t.Errorf("unexpected swaps: %+v", report.Swaps)
+	}
+
+	expected := ZRAMDevice{Name: "zram0", Algorithm: "zstd", DiskSizeBytes: 982142976, OriginalBytes: 961171456, CompressedBytes: 240292864}
+	if len(report.ZRAM) != 1 || report.ZRAM[0] != expected {
+		t.Errorf("expected %+v, got %+v", expected, report.ZRAM)
+	}
+
+	if alerts := report.Diagnostics(); len(alerts) != 1 || !strings.Contains(alerts[0], "97% of the swap") {
+		t.Errorf("expected the swap usage alert, got %v", alerts)
+	}
+}
+
+func TestApplyRecommendation(t *testing.T) {
+	withHost(t, map[string]string{
+		"meminfo": "MemTotal:        1000000 kB\nSwapTotal:             0 kB\n",
+	}, nil)
+
+	var script string
+	service := &Service{run: func(ctx context.Context, cmd []string) ([]byte, error) {
+		script = cmd[len(cmd)-1]
+
+		return []byte("the kernel does not support zram\n"), errors.New("exit status 1")
+	}}
+
+	err := service.ApplyRecommendation(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "the kernel does not support zram") {
+		t.Fatalf("expected the output of the failed command in the error, got %v", err)
+	}
+
+	if !strings.Contains(script, "echo 512000000 > /sys/block/zram0/disksize") || !strings.Contains(script, "vm.swappiness=100") {
+		t.Errorf("unexpected script:\n%s", script)
+	}
+
+	report := service.Status(context.Background())
+	if report.LastApply == nil || report.LastApply.Error == "" {
+		t.Errorf("expected the failure to be reported, got %+v", report.LastApply)
+	}
+
+	withHost(t, map[string]string{
+		"meminfo": "MemTotal:        16000000 kB\nSwapTotal:             0 kB\n",
+	}, nil)
+
+	if err := service.ApplyRecommendation(context.Background()); !errors.Is(err, ErrNoRecommendation) {
+		t.Errorf("expected ErrNoRecommendation on a large host, got %v", err)
+	}
+}
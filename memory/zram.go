@@ -0,0 +1,82 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/portainer/agent/docker"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrNoRecommendation is returned when the recommended zram configuration is applied on a host that needs none
+var ErrNoRecommendation = errors.New("no zram configuration is recommended for the host")
+
+// zramScript configures the first zram device of the host as a swap with the recommended size, compression
+// algorithm and swappiness. The configuration is not persisted and is lost when the host reboots.
+const zramScript = `set -e
+modprobe zram 2>/dev/null || true
+if [ ! -e /sys/block/zram0 ]; then echo "the kernel does not support zram" >&2; exit 1; fi
+if [ "$(cat /sys/block/zram0/disksize)" != "0" ]; then echo "the zram0 device is already in use" >&2; exit 1; fi
+echo %[1]s > /sys/block/zram0/comp_algorithm 2>/dev/null || echo lz4 > /sys/block/zram0/comp_algorithm 2>/dev/null || true
+echo %[2]d > /sys/block/zram0/disksize
+mkswap /dev/zram0 >/dev/null
+swapon -p 100 /dev/zram0
+sysctl -q -w vm.swappiness=%[3]d
+`
+
+// CommandRunner executes a command on the host and returns its output
+type CommandRunner func(ctx context.Context, cmd []string) ([]byte, error)
+
+// NewService returns a pointer to a Service applying the zram configuration on the host with image, which must
+// provide nsenter
+func NewService(image string) *Service {
+	return &Service{
+		run: func(ctx context.Context, cmd []string) ([]byte, error) {
+			var output bytes.Buffer
+			err := docker.ExecHostCommand(ctx, image, cmd, &output)
+
+			return output.Bytes(), err
+		},
+	}
+}
+
+// ApplyRecommendation configures the zram swap recommended for the host, ErrNoRecommendation is returned when the
+// host needs none. The outcome is reported in the next reports.
+func (service *Service) ApplyRecommendation(ctx context.Context) error {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	recommendation := readReport().Recommendation
+	if recommendation == nil {
+		return ErrNoRecommendation
+	}
+
+	script := fmt.Sprintf(zramScript, recommendation.Algorithm, recommendation.DiskSizeBytes, recommendation.Swappiness)
+
+	output, err := service.run(ctx, []string{"sh", "-c", script})
+	if err != nil {
+		if message := strings.TrimSpace(string(output)); message != "" {
+			err = fmt.Errorf("%w: %s", err, message)
+		}
+	}
+
+	service.lastApply = &Apply{Time: time.Now(), Recommendation: *recommendation}
+	if err != nil {
+		service.lastApply.Error = err.Error()
+
+		return err
+	}
+
+	log.Info().
+		Uint64("disk_size_bytes", recommendation.DiskSizeBytes).
+		Str("algorithm", recommendation.Algorithm).
+		Int("swappiness", recommendation.Swappiness).
+		Msg("zram swap configured on the host")
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stages of the requests proxied to the Docker daemon
+const (
+	// StageAgent is the time spent in the agent before the request is sent to the daemon: signature verification,
+	// policy filtering and redirection to the agent of another node
+	StageAgent = "agent"
+	// StageDaemon is the time taken by the daemon to answer with the response headers
+	StageDaemon = "daemon"
+)
+
+const (
+	// maxDockerRoutes bounds the number of routes measured, the requests of the other routes are measured together
+	maxDockerRoutes = 200
+	// otherDockerRoute is the route of the requests measured once maxDockerRoutes is reached
+	otherDockerRoute = "other"
+	// statusError is the status class of the requests that received no response from the daemon
+	statusError = "error"
+)
+
+// dockerCollections are the Docker API resources whose second path segment is an identifier or a name
+var dockerCollections = map[string]bool{
+	"configs":      true,
+	"containers":   true,
+	"distribution": true,
+	"exec":         true,
+	"images":       true,
+	"networks":     true,
+	"nodes":        true,
+	"plugins":      true,
+	"secrets":      true,
+	"services":     true,
+	"tasks":        true,
+	"volumes":      true,
+}
+
+// dockerStaticEndpoints are the path segments following a collection that are not identifiers, e.g. /containers/json
+var dockerStaticEndpoints = map[string]bool{
+	"create":     true,
+	"get":        true,
+	"json":       true,
+	"load":       true,
+	"privileges": true,
+	"prune":      true,
+	"pull":       true,
+	"search":     true,
+}
+
+// dockerActions are the last path segments of the routes acting on a resource, e.g. /containers/{id}/logs
+var dockerActions = map[string]bool{
+	"archive": true, "attach": true, "changes": true, "connect": true, "disable": true, "disconnect": true,
+	"enable": true, "exec": true, "export": true, "get": true, "history": true, "json": true, "kill": true,
+	"logs": true, "pause": true, "push": true, "rename": true, "resize": true, "restart": true, "set": true,
+	"start": true, "stats": true, "stop": true, "tag": true, "top": true, "unpause": true, "update": true,
+	"upgrade": true, "wait": true,
+}
+
+type requestStartKey struct{}
+
+// dockerRequestKey identifies the histograms and the counters of a route
+type dockerRequestKey struct {
+	method string
+	route  string
+}
+
+// WithRequestStart returns a copy of ctx holding the time the agent received the request
+func WithRequestStart(ctx context.Context, start time.Time) context.Context {
+	return context.WithValue(ctx, requestStartKey{}, start)
+}
+
+// RequestStart returns the time the agent received the request of ctx, ok is false when it is not known
+func RequestStart(ctx context.Context) (start time.Time, ok bool) {
+	start, ok = ctx.Value(requestStartKey{}).(time.Time)
+
+	return start, ok
+}
+
+// DockerRoute returns the route of a Docker API path without version prefix, the identifiers and the names of the
+// resources are replaced with {id} so that the requests on the different resources are measured together, e.g.
+// /containers/3f4e2a/logs is /containers/{id}/logs and /images/library/nginx:latest/json is /images/{id}/json
+func DockerRoute(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) < 2 || !dockerCollections[segments[0]] {
+		return "/" + strings.Join(segments, "/")
+	}
+
+	rest := segments[1:]
+	if len(rest) == 1 && dockerStaticEndpoints[rest[0]] {
+		return "/" + segments[0] + "/" + rest[0]
+	}
+
+	route := "/" + segments[0] + "/{id}"
+
+	// the image names contain slashes, the action is the last segment
+	if last := rest[len(rest)-1]; len(rest) > 1 && dockerActions[last] {
+		route += "/" + last
+	}
+
+	return route
+}
+
+// ObserveDockerRequest records the duration of a stage of a request proxied to the Docker daemon
+func ObserveDockerRequest(method, path, stage string, duration time.Duration) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	key := dockerRequestKeyLocked(method, path)
+
+	stages, ok := registry.dockerDurations[key]
+	if !ok {
+		stages = map[string]*histogram{}
+		registry.dockerDurations[key] = stages
+	}
+
+	h, ok := stages[stage]
+	if !ok {
+		h = newHistogram(requestBuckets)
+		stages[stage] = h
+	}
+
+	h.observe(duration.Seconds())
+}
+
+// CountDockerResponse counts a request proxied to the Docker daemon by the class of its status code (2xx to 5xx), a
+// status code of 0 counts a request that received no response
+func CountDockerResponse(method, path string, statusCode int) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	key := dockerRequestKeyLocked(method, path)
+
+	class := statusError
+	if statusCode > 0 {
+		class = strconv.Itoa(statusCode/100) + "xx"
+	}
+
+	counts, ok := registry.dockerResponses[key]
+	if !ok {
+		counts = map[string]uint64{}
+		registry.dockerResponses[key] = counts
+	}
+
+	counts[class]++
+}
+
+// dockerRequestKeyLocked returns the key of the route of path, the routes beyond maxDockerRoutes are measured as
+// the other route
+func dockerRequestKeyLocked(method, path string) dockerRequestKey {
+	key := dockerRequestKey{method: method, route: DockerRoute(path)}
+
+	if _, known := registry.dockerRoutes[key]; !known {
+		if len(registry.dockerRoutes) >= maxDockerRoutes {
+			return dockerRequestKey{method: method, route: otherDockerRoute}
+		}
+
+		registry.dockerRoutes[key] = struct{}{}
+	}
+
+	return key
+}
@@ -0,0 +1,310 @@
+// Package metrics collects the internal metrics of the agent and exposes them in the Prometheus text format, so that
+// the failing agents can be alerted on from a Prometheus server.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	portainer "github.com/portainer/portainer/api"
+)
+
+// Platforms of the snapshots
+const (
+	PlatformDocker     = "docker"
+	PlatformKubernetes = "kubernetes"
+)
+
+var (
+	snapshotBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+	requestBuckets  = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+)
+
+// histogram counts the observations in cumulative buckets, the same way as the Prometheus histograms
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *histogram) observe(value float64) {
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+
+	h.sum += value
+	h.count++
+}
+
+// dockerSnapshotCounts holds the headline counts of the last Docker snapshot
+type dockerSnapshotCounts struct {
+	time      time.Time
+	running   int
+	stopped   int
+	healthy   int
+	unhealthy int
+	images    int
+	volumes   int
+	stacks    int
+	services  int
+	nodes     int
+	swarm     bool
+}
+
+var registry = struct {
+	mu                sync.Mutex
+	snapshotDurations map[string]*histogram
+	snapshotErrors    map[string]uint64
+	tunnelConnects    uint64
+	tunnelReconnects  uint64
+	proxyRequests     *histogram
+	edgePollFailures  uint64
+	lastDocker        *dockerSnapshotCounts
+	// edgeConnectivity is the state of the connectivity to the Portainer server, empty before the first request
+	edgeConnectivity string
+	// dockerRoutes are the routes of the Docker API measured, dockerDurations holds the histograms of each stage
+	// of their requests and dockerResponses the counts of each status class
+	dockerRoutes    map[dockerRequestKey]struct{}
+	dockerDurations map[dockerRequestKey]map[string]*histogram
+	dockerResponses map[dockerRequestKey]map[string]uint64
+}{
+	snapshotDurations: map[string]*histogram{},
+	snapshotErrors:    map[string]uint64{},
+	proxyRequests:     newHistogram(requestBuckets),
+	dockerRoutes:      map[dockerRequestKey]struct{}{},
+	dockerDurations:   map[dockerRequestKey]map[string]*histogram{},
+	dockerResponses:   map[dockerRequestKey]map[string]uint64{},
+}
+
+// ObserveSnapshot records the duration of the creation of a snapshot of the platform and whether it failed
+func ObserveSnapshot(platform string, duration time.Duration, err error) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	h, ok := registry.snapshotDurations[platform]
+	if !ok {
+		h = newHistogram(snapshotBuckets)
+		registry.snapshotDurations[platform] = h
+	}
+
+	h.observe(duration.Seconds())
+
+	if err != nil {
+		registry.snapshotErrors[platform]++
+	}
+}
+
+// ObserveDockerSnapshot records the creation of a Docker snapshot and keeps its counts, the counts of the previous
+// snapshot are kept when the snapshot failed
+func ObserveDockerSnapshot(snapshot *portainer.DockerSnapshot, duration time.Duration, err error) {
+	ObserveSnapshot(PlatformDocker, duration, err)
+
+	if err != nil || snapshot == nil {
+		return
+	}
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	registry.lastDocker = &dockerSnapshotCounts{
+		time:      time.Now(),
+		running:   snapshot.RunningContainerCount,
+		stopped:   snapshot.StoppedContainerCount,
+		healthy:   snapshot.HealthyContainerCount,
+		unhealthy: snapshot.UnhealthyContainerCount,
+		images:    snapshot.ImageCount,
+		volumes:   snapshot.VolumeCount,
+		stacks:    snapshot.StackCount,
+		services:  snapshot.ServiceCount,
+		nodes:     snapshot.NodeCount,
+		swarm:     snapshot.Swarm,
+	}
+}
+
+// TunnelConnected counts a connection of the reverse tunnel to the Portainer server, reconnect is true when the
+// connection was lost and established again by the tunnel client
+func TunnelConnected(reconnect bool) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	if reconnect {
+		registry.tunnelReconnects++
+	} else {
+		registry.tunnelConnects++
+	}
+}
+
+// ObserveProxyRequest records the duration of a request served by the agent API
+func ObserveProxyRequest(duration time.Duration) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	registry.proxyRequests.observe(duration.Seconds())
+}
+
+// EdgePollFailed counts a failed poll of the Portainer server
+func EdgePollFailed() {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	registry.edgePollFailures++
+}
+
+// SetEdgeConnectivityState records the state of the connectivity to the Portainer server, as classified by the
+// Edge client
+func SetEdgeConnectivityState(state string) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	registry.edgeConnectivity = state
+}
+
+// Write writes the metrics in the Prometheus text format
+func Write(w io.Writer) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	header := func(name, kind, help string) {
+		fmt.Fprintf(w, "# HELP portainer_agent_%s %s\n# TYPE portainer_agent_%s %s\n", name, help, name, kind)
+	}
+
+	sample := func(name string, value float64, labels ...string) {
+		var pairs []string
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, fmt.Sprintf("%s=%q", labels[i], labels[i+1]))
+		}
+
+		if len(pairs) > 0 {
+			name += "{" + strings.Join(pairs, ",") + "}"
+		}
+
+		fmt.Fprintf(w, "portainer_agent_%s %s\n", name, strconv.FormatFloat(value, 'g', -1, 64))
+	}
+
+	writeHistogram := func(name string, h *histogram, labels ...string) {
+		for i, bound := range h.buckets {
+			sample(name+"_bucket", float64(h.counts[i]), append(labels, "le", strconv.FormatFloat(bound, 'g', -1, 64))...)
+		}
+
+		sample(name+"_bucket", float64(h.count), append(labels, "le", "+Inf")...)
+		sample(name+"_sum", h.sum, labels...)
+		sample(name+"_count", float64(h.count), labels...)
+	}
+
+	platforms := make([]string, 0, len(registry.snapshotDurations))
+	for platform := range registry.snapshotDurations {
+		platforms = append(platforms, platform)
+	}
+	sort.Strings(platforms)
+
+	header("snapshot_duration_seconds", "histogram", "Duration of the creation of the snapshots.")
+	for _, platform := range platforms {
+		writeHistogram("snapshot_duration_seconds", registry.snapshotDurations[platform], "platform", platform)
+	}
+
+	header("snapshot_errors_total", "counter", "Number of snapshots that could not be created.")
+	for _, platform := range platforms {
+		sample("snapshot_errors_total", float64(registry.snapshotErrors[platform]), "platform", platform)
+	}
+
+	header("tunnel_connections_total", "counter", "Number of connections of the reverse tunnel to the Portainer server.")
+	sample("tunnel_connections_total", float64(registry.tunnelConnects), "type", "connect")
+	sample("tunnel_connections_total", float64(registry.tunnelReconnects), "type", "reconnect")
+
+	header("proxy_request_duration_seconds", "histogram", "Duration of the requests served by the agent API.")
+	writeHistogram("proxy_request_duration_seconds", registry.proxyRequests)
+
+	routes := make([]dockerRequestKey, 0, len(registry.dockerDurations))
+	for key := range registry.dockerDurations {
+		routes = append(routes, key)
+	}
+	sortDockerRequestKeys(routes)
+
+	header("docker_request_duration_seconds", "histogram", "Duration of the stages of the requests proxied to the Docker daemon: the time spent in the agent and the time taken by the daemon to answer.")
+	for _, key := range routes {
+		stages := make([]string, 0, len(registry.dockerDurations[key]))
+		for stage := range registry.dockerDurations[key] {
+			stages = append(stages, stage)
+		}
+		sort.Strings(stages)
+
+		for _, stage := range stages {
+			writeHistogram("docker_request_duration_seconds", registry.dockerDurations[key][stage], "method", key.method, "route", key.route, "stage", stage)
+		}
+	}
+
+	routes = routes[:0]
+	for key := range registry.dockerResponses {
+		routes = append(routes, key)
+	}
+	sortDockerRequestKeys(routes)
+
+	header("docker_requests_total", "counter", "Number of requests proxied to the Docker daemon by status class, error when the daemon did not answer.")
+	for _, key := range routes {
+		classes := make([]string, 0, len(registry.dockerResponses[key]))
+		for class := range registry.dockerResponses[key] {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+
+		for _, class := range classes {
+			sample("docker_requests_total", float64(registry.dockerResponses[key][class]), "method", key.method, "route", key.route, "status", class)
+		}
+	}
+
+	header("edge_poll_failures_total", "counter", "Number of failed polls of the Portainer server.")
+	sample("edge_poll_failures_total", float64(registry.edgePollFailures))
+
+	if registry.edgeConnectivity != "" {
+		header("edge_connectivity_state", "gauge", "State of the connectivity to the Portainer server, ok or the class of the last failure.")
+		sample("edge_connectivity_state", 1, "state", registry.edgeConnectivity)
+	}
+
+	if s := registry.lastDocker; s != nil {
+		header("docker_snapshot_timestamp_seconds", "gauge", "Unix time of the last Docker snapshot.")
+		sample("docker_snapshot_timestamp_seconds", float64(s.time.Unix()))
+		header("docker_containers", "gauge", "Number of containers by state in the last Docker snapshot.")
+		sample("docker_containers", float64(s.running), "state", "running")
+		sample("docker_containers", float64(s.stopped), "state", "stopped")
+		sample("docker_containers", float64(s.healthy), "state", "healthy")
+		sample("docker_containers", float64(s.unhealthy), "state", "unhealthy")
+		header("docker_images", "gauge", "Number of images in the last Docker snapshot.")
+		sample("docker_images", float64(s.images))
+		header("docker_volumes", "gauge", "Number of volumes in the last Docker snapshot.")
+		sample("docker_volumes", float64(s.volumes))
+		header("docker_stacks", "gauge", "Number of stacks in the last Docker snapshot.")
+		sample("docker_stacks", float64(s.stacks))
+
+		if s.swarm {
+			header("docker_services", "gauge", "Number of Swarm services in the last Docker snapshot.")
+			sample("docker_services", float64(s.services))
+			header("docker_nodes", "gauge", "Number of Swarm nodes in the last Docker snapshot.")
+			sample("docker_nodes", float64(s.nodes))
+		}
+	}
+}
+
+func sortDockerRequestKeys(keys []dockerRequestKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+
+		return keys[i].method < keys[j].method
+	})
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	portainer "github.com/portainer/portainer/api"
+)
+
+func TestWrite(t *testing.T) {
+	ObserveDockerSnapshot(&portainer.DockerSnapshot{RunningContainerCount: 3, ImageCount: 5}, 2*time.Second, nil)
+	ObserveDockerSnapshot(nil, 40*time.Second, errors.New("unreachable"))
+	TunnelConnected(false)
+	TunnelConnected(true)
+	ObserveProxyRequest(30 * time.Millisecond)
+	EdgePollFailed()
+
+	var buf bytes.Buffer
+	Write(&buf)
+	output := buf.String()
+
+	expected := []string{
+		`portainer_agent_snapshot_duration_seconds_bucket{platform="docker",le="2.5"} 1`,
+		`portainer_agent_snapshot_duration_seconds_bucket{platform="docker",le="+Inf"} 2`,
+		`portainer_agent_snapshot_duration_seconds_sum{platform="docker"} 42`,
+		`portainer_agent_snapshot_errors_total{platform="docker"} 1`,
+		`portainer_agent_tunnel_connections_total{type="reconnect"} 1`,
+		`portainer_agent_proxy_request_duration_seconds_bucket{le="0.025"} 0`,
+		`portainer_agent_proxy_request_duration_seconds_bucket{le="0.05"} 1`,
+		`portainer_agent_edge_poll_failures_total 1`,
+		`portainer_agent_docker_containers{state="running"} 3`,
+		`portainer_agent_docker_images 5`,
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("expected the line %s in:\n%s", line, output)
+		}
+	}
+
+	if strings.Contains(output, "portainer_agent_docker_services") {
+		t.Error("expected no Swarm metrics for a standalone host")
+	}
+}
+
+func TestDockerRoute(t *testing.T) {
+	tests := map[string]string{
+		"/_ping":                              "/_ping",
+		"/info":                               "/info",
+		"/swarm/init":                         "/swarm/init",
+		"/containers/json":                    "/containers/json",
+		"/containers/3f4e2a":                  "/containers/{id}",
+		"/containers/3f4e2a/logs":             "/containers/{id}/logs",
+		"/images/create":                      "/images/create",
+		"/images/library/nginx:latest/json":   "/images/{id}/json",
+		"/images/registry:5000/team/app/push": "/images/{id}/push",
+		"/images/library/nginx":               "/images/{id}",
+		"/exec/9a8b/start":                    "/exec/{id}/start",
+	}
+
+	for path, expected := range tests {
+		if route := DockerRoute(path); route != expected {
+			t.Errorf("expected the route %s for %s, got %s", expected, path, route)
+		}
+	}
+}
+
+func TestWriteDockerRequests(t *testing.T) {
+	ObserveDockerRequest("GET", "/containers/abc/json", StageAgent, 2*time.Millisecond)
+	ObserveDockerRequest("GET", "/containers/def/json", StageDaemon, 300*time.Millisecond)
+	CountDockerResponse("GET", "/containers/abc/json", 200)
+	CountDockerResponse("GET", "/containers/def/json", 404)
+	CountDockerResponse("POST", "/containers/abc/start", 0)
+
+	var buf bytes.Buffer
+	Write(&buf)
+	output := buf.String()
+
+	expected := []string{
+		`portainer_agent_docker_request_duration_seconds_bucket{method="GET",route="/containers/{id}/json",stage="agent",le="0.005"} 1`,
+		`portainer_agent_docker_request_duration_seconds_bucket{method="GET",route="/containers/{id}/json",stage="daemon",le="0.25"} 0`,
+		`portainer_agent_docker_request_duration_seconds_bucket{method="GET",route="/containers/{id}/json",stage="daemon",le="0.5"} 1`,
+		`portainer_agent_docker_requests_total{method="GET",route="/containers/{id}/json",status="2xx"} 1`,
+		`portainer_agent_docker_requests_total{method="GET",route="/containers/{id}/json",status="4xx"} 1`,
+		`portainer_agent_docker_requests_total{method="POST",route="/containers/{id}/start",status="error"} 1`,
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("expected the line %s in:\n%s", line, output)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Handler returns the handler writing the metrics on GET requests
+func Handler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			rw.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		rw.Header().Set("Content-Type", contentType)
+		Write(rw)
+	})
+}
+
+// Serve exposes the metrics on /metrics of addr, it blocks until the listener fails
+func Serve(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+
+	server := &http.Server{
+		Addr:         addr,
+		Handler:      mux,
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+
+	log.Info().Str("addr", addr).Msg("starting the metrics server")
+
+	return server.ListenAndServe()
+}
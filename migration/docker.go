@@ -0,0 +1,90 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/portainer/agent/docker"
+)
+
+// dockerEngine manages the containers of the compose stacks through the Docker API
+type dockerEngine struct{}
+
+func (dockerEngine) Containers(ctx context.Context, stack string) ([]stackContainer, error) {
+	cli, err := docker.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+
+	list, err := cli.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", fmt.Sprintf("%s=%s", docker.ComposeProjectLabel, stack))),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	containers := make([]stackContainer, 0, len(list))
+	for _, c := range list {
+		name := c.ID
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+
+		mounts := make([]mount, 0, len(c.Mounts))
+		for _, m := range c.Mounts {
+			mounts = append(mounts, mount{
+				Type:        string(m.Type),
+				Name:        m.Name,
+				Source:      m.Source,
+				Destination: m.Destination,
+				Driver:      m.Driver,
+			})
+		}
+
+		containers = append(containers, stackContainer{
+			ID:      c.ID,
+			Name:    name,
+			Running: c.State == "running" || c.State == "restarting",
+			Labels:  c.Labels,
+			Mounts:  mounts,
+		})
+	}
+
+	return containers, nil
+}
+
+func (dockerEngine) Stop(ctx context.Context, id string) error {
+	cli, err := docker.NewClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	return cli.ContainerStop(ctx, id, container.StopOptions{})
+}
+
+func (dockerEngine) Start(ctx context.Context, id string) error {
+	cli, err := docker.NewClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	return cli.ContainerStart(ctx, id, types.ContainerStartOptions{})
+}
+
+func (dockerEngine) Remove(ctx context.Context, id string) error {
+	cli, err := docker.NewClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	return cli.ContainerRemove(ctx, id, types.ContainerRemoveOptions{Force: true})
+}
@@ -0,0 +1,618 @@
+// Package migration moves a compose stack from one agent to another under the coordination of the Portainer server,
+// e.g. to evacuate the workloads of failing edge hardware. The server drives both agents:
+//
+//  1. the source exports the bundle of the stack: its compose files, its environment file and its secret files
+//  2. the target imports the bundle, the project files are written on the host
+//  3. the source cuts over: the containers of the stack are stopped so that its volumes are consistent
+//  4. the server streams the volumes from the source to the target with the volume backup and restore endpoints
+//  5. the target starts the stack
+//  6. the source completes the migration by removing the containers, or rolls back by starting them again when the
+//     target failed, in which case the target aborts the migration
+//
+// The volumes and the project files of the source are kept, they are removed once the migration is verified.
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Roles of the agent in a migration
+const (
+	RoleSource = "source"
+	RoleTarget = "target"
+)
+
+// States of a migration
+const (
+	StateExported   = "exported"
+	StateCutover    = "cutover"
+	StateCompleted  = "completed"
+	StateRolledBack = "rolled_back"
+	StateImported   = "imported"
+	StateStarted    = "started"
+	StateAborted    = "aborted"
+	StateFailed     = "failed"
+)
+
+// Actions of the migration executed after the export and the import
+const (
+	ActionCutover  = "cutover"
+	ActionComplete = "complete"
+	ActionRollback = "rollback"
+	ActionStart    = "start"
+	ActionAbort    = "abort"
+)
+
+const (
+	// bundleVersion is the version of the format of the bundles
+	bundleVersion = 1
+	// maxFileSize is the maximum size of a file of the bundle
+	maxFileSize = 1 << 20
+	// MaxBundleSize is the maximum size of the files of a bundle
+	MaxBundleSize = 8 << 20
+	// envFileName is the environment file read by compose in the project directory
+	envFileName = ".env"
+	// secretsTarget is the folder where compose mounts the secrets of the services
+	secretsTarget = "/run/secrets/"
+
+	labelWorkingDir  = "com.docker.compose.project.working_dir"
+	labelConfigFiles = "com.docker.compose.project.config_files"
+	labelEnvFile     = "com.docker.compose.project.environment_file"
+)
+
+var (
+	// ErrDisabled is returned when the migrations are not enabled on the agent
+	ErrDisabled = errors.New("the stack migrations are not enabled on this agent")
+	// ErrStackNotFound is returned when the stack has no container
+	ErrStackNotFound = errors.New("no container was found for the stack")
+	// ErrInvalidState is returned when an action does not follow the previous step of the migration
+	ErrInvalidState = errors.New("the action does not follow the previous step of the migration")
+	// ErrUnknownAction is returned when the action of the migration is not supported
+	ErrUnknownAction = errors.New("unknown migration action")
+)
+
+// hostRoot is where the host filesystem is mounted in the agent container
+var hostRoot = agent.HostRoot
+
+var (
+	defaultManager   *Manager
+	defaultManagerMu sync.Mutex
+)
+
+// Bundle is the definition of a stack moved between two agents, its volumes are streamed separately
+type Bundle struct {
+	Version int    `json:"Version"`
+	Stack   string `json:"Stack"`
+	// WorkingDir is the project directory of the stack on the host, the files are written in the same directory on
+	// the target so that the relative bind mounts of the stack are kept
+	WorkingDir string `json:"WorkingDir"`
+	// ComposeFiles are the paths of the compose files among the files, in the order they are applied
+	ComposeFiles []string `json:"ComposeFiles"`
+	Files        []File   `json:"Files"`
+	// Volumes are the local volumes of the stack, to stream from the source to the target
+	Volumes    []string  `json:"Volumes"`
+	ExportedAt time.Time `json:"ExportedAt"`
+}
+
+// File is a file of the project directory of a stack
+type File struct {
+	// Path is relative to the project directory
+	Path    string `json:"Path"`
+	Content []byte `json:"Content"`
+	// Secret is true for the files mounted as secrets in the containers
+	Secret bool `json:"Secret,omitempty"`
+}
+
+// Record is the state of a migration on this agent
+type Record struct {
+	Stack     string    `json:"Stack"`
+	Role      string    `json:"Role"`
+	State     string    `json:"State"`
+	Error     string    `json:"Error,omitempty"`
+	UpdatedAt time.Time `json:"UpdatedAt"`
+}
+
+// stackContainer is a container of a stack, with the mounts used to build the bundle
+type stackContainer struct {
+	ID      string
+	Name    string
+	Running bool
+	Labels  map[string]string
+	Mounts  []mount
+}
+
+type mount struct {
+	// Type is bind or volume
+	Type        string
+	Name        string
+	Source      string
+	Destination string
+	Driver      string
+}
+
+// engine manages the containers of the stacks
+type engine interface {
+	Containers(ctx context.Context, stack string) ([]stackContainer, error)
+	Stop(ctx context.Context, id string) error
+	Start(ctx context.Context, id string) error
+	Remove(ctx context.Context, id string) error
+}
+
+// Manager exports, imports and cuts over the stacks migrated between two agents
+type Manager struct {
+	engine   engine
+	deployer agent.Deployer
+
+	mu      sync.Mutex
+	records map[string]*Record
+	// bundles are the bundles imported by the target, by stack
+	bundles map[string]*Bundle
+}
+
+// NewManager returns a pointer to a Manager deploying the imported stacks with deployer
+func NewManager(deployer agent.Deployer) *Manager {
+	return &Manager{
+		engine:   dockerEngine{},
+		deployer: deployer,
+		records:  map[string]*Record{},
+		bundles:  map[string]*Bundle{},
+	}
+}
+
+// Export returns the bundle of a compose stack. The files of the bundle must be in the project directory of the
+// stack, the secret files mounted from another folder cannot be migrated.
+func (manager *Manager) Export(ctx context.Context, stack string) (*Bundle, error) {
+	bundle, err := manager.export(ctx, stack)
+	if err != nil {
+		return nil, err
+	}
+
+	manager.record(stack, RoleSource, StateExported, nil)
+
+	return bundle, nil
+}
+
+func (manager *Manager) export(ctx context.Context, stack string) (*Bundle, error) {
+	containers, err := manager.engine.Containers(ctx, stack)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(containers) == 0 {
+		return nil, ErrStackNotFound
+	}
+
+	labels := containers[0].Labels
+
+	bundle := &Bundle{
+		Version:    bundleVersion,
+		Stack:      stack,
+		WorkingDir: labels[labelWorkingDir],
+		ExportedAt: time.Now().UTC(),
+	}
+
+	if !filepath.IsAbs(bundle.WorkingDir) {
+		return nil, fmt.Errorf("the project directory of the stack is unknown: %q", bundle.WorkingDir)
+	}
+
+	files := newFileSet(bundle.WorkingDir)
+
+	for _, configFile := range strings.Split(labels[labelConfigFiles], ",") {
+		relativePath, err := files.add(configFile, false, true)
+		if err != nil {
+			return nil, err
+		}
+
+		bundle.ComposeFiles = append(bundle.ComposeFiles, relativePath)
+	}
+
+	envFile := labels[labelEnvFile]
+	if envFile == "" {
+		envFile = filepath.Join(bundle.WorkingDir, envFileName)
+	}
+
+	if _, err := files.add(envFile, false, false); err != nil {
+		return nil, err
+	}
+
+	volumes := map[string]bool{}
+	for _, c := range containers {
+		for _, m := range c.Mounts {
+			switch {
+			case m.Type == "bind" && strings.HasPrefix(m.Destination, secretsTarget):
+				if _, err := files.add(m.Source, true, true); err != nil {
+					return nil, fmt.Errorf("unable to export the secret %s of the container %s: %w", m.Destination, c.Name, err)
+				}
+			case m.Type == "volume" && m.Driver == "local":
+				volumes[m.Name] = true
+			case m.Type == "volume":
+				log.Warn().Str("stack", stack).Str("volume", m.Name).Str("driver", m.Driver).Msg("the volume is not local and is not migrated")
+			}
+		}
+	}
+
+	bundle.Files = files.files
+	for volume := range volumes {
+		bundle.Volumes = append(bundle.Volumes, volume)
+	}
+	sort.Strings(bundle.Volumes)
+
+	return bundle, nil
+}
+
+// fileSet reads the files of the project directory of a stack through the host filesystem
+type fileSet struct {
+	workingDir string
+	files      []File
+	size       int
+	paths      map[string]bool
+}
+
+func newFileSet(workingDir string) *fileSet {
+	return &fileSet{workingDir: workingDir, paths: map[string]bool{}}
+}
+
+// add reads the file of the host and returns its path relative to the project directory, a missing file is an
+// error unless required is false
+func (files *fileSet) add(hostPath string, secret, required bool) (string, error) {
+	relativePath, err := filepath.Rel(files.workingDir, hostPath)
+	if err != nil || !filepath.IsLocal(relativePath) {
+		return "", fmt.Errorf("the file %s is outside of the project directory %s", hostPath, files.workingDir)
+	}
+
+	if files.paths[relativePath] {
+		return relativePath, nil
+	}
+
+	fullPath := filepath.Join(hostRoot, hostPath)
+
+	info, err := os.Stat(fullPath)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%s is not a regular file", hostPath)
+	}
+
+	if info.Size() > maxFileSize || files.size+int(info.Size()) > MaxBundleSize {
+		return "", fmt.Errorf("the file %s exceeds the size of a bundle", hostPath)
+	}
+
+	content, err := os.ReadFile(fullPath)
+	if err != nil {
+		return "", err
+	}
+
+	files.files = append(files.files, File{Path: filepath.ToSlash(relativePath), Content: content, Secret: secret})
+	files.size += len(content)
+	files.paths[relativePath] = true
+
+	return filepath.ToSlash(relativePath), nil
+}
+
+// Validate checks that the bundle can be imported
+func (bundle *Bundle) Validate() error {
+	if bundle.Version != bundleVersion {
+		return fmt.Errorf("unsupported bundle version %d", bundle.Version)
+	}
+
+	if bundle.Stack == "" {
+		return errors.New("missing stack name")
+	}
+
+	if !path.IsAbs(bundle.WorkingDir) || path.Clean(bundle.WorkingDir) != bundle.WorkingDir || bundle.WorkingDir == "/" {
+		return fmt.Errorf("invalid project directory %q", bundle.WorkingDir)
+	}
+
+	if len(bundle.ComposeFiles) == 0 {
+		return errors.New("missing compose file")
+	}
+
+	paths := map[string]bool{}
+	size := 0
+	for _, file := range bundle.Files {
+		if !filepath.IsLocal(filepath.FromSlash(file.Path)) {
+			return fmt.Errorf("invalid file path %q", file.Path)
+		}
+
+		paths[file.Path] = true
+		size += len(file.Content)
+	}
+
+	if size > MaxBundleSize {
+		return errors.New("the files exceed the size of a bundle")
+	}
+
+	for _, composeFile := range bundle.ComposeFiles {
+		if !paths[composeFile] {
+			return fmt.Errorf("the compose file %s is missing from the files", composeFile)
+		}
+	}
+
+	return nil
+}
+
+// Import writes the project files of the bundle on the host, the project directory must not exist or be empty. The
+// stack is started by ActionStart once its volumes are restored.
+func (manager *Manager) Import(ctx context.Context, bundle *Bundle) error {
+	if err := bundle.Validate(); err != nil {
+		return err
+	}
+
+	directory := filepath.Join(hostRoot, bundle.WorkingDir)
+
+	entries, err := os.ReadDir(directory)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if len(entries) > 0 {
+		return fmt.Errorf("the project directory %s is not empty", bundle.WorkingDir)
+	}
+
+	for _, file := range bundle.Files {
+		filePath := filepath.Join(directory, filepath.FromSlash(file.Path))
+
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			return err
+		}
+
+		mode := os.FileMode(0644)
+		if file.Secret {
+			mode = 0600
+		}
+
+		if err := os.WriteFile(filePath, file.Content, mode); err != nil {
+			return err
+		}
+	}
+
+	manager.mu.Lock()
+	manager.bundles[bundle.Stack] = bundle
+	manager.mu.Unlock()
+
+	manager.record(bundle.Stack, RoleTarget, StateImported, nil)
+
+	return nil
+}
+
+// Execute executes an action of the migration of a stack
+func (manager *Manager) Execute(ctx context.Context, stack, action string) error {
+	var role, from, to string
+
+	switch action {
+	case ActionCutover:
+		role, from, to = RoleSource, StateExported, StateCutover
+	case ActionComplete:
+		role, from, to = RoleSource, StateCutover, StateCompleted
+	case ActionRollback:
+		role, from, to = RoleSource, "", StateRolledBack
+	case ActionStart:
+		role, from, to = RoleTarget, StateImported, StateStarted
+	case ActionAbort:
+		role, from, to = RoleTarget, "", StateAborted
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownAction, action)
+	}
+
+	if err := manager.checkState(stack, role, from); err != nil {
+		return err
+	}
+
+	var err error
+	switch action {
+	case ActionCutover:
+		err = manager.forEachContainer(ctx, stack, func(c stackContainer) error {
+			if !c.Running {
+				return nil
+			}
+
+			return manager.engine.Stop(ctx, c.ID)
+		})
+	case ActionComplete:
+		err = manager.forEachContainer(ctx, stack, func(c stackContainer) error {
+			return manager.engine.Remove(ctx, c.ID)
+		})
+	case ActionRollback:
+		err = manager.forEachContainer(ctx, stack, func(c stackContainer) error {
+			if c.Running {
+				return nil
+			}
+
+			return manager.engine.Start(ctx, c.ID)
+		})
+	case ActionStart:
+		err = manager.start(ctx, stack)
+	case ActionAbort:
+		err = manager.abort(ctx, stack)
+	}
+
+	if err != nil {
+		manager.record(stack, role, StateFailed, err)
+
+		return err
+	}
+
+	manager.record(stack, role, to, nil)
+
+	log.Info().Str("stack", stack).Str("action", action).Msg("stack migration step executed")
+
+	return nil
+}
+
+// checkState returns ErrInvalidState when the migration of the stack is not in the state from, any state of the
+// role is accepted when from is empty
+func (manager *Manager) checkState(stack, role, from string) error {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	record, ok := manager.records[stack]
+	if !ok || record.Role != role || (from != "" && record.State != from) {
+		return ErrInvalidState
+	}
+
+	return nil
+}
+
+func (manager *Manager) forEachContainer(ctx context.Context, stack string, fn func(c stackContainer) error) error {
+	containers, err := manager.engine.Containers(ctx, stack)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range containers {
+		if err := fn(c); err != nil {
+			return fmt.Errorf("container %s: %w", c.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// start deploys the imported stack, the compose files are read through the host filesystem while the project
+// directory is the one of the host so that the bind mounts are resolved on the host
+func (manager *Manager) start(ctx context.Context, stack string) error {
+	bundle := manager.bundle(stack)
+	if bundle == nil {
+		return ErrInvalidState
+	}
+
+	return manager.deployer.Deploy(ctx, stack, bundle.composeFilePaths(), agent.DeployOptions{
+		DeployerBaseOptions: agent.DeployerBaseOptions{
+			WorkingDir: bundle.WorkingDir,
+			Env:        bundle.env(),
+		},
+	})
+}
+
+// abort removes the containers started by the target and the imported project files
+func (manager *Manager) abort(ctx context.Context, stack string) error {
+	bundle := manager.bundle(stack)
+	if bundle == nil {
+		return ErrInvalidState
+	}
+
+	err := manager.deployer.Remove(ctx, stack, bundle.composeFilePaths(), agent.RemoveOptions{
+		DeployerBaseOptions: agent.DeployerBaseOptions{WorkingDir: bundle.WorkingDir, Env: bundle.env()},
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(filepath.Join(hostRoot, bundle.WorkingDir)); err != nil {
+		return err
+	}
+
+	manager.mu.Lock()
+	delete(manager.bundles, stack)
+	manager.mu.Unlock()
+
+	return nil
+}
+
+// bundle returns the bundle imported for the stack, nil when none was imported
+func (manager *Manager) bundle(stack string) *Bundle {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	return manager.bundles[stack]
+}
+
+func (bundle *Bundle) composeFilePaths() []string {
+	paths := make([]string, 0, len(bundle.ComposeFiles))
+	for _, composeFile := range bundle.ComposeFiles {
+		paths = append(paths, filepath.Join(hostRoot, bundle.WorkingDir, filepath.FromSlash(composeFile)))
+	}
+
+	return paths
+}
+
+// env returns the variables of the environment file of the bundle, compose cannot read it from the project directory
+// of the host
+func (bundle *Bundle) env() []string {
+	var env []string
+
+	for _, file := range bundle.Files {
+		if path.Base(file.Path) != envFileName {
+			continue
+		}
+
+		for _, line := range strings.Split(string(file.Content), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") || !strings.Contains(line, "=") {
+				continue
+			}
+
+			env = append(env, line)
+		}
+	}
+
+	return env
+}
+
+func (manager *Manager) record(stack, role, state string, err error) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	record, ok := manager.records[stack]
+	if !ok || record.Role != role {
+		record = &Record{Stack: stack, Role: role}
+		manager.records[stack] = record
+	}
+
+	record.State = state
+	record.UpdatedAt = time.Now()
+	record.Error = ""
+	if err != nil {
+		record.Error = err.Error()
+	}
+}
+
+// Records returns the migrations of this agent, sorted by stack
+func (manager *Manager) Records() []Record {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	records := make([]Record, 0, len(manager.records))
+	for _, record := range manager.records {
+		records = append(records, *record)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Stack < records[j].Stack
+	})
+
+	return records
+}
+
+// Enable makes manager the default manager returned by DefaultManager
+func Enable(manager *Manager) {
+	defaultManagerMu.Lock()
+	defer defaultManagerMu.Unlock()
+
+	defaultManager = manager
+}
+
+// DefaultManager returns the default manager, nil when the migrations are not enabled
+func DefaultManager() *Manager {
+	defaultManagerMu.Lock()
+	defer defaultManagerMu.Unlock()
+
+	return defaultManager
+}
@@ -0,0 +1,229 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/portainer/agent"
+	libstack "github.com/portainer/portainer/pkg/libstack"
+)
+
+type fakeEngine struct {
+	containers []stackContainer
+	stopped    []string
+	started    []string
+	removed    []string
+}
+
+func (engine *fakeEngine) Containers(ctx context.Context, stack string) ([]stackContainer, error) {
+	return engine.containers, nil
+}
+
+func (engine *fakeEngine) Stop(ctx context.Context, id string) error {
+	engine.stopped = append(engine.stopped, id)
+
+	return nil
+}
+
+func (engine *fakeEngine) Start(ctx context.Context, id string) error {
+	engine.started = append(engine.started, id)
+
+	return nil
+}
+
+func (engine *fakeEngine) Remove(ctx context.Context, id string) error {
+	engine.removed = append(engine.removed, id)
+
+	return nil
+}
+
+type fakeDeployer struct {
+	agent.Deployer
+	deployed []string
+	options  agent.DeployOptions
+	removed  []string
+}
+
+func (deployer *fakeDeployer) Deploy(ctx context.Context, name string, filePaths []string, options agent.DeployOptions) error {
+	deployer.deployed = filePaths
+	deployer.options = options
+
+	return nil
+}
+
+func (deployer *fakeDeployer) Remove(ctx context.Context, name string, filePaths []string, options agent.RemoveOptions) error {
+	deployer.removed = filePaths
+
+	return nil
+}
+
+func (deployer *fakeDeployer) WaitForStatus(ctx context.Context, name string, status libstack.Status) <-chan string {
+	return nil
+}
+
+func withHostRoot(t *testing.T) string {
+	t.Helper()
+
+	previous := hostRoot
+	hostRoot = t.TempDir()
+	t.Cleanup(func() { hostRoot = previous })
+
+	return hostRoot
+}
+
+func writeHostFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	fullPath := filepath.Join(hostRoot, path)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sourceEngine() *fakeEngine {
+	labels := map[string]string{
+		labelWorkingDir:  "/opt/line2",
+		labelConfigFiles: "/opt/line2/docker-compose.yml,/opt/line2/docker-compose.override.yml",
+	}
+
+	return &fakeEngine{containers: []stackContainer{
+		{ID: "a1", Name: "line2-gateway-1", Running: true, Labels: labels, Mounts: []mount{
+			{Type: "volume", Name: "line2_data", Driver: "local"},
+			{Type: "bind", Source: "/opt/line2/secrets/plc_password.txt", Destination: "/run/secrets/plc_password"},
+			{Type: "bind", Source: "/opt/line2/config", Destination: "/etc/gateway"},
+		}},
+		{ID: "b2", Name: "line2-historian-1", Running: false, Labels: labels, Mounts: []mount{
+			{Type: "volume", Name: "line2_data", Driver: "local"},
+			{Type: "volume", Name: "line2_nfs", Driver: "nfs"},
+		}},
+	}}
+}
+
+func TestExportImport(t *testing.T) {
+	withHostRoot(t)
+	writeHostFile(t, "/opt/line2/docker-compose.yml", "services:\n  gateway:\n    image: gateway\n")
+	writeHostFile(t, "/opt/line2/docker-compose.override.yml", "services:\n  historian:\n    image: historian\n")
+	writeHostFile(t, "/opt/line2/.env", "# line 2\nPLC_HOST=10.0.2.10\n")
+	writeHostFile(t, "/opt/line2/secrets/plc_password.txt", "s3cret")
+
+	engine := sourceEngine()
+	source := &Manager{engine: engine, records: map[string]*Record{}, bundles: map[string]*Bundle{}}
+
+	bundle, err := source.Export(context.Background(), "line2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(bundle.ComposeFiles, []string{"docker-compose.yml", "docker-compose.override.yml"}) {
+		t.Errorf("unexpected compose files: %v", bundle.ComposeFiles)
+	}
+
+	if len(bundle.Files) != 4 || !bundle.Files[3].Secret || bundle.Files[3].Path != "secrets/plc_password.txt" {
+		t.Errorf("unexpected files: %+v", bundle.Files)
+	}
+
+	if !reflect.DeepEqual(bundle.Volumes, []string{"line2_data"}) {
+		t.Errorf("expected only the local volumes, got %v", bundle.Volumes)
+	}
+
+	if err := source.Execute(context.Background(), "line2", ActionComplete); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expected the completion before the cutover to be refused, got %v", err)
+	}
+
+	if err := source.Execute(context.Background(), "line2", ActionCutover); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(engine.stopped, []string{"a1"}) {
+		t.Errorf("expected the running containers to be stopped, got %v", engine.stopped)
+	}
+
+	// the target imports the bundle on another host
+	withHostRoot(t)
+
+	deployer := &fakeDeployer{}
+	target := &Manager{engine: &fakeEngine{}, deployer: deployer, records: map[string]*Record{}, bundles: map[string]*Bundle{}}
+
+	if err := target.Import(context.Background(), bundle); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(filepath.Join(hostRoot, "/opt/line2/secrets/plc_password.txt"))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected the secret to be written with restricted permissions, got %v %v", info, err)
+	}
+
+	if err := target.Import(context.Background(), bundle); err == nil {
+		t.Error("expected the import in a non-empty project directory to be refused")
+	}
+
+	if err := target.Execute(context.Background(), "line2", ActionStart); err != nil {
+		t.Fatal(err)
+	}
+
+	if deployer.options.WorkingDir != "/opt/line2" || !reflect.DeepEqual(deployer.options.Env, []string{"PLC_HOST=10.0.2.10"}) {
+		t.Errorf("unexpected deploy options: %+v", deployer.options)
+	}
+
+	if len(deployer.deployed) != 2 || deployer.deployed[0] != filepath.Join(hostRoot, "/opt/line2/docker-compose.yml") {
+		t.Errorf("unexpected compose files: %v", deployer.deployed)
+	}
+
+	if err := source.Execute(context.Background(), "line2", ActionComplete); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(engine.removed, []string{"a1", "b2"}) {
+		t.Errorf("expected the containers of the source to be removed, got %v", engine.removed)
+	}
+
+	records := source.Records()
+	if len(records) != 1 || records[0].Role != RoleSource || records[0].State != StateCompleted {
+		t.Errorf("unexpected records: %+v", records)
+	}
+}
+
+func TestExportSecretOutsideProject(t *testing.T) {
+	withHostRoot(t)
+	writeHostFile(t, "/opt/line2/docker-compose.yml", "services: {}\n")
+	writeHostFile(t, "/etc/line2/token", "token")
+
+	engine := sourceEngine()
+	engine.containers[0].Mounts = []mount{{Type: "bind", Source: "/etc/line2/token", Destination: "/run/secrets/token"}}
+	engine.containers[0].Labels = map[string]string{labelWorkingDir: "/opt/line2", labelConfigFiles: "/opt/line2/docker-compose.yml"}
+
+	manager := &Manager{engine: engine, records: map[string]*Record{}, bundles: map[string]*Bundle{}}
+
+	if _, err := manager.Export(context.Background(), "line2"); err == nil {
+		t.Error("expected the secret outside of the project directory to be refused")
+	}
+}
+
+func TestBundleValidate(t *testing.T) {
+	valid := Bundle{Version: bundleVersion, Stack: "line2", WorkingDir: "/opt/line2", ComposeFiles: []string{"docker-compose.yml"}, Files: []File{{Path: "docker-compose.yml"}}}
+
+	for name, mutate := range map[string]func(b *Bundle){
+		"valid":               func(b *Bundle) {},
+		"relative directory":  func(b *Bundle) { b.WorkingDir = "opt/line2" },
+		"root directory":      func(b *Bundle) { b.WorkingDir = "/" },
+		"path traversal":      func(b *Bundle) { b.Files = append(b.Files, File{Path: "../../etc/cron.d/job"}) },
+		"missing compose":     func(b *Bundle) { b.ComposeFiles = []string{"compose.yml"} },
+		"unsupported version": func(b *Bundle) { b.Version = 2 },
+	} {
+		bundle := valid
+		bundle.Files = append([]File{}, valid.Files...)
+		mutate(&bundle)
+
+		if err := bundle.Validate(); (err == nil) != (name == "valid") {
+			t.Errorf("%s: unexpected validation result: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,458 @@
+package net
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/rs/zerolog/log"
+)
+
+// Subsystems whose network traffic is accounted
+const (
+	// BandwidthSnapshots is the traffic of the requests sent by the Edge agent to the Portainer server (polling,
+	// snapshots, stack files)
+	BandwidthSnapshots = "snapshots"
+	// BandwidthTunnel is the traffic of the reverse tunnel opened to the Portainer server
+	BandwidthTunnel = "tunnel"
+	// BandwidthLogStreams is the traffic of the container and service logs streamed by the agent API
+	BandwidthLogStreams = "log_streams"
+	// BandwidthFileTransfers is the traffic of the files uploaded to and downloaded from the agent API (volume and
+	// host browsing, container archives, stack synchronization)
+	BandwidthFileTransfers = "file_transfers"
+	// BandwidthSFTP is the traffic of the SFTP sessions
+	BandwidthSFTP = "sftp"
+	// BandwidthEventBus is the traffic of the messages published on the event bus
+	BandwidthEventBus = "event_bus"
+	// BandwidthLogShipping is the traffic of the container logs shipped to the log sink
+	BandwidthLogShipping = "log_shipping"
+	// BandwidthSBOMUploads is the traffic of the SBOMs of the images uploaded to the endpoint given by the server
+	BandwidthSBOMUploads = "sbom_uploads"
+)
+
+// bandwidthSaveInterval is the interval between two writes of the usage on the disk
+const bandwidthSaveInterval = time.Minute
+
+// ErrBandwidthCapExceeded is returned when the monthly bandwidth cap is reached
+var ErrBandwidthCapExceeded = errors.New("the monthly bandwidth cap is exceeded")
+
+// apiSubsystems are served through the agent API. In Edge mode, the API is reached through the tunnel so their
+// traffic is a detail of the traffic of the tunnel and is not counted twice in the monthly usage.
+var apiSubsystems = map[string]bool{
+	BandwidthLogStreams:    true,
+	BandwidthFileTransfers: true,
+}
+
+// BandwidthUsage represents the bytes sent and received by a subsystem during the current month
+type BandwidthUsage struct {
+	Subsystem string `json:"subsystem"`
+	Sent      uint64 `json:"sent"`
+	Received  uint64 `json:"received"`
+}
+
+// BandwidthReport represents the bandwidth usage of the agent during the current month
+type BandwidthReport struct {
+	Month      string           `json:"month"`
+	Subsystems []BandwidthUsage `json:"subsystems"`
+	// Total is the traffic counted against the monthly cap
+	Total      uint64 `json:"total"`
+	MonthlyCap uint64 `json:"monthlyCap,omitempty"`
+}
+
+// BandwidthMeter accounts the bytes sent and received by the subsystems of the agent. The usage is reset every
+// month and persisted so that it survives the restarts of the agent.
+type BandwidthMeter struct {
+	statePath        string
+	monthlyCap       uint64
+	warningThreshold int
+	month            string
+	usage            map[string]*BandwidthUsage
+	warned           bool
+	capExceeded      bool
+	dirty            bool
+	mu               sync.Mutex
+}
+
+type bandwidthState struct {
+	Month string           `json:"month"`
+	Usage []BandwidthUsage `json:"usage"`
+}
+
+var defaultBandwidthMeter *BandwidthMeter
+
+// NewBandwidthMeter returns a meter persisting the usage in statePath. A warning is reported once the usage
+// reaches warningThreshold percent of monthlyCap, no cap is enforced when monthlyCap is 0.
+func NewBandwidthMeter(statePath string, monthlyCap uint64, warningThreshold int) (*BandwidthMeter, error) {
+	meter := &BandwidthMeter{
+		statePath:        statePath,
+		monthlyCap:       monthlyCap,
+		warningThreshold: warningThreshold,
+		month:            currentMonth(),
+		usage:            map[string]*BandwidthUsage{},
+	}
+
+	content, err := os.ReadFile(statePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return meter, nil
+		}
+
+		return nil, err
+	}
+
+	var state bandwidthState
+	if err := json.Unmarshal(content, &state); err != nil {
+		log.Warn().Err(err).Str("path", statePath).Msg("unable to parse the persisted bandwidth usage, resetting it")
+
+		return meter, nil
+	}
+
+	if state.Month != meter.month {
+		return meter, nil
+	}
+
+	for _, usage := range state.Usage {
+		usage := usage
+		meter.usage[usage.Subsystem] = &usage
+	}
+
+	meter.warned = meter.total() >= meter.warningLevel()
+	meter.capExceeded = meter.isCapExceeded()
+
+	return meter, nil
+}
+
+// Record adds the bytes sent and received by a subsystem to the usage of the current month
+func (meter *BandwidthMeter) Record(subsystem string, sent, received int) {
+	if sent <= 0 && received <= 0 {
+		return
+	}
+
+	meter.mu.Lock()
+	defer meter.mu.Unlock()
+
+	meter.rotate()
+
+	usage, ok := meter.usage[subsystem]
+	if !ok {
+		usage = &BandwidthUsage{Subsystem: subsystem}
+		meter.usage[subsystem] = usage
+	}
+
+	if sent > 0 {
+		usage.Sent += uint64(sent)
+	}
+
+	if received > 0 {
+		usage.Received += uint64(received)
+	}
+
+	meter.dirty = true
+
+	if meter.monthlyCap == 0 || apiSubsystems[subsystem] {
+		return
+	}
+
+	total := meter.total()
+
+	if !meter.warned && total >= meter.warningLevel() {
+		meter.warned = true
+
+		log.Warn().
+			Str("usage", units.HumanSize(float64(total))).
+			Str("monthly_cap", units.HumanSize(float64(meter.monthlyCap))).
+			Msg("the bandwidth usage is approaching the monthly cap")
+	}
+
+	if !meter.capExceeded && meter.isCapExceeded() {
+		meter.capExceeded = true
+
+		log.Warn().
+			Str("monthly_cap", units.HumanSize(float64(meter.monthlyCap))).
+			Msg("the monthly bandwidth cap is exceeded, the log streams and the file transfers are refused until the end of the month")
+	}
+}
+
+// CapExceeded returns true when the usage of the current month exceeds the monthly cap
+func (meter *BandwidthMeter) CapExceeded() bool {
+	meter.mu.Lock()
+	defer meter.mu.Unlock()
+
+	meter.rotate()
+
+	return meter.capExceeded
+}
+
+// Report returns the usage of the current month, sorted by subsystem
+func (meter *BandwidthMeter) Report() BandwidthReport {
+	meter.mu.Lock()
+	defer meter.mu.Unlock()
+
+	meter.rotate()
+
+	report := BandwidthReport{
+		Month:      meter.month,
+		Subsystems: make([]BandwidthUsage, 0, len(meter.usage)),
+		Total:      meter.total(),
+		MonthlyCap: meter.monthlyCap,
+	}
+
+	for _, usage := range meter.usage {
+		report.Subsystems = append(report.Subsystems, *usage)
+	}
+
+	sort.Slice(report.Subsystems, func(i, j int) bool {
+		return report.Subsystems[i].Subsystem < report.Subsystems[j].Subsystem
+	})
+
+	return report
+}
+
+// Diagnostics returns a diagnostic message when the usage reaches the warning threshold of the monthly cap
+func (meter *BandwidthMeter) Diagnostics() []string {
+	report := meter.Report()
+	if report.MonthlyCap == 0 || report.Total < meter.warningLevel() {
+		return nil
+	}
+
+	return []string{fmt.Sprintf("bandwidth usage: %s of the %s monthly cap used in %s",
+		units.HumanSize(float64(report.Total)), units.HumanSize(float64(report.MonthlyCap)), report.Month)}
+}
+
+// Save writes the usage on the disk when it changed since the last save
+func (meter *BandwidthMeter) Save() error {
+	meter.mu.Lock()
+	if !meter.dirty {
+		meter.mu.Unlock()
+		return nil
+	}
+
+	state := bandwidthState{Month: meter.month}
+	for _, usage := range meter.usage {
+		state.Usage = append(state.Usage, *usage)
+	}
+	meter.dirty = false
+	meter.mu.Unlock()
+
+	content, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(meter.statePath, content, 0600)
+}
+
+// rotate resets the usage when a new month starts, it must be called with the lock held
+func (meter *BandwidthMeter) rotate() {
+	month := currentMonth()
+	if month == meter.month {
+		return
+	}
+
+	meter.month = month
+	meter.usage = map[string]*BandwidthUsage{}
+	meter.warned = false
+	meter.capExceeded = false
+	meter.dirty = true
+}
+
+// total returns the traffic counted against the monthly cap, it must be called with the lock held
+func (meter *BandwidthMeter) total() uint64 {
+	var total uint64
+	for subsystem, usage := range meter.usage {
+		if !apiSubsystems[subsystem] {
+			total += usage.Sent + usage.Received
+		}
+	}
+
+	return total
+}
+
+func (meter *BandwidthMeter) warningLevel() uint64 {
+	return meter.monthlyCap * uint64(meter.warningThreshold) / 100
+}
+
+func (meter *BandwidthMeter) isCapExceeded() bool {
+	return meter.monthlyCap > 0 && meter.total() >= meter.monthlyCap
+}
+
+func currentMonth() string {
+	return time.Now().UTC().Format("2006-01")
+}
+
+// EnableBandwidthAccounting makes meter the meter used by the subsystems of the agent and persists its usage
+// periodically
+func EnableBandwidthAccounting(meter *BandwidthMeter) {
+	defaultBandwidthMeter = meter
+
+	go func() {
+		ticker := time.NewTicker(bandwidthSaveInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := meter.Save(); err != nil {
+				log.Warn().Err(err).Msg("unable to persist the bandwidth usage")
+			}
+		}
+	}()
+}
+
+// RecordBandwidth adds the bytes sent and received by a subsystem to the usage of the enabled meter, if any
+func RecordBandwidth(subsystem string, sent, received int) {
+	if defaultBandwidthMeter != nil {
+		defaultBandwidthMeter.Record(subsystem, sent, received)
+	}
+}
+
+// BandwidthCapExceeded returns true when the enabled meter, if any, exceeds its monthly cap
+func BandwidthCapExceeded() bool {
+	return defaultBandwidthMeter != nil && defaultBandwidthMeter.CapExceeded()
+}
+
+// GetBandwidthReport returns the usage of the enabled meter, or nil when the accounting is not enabled
+func GetBandwidthReport() *BandwidthReport {
+	if defaultBandwidthMeter == nil {
+		return nil
+	}
+
+	report := defaultBandwidthMeter.Report()
+
+	return &report
+}
+
+// BandwidthDiagnostics returns the diagnostic messages of the enabled meter, if any
+func BandwidthDiagnostics() []string {
+	if defaultBandwidthMeter == nil {
+		return nil
+	}
+
+	return defaultBandwidthMeter.Diagnostics()
+}
+
+type meteredReader struct {
+	r         io.Reader
+	subsystem string
+	sent      bool
+}
+
+func (reader *meteredReader) Read(p []byte) (int, error) {
+	n, err := reader.r.Read(p)
+
+	if reader.sent {
+		RecordBandwidth(reader.subsystem, n, 0)
+	} else {
+		RecordBandwidth(reader.subsystem, 0, n)
+	}
+
+	return n, err
+}
+
+// MeterSentReader counts the bytes read from r as sent by the subsystem, r is typically the body of an outbound request
+func MeterSentReader(subsystem string, r io.Reader) io.Reader {
+	return &meteredReader{r: r, subsystem: subsystem, sent: true}
+}
+
+// MeterReceivedReader counts the bytes read from r as received by the subsystem
+func MeterReceivedReader(subsystem string, r io.Reader) io.Reader {
+	return &meteredReader{r: r, subsystem: subsystem}
+}
+
+type meteredWriter struct {
+	w         io.Writer
+	subsystem string
+}
+
+func (writer *meteredWriter) Write(p []byte) (int, error) {
+	n, err := writer.w.Write(p)
+	RecordBandwidth(writer.subsystem, n, 0)
+
+	return n, err
+}
+
+// MeterWriter counts the bytes written to w as sent by the subsystem
+func MeterWriter(subsystem string, w io.Writer) io.Writer {
+	return &meteredWriter{w: w, subsystem: subsystem}
+}
+
+type meteredConn struct {
+	net.Conn
+	subsystem string
+}
+
+func (conn *meteredConn) Read(p []byte) (int, error) {
+	n, err := conn.Conn.Read(p)
+	RecordBandwidth(conn.subsystem, 0, n)
+
+	return n, err
+}
+
+func (conn *meteredConn) Write(p []byte) (int, error) {
+	n, err := conn.Conn.Write(p)
+	RecordBandwidth(conn.subsystem, n, 0)
+
+	return n, err
+}
+
+// MeterConn accounts the traffic of conn to the subsystem
+func MeterConn(subsystem string, conn net.Conn) net.Conn {
+	return &meteredConn{Conn: conn, subsystem: subsystem}
+}
+
+// MeterDialContext wraps dial to account the traffic of the connections to the subsystem
+func MeterDialContext(subsystem string, dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		return MeterConn(subsystem, conn), nil
+	}
+}
+
+type meteredResponseWriter struct {
+	http.ResponseWriter
+	subsystem string
+}
+
+func (rw *meteredResponseWriter) Write(p []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(p)
+	RecordBandwidth(rw.subsystem, n, 0)
+
+	return n, err
+}
+
+func (rw *meteredResponseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// MeterHandler accounts the request and response bodies of next to the subsystem. The requests are refused
+// once the monthly bandwidth cap is exceeded.
+func MeterHandler(subsystem string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if BandwidthCapExceeded() {
+			http.Error(rw, ErrBandwidthCapExceeded.Error(), http.StatusTooManyRequests)
+			return
+		}
+
+		if r.Body != nil {
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{MeterReceivedReader(subsystem, r.Body), r.Body}
+		}
+
+		next.ServeHTTP(&meteredResponseWriter{ResponseWriter: rw, subsystem: subsystem}, r)
+	})
+}
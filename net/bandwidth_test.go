@@ -0,0 +1,91 @@
+package net
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBandwidthMeterCap(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "usage.json")
+
+	meter, err := NewBandwidthMeter(statePath, 1000, 80)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	meter.Record(BandwidthSnapshots, 300, 200)
+	meter.Record(BandwidthFileTransfers, 5000, 0)
+
+	if meter.CapExceeded() {
+		t.Fatal("the traffic of the API subsystems must not be counted against the cap")
+	}
+
+	if diagnostics := meter.Diagnostics(); len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+
+	meter.Record(BandwidthTunnel, 100, 250)
+
+	if diagnostics := meter.Diagnostics(); len(diagnostics) != 1 {
+		t.Fatalf("expected a diagnostic once the warning threshold is reached, got %v", diagnostics)
+	}
+
+	meter.Record(BandwidthTunnel, 150, 0)
+
+	if !meter.CapExceeded() {
+		t.Fatal("expected the cap to be exceeded")
+	}
+
+	report := meter.Report()
+	if report.Total != 1000 || len(report.Subsystems) != 3 || report.Subsystems[0].Subsystem != BandwidthFileTransfers {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	if err := meter.Save(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	reloaded, err := NewBandwidthMeter(statePath, 1000, 80)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reloaded.CapExceeded() || reloaded.Report().Total != 1000 {
+		t.Fatalf("expected the usage to be restored, got %+v", reloaded.Report())
+	}
+}
+
+func TestMeterHandler(t *testing.T) {
+	meter, err := NewBandwidthMeter(filepath.Join(t.TempDir(), "usage.json"), 100, 80)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	defaultBandwidthMeter = meter
+	defer func() { defaultBandwidthMeter = nil }()
+
+	handler := MeterHandler(BandwidthFileTransfers, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, 64)
+		n, _ := r.Body.Read(buf)
+		rw.Write(buf[:n])
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/browse/put", strings.NewReader("content")))
+
+	report := meter.Report()
+	if len(report.Subsystems) != 1 || report.Subsystems[0].Sent != 7 || report.Subsystems[0].Received != 7 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	meter.Record(BandwidthTunnel, 100, 0)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/browse/get", nil))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the request to be refused once the cap is exceeded, got %d", rec.Code)
+	}
+}
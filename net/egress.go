@@ -0,0 +1,214 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrEgressDenied is returned when the agent tries to connect to a host that is not part of the egress allowlist
+var ErrEgressDenied = errors.New("outbound connection denied by the egress allowlist")
+
+// EgressViolation describes the denied connection attempts to a host
+type EgressViolation struct {
+	Address  string
+	Count    int
+	LastSeen time.Time
+}
+
+// EgressPolicy restricts the hosts the agent is allowed to connect to. The allowlist entries are host names
+// (example.com), wildcard domains (*.example.com), IP addresses or CIDR ranges, optionally followed by a port.
+type EgressPolicy struct {
+	entries    []egressEntry
+	violations map[string]*EgressViolation
+	mu         sync.Mutex
+}
+
+type egressEntry struct {
+	host    string
+	port    string
+	network *net.IPNet
+}
+
+var defaultEgressPolicy *EgressPolicy
+
+// NewEgressPolicy returns an egress policy allowing the connections to the hosts of allowlist
+func NewEgressPolicy(allowlist []string) (*EgressPolicy, error) {
+	policy := &EgressPolicy{
+		violations: make(map[string]*EgressViolation),
+	}
+
+	for _, value := range allowlist {
+		entry, err := parseEgressEntry(value)
+		if err != nil {
+			return nil, err
+		}
+
+		policy.entries = append(policy.entries, entry)
+	}
+
+	return policy, nil
+}
+
+func parseEgressEntry(value string) (egressEntry, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	if _, network, err := net.ParseCIDR(value); err == nil {
+		return egressEntry{network: network}, nil
+	}
+
+	entry := egressEntry{host: value}
+	if host, port, err := net.SplitHostPort(value); err == nil {
+		entry.host, entry.port = host, port
+	}
+
+	if entry.host == "" || entry.host == "*" {
+		return entry, fmt.Errorf("invalid egress allowlist entry: %q", value)
+	}
+
+	return entry, nil
+}
+
+func (entry egressEntry) matches(host, port string) bool {
+	if entry.network != nil {
+		ip := net.ParseIP(host)
+
+		return ip != nil && entry.network.Contains(ip)
+	}
+
+	if entry.port != "" && entry.port != port {
+		return false
+	}
+
+	if strings.HasPrefix(entry.host, "*.") {
+		return strings.HasSuffix(host, entry.host[1:])
+	}
+
+	return host == entry.host
+}
+
+// IsAllowed returns true when the policy allows the connections to addr (host:port)
+func (policy *EgressPolicy) IsAllowed(addr string) bool {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	for _, entry := range policy.entries {
+		if entry.matches(host, port) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DialContext wraps dial to refuse the connections to the hosts that are not allowed and record them
+func (policy *EgressPolicy) DialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if strings.HasPrefix(network, "tcp") && !policy.IsAllowed(addr) {
+			policy.recordViolation(addr)
+
+			return nil, fmt.Errorf("%w: %s", ErrEgressDenied, addr)
+		}
+
+		return dial(ctx, network, addr)
+	}
+}
+
+func (policy *EgressPolicy) recordViolation(addr string) {
+	policy.mu.Lock()
+	defer policy.mu.Unlock()
+
+	violation, ok := policy.violations[addr]
+	if !ok {
+		violation = &EgressViolation{Address: addr}
+		policy.violations[addr] = violation
+
+		log.Warn().Str("address", addr).Msg("outbound connection denied by the egress allowlist")
+	}
+
+	violation.Count++
+	violation.LastSeen = time.Now()
+}
+
+// Violations returns the denied connection attempts, sorted by address
+func (policy *EgressPolicy) Violations() []EgressViolation {
+	policy.mu.Lock()
+	defer policy.mu.Unlock()
+
+	violations := make([]EgressViolation, 0, len(policy.violations))
+	for _, violation := range policy.violations {
+		violations = append(violations, *violation)
+	}
+
+	sort.Slice(violations, func(i, j int) bool {
+		return violations[i].Address < violations[j].Address
+	})
+
+	return violations
+}
+
+// EnforceEgressPolicy applies the policy to the default HTTP transport, which is used or cloned by the agent
+// subsystems contacting external hosts (Portainer server, registries, git repositories, revocation lists)
+func EnforceEgressPolicy(policy *EgressPolicy) {
+	transport := http.DefaultTransport.(*http.Transport)
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport.DialContext = policy.DialContext(dialer.DialContext)
+
+	// When a proxy is used, the connections are made to the proxy so the target host is checked beforehand
+	proxy := transport.Proxy
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		addr := requestAddr(req.URL)
+		if !policy.IsAllowed(addr) {
+			policy.recordViolation(addr)
+
+			return nil, fmt.Errorf("%w: %s", ErrEgressDenied, addr)
+		}
+
+		if proxy == nil {
+			return nil, nil
+		}
+
+		return proxy(req)
+	}
+
+	defaultEgressPolicy = policy
+}
+
+func requestAddr(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" || u.Scheme == "wss" {
+			port = "443"
+		}
+	}
+
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// EgressViolations returns the connection attempts denied by the enforced egress policy, if any
+func EgressViolations() []EgressViolation {
+	if defaultEgressPolicy == nil {
+		return nil
+	}
+
+	return defaultEgressPolicy.Violations()
+}
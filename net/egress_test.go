@@ -0,0 +1,80 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestEgressPolicyIsAllowed(t *testing.T) {
+	policy, err := NewEgressPolicy([]string{"portainer.example.com:9443", "*.registry.example.com", "10.0.0.0/8", "github.com"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	tests := map[string]bool{
+		"portainer.example.com:9443":   true,
+		"PORTAINER.example.com.:9443":  true,
+		"portainer.example.com:443":    false,
+		"eu.registry.example.com:443":  true,
+		"registry.example.com:443":     false,
+		"10.1.2.3:8000":                true,
+		"192.168.1.1:8000":             false,
+		"github.com:443":               true,
+		"api.github.com:443":           false,
+		"evilregistry.example.com:443": false,
+	}
+
+	for addr, expected := range tests {
+		if allowed := policy.IsAllowed(addr); allowed != expected {
+			t.Errorf("IsAllowed(%q) = %t, expected %t", addr, allowed, expected)
+		}
+	}
+}
+
+func TestEgressPolicyDialContext(t *testing.T) {
+	policy, err := NewEgressPolicy([]string{"allowed.example.com"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	dialed := 0
+	dial := policy.DialContext(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed++
+		return nil, nil
+	})
+
+	for i := 0; i < 2; i++ {
+		_, err = dial(context.Background(), "tcp", "denied.example.com:443")
+		if !errors.Is(err, ErrEgressDenied) {
+			t.Fatalf("expected ErrEgressDenied, got %v", err)
+		}
+	}
+
+	_, err = dial(context.Background(), "tcp", "allowed.example.com:443")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	_, err = dial(context.Background(), "unix", "/var/run/docker.sock")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if dialed != 2 {
+		t.Errorf("expected 2 connections, got %d", dialed)
+	}
+
+	violations := policy.Violations()
+	if len(violations) != 1 || violations[0].Address != "denied.example.com:443" || violations[0].Count != 2 {
+		t.Errorf("unexpected violations: %+v", violations)
+	}
+}
+
+func TestNewEgressPolicyInvalidEntry(t *testing.T) {
+	_, err := NewEgressPolicy([]string{"*"})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
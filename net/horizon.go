@@ -0,0 +1,179 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// AddressRule maps a host to another address while the host is connected to a network
+type AddressRule struct {
+	Host string
+	// Network is a CIDR range, the rule applies when the host has a route to the range, or the name of an
+	// interface, the rule applies when the default route goes through the interface
+	Network string
+	// Address is the address dialed instead of the host, with an optional port
+	Address string
+
+	cidr *net.IPNet
+}
+
+// SplitHorizon resolves the addresses of the hosts depending on the network the host is connected to, e.g. the
+// Portainer instance is reached through its LAN address on-site and through its public address over cellular. The
+// rules are evaluated in order each time a connection is made, so that a device roaming between networks always
+// uses the address of its current network.
+type SplitHorizon struct {
+	rules []AddressRule
+}
+
+var (
+	defaultSplitHorizon *SplitHorizon
+
+	// hostRoutes and defaultRouteInterfaces read the routing table of the host
+	hostRoutes             = GetHostRoutes
+	defaultRouteInterfaces = GetDefaultRouteInterfaces
+)
+
+// NewSplitHorizon returns a split horizon resolver for the rules, formatted as host@network=address, e.g.
+// portainer.example.com@10.20.0.0/16=10.20.1.5 or portainer.example.com@wwan0=203.0.113.10:9443
+func NewSplitHorizon(rules []string) (*SplitHorizon, error) {
+	horizon := &SplitHorizon{}
+
+	for _, value := range rules {
+		rule, err := parseAddressRule(value)
+		if err != nil {
+			return nil, err
+		}
+
+		horizon.rules = append(horizon.rules, rule)
+	}
+
+	return horizon, nil
+}
+
+func parseAddressRule(value string) (AddressRule, error) {
+	condition, address, found := strings.Cut(strings.TrimSpace(value), "=")
+	host, network, hasNetwork := strings.Cut(condition, "@")
+
+	if !found || !hasNetwork || host == "" || network == "" || address == "" {
+		return AddressRule{}, fmt.Errorf("invalid address rule %q, expected host@network=address", value)
+	}
+
+	rule := AddressRule{
+		Host:    strings.ToLower(host),
+		Network: network,
+		Address: address,
+	}
+
+	if strings.Contains(network, "/") {
+		_, cidr, err := net.ParseCIDR(network)
+		if err != nil {
+			return AddressRule{}, fmt.Errorf("invalid network of the address rule %q: %w", value, err)
+		}
+
+		rule.cidr = cidr
+	}
+
+	return rule, nil
+}
+
+// Resolve returns the address to dial instead of addr (host:port), addr when no rule applies to the current network
+func (horizon *SplitHorizon) Resolve(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	var routes []Route
+	var interfaces []string
+	var routesRead, interfacesRead bool
+
+	for _, rule := range horizon.rules {
+		if rule.Host != host {
+			continue
+		}
+
+		matched := false
+		if rule.cidr != nil {
+			if !routesRead {
+				routes, _ = hostRoutes()
+				routesRead = true
+			}
+
+			matched = routeToNetwork(routes, rule.cidr)
+		} else {
+			if !interfacesRead {
+				interfaces, _ = defaultRouteInterfaces()
+				interfacesRead = true
+			}
+
+			for _, iface := range interfaces {
+				matched = matched || iface == rule.Network
+			}
+		}
+
+		if !matched {
+			continue
+		}
+
+		if _, _, err := net.SplitHostPort(rule.Address); err == nil {
+			return rule.Address
+		}
+
+		return net.JoinHostPort(strings.Trim(rule.Address, "[]"), port)
+	}
+
+	return addr
+}
+
+func routeToNetwork(routes []Route, network *net.IPNet) bool {
+	for _, route := range routes {
+		if network.Contains(route.Destination.IP) || route.Destination.Contains(network.IP) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DialContext wraps dial to connect to the address resolved for the current network
+func (horizon *SplitHorizon) DialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		resolved := horizon.Resolve(addr)
+		if resolved != addr {
+			log.Debug().Str("address", addr).Str("resolved_address", resolved).Msg("split horizon address")
+		}
+
+		return dial(ctx, network, resolved)
+	}
+}
+
+// EnableSplitHorizon makes horizon the resolver used to connect to the Portainer instance
+func EnableSplitHorizon(horizon *SplitHorizon) {
+	defaultSplitHorizon = horizon
+}
+
+// ResolveServerAddress returns the address to dial instead of addr (host:port) according to the enabled split
+// horizon resolver, addr when no resolver is enabled
+func ResolveServerAddress(addr string) string {
+	if defaultSplitHorizon == nil {
+		return addr
+	}
+
+	return defaultSplitHorizon.Resolve(addr)
+}
+
+// SplitHorizonDialContext wraps dial with the enabled split horizon resolver, dial is returned when no resolver is
+// enabled
+func SplitHorizonDialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if defaultSplitHorizon == nil {
+		return dial
+	}
+
+	return defaultSplitHorizon.DialContext(dial)
+}
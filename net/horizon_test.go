@@ -0,0 +1,54 @@
+package net
+
+import (
+	"net"
+	"testing"
+)
+
+func TestSplitHorizonResolve(t *testing.T) {
+	horizon, err := NewSplitHorizon([]string{
+		"portainer.example.com@10.20.0.0/16=10.20.1.5",
+		"portainer.example.com@wwan0=203.0.113.10:9443",
+		"tunnel.example.com@wwan0=[2001:db8::1]",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, lan, _ := net.ParseCIDR("10.20.4.0/24")
+	_, cellular, _ := net.ParseCIDR("100.64.0.0/10")
+
+	tests := []struct {
+		name       string
+		routes     []Route
+		interfaces []string
+		addr       string
+		expected   string
+	}{
+		{name: "on-site", routes: []Route{{Interface: "eth0", Destination: lan}}, interfaces: []string{"eth0"}, addr: "portainer.example.com:443", expected: "10.20.1.5:443"},
+		{name: "cellular", routes: []Route{{Interface: "wwan0", Destination: cellular}}, interfaces: []string{"wwan0"}, addr: "Portainer.example.com.:443", expected: "203.0.113.10:9443"},
+		{name: "IPv6 address", interfaces: []string{"wwan0"}, addr: "tunnel.example.com:8000", expected: "[2001:db8::1]:8000"},
+		{name: "no matching network", routes: []Route{{Interface: "wlan0", Destination: cellular}}, interfaces: []string{"wlan0"}, addr: "portainer.example.com:443", expected: "portainer.example.com:443"},
+		{name: "other host", routes: []Route{{Interface: "eth0", Destination: lan}}, addr: "registry.example.com:443", expected: "registry.example.com:443"},
+	}
+
+	for _, test := range tests {
+		hostRoutes = func() ([]Route, error) { return test.routes, nil }
+		defaultRouteInterfaces = func() ([]string, error) { return test.interfaces, nil }
+
+		if resolved := horizon.Resolve(test.addr); resolved != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, resolved)
+		}
+	}
+
+	hostRoutes = GetHostRoutes
+	defaultRouteInterfaces = GetDefaultRouteInterfaces
+}
+
+func TestNewSplitHorizonInvalidRule(t *testing.T) {
+	for _, rule := range []string{"portainer.example.com=10.0.0.1", "portainer.example.com@10.0.0.0/33=10.0.0.1", "@eth0=10.0.0.1"} {
+		if _, err := NewSplitHorizon([]string{rule}); err == nil {
+			t.Errorf("expected the rule %q to be rejected", rule)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package net
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/portainer/agent"
+)
+
+// socket states of /proc/net/tcp and /proc/net/udp
+const (
+	tcpStateListen    = "0A"
+	udpStateUnconnect = "07"
+)
+
+// ListeningPort is a port on which a socket of the host is listening
+type ListeningPort struct {
+	Port     int
+	Protocol string
+}
+
+// GetHostListeningPorts returns the TCP and UDP ports on which the sockets of the host network namespace listen.
+// The sockets of the host network namespace are read through the host filesystem mount point when available, the
+// ones of the agent network namespace are used otherwise.
+func GetHostListeningPorts() ([]ListeningPort, error) {
+	dir := filepath.Join(agent.HostRoot, "proc", "1", "net")
+	if _, err := os.Stat(dir); err != nil {
+		dir = "/proc/net"
+	}
+
+	ports := []ListeningPort{}
+	seen := map[ListeningPort]bool{}
+
+	for _, file := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		f, err := os.Open(filepath.Join(dir, file))
+		if err != nil {
+			// IPv6 can be disabled
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		protocol := strings.TrimSuffix(file, "6")
+
+		for _, port := range parseListeningPorts(bufio.NewScanner(f), protocol) {
+			if !seen[port] {
+				seen[port] = true
+				ports = append(ports, port)
+			}
+		}
+
+		f.Close()
+	}
+
+	return ports, nil
+}
+
+// parseListeningPorts parses the content of a /proc/net/tcp or /proc/net/udp file and returns the ports of the
+// listening sockets
+func parseListeningPorts(scanner *bufio.Scanner, protocol string) []ListeningPort {
+	state := tcpStateListen
+	if protocol == "udp" {
+		state = udpStateUnconnect
+	}
+
+	ports := []ListeningPort{}
+
+	// Skip the header line
+	scanner.Scan()
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[3] != state {
+			continue
+		}
+
+		// the local address is the hexadecimal address and port separated by a colon
+		i := strings.LastIndex(fields[1], ":")
+		if i < 0 {
+			continue
+		}
+
+		port, err := strconv.ParseUint(fields[1][i+1:], 16, 16)
+		if err != nil || port == 0 {
+			continue
+		}
+
+		ports = append(ports, ListeningPort{Port: int(port), Protocol: protocol})
+	}
+
+	return ports
+}
@@ -0,0 +1,34 @@
+package net
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseListeningPorts(t *testing.T) {
+	tcp := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 21011 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:0CEA 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 21012 1 0000000000000000 100 0 0 10 0
+   2: 0101A8C0:0016 0201A8C0:D2F4 01 00000000:00000000 02:0009A0E4 00000000     0        0 31013 4 0000000000000000 20 4 31 10 -1
+`
+
+	ports := parseListeningPorts(bufio.NewScanner(strings.NewReader(tcp)), "tcp")
+
+	expected := []ListeningPort{{Port: 22, Protocol: "tcp"}, {Port: 3306, Protocol: "tcp"}}
+	if !reflect.DeepEqual(ports, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, ports)
+	}
+
+	udp := `   sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops
+  100: 00000000000000000000000000000000:14E9 00000000000000000000000000000000:0000 07 00000000:00000000 00:00000000 00000000   107        0 18431 2 0000000000000000 0
+`
+
+	ports = parseListeningPorts(bufio.NewScanner(strings.NewReader(udp)), "udp")
+
+	expected = []ListeningPort{{Port: 5353, Protocol: "udp"}}
+	if !reflect.DeepEqual(ports, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, ports)
+	}
+}
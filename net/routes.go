@@ -0,0 +1,122 @@
+package net
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/portainer/agent"
+)
+
+// Route represents an IPv4 route of the host routing table
+type Route struct {
+	Interface   string
+	Destination *net.IPNet
+}
+
+// GetHostRoutes returns the IPv4 routes of the host, default routes excluded.
+// The routing table of the host network namespace is read through the host filesystem mount point when available,
+// the routing table of the agent network namespace is used otherwise.
+func GetHostRoutes() ([]Route, error) {
+	f, err := openRouteTable()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseRoutes(bufio.NewScanner(f)), nil
+}
+
+// GetDefaultRouteInterfaces returns the interfaces of the default IPv4 routes of the host, e.g. eth0 when the host
+// is connected to a LAN and wwan0 when it uses its cellular modem
+func GetDefaultRouteInterfaces() ([]string, error) {
+	f, err := openRouteTable()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseDefaultRouteInterfaces(bufio.NewScanner(f)), nil
+}
+
+func openRouteTable() (*os.File, error) {
+	path := filepath.Join(agent.HostRoot, "proc", "1", "net", "route")
+	if _, err := os.Stat(path); err != nil {
+		path = "/proc/net/route"
+	}
+
+	return os.Open(path)
+}
+
+// parseRoutes parses the content of a /proc/net/route file
+func parseRoutes(scanner *bufio.Scanner) []Route {
+	routes := []Route{}
+
+	// Skip the header line
+	scanner.Scan()
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 {
+			continue
+		}
+
+		destination, err := parseHexIPv4(fields[1])
+		if err != nil {
+			continue
+		}
+
+		mask, err := parseHexIPv4(fields[7])
+		if err != nil {
+			continue
+		}
+
+		ones, _ := net.IPMask(mask).Size()
+		if ones == 0 {
+			continue
+		}
+
+		routes = append(routes, Route{
+			Interface:   fields[0],
+			Destination: &net.IPNet{IP: destination, Mask: net.IPMask(mask)},
+		})
+	}
+
+	return routes
+}
+
+// parseDefaultRouteInterfaces returns the interfaces of the default routes of a /proc/net/route file
+func parseDefaultRouteInterfaces(scanner *bufio.Scanner) []string {
+	var interfaces []string
+
+	// Skip the header line
+	scanner.Scan()
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 || fields[1] != "00000000" || fields[7] != "00000000" {
+			continue
+		}
+
+		interfaces = append(interfaces, fields[0])
+	}
+
+	return interfaces
+}
+
+// parseHexIPv4 parses an IPv4 address stored as a little-endian hexadecimal value
+func parseHexIPv4(value string) (net.IP, error) {
+	b, err := hex.DecodeString(value)
+	if err != nil || len(b) != 4 {
+		return nil, &net.ParseError{Type: "IP address", Text: value}
+	}
+
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(b))
+
+	return ip, nil
+}
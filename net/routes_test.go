@@ -0,0 +1,45 @@
+package net
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestParseRoutes(t *testing.T) {
+	content := `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth0	00000000	0101A8C0	0003	0	0	100	00000000	0	0	0
+eth0	0001A8C0	00000000	0001	0	0	100	00FFFFFF	0	0	0
+docker0	000011AC	00000000	0001	0	0	0	0000FFFF	0	0	0
+`
+
+	routes := parseRoutes(bufio.NewScanner(strings.NewReader(content)))
+
+	expected := map[string]string{
+		"192.168.1.0/24": "eth0",
+		"172.17.0.0/16":  "docker0",
+	}
+
+	if len(routes) != len(expected) {
+		t.Fatalf("expected %d routes, got %d", len(expected), len(routes))
+	}
+
+	for _, route := range routes {
+		iface, ok := expected[route.Destination.String()]
+		if !ok || iface != route.Interface {
+			t.Errorf("unexpected route %s on %s", route.Destination, route.Interface)
+		}
+	}
+}
+
+func TestParseDefaultRouteInterfaces(t *testing.T) {
+	content := `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+wwan0	00000000	0100400A	0003	0	0	700	00000000	0	0	0
+eth0	0001A8C0	00000000	0001	0	0	100	00FFFFFF	0	0	0
+`
+
+	interfaces := parseDefaultRouteInterfaces(bufio.NewScanner(strings.NewReader(content)))
+	if len(interfaces) != 1 || interfaces[0] != "wwan0" {
+		t.Errorf("expected the default route to go through wwan0, got %v", interfaces)
+	}
+}
@@ -0,0 +1,76 @@
+package netpolicy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// chain is the chain of the filter table holding the rules of the policies, jumped to from the DOCKER-USER chain
+// that Docker evaluates before its own forwarding rules
+const chain = "PORTAINER-NETPOLICY"
+
+// restoreInput returns the input of iptables-restore replacing the rules of the chain with the rules of the
+// containers. Only the new connections are filtered, the packets of the established connections are returned to
+// Docker.
+func restoreInput(containers []ContainerPolicy) string {
+	lines := []string{
+		"*filter",
+		":" + chain + " - [0:0]",
+		"-A " + chain + " -m conntrack --ctstate RELATED,ESTABLISHED -j RETURN",
+	}
+
+	for _, container := range containers {
+		for _, address := range container.Addresses {
+			for _, rule := range container.Ingress {
+				lines = append(lines, iptablesRule("-d", "-s", address, rule, container.Name+" ingress"))
+			}
+
+			for _, rule := range container.Egress {
+				lines = append(lines, iptablesRule("-s", "-d", address, rule, container.Name+" egress"))
+			}
+		}
+	}
+
+	lines = append(lines, "COMMIT", "")
+
+	return strings.Join(lines, "\n")
+}
+
+// iptablesRule returns the rule matching the traffic of the container at address, selected with containerFlag, and
+// of the peers of the rule, selected with peerFlag
+func iptablesRule(containerFlag, peerFlag, address string, rule Rule, comment string) string {
+	parts := []string{"-A", chain, containerFlag, address + "/32"}
+
+	if rule.CIDR != "" {
+		parts = append(parts, peerFlag, rule.CIDR)
+	}
+
+	if rule.Protocol != "" {
+		parts = append(parts, "-p", rule.Protocol)
+	}
+
+	if rule.Port != 0 {
+		parts = append(parts, "--dport", strconv.Itoa(rule.Port))
+	}
+
+	target := "RETURN"
+	if rule.Action == ActionDeny {
+		target = "DROP"
+	}
+
+	parts = append(parts, "-m", "comment", "--comment", fmt.Sprintf("%q", comment), "-j", target)
+
+	return strings.Join(parts, " ")
+}
+
+// applyCommand returns the host command atomically replacing the rules of the chain and jumping to the chain from
+// the DOCKER-USER chain. The iptables commands of the host use either the legacy or the nftables backend.
+func applyCommand(input string) []string {
+	script := fmt.Sprintf(`set -e
+iptables-restore --noflush <<'EOF'
+%sEOF
+iptables -C DOCKER-USER -j %s 2>/dev/null || iptables -I DOCKER-USER -j %s`, input, chain, chain)
+
+	return []string{"sh", "-c", script}
+}
@@ -0,0 +1,324 @@
+// Package netpolicy applies simple ingress and egress network policies to the containers of a standalone Docker
+// host, giving the edge hosts a basic network segmentation. The policies are declared in the labels of the
+// containers or pushed by the Portainer server, and enforced with the iptables rules of the host, through either its
+// legacy or its nftables backend.
+package netpolicy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker"
+
+	"github.com/docker/docker/api/types"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrDisabled is returned when the network policies are managed while they are not enabled on the agent
+var ErrDisabled = errors.New("the network policies are not enabled on this agent")
+
+var (
+	defaultEnforcer   *Enforcer
+	defaultEnforcerMu sync.Mutex
+)
+
+// CommandRunner executes cmd on the host and returns its output
+type CommandRunner func(ctx context.Context, cmd []string) ([]byte, error)
+
+// Report is the state of the network policies of the host reported in the snapshots
+type Report struct {
+	Containers []ContainerPolicy `json:"Containers"`
+	AppliedAt  *time.Time        `json:"AppliedAt,omitempty"`
+	// Errors are the invalid labels, the policies that cannot be enforced and the failure of the last application
+	Errors []string `json:"Errors,omitempty"`
+}
+
+// ContainerPolicy is the policy enforced on a container, the rules pushed by the server before the rules of its labels
+type ContainerPolicy struct {
+	ID        string   `json:"Id"`
+	Name      string   `json:"Name"`
+	Stack     string   `json:"Stack,omitempty"`
+	Addresses []string `json:"Addresses"`
+	Ingress   []Rule   `json:"Ingress,omitempty"`
+	Egress    []Rule   `json:"Egress,omitempty"`
+}
+
+// serverPolicies is the persisted form of the policies pushed by the server
+type serverPolicies struct {
+	Policies []Policy `json:"Policies"`
+}
+
+// Enforcer applies the network policies of the running containers of the host
+type Enforcer struct {
+	run            CommandRunner
+	listContainers func(ctx context.Context) ([]types.Container, error)
+	statePath      string
+
+	mu       sync.Mutex
+	server   []Policy
+	applied  string
+	report   Report
+	applyErr error
+}
+
+// NewEnforcer returns a pointer to an Enforcer executing the iptables commands on the host with image, which must
+// provide nsenter. The policies pushed by the server are persisted in statePath.
+func NewEnforcer(image, statePath string) (*Enforcer, error) {
+	enforcer := &Enforcer{
+		run: func(ctx context.Context, cmd []string) ([]byte, error) {
+			var output bytes.Buffer
+			err := docker.ExecHostCommand(ctx, image, cmd, &output)
+
+			return output.Bytes(), err
+		},
+		listContainers: docker.ListRunningContainers,
+		statePath:      statePath,
+	}
+
+	content, err := os.ReadFile(statePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if len(content) > 0 {
+		var persisted serverPolicies
+		if err := json.Unmarshal(content, &persisted); err != nil {
+			return nil, err
+		}
+
+		enforcer.server = persisted.Policies
+	}
+
+	return enforcer, nil
+}
+
+// Enable makes enforcer the enforcer of the policies pushed by the server and reported in the snapshots
+func Enable(enforcer *Enforcer) {
+	defaultEnforcerMu.Lock()
+	defer defaultEnforcerMu.Unlock()
+
+	defaultEnforcer = enforcer
+}
+
+// DefaultEnforcer returns the enabled enforcer, nil when the network policies are not enabled
+func DefaultEnforcer() *Enforcer {
+	defaultEnforcerMu.Lock()
+	defer defaultEnforcerMu.Unlock()
+
+	return defaultEnforcer
+}
+
+// Run applies the policies at each interval, when the containers or their policies changed, until ctx is done
+func (enforcer *Enforcer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := enforcer.Apply(ctx); err != nil {
+			log.Warn().Err(err).Msg("unable to apply the network policies")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ServerPolicies returns the policies pushed by the server
+func (enforcer *Enforcer) ServerPolicies() []Policy {
+	enforcer.mu.Lock()
+	defer enforcer.mu.Unlock()
+
+	return append([]Policy{}, enforcer.server...)
+}
+
+// UpdateServerPolicies persists the policies pushed by the server, which replace the previous ones, and applies
+// them immediately. An empty list removes them.
+func (enforcer *Enforcer) UpdateServerPolicies(ctx context.Context, policies []Policy) error {
+	for i := range policies {
+		if err := policies[i].Validate(); err != nil {
+			return err
+		}
+	}
+
+	enforcer.mu.Lock()
+
+	if len(policies) == 0 {
+		if err := os.Remove(enforcer.statePath); err != nil && !os.IsNotExist(err) {
+			enforcer.mu.Unlock()
+
+			return err
+		}
+	} else {
+		content, err := json.Marshal(serverPolicies{Policies: policies})
+		if err != nil {
+			enforcer.mu.Unlock()
+
+			return err
+		}
+
+		if err := os.WriteFile(enforcer.statePath, content, 0600); err != nil {
+			enforcer.mu.Unlock()
+
+			return err
+		}
+	}
+
+	enforcer.server = policies
+	enforcer.mu.Unlock()
+
+	return enforcer.Apply(ctx)
+}
+
+// Apply replaces the iptables rules of the host with the rules of the policies of the running containers, the rules
+// are only applied when they changed since the last successful application
+func (enforcer *Enforcer) Apply(ctx context.Context) error {
+	containers, err := enforcer.listContainers(ctx)
+	if err != nil {
+		return err
+	}
+
+	enforcer.mu.Lock()
+	defer enforcer.mu.Unlock()
+
+	policies, errs := containerPolicies(containers, enforcer.server)
+
+	input := restoreInput(policies)
+	if input != enforcer.applied || enforcer.applyErr != nil {
+		output, err := enforcer.run(ctx, applyCommand(input))
+		if err != nil {
+			err = fmt.Errorf("%w: %s", err, bytes.TrimSpace(output))
+		} else {
+			now := time.Now().UTC()
+			enforcer.applied = input
+			enforcer.report.AppliedAt = &now
+
+			log.Info().Int("containers", len(policies)).Msg("network policies applied")
+		}
+
+		enforcer.applyErr = err
+	}
+
+	if enforcer.applyErr != nil {
+		errs = append(errs, fmt.Sprintf("unable to apply the network policies: %s", enforcer.applyErr))
+	}
+
+	enforcer.report.Containers = policies
+	enforcer.report.Errors = errs
+
+	return enforcer.applyErr
+}
+
+// Report returns a copy of the state of the network policies, nil when the network policies are not enabled
+func (enforcer *Enforcer) Report() *Report {
+	if enforcer == nil {
+		return nil
+	}
+
+	enforcer.mu.Lock()
+	defer enforcer.mu.Unlock()
+
+	report := enforcer.report
+	report.Containers = append([]ContainerPolicy{}, report.Containers...)
+	report.Errors = append([]string(nil), report.Errors...)
+
+	return &report
+}
+
+// Diagnostics returns a diagnostic message for each invalid label, each policy that cannot be enforced and the
+// failure of the last application
+func (report *Report) Diagnostics() []string {
+	if report == nil {
+		return nil
+	}
+
+	return report.Errors
+}
+
+// containerPolicies returns the policies of the running containers that have rules, the rules pushed by the server
+// first, and the errors of the labels and of the policies that cannot be enforced
+func containerPolicies(containers []types.Container, server []Policy) ([]ContainerPolicy, []string) {
+	policies := []ContainerPolicy{}
+	var errs []string
+
+	for _, c := range containers {
+		policy := ContainerPolicy{
+			ID:    c.ID,
+			Name:  containerName(c),
+			Stack: c.Labels[docker.ComposeProjectLabel],
+		}
+
+		for _, serverPolicy := range server {
+			if (serverPolicy.Container != "" && serverPolicy.Container == policy.Name) || (serverPolicy.Stack != "" && serverPolicy.Stack == policy.Stack) {
+				policy.Ingress = append(policy.Ingress, serverPolicy.Ingress...)
+				policy.Egress = append(policy.Egress, serverPolicy.Egress...)
+			}
+		}
+
+		for label, rules := range map[string]*[]Rule{
+			agent.ContainerLabelNetworkPolicyIngress: &policy.Ingress,
+			agent.ContainerLabelNetworkPolicyEgress:  &policy.Egress,
+		} {
+			value, ok := c.Labels[label]
+			if !ok {
+				continue
+			}
+
+			labelRules, err := ParseRules(value)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("invalid label %s of the container %s: %s", label, policy.Name, err))
+
+				continue
+			}
+
+			*rules = append(*rules, labelRules...)
+		}
+
+		if len(policy.Ingress) == 0 && len(policy.Egress) == 0 {
+			continue
+		}
+
+		if c.NetworkSettings != nil {
+			for _, network := range c.NetworkSettings.Networks {
+				if network != nil && network.IPAddress != "" {
+					policy.Addresses = append(policy.Addresses, network.IPAddress)
+				}
+			}
+		}
+
+		if len(policy.Addresses) == 0 {
+			errs = append(errs, fmt.Sprintf("the network policy of the container %s cannot be enforced, it has no bridge network address", policy.Name))
+
+			continue
+		}
+
+		sort.Strings(policy.Addresses)
+		policies = append(policies, policy)
+	}
+
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].Name < policies[j].Name
+	})
+	sort.Strings(errs)
+
+	return policies, errs
+}
+
+func containerName(c types.Container) string {
+	if len(c.Names) == 0 {
+		return c.ID
+	}
+
+	return strings.TrimPrefix(c.Names[0], "/")
+}
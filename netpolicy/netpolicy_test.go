@@ -0,0 +1,148 @@
+package netpolicy
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+)
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules("allow 10.0.0.0/8 tcp/80, allow udp/53 ,icmp-less, deny")
+	if err == nil {
+		t.Fatalf("expected an error for the unsupported action, got %v", rules)
+	}
+
+	rules, err = ParseRules("allow 10.0.0.0/8 tcp/80, allow udp/53, allow icmp, deny")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Rule{
+		{Action: ActionAllow, CIDR: "10.0.0.0/8", Protocol: ProtocolTCP, Port: 80},
+		{Action: ActionAllow, Protocol: ProtocolUDP, Port: 53},
+		{Action: ActionAllow, Protocol: ProtocolICMP},
+		{Action: ActionDeny},
+	}
+
+	if !reflect.DeepEqual(rules, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, rules)
+	}
+
+	for _, invalid := range []string{"allow tcp/http", "allow icmp/8", "deny sctp", "allow 10.0.0.300/8", "allow fd00::/8", "allow tcp/70000"} {
+		if _, err := ParseRules(invalid); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestPolicy_Validate(t *testing.T) {
+	for _, policy := range []Policy{
+		{},
+		{Stack: "shop", Container: "shop-web-1"},
+		{Stack: "shop", Egress: []Rule{{Action: "reject"}}},
+	} {
+		if err := policy.Validate(); err == nil {
+			t.Errorf("expected an error for %+v", policy)
+		}
+	}
+}
+
+func policyTestContainer(id, name, stack, address string, labels map[string]string) types.Container {
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[docker.ComposeProjectLabel] = stack
+
+	c := types.Container{ID: id, Names: []string{"/" + name}, Labels: labels}
+	c.NetworkSettings = &types.SummaryNetworkSettings{Networks: map[string]*network.EndpointSettings{}}
+
+	if address != "" {
+		c.NetworkSettings.Networks["default"] = &network.EndpointSettings{IPAddress: address}
+	}
+
+	return c
+}
+
+func TestEnforcer_Apply(t *testing.T) {
+	containers := []types.Container{
+		policyTestContainer("db1", "shop-db-1", "shop", "172.18.0.2", map[string]string{
+			agent.ContainerLabelNetworkPolicyIngress: "allow 172.18.0.0/16 tcp/5432, deny",
+		}),
+		policyTestContainer("web1", "shop-web-1", "shop", "172.18.0.3", map[string]string{
+			agent.ContainerLabelNetworkPolicyEgress: "allow tcp/",
+		}),
+		policyTestContainer("host1", "monitor", "", "", map[string]string{
+			agent.ContainerLabelNetworkPolicyEgress: "deny",
+		}),
+		policyTestContainer("other1", "other", "", "172.17.0.2", nil),
+	}
+
+	var commands [][]string
+
+	enforcer, err := NewEnforcer("alpine", filepath.Join(t.TempDir(), "netpolicy.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enforcer.listContainers = func(ctx context.Context) ([]types.Container, error) {
+		return containers, nil
+	}
+	enforcer.run = func(ctx context.Context, cmd []string) ([]byte, error) {
+		commands = append(commands, cmd)
+		return nil, nil
+	}
+
+	err = enforcer.UpdateServerPolicies(context.Background(), []Policy{
+		{Stack: "shop", Egress: []Rule{{Action: ActionDeny, CIDR: "0.0.0.0/0"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(commands) != 1 {
+		t.Fatalf("expected the rules to be applied once, got %d commands", len(commands))
+	}
+
+	script := commands[0][2]
+	for _, expected := range []string{
+		"-A PORTAINER-NETPOLICY -m conntrack --ctstate RELATED,ESTABLISHED -j RETURN\n",
+		"-A PORTAINER-NETPOLICY -d 172.18.0.2/32 -s 172.18.0.0/16 -p tcp --dport 5432 -m comment --comment \"shop-db-1 ingress\" -j RETURN\n",
+		"-A PORTAINER-NETPOLICY -d 172.18.0.2/32 -m comment --comment \"shop-db-1 ingress\" -j DROP\n",
+		"-A PORTAINER-NETPOLICY -s 172.18.0.3/32 -d 0.0.0.0/0 -m comment --comment \"shop-web-1 egress\" -j DROP\n",
+		"iptables -I DOCKER-USER -j PORTAINER-NETPOLICY",
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("expected %q in the script %s", expected, script)
+		}
+	}
+
+	if strings.Contains(script, "other") || strings.Contains(script, "monitor") {
+		t.Errorf("expected only the containers with a policy and an address in the script %s", script)
+	}
+
+	report := enforcer.Report()
+	if len(report.Containers) != 2 || report.AppliedAt == nil || len(report.Diagnostics()) != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	if err := enforcer.Apply(context.Background()); err != nil || len(commands) != 1 {
+		t.Fatalf("expected the unchanged rules not to be applied again, got %d commands", len(commands))
+	}
+
+	reloaded, err := NewEnforcer("alpine", enforcer.statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if policies := reloaded.ServerPolicies(); len(policies) != 1 || policies[0].Stack != "shop" {
+		t.Fatalf("expected the server policies to be persisted, got %+v", policies)
+	}
+}
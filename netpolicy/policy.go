@@ -0,0 +1,139 @@
+package netpolicy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Actions of the rules
+const (
+	ActionAllow = "allow"
+	ActionDeny  = "deny"
+)
+
+// Protocols matched by the rules
+const (
+	ProtocolTCP  = "tcp"
+	ProtocolUDP  = "udp"
+	ProtocolICMP = "icmp"
+)
+
+// Policy is the set of rules applied to the traffic of a container or of the containers of a stack. The rules are
+// evaluated in order, the first matching rule applies and the traffic matching no rule is allowed.
+type Policy struct {
+	// Stack is the name of the Compose project of the containers, exclusive with Container
+	Stack string `json:"Stack,omitempty"`
+	// Container is the name of the container, exclusive with Stack
+	Container string `json:"Container,omitempty"`
+	Ingress   []Rule `json:"Ingress,omitempty"`
+	Egress    []Rule `json:"Egress,omitempty"`
+}
+
+// Rule allows or denies the new connections to a container (ingress) or from a container (egress)
+type Rule struct {
+	Action string `json:"Action"`
+	// CIDR is the network of the peers: the sources of the ingress rules and the destinations of the egress rules,
+	// any peer when empty
+	CIDR string `json:"CIDR,omitempty"`
+	// Protocol is tcp, udp or icmp, any protocol when empty
+	Protocol string `json:"Protocol,omitempty"`
+	// Port is the destination port of the tcp and udp connections, any port when zero
+	Port int `json:"Port,omitempty"`
+}
+
+// Validate returns an error when the policy does not target exactly one container or stack, or when one of its
+// rules is invalid
+func (policy *Policy) Validate() error {
+	if (policy.Stack == "") == (policy.Container == "") {
+		return errors.New("a network policy must target either a stack or a container")
+	}
+
+	for _, rules := range [][]Rule{policy.Ingress, policy.Egress} {
+		for _, rule := range rules {
+			if err := rule.Validate(); err != nil {
+				return fmt.Errorf("invalid rule of the network policy of %s%s: %w", policy.Stack, policy.Container, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Validate returns an error when the rule cannot be translated to a packet filter rule
+func (rule *Rule) Validate() error {
+	if rule.Action != ActionAllow && rule.Action != ActionDeny {
+		return fmt.Errorf("unsupported action %q", rule.Action)
+	}
+
+	if rule.CIDR != "" {
+		ip, _, err := net.ParseCIDR(rule.CIDR)
+		if err != nil {
+			return err
+		}
+
+		if ip.To4() == nil {
+			return fmt.Errorf("only the IPv4 networks are supported: %s", rule.CIDR)
+		}
+	}
+
+	switch rule.Protocol {
+	case "", ProtocolICMP:
+		if rule.Port != 0 {
+			return errors.New("a port requires the tcp or udp protocol")
+		}
+	case ProtocolTCP, ProtocolUDP:
+		if rule.Port < 0 || rule.Port > 65535 {
+			return fmt.Errorf("invalid port %d", rule.Port)
+		}
+	default:
+		return fmt.Errorf("unsupported protocol %q", rule.Protocol)
+	}
+
+	return nil
+}
+
+// ParseRules parses the rules declared in a label, separated by commas. Each rule is an action followed by an
+// optional network and an optional protocol with an optional port, e.g. "allow 10.0.0.0/8 tcp/80, allow udp/53,
+// deny".
+func ParseRules(value string) ([]Rule, error) {
+	rules := []Rule{}
+
+	for _, declaration := range strings.Split(value, ",") {
+		fields := strings.Fields(declaration)
+		if len(fields) == 0 {
+			continue
+		}
+
+		rule := Rule{Action: fields[0]}
+
+		for _, field := range fields[1:] {
+			switch {
+			case strings.Contains(field, "/") && net.ParseIP(strings.SplitN(field, "/", 2)[0]) != nil:
+				rule.CIDR = field
+			default:
+				protocol, port, hasPort := strings.Cut(field, "/")
+				rule.Protocol = protocol
+
+				if hasPort {
+					number, err := strconv.Atoi(port)
+					if err != nil {
+						return nil, fmt.Errorf("invalid port in %q", strings.TrimSpace(declaration))
+					}
+
+					rule.Port = number
+				}
+			}
+		}
+
+		if err := rule.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid rule %q: %w", strings.TrimSpace(declaration), err)
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
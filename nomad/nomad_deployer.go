@@ -19,17 +19,19 @@ import (
 
 // Deployer represents a service to deploy resources inside a Nomad environment.
 type Deployer struct {
-	client *nomadapi.Client
+	client       *nomadapi.Client
+	agentOptions *agent.Options
 }
 
 // NewDeployer initializes a new Nomad api client.
-func NewDeployer() (*Deployer, error) {
+// The agent options are forwarded to the updater job, as the secrets are no longer available in the environment.
+func NewDeployer(agentOptions *agent.Options) (*Deployer, error) {
 	//DefaultConfig will try to retrieve NOMAD_ADDR and NOMAD_TOKEN from ENV
 	client, err := nomadapi.NewClient(nomadapi.DefaultConfig())
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to init Nomad api client")
 	}
-	return &Deployer{client: client}, nil
+	return &Deployer{client: client, agentOptions: agentOptions}, nil
 }
 
 // Deploy attempts to run a Nomad job via provided job file
@@ -96,7 +98,7 @@ func (d *Deployer) Deploy(ctx context.Context, name string, filePaths []string,
 		if err != nil {
 			return errors.Wrap(err, "failed to purge former Nomad job")
 		}
-		addNomadDefaultEnv(newJob)
+		addNomadDefaultEnv(newJob, d.agentOptions)
 	}
 
 	// Submit the job
@@ -199,7 +201,7 @@ func compareJobs(old, new *nomadapi.Job) bool {
 }
 
 // addNomadDefaultEnv injects environment varibles inherited from Nomad environment
-func addNomadDefaultEnv(job *nomadapi.Job) {
+func addNomadDefaultEnv(job *nomadapi.Job, agentOptions *agent.Options) {
 	task := job.TaskGroups[0].Tasks[0]
 
 	// Inject Nomad environment variables only when the custom env "PORTAINER_UPDATER"
@@ -240,10 +242,10 @@ func addNomadDefaultEnv(job *nomadapi.Job) {
 
 	// Inject portainer agent env
 	task.Env[agentos.EnvKeyEdge] = os.Getenv(agentos.EnvKeyEdge)
-	task.Env[agentos.EnvKeyEdgeKey] = os.Getenv(agentos.EnvKeyEdgeKey)
+	task.Env[agentos.EnvKeyEdgeKey] = agentOptions.EdgeKey
 	task.Env[agentos.EnvKeyEdgeID] = os.Getenv(agentos.EnvKeyEdgeID)
 	task.Env[agentos.EnvKeyEdgeInsecurePoll] = os.Getenv(agentos.EnvKeyEdgeInsecurePoll)
-	task.Env[agentos.EnvKeyAgentSecret] = os.Getenv(agentos.EnvKeyAgentSecret)
+	task.Env[agentos.EnvKeyAgentSecret] = agentOptions.SharedSecret
 
 	job.TaskGroups[0].Tasks[0] = task
 }
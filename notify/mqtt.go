@@ -0,0 +1,196 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+)
+
+const (
+	mqttDefaultPort    = "1883"
+	mqttsDefaultPort   = "8883"
+	mqttKeepAlive      = 30
+	mqttProtocolLevel  = 4
+	mqttPacketConnect  = 0x10
+	mqttPacketConnAck  = 0x20
+	mqttPacketPublish  = 0x30
+	mqttPacketClose    = 0xe0
+	mqttFlagClean      = 0x02
+	mqttFlagPassword   = 0x40
+	mqttFlagUsername   = 0x80
+	mqttMaxTopicLength = 65535
+)
+
+// mqttNotifier publishes the alerts as JSON on an MQTT topic with the MQTT 3.1.1 protocol. A connection is opened for
+// each alert, the alerts are rare and the brokers of the sites often drop the idle connections.
+type mqttNotifier struct {
+	addr      string
+	topic     string
+	username  string
+	password  string
+	tlsConfig *tls.Config
+}
+
+func newMQTTNotifier(u *url.URL) (*mqttNotifier, error) {
+	topic := strings.TrimPrefix(u.Path, "/")
+	if topic == "" || len(topic) > mqttMaxTopicLength || strings.ContainsAny(topic, "+#") {
+		return nil, fmt.Errorf("invalid topic of the MQTT notification channel: %q", topic)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = mqttDefaultPort
+		if u.Scheme == "mqtts" {
+			port = mqttsDefaultPort
+		}
+	}
+
+	notifier := &mqttNotifier{
+		addr:  net.JoinHostPort(u.Hostname(), port),
+		topic: topic,
+	}
+
+	if u.Scheme == "mqtts" {
+		notifier.tlsConfig = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+	}
+
+	if u.User != nil {
+		notifier.username = u.User.Username()
+		notifier.password, _ = u.User.Password()
+	}
+
+	return notifier, nil
+}
+
+func (notifier *mqttNotifier) Channel() string {
+	return "mqtt " + notifier.addr + "/" + notifier.topic
+}
+
+func (notifier *mqttNotifier) Notify(ctx context.Context, alert Alert) error {
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	dialer := &net.Dialer{}
+
+	conn, err := dialer.DialContext(ctx, "tcp", notifier.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if notifier.tlsConfig != nil {
+		conn = tls.Client(conn, notifier.tlsConfig)
+	}
+
+	// the client identifier is random so that two agents never take over the session of each other, and shorter than
+	// the 23 characters accepted by every broker
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+
+	clientID := "portainer-" + hex.EncodeToString(id)
+
+	writer := bufio.NewWriter(conn)
+	writer.Write(notifier.connectPacket(clientID))
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	// CONNACK: packet type, remaining length of 2, session present flag and return code
+	connAck := make([]byte, 4)
+	if _, err := io.ReadFull(conn, connAck); err != nil {
+		return err
+	}
+
+	if connAck[0] != mqttPacketConnAck || connAck[1] != 2 {
+		return errors.New("unexpected answer from the MQTT broker")
+	}
+
+	if connAck[3] != 0 {
+		return fmt.Errorf("connection refused by the MQTT broker with the return code %d", connAck[3])
+	}
+
+	// the alerts are published with the QoS 0, the broker does not acknowledge them
+	publish := mqttString(notifier.topic)
+	publish = append(publish, payload...)
+
+	writer.Write(mqttPacket(mqttPacketPublish, publish))
+	writer.Write([]byte{mqttPacketClose, 0})
+
+	return writer.Flush()
+}
+
+// connectPacket returns the CONNECT packet opening a clean session
+func (notifier *mqttNotifier) connectPacket(clientID string) []byte {
+	flags := byte(mqttFlagClean)
+
+	body := mqttString("MQTT")
+	body = append(body, mqttProtocolLevel, 0, 0, 0)
+	binary.BigEndian.PutUint16(body[len(body)-2:], mqttKeepAlive)
+	body = append(body, mqttString(clientID)...)
+
+	if notifier.username != "" {
+		flags |= mqttFlagUsername
+		body = append(body, mqttString(notifier.username)...)
+
+		if notifier.password != "" {
+			flags |= mqttFlagPassword
+			body = append(body, mqttString(notifier.password)...)
+		}
+	}
+
+	// the connect flags follow the protocol name and level
+	body[7] = flags
+
+	return mqttPacket(mqttPacketConnect, body)
+}
+
+// mqttPacket returns a packet made of the fixed header of packetType and body
+func mqttPacket(packetType byte, body []byte) []byte {
+	packet := []byte{packetType}
+
+	// the remaining length is encoded with 7 bits per byte, the high bit marks the bytes that are followed by another
+	length := len(body)
+	for {
+		encoded := byte(length % 128)
+		length /= 128
+
+		if length > 0 {
+			encoded |= 0x80
+		}
+
+		packet = append(packet, encoded)
+
+		if length == 0 {
+			break
+		}
+	}
+
+	return append(packet, body...)
+}
+
+// mqttString returns s prefixed with its length
+func mqttString(s string) []byte {
+	encoded := make([]byte, 2, 2+len(s))
+	binary.BigEndian.PutUint16(encoded, uint16(len(s)))
+
+	return append(encoded, s...)
+}
@@ -0,0 +1,207 @@
+// Package notify sends the alerts of the agent directly to the site staff through email, Slack or Microsoft Teams
+// webhooks and MQTT topics, so that the critical conditions of an edge environment are reported even when the
+// Portainer server is unreachable.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Sources of the alerts
+const (
+	SourceAnomaly     = "anomaly"
+	SourceHook        = "hook"
+	SourceDiagnostics = "diagnostics"
+)
+
+const (
+	// queueSize is the number of alerts waiting to be sent from which the new alerts are dropped
+	queueSize = 64
+	// notifyTimeout is the maximum duration of the delivery of an alert to a channel
+	notifyTimeout = 30 * time.Second
+	// cooldown is the duration during which an alert is not sent again
+	cooldown = 15 * time.Minute
+)
+
+var (
+	defaultDispatcher   *Dispatcher
+	defaultDispatcherMu sync.Mutex
+)
+
+// Alert is an alert sent to the notification channels
+type Alert struct {
+	AgentID string    `json:"AgentID"`
+	Source  string    `json:"Source"`
+	Message string    `json:"Message"`
+	Time    time.Time `json:"Time"`
+}
+
+// Text returns the alert formatted for humans
+func (alert Alert) Text() string {
+	return fmt.Sprintf("[Portainer agent %s] %s alert: %s", alert.AgentID, alert.Source, alert.Message)
+}
+
+// Notifier sends the alerts to a notification channel
+type Notifier interface {
+	// Channel returns the description of the channel, without credentials
+	Channel() string
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// NewNotifier returns the Notifier of the channel at rawURL:
+//   - smtp://[user:password@]host[:port]?from=<address>&to=<address>[&to=<address>...], smtps:// for implicit TLS
+//   - slack+https://hooks.slack.com/services/... for a Slack incoming webhook
+//   - teams+https://<tenant>.webhook.office.com/... for a Microsoft Teams incoming webhook
+//   - mqtt://[user:password@]host[:port]/<topic>, mqtts:// for TLS
+func NewNotifier(rawURL string) (Notifier, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("the URL of the notification channel must contain a host: %q", u.Redacted())
+	}
+
+	switch u.Scheme {
+	case "smtp", "smtps":
+		return newSMTPNotifier(u)
+	case "slack+https", "slack+http", "teams+https", "teams+http":
+		return newWebhookNotifier(u), nil
+	case "mqtt", "mqtts":
+		return newMQTTNotifier(u)
+	}
+
+	return nil, fmt.Errorf("unsupported notification channel scheme: %q", u.Scheme)
+}
+
+// Dispatcher sends the alerts to the notification channels in the background, so that an unavailable channel never
+// slows down the agent. An alert is not sent again during the cooldown, the alerts are dropped when the channels
+// cannot keep up.
+type Dispatcher struct {
+	notifiers []Notifier
+	agentID   string
+	queue     chan Alert
+
+	mu         sync.Mutex
+	sentAt     map[string]time.Time
+	lastAlerts map[string]struct{}
+}
+
+// NewDispatcher returns a pointer to a Dispatcher sending the alerts of the agent agentID to notifiers
+func NewDispatcher(notifiers []Notifier, agentID string) *Dispatcher {
+	return &Dispatcher{
+		notifiers:  notifiers,
+		agentID:    agentID,
+		queue:      make(chan Alert, queueSize),
+		sentAt:     map[string]time.Time{},
+		lastAlerts: map[string]struct{}{},
+	}
+}
+
+// Notify queues an alert unless it was sent during the cooldown
+func (dispatcher *Dispatcher) Notify(source, message string) {
+	now := time.Now().UTC()
+	key := source + "\x00" + message
+
+	dispatcher.mu.Lock()
+	if sentAt, ok := dispatcher.sentAt[key]; ok && now.Sub(sentAt) < cooldown {
+		dispatcher.mu.Unlock()
+
+		return
+	}
+
+	dispatcher.sentAt[key] = now
+
+	for key, sentAt := range dispatcher.sentAt {
+		if now.Sub(sentAt) >= cooldown {
+			delete(dispatcher.sentAt, key)
+		}
+	}
+	dispatcher.mu.Unlock()
+
+	alert := Alert{
+		AgentID: dispatcher.agentID,
+		Source:  source,
+		Message: message,
+		Time:    now,
+	}
+
+	select {
+	case dispatcher.queue <- alert:
+	default:
+		log.Warn().Str("source", source).Msg("the notification queue is full, dropping the alert")
+	}
+}
+
+// notifyRaised sends the alerts that were not part of the previous call
+func (dispatcher *Dispatcher) notifyRaised(source string, alerts []string) {
+	dispatcher.mu.Lock()
+
+	current := make(map[string]struct{}, len(alerts))
+	var raised []string
+
+	for _, alert := range alerts {
+		current[alert] = struct{}{}
+
+		if _, ok := dispatcher.lastAlerts[alert]; !ok {
+			raised = append(raised, alert)
+		}
+	}
+
+	dispatcher.lastAlerts = current
+	dispatcher.mu.Unlock()
+
+	for _, alert := range raised {
+		dispatcher.Notify(source, alert)
+	}
+}
+
+func (dispatcher *Dispatcher) run() {
+	for alert := range dispatcher.queue {
+		for _, notifier := range dispatcher.notifiers {
+			ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+
+			if err := notifier.Notify(ctx, alert); err != nil {
+				log.Warn().Err(err).Str("channel", notifier.Channel()).Msg("unable to send the alert")
+			}
+
+			cancel()
+		}
+	}
+}
+
+// Enable makes dispatcher the dispatcher used by the subsystems of the agent and starts sending its alerts
+func Enable(dispatcher *Dispatcher) {
+	defaultDispatcherMu.Lock()
+	defer defaultDispatcherMu.Unlock()
+
+	defaultDispatcher = dispatcher
+
+	go dispatcher.run()
+}
+
+func enabledDispatcher() *Dispatcher {
+	defaultDispatcherMu.Lock()
+	defer defaultDispatcherMu.Unlock()
+
+	return defaultDispatcher
+}
+
+// Notify queues an alert on the enabled dispatcher, if any
+func Notify(source, message string) {
+	if dispatcher := enabledDispatcher(); dispatcher != nil {
+		dispatcher.Notify(source, message)
+	}
+}
+
+// redactedHost returns the scheme and the host of u, used to describe a channel without its credentials
+func redactedHost(u *url.URL) string {
+	return u.Scheme + "://" + u.Host
+}
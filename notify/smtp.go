@@ -0,0 +1,162 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"time"
+)
+
+const (
+	smtpDefaultPort  = "25"
+	smtpsDefaultPort = "465"
+)
+
+// smtpNotifier emails the alerts, STARTTLS is used when the server supports it and the credentials are only sent
+// over TLS
+type smtpNotifier struct {
+	addr      string
+	host      string
+	implicit  bool
+	username  string
+	password  string
+	from      string
+	to        []string
+	tlsConfig *tls.Config
+}
+
+func newSMTPNotifier(u *url.URL) (*smtpNotifier, error) {
+	query := u.Query()
+
+	from, err := mail.ParseAddress(query.Get("from"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender address of the SMTP notification channel: %w", err)
+	}
+
+	if len(query["to"]) == 0 {
+		return nil, errors.New("the SMTP notification channel requires at least one recipient")
+	}
+
+	var to []string
+	for _, recipient := range query["to"] {
+		address, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient address of the SMTP notification channel: %w", err)
+		}
+
+		to = append(to, address.Address)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = smtpDefaultPort
+		if u.Scheme == "smtps" {
+			port = smtpsDefaultPort
+		}
+	}
+
+	notifier := &smtpNotifier{
+		addr:      net.JoinHostPort(u.Hostname(), port),
+		host:      u.Hostname(),
+		implicit:  u.Scheme == "smtps",
+		from:      from.Address,
+		to:        to,
+		tlsConfig: &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12},
+	}
+
+	if u.User != nil {
+		notifier.username = u.User.Username()
+		notifier.password, _ = u.User.Password()
+	}
+
+	return notifier, nil
+}
+
+func (notifier *smtpNotifier) Channel() string {
+	return "smtp " + notifier.addr
+}
+
+func (notifier *smtpNotifier) Notify(ctx context.Context, alert Alert) error {
+	dialer := &net.Dialer{}
+
+	conn, err := dialer.DialContext(ctx, "tcp", notifier.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if notifier.implicit {
+		conn = tls.Client(conn, notifier.tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, notifier.host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && !notifier.implicit {
+		if err := client.StartTLS(notifier.tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if notifier.username != "" {
+		// smtp.PlainAuth refuses to send the credentials over an unencrypted connection to a remote server
+		if err := client.Auth(smtp.PlainAuth("", notifier.username, notifier.password, notifier.host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(notifier.from); err != nil {
+		return err
+	}
+
+	for _, recipient := range notifier.to {
+		if err := client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := writer.Write(notifier.message(alert)); err != nil {
+		return err
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// message returns the email of the alert
+func (notifier *smtpNotifier) message(alert Alert) []byte {
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintf(buf, "From: %s\r\n", notifier.from)
+	for _, recipient := range notifier.to {
+		fmt.Fprintf(buf, "To: %s\r\n", recipient)
+	}
+	fmt.Fprintf(buf, "Subject: [Portainer agent %s] %s alert\r\n", alert.AgentID, alert.Source)
+	fmt.Fprintf(buf, "Date: %s\r\n", alert.Time.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(buf, "%s\r\n\r\nRaised at %s.\r\n", alert.Message, alert.Time.Format(time.RFC3339))
+
+	return buf.Bytes()
+}
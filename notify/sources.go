@@ -0,0 +1,52 @@
+package notify
+
+import (
+	"context"
+	"time"
+
+	"github.com/portainer/agent/hostaction"
+	"github.com/portainer/agent/imagecache"
+	"github.com/portainer/agent/memory"
+	agentnet "github.com/portainer/agent/net"
+	"github.com/portainer/agent/netpolicy"
+	"github.com/portainer/agent/osupdate"
+	"github.com/portainer/agent/power"
+	"github.com/portainer/agent/thermal"
+)
+
+// Run sends the new alerts raised by the diagnostics of the host at each interval, until ctx is done
+func Run(ctx context.Context, interval time.Duration) {
+	dispatcher := enabledDispatcher()
+	if dispatcher == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		dispatcher.notifyRaised(SourceDiagnostics, CurrentAlerts(ctx))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CurrentAlerts returns the alerts currently raised by the diagnostics of the host: bandwidth cap, host actions,
+// OS updates, thermal conditions, memory pressure, power events and network policies
+func CurrentAlerts(ctx context.Context) []string {
+	var alerts []string
+	alerts = append(alerts, agentnet.BandwidthDiagnostics()...)
+	alerts = append(alerts, hostaction.Diagnostics()...)
+	alerts = append(alerts, osupdate.Diagnostics()...)
+	alerts = append(alerts, thermal.CurrentStatus(ctx).Diagnostics()...)
+	alerts = append(alerts, memory.CurrentStatus(ctx).Diagnostics()...)
+	alerts = append(alerts, imagecache.DefaultCache().Report().Diagnostics()...)
+	alerts = append(alerts, power.DefaultMonitor().Report().Diagnostics()...)
+	alerts = append(alerts, netpolicy.DefaultEnforcer().Report().Diagnostics()...)
+
+	return alerts
+}
@@ -0,0 +1,61 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// webhookNotifier posts the alerts to a Slack or a Microsoft Teams incoming webhook, both accept a message made of a
+// single text field
+type webhookNotifier struct {
+	channel string
+	url     string
+	client  *http.Client
+}
+
+func newWebhookNotifier(u *url.URL) *webhookNotifier {
+	service, scheme, _ := strings.Cut(u.Scheme, "+")
+
+	webhookURL := *u
+	webhookURL.Scheme = scheme
+
+	return &webhookNotifier{
+		channel: service + " " + redactedHost(&webhookURL),
+		url:     webhookURL.String(),
+		client:  &http.Client{},
+	}
+}
+
+func (notifier *webhookNotifier) Channel() string {
+	return notifier.channel
+}
+
+func (notifier *webhookNotifier) Notify(ctx context.Context, alert Alert) error {
+	payload, err := json.Marshal(map[string]string{"text": alert.Text()})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, notifier.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := notifier.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("the webhook refused the alert with the status %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,376 @@
+package operations
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent/maintenance"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Operation statuses
+const (
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+	// StatusDeferred is the status of a disruptive operation waiting for the next maintenance window
+	StatusDeferred = "deferred"
+)
+
+const (
+	// retention is the duration during which a finished operation is kept in memory
+	retention = 1 * time.Hour
+	// maintenanceCheckInterval is the interval between two checks of the maintenance window by the deferred operations
+	maintenanceCheckInterval = 30 * time.Second
+)
+
+// ErrOperationNotFound is returned when an operation does not exist or has expired
+var ErrOperationNotFound = errors.New("operation not found")
+
+type (
+	// Operation represents the state of a long-running operation
+	Operation struct {
+		ID        string      `json:"Id"`
+		Type      string      `json:"Type"`
+		Status    string      `json:"Status"`
+		Progress  int         `json:"Progress"`
+		Message   string      `json:"Message,omitempty"`
+		Result    interface{} `json:"Result,omitempty"`
+		Error     string      `json:"Error,omitempty"`
+		CreatedAt time.Time   `json:"CreatedAt"`
+		UpdatedAt time.Time   `json:"UpdatedAt"`
+	}
+
+	// Func is the function executed by an operation. It must return when ctx is cancelled.
+	Func func(ctx context.Context, progress *Progress) (interface{}, error)
+
+	// Progress is used by a running operation to report its progress
+	Progress struct {
+		manager *Manager
+		id      string
+	}
+
+	// Manager keeps track of the long-running operations executed by the agent
+	Manager struct {
+		mu          sync.Mutex
+		operations  map[string]*Operation
+		cancels     map[string]context.CancelFunc
+		subscribers map[string][]chan Operation
+		// checkInterval is the interval between two checks of the maintenance window by the deferred operations
+		checkInterval time.Duration
+	}
+)
+
+// NewManager returns a pointer to a new Manager
+func NewManager() *Manager {
+	return &Manager{
+		operations:  map[string]*Operation{},
+		cancels:     map[string]context.CancelFunc{},
+		subscribers: map[string][]chan Operation{},
+
+		checkInterval: maintenanceCheckInterval,
+	}
+}
+
+// Start executes fn in the background and returns a copy of the created operation
+func (manager *Manager) Start(operationType string, fn Func) Operation {
+	return manager.start(operationType, fn, false)
+}
+
+// StartDisruptive executes fn in the background when the maintenance window is open. Otherwise, the operation is
+// deferred and executed once the next window opens.
+func (manager *Manager) StartDisruptive(operationType string, fn Func) Operation {
+	return manager.start(operationType, fn, !maintenance.IsOpen())
+}
+
+func (manager *Manager) start(operationType string, fn Func, deferred bool) Operation {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	now := time.Now()
+	op := &Operation{
+		ID:        newID(),
+		Type:      operationType,
+		Status:    StatusRunning,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if deferred {
+		op.Status = StatusDeferred
+		op.Message = "deferred until the next maintenance window at " + maintenance.NextOpening().Format(time.RFC3339)
+	}
+
+	manager.mu.Lock()
+	manager.purge()
+	manager.operations[op.ID] = op
+	manager.cancels[op.ID] = cancel
+	snapshot := *op
+	manager.mu.Unlock()
+
+	log.Debug().Str("operation_id", op.ID).Str("type", operationType).Str("status", snapshot.Status).Msg("starting operation")
+
+	go func() {
+		defer cancel()
+
+		if deferred && !manager.waitForMaintenanceWindow(ctx, op.ID) {
+			manager.finish(ctx, op.ID, nil, nil)
+			return
+		}
+
+		result, err := fn(ctx, &Progress{manager: manager, id: op.ID})
+		manager.finish(ctx, op.ID, result, err)
+	}()
+
+	return snapshot
+}
+
+// waitForMaintenanceWindow blocks until the maintenance window opens and marks the deferred operation as running.
+// It returns false when the operation is cancelled in the meantime.
+func (manager *Manager) waitForMaintenanceWindow(ctx context.Context, id string) bool {
+	ticker := time.NewTicker(manager.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+
+		if !maintenance.IsOpen() {
+			continue
+		}
+
+		manager.mu.Lock()
+		defer manager.mu.Unlock()
+
+		op, ok := manager.operations[id]
+		if !ok {
+			return false
+		}
+
+		op.Status = StatusRunning
+		op.Message = ""
+		op.UpdatedAt = time.Now()
+		manager.notify(op)
+
+		log.Debug().Str("operation_id", id).Str("type", op.Type).Msg("starting deferred operation")
+
+		return true
+	}
+}
+
+// Get returns a copy of the operation associated to id
+func (manager *Manager) Get(id string) (Operation, error) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	op, ok := manager.operations[id]
+	if !ok {
+		return Operation{}, ErrOperationNotFound
+	}
+
+	return *op, nil
+}
+
+// IsRunning returns true when an operation of the given type is running
+func (manager *Manager) IsRunning(operationType string) bool {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	for _, op := range manager.operations {
+		if op.Type == operationType && op.Status == StatusRunning {
+			return true
+		}
+	}
+
+	return false
+}
+
+// List returns a copy of all the known operations, most recent first
+func (manager *Manager) List() []Operation {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	manager.purge()
+
+	ops := make([]Operation, 0, len(manager.operations))
+	for _, op := range manager.operations {
+		ops = append(ops, *op)
+	}
+
+	sort.Slice(ops, func(i, j int) bool {
+		return ops[i].CreatedAt.After(ops[j].CreatedAt)
+	})
+
+	return ops
+}
+
+// Subscribe returns a channel receiving a copy of the operation associated to id each time it is updated.
+// The current state is sent immediately and the channel is closed once the operation is finished.
+// Slow subscribers only receive the latest state. The returned function must be called to unsubscribe.
+func (manager *Manager) Subscribe(id string) (<-chan Operation, func(), error) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	op, ok := manager.operations[id]
+	if !ok {
+		return nil, nil, ErrOperationNotFound
+	}
+
+	ch := make(chan Operation, 1)
+	ch <- *op
+
+	if op.isFinished() {
+		close(ch)
+		return ch, func() {}, nil
+	}
+
+	manager.subscribers[id] = append(manager.subscribers[id], ch)
+
+	unsubscribe := func() {
+		manager.mu.Lock()
+		defer manager.mu.Unlock()
+
+		subscribers := manager.subscribers[id]
+		for i, sub := range subscribers {
+			if sub == ch {
+				manager.subscribers[id] = append(subscribers[:i], subscribers[i+1:]...)
+				close(ch)
+				break
+			}
+		}
+	}
+
+	return ch, unsubscribe, nil
+}
+
+// notify sends the current state of an operation to its subscribers, the lock must be held by the caller
+func (manager *Manager) notify(op *Operation) {
+	for _, ch := range manager.subscribers[op.ID] {
+		select {
+		case <-ch:
+		default:
+		}
+
+		ch <- *op
+	}
+
+	if op.isFinished() {
+		for _, ch := range manager.subscribers[op.ID] {
+			close(ch)
+		}
+
+		delete(manager.subscribers, op.ID)
+	}
+}
+
+// Cancel requests the cancellation of a running operation
+func (manager *Manager) Cancel(id string) error {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	if _, ok := manager.operations[id]; !ok {
+		return ErrOperationNotFound
+	}
+
+	if cancel, ok := manager.cancels[id]; ok {
+		cancel()
+	}
+
+	return nil
+}
+
+func (manager *Manager) finish(ctx context.Context, id string, result interface{}, err error) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	delete(manager.cancels, id)
+
+	op, ok := manager.operations[id]
+	if !ok {
+		return
+	}
+
+	op.UpdatedAt = time.Now()
+	op.Result = result
+
+	switch {
+	case ctx.Err() != nil:
+		op.Status = StatusCancelled
+	case err != nil:
+		op.Status = StatusFailed
+		op.Error = err.Error()
+	default:
+		op.Status = StatusSucceeded
+		op.Progress = 100
+	}
+
+	manager.notify(op)
+
+	log.Debug().Str("operation_id", id).Str("status", op.Status).Msg("operation finished")
+}
+
+// purge removes the finished operations older than the retention period, the lock must be held by the caller
+func (manager *Manager) purge() {
+	for id, op := range manager.operations {
+		if op.isFinished() && time.Since(op.UpdatedAt) > retention {
+			delete(manager.operations, id)
+		}
+	}
+}
+
+// Update reports the progress (in percent) of the operation along with an optional message
+func (progress *Progress) Update(percent int, message string) {
+	progress.update(percent, message, nil, false)
+}
+
+// UpdateResult reports the progress of the operation like Update, along with its partial result. The result must not
+// be modified afterwards, a new value must be reported for each update.
+func (progress *Progress) UpdateResult(percent int, message string, result interface{}) {
+	progress.update(percent, message, result, true)
+}
+
+func (progress *Progress) update(percent int, message string, result interface{}, withResult bool) {
+	if percent < 0 {
+		percent = 0
+	} else if percent > 99 {
+		percent = 99
+	}
+
+	progress.manager.mu.Lock()
+	defer progress.manager.mu.Unlock()
+
+	op, ok := progress.manager.operations[progress.id]
+	if !ok || op.Status != StatusRunning {
+		return
+	}
+
+	op.Progress = percent
+	op.Message = message
+	op.UpdatedAt = time.Now()
+
+	if withResult {
+		op.Result = result
+	}
+
+	progress.manager.notify(op)
+}
+
+func (op *Operation) isFinished() bool {
+	return op.Status != StatusRunning && op.Status != StatusDeferred
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,409 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/portainer/agent/maintenance"
+)
+
+const testTimeout = 5 * time.Second
+
+// waitFinished returns the last state received on ch before it is closed
+func waitFinished(t *testing.T, ch <-chan Operation) Operation {
+	t.Helper()
+
+	var last Operation
+
+	timeout := time.After(testTimeout)
+	for {
+		select {
+		case op, ok := <-ch:
+			if !ok {
+				return last
+			}
+
+			last = op
+		case <-timeout:
+			t.Fatalf("the operation did not finish, last state: %+v", last)
+		}
+	}
+}
+
+func receive(t *testing.T, ch <-chan Operation) Operation {
+	t.Helper()
+
+	select {
+	case op, ok := <-ch:
+		if !ok {
+			t.Fatal("unexpected closed channel")
+		}
+
+		return op
+	case <-time.After(testTimeout):
+		t.Fatal("no update received")
+	}
+
+	return Operation{}
+}
+
+// closedSchedule enforces a maintenance window that does not contain the current time
+func closedSchedule(t *testing.T) {
+	t.Helper()
+
+	now := time.Now()
+
+	schedule, err := maintenance.NewSchedule([]string{now.Add(2*time.Hour).Format("15:04") + "-" + now.Add(3*time.Hour).Format("15:04")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	maintenance.EnforceSchedule(schedule)
+	t.Cleanup(func() { maintenance.EnforceSchedule(nil) })
+}
+
+func TestSubscribeNotify(t *testing.T) {
+	manager := NewManager()
+
+	release := make(chan struct{})
+	op := manager.Start("image_pull", func(ctx context.Context, progress *Progress) (interface{}, error) {
+		progress.Update(50, "pulling")
+		<-release
+
+		return "sha256:abc", nil
+	})
+
+	if op.Status != StatusRunning || op.ID == "" {
+		t.Fatalf("unexpected operation %+v", op)
+	}
+
+	ch, unsubscribe, err := manager.Subscribe(op.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsubscribe()
+
+	update := receive(t, ch)
+	for update.Progress != 50 {
+		update = receive(t, ch)
+	}
+
+	if update.Status != StatusRunning || update.Message != "pulling" {
+		t.Errorf("unexpected progress %+v", update)
+	}
+
+	close(release)
+
+	final := waitFinished(t, ch)
+	if final.Status != StatusSucceeded || final.Progress != 100 || final.Result != "sha256:abc" {
+		t.Errorf("unexpected final state %+v", final)
+	}
+
+	stored, err := manager.Get(op.ID)
+	if err != nil || stored.Status != StatusSucceeded {
+		t.Errorf("expected the operation to be kept once finished, got %+v, %v", stored, err)
+	}
+
+	// a finished operation sends its state and closes the channel
+	ch, _, err = manager.Subscribe(op.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if final := waitFinished(t, ch); final.Status != StatusSucceeded {
+		t.Errorf("expected the final state, got %+v", final)
+	}
+
+	_, _, err = manager.Subscribe("unknown")
+	if !errors.Is(err, ErrOperationNotFound) {
+		t.Errorf("expected ErrOperationNotFound, got %v", err)
+	}
+}
+
+func TestOperationFailed(t *testing.T) {
+	manager := NewManager()
+
+	op := manager.Start("stack_deploy", func(ctx context.Context, progress *Progress) (interface{}, error) {
+		return nil, errors.New("unable to deploy")
+	})
+
+	ch, unsubscribe, err := manager.Subscribe(op.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsubscribe()
+
+	final := waitFinished(t, ch)
+	if final.Status != StatusFailed || final.Error != "unable to deploy" {
+		t.Errorf("unexpected final state %+v", final)
+	}
+
+	if manager.IsRunning("stack_deploy") {
+		t.Error("expected the failed operation not to be running")
+	}
+}
+
+func TestProgressUpdate(t *testing.T) {
+	manager := NewManager()
+
+	updated := make(chan struct{})
+	release := make(chan struct{})
+	op := manager.Start("prune", func(ctx context.Context, progress *Progress) (interface{}, error) {
+		progress.UpdateResult(150, "almost", 3)
+		close(updated)
+		<-release
+
+		return 4, nil
+	})
+	defer close(release)
+
+	<-updated
+
+	running, err := manager.Get(op.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if running.Progress != 99 || running.Result != 3 {
+		t.Errorf("expected the progress to be capped at 99 with the partial result, got %+v", running)
+	}
+
+	if !manager.IsRunning("prune") {
+		t.Error("expected the operation to be running")
+	}
+}
+
+func TestCancel(t *testing.T) {
+	manager := NewManager()
+
+	started := make(chan struct{})
+	op := manager.Start("image_pull", func(ctx context.Context, progress *Progress) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+
+		return nil, ctx.Err()
+	})
+
+	ch, unsubscribe, err := manager.Subscribe(op.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsubscribe()
+
+	<-started
+
+	err = manager.Cancel(op.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	final := waitFinished(t, ch)
+	if final.Status != StatusCancelled || final.Error != "" {
+		t.Errorf("expected the operation to be cancelled, got %+v", final)
+	}
+
+	err = manager.Cancel(op.ID)
+	if err != nil {
+		t.Errorf("expected the cancellation of a finished operation to be a no-op, got %v", err)
+	}
+
+	err = manager.Cancel("unknown")
+	if !errors.Is(err, ErrOperationNotFound) {
+		t.Errorf("expected ErrOperationNotFound, got %v", err)
+	}
+}
+
+func TestDeferredOperation(t *testing.T) {
+	closedSchedule(t)
+
+	manager := NewManager()
+	manager.checkInterval = 10 * time.Millisecond
+
+	executed := make(chan struct{})
+	op := manager.StartDisruptive("stack_update", func(ctx context.Context, progress *Progress) (interface{}, error) {
+		close(executed)
+
+		return nil, nil
+	})
+
+	if op.Status != StatusDeferred || !strings.HasPrefix(op.Message, "deferred until the next maintenance window") {
+		t.Fatalf("expected the operation to be deferred, got %+v", op)
+	}
+
+	if manager.IsRunning("stack_update") {
+		t.Error("expected the deferred operation not to be running")
+	}
+
+	ch, unsubscribe, err := manager.Subscribe(op.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsubscribe()
+
+	if state := receive(t, ch); state.Status != StatusDeferred {
+		t.Errorf("expected the deferred state, got %+v", state)
+	}
+
+	select {
+	case <-executed:
+		t.Fatal("expected the operation to wait for the maintenance window")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	maintenance.EnforceSchedule(nil)
+
+	final := waitFinished(t, ch)
+	if final.Status != StatusSucceeded || final.Message != "" {
+		t.Errorf("expected the deferred operation to complete once the window opens, got %+v", final)
+	}
+
+	select {
+	case <-executed:
+	default:
+		t.Error("expected the deferred operation to be executed")
+	}
+}
+
+func TestCancelDeferredOperation(t *testing.T) {
+	closedSchedule(t)
+
+	manager := NewManager()
+	manager.checkInterval = 10 * time.Millisecond
+
+	op := manager.StartDisruptive("stack_update", func(ctx context.Context, progress *Progress) (interface{}, error) {
+		t.Error("expected the cancelled operation not to be executed")
+
+		return nil, nil
+	})
+
+	ch, unsubscribe, err := manager.Subscribe(op.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsubscribe()
+
+	err = manager.Cancel(op.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if final := waitFinished(t, ch); final.Status != StatusCancelled {
+		t.Errorf("expected the deferred operation to be cancelled, got %+v", final)
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	manager := NewManager()
+
+	release := make(chan struct{})
+	defer close(release)
+
+	op := manager.Start("image_pull", func(ctx context.Context, progress *Progress) (interface{}, error) {
+		<-release
+
+		return nil, nil
+	})
+
+	ch, unsubscribe, err := manager.Subscribe(op.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unsubscribe()
+	unsubscribe()
+
+	waitFinished(t, ch)
+
+	manager.mu.Lock()
+	subscribers := len(manager.subscribers[op.ID])
+	manager.mu.Unlock()
+
+	if subscribers != 0 {
+		t.Errorf("expected the subscriber to be removed, got %d subscribers", subscribers)
+	}
+}
+
+func TestConcurrentSubscribers(t *testing.T) {
+	manager := NewManager()
+
+	const updates = 200
+	const subscribers = 20
+
+	start := make(chan struct{})
+	op := manager.Start("image_pull", func(ctx context.Context, progress *Progress) (interface{}, error) {
+		<-start
+
+		for i := 1; i <= updates; i++ {
+			progress.Update(i*99/updates, "pulling")
+		}
+
+		return nil, nil
+	})
+
+	var wg sync.WaitGroup
+	errs := make(chan string, subscribers)
+
+	for i := 0; i < subscribers; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			ch, unsubscribe, err := manager.Subscribe(op.ID)
+			if err != nil {
+				errs <- err.Error()
+				return
+			}
+
+			// half of the subscribers leave after the first update
+			if i%2 == 0 {
+				<-ch
+				unsubscribe()
+
+				for range ch {
+				}
+
+				return
+			}
+			defer unsubscribe()
+
+			progress := -1
+			var last Operation
+			for op := range ch {
+				if op.Progress < progress {
+					errs <- "the progress went backward"
+				}
+
+				progress = op.Progress
+				last = op
+			}
+
+			if last.Status != StatusSucceeded {
+				errs <- "the final state was not received: " + last.Status
+			}
+		}(i)
+	}
+
+	close(start)
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(testTimeout):
+		t.Fatal("the subscribers did not finish")
+	}
+
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
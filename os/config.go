@@ -0,0 +1,342 @@
+package os
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+// OptionSource represents the configuration layer an option value comes from.
+// The layers are listed below from the highest to the lowest precedence.
+type OptionSource string
+
+const (
+	SourceFlag    OptionSource = "flag"
+	SourceEnv     OptionSource = "env"
+	SourceSecret  OptionSource = "secret"
+	SourceFile    OptionSource = "file"
+	SourceProfile OptionSource = "profile"
+	SourceServer  OptionSource = "server"
+	SourceDefault OptionSource = "default"
+)
+
+// ServerConfigFileName is the name of the file, inside the data folder, where the configuration pushed by
+// the Portainer server is persisted. It is the configuration layer with the lowest precedence.
+const ServerConfigFileName = "agent_server_config.yaml"
+
+// fileEnvSuffix is the suffix of the environment variables referencing a file containing the value of an option
+const fileEnvSuffix = "_FILE"
+
+// ErrRestrictedOption is returned when the configuration pushed by the Portainer server or a configuration profile
+// sets an option that is not part of remoteFlags
+var ErrRestrictedOption = errors.New("the option can only be set via a flag, an environment variable or the configuration file")
+
+// sensitiveEnvKeys are the options marked as sensitive by their definition, their value is masked when printing the
+// configuration and never exported in a configuration profile
+var sensitiveEnvKeys = map[string]bool{}
+
+// sensitive marks the option defined by flag as sensitive, the option must be set via an environment variable
+func sensitive(flag *kingpin.FlagClause) *kingpin.FlagClause {
+	sensitiveEnvKeys[flag.Model().Envar] = true
+
+	return flag
+}
+
+// remoteFlags are the options the configuration pushed by the Portainer server and the configuration profiles may
+// set. They tune the behavior of the agent, the options gating the operations, the identity, the secrets, the
+// listeners, the executed commands and the destinations of the data of the agent are restricted to the local layers.
+var remoteFlags = map[string]bool{
+	"log-level":                   true,
+	"log-mode":                    true,
+	"agent-cluster-timeout":       true,
+	"agent-cluster-interval":      true,
+	"docker-proxy-timeout":        true,
+	"docker-proxy-retries":        true,
+	"orphan-gc-interval":          true,
+	"stack-hook-timeout":          true,
+	"health-gate-window":          true,
+	"health-gate-min-uptime":      true,
+	"stack-concurrency":           true,
+	"bandwidth-monthly-cap":       true,
+	"bandwidth-warning-threshold": true,
+	"maintenance-windows":         true,
+	"snapshot-stats":              true,
+	"snapshot-vms":                true,
+	"snapshot-overlay":            true,
+	"snapshot-smart":              true,
+	"snapshot-kernel-anomalies":   true,
+	"temperature-alert-threshold": true,
+	"battery-alert-threshold":     true,
+	"event-bus-subject":           true,
+	"event-bus-snapshot-interval": true,
+	"log-shipping-batch-size":     true,
+	"log-shipping-flush-interval": true,
+	"crash-log-lines":             true,
+	"crash-artifacts-max-size":    true,
+	"audit-max-size":              true,
+	"retention-interval":          true,
+	"alert-notify-interval":       true,
+	"shutdown-stop-timeout":       true,
+	"shutdown-timeout":            true,
+	"power-check-interval":        true,
+	"power-shed-delay":            true,
+	"network-policy-interval":     true,
+	"wasm-plugin-timeout":         true,
+	"snapshot-history-interval":   true,
+	"hooks-snapshot-interval":     true,
+	"browse-archive-max-size":     true,
+	"idempotency-window":          true,
+	"edge-stack-auto-rollback":    true,
+	"edge-stack-history-size":     true,
+	"edge-snapshot-delta":         true,
+	"edge-payload-format":         true,
+	"edge-offline-queue":          true,
+	"edge-inactivity":             true,
+	"edge-http2":                  true,
+	"edge-max-idle-conns":         true,
+	"edge-idle-conn-timeout":      true,
+	"edge-poll-transport":         true,
+	"edge-tunnel-grace-period":    true,
+	"edge-tunnel-transport":       true,
+	"edge-groups":                 true,
+	"environment-group":           true,
+	"tags":                        true,
+	"certificate-retry-interval":  true,
+	"registry-credentials-ttl":    true,
+}
+
+// loadFileEnvVars sets the value of every option environment variable that is not defined from the content of
+// the file referenced by the same variable suffixed with _FILE (e.g. AGENT_SECRET_FILE=/run/secrets/agent_secret).
+// It returns the environment variables loaded from files.
+func loadFileEnvVars(flags []*kingpin.FlagModel) (map[string]bool, error) {
+	loaded := map[string]bool{}
+
+	for _, flag := range flags {
+		if flag.Envar == "" || os.Getenv(flag.Envar) != "" {
+			continue
+		}
+
+		path := os.Getenv(flag.Envar + fileEnvSuffix)
+		if path == "" {
+			continue
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "unable to read the file referenced by %s%s", flag.Envar, fileEnvSuffix)
+		}
+
+		os.Setenv(flag.Envar, strings.TrimRight(string(content), "\r\n"))
+		loaded[flag.Envar] = true
+	}
+
+	return loaded, nil
+}
+
+// resolveSources returns the source of the value of each flag after the command line has been parsed
+func resolveSources(flags []*kingpin.FlagModel, args []string, loadedFromFiles map[string]bool) map[string]OptionSource {
+	sources := map[string]OptionSource{}
+
+	for _, flag := range flags {
+		switch {
+		case flagInArgs(flag.Name, args):
+			sources[flag.Name] = SourceFlag
+		case loadedFromFiles[flag.Envar]:
+			sources[flag.Name] = SourceSecret
+		case flag.Envar != "" && os.Getenv(flag.Envar) != "":
+			sources[flag.Name] = SourceEnv
+		default:
+			sources[flag.Name] = SourceDefault
+		}
+	}
+
+	return sources
+}
+
+func flagInArgs(name string, args []string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			return false
+		}
+
+		if arg == "--"+name || arg == "--no-"+name || strings.HasPrefix(arg, "--"+name+"=") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readConfigFile reads a YAML configuration file containing a map of option names (flag names or environment
+// variable names) to values. A missing file is not an error when optional is set.
+func readConfigFile(path string, optional bool) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if optional && errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	values := map[string]string{}
+	err = yaml.Unmarshal(content, &values)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "invalid configuration file %s", path)
+	}
+
+	return values, nil
+}
+
+// flagNamesByEnvKey returns the name of the flag associated to each environment variable
+func flagNamesByEnvKey(flags []*kingpin.FlagModel) map[string]string {
+	names := map[string]string{}
+
+	for _, flag := range flags {
+		if flag.Envar != "" {
+			if _, ok := names[flag.Envar]; !ok {
+				names[flag.Envar] = flag.Name
+			}
+		}
+	}
+
+	return names
+}
+
+// validateConfigKeys returns an error if a key does not match the name or the environment variable of an option
+func validateConfigKeys(flags []*kingpin.FlagModel, values map[string]string) error {
+	known := map[string]bool{}
+	for _, flag := range flags {
+		known[flag.Name] = true
+		if flag.Envar != "" {
+			known[flag.Envar] = true
+		}
+	}
+
+	for key := range values {
+		if !known[key] {
+			return fmt.Errorf("unknown option %s", key)
+		}
+	}
+
+	return nil
+}
+
+// validateRemoteConfigKeys returns an error if a key does not match an option, or matches an option the configuration
+// pushed by the Portainer server and the configuration profiles cannot set
+func validateRemoteConfigKeys(flags []*kingpin.FlagModel, values map[string]string) error {
+	err := validateConfigKeys(flags, values)
+	if err != nil {
+		return err
+	}
+
+	for _, flag := range flags {
+		_, byName := values[flag.Name]
+		_, byEnvKey := values[flag.Envar]
+		if !byName && (flag.Envar == "" || !byEnvKey) {
+			continue
+		}
+
+		if !remoteFlags[flag.Name] {
+			return errors.WithMessagef(ErrRestrictedOption, "option %s", flag.Name)
+		}
+	}
+
+	return nil
+}
+
+// applyConfigLayer sets the value of the flags that still use their default value from the specified layer, the
+// server and profile layers can only set the remote options
+func applyConfigLayer(flags []*kingpin.FlagModel, sources map[string]OptionSource, values map[string]string, source OptionSource) error {
+	validate := validateConfigKeys
+	if source == SourceServer || source == SourceProfile {
+		validate = validateRemoteConfigKeys
+	}
+
+	err := validate(flags, values)
+	if err != nil {
+		return err
+	}
+
+	for _, flag := range flags {
+		if sources[flag.Name] != SourceDefault {
+			continue
+		}
+
+		value, ok := values[flag.Name]
+		if !ok && flag.Envar != "" {
+			value, ok = values[flag.Envar]
+		}
+
+		if !ok {
+			continue
+		}
+
+		err := flag.Value.Set(value)
+		if err != nil {
+			return errors.WithMessagef(err, "invalid value for option %s", flag.Name)
+		}
+
+		sources[flag.Name] = source
+	}
+
+	return nil
+}
+
+// SaveServerConfig persists the configuration pushed by the Portainer server inside the data folder.
+// It is applied on the next start of the agent to the options that are not defined by any other layer.
+// ErrRestrictedOption is returned when an option is not part of the remote options.
+func SaveServerConfig(dataPath string, values map[string]string) error {
+	err := validateRemoteConfigKeys(kingpin.CommandLine.Model().Flags, values)
+	if err != nil {
+		return err
+	}
+
+	content, err := yaml.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dataPath, ServerConfigFileName), content, 0600)
+}
+
+// PrintConfig writes the effective value of every option along with its source
+func (parser *EnvOptionParser) PrintConfig(w io.Writer) {
+	flags := kingpin.CommandLine.Model().Flags
+
+	sort.Slice(flags, func(i, j int) bool {
+		return flags[i].Name < flags[j].Name
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "OPTION\tENV\tVALUE\tSOURCE")
+
+	for _, flag := range flags {
+		if flag.Name == "help" || flag.Name == "print-config" || flag.Name == "export-profile" || flag.Name == "import-profile" ||
+			flag.Name == "use-profile" || flag.Name == "list-profiles" {
+			continue
+		}
+
+		value := flag.String()
+		if sensitiveEnvKeys[flag.Envar] && value != "" {
+			value = "********"
+		} else if u, err := url.Parse(value); err == nil && u.User != nil {
+			// the credentials of the URLs, e.g. of the event bus, are masked as well
+			value = u.Redacted()
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", flag.Name, flag.Envar, value, parser.sources[flag.Name])
+	}
+
+	tw.Flush()
+}
@@ -0,0 +1,233 @@
+package os
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+// allowRemote lets the server and profile layers set the options named names for the duration of the test
+func allowRemote(t *testing.T, names ...string) {
+	t.Helper()
+
+	for _, name := range names {
+		if remoteFlags[name] {
+			continue
+		}
+
+		name := name
+		remoteFlags[name] = true
+		t.Cleanup(func() { delete(remoteFlags, name) })
+	}
+}
+
+func TestConfigLayersPrecedence(t *testing.T) {
+	allowRemote(t, "opt-flag", "opt-env", "opt-file", "opt-server")
+
+	app := kingpin.New("agent", "")
+	fFlag := app.Flag("opt-flag", "").Envar("TEST_OPT_FLAG").Default("default").String()
+	fEnv := app.Flag("opt-env", "").Envar("TEST_OPT_ENV").Default("default").String()
+	fFile := app.Flag("opt-file", "").Envar("TEST_OPT_FILE").Default("default").String()
+	fServer := app.Flag("opt-server", "").Envar("TEST_OPT_SERVER").Default("default").String()
+	fDefault := app.Flag("opt-default", "").Envar("TEST_OPT_DEFAULT").Default("default").String()
+
+	t.Setenv("TEST_OPT_FLAG", "env")
+	t.Setenv("TEST_OPT_ENV", "env")
+
+	args := []string{"--opt-flag=flag"}
+	_, err := app.Parse(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flags := app.Model().Flags
+	sources := resolveSources(flags, args, nil)
+
+	fileValues := map[string]string{"opt-flag": "file", "TEST_OPT_ENV": "file", "opt-file": "file"}
+	err = applyConfigLayer(flags, sources, fileValues, SourceFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverValues := map[string]string{"opt-flag": "server", "opt-env": "server", "opt-file": "server", "TEST_OPT_SERVER": "server"}
+	err = applyConfigLayer(flags, sources, serverValues, SourceServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		value  string
+		source OptionSource
+	}{
+		{"opt-flag", *fFlag, SourceFlag},
+		{"opt-env", *fEnv, SourceEnv},
+		{"opt-file", *fFile, SourceFile},
+		{"opt-server", *fServer, SourceServer},
+		{"opt-default", *fDefault, SourceDefault},
+	}
+
+	for _, test := range tests {
+		if test.value != string(test.source) {
+			t.Errorf("%s: expected value %s, got %s", test.name, test.source, test.value)
+		}
+
+		if sources[test.name] != test.source {
+			t.Errorf("%s: expected source %s, got %s", test.name, test.source, sources[test.name])
+		}
+	}
+}
+
+func TestApplyConfigLayerUnknownOption(t *testing.T) {
+	app := kingpin.New("agent", "")
+	app.Flag("opt", "").Envar("TEST_OPT").String()
+
+	_, err := app.Parse(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flags := app.Model().Flags
+	sources := resolveSources(flags, nil, nil)
+
+	err = applyConfigLayer(flags, sources, map[string]string{"TEST_OTP": "value"}, SourceFile)
+	if err == nil {
+		t.Error("expected an error for an unknown option")
+	}
+}
+
+func TestRemoteLayersRestrictedOptions(t *testing.T) {
+	app := kingpin.New("agent", "")
+	fLogLevel := app.Flag("log-level", "").Envar(EnvKeyLogLevel).Default("INFO").String()
+	app.Flag("allowed-operations", "").Envar(EnvKeyAllowedOperations).String()
+	app.Flag("stack-hooks", "").Envar(EnvKeyStackHooks).String()
+
+	_, err := app.Parse(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flags := app.Model().Flags
+
+	for _, source := range []OptionSource{SourceServer, SourceProfile} {
+		for _, key := range []string{EnvKeyAllowedOperations, "stack-hooks"} {
+			sources := resolveSources(flags, nil, nil)
+
+			err = applyConfigLayer(flags, sources, map[string]string{key: "value"}, source)
+			if !errors.Is(err, ErrRestrictedOption) {
+				t.Errorf("%s: expected %s to be restricted, got %v", source, key, err)
+			}
+		}
+
+		sources := resolveSources(flags, nil, nil)
+
+		err = applyConfigLayer(flags, sources, map[string]string{EnvKeyLogLevel: "DEBUG"}, source)
+		if err != nil || *fLogLevel != "DEBUG" || sources["log-level"] != source {
+			t.Errorf("%s: expected the log level to be set, got %q, %v", source, *fLogLevel, err)
+		}
+	}
+
+	sources := resolveSources(flags, nil, nil)
+
+	err = applyConfigLayer(flags, sources, map[string]string{EnvKeyAllowedOperations: "value"}, SourceFile)
+	if err != nil {
+		t.Errorf("expected the configuration file to set any option, got %v", err)
+	}
+}
+
+func TestSaveServerConfigRestrictedOptions(t *testing.T) {
+	dataPath := t.TempDir()
+
+	for _, key := range []string{EnvKeyAllowedOperations, EnvKeyStackHooks, EnvKeyEdgeServerURLs, EnvKeyAgentSecret} {
+		err := SaveServerConfig(dataPath, map[string]string{key: "value"})
+		if !errors.Is(err, ErrRestrictedOption) {
+			t.Errorf("expected %s to be restricted, got %v", key, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dataPath, ServerConfigFileName)); !os.IsNotExist(err) {
+		t.Error("expected the restricted configuration not to be saved")
+	}
+
+	err := SaveServerConfig(dataPath, map[string]string{EnvKeyLogLevel: "DEBUG"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ImportProfile(dataPath, "", &Profile{Version: ProfileVersion, Options: map[string]string{EnvKeyAllowedOperations: "value"}})
+	if !errors.Is(err, ErrRestrictedOption) {
+		t.Errorf("expected the profile to be restricted, got %v", err)
+	}
+}
+
+func TestRemoteFlagsAreDefined(t *testing.T) {
+	defined := map[string]bool{}
+	for _, flag := range kingpin.CommandLine.Model().Flags {
+		defined[flag.Name] = true
+	}
+
+	for name := range remoteFlags {
+		if !defined[name] {
+			t.Errorf("the remote option %s is not defined", name)
+		}
+	}
+}
+
+func TestSecretsAreSensitive(t *testing.T) {
+	for _, key := range append(secretValueEnvKeys, EnvKeyReplicaToken, EnvKeyMTLSEnrollToken) {
+		if !sensitiveEnvKeys[key] {
+			t.Errorf("the secret %s is not sensitive", key)
+		}
+	}
+}
+
+func TestFlagInArgs(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected bool
+	}{
+		{[]string{"--opt"}, true},
+		{[]string{"--opt=value"}, true},
+		{[]string{"--no-opt"}, true},
+		{[]string{"--option"}, false},
+		{[]string{"--", "--opt"}, false},
+	}
+
+	for _, test := range tests {
+		if flagInArgs("opt", test.args) != test.expected {
+			t.Errorf("%v: expected %t", test.args, test.expected)
+		}
+	}
+}
+
+func TestReadConfigFile(t *testing.T) {
+	dir := t.TempDir()
+
+	values, err := readConfigFile(filepath.Join(dir, "missing.yaml"), true)
+	if err != nil || values != nil {
+		t.Errorf("expected a missing optional file to be ignored, got %v, %v", values, err)
+	}
+
+	_, err = readConfigFile(filepath.Join(dir, "missing.yaml"), false)
+	if err == nil {
+		t.Error("expected an error for a missing file")
+	}
+
+	path := filepath.Join(dir, "config.yaml")
+	err = os.WriteFile(path, []byte("log-level: DEBUG\nAGENT_PORT: \"9002\"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values, err = readConfigFile(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if values["log-level"] != "DEBUG" || values["AGENT_PORT"] != "9002" {
+		t.Errorf("unexpected values %v", values)
+	}
+}
@@ -1,11 +1,22 @@
 package os
 
 import (
+	"fmt"
+	"net"
+	"net/url"
+	goos "os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
+	"github.com/docker/go-units"
 	"github.com/pkg/errors"
 	"github.com/portainer/agent"
+	"github.com/portainer/agent/codec"
+	"github.com/portainer/agent/maintenance"
+	"github.com/portainer/agent/osupdate"
+	"github.com/portainer/agent/provisioning"
+	"github.com/portainer/agent/retention"
 
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 )
@@ -22,13 +33,34 @@ const (
 	EnvKeyDataPath              = "DATA_PATH"
 	EnvKeyEdge                  = "EDGE"
 	EnvKeyEdgeAsync             = "EDGE_ASYNC"
+	EnvKeyEdgeSnapshotDelta     = "EDGE_SNAPSHOT_DELTA"
+	EnvKeyEdgePayloadFormat     = "EDGE_PAYLOAD_FORMAT"
+	EnvKeyEdgeOfflineQueue      = "EDGE_OFFLINE_QUEUE"
+	EnvKeyEdgePayloadServerKey  = "EDGE_PAYLOAD_SERVER_KEY"
 	EnvKeyEdgeKey               = "EDGE_KEY"
 	EnvKeyEdgeID                = "EDGE_ID"
 	EnvKeyEdgeServerHost        = "EDGE_SERVER_HOST"
 	EnvKeyEdgeServerPort        = "EDGE_SERVER_PORT"
+	EnvKeyEdgeEnrollment        = "EDGE_ENROLLMENT"
+	EnvKeyEdgeEnrollURL         = "EDGE_ENROLL_URL"
+	EnvKeyEdgeEnrollCode        = "EDGE_ENROLL_CODE"
+	EnvKeyEdgeClaim             = "EDGE_CLAIM"
 	EnvKeyEdgeInactivityTimeout = "EDGE_INACTIVITY_TIMEOUT"
 	EnvKeyEdgeInsecurePoll      = "EDGE_INSECURE_POLL"
+	EnvKeyEdgeHTTP2             = "EDGE_HTTP2"
+	EnvKeyEdgeMaxIdleConns      = "EDGE_MAX_IDLE_CONNS"
+	EnvKeyEdgeIdleConnTimeout   = "EDGE_IDLE_CONN_TIMEOUT"
+	EnvKeyEdgePollTransport     = "EDGE_POLL_TRANSPORT"
+	EnvKeyEdgeServerURLs        = "EDGE_SERVER_URLS"
+	EnvKeyEdgeServerAddrRules   = "EDGE_SERVER_ADDRESS_RULES"
 	EnvKeyEdgeTunnel            = "EDGE_TUNNEL"
+	EnvKeyEdgeTunnelGracePeriod = "EDGE_TUNNEL_GRACE_PERIOD"
+	EnvKeyEdgeTunnelTransport   = "EDGE_TUNNEL_TRANSPORT"
+	EnvKeyEdgeOIDCTokenURL      = "EDGE_OIDC_TOKEN_URL"
+	EnvKeyEdgeOIDCClientID      = "EDGE_OIDC_CLIENT_ID"
+	EnvKeyEdgeOIDCClientSecret  = "EDGE_OIDC_CLIENT_SECRET"
+	EnvKeyEdgeOIDCScopes        = "EDGE_OIDC_SCOPES"
+	EnvKeyEdgeOIDCAudience      = "EDGE_OIDC_AUDIENCE"
 	EnvKeyHealthCheck           = "HEALTH_CHECK"
 	EnvKeyLogLevel              = "LOG_LEVEL"
 	EnvKeyLogMode               = "LOG_MODE"
@@ -36,6 +68,8 @@ const (
 	EnvKeySSLKey                = "MTLS_SSL_KEY"
 	EnvKeySSLCACert             = "MTLS_SSL_CA"
 	EnvKeyCertRetryInterval     = "MTLS_CERT_RETRY_INTERVAL"
+	EnvKeyMTLSEnrollURL         = "MTLS_ENROLL_URL"
+	EnvKeyMTLSEnrollToken       = "MTLS_ENROLL_TOKEN"
 	EnvKeyAWSClientCert         = "AWS_CLIENT_CERT"
 	EnvKeyAWSClientKey          = "AWS_CLIENT_KEY"
 	EnvKeyAWSClientBundle       = "AWS_CLIENT_BUNDLE"
@@ -43,16 +77,147 @@ const (
 	EnvKeyAWSTrustAnchorARN     = "AWS_TRUST_ANCHOR_ARN"
 	EnvKeyAWSProfileARN         = "AWS_PROFILE_ARN"
 	EnvKeyAWSRegion             = "AWS_REGION"
+	EnvKeyCredentialHelpers     = "REGISTRY_CREDENTIAL_HELPERS"
+	EnvKeyCredentialHelpersTTL  = "REGISTRY_CREDENTIALS_TTL"
+	EnvKeyGitCredentialHelpers  = "GIT_CREDENTIAL_HELPERS"
 	EnvKeyUpdateID              = "UPDATE_ID"
 	EnvKeyEdgeGroups            = "EDGE_GROUPS"
 	EnvKeyEnvironmentGroup      = "PORTAINER_GROUP"
 	EnvKeyTags                  = "PORTAINER_TAGS"
+	EnvKeyWebhookSecret         = "AGENT_WEBHOOK_SECRET"
+	EnvKeyRegistryAutoUpdate    = "AGENT_REGISTRY_AUTO_UPDATE"
+	EnvKeyRegistryWebhookToken  = "AGENT_REGISTRY_WEBHOOK_TOKEN"
+	EnvKeyDeployExtraHosts      = "AGENT_DEPLOY_EXTRA_HOSTS"
+	EnvKeyDeployDNS             = "AGENT_DEPLOY_DNS"
+	EnvKeyQuotaMaxContainers    = "AGENT_QUOTA_MAX_CONTAINERS"
+	EnvKeyQuotaMaxVolumes       = "AGENT_QUOTA_MAX_VOLUMES"
+	EnvKeyQuotaMaxMemory        = "AGENT_QUOTA_MAX_MEMORY"
+	EnvKeyQuotaMaxCPUs          = "AGENT_QUOTA_MAX_CPUS"
+	EnvKeyAllowedOperations     = "AGENT_ALLOWED_OPERATIONS"
+	EnvKeyRedactionPatterns     = "AGENT_REDACTION_PATTERNS"
+	EnvKeyCaptureImage          = "AGENT_CAPTURE_IMAGE"
+	EnvKeyScanImage             = "AGENT_SCAN_IMAGE"
+	EnvKeyHostActionImage       = "AGENT_HOST_ACTION_IMAGE"
+	EnvKeyKubernetesKubeconfig  = "KUBERNETES_KUBECONFIG"
+	EnvKeyProxyPolicyFile       = "AGENT_PROXY_POLICY_FILE"
+	EnvKeyConfigFile            = "AGENT_CONFIG_FILE"
+	EnvKeyProfile               = "AGENT_PROFILE"
+	EnvKeyIdentityFile          = "AGENT_IDENTITY_FILE"
+	EnvKeyDockerProxyTimeout    = "AGENT_DOCKER_PROXY_TIMEOUT"
+	EnvKeyDockerProxyRetries    = "AGENT_DOCKER_PROXY_RETRIES"
+	EnvKeyACMEDomains           = "AGENT_ACME_DOMAINS"
+	EnvKeyACMEEmail             = "AGENT_ACME_EMAIL"
+	EnvKeyACMEDirectoryURL      = "AGENT_ACME_DIRECTORY_URL"
+	EnvKeyACMESolver            = "AGENT_ACME_SOLVER"
+	EnvKeyACMEHTTPAddr          = "AGENT_ACME_HTTP_ADDR"
+	EnvKeyACMEDNSHook           = "AGENT_ACME_DNS_HOOK"
+	EnvKeySPIFFEEndpointSocket  = "AGENT_SPIFFE_ENDPOINT_SOCKET"
+	EnvKeyEgressAllowlist       = "AGENT_EGRESS_ALLOWLIST"
+	EnvKeyDeploymentLintPolicy  = "AGENT_DEPLOYMENT_LINT_POLICY"
+	EnvKeyOrphanGCPolicy        = "AGENT_ORPHAN_GC_POLICY"
+	EnvKeyOrphanGCInterval      = "AGENT_ORPHAN_GC_INTERVAL"
+	EnvKeyStackHooks            = "AGENT_STACK_HOOKS"
+	EnvKeyStackHookTimeout      = "AGENT_STACK_HOOK_TIMEOUT"
+	EnvKeyHealthGateWindow      = "AGENT_HEALTH_GATE_WINDOW"
+	EnvKeyHealthGateMinUptime   = "AGENT_HEALTH_GATE_MIN_UPTIME"
+	EnvKeyBandwidthMonthlyCap   = "AGENT_BANDWIDTH_MONTHLY_CAP"
+	EnvKeyBandwidthWarning      = "AGENT_BANDWIDTH_WARNING_THRESHOLD"
+	EnvKeyMaintenanceWindows    = "AGENT_MAINTENANCE_WINDOWS"
+	EnvKeyOSUpdater             = "AGENT_OS_UPDATER"
+	EnvKeySystemdUnits          = "AGENT_SYSTEMD_UNITS"
+	EnvKeyCommandPluginsPath    = "AGENT_COMMAND_PLUGINS_PATH"
+	EnvKeyGRPCAPI               = "AGENT_GRPC_API"
+	EnvKeySnapshotStats         = "AGENT_SNAPSHOT_STATS"
+	EnvKeySnapshotVMs           = "AGENT_SNAPSHOT_VMS"
+	EnvKeySnapshotOverlay       = "AGENT_SNAPSHOT_OVERLAY"
+	EnvKeySnapshotSMART         = "AGENT_SNAPSHOT_SMART"
+	EnvKeySnapshotKernel        = "AGENT_SNAPSHOT_KERNEL_ANOMALIES"
+	EnvKeySnapshotLANDevices    = "AGENT_SNAPSHOT_LAN_DEVICES"
+	EnvKeyTemperatureAlert      = "AGENT_TEMPERATURE_ALERT_THRESHOLD"
+	EnvKeyBatteryAlert          = "AGENT_BATTERY_ALERT_THRESHOLD"
+	EnvKeySnapshotConcurrency   = "AGENT_SNAPSHOT_CONCURRENCY"
+	EnvKeySnapshotEnv           = "AGENT_SNAPSHOT_ENV"
+	EnvKeyStackConcurrency      = "AGENT_STACK_CONCURRENCY"
+	EnvKeyEventBusURL           = "AGENT_EVENT_BUS_URL"
+	EnvKeyEventBusSubject       = "AGENT_EVENT_BUS_SUBJECT"
+	EnvKeyEventBusInterval      = "AGENT_EVENT_BUS_SNAPSHOT_INTERVAL"
+	EnvKeyLogShippingURL        = "AGENT_LOG_SHIPPING_URL"
+	EnvKeyLogShippingContainers = "AGENT_LOG_SHIPPING_CONTAINERS"
+	EnvKeyLogShippingBatchSize  = "AGENT_LOG_SHIPPING_BATCH_SIZE"
+	EnvKeyLogShippingInterval   = "AGENT_LOG_SHIPPING_FLUSH_INTERVAL"
+	EnvKeyMetricsAddr           = "AGENT_METRICS_ADDR"
+	EnvKeyReplicaToken          = "AGENT_REPLICA_TOKEN"
+	EnvKeyCrashArtifacts        = "AGENT_CRASH_ARTIFACTS"
+	EnvKeyCrashLogLines         = "AGENT_CRASH_LOG_LINES"
+	EnvKeyCrashCoreDumpPath     = "AGENT_CRASH_CORE_DUMP_PATH"
+	EnvKeyCrashArtifactsMaxSize = "AGENT_CRASH_ARTIFACTS_MAX_SIZE"
+	EnvKeyAuditSessions         = "AGENT_AUDIT_SESSIONS"
+	EnvKeyAuditMaxSize          = "AGENT_AUDIT_MAX_SIZE"
+	EnvKeyIdempotencyWindow     = "AGENT_IDEMPOTENCY_WINDOW"
+	EnvKeyBrowseArchiveMaxSize  = "AGENT_BROWSE_ARCHIVE_MAX_SIZE"
+	EnvKeyClockSkewTolerance    = "AGENT_CLOCK_SKEW_TOLERANCE"
+	EnvKeyEdgeStackAutoRollback = "AGENT_EDGE_STACK_AUTO_ROLLBACK"
+	EnvKeyEdgeStackHistorySize  = "AGENT_EDGE_STACK_HISTORY_SIZE"
+	EnvKeyEdgeStackPreflight    = "AGENT_EDGE_STACK_PREFLIGHT"
+	EnvKeyHASocket              = "AGENT_HA_SOCKET"
+	EnvKeyRetentionPolicies     = "AGENT_RETENTION_POLICIES"
+	EnvKeyRetentionInterval     = "AGENT_RETENTION_INTERVAL"
+	EnvKeyProvisioningSources   = "AGENT_PROVISIONING_SOURCES"
+	EnvKeyProvisioningURL       = "AGENT_PROVISIONING_URL"
+	EnvKeyAnomalyDetection      = "AGENT_ANOMALY_DETECTION"
+	EnvKeyAnomalyFailedAuth     = "AGENT_ANOMALY_FAILED_AUTH_THRESHOLD"
+	EnvKeyAnomalyLearning       = "AGENT_ANOMALY_LEARNING_PERIOD"
+	EnvKeyAlertWebhookURL       = "AGENT_ALERT_WEBHOOK_URL"
+	EnvKeyAlertNotifiers        = "AGENT_ALERT_NOTIFIERS"
+	EnvKeyAlertNotifyInterval   = "AGENT_ALERT_NOTIFY_INTERVAL"
+	EnvKeyShutdownSignals       = "AGENT_SHUTDOWN_SIGNALS"
+	EnvKeyShutdownStopTimeout   = "AGENT_SHUTDOWN_STOP_TIMEOUT"
+	EnvKeyShutdownTimeout       = "AGENT_SHUTDOWN_TIMEOUT"
+	EnvKeyPowerUPS              = "AGENT_POWER_UPS"
+	EnvKeyPowerCheckInterval    = "AGENT_POWER_CHECK_INTERVAL"
+	EnvKeyPowerShedding         = "AGENT_POWER_SHEDDING"
+	EnvKeyPowerShedDelay        = "AGENT_POWER_SHED_DELAY"
+	EnvKeyNetworkPolicy         = "AGENT_NETWORK_POLICY"
+	EnvKeyNetworkPolicyInterval = "AGENT_NETWORK_POLICY_INTERVAL"
+	EnvKeyPortForwardNetworks   = "AGENT_PORT_FORWARD_NETWORKS"
+	EnvKeyPortForwardMaxSess    = "AGENT_PORT_FORWARD_MAX_SESSIONS"
+	EnvKeyPortForwardMaxDur     = "AGENT_PORT_FORWARD_MAX_DURATION"
+	EnvKeyTPM                   = "AGENT_TPM"
+	EnvKeyTPMDevice             = "AGENT_TPM_DEVICE"
+	EnvKeyStateEncryption       = "AGENT_STATE_ENCRYPTION"
+	EnvKeyStateSecret           = "AGENT_STATE_SECRET"
+	EnvKeyDockerBroker          = "AGENT_DOCKER_BROKER"
+	EnvKeyBrokerMode            = "AGENT_BROKER_MODE"
+	EnvKeyBrokerUID             = "AGENT_BROKER_UID"
+	EnvKeyPrivilegeCheck        = "AGENT_PRIVILEGE_CHECK"
+	EnvKeyHooksPath             = "AGENT_HOOKS_PATH"
+	EnvKeyHooksInterval         = "AGENT_HOOKS_SNAPSHOT_INTERVAL"
+	EnvKeyWASMPluginsPath       = "AGENT_WASM_PLUGINS_PATH"
+	EnvKeyWASMPluginTimeout     = "AGENT_WASM_PLUGIN_TIMEOUT"
+	EnvKeyImageCacheAddr        = "AGENT_IMAGE_CACHE_ADDR"
+	EnvKeyImageCacheUpstream    = "AGENT_IMAGE_CACHE_UPSTREAM"
+	EnvKeyImageCacheMaxSize     = "AGENT_IMAGE_CACHE_MAX_SIZE"
+	EnvKeyRelayAddr             = "AGENT_RELAY_ADDR"
+	EnvKeyRelaySecret           = "AGENT_RELAY_SECRET"
+	EnvKeySnapshotHistory       = "AGENT_SNAPSHOT_HISTORY_INTERVAL"
 )
 
-type EnvOptionParser struct{}
+// EnvOptionParser parses the options of the agent from the following layers, by order of precedence:
+// command line flags, environment variables (or files referenced by *_FILE variables), configuration file,
+// imported configuration profile, configuration pushed by the Portainer server and default values.
+type EnvOptionParser struct {
+	sources map[string]OptionSource
+	// secretFiles are the files the secrets were read from, by environment variable
+	secretFiles map[string]string
+	// exposedSecrets are the environment variables of the secrets provided through an environment variable or a flag
+	exposedSecrets []string
+}
 
 func NewEnvOptionParser() *EnvOptionParser {
-	return &EnvOptionParser{}
+	return &EnvOptionParser{
+		sources:     map[string]OptionSource{},
+		secretFiles: map[string]string{},
+	}
 }
 
 var (
@@ -64,31 +229,176 @@ var (
 	fClusterProbeTimeout   = kingpin.Flag("agent-cluster-timeout", EnvKeyClusterProbeTimeout+" timeout interval for receiving agent member probe responses (only change this setting if you know what you're doing)").Envar(EnvKeyClusterProbeTimeout).Default(agent.DefaultClusterProbeTimeout).Duration()
 	fClusterProbeInterval  = kingpin.Flag("agent-cluster-interval", EnvKeyClusterProbeInterval+" interval for repeating failed agent member probe (only change this setting if you know what you're doing)").Envar(EnvKeyClusterProbeInterval).Default(agent.DefaultClusterProbeInterval).Duration()
 	fDataPath              = kingpin.Flag("data", EnvKeyDataPath+" path to the data folder").Envar(EnvKeyDataPath).Default(agent.DefaultDataPath).String()
-	fSharedSecret          = kingpin.Flag("secret", EnvKeyAgentSecret+" shared secret used in the signature verification process").Envar(EnvKeyAgentSecret).String()
+	fSharedSecret          = sensitive(kingpin.Flag("secret", EnvKeyAgentSecret+" shared secret used in the signature verification process").Envar(EnvKeyAgentSecret)).String()
 	fLogLevel              = kingpin.Flag("log-level", EnvKeyLogLevel+" defines the log output verbosity (default to INFO)").Envar(EnvKeyLogLevel).Default(agent.DefaultLogLevel).Enum("ERROR", "WARN", "INFO", "DEBUG")
 	fLogMode               = kingpin.Flag("log-mode", EnvKeyLogMode+" defines the logging output mode").Envar(EnvKeyLogMode).Default("PRETTY").Enum("PRETTY", "JSON")
 	fHealthCheck           = kingpin.Flag("health-check", "run the agent in healthcheck mode and exit after running preflight checks").Envar(EnvKeyHealthCheck).Default("false").Bool()
+	fConfigFile            = kingpin.Flag("config", EnvKeyConfigFile+" path to a YAML configuration file mapping option names (flag or environment variable names) to values. Flags and environment variables take precedence over this file").Envar(EnvKeyConfigFile).String()
+	fPrintConfig           = kingpin.Flag("print-config", "print the effective configuration along with the source of each value and exit").Bool()
+	fExportProfile         = kingpin.Flag("export-profile", "write the configuration profile of the agent to the specified file (- for the standard output) and exit. The profile contains the tuning options that are not set to their default value, the options gating the operations and the security of the agent are never part of a profile, the secrets are only referenced by the files they are read from").String()
+	fImportProfile         = kingpin.Flag("import-profile", "import the configuration profile of the specified file inside the data folder and exit. The profile is applied on the next start to the options that are not defined via a flag, an environment variable or the configuration file, a profile setting an option gating the operations or the security of the agent is rejected").String()
+	fProfile               = kingpin.Flag("profile", EnvKeyProfile+" name of the configuration profile applied on start, e.g. staging or production, instead of the profile selected with --use-profile. With --import-profile, the name under which the profile is imported (default to the unnamed profile)").Envar(EnvKeyProfile).String()
+	fUseProfile            = kingpin.Flag("use-profile", "select the configuration profile applied on the next starts (default for the unnamed profile) and exit. The configuration pushed by the Portainer server is discarded when the selected profile changes").String()
+	fListProfiles          = kingpin.Flag("list-profiles", "list the imported configuration profiles and exit").Bool()
 	fUpdateID              = kingpin.Flag("update-id", "the edge update identifier that started this agent").Envar(EnvKeyUpdateID).Int()
+	fAllowedOperations     = kingpin.Flag("allowed-operations", EnvKeyAllowedOperations+" a comma-separated list of the policy-gated operations allowed on this agent (e.g. traffic_capture, stack_sync, sftp, host_reboot, docker_restart, kubernetes_restart, os_update, log_remediation, image_scan, systemd_restart, overlay_control, sbom, journal_query, network_debug, script_hooks, network_policy, port_forward, zram, stack_migration). All of them are disabled by default").Envar(EnvKeyAllowedOperations).String()
+	fRedactionPatterns     = kingpin.Flag("redaction-patterns", EnvKeyRedactionPatterns+" a comma-separated list of patterns (e.g. *PASSWORD*) matching the names of the environment variables and configuration keys whose values are redacted, in the stack files and in the environment of the containers sent in the snapshots. Defaults to *PASSWORD*,*SECRET*,*TOKEN*,*KEY*").Envar(EnvKeyRedactionPatterns).String()
+	fCaptureImage          = kingpin.Flag("capture-image", EnvKeyCaptureImage+" image providing tcpdump, dig and curl, used to capture the network traffic of containers and to debug their network").Envar(EnvKeyCaptureImage).Default(agent.DefaultCaptureImage).String()
+	fScanImage             = kingpin.Flag("scan-image", EnvKeyScanImage+" image providing Trivy, used to scan the local images for vulnerabilities").Envar(EnvKeyScanImage).Default(agent.DefaultScanImage).String()
+	fHostActionImage       = kingpin.Flag("host-action-image", EnvKeyHostActionImage+" image providing nsenter, used to reboot the host and restart the Docker daemon").Envar(EnvKeyHostActionImage).Default(agent.DefaultHostActionImage).String()
+	fKubernetesKubeconfig  = kingpin.Flag("kubernetes-kubeconfig", EnvKeyKubernetesKubeconfig+" path to the kubeconfig of a Kubernetes cluster running on the same host as the Docker daemon (e.g. k3s), or auto to use the kubeconfig of the distribution installed on the host. The agent then snapshots and serves the cluster as a second environment, it must be able to reach the API server (e.g. with the host network). Disabled by default").Envar(EnvKeyKubernetesKubeconfig).String()
+	fProxyPolicyFile       = kingpin.Flag("proxy-policy-file", EnvKeyProxyPolicyFile+" path to a JSON file containing the allow and deny rules, by HTTP method and Docker API path, and the rate limit per client applied to the Docker API requests proxied by the agent. The policy pushed by the Portainer server can only restrict it further").Envar(EnvKeyProxyPolicyFile).String()
+	fIdentityFile          = kingpin.Flag("identity-file", EnvKeyIdentityFile+" path to the file persisting the identity of the agent (defaults to agent_identity.json inside the data folder)").Envar(EnvKeyIdentityFile).String()
+	fDockerProxyTimeout    = kingpin.Flag("docker-proxy-timeout", EnvKeyDockerProxyTimeout+" maximum duration to wait for the Docker daemon to answer a proxied request, requests waiting for a container and uploads are not limited (0 to disable)").Envar(EnvKeyDockerProxyTimeout).Default(agent.DefaultDockerProxyTimeout).Duration()
+	fDockerProxyRetries    = kingpin.Flag("docker-proxy-retries", EnvKeyDockerProxyRetries+" number of times a proxied read request is sent again to the Docker daemon after a failure, write requests are never retried").Envar(EnvKeyDockerProxyRetries).Default(agent.DefaultDockerProxyRetries).Int()
+	fACMEDomains           = kingpin.Flag("acme-domains", EnvKeyACMEDomains+" comma separated list of domain names for which a certificate of the agent API is obtained and renewed from an ACME certificate authority (e.g. Let's Encrypt)").Envar(EnvKeyACMEDomains).String()
+	fACMEEmail             = kingpin.Flag("acme-email", EnvKeyACMEEmail+" contact email of the ACME account").Envar(EnvKeyACMEEmail).String()
+	fACMEDirectoryURL      = kingpin.Flag("acme-directory-url", EnvKeyACMEDirectoryURL+" URL of the ACME directory (defaults to Let's Encrypt)").Envar(EnvKeyACMEDirectoryURL).Default(agent.DefaultACMEDirectoryURL).String()
+	fACMESolver            = kingpin.Flag("acme-solver", EnvKeyACMESolver+" challenge used to validate the domains: http-01, tls-alpn-01 or dns-01").Envar(EnvKeyACMESolver).Default(agent.ACMESolverHTTP01).Enum(agent.ACMESolverHTTP01, agent.ACMESolverTLSALPN01, agent.ACMESolverDNS01)
+	fACMEHTTPAddr          = kingpin.Flag("acme-http-addr", EnvKeyACMEHTTPAddr+" address of the server answering the HTTP-01 challenges").Envar(EnvKeyACMEHTTPAddr).Default(agent.DefaultACMEHTTPAddr).String()
+	fACMEDNSHook           = kingpin.Flag("acme-dns-hook", EnvKeyACMEDNSHook+" command publishing the DNS-01 challenge records, called with the present or cleanup action, the record name and its value").Envar(EnvKeyACMEDNSHook).String()
+	fSPIFFEEndpointSocket  = kingpin.Flag("spiffe-endpoint-socket", EnvKeySPIFFEEndpointSocket+" address of the SPIFFE Workload API socket of the SPIRE agent (e.g. unix:///run/spire/sockets/agent.sock), the X509 SVID retrieved from it is used as the mTLS client certificate of the agent and rotated automatically").Envar(EnvKeySPIFFEEndpointSocket).String()
+	fEgressAllowlist       = kingpin.Flag("egress-allowlist", EnvKeyEgressAllowlist+" comma separated list of the hosts the agent is allowed to connect to (e.g. portainer.example.com:9443,*.registry.example.com,10.0.0.0/8), the other outbound connections of the agent are refused and reported. All hosts are allowed when not set").Envar(EnvKeyEgressAllowlist).String()
+	fDeploymentLintPolicy  = kingpin.Flag("deployment-lint-policy", EnvKeyDeploymentLintPolicy+" action taken when an Edge stack uses dangerous settings (privileged mode, host PID/IPC namespaces, Docker socket mounts, SYS_ADMIN capability): off, warn or block (default to warn)").Envar(EnvKeyDeploymentLintPolicy).Default(agent.DeploymentLintPolicyWarn).Enum(agent.DeploymentLintPolicyOff, agent.DeploymentLintPolicyWarn, agent.DeploymentLintPolicyBlock)
+	fOrphanGCPolicy        = kingpin.Flag("orphan-gc-policy", EnvKeyOrphanGCPolicy+" action taken on the resources labeled as belonging to a deployed Edge stack that its definition no longer references (e.g. renamed services, removed volumes): off, report or remove (default to report)").Envar(EnvKeyOrphanGCPolicy).Default(agent.OrphanGCPolicyReport).Enum(agent.OrphanGCPolicyOff, agent.OrphanGCPolicyReport, agent.OrphanGCPolicyRemove)
+	fOrphanGCInterval      = kingpin.Flag("orphan-gc-interval", EnvKeyOrphanGCInterval+" interval between two detections of the orphaned resources of the Edge stacks (default to 1h)").Envar(EnvKeyOrphanGCInterval).Default(agent.DefaultOrphanGCInterval).Duration()
+	fStackHooks            = kingpin.Flag("stack-hooks", EnvKeyStackHooks+" enable this option to run the hook scripts bundled with the Edge stacks in their .portainer/hooks folder (pre-deploy.sh, post-deploy.sh and pre-remove.sh). Disabled by default").Envar(EnvKeyStackHooks).Bool()
+	fStackHookTimeout      = kingpin.Flag("stack-hook-timeout", EnvKeyStackHookTimeout+" maximum duration of the execution of an Edge stack hook script (default to 5m)").Envar(EnvKeyStackHookTimeout).Default(agent.DefaultStackHookTimeout).Duration()
+	fHealthGateWindow      = kingpin.Flag("health-gate-window", EnvKeyHealthGateWindow+" maximum duration after the deployment of an Edge stack for all its services to become healthy, or to run for the minimum uptime when they have no healthcheck, before the deployment is reported as successful. The deployment is reported as failed when a service does not pass its gate within the window. Disabled when not set").Envar(EnvKeyHealthGateWindow).Default("0s").Duration()
+	fHealthGateMinUptime   = kingpin.Flag("health-gate-min-uptime", EnvKeyHealthGateMinUptime+" duration the containers without healthcheck must be running for to pass the health gate (default to 10s)").Envar(EnvKeyHealthGateMinUptime).Default(agent.DefaultHealthGateMinUptime).Duration()
+	fStackConcurrency      = kingpin.Flag("stack-concurrency", EnvKeyStackConcurrency+" maximum number of stacks deployed, updated or removed at the same time, the other operations are queued. The operations on the same stack are always executed one at a time (default to 1)").Envar(EnvKeyStackConcurrency).Default(agent.DefaultStackConcurrency).Int()
+	fBandwidthMonthlyCap   = kingpin.Flag("bandwidth-monthly-cap", EnvKeyBandwidthMonthlyCap+" maximum amount of data exchanged by the agent per calendar month (e.g. 5GB), for devices on metered connections. Once exceeded, the log streams and the file transfers are refused until the end of the month while the snapshots and the tunnel keep working. No cap when not set").Envar(EnvKeyBandwidthMonthlyCap).String()
+	fBandwidthWarning      = kingpin.Flag("bandwidth-warning-threshold", EnvKeyBandwidthWarning+" percentage of the monthly bandwidth cap from which a warning is logged and reported in the snapshots (default to 80)").Envar(EnvKeyBandwidthWarning).Default(agent.DefaultBandwidthWarningThreshold).Int()
+	fMaintenanceWindows    = kingpin.Flag("maintenance-windows", EnvKeyMaintenanceWindows+" semicolon-separated list of the maintenance windows during which the disruptive operations (Edge stack updates and removals, prunes, stack deployments and updates through the agent API, host reboots) are executed, in the [days ]HH:MM-HH:MM format using the local time (e.g. Sat-Sun 02:00-06:00;Mon-Fri 22:00-23:30). The operations requested outside the windows are deferred. No restriction when not set").Envar(EnvKeyMaintenanceWindows).String()
+	fOSUpdater             = kingpin.Flag("os-updater", EnvKeyOSUpdater+" tool used to update the host operating system when requested by Portainer (rauc, mender, swupdate or apt). The tool must be installed on the host. OS updates are disabled when not set").Envar(EnvKeyOSUpdater).String()
+	fSystemdUnits          = kingpin.Flag("systemd-units", EnvKeySystemdUnits+" a comma-separated list of the systemd units of the host reported in the snapshots (e.g. containerd,chronyd,wg-quick@wg0). They are the only units that can be restarted with the systemd_restart operation").Envar(EnvKeySystemdUnits).String()
+	fCommandPluginsPath    = kingpin.Flag("command-plugins-path", EnvKeyCommandPluginsPath+" folder containing the Go plugins (*.so) providing the executors of additional Edge async commands. Each plugin exports an Executors function returning a []command.Executor, the agent must be built with cgo").Envar(EnvKeyCommandPluginsPath).String()
+	fGRPCAPI               = kingpin.Flag("grpc-api", EnvKeyGRPCAPI+" enable this option to serve the gRPC control-plane API described in grpcapi/agent.proto alongside the REST API, on HTTP/2 connections. Disabled by default").Envar(EnvKeyGRPCAPI).Bool()
+	fSnapshotStats         = kingpin.Flag("snapshot-stats", EnvKeySnapshotStats+" enable this option to add the CPU and memory usage of the running containers to the Docker snapshots. Retrieving the stats adds load on the hosts running many containers. The Portainer server can override this option per environment, the containers labelled with io.portainer.agent.stats=true or false are always included or excluded. Disabled by default").Envar(EnvKeySnapshotStats).Bool()
+	fSnapshotVMs           = kingpin.Flag("snapshot-vms", EnvKeySnapshotVMs+" enable this option to add the QEMU/KVM virtual machines managed by libvirt on the host to the snapshots, with their state, vCPUs and memory. The libvirt folders are read through the host filesystem mounted in /host. The Portainer server can override this option per environment. Disabled by default").Envar(EnvKeySnapshotVMs).Bool()
+	fSnapshotOverlay       = kingpin.Flag("snapshot-overlay", EnvKeySnapshotOverlay+" enable this option to add the status of the WireGuard, Tailscale and ZeroTier clients installed on the host to the snapshots, with their peers and assigned addresses. The Portainer server can override this option per environment. Disabled by default").Envar(EnvKeySnapshotOverlay).Bool()
+	fSnapshotSMART         = kingpin.Flag("snapshot-smart", EnvKeySnapshotSMART+" enable this option to add the SMART health of the disks of the host to the snapshots and report the failing drives. The ATA, SCSI and NVMe disks are read with the smartctl binary of the host, the eMMC disks from their kernel attributes. The Portainer server can override this option per environment. Disabled by default").Envar(EnvKeySnapshotSMART).Bool()
+	fSnapshotKernel        = kingpin.Flag("snapshot-kernel-anomalies", EnvKeySnapshotKernel+" enable this option to scan the kernel messages of the host every five minutes and add the anomalies of the last 24 hours (OOM killer activations, filesystem and I/O errors, USB disconnections, hung tasks) to the snapshots. The messages are read with journalctl, or with dmesg on the hosts without journald. The Portainer server can override this option per environment. Disabled by default").Envar(EnvKeySnapshotKernel).Bool()
+	fSnapshotLANDevices    = kingpin.Flag("snapshot-lan-devices", EnvKeySnapshotLANDevices+" enable this option to discover the devices of the local network of the host with mDNS (DNS-SD) and SSDP (UPnP) every ten minutes and add an inventory of the devices seen during the last hour (address, name, manufacturer, model and advertised services) to the snapshots. The agent must run on the host network. The Portainer server can override this option per environment. Disabled by default").Envar(EnvKeySnapshotLANDevices).Bool()
+	fTemperatureAlert      = kingpin.Flag("temperature-alert-threshold", EnvKeyTemperatureAlert+" CPU temperature in Celsius from which an alert is reported in the snapshots and on the event bus, 0 to disable the alert. The throttling of the CPU and the under-voltage of a Raspberry Pi are always reported (default to 80)").Envar(EnvKeyTemperatureAlert).Default(agent.DefaultTemperatureAlertThreshold).Float64()
+	fBatteryAlert          = kingpin.Flag("battery-alert-threshold", EnvKeyBatteryAlert+" capacity in percent of a discharging battery or UPS of the host from which an alert is reported in the snapshots and on the event bus (default to 20)").Envar(EnvKeyBatteryAlert).Default(agent.DefaultBatteryAlertThreshold).Int()
+	fSnapshotConcurrency   = kingpin.Flag("snapshot-concurrency", EnvKeySnapshotConcurrency+" maximum number of containers inspected in parallel when creating a Docker snapshot (default to 5)").Envar(EnvKeySnapshotConcurrency).Default(agent.DefaultSnapshotConcurrency).Int()
+	fSnapshotEnv           = kingpin.Flag("snapshot-env", EnvKeySnapshotEnv+" disable this option to remove the environment variables of the containers from the Docker snapshots, they are otherwise sent with the values matching the redaction patterns masked. Enabled by default").Envar(EnvKeySnapshotEnv).Default("true").Bool()
+	fEventBusURL           = kingpin.Flag("event-bus-url", EnvKeyEventBusURL+" URL of the NATS server on which the snapshots, Docker events and alerts of the agent are published (nats://[user:password@]host[:port] or tls://...). Disabled when not set").Envar(EnvKeyEventBusURL).String()
+	fEventBusSubject       = kingpin.Flag("event-bus-subject", EnvKeyEventBusSubject+" prefix of the subjects of the messages published on the event bus, followed by the type of the message (default to portainer.agent)").Envar(EnvKeyEventBusSubject).Default(agent.DefaultEventBusSubject).String()
+	fEventBusInterval      = kingpin.Flag("event-bus-snapshot-interval", EnvKeyEventBusInterval+" interval between two snapshots published on the event bus (default to 5m)").Envar(EnvKeyEventBusInterval).Default(agent.DefaultEventBusSnapshotInterval).Duration()
+	fLogShippingURL        = kingpin.Flag("log-shipping-url", EnvKeyLogShippingURL+" URL of the sink to which the logs of the selected containers are shipped: the push API of Loki (loki+http://[user:password@]host:port[/path][?tenant=id] or loki+https://...), a syslog server (syslog+udp://host:port, syslog+tcp://... or syslog+tls://...) or a HTTP endpoint receiving the lines in JSON (http://... or https://...). Disabled when not set").Envar(EnvKeyLogShippingURL).String()
+	fLogShippingContainers = kingpin.Flag("log-shipping-containers", EnvKeyLogShippingContainers+" comma separated list of the patterns of the names of the containers whose logs are shipped (e.g. web-*,db), the containers labelled with io.portainer.agent.logship=true (or with the kind of the sink: loki, syslog or http) are always shipped and the ones labelled with io.portainer.agent.logship=false never are").Envar(EnvKeyLogShippingContainers).String()
+	fLogShippingBatchSize  = kingpin.Flag("log-shipping-batch-size", EnvKeyLogShippingBatchSize+" number of lines from which the shipped logs are sent before the flush interval (default to 500)").Envar(EnvKeyLogShippingBatchSize).Default(agent.DefaultLogShippingBatchSize).Int()
+	fLogShippingInterval   = kingpin.Flag("log-shipping-flush-interval", EnvKeyLogShippingInterval+" interval at which the shipped logs are sent (default to 5s)").Envar(EnvKeyLogShippingInterval).Default(agent.DefaultLogShippingFlushInterval).Duration()
+	fMetricsAddr           = kingpin.Flag("metrics-addr", EnvKeyMetricsAddr+" address (in the [IP]:PORT format) of the listener exposing the internal metrics of the agent in the Prometheus format under /metrics, e.g. :9090. The listener is not authenticated. Disabled when not set").Envar(EnvKeyMetricsAddr).String()
+	fReplicaToken          = sensitive(kingpin.Flag("replica-token", EnvKeyReplicaToken+" bearer token expected from the local consumers of the read-only replica API (/replica/snapshot and /replica/metrics), which does not grant access to the rest of the agent API. The replica API is disabled when not set").Envar(EnvKeyReplicaToken)).String()
+	fCrashArtifacts        = kingpin.Flag("crash-artifacts", EnvKeyCrashArtifacts+" enable this option to collect the last log lines and the inspection of the containers exiting with a non-zero code or killed when running out of memory, they are stored in the data folder and served by the agent API under /crashes. The containers labelled with io.portainer.agent.crash=false are ignored. Disabled by default").Envar(EnvKeyCrashArtifacts).Bool()
+	fCrashLogLines         = kingpin.Flag("crash-log-lines", EnvKeyCrashLogLines+" number of log lines collected when a container crashes (default to 200)").Envar(EnvKeyCrashLogLines).Default(agent.DefaultCrashLogLines).Int()
+	fCrashCoreDumpPath     = kingpin.Flag("crash-core-dump-path", EnvKeyCrashCoreDumpPath+" folder of the host where the kernel writes the core dumps (e.g. /var/crash), the core dumps written while a crashed container was running are collected with its artifact. The host filesystem must be mounted in the agent container. Not collected when not set").Envar(EnvKeyCrashCoreDumpPath).String()
+	fCrashMaxSize          = kingpin.Flag("crash-artifacts-max-size", EnvKeyCrashArtifactsMaxSize+" maximum total size of the stored crash artifacts (e.g. 512MB), the oldest artifacts are removed once exceeded (default to 256MB)").Envar(EnvKeyCrashArtifactsMaxSize).Default(agent.DefaultCrashArtifactsMaxSize).String()
+	fAuditSessions         = kingpin.Flag("audit-sessions", EnvKeyAuditSessions+" recording of the exec, attach and pod exec sessions opened through the agent: off, metadata (command, user and timestamps) or full (metadata, input and output). The sessions are written to the audit folder of the data folder and their start and end are published on the event bus, when configured (default to off)").Envar(EnvKeyAuditSessions).Default(agent.AuditSessionsOff).Enum(agent.AuditSessionsOff, agent.AuditSessionsMetadata, agent.AuditSessionsFull)
+	fAuditMaxSize          = kingpin.Flag("audit-max-size", EnvKeyAuditMaxSize+" size from which the audit trail is rotated (e.g. 50MB), the last 5 rotated files are kept (default to 10MB)").Envar(EnvKeyAuditMaxSize).Default(agent.DefaultAuditMaxSize).String()
+	fRetentionPolicies     = kingpin.Flag("retention-policies", EnvKeyRetentionPolicies+" comma separated list of the policies bounding the data stored by the agent on the device, formatted as category:max_age:max_size where category is jobs (the outputs of the Edge jobs), backups (the volume backups), histories (the deployed versions of the Edge stacks), crashes (the crash artifacts), recordings (the rotated files of the audit trail) or snapshots (the history of the snapshots), e.g. jobs:168h:50MB,backups::2GB. The oldest items are removed once they exceed the maximum age or the maximum size of their category, an empty or 0 limit means unlimited (default to jobs:720h:100MB,crashes:720h:0,recordings:2160h:0,snapshots:168h:0)").Envar(EnvKeyRetentionPolicies).String()
+	fRetentionInterval     = kingpin.Flag("retention-interval", EnvKeyRetentionInterval+" interval between two applications of the retention policies, they can also be applied on demand through the agent API (default to 1h)").Envar(EnvKeyRetentionInterval).Default(agent.DefaultRetentionInterval).Duration()
+	fAnomalyDetection      = kingpin.Flag("anomaly-detection", EnvKeyAnomalyDetection+" enable the alerts on the unusual accesses to the agent API: bursts of failed authentications, replayed webhooks, and requests from new source addresses or to unusual endpoints once the learning period is over. The alerts are logged, published on the event bus, sent to the alert webhook and reported in the diagnostics of the snapshots").Envar(EnvKeyAnomalyDetection).Default("false").Bool()
+	fAnomalyFailedAuth     = kingpin.Flag("anomaly-failed-auth-threshold", EnvKeyAnomalyFailedAuth+" number of failed authentications from a source address within a minute raising an alert (default to 10)").Envar(EnvKeyAnomalyFailedAuth).Default(agent.DefaultAnomalyFailedAuthThreshold).Int()
+	fAnomalyLearning       = kingpin.Flag("anomaly-learning-period", EnvKeyAnomalyLearning+" period, from the first start of the agent, during which the source addresses and the endpoints of the agent API are learned without raising alerts (default to 24h)").Envar(EnvKeyAnomalyLearning).Default(agent.DefaultAnomalyLearningPeriod).Duration()
+	fAlertWebhookURL       = kingpin.Flag("alert-webhook-url", EnvKeyAlertWebhookURL+" URL the alerts of the agent are sent to with a POST request, signed with the webhook secret when it is set").Envar(EnvKeyAlertWebhookURL).String()
+	fAlertNotifiers        = kingpin.Flag("alert-notifiers", EnvKeyAlertNotifiers+" comma-separated list of the channels the critical alerts of the agent (anomalies, scripting hooks, bandwidth cap, host actions, OS updates, thermal conditions) are sent to directly, even when the Portainer server is unreachable: smtp://[user:password@]host[:port]?from=<address>&to=<address> (smtps:// for implicit TLS), slack+https://<Slack webhook>, teams+https://<Teams webhook> and mqtt://[user:password@]host[:port]/<topic> (mqtts:// for TLS). Disabled when not set").Envar(EnvKeyAlertNotifiers).String()
+	fAlertNotifyInterval   = kingpin.Flag("alert-notify-interval", EnvKeyAlertNotifyInterval+" interval between two checks of the diagnostics of the host raising the alerts sent to the notification channels (default to 1m)").Envar(EnvKeyAlertNotifyInterval).Default(agent.DefaultAlertNotifyInterval).Duration()
+	fShutdownSignals       = kingpin.Flag("shutdown-signals", EnvKeyShutdownSignals+" comma-separated list of the signals on which the agent stops the containers of the Edge stacks in dependency order before the host powers off, e.g. PWR sent by the shutdown command of the UPS daemon with docker kill --signal PWR, or TERM when the agent is only stopped with the host. Disabled when not set").Envar(EnvKeyShutdownSignals).String()
+	fShutdownStopTimeout   = kingpin.Flag("shutdown-stop-timeout", EnvKeyShutdownStopTimeout+" maximum duration of the stop of a container of the Edge stacks on shutdown, after which it is killed (default to 30s)").Envar(EnvKeyShutdownStopTimeout).Default(agent.DefaultShutdownStopTimeout).Duration()
+	fShutdownTimeout       = kingpin.Flag("shutdown-timeout", EnvKeyShutdownTimeout+" maximum duration of the stop of the Edge stacks on shutdown, the containers that are not stopped are left to the host (default to 2m)").Envar(EnvKeyShutdownTimeout).Default(agent.DefaultShutdownTimeout).Duration()
+	fPowerUPS              = kingpin.Flag("power-ups", EnvKeyPowerUPS+" URL of the daemon of the UPS of the host, whose state and power events are reported in the snapshots: nut://[user:password@]host[:port]/<ups> for Network UPS Tools or apcupsd://host[:port] for apcupsd. Disabled when not set").Envar(EnvKeyPowerUPS).String()
+	fPowerCheckInterval    = kingpin.Flag("power-check-interval", EnvKeyPowerCheckInterval+" interval between two checks of the status of the UPS (default to 10s)").Envar(EnvKeyPowerCheckInterval).Default(agent.DefaultPowerCheckInterval).Duration()
+	fPowerShedding         = kingpin.Flag("power-shedding", EnvKeyPowerShedding+" enable this option to stop the stacks with a container labelled with io.portainer.agent.power-priority=low while the host runs on battery, they are started again when the power returns. Disabled by default").Envar(EnvKeyPowerShedding).Default("false").Bool()
+	fPowerShedDelay        = kingpin.Flag("power-shed-delay", EnvKeyPowerShedDelay+" duration on battery after which the low-priority stacks are stopped, they are stopped immediately when the battery is low (default to 1m)").Envar(EnvKeyPowerShedDelay).Default(agent.DefaultPowerShedDelay).Duration()
+	fNetworkPolicy         = kingpin.Flag("network-policy", EnvKeyNetworkPolicy+" enable this option to enforce with the iptables rules of the host the ingress and egress rules declared in the io.portainer.agent.netpolicy.ingress and io.portainer.agent.netpolicy.egress labels of the containers, e.g. \"allow 10.0.0.0/8 tcp/80, deny\", and the network policies pushed by the server when the network_policy operation is allowed. Only supported on standalone Docker hosts. Disabled by default").Envar(EnvKeyNetworkPolicy).Default("false").Bool()
+	fNetworkPolicyInterval = kingpin.Flag("network-policy-interval", EnvKeyNetworkPolicyInterval+" interval between two checks of the containers whose network policies are applied (default to 30s)").Envar(EnvKeyNetworkPolicyInterval).Default(agent.DefaultNetworkPolicyInterval).Duration()
+	fPortForwardNetworks   = kingpin.Flag("port-forward-networks", EnvKeyPortForwardNetworks+" comma separated list of the CIDR ranges of the devices the port-forwards can target when the port_forward operation is allowed, e.g. the web interface of a PLC or the administration page of a printer (default to the private and link-local networks)").Envar(EnvKeyPortForwardNetworks).Default(agent.DefaultPortForwardNetworks).String()
+	fPortForwardMaxSess    = kingpin.Flag("port-forward-max-sessions", EnvKeyPortForwardMaxSess+" maximum number of concurrent port-forward sessions (default to 4)").Envar(EnvKeyPortForwardMaxSess).Default(agent.DefaultPortForwardMaxSessions).Int()
+	fPortForwardMaxDur     = kingpin.Flag("port-forward-max-duration", EnvKeyPortForwardMaxDur+" maximum duration of a port-forward session, its connections are closed once it expires (default to 1h)").Envar(EnvKeyPortForwardMaxDur).Default(agent.DefaultPortForwardMaxDuration).Duration()
+	fTPM                   = kingpin.Flag("tpm", EnvKeyTPM+" storage of the private keys of the agent (identity, payload key pair) and of the Edge key in the TPM 2.0 of the host, so that they cannot be used by copying the data folder: auto uses the TPM when the host has one, required prevents the agent from starting without a TPM, off stores them in files. The TPM device must be mapped in the agent container (default to auto)").Envar(EnvKeyTPM).Default(agent.TPMAuto).Enum(agent.TPMAuto, agent.TPMRequired, agent.TPMOff)
+	fTPMDevice             = kingpin.Flag("tpm-device", EnvKeyTPMDevice+" path of the TPM device (defaults to /dev/tpmrm0, then /dev/tpm0)").Envar(EnvKeyTPMDevice).String()
+	fStateEncryption       = kingpin.Flag("state-encryption", EnvKeyStateEncryption+" encrypt the persistent state of the agent (Edge key, queued Edge commands and results, Edge stack histories) with a key sealed by the TPM, or derived from the state secret when the host has no TPM, so that the storage of a stolen device does not leak the server credentials and the workload data. Without TPM, the state secret must be provided from outside the storage of the device (e.g. mounted from a secret store), the machine identifier it defaults to is stored on the same disk as the state which is then only obfuscated").Envar(EnvKeyStateEncryption).Default("false").Bool()
+	fStateSecret           = sensitive(kingpin.Flag("state-secret", EnvKeyStateSecret+" secret the key encrypting the state is derived from when the host has no TPM, it must not be stored on the device. Defaults to the machine identifier of the host, read from /etc/machine-id, which only obfuscates the state as it is stored on the same disk").Envar(EnvKeyStateSecret)).String()
+	fDockerBroker          = kingpin.Flag("docker-broker", EnvKeyDockerBroker+" path of the unix socket of the Docker broker, e.g. /run/portainer/docker-broker.sock, shared with the broker container. The agent talks to the Docker daemon through the broker and runs without the Docker socket. The broker only allows the endpoints of the Docker API used by the agent and denies the containers and the services mounting the Docker socket, such as the image scans").Envar(EnvKeyDockerBroker).String()
+	fBrokerMode            = kingpin.Flag("broker", EnvKeyBrokerMode+" run the Docker broker listening on the socket set with "+EnvKeyDockerBroker+" instead of the agent, it is the only process with access to the Docker socket").Envar(EnvKeyBrokerMode).Default("false").Bool()
+	fBrokerUID             = kingpin.Flag("broker-uid", EnvKeyBrokerUID+" user owning the socket of the Docker broker, the user the agent runs as, so that only the agent can use the broker (default to -1, every user)").Envar(EnvKeyBrokerUID).Default("-1").Int()
+	fWASMPluginsPath       = kingpin.Flag("wasm-plugins-path", EnvKeyWASMPluginsPath+" folder containing the WebAssembly plugins (*.wasm) adding collectors to the snapshots, transforming the snapshots before they are sent or handling additional Edge async commands. The plugins are WASI modules run in a sandbox, without access to the filesystem, the network or the environment of the agent, and with at most 64MB of memory. Disabled by default").Envar(EnvKeyWASMPluginsPath).String()
+	fWASMPluginTimeout     = kingpin.Flag("wasm-plugin-timeout", EnvKeyWASMPluginTimeout+" maximum duration of a call to a WebAssembly plugin, the plugin is interrupted once it is exceeded (default to 10s)").Envar(EnvKeyWASMPluginTimeout).Default(agent.DefaultWASMPluginTimeout).Duration()
+	fImageCacheAddr        = kingpin.Flag("image-cache-addr", EnvKeyImageCacheAddr+" address (in the [IP]:PORT format) of the listener serving the image layers cached by the agent to the other hosts of the site, e.g. :5000. The listener is a read-only registry mirror of the upstream registry: the Docker daemons of the site use it with \"registry-mirrors\": [\"http://<agent host>:5000\"] in their daemon.json, including the daemon of the host of the agent so that its own pulls fill the cache. The listener is not authenticated and only serves the public repositories. Disabled when not set").Envar(EnvKeyImageCacheAddr).String()
+	fImageCacheUpstream    = kingpin.Flag("image-cache-upstream", EnvKeyImageCacheUpstream+" URL of the registry mirrored by the image cache (default to https://registry-1.docker.io)").Envar(EnvKeyImageCacheUpstream).Default(agent.DefaultImageCacheUpstream).String()
+	fImageCacheMaxSize     = kingpin.Flag("image-cache-max-size", EnvKeyImageCacheMaxSize+" maximum total size of the layers stored by the image cache in the data folder (e.g. 50GB), the least recently served layers are removed once exceeded (default to 20GB)").Envar(EnvKeyImageCacheMaxSize).Default(agent.DefaultImageCacheMaxSize).String()
+	fRelayAddr             = kingpin.Flag("relay-addr", EnvKeyRelayAddr+" address (in the [IP]:PORT format) of the listener relaying the Edge requests of the agents of the local network that have no route to the Portainer server, e.g. :9003. The relay is served over HTTPS with the mTLS certificate of the agent, requiring the certificate of the peers when the CA certificate is set, or with a self-signed certificate otherwise. The relayed agents list the URL of the relay (e.g. https://<agent host>:9003) in "+EnvKeyEdgeServerURLs+" and share the relay secret of the site, their requests are forwarded through the connection of this agent to the Portainer server, itself possibly through another relay. The reverse tunnel is not relayed, the relayed agents should use the Edge Async mode. Requires the Edge mode and "+EnvKeyRelaySecret+". Disabled when not set").Envar(EnvKeyRelayAddr).String()
+	fRelaySecret           = sensitive(kingpin.Flag("relay-secret", EnvKeyRelaySecret+" secret shared by the agents of the site, every Edge request is signed with it so that the relays only forward the requests of the agents of the site. The requests traversing a relay twice or more than 4 relays are rejected").Envar(EnvKeyRelaySecret)).String()
+	fSnapshotHistory       = kingpin.Flag("snapshot-history-interval", EnvKeySnapshotHistory+" interval at which a snapshot of the Docker environment is stored in the data folder (e.g. 1h), the stored snapshots are compared with each other, with the current snapshot or with the anonymized snapshot of another environment through the agent API under /snapshots, e.g. to find what changed before an outage. The stored snapshots are removed by the snapshots retention policy. Disabled when not set").Envar(EnvKeySnapshotHistory).Duration()
+	fHooksPath             = kingpin.Flag("hooks-path", EnvKeyHooksPath+" folder containing the scripting hooks (*.star), Starlark scripts defining on_docker_event(event) and/or on_snapshot(snapshot) to react to the Docker events and to the snapshots, e.g. to restart the containers matching a pattern. The hooks can restart, start and stop the containers and raise alerts, they have no access to the filesystem or the network. The hooks can also be pushed by the Portainer server when the script_hooks operation is allowed").Envar(EnvKeyHooksPath).String()
+	fHooksInterval         = kingpin.Flag("hooks-snapshot-interval", EnvKeyHooksInterval+" interval between two snapshots passed to the scripting hooks (default to 1m)").Envar(EnvKeyHooksInterval).Default(agent.DefaultHooksSnapshotInterval).Duration()
+	fPrivilegeCheck        = kingpin.Flag("privilege-check", EnvKeyPrivilegeCheck+" check of the privileges of the agent at startup: warn logs the capabilities of the agent container that are not granted by default to the Docker containers, enforce prevents the agent from starting with them, off disables the check. Unless off, the agent and the processes it executes are prevented from gaining privileges (no_new_privs). The privilege posture of the agent is reported in the snapshots (default to warn)").Envar(EnvKeyPrivilegeCheck).Default(agent.PrivilegeCheckWarn).Enum(agent.PrivilegeCheckWarn, agent.PrivilegeCheckEnforce, agent.PrivilegeCheckOff)
+	fWriteSecProfiles      = kingpin.Flag("write-security-profiles", "write the seccomp and the AppArmor profiles of the agent container inside the specified folder and exit. Run the agent with --security-opt seccomp=<folder>/portainer-agent-seccomp.json, and with --security-opt apparmor=portainer-agent once the AppArmor profile is loaded with apparmor_parser").String()
+	fBrowseArchiveMaxSize  = kingpin.Flag("browse-archive-max-size", EnvKeyBrowseArchiveMaxSize+" maximum size of the directories downloaded and of the archives uploaded as tar.gz archives through the browse API (default to 1GB)").Envar(EnvKeyBrowseArchiveMaxSize).Default(agent.DefaultBrowseArchiveMaxSize).String()
+	fIdempotencyWindow     = kingpin.Flag("idempotency-window", EnvKeyIdempotencyWindow+" duration during which the response of a mutating request sent with an Idempotency-Key header is replayed to the requests sent again with the same key, instead of executing them again (default to 1h, 0 to disable)").Envar(EnvKeyIdempotencyWindow).Default(agent.DefaultIdempotencyWindow).Duration()
+	fClockSkewTolerance    = kingpin.Flag("clock-skew-tolerance", EnvKeyClockSkewTolerance+" maximum difference tolerated between the timestamp of a webhook request and the clock of the agent, and between the timestamp of an Edge async command and the clock of the Portainer server estimated from its responses (default to 5m)").Envar(EnvKeyClockSkewTolerance).Default(agent.DefaultClockSkewTolerance).Duration()
+	fEdgeStackAutoRollback = kingpin.Flag("edge-stack-auto-rollback", EnvKeyEdgeStackAutoRollback+" enable this option to redeploy the last version of an Edge stack known to be running when the deployment of a new version fails, the rollback is reported to the Portainer server. Disabled by default").Envar(EnvKeyEdgeStackAutoRollback).Bool()
+	fEdgeStackHistorySize  = kingpin.Flag("edge-stack-history-size", EnvKeyEdgeStackHistorySize+" number of deployed versions of each Edge stack kept in the data folder, the last version known to be running is always kept (default to 5, 0 to disable)").Envar(EnvKeyEdgeStackHistorySize).Default(agent.DefaultEdgeStackHistorySize).Int()
+	fEdgeStackPreflight    = kingpin.Flag("edge-stack-preflight", EnvKeyEdgeStackPreflight+" enable this option to check that the ports of an Edge stack are free, that its bind mounted paths exist, that its images can be pulled for the platform of the host and that the host has enough memory and disk before deploying it. The deployment is refused and the failed checks are sent to the Portainer server when a check fails. Disabled by default").Envar(EnvKeyEdgeStackPreflight).Bool()
+	fHASocket              = kingpin.Flag("ha-socket", EnvKeyHASocket+" path of the local socket shared by two agent instances running on the same host with the same data folder. The instance started second stays passive while the first answers the heartbeats on the socket, and takes over the listener, the tunnel and the Edge identity when the first stops answering. Disabled by default").Envar(EnvKeyHASocket).String()
+	fWebhookSecret         = sensitive(kingpin.Flag("webhook-secret", EnvKeyWebhookSecret+" secret used to verify the HMAC signature of webhook requests. Webhooks are disabled when not set").Envar(EnvKeyWebhookSecret)).String()
+	fRegistryWebhookToken  = sensitive(kingpin.Flag("registry-webhook-token", EnvKeyRegistryWebhookToken+" token expected from registry webhook requests, as a bearer token or in the token query parameter. Registry webhooks are disabled when not set").Envar(EnvKeyRegistryWebhookToken)).String()
+	fRegistryAutoUpdate    = kingpin.Flag("registry-auto-update", EnvKeyRegistryAutoUpdate+" enable this option to redeploy the containers and services using an image when a registry webhook reports a push of this image. Disabled by default").Envar(EnvKeyRegistryAutoUpdate).Bool()
 
 	// Edge mode
 	fEdgeMode              = kingpin.Flag("edge", EnvKeyEdge+" enable Edge mode. Disabled by default, set to 1 or true to enable it").Envar(EnvKeyEdge).Bool()
 	fEdgeAsyncMode         = kingpin.Flag("edge-async", EnvKeyEdge+" enable Edge Async mode. Disabled by default, set to 1 or true to enable it").Envar(EnvKeyEdgeAsync).Bool()
-	fEdgeKey               = kingpin.Flag("edge-key", EnvKeyEdgeKey+" specify an Edge key to use at startup").Envar(EnvKeyEdgeKey).String()
+	fEdgePayloadServerKey  = kingpin.Flag("edge-payload-server-key", EnvKeyEdgePayloadServerKey+" base64 encoded NaCl box public key of the Portainer server. When set, the requests of the Edge Async mode are encrypted with the key pair of the device and the responses of the server must be encrypted with its public key, so that the snapshots and the commands stay confidential through TLS-terminating proxies. Disabled when not set").Envar(EnvKeyEdgePayloadServerKey).String()
+	fEdgeSnapshotDelta     = kingpin.Flag("edge-snapshot-delta", EnvKeyEdgeSnapshotDelta+" enable this option to send the Docker snapshots of the Edge Async mode as the containers, images, volumes and networks added, changed or removed since the last snapshot acknowledged by the server, the dependency graph, container stats, log audit and GPU inventory are omitted when unchanged. A full snapshot is sent when the server does not have the base snapshot or requests a full resync. Disabled by default").Envar(EnvKeyEdgeSnapshotDelta).Bool()
+	fEdgePayloadFormat     = kingpin.Flag("edge-payload-format", EnvKeyEdgePayloadFormat+" format of the snapshots and commands of the Edge Async mode, json, msgpack or cbor. The binary formats are requested from the server and used for the requests once the server answered with them, JSON is used with the servers that do not support them (default to json)").Envar(EnvKeyEdgePayloadFormat).Default(codec.JSON).Enum(codec.JSON, codec.MessagePack, codec.CBOR)
+	fEdgeOfflineQueue      = kingpin.Flag("edge-offline-queue", EnvKeyEdgeOfflineQueue+" enable this option to persist the commands of the Edge Async mode in a queue inside the data folder before executing them in order, the stack, job and configuration commands that fail are attempted again with a growing delay. The statuses and results waiting to be sent to the server are persisted as well while it cannot be reached. Disabled by default").Envar(EnvKeyEdgeOfflineQueue).Bool()
+	fEdgeKey               = sensitive(kingpin.Flag("edge-key", EnvKeyEdgeKey+" specify an Edge key to use at startup").Envar(EnvKeyEdgeKey)).String()
 	fEdgeID                = kingpin.Flag("edge-id", EnvKeyEdgeID+" a unique identifier associated to this agent cluster").Envar(EnvKeyEdgeID).String()
 	fEdgeServerAddr        = kingpin.Flag("edge-host", EnvKeyEdgeServerHost+" address on which the Edge UI will be exposed (default to 0.0.0.0)").Envar(EnvKeyEdgeServerHost).Default(agent.DefaultEdgeServerAddr).IP()
 	fEdgeServerPort        = kingpin.Flag("edge-port", EnvKeyEdgeServerPort+" port on which the Edge UI will be exposed (default to 80)").Envar(EnvKeyEdgeServerPort).Default(agent.DefaultEdgeServerPort).Int()
+	fEdgeEnrollment        = kingpin.Flag("edge-enrollment", EnvKeyEdgeEnrollment+" enable this option to enroll the agent with a one-time enrollment code instead of an Edge key. When no Edge key is associated to the agent, the Edge UI asks for the URL of the Portainer instance and the enrollment code, exchanges it for the Edge key and shuts down").Envar(EnvKeyEdgeEnrollment).Default("false").Bool()
+	fEdgeEnrollURL         = kingpin.Flag("edge-enroll-url", EnvKeyEdgeEnrollURL+" URL of the Portainer instance the one-time enrollment code is exchanged with, or the device is claimed with").Envar(EnvKeyEdgeEnrollURL).String()
+	fEdgeEnrollCode        = sensitive(kingpin.Flag("edge-enroll-code", EnvKeyEdgeEnrollCode+" one-time enrollment code exchanged on start for the Edge key of the agent when no Edge key is associated to it. Requires the enrollment URL").Envar(EnvKeyEdgeEnrollCode)).String()
+	fEdgeClaim             = kingpin.Flag("edge-claim", EnvKeyEdgeClaim+" enable this option to claim the device from Portainer when no Edge key is associated to the agent. The agent registers a claim code with the Portainer instance at the enrollment URL, displays it in the logs and in the Edge UI, and obtains its Edge key once a user enters the code in Portainer. Requires the enrollment URL").Envar(EnvKeyEdgeClaim).Default("false").Bool()
+	fProvisioningSources   = kingpin.Flag("provisioning-sources", EnvKeyProvisioningSources+" comma separated list of the sources the enrollment configuration (URL of the Portainer instance, enrollment code, Edge key, Edge ID or claim) is discovered from on the first boot, by priority: userdata for the portainer_agent key of the cloud-init user-data, dmi for the io.portainer.agent.* SMBIOS OEM strings, dhcp for the provisioning URL provided by the DHCP option 224, url for the provisioning URL. Disabled by default").Envar(EnvKeyProvisioningSources).String()
+	fProvisioningURL       = kingpin.Flag("provisioning-url", EnvKeyProvisioningURL+" URL of the enrollment configuration, in YAML or JSON, read by the url provisioning source").Envar(EnvKeyProvisioningURL).String()
 	fEdgeInactivityTimeout = kingpin.Flag("edge-inactivity", EnvKeyEdgeInactivityTimeout+" timeout used by the agent to close the reverse tunnel after inactivity (default to 5m)").Envar(EnvKeyEdgeInactivityTimeout).Default(agent.DefaultEdgeSleepInterval).String()
 	fEdgeInsecurePoll      = kingpin.Flag("edge-insecurepoll", EnvKeyEdgeInsecurePoll+" enable this option if you need the agent to poll a HTTPS Portainer instance with self-signed certificates. Disabled by default, set to 1 to enable it").Envar(EnvKeyEdgeInsecurePoll).Bool()
+	fEdgeHTTP2             = kingpin.Flag("edge-http2", EnvKeyEdgeHTTP2+" disable this option to communicate with the Portainer instance over HTTP/1.1 only, HTTP/2 is used when the instance or the proxies in front of it support it").Envar(EnvKeyEdgeHTTP2).Default("true").Bool()
+	fEdgeMaxIdleConns      = kingpin.Flag("edge-max-idle-conns", EnvKeyEdgeMaxIdleConns+" maximum number of idle connections to the Portainer instance kept open to be reused by the next requests, avoiding a TLS handshake for each poll (default to 10)").Envar(EnvKeyEdgeMaxIdleConns).Default(agent.DefaultEdgeMaxIdleConns).Int()
+	fEdgeIdleConnTimeout   = kingpin.Flag("edge-idle-conn-timeout", EnvKeyEdgeIdleConnTimeout+" duration after which an idle connection to the Portainer instance is closed, it should be longer than the poll interval for the connections to be reused (default to 90s)").Envar(EnvKeyEdgeIdleConnTimeout).Default(agent.DefaultEdgeIdleConnTimeout).Duration()
+	fEdgePollTransport     = kingpin.Flag("edge-poll-transport", EnvKeyEdgePollTransport+" transport of the polls and the snapshots sent to the Portainer instance: tcp, or the experimental quic which sends them over HTTP/3 and recovers better from the packet loss of cellular and satellite links, the requests are sent over TCP while the instance cannot be reached over UDP (default to tcp)").Envar(EnvKeyEdgePollTransport).Default(agent.EdgePollTransportTCP).Enum(agent.EdgePollTransportTCP, agent.EdgePollTransportQUIC)
+	fEdgeServerURLs        = kingpin.Flag("edge-server-urls", EnvKeyEdgeServerURLs+" comma separated list of the URLs of the Portainer instance by priority, e.g. the primary instance, its disaster recovery instance and the primary instance through a VPN. The requests are sent to the first available URL, an URL that fails is attempted again after a growing delay and the URL of the Edge key is attempted last when it is not listed. Disabled when not set").Envar(EnvKeyEdgeServerURLs).String()
+	fEdgeServerAddrRules   = kingpin.Flag("edge-server-address-rules", EnvKeyEdgeServerAddrRules+" comma separated list of rules mapping the host of the Portainer instance to another address depending on the network the host is connected to, formatted as host@network=address where network is a CIDR range the host has a route to or the interface of the default route (e.g. portainer.example.com@10.20.0.0/16=10.20.1.5,portainer.example.com@wwan0=203.0.113.10). The rules are evaluated in order when the agent connects to the instance or opens the tunnel. Disabled when not set").Envar(EnvKeyEdgeServerAddrRules).String()
 	fEdgeTunnel            = kingpin.Flag("edge-tunnel", EnvKeyEdgeTunnel+" disable this option if you wish to prevent the agent from opening tunnels over websockets").Envar(EnvKeyEdgeTunnel).Default("true").Bool()
+	fEdgeTunnelGracePeriod = kingpin.Flag("edge-tunnel-grace-period", EnvKeyEdgeTunnelGracePeriod+" duration during which an idle tunnel is kept open after its last activity when Portainer does not require it anymore, tunnels with open sessions are never closed (default to 1m)").Envar(EnvKeyEdgeTunnelGracePeriod).Default(agent.DefaultEdgeTunnelGracePeriod).String()
+	fEdgeTunnelTransport   = kingpin.Flag("edge-tunnel-transport", EnvKeyEdgeTunnelTransport+" transport of the reverse tunnel: chisel connects directly to the tunnel server, websocket goes through the proxy set with HTTPS_PROXY or HTTP_PROXY, sends keepalives and reconnects automatically, for the networks where the proxies cut the long-lived websockets (default to chisel)").Envar(EnvKeyEdgeTunnelTransport).Default(agent.EdgeTunnelTransportChisel).Enum(agent.EdgeTunnelTransportChisel, agent.EdgeTunnelTransportWebSocket)
+	fEdgeOIDCTokenURL      = kingpin.Flag("edge-oidc-token-url", EnvKeyEdgeOIDCTokenURL+" token endpoint of the identity provider, when set the agent authenticates its requests to Portainer with an access token obtained with the OAuth2 client credentials grant and refreshed automatically").Envar(EnvKeyEdgeOIDCTokenURL).String()
+	fEdgeOIDCClientID      = kingpin.Flag("edge-oidc-client-id", EnvKeyEdgeOIDCClientID+" client identifier of the agent at the identity provider").Envar(EnvKeyEdgeOIDCClientID).String()
+	fEdgeOIDCClientSecret  = sensitive(kingpin.Flag("edge-oidc-client-secret", EnvKeyEdgeOIDCClientSecret+" client secret of the agent at the identity provider").Envar(EnvKeyEdgeOIDCClientSecret)).String()
+	fEdgeOIDCScopes        = kingpin.Flag("edge-oidc-scopes", EnvKeyEdgeOIDCScopes+" comma separated list of the scopes requested with the access token").Envar(EnvKeyEdgeOIDCScopes).String()
+	fEdgeOIDCAudience      = kingpin.Flag("edge-oidc-audience", EnvKeyEdgeOIDCAudience+" audience requested for the access token, required by some identity providers").Envar(EnvKeyEdgeOIDCAudience).String()
 	fEdgeGroupsIDs         = kingpin.Flag("edge-groups", EnvKeyEdgeGroups+" a colon-separated list of Edge groups identifiers. Used for AEEC, the created environment will be added to these edge groups").Envar(EnvKeyEdgeGroups).String()
 	fEnvironmentGroupID    = kingpin.Flag("environment-group", EnvKeyEnvironmentGroup+" an Environment group identifier. Used for AEEC, the created environment will be associated to this group").Envar(EnvKeyEnvironmentGroup).Int()
 	fTagsIDs               = kingpin.Flag("tags", EnvKeyTags+" a colon-separated list of tags to associate to the environment. Used for AEEC.").Envar(EnvKeyTags).String()
+	fDeployExtraHosts      = kingpin.Flag("deploy-extra-hosts", EnvKeyDeployExtraHosts+" a comma-separated list of host:ip entries added to the extra hosts of the services of the deployed Edge stacks").Envar(EnvKeyDeployExtraHosts).String()
+	fDeployDNS             = kingpin.Flag("deploy-dns", EnvKeyDeployDNS+" a comma-separated list of DNS servers used by the services of the deployed Edge stacks that do not define their own").Envar(EnvKeyDeployDNS).String()
+	fQuotaMaxContainers    = kingpin.Flag("quota-max-containers", EnvKeyQuotaMaxContainers+" maximum number of containers on the host, Edge stacks exceeding it are not deployed (0 for unlimited)").Envar(EnvKeyQuotaMaxContainers).Int()
+	fQuotaMaxVolumes       = kingpin.Flag("quota-max-volumes", EnvKeyQuotaMaxVolumes+" maximum number of volumes on the host, Edge stacks exceeding it are not deployed (0 for unlimited)").Envar(EnvKeyQuotaMaxVolumes).Int()
+	fQuotaMaxMemory        = kingpin.Flag("quota-max-memory", EnvKeyQuotaMaxMemory+" maximum total memory reservation of the containers on the host (e.g. 2g), Edge stacks exceeding it are not deployed (unlimited by default)").Envar(EnvKeyQuotaMaxMemory).String()
+	fQuotaMaxCPUs          = kingpin.Flag("quota-max-cpus", EnvKeyQuotaMaxCPUs+" maximum total CPU reservation of the containers on the host (e.g. 1.5), Edge stacks exceeding it are not deployed (0 for unlimited)").Envar(EnvKeyQuotaMaxCPUs).Float64()
 
 	// mTLS edge agent certs
 	fSSLCert           = kingpin.Flag("mtlscert", "Path to the mTLS certificate used to identify the agent to Portainer").Envar(EnvKeySSLCert).String()
 	fSSLKey            = kingpin.Flag("mtlskey", "Path to the mTLS key used to identify the agent to Portainer").Envar(EnvKeySSLKey).String()
 	fSSLCACert         = kingpin.Flag("mtlscacert", "Path to the mTLS CA certificate used to validate the Portainer server").Envar(EnvKeySSLCACert).String()
 	fCertRetryInterval = kingpin.Flag("certificate-retry-interval", "Interval used to block initialization until the certificate is available").Envar(EnvKeyCertRetryInterval).Duration()
+	fMTLSEnrollURL     = kingpin.Flag("mtls-enroll-url", "URL of the Portainer endpoint signing the certificate signing requests of the agents. When set, the agent generates its mTLS key, obtains its certificate from the server and renews it before it expires. Requires the mTLS CA certificate, the certificate and the key are stored in the data folder unless their paths are set").Envar(EnvKeyMTLSEnrollURL).String()
+	fMTLSEnrollToken   = sensitive(kingpin.Flag("mtls-enroll-token", "Token authenticating the first certificate signing request of the agent, the renewals are authenticated with the current certificate").Envar(EnvKeyMTLSEnrollToken)).String()
 
 	// AWS IAM Roles Anywhere + ECR
 	fAWSClientCert     = kingpin.Flag("aws-cert", "Path to the x509 certificate used to authenticate against IAM Roles Anywhere").Envar(EnvKeyAWSClientCert).Default(agent.DefaultAWSClientCertPath).String()
@@ -98,6 +408,11 @@ var (
 	fAWSTrustAnchorARN = kingpin.Flag("aws-trust-anchor-arn", "AWS IAM Trust anchor used for authentication against IAM Roles Anyhwere").Envar(EnvKeyAWSTrustAnchorARN).String()
 	fAWSProfileARN     = kingpin.Flag("aws-profile-arn", "AWS profile ARN used to pull policies from (IAM Roles Anywhere authentication)").Envar(EnvKeyAWSProfileARN).String()
 	fAWSRegion         = kingpin.Flag("aws-region", "AWS region used when signing against IAM Roles Anyhwere").Envar(EnvKeyAWSRegion).String()
+
+	// Docker credential helpers
+	fCredentialHelpers    = kingpin.Flag("registry-credential-helpers", "Comma-separated list of registry=helper entries, the credentials of the registry are requested from the docker-credential-<helper> executable (e.g. 123456789012.dkr.ecr.us-east-1.amazonaws.com=ecr-login,gcr.io=gcr). The * registry sets the helper of the other registries. Used by the Edge stack deployments and the image pulls of the agent").Envar(EnvKeyCredentialHelpers).String()
+	fCredentialHelpersTTL = kingpin.Flag("registry-credentials-ttl", "Duration during which the credentials returned by a credential helper are cached before being requested again (default to 10m)").Envar(EnvKeyCredentialHelpersTTL).Default(agent.DefaultCredentialHelpersTTL).Duration()
+	fGitCredentialHelpers = kingpin.Flag("git-credential-helpers", "Comma-separated list of host=helper entries, the credentials of the Git repositories of the host are requested from the docker-credential-<helper> executable with the https://<host> server URL (e.g. github.com=github). The * host sets the helper of the other hosts. Used by the image builds from a Git repository, the credentials are cached for the registry credentials TTL").Envar(EnvKeyGitCredentialHelpers).String()
 )
 
 func init() {
@@ -106,8 +421,94 @@ func init() {
 	kingpin.Flag("sslcacert", "(DEPRECATED) Path to the mTLS CA certificate used to validate the Portainer server").Envar(EnvKeySSLCACert).StringVar(fSSLCACert)
 }
 
+// ExposedSecrets returns the environment variables of the secret options provided through an environment variable
+// or a flag instead of a secret file, their value can be read by anyone able to inspect the container of the agent
+func (parser *EnvOptionParser) ExposedSecrets() []string {
+	return parser.exposedSecrets
+}
+
 func (parser *EnvOptionParser) Options() (*agent.Options, error) {
+	flags := kingpin.CommandLine.Model().Flags
+
+	discoverSecretFiles()
+
+	loadedFromFiles, err := loadFileEnvVars(flags)
+	if err != nil {
+		return nil, err
+	}
+
 	kingpin.Parse()
+
+	parser.sources = resolveSources(flags, goos.Args[1:], loadedFromFiles)
+
+	for key := range loadedFromFiles {
+		parser.secretFiles[key] = goos.Getenv(key + fileEnvSuffix)
+	}
+
+	parser.exposedSecrets = exposedSecrets(parser.sources, flagNamesByEnvKey(flags))
+
+	scrubSecretEnvVars()
+
+	if *fConfigFile != "" {
+		values, err := readConfigFile(*fConfigFile, false)
+		if err != nil {
+			return nil, errors.WithMessage(err, "failed reading configuration file")
+		}
+
+		err = applyConfigLayer(flags, parser.sources, values, SourceFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	profileName := *fProfile
+	if profileName == "" {
+		profileName, err = ActiveProfile(*fDataPath)
+		if err != nil {
+			return nil, errors.WithMessage(err, "failed reading the selected configuration profile")
+		}
+	}
+
+	// the profile commands manage the profiles, the selected profile does not need to exist
+	var profile *Profile
+	if *fImportProfile == "" && *fUseProfile == "" && !*fListProfiles {
+		profile, err = readProfileFile(*fDataPath, profileName)
+		if err != nil {
+			return nil, errors.WithMessage(err, "failed reading the imported configuration profile")
+		}
+	}
+
+	if profile != nil {
+		err = applyConfigLayer(flags, parser.sources, profile.Options, SourceProfile)
+		if err != nil {
+			return nil, err
+		}
+
+		err = applyProfileSecrets(flags, parser.sources, profile.Secrets)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	serverValues, err := readConfigFile(filepath.Join(*fDataPath, ServerConfigFileName), true)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed reading server pushed configuration")
+	}
+
+	err = applyConfigLayer(flags, parser.sources, serverValues, SourceServer)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkSecretsFromFiles(parser.sources, flagNamesByEnvKey(flags), map[string]string{
+		EnvKeySSLCert:   *fSSLCert,
+		EnvKeySSLKey:    *fSSLKey,
+		EnvKeySSLCACert: *fSSLCACert,
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	edgeGroupsIDs, err := parseListValue(fEdgeGroupsIDs)
 	if err != nil {
 		return nil, errors.WithMessage(err, "failed parsing edge group ids")
@@ -118,39 +519,486 @@ func (parser *EnvOptionParser) Options() (*agent.Options, error) {
 		return nil, errors.WithMessage(err, "failed parsing tag ids")
 	}
 
+	extraHosts, err := parseExtraHostsValue(fDeployExtraHosts)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed parsing deployment extra hosts")
+	}
+
+	credentialHelpers, err := parseCredentialHelpersValue(fCredentialHelpers)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed parsing registry credential helpers")
+	}
+
+	gitCredentialHelpers, err := parseCredentialHelpersValue(fGitCredentialHelpers)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed parsing Git credential helpers")
+	}
+
+	dnsServers, err := parseIPListValue(fDeployDNS)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed parsing deployment DNS servers")
+	}
+
+	if *fDockerProxyTimeout < 0 || *fDockerProxyRetries < 0 {
+		return nil, errors.New("the Docker proxy timeout and retries cannot be negative")
+	}
+
+	acmeDomains := parseStringListValue(fACMEDomains)
+	if len(acmeDomains) > 0 && *fACMESolver == agent.ACMESolverDNS01 && *fACMEDNSHook == "" {
+		return nil, errors.New("a DNS hook is required to use the ACME DNS-01 challenge")
+	}
+
+	if *fEdgeMaxIdleConns < 0 || *fEdgeIdleConnTimeout < 0 {
+		return nil, errors.New("the maximum number of idle connections and the idle connection timeout cannot be negative")
+	}
+
+	edgeServerURLs := parseStringListValue(fEdgeServerURLs)
+	for _, serverURL := range edgeServerURLs {
+		parsedURL, err := url.Parse(serverURL)
+		if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+			return nil, fmt.Errorf("invalid Portainer URL %q", serverURL)
+		}
+	}
+
+	if *fEdgeEnrollCode != "" || *fEdgeClaim {
+		parsedURL, err := url.Parse(*fEdgeEnrollURL)
+		if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+			return nil, fmt.Errorf("invalid enrollment URL %q", *fEdgeEnrollURL)
+		}
+	}
+
+	provisioningSources := parseStringListValue(fProvisioningSources)
+	if err := provisioning.ValidateSources(provisioningSources, *fProvisioningURL); err != nil {
+		return nil, err
+	}
+
+	if *fEdgeOIDCTokenURL != "" && (*fEdgeOIDCClientID == "" || *fEdgeOIDCClientSecret == "") {
+		return nil, errors.New("a client identifier and a client secret are required to authenticate with OIDC")
+	}
+
+	quotas := agent.DeploymentQuotas{
+		MaxContainers: *fQuotaMaxContainers,
+		MaxVolumes:    *fQuotaMaxVolumes,
+		MaxCPUs:       *fQuotaMaxCPUs,
+	}
+
+	if *fQuotaMaxMemory != "" {
+		quotas.MaxMemory, err = units.RAMInBytes(*fQuotaMaxMemory)
+		if err != nil {
+			return nil, errors.WithMessage(err, "failed parsing the memory quota")
+		}
+	}
+
+	if *fOrphanGCInterval <= 0 {
+		return nil, errors.New("the orphaned resources detection interval must be positive")
+	}
+
+	if *fSnapshotConcurrency <= 0 {
+		return nil, errors.New("the snapshot concurrency must be positive")
+	}
+
+	if *fCrashLogLines < 0 {
+		return nil, errors.New("the number of crash log lines cannot be negative")
+	}
+
+	crashArtifactsMaxSize, err := units.FromHumanSize(*fCrashMaxSize)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed parsing the maximum size of the crash artifacts")
+	}
+
+	if crashArtifactsMaxSize <= 0 {
+		return nil, errors.New("the maximum size of the crash artifacts must be positive")
+	}
+
+	auditMaxSize, err := units.FromHumanSize(*fAuditMaxSize)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed parsing the maximum size of the audit trail")
+	}
+
+	if auditMaxSize <= 0 {
+		return nil, errors.New("the maximum size of the audit trail must be positive")
+	}
+
+	retentionPolicies := parseStringListValue(fRetentionPolicies)
+	if _, err := retention.ParsePolicies(retentionPolicies); err != nil {
+		return nil, err
+	}
+
+	if *fRetentionInterval <= 0 {
+		return nil, errors.New("the retention interval must be positive")
+	}
+
+	if *fAnomalyFailedAuth <= 0 {
+		return nil, errors.New("the failed authentication threshold of the anomaly detection must be positive")
+	}
+
+	if *fAlertWebhookURL != "" {
+		parsedURL, err := url.Parse(*fAlertWebhookURL)
+		if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+			return nil, fmt.Errorf("invalid alert webhook URL %q", *fAlertWebhookURL)
+		}
+	}
+
+	if *fAlertNotifyInterval <= 0 {
+		return nil, errors.New("the alert notification interval must be positive")
+	}
+
+	if *fShutdownStopTimeout <= 0 || *fShutdownTimeout <= 0 {
+		return nil, errors.New("the shutdown timeouts must be positive")
+	}
+
+	if *fPowerCheckInterval <= 0 {
+		return nil, errors.New("the UPS check interval must be positive")
+	}
+
+	if *fPowerShedDelay < 0 {
+		return nil, errors.New("the delay before the low-priority stacks are stopped on battery cannot be negative")
+	}
+
+	if *fNetworkPolicyInterval <= 0 {
+		return nil, errors.New("the network policy interval must be positive")
+	}
+
+	portForwardNetworks := parseStringListValue(fPortForwardNetworks)
+	for _, network := range portForwardNetworks {
+		if _, _, err := net.ParseCIDR(network); err != nil {
+			return nil, errors.WithMessage(err, "invalid port forwarding network")
+		}
+	}
+
+	if *fPortForwardMaxSess <= 0 || *fPortForwardMaxDur <= 0 {
+		return nil, errors.New("the maximum number of port-forward sessions and their maximum duration must be positive")
+	}
+
+	if *fBrokerMode && *fDockerBroker == "" {
+		return nil, fmt.Errorf("the socket of the Docker broker is required in broker mode, set %s", EnvKeyDockerBroker)
+	}
+
+	if *fEventBusInterval <= 0 {
+		return nil, errors.New("the event bus snapshot interval must be positive")
+	}
+
+	if *fLogShippingBatchSize <= 0 || *fLogShippingInterval <= 0 {
+		return nil, errors.New("the log shipping batch size and flush interval must be positive")
+	}
+
+	if *fMetricsAddr != "" {
+		if _, _, err := net.SplitHostPort(*fMetricsAddr); err != nil {
+			return nil, errors.WithMessage(err, "invalid metrics address")
+		}
+	}
+
+	if *fImageCacheAddr != "" {
+		if _, _, err := net.SplitHostPort(*fImageCacheAddr); err != nil {
+			return nil, errors.WithMessage(err, "invalid image cache address")
+		}
+	}
+
+	if *fSnapshotHistory < 0 {
+		return nil, errors.New("the snapshot history interval must be positive")
+	}
+
+	if *fRelayAddr != "" {
+		if _, _, err := net.SplitHostPort(*fRelayAddr); err != nil {
+			return nil, errors.WithMessage(err, "invalid relay address")
+		}
+
+		if !*fEdgeMode || *fRelaySecret == "" {
+			return nil, errors.New("the relay requires the Edge mode and a relay secret")
+		}
+	}
+
+	imageCacheMaxSize, err := units.FromHumanSize(*fImageCacheMaxSize)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed parsing the maximum size of the image cache")
+	}
+
+	if imageCacheMaxSize <= 0 {
+		return nil, errors.New("the maximum size of the image cache must be positive")
+	}
+
+	browseArchiveMaxSize, err := units.FromHumanSize(*fBrowseArchiveMaxSize)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed parsing the maximum size of the browse archives")
+	}
+
+	if browseArchiveMaxSize <= 0 {
+		return nil, errors.New("the maximum size of the browse archives must be positive")
+	}
+
+	if *fEdgePayloadServerKey != "" && !*fEdgeAsyncMode {
+		return nil, errors.New("the encryption of the Edge payloads requires the Edge Async mode")
+	}
+
+	if *fIdempotencyWindow < 0 {
+		return nil, errors.New("the idempotency window must not be negative")
+	}
+
+	if *fClockSkewTolerance <= 0 {
+		return nil, errors.New("the clock skew tolerance must be positive")
+	}
+
+	if *fEdgeStackHistorySize < 0 {
+		return nil, errors.New("the Edge stack history size must not be negative")
+	}
+
+	if *fEdgeStackAutoRollback && *fEdgeStackHistorySize == 0 {
+		return nil, errors.New("the automatic rollback of the Edge stacks requires an Edge stack history")
+	}
+
+	if *fStackConcurrency <= 0 {
+		return nil, errors.New("the stack concurrency must be positive")
+	}
+
+	if *fStackHookTimeout <= 0 {
+		return nil, errors.New("the stack hook timeout must be positive")
+	}
+
+	if *fHealthGateWindow < 0 || *fHealthGateMinUptime < 0 {
+		return nil, errors.New("the health gate durations cannot be negative")
+	}
+
+	var bandwidthMonthlyCap int64
+	if *fBandwidthMonthlyCap != "" {
+		bandwidthMonthlyCap, err = units.FromHumanSize(*fBandwidthMonthlyCap)
+		if err != nil {
+			return nil, errors.WithMessage(err, "failed parsing the monthly bandwidth cap")
+		}
+
+		if bandwidthMonthlyCap < 0 {
+			return nil, errors.New("the monthly bandwidth cap cannot be negative")
+		}
+	}
+
+	if *fBandwidthWarning <= 0 || *fBandwidthWarning > 100 {
+		return nil, errors.New("the bandwidth warning threshold must be a percentage between 1 and 100")
+	}
+
+	var maintenanceWindows []string
+	for _, window := range strings.Split(*fMaintenanceWindows, ";") {
+		if window = strings.TrimSpace(window); window != "" {
+			maintenanceWindows = append(maintenanceWindows, window)
+		}
+	}
+
+	if _, err := maintenance.NewSchedule(maintenanceWindows); err != nil {
+		return nil, err
+	}
+
+	if *fOSUpdater != "" {
+		if _, err := osupdate.Get(*fOSUpdater); err != nil {
+			return nil, err
+		}
+	}
+
+	allowedOperations := parseStringListValue(fAllowedOperations)
+	if quotas.MaxContainers < 0 || quotas.MaxVolumes < 0 || quotas.MaxMemory < 0 || quotas.MaxCPUs < 0 {
+		return nil, errors.New("the deployment quotas cannot be negative")
+	}
+
+	sslCert, sslKey := *fSSLCert, *fSSLKey
+	if *fMTLSEnrollURL != "" {
+		if *fSSLCACert == "" {
+			return nil, errors.New("the mTLS CA certificate is required to enroll the mTLS certificate")
+		}
+
+		if sslCert == "" {
+			sslCert = filepath.Join(*fDataPath, agent.MTLSCertFileName)
+		}
+
+		if sslKey == "" {
+			sslKey = filepath.Join(*fDataPath, agent.MTLSKeyFileName)
+		}
+	}
+
+	identityFile := *fIdentityFile
+	if identityFile == "" {
+		identityFile = filepath.Join(*fDataPath, agent.IdentityFileName)
+	}
+
+	currentParserMu.Lock()
+	currentParser = parser
+	currentParserMu.Unlock()
+
 	return &agent.Options{
-		AssetsPath:            *fAssetsPath,
-		AgentServerAddr:       fAgentServerAddr.String(),
-		AgentServerPort:       strconv.Itoa(*fAgentServerPort),
-		AgentSecurityShutdown: *fAgentSecurityShutdown,
-		ClusterAddress:        *fClusterAddress,
-		ClusterProbeTimeout:   *fClusterProbeTimeout,
-		ClusterProbeInterval:  *fClusterProbeInterval,
-		DataPath:              *fDataPath,
-		EdgeMode:              *fEdgeMode,
-		EdgeAsyncMode:         *fEdgeAsyncMode,
-		EdgeKey:               *fEdgeKey,
-		EdgeID:                *fEdgeID,
-		EdgeUIServerAddr:      fEdgeServerAddr.String(),
-		EdgeUIServerPort:      strconv.Itoa(*fEdgeServerPort),
-		EdgeInactivityTimeout: *fEdgeInactivityTimeout,
-		EdgeInsecurePoll:      *fEdgeInsecurePoll,
-		EdgeTunnel:            *fEdgeTunnel,
-		HealthCheck:           *fHealthCheck,
-		LogLevel:              *fLogLevel,
-		LogMode:               *fLogMode,
-		SharedSecret:          *fSharedSecret,
-		SSLCert:               *fSSLCert,
-		SSLKey:                *fSSLKey,
-		SSLCACert:             *fSSLCACert,
-		CertRetryInterval:     *fCertRetryInterval,
-		AWSClientCert:         *fAWSClientCert,
-		AWSClientKey:          *fAWSClientKey,
-		AWSClientBundle:       *fAWSClientBundle,
-		AWSRoleARN:            *fAWSRoleARN,
-		AWSTrustAnchorARN:     *fAWSTrustAnchorARN,
-		AWSProfileARN:         *fAWSProfileARN,
-		AWSRegion:             *fAWSRegion,
+		AssetsPath:                *fAssetsPath,
+		AgentServerAddr:           fAgentServerAddr.String(),
+		AgentServerPort:           strconv.Itoa(*fAgentServerPort),
+		AgentSecurityShutdown:     *fAgentSecurityShutdown,
+		ClusterAddress:            *fClusterAddress,
+		ClusterProbeTimeout:       *fClusterProbeTimeout,
+		ClusterProbeInterval:      *fClusterProbeInterval,
+		DataPath:                  *fDataPath,
+		EdgeMode:                  *fEdgeMode,
+		EdgeAsyncMode:             *fEdgeAsyncMode,
+		EdgeSnapshotDelta:         *fEdgeSnapshotDelta,
+		EdgePayloadFormat:         *fEdgePayloadFormat,
+		EdgeOfflineQueue:          *fEdgeOfflineQueue,
+		EdgePayloadServerKey:      *fEdgePayloadServerKey,
+		EdgeKey:                   *fEdgeKey,
+		EdgeID:                    *fEdgeID,
+		EdgeUIServerAddr:          fEdgeServerAddr.String(),
+		EdgeUIServerPort:          strconv.Itoa(*fEdgeServerPort),
+		EdgeEnrollment:            *fEdgeEnrollment,
+		EdgeEnrollURL:             *fEdgeEnrollURL,
+		EdgeEnrollCode:            *fEdgeEnrollCode,
+		EdgeClaim:                 *fEdgeClaim,
+		ProvisioningSources:       provisioningSources,
+		ProvisioningURL:           *fProvisioningURL,
+		EdgeInactivityTimeout:     *fEdgeInactivityTimeout,
+		EdgeTunnelGracePeriod:     *fEdgeTunnelGracePeriod,
+		EdgeOIDCTokenURL:          *fEdgeOIDCTokenURL,
+		EdgeOIDCClientID:          *fEdgeOIDCClientID,
+		EdgeOIDCClientSecret:      *fEdgeOIDCClientSecret,
+		EdgeOIDCScopes:            parseStringListValue(fEdgeOIDCScopes),
+		EdgeOIDCAudience:          *fEdgeOIDCAudience,
+		EdgeInsecurePoll:          *fEdgeInsecurePoll,
+		EdgeHTTP2:                 *fEdgeHTTP2,
+		EdgeMaxIdleConns:          *fEdgeMaxIdleConns,
+		EdgeIdleConnTimeout:       *fEdgeIdleConnTimeout,
+		EdgePollTransport:         *fEdgePollTransport,
+		EdgeServerURLs:            edgeServerURLs,
+		EdgeServerAddressRules:    parseStringListValue(fEdgeServerAddrRules),
+		RetentionPolicies:         retentionPolicies,
+		RetentionInterval:         *fRetentionInterval,
+		AnomalyDetection:          *fAnomalyDetection,
+		AnomalyAuthThreshold:      *fAnomalyFailedAuth,
+		AnomalyLearningPeriod:     *fAnomalyLearning,
+		AlertWebhookURL:           *fAlertWebhookURL,
+		AlertNotifiers:            parseStringListValue(fAlertNotifiers),
+		AlertNotifyInterval:       *fAlertNotifyInterval,
+		ShutdownSignals:           parseStringListValue(fShutdownSignals),
+		ShutdownStopTimeout:       *fShutdownStopTimeout,
+		ShutdownTimeout:           *fShutdownTimeout,
+		PowerUPS:                  *fPowerUPS,
+		PowerCheckInterval:        *fPowerCheckInterval,
+		PowerShedding:             *fPowerShedding,
+		PowerShedDelay:            *fPowerShedDelay,
+		NetworkPolicy:             *fNetworkPolicy,
+		NetworkPolicyInterval:     *fNetworkPolicyInterval,
+		PortForwardNetworks:       portForwardNetworks,
+		PortForwardMaxSessions:    *fPortForwardMaxSess,
+		PortForwardMaxDuration:    *fPortForwardMaxDur,
+		TPM:                       *fTPM,
+		TPMDevice:                 *fTPMDevice,
+		StateEncryption:           *fStateEncryption,
+		StateSecret:               *fStateSecret,
+		DockerBroker:              *fDockerBroker,
+		BrokerMode:                *fBrokerMode,
+		BrokerUID:                 *fBrokerUID,
+		HooksPath:                 *fHooksPath,
+		HooksSnapshotInterval:     *fHooksInterval,
+		PrivilegeCheck:            *fPrivilegeCheck,
+		WASMPluginsPath:           *fWASMPluginsPath,
+		WASMPluginTimeout:         *fWASMPluginTimeout,
+		ImageCacheAddr:            *fImageCacheAddr,
+		ImageCacheUpstream:        *fImageCacheUpstream,
+		ImageCacheMaxSize:         imageCacheMaxSize,
+		RelayAddr:                 *fRelayAddr,
+		RelaySecret:               *fRelaySecret,
+		SnapshotHistoryInterval:   *fSnapshotHistory,
+		WriteSecurityProfiles:     *fWriteSecProfiles,
+		EdgeTunnel:                *fEdgeTunnel,
+		EdgeTunnelTransport:       *fEdgeTunnelTransport,
+		HealthCheck:               *fHealthCheck,
+		PrintConfig:               *fPrintConfig,
+		ExportProfile:             *fExportProfile,
+		ImportProfile:             *fImportProfile,
+		Profile:                   *fProfile,
+		UseProfile:                *fUseProfile,
+		ListProfiles:              *fListProfiles,
+		LogLevel:                  *fLogLevel,
+		LogMode:                   *fLogMode,
+		SharedSecret:              *fSharedSecret,
+		SSLCert:                   sslCert,
+		SSLKey:                    sslKey,
+		SSLCACert:                 *fSSLCACert,
+		CertRetryInterval:         *fCertRetryInterval,
+		MTLSEnrollURL:             *fMTLSEnrollURL,
+		MTLSEnrollToken:           *fMTLSEnrollToken,
+		AWSClientCert:             *fAWSClientCert,
+		AWSClientKey:              *fAWSClientKey,
+		AWSClientBundle:           *fAWSClientBundle,
+		AWSRoleARN:                *fAWSRoleARN,
+		AWSTrustAnchorARN:         *fAWSTrustAnchorARN,
+		AWSProfileARN:             *fAWSProfileARN,
+		AWSRegion:                 *fAWSRegion,
+		CredentialHelpers:         credentialHelpers,
+		CredentialHelpersTTL:      *fCredentialHelpersTTL,
+		GitCredentialHelpers:      gitCredentialHelpers,
+		WebhookSecret:             *fWebhookSecret,
+		AllowedOperations:         allowedOperations,
+		RedactionPatterns:         parseStringListValue(fRedactionPatterns),
+		CaptureImage:              *fCaptureImage,
+		ScanImage:                 *fScanImage,
+		HostActionImage:           *fHostActionImage,
+		KubernetesKubeconfig:      *fKubernetesKubeconfig,
+		ProxyPolicyFile:           *fProxyPolicyFile,
+		IdentityFile:              identityFile,
+		DockerProxyTimeout:        *fDockerProxyTimeout,
+		DockerProxyRetries:        *fDockerProxyRetries,
+		ACMEDomains:               acmeDomains,
+		ACMEEmail:                 *fACMEEmail,
+		ACMEDirectoryURL:          *fACMEDirectoryURL,
+		ACMESolver:                *fACMESolver,
+		ACMEHTTPAddr:              *fACMEHTTPAddr,
+		ACMEDNSHook:               *fACMEDNSHook,
+		SPIFFEEndpointSocket:      *fSPIFFEEndpointSocket,
+		EgressAllowlist:           parseStringListValue(fEgressAllowlist),
+		DeploymentLintPolicy:      *fDeploymentLintPolicy,
+		OrphanGCPolicy:            *fOrphanGCPolicy,
+		OrphanGCInterval:          *fOrphanGCInterval,
+		StackHooks:                *fStackHooks,
+		StackHookTimeout:          *fStackHookTimeout,
+		HealthGateWindow:          *fHealthGateWindow,
+		HealthGateMinUptime:       *fHealthGateMinUptime,
+		BandwidthMonthlyCap:       uint64(bandwidthMonthlyCap),
+		BandwidthWarningThreshold: *fBandwidthWarning,
+		MaintenanceWindows:        maintenanceWindows,
+		OSUpdater:                 *fOSUpdater,
+		SystemdUnits:              parseStringListValue(fSystemdUnits),
+		CommandPluginsPath:        *fCommandPluginsPath,
+		GRPCAPI:                   *fGRPCAPI,
+		SnapshotStats:             *fSnapshotStats,
+		SnapshotVirtualMachines:   *fSnapshotVMs,
+		SnapshotOverlayNetworks:   *fSnapshotOverlay,
+		SnapshotSMART:             *fSnapshotSMART,
+		SnapshotKernelAnomalies:   *fSnapshotKernel,
+		SnapshotLANDevices:        *fSnapshotLANDevices,
+		TemperatureAlertThreshold: *fTemperatureAlert,
+		BatteryAlertThreshold:     *fBatteryAlert,
+		SnapshotConcurrency:       *fSnapshotConcurrency,
+		SnapshotEnv:               *fSnapshotEnv,
+		StackConcurrency:          *fStackConcurrency,
+		EventBusURL:               *fEventBusURL,
+		EventBusSubject:           *fEventBusSubject,
+		EventBusSnapshotInterval:  *fEventBusInterval,
+		LogShippingURL:            *fLogShippingURL,
+		LogShippingContainers:     parseStringListValue(fLogShippingContainers),
+		LogShippingBatchSize:      *fLogShippingBatchSize,
+		LogShippingFlushInterval:  *fLogShippingInterval,
+		MetricsAddr:               *fMetricsAddr,
+		ReplicaToken:              *fReplicaToken,
+		CrashArtifacts:            *fCrashArtifacts,
+		CrashLogLines:             *fCrashLogLines,
+		CrashCoreDumpPath:         *fCrashCoreDumpPath,
+		CrashArtifactsMaxSize:     crashArtifactsMaxSize,
+		AuditSessions:             *fAuditSessions,
+		AuditMaxSize:              auditMaxSize,
+		IdempotencyWindow:         *fIdempotencyWindow,
+		BrowseArchiveMaxSize:      browseArchiveMaxSize,
+		ClockSkewTolerance:        *fClockSkewTolerance,
+		EdgeStackAutoRollback:     *fEdgeStackAutoRollback,
+		EdgeStackHistorySize:      *fEdgeStackHistorySize,
+		EdgeStackPreflight:        *fEdgeStackPreflight,
+		HASocket:                  *fHASocket,
+		RegistryWebhookToken:      *fRegistryWebhookToken,
+		RegistryAutoUpdate:        *fRegistryAutoUpdate,
+		DNSOverrides: agent.DNSOverrides{
+			ExtraHosts: extraHosts,
+			DNS:        dnsServers,
+		},
+		DeploymentQuotas: quotas,
 		EdgeMetaFields: agent.EdgeMetaFields{
 			EdgeGroupsIDs:      edgeGroupsIDs,
 			EnvironmentGroupID: *fEnvironmentGroupID,
@@ -178,3 +1026,64 @@ func parseListValue(flagValue *string) ([]int, error) {
 
 	return arr, nil
 }
+
+const stringListSeparator = ","
+
+func parseStringListValue(flagValue *string) []string {
+	if flagValue == nil || *flagValue == "" {
+		return nil
+	}
+
+	var arr []string
+	for _, value := range strings.Split(*flagValue, stringListSeparator) {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			arr = append(arr, value)
+		}
+	}
+
+	return arr
+}
+
+// parseExtraHostsValue parses a list of host:ip entries, ip can also be the special host-gateway value
+func parseExtraHostsValue(flagValue *string) ([]string, error) {
+	extraHosts := parseStringListValue(flagValue)
+
+	for _, extraHost := range extraHosts {
+		host, ip, found := strings.Cut(extraHost, ":")
+		if !found || host == "" || (ip != "host-gateway" && net.ParseIP(ip) == nil) {
+			return nil, fmt.Errorf("invalid extra host %q, expected host:ip", extraHost)
+		}
+	}
+
+	return extraHosts, nil
+}
+
+// parseCredentialHelpersValue parses a list of host=helper entries
+func parseCredentialHelpersValue(flagValue *string) (map[string]string, error) {
+	helpers := map[string]string{}
+
+	for _, entry := range parseStringListValue(flagValue) {
+		registry, helper, found := strings.Cut(entry, "=")
+		registry, helper = strings.TrimSpace(registry), strings.TrimSpace(helper)
+		if !found || registry == "" || helper == "" || strings.ContainsAny(helper, "/\\ ") {
+			return nil, fmt.Errorf("invalid credential helper %q, expected host=helper", entry)
+		}
+
+		helpers[strings.ToLower(registry)] = helper
+	}
+
+	return helpers, nil
+}
+
+func parseIPListValue(flagValue *string) ([]string, error) {
+	ips := parseStringListValue(flagValue)
+
+	for _, ip := range ips {
+		if net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("invalid IP address %q", ip)
+		}
+	}
+
+	return ips, nil
+}
@@ -0,0 +1,381 @@
+package os
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/portainer/agent"
+	"gopkg.in/yaml.v3"
+
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+// ProfileFileName is the name of the file, inside the data folder, where the imported configuration profile is
+// persisted. It takes precedence over the configuration pushed by the Portainer server only.
+const ProfileFileName = "agent_profile.yaml"
+
+// ProfilesDirName is the name of the folder, inside the data folder, where the named configuration profiles are
+// persisted, e.g. the profiles of the staging and of the production Portainer instances
+const ProfilesDirName = "profiles"
+
+// ActiveProfileFileName is the name of the file, inside the data folder, persisting the name of the configuration
+// profile selected with the use-profile command
+const ActiveProfileFileName = "agent_active_profile"
+
+// DefaultProfileName designates the unnamed configuration profile
+const DefaultProfileName = "default"
+
+// ProfileVersion is the version of the format of the configuration profiles
+const ProfileVersion = 1
+
+var profileNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,62}$`)
+
+var (
+	currentParser   *EnvOptionParser
+	currentParserMu sync.Mutex
+)
+
+// Profile represents the configuration of an agent that can be exported from a device and imported on another one.
+// The values of the secrets are never part of a profile.
+type Profile struct {
+	Version      int       `yaml:"version" json:"Version"`
+	AgentVersion string    `yaml:"agentVersion" json:"AgentVersion"`
+	ExportedAt   time.Time `yaml:"exportedAt" json:"ExportedAt"`
+	// Options maps the options (environment variable names, or flag names for the options without one) to their
+	// values, only the remote options that are not set to their default value are exported
+	Options map[string]string `yaml:"options" json:"Options"`
+	// Secrets maps the secret options set on the exporting device to the file their value was read from, empty when
+	// it was provided otherwise. The importing device reads the secrets from the same files, the other secrets must
+	// be provided to it.
+	Secrets map[string]string `yaml:"secrets,omitempty" json:"Secrets,omitempty"`
+}
+
+// isProfileSecret returns true when the value of the option identified by envKey must not be exported
+func isProfileSecret(envKey string) bool {
+	return envKey != "" && sensitiveEnvKeys[envKey]
+}
+
+// buildProfile returns the profile of the remote options set from another source than their default value, the
+// secrets are referenced by the files they are read from
+func buildProfile(flags []*kingpin.FlagModel, sources map[string]OptionSource, secretFiles map[string]string) *Profile {
+	profile := &Profile{
+		Version:      ProfileVersion,
+		AgentVersion: agent.Version,
+		ExportedAt:   time.Now().UTC(),
+		Options:      map[string]string{},
+	}
+
+	for _, flag := range flags {
+		if sources[flag.Name] == SourceDefault || sources[flag.Name] == "" {
+			continue
+		}
+
+		key := flag.Name
+		if flag.Envar != "" {
+			key = flag.Envar
+		}
+
+		if isProfileSecret(flag.Envar) {
+			if profile.Secrets == nil {
+				profile.Secrets = map[string]string{}
+			}
+
+			profile.Secrets[key] = secretFiles[flag.Envar]
+
+			continue
+		}
+
+		if remoteFlags[flag.Name] {
+			profile.Options[key] = flag.String()
+		}
+	}
+
+	return profile
+}
+
+// ExportProfile returns the profile of the options parsed by the parser
+func (parser *EnvOptionParser) ExportProfile() *Profile {
+	return buildProfile(kingpin.CommandLine.Model().Flags, parser.sources, parser.secretFiles)
+}
+
+// CurrentProfile returns the profile of the options the agent was started with
+func CurrentProfile() (*Profile, error) {
+	currentParserMu.Lock()
+	defer currentParserMu.Unlock()
+
+	if currentParser == nil {
+		return nil, errors.New("the options of the agent are not parsed")
+	}
+
+	return currentParser.ExportProfile(), nil
+}
+
+// WriteProfile writes profile in YAML to w
+func WriteProfile(w io.Writer, profile *Profile) error {
+	encoder := yaml.NewEncoder(w)
+	defer encoder.Close()
+
+	return encoder.Encode(profile)
+}
+
+// ReadProfile reads a profile in YAML, as exported by the command line, or in JSON, as exported by the agent API,
+// from r
+func ReadProfile(r io.Reader) (*Profile, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var profile Profile
+	if bytes.HasPrefix(bytes.TrimSpace(content), []byte("{")) {
+		err = json.Unmarshal(content, &profile)
+	} else {
+		err = yaml.Unmarshal(content, &profile)
+	}
+	if err != nil {
+		return nil, errors.WithMessage(err, "invalid configuration profile")
+	}
+
+	return &profile, nil
+}
+
+// validateProfile returns an error when the profile is not supported or references unknown options, ErrRestrictedOption
+// is returned when it sets an option that is not part of the remote options
+func validateProfile(flags []*kingpin.FlagModel, profile *Profile) error {
+	if profile.Version != ProfileVersion {
+		return fmt.Errorf("unsupported configuration profile version %d, expected %d", profile.Version, ProfileVersion)
+	}
+
+	err := validateConfigKeys(flags, profile.Options)
+	if err != nil {
+		return err
+	}
+
+	for _, flag := range flags {
+		_, byName := profile.Options[flag.Name]
+		_, byEnvKey := profile.Options[flag.Envar]
+		if !byName && (flag.Envar == "" || !byEnvKey) {
+			continue
+		}
+
+		if isProfileSecret(flag.Envar) {
+			return fmt.Errorf("the secret %s cannot be imported, it must be referenced as a secret", flag.Envar)
+		}
+
+		if !remoteFlags[flag.Name] {
+			return errors.WithMessagef(ErrRestrictedOption, "option %s", flag.Name)
+		}
+	}
+
+	for key := range profile.Secrets {
+		if !isProfileSecret(key) {
+			return fmt.Errorf("%s is not a secret option", key)
+		}
+	}
+
+	return nil
+}
+
+// profilePath returns the path of the file of the profile named name inside the data folder
+func profilePath(dataPath, name string) (string, error) {
+	if name == "" || name == DefaultProfileName {
+		return filepath.Join(dataPath, ProfileFileName), nil
+	}
+
+	if !profileNameRegexp.MatchString(name) {
+		return "", fmt.Errorf("invalid configuration profile name %q", name)
+	}
+
+	return filepath.Join(dataPath, ProfilesDirName, name+".yaml"), nil
+}
+
+// ImportProfile persists profile inside the data folder under name, the unnamed profile when name is empty. The
+// selected profile is applied on the next start of the agent to the options that are not defined via a flag, an
+// environment variable or the configuration file. It returns the secrets that must be provided to the agent, because
+// they are not read from a file.
+func ImportProfile(dataPath, name string, profile *Profile) ([]string, error) {
+	err := validateProfile(kingpin.CommandLine.Model().Flags, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := profilePath(dataPath, name)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := yaml.Marshal(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.WriteFile(path, content, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	var required []string
+	for key, path := range profile.Secrets {
+		if path == "" {
+			required = append(required, key)
+		}
+	}
+	sort.Strings(required)
+
+	return required, nil
+}
+
+// readProfileFile reads the profile named name inside the data folder. nil is returned when the unnamed profile was
+// not imported, a named profile must exist.
+func readProfileFile(dataPath, name string) (*Profile, error) {
+	path, err := profilePath(dataPath, name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) && (name == "" || name == DefaultProfileName) {
+		return nil, nil
+	} else if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("the configuration profile %s does not exist", name)
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadProfile(f)
+}
+
+// ProfileInfo represents a configuration profile imported inside the data folder
+type ProfileInfo struct {
+	Name   string
+	Active bool
+}
+
+// ListProfiles returns the profiles imported inside the data folder, the profile selected with UseProfile is active
+func ListProfiles(dataPath string) ([]ProfileInfo, error) {
+	active, err := ActiveProfile(dataPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var profiles []ProfileInfo
+	if _, err := os.Stat(filepath.Join(dataPath, ProfileFileName)); err == nil {
+		profiles = append(profiles, ProfileInfo{Name: DefaultProfileName})
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dataPath, ProfilesDirName))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".yaml")
+		if entry.IsDir() || !ok || !profileNameRegexp.MatchString(name) || name == DefaultProfileName {
+			continue
+		}
+
+		profiles = append(profiles, ProfileInfo{Name: name})
+	}
+
+	for i := range profiles {
+		profiles[i].Active = profiles[i].Name == active
+	}
+
+	return profiles, nil
+}
+
+// ActiveProfile returns the name of the profile selected with UseProfile, the unnamed profile when none was selected
+func ActiveProfile(dataPath string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(dataPath, ActiveProfileFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return DefaultProfileName, nil
+	} else if err != nil {
+		return "", err
+	}
+
+	name := strings.TrimSpace(string(content))
+	if name == "" {
+		return DefaultProfileName, nil
+	}
+
+	return name, nil
+}
+
+// UseProfile selects the profile named name for the next starts of the agent. The configuration pushed by the
+// Portainer server is discarded when the selected profile changes, as it was pushed by the instance of the previous
+// profile.
+func UseProfile(dataPath, name string) error {
+	path, err := profilePath(dataPath, name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(path); err != nil && (name != "" && name != DefaultProfileName) {
+		return fmt.Errorf("the configuration profile %s does not exist", name)
+	}
+
+	if name == "" {
+		name = DefaultProfileName
+	}
+
+	previous, err := ActiveProfile(dataPath)
+	if err != nil {
+		return err
+	}
+
+	if previous == name {
+		return nil
+	}
+
+	err = os.WriteFile(filepath.Join(dataPath, ActiveProfileFileName), []byte(name+"\n"), 0600)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(filepath.Join(dataPath, ServerConfigFileName))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// applyProfileSecrets sets the secrets of the profile that are still undefined from the files they reference
+func applyProfileSecrets(flags []*kingpin.FlagModel, sources map[string]OptionSource, secrets map[string]string) error {
+	for _, flag := range flags {
+		path, ok := secrets[flag.Envar]
+		if !ok || path == "" || sources[flag.Name] != SourceDefault {
+			continue
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return errors.WithMessagef(err, "unable to read the file referenced by the secret %s of the configuration profile", flag.Envar)
+		}
+
+		err = flag.Value.Set(strings.TrimRight(string(content), "\r\n"))
+		if err != nil {
+			return errors.WithMessagef(err, "invalid value for option %s", flag.Name)
+		}
+
+		sources[flag.Name] = SourceSecret
+	}
+
+	return nil
+}
@@ -0,0 +1,250 @@
+package os
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+func TestBuildProfileReferencesSecrets(t *testing.T) {
+	allowRemote(t, "opt", "opt-default", "opt-noenv")
+
+	app := kingpin.New("agent", "")
+	app.Flag("opt", "").Envar("TEST_OPT").Default("default").String()
+	app.Flag("opt-default", "").Envar("TEST_OPT_DEFAULT").Default("default").String()
+	app.Flag("opt-noenv", "").Default("default").String()
+	app.Flag("secret", "").Envar(EnvKeyAgentSecret).String()
+	app.Flag("edge-key", "").Envar(EnvKeyEdgeKey).String()
+	app.Flag("edge-id", "").Envar(EnvKeyEdgeID).String()
+	app.Flag("allowed-operations", "").Envar(EnvKeyAllowedOperations).String()
+
+	t.Setenv("TEST_OPT", "env")
+	t.Setenv(EnvKeyAgentSecret, "s3cr3t")
+	t.Setenv(EnvKeyEdgeKey, "key")
+	t.Setenv(EnvKeyEdgeID, "device-1")
+	t.Setenv(EnvKeyAllowedOperations, "restricted-1")
+
+	args := []string{"--opt-noenv=flag"}
+	_, err := app.Parse(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flags := app.Model().Flags
+	sources := resolveSources(flags, args, map[string]bool{EnvKeyAgentSecret: true})
+
+	profile := buildProfile(flags, sources, map[string]string{EnvKeyAgentSecret: "/run/secrets/agent_secret"})
+
+	expectedOptions := map[string]string{"TEST_OPT": "env", "opt-noenv": "flag"}
+	if len(profile.Options) != len(expectedOptions) {
+		t.Fatalf("expected the options %v, got %v", expectedOptions, profile.Options)
+	}
+
+	for key, value := range expectedOptions {
+		if profile.Options[key] != value {
+			t.Errorf("%s: expected %q, got %q", key, value, profile.Options[key])
+		}
+	}
+
+	if len(profile.Secrets) != 2 || profile.Secrets[EnvKeyAgentSecret] != "/run/secrets/agent_secret" || profile.Secrets[EnvKeyEdgeKey] != "" {
+		t.Errorf("expected the secrets to be referenced, got %v", profile.Secrets)
+	}
+
+	var buf bytes.Buffer
+	err = WriteProfile(&buf, profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(buf.Bytes(), []byte("s3cr3t")) || bytes.Contains(buf.Bytes(), []byte("device-1")) || bytes.Contains(buf.Bytes(), []byte("restricted-1")) {
+		t.Errorf("expected the secrets and the restricted options to be omitted, got %s", buf.String())
+	}
+
+	read, err := ReadProfile(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if read.Version != ProfileVersion || read.Options["TEST_OPT"] != "env" || read.Secrets[EnvKeyAgentSecret] != "/run/secrets/agent_secret" {
+		t.Errorf("expected the profile to be read back, got %+v", read)
+	}
+}
+
+func TestReadProfileJSON(t *testing.T) {
+	profile, err := ReadProfile(bytes.NewBufferString(`{"Version": 1, "Options": {"TEST_OPT": "value"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if profile.Version != 1 || profile.Options["TEST_OPT"] != "value" {
+		t.Errorf("unexpected profile %+v", profile)
+	}
+}
+
+func TestValidateProfile(t *testing.T) {
+	allowRemote(t, "opt")
+
+	app := kingpin.New("agent", "")
+	app.Flag("opt", "").Envar("TEST_OPT").String()
+	app.Flag("secret", "").Envar(EnvKeyAgentSecret).String()
+	app.Flag("edge-id", "").Envar(EnvKeyEdgeID).String()
+	app.Flag("stack-hooks", "").Envar(EnvKeyStackHooks).String()
+
+	flags := app.Model().Flags
+
+	tests := []struct {
+		name    string
+		profile Profile
+		valid   bool
+	}{
+		{"valid", Profile{Version: ProfileVersion, Options: map[string]string{"TEST_OPT": "value"}, Secrets: map[string]string{EnvKeyAgentSecret: ""}}, true},
+		{"unsupported version", Profile{Version: ProfileVersion + 1}, false},
+		{"unknown option", Profile{Version: ProfileVersion, Options: map[string]string{"TEST_OTP": "value"}}, false},
+		{"embedded secret", Profile{Version: ProfileVersion, Options: map[string]string{"secret": "value"}}, false},
+		{"device option", Profile{Version: ProfileVersion, Options: map[string]string{EnvKeyEdgeID: "value"}}, false},
+		{"restricted option", Profile{Version: ProfileVersion, Options: map[string]string{"stack-hooks": "value"}}, false},
+		{"not a secret", Profile{Version: ProfileVersion, Secrets: map[string]string{"TEST_OPT": ""}}, false},
+	}
+
+	for _, test := range tests {
+		err := validateProfile(flags, &test.profile)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: expected valid=%t, got %v", test.name, test.valid, err)
+		}
+	}
+}
+
+func TestApplyProfileSecrets(t *testing.T) {
+	app := kingpin.New("agent", "")
+	fSecret := app.Flag("secret", "").Envar(EnvKeyAgentSecret).String()
+	fEdgeKey := app.Flag("edge-key", "").Envar(EnvKeyEdgeKey).String()
+
+	t.Setenv(EnvKeyEdgeKey, "from-env")
+
+	_, err := app.Parse(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "secret")
+	err = os.WriteFile(path, []byte("from-file\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flags := app.Model().Flags
+	sources := resolveSources(flags, nil, nil)
+
+	err = applyProfileSecrets(flags, sources, map[string]string{EnvKeyAgentSecret: path, EnvKeyEdgeKey: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *fSecret != "from-file" || sources["secret"] != SourceSecret {
+		t.Errorf("expected the secret to be read from the referenced file, got %q from %s", *fSecret, sources["secret"])
+	}
+
+	if *fEdgeKey != "from-env" {
+		t.Errorf("expected the environment to take precedence over the profile, got %q", *fEdgeKey)
+	}
+}
+
+func TestNamedProfiles(t *testing.T) {
+	dataPath := t.TempDir()
+
+	for _, name := range []string{"", "staging"} {
+		_, err := ImportProfile(dataPath, name, &Profile{Version: ProfileVersion})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := os.WriteFile(filepath.Join(dataPath, ServerConfigFileName), []byte("{}"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profiles, err := ListProfiles(dataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(profiles) != 2 || profiles[0] != (ProfileInfo{Name: DefaultProfileName, Active: true}) || profiles[1] != (ProfileInfo{Name: "staging"}) {
+		t.Fatalf("unexpected profiles %+v", profiles)
+	}
+
+	err = UseProfile(dataPath, "staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if active, _ := ActiveProfile(dataPath); active != "staging" {
+		t.Errorf("expected the staging profile to be selected, got %s", active)
+	}
+
+	if _, err := os.Stat(filepath.Join(dataPath, ServerConfigFileName)); !os.IsNotExist(err) {
+		t.Error("expected the configuration pushed by the previous instance to be discarded")
+	}
+
+	if profile, err := readProfileFile(dataPath, "staging"); err != nil || profile == nil {
+		t.Errorf("expected the staging profile to be read, got %v", err)
+	}
+
+	if err := UseProfile(dataPath, "production"); err == nil {
+		t.Error("expected a missing profile to be rejected")
+	}
+
+	if _, err := readProfileFile(dataPath, "production"); err == nil {
+		t.Error("expected a missing named profile to be an error")
+	}
+
+	if _, err := ImportProfile(dataPath, "../staging", &Profile{Version: ProfileVersion}); err == nil {
+		t.Error("expected an invalid profile name to be rejected")
+	}
+}
+
+func TestSecretsNeverExported(t *testing.T) {
+	flags := kingpin.CommandLine.Model().Flags
+	sources := map[string]OptionSource{}
+
+	for _, key := range []string{EnvKeyRelaySecret, EnvKeyAgentSecret, EnvKeyEdgeOIDCClientSecret, EnvKeyReplicaToken, EnvKeyMTLSEnrollToken} {
+		var flag *kingpin.FlagModel
+		for _, f := range flags {
+			if f.Envar == key {
+				flag = f
+			}
+		}
+
+		if flag == nil {
+			t.Fatalf("no option is defined with %s", key)
+		}
+
+		if err := flag.Value.Set("s3cr3t-" + key); err != nil {
+			t.Fatal(err)
+		}
+		defer flag.Value.Set("")
+
+		sources[flag.Name] = SourceEnv
+	}
+
+	var buf bytes.Buffer
+	err := WriteProfile(&buf, buildProfile(flags, sources, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parser := NewEnvOptionParser()
+	parser.sources = sources
+	parser.PrintConfig(&buf)
+
+	if bytes.Contains(buf.Bytes(), []byte("s3cr3t")) {
+		t.Fatalf("expected the secrets to be masked, got %s", buf.String())
+	}
+
+	if !bytes.Contains(buf.Bytes(), []byte(EnvKeyRelaySecret)) {
+		t.Fatalf("expected the relay secret to be referenced, got %s", buf.String())
+	}
+}
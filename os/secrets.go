@@ -0,0 +1,139 @@
+package os
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultSecretsDir is the default folder where Docker secrets are mounted. Kubernetes secrets can be mounted
+// in the same folder, or in the folder specified via the AGENT_SECRETS_DIR environment variable.
+const DefaultSecretsDir = "/run/secrets"
+
+// Environment variables read before the command line is parsed, they are not exposed as flags
+const (
+	EnvKeySecretsDir       = "AGENT_SECRETS_DIR"
+	EnvKeySecretsFilesOnly = "AGENT_SECRETS_FILES_ONLY"
+)
+
+// secretValueEnvKeys are the options whose value is a secret that can be read from a mounted secret file
+var secretValueEnvKeys = []string{EnvKeyAgentSecret, EnvKeyEdgeKey, EnvKeyWebhookSecret, EnvKeyRegistryWebhookToken, EnvKeyEdgeOIDCClientSecret, EnvKeyEdgeEnrollCode, EnvKeyStateSecret, EnvKeyRelaySecret}
+
+// secretPathEnvKeys are the options whose value is the path to TLS material that can be provided as a mounted secret file
+var secretPathEnvKeys = []string{EnvKeySSLCert, EnvKeySSLKey, EnvKeySSLCACert}
+
+// discoverSecretFiles looks for secret files named after the options (e.g. agent_secret or AGENT_SECRET) inside
+// the secrets folder and references them for the options that are not defined otherwise.
+func discoverSecretFiles() {
+	dir := secretsDir()
+
+	for _, key := range secretValueEnvKeys {
+		if os.Getenv(key) != "" || os.Getenv(key+fileEnvSuffix) != "" {
+			continue
+		}
+
+		if path, ok := findSecretFile(dir, key); ok {
+			os.Setenv(key+fileEnvSuffix, path)
+		}
+	}
+
+	for _, key := range secretPathEnvKeys {
+		if os.Getenv(key) != "" {
+			continue
+		}
+
+		if path, ok := findSecretFile(dir, key); ok {
+			os.Setenv(key, path)
+		}
+	}
+}
+
+func secretsDir() string {
+	dir := os.Getenv(EnvKeySecretsDir)
+	if dir == "" {
+		return DefaultSecretsDir
+	}
+
+	return filepath.Clean(dir)
+}
+
+func findSecretFile(dir, key string) (string, bool) {
+	for _, name := range []string{strings.ToLower(key), key} {
+		path := filepath.Join(dir, name)
+
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, true
+		}
+	}
+
+	return "", false
+}
+
+// checkSecretsFromFiles returns an error when the agent is configured to only read secrets from files and a secret
+// option is provided through any other layer (flag, environment variable, configuration file or server), or when the
+// TLS material is located outside of the secrets folder.
+func checkSecretsFromFiles(sources map[string]OptionSource, flagNames map[string]string, tlsPaths map[string]string) error {
+	if !isTrue(os.Getenv(EnvKeySecretsFilesOnly)) {
+		return nil
+	}
+
+	for _, key := range secretValueEnvKeys {
+		source := sources[flagNames[key]]
+		if source != SourceSecret && source != SourceDefault {
+			return fmt.Errorf("%s must be provided through a secret file when %s is enabled", key, EnvKeySecretsFilesOnly)
+		}
+	}
+
+	dir := secretsDir()
+
+	for _, key := range secretPathEnvKeys {
+		path := tlsPaths[key]
+		if path == "" {
+			continue
+		}
+
+		rel, err := filepath.Rel(dir, filepath.Clean(path))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("%s must reference a file located in %s when %s is enabled", key, dir, EnvKeySecretsFilesOnly)
+		}
+	}
+
+	return nil
+}
+
+// exposedSecrets returns the environment variables of the secret options provided through an environment variable
+// or a flag. Their value remains visible via /proc/1/environ, /proc/1/cmdline and docker inspect whatever the agent
+// does, scrubSecretEnvVars only keeps them out of the processes started by the agent.
+func exposedSecrets(sources map[string]OptionSource, flagNames map[string]string) []string {
+	var keys []string
+
+	for _, key := range secretValueEnvKeys {
+		switch sources[flagNames[key]] {
+		case SourceEnv, SourceFlag:
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// scrubSecretEnvVars removes the secrets from the environment of the process once they are loaded so that they are
+// not inherited by the processes started by the agent (docker, docker compose, kubectl...).
+// Note that the environment provided when the container was created remains visible via /proc/1/environ and
+// docker inspect, providing secrets as files is the only way to keep them out of these.
+func scrubSecretEnvVars() {
+	for _, key := range secretValueEnvKeys {
+		os.Unsetenv(key)
+		os.Unsetenv(key + fileEnvSuffix)
+	}
+}
+
+func isTrue(value string) bool {
+	switch strings.ToLower(value) {
+	case "1", "true", "yes":
+		return true
+	}
+
+	return false
+}
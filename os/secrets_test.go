@@ -0,0 +1,142 @@
+package os
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeSecret(t *testing.T, dir, name string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// unsetEnv removes the environment variables for the duration of the test
+func unsetEnv(t *testing.T, keys ...string) {
+	t.Helper()
+
+	for _, key := range keys {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+}
+
+func TestSecretsDir(t *testing.T) {
+	tests := []struct {
+		dir      string
+		expected string
+	}{
+		{dir: "", expected: DefaultSecretsDir},
+		{dir: "/etc/agent/secrets", expected: "/etc/agent/secrets"},
+		{dir: "/etc/agent/../agent/secrets/", expected: "/etc/agent/secrets"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			t.Setenv(EnvKeySecretsDir, tt.dir)
+
+			if dir := secretsDir(); dir != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, dir)
+			}
+		})
+	}
+}
+
+func TestFindSecretFile(t *testing.T) {
+	dir := t.TempDir()
+
+	lower := writeSecret(t, dir, "agent_secret")
+	writeSecret(t, dir, "AGENT_SECRET")
+	upper := writeSecret(t, dir, "EDGE_KEY")
+
+	if err := os.Mkdir(filepath.Join(dir, "agent_webhook_secret"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key      string
+		expected string
+	}{
+		{key: EnvKeyAgentSecret, expected: lower},
+		{key: EnvKeyEdgeKey, expected: upper},
+		{key: EnvKeyWebhookSecret},
+		{key: EnvKeyRelaySecret},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			path, ok := findSecretFile(dir, tt.key)
+			if ok != (tt.expected != "") || path != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, path)
+			}
+		})
+	}
+}
+
+func TestDiscoverSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(EnvKeySecretsDir, dir)
+
+	for _, key := range secretValueEnvKeys {
+		unsetEnv(t, key, key+fileEnvSuffix)
+	}
+	unsetEnv(t, secretPathEnvKeys...)
+
+	agentSecret := writeSecret(t, dir, "agent_secret")
+	writeSecret(t, dir, "edge_key")
+	writeSecret(t, dir, "agent_webhook_secret")
+	cert := writeSecret(t, dir, "MTLS_SSL_CERT")
+	writeSecret(t, dir, "mtls_ssl_key")
+
+	// the options defined otherwise keep their value
+	t.Setenv(EnvKeyEdgeKey, "from-env")
+	t.Setenv(EnvKeyWebhookSecret+fileEnvSuffix, "/run/other/webhook")
+	t.Setenv(EnvKeySSLKey, "/certs/key.pem")
+
+	discoverSecretFiles()
+
+	expected := map[string]string{
+		EnvKeyAgentSecret + fileEnvSuffix:   agentSecret,
+		EnvKeyEdgeKey:                       "from-env",
+		EnvKeyEdgeKey + fileEnvSuffix:       "",
+		EnvKeyWebhookSecret + fileEnvSuffix: "/run/other/webhook",
+		EnvKeyRelaySecret + fileEnvSuffix:   "",
+		EnvKeySSLCert:                       cert,
+		EnvKeySSLKey:                        "/certs/key.pem",
+		EnvKeySSLCACert:                     "",
+	}
+
+	for key, value := range expected {
+		if v := os.Getenv(key); v != value {
+			t.Errorf("expected %s to be %q, got %q", key, value, v)
+		}
+	}
+}
+
+func TestExposedSecrets(t *testing.T) {
+	flagNames := map[string]string{
+		EnvKeyAgentSecret:   "secret",
+		EnvKeyEdgeKey:       "edge-key",
+		EnvKeyWebhookSecret: "webhook-secret",
+		EnvKeyRelaySecret:   "relay-secret",
+	}
+
+	sources := map[string]OptionSource{
+		"secret":         SourceEnv,
+		"edge-key":       SourceFlag,
+		"webhook-secret": SourceSecret,
+		"relay-secret":   SourceDefault,
+	}
+
+	expected := []string{EnvKeyAgentSecret, EnvKeyEdgeKey}
+	if keys := exposedSecrets(sources, flagNames); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected %v, got %v", expected, keys)
+	}
+}
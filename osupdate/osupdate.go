@@ -0,0 +1,237 @@
+package osupdate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent/docker"
+
+	"github.com/rs/zerolog/log"
+)
+
+// States of an OS update
+const (
+	StateRunning   = "running"
+	StateSucceeded = "succeeded"
+	StateFailed    = "failed"
+)
+
+var (
+	// ErrDisabled is returned when an update is requested while no OS updater is configured
+	ErrDisabled = errors.New("no OS updater is configured on this agent")
+	// ErrUpdateInProgress is returned when an update is requested while another one is running
+	ErrUpdateInProgress = errors.New("an OS update is already in progress")
+)
+
+var (
+	defaultService   *Service
+	defaultServiceMu sync.Mutex
+)
+
+// Status represents the progress of the last OS update
+type Status struct {
+	Updater    string     `json:"Updater"`
+	Artifact   string     `json:"Artifact,omitempty"`
+	State      string     `json:"State"`
+	Progress   int        `json:"Progress"`
+	Message    string     `json:"Message,omitempty"`
+	Error      string     `json:"Error,omitempty"`
+	StartedAt  time.Time  `json:"StartedAt"`
+	FinishedAt *time.Time `json:"FinishedAt,omitempty"`
+}
+
+// Service executes the OS updates with an Updater, one at a time
+type Service struct {
+	updater Updater
+	run     CommandRunner
+	mu      sync.Mutex
+	status  *Status
+}
+
+// NewService returns a pointer to a Service using the updater registered under updaterName. The commands of the
+// updater are executed on the host with image, which must provide nsenter.
+func NewService(updaterName, image string) (*Service, error) {
+	updater, err := Get(updaterName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Service{
+		updater: updater,
+		run: func(ctx context.Context, cmd []string, onLine func(line string)) error {
+			w := &lineWriter{onLine: onLine}
+			defer w.Flush()
+
+			return docker.ExecHostCommand(ctx, image, cmd, w)
+		},
+	}, nil
+}
+
+// Update validates artifact and applies the update, progress is called each time the updater reports its progress
+func (service *Service) Update(ctx context.Context, artifact string, progress ProgressFunc) error {
+	if err := service.updater.ValidateArtifact(artifact); err != nil {
+		return err
+	}
+
+	service.mu.Lock()
+	if service.status != nil && service.status.State == StateRunning {
+		service.mu.Unlock()
+
+		return ErrUpdateInProgress
+	}
+
+	service.status = &Status{
+		Updater:   service.updater.Name(),
+		Artifact:  artifact,
+		State:     StateRunning,
+		StartedAt: time.Now(),
+	}
+	service.mu.Unlock()
+
+	log.Info().Str("updater", service.updater.Name()).Str("artifact", artifact).Msg("starting OS update")
+
+	err := service.updater.Install(ctx, service.run, artifact, func(percent int, message string) {
+		service.mu.Lock()
+		service.status.Progress = percent
+		service.status.Message = message
+		service.mu.Unlock()
+
+		if progress != nil {
+			progress(percent, message)
+		}
+	})
+
+	now := time.Now()
+
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	service.status.FinishedAt = &now
+	service.status.State = StateSucceeded
+	if err != nil {
+		service.status.State = StateFailed
+		service.status.Error = err.Error()
+
+		log.Error().Err(err).Str("updater", service.updater.Name()).Msg("OS update failed")
+
+		return err
+	}
+
+	service.status.Progress = 100
+
+	log.Info().Str("updater", service.updater.Name()).Msg("OS update succeeded")
+
+	return nil
+}
+
+// Status returns a copy of the status of the last update, or nil
+func (service *Service) Status() *Status {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	if service.status == nil {
+		return nil
+	}
+
+	status := *service.status
+
+	return &status
+}
+
+// Enable makes service the default service used by Run, CurrentStatus and Diagnostics
+func Enable(service *Service) {
+	defaultServiceMu.Lock()
+	defer defaultServiceMu.Unlock()
+
+	defaultService = service
+}
+
+func getDefaultService() *Service {
+	defaultServiceMu.Lock()
+	defer defaultServiceMu.Unlock()
+
+	return defaultService
+}
+
+// Run applies an update with the default service, ErrDisabled is returned when no service is enabled
+func Run(ctx context.Context, artifact string, progress ProgressFunc) error {
+	service := getDefaultService()
+	if service == nil {
+		return ErrDisabled
+	}
+
+	return service.Update(ctx, artifact, progress)
+}
+
+// ValidateArtifact validates artifact with the updater of the default service, ErrDisabled is returned when no
+// service is enabled
+func ValidateArtifact(artifact string) error {
+	service := getDefaultService()
+	if service == nil {
+		return ErrDisabled
+	}
+
+	return service.updater.ValidateArtifact(artifact)
+}
+
+// CurrentStatus returns the status of the last update applied by the default service, or nil
+func CurrentStatus() *Status {
+	service := getDefaultService()
+	if service == nil {
+		return nil
+	}
+
+	return service.Status()
+}
+
+// Diagnostics returns a diagnostic message describing the progress or the outcome of the last update
+func Diagnostics() []string {
+	status := CurrentStatus()
+	if status == nil {
+		return nil
+	}
+
+	message := fmt.Sprintf("OS update with %s %s (%d%%)", status.Updater, status.State, status.Progress)
+	if status.Error != "" {
+		message += ": " + status.Error
+	} else if status.Message != "" {
+		message += ": " + status.Message
+	}
+
+	return []string{message}
+}
+
+// lineWriter calls onLine for each line written to it, the carriage returns used to redraw the progress bars
+// also terminate a line
+type lineWriter struct {
+	onLine func(line string)
+	buf    bytes.Buffer
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if b != '\n' && b != '\r' {
+			w.buf.WriteByte(b)
+
+			continue
+		}
+
+		w.Flush()
+	}
+
+	return len(p), nil
+}
+
+// Flush calls onLine with the pending incomplete line, if any
+func (w *lineWriter) Flush() {
+	if w.buf.Len() == 0 {
+		return
+	}
+
+	w.onLine(w.buf.String())
+	w.buf.Reset()
+}
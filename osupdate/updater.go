@@ -0,0 +1,170 @@
+package osupdate
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type (
+	// CommandRunner executes a command on the host and calls onLine for each line of its output
+	CommandRunner func(ctx context.Context, cmd []string, onLine func(line string)) error
+
+	// ProgressFunc is called by an Updater to report the progress of an update
+	ProgressFunc func(percent int, message string)
+
+	// Updater integrates an OS update tool. Install applies the update described by artifact, a bundle path or URL
+	// or a list of packages depending on the tool, by executing the commands of the tool with run.
+	Updater interface {
+		Name() string
+		ValidateArtifact(artifact string) error
+		Install(ctx context.Context, run CommandRunner, artifact string, progress ProgressFunc) error
+	}
+)
+
+var (
+	updaters   = map[string]Updater{}
+	updatersMu sync.RWMutex
+)
+
+func init() {
+	Register(&bundleUpdater{name: "rauc", command: []string{"rauc", "install"}})
+	Register(&bundleUpdater{name: "mender", command: []string{"mender", "install"}})
+	Register(&bundleUpdater{name: "swupdate", command: []string{"swupdate", "-v", "-i"}})
+	Register(&aptUpdater{})
+}
+
+// Register makes an Updater available under its name, replacing any updater registered with the same name
+func Register(updater Updater) {
+	updatersMu.Lock()
+	defer updatersMu.Unlock()
+
+	updaters[updater.Name()] = updater
+}
+
+// Get returns the Updater registered under name
+func Get(name string) (Updater, error) {
+	updatersMu.RLock()
+	defer updatersMu.RUnlock()
+
+	updater, ok := updaters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown OS updater %q, supported updaters: %s", name, strings.Join(namesLocked(), ", "))
+	}
+
+	return updater, nil
+}
+
+// Names returns the names of the registered updaters, sorted
+func Names() []string {
+	updatersMu.RLock()
+	defer updatersMu.RUnlock()
+
+	return namesLocked()
+}
+
+func namesLocked() []string {
+	names := make([]string, 0, len(updaters))
+	for name := range updaters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// percentRegexp matches the percentages printed by rauc (" 40% Copying image"), mender and swupdate
+var percentRegexp = regexp.MustCompile(`(\d{1,3})%\s*(.*)$`)
+
+// bundleUpdater installs a bundle, a path on the host or a URL, with a tool printing its progress as percentages
+type bundleUpdater struct {
+	name    string
+	command []string
+}
+
+func (updater *bundleUpdater) Name() string {
+	return updater.name
+}
+
+func (updater *bundleUpdater) ValidateArtifact(artifact string) error {
+	if artifact == "" || strings.HasPrefix(artifact, "-") || strings.ContainsAny(artifact, " \t\n") {
+		return fmt.Errorf("invalid %s bundle: %q", updater.name, artifact)
+	}
+
+	return nil
+}
+
+func (updater *bundleUpdater) Install(ctx context.Context, run CommandRunner, artifact string, progress ProgressFunc) error {
+	cmd := append(append([]string{}, updater.command...), artifact)
+
+	return run(ctx, cmd, func(line string) {
+		match := percentRegexp.FindStringSubmatch(line)
+		if match == nil {
+			return
+		}
+
+		percent, err := strconv.Atoi(match[1])
+		if err != nil || percent > 100 {
+			return
+		}
+
+		progress(percent, strings.TrimSpace(match[2]))
+	})
+}
+
+// aptStatusRegexp matches the status lines written by apt-get with APT::Status-Fd, e.g. "pmstatus:curl:42.8571:Unpacking curl"
+var aptStatusRegexp = regexp.MustCompile(`^(?:dl|pm)status:[^:]*:([\d.]+):(.*)$`)
+
+// aptPackageRegexp matches a Debian package name, optionally followed by a version or a release
+var aptPackageRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9+.\-]*([=/][A-Za-z0-9+.~:\-]+)?$`)
+
+// aptUpdater upgrades the packages listed in the artifact, separated by spaces, or all the packages when the
+// artifact is empty
+type aptUpdater struct{}
+
+func (updater *aptUpdater) Name() string {
+	return "apt"
+}
+
+func (updater *aptUpdater) ValidateArtifact(artifact string) error {
+	for _, pkg := range strings.Fields(artifact) {
+		if !aptPackageRegexp.MatchString(pkg) {
+			return fmt.Errorf("invalid package name: %q", pkg)
+		}
+	}
+
+	return nil
+}
+
+func (updater *aptUpdater) Install(ctx context.Context, run CommandRunner, artifact string, progress ProgressFunc) error {
+	progress(0, "Updating the package lists")
+
+	if err := run(ctx, []string{"apt-get", "update"}, func(string) {}); err != nil {
+		return err
+	}
+
+	cmd := []string{"env", "DEBIAN_FRONTEND=noninteractive", "apt-get", "-y", "-o", "APT::Status-Fd=1"}
+	if packages := strings.Fields(artifact); len(packages) > 0 {
+		cmd = append(append(cmd, "install", "--only-upgrade"), packages...)
+	} else {
+		cmd = append(cmd, "upgrade")
+	}
+
+	return run(ctx, cmd, func(line string) {
+		match := aptStatusRegexp.FindStringSubmatch(line)
+		if match == nil {
+			return
+		}
+
+		percent, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			return
+		}
+
+		progress(int(percent), match[2])
+	})
+}
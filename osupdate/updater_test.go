@@ -0,0 +1,107 @@
+package osupdate
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type progressUpdate struct {
+	percent int
+	message string
+}
+
+// fakeRunner records the executed commands and replays output for each of them
+func fakeRunner(output string, executed *[][]string) CommandRunner {
+	return func(ctx context.Context, cmd []string, onLine func(line string)) error {
+		*executed = append(*executed, cmd)
+
+		w := &lineWriter{onLine: onLine}
+		w.Write([]byte(output))
+		w.Flush()
+
+		return nil
+	}
+}
+
+func TestBundleUpdater_Install(t *testing.T) {
+	updater, err := Get("rauc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var executed [][]string
+	var updates []progressUpdate
+
+	output := "installing\n  0% Installing\r 40% Copying image to rootfs.1\r100% Installing done.\nInstalling `/tmp/update.raucb` succeeded\n"
+	err = updater.Install(context.Background(), fakeRunner(output, &executed), "/tmp/update.raucb", func(percent int, message string) {
+		updates = append(updates, progressUpdate{percent, message})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(executed, [][]string{{"rauc", "install", "/tmp/update.raucb"}}) {
+		t.Fatalf("unexpected commands: %v", executed)
+	}
+
+	expected := []progressUpdate{{0, "Installing"}, {40, "Copying image to rootfs.1"}, {100, "Installing done."}}
+	if !reflect.DeepEqual(updates, expected) {
+		t.Fatalf("expected %v, got %v", expected, updates)
+	}
+}
+
+func TestAptUpdater_Install(t *testing.T) {
+	updater, err := Get("apt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var executed [][]string
+	var updates []progressUpdate
+
+	output := "pmstatus:curl:20.5:Preparing curl\npmstatus:curl:75:Unpacking curl\n"
+	err = updater.Install(context.Background(), fakeRunner(output, &executed), "curl", func(percent int, message string) {
+		updates = append(updates, progressUpdate{percent, message})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(executed) != 2 || strings.Join(executed[1], " ") != "env DEBIAN_FRONTEND=noninteractive apt-get -y -o APT::Status-Fd=1 install --only-upgrade curl" {
+		t.Fatalf("unexpected commands: %v", executed)
+	}
+
+	expected := []progressUpdate{{0, "Updating the package lists"}, {20, "Preparing curl"}, {75, "Unpacking curl"}}
+	if !reflect.DeepEqual(updates, expected) {
+		t.Fatalf("expected %v, got %v", expected, updates)
+	}
+}
+
+func TestValidateArtifact(t *testing.T) {
+	tests := []struct {
+		updater  string
+		artifact string
+		valid    bool
+	}{
+		{"mender", "https://example.com/release.mender", true},
+		{"mender", "", false},
+		{"swupdate", "--help", false},
+		{"rauc", "/tmp/a b.raucb", false},
+		{"apt", "", true},
+		{"apt", "curl openssl=3.0.11-1", true},
+		{"apt", "-o Dpkg::Options", false},
+	}
+
+	for _, tt := range tests {
+		updater, err := Get(tt.updater)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := updater.ValidateArtifact(tt.artifact); (err == nil) != tt.valid {
+			t.Errorf("%s %q: expected valid=%t, got %v", tt.updater, tt.artifact, tt.valid, err)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package overlay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// CommandRunner executes a command on the host and returns its standard and error outputs
+	CommandRunner func(ctx context.Context, cmd []string) ([]byte, error)
+
+	// Client integrates an overlay networking client. Status returns the networks of the client by executing its
+	// commands with run, ControlCommand returns the command connecting or disconnecting network.
+	Client interface {
+		Name() string
+		Binary() string
+		Status(ctx context.Context, run CommandRunner) ([]Network, error)
+		ControlCommand(action, network string) ([]string, error)
+	}
+)
+
+var (
+	clients   = map[string]Client{}
+	clientsMu sync.RWMutex
+)
+
+func init() {
+	Register(&wireGuardClient{})
+	Register(&tailscaleClient{})
+	Register(&zeroTierClient{})
+}
+
+// Register makes a Client available under its name, replacing any client registered with the same name
+func Register(client Client) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	clients[client.Name()] = client
+}
+
+// Get returns the Client registered under name
+func Get(name string) (Client, error) {
+	clientsMu.RLock()
+	defer clientsMu.RUnlock()
+
+	client, ok := clients[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown overlay client %q", name)
+	}
+
+	return client, nil
+}
+
+// Clients returns the registered clients, sorted by name
+func Clients() []Client {
+	clientsMu.RLock()
+	defer clientsMu.RUnlock()
+
+	result := make([]Client, 0, len(clients))
+	for _, client := range clients {
+		result = append(result, client)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name() < result[j].Name() })
+
+	return result
+}
+
+func validateAction(action string) error {
+	if action != ActionConnect && action != ActionDisconnect {
+		return fmt.Errorf("invalid overlay network action %q", action)
+	}
+
+	return nil
+}
+
+// wireGuardHandshakeTimeout is the age of the last handshake after which a WireGuard peer is considered offline,
+// the peers exchanging traffic renew the handshake every two minutes
+const wireGuardHandshakeTimeout = 3 * time.Minute
+
+// wireGuardInterfaceRegexp matches the names of the network interfaces accepted by wg-quick
+var wireGuardInterfaceRegexp = regexp.MustCompile(`^[A-Za-z0-9_=+.-]{1,15}$`)
+
+// wireGuardClient reports the WireGuard interfaces and brings up or down the ones configured with wg-quick
+type wireGuardClient struct{}
+
+func (client *wireGuardClient) Name() string {
+	return "wireguard"
+}
+
+func (client *wireGuardClient) Binary() string {
+	return "wg"
+}
+
+func (client *wireGuardClient) Status(ctx context.Context, run CommandRunner) ([]Network, error) {
+	dump, err := run(ctx, []string{"wg", "show", "all", "dump"})
+	if err != nil {
+		return nil, err
+	}
+
+	addresses, err := run(ctx, []string{"ip", "-o", "address", "show"})
+	if err != nil {
+		return nil, err
+	}
+
+	return parseWireGuardDump(string(dump), parseInterfaceAddresses(string(addresses)), time.Now()), nil
+}
+
+func (client *wireGuardClient) ControlCommand(action, network string) ([]string, error) {
+	if err := validateAction(action); err != nil {
+		return nil, err
+	}
+
+	if !wireGuardInterfaceRegexp.MatchString(network) {
+		return nil, fmt.Errorf("invalid WireGuard interface %q", network)
+	}
+
+	if action == ActionConnect {
+		return []string{"wg-quick", "up", network}, nil
+	}
+
+	return []string{"wg-quick", "down", network}, nil
+}
+
+// parseWireGuardDump parses the output of wg show all dump. The interface lines are followed by the lines of their
+// peers, the private and preshared keys are never reported.
+func parseWireGuardDump(dump string, addresses map[string][]string, now time.Time) []Network {
+	networks := []Network{}
+	indexes := map[string]int{}
+
+	for _, line := range strings.Split(strings.TrimSpace(dump), "\n") {
+		fields := strings.Split(line, "\t")
+
+		switch len(fields) {
+		case 5:
+			indexes[fields[0]] = len(networks)
+			networks = append(networks, Network{Client: "wireguard", Name: fields[0], Addresses: addresses[fields[0]]})
+		case 9:
+			i, ok := indexes[fields[0]]
+			if !ok {
+				continue
+			}
+
+			peer := Peer{Name: fields[1]}
+			if fields[3] != "(none)" {
+				peer.Endpoint = fields[3]
+			}
+
+			if fields[4] != "(none)" {
+				peer.Addresses = strings.Split(fields[4], ",")
+			}
+
+			if seconds, err := strconv.ParseInt(fields[5], 10, 64); err == nil && seconds > 0 {
+				handshake := time.Unix(seconds, 0).UTC()
+				peer.LastHandshake = &handshake
+				peer.Online = now.Sub(handshake) < wireGuardHandshakeTimeout
+			}
+
+			networks[i].Peers = append(networks[i].Peers, peer)
+		}
+	}
+
+	// an interface is connected once a handshake was completed with one of its peers
+	for i := range networks {
+		networks[i].Connected = onlinePeers(networks[i].Peers) > 0
+	}
+
+	return networks
+}
+
+// parseInterfaceAddresses parses the output of ip -o address show and returns the addresses of each interface
+func parseInterfaceAddresses(output string) map[string][]string {
+	addresses := map[string][]string{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || (fields[2] != "inet" && fields[2] != "inet6") {
+			continue
+		}
+
+		addresses[fields[1]] = append(addresses[fields[1]], fields[3])
+	}
+
+	return addresses
+}
+
+// tailscaleClient reports the tailnet of the host and its peers
+type tailscaleClient struct{}
+
+type tailscaleNode struct {
+	HostName      string
+	DNSName       string
+	TailscaleIPs  []string
+	CurAddr       string
+	Relay         string
+	Online        bool
+	LastHandshake time.Time
+}
+
+type tailscaleStatus struct {
+	BackendState   string
+	Self           *tailscaleNode
+	Peer           map[string]*tailscaleNode
+	CurrentTailnet *struct {
+		Name string
+	}
+}
+
+func (client *tailscaleClient) Name() string {
+	return "tailscale"
+}
+
+func (client *tailscaleClient) Binary() string {
+	return "tailscale"
+}
+
+func (client *tailscaleClient) Status(ctx context.Context, run CommandRunner) ([]Network, error) {
+	output, err := run(ctx, []string{"tailscale", "status", "--json"})
+	if err != nil {
+		return nil, err
+	}
+
+	network, err := parseTailscaleStatus(output)
+	if err != nil {
+		return nil, err
+	}
+
+	return []Network{network}, nil
+}
+
+// ControlCommand brings the tailnet up or down, the host is part of a single tailnet so network must be empty
+func (client *tailscaleClient) ControlCommand(action, network string) ([]string, error) {
+	if err := validateAction(action); err != nil {
+		return nil, err
+	}
+
+	if network != "" {
+		return nil, fmt.Errorf("invalid Tailscale network %q, the host is part of a single tailnet", network)
+	}
+
+	if action == ActionConnect {
+		return []string{"tailscale", "up"}, nil
+	}
+
+	return []string{"tailscale", "down"}, nil
+}
+
+func parseTailscaleStatus(output []byte) (Network, error) {
+	var status tailscaleStatus
+	if err := json.Unmarshal(output, &status); err != nil {
+		return Network{}, fmt.Errorf("unable to parse the Tailscale status: %w", err)
+	}
+
+	network := Network{
+		Client:    "tailscale",
+		Name:      "tailnet",
+		Connected: status.BackendState == "Running",
+	}
+
+	if status.CurrentTailnet != nil && status.CurrentTailnet.Name != "" {
+		network.Name = status.CurrentTailnet.Name
+	}
+
+	if status.Self != nil {
+		network.Addresses = status.Self.TailscaleIPs
+	}
+
+	for _, node := range status.Peer {
+		peer := Peer{
+			Name:      node.HostName,
+			Endpoint:  node.CurAddr,
+			Addresses: node.TailscaleIPs,
+			Online:    node.Online,
+		}
+
+		// the peers relayed through DERP have no direct address
+		if peer.Endpoint == "" && node.Relay != "" {
+			peer.Endpoint = "derp:" + node.Relay
+		}
+
+		if !node.LastHandshake.IsZero() {
+			handshake := node.LastHandshake
+			peer.LastHandshake = &handshake
+		}
+
+		network.Peers = append(network.Peers, peer)
+	}
+
+	sort.Slice(network.Peers, func(i, j int) bool { return network.Peers[i].Name < network.Peers[j].Name })
+
+	return network, nil
+}
+
+// zeroTierNetworkRegexp matches the 16 hexadecimal digits identifying a ZeroTier network
+var zeroTierNetworkRegexp = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// zeroTierClient reports the ZeroTier networks joined by the host, and joins or leaves them
+type zeroTierClient struct{}
+
+type zeroTierNetwork struct {
+	ID                string   `json:"nwid"`
+	Status            string   `json:"status"`
+	AssignedAddresses []string `json:"assignedAddresses"`
+}
+
+func (client *zeroTierClient) Name() string {
+	return "zerotier"
+}
+
+func (client *zeroTierClient) Binary() string {
+	return "zerotier-cli"
+}
+
+func (client *zeroTierClient) Status(ctx context.Context, run CommandRunner) ([]Network, error) {
+	output, err := run(ctx, []string{"zerotier-cli", "-j", "listnetworks"})
+	if err != nil {
+		return nil, err
+	}
+
+	return parseZeroTierNetworks(output)
+}
+
+func (client *zeroTierClient) ControlCommand(action, network string) ([]string, error) {
+	if err := validateAction(action); err != nil {
+		return nil, err
+	}
+
+	if !zeroTierNetworkRegexp.MatchString(network) {
+		return nil, fmt.Errorf("invalid ZeroTier network %q", network)
+	}
+
+	if action == ActionConnect {
+		return []string{"zerotier-cli", "join", network}, nil
+	}
+
+	return []string{"zerotier-cli", "leave", network}, nil
+}
+
+// parseZeroTierNetworks parses the output of zerotier-cli -j listnetworks, the networks are named after their
+// identifier as the name is only known once the controller authorized the host
+func parseZeroTierNetworks(output []byte) ([]Network, error) {
+	var ztNetworks []zeroTierNetwork
+	if err := json.Unmarshal(output, &ztNetworks); err != nil {
+		return nil, fmt.Errorf("unable to parse the ZeroTier networks: %w", err)
+	}
+
+	networks := make([]Network, 0, len(ztNetworks))
+	for _, ztNetwork := range ztNetworks {
+		networks = append(networks, Network{
+			Client:    "zerotier",
+			Name:      ztNetwork.ID,
+			Connected: ztNetwork.Status == "OK",
+			Addresses: ztNetwork.AssignedAddresses,
+		})
+	}
+
+	return networks, nil
+}
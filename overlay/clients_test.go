@@ -0,0 +1,126 @@
+package overlay
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseWireGuardDump(t *testing.T) {
+	dump := "wg0\tcHJpdmF0ZQ==\tcHVibGlj\t51820\toff\n" +
+		"wg0\tcGVlcjE=\t(none)\t203.0.113.10:51820\t10.8.0.1/32,10.8.1.0/24\t1700000000\t1024\t2048\t25\n" +
+		"wg0\tcGVlcjI=\t(none)\t(none)\t10.8.0.3/32\t0\t0\t0\toff\n" +
+		"wg1\tcHJpdmF0ZTI=\tcHVibGljMg==\t51821\toff\n"
+
+	addresses := parseInterfaceAddresses("1: lo    inet 127.0.0.1/8 scope host lo\\       valid_lft forever preferred_lft forever\n" +
+		"5: wg0    inet 10.8.0.2/24 scope global wg0\\       valid_lft forever preferred_lft forever\n")
+
+	now := time.Unix(1700000060, 0)
+	handshake := time.Unix(1700000000, 0).UTC()
+
+	expected := []Network{
+		{
+			Client:    "wireguard",
+			Name:      "wg0",
+			Connected: true,
+			Addresses: []string{"10.8.0.2/24"},
+			Peers: []Peer{
+				{Name: "cGVlcjE=", Endpoint: "203.0.113.10:51820", Addresses: []string{"10.8.0.1/32", "10.8.1.0/24"}, Online: true, LastHandshake: &handshake},
+				{Name: "cGVlcjI=", Addresses: []string{"10.8.0.3/32"}},
+			},
+		},
+		{Client: "wireguard", Name: "wg1"},
+	}
+
+	networks := parseWireGuardDump(dump, addresses, now)
+	if !reflect.DeepEqual(networks, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, networks)
+	}
+
+	diagnostics := Diagnostics(networks)
+	if !reflect.DeepEqual(diagnostics, []string{"wireguard network wg1 is disconnected"}) {
+		t.Errorf("unexpected diagnostics %v", diagnostics)
+	}
+}
+
+func TestParseTailscaleStatus(t *testing.T) {
+	output := []byte(`{
+		"BackendState": "Running",
+		"Self": {"HostName": "gateway", "TailscaleIPs": ["100.64.0.1", "fd7a:115c:a1e0::1"]},
+		"Peer": {
+			"nodekey:b": {"HostName": "server", "TailscaleIPs": ["100.64.0.2"], "CurAddr": "198.51.100.4:41641", "Online": true, "LastHandshake": "2024-03-05T10:15:30Z"},
+			"nodekey:a": {"HostName": "laptop", "TailscaleIPs": ["100.64.0.3"], "Relay": "fra", "Online": false, "LastHandshake": "0001-01-01T00:00:00Z"}
+		},
+		"CurrentTailnet": {"Name": "example.com"}
+	}`)
+
+	network, err := parseTailscaleStatus(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handshake := time.Date(2024, 3, 5, 10, 15, 30, 0, time.UTC)
+	expected := Network{
+		Client:    "tailscale",
+		Name:      "example.com",
+		Connected: true,
+		Addresses: []string{"100.64.0.1", "fd7a:115c:a1e0::1"},
+		Peers: []Peer{
+			{Name: "laptop", Endpoint: "derp:fra", Addresses: []string{"100.64.0.3"}},
+			{Name: "server", Endpoint: "198.51.100.4:41641", Addresses: []string{"100.64.0.2"}, Online: true, LastHandshake: &handshake},
+		},
+	}
+
+	if !reflect.DeepEqual(network, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, network)
+	}
+}
+
+func TestParseZeroTierNetworks(t *testing.T) {
+	output := []byte(`[
+		{"nwid": "8056c2e21c000001", "name": "earth", "status": "OK", "assignedAddresses": ["10.147.17.5/24"]},
+		{"nwid": "a09acf0233e4b070", "name": "", "status": "ACCESS_DENIED", "assignedAddresses": []}
+	]`)
+
+	networks, err := parseZeroTierNetworks(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Network{
+		{Client: "zerotier", Name: "8056c2e21c000001", Connected: true, Addresses: []string{"10.147.17.5/24"}},
+		{Client: "zerotier", Name: "a09acf0233e4b070", Addresses: []string{}},
+	}
+
+	if !reflect.DeepEqual(networks, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, networks)
+	}
+}
+
+func TestControlCommand(t *testing.T) {
+	tests := []struct {
+		client, action, network string
+		expected                []string
+	}{
+		{"wireguard", ActionConnect, "wg0", []string{"wg-quick", "up", "wg0"}},
+		{"wireguard", ActionDisconnect, "wg0; reboot", nil},
+		{"tailscale", ActionDisconnect, "", []string{"tailscale", "down"}},
+		{"tailscale", ActionConnect, "other", nil},
+		{"zerotier", ActionConnect, "8056c2e21c000001", []string{"zerotier-cli", "join", "8056c2e21c000001"}},
+		{"zerotier", "restart", "8056c2e21c000001", nil},
+	}
+
+	for _, test := range tests {
+		client, err := Get(test.client)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cmd, err := client.ControlCommand(test.action, test.network)
+		if test.expected == nil && err == nil {
+			t.Errorf("expected an error for %s %s %q", test.client, test.action, test.network)
+		} else if !reflect.DeepEqual(cmd, test.expected) {
+			t.Errorf("expected %v for %s %s %q, got %v", test.expected, test.client, test.action, test.network, cmd)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package overlay
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Actions applied to an overlay network
+const (
+	ActionConnect    = "connect"
+	ActionDisconnect = "disconnect"
+)
+
+// statusCacheDuration is the duration during which the status of the networks is reused, each collection runs a
+// container on the host per client
+const statusCacheDuration = time.Minute
+
+var (
+	// ErrDisabled is returned when the overlay networks are managed while the agent cannot run host commands
+	ErrDisabled = errors.New("the overlay networks cannot be managed on this agent")
+	// ErrClientNotInstalled is returned when the overlay client is not installed on the host
+	ErrClientNotInstalled = errors.New("the overlay client is not installed on the host")
+)
+
+var (
+	// hostRoot is where the host filesystem is mounted in the agent container
+	hostRoot = agent.HostRoot
+	// binaryPaths are the folders of the host searched for the binaries of the clients
+	binaryPaths = []string{"/usr/local/sbin", "/usr/local/bin", "/usr/sbin", "/usr/bin", "/sbin", "/bin"}
+)
+
+var (
+	defaultService   *Service
+	defaultServiceMu sync.Mutex
+)
+
+// Network represents an overlay network the host is part of, a WireGuard interface, a tailnet or a ZeroTier network
+type Network struct {
+	Client    string   `json:"Client"`
+	Name      string   `json:"Name"`
+	Connected bool     `json:"Connected"`
+	Addresses []string `json:"Addresses,omitempty"`
+	Peers     []Peer   `json:"Peers,omitempty"`
+	// Error is the reason why the status of the client could not be retrieved
+	Error string `json:"Error,omitempty"`
+}
+
+// Peer represents a remote node of an overlay network
+type Peer struct {
+	// Name is the host name of the node, or the public key of a WireGuard peer
+	Name      string   `json:"Name"`
+	Endpoint  string   `json:"Endpoint,omitempty"`
+	Addresses []string `json:"Addresses,omitempty"`
+	Online    bool     `json:"Online"`
+	// LastHandshake is nil when no handshake was ever completed with the peer
+	LastHandshake *time.Time `json:"LastHandshake,omitempty"`
+}
+
+// Service reports the status of the overlay clients installed on the host and connects or disconnects their networks
+type Service struct {
+	run       CommandRunner
+	mu        sync.Mutex
+	networks  []Network
+	checkedAt time.Time
+}
+
+// NewService returns a pointer to a Service executing the commands of the clients on the host with image, which
+// must provide nsenter
+func NewService(image string) *Service {
+	return &Service{
+		run: func(ctx context.Context, cmd []string) ([]byte, error) {
+			var output bytes.Buffer
+			err := docker.ExecHostCommand(ctx, image, cmd, &output)
+
+			return output.Bytes(), err
+		},
+	}
+}
+
+// Status returns the networks of the clients installed on the host, collected at most once per minute
+func (service *Service) Status(ctx context.Context) []Network {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	if service.networks != nil && time.Since(service.checkedAt) < statusCacheDuration {
+		return service.networks
+	}
+
+	networks := []Network{}
+	for _, client := range Clients() {
+		if !installed(client.Binary()) {
+			continue
+		}
+
+		clientNetworks, err := client.Status(ctx, service.run)
+		if err != nil {
+			log.Warn().Err(err).Str("client", client.Name()).Msg("unable to retrieve the status of the overlay client")
+
+			networks = append(networks, Network{Client: client.Name(), Error: err.Error()})
+
+			continue
+		}
+
+		networks = append(networks, clientNetworks...)
+	}
+
+	service.networks = networks
+	service.checkedAt = time.Now()
+
+	return networks
+}
+
+// Control connects or disconnects network with the client registered under clientName
+func (service *Service) Control(ctx context.Context, clientName, action, network string) error {
+	client, err := Get(clientName)
+	if err != nil {
+		return err
+	}
+
+	if !installed(client.Binary()) {
+		return ErrClientNotInstalled
+	}
+
+	cmd, err := client.ControlCommand(action, network)
+	if err != nil {
+		return err
+	}
+
+	log.Info().Str("client", clientName).Str("action", action).Str("network", network).Msg("updating the overlay network")
+
+	if output, err := service.run(ctx, cmd); err != nil {
+		return fmt.Errorf("%w: %s", err, bytes.TrimSpace(output))
+	}
+
+	// the next status reflects the change
+	service.mu.Lock()
+	service.networks = nil
+	service.mu.Unlock()
+
+	return nil
+}
+
+func installed(binary string) bool {
+	for _, path := range binaryPaths {
+		if _, err := os.Stat(filepath.Join(hostRoot, path, binary)); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Enable makes service the default service used by CurrentStatus, Control and Diagnostics
+func Enable(service *Service) {
+	defaultServiceMu.Lock()
+	defer defaultServiceMu.Unlock()
+
+	defaultService = service
+}
+
+func getDefaultService() *Service {
+	defaultServiceMu.Lock()
+	defer defaultServiceMu.Unlock()
+
+	return defaultService
+}
+
+// CurrentStatus returns the overlay networks reported by the default service, nil when no service is enabled
+func CurrentStatus(ctx context.Context) []Network {
+	service := getDefaultService()
+	if service == nil {
+		return nil
+	}
+
+	return service.Status(ctx)
+}
+
+// Control connects or disconnects a network with the default service, ErrDisabled is returned when no service is
+// enabled
+func Control(ctx context.Context, clientName, action, network string) error {
+	service := getDefaultService()
+	if service == nil {
+		return ErrDisabled
+	}
+
+	return service.Control(ctx, clientName, action, network)
+}
+
+// Diagnostics returns a diagnostic message for each disconnected network and each network whose peers are all
+// offline
+func Diagnostics(networks []Network) []string {
+	diagnostics := []string{}
+	for _, network := range networks {
+		switch {
+		case network.Error != "":
+			continue
+		case !network.Connected:
+			diagnostics = append(diagnostics, fmt.Sprintf("%s network %s is disconnected", network.Client, network.Name))
+		case len(network.Peers) > 0 && onlinePeers(network.Peers) == 0:
+			diagnostics = append(diagnostics, fmt.Sprintf("no peer of the %s network %s is reachable", network.Client, network.Name))
+		}
+	}
+
+	sort.Strings(diagnostics)
+
+	return diagnostics
+}
+
+func onlinePeers(peers []Peer) int {
+	online := 0
+	for _, peer := range peers {
+		if peer.Online {
+			online++
+		}
+	}
+
+	return online
+}
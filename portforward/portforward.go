@@ -0,0 +1,385 @@
+// Package portforward brokers temporary port-forwards to the TCP services of the devices of the local network of the
+// host, such as the web interface of a PLC or the administration page of a printer, through the tunnel of the agent.
+// A session authorizes the connections to a single target of the allowed networks for a limited duration, the
+// number of sessions and of connections per session is bounded and the sessions are recorded in the audit trail.
+package portforward
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/portainer/agent/audit"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// ErrDisabled is returned when a port-forward is requested while the port_forward operation is not allowed
+	ErrDisabled = errors.New("the port forwarding is not enabled on this agent")
+	// ErrSessionNotFound is returned when the session does not exist, it expired or it was closed
+	ErrSessionNotFound = errors.New("port-forward session not found")
+	// ErrSessionLimit is returned when a session is opened while the maximum number of sessions is reached
+	ErrSessionLimit = errors.New("the maximum number of port-forward sessions is reached")
+	// ErrConnectionLimit is returned when a connection is opened while the session has its maximum number of
+	// connections
+	ErrConnectionLimit = errors.New("the maximum number of connections of the port-forward session is reached")
+	// ErrTargetNotAllowed is returned when the target does not belong to the allowed networks
+	ErrTargetNotAllowed = errors.New("the target does not belong to the networks allowed for the port forwarding")
+
+	errExpired = errors.New("the port-forward session expired")
+)
+
+const (
+	// maxConnections is the maximum number of concurrent connections of a session, enough for a browser loading a
+	// web interface
+	maxConnections = 32
+	dialTimeout    = 10 * time.Second
+)
+
+var (
+	defaultBroker   *Broker
+	defaultBrokerMu sync.Mutex
+)
+
+// Session is a port-forward authorizing the connections to a target until it expires
+type Session struct {
+	ID     string `json:"Id"`
+	Target string `json:"Target"`
+	User   string `json:"User,omitempty"`
+	// Connections is the number of open connections, TotalConnections the number of connections since the start
+	Connections      int       `json:"Connections"`
+	TotalConnections int       `json:"TotalConnections"`
+	BytesSent        int64     `json:"BytesSent"`
+	BytesReceived    int64     `json:"BytesReceived"`
+	CreatedAt        time.Time `json:"CreatedAt"`
+	ExpiresAt        time.Time `json:"ExpiresAt"`
+}
+
+type session struct {
+	info  Session
+	audit *audit.Session
+	timer *time.Timer
+	conns map[*conn]struct{}
+
+	bytesSent     int64
+	bytesReceived int64
+}
+
+// Broker opens the port-forward sessions and the connections to their targets
+type Broker struct {
+	networks    []*net.IPNet
+	maxSessions int
+	maxDuration time.Duration
+	lookup      func(ctx context.Context, host string) ([]net.IPAddr, error)
+	dial        func(ctx context.Context, address string) (net.Conn, error)
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// NewBroker returns a pointer to a Broker forwarding to the targets of networks, a list of CIDR ranges, with at most
+// maxSessions concurrent sessions lasting at most maxDuration each
+func NewBroker(networks []string, maxSessions int, maxDuration time.Duration) (*Broker, error) {
+	ipNetworks, err := ParseNetworks(networks)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second}
+
+	return &Broker{
+		networks:    ipNetworks,
+		maxSessions: maxSessions,
+		maxDuration: maxDuration,
+		lookup:      net.DefaultResolver.LookupIPAddr,
+		dial: func(ctx context.Context, address string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "tcp", address)
+		},
+		sessions: map[string]*session{},
+	}, nil
+}
+
+// ParseNetworks parses a list of CIDR ranges
+func ParseNetworks(networks []string) ([]*net.IPNet, error) {
+	ipNetworks := make([]*net.IPNet, 0, len(networks))
+	for _, network := range networks {
+		_, ipNetwork, err := net.ParseCIDR(network)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port forwarding network %q: %w", network, err)
+		}
+
+		ipNetworks = append(ipNetworks, ipNetwork)
+	}
+
+	return ipNetworks, nil
+}
+
+// Enable makes broker the broker of the port-forwards requested through the agent API
+func Enable(broker *Broker) {
+	defaultBrokerMu.Lock()
+	defer defaultBrokerMu.Unlock()
+
+	defaultBroker = broker
+}
+
+// DefaultBroker returns the enabled broker, nil when the port forwarding is not enabled
+func DefaultBroker() *Broker {
+	defaultBrokerMu.Lock()
+	defer defaultBrokerMu.Unlock()
+
+	return defaultBroker
+}
+
+// Open opens a session forwarding to target, a host:port address of the allowed networks, for duration. The maximum
+// duration is used when duration is 0. user and remoteAddr are recorded in the audit trail.
+func (broker *Broker) Open(ctx context.Context, target string, duration time.Duration, user, remoteAddr string) (Session, error) {
+	if duration == 0 {
+		duration = broker.maxDuration
+	}
+
+	if duration < 0 || duration > broker.maxDuration {
+		return Session{}, fmt.Errorf("the duration of the port-forward session must be between 0 and %s", broker.maxDuration)
+	}
+
+	if _, err := broker.resolve(ctx, target); err != nil {
+		return Session{}, err
+	}
+
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	if len(broker.sessions) >= broker.maxSessions {
+		return Session{}, ErrSessionLimit
+	}
+
+	now := time.Now().UTC()
+	s := &session{
+		info: Session{
+			ID:        newSessionID(),
+			Target:    target,
+			User:      user,
+			CreatedAt: now,
+			ExpiresAt: now.Add(duration),
+		},
+		audit: audit.StartSession(audit.SessionPortForward, target, "", user, remoteAddr),
+		conns: map[*conn]struct{}{},
+	}
+
+	id := s.info.ID
+	s.timer = time.AfterFunc(duration, func() {
+		broker.close(id, errExpired)
+	})
+
+	broker.sessions[id] = s
+
+	log.Info().Str("session_id", id).Str("target", target).Str("user", user).Dur("duration", duration).Msg("port-forward session opened")
+
+	return s.info, nil
+}
+
+// Sessions returns the open sessions sorted by creation date
+func (broker *Broker) Sessions() []Session {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	sessions := make([]Session, 0, len(broker.sessions))
+	for _, s := range broker.sessions {
+		sessions = append(sessions, s.snapshot())
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+
+	return sessions
+}
+
+// Close closes the session and its connections
+func (broker *Broker) Close(id string) error {
+	if !broker.close(id, nil) {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// Dial opens a connection to the target of the session, the connection is closed when the session ends
+func (broker *Broker) Dial(ctx context.Context, id string) (net.Conn, error) {
+	broker.mu.Lock()
+	s, ok := broker.sessions[id]
+	if !ok {
+		broker.mu.Unlock()
+
+		return nil, ErrSessionNotFound
+	}
+
+	if len(s.conns) >= maxConnections {
+		broker.mu.Unlock()
+
+		return nil, ErrConnectionLimit
+	}
+	target := s.info.Target
+	broker.mu.Unlock()
+
+	// the target is resolved again for each connection, the addresses it resolves to may have changed since the
+	// session was opened
+	address, err := broker.resolve(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	netConn, err := broker.dial(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	// the session may have ended while dialing
+	if _, ok := broker.sessions[id]; !ok {
+		netConn.Close()
+
+		return nil, ErrSessionNotFound
+	}
+
+	c := &conn{Conn: netConn, broker: broker, session: s}
+	s.conns[c] = struct{}{}
+	s.info.TotalConnections++
+
+	return c, nil
+}
+
+// resolve returns the first address of target that belongs to the allowed networks
+func (broker *Broker) resolve(ctx context.Context, target string) (string, error) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return "", fmt.Errorf("invalid target %q: %w", target, err)
+	}
+
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return "", fmt.Errorf("invalid port of the target %q", target)
+	}
+
+	var addrs []net.IPAddr
+	if ip := net.ParseIP(host); ip != nil {
+		addrs = []net.IPAddr{{IP: ip}}
+	} else {
+		addrs, err = broker.lookup(ctx, host)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	for _, addr := range addrs {
+		if broker.allowed(addr.IP) {
+			return net.JoinHostPort(addr.IP.String(), port), nil
+		}
+	}
+
+	return "", ErrTargetNotAllowed
+}
+
+func (broker *Broker) allowed(ip net.IP) bool {
+	for _, network := range broker.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// close ends the session, it returns false when the session does not exist
+func (broker *Broker) close(id string, reason error) bool {
+	broker.mu.Lock()
+	s, ok := broker.sessions[id]
+	if !ok {
+		broker.mu.Unlock()
+
+		return false
+	}
+
+	delete(broker.sessions, id)
+	s.timer.Stop()
+	info := s.snapshot()
+
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	broker.mu.Unlock()
+
+	for _, c := range conns {
+		c.Conn.Close()
+	}
+
+	s.audit.End(reason)
+
+	log.Info().Str("session_id", id).Str("target", info.Target).
+		Int("connections", info.TotalConnections).
+		Int64("bytes_sent", info.BytesSent).
+		Int64("bytes_received", info.BytesReceived).
+		AnErr("reason", reason).
+		Msg("port-forward session closed")
+
+	return true
+}
+
+// snapshot returns the state of the session, the lock of the broker must be held
+func (s *session) snapshot() Session {
+	info := s.info
+	info.Connections = len(s.conns)
+	info.BytesSent = atomic.LoadInt64(&s.bytesSent)
+	info.BytesReceived = atomic.LoadInt64(&s.bytesReceived)
+
+	return info
+}
+
+// conn is a connection of a session, counting the bytes sent to and received from the target
+type conn struct {
+	net.Conn
+	broker  *Broker
+	session *session
+	once    sync.Once
+}
+
+func (c *conn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	atomic.AddInt64(&c.session.bytesReceived, int64(n))
+
+	return n, err
+}
+
+func (c *conn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	atomic.AddInt64(&c.session.bytesSent, int64(n))
+
+	return n, err
+}
+
+func (c *conn) Close() error {
+	c.once.Do(func() {
+		c.broker.mu.Lock()
+		delete(c.session.conns, c)
+		c.broker.mu.Unlock()
+	})
+
+	return c.Conn.Close()
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
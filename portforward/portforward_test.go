@@ -0,0 +1,172 @@
+package portforward
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func echoServer(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			c, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer c.Close()
+				io.Copy(c, c)
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestBrokerForwardsToTheTarget(t *testing.T) {
+	target := echoServer(t)
+
+	broker, err := NewBroker([]string{"127.0.0.0/8"}, 2, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := broker.Open(context.Background(), target, 0, "admin", "10.0.0.1:1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := session.ExpiresAt.Sub(session.CreatedAt); got != time.Hour {
+		t.Errorf("expected the session to last the maximum duration, got %s", got)
+	}
+
+	c, err := broker.Dial(context.Background(), session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(c, reply); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(reply) != "ping" {
+		t.Errorf("expected the echo of the target, got %q", reply)
+	}
+
+	sessions := broker.Sessions()
+	if len(sessions) != 1 || sessions[0].Connections != 1 || sessions[0].BytesSent != 4 || sessions[0].BytesReceived != 4 {
+		t.Errorf("unexpected sessions: %+v", sessions)
+	}
+
+	c.Close()
+
+	if sessions := broker.Sessions(); sessions[0].Connections != 0 || sessions[0].TotalConnections != 1 {
+		t.Errorf("expected the connection to be closed, got %+v", sessions)
+	}
+
+	if err := broker.Close(session.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := broker.Dial(context.Background(), session.ID); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("expected ErrSessionNotFound after the session is closed, got %v", err)
+	}
+}
+
+func TestBrokerRejectsTheTargetsOutsideTheAllowedNetworks(t *testing.T) {
+	broker, err := NewBroker([]string{"192.168.0.0/16"}, 2, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker.lookup = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		return []net.IPAddr{{IP: net.ParseIP("10.1.2.3")}}, nil
+	}
+
+	for _, target := range []string{"10.0.0.1:80", "plc.local:80"} {
+		if _, err := broker.Open(context.Background(), target, 0, "", ""); !errors.Is(err, ErrTargetNotAllowed) {
+			t.Errorf("expected ErrTargetNotAllowed for %s, got %v", target, err)
+		}
+	}
+
+	for _, target := range []string{"192.168.1.10", "192.168.1.10:0", "192.168.1.10:http"} {
+		if _, err := broker.Open(context.Background(), target, 0, "", ""); err == nil {
+			t.Errorf("expected an error for the invalid target %s", target)
+		}
+	}
+
+	if _, err := broker.Open(context.Background(), "192.168.1.10:80", 2*time.Hour, "", ""); err == nil {
+		t.Error("expected an error for a duration exceeding the maximum")
+	}
+}
+
+func TestBrokerLimitsTheSessions(t *testing.T) {
+	broker, err := NewBroker([]string{"192.168.0.0/16"}, 1, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := broker.Open(context.Background(), "192.168.1.10:80", 0, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := broker.Open(context.Background(), "192.168.1.11:80", 0, "", ""); !errors.Is(err, ErrSessionLimit) {
+		t.Errorf("expected ErrSessionLimit, got %v", err)
+	}
+}
+
+func TestBrokerClosesTheExpiredSessions(t *testing.T) {
+	target := echoServer(t)
+
+	broker, err := NewBroker([]string{"127.0.0.0/8"}, 1, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := broker.Open(context.Background(), target, 50*time.Millisecond, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := broker.Dial(context.Background(), session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.Read(make([]byte, 1)); err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("expected the connection to be closed when the session expires, got %v", err)
+	}
+
+	if sessions := broker.Sessions(); len(sessions) != 0 {
+		t.Errorf("expected the expired session to be removed, got %+v", sessions)
+	}
+}
+
+func TestParseNetworks(t *testing.T) {
+	if _, err := ParseNetworks([]string{"10.0.0.0/8", "fe80::/10"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseNetworks([]string{"10.0.0.1"}); err == nil {
+		t.Error("expected an error for an address without prefix length")
+	}
+}
@@ -0,0 +1,21 @@
+//go:build linux
+// +build linux
+
+package posture
+
+import "syscall"
+
+// prSetNoNewPrivs is the prctl option preventing the process and its children from gaining privileges through execve
+const prSetNoNewPrivs = 38
+
+// setNoNewPrivileges prevents the agent and the processes it executes from gaining privileges, e.g. through setuid
+// binaries. no_new_privs is an attribute of the threads, it is set on every thread of the agent and inherited by the
+// threads created afterwards. ENOTSUP is returned when the agent is built with cgo.
+func setNoNewPrivileges() error {
+	_, _, errno := syscall.AllThreadsSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0)
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
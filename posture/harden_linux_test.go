@@ -0,0 +1,44 @@
+//go:build linux
+// +build linux
+
+package posture
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+func TestSetNoNewPrivilegesAllThreads(t *testing.T) {
+	// threads are started before no_new_privs is set, it must be set on them as well
+	var started, release sync.WaitGroup
+	release.Add(1)
+
+	for i := 0; i < 4; i++ {
+		started.Add(1)
+
+		go func() {
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+
+			started.Done()
+			release.Wait()
+		}()
+	}
+
+	started.Wait()
+	defer release.Done()
+
+	err := setNoNewPrivileges()
+	if errors.Is(err, syscall.ENOTSUP) {
+		t.Skip("no_new_privs cannot be set on every thread with cgo, e.g. with the race detector")
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	if !threadsNoNewPrivileges() {
+		t.Error("expected no_new_privs to be set on every thread")
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package posture
+
+// setNoNewPrivileges is a no-op on the platforms without no_new_privs
+func setNoNewPrivileges() error {
+	return nil
+}
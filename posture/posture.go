@@ -0,0 +1,351 @@
+// Package posture reports the privilege posture of the agent container (capabilities, seccomp and AppArmor
+// confinement, access to the Docker socket) so that auditors can verify that the agent runs with the least privilege,
+// and ships the hardened seccomp and AppArmor profiles of the agent container.
+package posture
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/broker"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// SeccompProfileFileName is the name of the file the seccomp profile is written to
+	SeccompProfileFileName = "portainer-agent-seccomp.json"
+	// AppArmorProfileFileName is the name of the file the AppArmor profile is written to
+	AppArmorProfileFileName = "portainer-agent-apparmor"
+	// AppArmorProfileName is the name of the AppArmor profile loaded in the kernel
+	AppArmorProfileName = "portainer-agent"
+)
+
+const (
+	// SeccompDisabled means that the system calls of the agent are not filtered
+	SeccompDisabled = "disabled"
+	// SeccompStrict means that the agent only has access to read, write, exit and sigreturn
+	SeccompStrict = "strict"
+	// SeccompFilter means that the system calls of the agent are filtered by a seccomp profile
+	SeccompFilter = "filter"
+)
+
+//go:embed profiles/seccomp.json
+var seccompProfile []byte
+
+//go:embed profiles/apparmor
+var apparmorProfile []byte
+
+// procSelf is the proc directory of the agent process, replaced by the tests
+var procSelf = "/proc/self"
+
+// capabilityNames are the names of the Linux capabilities, indexed by their number
+var capabilityNames = []string{
+	"CHOWN", "DAC_OVERRIDE", "DAC_READ_SEARCH", "FOWNER", "FSETID", "KILL", "SETGID", "SETUID", "SETPCAP",
+	"LINUX_IMMUTABLE", "NET_BIND_SERVICE", "NET_BROADCAST", "NET_ADMIN", "NET_RAW", "IPC_LOCK", "IPC_OWNER",
+	"SYS_MODULE", "SYS_RAWIO", "SYS_CHROOT", "SYS_PTRACE", "SYS_PACCT", "SYS_ADMIN", "SYS_BOOT", "SYS_NICE",
+	"SYS_RESOURCE", "SYS_TIME", "SYS_TTY_CONFIG", "MKNOD", "LEASE", "AUDIT_WRITE", "AUDIT_CONTROL", "SETFCAP",
+	"MAC_OVERRIDE", "MAC_ADMIN", "SYSLOG", "WAKE_ALARM", "BLOCK_SUSPEND", "AUDIT_READ", "PERFMON", "BPF",
+	"CHECKPOINT_RESTORE",
+}
+
+// neededCapabilities are the capabilities granted by default to the Docker containers, the agent does not need any
+// other capability
+var neededCapabilities = map[string]bool{
+	"CHOWN": true, "DAC_OVERRIDE": true, "FOWNER": true, "FSETID": true, "KILL": true, "SETGID": true, "SETUID": true,
+	"SETPCAP": true, "NET_BIND_SERVICE": true, "NET_RAW": true, "SYS_CHROOT": true, "MKNOD": true,
+	"AUDIT_WRITE": true, "SETFCAP": true,
+}
+
+// privilegedCapabilityCount is the number of capabilities, up to AUDIT_READ, granted to the privileged containers by
+// every kernel supported by Docker
+const privilegedCapabilityCount = 38
+
+var (
+	current   *Posture
+	currentMu sync.Mutex
+)
+
+// Posture is the privilege posture of the agent process
+type Posture struct {
+	UID int `json:"UID"`
+	// Capabilities are the effective capabilities of the agent
+	Capabilities []string `json:"Capabilities"`
+	// UnneededCapabilities are the effective capabilities that are not granted by default to the Docker containers
+	UnneededCapabilities []string `json:"UnneededCapabilities,omitempty"`
+	// Privileged is true when the agent has every capability, e.g. in a privileged container
+	Privileged bool `json:"Privileged"`
+	// Seccomp is the seccomp mode of the agent: disabled, strict or filter
+	Seccomp         string `json:"Seccomp"`
+	NoNewPrivileges bool   `json:"NoNewPrivileges"`
+	// AppArmor is the AppArmor profile confining the agent, empty when AppArmor is not enabled on the host
+	AppArmor       string `json:"AppArmor,omitempty"`
+	ReadOnlyRootFS bool   `json:"ReadOnlyRootFS"`
+	// DockerSocket is true when the Docker socket is mounted in the agent container
+	DockerSocket bool `json:"DockerSocket"`
+	// DockerBroker is true when the agent talks to the Docker daemon through the Docker broker
+	DockerBroker bool `json:"DockerBroker"`
+}
+
+// WriteProfiles writes the seccomp and the AppArmor profiles of the agent container inside dir
+func WriteProfiles(dir string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(filepath.Join(dir, SeccompProfileFileName), seccompProfile, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, AppArmorProfileFileName), apparmorProfile, 0644)
+}
+
+// Harden prevents the agent and the processes it executes from gaining privileges (no_new_privs) unless mode is off. It
+// must be called as early as possible, before the agent executes any process.
+func Harden(mode string) {
+	if mode == agent.PrivilegeCheckOff {
+		return
+	}
+
+	if err := setNoNewPrivileges(); err != nil {
+		log.Warn().Err(err).Msg("unable to prevent the agent from gaining privileges")
+	}
+}
+
+// Check collects the posture of the agent process, hardened by Harden, and warns about the capabilities the agent
+// does not need. An error is returned when mode is enforce and the agent has unneeded capabilities or its posture
+// cannot be collected. The posture is only collected on Linux, nil is returned on the other platforms.
+func Check(mode string) (*Posture, error) {
+	if runtime.GOOS != "linux" {
+		return nil, nil
+	}
+
+	posture, err := Collect()
+	if err != nil {
+		if mode == agent.PrivilegeCheckEnforce {
+			return nil, err
+		}
+
+		log.Warn().Err(err).Msg("unable to collect the privilege posture of the agent")
+
+		return nil, nil
+	}
+
+	Enable(posture)
+
+	if mode == agent.PrivilegeCheckOff || len(posture.UnneededCapabilities) == 0 {
+		return posture, nil
+	}
+
+	if mode == agent.PrivilegeCheckEnforce {
+		return posture, fmt.Errorf("the agent has the unneeded capabilities %s, drop them from the agent container", strings.Join(posture.UnneededCapabilities, ", "))
+	}
+
+	log.Warn().Strs("capabilities", posture.UnneededCapabilities).Bool("privileged", posture.Privileged).Msg("the agent has capabilities it does not need, drop them from the agent container")
+
+	return posture, nil
+}
+
+// Collect returns the privilege posture of the agent process
+func Collect() (*Posture, error) {
+	status, err := readStatus(filepath.Join(procSelf, "status"))
+	if err != nil {
+		return nil, err
+	}
+
+	posture := &Posture{
+		UID:             os.Getuid(),
+		Seccomp:         SeccompDisabled,
+		NoNewPrivileges: status["NoNewPrivs"] == "1" && threadsNoNewPrivileges(),
+		AppArmor:        appArmorProfile(),
+		ReadOnlyRootFS:  readOnlyRootFS(filepath.Join(procSelf, "mountinfo")),
+		DockerBroker:    broker.DockerSocketPath() != broker.DefaultDockerSocketPath,
+	}
+
+	switch status["Seccomp"] {
+	case "1":
+		posture.Seccomp = SeccompStrict
+	case "2":
+		posture.Seccomp = SeccompFilter
+	}
+
+	capabilities, err := strconv.ParseUint(status["CapEff"], 16, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid effective capabilities %q: %w", status["CapEff"], err)
+	}
+
+	posture.Capabilities, posture.UnneededCapabilities, posture.Privileged = parseCapabilities(capabilities)
+
+	if _, err := os.Stat(broker.DefaultDockerSocketPath); err == nil {
+		posture.DockerSocket = true
+	}
+
+	return posture, nil
+}
+
+// Enable makes posture the posture reported in the snapshots
+func Enable(posture *Posture) {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+
+	current = posture
+}
+
+// Current returns the posture collected when the agent started, nil when it was not collected
+func Current() *Posture {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+
+	return current
+}
+
+// Diagnostics returns the weaknesses of the posture
+func (posture *Posture) Diagnostics() []string {
+	if posture == nil {
+		return nil
+	}
+
+	var diagnostics []string
+
+	if posture.Privileged {
+		diagnostics = append(diagnostics, "the agent runs in a privileged container")
+	} else if len(posture.UnneededCapabilities) > 0 {
+		diagnostics = append(diagnostics, "the agent has the unneeded capabilities "+strings.Join(posture.UnneededCapabilities, ", "))
+	}
+
+	if posture.Seccomp == SeccompDisabled {
+		diagnostics = append(diagnostics, "the agent runs without a seccomp profile")
+	}
+
+	if posture.AppArmor == "unconfined" {
+		diagnostics = append(diagnostics, "the agent runs without an AppArmor profile")
+	}
+
+	return diagnostics
+}
+
+// readStatus returns the fields of the proc status file at path
+// threadsNoNewPrivileges returns true when no_new_privs is set on every thread of the agent, it is an attribute of the
+// threads and the status of the process only reports the one of the main thread
+func threadsNoNewPrivileges() bool {
+	paths, err := filepath.Glob(filepath.Join(procSelf, "task", "*", "status"))
+	if err != nil {
+		return false
+	}
+
+	for _, path := range paths {
+		status, err := readStatus(path)
+		if errors.Is(err, os.ErrNotExist) {
+			// the thread exited
+			continue
+		} else if err != nil || status["NoNewPrivs"] != "1" {
+			return false
+		}
+	}
+
+	return true
+}
+
+func readStatus(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	status := map[string]string{}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if found {
+			status[key] = strings.TrimSpace(value)
+		}
+	}
+
+	return status, scanner.Err()
+}
+
+// parseCapabilities returns the names of the capabilities of the mask, the ones that are not needed by the agent and
+// whether the mask contains every known capability
+func parseCapabilities(mask uint64) (capabilities, unneeded []string, all bool) {
+	all = true
+
+	for i, name := range capabilityNames {
+		if mask&(1<<uint(i)) == 0 {
+			all = all && i >= privilegedCapabilityCount
+
+			continue
+		}
+
+		capabilities = append(capabilities, name)
+		if !neededCapabilities[name] {
+			unneeded = append(unneeded, name)
+		}
+	}
+
+	sort.Strings(capabilities)
+	sort.Strings(unneeded)
+
+	return capabilities, unneeded, all
+}
+
+// appArmorProfile returns the AppArmor profile confining the agent, empty when AppArmor is not enabled
+func appArmorProfile() string {
+	for _, path := range []string{filepath.Join(procSelf, "attr", "apparmor", "current"), filepath.Join(procSelf, "attr", "current")} {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		// the label is formatted as "profile (mode)"
+		profile := strings.TrimSpace(strings.TrimRight(string(content), "\x00\n"))
+		if profile != "" {
+			return strings.TrimSuffix(strings.TrimSuffix(profile, " (enforce)"), " (complain)")
+		}
+	}
+
+	return ""
+}
+
+// readOnlyRootFS returns true when the root filesystem of the agent is mounted read-only according to the mountinfo
+// file at path
+func readOnlyRootFS(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	readOnly := false
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// the mount point and the mount options are the fifth and the sixth fields, the last mount on / wins
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || fields[4] != "/" {
+			continue
+		}
+
+		readOnly = false
+		for _, option := range strings.Split(fields[5], ",") {
+			if option == "ro" {
+				readOnly = true
+			}
+		}
+	}
+
+	return readOnly
+}
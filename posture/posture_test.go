@@ -0,0 +1,118 @@
+package posture
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCapabilities(t *testing.T) {
+	// the default capabilities of the Docker containers
+	capabilities, unneeded, all := parseCapabilities(0xa80425fb)
+	if len(capabilities) != 14 || len(unneeded) != 0 || all {
+		t.Errorf("expected the 14 default capabilities, got %v (unneeded %v, all %t)", capabilities, unneeded, all)
+	}
+
+	capabilities, unneeded, all = parseCapabilities(0xa82425fb | 1<<12)
+	if !reflect.DeepEqual(unneeded, []string{"NET_ADMIN", "SYS_ADMIN"}) || all || len(capabilities) != 16 {
+		t.Errorf("expected NET_ADMIN and SYS_ADMIN to be unneeded, got %v (all %t)", unneeded, all)
+	}
+
+	// a privileged container on a kernel older than PERFMON, BPF and CHECKPOINT_RESTORE
+	_, _, all = parseCapabilities(0x3fffffffff)
+	if !all {
+		t.Error("expected the container to be privileged")
+	}
+}
+
+func TestCollect(t *testing.T) {
+	dir := t.TempDir()
+	procSelf = dir
+	defer func() { procSelf = "/proc/self" }()
+
+	status := "Name:\tagent\nNoNewPrivs:\t1\nSeccomp:\t2\nCapEff:\t00000000a82425fb\n"
+	mountinfo := "22 1 0:21 / / rw,relatime - overlay overlay rw\n23 22 0:21 / / ro,relatime - overlay overlay rw\n24 23 0:22 / /proc rw - proc proc rw\n"
+
+	os.MkdirAll(filepath.Join(dir, "attr", "apparmor"), 0755)
+	os.MkdirAll(filepath.Join(dir, "task", "1"), 0755)
+	os.WriteFile(filepath.Join(dir, "task", "1", "status"), []byte(status), 0644)
+	os.WriteFile(filepath.Join(dir, "status"), []byte(status), 0644)
+	os.WriteFile(filepath.Join(dir, "mountinfo"), []byte(mountinfo), 0644)
+	os.WriteFile(filepath.Join(dir, "attr", "apparmor", "current"), []byte("portainer-agent (enforce)\n"), 0644)
+
+	posture, err := Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if posture.Seccomp != SeccompFilter || !posture.NoNewPrivileges || !posture.ReadOnlyRootFS || posture.AppArmor != AppArmorProfileName {
+		t.Errorf("unexpected posture %+v", posture)
+	}
+
+	diagnostics := posture.Diagnostics()
+	if len(diagnostics) != 1 || !strings.Contains(diagnostics[0], "SYS_ADMIN") {
+		t.Errorf("expected a diagnostic for SYS_ADMIN, got %v", diagnostics)
+	}
+
+	if (*Posture)(nil).Diagnostics() != nil {
+		t.Error("expected no diagnostics without a posture")
+	}
+
+	// no_new_privs is an attribute of the threads, a thread without it is reported
+	os.MkdirAll(filepath.Join(dir, "task", "2"), 0755)
+	os.WriteFile(filepath.Join(dir, "task", "2", "status"), []byte(strings.Replace(status, "NoNewPrivs:\t1", "NoNewPrivs:\t0", 1)), 0644)
+
+	posture, err = Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if posture.NoNewPrivileges {
+		t.Error("expected no_new_privs not to be reported when a thread does not have it")
+	}
+}
+
+func TestWriteProfiles(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := WriteProfiles(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, SeccompProfileFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var profile struct {
+		DefaultAction string
+		Syscalls      []struct {
+			Names  []string
+			Action string
+		}
+	}
+	if err := json.Unmarshal(content, &profile); err != nil {
+		t.Fatalf("invalid seccomp profile: %s", err)
+	}
+
+	denied := map[string]bool{}
+	for _, syscall := range profile.Syscalls {
+		for _, name := range syscall.Names {
+			denied[name] = syscall.Action == "SCMP_ACT_ERRNO"
+		}
+	}
+
+	for _, name := range []string{"mount", "kexec_load", "init_module", "ptrace", "bpf", "setns"} {
+		if !denied[name] {
+			t.Errorf("expected %s to be denied by the seccomp profile", name)
+		}
+	}
+
+	content, err = os.ReadFile(filepath.Join(dir, AppArmorProfileFileName))
+	if err != nil || !strings.Contains(string(content), "profile "+AppArmorProfileName+" ") {
+		t.Errorf("expected the AppArmor profile to be written, got %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package power
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apcupsdSource reads the status of a UPS from the network information server of apcupsd, whose records are
+// prefixed by their length
+type apcupsdSource struct {
+	address string
+}
+
+func (source *apcupsdSource) UPS() string {
+	return fmt.Sprintf("apcupsd %s", source.address)
+}
+
+func (source *apcupsdSource) Status(ctx context.Context) (*Status, error) {
+	dialer := &net.Dialer{}
+
+	conn, err := dialer.DialContext(ctx, "tcp", source.address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(sourceTimeout))
+	}
+
+	request := append([]byte{0, 6}, "status"...)
+	if _, err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	records := map[string]string{}
+	for {
+		var length uint16
+		if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+			return nil, err
+		}
+
+		if length == 0 {
+			break
+		}
+
+		record := make([]byte, length)
+		if _, err := io.ReadFull(conn, record); err != nil {
+			return nil, err
+		}
+
+		// STATUS   : ONBATT
+		key, value, ok := strings.Cut(string(record), ":")
+		if ok {
+			records[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+
+	return apcupsdStatus(records)
+}
+
+// apcupsdStatus returns the status of the UPS from the records reported by apcupsd
+func apcupsdStatus(records map[string]string) (*Status, error) {
+	flags, ok := records["STATUS"]
+	if !ok {
+		return nil, fmt.Errorf("the UPS does not report its status")
+	}
+
+	if strings.Contains(flags, "COMMLOST") {
+		return nil, fmt.Errorf("apcupsd lost the communication with the UPS")
+	}
+
+	status := &Status{}
+	for _, flag := range strings.Fields(flags) {
+		switch flag {
+		case "ONBATT":
+			status.OnBattery = true
+		case "LOWBATT":
+			status.LowBattery = true
+		}
+	}
+
+	// BCHARGE  : 100.0 Percent
+	if charge, err := strconv.ParseFloat(firstField(records["BCHARGE"]), 64); err == nil {
+		status.BatteryCharge = &charge
+	}
+
+	// TIMELEFT : 45.3 Minutes
+	if minutes, err := strconv.ParseFloat(firstField(records["TIMELEFT"]), 64); err == nil {
+		seconds := int(minutes * 60)
+		status.RuntimeSeconds = &seconds
+	}
+
+	return status, nil
+}
+
+func firstField(value string) string {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return ""
+	}
+
+	return fields[0]
+}
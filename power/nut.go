@@ -0,0 +1,126 @@
+package power
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// nutSource reads the status of a UPS from the upsd daemon of Network UPS Tools, with its line-based network
+// protocol
+type nutSource struct {
+	address  string
+	ups      string
+	username string
+	password string
+}
+
+func (source *nutSource) UPS() string {
+	return fmt.Sprintf("nut %s@%s", source.ups, source.address)
+}
+
+func (source *nutSource) Status(ctx context.Context) (*Status, error) {
+	dialer := &net.Dialer{}
+
+	conn, err := dialer.DialContext(ctx, "tcp", source.address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(sourceTimeout))
+	}
+
+	reader := bufio.NewReader(conn)
+
+	command := func(line string) (string, error) {
+		if _, err := fmt.Fprintf(conn, "%s\n", line); err != nil {
+			return "", err
+		}
+
+		response, err := reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+
+		response = strings.TrimRight(response, "\r\n")
+		if strings.HasPrefix(response, "ERR ") {
+			return "", fmt.Errorf("upsd error: %s", strings.TrimPrefix(response, "ERR "))
+		}
+
+		return response, nil
+	}
+
+	if source.username != "" {
+		if _, err := command("USERNAME " + source.username); err != nil {
+			return nil, err
+		}
+
+		if _, err := command("PASSWORD " + source.password); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := command("LIST VAR " + source.ups); err != nil {
+		return nil, err
+	}
+
+	variables := map[string]string{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(line, "END LIST VAR") {
+			break
+		}
+
+		// VAR <ups> <name> "<value>"
+		fields := strings.SplitN(line, " ", 4)
+		if len(fields) == 4 && fields[0] == "VAR" {
+			variables[fields[2]] = strings.Trim(fields[3], `"`)
+		}
+	}
+
+	fmt.Fprint(conn, "LOGOUT\n")
+
+	return nutStatus(variables)
+}
+
+// nutStatus returns the status of the UPS from the variables reported by upsd
+func nutStatus(variables map[string]string) (*Status, error) {
+	flags, ok := variables["ups.status"]
+	if !ok {
+		return nil, fmt.Errorf("the UPS does not report its status")
+	}
+
+	status := &Status{}
+	for _, flag := range strings.Fields(flags) {
+		switch flag {
+		case "OB":
+			status.OnBattery = true
+		case "LB":
+			status.LowBattery = true
+		}
+	}
+
+	if charge, err := strconv.ParseFloat(variables["battery.charge"], 64); err == nil {
+		status.BatteryCharge = &charge
+	}
+
+	if runtime, err := strconv.ParseFloat(variables["battery.runtime"], 64); err == nil {
+		seconds := int(runtime)
+		status.RuntimeSeconds = &seconds
+	}
+
+	return status, nil
+}
@@ -0,0 +1,382 @@
+// Package power monitors the UPS of the host through Network UPS Tools or apcupsd. While the host runs on battery,
+// the stacks labeled as low priority can be stopped to extend the runtime of the critical workloads, they are
+// started again when the power returns. The state of the UPS and the transitions are reported in the snapshots.
+package power
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker"
+
+	"github.com/docker/docker/api/types"
+	"github.com/rs/zerolog/log"
+)
+
+// States of the power supply of the host
+const (
+	StateOnline    = "online"
+	StateOnBattery = "on_battery"
+	StateUnknown   = "unknown"
+)
+
+// Types of the power events
+const (
+	EventOnBattery  = "on_battery"
+	EventOnline     = "online"
+	EventShed       = "shed"
+	EventResumed    = "resumed"
+	EventShedFailed = "shed_failed"
+)
+
+// LowPriority is the value of the agent.ContainerLabelPowerPriority label of the containers whose stacks are stopped
+// while the host runs on battery
+const LowPriority = "low"
+
+const (
+	// sourceTimeout is the maximum duration of the reading of the status of the UPS
+	sourceTimeout = 10 * time.Second
+	// shedStopTimeout is the maximum duration of the stop of a shed container, after which it is killed
+	shedStopTimeout = 30 * time.Second
+	// maxEvents is the number of the last power events reported
+	maxEvents = 20
+)
+
+var (
+	defaultMonitor   *Monitor
+	defaultMonitorMu sync.Mutex
+)
+
+// Report is the state of the UPS of the host reported in the snapshots
+type Report struct {
+	UPS            string     `json:"UPS"`
+	State          string     `json:"State"`
+	LowBattery     bool       `json:"LowBattery,omitempty"`
+	BatteryCharge  *float64   `json:"BatteryCharge,omitempty"`
+	RuntimeSeconds *int       `json:"RuntimeSeconds,omitempty"`
+	OnBatterySince *time.Time `json:"OnBatterySince,omitempty"`
+	// ShedStacks are the stacks stopped to extend the runtime on battery, until the power returns
+	ShedStacks []string `json:"ShedStacks,omitempty"`
+	// Events are the last transitions of the power supply and of the shedding, oldest first
+	Events    []Event   `json:"Events,omitempty"`
+	Error     string    `json:"Error,omitempty"`
+	CheckedAt time.Time `json:"CheckedAt"`
+}
+
+// Event is a transition of the power supply of the host or of the shedding of the stacks
+type Event struct {
+	Type    string    `json:"Type"`
+	Message string    `json:"Message"`
+	Time    time.Time `json:"Time"`
+}
+
+// shedState is the persisted list of the containers stopped by the shedding, started again when the power returns
+// even when the agent was restarted in between
+type shedState struct {
+	Stacks     []string                `json:"Stacks"`
+	Containers []docker.DependencyNode `json:"Containers"`
+}
+
+// Monitor reads the status of the UPS at each interval and sheds the low-priority stacks while the host runs on
+// battery
+type Monitor struct {
+	source    Source
+	shedding  bool
+	shedDelay time.Duration
+	statePath string
+
+	mu     sync.Mutex
+	report Report
+	shed   *shedState
+	// shedAttempted prevents shedding again during the same outage when no stack could be stopped
+	shedAttempted bool
+
+	stopOrder      func(ctx context.Context) ([]docker.DependencyNode, []string, error)
+	stopContainer  func(ctx context.Context, id string, timeout time.Duration) error
+	startContainer func(ctx context.Context, id string) error
+}
+
+// NewMonitor returns a pointer to a Monitor of the UPS read from source. When shedding is true, the low-priority
+// stacks are stopped once the host has been on battery for shedDelay, or as soon as the battery is low. The stopped
+// containers are persisted in statePath.
+func NewMonitor(source Source, shedding bool, shedDelay time.Duration, statePath string) (*Monitor, error) {
+	monitor := &Monitor{
+		source:    source,
+		shedding:  shedding,
+		shedDelay: shedDelay,
+		statePath: statePath,
+		report:    Report{UPS: source.UPS()},
+		stopOrder: func(ctx context.Context) ([]docker.DependencyNode, []string, error) {
+			return docker.LabeledStacksStopOrder(ctx, agent.ContainerLabelPowerPriority, LowPriority)
+		},
+		stopContainer: docker.ContainerStopWithTimeout,
+		startContainer: func(ctx context.Context, id string) error {
+			return docker.ContainerStart(id, types.ContainerStartOptions{})
+		},
+	}
+
+	content, err := os.ReadFile(statePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if len(content) > 0 {
+		state := &shedState{}
+		if err := json.Unmarshal(content, state); err != nil {
+			return nil, err
+		}
+
+		monitor.shed = state
+		monitor.report.ShedStacks = state.Stacks
+	}
+
+	return monitor, nil
+}
+
+// Enable makes monitor the monitor reported in the snapshots
+func Enable(monitor *Monitor) {
+	defaultMonitorMu.Lock()
+	defer defaultMonitorMu.Unlock()
+
+	defaultMonitor = monitor
+}
+
+// DefaultMonitor returns the enabled monitor, nil when no UPS is monitored
+func DefaultMonitor() *Monitor {
+	defaultMonitorMu.Lock()
+	defer defaultMonitorMu.Unlock()
+
+	return defaultMonitor
+}
+
+// Run checks the UPS at each interval until ctx is done
+func (monitor *Monitor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		monitor.check(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Report returns a copy of the last state of the UPS, nil when no UPS is monitored
+func (monitor *Monitor) Report() *Report {
+	if monitor == nil {
+		return nil
+	}
+
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+
+	report := monitor.report
+	report.ShedStacks = append([]string(nil), report.ShedStacks...)
+	report.Events = append([]Event(nil), report.Events...)
+
+	return &report
+}
+
+// Diagnostics returns a diagnostic message when the host runs on battery, when stacks are shed and when the UPS
+// cannot be read
+func (report *Report) Diagnostics() []string {
+	if report == nil {
+		return nil
+	}
+
+	var diagnostics []string
+
+	if report.Error != "" {
+		diagnostics = append(diagnostics, fmt.Sprintf("unable to read the status of the UPS %s: %s", report.UPS, report.Error))
+	}
+
+	if report.State == StateOnBattery {
+		message := "the host runs on battery"
+		if report.OnBatterySince != nil {
+			message += " since " + report.OnBatterySince.Format(time.RFC3339)
+		}
+
+		if report.LowBattery {
+			message += ", the battery is low"
+		}
+
+		diagnostics = append(diagnostics, message)
+	}
+
+	if len(report.ShedStacks) > 0 {
+		diagnostics = append(diagnostics, fmt.Sprintf("the low-priority stacks are stopped until the power returns: %s", strings.Join(report.ShedStacks, ", ")))
+	}
+
+	return diagnostics
+}
+
+// check reads the status of the UPS at now, sheds the low-priority stacks when the host has been on battery long
+// enough and starts them again when the power returns
+func (monitor *Monitor) check(ctx context.Context, now time.Time) {
+	statusCtx, cancel := context.WithTimeout(ctx, sourceTimeout)
+	status, err := monitor.source.Status(statusCtx)
+	cancel()
+
+	monitor.mu.Lock()
+
+	monitor.report.CheckedAt = now.UTC()
+
+	// the stacks are neither shed nor resumed while the state of the power supply is unknown
+	if err != nil {
+		if monitor.report.Error == "" {
+			log.Warn().Err(err).Str("ups", monitor.report.UPS).Msg("unable to read the status of the UPS")
+		}
+
+		monitor.report.Error = err.Error()
+		monitor.report.State = StateUnknown
+		monitor.mu.Unlock()
+
+		return
+	}
+
+	monitor.report.Error = ""
+	monitor.report.LowBattery = status.LowBattery
+	monitor.report.BatteryCharge = status.BatteryCharge
+	monitor.report.RuntimeSeconds = status.RuntimeSeconds
+
+	switch {
+	case status.OnBattery && monitor.report.State != StateOnBattery:
+		since := now.UTC()
+		monitor.report.State = StateOnBattery
+		monitor.report.OnBatterySince = &since
+		monitor.addEvent(EventOnBattery, "the host runs on battery", now)
+	case !status.OnBattery && monitor.report.State == StateOnBattery:
+		monitor.report.OnBatterySince = nil
+		monitor.report.State = StateOnline
+		monitor.shedAttempted = false
+		monitor.addEvent(EventOnline, "the power returned", now)
+	case !status.OnBattery:
+		monitor.report.State = StateOnline
+	}
+
+	shed := monitor.shedding && status.OnBattery && monitor.shed == nil && !monitor.shedAttempted &&
+		(status.LowBattery || now.Sub(*monitor.report.OnBatterySince) >= monitor.shedDelay)
+	resume := !status.OnBattery && monitor.shed != nil
+
+	monitor.mu.Unlock()
+
+	switch {
+	case shed:
+		monitor.shedStacks(ctx, now)
+	case resume:
+		monitor.resumeStacks(ctx, now)
+	}
+}
+
+// shedStacks stops the containers of the low-priority stacks, the containers depending on other containers first
+func (monitor *Monitor) shedStacks(ctx context.Context, now time.Time) {
+	nodes, stacks, err := monitor.stopOrder(ctx)
+
+	monitor.mu.Lock()
+	monitor.shedAttempted = true
+	monitor.mu.Unlock()
+
+	if err != nil {
+		log.Error().Err(err).Msg("unable to list the low-priority stacks")
+		monitor.event(EventShedFailed, fmt.Sprintf("unable to list the low-priority stacks: %s", err), now)
+
+		return
+	}
+
+	if len(nodes) == 0 {
+		return
+	}
+
+	state := &shedState{Stacks: stacks}
+
+	var failed []string
+	for _, node := range nodes {
+		if err := monitor.stopContainer(ctx, node.ID, shedStopTimeout); err != nil {
+			log.Warn().Err(err).Str("container", node.Name).Msg("unable to stop the low-priority container")
+			failed = append(failed, node.Name)
+
+			continue
+		}
+
+		state.Containers = append(state.Containers, node)
+	}
+
+	if err := monitor.saveState(state); err != nil {
+		log.Error().Err(err).Msg("unable to persist the low-priority containers stopped on battery")
+	}
+
+	monitor.mu.Lock()
+	monitor.shed = state
+	monitor.report.ShedStacks = stacks
+	monitor.mu.Unlock()
+
+	log.Info().Strs("stacks", stacks).Int("containers", len(state.Containers)).Msg("the low-priority stacks are stopped while the host runs on battery")
+	monitor.event(EventShed, fmt.Sprintf("stopped the low-priority stacks %s", strings.Join(stacks, ", ")), now)
+
+	if len(failed) > 0 {
+		monitor.event(EventShedFailed, fmt.Sprintf("unable to stop the containers %s", strings.Join(failed, ", ")), now)
+	}
+}
+
+// resumeStacks starts the containers stopped by the shedding, the containers depended on first
+func (monitor *Monitor) resumeStacks(ctx context.Context, now time.Time) {
+	monitor.mu.Lock()
+	state := monitor.shed
+	monitor.mu.Unlock()
+
+	for i := len(state.Containers) - 1; i >= 0; i-- {
+		node := state.Containers[i]
+
+		if err := monitor.startContainer(ctx, node.ID); err != nil {
+			log.Warn().Err(err).Str("container", node.Name).Msg("unable to start the low-priority container")
+		}
+	}
+
+	if err := os.Remove(monitor.statePath); err != nil && !os.IsNotExist(err) {
+		log.Error().Err(err).Msg("unable to remove the low-priority containers stopped on battery")
+	}
+
+	monitor.mu.Lock()
+	monitor.shed = nil
+	monitor.report.ShedStacks = nil
+	monitor.mu.Unlock()
+
+	log.Info().Strs("stacks", state.Stacks).Msg("the low-priority stacks are started again")
+	monitor.event(EventResumed, fmt.Sprintf("started the low-priority stacks %s", strings.Join(state.Stacks, ", ")), now)
+}
+
+func (monitor *Monitor) saveState(state *shedState) error {
+	content, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(monitor.statePath, content, 0600)
+}
+
+// event records an event, monitor.mu must not be held
+func (monitor *Monitor) event(eventType, message string, now time.Time) {
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+
+	monitor.addEvent(eventType, message, now)
+}
+
+// addEvent records an event, monitor.mu must be held
+func (monitor *Monitor) addEvent(eventType, message string, now time.Time) {
+	monitor.report.Events = append(monitor.report.Events, Event{Type: eventType, Message: message, Time: now.UTC()})
+
+	if len(monitor.report.Events) > maxEvents {
+		monitor.report.Events = monitor.report.Events[len(monitor.report.Events)-maxEvents:]
+	}
+}
@@ -0,0 +1,228 @@
+package power
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/portainer/agent/docker"
+)
+
+func listen(t *testing.T, serve func(conn net.Conn)) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		serve(conn)
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestNUTSource(t *testing.T) {
+	var commands []string
+
+	address := listen(t, func(conn net.Conn) {
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			line = strings.TrimSpace(line)
+			commands = append(commands, line)
+
+			switch {
+			case strings.HasPrefix(line, "USERNAME"), strings.HasPrefix(line, "PASSWORD"):
+				io.WriteString(conn, "OK\n")
+			case line == "LIST VAR rack":
+				io.WriteString(conn, "BEGIN LIST VAR rack\nVAR rack battery.charge \"42\"\nVAR rack battery.runtime \"600\"\nVAR rack ups.status \"OB DISCHRG LB\"\nEND LIST VAR rack\n")
+			case line == "LOGOUT":
+				io.WriteString(conn, "OK Goodbye\n")
+				return
+			}
+		}
+	})
+
+	source, err := NewSource("nut://monuser:secret@" + address + "/rack")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := source.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !status.OnBattery || !status.LowBattery || *status.BatteryCharge != 42 || *status.RuntimeSeconds != 600 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	if commands[0] != "USERNAME monuser" || commands[1] != "PASSWORD secret" {
+		t.Fatalf("expected the client to authenticate, got %v", commands)
+	}
+
+	if strings.Contains(source.UPS(), "secret") {
+		t.Fatalf("expected the UPS description without credentials, got %s", source.UPS())
+	}
+}
+
+func TestAPCUPSDSource(t *testing.T) {
+	address := listen(t, func(conn net.Conn) {
+		request := make([]byte, 8)
+		if _, err := io.ReadFull(conn, request); err != nil || string(request[2:]) != "status" {
+			return
+		}
+
+		for _, record := range []string{"APC      : 001,036,0879\n", "STATUS   : ONBATT \n", "BCHARGE  : 87.0 Percent\n", "TIMELEFT : 12.5 Minutes\n", ""} {
+			binary.Write(conn, binary.BigEndian, uint16(len(record)))
+			io.WriteString(conn, record)
+		}
+	})
+
+	source, err := NewSource("apcupsd://" + address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := source.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !status.OnBattery || status.LowBattery || *status.BatteryCharge != 87 || *status.RuntimeSeconds != 750 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+}
+
+func TestNewSource_Invalid(t *testing.T) {
+	for _, rawURL := range []string{"nut://localhost", "nut:///rack", "snmp://localhost", "apcupsd://"} {
+		if _, err := NewSource(rawURL); err == nil {
+			t.Errorf("expected an error for %s", rawURL)
+		}
+	}
+}
+
+type fakeSource struct {
+	status *Status
+	err    error
+}
+
+func (source *fakeSource) UPS() string { return "fake" }
+
+func (source *fakeSource) Status(ctx context.Context) (*Status, error) {
+	return source.status, source.err
+}
+
+func TestMonitor_ShedAndResume(t *testing.T) {
+	source := &fakeSource{status: &Status{}}
+	statePath := filepath.Join(t.TempDir(), "power.json")
+
+	monitor, err := NewMonitor(source, true, time.Minute, statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stopped, started []string
+	monitor.stopOrder = func(ctx context.Context) ([]docker.DependencyNode, []string, error) {
+		return []docker.DependencyNode{{ID: "web", Stack: "media"}, {ID: "db", Stack: "media"}}, []string{"media"}, nil
+	}
+	monitor.stopContainer = func(ctx context.Context, id string, timeout time.Duration) error {
+		stopped = append(stopped, id)
+		return nil
+	}
+	monitor.startContainer = func(ctx context.Context, id string) error {
+		started = append(started, id)
+		return nil
+	}
+
+	now := time.Now()
+	monitor.check(context.Background(), now)
+
+	source.status = &Status{OnBattery: true}
+	monitor.check(context.Background(), now.Add(time.Second))
+
+	if len(stopped) != 0 {
+		t.Fatalf("expected the stacks to be shed after the delay, got %v", stopped)
+	}
+
+	monitor.check(context.Background(), now.Add(2*time.Minute))
+	monitor.check(context.Background(), now.Add(3*time.Minute))
+
+	if !reflect.DeepEqual(stopped, []string{"web", "db"}) {
+		t.Fatalf("expected the containers to be stopped once in order, got %v", stopped)
+	}
+
+	report := monitor.Report()
+	if report.State != StateOnBattery || !reflect.DeepEqual(report.ShedStacks, []string{"media"}) || len(report.Diagnostics()) != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	// the shed containers are started again by a restarted agent
+	monitor, err = NewMonitor(source, true, time.Minute, statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	monitor.startContainer = func(ctx context.Context, id string) error {
+		started = append(started, id)
+		return nil
+	}
+
+	source.err = errors.New("connection refused")
+	monitor.check(context.Background(), now.Add(4*time.Minute))
+
+	if len(started) != 0 {
+		t.Fatalf("expected the stacks not to be started while the UPS is unknown, got %v", started)
+	}
+
+	source.status, source.err = &Status{}, nil
+	monitor.check(context.Background(), now.Add(5*time.Minute))
+
+	if !reflect.DeepEqual(started, []string{"db", "web"}) {
+		t.Fatalf("expected the containers to be started in reverse order, got %v", started)
+	}
+
+	report = monitor.Report()
+	if report.State != StateOnline || len(report.ShedStacks) != 0 || report.Events[len(report.Events)-1].Type != EventResumed {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
+
+func TestMonitor_ShedOnLowBattery(t *testing.T) {
+	source := &fakeSource{status: &Status{OnBattery: true, LowBattery: true}}
+
+	monitor, err := NewMonitor(source, true, time.Hour, filepath.Join(t.TempDir(), "power.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shed := false
+	monitor.stopOrder = func(ctx context.Context) ([]docker.DependencyNode, []string, error) {
+		shed = true
+		return nil, nil, nil
+	}
+
+	monitor.check(context.Background(), time.Now())
+
+	if !shed {
+		t.Fatal("expected the stacks to be shed as soon as the battery is low")
+	}
+}
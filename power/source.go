@@ -0,0 +1,81 @@
+package power
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Default ports of the UPS daemons
+const (
+	nutDefaultPort     = "3493"
+	apcupsdDefaultPort = "3551"
+)
+
+// Status is the state of the UPS reported by its daemon
+type Status struct {
+	// OnBattery is true when the host is powered by the battery of the UPS
+	OnBattery bool
+	// LowBattery is true when the UPS reports that the battery is almost depleted
+	LowBattery bool
+	// BatteryCharge is the charge of the battery in percent, nil when not reported
+	BatteryCharge *float64
+	// RuntimeSeconds is the remaining runtime on battery, nil when not reported
+	RuntimeSeconds *int
+}
+
+// Source reads the status of the UPS of the host from its daemon
+type Source interface {
+	// UPS returns the description of the UPS, without credentials
+	UPS() string
+	Status(ctx context.Context) (*Status, error)
+}
+
+// NewSource returns the Source of the UPS daemon at rawURL:
+//   - nut://[user:password@]host[:port]/<ups> for the upsd daemon of Network UPS Tools
+//   - apcupsd://host[:port] for the network information server of apcupsd
+func NewSource(rawURL string) (Source, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid UPS URL: %w", err)
+	}
+
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("the host of the UPS daemon is required in %s", u.Redacted())
+	}
+
+	switch u.Scheme {
+	case "nut":
+		ups := strings.Trim(u.Path, "/")
+		if ups == "" || strings.ContainsAny(ups, "/ \n") {
+			return nil, fmt.Errorf("invalid UPS name in %s", u.Redacted())
+		}
+
+		source := &nutSource{
+			address: hostPort(u, nutDefaultPort),
+			ups:     ups,
+		}
+
+		if u.User != nil {
+			source.username = u.User.Username()
+			source.password, _ = u.User.Password()
+		}
+
+		return source, nil
+	case "apcupsd":
+		return &apcupsdSource{address: hostPort(u, apcupsdDefaultPort)}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported UPS daemon %q, expected nut or apcupsd", u.Scheme)
+}
+
+func hostPort(u *url.URL, defaultPort string) string {
+	port := u.Port()
+	if port == "" {
+		port = defaultPort
+	}
+
+	return net.JoinHostPort(u.Hostname(), port)
+}
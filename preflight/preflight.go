@@ -0,0 +1,355 @@
+package preflight
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/edge/yaml"
+	"github.com/portainer/agent/inventory"
+	agentnet "github.com/portainer/agent/net"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Types of the preflight checks
+const (
+	CheckPort   = "port"
+	CheckPath   = "path"
+	CheckImage  = "image"
+	CheckMemory = "memory"
+	CheckDisk   = "disk"
+)
+
+// Status of the preflight checks, the deployment is expected to fail when a check fails
+const (
+	StatusPass = "pass"
+	StatusWarn = "warn"
+	StatusFail = "fail"
+)
+
+// minimumFreeDisk is the free space required on the partition of the Docker root folder to pull the images and
+// create the containers of a stack
+const minimumFreeDisk = 1 << 30
+
+// Check is the result of a preflight check of a stack
+type Check struct {
+	Type string `json:"Type"`
+	// Service is the service requiring the checked resource, empty for the checks of the host
+	Service string `json:"Service,omitempty"`
+	Target  string `json:"Target"`
+	Status  string `json:"Status"`
+	Message string `json:"Message"`
+}
+
+// Report is the result of the preflight checks of a stack, it passes when no check failed
+type Report struct {
+	Stack     string    `json:"Stack"`
+	Passed    bool      `json:"Passed"`
+	Checks    []Check   `json:"Checks"`
+	CheckedAt time.Time `json:"CheckedAt"`
+}
+
+// Run checks that the ports published by the compose file of the stack are free, that the host paths it bind
+// mounts exist, that its images can be resolved for the platform of the host and that the host has enough memory
+// and disk for the stack. The resources of the stack already deployed with stackName are replaced by the
+// deployment, they are not reported as conflicts. An error is returned when the compose file is invalid.
+func Run(ctx context.Context, stackName, fileContent string) (Report, error) {
+	report := Report{Stack: stackName, Checks: []Check{}, CheckedAt: time.Now()}
+
+	requirements, err := yaml.GetComposePreflightRequirements(fileContent)
+	if err != nil {
+		return report, err
+	}
+
+	resources, err := yaml.ComposeResourceRequirements(fileContent)
+	if err != nil {
+		return report, err
+	}
+
+	report.Checks = append(report.Checks, portChecks(ctx, stackName, requirements.Ports)...)
+	report.Checks = append(report.Checks, pathChecks(agent.HostRoot, requirements.BindMounts)...)
+	report.Checks = append(report.Checks, imageChecks(ctx, requirements.Images)...)
+
+	capacity, err := docker.GetHostCapacity(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	report.Checks = append(report.Checks, memoryCheck(ctx, stackName, capacity.MemTotal, resources.Memory))
+	report.Checks = append(report.Checks, diskCheck(capacity.DockerRootDir))
+
+	report.Passed = true
+	for _, check := range report.Checks {
+		if check.Status == StatusFail {
+			report.Passed = false
+
+			break
+		}
+	}
+
+	return report, nil
+}
+
+// Failures summarizes the failed checks of the report
+func (report Report) Failures() string {
+	failures := []string{}
+	for _, check := range report.Checks {
+		if check.Status == StatusFail {
+			failures = append(failures, check.Message)
+		}
+	}
+
+	return strings.Join(failures, ", ")
+}
+
+func portChecks(ctx context.Context, stackName string, ports []yaml.ComposePublishedPort) []Check {
+	if len(ports) == 0 {
+		return nil
+	}
+
+	published, err := docker.GetPublishedPorts(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("unable to retrieve the ports published by the containers")
+	}
+
+	listeners, err := agentnet.GetHostListeningPorts()
+	if err != nil {
+		log.Warn().Err(err).Msg("unable to retrieve the listening ports of the host")
+	}
+
+	return checkPorts(stackName, ports, published, listeners)
+}
+
+// checkPorts checks that each port of the stack is published by a single service and is not already published by
+// a container of another stack or used by a process of the host. The proxies of the ports published by the
+// containers listen on the host, the containers are checked first.
+func checkPorts(stackName string, ports []yaml.ComposePublishedPort, published []docker.PublishedPort, listeners []agentnet.ListeningPort) []Check {
+	checks := []Check{}
+	services := map[string]string{}
+
+	for _, port := range ports {
+		target := fmt.Sprintf("%d/%s", port.Port, port.Protocol)
+		check := Check{Type: CheckPort, Service: port.Service, Target: target, Status: StatusPass, Message: fmt.Sprintf("port %s is free", target)}
+
+		if service, ok := services[target]; ok && service != port.Service {
+			check.Status = StatusFail
+			check.Message = fmt.Sprintf("port %s is published by the services %s and %s", target, service, port.Service)
+			checks = append(checks, check)
+
+			continue
+		}
+
+		services[target] = port.Service
+
+		if container, ok := publishingContainer(published, port); ok {
+			if stackName != "" && strings.EqualFold(container.Stack, stackName) {
+				check.Message = fmt.Sprintf("port %s is published by the container %s of the stack, which is replaced by the deployment", target, container.Container)
+			} else {
+				check.Status = StatusFail
+				check.Message = fmt.Sprintf("port %s is already published by the container %s", target, container.Container)
+			}
+		} else if isListening(listeners, port) {
+			check.Status = StatusFail
+			check.Message = fmt.Sprintf("port %s is used by a process of the host", target)
+		}
+
+		checks = append(checks, check)
+	}
+
+	return checks
+}
+
+func publishingContainer(published []docker.PublishedPort, port yaml.ComposePublishedPort) (docker.PublishedPort, bool) {
+	for _, p := range published {
+		if p.Port == port.Port && p.Protocol == port.Protocol {
+			return p, true
+		}
+	}
+
+	return docker.PublishedPort{}, false
+}
+
+func isListening(listeners []agentnet.ListeningPort, port yaml.ComposePublishedPort) bool {
+	for _, listener := range listeners {
+		if listener.Port == port.Port && listener.Protocol == port.Protocol {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pathChecks checks that the host paths bind mounted by the stack exist, through the host filesystem mounted on
+// hostRoot. The relative paths are only resolved at deployment time.
+func pathChecks(hostRoot string, mounts []yaml.ComposeBindMount) []Check {
+	checks := []Check{}
+
+	if len(mounts) == 0 {
+		return checks
+	}
+
+	_, err := os.Stat(hostRoot)
+	mounted := err == nil
+
+	for _, mount := range mounts {
+		check := Check{Type: CheckPath, Service: mount.Service, Target: mount.Source, Status: StatusPass}
+
+		_, err := os.Stat(filepath.Join(hostRoot, mount.Source))
+
+		switch {
+		case !filepath.IsAbs(mount.Source):
+			check.Status = StatusWarn
+			check.Message = fmt.Sprintf("path %s is not absolute, it is resolved when the stack is deployed", mount.Source)
+		case !mounted:
+			check.Status = StatusWarn
+			check.Message = fmt.Sprintf("path %s cannot be checked, the host filesystem is not mounted in the agent container", mount.Source)
+		case err == nil:
+			check.Message = fmt.Sprintf("path %s exists", mount.Source)
+		case mount.CreateHostPath:
+			check.Status = StatusWarn
+			check.Message = fmt.Sprintf("path %s does not exist, an empty directory is created by the deployment", mount.Source)
+		default:
+			check.Status = StatusFail
+			check.Message = fmt.Sprintf("path %s does not exist on the host", mount.Source)
+		}
+
+		checks = append(checks, check)
+	}
+
+	return checks
+}
+
+// imageChecks checks that each image of the stack is present on the host or can be pulled from its registry for
+// the platform of the host
+func imageChecks(ctx context.Context, images []yaml.ComposeServiceImage) []Check {
+	checks := []Check{}
+	hostPlatform := runtime.GOOS + "/" + runtime.GOARCH
+
+	for _, image := range images {
+		check := Check{Type: CheckImage, Service: image.Service, Target: image.Image, Status: StatusPass}
+
+		platforms, err := docker.GetImagePlatforms(ctx, image.Image)
+
+		switch {
+		case err != nil:
+			check.Status = StatusFail
+			check.Message = fmt.Sprintf("image %s cannot be resolved: %s", image.Image, err)
+		case len(platforms.Platforms) == 0:
+			check.Status = StatusWarn
+			check.Message = fmt.Sprintf("image %s can be pulled, its registry does not report its platforms", image.Image)
+		case !supportsPlatform(platforms.Platforms, hostPlatform):
+			check.Status = StatusFail
+			check.Message = fmt.Sprintf("image %s is not available for %s, only for %s", image.Image, hostPlatform, strings.Join(platforms.Platforms, ", "))
+		case platforms.Local:
+			check.Message = fmt.Sprintf("image %s is present on the host", image.Image)
+		default:
+			check.Message = fmt.Sprintf("image %s can be pulled for %s", image.Image, hostPlatform)
+		}
+
+		checks = append(checks, check)
+	}
+
+	return checks
+}
+
+// supportsPlatform returns true when one of the os/architecture[/variant] platforms matches the os/architecture
+// of the host, the variants are not compared
+func supportsPlatform(platforms []string, hostPlatform string) bool {
+	for _, platform := range platforms {
+		if platform == hostPlatform || strings.HasPrefix(platform, hostPlatform+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// memoryCheck checks that the memory reserved by the stack is available on the host, once the memory reserved by
+// the containers of the other stacks is deducted
+func memoryCheck(ctx context.Context, stackName string, total, required int64) Check {
+	check := Check{Type: CheckMemory, Target: units.BytesSize(float64(required)), Status: StatusPass}
+
+	if required == 0 {
+		check.Message = "the services of the stack reserve no memory"
+
+		return check
+	}
+
+	usage, err := docker.GetResourceUsage(ctx, stackName)
+	if err != nil {
+		check.Status = StatusWarn
+		check.Message = fmt.Sprintf("the memory reserved on the host cannot be retrieved: %s", err)
+
+		return check
+	}
+
+	available := max(total-usage.Memory, 0)
+	if required > available {
+		check.Status = StatusFail
+	}
+
+	check.Message = fmt.Sprintf("%s of memory reserved by the stack, %s available", units.BytesSize(float64(required)), units.BytesSize(float64(available)))
+
+	return check
+}
+
+func diskCheck(dockerRootDir string) Check {
+	partitions, err := inventory.GetPartitions()
+	if err != nil {
+		return Check{Type: CheckDisk, Target: dockerRootDir, Status: StatusWarn, Message: fmt.Sprintf("the free disk space cannot be retrieved: %s", err)}
+	}
+
+	return checkDisk(dockerRootDir, partitions)
+}
+
+// checkDisk checks that the partition of the Docker root folder has at least minimumFreeDisk free
+func checkDisk(dockerRootDir string, partitions []inventory.Partition) Check {
+	check := Check{Type: CheckDisk, Target: dockerRootDir, Status: StatusPass}
+
+	partition, ok := partitionOf(partitions, dockerRootDir)
+	if !ok {
+		check.Status = StatusWarn
+		check.Message = fmt.Sprintf("the partition of %s cannot be found", dockerRootDir)
+
+		return check
+	}
+
+	if partition.FreeBytes < minimumFreeDisk {
+		check.Status = StatusFail
+		check.Message = fmt.Sprintf("%s free on the partition of %s, at least %s required", units.BytesSize(float64(partition.FreeBytes)), dockerRootDir, units.BytesSize(minimumFreeDisk))
+
+		return check
+	}
+
+	check.Message = fmt.Sprintf("%s free on the partition of %s", units.BytesSize(float64(partition.FreeBytes)), dockerRootDir)
+
+	return check
+}
+
+// partitionOf returns the partition with the longest mount point containing path
+func partitionOf(partitions []inventory.Partition, path string) (inventory.Partition, bool) {
+	var found inventory.Partition
+
+	ok := false
+	for _, partition := range partitions {
+		mountPoint := strings.TrimSuffix(partition.MountPoint, "/")
+		if path != mountPoint && !strings.HasPrefix(path, mountPoint+"/") {
+			continue
+		}
+
+		if !ok || len(partition.MountPoint) > len(found.MountPoint) {
+			found = partition
+			ok = true
+		}
+	}
+
+	return found, ok
+}
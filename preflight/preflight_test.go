@@ -0,0 +1,116 @@
+package preflight
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/edge/yaml"
+	"github.com/portainer/agent/inventory"
+	agentnet "github.com/portainer/agent/net"
+)
+
+func TestCheckPorts(t *testing.T) {
+	ports := []yaml.ComposePublishedPort{
+		{Service: "web", Port: 80, Protocol: "tcp"},
+		{Service: "web", Port: 443, Protocol: "tcp"},
+		{Service: "api", Port: 8080, Protocol: "tcp"},
+		{Service: "dns", Port: 53, Protocol: "udp"},
+		{Service: "admin", Port: 8080, Protocol: "tcp"},
+		{Service: "metrics", Port: 9100, Protocol: "tcp"},
+	}
+
+	published := []docker.PublishedPort{
+		{Container: "edge_shop-web-1", Stack: "edge_shop", Port: 80, Protocol: "tcp"},
+		{Container: "proxy", Port: 443, Protocol: "tcp"},
+	}
+
+	listeners := []agentnet.ListeningPort{
+		{Port: 80, Protocol: "tcp"},
+		{Port: 53, Protocol: "udp"},
+		{Port: 9100, Protocol: "udp"},
+	}
+
+	expected := []string{StatusPass, StatusFail, StatusPass, StatusFail, StatusFail, StatusPass}
+
+	checks := checkPorts("EDGE_shop", ports, published, listeners)
+	if len(checks) != len(expected) {
+		t.Fatalf("expected %d checks, got %d", len(expected), len(checks))
+	}
+
+	for i, check := range checks {
+		if check.Status != expected[i] {
+			t.Errorf("expected the check of port %s of %s to be %s, got %s: %s", check.Target, check.Service, expected[i], check.Status, check.Message)
+		}
+	}
+}
+
+func TestPathChecks(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "srv", "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	mounts := []yaml.ComposeBindMount{
+		{Service: "web", Source: "/srv/data"},
+		{Service: "web", Source: "/srv/missing"},
+		{Service: "web", Source: "/srv/created", CreateHostPath: true},
+		{Service: "web", Source: "./conf", CreateHostPath: true},
+	}
+
+	expected := []string{StatusPass, StatusFail, StatusWarn, StatusWarn}
+
+	checks := pathChecks(root, mounts)
+	for i, check := range checks {
+		if check.Status != expected[i] {
+			t.Errorf("expected the check of %s to be %s, got %s: %s", check.Target, expected[i], check.Status, check.Message)
+		}
+	}
+
+	for _, check := range pathChecks(filepath.Join(root, "missing"), mounts[:1]) {
+		if check.Status != StatusWarn {
+			t.Errorf("expected the check of %s to be skipped without host filesystem, got %s", check.Target, check.Status)
+		}
+	}
+}
+
+func TestSupportsPlatform(t *testing.T) {
+	tests := []struct {
+		platforms []string
+		host      string
+		supported bool
+	}{
+		{[]string{"linux/amd64", "linux/arm64/v8"}, "linux/arm64", true},
+		{[]string{"linux/arm/v7"}, "linux/arm", true},
+		{[]string{"linux/amd64"}, "linux/arm64", false},
+		{[]string{"linux/arm64"}, "linux/arm", false},
+		{[]string{"windows/amd64"}, "linux/amd64", false},
+	}
+
+	for _, test := range tests {
+		if supportsPlatform(test.platforms, test.host) != test.supported {
+			t.Errorf("expected supportsPlatform(%v, %s) to be %t", test.platforms, test.host, test.supported)
+		}
+	}
+}
+
+func TestCheckDisk(t *testing.T) {
+	partitions := []inventory.Partition{
+		{MountPoint: "/", FreeBytes: 20 << 30},
+		{MountPoint: "/var/lib/docker", FreeBytes: 512 << 20},
+		{MountPoint: "/var/lib/dockerd", FreeBytes: 40 << 30},
+	}
+
+	if check := checkDisk("/var/lib/docker", partitions); check.Status != StatusFail {
+		t.Errorf("expected the disk check to fail, got %s: %s", check.Status, check.Message)
+	}
+
+	if check := checkDisk("/data/docker", partitions); check.Status != StatusPass {
+		t.Errorf("expected the disk check to pass, got %s: %s", check.Status, check.Message)
+	}
+
+	if check := checkDisk("/data/docker", nil); check.Status != StatusWarn {
+		t.Errorf("expected the disk check to be skipped, got %s: %s", check.Status, check.Message)
+	}
+}
@@ -0,0 +1,170 @@
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+)
+
+// Options of the Modbus probes
+const (
+	// ModbusOptionUnit is the unit identifier of the device behind the gateway, 1 by default
+	ModbusOptionUnit = "unit"
+	// ModbusOptionRegister is the address of the register read, 0 by default
+	ModbusOptionRegister = "register"
+	// ModbusOptionFunction is the kind of register read, holding (the default) or input
+	ModbusOptionFunction = "function"
+)
+
+const (
+	modbusDefaultPort = "502"
+
+	modbusReadHoldingRegisters = 0x03
+	modbusReadInputRegisters   = 0x04
+	modbusExceptionFlag        = 0x80
+	// modbusMaxADU is the maximum size of a Modbus TCP frame
+	modbusMaxADU = 260
+)
+
+var modbusExceptions = map[byte]string{
+	0x01: "illegal function",
+	0x02: "illegal data address",
+	0x03: "illegal data value",
+	0x04: "server device failure",
+	0x05: "acknowledge",
+	0x06: "server device busy",
+	0x08: "memory parity error",
+	0x0A: "gateway path unavailable",
+	0x0B: "gateway target device failed to respond",
+}
+
+// modbusChecker reads a register of a Modbus TCP device, which checks that the device, or the device behind a
+// gateway, answers the requests of the applications and not only accepts the connections
+type modbusChecker struct{}
+
+func (modbusChecker) Validate(definition *Definition) error {
+	if _, _, err := net.SplitHostPort(definition.Target); err != nil {
+		definition.Target = net.JoinHostPort(definition.Target, modbusDefaultPort)
+	}
+
+	if host, _, err := net.SplitHostPort(definition.Target); err != nil || host == "" {
+		return fmt.Errorf("invalid address of the probe %s: %q", definition.Name, definition.Target)
+	}
+
+	if _, _, _, err := modbusRequestOptions(definition.Options); err != nil {
+		return fmt.Errorf("invalid options of the probe %s: %w", definition.Name, err)
+	}
+
+	return nil
+}
+
+func (modbusChecker) Check(ctx context.Context, definition Definition) (int, error) {
+	unit, function, register, err := modbusRequestOptions(definition.Options)
+	if err != nil {
+		return 0, err
+	}
+
+	conn, err := dial(ctx, definition.Target)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	transaction := uint16(rand.Intn(1 << 16))
+
+	// MBAP header (transaction, protocol 0, length of the unit and the PDU, unit) followed by the PDU reading one
+	// register
+	request := make([]byte, 12)
+	binary.BigEndian.PutUint16(request[0:], transaction)
+	binary.BigEndian.PutUint16(request[4:], 6)
+	request[6] = unit
+	request[7] = function
+	binary.BigEndian.PutUint16(request[8:], register)
+	binary.BigEndian.PutUint16(request[10:], 1)
+
+	if _, err := conn.Write(request); err != nil {
+		return 0, err
+	}
+
+	return 0, readModbusResponse(conn, transaction, function)
+}
+
+// readModbusResponse reads the response to the request and returns the exception of the device, if any
+func readModbusResponse(reader io.Reader, transaction uint16, function byte) error {
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return fmt.Errorf("no Modbus response: %w", err)
+	}
+
+	length := int(binary.BigEndian.Uint16(header[4:]))
+	if binary.BigEndian.Uint16(header[2:]) != 0 || length < 2 || length > modbusMaxADU-6 {
+		return errors.New("invalid Modbus response")
+	}
+
+	if binary.BigEndian.Uint16(header[0:]) != transaction {
+		return errors.New("unexpected Modbus transaction in the response")
+	}
+
+	pdu := make([]byte, length-1)
+	if _, err := io.ReadFull(reader, pdu); err != nil {
+		return fmt.Errorf("truncated Modbus response: %w", err)
+	}
+
+	if pdu[0] == function|modbusExceptionFlag {
+		exception, ok := modbusExceptions[pdu[1]]
+		if !ok {
+			exception = "unknown exception"
+		}
+
+		return fmt.Errorf("Modbus exception %d: %s", pdu[1], exception)
+	}
+
+	if pdu[0] != function {
+		return fmt.Errorf("unexpected Modbus function %d in the response", pdu[0])
+	}
+
+	return nil
+}
+
+// modbusRequestOptions returns the unit, the function and the register read by the probe
+func modbusRequestOptions(options map[string]string) (byte, byte, uint16, error) {
+	unit, register := 1, 0
+	function := byte(modbusReadHoldingRegisters)
+
+	if value, ok := options[ModbusOptionUnit]; ok {
+		parsed, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("invalid unit %q", value)
+		}
+		unit = int(parsed)
+	}
+
+	if value, ok := options[ModbusOptionRegister]; ok {
+		parsed, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("invalid register %q", value)
+		}
+		register = int(parsed)
+	}
+
+	switch options[ModbusOptionFunction] {
+	case "", "holding":
+	case "input":
+		function = modbusReadInputRegisters
+	default:
+		return 0, 0, 0, fmt.Errorf("invalid function %q, holding or input expected", options[ModbusOptionFunction])
+	}
+
+	for option := range options {
+		if option != ModbusOptionUnit && option != ModbusOptionRegister && option != ModbusOptionFunction {
+			return 0, 0, 0, fmt.Errorf("unknown option %q", option)
+		}
+	}
+
+	return byte(unit), function, uint16(register), nil
+}
@@ -0,0 +1,128 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+)
+
+const (
+	opcuaDefaultPort = "4840"
+	// opcuaBufferSize is the size of the buffers announced in the Hello message
+	opcuaBufferSize = 65536
+	// opcuaMaxEndpointURL is the maximum length of the endpoint URL of the Hello message
+	opcuaMaxEndpointURL = 4096
+	// opcuaMaxReason bounds the size of the reason of an Error message
+	opcuaMaxReason = 4096
+)
+
+// opcuaChecker opens an OPC UA TCP connection to the endpoint of the probe, the Hello message must be acknowledged by
+// the server. The secure channel and the session are not opened, the probe needs no credentials.
+type opcuaChecker struct{}
+
+func (opcuaChecker) Validate(definition *Definition) error {
+	u, err := url.Parse(definition.Target)
+	if err != nil || u.Scheme != "opc.tcp" || u.Hostname() == "" || len(definition.Target) > opcuaMaxEndpointURL {
+		return fmt.Errorf("invalid endpoint of the probe %s, opc.tcp://host[:port][/path] expected: %q", definition.Name, definition.Target)
+	}
+
+	if len(definition.Options) > 0 {
+		return fmt.Errorf("the probe %s has unknown options, the OPC UA probes have none", definition.Name)
+	}
+
+	return nil
+}
+
+func (opcuaChecker) Check(ctx context.Context, definition Definition) (int, error) {
+	u, err := url.Parse(definition.Target)
+	if err != nil {
+		return 0, err
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = opcuaDefaultPort
+	}
+
+	conn, err := dial(ctx, net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write(opcuaHello(definition.Target)); err != nil {
+		return 0, err
+	}
+
+	return 0, readOPCUAAcknowledge(conn)
+}
+
+// opcuaHello returns the Hello message opening an OPC UA TCP connection to endpoint
+func opcuaHello(endpoint string) []byte {
+	body := new(bytes.Buffer)
+	for _, value := range []uint32{
+		0,               // protocol version
+		opcuaBufferSize, // receive buffer size
+		opcuaBufferSize, // send buffer size
+		0,               // no maximum message size
+		0,               // no maximum chunk count
+	} {
+		binary.Write(body, binary.LittleEndian, value)
+	}
+	binary.Write(body, binary.LittleEndian, int32(len(endpoint)))
+	body.WriteString(endpoint)
+
+	message := new(bytes.Buffer)
+	message.WriteString("HELF")
+	binary.Write(message, binary.LittleEndian, uint32(8+body.Len()))
+	message.Write(body.Bytes())
+
+	return message.Bytes()
+}
+
+// readOPCUAAcknowledge reads the answer to the Hello message, the server answers with an Acknowledge message or with
+// an Error message carrying the status code of the failure
+func readOPCUAAcknowledge(reader io.Reader) error {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return fmt.Errorf("no OPC UA acknowledge: %w", err)
+	}
+
+	size := binary.LittleEndian.Uint32(header[4:])
+	if size < 8 || size > 8+8+opcuaMaxReason {
+		return errors.New("invalid OPC UA message")
+	}
+
+	body := make([]byte, size-8)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return fmt.Errorf("truncated OPC UA message: %w", err)
+	}
+
+	switch string(header[:4]) {
+	case "ACKF":
+		if len(body) < 20 {
+			return errors.New("invalid OPC UA acknowledge")
+		}
+
+		return nil
+	case "ERRF":
+		if len(body) < 8 {
+			return errors.New("invalid OPC UA error")
+		}
+
+		status := binary.LittleEndian.Uint32(body[0:])
+		reason := ""
+		if length := int32(binary.LittleEndian.Uint32(body[4:])); length > 0 && int(length) <= len(body)-8 {
+			reason = string(body[8 : 8+length])
+		}
+
+		return fmt.Errorf("OPC UA error 0x%08X: %s", status, reason)
+	}
+
+	return fmt.Errorf("unexpected OPC UA message %q", header[:4])
+}
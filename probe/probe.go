@@ -0,0 +1,378 @@
+// Package probe runs the synthetic probes defined by the Edge stacks against their applications, from the agent, and
+// reports whether they pass along with their latency, providing the health of the applications beyond the state of
+// their containers. The HTTP and TCP probes are built in, the protocols of the industrial equipment (Modbus TCP,
+// OPC UA) are provided by the checkers registered for their type.
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Types of the probes
+const (
+	TypeHTTP   = "http"
+	TypeTCP    = "tcp"
+	TypeModbus = "modbus"
+	TypeOPCUA  = "opcua"
+)
+
+const (
+	// DefaultInterval is the default interval between two runs of a probe
+	DefaultInterval = 30 * time.Second
+	// DefaultTimeout is the default maximum duration of a probe
+	DefaultTimeout = 5 * time.Second
+	// minInterval is the shortest interval accepted, so that the probes never load the applications
+	minInterval = 5 * time.Second
+)
+
+var (
+	stacks   = map[int]*stackProbes{}
+	stacksMu sync.Mutex
+
+	checkers = map[string]Checker{
+		TypeHTTP:   httpChecker{},
+		TypeTCP:    tcpChecker{},
+		TypeModbus: modbusChecker{},
+		TypeOPCUA:  opcuaChecker{},
+	}
+	checkersMu sync.RWMutex
+
+	// httpClient does not follow the redirections, they are checked against the expected status
+	httpClient = &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+)
+
+// Definition is a synthetic probe defined by a stack
+type Definition struct {
+	Name string `json:"Name"`
+	Type string `json:"Type"`
+	// Target is the URL of the HTTP probes and the host:port address of the TCP probes
+	Target string `json:"Target"`
+	// ExpectedStatus is the status code expected from an HTTP probe, the 2xx and 3xx codes pass when it is not set
+	ExpectedStatus int `json:"ExpectedStatus,omitempty"`
+	// Options are the parameters specific to the type of the probe, e.g. the unit and the register read by a
+	// Modbus probe
+	Options  map[string]string `json:"Options,omitempty"`
+	Interval time.Duration     `json:"Interval"`
+	Timeout  time.Duration     `json:"Timeout"`
+}
+
+// Checker runs the probes of a type
+type Checker interface {
+	// Validate checks the target and the options of a definition, it can set their default values
+	Validate(definition *Definition) error
+	// Check runs the probe once, it returns the status code of the answer when the protocol has one
+	Check(ctx context.Context, definition Definition) (int, error)
+}
+
+// Result is the outcome of the last run of a probe
+type Result struct {
+	StackID int    `json:"StackID"`
+	Stack   string `json:"Stack"`
+	Name    string `json:"Name"`
+	Type    string `json:"Type"`
+	// Target is redacted from the credentials of the URL
+	Target     string    `json:"Target"`
+	Passed     bool      `json:"Passed"`
+	LatencyMs  int64     `json:"LatencyMs"`
+	StatusCode int       `json:"StatusCode,omitempty"`
+	Error      string    `json:"Error,omitempty"`
+	CheckedAt  time.Time `json:"CheckedAt"`
+	// ConsecutiveFailures is the number of failed runs since the last successful one
+	ConsecutiveFailures int `json:"ConsecutiveFailures,omitempty"`
+}
+
+type stackProbes struct {
+	cancel  context.CancelFunc
+	results []Result
+}
+
+// Validate checks the definition and sets the default interval and timeout
+func (definition *Definition) Validate() error {
+	if definition.Name == "" {
+		return errors.New("the name of the probe is required")
+	}
+
+	checker, ok := checkerOf(definition.Type)
+	if !ok {
+		return fmt.Errorf("unsupported type of the probe %s: %q", definition.Name, definition.Type)
+	}
+
+	if err := checker.Validate(definition); err != nil {
+		return err
+	}
+
+	if definition.Interval == 0 {
+		definition.Interval = DefaultInterval
+	}
+
+	if definition.Interval < minInterval {
+		return fmt.Errorf("the interval of the probe %s must be at least %s", definition.Name, minInterval)
+	}
+
+	if definition.Timeout <= 0 {
+		definition.Timeout = DefaultTimeout
+	}
+
+	return nil
+}
+
+// Register makes checker run the probes of probeType, replacing the checker previously registered for the type
+func Register(probeType string, checker Checker) {
+	checkersMu.Lock()
+	defer checkersMu.Unlock()
+
+	checkers[probeType] = checker
+}
+
+func checkerOf(probeType string) (Checker, bool) {
+	checkersMu.RLock()
+	defer checkersMu.RUnlock()
+
+	checker, ok := checkers[probeType]
+
+	return checker, ok
+}
+
+// Start runs the probes of a stack in the background, replacing its previous probes
+func Start(stackID int, stackName string, definitions []Definition) {
+	Stop(stackID)
+
+	if len(definitions) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	probes := &stackProbes{
+		cancel:  cancel,
+		results: make([]Result, len(definitions)),
+	}
+
+	for i, definition := range definitions {
+		probes.results[i] = Result{
+			StackID: stackID,
+			Stack:   stackName,
+			Name:    definition.Name,
+			Type:    definition.Type,
+			Target:  redactTarget(definition),
+		}
+	}
+
+	stacksMu.Lock()
+	stacks[stackID] = probes
+	stacksMu.Unlock()
+
+	for i, definition := range definitions {
+		go run(ctx, probes, i, definition)
+	}
+}
+
+// Stop stops the probes of a stack that is no longer deployed and removes their results
+func Stop(stackID int) {
+	stacksMu.Lock()
+	defer stacksMu.Unlock()
+
+	if probes, ok := stacks[stackID]; ok {
+		probes.cancel()
+		delete(stacks, stackID)
+	}
+}
+
+// Results returns the results of the probes that ran at least once, sorted by stack identifier and probe name
+func Results() []Result {
+	stacksMu.Lock()
+	defer stacksMu.Unlock()
+
+	var results []Result
+	for _, probes := range stacks {
+		for _, result := range probes.results {
+			if !result.CheckedAt.IsZero() {
+				results = append(results, result)
+			}
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].StackID != results[j].StackID {
+			return results[i].StackID < results[j].StackID
+		}
+
+		return results[i].Name < results[j].Name
+	})
+
+	return results
+}
+
+// Diagnostics returns a diagnostic message for each failing probe
+func Diagnostics() []string {
+	var diagnostics []string
+	for _, result := range Results() {
+		if !result.Passed {
+			diagnostics = append(diagnostics, fmt.Sprintf("probe %s of the stack %s is failing (%d consecutive failures): %s", result.Name, result.Stack, result.ConsecutiveFailures, result.Error))
+		}
+	}
+
+	return diagnostics
+}
+
+// run runs a probe at each interval until ctx is done, its results are stored at index in probes
+func run(ctx context.Context, probes *stackProbes, index int, definition Definition) {
+	ticker := time.NewTicker(definition.Interval)
+	defer ticker.Stop()
+
+	for {
+		result := check(ctx, definition)
+
+		stacksMu.Lock()
+		previous := probes.results[index]
+		result.StackID, result.Stack, result.Target = previous.StackID, previous.Stack, previous.Target
+		if !result.Passed {
+			result.ConsecutiveFailures = previous.ConsecutiveFailures + 1
+		}
+		probes.results[index] = result
+		stacksMu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check runs a probe once
+func check(ctx context.Context, definition Definition) Result {
+	ctx, cancel := context.WithTimeout(ctx, definition.Timeout)
+	defer cancel()
+
+	result := Result{
+		Name:      definition.Name,
+		Type:      definition.Type,
+		CheckedAt: time.Now().UTC(),
+	}
+
+	start := time.Now()
+
+	var err error
+	if checker, ok := checkerOf(definition.Type); ok {
+		result.StatusCode, err = checker.Check(ctx, definition)
+	} else {
+		err = fmt.Errorf("unsupported type of the probe: %q", definition.Type)
+	}
+
+	result.LatencyMs = time.Since(start).Milliseconds()
+	result.Passed = err == nil
+
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+// httpChecker sends a GET request to the URL of the probe
+type httpChecker struct{}
+
+func (httpChecker) Validate(definition *Definition) error {
+	u, err := url.Parse(definition.Target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid URL of the probe %s: %q", definition.Name, definition.Target)
+	}
+
+	if definition.ExpectedStatus != 0 && (definition.ExpectedStatus < 100 || definition.ExpectedStatus > 599) {
+		return fmt.Errorf("invalid expected status of the probe %s: %d", definition.Name, definition.ExpectedStatus)
+	}
+
+	return nil
+}
+
+func (httpChecker) Check(ctx context.Context, definition Definition) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, definition.Target, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		// the errors of the client contain the URL, which may contain credentials
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if definition.ExpectedStatus != 0 && resp.StatusCode != definition.ExpectedStatus {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d, expected %d", resp.StatusCode, definition.ExpectedStatus)
+	}
+
+	if definition.ExpectedStatus == 0 && resp.StatusCode >= http.StatusBadRequest {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// tcpChecker opens a TCP connection to the address of the probe
+type tcpChecker struct{}
+
+func (tcpChecker) Validate(definition *Definition) error {
+	if _, _, err := net.SplitHostPort(definition.Target); err != nil {
+		return fmt.Errorf("invalid address of the probe %s: %w", definition.Name, err)
+	}
+
+	return nil
+}
+
+func (tcpChecker) Check(ctx context.Context, definition Definition) (int, error) {
+	conn, err := dial(ctx, definition.Target)
+	if err != nil {
+		return 0, err
+	}
+
+	return 0, conn.Close()
+}
+
+// dial opens a TCP connection to address, the connection is bounded by the deadline of ctx
+func dial(ctx context.Context, address string) (net.Conn, error) {
+	dialer := &net.Dialer{}
+
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	return conn, nil
+}
+
+// redactTarget returns the target of the probe without the credentials of its URL
+func redactTarget(definition Definition) string {
+	if definition.Type != TypeHTTP && definition.Type != TypeOPCUA {
+		return definition.Target
+	}
+
+	u, err := url.Parse(definition.Target)
+	if err != nil {
+		return definition.Target
+	}
+
+	return u.Redacted()
+}
@@ -0,0 +1,94 @@
+package provisioning
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// dhcpLeasePatterns match the leases of dhclient, systemd-networkd and NetworkManager
+var dhcpLeasePatterns = []string{
+	"/var/lib/dhcp/dhclient*.leases",
+	"/var/lib/dhclient/*.lease*",
+	"/run/systemd/netif/leases/*",
+	"/var/lib/NetworkManager/*.lease",
+}
+
+// dhcpSource reads the provisioning URL from a site-specific option of the DHCP leases of the host and discovers the
+// enrollment configuration from this URL. The URL is provided by the network, it must use HTTPS.
+type dhcpSource struct {
+	patterns []string
+	option   int
+}
+
+func (source *dhcpSource) Name() string {
+	return SourceDHCP
+}
+
+func (source *dhcpSource) Discover(ctx context.Context) (*Config, error) {
+	var provisioningURL string
+
+	for _, pattern := range source.patterns {
+		for _, path := range hostPaths(pattern) {
+			value, err := readDHCPOption(path, source.option)
+			if err != nil {
+				return nil, err
+			}
+
+			if value != "" {
+				provisioningURL = value
+			}
+		}
+	}
+
+	if provisioningURL == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(provisioningURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid provisioning URL %q provided by the DHCP option %d, an HTTPS URL is required", provisioningURL, source.option)
+	}
+
+	return (&urlSource{url: provisioningURL}).Discover(ctx)
+}
+
+// readDHCPOption returns the value of the option in the last lease of the file, in the dhclient format
+// (option unknown-224 "value"; or option unknown-224 76:61:6c;) or in the systemd-networkd format (OPTION_224=76616c)
+func readDHCPOption(path string, option int) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	dhclientPrefix := "option unknown-" + strconv.Itoa(option) + " "
+	networkdPrefix := "OPTION_" + strconv.Itoa(option) + "="
+
+	var value string
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if raw, ok := strings.CutPrefix(line, dhclientPrefix); ok {
+			raw = strings.TrimSuffix(raw, ";")
+			if unquoted, err := strconv.Unquote(raw); err == nil {
+				value = unquoted
+			} else if decoded, err := hex.DecodeString(strings.ReplaceAll(raw, ":", "")); err == nil {
+				value = string(decoded)
+			}
+		} else if raw, ok := strings.CutPrefix(line, networkdPrefix); ok {
+			if decoded, err := hex.DecodeString(raw); err == nil {
+				value = string(decoded)
+			}
+		}
+	}
+
+	return strings.TrimRight(value, "\x00"), scanner.Err()
+}
@@ -0,0 +1,67 @@
+package provisioning
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+)
+
+// dmiOEMStringsPattern matches the SMBIOS OEM strings structures (type 11) exposed by the kernel
+const dmiOEMStringsPattern = "/sys/firmware/dmi/entries/11-*/raw"
+
+// dmiKeyPrefix prefixes the OEM strings of the enrollment configuration, e.g. io.portainer.agent.url=https://...
+const dmiKeyPrefix = "io.portainer.agent."
+
+// dmiSource reads the enrollment configuration from the SMBIOS OEM strings set by the hypervisor or the
+// manufacturer, e.g. with qemu -smbios type=11,value=io.portainer.agent.enroll_code=7G4K-2MXQ
+type dmiSource struct {
+	pattern string
+}
+
+func (source *dmiSource) Name() string {
+	return SourceDMI
+}
+
+func (source *dmiSource) Discover(ctx context.Context) (*Config, error) {
+	var config Config
+
+	for _, path := range hostPaths(source.pattern) {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, value := range parseDMIStrings(raw) {
+			key, value, ok := strings.Cut(value, "=")
+			if !ok {
+				continue
+			}
+
+			if key, ok := strings.CutPrefix(key, dmiKeyPrefix); ok {
+				config.set(key, value)
+			}
+		}
+	}
+
+	return &config, nil
+}
+
+// parseDMIStrings returns the strings of an SMBIOS structure: the formatted area, whose length is the second byte, is
+// followed by the null-terminated strings and ends with an empty string
+func parseDMIStrings(raw []byte) []string {
+	if len(raw) < 4 || int(raw[1]) > len(raw) {
+		return nil
+	}
+
+	var values []string
+	for _, value := range bytes.Split(raw[raw[1]:], []byte{0}) {
+		if len(value) == 0 {
+			break
+		}
+
+		values = append(values, string(value))
+	}
+
+	return values
+}
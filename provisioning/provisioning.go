@@ -0,0 +1,159 @@
+// Package provisioning discovers the enrollment configuration of an Edge agent on its first boot from the cloud-init
+// user-data, the SMBIOS OEM strings, a DHCP option or a provisioning URL, so that a fleet of devices can be
+// provisioned without configuring each device.
+package provisioning
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/portainer/agent"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Names of the discovery sources
+const (
+	SourceUserData = "userdata"
+	SourceDMI      = "dmi"
+	SourceDHCP     = "dhcp"
+	SourceURL      = "url"
+)
+
+var sourceNames = []string{SourceUserData, SourceDMI, SourceDHCP, SourceURL}
+
+// hostRoot is where the host filesystem is mounted in the agent container, the paths are read from the filesystem
+// of the agent when it is not mounted
+var hostRoot = agent.HostRoot
+
+// Config is the enrollment configuration of the agent, the empty fields are not configured
+type Config struct {
+	// ServerURL is the URL of the Portainer instance the agent enrolls with or is claimed with
+	ServerURL  string `yaml:"url" json:"url"`
+	EnrollCode string `yaml:"enroll_code" json:"enroll_code"`
+	EdgeKey    string `yaml:"edge_key" json:"edge_key"`
+	EdgeID     string `yaml:"edge_id" json:"edge_id"`
+	Claim      bool   `yaml:"claim" json:"claim"`
+}
+
+// Source discovers the enrollment configuration, Discover returns nil when the source provides no configuration
+type Source interface {
+	Name() string
+	Discover(ctx context.Context) (*Config, error)
+}
+
+// ValidateSources returns an error when a name is not a discovery source or when the url source has no URL
+func ValidateSources(names []string, provisioningURL string) error {
+	for _, name := range names {
+		if !slices.Contains(sourceNames, name) {
+			return fmt.Errorf("invalid provisioning source %q, expected one of %s", name, strings.Join(sourceNames, ", "))
+		}
+
+		if name == SourceURL && provisioningURL == "" {
+			return fmt.Errorf("the provisioning URL is required by the %s provisioning source", SourceURL)
+		}
+	}
+
+	return nil
+}
+
+// NewSources returns the discovery sources named names, in the same order
+func NewSources(names []string, provisioningURL string) []Source {
+	sources := make([]Source, 0, len(names))
+	for _, name := range names {
+		switch name {
+		case SourceUserData:
+			sources = append(sources, &userDataSource{paths: userDataPaths})
+		case SourceDMI:
+			sources = append(sources, &dmiSource{pattern: dmiOEMStringsPattern})
+		case SourceDHCP:
+			sources = append(sources, &dhcpSource{patterns: dhcpLeasePatterns, option: agent.ProvisioningDHCPOption})
+		case SourceURL:
+			sources = append(sources, &urlSource{url: provisioningURL})
+		}
+	}
+
+	return sources
+}
+
+// Discover returns the configuration of the first source providing one, nil when no source provides a configuration
+func Discover(ctx context.Context, sources []Source) *Config {
+	for _, source := range sources {
+		config, err := source.Discover(ctx)
+		if err != nil {
+			log.Warn().Err(err).Str("source", source.Name()).Msg("unable to discover the provisioning configuration")
+
+			continue
+		}
+
+		if config == nil || config.isEmpty() {
+			continue
+		}
+
+		log.Info().Str("source", source.Name()).Msg("provisioning configuration discovered")
+
+		return config
+	}
+
+	return nil
+}
+
+// Apply sets the options that are not defined from the configuration
+func (config *Config) Apply(options *agent.Options) {
+	if options.EdgeEnrollURL == "" {
+		options.EdgeEnrollURL = config.ServerURL
+	}
+
+	if options.EdgeEnrollCode == "" {
+		options.EdgeEnrollCode = config.EnrollCode
+	}
+
+	if options.EdgeKey == "" {
+		options.EdgeKey = config.EdgeKey
+	}
+
+	if options.EdgeID == "" {
+		options.EdgeID = config.EdgeID
+	}
+
+	options.EdgeClaim = options.EdgeClaim || config.Claim
+}
+
+func (config *Config) isEmpty() bool {
+	return *config == Config{}
+}
+
+// set sets the field of the configuration named key, as used in the user-data, unknown keys are ignored
+func (config *Config) set(key, value string) {
+	switch strings.ToLower(strings.TrimSpace(key)) {
+	case "url":
+		config.ServerURL = value
+	case "enroll_code":
+		config.EnrollCode = value
+	case "edge_key":
+		config.EdgeKey = value
+	case "edge_id":
+		config.EdgeID = value
+	case "claim":
+		config.Claim = value == "1" || strings.EqualFold(value, "true")
+	}
+}
+
+// hostPaths returns the paths matching pattern on the host, or on the filesystem of the agent when the host
+// filesystem is not mounted
+func hostPaths(pattern string) []string {
+	if _, err := os.Stat(hostRoot); err == nil {
+		matches, _ := filepath.Glob(filepath.Join(hostRoot, pattern))
+		if len(matches) > 0 {
+			return matches
+		}
+	}
+
+	matches, _ := filepath.Glob(pattern)
+
+	return matches
+}
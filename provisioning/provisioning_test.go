@@ -0,0 +1,135 @@
+package provisioning
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/portainer/agent"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUserDataSource(t *testing.T) {
+	dir := t.TempDir()
+	hostRoot = filepath.Join(dir, "missing")
+
+	writeFile(t, filepath.Join(dir, "script"), "#!/bin/sh\necho hello\n")
+	writeFile(t, filepath.Join(dir, "other"), "#cloud-config\npackages: [curl]\n")
+	writeFile(t, filepath.Join(dir, "user-data"), "#cloud-config\npackages: [curl]\nportainer_agent:\n  url: https://portainer.example.com\n  enroll_code: 7G4K-2MXQ\n  claim: true\n")
+
+	source := &userDataSource{paths: []string{filepath.Join(dir, "script"), filepath.Join(dir, "other"), filepath.Join(dir, "user-data")}}
+
+	config, err := source.Discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Config{ServerURL: "https://portainer.example.com", EnrollCode: "7G4K-2MXQ", Claim: true}
+	if config == nil || *config != expected {
+		t.Fatalf("expected %+v, got %+v", expected, config)
+	}
+}
+
+func TestDMISource(t *testing.T) {
+	dir := t.TempDir()
+	hostRoot = dir
+
+	// type 11, length 5, handle 0x000b, 2 strings
+	raw := append([]byte{11, 5, 0x0b, 0x00, 2}, []byte("io.portainer.agent.url=https://portainer.example.com\x00io.portainer.agent.edge_id=device-1\x00other=value\x00\x00")...)
+	writeFile(t, filepath.Join(dir, "sys", "firmware", "dmi", "entries", "11-0", "raw"), string(raw))
+
+	config, err := (&dmiSource{pattern: dmiOEMStringsPattern}).Discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Config{ServerURL: "https://portainer.example.com", EdgeID: "device-1"}
+	if config == nil || *config != expected {
+		t.Fatalf("expected %+v, got %+v", expected, config)
+	}
+}
+
+func TestReadDHCPOption(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFile(t, filepath.Join(dir, "dhclient.leases"), `lease {
+  interface "eth0";
+  option unknown-224 "https://old.example.com/agent.yaml";
+}
+lease {
+  interface "eth0";
+  option unknown-224 68:74:74:70:73:3a:2f:2f:70:2e:65:78:61:6d:70:6c:65:2e:63:6f:6d;
+}
+`)
+	writeFile(t, filepath.Join(dir, "networkd"), "ADDRESS=10.0.0.2\nOPTION_224="+hex.EncodeToString([]byte("https://p.example.com"))+"\n")
+
+	for _, name := range []string{"dhclient.leases", "networkd"} {
+		value, err := readDHCPOption(filepath.Join(dir, name), agent.ProvisioningDHCPOption)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if value != "https://p.example.com" {
+			t.Errorf("%s: expected the option of the last lease, got %q", name, value)
+		}
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/agent.json":
+			w.Write([]byte(`{"url": "https://portainer.example.com", "edge_key": "key"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	config := Discover(context.Background(), []Source{
+		&urlSource{url: srv.URL + "/missing.yaml"},
+		&urlSource{url: srv.URL + "/agent.json"},
+	})
+
+	expected := Config{ServerURL: "https://portainer.example.com", EdgeKey: "key"}
+	if config == nil || *config != expected {
+		t.Fatalf("expected %+v, got %+v", expected, config)
+	}
+
+	options := &agent.Options{EdgeID: "configured"}
+	config.EdgeID = "discovered"
+	config.Apply(options)
+
+	if options.EdgeKey != "key" || options.EdgeEnrollURL != "https://portainer.example.com" || options.EdgeID != "configured" {
+		t.Errorf("expected the undefined options to be set, got %+v", options)
+	}
+}
+
+func TestValidateSources(t *testing.T) {
+	if err := ValidateSources([]string{SourceUserData, SourceDMI, SourceDHCP}, ""); err != nil {
+		t.Error(err)
+	}
+
+	if err := ValidateSources([]string{SourceURL}, ""); err == nil {
+		t.Error("expected the provisioning URL to be required")
+	}
+
+	if err := ValidateSources([]string{"floppy"}, ""); err == nil {
+		t.Error("expected an unknown source to be rejected")
+	}
+}
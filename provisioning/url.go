@@ -0,0 +1,73 @@
+package provisioning
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/portainer/agent/crypto"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// urlRequestTimeout is the maximum duration of the request of the provisioning configuration
+	urlRequestTimeout = 30 * time.Second
+	// urlMaxSize is the maximum size of the provisioning configuration
+	urlMaxSize = 64 * 1024
+)
+
+// urlSource reads the enrollment configuration, in YAML or in JSON, from a provisioning URL
+type urlSource struct {
+	url string
+}
+
+func (source *urlSource) Name() string {
+	return SourceURL
+}
+
+func (source *urlSource) Discover(ctx context.Context) (*Config, error) {
+	ctx, cancel := context.WithTimeout(ctx, urlRequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = crypto.CreateTLSConfiguration()
+
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the provisioning configuration was requested with the status %d", resp.StatusCode)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, urlMaxSize))
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if bytes.HasPrefix(bytes.TrimSpace(content), []byte("{")) {
+		err = json.Unmarshal(content, &config)
+	} else {
+		err = yaml.Unmarshal(content, &config)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid provisioning configuration: %w", err)
+	}
+
+	return &config, nil
+}
@@ -0,0 +1,67 @@
+package provisioning
+
+import (
+	"context"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// userDataKey is the key of the enrollment configuration in the cloud-config user-data, cloud-init ignores it
+const userDataKey = "portainer_agent"
+
+// userDataPaths are the user-data of the cloud-init instance and of the NoCloud seeds, including the boot partition
+// of the Raspberry Pi and Ubuntu Server images
+var userDataPaths = []string{
+	"/var/lib/cloud/instance/user-data.txt",
+	"/var/lib/cloud/seed/nocloud/user-data",
+	"/var/lib/cloud/seed/nocloud-net/user-data",
+	"/boot/firmware/user-data",
+	"/boot/user-data",
+}
+
+// userDataSource reads the enrollment configuration from the portainer_agent key of the cloud-config user-data:
+//
+//	#cloud-config
+//	portainer_agent:
+//	  url: https://portainer.example.com
+//	  enroll_code: 7G4K-2MXQ
+type userDataSource struct {
+	paths []string
+}
+
+func (source *userDataSource) Name() string {
+	return SourceUserData
+}
+
+func (source *userDataSource) Discover(ctx context.Context) (*Config, error) {
+	for _, pattern := range source.paths {
+		for _, path := range hostPaths(pattern) {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+
+			// The user-data can be a script or a multi-part archive, only the cloud-config documents are parsed
+			var userData map[string]yaml.Node
+			if yaml.Unmarshal(content, &userData) != nil {
+				continue
+			}
+
+			node, ok := userData[userDataKey]
+			if !ok {
+				continue
+			}
+
+			var config Config
+			err = node.Decode(&config)
+			if err != nil {
+				return nil, err
+			}
+
+			return &config, nil
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,79 @@
+package registryauth
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	defaultGitResolver   *Resolver
+	defaultGitResolverMu sync.Mutex
+)
+
+// NewGitResolver returns a pointer to a Resolver of the credentials of the Git repositories. helpers maps the Git hosts
+// to the names of their credential helper, the "*" host sets the helper of the other hosts. The helpers are called
+// with the https://<host> server URL and the credentials are cached for ttl.
+func NewGitResolver(helpers map[string]string, ttl time.Duration) *Resolver {
+	resolver := NewResolver(helpers, ttl)
+	resolver.serverURL = func(host string) string {
+		return "https://" + host
+	}
+
+	return resolver
+}
+
+// EnableGit makes resolver the resolver of the credentials of the Git repositories, a nil resolver disables the
+// credential helpers of the Git repositories
+func EnableGit(resolver *Resolver) {
+	defaultGitResolverMu.Lock()
+	defer defaultGitResolverMu.Unlock()
+
+	defaultGitResolver = resolver
+}
+
+func enabledGitResolver() *Resolver {
+	defaultGitResolverMu.Lock()
+	defer defaultGitResolverMu.Unlock()
+
+	return defaultGitResolver
+}
+
+// AuthenticatedGitURL returns repositoryURL with the credentials returned by the helper of its host. The URLs that are
+// not HTTP Git URLs, that already contain credentials or whose host has no helper are returned unchanged.
+func AuthenticatedGitURL(repositoryURL string) (string, error) {
+	resolver := enabledGitResolver()
+	if resolver == nil || !IsHTTPGitURL(repositoryURL) {
+		return repositoryURL, nil
+	}
+
+	u, err := url.Parse(repositoryURL)
+	if err != nil || u.User != nil {
+		return repositoryURL, nil
+	}
+
+	registryCredentials, err := resolver.Get(u.Host)
+	if errors.Is(err, ErrNoCredentials) {
+		return repositoryURL, nil
+	} else if err != nil {
+		return repositoryURL, err
+	}
+
+	u.User = url.UserPassword(registryCredentials.Username, registryCredentials.Secret)
+
+	return u.String(), nil
+}
+
+// IsHTTPGitURL returns true when rawURL is the HTTP URL of a Git repository as understood by the Docker daemon, e.g.
+// https://github.com/portainer/agent.git#develop
+func IsHTTPGitURL(rawURL string) bool {
+	if !strings.HasPrefix(rawURL, "https://") && !strings.HasPrefix(rawURL, "http://") {
+		return false
+	}
+
+	repository, _, _ := strings.Cut(rawURL, "#")
+
+	return strings.HasSuffix(repository, ".git")
+}
@@ -0,0 +1,237 @@
+// Package registryauth resolves the credentials of the container registries and of the Git repositories with the
+// Docker credential helpers (docker-credential-ecr-login, docker-credential-gcr...) configured on the agent, so that
+// the agent never stores them. The credentials returned by the helpers are often short-lived tokens, they are cached
+// in memory for a limited time and requested again once expired or refused by the registry.
+package registryauth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker-credential-helpers/client"
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/docker/docker/api/types"
+	"github.com/portainer/portainer/api/edge"
+)
+
+const (
+	// helperProgramPrefix is the prefix of the executables of the Docker credential helpers
+	helperProgramPrefix = "docker-credential-"
+	// defaultHelperKey is the registry key of the helper used for the registries without a dedicated helper
+	defaultHelperKey = "*"
+	// dockerHubHost is the registry host of the images without a registry
+	dockerHubHost = "docker.io"
+	// dockerHubServerURL is the server URL of Docker Hub expected by the credential helpers
+	dockerHubServerURL = "https://index.docker.io/v1/"
+	// identityTokenUsername is the username returned by the helpers along with an identity token instead of a password
+	identityTokenUsername = "<token>"
+)
+
+// ErrNoCredentials is returned when no credential helper provides credentials for a registry
+var ErrNoCredentials = errors.New("no credentials found for the registry")
+
+var (
+	defaultResolver   *Resolver
+	defaultResolverMu sync.Mutex
+)
+
+type cachedCredentials struct {
+	credentials *edge.RegistryCredentials
+	expiresAt   time.Time
+}
+
+// Resolver resolves the credentials of the registries with the credential helpers and caches them
+type Resolver struct {
+	// helpers maps the registry hosts to the names of their helper, without the docker-credential- prefix
+	helpers map[string]string
+	ttl     time.Duration
+	program func(helper string) client.ProgramFunc
+	// serverURL returns the server URL sent to the helpers for a host
+	serverURL func(host string) string
+
+	mu    sync.Mutex
+	cache map[string]cachedCredentials
+}
+
+// NewResolver returns a pointer to a Resolver. helpers maps the registry hosts to the names of their credential
+// helper, the "*" host sets the helper of the other registries. The credentials are cached for ttl.
+func NewResolver(helpers map[string]string, ttl time.Duration) *Resolver {
+	return &Resolver{
+		helpers: helpers,
+		ttl:     ttl,
+		program: func(helper string) client.ProgramFunc {
+			return client.NewShellProgramFunc(helperProgramPrefix + helper)
+		},
+		serverURL: registryServerURL,
+		cache:     map[string]cachedCredentials{},
+	}
+}
+
+// Enable makes resolver the resolver used by the agent, a nil resolver disables the credential helpers
+func Enable(resolver *Resolver) {
+	defaultResolverMu.Lock()
+	defer defaultResolverMu.Unlock()
+
+	defaultResolver = resolver
+}
+
+func enabledResolver() *Resolver {
+	defaultResolverMu.Lock()
+	defer defaultResolverMu.Unlock()
+
+	return defaultResolver
+}
+
+// Lookup returns the credentials of the registry of serverURL with the enabled resolver. ErrNoCredentials is returned
+// when the credential helpers are not enabled or do not know the registry.
+func Lookup(serverURL string) (*edge.RegistryCredentials, error) {
+	resolver := enabledResolver()
+	if resolver == nil {
+		return nil, ErrNoCredentials
+	}
+
+	return resolver.Get(serverURL)
+}
+
+// Invalidate removes the cached credentials of the registry of serverURL from the enabled resolver, so that they are
+// requested again from the helper, e.g. once refused by the registry
+func Invalidate(serverURL string) {
+	if resolver := enabledResolver(); resolver != nil {
+		resolver.Invalidate(serverURL)
+	}
+}
+
+// Get returns the credentials of the registry of serverURL, from the cache when they have not expired
+func (resolver *Resolver) Get(serverURL string) (*edge.RegistryCredentials, error) {
+	host := RegistryHost(serverURL)
+
+	helper, ok := resolver.helpers[host]
+	if !ok {
+		helper, ok = resolver.helpers[defaultHelperKey]
+	}
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+
+	resolver.mu.Lock()
+	defer resolver.mu.Unlock()
+
+	if cached, ok := resolver.cache[host]; ok && time.Now().Before(cached.expiresAt) {
+		return cached.credentials, nil
+	}
+
+	creds, err := client.Get(resolver.program(helper), resolver.serverURL(host))
+	if credentials.IsErrCredentialsNotFound(err) {
+		return nil, ErrNoCredentials
+	} else if err != nil {
+		return nil, err
+	}
+
+	registryCredentials := &edge.RegistryCredentials{
+		ServerURL: host,
+		Username:  creds.Username,
+		Secret:    creds.Secret,
+	}
+
+	resolver.cache[host] = cachedCredentials{
+		credentials: registryCredentials,
+		expiresAt:   time.Now().Add(resolver.ttl),
+	}
+
+	return registryCredentials, nil
+}
+
+// Invalidate removes the cached credentials of the registry of serverURL
+func (resolver *Resolver) Invalidate(serverURL string) {
+	resolver.mu.Lock()
+	defer resolver.mu.Unlock()
+
+	delete(resolver.cache, RegistryHost(serverURL))
+}
+
+// registryServerURL returns the server URL of a registry expected by the credential helpers
+func registryServerURL(host string) string {
+	if host == dockerHubHost {
+		return dockerHubServerURL
+	}
+
+	return host
+}
+
+// RegistryHost returns the host of the registry of a server URL (https://registry.example.com/v2/,
+// registry.example.com:5000...), the Docker Hub URLs are all normalized to docker.io
+func RegistryHost(serverURL string) string {
+	host := serverURL
+	if strings.Contains(serverURL, "://") {
+		if u, err := url.Parse(serverURL); err == nil {
+			host = u.Host
+		}
+	}
+
+	host, _, _ = strings.Cut(host, "/")
+	host = strings.ToLower(host)
+
+	if host == "index.docker.io" || host == "registry-1.docker.io" || host == "registry.hub.docker.com" {
+		return dockerHubHost
+	}
+
+	return host
+}
+
+// ImageRegistryHost returns the host of the registry of an image, docker.io for the images without a registry
+func ImageRegistryHost(image string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", err
+	}
+
+	return reference.Domain(named), nil
+}
+
+// EncodeAuth returns the credentials encoded for the X-Registry-Auth header of the Docker API. The identity tokens
+// returned by some helpers are sent as such so that the Docker daemon exchanges them for an access token.
+func EncodeAuth(registryCredentials *edge.RegistryCredentials) (string, error) {
+	authConfig := types.AuthConfig{
+		Username:      registryCredentials.Username,
+		Password:      registryCredentials.Secret,
+		ServerAddress: registryCredentials.ServerURL,
+	}
+
+	if registryCredentials.Username == identityTokenUsername {
+		authConfig = types.AuthConfig{
+			IdentityToken: registryCredentials.Secret,
+			ServerAddress: registryCredentials.ServerURL,
+		}
+	}
+
+	data, err := json.Marshal(authConfig)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.URLEncoding.EncodeToString(data), nil
+}
+
+// ImageRegistryAuth returns the encoded credentials of the registry of an image with the enabled resolver, it returns
+// an empty string when the image is pulled anonymously
+func ImageRegistryAuth(image string) (string, error) {
+	host, err := ImageRegistryHost(image)
+	if err != nil {
+		return "", err
+	}
+
+	registryCredentials, err := Lookup(host)
+	if errors.Is(err, ErrNoCredentials) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	return EncodeAuth(registryCredentials)
+}
@@ -0,0 +1,523 @@
+// Package relay lets an agent with access to the Portainer server relay the Edge requests of the agents of its LAN
+// that have no route to the server, e.g. the leaf devices of a site behind a gateway device. The relayed agents list
+// the URL of the relay in their Portainer URLs and sign every request with the secret shared by the agents of the
+// site, the relay verifies the signature of the hop and forwards the request through its own connection to the
+// server. The signature covers the method, the URI and the body of the request, so that a hop captured on the LAN
+// cannot be replayed against another endpoint, and the relay is served over TLS. A relay can itself reach the server
+// through another relay, the relays traversed by a request are recorded in the via header so that the requests going
+// around a loop are rejected.
+package relay
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/crypto"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// MaxHops is the maximum number of relays a request can traverse
+	MaxHops = 4
+	// MaxBodySize is the maximum size of the body of a relayed request, the body is read to verify its signature
+	// before it is forwarded
+	MaxBodySize = 32 << 20
+	// rejectionRetention is the duration during which the last rejected request is reported in the diagnostics
+	rejectionRetention = time.Hour
+	signaturePrefix    = "sha256="
+)
+
+var (
+	// ErrInvalidSignature is returned when the hop of a request is not signed with the secret of the site
+	ErrInvalidSignature = errors.New("invalid relay signature")
+	// ErrExpired is returned when the timestamp of the hop is outside of the tolerated window
+	ErrExpired = errors.New("expired relay timestamp")
+	// ErrReplayed is returned when the nonce of the hop was already received
+	ErrReplayed = errors.New("relay request already received")
+	// ErrBodyTooLarge is returned when the body of a relayed request exceeds MaxBodySize
+	ErrBodyTooLarge = errors.New("the body of the relayed request is too large")
+)
+
+// hopByHopHeaders are the headers of a hop that are not forwarded
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+	agent.HTTPRelayTimestampHeaderName,
+	agent.HTTPRelayNonceHeaderName,
+	agent.HTTPRelaySignatureHeaderName,
+}
+
+var (
+	defaultServer   *Server
+	defaultServerMu sync.Mutex
+)
+
+// Forwarder sends the relayed requests to the Portainer server
+type Forwarder interface {
+	Relay(req *http.Request) (*http.Response, error)
+}
+
+// Peer is an agent whose requests are relayed
+type Peer struct {
+	EdgeID   string    `json:"EdgeID"`
+	Requests uint64    `json:"Requests"`
+	LastSeen time.Time `json:"LastSeen"`
+}
+
+// Report is the state of the relay
+type Report struct {
+	ID       string `json:"ID"`
+	Upstream string `json:"Upstream,omitempty"`
+	Peers    []Peer `json:"Peers"`
+	Relayed  uint64 `json:"Relayed"`
+	Rejected uint64 `json:"Rejected"`
+	// LastRejection is the reason the last rejected request was not relayed
+	LastRejection   string     `json:"LastRejection,omitempty"`
+	LastRejectionAt *time.Time `json:"LastRejectionAt,omitempty"`
+}
+
+// Server relays the Edge requests of the peers of the LAN to the Portainer server
+type Server struct {
+	id                 string
+	secret             []byte
+	timestampTolerance time.Duration
+
+	mu        sync.Mutex
+	upstream  *url.URL
+	forwarder Forwarder
+	seen      map[string]time.Time
+	peers     map[string]*Peer
+	report    Report
+}
+
+// NewServer returns a pointer to a Server identified by id in the via header, the hops are signed with secret and
+// accepted when their timestamp differs from the clock of the agent by at most timestampTolerance
+func NewServer(id, secret string, timestampTolerance time.Duration) *Server {
+	return &Server{
+		id:                 id,
+		secret:             []byte(secret),
+		timestampTolerance: timestampTolerance,
+		seen:               map[string]time.Time{},
+		peers:              map[string]*Peer{},
+		report:             Report{ID: id},
+	}
+}
+
+// SetUpstream relays the requests to the Portainer server at baseURL through forwarder, the requests are rejected
+// until the upstream is set
+func (server *Server) SetUpstream(baseURL string, forwarder Forwarder) error {
+	upstream, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil || (upstream.Scheme != "https" && upstream.Scheme != "http") || upstream.Host == "" {
+		return fmt.Errorf("invalid Portainer URL %q", baseURL)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.upstream = upstream
+	server.forwarder = forwarder
+	server.report.Upstream = upstream.String()
+
+	return nil
+}
+
+// Sign signs the hop of req with secret, the signature covers the method, the URI, the SHA-256 of the body, the Edge
+// identifier and the relays traversed by the request. The body is read again through GetBody, a body that cannot be
+// read again is buffered, up to MaxBodySize bytes, so that it can be hashed.
+func Sign(req *http.Request, secret string, now time.Time) error {
+	bodyHash, err := hashBody(req)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	req.Header.Set(agent.HTTPRelayTimestampHeaderName, timestamp)
+	req.Header.Set(agent.HTTPRelayNonceHeaderName, hex.EncodeToString(nonce))
+	req.Header.Set(agent.HTTPRelaySignatureHeaderName, signature(req, bodyHash, []byte(secret)))
+
+	return nil
+}
+
+// hashBody returns the SHA-256 of the body of req
+func hashBody(req *http.Request) ([]byte, error) {
+	hash := sha256.New()
+
+	if req.Body == nil || req.Body == http.NoBody {
+		return hash.Sum(nil), nil
+	}
+
+	if req.GetBody == nil {
+		body, err := readBody(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		req.ContentLength = int64(len(body))
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	if _, err := io.Copy(hash, body); err != nil {
+		return nil, err
+	}
+
+	return hash.Sum(nil), nil
+}
+
+// readBody reads a body of up to MaxBodySize bytes
+func readBody(body io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(body, MaxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > MaxBodySize {
+		return nil, ErrBodyTooLarge
+	}
+
+	return data, nil
+}
+
+// signature returns the signature of the hop of req, the fields are separated by new lines that cannot be part of
+// them
+func signature(req *http.Request, bodyHash, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strings.Join([]string{
+		req.Header.Get(agent.HTTPRelayTimestampHeaderName),
+		req.Header.Get(agent.HTTPRelayNonceHeaderName),
+		req.Method,
+		req.URL.RequestURI(),
+		hex.EncodeToString(bodyHash),
+		req.Header.Get(agent.HTTPEdgeIdentifierHeaderName),
+		req.Header.Get(agent.HTTPRelayViaHeaderName),
+	}, "\n")))
+
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify returns an error when the hop of the request with body is not signed with the secret of the site, is
+// expired or was already received
+func (server *Server) verify(r *http.Request, body []byte, now time.Time) error {
+	unixTime, err := strconv.ParseInt(r.Header.Get(agent.HTTPRelayTimestampHeaderName), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	bodyHash := sha256.Sum256(body)
+	if !hmac.Equal([]byte(r.Header.Get(agent.HTTPRelaySignatureHeaderName)), []byte(signature(r, bodyHash[:], server.secret))) {
+		return ErrInvalidSignature
+	}
+
+	timestamp := time.Unix(unixTime, 0)
+	if delta := now.Sub(timestamp); delta > server.timestampTolerance || delta < -server.timestampTolerance {
+		return ErrExpired
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	for nonce, expiration := range server.seen {
+		if now.After(expiration) {
+			delete(server.seen, nonce)
+		}
+	}
+
+	nonce := r.Header.Get(agent.HTTPRelayNonceHeaderName)
+	if _, seen := server.seen[nonce]; seen {
+		return ErrReplayed
+	}
+
+	server.seen[nonce] = timestamp.Add(server.timestampTolerance)
+
+	return nil
+}
+
+// ServeHTTP verifies the hop of the request and relays it to the Portainer server
+func (server *Server) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	edgeID := r.Header.Get(agent.HTTPEdgeIdentifierHeaderName)
+
+	body, err := readBody(r.Body)
+	if err != nil {
+		statusCode := http.StatusBadRequest
+		if errors.Is(err, ErrBodyTooLarge) {
+			statusCode = http.StatusRequestEntityTooLarge
+		}
+
+		server.reject(rw, r, edgeID, statusCode, err)
+		return
+	}
+
+	if err := server.verify(r, body, time.Now()); err != nil {
+		server.reject(rw, r, edgeID, http.StatusUnauthorized, err)
+		return
+	}
+
+	var via []string
+	if header := r.Header.Get(agent.HTTPRelayViaHeaderName); header != "" {
+		via = strings.Split(header, ",")
+	}
+
+	for _, hop := range via {
+		if strings.TrimSpace(hop) == server.id {
+			server.reject(rw, r, edgeID, http.StatusLoopDetected, errors.New("the request already traversed this relay"))
+			return
+		}
+	}
+
+	if len(via) >= MaxHops {
+		server.reject(rw, r, edgeID, http.StatusLoopDetected, fmt.Errorf("the request traversed more than %d relays", MaxHops))
+		return
+	}
+
+	server.mu.Lock()
+	upstream, forwarder := server.upstream, server.forwarder
+	server.mu.Unlock()
+
+	if forwarder == nil {
+		http.Error(rw, "the relay is not connected to the Portainer server", http.StatusServiceUnavailable)
+		return
+	}
+
+	target := *upstream
+	target.Path = upstream.Path + r.URL.Path
+	target.RawPath = ""
+	target.RawQuery = r.URL.RawQuery
+
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req.Header = r.Header.Clone()
+	for _, header := range hopByHopHeaders {
+		req.Header.Del(header)
+	}
+	req.Header.Set(agent.HTTPRelayViaHeaderName, strings.Join(append(via, server.id), ","))
+
+	resp, err := forwarder.Relay(req)
+	if err != nil {
+		log.Debug().Err(err).Str("edge_id", edgeID).Msg("unable to relay the request to the Portainer server")
+
+		http.Error(rw, "the Portainer server is unreachable", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	server.relayed(edgeID)
+
+	for key, values := range resp.Header {
+		for _, value := range values {
+			rw.Header().Add(key, value)
+		}
+	}
+
+	rw.WriteHeader(resp.StatusCode)
+	io.Copy(rw, resp.Body)
+}
+
+func (server *Server) reject(rw http.ResponseWriter, r *http.Request, edgeID string, statusCode int, err error) {
+	log.Warn().Err(err).Str("edge_id", edgeID).Str("remote_addr", r.RemoteAddr).Msg("rejecting the relayed request")
+
+	server.mu.Lock()
+	now := time.Now()
+	server.report.Rejected++
+	server.report.LastRejection = fmt.Sprintf("%s from %s", err, r.RemoteAddr)
+	server.report.LastRejectionAt = &now
+	server.mu.Unlock()
+
+	http.Error(rw, err.Error(), statusCode)
+}
+
+func (server *Server) relayed(edgeID string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.report.Relayed++
+
+	peer, ok := server.peers[edgeID]
+	if !ok {
+		peer = &Peer{EdgeID: edgeID}
+		server.peers[edgeID] = peer
+	}
+
+	peer.Requests++
+	peer.LastSeen = time.Now()
+}
+
+// Report returns the state of the relay, nil when the relay is not enabled
+func (server *Server) Report() *Report {
+	if server == nil {
+		return nil
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	report := server.report
+	report.Peers = make([]Peer, 0, len(server.peers))
+	for _, peer := range server.peers {
+		report.Peers = append(report.Peers, *peer)
+	}
+
+	sort.Slice(report.Peers, func(i, j int) bool {
+		return report.Peers[i].EdgeID < report.Peers[j].EdgeID
+	})
+
+	return &report
+}
+
+// Diagnostics returns the last rejected request when it is recent
+func (report *Report) Diagnostics() []string {
+	if report == nil || report.LastRejectionAt == nil || time.Since(*report.LastRejectionAt) > rejectionRetention {
+		return nil
+	}
+
+	return []string{"the relay rejected a request: " + report.LastRejection}
+}
+
+// TLSConfig returns the TLS configuration of the relay. The relay is served with the certificate of the agent when
+// certFile and keyFile are set, and requires the peers to present a certificate signed by caFile when it is set. A
+// self-signed certificate is generated otherwise, the peers must then skip the verification of the certificate of
+// the relay.
+func TLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	config := crypto.CreateTLSConfiguration()
+
+	if certFile == "" || keyFile == "" {
+		cert, err := selfSignedCertificate()
+		if err != nil {
+			return nil, err
+		}
+
+		log.Warn().Msg("the Edge relay is served with a self-signed certificate, set the mTLS certificate of the agent to let the peers verify it")
+
+		config.Certificates = []tls.Certificate{cert}
+
+		return config, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config.Certificates = []tls.Certificate{cert}
+
+	if caFile != "" {
+		caCert, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificate found in %s", caFile)
+		}
+
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+func selfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: "portainer-agent-relay"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// Serve exposes the relay on addr over TLS, it blocks until the listener fails
+func Serve(addr string, server *Server, tlsConfig *tls.Config) error {
+	httpServer := &http.Server{
+		Addr:              addr,
+		Handler:           server,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 15 * time.Second,
+		IdleTimeout:       60 * time.Second,
+	}
+
+	log.Info().Str("addr", addr).Str("id", server.id).Msg("starting the Edge relay")
+
+	return httpServer.ListenAndServeTLS("", "")
+}
+
+// Enable makes server the default relay returned by DefaultServer
+func Enable(server *Server) {
+	defaultServerMu.Lock()
+	defer defaultServerMu.Unlock()
+
+	defaultServer = server
+}
+
+// DefaultServer returns the default relay, nil when the agent does not relay the requests of its peers
+func DefaultServer() *Server {
+	defaultServerMu.Lock()
+	defer defaultServerMu.Unlock()
+
+	return defaultServer
+}
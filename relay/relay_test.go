@@ -0,0 +1,282 @@
+package relay
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/portainer/agent"
+)
+
+const secret = "site-secret"
+
+// forwarder sends the relayed requests to the server, signing the hop like the Edge client of the relay
+type forwarder struct {
+	client *http.Client
+}
+
+func (f *forwarder) Relay(req *http.Request) (*http.Response, error) {
+	if err := Sign(req, secret, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return f.client.Do(req)
+}
+
+func newRequest(t *testing.T, url, via string) *http.Request {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, url+"/api/endpoints/1/edge/status?version=2", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set(agent.HTTPEdgeIdentifierHeaderName, "leaf")
+	if via != "" {
+		req.Header.Set(agent.HTTPRelayViaHeaderName, via)
+	}
+
+	return req
+}
+
+func TestServeHTTP(t *testing.T) {
+	portainer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		if r.URL.Path != "/portainer/api/endpoints/1/edge/status" || r.URL.RawQuery != "version=2" || string(body) != "payload" {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		rw.Header().Set("X-Via", r.Header.Get(agent.HTTPRelayViaHeaderName))
+		rw.Write([]byte(r.Header.Get(agent.HTTPEdgeIdentifierHeaderName)))
+	}))
+	defer portainer.Close()
+
+	gateway := NewServer("gateway", secret, time.Minute)
+	gatewayServer := httptest.NewServer(gateway)
+	defer gatewayServer.Close()
+
+	// the intermediate relay reaches the server through the gateway
+	intermediate := NewServer("intermediate", secret, time.Minute)
+	intermediateServer := httptest.NewServer(intermediate)
+	defer intermediateServer.Close()
+
+	req := newRequest(t, intermediateServer.URL, "")
+	if err := Sign(req, secret, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected the relay without upstream to be unavailable, got %d", resp.StatusCode)
+	}
+
+	if err := gateway.SetUpstream(portainer.URL+"/portainer/", &forwarder{client: http.DefaultClient}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := intermediate.SetUpstream(gatewayServer.URL, &forwarder{client: http.DefaultClient}); err != nil {
+		t.Fatal(err)
+	}
+
+	req = newRequest(t, intermediateServer.URL, "")
+	if err := Sign(req, secret, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "leaf" {
+		t.Fatalf("unexpected response %d %s", resp.StatusCode, body)
+	}
+
+	if via := resp.Header.Get("X-Via"); via != "intermediate,gateway" {
+		t.Errorf("unexpected via header %q", via)
+	}
+
+	report := gateway.Report()
+	if report.Relayed != 1 || len(report.Peers) != 1 || report.Peers[0].EdgeID != "leaf" || report.Upstream != portainer.URL+"/portainer" {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
+
+func TestServeHTTPRejected(t *testing.T) {
+	server := NewServer("gateway", secret, time.Minute)
+	server.SetUpstream("https://portainer.example.com", &forwarder{client: http.DefaultClient})
+
+	tests := []struct {
+		name       string
+		via        string
+		sign       func(req *http.Request)
+		statusCode int
+	}{
+		{
+			name:       "unsigned",
+			sign:       func(req *http.Request) {},
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name: "wrong secret",
+			sign: func(req *http.Request) {
+				Sign(req, "other-site", time.Now())
+			},
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name: "tampered via",
+			sign: func(req *http.Request) {
+				Sign(req, secret, time.Now())
+				req.Header.Set(agent.HTTPRelayViaHeaderName, "forged")
+			},
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name: "replayed to another endpoint",
+			sign: func(req *http.Request) {
+				Sign(req, secret, time.Now())
+				req.URL.Path = "/api/endpoints/2/edge/status"
+			},
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name: "tampered query",
+			sign: func(req *http.Request) {
+				Sign(req, secret, time.Now())
+				req.URL.RawQuery = "version=3"
+			},
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name: "tampered body",
+			sign: func(req *http.Request) {
+				Sign(req, secret, time.Now())
+				req.Body = io.NopCloser(strings.NewReader("forged"))
+			},
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name: "expired",
+			sign: func(req *http.Request) {
+				Sign(req, secret, time.Now().Add(-time.Hour))
+			},
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "loop",
+			via:        "intermediate,gateway",
+			statusCode: http.StatusLoopDetected,
+		},
+		{
+			name:       "too many hops",
+			via:        "a,b,c,d",
+			statusCode: http.StatusLoopDetected,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := newRequest(t, "http://gateway:9003", test.via)
+
+			if test.sign != nil {
+				test.sign(req)
+			} else {
+				Sign(req, secret, time.Now())
+			}
+
+			rec := httptest.NewRecorder()
+			server.ServeHTTP(rec, req)
+
+			if rec.Code != test.statusCode {
+				t.Errorf("expected the status code %d, got %d", test.statusCode, rec.Code)
+			}
+		})
+	}
+
+	report := server.Report()
+	if report.Rejected != uint64(len(tests)) || report.Relayed != 0 || len(report.Diagnostics()) != 1 {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
+
+func TestVerifyReplay(t *testing.T) {
+	server := NewServer("gateway", secret, time.Minute)
+
+	req := newRequest(t, "http://gateway:9003", "")
+	Sign(req, secret, time.Now())
+
+	if err := server.verify(req, []byte("payload"), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.verify(req, []byte("payload"), time.Now()); !errors.Is(err, ErrReplayed) {
+		t.Errorf("expected the replayed hop to be rejected, got %v", err)
+	}
+
+	if err := server.verify(req, []byte("payload"), time.Now().Add(2*time.Minute)); !errors.Is(err, ErrExpired) {
+		t.Errorf("expected the hop to expire, got %v", err)
+	}
+}
+
+func TestSignBuffersBody(t *testing.T) {
+	req := newRequest(t, "http://gateway:9003", "")
+	req.Body = io.NopCloser(strings.NewReader("payload"))
+	req.GetBody = nil
+
+	if err := Sign(req, secret, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := io.ReadAll(req.Body)
+	if string(body) != "payload" || req.ContentLength != int64(len(body)) {
+		t.Errorf("expected the body to be kept, got %q", body)
+	}
+
+	server := NewServer("gateway", secret, time.Minute)
+	if err := server.verify(req, body, time.Now()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	config, err := TLSConfig("", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(config.Certificates) != 1 || config.ClientAuth != tls.NoClientCert {
+		t.Fatalf("expected a self-signed certificate, got %+v", config)
+	}
+
+	server := httptest.NewUnstartedServer(NewServer("gateway", secret, time.Minute))
+	server.TLS = config
+	server.StartTLS()
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+
+	resp, err := client.Get(server.URL + "/api/endpoints/1/edge/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected the unsigned request to be rejected, got %d", resp.StatusCode)
+	}
+}
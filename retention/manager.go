@@ -0,0 +1,317 @@
+// Package retention bounds the data accumulated by the agent on the device (job outputs, volume backups, Edge stack
+// histories, crash artifacts, session recordings and stored snapshots) with size and age based policies applied
+// periodically and on demand.
+package retention
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/audit"
+	"github.com/portainer/agent/snapshots"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrDisabled is returned when the retention is requested while no manager is enabled
+var ErrDisabled = errors.New("the retention of the agent data is disabled on this agent")
+
+var (
+	defaultManager   *Manager
+	defaultManagerMu sync.Mutex
+)
+
+// Location is a folder holding the items of a category, an item is a file or a folder removed as a whole
+type Location struct {
+	Category string
+	Dir      string
+	// Match selects the items among the entries of the folder, every entry is an item when nil
+	Match func(entry fs.DirEntry) bool
+}
+
+// CategoryReport represents the data of a category and the items removed by a cleanup
+type CategoryReport struct {
+	Category     string   `json:"Category"`
+	Policy       Policy   `json:"Policy"`
+	Items        int      `json:"Items"`
+	Size         int64    `json:"Size"`
+	RemovedItems int      `json:"RemovedItems"`
+	RemovedSize  int64    `json:"RemovedSize"`
+	Errors       []string `json:"Errors,omitempty"`
+}
+
+// Report represents the state of the agent data after a cleanup
+type Report struct {
+	Time       time.Time        `json:"Time"`
+	Categories []CategoryReport `json:"Categories"`
+}
+
+// Manager applies the retention policies to the locations of the agent data
+type Manager struct {
+	locations []Location
+	policies  map[string]Policy
+
+	mu      sync.Mutex
+	lastRun *Report
+}
+
+// item is a file or a folder of a location, modTime is the most recent modification inside a folder
+type item struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// NewManager returns a pointer to a Manager applying policies to the locations
+func NewManager(locations []Location, policies map[string]Policy) *Manager {
+	return &Manager{
+		locations: locations,
+		policies:  policies,
+	}
+}
+
+// Locations returns the locations of the data of the agent stored in dataPath and on the host
+func Locations(dataPath string) []Location {
+	isDir := func(entry fs.DirEntry) bool { return entry.IsDir() }
+
+	return []Location{
+		{
+			Category: CategoryJobs,
+			Dir:      filepath.Join(agent.HostRoot, agent.ScheduleScriptDirectory),
+			Match: func(entry fs.DirEntry) bool {
+				return !entry.IsDir() && strings.HasPrefix(entry.Name(), "schedule_") && strings.HasSuffix(entry.Name(), ".log")
+			},
+		},
+		{Category: CategoryBackups, Dir: filepath.Join(dataPath, agent.BackupsDirName)},
+		{Category: CategoryHistories, Dir: filepath.Join(dataPath, agent.EdgeStackVersionsDirName), Match: isDir},
+		{Category: CategoryCrashes, Dir: filepath.Join(dataPath, agent.CrashArtifactsDirName), Match: isDir},
+		{
+			Category: CategoryRecordings,
+			Dir:      filepath.Join(dataPath, agent.AuditDirName),
+			// the audit trail being written is never removed, only its rotated files
+			Match: func(entry fs.DirEntry) bool {
+				return !entry.IsDir() && strings.HasPrefix(entry.Name(), audit.FileName+".")
+			},
+		},
+		{
+			Category: CategorySnapshots,
+			Dir:      filepath.Join(dataPath, agent.SnapshotsDirName),
+			Match: func(entry fs.DirEntry) bool {
+				return !entry.IsDir() && strings.HasSuffix(entry.Name(), snapshots.FileExtension)
+			},
+		},
+	}
+}
+
+// Enable makes manager the manager of the retention API
+func Enable(manager *Manager) {
+	defaultManagerMu.Lock()
+	defer defaultManagerMu.Unlock()
+
+	defaultManager = manager
+}
+
+// DefaultManager returns the enabled manager, ErrDisabled is returned when no manager is enabled
+func DefaultManager() (*Manager, error) {
+	defaultManagerMu.Lock()
+	defer defaultManagerMu.Unlock()
+
+	if defaultManager == nil {
+		return nil, ErrDisabled
+	}
+
+	return defaultManager, nil
+}
+
+// Run applies the policies at startup and then every interval until ctx is done
+func (manager *Manager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		manager.Cleanup()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Cleanup removes the items exceeding the policies of their category and returns the report of the cleanup
+func (manager *Manager) Cleanup() Report {
+	return manager.apply(time.Now(), true)
+}
+
+// Usage returns the data of each category without removing it
+func (manager *Manager) Usage() Report {
+	return manager.apply(time.Now(), false)
+}
+
+// LastCleanup returns the report of the last cleanup, nil when no cleanup ran yet
+func (manager *Manager) LastCleanup() *Report {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	return manager.lastRun
+}
+
+func (manager *Manager) apply(now time.Time, remove bool) Report {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	reports := map[string]*CategoryReport{}
+	report := Report{Time: now}
+
+	for _, category := range categories {
+		report.Categories = append(report.Categories, CategoryReport{Category: category, Policy: manager.policies[category]})
+	}
+
+	for i := range report.Categories {
+		reports[report.Categories[i].Category] = &report.Categories[i]
+	}
+
+	for _, location := range manager.locations {
+		categoryReport, ok := reports[location.Category]
+		if !ok {
+			continue
+		}
+
+		items, err := listItems(location)
+		if err != nil {
+			categoryReport.Errors = append(categoryReport.Errors, err.Error())
+
+			continue
+		}
+
+		var kept []item
+		if remove {
+			kept = manager.enforce(location, categoryReport, items, now)
+		} else {
+			kept = items
+		}
+
+		for _, it := range kept {
+			categoryReport.Items++
+			categoryReport.Size += it.size
+		}
+	}
+
+	if remove {
+		manager.lastRun = &report
+
+		for _, categoryReport := range report.Categories {
+			if categoryReport.RemovedItems > 0 {
+				log.Info().
+					Str("category", categoryReport.Category).
+					Int("removed_items", categoryReport.RemovedItems).
+					Int64("removed_bytes", categoryReport.RemovedSize).
+					Msg("removed the agent data exceeding the retention policy")
+			}
+		}
+	}
+
+	return report
+}
+
+// enforce removes the items older than the maximum age of the policy, then the oldest items until their total size
+// fits in the maximum size, and returns the items kept
+func (manager *Manager) enforce(location Location, report *CategoryReport, items []item, now time.Time) []item {
+	policy := manager.policies[location.Category]
+
+	var total int64
+	for _, it := range items {
+		total += it.size
+	}
+
+	var kept []item
+	for _, it := range items {
+		expired := policy.MaxAge > 0 && now.Sub(it.modTime) > policy.MaxAge
+		oversized := policy.MaxSize > 0 && total > policy.MaxSize
+
+		if !expired && !oversized {
+			kept = append(kept, it)
+
+			continue
+		}
+
+		if err := os.RemoveAll(it.path); err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			kept = append(kept, it)
+
+			continue
+		}
+
+		total -= it.size
+		report.RemovedItems++
+		report.RemovedSize += it.size
+	}
+
+	return kept
+}
+
+// listItems returns the items of the location, the oldest first
+func listItems(location Location) ([]item, error) {
+	entries, err := os.ReadDir(location.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var items []item
+	for _, entry := range entries {
+		if location.Match != nil && !location.Match(entry) {
+			continue
+		}
+
+		it, err := readItem(filepath.Join(location.Dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+
+		items = append(items, it)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].modTime.Before(items[j].modTime)
+	})
+
+	return items, nil
+}
+
+func readItem(path string) (item, error) {
+	it := item{path: path}
+
+	err := filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		if info.Mode().IsRegular() {
+			it.size += info.Size()
+		}
+
+		if info.ModTime().After(it.modTime) {
+			it.modTime = info.ModTime()
+		}
+
+		return nil
+	})
+
+	return it, err
+}
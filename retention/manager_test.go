@@ -0,0 +1,121 @@
+package retention
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeItem(t *testing.T, path string, size int, modTime time.Time) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, make([]byte, size), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+
+	return err == nil
+}
+
+func TestCleanupRemovesExpiredItems(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	writeItem(t, filepath.Join(dir, "old.tar.gz"), 10, now.Add(-48*time.Hour))
+	writeItem(t, filepath.Join(dir, "recent.tar.gz"), 10, now.Add(-time.Hour))
+
+	manager := NewManager([]Location{{Category: CategoryBackups, Dir: dir}}, map[string]Policy{
+		CategoryBackups: {MaxAge: 24 * time.Hour},
+	})
+
+	report := manager.Cleanup()
+
+	if exists(filepath.Join(dir, "old.tar.gz")) || !exists(filepath.Join(dir, "recent.tar.gz")) {
+		t.Fatal("expected only the expired backup to be removed")
+	}
+
+	backups := report.Categories[1]
+	if backups.Category != CategoryBackups || backups.RemovedItems != 1 || backups.RemovedSize != 10 || backups.Items != 1 || backups.Size != 10 {
+		t.Fatalf("unexpected report %+v", backups)
+	}
+
+	if manager.LastCleanup() == nil {
+		t.Fatal("expected the report of the cleanup to be kept")
+	}
+}
+
+func TestCleanupRemovesOldestItemsExceedingTheSize(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	// a folder is removed as a whole, its age is the one of its most recent file
+	writeItem(t, filepath.Join(dir, "1", "compose.yml"), 10, now.Add(-3*time.Hour))
+	writeItem(t, filepath.Join(dir, "2", "compose.yml"), 10, now.Add(-2*time.Hour))
+	writeItem(t, filepath.Join(dir, "2", "env"), 5, now.Add(-30*time.Minute))
+	writeItem(t, filepath.Join(dir, "3", "compose.yml"), 10, now.Add(-time.Hour))
+
+	for _, name := range []string{"1", "2", "3"} {
+		if err := os.Chtimes(filepath.Join(dir, name), now.Add(-4*time.Hour), now.Add(-4*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manager := NewManager([]Location{{Category: CategoryHistories, Dir: dir}}, map[string]Policy{
+		CategoryHistories: {MaxSize: 20},
+	})
+
+	manager.Cleanup()
+
+	if exists(filepath.Join(dir, "1")) || exists(filepath.Join(dir, "3")) || !exists(filepath.Join(dir, "2", "env")) {
+		t.Fatal("expected the oldest folders to be removed until the histories fit")
+	}
+}
+
+func TestCleanupOnlyRemovesMatchingItems(t *testing.T) {
+	dataPath := t.TempDir()
+	old := time.Now().Add(-365 * 24 * time.Hour)
+
+	auditDir := filepath.Join(dataPath, "audit")
+	writeItem(t, filepath.Join(auditDir, "sessions.log"), 10, old)
+	writeItem(t, filepath.Join(auditDir, "sessions.log.1"), 10, old)
+
+	var locations []Location
+	for _, location := range Locations(dataPath) {
+		if location.Category == CategoryRecordings {
+			locations = append(locations, location)
+		}
+	}
+
+	NewManager(locations, DefaultPolicies).Cleanup()
+
+	if !exists(filepath.Join(auditDir, "sessions.log")) || exists(filepath.Join(auditDir, "sessions.log.1")) {
+		t.Fatal("expected only the rotated file of the audit trail to be removed")
+	}
+}
+
+func TestUsageDoesNotRemoveItems(t *testing.T) {
+	dir := t.TempDir()
+	writeItem(t, filepath.Join(dir, "backup.tar.gz"), 10, time.Now().Add(-48*time.Hour))
+
+	manager := NewManager([]Location{{Category: CategoryBackups, Dir: dir}}, map[string]Policy{
+		CategoryBackups: {MaxAge: time.Hour},
+	})
+
+	report := manager.Usage()
+
+	if !exists(filepath.Join(dir, "backup.tar.gz")) || report.Categories[1].Items != 1 || manager.LastCleanup() != nil {
+		t.Fatal("expected the usage to leave the items in place")
+	}
+}
@@ -0,0 +1,89 @@
+package retention
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+)
+
+// Categories of the agent-local data
+const (
+	// CategoryJobs are the outputs of the Edge jobs written on the host
+	CategoryJobs = "jobs"
+	// CategoryBackups are the archives of the volume backups
+	CategoryBackups = "backups"
+	// CategoryHistories are the deployed versions of the Edge stacks kept for the rollbacks
+	CategoryHistories = "histories"
+	// CategoryCrashes are the artifacts collected when the containers crash
+	CategoryCrashes = "crashes"
+	// CategoryRecordings are the rotated files of the audit trail of the sessions
+	CategoryRecordings = "recordings"
+	// CategorySnapshots are the stored snapshots of the environment compared through the snapshots API
+	CategorySnapshots = "snapshots"
+)
+
+var categories = []string{CategoryJobs, CategoryBackups, CategoryHistories, CategoryCrashes, CategoryRecordings, CategorySnapshots}
+
+// Policy bounds the data of a category, a zero value means unlimited
+type Policy struct {
+	// MaxAge is the duration after which an item is removed
+	MaxAge time.Duration `json:"MaxAge"`
+	// MaxSize is the total size in bytes of the items of the category, the oldest items are removed once exceeded
+	MaxSize int64 `json:"MaxSize"`
+}
+
+// DefaultPolicies are the policies of the categories that are not configured. The backups and the histories can be
+// needed to restore a volume or to roll back a stack and are only removed when configured.
+var DefaultPolicies = map[string]Policy{
+	CategoryJobs:       {MaxAge: 30 * 24 * time.Hour, MaxSize: 100 * units.MB},
+	CategoryCrashes:    {MaxAge: 30 * 24 * time.Hour},
+	CategoryRecordings: {MaxAge: 90 * 24 * time.Hour},
+	CategorySnapshots:  {MaxAge: 7 * 24 * time.Hour},
+}
+
+// ParsePolicies returns the policies of the categories from the values formatted as category:max_age:max_size, e.g.
+// jobs:168h:50MB or backups::2GB, merged with the default policies. An empty or 0 limit means unlimited.
+func ParsePolicies(values []string) (map[string]Policy, error) {
+	policies := make(map[string]Policy, len(categories))
+	for category, policy := range DefaultPolicies {
+		policies[category] = policy
+	}
+
+	for _, value := range values {
+		parts := strings.Split(strings.TrimSpace(value), ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid retention policy %q, expected category:max_age:max_size", value)
+		}
+
+		category := strings.ToLower(parts[0])
+		if !slices.Contains(categories, category) {
+			return nil, fmt.Errorf("invalid category of the retention policy %q, expected one of %s", value, strings.Join(categories, ", "))
+		}
+
+		var policy Policy
+		if parts[1] != "" && parts[1] != "0" {
+			maxAge, err := time.ParseDuration(parts[1])
+			if err != nil || maxAge < 0 {
+				return nil, fmt.Errorf("invalid maximum age of the retention policy %q", value)
+			}
+
+			policy.MaxAge = maxAge
+		}
+
+		if parts[2] != "" && parts[2] != "0" {
+			maxSize, err := units.FromHumanSize(parts[2])
+			if err != nil || maxSize < 0 {
+				return nil, fmt.Errorf("invalid maximum size of the retention policy %q", value)
+			}
+
+			policy.MaxSize = maxSize
+		}
+
+		policies[category] = policy
+	}
+
+	return policies, nil
+}
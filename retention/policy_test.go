@@ -0,0 +1,37 @@
+package retention
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePoliciesOverridesTheDefaults(t *testing.T) {
+	policies, err := ParsePolicies([]string{"jobs:168h:50MB", "backups::2GB", "crashes:0:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if policies[CategoryJobs] != (Policy{MaxAge: 168 * time.Hour, MaxSize: 50_000_000}) {
+		t.Fatalf("unexpected jobs policy %+v", policies[CategoryJobs])
+	}
+
+	if policies[CategoryBackups] != (Policy{MaxSize: 2_000_000_000}) {
+		t.Fatalf("unexpected backups policy %+v", policies[CategoryBackups])
+	}
+
+	if policies[CategoryCrashes] != (Policy{}) {
+		t.Fatalf("expected an unlimited crashes policy, got %+v", policies[CategoryCrashes])
+	}
+
+	if policies[CategoryRecordings] != DefaultPolicies[CategoryRecordings] {
+		t.Fatalf("expected the default recordings policy, got %+v", policies[CategoryRecordings])
+	}
+}
+
+func TestParsePoliciesRejectsInvalidValues(t *testing.T) {
+	for _, value := range []string{"jobs", "jobs:1h", "logs:1h:1MB", "jobs:1x:", "jobs::big", "jobs:-1h:"} {
+		if _, err := ParsePolicies([]string{value}); err == nil {
+			t.Errorf("expected %q to be rejected", value)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package sbom
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Types of the packages cataloged in the images
+const (
+	PackageTypeDeb = "deb"
+	PackageTypeAPK = "apk"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+	// maxCatalogedFileSize is the maximum size of a package database read from a layer
+	maxCatalogedFileSize = 64 * 1024 * 1024
+)
+
+// Package represents a package installed in an image by the package manager of its distribution
+type Package struct {
+	Name         string `json:"Name"`
+	Version      string `json:"Version"`
+	Type         string `json:"Type"`
+	Architecture string `json:"Architecture,omitempty"`
+	// License is the license declared by the package, as written by the package manager
+	License string `json:"License,omitempty"`
+}
+
+// Distribution represents the distribution of an image, read from its os-release file
+type Distribution struct {
+	ID         string `json:"ID,omitempty"`
+	VersionID  string `json:"VersionID,omitempty"`
+	PrettyName string `json:"PrettyName,omitempty"`
+}
+
+// Catalog represents the packages of an image
+type Catalog struct {
+	ImageID      string
+	RepoTags     []string
+	Distribution Distribution
+	Packages     []Package
+}
+
+// archiveManifest is an entry of the manifest.json file of the archives produced by docker save
+type archiveManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// layerContent is the part of a layer relevant to the catalog: the package databases it adds and the paths it removes
+type layerContent struct {
+	files     map[string][]byte
+	whiteouts []string
+	opaques   []string
+}
+
+// isCatalogedFile returns true when name, a path relative to the root of the image, is read to build the catalog
+func isCatalogedFile(name string) bool {
+	switch name {
+	case "etc/os-release", "usr/lib/os-release", "var/lib/dpkg/status", "lib/apk/db/installed":
+		return true
+	}
+
+	// the distroless images list their packages in a file per package
+	return strings.HasPrefix(name, "var/lib/dpkg/status.d/") && !strings.HasSuffix(name, ".md5sums")
+}
+
+// CatalogArchive returns the packages of the image exported in archive by docker save, in the legacy or the OCI
+// layout. The layers are read in a single pass, only the package databases and the os-release files are kept.
+func CatalogArchive(archive io.Reader) (*Catalog, error) {
+	var manifests []archiveManifest
+	layers := map[string]*layerContent{}
+
+	reader := tar.NewReader(archive)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		if header.Name == "manifest.json" {
+			if err := json.NewDecoder(reader).Decode(&manifests); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		// the configurations and the indexes of the OCI layout are blobs as well, they are not tar archives
+		if content, err := readLayer(reader); err == nil {
+			layers[header.Name] = content
+		}
+	}
+
+	if len(manifests) == 0 {
+		return nil, errors.New("the image archive does not contain a manifest")
+	}
+
+	manifest := manifests[0]
+
+	files := map[string][]byte{}
+	for _, name := range manifest.Layers {
+		content, ok := layers[name]
+		if !ok {
+			return nil, errors.New("the image archive does not contain the layer " + name)
+		}
+
+		content.applyTo(files)
+	}
+
+	catalog := &Catalog{
+		ImageID:  configImageID(manifest.Config),
+		RepoTags: manifest.RepoTags,
+		Packages: []Package{},
+	}
+
+	if data, ok := files["etc/os-release"]; ok {
+		catalog.Distribution = parseOSRelease(data)
+	} else if data, ok := files["usr/lib/os-release"]; ok {
+		catalog.Distribution = parseOSRelease(data)
+	}
+
+	for name, data := range files {
+		switch {
+		case name == "lib/apk/db/installed":
+			catalog.Packages = append(catalog.Packages, parseAPKDatabase(data)...)
+		case name == "var/lib/dpkg/status", strings.HasPrefix(name, "var/lib/dpkg/status.d/"):
+			catalog.Packages = append(catalog.Packages, parseDpkgStatus(data)...)
+		}
+	}
+
+	sort.Slice(catalog.Packages, func(i, j int) bool {
+		if catalog.Packages[i].Name != catalog.Packages[j].Name {
+			return catalog.Packages[i].Name < catalog.Packages[j].Name
+		}
+
+		return catalog.Packages[i].Version < catalog.Packages[j].Version
+	})
+
+	// a package listed by several databases is reported once
+	packages := catalog.Packages[:0]
+	for i, pkg := range catalog.Packages {
+		if i == 0 || pkg != catalog.Packages[i-1] {
+			packages = append(packages, pkg)
+		}
+	}
+	catalog.Packages = packages
+
+	return catalog, nil
+}
+
+// readLayer reads the cataloged files and the whiteouts of a layer, compressed or not
+func readLayer(r io.Reader) (*layerContent, error) {
+	buffered := bufio.NewReader(r)
+	if magic, err := buffered.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+
+		r = gz
+	} else {
+		r = buffered
+	}
+
+	content := &layerContent{files: map[string][]byte{}}
+
+	reader := tar.NewReader(r)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return content, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+header.Name), "/")
+		dir, base := path.Split(name)
+
+		switch {
+		case base == whiteoutOpaque:
+			content.opaques = append(content.opaques, strings.TrimSuffix(dir, "/"))
+		case strings.HasPrefix(base, whiteoutPrefix):
+			content.whiteouts = append(content.whiteouts, dir+strings.TrimPrefix(base, whiteoutPrefix))
+		case header.Typeflag == tar.TypeReg && isCatalogedFile(name) && header.Size <= maxCatalogedFileSize:
+			var data bytes.Buffer
+			if _, err := io.Copy(&data, reader); err != nil {
+				return nil, err
+			}
+
+			content.files[name] = data.Bytes()
+		}
+	}
+}
+
+// applyTo adds the layer on top of files, the files of the lower layers removed by the layer are deleted first
+func (content *layerContent) applyTo(files map[string][]byte) {
+	removed := func(name, p string) bool {
+		return p == "" || name == p || strings.HasPrefix(name, p+"/")
+	}
+
+	for name := range files {
+		for _, p := range append(content.whiteouts, content.opaques...) {
+			if removed(name, p) {
+				delete(files, name)
+
+				break
+			}
+		}
+	}
+
+	for name, data := range content.files {
+		files[name] = data
+	}
+}
+
+// configImageID returns the identifier of the image from the path of its configuration in the archive, either
+// <hex>.json or blobs/sha256/<hex>
+func configImageID(config string) string {
+	id := strings.TrimSuffix(path.Base(config), ".json")
+	if id == "" || id == "." {
+		return ""
+	}
+
+	return "sha256:" + id
+}
+
+func parseOSRelease(data []byte) Distribution {
+	distribution := Distribution{}
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+
+		value = strings.Trim(value, `"'`)
+
+		switch key {
+		case "ID":
+			distribution.ID = value
+		case "VERSION_ID":
+			distribution.VersionID = value
+		case "PRETTY_NAME":
+			distribution.PrettyName = value
+		}
+	}
+
+	return distribution
+}
+
+// parseDpkgStatus returns the installed packages of a dpkg status file, made of paragraphs of fields separated by
+// empty lines
+func parseDpkgStatus(data []byte) []Package {
+	packages := []Package{}
+
+	for _, paragraph := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n\n") {
+		fields := map[string]string{}
+		for _, line := range strings.Split(paragraph, "\n") {
+			// the continuation lines of the multiline fields start with a space
+			if line == "" || line[0] == ' ' || line[0] == '\t' {
+				continue
+			}
+
+			key, value, ok := strings.Cut(line, ":")
+			if ok {
+				fields[key] = strings.TrimSpace(value)
+			}
+		}
+
+		// the distroless status files have no status field, the packages they list are installed
+		if status, ok := fields["Status"]; ok && !strings.HasSuffix(status, " installed") {
+			continue
+		}
+
+		if fields["Package"] == "" {
+			continue
+		}
+
+		packages = append(packages, Package{
+			Name:         fields["Package"],
+			Version:      fields["Version"],
+			Type:         PackageTypeDeb,
+			Architecture: fields["Architecture"],
+		})
+	}
+
+	return packages
+}
+
+// parseAPKDatabase returns the packages of the installed database of apk, made of blocks of single letter fields
+// separated by empty lines
+func parseAPKDatabase(data []byte) []Package {
+	packages := []Package{}
+	current := Package{Type: PackageTypeAPK}
+
+	flush := func() {
+		if current.Name != "" {
+			packages = append(packages, current)
+		}
+
+		current = Package{Type: PackageTypeAPK}
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			flush()
+
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "P":
+			current.Name = value
+		case "V":
+			current.Version = value
+		case "A":
+			current.Architecture = value
+		case "L":
+			current.License = value
+		}
+	}
+
+	flush()
+
+	return packages
+}
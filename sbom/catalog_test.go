@@ -0,0 +1,108 @@
+package sbom
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTar(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var b bytes.Buffer
+	w := tar.NewWriter(&b)
+
+	for name, content := range files {
+		err := w.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.Bytes()
+}
+
+func TestCatalogArchive(t *testing.T) {
+	base := writeTar(t, map[string]string{
+		"etc/os-release": "ID=debian\nVERSION_ID=\"12\"\nPRETTY_NAME=\"Debian GNU/Linux 12 (bookworm)\"\n",
+		"var/lib/dpkg/status": "Package: libc6\nStatus: install ok installed\nArchitecture: amd64\nVersion: 2.36-9+deb12u4\nDescription: GNU C Library\n shared libraries\n\n" +
+			"Package: removed\nStatus: deinstall ok config-files\nVersion: 1.0\n",
+		"lib/apk/db/installed": "P:musl\nV:1.2.4-r2\nA:x86_64\nL:MIT\n",
+	})
+
+	// the upper layer removes the apk database
+	upper := writeTar(t, map[string]string{
+		"lib/apk/db/.wh.installed":              "",
+		"var/lib/dpkg/status.d/ca-certificates": "Package: ca-certificates\nVersion: 20230311\nArchitecture: all\n",
+	})
+
+	archive := writeTar(t, map[string]string{
+		"blobs/sha256/aaaa": string(base),
+		"blobs/sha256/bbbb": string(upper),
+		"blobs/sha256/cccc": `{"architecture":"amd64"}`,
+		"manifest.json":     `[{"Config":"blobs/sha256/cccc","RepoTags":["app:1.0"],"Layers":["blobs/sha256/aaaa","blobs/sha256/bbbb"]}]`,
+	})
+
+	catalog, err := CatalogArchive(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if catalog.ImageID != "sha256:cccc" || catalog.Distribution.ID != "debian" || catalog.Distribution.VersionID != "12" {
+		t.Errorf("unexpected catalog metadata %+v", catalog)
+	}
+
+	expected := []Package{
+		{Name: "ca-certificates", Version: "20230311", Type: PackageTypeDeb, Architecture: "all"},
+		{Name: "libc6", Version: "2.36-9+deb12u4", Type: PackageTypeDeb, Architecture: "amd64"},
+	}
+
+	if !reflect.DeepEqual(catalog.Packages, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, catalog.Packages)
+	}
+
+	if purl := packageURL(catalog.Packages[1], catalog.Distribution); purl != "pkg:deb/debian/libc6@2.36-9%2Bdeb12u4?arch=amd64&distro=debian-12" {
+		t.Errorf("unexpected purl %s", purl)
+	}
+
+	for _, format := range []string{FormatSPDX, FormatCycloneDX} {
+		var document bytes.Buffer
+		if err := Encode(&document, format, "app:1.0", catalog, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+
+		var decoded map[string]interface{}
+		if err := json.Unmarshal(document.Bytes(), &decoded); err != nil {
+			t.Fatalf("invalid %s document: %s", format, err)
+		}
+
+		if !strings.Contains(document.String(), "pkg:deb/debian/ca-certificates@20230311") {
+			t.Errorf("expected the %s document to reference the packages, got:\n%s", format, document.String())
+		}
+	}
+}
+
+func TestParseAPKDatabase(t *testing.T) {
+	packages := parseAPKDatabase([]byte("C:Q1abc=\nP:musl\nV:1.2.4-r2\nA:x86_64\nL:MIT\n\nP:busybox\nV:1.36.1-r5\nA:x86_64\nL:GPL-2.0-only\n"))
+
+	expected := []Package{
+		{Name: "musl", Version: "1.2.4-r2", Type: PackageTypeAPK, Architecture: "x86_64", License: "MIT"},
+		{Name: "busybox", Version: "1.36.1-r5", Type: PackageTypeAPK, Architecture: "x86_64", License: "GPL-2.0-only"},
+	}
+
+	if !reflect.DeepEqual(packages, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, packages)
+	}
+}
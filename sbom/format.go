@@ -0,0 +1,215 @@
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/portainer/agent"
+
+	"github.com/google/uuid"
+)
+
+// Formats of the SBOM documents
+const (
+	FormatSPDX      = "spdx-json"
+	FormatCycloneDX = "cyclonedx-json"
+)
+
+// ContentType returns the media type of the documents in format
+func ContentType(format string) string {
+	if format == FormatCycloneDX {
+		return "application/vnd.cyclonedx+json"
+	}
+
+	return "application/spdx+json"
+}
+
+// ValidateFormat returns an error when format is not a supported SBOM format, the empty format is SPDX
+func ValidateFormat(format string) error {
+	if format != "" && format != FormatSPDX && format != FormatCycloneDX {
+		return fmt.Errorf("unsupported SBOM format %q, supported formats: %s, %s", format, FormatSPDX, FormatCycloneDX)
+	}
+
+	return nil
+}
+
+// Encode writes the SBOM of the image described by catalog in format, image is the reference the image was
+// selected with
+func Encode(w io.Writer, format, image string, catalog *Catalog, created time.Time) error {
+	var document interface{}
+
+	switch format {
+	case FormatCycloneDX:
+		document = cycloneDXDocument(image, catalog, created)
+	case FormatSPDX, "":
+		document = spdxDocument(image, catalog, created)
+	default:
+		return ValidateFormat(format)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(document)
+}
+
+// packageURL returns the purl identifying pkg in the distribution of the image
+func packageURL(pkg Package, distribution Distribution) string {
+	namespace := distribution.ID
+	if namespace == "" {
+		namespace = "unknown"
+	}
+
+	purl := fmt.Sprintf("pkg:%s/%s/%s@%s", pkg.Type, url.PathEscape(namespace), url.PathEscape(pkg.Name), url.QueryEscape(pkg.Version))
+
+	var qualifiers []string
+	if pkg.Architecture != "" {
+		qualifiers = append(qualifiers, "arch="+url.QueryEscape(pkg.Architecture))
+	}
+
+	if distribution.ID != "" && distribution.VersionID != "" {
+		qualifiers = append(qualifiers, "distro="+url.QueryEscape(distribution.ID+"-"+distribution.VersionID))
+	}
+
+	if len(qualifiers) > 0 {
+		purl += "?" + strings.Join(qualifiers, "&")
+	}
+
+	return purl
+}
+
+func toolName() string {
+	return "portainer-agent-" + agent.Version
+}
+
+type spdxPackage struct {
+	SPDXID           string            `json:"SPDXID"`
+	Name             string            `json:"name"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	LicenseComments  string            `json:"licenseComments,omitempty"`
+	CopyrightText    string            `json:"copyrightText"`
+	PrimaryPurpose   string            `json:"primaryPackagePurpose,omitempty"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// spdxDocument returns an SPDX 2.3 document describing the image and the packages it contains. The licenses
+// declared by the package managers are not SPDX expressions, they are kept as comments.
+func spdxDocument(image string, catalog *Catalog, created time.Time) interface{} {
+	const imageID = "SPDXRef-Image"
+
+	packages := []spdxPackage{{
+		SPDXID:           imageID,
+		Name:             image,
+		VersionInfo:      catalog.ImageID,
+		DownloadLocation: "NOASSERTION",
+		LicenseConcluded: "NOASSERTION",
+		LicenseDeclared:  "NOASSERTION",
+		CopyrightText:    "NOASSERTION",
+		PrimaryPurpose:   "CONTAINER",
+	}}
+
+	relationships := []spdxRelationship{{SPDXElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSPDXElement: imageID}}
+
+	for i, pkg := range catalog.Packages {
+		id := fmt.Sprintf("SPDXRef-Package-%s-%d", pkg.Type, i)
+
+		packages = append(packages, spdxPackage{
+			SPDXID:           id,
+			Name:             pkg.Name,
+			VersionInfo:      pkg.Version,
+			DownloadLocation: "NOASSERTION",
+			LicenseConcluded: "NOASSERTION",
+			LicenseDeclared:  "NOASSERTION",
+			LicenseComments:  pkg.License,
+			CopyrightText:    "NOASSERTION",
+			ExternalRefs: []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  packageURL(pkg, catalog.Distribution),
+			}},
+		})
+
+		relationships = append(relationships, spdxRelationship{SPDXElementID: imageID, RelationshipType: "CONTAINS", RelatedSPDXElement: id})
+	}
+
+	return map[string]interface{}{
+		"spdxVersion":       "SPDX-2.3",
+		"dataLicense":       "CC0-1.0",
+		"SPDXID":            "SPDXRef-DOCUMENT",
+		"name":              image,
+		"documentNamespace": "https://portainer.io/spdx/" + strings.TrimPrefix(catalog.ImageID, "sha256:") + "-" + uuid.NewString(),
+		"creationInfo": map[string]interface{}{
+			"created":  created.UTC().Format(time.RFC3339),
+			"creators": []string{"Tool: " + toolName()},
+		},
+		"packages":      packages,
+		"relationships": relationships,
+	}
+}
+
+type cycloneDXComponent struct {
+	Type     string             `json:"type"`
+	BOMRef   string             `json:"bom-ref,omitempty"`
+	Name     string             `json:"name"`
+	Version  string             `json:"version,omitempty"`
+	PURL     string             `json:"purl,omitempty"`
+	Licenses []cycloneDXLicense `json:"licenses,omitempty"`
+}
+
+type cycloneDXLicense struct {
+	License struct {
+		Name string `json:"name"`
+	} `json:"license"`
+}
+
+// cycloneDXDocument returns a CycloneDX 1.5 document whose metadata component is the image
+func cycloneDXDocument(image string, catalog *Catalog, created time.Time) interface{} {
+	components := make([]cycloneDXComponent, 0, len(catalog.Packages))
+	for _, pkg := range catalog.Packages {
+		purl := packageURL(pkg, catalog.Distribution)
+
+		component := cycloneDXComponent{Type: "library", BOMRef: purl, Name: pkg.Name, Version: pkg.Version, PURL: purl}
+		if pkg.License != "" {
+			license := cycloneDXLicense{}
+			license.License.Name = pkg.License
+			component.Licenses = []cycloneDXLicense{license}
+		}
+
+		components = append(components, component)
+	}
+
+	return map[string]interface{}{
+		"bomFormat":    "CycloneDX",
+		"specVersion":  "1.5",
+		"serialNumber": "urn:uuid:" + uuid.NewString(),
+		"version":      1,
+		"metadata": map[string]interface{}{
+			"timestamp": created.UTC().Format(time.RFC3339),
+			"tools": map[string]interface{}{
+				"components": []cycloneDXComponent{{Type: "application", Name: "portainer-agent", Version: agent.Version}},
+			},
+			"component": cycloneDXComponent{Type: "container", BOMRef: catalog.ImageID, Name: image, Version: catalog.ImageID},
+		},
+		"components": components,
+	}
+}
@@ -0,0 +1,183 @@
+package sbom
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent/docker"
+	agentnet "github.com/portainer/agent/net"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	uploadTimeout = 5 * time.Minute
+	// maxErrorSize is the maximum size of an error response read from the upload endpoint
+	maxErrorSize = 4 * 1024
+	// HTTP headers identifying the image of an uploaded SBOM
+	imageIDHeader  = "X-Portainer-Image-Id"
+	imageRefHeader = "X-Portainer-Image"
+)
+
+// Result represents the outcome of the generation of the SBOM of an image
+type Result struct {
+	ImageID     string `json:"ImageId,omitempty"`
+	Image       string `json:"Image"`
+	Format      string `json:"Format"`
+	Packages    int    `json:"Packages"`
+	GeneratedAt int64  `json:"GeneratedAt"`
+	Uploaded    bool   `json:"Uploaded"`
+	Error       string `json:"Error,omitempty"`
+}
+
+var results = struct {
+	// generating is held during a generation so that a single image is exported at a time
+	generating sync.Mutex
+
+	mu     sync.Mutex
+	images map[string]Result
+}{images: map[string]Result{}}
+
+// Generate writes the SBOM of the local image in format to w. The image is exported from the Docker daemon and read
+// by the agent, it never leaves the node.
+func Generate(ctx context.Context, image, format string, w io.Writer) (Result, error) {
+	if format == "" {
+		format = FormatSPDX
+	}
+
+	result := Result{Image: image, Format: format, GeneratedAt: time.Now().Unix()}
+
+	if err := ValidateFormat(format); err != nil {
+		return result, err
+	}
+
+	results.generating.Lock()
+	defer results.generating.Unlock()
+
+	archive, err := docker.ImageSave(ctx, image)
+	if err != nil {
+		return result, err
+	}
+	defer archive.Close()
+
+	catalog, err := CatalogArchive(archive)
+	if err != nil {
+		return result, fmt.Errorf("unable to catalog the image %s: %w", image, err)
+	}
+
+	result.ImageID = catalog.ImageID
+	result.Packages = len(catalog.Packages)
+
+	return result, Encode(w, format, image, catalog, time.Now())
+}
+
+// GenerateAndUpload generates the SBOM of each image in format and posts it to uploadURL, the image is identified by
+// the X-Portainer-Image and X-Portainer-Image-Id headers. A failure on an image does not prevent the other images
+// from being processed, the outcome of each image is reported in the returned results and in the snapshots.
+func GenerateAndUpload(ctx context.Context, images []string, format, uploadURL string) []Result {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = agentnet.MeterDialContext(agentnet.BandwidthSBOMUploads, transport.DialContext)
+	client := &http.Client{Transport: transport, Timeout: uploadTimeout}
+
+	generated := make([]Result, 0, len(images))
+	for _, image := range images {
+		var document bytes.Buffer
+
+		result, err := Generate(ctx, image, format, &document)
+		if err == nil {
+			err = upload(ctx, client, uploadURL, result, document.Bytes())
+			result.Uploaded = err == nil
+		}
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return generated
+			}
+
+			log.Warn().Str("image", image).Err(err).Msg("unable to generate the SBOM of the image")
+
+			result.Error = err.Error()
+		}
+
+		record(result)
+		generated = append(generated, result)
+	}
+
+	return generated
+}
+
+func upload(ctx context.Context, client *http.Client, uploadURL string, result Result, document []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uploadURL, bytes.NewReader(document))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", ContentType(result.Format))
+	req.Header.Set(imageIDHeader, result.ImageID)
+	req.Header.Set(imageRefHeader, result.Image)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorSize))
+
+	return fmt.Errorf("the SBOM upload endpoint answered with the status code %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+}
+
+func record(result Result) {
+	key := result.ImageID
+	if key == "" {
+		key = result.Image
+	}
+
+	results.mu.Lock()
+	defer results.mu.Unlock()
+
+	results.images[key] = result
+}
+
+// Results returns the outcome of the last SBOM generation of each image, sorted by image, nil when no SBOM was
+// generated
+func Results() []Result {
+	results.mu.Lock()
+	defer results.mu.Unlock()
+
+	if len(results.images) == 0 {
+		return nil
+	}
+
+	list := make([]Result, 0, len(results.images))
+	for _, result := range results.images {
+		list = append(list, result)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Image < list[j].Image })
+
+	return list
+}
+
+// Diagnostics returns a diagnostic message for each image whose SBOM could not be generated or uploaded
+func Diagnostics() []string {
+	var diagnostics []string
+	for _, result := range Results() {
+		if result.Error != "" {
+			diagnostics = append(diagnostics, fmt.Sprintf("SBOM of the image %s failed: %s", result.Image, result.Error))
+		}
+	}
+
+	return diagnostics
+}
@@ -0,0 +1,219 @@
+// Package schema validates the payloads pushed by the Portainer server, the Edge commands and the bodies of the API
+// requests, against the JSON schemas embedded in the agent. A payload is validated as a whole before it is decoded
+// and executed, so that a malformed payload is rejected with the list of its invalid fields instead of failing
+// halfway through its execution and leaving the device in a partially applied state.
+package schema
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// Names of the schemas of the bodies of the API requests
+const (
+	APIStackDeploy      = "api/stackDeploy"
+	APIVolumeRestore    = "api/volumeRestore"
+	APIKubernetesDeploy = "api/kubernetesDeploy"
+	APIConfigUpdate     = "api/configUpdate"
+	APINetworkPolicy    = "api/networkPolicy"
+)
+
+// baseURL is the URL the embedded schemas are loaded at, their references are resolved relatively to it
+const baseURL = "file:///schemas/"
+
+// ErrUnknownSchema is returned when no schema is embedded with a name
+var ErrUnknownSchema = errors.New("unknown schema")
+
+//go:embed schemas
+var files embed.FS
+
+var registry struct {
+	schemas map[string]*jsonschema.Schema
+	err     error
+	once    sync.Once
+}
+
+// FieldError is a field of a payload that does not match its schema
+type FieldError struct {
+	// Field is the JSON pointer of the field, / for the payload itself
+	Field   string `json:"Field"`
+	Message string `json:"Message"`
+}
+
+// ValidationError lists the fields of a payload that do not match its schema
+type ValidationError struct {
+	Schema string       `json:"Schema"`
+	Fields []FieldError `json:"Fields"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		messages = append(messages, field.Field+": "+field.Message)
+	}
+
+	return "invalid payload: " + strings.Join(messages, "; ")
+}
+
+// CommandSchema returns the name of the schema of the value of the Edge commands of commandType
+func CommandSchema(commandType string) string {
+	return "commands/" + commandType
+}
+
+// Has returns true when a schema is embedded with name
+func Has(name string) bool {
+	schemas, err := load()
+	if err != nil {
+		return false
+	}
+
+	_, ok := schemas[name]
+
+	return ok
+}
+
+// Validate validates document against the schema embedded with name. The document is either a JSON document or a
+// value that is encoded in JSON first, e.g. the value of an Edge command. A *ValidationError is returned when the
+// document does not match the schema.
+func Validate(name string, document any) error {
+	schemas, err := load()
+	if err != nil {
+		return err
+	}
+
+	schema, ok := schemas[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownSchema, name)
+	}
+
+	data, ok := document.([]byte)
+	if !ok {
+		if raw, isRaw := document.(json.RawMessage); isRaw {
+			data = raw
+		} else if data, err = json.Marshal(document); err != nil {
+			return err
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var instance any
+	if err := decoder.Decode(&instance); err != nil {
+		return &ValidationError{Schema: name, Fields: []FieldError{{Field: "/", Message: err.Error()}}}
+	}
+
+	err = schema.Validate(instance)
+
+	var validationErr *jsonschema.ValidationError
+	if errors.As(err, &validationErr) {
+		return &ValidationError{Schema: name, Fields: fieldErrors(validationErr)}
+	}
+
+	return err
+}
+
+// DecodeAndValidateJSONPayload validates the body of r against the schema embedded with name, then decodes it into
+// payload and validates it like request.DecodeAndValidateJSONPayload
+func DecodeAndValidateJSONPayload(r *http.Request, name string, payload request.PayloadValidation) error {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+
+	if err := Validate(name, data); err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, payload); err != nil {
+		return err
+	}
+
+	return payload.Validate(r)
+}
+
+// fieldErrors returns the errors of the leaves of the tree of validation errors, sorted by field
+func fieldErrors(err *jsonschema.ValidationError) []FieldError {
+	var fields []FieldError
+
+	var walk func(err *jsonschema.ValidationError)
+	walk = func(err *jsonschema.ValidationError) {
+		if len(err.Causes) == 0 {
+			field := err.InstanceLocation
+			if field == "" {
+				field = "/"
+			}
+
+			fields = append(fields, FieldError{Field: field, Message: err.Message})
+
+			return
+		}
+
+		for _, cause := range err.Causes {
+			walk(cause)
+		}
+	}
+
+	walk(err)
+
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].Field < fields[j].Field })
+
+	return fields
+}
+
+// load compiles the embedded schemas once, a schema is named after its path without the .json extension
+func load() (map[string]*jsonschema.Schema, error) {
+	registry.once.Do(func() {
+		compiler := jsonschema.NewCompiler()
+
+		var names []string
+		err := fs.WalkDir(files, "schemas", func(filePath string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() || path.Ext(filePath) != ".json" {
+				return err
+			}
+
+			file, err := files.Open(filePath)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+
+			name := strings.TrimSuffix(strings.TrimPrefix(filePath, "schemas/"), ".json")
+			names = append(names, name)
+
+			return compiler.AddResource(baseURL+name+".json", file)
+		})
+		if err != nil {
+			registry.err = err
+
+			return
+		}
+
+		registry.schemas = make(map[string]*jsonschema.Schema, len(names))
+		for _, name := range names {
+			schema, err := compiler.Compile(baseURL + name + ".json")
+			if err != nil {
+				registry.err = fmt.Errorf("unable to compile the %s schema: %w", name, err)
+
+				return
+			}
+
+			registry.schemas[name] = schema
+		}
+	})
+
+	return registry.schemas, registry.err
+}
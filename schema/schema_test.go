@@ -0,0 +1,118 @@
+package schema
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	if _, err := load(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{CommandSchema("edgeStack"), CommandSchema("container"), APIStackDeploy, APINetworkPolicy} {
+		if !Has(name) {
+			t.Fatalf("expected the %s schema to be embedded", name)
+		}
+	}
+
+	if Has(CommandSchema("zram")) {
+		t.Fatal("expected no schema for the commands without a value")
+	}
+}
+
+func TestValidateCommand(t *testing.T) {
+	valid := map[string]any{
+		"ID":         1,
+		"Name":       "web",
+		"Version":    2,
+		"DirEntries": []any{map[string]any{"Name": "docker-compose.yml", "IsFile": true, "Content": "services: {}"}},
+	}
+
+	if err := Validate(CommandSchema("edgeStack"), valid); err != nil {
+		t.Fatalf("expected a valid stack, got %s", err)
+	}
+
+	invalid := map[string]any{
+		"ID":         "1",
+		"DirEntries": []any{map[string]any{"IsFile": "yes"}},
+	}
+
+	err := Validate(CommandSchema("edgeStack"), invalid)
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+
+	fields := map[string]bool{}
+	for _, field := range validationErr.Fields {
+		fields[field.Field] = true
+	}
+
+	for _, expected := range []string{"/ID", "/DirEntries/0", "/DirEntries/0/IsFile"} {
+		if !fields[expected] {
+			t.Fatalf("expected an error for the %s field, got %s", expected, err)
+		}
+	}
+}
+
+func TestValidateEnum(t *testing.T) {
+	err := Validate(CommandSchema("container"), map[string]any{"ContainerName": "web", "ContainerOperation": "pause"})
+	if err == nil || !strings.Contains(err.Error(), "/ContainerOperation") {
+		t.Fatalf("expected an error for the unsupported operation, got %v", err)
+	}
+}
+
+func TestValidateNestedReference(t *testing.T) {
+	err := Validate(APINetworkPolicy, []byte(`{"Policies": [{"Stack": "web", "Ingress": [{"Action": "allow", "Port": 70000}]}]}`))
+	if err == nil || !strings.Contains(err.Error(), "/Policies/0/Ingress/0/Port") {
+		t.Fatalf("expected an error for the port of the rule, got %v", err)
+	}
+}
+
+func TestValidateUnknownSchema(t *testing.T) {
+	if err := Validate("commands/unknown", map[string]any{}); !errors.Is(err, ErrUnknownSchema) {
+		t.Fatalf("expected ErrUnknownSchema, got %v", err)
+	}
+}
+
+type deployPayload struct {
+	Name             string
+	StackFileContent string
+	validated        bool
+}
+
+func (payload *deployPayload) Validate(r *http.Request) error {
+	payload.validated = true
+
+	return nil
+}
+
+func TestDecodeAndValidateJSONPayload(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/operations/stack_deploy", strings.NewReader(`{"Name": "web", "StackFileContent": "services: {}"}`))
+
+	var payload deployPayload
+	if err := DecodeAndValidateJSONPayload(r, APIStackDeploy, &payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if payload.Name != "web" || !payload.validated {
+		t.Fatalf("expected the payload to be decoded and validated, got %+v", payload)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/operations/stack_deploy", strings.NewReader(`{"Name": "Web App"}`))
+
+	payload = deployPayload{}
+	err := DecodeAndValidateJSONPayload(r, APIStackDeploy, &payload)
+	if err == nil || !strings.Contains(err.Error(), "/Name") || !strings.Contains(err.Error(), "StackFileContent") {
+		t.Fatalf("expected errors for the name and the missing stack file, got %v", err)
+	}
+
+	if payload.validated {
+		t.Fatal("expected an invalid payload not to be decoded")
+	}
+}
@@ -19,6 +19,7 @@ const (
 	memberTagKeyNodeRole     = "DockerNodeRole"
 	memberTagKeyEngineStatus = "DockerEngineStatus"
 	memberTagKeyEdgeKeySet   = "EdgeKeySet"
+	memberTagKeyAgentVersion = "AgentVersion"
 
 	memberTagValueEngineStatusSwarm      = "swarm"
 	memberTagValueEngineStatusStandalone = "standalone"
@@ -31,12 +32,14 @@ const (
 type ClusterService struct {
 	runtimeConfiguration *agent.RuntimeConfiguration
 	cluster              *serf.Serf
+	memberHealth         *memberHealthTracker
 }
 
 // NewClusterService returns a pointer to a ClusterService.
 func NewClusterService(runtimeConfiguration *agent.RuntimeConfiguration) *ClusterService {
 	return &ClusterService{
 		runtimeConfiguration: runtimeConfiguration,
+		memberHealth:         newMemberHealthTracker(),
 	}
 }
 
@@ -63,6 +66,10 @@ func (service *ClusterService) Create(advertiseAddr string, joinAddr []string, p
 	conf.LogOutput = filter
 	conf.MemberlistConfig.AdvertiseAddr = advertiseAddr
 
+	eventCh := make(chan serf.Event, 64)
+	conf.EventCh = eventCh
+	go service.watchMembers(eventCh)
+
 	// These parameters should only be overriden if experiencing agent cluster instability
 	// Default memberlist values should work in most clustering use cases but some
 	// cluster/network topologies might cause the agent cluster to be unstable and
@@ -109,6 +116,7 @@ func (service *ClusterService) Members() []agent.ClusterMember {
 				NodeRole:   member.Tags[memberTagKeyNodeRole],
 				NodeName:   member.Tags[memberTagKeyNodeName],
 				EdgeKeySet: false,
+				Version:    member.Tags[memberTagKeyAgentVersion],
 			}
 
 			_, ok := member.Tags[memberTagKeyEdgeKeySet]
@@ -165,6 +173,57 @@ func (service *ClusterService) GetMemberWithEdgeKeySet() *agent.ClusterMember {
 	return nil
 }
 
+// GetMismatchedVersionMembers will return the members running a different agent version than this agent.
+// Members running a version of the agent that does not advertise its version are reported with an empty version.
+func (service *ClusterService) GetMismatchedVersionMembers() []agent.ClusterMember {
+	var mismatchedMembers []agent.ClusterMember
+
+	for _, member := range service.Members() {
+		if member.Version != agent.Version {
+			mismatchedMembers = append(mismatchedMembers, member)
+		}
+	}
+
+	return mismatchedMembers
+}
+
+// watchMembers records the health of the members and logs a warning each time a member running a different agent
+// version joins the cluster or updates its tags. Mixed version clusters are not supported and can cause proxied
+// requests to fail.
+func (service *ClusterService) watchMembers(eventCh <-chan serf.Event) {
+	for event := range eventCh {
+		memberEvent, ok := event.(serf.MemberEvent)
+		if !ok {
+			continue
+		}
+
+		if memberEvent.Type == serf.EventMemberReap {
+			service.memberHealth.reaped(memberEvent.Members)
+
+			continue
+		}
+
+		service.memberHealth.observe(memberEvent.Members, time.Now())
+
+		if memberEvent.Type != serf.EventMemberJoin && memberEvent.Type != serf.EventMemberUpdate {
+			continue
+		}
+
+		for _, member := range memberEvent.Members {
+			version := member.Tags[memberTagKeyAgentVersion]
+			if version == agent.Version {
+				continue
+			}
+
+			log.Warn().
+				Str("node_name", member.Tags[memberTagKeyNodeName]).
+				Str("member_version", version).
+				Str("agent_version", agent.Version).
+				Msg("agent version mismatch detected in the cluster, all the agents of a cluster must run the same version")
+		}
+	}
+}
+
 // UpdateRuntimeConfiguration propagate the new runtimeConfiguration to the cluster
 func (service *ClusterService) UpdateRuntimeConfiguration(runtimeConfiguration *agent.RuntimeConfiguration) error {
 	service.runtimeConfiguration = runtimeConfiguration
@@ -190,6 +249,7 @@ func convertRuntimeConfigurationToTagMap(runtimeConfiguration *agent.RuntimeConf
 	}
 
 	tagsMap[memberTagKeyAgentPort] = runtimeConfiguration.AgentPort
+	tagsMap[memberTagKeyAgentVersion] = agent.Version
 
 	if runtimeConfiguration.DockerConfiguration.Leader {
 		tagsMap[memberTagKeyIsLeader] = "1"
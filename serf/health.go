@@ -0,0 +1,155 @@
+package serf
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent"
+
+	"github.com/hashicorp/serf/serf"
+)
+
+// memberHealthRetention is the duration during which a member that left or failed is still reported after it was
+// last seen, so that a degraded agent does not silently disappear once it is reaped from the member list
+const memberHealthRetention = 24 * time.Hour
+
+// memberHealthTracker keeps the last known health of the members of the cluster, by node name so that a restarted
+// agent replaces its previous instance
+type memberHealthTracker struct {
+	mu      sync.Mutex
+	members map[string]trackedMember
+}
+
+type trackedMember struct {
+	// instance is the name of the member in the cluster, which changes when the agent of the node is restarted
+	instance string
+	health   agent.ClusterMemberHealth
+}
+
+func newMemberHealthTracker() *memberHealthTracker {
+	return &memberHealthTracker{
+		members: map[string]trackedMember{},
+	}
+}
+
+// observe records the state of members. An alive instance takes precedence over the previous instances of its node
+// that failed or left.
+func (tracker *memberHealthTracker) observe(members []serf.Member, now time.Time) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	for _, member := range members {
+		nodeName := member.Tags[memberTagKeyNodeName]
+		if nodeName == "" {
+			continue
+		}
+
+		alive := member.Status == serf.StatusAlive
+
+		previous, known := tracker.members[nodeName]
+		if known && previous.instance != member.Name && previous.health.Reachable && !alive {
+			continue
+		}
+
+		health := agent.ClusterMemberHealth{
+			NodeName:  nodeName,
+			IPAddress: member.Addr.String(),
+			NodeRole:  member.Tags[memberTagKeyNodeRole],
+			Version:   member.Tags[memberTagKeyAgentVersion],
+			Status:    member.Status.String(),
+			Reachable: alive,
+			LastSeen:  previous.health.LastSeen,
+		}
+
+		if alive {
+			health.LastSeen = now
+		}
+
+		tracker.members[nodeName] = trackedMember{instance: member.Name, health: health}
+	}
+}
+
+// reaped records that members were removed from the member list, they are reported as failed unless they left
+func (tracker *memberHealthTracker) reaped(members []serf.Member) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	for _, member := range members {
+		nodeName := member.Tags[memberTagKeyNodeName]
+
+		tracked, ok := tracker.members[nodeName]
+		if !ok || tracked.instance != member.Name || tracked.health.Status == serf.StatusLeft.String() {
+			continue
+		}
+
+		tracked.health.Status = serf.StatusFailed.String()
+		tracked.health.Reachable = false
+		tracker.members[nodeName] = tracked
+	}
+}
+
+// health returns the members seen during the retention, sorted by node name
+func (tracker *memberHealthTracker) health(now time.Time) []agent.ClusterMemberHealth {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	members := make([]agent.ClusterMemberHealth, 0, len(tracker.members))
+	for nodeName, tracked := range tracker.members {
+		if !tracked.health.Reachable && now.Sub(tracked.health.LastSeen) > memberHealthRetention {
+			delete(tracker.members, nodeName)
+
+			continue
+		}
+
+		members = append(members, tracked.health)
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].NodeName < members[j].NodeName
+	})
+
+	return members
+}
+
+// instances returns the names of the tracked instances in the cluster, by node name
+func (tracker *memberHealthTracker) instances() map[string]string {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	instances := make(map[string]string, len(tracker.members))
+	for nodeName, tracked := range tracker.members {
+		instances[nodeName] = tracked.instance
+	}
+
+	return instances
+}
+
+// MembersHealth returns the health of the members of the cluster, including the members that left or failed during
+// the last 24 hours
+func (service *ClusterService) MembersHealth() []agent.ClusterMemberHealth {
+	service.memberHealth.observe(service.cluster.Members(), time.Now())
+
+	members := service.memberHealth.health(time.Now())
+
+	local, err := service.cluster.GetCoordinate()
+	if err != nil {
+		return members
+	}
+
+	instances := service.memberHealth.instances()
+	localName := service.cluster.LocalMember().Name
+
+	for i := range members {
+		instance := instances[members[i].NodeName]
+		if !members[i].Reachable || instance == localName {
+			continue
+		}
+
+		if coordinate, ok := service.cluster.GetCachedCoordinate(instance); ok {
+			members[i].RTTMilliseconds = float64(local.DistanceTo(coordinate).Microseconds()) / 1000
+		}
+	}
+
+	return members
+}
@@ -0,0 +1,54 @@
+package serf
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/serf/serf"
+)
+
+func TestMemberHealthTracker(t *testing.T) {
+	tracker := newMemberHealthTracker()
+	now := time.Now()
+
+	member := func(name, nodeName, ip string, status serf.MemberStatus) serf.Member {
+		return serf.Member{
+			Name:   name,
+			Addr:   net.ParseIP(ip),
+			Status: status,
+			Tags:   map[string]string{memberTagKeyNodeName: nodeName, memberTagKeyNodeRole: "manager"},
+		}
+	}
+
+	tracker.observe([]serf.Member{
+		member("a-1", "node-a", "10.0.0.1", serf.StatusAlive),
+		member("b-1", "node-b", "10.0.0.2", serf.StatusAlive),
+	}, now)
+
+	// The agent of node-a restarted, its previous instance failed
+	tracker.observe([]serf.Member{
+		member("a-2", "node-a", "10.0.0.3", serf.StatusAlive),
+		member("a-1", "node-a", "10.0.0.1", serf.StatusFailed),
+		member("b-1", "node-b", "10.0.0.2", serf.StatusFailed),
+	}, now.Add(time.Minute))
+
+	tracker.reaped([]serf.Member{member("a-1", "node-a", "10.0.0.1", serf.StatusFailed)})
+
+	members := tracker.health(now.Add(time.Hour))
+	if len(members) != 2 {
+		t.Fatalf("expected 2 members, got %+v", members)
+	}
+
+	if a := members[0]; !a.Reachable || a.IPAddress != "10.0.0.3" || a.Status != "alive" {
+		t.Fatalf("expected the new instance of node-a to be reported, got %+v", a)
+	}
+
+	if b := members[1]; b.Reachable || b.Status != "failed" || !b.LastSeen.Equal(now) {
+		t.Fatalf("expected node-b to be failed since its last probe, got %+v", b)
+	}
+
+	if members := tracker.health(now.Add(memberHealthRetention + time.Hour)); len(members) != 1 {
+		t.Fatalf("expected the failed member to be removed after the retention, got %+v", members)
+	}
+}
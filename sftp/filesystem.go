@@ -0,0 +1,242 @@
+package sftp
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	hostFolder    = "host"
+	volumesFolder = "volumes"
+)
+
+var (
+	// errReadOnly is returned when a client tries to modify one of the virtual directories
+	errReadOnly = errors.New("read-only directory")
+	// errPathEscape is returned when a client path resolves outside of its root through a symbolic link
+	errPathEscape = errors.New("the path resolves outside of the shared directories")
+)
+
+// fileSystem maps the paths of the clients to the filesystem browsed by the agent. The root directory
+// contains two virtual directories:
+//
+//	/host/<path> maps to the host filesystem mounted inside the agent container
+//	/volumes/<volumeID>/<path> maps to the data of the Docker volumes
+//
+// The client paths are cleaned as absolute paths, so they cannot escape the root directory, and their symbolic links
+// are resolved to make sure they stay inside the host root or the data of their volume.
+type fileSystem struct {
+	hostRoot    string
+	volumesRoot string
+}
+
+// resolve returns the local path associated to a client path, or false when the client path is
+// one of the virtual directories (/ and /volumes)
+func (fsys *fileSystem) resolve(clientPath string) (string, bool, error) {
+	clientPath = cleanPath(clientPath)
+	if clientPath == "/" {
+		return "", false, nil
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(clientPath, "/"), "/", 3)
+
+	switch parts[0] {
+	case hostFolder:
+		localPath, err := confine(fsys.hostRoot, filepath.FromSlash(strings.TrimPrefix(clientPath, "/"+hostFolder)))
+
+		return localPath, true, err
+	case volumesFolder:
+		if len(parts) == 1 {
+			return "", false, nil
+		}
+
+		relativePath := ""
+		if len(parts) == 3 {
+			relativePath = filepath.FromSlash(parts[2])
+		}
+
+		localPath, err := confine(filepath.Join(fsys.volumesRoot, parts[1], "_data"), relativePath)
+
+		return localPath, true, err
+	}
+
+	return "", false, fs.ErrNotExist
+}
+
+// confine returns the local path of relativePath inside root, with the symbolic links of its parent directories
+// resolved. errPathEscape is returned when the path or its parent directory resolves outside of root, so that the
+// operations following the symbolic links stay inside root while the links themselves can still be listed, read
+// and removed.
+func confine(root, relativePath string) (string, error) {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+
+	localPath := filepath.Join(realRoot, relativePath)
+	if localPath == realRoot {
+		return realRoot, nil
+	}
+
+	parent, err := evalSymlinks(filepath.Dir(localPath))
+	if err != nil {
+		return "", err
+	}
+
+	target, err := evalSymlinks(localPath)
+	if err != nil {
+		return "", err
+	}
+
+	if !within(realRoot, parent) || !within(realRoot, target) {
+		return "", errPathEscape
+	}
+
+	return filepath.Join(parent, filepath.Base(localPath)), nil
+}
+
+// evalSymlinks returns localPath with its symbolic links resolved, the part of the path that does not exist yet is
+// kept as is and the dangling links are resolved to the path they would create
+func evalSymlinks(localPath string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(localPath)
+	if err == nil {
+		return resolved, nil
+	}
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	if target, err := os.Readlink(localPath); err == nil {
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(localPath), target)
+		}
+
+		return evalSymlinks(target)
+	}
+
+	parent := filepath.Dir(localPath)
+	if parent == localPath {
+		return localPath, nil
+	}
+
+	resolvedParent, err := evalSymlinks(parent)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(resolvedParent, filepath.Base(localPath)), nil
+}
+
+func within(root, localPath string) bool {
+	relativePath, err := filepath.Rel(root, localPath)
+
+	return err == nil && relativePath != ".." && !strings.HasPrefix(relativePath, ".."+string(filepath.Separator))
+}
+
+// stat returns the information of a file, the virtual directories are reported as read-only directories
+func (fsys *fileSystem) stat(clientPath string, followSymlinks bool) (os.FileInfo, error) {
+	localPath, ok, err := fsys.resolve(clientPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return virtualDir(path.Base(cleanPath(clientPath))), nil
+	}
+
+	if followSymlinks {
+		return os.Stat(localPath)
+	}
+
+	return os.Lstat(localPath)
+}
+
+// readDir returns the content of a directory
+func (fsys *fileSystem) readDir(clientPath string) ([]os.FileInfo, error) {
+	localPath, ok, err := fsys.resolve(clientPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		return readDirInfo(localPath)
+	}
+
+	if cleanPath(clientPath) == "/" {
+		return []os.FileInfo{virtualDir(hostFolder), virtualDir(volumesFolder)}, nil
+	}
+
+	volumes, err := os.ReadDir(fsys.volumesRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]os.FileInfo, 0, len(volumes))
+	for _, volume := range volumes {
+		if volume.IsDir() {
+			infos = append(infos, virtualDir(volume.Name()))
+		}
+	}
+
+	return infos, nil
+}
+
+// writablePath resolves a client path that is about to be created, modified or removed
+func (fsys *fileSystem) writablePath(clientPath string) (string, error) {
+	localPath, ok, err := fsys.resolve(clientPath)
+	if err != nil {
+		return "", err
+	}
+
+	if !ok || isVolumeRoot(clientPath) {
+		return "", errReadOnly
+	}
+
+	return localPath, nil
+}
+
+func readDirInfo(localPath string) ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(localPath)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			// the file was removed in the meantime
+			continue
+		}
+
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+func isVolumeRoot(clientPath string) bool {
+	parts := strings.Split(strings.TrimPrefix(cleanPath(clientPath), "/"), "/")
+
+	return len(parts) == 2 && parts[0] == volumesFolder
+}
+
+func cleanPath(clientPath string) string {
+	return path.Clean("/" + filepath.ToSlash(clientPath))
+}
+
+// virtualDir represents one of the directories that do not exist on the filesystem
+type virtualDir string
+
+func (d virtualDir) Name() string       { return string(d) }
+func (d virtualDir) Size() int64        { return 0 }
+func (d virtualDir) Mode() os.FileMode  { return os.ModeDir | 0555 }
+func (d virtualDir) ModTime() time.Time { return time.Unix(0, 0) }
+func (d virtualDir) IsDir() bool        { return true }
+func (d virtualDir) Sys() interface{}   { return nil }
@@ -0,0 +1,124 @@
+package sftp
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func symlink(t *testing.T, target, link string) {
+	t.Helper()
+
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileSystem_ResolveSymlinks(t *testing.T) {
+	fsys := setupFileSystem(t)
+	outside := t.TempDir()
+
+	dataRoot := filepath.Join(fsys.volumesRoot, "data", "_data")
+	otherRoot := filepath.Join(fsys.volumesRoot, "other", "_data")
+	for _, dir := range []string{filepath.Join(fsys.hostRoot, "etc"), otherRoot} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	symlink(t, outside, filepath.Join(fsys.hostRoot, "escape"))
+	symlink(t, "../..", filepath.Join(fsys.hostRoot, "etc", "parent"))
+	symlink(t, filepath.Join(outside, "missing"), filepath.Join(fsys.hostRoot, "dangling"))
+	symlink(t, "etc", filepath.Join(fsys.hostRoot, "config"))
+	symlink(t, otherRoot, filepath.Join(dataRoot, "other"))
+	symlink(t, "missing", filepath.Join(dataRoot, "new"))
+
+	tests := []struct {
+		clientPath string
+		// expected is the local path relative to the root of the volumes, empty when the path escapes its root
+		expected string
+	}{
+		{clientPath: "/host/escape"},
+		{clientPath: "/host/escape/file"},
+		{clientPath: "/host/etc/parent"},
+		{clientPath: "/host/etc/parent/outside"},
+		{clientPath: "/host/dangling"},
+		{clientPath: "/volumes/data/other"},
+		{clientPath: "/volumes/data/other/file"},
+		{clientPath: "/host/config", expected: "../host/config"},
+		{clientPath: "/host/config/file", expected: "../host/etc/file"},
+		{clientPath: "/host/missing/file", expected: "../host/missing/file"},
+		{clientPath: "/volumes/data/new", expected: "data/_data/new"},
+		{clientPath: "/volumes/data/../../host/escape"},
+		{clientPath: "/volumes/data", expected: "data/_data"},
+	}
+
+	realVolumesRoot, err := filepath.EvalSymlinks(fsys.volumesRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.clientPath, func(t *testing.T) {
+			localPath, ok, err := fsys.resolve(tt.clientPath)
+
+			if tt.expected == "" {
+				if !errors.Is(err, errPathEscape) {
+					t.Errorf("expected the path to escape its root, got %q (%v)", localPath, err)
+				}
+
+				return
+			}
+
+			if err != nil || !ok {
+				t.Fatalf("unable to resolve the path: %v", err)
+			}
+
+			if expected := filepath.Join(realVolumesRoot, filepath.FromSlash(tt.expected)); localPath != expected {
+				t.Errorf("expected %s, got %s", expected, localPath)
+			}
+		})
+	}
+}
+
+func TestSession_SymlinksCannotEscapeRoot(t *testing.T) {
+	fsys := setupFileSystem(t)
+	outside := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	symlink(t, outside, filepath.Join(fsys.hostRoot, "escape"))
+	symlink(t, filepath.Join(outside, "created"), filepath.Join(fsys.hostRoot, "dangling"))
+
+	client := newTestClient(t, fsys)
+
+	client.expectStatus(fxPermissionDenied, fxpOpen, func(e *encoder) {
+		e.string("/host/escape/secret")
+		e.uint32(fxfRead)
+		e.attrs(fileAttrs{})
+	})
+
+	client.expectStatus(fxPermissionDenied, fxpOpen, func(e *encoder) {
+		e.string("/host/dangling")
+		e.uint32(fxfWrite | fxfCreat)
+		e.attrs(fileAttrs{})
+	})
+
+	client.expectStatus(fxPermissionDenied, fxpOpendir, func(e *encoder) { e.string("/host/escape") })
+
+	client.expectStatus(fxPermissionDenied, fxpRename, func(e *encoder) {
+		e.string("/host/escape/secret")
+		e.string("/host/secret")
+	})
+
+	if _, err := os.Stat(filepath.Join(outside, "created")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected no file to be created outside of the host root, got %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(outside, "secret")); err != nil {
+		t.Errorf("expected the file outside of the host root to be left untouched, got %v", err)
+	}
+}
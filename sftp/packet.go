@@ -0,0 +1,295 @@
+package sftp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Packet types of the version 3 of the SFTP protocol (draft-ietf-secsh-filexfer-02)
+const (
+	fxpInit     = 1
+	fxpVersion  = 2
+	fxpOpen     = 3
+	fxpClose    = 4
+	fxpRead     = 5
+	fxpWrite    = 6
+	fxpLstat    = 7
+	fxpFstat    = 8
+	fxpSetstat  = 9
+	fxpFsetstat = 10
+	fxpOpendir  = 11
+	fxpReaddir  = 12
+	fxpRemove   = 13
+	fxpMkdir    = 14
+	fxpRmdir    = 15
+	fxpRealpath = 16
+	fxpStat     = 17
+	fxpRename   = 18
+	fxpStatus   = 101
+	fxpHandle   = 102
+	fxpData     = 103
+	fxpName     = 104
+	fxpAttrs    = 105
+)
+
+// Status codes
+const (
+	fxOK               = 0
+	fxEOF              = 1
+	fxNoSuchFile       = 2
+	fxPermissionDenied = 3
+	fxFailure          = 4
+	fxBadMessage       = 5
+	fxOpUnsupported    = 8
+)
+
+// Attribute flags
+const (
+	attrSize        = 0x00000001
+	attrUIDGID      = 0x00000002
+	attrPermissions = 0x00000004
+	attrACModTime   = 0x00000008
+	attrExtended    = 0x80000000
+)
+
+// Open flags
+const (
+	fxfRead   = 0x00000001
+	fxfWrite  = 0x00000002
+	fxfAppend = 0x00000004
+	fxfCreat  = 0x00000008
+	fxfTrunc  = 0x00000010
+	fxfExcl   = 0x00000020
+)
+
+// File type bits of the permissions attribute
+const (
+	modeTypeDir     = 0040000
+	modeTypeRegular = 0100000
+	modeTypeSymlink = 0120000
+)
+
+const (
+	protocolVersion = 3
+	// maxPacketSize is the maximum size of the packets accepted from the clients, the clients are
+	// required to support packets of 34000 bytes and usually write chunks of 32KB
+	maxPacketSize = 256 * 1024
+	// maxReadLength is the maximum number of bytes returned by a single read request
+	maxReadLength = 64 * 1024
+)
+
+var errBadMessage = errors.New("malformed SFTP packet")
+
+// fileAttrs represents the attributes of a file exchanged with the clients
+type fileAttrs struct {
+	flags       uint32
+	size        uint64
+	permissions uint32
+	atime       uint32
+	mtime       uint32
+}
+
+func attrsFromFileInfo(info os.FileInfo) fileAttrs {
+	mode := info.Mode()
+
+	permissions := uint32(mode.Perm())
+	switch {
+	case mode.IsDir():
+		permissions |= modeTypeDir
+	case mode&os.ModeSymlink != 0:
+		permissions |= modeTypeSymlink
+	case mode.IsRegular():
+		permissions |= modeTypeRegular
+	}
+
+	mtime := uint32(info.ModTime().Unix())
+
+	return fileAttrs{
+		flags:       attrSize | attrPermissions | attrACModTime,
+		size:        uint64(info.Size()),
+		permissions: permissions,
+		atime:       mtime,
+		mtime:       mtime,
+	}
+}
+
+// longName returns the ls -l like representation of a file expected in the name responses
+func longName(info os.FileInfo) string {
+	return fmt.Sprintf("%s 1 0 0 %d %s %s", info.Mode().String(), info.Size(), info.ModTime().Format("Jan _2 15:04"), info.Name())
+}
+
+func readPacket(r io.Reader) ([]byte, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(length[:])
+	if size == 0 || size > maxPacketSize {
+		return nil, fmt.Errorf("invalid SFTP packet length: %d", size)
+	}
+
+	packet := make([]byte, size)
+	if _, err := io.ReadFull(r, packet); err != nil {
+		return nil, err
+	}
+
+	return packet, nil
+}
+
+// decoder reads the fields of a packet, the first error is kept and the following reads return zero values
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil || len(d.buf) < n {
+		d.err = errBadMessage
+		return nil
+	}
+
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+
+	return b
+}
+
+func (d *decoder) uint32() uint32 {
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+
+	return binary.BigEndian.Uint32(b)
+}
+
+func (d *decoder) uint64() uint64 {
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+
+	return binary.BigEndian.Uint64(b)
+}
+
+func (d *decoder) bytes() []byte {
+	length := d.uint32()
+	if length > maxPacketSize {
+		d.err = errBadMessage
+		return nil
+	}
+
+	return d.next(int(length))
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+func (d *decoder) attrs() fileAttrs {
+	attrs := fileAttrs{flags: d.uint32()}
+
+	if attrs.flags&attrSize != 0 {
+		attrs.size = d.uint64()
+	}
+
+	if attrs.flags&attrUIDGID != 0 {
+		d.uint32()
+		d.uint32()
+	}
+
+	if attrs.flags&attrPermissions != 0 {
+		attrs.permissions = d.uint32()
+	}
+
+	if attrs.flags&attrACModTime != 0 {
+		attrs.atime = d.uint32()
+		attrs.mtime = d.uint32()
+	}
+
+	if attrs.flags&attrExtended != 0 {
+		count := d.uint32()
+		for i := uint32(0); i < count && d.err == nil; i++ {
+			d.bytes()
+			d.bytes()
+		}
+	}
+
+	return attrs
+}
+
+// encoder builds a packet, the length prefix is written by finish
+type encoder struct {
+	buf []byte
+}
+
+func newEncoder(packetType byte, id uint32) *encoder {
+	e := &encoder{buf: make([]byte, 4, 64)}
+	e.byte(packetType)
+	e.uint32(id)
+
+	return e
+}
+
+func (e *encoder) byte(b byte) {
+	e.buf = append(e.buf, b)
+}
+
+func (e *encoder) uint32(v uint32) {
+	e.buf = binary.BigEndian.AppendUint32(e.buf, v)
+}
+
+func (e *encoder) uint64(v uint64) {
+	e.buf = binary.BigEndian.AppendUint64(e.buf, v)
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uint32(uint32(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) string(s string) {
+	e.uint32(uint32(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) attrs(attrs fileAttrs) {
+	e.uint32(attrs.flags)
+
+	if attrs.flags&attrSize != 0 {
+		e.uint64(attrs.size)
+	}
+
+	if attrs.flags&attrPermissions != 0 {
+		e.uint32(attrs.permissions)
+	}
+
+	if attrs.flags&attrACModTime != 0 {
+		e.uint32(attrs.atime)
+		e.uint32(attrs.mtime)
+	}
+}
+
+func (e *encoder) finish() []byte {
+	binary.BigEndian.PutUint32(e.buf, uint32(len(e.buf)-4))
+
+	return e.buf
+}
+
+func statusPacket(id uint32, code uint32, message string) []byte {
+	e := newEncoder(fxpStatus, id)
+	e.uint32(code)
+	e.string(message)
+	e.string("en")
+
+	return e.finish()
+}
+
+func unixTime(t uint32) time.Time {
+	return time.Unix(int64(t), 0)
+}
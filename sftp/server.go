@@ -0,0 +1,28 @@
+package sftp
+
+import (
+	"io"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/constants"
+	agentnet "github.com/portainer/agent/net"
+)
+
+// Serve serves the SFTP session of a client over rw until the client closes it, the session exposes the host
+// filesystem and the Docker volumes browsed by the agent. rw is a stream authenticated by the caller, e.g. the
+// websocket of a request signed by the Portainer instance and allowed by the policy, the standard SFTP clients
+// (WinSCP, FileZilla, sftp...) connect to the Portainer instance which tunnels their sessions to the agent.
+func Serve(rw io.ReadWriter) error {
+	metered := struct {
+		io.Reader
+		io.Writer
+	}{
+		agentnet.MeterReceivedReader(agentnet.BandwidthSFTP, rw),
+		agentnet.MeterWriter(agentnet.BandwidthSFTP, rw),
+	}
+
+	return newSession(metered, &fileSystem{
+		hostRoot:    agent.HostRoot,
+		volumesRoot: constants.SystemVolumePath,
+	}).serve()
+}
@@ -0,0 +1,517 @@
+package sftp
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+)
+
+const (
+	// maxHandles is the maximum number of files and directories opened at the same time by a session
+	maxHandles = 256
+	// readDirBatchSize is the maximum number of entries returned by a single readdir request
+	readDirBatchSize = 128
+)
+
+// handle represents a file or a directory opened by the client
+type handle struct {
+	file *os.File
+	// entries are the directory entries that have not been sent to the client yet
+	entries []os.FileInfo
+	isDir   bool
+}
+
+// session serves the SFTP requests of a client, the requests are processed in order
+type session struct {
+	rw         io.ReadWriter
+	fs         *fileSystem
+	handles    map[string]*handle
+	nextHandle uint64
+}
+
+func newSession(rw io.ReadWriter, fsys *fileSystem) *session {
+	return &session{
+		rw:      rw,
+		fs:      fsys,
+		handles: map[string]*handle{},
+	}
+}
+
+// serve processes the requests until the client closes the channel
+func (s *session) serve() error {
+	defer s.closeHandles()
+
+	for {
+		packet, err := readPacket(s.rw)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			return err
+		}
+
+		response := s.handlePacket(packet)
+
+		if _, err := s.rw.Write(response); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *session) handlePacket(packet []byte) []byte {
+	d := &decoder{buf: packet[1:]}
+
+	if packet[0] == fxpInit {
+		e := &encoder{buf: make([]byte, 4, 9)}
+		e.byte(fxpVersion)
+		e.uint32(protocolVersion)
+
+		return e.finish()
+	}
+
+	id := d.uint32()
+	if d.err != nil {
+		return statusPacket(id, fxBadMessage, d.err.Error())
+	}
+
+	var response []byte
+	switch packet[0] {
+	case fxpOpen:
+		response = s.open(id, d)
+	case fxpClose:
+		response = s.close(id, d)
+	case fxpRead:
+		response = s.read(id, d)
+	case fxpWrite:
+		response = s.write(id, d)
+	case fxpLstat:
+		response = s.stat(id, d, false)
+	case fxpStat:
+		response = s.stat(id, d, true)
+	case fxpFstat:
+		response = s.fstat(id, d)
+	case fxpSetstat:
+		response = s.setstat(id, d)
+	case fxpFsetstat:
+		response = s.fsetstat(id, d)
+	case fxpOpendir:
+		response = s.opendir(id, d)
+	case fxpReaddir:
+		response = s.readdir(id, d)
+	case fxpRemove, fxpRmdir:
+		response = s.remove(id, d)
+	case fxpMkdir:
+		response = s.mkdir(id, d)
+	case fxpRealpath:
+		response = s.realpath(id, d)
+	case fxpRename:
+		response = s.rename(id, d)
+	default:
+		return statusPacket(id, fxOpUnsupported, "operation not supported")
+	}
+
+	if d.err != nil {
+		return statusPacket(id, fxBadMessage, d.err.Error())
+	}
+
+	return response
+}
+
+func (s *session) open(id uint32, d *decoder) []byte {
+	clientPath := d.string()
+	pflags := d.uint32()
+	attrs := d.attrs()
+	if d.err != nil {
+		return nil
+	}
+
+	flags := os.O_RDONLY
+	switch {
+	case pflags&fxfRead != 0 && pflags&fxfWrite != 0:
+		flags = os.O_RDWR
+	case pflags&fxfWrite != 0:
+		flags = os.O_WRONLY
+	}
+
+	// the writes are positioned by the client, the append flag is only a hint
+	if pflags&fxfCreat != 0 {
+		flags |= os.O_CREATE
+	}
+
+	if pflags&fxfTrunc != 0 {
+		flags |= os.O_TRUNC
+	}
+
+	if pflags&fxfExcl != 0 {
+		flags |= os.O_EXCL
+	}
+
+	var localPath string
+	var err error
+	if flags == os.O_RDONLY {
+		localPath, err = s.resolveFile(clientPath)
+	} else {
+		localPath, err = s.fs.writablePath(clientPath)
+	}
+	if err != nil {
+		return errorStatus(id, err)
+	}
+
+	mode := os.FileMode(0644)
+	if attrs.flags&attrPermissions != 0 {
+		mode = os.FileMode(attrs.permissions).Perm()
+	}
+
+	file, err := os.OpenFile(localPath, flags, mode)
+	if err != nil {
+		return errorStatus(id, err)
+	}
+
+	return s.addHandle(id, &handle{file: file})
+}
+
+func (s *session) close(id uint32, d *decoder) []byte {
+	handleID := d.string()
+
+	h, ok := s.handles[handleID]
+	if !ok {
+		return statusPacket(id, fxFailure, "invalid handle")
+	}
+
+	delete(s.handles, handleID)
+
+	if h.file != nil {
+		if err := h.file.Close(); err != nil {
+			return errorStatus(id, err)
+		}
+	}
+
+	return statusPacket(id, fxOK, "")
+}
+
+func (s *session) read(id uint32, d *decoder) []byte {
+	h := s.fileHandle(d.string())
+	offset := d.uint64()
+	length := d.uint32()
+	if d.err != nil {
+		return nil
+	}
+
+	if h == nil {
+		return statusPacket(id, fxFailure, "invalid handle")
+	}
+
+	if length > maxReadLength {
+		length = maxReadLength
+	}
+
+	data := make([]byte, length)
+	n, err := h.file.ReadAt(data, int64(offset))
+	if n == 0 && err != nil {
+		if errors.Is(err, io.EOF) {
+			return statusPacket(id, fxEOF, "")
+		}
+
+		return errorStatus(id, err)
+	}
+
+	e := newEncoder(fxpData, id)
+	e.bytes(data[:n])
+
+	return e.finish()
+}
+
+func (s *session) write(id uint32, d *decoder) []byte {
+	h := s.fileHandle(d.string())
+	offset := d.uint64()
+	data := d.bytes()
+	if d.err != nil {
+		return nil
+	}
+
+	if h == nil {
+		return statusPacket(id, fxFailure, "invalid handle")
+	}
+
+	if _, err := h.file.WriteAt(data, int64(offset)); err != nil {
+		return errorStatus(id, err)
+	}
+
+	return statusPacket(id, fxOK, "")
+}
+
+func (s *session) stat(id uint32, d *decoder, followSymlinks bool) []byte {
+	clientPath := d.string()
+	if d.err != nil {
+		return nil
+	}
+
+	info, err := s.fs.stat(clientPath, followSymlinks)
+	if err != nil {
+		return errorStatus(id, err)
+	}
+
+	return attrsPacket(id, info)
+}
+
+func (s *session) fstat(id uint32, d *decoder) []byte {
+	h := s.fileHandle(d.string())
+	if d.err != nil {
+		return nil
+	}
+
+	if h == nil {
+		return statusPacket(id, fxFailure, "invalid handle")
+	}
+
+	info, err := h.file.Stat()
+	if err != nil {
+		return errorStatus(id, err)
+	}
+
+	return attrsPacket(id, info)
+}
+
+func (s *session) setstat(id uint32, d *decoder) []byte {
+	clientPath := d.string()
+	attrs := d.attrs()
+	if d.err != nil {
+		return nil
+	}
+
+	localPath, err := s.fs.writablePath(clientPath)
+	if err != nil {
+		return errorStatus(id, err)
+	}
+
+	return errorStatus(id, applyAttrs(localPath, attrs))
+}
+
+func (s *session) fsetstat(id uint32, d *decoder) []byte {
+	h := s.fileHandle(d.string())
+	attrs := d.attrs()
+	if d.err != nil {
+		return nil
+	}
+
+	if h == nil {
+		return statusPacket(id, fxFailure, "invalid handle")
+	}
+
+	return errorStatus(id, applyAttrs(h.file.Name(), attrs))
+}
+
+func (s *session) opendir(id uint32, d *decoder) []byte {
+	clientPath := d.string()
+	if d.err != nil {
+		return nil
+	}
+
+	entries, err := s.fs.readDir(clientPath)
+	if err != nil {
+		return errorStatus(id, err)
+	}
+
+	return s.addHandle(id, &handle{entries: entries, isDir: true})
+}
+
+func (s *session) readdir(id uint32, d *decoder) []byte {
+	h, ok := s.handles[d.string()]
+	if d.err != nil {
+		return nil
+	}
+
+	if !ok || !h.isDir {
+		return statusPacket(id, fxFailure, "invalid handle")
+	}
+
+	if len(h.entries) == 0 {
+		return statusPacket(id, fxEOF, "")
+	}
+
+	batch := h.entries
+	if len(batch) > readDirBatchSize {
+		batch = batch[:readDirBatchSize]
+	}
+	h.entries = h.entries[len(batch):]
+
+	e := newEncoder(fxpName, id)
+	e.uint32(uint32(len(batch)))
+	for _, info := range batch {
+		e.string(info.Name())
+		e.string(longName(info))
+		e.attrs(attrsFromFileInfo(info))
+	}
+
+	return e.finish()
+}
+
+func (s *session) remove(id uint32, d *decoder) []byte {
+	clientPath := d.string()
+	if d.err != nil {
+		return nil
+	}
+
+	localPath, err := s.fs.writablePath(clientPath)
+	if err != nil {
+		return errorStatus(id, err)
+	}
+
+	return errorStatus(id, os.Remove(localPath))
+}
+
+func (s *session) mkdir(id uint32, d *decoder) []byte {
+	clientPath := d.string()
+	attrs := d.attrs()
+	if d.err != nil {
+		return nil
+	}
+
+	localPath, err := s.fs.writablePath(clientPath)
+	if err != nil {
+		return errorStatus(id, err)
+	}
+
+	mode := os.FileMode(0755)
+	if attrs.flags&attrPermissions != 0 {
+		mode = os.FileMode(attrs.permissions).Perm()
+	}
+
+	return errorStatus(id, os.Mkdir(localPath, mode))
+}
+
+func (s *session) realpath(id uint32, d *decoder) []byte {
+	clientPath := d.string()
+	if d.err != nil {
+		return nil
+	}
+
+	e := newEncoder(fxpName, id)
+	e.uint32(1)
+	e.string(cleanPath(clientPath))
+	e.string(cleanPath(clientPath))
+	e.attrs(fileAttrs{})
+
+	return e.finish()
+}
+
+func (s *session) rename(id uint32, d *decoder) []byte {
+	oldPath := d.string()
+	newPath := d.string()
+	if d.err != nil {
+		return nil
+	}
+
+	oldLocalPath, err := s.fs.writablePath(oldPath)
+	if err != nil {
+		return errorStatus(id, err)
+	}
+
+	newLocalPath, err := s.fs.writablePath(newPath)
+	if err != nil {
+		return errorStatus(id, err)
+	}
+
+	// the protocol requires the rename to fail when the target already exists
+	if _, err := os.Lstat(newLocalPath); err == nil {
+		return statusPacket(id, fxFailure, "target already exists")
+	}
+
+	return errorStatus(id, os.Rename(oldLocalPath, newLocalPath))
+}
+
+// resolveFile resolves the path of a file opened for reading
+func (s *session) resolveFile(clientPath string) (string, error) {
+	localPath, ok, err := s.fs.resolve(clientPath)
+	if err != nil {
+		return "", err
+	}
+
+	if !ok {
+		return "", errReadOnly
+	}
+
+	return localPath, nil
+}
+
+func (s *session) addHandle(id uint32, h *handle) []byte {
+	if len(s.handles) >= maxHandles {
+		if h.file != nil {
+			h.file.Close()
+		}
+
+		return statusPacket(id, fxFailure, "too many open handles")
+	}
+
+	s.nextHandle++
+	handleID := strconv.FormatUint(s.nextHandle, 10)
+	s.handles[handleID] = h
+
+	e := newEncoder(fxpHandle, id)
+	e.string(handleID)
+
+	return e.finish()
+}
+
+func (s *session) fileHandle(handleID string) *handle {
+	h, ok := s.handles[handleID]
+	if !ok || h.isDir {
+		return nil
+	}
+
+	return h
+}
+
+func (s *session) closeHandles() {
+	for handleID, h := range s.handles {
+		if h.file != nil {
+			h.file.Close()
+		}
+
+		delete(s.handles, handleID)
+	}
+}
+
+func applyAttrs(localPath string, attrs fileAttrs) error {
+	if attrs.flags&attrSize != 0 {
+		if err := os.Truncate(localPath, int64(attrs.size)); err != nil {
+			return err
+		}
+	}
+
+	if attrs.flags&attrPermissions != 0 {
+		if err := os.Chmod(localPath, os.FileMode(attrs.permissions).Perm()); err != nil {
+			return err
+		}
+	}
+
+	if attrs.flags&attrACModTime != 0 {
+		return os.Chtimes(localPath, unixTime(attrs.atime), unixTime(attrs.mtime))
+	}
+
+	return nil
+}
+
+func attrsPacket(id uint32, info os.FileInfo) []byte {
+	e := newEncoder(fxpAttrs, id)
+	e.attrs(attrsFromFileInfo(info))
+
+	return e.finish()
+}
+
+// errorStatus returns the status packet associated to an error, a nil error is reported as a success
+func errorStatus(id uint32, err error) []byte {
+	switch {
+	case err == nil:
+		return statusPacket(id, fxOK, "")
+	case errors.Is(err, fs.ErrNotExist):
+		return statusPacket(id, fxNoSuchFile, err.Error())
+	case errors.Is(err, fs.ErrPermission), errors.Is(err, errReadOnly), errors.Is(err, errPathEscape):
+		return statusPacket(id, fxPermissionDenied, err.Error())
+	}
+
+	return statusPacket(id, fxFailure, err.Error())
+}
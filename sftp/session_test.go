@@ -0,0 +1,200 @@
+package sftp
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testClient struct {
+	t      *testing.T
+	conn   net.Conn
+	nextID uint32
+}
+
+func newTestClient(t *testing.T, fsys *fileSystem) *testClient {
+	serverConn, clientConn := net.Pipe()
+
+	go newSession(serverConn, fsys).serve()
+
+	t.Cleanup(func() { clientConn.Close() })
+
+	client := &testClient{t: t, conn: clientConn}
+
+	e := &encoder{buf: make([]byte, 4)}
+	e.byte(fxpInit)
+	e.uint32(protocolVersion)
+	packetType, d := client.roundTrip(e.finish())
+	if packetType != fxpVersion || d.uint32() != protocolVersion {
+		t.Fatalf("unexpected init response: %d", packetType)
+	}
+
+	return client
+}
+
+func (c *testClient) roundTrip(packet []byte) (byte, *decoder) {
+	if _, err := c.conn.Write(packet); err != nil {
+		c.t.Fatal(err)
+	}
+
+	response, err := readPacket(c.conn)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	return response[0], &decoder{buf: response[1:]}
+}
+
+// request sends a request built by fill and returns the type of the response, its identifier is checked
+func (c *testClient) request(packetType byte, fill func(e *encoder)) (byte, *decoder) {
+	c.nextID++
+
+	e := newEncoder(packetType, c.nextID)
+	fill(e)
+
+	responseType, d := c.roundTrip(e.finish())
+	if id := d.uint32(); id != c.nextID {
+		c.t.Fatalf("expected response to request %d, got %d", c.nextID, id)
+	}
+
+	return responseType, d
+}
+
+func (c *testClient) expectStatus(code uint32, packetType byte, fill func(e *encoder)) {
+	c.t.Helper()
+
+	responseType, d := c.request(packetType, fill)
+	if responseType != fxpStatus {
+		c.t.Fatalf("expected status response, got %d", responseType)
+	}
+
+	if got := d.uint32(); got != code {
+		c.t.Fatalf("expected status %d, got %d (%s)", code, got, d.string())
+	}
+}
+
+func (c *testClient) open(clientPath string, pflags uint32) string {
+	c.t.Helper()
+
+	responseType, d := c.request(fxpOpen, func(e *encoder) {
+		e.string(clientPath)
+		e.uint32(pflags)
+		e.attrs(fileAttrs{})
+	})
+	if responseType != fxpHandle {
+		c.t.Fatalf("unable to open %s: %d", clientPath, responseType)
+	}
+
+	return d.string()
+}
+
+func setupFileSystem(t *testing.T) *fileSystem {
+	root := t.TempDir()
+
+	fsys := &fileSystem{
+		hostRoot:    filepath.Join(root, "host"),
+		volumesRoot: filepath.Join(root, "volumes"),
+	}
+
+	for _, dir := range []string{fsys.hostRoot, filepath.Join(fsys.volumesRoot, "data", "_data")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return fsys
+}
+
+func TestSession_WriteAndReadFile(t *testing.T) {
+	fsys := setupFileSystem(t)
+	client := newTestClient(t, fsys)
+
+	handle := client.open("/volumes/data/file.txt", fxfWrite|fxfCreat|fxfTrunc)
+	client.expectStatus(fxOK, fxpWrite, func(e *encoder) {
+		e.string(handle)
+		e.uint64(0)
+		e.string("hello")
+	})
+	client.expectStatus(fxOK, fxpClose, func(e *encoder) { e.string(handle) })
+
+	content, err := os.ReadFile(filepath.Join(fsys.volumesRoot, "data", "_data", "file.txt"))
+	if err != nil || string(content) != "hello" {
+		t.Fatalf("unexpected file content: %q (%v)", content, err)
+	}
+
+	handle = client.open("/volumes/data/file.txt", fxfRead)
+	responseType, d := client.request(fxpRead, func(e *encoder) {
+		e.string(handle)
+		e.uint64(1)
+		e.uint32(1024)
+	})
+	if responseType != fxpData {
+		t.Fatalf("expected data response, got %d", responseType)
+	}
+
+	if data := d.string(); data != "ello" {
+		t.Fatalf("unexpected data: %q", data)
+	}
+
+	client.expectStatus(fxEOF, fxpRead, func(e *encoder) {
+		e.string(handle)
+		e.uint64(5)
+		e.uint32(1024)
+	})
+}
+
+func TestSession_ReadDir(t *testing.T) {
+	fsys := setupFileSystem(t)
+	client := newTestClient(t, fsys)
+
+	responseType, d := client.request(fxpOpendir, func(e *encoder) { e.string("/") })
+	if responseType != fxpHandle {
+		t.Fatalf("expected handle response, got %d", responseType)
+	}
+	handle := d.string()
+
+	responseType, d = client.request(fxpReaddir, func(e *encoder) { e.string(handle) })
+	if responseType != fxpName {
+		t.Fatalf("expected name response, got %d", responseType)
+	}
+
+	count := d.uint32()
+	names := []string{}
+	for i := uint32(0); i < count; i++ {
+		names = append(names, d.string())
+		d.string()
+		if attrs := d.attrs(); attrs.permissions&modeTypeDir == 0 {
+			t.Errorf("expected %s to be a directory", names[i])
+		}
+	}
+
+	if len(names) != 2 || names[0] != hostFolder || names[1] != volumesFolder {
+		t.Fatalf("unexpected root entries: %v", names)
+	}
+
+	client.expectStatus(fxEOF, fxpReaddir, func(e *encoder) { e.string(handle) })
+}
+
+func TestSession_PathsCannotEscapeRoot(t *testing.T) {
+	fsys := setupFileSystem(t)
+	client := newTestClient(t, fsys)
+
+	client.expectStatus(fxNoSuchFile, fxpMkdir, func(e *encoder) {
+		e.string("/volumes/../../outside")
+		e.attrs(fileAttrs{})
+	})
+
+	client.expectStatus(fxPermissionDenied, fxpRmdir, func(e *encoder) { e.string("/volumes/data") })
+
+	client.expectStatus(fxNoSuchFile, fxpStat, func(e *encoder) { e.string("/etc/passwd") })
+
+	client.expectStatus(fxOK, fxpMkdir, func(e *encoder) {
+		e.string("/host/../host/dir")
+		e.attrs(fileAttrs{})
+	})
+
+	if _, err := os.Stat(filepath.Join(fsys.hostRoot, "dir")); err != nil {
+		t.Fatalf("expected the directory to be created inside the host root: %v", err)
+	}
+}
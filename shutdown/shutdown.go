@@ -0,0 +1,163 @@
+// Package shutdown stops the Edge stacks of the host in dependency order before the host powers off, so that the
+// databases and the applications writing to the disks are stopped cleanly on the edge devices that are unplugged
+// on UPS events. The stop is triggered by signals sent to the agent, e.g. SIGPWR sent by the shutdown command of the
+// UPS daemon with docker kill --signal PWR, or SIGTERM when the agent is only stopped with the host.
+package shutdown
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/portainer/agent/docker"
+
+	"github.com/rs/zerolog/log"
+)
+
+// edgeStackProjectPrefix is the prefix of the Compose projects of the Edge stacks
+const edgeStackProjectPrefix = "edge_"
+
+// Hook stops the containers of the Edge stacks in dependency order when the agent receives one of its signals
+type Hook struct {
+	signals     []os.Signal
+	stopTimeout time.Duration
+	timeout     time.Duration
+	mu          sync.Mutex
+
+	dependencyGraph func(ctx context.Context) (*docker.DependencyGraph, error)
+	stopContainer   func(ctx context.Context, id string, timeout time.Duration) error
+}
+
+// NewHook returns a pointer to a Hook triggered by the signals named in signalNames, e.g. PWR or SIGTERM. Each
+// container is killed when it is not stopped after stopTimeout, the containers that are not stopped after timeout
+// are left to the host.
+func NewHook(signalNames []string, stopTimeout, timeout time.Duration) (*Hook, error) {
+	hook := &Hook{
+		stopTimeout:     stopTimeout,
+		timeout:         timeout,
+		dependencyGraph: docker.GetDependencyGraph,
+		stopContainer:   docker.ContainerStopWithTimeout,
+	}
+
+	for _, name := range signalNames {
+		name = strings.ToUpper(strings.TrimSpace(name))
+
+		sig, ok := signals[strings.TrimPrefix(name, "SIG")]
+		if !ok {
+			return nil, fmt.Errorf("unsupported shutdown signal %q", name)
+		}
+
+		hook.signals = append(hook.signals, sig)
+	}
+
+	return hook, nil
+}
+
+// Listen stops the stacks each time the agent receives one of the signals of the hook that do not terminate the
+// agent, until ctx is done. The terminating signals, SIGINT and SIGTERM, are handled with Handles.
+func (hook *Hook) Listen(ctx context.Context) {
+	var listened []os.Signal
+	for _, sig := range hook.signals {
+		if !isTerminating(sig) {
+			listened = append(listened, sig)
+		}
+	}
+
+	if len(listened) == 0 {
+		return
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, listened...)
+	defer signal.Stop(sigs)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-sigs:
+			log.Info().Stringer("signal", sig).Msg("the host is shutting down, stopping the Edge stacks")
+
+			hook.StopStacks(ctx)
+		}
+	}
+}
+
+// Handles returns true when the stacks must be stopped when the agent receives sig
+func (hook *Hook) Handles(sig os.Signal) bool {
+	if hook == nil {
+		return false
+	}
+
+	for _, s := range hook.signals {
+		if s == sig {
+			return true
+		}
+	}
+
+	return false
+}
+
+// StopStacks stops the containers of the Edge stacks, the containers depending on other containers first
+func (hook *Hook) StopStacks(ctx context.Context) {
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, hook.timeout)
+	defer cancel()
+
+	graph, err := hook.dependencyGraph(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("unable to retrieve the dependencies of the containers, the Edge stacks are left to the host")
+
+		return
+	}
+
+	waves := graph.StopOrder(func(node docker.DependencyNode) bool {
+		return strings.HasPrefix(node.Stack, edgeStackProjectPrefix)
+	})
+
+	start := time.Now()
+	stopped := 0
+
+	for _, wave := range waves {
+		stopTimeout := hook.stopTimeout
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < stopTimeout {
+			stopTimeout = time.Until(deadline)
+		}
+
+		var wg sync.WaitGroup
+		for _, node := range wave {
+			wg.Add(1)
+
+			go func(node docker.DependencyNode) {
+				defer wg.Done()
+
+				err := hook.stopContainer(ctx, node.ID, stopTimeout)
+				if err != nil {
+					log.Warn().Err(err).Str("container", node.Name).Str("stack", node.Stack).Msg("unable to stop the container")
+				}
+			}(node)
+		}
+		wg.Wait()
+
+		if ctx.Err() != nil {
+			log.Warn().Dur("timeout", hook.timeout).Msg("the Edge stacks could not be stopped before the shutdown timeout")
+
+			return
+		}
+
+		stopped += len(wave)
+	}
+
+	log.Info().Int("containers", stopped).Dur("duration", time.Since(start)).Msg("the Edge stacks are stopped")
+}
+
+func isTerminating(sig os.Signal) bool {
+	return sig == syscall.SIGINT || sig == syscall.SIGTERM
+}
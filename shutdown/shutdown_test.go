@@ -0,0 +1,107 @@
+package shutdown
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/portainer/agent/docker"
+)
+
+func TestNewHook(t *testing.T) {
+	hook, err := NewHook([]string{"sigterm", " INT"}, time.Second, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !hook.Handles(syscall.SIGTERM) || !hook.Handles(syscall.SIGINT) || hook.Handles(syscall.SIGHUP) {
+		t.Fatalf("unexpected signals %v", hook.signals)
+	}
+
+	if _, err := NewHook([]string{"HUP"}, time.Second, time.Minute); err == nil {
+		t.Fatal("expected an error for an unsupported signal")
+	}
+
+	var disabled *Hook
+	if disabled.Handles(syscall.SIGTERM) {
+		t.Fatal("expected a disabled hook to handle no signal")
+	}
+}
+
+func TestHook_StopStacks(t *testing.T) {
+	hook, _ := NewHook(nil, 10*time.Second, time.Minute)
+
+	hook.dependencyGraph = func(ctx context.Context) (*docker.DependencyGraph, error) {
+		return &docker.DependencyGraph{
+			Nodes: []docker.DependencyNode{
+				{ID: "web", Name: "shop-web-1", Stack: "edge_shop"},
+				{ID: "db", Name: "shop-db-1", Stack: "edge_shop"},
+				{ID: "agent", Name: "portainer_agent"},
+			},
+			Edges: []docker.DependencyEdge{
+				{From: "web", To: "db", Kind: docker.DependencyDependsOn},
+			},
+		}, nil
+	}
+
+	var (
+		stopped []string
+		mu      sync.Mutex
+	)
+
+	hook.stopContainer = func(ctx context.Context, id string, timeout time.Duration) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if timeout != 10*time.Second {
+			t.Errorf("unexpected stop timeout %s", timeout)
+		}
+
+		stopped = append(stopped, id)
+
+		return nil
+	}
+
+	hook.StopStacks(context.Background())
+
+	if !reflect.DeepEqual(stopped, []string{"web", "db"}) {
+		t.Fatalf("expected the containers of the Edge stacks to be stopped in dependency order, got %v", stopped)
+	}
+}
+
+func TestHook_StopStacks_Timeout(t *testing.T) {
+	hook, _ := NewHook(nil, 10*time.Second, 50*time.Millisecond)
+
+	hook.dependencyGraph = func(ctx context.Context) (*docker.DependencyGraph, error) {
+		return &docker.DependencyGraph{
+			Nodes: []docker.DependencyNode{
+				{ID: "web", Name: "shop-web-1", Stack: "edge_shop"},
+				{ID: "db", Name: "shop-db-1", Stack: "edge_shop"},
+			},
+			Edges: []docker.DependencyEdge{
+				{From: "web", To: "db", Kind: docker.DependencyDependsOn},
+			},
+		}, nil
+	}
+
+	var stopped []string
+	hook.stopContainer = func(ctx context.Context, id string, timeout time.Duration) error {
+		if timeout > 50*time.Millisecond {
+			t.Errorf("expected the stop timeout to be capped by the shutdown timeout, got %s", timeout)
+		}
+
+		stopped = append(stopped, id)
+		<-ctx.Done()
+
+		return ctx.Err()
+	}
+
+	hook.StopStacks(context.Background())
+
+	if !reflect.DeepEqual(stopped, []string{"web"}) {
+		t.Fatalf("expected the stop to be aborted after the timeout, got %v", stopped)
+	}
+}
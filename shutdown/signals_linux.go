@@ -0,0 +1,18 @@
+//go:build linux
+// +build linux
+
+package shutdown
+
+import (
+	"os"
+	"syscall"
+)
+
+// signals are the signals that can trigger the hook, by name without the SIG prefix
+var signals = map[string]os.Signal{
+	"PWR":  syscall.SIGPWR,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+	"INT":  syscall.SIGINT,
+	"TERM": syscall.SIGTERM,
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package shutdown
+
+import (
+	"os"
+	"syscall"
+)
+
+// signals are the signals that can trigger the hook, by name without the SIG prefix. SIGPWR is only available on
+// Linux.
+var signals = map[string]os.Signal{
+	"INT":  syscall.SIGINT,
+	"TERM": syscall.SIGTERM,
+}
@@ -0,0 +1,74 @@
+package smart
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Pre end of life states of an eMMC disk, from the consumption of its reserved blocks
+const (
+	preEOLNormal  = "normal"
+	preEOLWarning = "warning"
+	preEOLUrgent  = "urgent"
+)
+
+var preEOLStates = map[int64]string{
+	1: preEOLNormal,
+	2: preEOLWarning,
+	3: preEOLUrgent,
+}
+
+// readEMMC reads the health of an MMC disk from the sysfs folder of its device. The eMMC disks report their wear
+// estimation and their pre end of life state, the SD cards report no health attribute.
+func readEMMC(devicePath, name string) Disk {
+	disk := Disk{
+		Name:   name,
+		Model:  readString(filepath.Join(devicePath, "name")),
+		Serial: readString(filepath.Join(devicePath, "serial")),
+	}
+
+	if readString(filepath.Join(devicePath, "type")) == "SD" {
+		disk.Protocol = ProtocolSD
+		disk.Error = "the SD cards do not report their health"
+
+		return disk
+	}
+
+	disk.Protocol = ProtocolEMMC
+
+	// the estimations of the wear of the type A and B memories, in steps of 10%: 0x01 for 0-10% of the endurance
+	// used, up to 0x0B once the endurance is exceeded
+	lifeTime := strings.Fields(readString(filepath.Join(devicePath, "life_time")))
+	for _, estimation := range lifeTime {
+		value, err := strconv.ParseInt(estimation, 0, 64)
+		if err != nil || value == 0 {
+			continue
+		}
+
+		used := int(value) * 10
+		if disk.PercentageUsed == nil || used > *disk.PercentageUsed {
+			disk.PercentageUsed = &used
+		}
+	}
+
+	if value, err := strconv.ParseInt(readString(filepath.Join(devicePath, "pre_eol_info")), 0, 64); err == nil {
+		disk.PreEOL = preEOLStates[value]
+	}
+
+	if disk.PercentageUsed == nil && disk.PreEOL == "" {
+		disk.Error = "the eMMC disk does not report its health"
+	}
+
+	return disk
+}
+
+func readString(path string) string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(content))
+}
@@ -0,0 +1,264 @@
+package smart
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Protocols of the disks
+const (
+	ProtocolATA  = "ATA"
+	ProtocolNVMe = "NVMe"
+	ProtocolSCSI = "SCSI"
+	ProtocolEMMC = "eMMC"
+	ProtocolSD   = "SD"
+)
+
+const (
+	// statusCacheDuration is the duration during which the health of the disks is reused, each collection runs a
+	// container on the host
+	statusCacheDuration = time.Hour
+	// wornOutPercent is the estimated wear from which a disk is reported as failing
+	wornOutPercent = 90
+)
+
+var (
+	// hostRoot is where the host filesystem is mounted in the agent container
+	hostRoot = agent.HostRoot
+	// binaryPaths are the folders of the host searched for smartctl
+	binaryPaths = []string{"/usr/local/sbin", "/usr/local/bin", "/usr/sbin", "/usr/bin", "/sbin", "/bin"}
+
+	sysPath = "/sys"
+)
+
+// ignoredDevicePrefixes are the block devices that are not physical disks
+var ignoredDevicePrefixes = []string{"loop", "ram", "zram", "dm-", "md", "sr", "nbd", "fd"}
+
+var (
+	defaultService   *Service
+	defaultServiceMu sync.Mutex
+)
+
+// CommandRunner executes a command on the host and returns its output, which is returned along the error when the
+// command exits with a non-zero code
+type CommandRunner func(ctx context.Context, cmd []string) ([]byte, error)
+
+// Disk is a disk of the host and the SMART attributes revealing a failing drive
+type Disk struct {
+	Name     string `json:"Name"`
+	Model    string `json:"Model,omitempty"`
+	Serial   string `json:"Serial,omitempty"`
+	Protocol string `json:"Protocol,omitempty"`
+	// Passed is the overall health self-assessment of the disk, nil when it is not reported
+	Passed             *bool `json:"Passed,omitempty"`
+	TemperatureCelsius int   `json:"TemperatureCelsius,omitempty"`
+	PowerOnHours       int64 `json:"PowerOnHours,omitempty"`
+	// ReallocatedSectors, PendingSectors and UncorrectableSectors are reported by the ATA disks
+	ReallocatedSectors   int64 `json:"ReallocatedSectors,omitempty"`
+	PendingSectors       int64 `json:"PendingSectors,omitempty"`
+	UncorrectableSectors int64 `json:"UncorrectableSectors,omitempty"`
+	// MediaErrors and CriticalWarning are reported by the NVMe disks
+	MediaErrors     int64 `json:"MediaErrors,omitempty"`
+	CriticalWarning int   `json:"CriticalWarning,omitempty"`
+	// PercentageUsed is the estimated wear of the disk, above 100 once its endurance is exceeded, nil when it is
+	// not reported
+	PercentageUsed *int `json:"PercentageUsed,omitempty"`
+	// PreEOL is the pre end of life state of an eMMC disk: normal, warning or urgent
+	PreEOL   string   `json:"PreEOL,omitempty"`
+	Warnings []string `json:"Warnings,omitempty"`
+	// Error is the reason why the SMART attributes of the disk could not be read
+	Error string `json:"Error,omitempty"`
+}
+
+// Service reports the health of the disks of the host, read with smartctl for the ATA, SCSI and NVMe disks and from
+// the sysfs attributes of the eMMC disks
+type Service struct {
+	run       CommandRunner
+	mu        sync.Mutex
+	disks     []Disk
+	checkedAt time.Time
+}
+
+// NewService returns a pointer to a Service executing smartctl on the host with image, which must provide nsenter
+func NewService(image string) *Service {
+	return &Service{
+		run: func(ctx context.Context, cmd []string) ([]byte, error) {
+			var output bytes.Buffer
+			err := docker.ExecHostCommand(ctx, image, cmd, &output)
+
+			return output.Bytes(), err
+		},
+	}
+}
+
+// Status returns the health of the disks of the host, collected at most once per hour
+func (service *Service) Status(ctx context.Context) []Disk {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	if service.disks != nil && time.Since(service.checkedAt) < statusCacheDuration {
+		return service.disks
+	}
+
+	names, err := listDisks(filepath.Join(sysPath, "block"))
+	if err != nil {
+		log.Warn().Err(err).Msg("unable to list the disks of the host")
+
+		return nil
+	}
+
+	smartctl := installed("smartctl")
+
+	disks := []Disk{}
+	for _, name := range names {
+		var disk Disk
+
+		switch {
+		case strings.HasPrefix(name, "mmcblk"):
+			disk = readEMMC(filepath.Join(sysPath, "block", name, "device"), name)
+		case !smartctl:
+			disk = Disk{Name: name, Error: "smartctl is not installed on the host"}
+		default:
+			output, runErr := service.run(ctx, []string{"smartctl", "--json", "--all", "/dev/" + name})
+
+			// smartctl exits with a non-zero code when the disk is failing, the output is used when it is valid
+			disk, err = parseSmartctl(name, output)
+			if err != nil {
+				if runErr != nil {
+					err = fmt.Errorf("%w: %s", runErr, bytes.TrimSpace(output))
+				}
+
+				disk = Disk{Name: name, Error: err.Error()}
+			}
+		}
+
+		disk.Warnings = diskWarnings(disk)
+		disks = append(disks, disk)
+	}
+
+	service.disks = disks
+	service.checkedAt = time.Now()
+
+	return disks
+}
+
+// listDisks returns the block devices of the host that are physical disks, the partitions are not listed in
+// /sys/block
+func listDisks(blockPath string) ([]string, error) {
+	entries, err := os.ReadDir(blockPath)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+
+		ignored := strings.Contains(name, "boot") || strings.Contains(name, "rpmb")
+		for _, prefix := range ignoredDevicePrefixes {
+			ignored = ignored || strings.HasPrefix(name, prefix)
+		}
+
+		if !ignored {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func installed(binary string) bool {
+	for _, path := range binaryPaths {
+		if _, err := os.Stat(filepath.Join(hostRoot, path, binary)); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// diskWarnings returns the indicators of a failing disk
+func diskWarnings(disk Disk) []string {
+	var warnings []string
+
+	if disk.Passed != nil && !*disk.Passed {
+		warnings = append(warnings, "the SMART overall health self-assessment failed")
+	}
+
+	if disk.ReallocatedSectors > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d reallocated sectors", disk.ReallocatedSectors))
+	}
+
+	if disk.PendingSectors > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d sectors pending reallocation", disk.PendingSectors))
+	}
+
+	if disk.UncorrectableSectors > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d uncorrectable sectors", disk.UncorrectableSectors))
+	}
+
+	if disk.MediaErrors > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d media errors", disk.MediaErrors))
+	}
+
+	if disk.CriticalWarning != 0 {
+		warnings = append(warnings, fmt.Sprintf("critical warning 0x%02x reported by the controller", disk.CriticalWarning))
+	}
+
+	if disk.PercentageUsed != nil && *disk.PercentageUsed >= wornOutPercent {
+		warnings = append(warnings, fmt.Sprintf("%d%% of the endurance of the disk used", *disk.PercentageUsed))
+	}
+
+	if disk.PreEOL == preEOLWarning || disk.PreEOL == preEOLUrgent {
+		warnings = append(warnings, fmt.Sprintf("pre end of life state is %s, the reserved blocks are nearly consumed", disk.PreEOL))
+	}
+
+	return warnings
+}
+
+// Enable makes service the default service used by CurrentStatus
+func Enable(service *Service) {
+	defaultServiceMu.Lock()
+	defer defaultServiceMu.Unlock()
+
+	defaultService = service
+}
+
+// CurrentStatus returns the disks reported by the default service, nil when no service is enabled
+func CurrentStatus(ctx context.Context) []Disk {
+	defaultServiceMu.Lock()
+	service := defaultService
+	defaultServiceMu.Unlock()
+
+	if service == nil {
+		return nil
+	}
+
+	return service.Status(ctx)
+}
+
+// Diagnostics returns a diagnostic message for each failing indicator of the disks
+func Diagnostics(disks []Disk) []string {
+	var diagnostics []string
+	for _, disk := range disks {
+		for _, warning := range disk.Warnings {
+			diagnostics = append(diagnostics, fmt.Sprintf("disk %s may be failing: %s", disk.Name, warning))
+		}
+	}
+
+	return diagnostics
+}
@@ -0,0 +1,160 @@
+package smart
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseSmartctlATA(t *testing.T) {
+	output := `{
+  "smartctl": {"exit_status": 8},
+  "device": {"name": "/dev/sda", "type": "sat", "protocol": "ATA"},
+  "model_name": "WDC WD10EZEX",
+  "serial_number": "WD-1234",
+  "smart_status": {"passed": false},
+  "temperature": {"current": 41},
+  "power_on_time": {"hours": 35012},
+  "ata_smart_attributes": {"table": [
+    {"id": 5, "name": "Reallocated_Sector_Ct", "value": 180, "raw": {"value": 120}},
+    {"id": 9, "name": "Power_On_Hours", "value": 52, "raw": {"value": 35012}},
+    {"id": 197, "name": "Current_Pending_Sector", "value": 200, "raw": {"value": 8}},
+    {"id": 198, "name": "Offline_Uncorrectable", "value": 200, "raw": {"value": 0}}
+  ]}
+}`
+
+	disk, err := parseSmartctl("sda", []byte(output))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	passed := false
+	expected := Disk{
+		Name:               "sda",
+		Model:              "WDC WD10EZEX",
+		Serial:             "WD-1234",
+		Protocol:           ProtocolATA,
+		Passed:             &passed,
+		TemperatureCelsius: 41,
+		PowerOnHours:       35012,
+		ReallocatedSectors: 120,
+		PendingSectors:     8,
+	}
+	if !reflect.DeepEqual(disk, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, disk)
+	}
+
+	expectedWarnings := []string{
+		"the SMART overall health self-assessment failed",
+		"120 reallocated sectors",
+		"8 sectors pending reallocation",
+	}
+	if warnings := diskWarnings(disk); !reflect.DeepEqual(warnings, expectedWarnings) {
+		t.Fatalf("expected %v, got %v", expectedWarnings, warnings)
+	}
+}
+
+func TestParseSmartctlNVMe(t *testing.T) {
+	output := `{
+  "device": {"name": "/dev/nvme0n1", "type": "nvme", "protocol": "NVMe"},
+  "model_name": "Samsung SSD 970 EVO",
+  "smart_status": {"passed": true},
+  "nvme_smart_health_information_log": {"critical_warning": 4, "percentage_used": 93, "media_errors": 0}
+}`
+
+	disk, err := parseSmartctl("nvme0n1", []byte(output))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if disk.PercentageUsed == nil || *disk.PercentageUsed != 93 || disk.CriticalWarning != 4 {
+		t.Fatalf("unexpected NVMe health %+v", disk)
+	}
+
+	expectedWarnings := []string{
+		"critical warning 0x04 reported by the controller",
+		"93% of the endurance of the disk used",
+	}
+	if warnings := diskWarnings(disk); !reflect.DeepEqual(warnings, expectedWarnings) {
+		t.Fatalf("expected %v, got %v", expectedWarnings, warnings)
+	}
+}
+
+func TestParseSmartctlUnsupported(t *testing.T) {
+	output := `{"smartctl": {"messages": [{"string": "/dev/sdb: Unknown USB bridge", "severity": "error"}], "exit_status": 1}}`
+
+	disk, err := parseSmartctl("sdb", []byte(output))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if disk.Error != "/dev/sdb: Unknown USB bridge" || disk.Passed != nil {
+		t.Fatalf("unexpected disk %+v", disk)
+	}
+
+	if _, err := parseSmartctl("sdb", []byte("smartctl: command not found")); err == nil {
+		t.Fatal("expected an error for an output that is not JSON")
+	}
+}
+
+func TestReadEMMC(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFile(t, filepath.Join(dir, "emmc", "name"), "SEM16G\n")
+	writeFile(t, filepath.Join(dir, "emmc", "type"), "MMC\n")
+	writeFile(t, filepath.Join(dir, "emmc", "life_time"), "0x02 0x09\n")
+	writeFile(t, filepath.Join(dir, "emmc", "pre_eol_info"), "0x02\n")
+
+	disk := readEMMC(filepath.Join(dir, "emmc"), "mmcblk0")
+	if disk.Protocol != ProtocolEMMC || disk.PercentageUsed == nil || *disk.PercentageUsed != 90 || disk.PreEOL != preEOLWarning {
+		t.Fatalf("unexpected eMMC health %+v", disk)
+	}
+
+	expectedWarnings := []string{
+		"90% of the endurance of the disk used",
+		"pre end of life state is warning, the reserved blocks are nearly consumed",
+	}
+	if warnings := diskWarnings(disk); !reflect.DeepEqual(warnings, expectedWarnings) {
+		t.Fatalf("expected %v, got %v", expectedWarnings, warnings)
+	}
+
+	writeFile(t, filepath.Join(dir, "sd", "type"), "SD\n")
+
+	disk = readEMMC(filepath.Join(dir, "sd"), "mmcblk1")
+	if disk.Protocol != ProtocolSD || disk.Error == "" || len(diskWarnings(disk)) != 0 {
+		t.Fatalf("unexpected SD card health %+v", disk)
+	}
+}
+
+func TestListDisks(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{"sda", "nvme0n1", "mmcblk0", "mmcblk0boot0", "mmcblk0rpmb", "loop0", "dm-0", "zram0", "sr0"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	disks, err := listDisks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"mmcblk0", "nvme0n1", "sda"}
+	if !reflect.DeepEqual(disks, expected) {
+		t.Fatalf("expected %v, got %v", expected, disks)
+	}
+}
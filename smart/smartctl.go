@@ -0,0 +1,118 @@
+package smart
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ATA attributes revealing a failing disk
+const (
+	ataReallocatedSectors   = 5
+	ataPendingSectors       = 197
+	ataUncorrectableSectors = 198
+	// ataWearLevelingCount, ataSSDLifeLeft and ataMediaWearout report the remaining endurance of an SSD as their
+	// normalized value, from 100 to 0
+	ataWearLevelingCount = 177
+	ataSSDLifeLeft       = 231
+	ataMediaWearout      = 233
+)
+
+// smartctlOutput is the subset of the JSON output of smartctl --json --all used by the agent
+type smartctlOutput struct {
+	Smartctl struct {
+		Messages []struct {
+			String   string `json:"string"`
+			Severity string `json:"severity"`
+		} `json:"messages"`
+	} `json:"smartctl"`
+	Device struct {
+		Protocol string `json:"protocol"`
+	} `json:"device"`
+	ModelName    string `json:"model_name"`
+	SerialNumber string `json:"serial_number"`
+	SmartStatus  *struct {
+		Passed bool `json:"passed"`
+	} `json:"smart_status"`
+	Temperature struct {
+		Current int `json:"current"`
+	} `json:"temperature"`
+	PowerOnTime struct {
+		Hours int64 `json:"hours"`
+	} `json:"power_on_time"`
+	ATASmartAttributes struct {
+		Table []struct {
+			ID    int `json:"id"`
+			Value int `json:"value"`
+			Raw   struct {
+				Value int64 `json:"value"`
+			} `json:"raw"`
+		} `json:"table"`
+	} `json:"ata_smart_attributes"`
+	NVMeSmartHealthInformationLog *struct {
+		CriticalWarning int   `json:"critical_warning"`
+		PercentageUsed  int   `json:"percentage_used"`
+		MediaErrors     int64 `json:"media_errors"`
+	} `json:"nvme_smart_health_information_log"`
+}
+
+// parseSmartctl parses the JSON output of smartctl for the disk, an error is returned when the output is not JSON
+func parseSmartctl(name string, output []byte) (Disk, error) {
+	var result smartctlOutput
+	if err := json.Unmarshal(output, &result); err != nil {
+		return Disk{}, err
+	}
+
+	disk := Disk{
+		Name:               name,
+		Model:              result.ModelName,
+		Serial:             result.SerialNumber,
+		Protocol:           result.Device.Protocol,
+		TemperatureCelsius: result.Temperature.Current,
+		PowerOnHours:       result.PowerOnTime.Hours,
+	}
+
+	if result.SmartStatus == nil {
+		// the disk does not support SMART or cannot be opened, the reason is in the messages
+		failures := []string{}
+		for _, message := range result.Smartctl.Messages {
+			if message.Severity == "error" {
+				failures = append(failures, message.String)
+			}
+		}
+
+		disk.Error = strings.Join(failures, ", ")
+		if disk.Error == "" {
+			disk.Error = "the disk does not report its SMART health"
+		}
+
+		return disk, nil
+	}
+
+	passed := result.SmartStatus.Passed
+	disk.Passed = &passed
+
+	for _, attribute := range result.ATASmartAttributes.Table {
+		switch attribute.ID {
+		case ataReallocatedSectors:
+			disk.ReallocatedSectors = attribute.Raw.Value
+		case ataPendingSectors:
+			disk.PendingSectors = attribute.Raw.Value
+		case ataUncorrectableSectors:
+			disk.UncorrectableSectors = attribute.Raw.Value
+		case ataWearLevelingCount, ataSSDLifeLeft, ataMediaWearout:
+			if attribute.Value <= 100 {
+				used := 100 - attribute.Value
+				disk.PercentageUsed = &used
+			}
+		}
+	}
+
+	if health := result.NVMeSmartHealthInformationLog; health != nil {
+		used := health.PercentageUsed
+		disk.PercentageUsed = &used
+		disk.MediaErrors = health.MediaErrors
+		disk.CriticalWarning = health.CriticalWarning
+	}
+
+	return disk, nil
+}
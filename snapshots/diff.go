@@ -0,0 +1,361 @@
+package snapshots
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// settingFields are the fields of the engine information compared between two snapshots, the counters and the
+// clock of the engine change between every snapshot and are not compared
+var settingFields = []string{
+	"ServerVersion", "KernelVersion", "OperatingSystem", "OSVersion", "Architecture", "NCPU", "MemTotal", "Driver",
+	"CgroupDriver", "CgroupVersion", "LoggingDriver", "DefaultRuntime", "Runtimes", "LiveRestoreEnabled",
+	"SecurityOptions", "DockerRootDir", "HttpProxy", "HttpsProxy", "NoProxy", "RegistryConfig", "Swarm.LocalNodeState",
+	"Swarm.ControlAvailable", "Isolation", "InitBinary",
+}
+
+// Change is a field whose value differs between two snapshots
+type Change struct {
+	Field string `json:"Field"`
+	From  string `json:"From"`
+	To    string `json:"To"`
+}
+
+// ResourceChange lists the changed fields of a resource present in both snapshots
+type ResourceChange struct {
+	Name    string   `json:"Name"`
+	Changes []Change `json:"Changes"`
+}
+
+// Section lists the resources of a kind added, removed and changed between two snapshots
+type Section struct {
+	Added   []string         `json:"Added"`
+	Removed []string         `json:"Removed"`
+	Changed []ResourceChange `json:"Changed"`
+}
+
+// Diff lists the differences between two snapshots
+type Diff struct {
+	From       time.Time `json:"From"`
+	To         time.Time `json:"To"`
+	Containers Section   `json:"Containers"`
+	Images     Section   `json:"Images"`
+	Volumes    Section   `json:"Volumes"`
+	Networks   Section   `json:"Networks"`
+	Settings   []Change  `json:"Settings"`
+}
+
+// Compare returns the differences between two snapshots of the Docker environment. The snapshots are compared in
+// their JSON form, so that the anonymized snapshots can be compared as long as they were anonymized with the same
+// key. The replica form of the snapshots, which wraps the Docker snapshot, is accepted as well.
+func Compare(from, to json.RawMessage) (*Diff, error) {
+	fromSnapshot, err := decodeSnapshot(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot to compare from: %w", err)
+	}
+
+	toSnapshot, err := decodeSnapshot(to)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot to compare to: %w", err)
+	}
+
+	return &Diff{
+		From:       snapshotTime(fromSnapshot),
+		To:         snapshotTime(toSnapshot),
+		Containers: compareResources(containers(fromSnapshot), containers(toSnapshot)),
+		Images:     compareResources(images(fromSnapshot), images(toSnapshot)),
+		Volumes:    compareResources(volumes(fromSnapshot), volumes(toSnapshot)),
+		Networks:   compareResources(networks(fromSnapshot), networks(toSnapshot)),
+		Settings:   compareFields(settings(fromSnapshot), settings(toSnapshot)),
+	}, nil
+}
+
+func decodeSnapshot(data json.RawMessage) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var snapshot map[string]interface{}
+	if err := decoder.Decode(&snapshot); err != nil {
+		return nil, err
+	}
+
+	if _, ok := snapshot["DockerSnapshotRaw"]; !ok {
+		// the replica form of the snapshot
+		docker, ok := snapshot["docker"].(map[string]interface{})
+		if !ok {
+			return nil, errors.New("not a snapshot of a Docker environment")
+		}
+
+		snapshot = docker
+	}
+
+	return snapshot, nil
+}
+
+func snapshotTime(snapshot map[string]interface{}) time.Time {
+	if number, ok := snapshot["Time"].(json.Number); ok {
+		if unixTime, err := number.Int64(); err == nil {
+			return time.Unix(unixTime, 0)
+		}
+	}
+
+	return time.Time{}
+}
+
+// lookup returns the value at path, the dot separated keys of the nested objects
+func lookup(value interface{}, path string) interface{} {
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		value = object[key]
+	}
+
+	return value
+}
+
+func rawList(snapshot map[string]interface{}, path string) []interface{} {
+	list, _ := lookup(snapshot["DockerSnapshotRaw"], path).([]interface{})
+	return list
+}
+
+// containers returns the compared fields of the containers by name
+func containers(snapshot map[string]interface{}) map[string]map[string]string {
+	resources := map[string]map[string]string{}
+
+	for _, item := range rawList(snapshot, "Containers") {
+		container, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		name := format(container["Id"])
+		if names, ok := container["Names"].([]interface{}); ok && len(names) > 0 {
+			name = strings.TrimPrefix(format(names[0]), "/")
+		}
+
+		fields := map[string]string{}
+		for _, field := range []string{"Image", "ImageID", "State", "Command", "Ports", "Mounts", "HostConfig.NetworkMode"} {
+			fields[field] = format(lookup(container, field))
+		}
+
+		flattenMap(fields, "Labels", container["Labels"])
+		flattenMap(fields, "Env", envMap(container["Env"]))
+
+		if networks, ok := lookup(container, "NetworkSettings.Networks").(map[string]interface{}); ok {
+			// the addresses change when the containers restart, only the attached networks are compared
+			names := make([]string, 0, len(networks))
+			for name := range networks {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			fields["Networks"] = strings.Join(names, ", ")
+		}
+
+		resources[name] = fields
+	}
+
+	return resources
+}
+
+// images returns the identifier of the images by tag, the untagged images by identifier
+func images(snapshot map[string]interface{}) map[string]map[string]string {
+	resources := map[string]map[string]string{}
+
+	for _, item := range rawList(snapshot, "Images") {
+		image, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		id := format(image["Id"])
+
+		tags, _ := image["RepoTags"].([]interface{})
+		for _, tag := range tags {
+			if tag := format(tag); tag != "" && tag != "<none>:<none>" {
+				resources[tag] = map[string]string{"Id": id}
+			}
+		}
+
+		if len(tags) == 0 {
+			resources[id] = map[string]string{"Id": id}
+		}
+	}
+
+	return resources
+}
+
+func volumes(snapshot map[string]interface{}) map[string]map[string]string {
+	resources := map[string]map[string]string{}
+
+	for _, item := range rawList(snapshot, "Volumes.Volumes") {
+		volume, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		fields := map[string]string{"Driver": format(volume["Driver"])}
+		flattenMap(fields, "Labels", volume["Labels"])
+		flattenMap(fields, "Options", volume["Options"])
+
+		resources[format(volume["Name"])] = fields
+	}
+
+	return resources
+}
+
+func networks(snapshot map[string]interface{}) map[string]map[string]string {
+	resources := map[string]map[string]string{}
+
+	for _, item := range rawList(snapshot, "Networks") {
+		network, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		fields := map[string]string{}
+		for _, field := range []string{"Driver", "Scope", "Internal", "Attachable", "EnableIPv6", "IPAM"} {
+			fields[field] = format(network[field])
+		}
+		flattenMap(fields, "Labels", network["Labels"])
+		flattenMap(fields, "Options", network["Options"])
+
+		resources[format(network["Name"])] = fields
+	}
+
+	return resources
+}
+
+func settings(snapshot map[string]interface{}) map[string]string {
+	fields := map[string]string{
+		"DockerVersion": format(snapshot["DockerVersion"]),
+		"Swarm":         format(snapshot["Swarm"]),
+		"TotalCPU":      format(snapshot["TotalCPU"]),
+		"TotalMemory":   format(snapshot["TotalMemory"]),
+	}
+
+	info := lookup(snapshot, "DockerSnapshotRaw.Info")
+	for _, field := range settingFields {
+		fields["Info."+field] = format(lookup(info, field))
+	}
+
+	return fields
+}
+
+// envMap returns the environment variables as an object, the redacted and stripped values are compared as such
+func envMap(value interface{}) map[string]interface{} {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil
+	}
+
+	env := map[string]interface{}{}
+	for _, item := range list {
+		key, value, _ := strings.Cut(format(item), "=")
+		env[key] = value
+	}
+
+	return env
+}
+
+// flattenMap adds the entries of an object as the fields prefix.key
+func flattenMap(fields map[string]string, prefix string, value interface{}) {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	for key, v := range object {
+		fields[prefix+"."+key] = format(v)
+	}
+}
+
+// format returns the string form of a value of a snapshot, the objects and the lists are formatted as sorted JSON
+func format(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case bool:
+		if value {
+			return "true"
+		}
+
+		return "false"
+	case []interface{}:
+		items := make([]string, 0, len(value))
+		for _, item := range value {
+			items = append(items, format(item))
+		}
+		// the order of the lists of the Docker API is not stable
+		sort.Strings(items)
+
+		return strings.Join(items, ", ")
+	}
+
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+func compareResources(from, to map[string]map[string]string) Section {
+	section := Section{Added: []string{}, Removed: []string{}, Changed: []ResourceChange{}}
+
+	for name, fields := range to {
+		previous, ok := from[name]
+		if !ok {
+			section.Added = append(section.Added, name)
+			continue
+		}
+
+		if changes := compareFields(previous, fields); len(changes) > 0 {
+			section.Changed = append(section.Changed, ResourceChange{Name: name, Changes: changes})
+		}
+	}
+
+	for name := range from {
+		if _, ok := to[name]; !ok {
+			section.Removed = append(section.Removed, name)
+		}
+	}
+
+	sort.Strings(section.Added)
+	sort.Strings(section.Removed)
+	sort.Slice(section.Changed, func(i, j int) bool {
+		return section.Changed[i].Name < section.Changed[j].Name
+	})
+
+	return section
+}
+
+func compareFields(from, to map[string]string) []Change {
+	changes := []Change{}
+
+	for field, value := range to {
+		if from[field] != value {
+			changes = append(changes, Change{Field: field, From: from[field], To: value})
+		}
+	}
+
+	for field, value := range from {
+		if _, ok := to[field]; !ok && value != "" {
+			changes = append(changes, Change{Field: field, From: value})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+
+	return changes
+}
@@ -0,0 +1,122 @@
+package snapshots
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/portainer/agent/anonymize"
+)
+
+const fromSnapshot = `{
+	"Time": 1700000000,
+	"DockerVersion": "24.0.5",
+	"TotalCPU": 4,
+	"DockerSnapshotRaw": {
+		"Containers": [
+			{"Id": "a1", "Names": ["/web"], "Image": "nginx:1.25", "ImageID": "sha256:n1", "State": "running", "Labels": {"tier": "front"}, "Env": ["MODE=prod"], "NetworkSettings": {"Networks": {"bridge": {"IPAddress": "172.17.0.2"}}}},
+			{"Id": "b1", "Names": ["/db"], "Image": "postgres:15", "ImageID": "sha256:p1", "State": "running"}
+		],
+		"Images": [
+			{"Id": "sha256:n1", "RepoTags": ["nginx:1.25"]},
+			{"Id": "sha256:p1", "RepoTags": ["postgres:15"]}
+		],
+		"Volumes": {"Volumes": [{"Name": "data", "Driver": "local"}]},
+		"Networks": [{"Name": "bridge", "Driver": "bridge", "Scope": "local"}],
+		"Info": {"ServerVersion": "24.0.5", "Driver": "overlay2", "Containers": 2, "SystemTime": "2023-11-14T22:13:20Z", "Swarm": {"LocalNodeState": "inactive"}}
+	}
+}`
+
+const toSnapshot = `{
+	"createdAt": "2023-11-15T00:00:00Z",
+	"docker": {
+		"Time": 1700006400,
+		"DockerVersion": "24.0.7",
+		"TotalCPU": 4,
+		"DockerSnapshotRaw": {
+			"Containers": [
+				{"Id": "a2", "Names": ["/web"], "Image": "nginx:1.25", "ImageID": "sha256:n2", "State": "restarting", "Labels": {"tier": "front"}, "Env": ["MODE=debug"], "NetworkSettings": {"Networks": {"bridge": {"IPAddress": "172.17.0.3"}}}},
+				{"Id": "c1", "Names": ["/cache"], "Image": "redis:7", "ImageID": "sha256:r1", "State": "running"}
+			],
+			"Images": [
+				{"Id": "sha256:n2", "RepoTags": ["nginx:1.25"]},
+				{"Id": "sha256:p1", "RepoTags": ["postgres:15"]},
+				{"Id": "sha256:r1", "RepoTags": ["redis:7"]}
+			],
+			"Volumes": {"Volumes": [{"Name": "data", "Driver": "local"}]},
+			"Networks": [{"Name": "bridge", "Driver": "bridge", "Scope": "local"}],
+			"Info": {"ServerVersion": "24.0.7", "Driver": "overlay2", "Containers": 5, "SystemTime": "2023-11-15T00:00:00Z", "Swarm": {"LocalNodeState": "inactive"}}
+		}
+	}
+}`
+
+func TestCompare(t *testing.T) {
+	diff, err := Compare(json.RawMessage(fromSnapshot), json.RawMessage(toSnapshot))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff.From.Unix() != 1700000000 || diff.To.Unix() != 1700006400 {
+		t.Errorf("unexpected times %s and %s", diff.From, diff.To)
+	}
+
+	if !reflect.DeepEqual(diff.Containers.Added, []string{"cache"}) || !reflect.DeepEqual(diff.Containers.Removed, []string{"db"}) {
+		t.Errorf("unexpected added and removed containers %+v", diff.Containers)
+	}
+
+	expected := []ResourceChange{{Name: "web", Changes: []Change{
+		{Field: "Env.MODE", From: "prod", To: "debug"},
+		{Field: "ImageID", From: "sha256:n1", To: "sha256:n2"},
+		{Field: "State", From: "running", To: "restarting"},
+	}}}
+	if !reflect.DeepEqual(diff.Containers.Changed, expected) {
+		t.Errorf("unexpected changed containers %+v", diff.Containers.Changed)
+	}
+
+	if !reflect.DeepEqual(diff.Images.Added, []string{"redis:7"}) || len(diff.Images.Changed) != 1 || diff.Images.Changed[0].Name != "nginx:1.25" {
+		t.Errorf("unexpected images %+v", diff.Images)
+	}
+
+	if len(diff.Volumes.Added)+len(diff.Volumes.Removed)+len(diff.Volumes.Changed) != 0 || len(diff.Networks.Changed) != 0 {
+		t.Errorf("expected the volumes and the networks to be unchanged, got %+v and %+v", diff.Volumes, diff.Networks)
+	}
+
+	expectedSettings := []Change{
+		{Field: "DockerVersion", From: "24.0.5", To: "24.0.7"},
+		{Field: "Info.ServerVersion", From: "24.0.5", To: "24.0.7"},
+	}
+	if !reflect.DeepEqual(diff.Settings, expectedSettings) {
+		t.Errorf("unexpected settings %+v", diff.Settings)
+	}
+}
+
+func TestCompareAnonymized(t *testing.T) {
+	var from, to interface{}
+	json.Unmarshal([]byte(fromSnapshot), &from)
+	json.Unmarshal([]byte(toSnapshot), &to)
+
+	anonymizedFrom, err := anonymize.NewWithKey([]byte("shared")).Anonymize(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	anonymizedTo, err := anonymize.NewWithKey([]byte("shared")).Anonymize(to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := Compare(anonymizedFrom, anonymizedTo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(diff.Containers.Added) != 1 || len(diff.Containers.Removed) != 1 || len(diff.Containers.Changed) != 1 {
+		t.Errorf("expected the containers to be matched by their hashed name, got %+v", diff.Containers)
+	}
+}
+
+func TestCompareInvalid(t *testing.T) {
+	if _, err := Compare(json.RawMessage(`{"kubernetes": {}}`), json.RawMessage(toSnapshot)); err == nil {
+		t.Error("expected an error for a snapshot that is not a Docker snapshot")
+	}
+}
@@ -0,0 +1,238 @@
+// Package snapshots keeps a history of the snapshots of the Docker environment on the device and compares them, e.g.
+// the current snapshot with the one taken before an outage, or with the anonymized snapshot of another device.
+package snapshots
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	portainer "github.com/portainer/portainer/api"
+	"github.com/rs/zerolog/log"
+)
+
+// FileExtension is the extension of the files of the stored snapshots
+const FileExtension = ".json.gz"
+
+var (
+	// ErrDisabled is returned when the history of the snapshots is not enabled
+	ErrDisabled = errors.New("the history of the snapshots is disabled")
+	// ErrNotFound is returned when no stored snapshot matches
+	ErrNotFound = errors.New("no stored snapshot matches")
+)
+
+var (
+	defaultStore   *Store
+	defaultStoreMu sync.Mutex
+)
+
+// Entry is a stored snapshot, identified by the Unix time at which it was taken
+type Entry struct {
+	ID        string    `json:"ID"`
+	CreatedAt time.Time `json:"CreatedAt"`
+	Size      int64     `json:"Size"`
+}
+
+// Store persists the snapshots in a folder, the snapshots are removed by the snapshots retention policy
+type Store struct {
+	dir    string
+	create func(ctx context.Context) (*portainer.DockerSnapshot, error)
+	mu     sync.Mutex
+}
+
+// NewStore returns a pointer to a Store persisting the snapshots created with create inside dir
+func NewStore(dir string, create func(ctx context.Context) (*portainer.DockerSnapshot, error)) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &Store{dir: dir, create: create}, nil
+}
+
+// Run records a snapshot every interval until ctx is done
+func (store *Store) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := store.Record(ctx); err != nil {
+			log.Warn().Err(err).Msg("unable to record the snapshot of the environment")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Record creates a snapshot and stores it
+func (store *Store) Record(ctx context.Context) (*Entry, error) {
+	snapshot, err := store.Current(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	createdAt := time.Unix(snapshot.Time, 0)
+	path := filepath.Join(store.dir, strconv.FormatInt(snapshot.Time, 10)+FileExtension)
+
+	f, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	writer := gzip.NewWriter(f)
+	if err := json.NewEncoder(writer).Encode(snapshot); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Entry{ID: strconv.FormatInt(snapshot.Time, 10), CreatedAt: createdAt, Size: info.Size()}, nil
+}
+
+// Current creates a snapshot of the environment
+func (store *Store) Current(ctx context.Context) (*portainer.DockerSnapshot, error) {
+	snapshot, err := store.create(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if snapshot.Time == 0 {
+		snapshot.Time = time.Now().Unix()
+	}
+
+	return snapshot, nil
+}
+
+// List returns the stored snapshots, the most recent first
+func (store *Store) List() []Entry {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return store.list()
+}
+
+func (store *Store) list() []Entry {
+	files, err := os.ReadDir(store.dir)
+	if err != nil {
+		return nil
+	}
+
+	entries := []Entry{}
+	for _, file := range files {
+		id, found := strings.CutSuffix(file.Name(), FileExtension)
+		if !found {
+			continue
+		}
+
+		unixTime, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+
+		entries = append(entries, Entry{ID: id, CreatedAt: time.Unix(unixTime, 0), Size: info.Size()})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.After(entries[j].CreatedAt)
+	})
+
+	return entries
+}
+
+// Before returns the most recent stored snapshot taken at or before t
+func (store *Store) Before(t time.Time) (*Entry, error) {
+	for _, entry := range store.List() {
+		if !entry.CreatedAt.After(t) {
+			return &entry, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// Load returns the stored snapshot identified by id
+func (store *Store) Load(id string) (json.RawMessage, error) {
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		return nil, ErrNotFound
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	f, err := os.Open(filepath.Join(store.dir, id+FileExtension))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the snapshot %s: %w", id, err)
+	}
+
+	var snapshot json.RawMessage
+	if err := json.NewDecoder(reader).Decode(&snapshot); err != nil {
+		return nil, fmt.Errorf("unable to read the snapshot %s: %w", id, err)
+	}
+
+	return snapshot, nil
+}
+
+// Enable makes store the default store returned by DefaultStore
+func Enable(store *Store) {
+	defaultStoreMu.Lock()
+	defer defaultStoreMu.Unlock()
+
+	defaultStore = store
+}
+
+// DefaultStore returns the default store, ErrDisabled when the history of the snapshots is not enabled
+func DefaultStore() (*Store, error) {
+	defaultStoreMu.Lock()
+	defer defaultStoreMu.Unlock()
+
+	if defaultStore == nil {
+		return nil, ErrDisabled
+	}
+
+	return defaultStore, nil
+}
@@ -0,0 +1,68 @@
+package snapshots
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	portainer "github.com/portainer/portainer/api"
+)
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now().Unix()
+
+	next := now - 3600
+	store, err := NewStore(dir, func(ctx context.Context) (*portainer.DockerSnapshot, error) {
+		return &portainer.DockerSnapshot{Time: next, DockerVersion: "24.0.7"}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the files that are not snapshots are ignored
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Record(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	next = now
+	if _, err := store.Record(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := store.List()
+	if len(entries) != 2 || entries[0].CreatedAt.Unix() != now {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+
+	entry, err := store.Before(time.Unix(now-60, 0))
+	if err != nil || entry.CreatedAt.Unix() != now-3600 {
+		t.Fatalf("unexpected snapshot before %d: %+v, %v", now-60, entry, err)
+	}
+
+	if _, err := store.Before(time.Unix(now-7200, 0)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected no snapshot before the first one, got %v", err)
+	}
+
+	snapshot, err := store.Load(entry.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stored portainer.DockerSnapshot
+	if err := json.Unmarshal(snapshot, &stored); err != nil || stored.Time != now-3600 || stored.DockerVersion != "24.0.7" {
+		t.Errorf("unexpected stored snapshot %s, %v", snapshot, err)
+	}
+
+	if _, err := store.Load("../secret"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected an invalid identifier to be refused, got %v", err)
+	}
+}
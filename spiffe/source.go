@@ -0,0 +1,123 @@
+package spiffe
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 30 * time.Second
+)
+
+// X509Source keeps the X509 SVID of the agent up to date by watching the SPIFFE Workload API. The SVIDs are
+// rotated by the SPIRE agent before they expire.
+type X509Source struct {
+	client *workloadClient
+	svid   *X509SVID
+	ready  chan struct{}
+	once   sync.Once
+	mu     sync.RWMutex
+}
+
+// NewX509Source connects to the Workload API served on socketAddr and waits for the first SVID up to timeout
+func NewX509Source(ctx context.Context, socketAddr string, timeout time.Duration) (*X509Source, error) {
+	source := &X509Source{
+		client: newWorkloadClient(socketAddr),
+		ready:  make(chan struct{}),
+	}
+
+	go source.watch(ctx)
+
+	select {
+	case <-source.ready:
+		log.Info().Str("spiffe_id", source.ID()).Msg("X509 SVID retrieved from the Workload API")
+
+		return source, nil
+	case <-time.After(timeout):
+		return nil, errors.New("timed out waiting for an X509 SVID from the Workload API")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (source *X509Source) watch(ctx context.Context) {
+	delay := minReconnectDelay
+
+	for {
+		err := source.client.watchX509SVID(ctx, source.update)
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Warn().Err(err).Dur("retry_in", delay).Msg("lost the connection to the Workload API")
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+func (source *X509Source) update(svid *X509SVID) {
+	source.mu.Lock()
+	source.svid = svid
+	source.mu.Unlock()
+
+	log.Debug().
+		Str("spiffe_id", svid.ID).
+		Time("expires_at", svid.Certificates[0].NotAfter).
+		Msg("X509 SVID updated")
+
+	source.once.Do(func() { close(source.ready) })
+}
+
+// ID returns the SPIFFE ID of the agent
+func (source *X509Source) ID() string {
+	source.mu.RLock()
+	defer source.mu.RUnlock()
+
+	return source.svid.ID
+}
+
+// GetCertificate returns the current SVID as a TLS certificate
+func (source *X509Source) GetCertificate() (*tls.Certificate, error) {
+	source.mu.RLock()
+	defer source.mu.RUnlock()
+
+	certificate := &tls.Certificate{
+		PrivateKey: source.svid.PrivateKey,
+		Leaf:       source.svid.Certificates[0],
+	}
+
+	for _, cert := range source.svid.Certificates {
+		certificate.Certificate = append(certificate.Certificate, cert.Raw)
+	}
+
+	return certificate, nil
+}
+
+// Bundle returns the current trust bundle of the trust domain of the agent
+func (source *X509Source) Bundle() *x509.CertPool {
+	source.mu.RLock()
+	defer source.mu.RUnlock()
+
+	pool := x509.NewCertPool()
+	for _, cert := range source.svid.Bundle {
+		pool.AddCert(cert)
+	}
+
+	return pool
+}
@@ -0,0 +1,236 @@
+package spiffe
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	fetchX509SVIDURL       = "http://localhost/SpiffeWorkloadAPI/FetchX509SVID"
+	workloadHeaderName     = "workload.spiffe.io"
+	grpcMessageHeaderSize  = 5
+	maxWorkloadMessageSize = 4 * 1024 * 1024
+)
+
+// X509SVID is an X509 SPIFFE Verifiable Identity Document
+type X509SVID struct {
+	ID           string
+	Certificates []*x509.Certificate
+	PrivateKey   crypto.Signer
+	Bundle       []*x509.Certificate
+}
+
+// workloadClient is a minimal client of the SPIFFE Workload API, served by the SPIRE agent over gRPC on a Unix socket
+type workloadClient struct {
+	httpClient *http.Client
+}
+
+// newWorkloadClient returns a client of the Workload API listening on socketAddr, using the SPIFFE_ENDPOINT_SOCKET
+// format (unix:///path/to/socket) or a plain socket path
+func newWorkloadClient(socketAddr string) *workloadClient {
+	socketPath := strings.TrimPrefix(socketAddr, "unix://")
+
+	transport := &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socketPath)
+		},
+	}
+
+	return &workloadClient{httpClient: &http.Client{Transport: transport}}
+}
+
+// watchX509SVID streams the X509 SVIDs of the workload, onUpdate is called each time the SPIRE agent sends a new
+// SVID (e.g. after a rotation). It returns when the stream ends or ctx is cancelled.
+func (client *workloadClient) watchX509SVID(ctx context.Context, onUpdate func(*X509SVID)) error {
+	// Empty X509SVIDRequest message
+	body := make([]byte, grpcMessageHeaderSize)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fetchX509SVIDURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	req.Header.Set(workloadHeaderName, "true")
+
+	resp, err := client.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected Workload API response status: %d", resp.StatusCode)
+	}
+
+	if err := grpcStatusError(resp.Header); err != nil {
+		return err
+	}
+
+	for {
+		message, err := readGRPCMessage(resp.Body)
+		if err == io.EOF {
+			if err := grpcStatusError(resp.Trailer); err != nil {
+				return err
+			}
+
+			return errors.New("the Workload API stream was closed")
+		}
+
+		if err != nil {
+			return err
+		}
+
+		svid, err := parseX509SVIDResponse(message)
+		if err != nil {
+			return err
+		}
+
+		onUpdate(svid)
+	}
+}
+
+func grpcStatusError(header http.Header) error {
+	status := header.Get("Grpc-Status")
+	if status == "" || status == "0" {
+		return nil
+	}
+
+	return fmt.Errorf("Workload API error (status %s): %s", status, header.Get("Grpc-Message"))
+}
+
+func readGRPCMessage(r io.Reader) ([]byte, error) {
+	header := make([]byte, grpcMessageHeaderSize)
+
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, err
+	}
+
+	if header[0] != 0 {
+		return nil, errors.New("compressed Workload API messages are not supported")
+	}
+
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxWorkloadMessageSize {
+		return nil, fmt.Errorf("Workload API message too large: %d bytes", size)
+	}
+
+	message := make([]byte, size)
+
+	_, err = io.ReadFull(r, message)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return message, err
+}
+
+// parseX509SVIDResponse parses a X509SVIDResponse message and returns its first SVID, which is the default
+// identity of the workload
+func parseX509SVIDResponse(message []byte) (*X509SVID, error) {
+	for len(message) > 0 {
+		num, typ, n := protowire.ConsumeTag(message)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		message = message[n:]
+
+		if num == 1 && typ == protowire.BytesType {
+			value, n := protowire.ConsumeBytes(message)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+
+			return parseX509SVID(value)
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, message)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		message = message[n:]
+	}
+
+	return nil, errors.New("no SVID in the Workload API response")
+}
+
+func parseX509SVID(message []byte) (*X509SVID, error) {
+	svid := &X509SVID{}
+
+	var key []byte
+
+	for len(message) > 0 {
+		num, typ, n := protowire.ConsumeTag(message)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		message = message[n:]
+
+		if typ != protowire.BytesType || num < 1 || num > 4 {
+			n = protowire.ConsumeFieldValue(num, typ, message)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			message = message[n:]
+
+			continue
+		}
+
+		value, n := protowire.ConsumeBytes(message)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		message = message[n:]
+
+		var err error
+		switch num {
+		case 1:
+			svid.ID = string(value)
+		case 2:
+			svid.Certificates, err = x509.ParseCertificates(value)
+		case 3:
+			key = value
+		case 4:
+			svid.Bundle, err = x509.ParseCertificates(value)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(svid.Certificates) == 0 || len(key) == 0 {
+		return nil, errors.New("incomplete SVID in the Workload API response")
+	}
+
+	privateKey, err := x509.ParsePKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported SVID private key")
+	}
+
+	svid.PrivateKey = signer
+
+	return svid, nil
+}
@@ -0,0 +1,164 @@
+package stacklock
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// States of an operation on a stack
+const (
+	// StateWaiting is the state of an operation waiting for another operation on the same stack to finish
+	StateWaiting = "waiting"
+	// StateQueued is the state of an operation holding the lock of its stack and waiting for a deployment slot
+	StateQueued = "queued"
+	// StateRunning is the state of an operation being executed
+	StateRunning = "running"
+)
+
+// DefaultConcurrency is the default maximum number of operations executed at the same time on different stacks
+const DefaultConcurrency = 1
+
+var defaultLocker = NewLocker(DefaultConcurrency)
+
+// Lock represents an operation on a stack, running or waiting to run
+type Lock struct {
+	Stack     string    `json:"Stack"`
+	Operation string    `json:"Operation"`
+	State     string    `json:"State"`
+	Since     time.Time `json:"Since"`
+}
+
+// Locker serializes the operations on each stack, so that the deployments, updates and removals requested by the
+// server, the Edge stack manager and the agent API cannot interleave, and limits the number of operations executed
+// at the same time on different stacks. The operations waiting for a stack or a slot are served in arrival order.
+type Locker struct {
+	slots chan struct{}
+
+	mu     sync.Mutex
+	stacks map[string]chan struct{}
+	locks  map[*Lock]struct{}
+}
+
+// NewLocker returns a pointer to a Locker running at most concurrency operations at the same time
+func NewLocker(concurrency int) *Locker {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	return &Locker{
+		slots:  make(chan struct{}, concurrency),
+		stacks: map[string]chan struct{}{},
+		locks:  map[*Lock]struct{}{},
+	}
+}
+
+// Acquire waits until operation can be executed on stack, or until ctx is done. The returned function must be
+// called once the operation is done.
+func (locker *Locker) Acquire(ctx context.Context, stack, operation string) (func(), error) {
+	lock := &Lock{Stack: stack, Operation: operation, State: StateWaiting, Since: time.Now()}
+
+	locker.mu.Lock()
+	stackLock, ok := locker.stacks[stack]
+	if !ok {
+		stackLock = make(chan struct{}, 1)
+		locker.stacks[stack] = stackLock
+	}
+	locker.locks[lock] = struct{}{}
+	locker.mu.Unlock()
+
+	select {
+	case stackLock <- struct{}{}:
+	case <-ctx.Done():
+		locker.remove(lock)
+
+		return nil, ctx.Err()
+	}
+
+	locker.setState(lock, StateQueued)
+
+	select {
+	case locker.slots <- struct{}{}:
+	case <-ctx.Done():
+		<-stackLock
+		locker.remove(lock)
+
+		return nil, ctx.Err()
+	}
+
+	locker.setState(lock, StateRunning)
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			<-locker.slots
+			<-stackLock
+			locker.remove(lock)
+		})
+	}, nil
+}
+
+// Locks returns the operations running or waiting to run, the oldest first
+func (locker *Locker) Locks() []Lock {
+	locker.mu.Lock()
+	defer locker.mu.Unlock()
+
+	locks := make([]Lock, 0, len(locker.locks))
+	for lock := range locker.locks {
+		locks = append(locks, *lock)
+	}
+
+	sort.Slice(locks, func(i, j int) bool {
+		return locks[i].Since.Before(locks[j].Since)
+	})
+
+	return locks
+}
+
+func (locker *Locker) setState(lock *Lock, state string) {
+	locker.mu.Lock()
+	defer locker.mu.Unlock()
+
+	lock.State = state
+}
+
+func (locker *Locker) remove(lock *Lock) {
+	locker.mu.Lock()
+	defer locker.mu.Unlock()
+
+	delete(locker.locks, lock)
+
+	if !locker.stackInUse(lock.Stack) {
+		delete(locker.stacks, lock.Stack)
+	}
+}
+
+// stackInUse returns true when an operation on stack is running or waiting to run, the lock must be held
+func (locker *Locker) stackInUse(stack string) bool {
+	for lock := range locker.locks {
+		if lock.Stack == stack {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetConcurrency replaces the default Locker with a Locker running at most concurrency operations at the same time,
+// it must be called before any operation is executed
+func SetConcurrency(concurrency int) {
+	defaultLocker = NewLocker(concurrency)
+}
+
+// Acquire waits until operation can be executed on stack with the default Locker, or until ctx is done. The returned
+// function must be called once the operation is done.
+func Acquire(ctx context.Context, stack, operation string) (func(), error) {
+	return defaultLocker.Acquire(ctx, stack, operation)
+}
+
+// Locks returns the operations running or waiting to run on the default Locker
+func Locks() []Lock {
+	return defaultLocker.Locks()
+}
@@ -0,0 +1,87 @@
+package stacklock
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAcquireSerializesTheOperationsOnAStack(t *testing.T) {
+	locker := NewLocker(2)
+
+	release, err := locker.Acquire(context.Background(), "web", "deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan func())
+	go func() {
+		release, err := locker.Acquire(context.Background(), "web", "remove")
+		if err != nil {
+			t.Error(err)
+		}
+
+		acquired <- release
+	}()
+
+	// Another stack is not blocked while a slot is available
+	releaseOther, err := locker.Acquire(context.Background(), "db", "deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseOther()
+
+	select {
+	case <-acquired:
+		t.Fatal("the second operation on the stack must wait for the first one")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	locks := locker.Locks()
+	if len(locks) != 2 || locks[0].State != StateRunning || locks[1].State != StateWaiting || locks[1].Operation != "remove" {
+		t.Fatalf("unexpected locks: %+v", locks)
+	}
+
+	release()
+
+	select {
+	case release := <-acquired:
+		release()
+	case <-time.After(time.Second):
+		t.Fatal("the second operation on the stack must run once the first one is done")
+	}
+
+	if locks := locker.Locks(); len(locks) != 0 {
+		t.Errorf("expected no lock, got %+v", locks)
+	}
+}
+
+func TestAcquireQueuesTheOperationsBeyondTheConcurrency(t *testing.T) {
+	locker := NewLocker(1)
+
+	release, err := locker.Acquire(context.Background(), "web", "deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+
+		locks := locker.Locks()
+		if len(locks) != 2 || locks[1].State != StateQueued {
+			t.Errorf("expected the second operation to be queued, got %+v", locks)
+		}
+	}()
+
+	if _, err := locker.Acquire(ctx, "db", "deploy"); err != context.DeadlineExceeded {
+		t.Fatalf("expected the operation to wait for a slot, got %v", err)
+	}
+
+	if locks := locker.Locks(); len(locks) != 1 {
+		t.Errorf("expected the cancelled operation to be removed, got %+v", locks)
+	}
+}
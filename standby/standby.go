@@ -0,0 +1,223 @@
+package standby
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// missedHeartbeats is the number of consecutive heartbeats the primary instance fails to answer before the standby
+// instance takes over
+const missedHeartbeats = 3
+
+// heartbeatPrefix starts the answer of the primary instance to a heartbeat
+const heartbeatPrefix = "alive"
+
+// heartbeatInterval is the interval between two heartbeats sent by the standby instance, it is also the maximum
+// duration the primary instance has to answer a heartbeat
+var heartbeatInterval = 2 * time.Second
+
+// Primary is the instance of a warm standby pair owning the listener, the tunnel and the Edge identity of the agent.
+// It answers the heartbeats of the standby instance on the shared socket.
+type Primary struct {
+	socketPath string
+	listener   *net.UnixListener
+	socketInfo os.FileInfo
+	fenced     chan struct{}
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+// Acquire returns once this instance is the primary instance of the pair. When another instance answers the
+// heartbeats on socketPath, this instance stands by until the other instance misses missedHeartbeats consecutive
+// heartbeats. The socket is then taken over and served by this instance.
+func Acquire(ctx context.Context, socketPath string) (*Primary, error) {
+	standingBy := false
+	missed := 0
+
+	for {
+		err := heartbeat(socketPath, heartbeatInterval)
+
+		switch {
+		case err == nil:
+			if !standingBy {
+				log.Info().Str("socket", socketPath).Msg("another agent instance is the primary, standing by")
+			}
+
+			standingBy = true
+			missed = 0
+		case !standingBy:
+			// no instance answered since this instance started, there is no primary to wait for
+			return listen(socketPath)
+		default:
+			missed++
+
+			log.Warn().Err(err).Int("missed_heartbeats", missed).Msg("the primary agent instance missed a heartbeat")
+
+			if missed >= missedHeartbeats {
+				log.Info().Str("socket", socketPath).Msg("the primary agent instance stopped answering, taking over")
+
+				return listen(socketPath)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(heartbeatInterval):
+		}
+	}
+}
+
+// heartbeat connects to the socket of the primary instance and waits for its answer
+func heartbeat(socketPath string, timeout time.Duration) error {
+	conn, err := net.DialTimeout("unix", socketPath, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+
+	if !strings.HasPrefix(line, heartbeatPrefix) {
+		return fmt.Errorf("unexpected heartbeat answer: %q", strings.TrimSpace(line))
+	}
+
+	return nil
+}
+
+// listen replaces the socket left by a previous primary instance and serves the heartbeats on it
+func listen(socketPath string) (*Primary, error) {
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0700); err != nil {
+		return nil, err
+	}
+
+	if err := os.Remove(socketPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: socketPath, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+
+	// the socket is removed on close only when it was not taken over by another instance
+	listener.SetUnlinkOnClose(false)
+
+	info, err := os.Stat(socketPath)
+	if err != nil {
+		listener.Close()
+
+		return nil, err
+	}
+
+	primary := &Primary{
+		socketPath: socketPath,
+		listener:   listener,
+		socketInfo: info,
+		fenced:     make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+
+	go primary.serve()
+	go primary.watch()
+
+	log.Info().Str("socket", socketPath).Msg("serving the heartbeats of the primary agent instance")
+
+	return primary, nil
+}
+
+func (primary *Primary) serve() {
+	for {
+		conn, err := primary.listener.Accept()
+		if err != nil {
+			select {
+			case <-primary.done:
+				return
+			default:
+			}
+
+			log.Debug().Err(err).Msg("unable to accept a heartbeat")
+
+			continue
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(heartbeatInterval))
+		fmt.Fprintf(conn, "%s %d\n", heartbeatPrefix, os.Getpid())
+		conn.Close()
+	}
+}
+
+// watch fences this instance when the socket is replaced, which happens when the standby instance took over
+// because this instance did not answer in time
+func (primary *Primary) watch() {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-primary.done:
+			return
+		case <-ticker.C:
+		}
+
+		if primary.owned() {
+			continue
+		}
+
+		log.Warn().Str("socket", primary.socketPath).Msg("the heartbeat socket was taken over by another agent instance")
+
+		close(primary.fenced)
+
+		return
+	}
+}
+
+func (primary *Primary) owned() bool {
+	info, err := os.Stat(primary.socketPath)
+
+	return err == nil && os.SameFile(info, primary.socketInfo)
+}
+
+// Fenced is closed when another instance took over, this instance must stop using the listener, the tunnel and the
+// Edge identity of the agent
+func (primary *Primary) Fenced() <-chan struct{} {
+	return primary.fenced
+}
+
+// Close stops answering the heartbeats, the standby instance takes over once it misses enough heartbeats
+func (primary *Primary) Close() error {
+	var err error
+
+	primary.closeOnce.Do(func() {
+		close(primary.done)
+
+		owned := primary.owned()
+
+		err = primary.listener.Close()
+
+		if owned {
+			if removeErr := os.Remove(primary.socketPath); removeErr != nil && !errors.Is(removeErr, os.ErrNotExist) && err == nil {
+				err = removeErr
+			}
+		}
+	})
+
+	return err
+}
@@ -0,0 +1,95 @@
+package standby
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	heartbeatInterval = 20 * time.Millisecond
+
+	os.Exit(m.Run())
+}
+
+func TestAcquire(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "ha.sock")
+
+	primary, err := Acquire(context.Background(), socketPath)
+	if err != nil {
+		t.Fatalf("unable to acquire the primary role without primary: %s", err)
+	}
+
+	if err := heartbeat(socketPath, heartbeatInterval); err != nil {
+		t.Fatalf("the primary does not answer the heartbeats: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*heartbeatInterval)
+	defer cancel()
+
+	if _, err := Acquire(ctx, socketPath); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the second instance to stand by, got %v", err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() {
+		secondary, err := Acquire(context.Background(), socketPath)
+		if err == nil {
+			secondary.Close()
+		}
+
+		acquired <- err
+	}()
+
+	time.Sleep(2 * heartbeatInterval)
+
+	if err := primary.Close(); err != nil {
+		t.Fatalf("unable to close the primary: %s", err)
+	}
+
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("unable to take over: %s", err)
+		}
+	case <-time.After(20 * heartbeatInterval):
+		t.Fatal("the standby instance did not take over")
+	}
+}
+
+func TestFenced(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "ha.sock")
+
+	primary, err := Acquire(context.Background(), socketPath)
+	if err != nil {
+		t.Fatalf("unable to acquire the primary role: %s", err)
+	}
+
+	// a standby instance taking over replaces the socket
+	if err := os.Remove(socketPath); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := listen(socketPath)
+	if err != nil {
+		t.Fatalf("unable to take over the socket: %s", err)
+	}
+	defer other.Close()
+
+	select {
+	case <-primary.Fenced():
+	case <-time.After(20 * heartbeatInterval):
+		t.Fatal("the primary was not fenced")
+	}
+
+	if err := primary.Close(); err != nil {
+		t.Fatalf("unable to close the fenced primary: %s", err)
+	}
+
+	if _, err := os.Stat(socketPath); err != nil {
+		t.Fatalf("the fenced primary removed the socket of the new primary: %s", err)
+	}
+}
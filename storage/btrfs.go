@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/portainer/agent/docker"
+)
+
+// btrfsNoOperation is the content of the exclusive_operation file when no operation is in progress
+const btrfsNoOperation = "none"
+
+// collectBtrfs reports the btrfs filesystems of the host, read from their sysfs folder: the device errors, which
+// reveal failing disks, the exclusive operation in progress and the allocation of the data chunks
+func collectBtrfs(ctx context.Context, driver docker.StorageDriver, report *Report) error {
+	filesystems, err := readBtrfsFilesystems(filepath.Join(sysPath, "fs", "btrfs"))
+	if err != nil {
+		return err
+	}
+
+	report.BtrfsFilesystems = filesystems
+	report.Warnings = append(report.Warnings, btrfsWarnings(filesystems)...)
+
+	return nil
+}
+
+func readBtrfsFilesystems(btrfsPath string) ([]BtrfsFilesystem, error) {
+	entries, err := os.ReadDir(btrfsPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return []BtrfsFilesystem{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	filesystems := []BtrfsFilesystem{}
+	for _, entry := range entries {
+		path := filepath.Join(btrfsPath, entry.Name())
+
+		// the folders of the filesystems are named after their UUID, the features folder is skipped
+		if _, err := os.Stat(filepath.Join(path, "devinfo")); err != nil {
+			continue
+		}
+
+		fs := BtrfsFilesystem{
+			UUID:  entry.Name(),
+			Label: readString(filepath.Join(path, "label")),
+		}
+
+		if operation := readString(filepath.Join(path, "exclusive_operation")); operation != btrfsNoOperation {
+			fs.Operation = operation
+		}
+
+		fs.DataTotalBytes = readUint(filepath.Join(path, "allocation", "data", "total_bytes"))
+		fs.DataUsedBytes = readUint(filepath.Join(path, "allocation", "data", "bytes_used"))
+
+		devices, _ := os.ReadDir(filepath.Join(path, "devinfo"))
+		for _, device := range devices {
+			addBtrfsErrorStats(&fs, filepath.Join(path, "devinfo", device.Name(), "error_stats"))
+		}
+
+		filesystems = append(filesystems, fs)
+	}
+
+	sort.Slice(filesystems, func(i, j int) bool { return filesystems[i].UUID < filesystems[j].UUID })
+
+	return filesystems, nil
+}
+
+// addBtrfsErrorStats adds the error counters of a device to the filesystem, the error_stats file is only available
+// since Linux 5.14
+func addBtrfsErrorStats(fs *BtrfsFilesystem, path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		count, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		switch fields[0] {
+		case "write_errs":
+			fs.WriteErrors += count
+		case "read_errs":
+			fs.ReadErrors += count
+		case "flush_errs":
+			fs.FlushErrors += count
+		case "corruption_errs":
+			fs.CorruptionErrors += count
+		case "generation_errs":
+			fs.GenerationErrors += count
+		}
+	}
+}
+
+func btrfsWarnings(filesystems []BtrfsFilesystem) []string {
+	warnings := []string{}
+	for _, fs := range filesystems {
+		name := fs.UUID
+		if fs.Label != "" {
+			name = fs.Label
+		}
+
+		errs := fs.WriteErrors + fs.ReadErrors + fs.FlushErrors + fs.CorruptionErrors + fs.GenerationErrors
+		if errs > 0 {
+			warnings = append(warnings, fmt.Sprintf("btrfs filesystem %s reported %d device errors (%d write, %d read, %d flush, %d corruption, %d generation)", name, errs, fs.WriteErrors, fs.ReadErrors, fs.FlushErrors, fs.CorruptionErrors, fs.GenerationErrors))
+		}
+
+		if fs.Operation != "" {
+			warnings = append(warnings, fmt.Sprintf("btrfs filesystem %s is running a %s, the writes can be slowed down", name, fs.Operation))
+		}
+	}
+
+	return warnings
+}
+
+func readString(path string) string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(content))
+}
+
+func readUint(path string) uint64 {
+	value, _ := strconv.ParseUint(readString(path), 10, 64)
+
+	return value
+}
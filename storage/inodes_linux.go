@@ -0,0 +1,23 @@
+//go:build linux
+// +build linux
+
+package storage
+
+import "syscall"
+
+// inodeUsage returns the inode usage of the filesystem of path
+func inodeUsage(path string) (*InodeUsage, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return nil, err
+	}
+
+	usage := &InodeUsage{Total: stat.Files, Free: stat.Ffree}
+
+	// some filesystems (e.g. btrfs) allocate the inodes dynamically and report no total
+	if stat.Files > 0 {
+		usage.UsedPercent = float64(stat.Files-stat.Ffree) * 100 / float64(stat.Files)
+	}
+
+	return usage, nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package storage
+
+import "errors"
+
+// inodeUsage is only supported on Linux hosts
+func inodeUsage(path string) (*InodeUsage, error) {
+	return nil, errors.New("the inode usage is only available on Linux hosts")
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/portainer/agent/docker"
+
+	"github.com/rs/zerolog/log"
+)
+
+// collectOverlay2 reports the backing filesystem of the Docker root folder and its inode usage, the layers of the
+// images hold many small files which can exhaust the inodes before the disk space
+func collectOverlay2(ctx context.Context, driver docker.StorageDriver, report *Report) error {
+	report.BackingFilesystem = driver.Status["Backing Filesystem"]
+
+	if driver.Status["Supports d_type"] == "false" {
+		report.Warnings = append(report.Warnings, "the backing filesystem does not support d_type, the containers can fail to remove their files")
+	}
+
+	path := filepath.Join(hostRoot, driver.RootDir)
+	if _, err := os.Stat(path); err != nil {
+		log.Debug().Err(err).Str("path", path).Msg("the Docker root folder is not mounted in the agent container")
+
+		return nil
+	}
+
+	inodes, err := inodeUsage(path)
+	if err != nil {
+		return err
+	}
+
+	report.Inodes = inodes
+	report.Warnings = append(report.Warnings, inodeWarnings(driver.RootDir, inodes)...)
+
+	return nil
+}
+
+func inodeWarnings(rootDir string, inodes *InodeUsage) []string {
+	if inodes == nil || inodes.UsedPercent < nearFullInodesPercent {
+		return nil
+	}
+
+	return []string{fmt.Sprintf("inodes nearly exhausted on the filesystem of %s: %.0f%% used, %d free", rootDir, inodes.UsedPercent, inodes.Free)}
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker"
+)
+
+// Names of the storage drivers with a built-in collector
+const (
+	DriverZFS      = "zfs"
+	DriverBtrfs    = "btrfs"
+	DriverOverlay2 = "overlay2"
+)
+
+// nearFullInodesPercent is the usage of the inodes of the backing filesystem from which it is reported as a warning
+const nearFullInodesPercent = 90
+
+var (
+	// hostRoot is where the host filesystem is mounted in the agent container
+	hostRoot = agent.HostRoot
+
+	procPath = "/proc"
+	sysPath  = "/sys"
+)
+
+// Collector collects the health data specific to a storage driver into the report, the issues likely to make the
+// containers fail are added to the warnings of the report
+type Collector func(ctx context.Context, driver docker.StorageDriver, report *Report) error
+
+var (
+	collectors = map[string]Collector{
+		DriverZFS:      collectZFS,
+		DriverBtrfs:    collectBtrfs,
+		DriverOverlay2: collectOverlay2,
+	}
+	collectorsMu sync.Mutex
+)
+
+// Report is the health of the storage driver of the Docker daemon
+type Report struct {
+	Driver  string `json:"Driver"`
+	RootDir string `json:"RootDir"`
+	// BackingFilesystem is the filesystem of the root folder, when reported by the driver
+	BackingFilesystem string            `json:"BackingFilesystem,omitempty"`
+	ZFSPools          []ZFSPool         `json:"ZFSPools,omitempty"`
+	BtrfsFilesystems  []BtrfsFilesystem `json:"BtrfsFilesystems,omitempty"`
+	// Inodes is the inode usage of the backing filesystem of the root folder
+	Inodes   *InodeUsage `json:"Inodes,omitempty"`
+	Warnings []string    `json:"Warnings,omitempty"`
+	// Error is the reason why the health data of the driver could not be collected
+	Error string `json:"Error,omitempty"`
+}
+
+// ZFSPool is a ZFS pool of the host and its state (ONLINE, DEGRADED, FAULTED, OFFLINE, UNAVAIL or REMOVED)
+type ZFSPool struct {
+	Name  string `json:"Name"`
+	State string `json:"State"`
+}
+
+// BtrfsFilesystem is a btrfs filesystem of the host, its device errors and the allocation of its data chunks
+type BtrfsFilesystem struct {
+	UUID  string `json:"UUID"`
+	Label string `json:"Label,omitempty"`
+	// Operation is the exclusive operation in progress (e.g. balance), empty when there is none
+	Operation        string `json:"Operation,omitempty"`
+	WriteErrors      uint64 `json:"WriteErrors"`
+	ReadErrors       uint64 `json:"ReadErrors"`
+	FlushErrors      uint64 `json:"FlushErrors"`
+	CorruptionErrors uint64 `json:"CorruptionErrors"`
+	GenerationErrors uint64 `json:"GenerationErrors"`
+	DataTotalBytes   uint64 `json:"DataTotalBytes"`
+	DataUsedBytes    uint64 `json:"DataUsedBytes"`
+}
+
+// InodeUsage is the inode usage of a filesystem
+type InodeUsage struct {
+	Total       uint64  `json:"Total"`
+	Free        uint64  `json:"Free"`
+	UsedPercent float64 `json:"UsedPercent"`
+}
+
+// Register sets the collector of the driver, replacing the built-in collector of the driver if any
+func Register(driver string, collector Collector) {
+	collectorsMu.Lock()
+	defer collectorsMu.Unlock()
+
+	collectors[driver] = collector
+}
+
+// Collect detects the storage driver of the Docker daemon and collects its health data with the collector of the
+// driver. The report only contains the driver and its root folder when no collector is registered for the driver.
+func Collect(ctx context.Context) (*Report, error) {
+	driver, err := docker.GetStorageDriver(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Driver: driver.Name, RootDir: driver.RootDir}
+
+	collectorsMu.Lock()
+	collector, ok := collectors[driver.Name]
+	collectorsMu.Unlock()
+
+	if !ok {
+		return report, nil
+	}
+
+	if err := collector(ctx, driver, report); err != nil {
+		report.Error = err.Error()
+	}
+
+	return report, nil
+}
+
+// Diagnostics returns a diagnostic message for each warning of the storage driver
+func (report *Report) Diagnostics() []string {
+	if report == nil {
+		return nil
+	}
+
+	var diagnostics []string
+	for _, warning := range report.Warnings {
+		diagnostics = append(diagnostics, fmt.Sprintf("storage driver %s: %s", report.Driver, warning))
+	}
+
+	if report.Error != "" {
+		diagnostics = append(diagnostics, fmt.Sprintf("storage driver %s: unable to collect the health data: %s", report.Driver, report.Error))
+	}
+
+	return diagnostics
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadZFSPools(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFile(t, filepath.Join(dir, "tank", "state"), "DEGRADED\n")
+	writeFile(t, filepath.Join(dir, "rpool", "state"), "ONLINE\n")
+	writeFile(t, filepath.Join(dir, "fletcher_4_bench"), "")
+	writeFile(t, filepath.Join(dir, "dbufstats", "data"), "")
+
+	pools, err := readZFSPools(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []ZFSPool{{Name: "rpool", State: "ONLINE"}, {Name: "tank", State: "DEGRADED"}}
+	if !reflect.DeepEqual(pools, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, pools)
+	}
+
+	warnings := zfsWarnings(pools)
+	if !reflect.DeepEqual(warnings, []string{"ZFS pool tank is DEGRADED"}) {
+		t.Fatalf("unexpected warnings %v", warnings)
+	}
+
+	pools, err = readZFSPools(filepath.Join(dir, "missing"))
+	if err != nil || len(pools) != 0 {
+		t.Fatalf("expected no pool without the ZFS module, got %+v and %v", pools, err)
+	}
+}
+
+func TestReadBtrfsFilesystems(t *testing.T) {
+	dir := t.TempDir()
+	uuid := "5f3c1e8a-2b1d-4c7e-9a0b-1d2e3f4a5b6c"
+
+	writeFile(t, filepath.Join(dir, "features", "raid56"), "0\n")
+	writeFile(t, filepath.Join(dir, uuid, "label"), "data\n")
+	writeFile(t, filepath.Join(dir, uuid, "exclusive_operation"), "balance\n")
+	writeFile(t, filepath.Join(dir, uuid, "allocation", "data", "total_bytes"), "10737418240\n")
+	writeFile(t, filepath.Join(dir, uuid, "allocation", "data", "bytes_used"), "5368709120\n")
+	writeFile(t, filepath.Join(dir, uuid, "devinfo", "1", "error_stats"), "write_errs 2\nread_errs 1\nflush_errs 0\ncorruption_errs 0\ngeneration_errs 0\n")
+	writeFile(t, filepath.Join(dir, uuid, "devinfo", "2", "error_stats"), "write_errs 0\nread_errs 0\nflush_errs 0\ncorruption_errs 3\ngeneration_errs 0\n")
+
+	filesystems, err := readBtrfsFilesystems(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []BtrfsFilesystem{{
+		UUID:             uuid,
+		Label:            "data",
+		Operation:        "balance",
+		WriteErrors:      2,
+		ReadErrors:       1,
+		CorruptionErrors: 3,
+		DataTotalBytes:   10737418240,
+		DataUsedBytes:    5368709120,
+	}}
+	if !reflect.DeepEqual(filesystems, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, filesystems)
+	}
+
+	warnings := btrfsWarnings(filesystems)
+
+	expectedWarnings := []string{
+		"btrfs filesystem data reported 6 device errors (2 write, 1 read, 0 flush, 3 corruption, 0 generation)",
+		"btrfs filesystem data is running a balance, the writes can be slowed down",
+	}
+	if !reflect.DeepEqual(warnings, expectedWarnings) {
+		t.Fatalf("expected %v, got %v", expectedWarnings, warnings)
+	}
+}
+
+func TestInodeWarnings(t *testing.T) {
+	if warnings := inodeWarnings("/var/lib/docker", &InodeUsage{Total: 1000, Free: 500, UsedPercent: 50}); len(warnings) != 0 {
+		t.Fatalf("unexpected warnings %v", warnings)
+	}
+
+	warnings := inodeWarnings("/var/lib/docker", &InodeUsage{Total: 1000, Free: 40, UsedPercent: 96})
+
+	expected := []string{"inodes nearly exhausted on the filesystem of /var/lib/docker: 96% used, 40 free"}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Fatalf("expected %v, got %v", expected, warnings)
+	}
+}
+
+func TestReportDiagnostics(t *testing.T) {
+	var report *Report
+	if diagnostics := report.Diagnostics(); diagnostics != nil {
+		t.Fatalf("expected no diagnostics for a nil report, got %v", diagnostics)
+	}
+
+	report = &Report{Driver: DriverZFS, Warnings: []string{"ZFS pool tank is DEGRADED"}, Error: "permission denied"}
+
+	expected := []string{
+		"storage driver zfs: ZFS pool tank is DEGRADED",
+		"storage driver zfs: unable to collect the health data: permission denied",
+	}
+	if diagnostics := report.Diagnostics(); !reflect.DeepEqual(diagnostics, expected) {
+		t.Fatalf("expected %v, got %v", expected, diagnostics)
+	}
+}
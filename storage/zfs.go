@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/portainer/agent/docker"
+)
+
+const zfsStateOnline = "ONLINE"
+
+// collectZFS reports the state of the ZFS pools of the host, read from the kstat of the ZFS kernel module. The health
+// of the pool of the Docker root folder reported by the driver is used when the kstat is not available.
+func collectZFS(ctx context.Context, driver docker.StorageDriver, report *Report) error {
+	pools, err := readZFSPools(filepath.Join(procPath, "spl", "kstat", "zfs"))
+	if err != nil {
+		return err
+	}
+
+	if len(pools) == 0 && driver.Status["Zpool"] != "" {
+		pools = append(pools, ZFSPool{Name: driver.Status["Zpool"], State: driver.Status["Zpool Health"]})
+	}
+
+	report.ZFSPools = pools
+	report.Warnings = append(report.Warnings, zfsWarnings(pools)...)
+
+	return nil
+}
+
+// readZFSPools reads the state of each pool from the state file of its folder in the kstat folder of ZFS
+func readZFSPools(kstatPath string) ([]ZFSPool, error) {
+	entries, err := os.ReadDir(kstatPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return []ZFSPool{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	pools := []ZFSPool{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		state, err := os.ReadFile(filepath.Join(kstatPath, entry.Name(), "state"))
+		if err != nil {
+			// the other folders hold the statistics of the module
+			continue
+		}
+
+		pools = append(pools, ZFSPool{Name: entry.Name(), State: strings.TrimSpace(string(state))})
+	}
+
+	sort.Slice(pools, func(i, j int) bool { return pools[i].Name < pools[j].Name })
+
+	return pools, nil
+}
+
+func zfsWarnings(pools []ZFSPool) []string {
+	warnings := []string{}
+	for _, pool := range pools {
+		if pool.State != zfsStateOnline {
+			warnings = append(warnings, fmt.Sprintf("ZFS pool %s is %s", pool.Name, pool.State))
+		}
+	}
+
+	return warnings
+}
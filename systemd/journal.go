@@ -0,0 +1,240 @@
+package systemd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent/docker"
+)
+
+const (
+	// DefaultJournalLines is the number of entries returned when the query does not specify it
+	DefaultJournalLines = 200
+	// MaxJournalLines is the maximum number of entries returned by a query
+	MaxJournalLines = 5000
+	// MaxJournalOutputBytes bounds the output of a query, the entries can be long when they contain stack traces
+	MaxJournalOutputBytes = 4 << 20
+)
+
+// journalTruncatedMessage is appended to the output when it exceeds MaxJournalOutputBytes
+const journalTruncatedMessage = "\n-- output truncated, narrow the query with the unit, priority, since or until filters --\n"
+
+var (
+	// ErrJournalDisabled is returned when the journal of the host cannot be queried by the agent
+	ErrJournalDisabled = errors.New("the journal of the host cannot be queried on this agent")
+	// ErrInvalidJournalQuery is returned when a filter of a query is invalid
+	ErrInvalidJournalQuery = errors.New("invalid journal query")
+)
+
+// journalPriorities are the priorities accepted by journalctl, from the most to the least severe
+var journalPriorities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+var (
+	defaultJournal   *Journal
+	defaultJournalMu sync.Mutex
+)
+
+// JournalQuery filters the entries of the journal of the host
+type JournalQuery struct {
+	// Units are the systemd units whose entries are returned, the units without type suffix are services
+	Units []string
+	// Priority is the least severe priority returned, a name (emerg to debug) or a number (0 to 7)
+	Priority string
+	// Since and Until are RFC3339 timestamps or durations relative to the query (e.g. 2h)
+	Since string
+	Until string
+	// Kernel restricts the entries to the kernel messages, e.g. the OOM killer
+	Kernel bool
+	// Lines is the number of the most recent entries returned, DefaultJournalLines when 0
+	Lines int
+}
+
+// Journal queries the journal of the host with journalctl
+type Journal struct {
+	run CommandRunner
+}
+
+// NewJournal returns a pointer to a Journal executing journalctl on the host with image, which must provide nsenter
+func NewJournal(image string) *Journal {
+	return &Journal{
+		run: func(ctx context.Context, cmd []string, w io.Writer) error {
+			return docker.ExecHostCommand(ctx, image, cmd, w)
+		},
+	}
+}
+
+// Validate returns an error wrapping ErrInvalidJournalQuery when a filter of the query is invalid
+func (query JournalQuery) Validate() error {
+	_, err := query.command(time.Now())
+
+	return err
+}
+
+// command returns the journalctl command of the query, the relative times are resolved from now. The values are
+// passed with the --option=value form so that they cannot be interpreted as other options.
+func (query JournalQuery) command(now time.Time) ([]string, error) {
+	lines := query.Lines
+	if lines == 0 {
+		lines = DefaultJournalLines
+	}
+
+	if lines < 0 || lines > MaxJournalLines {
+		return nil, fmt.Errorf("%w: lines must be between 1 and %d", ErrInvalidJournalQuery, MaxJournalLines)
+	}
+
+	cmd := []string{"journalctl", "--no-pager", "--quiet", "--utc", "--output=short-iso", "--lines=" + strconv.Itoa(lines)}
+
+	for _, unit := range query.Units {
+		if !strings.Contains(unit, ".") {
+			unit += ".service"
+		}
+
+		if !unitNameRegexp.MatchString(unit) {
+			return nil, fmt.Errorf("%w: invalid systemd unit name %q", ErrInvalidJournalQuery, unit)
+		}
+
+		cmd = append(cmd, "--unit="+unit)
+	}
+
+	if query.Priority != "" {
+		if !validPriority(query.Priority) {
+			return nil, fmt.Errorf("%w: invalid priority %q, expected one of %s or 0 to 7", ErrInvalidJournalQuery, query.Priority, strings.Join(journalPriorities, ", "))
+		}
+
+		cmd = append(cmd, "--priority="+query.Priority)
+	}
+
+	if query.Since != "" {
+		since, err := parseJournalTime(query.Since, now)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid since: %s", ErrInvalidJournalQuery, err)
+		}
+
+		cmd = append(cmd, "--since="+since)
+	}
+
+	if query.Until != "" {
+		until, err := parseJournalTime(query.Until, now)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid until: %s", ErrInvalidJournalQuery, err)
+		}
+
+		cmd = append(cmd, "--until="+until)
+	}
+
+	if query.Kernel {
+		cmd = append(cmd, "--dmesg")
+	}
+
+	return cmd, nil
+}
+
+func validPriority(priority string) bool {
+	if value, err := strconv.Atoi(priority); err == nil {
+		return value >= 0 && value < len(journalPriorities)
+	}
+
+	for _, name := range journalPriorities {
+		if priority == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseJournalTime converts an RFC3339 timestamp or a duration before now to the @<unix seconds> form accepted by
+// journalctl, which does not depend on the timezone of the host
+func parseJournalTime(value string, now time.Time) (string, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return "@" + strconv.FormatInt(t.Unix(), 10), nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return "", fmt.Errorf("%q is neither an RFC3339 timestamp nor a positive duration", value)
+	}
+
+	return "@" + strconv.FormatInt(now.Add(-duration).Unix(), 10), nil
+}
+
+// Query writes the entries of the journal matching query to w as they are read, the output is truncated after
+// MaxJournalOutputBytes
+func (journal *Journal) Query(ctx context.Context, query JournalQuery, w io.Writer) error {
+	cmd, err := query.command(time.Now())
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	limited := &limitedWriter{w: w, remaining: MaxJournalOutputBytes, cancel: cancel}
+
+	err = journal.run(ctx, cmd, limited)
+	if limited.truncated {
+		_, err = io.WriteString(w, journalTruncatedMessage)
+	}
+
+	return err
+}
+
+// limitedWriter stops the query once the output reached its limit
+type limitedWriter struct {
+	w         io.Writer
+	remaining int
+	truncated bool
+	cancel    context.CancelFunc
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if w.truncated {
+		return 0, io.ErrShortWrite
+	}
+
+	if len(p) > w.remaining {
+		n, err := w.w.Write(p[:w.remaining])
+		w.remaining -= n
+		w.truncated = true
+		w.cancel()
+
+		if err != nil {
+			return n, err
+		}
+
+		return n, io.ErrShortWrite
+	}
+
+	n, err := w.w.Write(p)
+	w.remaining -= n
+
+	return n, err
+}
+
+// EnableJournal makes journal the default journal used by QueryJournal
+func EnableJournal(journal *Journal) {
+	defaultJournalMu.Lock()
+	defer defaultJournalMu.Unlock()
+
+	defaultJournal = journal
+}
+
+// QueryJournal queries the journal of the host with the default journal, ErrJournalDisabled is returned when no
+// journal is enabled
+func QueryJournal(ctx context.Context, query JournalQuery, w io.Writer) error {
+	defaultJournalMu.Lock()
+	journal := defaultJournal
+	defaultJournalMu.Unlock()
+
+	if journal == nil {
+		return ErrJournalDisabled
+	}
+
+	return journal.Query(ctx, query, w)
+}
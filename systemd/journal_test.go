@@ -0,0 +1,96 @@
+package systemd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJournalQueryCommand(t *testing.T) {
+	now := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+
+	query := JournalQuery{
+		Units:    []string{"docker", "containerd.service"},
+		Priority: "err",
+		Since:    "2h",
+		Until:    "2024-03-05T11:30:00Z",
+		Lines:    50,
+	}
+
+	cmd, err := query.command(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"journalctl", "--no-pager", "--quiet", "--utc", "--output=short-iso", "--lines=50",
+		"--unit=docker.service", "--unit=containerd.service",
+		"--priority=err",
+		"--since=@1709632800",
+		"--until=@1709638200",
+	}
+	if !reflect.DeepEqual(cmd, expected) {
+		t.Fatalf("expected %v, got %v", expected, cmd)
+	}
+
+	cmd, err = JournalQuery{Kernel: true, Priority: "3"}.command(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cmd[5] != "--lines=200" || cmd[len(cmd)-1] != "--dmesg" {
+		t.Fatalf("unexpected kernel query %v", cmd)
+	}
+}
+
+func TestJournalQueryValidate(t *testing.T) {
+	invalid := []JournalQuery{
+		{Units: []string{"--output=export"}},
+		{Units: []string{"docker; reboot"}},
+		{Priority: "8"},
+		{Priority: "error"},
+		{Since: "yesterday"},
+		{Until: "-1h"},
+		{Lines: MaxJournalLines + 1},
+		{Lines: -1},
+	}
+
+	for _, query := range invalid {
+		if err := query.Validate(); !errors.Is(err, ErrInvalidJournalQuery) {
+			t.Errorf("expected the query %+v to be rejected, got %v", query, err)
+		}
+	}
+}
+
+func TestJournalQueryTruncated(t *testing.T) {
+	journal := &Journal{
+		run: func(ctx context.Context, cmd []string, w io.Writer) error {
+			line := []byte(strings.Repeat("x", 1023) + "\n")
+			for ctx.Err() == nil {
+				if _, err := w.Write(line); err != nil {
+					return err
+				}
+			}
+
+			return ctx.Err()
+		},
+	}
+
+	var output bytes.Buffer
+	if err := journal.Query(context.Background(), JournalQuery{}, &output); err != nil {
+		t.Fatal(err)
+	}
+
+	if output.Len() != MaxJournalOutputBytes+len(journalTruncatedMessage) || !strings.HasSuffix(output.String(), journalTruncatedMessage) {
+		t.Fatalf("expected the output to be truncated, got %d bytes", output.Len())
+	}
+
+	if err := QueryJournal(context.Background(), JournalQuery{}, &output); !errors.Is(err, ErrJournalDisabled) {
+		t.Fatalf("expected ErrJournalDisabled, got %v", err)
+	}
+}
@@ -0,0 +1,257 @@
+package systemd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent/docker"
+)
+
+// statusCacheDuration is the duration during which the status of the units is reused, each collection runs a
+// container on the host
+const statusCacheDuration = time.Minute
+
+// showTimestampLayout is the layout of the timestamps printed by systemctl show
+const showTimestampLayout = "Mon 2006-01-02 15:04:05 MST"
+
+var (
+	// ErrDisabled is returned when no unit is monitored by the agent
+	ErrDisabled = errors.New("no systemd unit is monitored on this agent")
+	// ErrUnitNotAllowed is returned when a unit that is not in the allowlist is restarted
+	ErrUnitNotAllowed = errors.New("the systemd unit is not allowed on this agent")
+	// ErrAgentUnit is returned when restarting the unit would stop the agent before it can report the outcome
+	ErrAgentUnit = errors.New("the Docker daemon must be restarted with the Docker restart host action")
+)
+
+// unitNameRegexp matches the valid names of systemd units, with their type suffix
+var unitNameRegexp = regexp.MustCompile(`^[A-Za-z0-9:_.@\\-]+\.(service|socket|timer|mount|target|path)$`)
+
+// agentUnits are the units whose restart stops the agent
+var agentUnits = map[string]bool{
+	"docker.service": true,
+	"docker.socket":  true,
+}
+
+var (
+	defaultService   *Service
+	defaultServiceMu sync.Mutex
+)
+
+// UnitStatus represents the state of a systemd unit of the host
+type UnitStatus struct {
+	Name        string `json:"Name"`
+	Description string `json:"Description,omitempty"`
+	// LoadState is not-found when the unit is not installed on the host
+	LoadState   string `json:"LoadState"`
+	ActiveState string `json:"ActiveState"`
+	SubState    string `json:"SubState"`
+	// ActiveSince is the time the unit last entered the active state
+	ActiveSince *time.Time `json:"ActiveSince,omitempty"`
+	// Restarts is the number of automatic restarts of the service since it was started by systemd
+	Restarts int `json:"Restarts"`
+}
+
+// CommandRunner executes cmd on the host and writes its output to w
+type CommandRunner func(ctx context.Context, cmd []string, w io.Writer) error
+
+// Service reports the status of the allowlisted systemd units of the host and restarts them
+type Service struct {
+	units     []string
+	run       CommandRunner
+	mu        sync.Mutex
+	status    []UnitStatus
+	checkedAt time.Time
+}
+
+// NewService returns a pointer to a Service monitoring units, whose commands are executed on the host with image,
+// which must provide nsenter
+// The units without type suffix are services.
+func NewService(units []string, image string) (*Service, error) {
+	names := make([]string, 0, len(units))
+	for _, unit := range units {
+		if !strings.Contains(unit, ".") {
+			unit += ".service"
+		}
+
+		if !unitNameRegexp.MatchString(unit) {
+			return nil, fmt.Errorf("invalid systemd unit name %q", unit)
+		}
+
+		names = append(names, unit)
+	}
+
+	return &Service{
+		units: names,
+		run: func(ctx context.Context, cmd []string, w io.Writer) error {
+			return docker.ExecHostCommand(ctx, image, cmd, w)
+		},
+	}, nil
+}
+
+// Status returns the status of the monitored units, collected at most once per minute
+func (service *Service) Status(ctx context.Context) ([]UnitStatus, error) {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	if service.status != nil && time.Since(service.checkedAt) < statusCacheDuration {
+		return service.status, nil
+	}
+
+	cmd := append([]string{"systemctl", "show", "--no-pager", "--property=Id,Description,LoadState,ActiveState,SubState,ActiveEnterTimestamp,NRestarts"}, service.units...)
+
+	var output bytes.Buffer
+	if err := service.run(ctx, cmd, &output); err != nil {
+		return nil, err
+	}
+
+	service.status = parseShowOutput(&output)
+	service.checkedAt = time.Now()
+
+	return service.status, nil
+}
+
+// Restart restarts unit on the host, unit must be monitored by the service
+func (service *Service) Restart(ctx context.Context, unit string) error {
+	if !service.IsAllowed(unit) {
+		return ErrUnitNotAllowed
+	}
+
+	if agentUnits[unit] {
+		return ErrAgentUnit
+	}
+
+	var output bytes.Buffer
+	if err := service.run(ctx, []string{"systemctl", "restart", unit}, &output); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(output.String()))
+	}
+
+	// the next status reflects the restart
+	service.mu.Lock()
+	service.status = nil
+	service.mu.Unlock()
+
+	return nil
+}
+
+// IsAllowed returns true when unit is monitored by the service
+func (service *Service) IsAllowed(unit string) bool {
+	for _, u := range service.units {
+		if u == unit {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Enable makes service the default service used by CurrentStatus, Restart and Diagnostics
+func Enable(service *Service) {
+	defaultServiceMu.Lock()
+	defer defaultServiceMu.Unlock()
+
+	defaultService = service
+}
+
+func getDefaultService() *Service {
+	defaultServiceMu.Lock()
+	defer defaultServiceMu.Unlock()
+
+	return defaultService
+}
+
+// CurrentStatus returns the status of the units monitored by the default service, nil when no unit is monitored
+func CurrentStatus(ctx context.Context) ([]UnitStatus, error) {
+	service := getDefaultService()
+	if service == nil {
+		return nil, nil
+	}
+
+	return service.Status(ctx)
+}
+
+// Restart restarts unit with the default service, ErrDisabled is returned when no unit is monitored
+func Restart(ctx context.Context, unit string) error {
+	service := getDefaultService()
+	if service == nil {
+		return ErrDisabled
+	}
+
+	return service.Restart(ctx, unit)
+}
+
+// Diagnostics returns a diagnostic message for each monitored unit that failed or is not installed
+func Diagnostics(status []UnitStatus) []string {
+	diagnostics := []string{}
+	for _, unit := range status {
+		switch {
+		case unit.LoadState == "not-found":
+			diagnostics = append(diagnostics, fmt.Sprintf("systemd unit %s is not installed", unit.Name))
+		case unit.ActiveState == "failed":
+			diagnostics = append(diagnostics, fmt.Sprintf("systemd unit %s failed", unit.Name))
+		}
+	}
+
+	return diagnostics
+}
+
+// parseShowOutput parses the properties printed by systemctl show, the properties of each unit are separated by
+// an empty line
+func parseShowOutput(r io.Reader) []UnitStatus {
+	status := []UnitStatus{}
+	current := UnitStatus{}
+
+	flush := func() {
+		if current.Name != "" {
+			status = append(status, current)
+		}
+
+		current = UnitStatus{}
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			flush()
+
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "Id":
+			current.Name = value
+		case "Description":
+			current.Description = value
+		case "LoadState":
+			current.LoadState = value
+		case "ActiveState":
+			current.ActiveState = value
+		case "SubState":
+			current.SubState = value
+		case "ActiveEnterTimestamp":
+			if t, err := time.Parse(showTimestampLayout, value); err == nil {
+				current.ActiveSince = &t
+			}
+		case "NRestarts":
+			current.Restarts, _ = strconv.Atoi(value)
+		}
+	}
+
+	flush()
+
+	return status
+}
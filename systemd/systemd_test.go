@@ -0,0 +1,90 @@
+package systemd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseShowOutput(t *testing.T) {
+	output := `Id=containerd.service
+Description=containerd container runtime
+LoadState=loaded
+ActiveState=active
+SubState=running
+ActiveEnterTimestamp=Tue 2024-03-05 10:15:30 UTC
+NRestarts=2
+
+Id=chronyd.service
+Description=chronyd.service
+LoadState=not-found
+ActiveState=inactive
+SubState=dead
+ActiveEnterTimestamp=
+NRestarts=0
+`
+
+	status := parseShowOutput(strings.NewReader(output))
+	if len(status) != 2 {
+		t.Fatalf("expected 2 units, got %d", len(status))
+	}
+
+	containerd := status[0]
+	if containerd.Name != "containerd.service" || containerd.ActiveState != "active" || containerd.SubState != "running" || containerd.Restarts != 2 {
+		t.Errorf("unexpected containerd status %+v", containerd)
+	}
+
+	if containerd.ActiveSince == nil || !containerd.ActiveSince.Equal(time.Date(2024, 3, 5, 10, 15, 30, 0, time.UTC)) {
+		t.Errorf("unexpected containerd active since %v", containerd.ActiveSince)
+	}
+
+	if status[1].ActiveSince != nil {
+		t.Errorf("expected no active since for chronyd, got %v", status[1].ActiveSince)
+	}
+
+	diagnostics := Diagnostics(status)
+	if len(diagnostics) != 1 || diagnostics[0] != "systemd unit chronyd.service is not installed" {
+		t.Errorf("unexpected diagnostics %v", diagnostics)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	service, err := NewService([]string{"containerd", "docker", "wg-quick@wg0.service"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var restarted []string
+	service.run = func(ctx context.Context, cmd []string, w io.Writer) error {
+		restarted = append(restarted, cmd[len(cmd)-1])
+
+		return nil
+	}
+
+	tests := []struct {
+		unit string
+		err  error
+	}{
+		{"containerd.service", nil},
+		{"wg-quick@wg0.service", nil},
+		{"docker.service", ErrAgentUnit},
+		{"sshd.service", ErrUnitNotAllowed},
+	}
+
+	for _, test := range tests {
+		if err := service.Restart(context.Background(), test.unit); !errors.Is(err, test.err) {
+			t.Errorf("expected %v when restarting %s, got %v", test.err, test.unit, err)
+		}
+	}
+
+	if strings.Join(restarted, ",") != "containerd.service,wg-quick@wg0.service" {
+		t.Errorf("unexpected restarted units %v", restarted)
+	}
+
+	if _, err := NewService([]string{"containerd; reboot"}, ""); err == nil {
+		t.Error("expected an error for an invalid unit name")
+	}
+}
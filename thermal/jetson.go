@@ -0,0 +1,85 @@
+package thermal
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jetsonTelemetry reports the thermal zones of the NVIDIA Jetson modules (CPU, GPU, SoC) and the power drawn by the
+// rails monitored by their INA3221 sensors
+type jetsonTelemetry struct{}
+
+func (provider *jetsonTelemetry) Name() string {
+	return "jetson"
+}
+
+func (provider *jetsonTelemetry) Detect() bool {
+	return strings.Contains(deviceTreeProperty("compatible"), "nvidia,tegra")
+}
+
+func (provider *jetsonTelemetry) Collect(ctx context.Context, run CommandRunner, report *Report) error {
+	report.Sensors = append(report.Sensors, readThermalZones(filepath.Join(sysPath, "class", "thermal"))...)
+	report.Sensors = append(report.Sensors, readINA3221Rails(filepath.Join(sysPath, "bus", "i2c", "drivers"))...)
+
+	return nil
+}
+
+// readThermalZones returns the temperature of each thermal zone, named after its type (e.g. GPU-therm)
+func readThermalZones(thermalPath string) []Sensor {
+	zones, err := filepath.Glob(filepath.Join(thermalPath, "thermal_zone*"))
+	if err != nil {
+		return nil
+	}
+
+	var sensors []Sensor
+	for _, zone := range zones {
+		milliCelsius, err := strconv.ParseInt(readString(filepath.Join(zone, "temp")), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		name := readString(filepath.Join(zone, "type"))
+		if name == "" {
+			name = filepath.Base(zone)
+		}
+
+		sensors = append(sensors, Sensor{Name: name, Value: float64(milliCelsius) / 1000, Unit: "°C"})
+	}
+
+	return sensors
+}
+
+// readINA3221Rails returns the power drawn by each rail monitored by the INA3221 sensors, computed from the voltage
+// (in*_input, mV) and the current (curr*_input, mA) of the channels exposed by the hwmon driver
+func readINA3221Rails(driversPath string) []Sensor {
+	labels, err := filepath.Glob(filepath.Join(driversPath, "ina3221*", "*", "hwmon", "hwmon*", "in*_label"))
+	if err != nil {
+		return nil
+	}
+
+	sort.Strings(labels)
+
+	var sensors []Sensor
+	for _, label := range labels {
+		name := readString(label)
+		channel := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(label), "in"), "_label")
+		hwmon := filepath.Dir(label)
+
+		milliVolts, err := strconv.ParseFloat(readString(filepath.Join(hwmon, "in"+channel+"_input")), 64)
+		if err != nil || name == "" {
+			continue
+		}
+
+		milliAmps, err := strconv.ParseFloat(readString(filepath.Join(hwmon, "curr"+channel+"_input")), 64)
+		if err != nil {
+			continue
+		}
+
+		sensors = append(sensors, Sensor{Name: name, Value: milliVolts * milliAmps / 1000, Unit: "mW"})
+	}
+
+	return sensors
+}
@@ -0,0 +1,111 @@
+package thermal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// HostTelemetry is a provider of the hardware telemetry of a family of hosts. Detect reports whether the host is
+// supported by the provider, Collect adds the measurements of the host to report by reading the kernel attributes or
+// by executing the commands of the host with run. The providers are collected in the order of their registration, a
+// board-specific provider can override the values set by the generic ones.
+type HostTelemetry interface {
+	Name() string
+	Detect() bool
+	Collect(ctx context.Context, run CommandRunner, report *Report) error
+}
+
+var (
+	providers   []HostTelemetry
+	providersMu sync.RWMutex
+)
+
+func init() {
+	Register(&linuxTelemetry{})
+	Register(&raspberryPiTelemetry{})
+	Register(&jetsonTelemetry{})
+	Register(&windowsTelemetry{})
+}
+
+// Register adds a HostTelemetry provider, replacing any provider registered with the same name at the same position.
+// The vendors register the providers of their boards from the init function of a package built with the agent or of a
+// command plugin.
+func Register(provider HostTelemetry) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	for i, registered := range providers {
+		if registered.Name() == provider.Name() {
+			providers[i] = provider
+
+			return
+		}
+	}
+
+	providers = append(providers, provider)
+}
+
+// Providers returns the registered providers, in the order of their registration
+func Providers() []HostTelemetry {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	return append([]HostTelemetry(nil), providers...)
+}
+
+// detectProviders returns the registered providers supporting the host
+func detectProviders() []HostTelemetry {
+	var detected []HostTelemetry
+	for _, provider := range Providers() {
+		if provider.Detect() {
+			detected = append(detected, provider)
+		}
+	}
+
+	return detected
+}
+
+func providerNames(providers []HostTelemetry) []string {
+	names := make([]string, 0, len(providers))
+	for _, provider := range providers {
+		names = append(names, provider.Name())
+	}
+
+	return names
+}
+
+// linuxTelemetry reports the thermal zones, the power supplies and the thermal throttling events of the x86 CPUs
+// exposed by the Linux kernel
+type linuxTelemetry struct{}
+
+func (provider *linuxTelemetry) Name() string {
+	return "linux"
+}
+
+func (provider *linuxTelemetry) Detect() bool {
+	_, err := os.Stat(filepath.Join(sysPath, "class"))
+
+	return err == nil
+}
+
+func (provider *linuxTelemetry) Collect(ctx context.Context, run CommandRunner, report *Report) error {
+	report.CPUCelsius = readCPUTemperature(filepath.Join(sysPath, "class", "thermal"))
+	report.PowerSupplies = readPowerSupplies(filepath.Join(sysPath, "class", "power_supply"))
+	report.Throttling = readX86Throttling(filepath.Join(sysPath, "devices", "system", "cpu"))
+
+	return nil
+}
+
+// deviceTreeProperty returns the property of the device tree describing the board, the strings of the list
+// properties such as compatible are separated by NUL characters
+func deviceTreeProperty(name string) string {
+	content, err := os.ReadFile(filepath.Join(sysPath, "firmware", "devicetree", "base", name))
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimRight(strings.ReplaceAll(string(content), "\x00", "\n"), "\n")
+}
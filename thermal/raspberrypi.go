@@ -0,0 +1,25 @@
+package thermal
+
+import (
+	"context"
+	"strings"
+)
+
+// raspberryPiTelemetry reports the under-voltage and throttling state of the Raspberry Pi firmware
+type raspberryPiTelemetry struct{}
+
+func (provider *raspberryPiTelemetry) Name() string {
+	return "raspberrypi"
+}
+
+func (provider *raspberryPiTelemetry) Detect() bool {
+	return strings.Contains(deviceTreeProperty("model"), "Raspberry Pi")
+}
+
+func (provider *raspberryPiTelemetry) Collect(ctx context.Context, run CommandRunner, report *Report) error {
+	if value, ok := raspberryPiThrottled(ctx, run); ok {
+		report.Throttling = parseRaspberryPiThrottled(value)
+	}
+
+	return nil
+}
@@ -0,0 +1,318 @@
+package thermal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker"
+
+	"github.com/rs/zerolog/log"
+)
+
+// statusCacheDuration is the duration during which the report is reused, vcgencmd runs in a container on the host
+// when the firmware does not expose the throttling state in sysfs
+const statusCacheDuration = time.Minute
+
+var (
+	// hostRoot is where the host filesystem is mounted in the agent container
+	hostRoot = agent.HostRoot
+	// binaryPaths are the folders of the host searched for vcgencmd
+	binaryPaths = []string{"/usr/local/sbin", "/usr/local/bin", "/usr/sbin", "/usr/bin", "/sbin", "/bin", "/opt/vc/bin"}
+
+	sysPath = "/sys"
+)
+
+var (
+	defaultService   *Service
+	defaultServiceMu sync.Mutex
+)
+
+// CommandRunner executes a command on the host and returns its output
+type CommandRunner func(ctx context.Context, cmd []string) ([]byte, error)
+
+// Report is the thermal and power state of the host
+type Report struct {
+	// CPUCelsius is the temperature of the CPU, nil when the host exposes no thermal zone
+	CPUCelsius *float64 `json:"CPUCelsius,omitempty"`
+	// Throttling is the throttling state of the CPU, nil when the host does not report it
+	Throttling    *Throttling   `json:"Throttling,omitempty"`
+	PowerSupplies []PowerSupply `json:"PowerSupplies,omitempty"`
+	// Sensors are the board-specific measurements reported by the providers, e.g. the temperature of the GPU
+	Sensors []Sensor `json:"Sensors,omitempty"`
+	// Providers are the names of the telemetry providers detected on the host
+	Providers []string `json:"Providers,omitempty"`
+	// Alerts are the thresholds crossed and the throttling and power issues of the host
+	Alerts []string `json:"Alerts,omitempty"`
+}
+
+// Sensor is a measurement of the host that is not covered by the other fields of the report
+type Sensor struct {
+	Name  string  `json:"Name"`
+	Value float64 `json:"Value"`
+	// Unit is °C, mW, mV or mA
+	Unit string `json:"Unit"`
+}
+
+// Throttling is the throttling state of the CPU, reported by the firmware of the Raspberry Pi or by the thermal
+// throttle counters of the x86 CPUs
+type Throttling struct {
+	// Source is raspberrypi or x86
+	Source string `json:"Source"`
+	// UnderVoltage, FrequencyCapped, Throttled and SoftTemperatureLimit are the current conditions on a Raspberry Pi
+	UnderVoltage         bool `json:"UnderVoltage"`
+	FrequencyCapped      bool `json:"FrequencyCapped"`
+	Throttled            bool `json:"Throttled"`
+	SoftTemperatureLimit bool `json:"SoftTemperatureLimit"`
+	// OccurredSinceBoot lists the conditions that occurred since the Raspberry Pi booted
+	OccurredSinceBoot []string `json:"OccurredSinceBoot,omitempty"`
+	// Events is the number of thermal throttling events of the x86 CPU cores since the boot
+	Events uint64 `json:"Events,omitempty"`
+}
+
+// PowerSupply is a power supply of the host: the mains adapter, a battery or a UPS
+type PowerSupply struct {
+	Name string `json:"Name"`
+	// Type is Mains, Battery, UPS or USB
+	Type string `json:"Type"`
+	// Online is true when the supply is providing power, nil when it is not reported
+	Online *bool `json:"Online,omitempty"`
+	// Status is the charging status of a battery or a UPS: Charging, Discharging, Full or Not charging
+	Status          string `json:"Status,omitempty"`
+	CapacityPercent *int   `json:"CapacityPercent,omitempty"`
+}
+
+// Service collects the thermal and power state of the host and raises the alerts of the thresholds
+type Service struct {
+	run CommandRunner
+	// temperatureThreshold is the CPU temperature in Celsius from which an alert is raised, 0 when disabled
+	temperatureThreshold float64
+	// batteryThreshold is the capacity in percent of a discharging battery or UPS from which an alert is raised
+	batteryThreshold int
+
+	mu sync.Mutex
+	// providers are the telemetry providers supporting the host, detected at the first collection so that the
+	// providers registered by the plugins loaded at startup are included
+	providers  []HostTelemetry
+	detected   bool
+	report     *Report
+	checkedAt  time.Time
+	lastEvents *uint64
+}
+
+// NewService returns a pointer to a Service executing vcgencmd on the host with image, which must provide nsenter.
+// The alerts are raised from temperatureThreshold degrees Celsius and below batteryThreshold percent of battery.
+func NewService(image string, temperatureThreshold float64, batteryThreshold int) *Service {
+	return &Service{
+		run: func(ctx context.Context, cmd []string) ([]byte, error) {
+			var output bytes.Buffer
+			err := docker.ExecHostCommand(ctx, image, cmd, &output)
+
+			return output.Bytes(), err
+		},
+		temperatureThreshold: temperatureThreshold,
+		batteryThreshold:     batteryThreshold,
+	}
+}
+
+// Status returns the thermal and power state of the host, collected at most once per minute
+func (service *Service) Status(ctx context.Context) *Report {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	if service.report != nil && time.Since(service.checkedAt) < statusCacheDuration {
+		return service.report
+	}
+
+	if !service.detected {
+		service.providers = detectProviders()
+		service.detected = true
+
+		log.Info().Strs("providers", providerNames(service.providers)).Msg("hardware telemetry providers detected")
+	}
+
+	report := &Report{Providers: providerNames(service.providers)}
+	for _, provider := range service.providers {
+		if err := provider.Collect(ctx, service.run, report); err != nil {
+			log.Warn().Err(err).Str("provider", provider.Name()).Msg("unable to collect the hardware telemetry")
+		}
+	}
+
+	var previousEvents *uint64
+	if report.Throttling != nil && report.Throttling.Source == sourceX86 {
+		previousEvents = service.lastEvents
+		events := report.Throttling.Events
+		service.lastEvents = &events
+	}
+
+	report.Alerts = raiseAlerts(report, previousEvents, service.temperatureThreshold, service.batteryThreshold)
+
+	service.report = report
+	service.checkedAt = time.Now()
+
+	return report
+}
+
+// readCPUTemperature returns the highest temperature of the CPU thermal zones, or of all the thermal zones when
+// none of them is identified as a CPU zone
+func readCPUTemperature(thermalPath string) *float64 {
+	zones, err := filepath.Glob(filepath.Join(thermalPath, "thermal_zone*"))
+	if err != nil || len(zones) == 0 {
+		return nil
+	}
+
+	var cpu, hottest *float64
+	for _, zone := range zones {
+		milliCelsius, err := strconv.ParseInt(readString(filepath.Join(zone, "temp")), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		celsius := float64(milliCelsius) / 1000
+		if hottest == nil || celsius > *hottest {
+			hottest = &celsius
+		}
+
+		if isCPUZone(readString(filepath.Join(zone, "type"))) && (cpu == nil || celsius > *cpu) {
+			cpu = &celsius
+		}
+	}
+
+	if cpu != nil {
+		return cpu
+	}
+
+	return hottest
+}
+
+func isCPUZone(zoneType string) bool {
+	zoneType = strings.ToLower(zoneType)
+
+	for _, name := range []string{"cpu", "x86_pkg_temp", "soc", "coretemp", "k10temp"} {
+		if strings.Contains(zoneType, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readPowerSupplies returns the power supplies reported by the kernel, the UPS connected with USB HID are reported
+// as well
+func readPowerSupplies(powerSupplyPath string) []PowerSupply {
+	entries, err := os.ReadDir(powerSupplyPath)
+	if err != nil {
+		return nil
+	}
+
+	var supplies []PowerSupply
+	for _, entry := range entries {
+		path := filepath.Join(powerSupplyPath, entry.Name())
+
+		supply := PowerSupply{
+			Name:   entry.Name(),
+			Type:   readString(filepath.Join(path, "type")),
+			Status: readString(filepath.Join(path, "status")),
+		}
+
+		if online, err := strconv.Atoi(readString(filepath.Join(path, "online"))); err == nil {
+			isOnline := online == 1
+			supply.Online = &isOnline
+		}
+
+		if capacity, err := strconv.Atoi(readString(filepath.Join(path, "capacity"))); err == nil {
+			supply.CapacityPercent = &capacity
+		}
+
+		supplies = append(supplies, supply)
+	}
+
+	return supplies
+}
+
+// raiseAlerts returns the alerts of the report, previousEvents is the number of throttling events of the x86 CPU at
+// the previous collection
+func raiseAlerts(report *Report, previousEvents *uint64, temperatureThreshold float64, batteryThreshold int) []string {
+	var alerts []string
+
+	if report.CPUCelsius != nil && temperatureThreshold > 0 && *report.CPUCelsius >= temperatureThreshold {
+		alerts = append(alerts, fmt.Sprintf("CPU temperature at %.1f°C, above the threshold of %.0f°C", *report.CPUCelsius, temperatureThreshold))
+	}
+
+	if throttling := report.Throttling; throttling != nil {
+		if throttling.UnderVoltage {
+			alerts = append(alerts, "under-voltage detected, the power supply of the host is insufficient")
+		}
+
+		if throttling.Throttled || throttling.FrequencyCapped || throttling.SoftTemperatureLimit {
+			alerts = append(alerts, "the CPU of the host is throttled")
+		}
+
+		if previousEvents != nil && throttling.Events > *previousEvents {
+			alerts = append(alerts, fmt.Sprintf("%d thermal throttling events of the CPU since the last check", throttling.Events-*previousEvents))
+		}
+	}
+
+	for _, supply := range report.PowerSupplies {
+		switch supply.Type {
+		case "Battery", "UPS":
+			if supply.Status != "Discharging" {
+				continue
+			}
+
+			alerts = append(alerts, fmt.Sprintf("%s %s is discharging, the host is not powered by the mains", strings.ToLower(supply.Type), supply.Name))
+
+			if supply.CapacityPercent != nil && *supply.CapacityPercent <= batteryThreshold {
+				alerts = append(alerts, fmt.Sprintf("%s %s at %d%%, below the threshold of %d%%", strings.ToLower(supply.Type), supply.Name, *supply.CapacityPercent, batteryThreshold))
+			}
+		}
+	}
+
+	return alerts
+}
+
+func readString(path string) string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(content))
+}
+
+// Diagnostics returns the alerts of the report
+func (report *Report) Diagnostics() []string {
+	if report == nil {
+		return nil
+	}
+
+	return report.Alerts
+}
+
+// Enable makes service the default service used by CurrentStatus
+func Enable(service *Service) {
+	defaultServiceMu.Lock()
+	defer defaultServiceMu.Unlock()
+
+	defaultService = service
+}
+
+// CurrentStatus returns the report of the default service, nil when no service is enabled
+func CurrentStatus(ctx context.Context) *Report {
+	defaultServiceMu.Lock()
+	service := defaultService
+	defaultServiceMu.Unlock()
+
+	if service == nil {
+		return nil
+	}
+
+	return service.Status(ctx)
+}
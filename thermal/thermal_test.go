@@ -0,0 +1,225 @@
+package thermal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadCPUTemperature(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFile(t, filepath.Join(dir, "thermal_zone0", "type"), "acpitz\n")
+	writeFile(t, filepath.Join(dir, "thermal_zone0", "temp"), "91000\n")
+	writeFile(t, filepath.Join(dir, "thermal_zone1", "type"), "x86_pkg_temp\n")
+	writeFile(t, filepath.Join(dir, "thermal_zone1", "temp"), "67500\n")
+
+	celsius := readCPUTemperature(dir)
+	if celsius == nil || *celsius != 67.5 {
+		t.Fatalf("expected the temperature of the CPU zone, got %v", celsius)
+	}
+
+	writeFile(t, filepath.Join(dir, "other", "thermal_zone0", "type"), "acpitz\n")
+	writeFile(t, filepath.Join(dir, "other", "thermal_zone0", "temp"), "45000\n")
+
+	celsius = readCPUTemperature(filepath.Join(dir, "other"))
+	if celsius == nil || *celsius != 45 {
+		t.Fatalf("expected the hottest zone without CPU zone, got %v", celsius)
+	}
+
+	if celsius := readCPUTemperature(filepath.Join(dir, "missing")); celsius != nil {
+		t.Fatalf("expected no temperature without thermal zone, got %v", *celsius)
+	}
+}
+
+func TestParseRaspberryPiThrottled(t *testing.T) {
+	value, ok := parseVcgencmdThrottled("throttled=0x50005\n")
+	if !ok || value != 0x50005 {
+		t.Fatalf("unexpected throttling state %x", value)
+	}
+
+	throttling := parseRaspberryPiThrottled(value)
+
+	expected := &Throttling{
+		Source:            sourceRaspberryPi,
+		UnderVoltage:      true,
+		Throttled:         true,
+		OccurredSinceBoot: []string{"under-voltage", "throttled"},
+	}
+	if !reflect.DeepEqual(throttling, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, throttling)
+	}
+
+	if _, ok := parseVcgencmdThrottled("VCHI initialization failed"); ok {
+		t.Fatal("expected an invalid vcgencmd output to be rejected")
+	}
+}
+
+func TestReadX86Throttling(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFile(t, filepath.Join(dir, "cpu0", "thermal_throttle", "core_throttle_count"), "3\n")
+	writeFile(t, filepath.Join(dir, "cpu1", "thermal_throttle", "core_throttle_count"), "4\n")
+	writeFile(t, filepath.Join(dir, "cpufreq", "boost"), "1\n")
+
+	throttling := readX86Throttling(dir)
+	if throttling == nil || throttling.Source != sourceX86 || throttling.Events != 7 {
+		t.Fatalf("unexpected throttling %+v", throttling)
+	}
+}
+
+func TestReadPowerSupplies(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFile(t, filepath.Join(dir, "AC", "type"), "Mains\n")
+	writeFile(t, filepath.Join(dir, "AC", "online"), "0\n")
+	writeFile(t, filepath.Join(dir, "hid-ups", "type"), "UPS\n")
+	writeFile(t, filepath.Join(dir, "hid-ups", "status"), "Discharging\n")
+	writeFile(t, filepath.Join(dir, "hid-ups", "capacity"), "15\n")
+
+	offline := false
+	capacity := 15
+	expected := []PowerSupply{
+		{Name: "AC", Type: "Mains", Online: &offline},
+		{Name: "hid-ups", Type: "UPS", Status: "Discharging", CapacityPercent: &capacity},
+	}
+
+	supplies := readPowerSupplies(dir)
+	if !reflect.DeepEqual(supplies, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, supplies)
+	}
+}
+
+func TestRaiseAlerts(t *testing.T) {
+	celsius := 85.0
+	capacity := 15
+	previousEvents := uint64(2)
+
+	report := &Report{
+		CPUCelsius: &celsius,
+		Throttling: &Throttling{Source: sourceX86, Events: 5},
+		PowerSupplies: []PowerSupply{
+			{Name: "hid-ups", Type: "UPS", Status: "Discharging", CapacityPercent: &capacity},
+			{Name: "BAT0", Type: "Battery", Status: "Charging", CapacityPercent: &capacity},
+		},
+	}
+
+	expected := []string{
+		"CPU temperature at 85.0°C, above the threshold of 80°C",
+		"3 thermal throttling events of the CPU since the last check",
+		"ups hid-ups is discharging, the host is not powered by the mains",
+		"ups hid-ups at 15%, below the threshold of 20%",
+	}
+	if alerts := raiseAlerts(report, &previousEvents, 80, 20); !reflect.DeepEqual(alerts, expected) {
+		t.Fatalf("expected %v, got %v", expected, alerts)
+	}
+
+	if alerts := raiseAlerts(report, nil, 0, 10); len(alerts) != 1 {
+		t.Fatalf("expected only the discharging alert, got %v", alerts)
+	}
+}
+
+type fakeTelemetry struct {
+	name     string
+	detected bool
+}
+
+func (provider *fakeTelemetry) Name() string {
+	return provider.name
+}
+
+func (provider *fakeTelemetry) Detect() bool {
+	return provider.detected
+}
+
+func (provider *fakeTelemetry) Collect(ctx context.Context, run CommandRunner, report *Report) error {
+	report.Sensors = append(report.Sensors, Sensor{Name: provider.name, Value: 1, Unit: "mW"})
+
+	return nil
+}
+
+func TestRegisterProvider(t *testing.T) {
+	registered := Providers()
+	defer func() {
+		providersMu.Lock()
+		providers = registered
+		providersMu.Unlock()
+	}()
+
+	Register(&fakeTelemetry{name: "board", detected: true})
+	Register(&fakeTelemetry{name: "other", detected: false})
+	Register(&fakeTelemetry{name: "linux", detected: true})
+
+	names := providerNames(Providers())
+	if names[0] != "linux" || names[len(names)-2] != "board" || names[len(names)-1] != "other" {
+		t.Fatalf("expected the providers to keep their registration order, got %v", names)
+	}
+
+	detected := providerNames(detectProviders())
+	expected := []string{"linux", "board"}
+	if !reflect.DeepEqual(detected, expected) {
+		t.Fatalf("expected %v, got %v", expected, detected)
+	}
+}
+
+func TestReadINA3221Rails(t *testing.T) {
+	dir := t.TempDir()
+	hwmon := filepath.Join(dir, "ina3221", "1-0040", "hwmon", "hwmon3")
+
+	writeFile(t, filepath.Join(hwmon, "in1_label"), "VDD_IN\n")
+	writeFile(t, filepath.Join(hwmon, "in1_input"), "5000\n")
+	writeFile(t, filepath.Join(hwmon, "curr1_input"), "1200\n")
+	writeFile(t, filepath.Join(hwmon, "in2_label"), "VDD_CPU_GPU_CV\n")
+	writeFile(t, filepath.Join(hwmon, "in2_input"), "4000\n")
+	writeFile(t, filepath.Join(hwmon, "curr2_input"), "250\n")
+
+	expected := []Sensor{
+		{Name: "VDD_IN", Value: 6000, Unit: "mW"},
+		{Name: "VDD_CPU_GPU_CV", Value: 1000, Unit: "mW"},
+	}
+	if sensors := readINA3221Rails(dir); !reflect.DeepEqual(sensors, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, sensors)
+	}
+}
+
+func TestWindowsTelemetry(t *testing.T) {
+	var zones []windowsThermalZone
+	if err := unmarshalPowerShellJSON([]byte(`{"InstanceName": "ACPI\\ThermalZone\\TZ00_0", "CurrentTemperature": 3231.5}`), &zones); err != nil {
+		t.Fatal(err)
+	}
+
+	celsius, sensors := windowsTemperatures(zones)
+	if celsius == nil || *celsius < 49.99 || *celsius > 50.01 || len(sensors) != 1 || sensors[0].Name != "TZ00_0" {
+		t.Fatalf("unexpected temperatures %v and %+v", celsius, sensors)
+	}
+
+	var batteries []windowsBattery
+	if err := unmarshalPowerShellJSON([]byte(`[{"Name": "UPS", "BatteryStatus": 1, "EstimatedChargeRemaining": 40}]`), &batteries); err != nil {
+		t.Fatal(err)
+	}
+
+	capacity := 40
+	expected := []PowerSupply{{Name: "UPS", Type: "Battery", Status: "Discharging", CapacityPercent: &capacity}}
+	if supplies := windowsPowerSupplies(batteries); !reflect.DeepEqual(supplies, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, supplies)
+	}
+
+	batteries = nil
+	if err := unmarshalPowerShellJSON([]byte("\r\n"), &batteries); err != nil || batteries != nil {
+		t.Fatalf("expected no battery for an empty output, got %+v and %v", batteries, err)
+	}
+}
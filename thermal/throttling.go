@@ -0,0 +1,118 @@
+package thermal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Sources of the throttling state
+const (
+	sourceRaspberryPi = "raspberrypi"
+	sourceX86         = "x86"
+)
+
+// Bits of the throttling state reported by the firmware of the Raspberry Pi, the conditions that occurred since the
+// boot are reported 16 bits higher
+const (
+	throttledUnderVoltage    = 1 << 0
+	throttledFrequencyCapped = 1 << 1
+	throttledThrottled       = 1 << 2
+	throttledSoftTempLimit   = 1 << 3
+	throttledOccurredShift   = 16
+)
+
+var throttledConditions = []struct {
+	bit  uint64
+	name string
+}{
+	{throttledUnderVoltage, "under-voltage"},
+	{throttledFrequencyCapped, "frequency capped"},
+	{throttledThrottled, "throttled"},
+	{throttledSoftTempLimit, "soft temperature limit"},
+}
+
+// raspberryPiThrottled returns the throttling state of the Raspberry Pi, read from the firmware sysfs attribute or
+// with vcgencmd on the host
+func raspberryPiThrottled(ctx context.Context, run CommandRunner) (uint64, bool) {
+	if value, err := strconv.ParseUint(readString(filepath.Join(sysPath, "devices", "platform", "soc", "soc:firmware", "get_throttled")), 16, 64); err == nil {
+		return value, true
+	}
+
+	if !installed("vcgencmd") {
+		return 0, false
+	}
+
+	output, err := run(ctx, []string{"vcgencmd", "get_throttled"})
+	if err != nil {
+		log.Debug().Err(err).Msg("unable to retrieve the throttling state with vcgencmd")
+
+		return 0, false
+	}
+
+	return parseVcgencmdThrottled(string(output))
+}
+
+// parseVcgencmdThrottled parses the output of vcgencmd get_throttled, e.g. throttled=0x50005
+func parseVcgencmdThrottled(output string) (uint64, bool) {
+	_, value, found := strings.Cut(strings.TrimSpace(output), "=")
+	if !found {
+		return 0, false
+	}
+
+	throttled, err := strconv.ParseUint(strings.TrimPrefix(value, "0x"), 16, 64)
+
+	return throttled, err == nil
+}
+
+func parseRaspberryPiThrottled(value uint64) *Throttling {
+	throttling := &Throttling{
+		Source:               sourceRaspberryPi,
+		UnderVoltage:         value&throttledUnderVoltage != 0,
+		FrequencyCapped:      value&throttledFrequencyCapped != 0,
+		Throttled:            value&throttledThrottled != 0,
+		SoftTemperatureLimit: value&throttledSoftTempLimit != 0,
+	}
+
+	for _, condition := range throttledConditions {
+		if value&(condition.bit<<throttledOccurredShift) != 0 {
+			throttling.OccurredSinceBoot = append(throttling.OccurredSinceBoot, condition.name)
+		}
+	}
+
+	return throttling
+}
+
+// readX86Throttling sums the thermal throttling events of the cores of the CPU since the boot
+func readX86Throttling(cpuPath string) *Throttling {
+	counters, err := filepath.Glob(filepath.Join(cpuPath, "cpu[0-9]*", "thermal_throttle", "core_throttle_count"))
+	if err != nil || len(counters) == 0 {
+		return nil
+	}
+
+	throttling := &Throttling{Source: sourceX86}
+	for _, counter := range counters {
+		count, err := strconv.ParseUint(readString(counter), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		throttling.Events += count
+	}
+
+	return throttling
+}
+
+func installed(binary string) bool {
+	for _, path := range binaryPaths {
+		if _, err := os.Stat(filepath.Join(hostRoot, path, binary)); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
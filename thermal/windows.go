@@ -0,0 +1,136 @@
+package thermal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Queries of the WMI classes reporting the ACPI thermal zones and the batteries of a Windows host
+const (
+	windowsThermalZonesQuery = "Get-CimInstance -Namespace root/wmi -ClassName MSAcpi_ThermalZoneTemperature | Select-Object InstanceName,CurrentTemperature | ConvertTo-Json"
+	windowsBatteriesQuery    = "Get-CimInstance -ClassName Win32_Battery | Select-Object Name,BatteryStatus,EstimatedChargeRemaining | ConvertTo-Json"
+)
+
+// windowsTelemetry reports the ACPI thermal zones and the batteries of a Windows host, queried with PowerShell from
+// the agent container which shares the kernel of the host
+type windowsTelemetry struct{}
+
+type windowsThermalZone struct {
+	InstanceName string
+	// CurrentTemperature is in tenths of Kelvin
+	CurrentTemperature float64
+}
+
+type windowsBattery struct {
+	Name                     string
+	BatteryStatus            int
+	EstimatedChargeRemaining *int
+}
+
+func (provider *windowsTelemetry) Name() string {
+	return "windows"
+}
+
+func (provider *windowsTelemetry) Detect() bool {
+	return runtime.GOOS == "windows"
+}
+
+func (provider *windowsTelemetry) Collect(ctx context.Context, run CommandRunner, report *Report) error {
+	output, err := powershell(ctx, windowsThermalZonesQuery)
+	if err != nil {
+		return err
+	}
+
+	var zones []windowsThermalZone
+	if err := unmarshalPowerShellJSON(output, &zones); err != nil {
+		return fmt.Errorf("unable to parse the thermal zones: %w", err)
+	}
+
+	report.CPUCelsius, report.Sensors = windowsTemperatures(zones)
+
+	output, err = powershell(ctx, windowsBatteriesQuery)
+	if err != nil {
+		return err
+	}
+
+	var batteries []windowsBattery
+	if err := unmarshalPowerShellJSON(output, &batteries); err != nil {
+		return fmt.Errorf("unable to parse the batteries: %w", err)
+	}
+
+	report.PowerSupplies = windowsPowerSupplies(batteries)
+
+	return nil
+}
+
+func powershell(ctx context.Context, command string) ([]byte, error) {
+	output, err := exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", command).Output()
+	if err != nil {
+		return nil, fmt.Errorf("unable to execute the PowerShell query: %w", err)
+	}
+
+	return output, nil
+}
+
+// unmarshalPowerShellJSON parses the output of ConvertTo-Json into v, a pointer to a slice, as a single object is not
+// wrapped in an array and an empty result produces no output
+func unmarshalPowerShellJSON(output []byte, v interface{}) error {
+	output = bytes.TrimSpace(output)
+	if len(output) == 0 {
+		return nil
+	}
+
+	if output[0] != '[' {
+		output = append(append([]byte("["), output...), ']')
+	}
+
+	return json.Unmarshal(output, v)
+}
+
+// windowsTemperatures returns the highest temperature of the thermal zones, used as the CPU temperature as the zones
+// are not identified on Windows, and the temperature of each zone
+func windowsTemperatures(zones []windowsThermalZone) (*float64, []Sensor) {
+	var hottest *float64
+	var sensors []Sensor
+	for _, zone := range zones {
+		celsius := zone.CurrentTemperature/10 - 273.15
+		if hottest == nil || celsius > *hottest {
+			hottest = &celsius
+		}
+
+		// the instance names look like ACPI\ThermalZone\TZ00_0
+		name := zone.InstanceName[strings.LastIndex(zone.InstanceName, `\`)+1:]
+		sensors = append(sensors, Sensor{Name: name, Value: celsius, Unit: "°C"})
+	}
+
+	return hottest, sensors
+}
+
+// windowsPowerSupplies converts the batteries to power supplies, the values of BatteryStatus are documented by the
+// Win32_Battery class
+func windowsPowerSupplies(batteries []windowsBattery) []PowerSupply {
+	var supplies []PowerSupply
+	for _, battery := range batteries {
+		supply := PowerSupply{Name: battery.Name, Type: "Battery", CapacityPercent: battery.EstimatedChargeRemaining}
+
+		switch battery.BatteryStatus {
+		case 1, 4, 5:
+			supply.Status = "Discharging"
+		case 2:
+			supply.Status = "Not charging"
+		case 3:
+			supply.Status = "Full"
+		case 6, 7, 8, 9:
+			supply.Status = "Charging"
+		}
+
+		supplies = append(supplies, supply)
+	}
+
+	return supplies
+}
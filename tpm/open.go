@@ -0,0 +1,13 @@
+//go:build !windows
+
+package tpm
+
+import "github.com/google/go-tpm/tpm2/transport"
+
+func openTransport(path string) (transport.TPMCloser, error) {
+	if path == "" {
+		return transport.OpenTPM()
+	}
+
+	return transport.OpenTPM(path)
+}
@@ -0,0 +1,8 @@
+package tpm
+
+import "github.com/google/go-tpm/tpm2/transport"
+
+// openTransport opens the TPM through the TPM Base Services, the path is ignored on Windows
+func openTransport(_ string) (transport.TPMCloser, error) {
+	return transport.OpenTPM()
+}
@@ -0,0 +1,100 @@
+package tpm
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+)
+
+// ErrInvalidSealedData is returned when the data to unseal was not returned by Seal
+var ErrInvalidSealedData = errors.New("invalid sealed data")
+
+// secretSealer seals the small secrets, implemented by Device
+type secretSealer interface {
+	SealSecret(secret []byte) (*KeyBlob, error)
+	UnsealSecret(blob *KeyBlob) ([]byte, error)
+}
+
+type sealedData struct {
+	Key        KeyBlob `json:"Key"`
+	Nonce      []byte  `json:"Nonce"`
+	Ciphertext []byte  `json:"Ciphertext"`
+}
+
+// Seal encrypts data of any size with a random AES-256-GCM key sealed by the TPM, the result can only be decrypted by
+// Unseal on the same TPM
+func (device *Device) Seal(data []byte) ([]byte, error) {
+	return seal(device, data)
+}
+
+// Unseal returns the data encrypted by Seal
+func (device *Device) Unseal(sealed []byte) ([]byte, error) {
+	return unseal(device, sealed)
+}
+
+func seal(sealer secretSealer, data []byte) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	blob, err := sealer.SealSecret(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(sealedData{
+		Key:        *blob,
+		Nonce:      nonce,
+		Ciphertext: gcm.Seal(nil, nonce, data, nil),
+	})
+}
+
+func unseal(sealer secretSealer, sealed []byte) ([]byte, error) {
+	var data sealedData
+	if err := json.Unmarshal(sealed, &data); err != nil {
+		return nil, ErrInvalidSealedData
+	}
+
+	key, err := sealer.UnsealSecret(&data.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data.Nonce) != gcm.NonceSize() {
+		return nil, ErrInvalidSealedData
+	}
+
+	plaintext, err := gcm.Open(nil, data.Nonce, data.Ciphertext, nil)
+	if err != nil {
+		return nil, ErrInvalidSealedData
+	}
+
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
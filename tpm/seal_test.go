@@ -0,0 +1,59 @@
+package tpm
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fakeSealer keeps the sealed secrets in memory, the private part of a blob is the index of the secret
+type fakeSealer struct {
+	secrets [][]byte
+}
+
+func (sealer *fakeSealer) SealSecret(secret []byte) (*KeyBlob, error) {
+	sealer.secrets = append(sealer.secrets, append([]byte(nil), secret...))
+
+	return &KeyBlob{Public: []byte("public"), Private: []byte{byte(len(sealer.secrets) - 1)}}, nil
+}
+
+func (sealer *fakeSealer) UnsealSecret(blob *KeyBlob) ([]byte, error) {
+	if len(blob.Private) != 1 || int(blob.Private[0]) >= len(sealer.secrets) {
+		return nil, errors.New("unknown blob")
+	}
+
+	return sealer.secrets[blob.Private[0]], nil
+}
+
+func TestSealUnseal(t *testing.T) {
+	sealer := &fakeSealer{}
+	data := []byte(strings.Repeat("edge key larger than the sealed data limit|", 10))
+
+	sealed, err := seal(sealer, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(sealed, data) || len(sealer.secrets) != 1 || len(sealer.secrets[0]) != 32 {
+		t.Fatal("expected the data to be encrypted with a sealed 32 bytes key")
+	}
+
+	unsealed, err := unseal(sealer, sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(unsealed, data) {
+		t.Errorf("expected the unsealed data to match, got %q", unsealed)
+	}
+
+	sealer.secrets[0][0] ^= 0xff
+	if _, err := unseal(sealer, sealed); !errors.Is(err, ErrInvalidSealedData) {
+		t.Errorf("expected the data not to be decrypted with another key, got %v", err)
+	}
+
+	if _, err := unseal(sealer, []byte("plain text")); !errors.Is(err, ErrInvalidSealedData) {
+		t.Errorf("expected an error for data that was not sealed, got %v", err)
+	}
+}
@@ -0,0 +1,294 @@
+// Package tpm stores the key material of the agent in a TPM 2.0: the signing keys are generated inside the TPM and the
+// secrets are sealed by it. The files written by the agent only contain blobs wrapped by the storage root key of the
+// TPM, so that the device identity and the Edge credentials cannot be used by copying the filesystem of the host.
+package tpm
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// maxSealedSize is the size of the largest secret sealed directly by the TPM, TPM2B_SENSITIVE_DATA is limited to 128
+// bytes
+const maxSealedSize = 128
+
+var (
+	defaultDevice   *Device
+	defaultDeviceMu sync.Mutex
+)
+
+// KeyBlob is an object created by the TPM under its storage root key. Private is encrypted by the TPM and can only be
+// loaded in the TPM that created it.
+type KeyBlob struct {
+	Public  []byte `json:"Public"`
+	Private []byte `json:"Private"`
+}
+
+// Device is a connection to a TPM 2.0, the commands are serialized
+type Device struct {
+	mu        sync.Mutex
+	transport transport.TPMCloser
+	srk       tpm2.NamedHandle
+}
+
+// Open opens the TPM at path and creates its storage root key, the default TPM of the platform is used when path is
+// empty
+func Open(path string) (*Device, error) {
+	t, err := openTransport(path)
+	if err != nil {
+		return nil, err
+	}
+
+	srk, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InPublic:      tpm2.New2B(tpm2.ECCSRKTemplate),
+	}.Execute(t)
+	if err != nil {
+		t.Close()
+
+		return nil, fmt.Errorf("unable to create the storage root key: %w", err)
+	}
+
+	return &Device{
+		transport: t,
+		srk:       tpm2.NamedHandle{Handle: srk.ObjectHandle, Name: srk.Name},
+	}, nil
+}
+
+// Enable makes device the TPM storing the key material of the agent
+func Enable(device *Device) {
+	defaultDeviceMu.Lock()
+	defer defaultDeviceMu.Unlock()
+
+	defaultDevice = device
+}
+
+// DefaultDevice returns the enabled TPM, nil when the key material is stored in files
+func DefaultDevice() *Device {
+	defaultDeviceMu.Lock()
+	defer defaultDeviceMu.Unlock()
+
+	return defaultDevice
+}
+
+// Close flushes the storage root key and closes the connection to the TPM
+func (device *Device) Close() error {
+	device.mu.Lock()
+	defer device.mu.Unlock()
+
+	tpm2.FlushContext{FlushHandle: device.srk.Handle}.Execute(device.transport)
+
+	return device.transport.Close()
+}
+
+// CreateSigningKey generates a P-256 ECDSA key inside the TPM, the returned blob is persisted to load the key with
+// LoadSigningKey
+func (device *Device) CreateSigningKey() (*KeyBlob, error) {
+	device.mu.Lock()
+	defer device.mu.Unlock()
+
+	created, err := tpm2.Create{
+		ParentHandle: device.parent(),
+		InPublic:     tpm2.New2B(signingKeyTemplate),
+	}.Execute(device.transport)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the signing key: %w", err)
+	}
+
+	return &KeyBlob{Public: created.OutPublic.Bytes(), Private: created.OutPrivate.Buffer}, nil
+}
+
+// LoadSigningKey loads a key created with CreateSigningKey, the key stays loaded until the TPM is closed
+func (device *Device) LoadSigningKey(blob *KeyBlob) (crypto.Signer, error) {
+	handle, err := device.load(blob)
+	if err != nil {
+		return nil, err
+	}
+
+	public := tpm2.BytesAs2B[tpm2.TPMTPublic](blob.Public)
+
+	contents, err := public.Contents()
+	if err != nil {
+		return nil, err
+	}
+
+	point, err := contents.Unique.ECC()
+	if err != nil {
+		return nil, err
+	}
+
+	return &signer{
+		device: device,
+		handle: handle,
+		publicKey: &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(point.X.Buffer),
+			Y:     new(big.Int).SetBytes(point.Y.Buffer),
+		},
+	}, nil
+}
+
+// SealSecret seals a secret of up to 128 bytes with the TPM, it is only returned by UnsealSecret on the same TPM
+func (device *Device) SealSecret(secret []byte) (*KeyBlob, error) {
+	if len(secret) > maxSealedSize {
+		return nil, fmt.Errorf("the secret must not exceed %d bytes, use Seal", maxSealedSize)
+	}
+
+	device.mu.Lock()
+	defer device.mu.Unlock()
+
+	created, err := tpm2.Create{
+		ParentHandle: device.parent(),
+		InSensitive: tpm2.TPM2BSensitiveCreate{
+			Sensitive: &tpm2.TPMSSensitiveCreate{
+				Data: tpm2.NewTPMUSensitiveCreate(&tpm2.TPM2BSensitiveData{Buffer: secret}),
+			},
+		},
+		InPublic: tpm2.New2B(sealedDataTemplate),
+	}.Execute(device.transport)
+	if err != nil {
+		return nil, fmt.Errorf("unable to seal the secret: %w", err)
+	}
+
+	return &KeyBlob{Public: created.OutPublic.Bytes(), Private: created.OutPrivate.Buffer}, nil
+}
+
+// UnsealSecret returns the secret sealed with SealSecret
+func (device *Device) UnsealSecret(blob *KeyBlob) ([]byte, error) {
+	handle, err := device.load(blob)
+	if err != nil {
+		return nil, err
+	}
+
+	device.mu.Lock()
+	defer device.mu.Unlock()
+
+	defer tpm2.FlushContext{FlushHandle: handle.Handle}.Execute(device.transport)
+
+	unsealed, err := tpm2.Unseal{
+		ItemHandle: tpm2.AuthHandle{Handle: handle.Handle, Name: handle.Name, Auth: tpm2.PasswordAuth(nil)},
+	}.Execute(device.transport)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unseal the secret: %w", err)
+	}
+
+	return unsealed.OutData.Buffer, nil
+}
+
+func (device *Device) load(blob *KeyBlob) (tpm2.NamedHandle, error) {
+	if blob == nil || len(blob.Public) == 0 || len(blob.Private) == 0 {
+		return tpm2.NamedHandle{}, errors.New("invalid TPM key blob")
+	}
+
+	device.mu.Lock()
+	defer device.mu.Unlock()
+
+	loaded, err := tpm2.Load{
+		ParentHandle: device.parent(),
+		InPrivate:    tpm2.TPM2BPrivate{Buffer: blob.Private},
+		InPublic:     tpm2.BytesAs2B[tpm2.TPMTPublic](blob.Public),
+	}.Execute(device.transport)
+	if err != nil {
+		return tpm2.NamedHandle{}, fmt.Errorf("unable to load the key in the TPM, it was probably created by another TPM: %w", err)
+	}
+
+	return tpm2.NamedHandle{Handle: loaded.ObjectHandle, Name: loaded.Name}, nil
+}
+
+func (device *Device) parent() tpm2.AuthHandle {
+	return tpm2.AuthHandle{Handle: device.srk.Handle, Name: device.srk.Name, Auth: tpm2.PasswordAuth(nil)}
+}
+
+// signer signs the digests with a key loaded in the TPM, it implements crypto.Signer
+type signer struct {
+	device    *Device
+	handle    tpm2.NamedHandle
+	publicKey *ecdsa.PublicKey
+}
+
+func (s *signer) Public() crypto.PublicKey {
+	return s.publicKey
+}
+
+// Sign signs a SHA-256 digest, the signature is ASN.1 encoded as returned by ecdsa.PrivateKey.Sign
+func (s *signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.SHA256 {
+		return nil, errors.New("the TPM signing key only signs SHA-256 digests")
+	}
+
+	s.device.mu.Lock()
+	defer s.device.mu.Unlock()
+
+	signed, err := tpm2.Sign{
+		KeyHandle: tpm2.AuthHandle{Handle: s.handle.Handle, Name: s.handle.Name, Auth: tpm2.PasswordAuth(nil)},
+		Digest:    tpm2.TPM2BDigest{Buffer: digest},
+		InScheme: tpm2.TPMTSigScheme{
+			Scheme:  tpm2.TPMAlgECDSA,
+			Details: tpm2.NewTPMUSigScheme(tpm2.TPMAlgECDSA, &tpm2.TPMSSchemeHash{HashAlg: tpm2.TPMAlgSHA256}),
+		},
+		Validation: tpm2.TPMTTKHashCheck{Tag: tpm2.TPMSTHashCheck, Hierarchy: tpm2.TPMRHNull},
+	}.Execute(s.device.transport)
+	if err != nil {
+		return nil, fmt.Errorf("unable to sign with the TPM: %w", err)
+	}
+
+	signature, err := signed.Signature.Signature.ECDSA()
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(struct{ R, S *big.Int }{
+		R: new(big.Int).SetBytes(signature.SignatureR.Buffer),
+		S: new(big.Int).SetBytes(signature.SignatureS.Buffer),
+	})
+}
+
+// signingKeyTemplate is a non-exportable P-256 ECDSA signing key
+var signingKeyTemplate = tpm2.TPMTPublic{
+	Type:    tpm2.TPMAlgECC,
+	NameAlg: tpm2.TPMAlgSHA256,
+	ObjectAttributes: tpm2.TPMAObject{
+		FixedTPM:            true,
+		FixedParent:         true,
+		SensitiveDataOrigin: true,
+		UserWithAuth:        true,
+		NoDA:                true,
+		SignEncrypt:         true,
+	},
+	Parameters: tpm2.NewTPMUPublicParms(tpm2.TPMAlgECC, &tpm2.TPMSECCParms{
+		Symmetric: tpm2.TPMTSymDefObject{Algorithm: tpm2.TPMAlgNull},
+		Scheme: tpm2.TPMTECCScheme{
+			Scheme:  tpm2.TPMAlgECDSA,
+			Details: tpm2.NewTPMUAsymScheme(tpm2.TPMAlgECDSA, &tpm2.TPMSSigSchemeECDSA{HashAlg: tpm2.TPMAlgSHA256}),
+		},
+		CurveID: tpm2.TPMECCNistP256,
+		KDF:     tpm2.TPMTKDFScheme{Scheme: tpm2.TPMAlgNull},
+	}),
+	Unique: tpm2.NewTPMUPublicID(tpm2.TPMAlgECC, &tpm2.TPMSECCPoint{}),
+}
+
+// sealedDataTemplate is a data object which can only be unsealed in the TPM
+var sealedDataTemplate = tpm2.TPMTPublic{
+	Type:    tpm2.TPMAlgKeyedHash,
+	NameAlg: tpm2.TPMAlgSHA256,
+	ObjectAttributes: tpm2.TPMAObject{
+		FixedTPM:     true,
+		FixedParent:  true,
+		UserWithAuth: true,
+		NoDA:         true,
+	},
+	Parameters: tpm2.NewTPMUPublicParms(tpm2.TPMAlgKeyedHash, &tpm2.TPMSKeyedHashParms{
+		Scheme: tpm2.TPMTKeyedHashScheme{Scheme: tpm2.TPMAlgNull},
+	}),
+	Unique: tpm2.NewTPMUPublicID(tpm2.TPMAlgKeyedHash, &tpm2.TPM2BDigest{}),
+}
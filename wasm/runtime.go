@@ -0,0 +1,456 @@
+// Package wasm runs the sandboxed WebAssembly plugins of the agent. A plugin is a WASI module (*.wasm) located in the
+// plugins folder, it can add a collector to the snapshots, transform the snapshots before they are sent and handle
+// additional Edge async commands, without rebuilding the agent. The plugins have no access to the filesystem, the
+// network or the environment of the agent, their memory is bounded and each call is executed in a fresh instance of
+// the module, interrupted after the call timeout.
+//
+// The plugins exchange JSON documents with the agent through their linear memory. A document returned by a plugin is
+// packed in an i64 as (pointer << 32) | length, a zero length meaning no document. The exported functions are:
+//
+//	portainer_alloc(size i32) i32                    allocates size bytes for a document sent by the agent
+//	portainer_collect() i64                          returns the data added to the snapshots under the plugin name
+//	portainer_transform(ptr i32, len i32) i64        returns the transformed snapshot, or nothing to keep it
+//	portainer_commands() i64                         returns the JSON array of the command types handled by the plugin
+//	portainer_handle(typ i32, typLen i32, ptr i32, len i32) i64
+//	                                                 executes a command, returns an error message on failure
+//
+// The agent exposes portainer.log(level i32, ptr i32, len i32) to the plugins, the level is 0 (debug), 1 (info),
+// 2 (warning) or 3 (error).
+package wasm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+const (
+	allocFunction     = "portainer_alloc"
+	collectFunction   = "portainer_collect"
+	transformFunction = "portainer_transform"
+	commandsFunction  = "portainer_commands"
+	handleFunction    = "portainer_handle"
+
+	// hostModuleName is the name of the module of the functions exposed by the agent to the plugins
+	hostModuleName = "portainer"
+)
+
+// memoryLimitPages bounds the memory of each plugin instance to 64MB
+const memoryLimitPages = 1024
+
+var (
+	defaultRuntime   *Runtime
+	defaultRuntimeMu sync.Mutex
+)
+
+// pluginNameKey is the context key of the name of the plugin being called, used by the host functions
+type pluginNameKey struct{}
+
+// Runtime runs the WebAssembly plugins loaded from the plugins folder
+type Runtime struct {
+	runtime wazero.Runtime
+	timeout time.Duration
+	plugins []*Plugin
+
+	mu sync.Mutex
+	// failures are the last errors of the plugins, by plugin name
+	failures map[string]string
+}
+
+// Plugin is a WebAssembly plugin compiled by the runtime
+type Plugin struct {
+	// Name is the file name of the plugin without the .wasm extension
+	Name string
+	// Commands are the types of the commands handled by the plugin
+	Commands []string
+
+	runtime  *Runtime
+	compiled wazero.CompiledModule
+	exports  map[string]api.FunctionDefinition
+}
+
+// NewRuntime returns a pointer to a Runtime running the plugins (*.wasm files) located in dir, each call to a plugin
+// is interrupted after timeout
+func NewRuntime(ctx context.Context, dir string, timeout time.Duration) (*Runtime, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("unable to access the WebAssembly plugins folder: %w", err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.wasm"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	config := wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(memoryLimitPages).
+		WithCloseOnContextDone(true)
+
+	runtime := &Runtime{
+		runtime:  wazero.NewRuntimeWithConfig(ctx, config),
+		timeout:  timeout,
+		failures: map[string]string{},
+	}
+
+	if err := runtime.instantiateHostModules(ctx); err != nil {
+		runtime.Close(ctx)
+
+		return nil, err
+	}
+
+	for _, path := range paths {
+		plugin, err := runtime.load(ctx, path)
+		if err != nil {
+			runtime.Close(ctx)
+
+			return nil, fmt.Errorf("unable to load the WebAssembly plugin %s: %w", path, err)
+		}
+
+		runtime.plugins = append(runtime.plugins, plugin)
+
+		log.Info().Str("plugin", plugin.Name).Strs("commands", plugin.Commands).Bool("collector", plugin.exports[collectFunction] != nil).Bool("transform", plugin.exports[transformFunction] != nil).Msg("WebAssembly plugin loaded")
+	}
+
+	return runtime, nil
+}
+
+// Enable makes runtime the runtime of the plugins used by the snapshots
+func Enable(runtime *Runtime) {
+	defaultRuntimeMu.Lock()
+	defer defaultRuntimeMu.Unlock()
+
+	defaultRuntime = runtime
+}
+
+// DefaultRuntime returns the enabled runtime, nil when the WebAssembly plugins are disabled
+func DefaultRuntime() *Runtime {
+	defaultRuntimeMu.Lock()
+	defer defaultRuntimeMu.Unlock()
+
+	return defaultRuntime
+}
+
+// Close releases the compiled plugins and the runtime
+func (runtime *Runtime) Close(ctx context.Context) error {
+	return runtime.runtime.Close(ctx)
+}
+
+// Plugins returns the loaded plugins
+func (runtime *Runtime) Plugins() []*Plugin {
+	if runtime == nil {
+		return nil
+	}
+
+	return runtime.plugins
+}
+
+// Transforms returns true when a plugin exports a transform
+func (runtime *Runtime) Transforms() bool {
+	for _, plugin := range runtime.Plugins() {
+		if plugin.exports[transformFunction] != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Collect returns the data collected by the plugins exporting a collector, by plugin name. The plugins that fail are
+// reported in the diagnostics and omitted.
+func (runtime *Runtime) Collect(ctx context.Context) map[string]json.RawMessage {
+	if runtime == nil {
+		return nil
+	}
+
+	collected := map[string]json.RawMessage{}
+
+	for _, plugin := range runtime.plugins {
+		if plugin.exports[collectFunction] == nil {
+			continue
+		}
+
+		data, err := plugin.call(ctx, collectFunction)
+		if err == nil && len(data) > 0 && !json.Valid(data) {
+			err = errors.New("the collected data is not a valid JSON document")
+		}
+
+		runtime.record(plugin, err)
+		if err != nil || len(data) == 0 {
+			continue
+		}
+
+		collected[plugin.Name] = data
+	}
+
+	if len(collected) == 0 {
+		return nil
+	}
+
+	return collected
+}
+
+// Transform returns the document transformed by the plugins exporting a transform, in the order of their names. A
+// plugin that fails or returns nothing leaves the document unchanged.
+func (runtime *Runtime) Transform(ctx context.Context, document []byte) []byte {
+	if runtime == nil {
+		return document
+	}
+
+	for _, plugin := range runtime.plugins {
+		if plugin.exports[transformFunction] == nil {
+			continue
+		}
+
+		transformed, err := plugin.call(ctx, transformFunction, document)
+		if err == nil && len(transformed) > 0 && !json.Valid(transformed) {
+			err = errors.New("the transformed document is not a valid JSON document")
+		}
+
+		runtime.record(plugin, err)
+		if err != nil || len(transformed) == 0 {
+			continue
+		}
+
+		document = transformed
+	}
+
+	return document
+}
+
+// Diagnostics returns the last failures of the plugins
+func (runtime *Runtime) Diagnostics() []string {
+	if runtime == nil {
+		return nil
+	}
+
+	runtime.mu.Lock()
+	defer runtime.mu.Unlock()
+
+	diagnostics := make([]string, 0, len(runtime.failures))
+	for name, failure := range runtime.failures {
+		diagnostics = append(diagnostics, fmt.Sprintf("the WebAssembly plugin %s failed: %s", name, failure))
+	}
+	sort.Strings(diagnostics)
+
+	return diagnostics
+}
+
+// Handle executes the command of type commandType whose JSON encoding is cmd
+func (plugin *Plugin) Handle(ctx context.Context, commandType string, cmd []byte) error {
+	message, err := plugin.call(ctx, handleFunction, []byte(commandType), cmd)
+	if err == nil && len(message) > 0 {
+		err = errors.New(string(message))
+	}
+
+	plugin.runtime.record(plugin, err)
+
+	return err
+}
+
+func (runtime *Runtime) record(plugin *Plugin, err error) {
+	runtime.mu.Lock()
+	defer runtime.mu.Unlock()
+
+	if err == nil {
+		delete(runtime.failures, plugin.Name)
+
+		return
+	}
+
+	log.Warn().Str("plugin", plugin.Name).Err(err).Msg("WebAssembly plugin failure")
+
+	runtime.failures[plugin.Name] = err.Error()
+}
+
+// instantiateHostModules instantiates WASI, without access to the filesystem, the environment or the arguments of the
+// agent, and the functions exposed by the agent to the plugins
+func (runtime *Runtime) instantiateHostModules(ctx context.Context) error {
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime.runtime); err != nil {
+		return err
+	}
+
+	_, err := runtime.runtime.NewHostModuleBuilder(hostModuleName).
+		NewFunctionBuilder().WithFunc(hostLog).Export("log").
+		Instantiate(ctx)
+
+	return err
+}
+
+func (runtime *Runtime) load(ctx context.Context, path string) (*Plugin, error) {
+	binary, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	compiled, err := runtime.runtime.CompileModule(ctx, binary)
+	if err != nil {
+		return nil, err
+	}
+
+	plugin := &Plugin{
+		Name:     strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		runtime:  runtime,
+		compiled: compiled,
+		exports:  compiled.ExportedFunctions(),
+	}
+
+	if err := plugin.checkExports(); err != nil {
+		return nil, err
+	}
+
+	if plugin.exports[commandsFunction] != nil {
+		commands, err := plugin.call(ctx, commandsFunction)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(commands, &plugin.Commands); err != nil {
+			return nil, fmt.Errorf("invalid command types: %w", err)
+		}
+	}
+
+	return plugin, nil
+}
+
+// signatures are the parameter and the result types of the functions of the plugins ABI
+var signatures = map[string][2][]api.ValueType{
+	allocFunction:     {{api.ValueTypeI32}, {api.ValueTypeI32}},
+	collectFunction:   {nil, {api.ValueTypeI64}},
+	transformFunction: {{api.ValueTypeI32, api.ValueTypeI32}, {api.ValueTypeI64}},
+	commandsFunction:  {nil, {api.ValueTypeI64}},
+	handleFunction:    {{api.ValueTypeI32, api.ValueTypeI32, api.ValueTypeI32, api.ValueTypeI32}, {api.ValueTypeI64}},
+}
+
+// checkExports returns an error when the functions of the ABI exported by the plugin have an unexpected signature,
+// or when the plugin does not export anything useful to the agent
+func (plugin *Plugin) checkExports() error {
+	for name, signature := range signatures {
+		definition := plugin.exports[name]
+		if definition == nil {
+			continue
+		}
+
+		if !sameTypes(definition.ParamTypes(), signature[0]) || !sameTypes(definition.ResultTypes(), signature[1]) {
+			return fmt.Errorf("invalid signature of %s", name)
+		}
+	}
+
+	if plugin.exports[collectFunction] == nil && plugin.exports[transformFunction] == nil && plugin.exports[handleFunction] == nil {
+		return fmt.Errorf("the plugin exports none of %s, %s and %s", collectFunction, transformFunction, handleFunction)
+	}
+
+	if (plugin.exports[transformFunction] != nil || plugin.exports[handleFunction] != nil) && plugin.exports[allocFunction] == nil {
+		return fmt.Errorf("the plugin must export %s to receive documents", allocFunction)
+	}
+
+	if (plugin.exports[handleFunction] != nil) != (plugin.exports[commandsFunction] != nil) {
+		return fmt.Errorf("%s and %s must be exported together", handleFunction, commandsFunction)
+	}
+
+	return nil
+}
+
+// call calls function in a fresh instance of the plugin with the documents inputs, passed as pointer and length
+// pairs, and returns the document returned by the function
+func (plugin *Plugin) call(ctx context.Context, function string, inputs ...[]byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, plugin.runtime.timeout)
+	defer cancel()
+
+	ctx = context.WithValue(ctx, pluginNameKey{}, plugin.Name)
+
+	config := wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize")
+
+	module, err := plugin.runtime.runtime.InstantiateModule(ctx, plugin.compiled, config)
+	if err != nil {
+		return nil, err
+	}
+	defer module.Close(context.Background())
+
+	params := make([]uint64, 0, 2*len(inputs))
+	for _, input := range inputs {
+		results, err := module.ExportedFunction(allocFunction).Call(ctx, uint64(len(input)))
+		if err != nil {
+			return nil, err
+		}
+
+		ptr := uint32(results[0])
+		if !module.Memory().Write(ptr, input) {
+			return nil, fmt.Errorf("%s returned an address out of the memory of the plugin", allocFunction)
+		}
+
+		params = append(params, uint64(ptr), uint64(len(input)))
+	}
+
+	results, err := module.ExportedFunction(function).Call(ctx, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	ptr, size := unpack(results[0])
+	if size == 0 {
+		return nil, nil
+	}
+
+	output, ok := module.Memory().Read(ptr, size)
+	if !ok {
+		return nil, fmt.Errorf("%s returned a document out of the memory of the plugin", function)
+	}
+
+	// the memory of the instance is released when the module is closed
+	return append([]byte(nil), output...), nil
+}
+
+// hostLog logs the message written by a plugin in its memory
+func hostLog(ctx context.Context, module api.Module, level, ptr, size uint32) {
+	message, ok := module.Memory().Read(ptr, size)
+	if !ok {
+		return
+	}
+
+	name, _ := ctx.Value(pluginNameKey{}).(string)
+
+	event := log.Debug()
+	switch level {
+	case 1:
+		event = log.Info()
+	case 2:
+		event = log.Warn()
+	case 3:
+		event = log.Error()
+	}
+
+	event.Str("plugin", name).Msg(string(message))
+}
+
+// unpack returns the pointer and the length of a document packed in an i64 by a plugin
+func unpack(packed uint64) (ptr, size uint32) {
+	return uint32(packed >> 32), uint32(packed)
+}
+
+func sameTypes(types, expected []api.ValueType) bool {
+	if len(types) != len(expected) {
+		return false
+	}
+
+	for i := range types {
+		if types[i] != expected[i] {
+			return false
+		}
+	}
+
+	return true
+}
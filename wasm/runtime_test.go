@@ -0,0 +1,70 @@
+package wasm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tetratelabs/wazero/api"
+)
+
+// fakeDefinition is the definition of an exported function, only its signature is implemented
+type fakeDefinition struct {
+	api.FunctionDefinition
+	params  []api.ValueType
+	results []api.ValueType
+}
+
+func (definition *fakeDefinition) ParamTypes() []api.ValueType {
+	return definition.params
+}
+
+func (definition *fakeDefinition) ResultTypes() []api.ValueType {
+	return definition.results
+}
+
+func definition(name string) api.FunctionDefinition {
+	return &fakeDefinition{params: signatures[name][0], results: signatures[name][1]}
+}
+
+func TestCheckExports(t *testing.T) {
+	tests := []struct {
+		name    string
+		exports map[string]api.FunctionDefinition
+		valid   bool
+	}{
+		{"collector", map[string]api.FunctionDefinition{collectFunction: definition(collectFunction)}, true},
+		{"transform", map[string]api.FunctionDefinition{allocFunction: definition(allocFunction), transformFunction: definition(transformFunction)}, true},
+		{"transform without alloc", map[string]api.FunctionDefinition{transformFunction: definition(transformFunction)}, false},
+		{"handler", map[string]api.FunctionDefinition{allocFunction: definition(allocFunction), handleFunction: definition(handleFunction), commandsFunction: definition(commandsFunction)}, true},
+		{"handler without commands", map[string]api.FunctionDefinition{allocFunction: definition(allocFunction), handleFunction: definition(handleFunction)}, false},
+		{"nothing exported", map[string]api.FunctionDefinition{allocFunction: definition(allocFunction)}, false},
+		{"invalid signature", map[string]api.FunctionDefinition{collectFunction: &fakeDefinition{results: []api.ValueType{api.ValueTypeI32}}}, false},
+	}
+
+	for _, test := range tests {
+		plugin := &Plugin{Name: test.name, exports: test.exports}
+
+		if err := plugin.checkExports(); (err == nil) != test.valid {
+			t.Errorf("%s: expected valid=%t, got %v", test.name, test.valid, err)
+		}
+	}
+}
+
+func TestUnpack(t *testing.T) {
+	ptr, size := unpack(0x0001_0000_0000_0020)
+	if ptr != 0x10000 || size != 0x20 {
+		t.Errorf("expected the document at 0x10000 of 32 bytes, got %#x of %d bytes", ptr, size)
+	}
+}
+
+func TestNilRuntime(t *testing.T) {
+	var runtime *Runtime
+
+	if runtime.Collect(context.Background()) != nil || runtime.Diagnostics() != nil || runtime.Plugins() != nil {
+		t.Error("expected nothing from a disabled runtime")
+	}
+
+	if string(runtime.Transform(context.Background(), []byte(`{}`))) != `{}` {
+		t.Error("expected the document to be unchanged by a disabled runtime")
+	}
+}